@@ -75,6 +75,6 @@ func setCORSHeaders(w http.ResponseWriter, origin string, allowAll bool) {
 		w.Header().Set("Access-Control-Allow-Origin", origin)
 	}
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Authorization, MM-Authorization, Content-Type")
-	w.Header().Set("Access-Control-Expose-Headers", "X-Silent-Mode")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, MM-Authorization, Content-Type, Range, If-None-Match")
+	w.Header().Set("Access-Control-Expose-Headers", "X-Silent-Mode, X-Conversion-Warnings, X-Conversion-Warning-Details, ETag, Content-Range, X-Config-Signature, X-Config-Signature-Key-Id")
 }
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -14,8 +15,10 @@ import (
 	"miaomiaowu/internal/auth"
 	"miaomiaowu/internal/handler"
 	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/metrics"
 	"miaomiaowu/internal/proxygroups"
 	"miaomiaowu/internal/storage"
+	"miaomiaowu/internal/substore"
 	"miaomiaowu/internal/version"
 	"miaomiaowu/internal/web"
 	ruletemplates "miaomiaowu/rule_templates"
@@ -25,6 +28,12 @@ import (
 func main() {
 	// 初始化logger
 	logger.Init()
+
+	// 维护命令：server rotate-secrets 重新加密敏感数据后退出，不启动 HTTP 服务，可与运行中的面板并行执行
+	if len(os.Args) > 1 && os.Args[1] == "rotate-secrets" {
+		os.Exit(runRotateSecrets(filepath.Join("data", "traffic.db")))
+	}
+
 	logger.Info("喵喵屋服务器启动中", "version", version.Version)
 
 	// 启动日志清理任务（每天凌晨3点清理7天前的日志）
@@ -32,13 +41,79 @@ func main() {
 
 	addr := getAddr()
 
-	repo, err := storage.NewTrafficRepository(filepath.Join("data", "traffic.db"))
+	// 公开 ID 格式：uuid4（默认）或 uuid7
+	idGenerator, err := storage.IDGeneratorByName(os.Getenv("ID_FORMAT"))
+	if err != nil {
+		logger.Error("ID_FORMAT 配置无效", "error", err)
+		os.Exit(1)
+	}
+	storage.SetIDGenerator(idGenerator)
+
+	dbPath := filepath.Join("data", "traffic.db")
+
+	// 先启动 HTTP 监听：数据库迁移完成前只有 /api/health 可用，健康检查报告 migrating 而不是失败
+	storage.SetMigrationProgressHook(logMigrationProgress)
+	startupGate := handler.NewStartupGate()
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           startupGate,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		logger.Info("HTTP服务器启动", "version", version.Version, "address", addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("HTTP服务器运行失败", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	// 数据库副本：启动时按需从副本恢复，随后持续复制到本地路径或 S3
+	replicaConfig, err := replicaConfigFromEnv()
+	if err != nil {
+		logger.Error("数据库副本配置无效", "error", err)
+		os.Exit(1)
+	}
+	if restored, err := storage.RestoreReplica(context.Background(), replicaConfig, dbPath); err != nil {
+		logger.Error("从数据库副本恢复失败", "error", err)
+		os.Exit(1)
+	} else if restored {
+		logger.Info("已从数据库副本恢复", "mode", replicaConfig.Restore)
+	}
+
+	repo, err := storage.NewTrafficRepository(dbPath)
 	if err != nil {
 		logger.Error("流量数据库初始化失败", "error", err)
 		os.Exit(1)
 	}
 	defer repo.Close()
 
+	// 只读连接池：读多的列表和订阅查询分流到主库文件上的只读连接，写入始终走主库连接
+	if conns, err := readPoolConnsFromEnv(); err != nil {
+		logger.Error("只读连接池配置无效", "error", err)
+		os.Exit(1)
+	} else if conns > 0 {
+		if err := repo.AttachReadPool(context.Background(), dbPath, conns); err != nil {
+			logger.Error("只读连接池打开失败", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("只读连接池已启用", "conns", conns)
+	}
+
+	var replicator *storage.Replicator
+	if replicaConfig.Enabled() {
+		replicator, err = storage.NewReplicator(repo, dbPath, replicaConfig)
+		if err != nil {
+			logger.Error("数据库副本初始化失败", "error", err)
+			os.Exit(1)
+		}
+	}
+	replicaCtx, stopReplica := context.WithCancel(context.Background())
+	replicaDone := make(chan struct{})
+	go func() {
+		defer close(replicaDone)
+		handler.StartReplicator(replicaCtx, replicator)
+	}()
+
 	authManager, err := auth.NewManager(repo)
 	if err != nil {
 		logger.Error("认证管理器加载失败", "error", err)
@@ -86,8 +161,55 @@ func main() {
 		logger.Warn("加载系统配置失败", "error", err)
 	}
 
-	// 从远程拉取配置
-	data, resolvedURL, fetchErr := proxygroups.FetchConfig(systemConfig.ProxyGroupsSourceURL)
+	// 外部订阅拉取使用的全局出站代理
+	handler.SetGlobalFetchProxy(systemConfig.FetchProxy)
+
+	// 从定义文件加载插件转换类型，需在应用输出格式覆盖之前注册
+	producersDir := os.Getenv("PRODUCER_PLUGINS_DIR")
+	if producersDir == "" {
+		producersDir = filepath.Join("data", "producers")
+	}
+	registeredProducers, err := substore.RegisterProducersFromDir(producersDir)
+	if err != nil {
+		logger.Warn("[转换插件] 部分定义文件加载失败", "dir", producersDir, "error", err)
+	}
+	if len(registeredProducers) > 0 {
+		logger.Info("[转换插件] 已注册插件转换类型", "dir", producersDir, "targets", registeredProducers)
+	}
+
+	// 转换目标的 content type / 扩展名覆盖
+	handler.SetOutputFormatOverrides(systemConfig.OutputFormats)
+
+	// 慢操作日志阈值
+	metrics.SetSlowThreshold(time.Duration(systemConfig.SlowThresholdMs) * time.Millisecond)
+
+	// 订阅文件变更后清除 CDN（Cloudflare）缓存
+	handler.StartCDNPurger(repo)
+
+	// 离线模式：禁止所有出站请求，生成的地址均指向面板自身
+	airGapped := isAirGapped()
+	handler.SetAirGappedMode(airGapped)
+	handler.SetWebAuthnRelyingParty(os.Getenv("WEBAUTHN_RP_ID"), strings.Split(os.Getenv("WEBAUTHN_ORIGINS"), ","))
+	handler.SetPasswordResetBaseURL(os.Getenv("PANEL_BASE_URL"))
+	// 反向代理：只有来自 TRUSTED_PROXIES（逗号分隔的 IP 或 CIDR）和本机的请求才采信 X-Forwarded-* 头
+	if err := handler.SetTrustedProxies(strings.Split(os.Getenv("TRUSTED_PROXIES"), ",")); err != nil {
+		logger.Error("反向代理配置无效", "error", err)
+		os.Exit(1)
+	}
+	if airGapped {
+		logger.Info("离线模式已启用，已禁止访问外部网络")
+	}
+
+	// 从远程拉取配置（离线模式下读取本地文件）
+	var data []byte
+	var resolvedURL string
+	var fetchErr error
+	if airGapped {
+		resolvedURL = filepath.Join("proxy_groups", "proxy_groups.json")
+		data, fetchErr = os.ReadFile(resolvedURL)
+	} else {
+		data, resolvedURL, fetchErr = proxygroups.FetchConfig(systemConfig.ProxyGroupsSourceURL)
+	}
 	if fetchErr != nil {
 		logger.Warn("拉取代理组配置失败", "error", fetchErr)
 		// 远程拉取失败时使用空配置初始化
@@ -109,45 +231,128 @@ func main() {
 
 	syncSubscribeFilesToDatabase(repo, subscribeDir)
 
-	// 启动时初始化代理集合缓存
-	go handler.InitProxyProviderCacheOnStartup(repo)
-
-	// 启动代理集合定时同步器
+	// 代理集合缓存需要拉取外部订阅，离线模式下不启动
 	proxySyncCtx, stopProxySync := context.WithCancel(context.Background())
-	go handler.StartProxyProviderCacheSync(proxySyncCtx, repo)
+	if !airGapped {
+		// 启动时初始化代理集合缓存
+		go handler.InitProxyProviderCacheOnStartup(repo)
+
+		// 启动代理集合定时同步器
+		go handler.StartProxyProviderCacheSync(proxySyncCtx, repo)
+	}
+
+	// Webhook 事件分发，离线模式下投递会被跳过并记录为失败
+	webhookCtx, stopWebhooks := context.WithCancel(context.Background())
+	go handler.StartWebhookDispatcher(webhookCtx, repo)
+
+	// 实例间同步：定时从配置的主实例拉取节点池和订阅文件
+	federationCtx, stopFederation := context.WithCancel(context.Background())
+	go handler.StartFederationSync(federationCtx, repo)
+
+	// 地理数据库托管：按系统设置的间隔定时更新 GeoIP / GeoSite 等文件
+	geoDataCtx, stopGeoData := context.WithCancel(context.Background())
+	go handler.StartGeoDataUpdater(geoDataCtx, repo)
 
 	trafficHandler := handler.NewTrafficSummaryHandler(repo)
+	trafficCollector := handler.NewTrafficCollector(trafficHandler, repo)
+	liveTraffic := handler.NewLiveTrafficCollector(trafficHandler, repo)
 	userRepo := auth.NewRepositoryAdapter(repo)
 	loginRateLimiter := handler.NewLoginRateLimiter()
 
 	mux := http.NewServeMux()
+	mux.Handle("/api/health", handler.NewHealthHandler())
 	mux.Handle("/api/setup/status", handler.NewSetupStatusHandler(repo))
 	mux.Handle("/api/setup/init", handler.NewInitialSetupHandler(repo))
 	mux.Handle("/api/setup/restore-backup", handler.NewSetupRestoreBackupHandler(repo))
 	mux.Handle("/api/login", handler.NewLoginHandler(authManager, tokenStore, repo, loginRateLimiter))
+	mux.Handle("/api/login/code", handler.NewLoginCodeExchangeHandler(tokenStore, repo, loginRateLimiter))
+	mux.Handle("/api/login/passkey/", handler.NewPasskeyLoginHandler(tokenStore, repo, loginRateLimiter))
+	mux.Handle("/api/register", handler.NewRegisterHandler(repo, loginRateLimiter))
+	mux.Handle("/api/trial", handler.NewTrialRedeemHandler(repo, loginRateLimiter))
+	mux.Handle("/api/password/forgot", handler.NewForgotPasswordHandler(repo, loginRateLimiter))
+	mux.Handle("/api/password/reset", handler.NewResetPasswordHandler(tokenStore, repo, loginRateLimiter))
+	// 探针面板告警 Webhook，使用系统配置中的共享密钥鉴权
+	mux.Handle("/api/probe-alerts", handler.NewProbeAlertWebhookHandler(repo))
+	mux.Handle("/api/federation/export", handler.NewFederationExportHandler(repo))
 
 	// Admin-only endpoints
 	mux.Handle("/api/admin/credentials", auth.RequireAdmin(tokenStore, userRepo, handler.NewCredentialsHandler(authManager, tokenStore)))
+	mux.Handle("/api/admin/system-config", auth.RequireAdmin(tokenStore, userRepo, handler.NewSystemConfigHandler(repo)))
 	mux.Handle("/api/admin/users", auth.RequireAdmin(tokenStore, userRepo, handler.NewUserListHandler(repo)))
 	mux.Handle("/api/admin/users/create", auth.RequireAdmin(tokenStore, userRepo, handler.NewUserCreateHandler(repo)))
 	mux.Handle("/api/admin/users/delete", auth.RequireAdmin(tokenStore, userRepo, handler.NewUserDeleteHandler(repo)))
 	mux.Handle("/api/admin/users/status", auth.RequireAdmin(tokenStore, userRepo, handler.NewUserStatusHandler(repo)))
+	mux.Handle("/api/admin/users/unlock", auth.RequireAdmin(tokenStore, userRepo, handler.NewUserUnlockHandler(repo)))
 	mux.Handle("/api/admin/users/reset-password", auth.RequireAdmin(tokenStore, userRepo, handler.NewUserResetPasswordHandler(repo)))
 	mux.Handle("/api/admin/users/remark", auth.RequireAdmin(tokenStore, userRepo, handler.NewUserRemarkHandler(repo)))
+	mux.Handle("/api/admin/users/expiry", auth.RequireAdmin(tokenStore, userRepo, handler.NewUserExpiryHandler(repo)))
+	mux.Handle("/api/admin/users/expiring", auth.RequireAdmin(tokenStore, userRepo, handler.NewExpiringUsersHandler(repo)))
+	mux.Handle("/api/admin/stale-subscriptions", auth.RequireAdmin(tokenStore, userRepo, handler.NewStaleSubscriptionsHandler(repo)))
+	mux.Handle("/api/admin/kill-switch", auth.RequireAdmin(tokenStore, userRepo, handler.NewKillSwitchHandler(repo, tokenStore)))
+	mux.Handle("/api/admin/rule-cache", auth.RequireAdmin(tokenStore, userRepo, handler.NewRuleCacheAdminHandler(repo)))
+	mux.Handle("/api/admin/rule-cache/", auth.RequireAdmin(tokenStore, userRepo, handler.NewRuleCacheAdminHandler(repo)))
+	mux.Handle("/api/admin/geo-data", auth.RequireAdmin(tokenStore, userRepo, handler.NewGeoDataAdminHandler(repo)))
+	mux.Handle("/api/admin/geo-data/", auth.RequireAdmin(tokenStore, userRepo, handler.NewGeoDataAdminHandler(repo)))
+	mux.Handle("/api/admin/users/subscriptions/import", auth.RequireAdmin(tokenStore, userRepo, handler.NewUserSubscriptionsImportHandler(repo)))
+	mux.Handle("/api/admin/invitations", auth.RequireAdmin(tokenStore, userRepo, handler.NewInvitationsHandler(repo)))
+	mux.Handle("/api/admin/trial-links", auth.RequireAdmin(tokenStore, userRepo, handler.NewTrialLinksHandler(repo)))
+	mux.Handle("/api/admin/registrations", auth.RequireAdmin(tokenStore, userRepo, handler.NewRegistrationApprovalsHandler(repo)))
+	mux.Handle("/api/admin/registrations/", auth.RequireAdmin(tokenStore, userRepo, handler.NewRegistrationApprovalsHandler(repo)))
 	mux.Handle("/api/admin/users/", auth.RequireAdmin(tokenStore, userRepo, handler.NewUserSubscriptionsHandler(repo)))
+	mux.Handle("/api/admin/notifications/announce", auth.RequireAdmin(tokenStore, userRepo, handler.NewNotificationAnnounceHandler(repo)))
 	mux.Handle("/api/admin/subscriptions", auth.RequireAdmin(tokenStore, userRepo, handler.NewSubscriptionAdminHandler(subscribeDir, repo)))
 	mux.Handle("/api/admin/subscriptions/", auth.RequireAdmin(tokenStore, userRepo, handler.NewSubscriptionAdminHandler(subscribeDir, repo)))
 	mux.Handle("/api/admin/subscribe-files", auth.RequireAdmin(tokenStore, userRepo, handler.NewSubscribeFilesHandler(repo)))
 	mux.Handle("/api/admin/subscribe-files/", auth.RequireAdmin(tokenStore, userRepo, handler.NewSubscribeFilesHandler(repo)))
+	// 大文件分片上传（会话状态保存在内存中，两个路由共用同一个实例）
+	chunkedUploadHandler := auth.RequireAdmin(tokenStore, userRepo, handler.NewChunkedUploadHandler(repo, filepath.Join("data", "uploads")))
+	mux.Handle("/api/admin/uploads", chunkedUploadHandler)
+	mux.Handle("/api/admin/uploads/", chunkedUploadHandler)
+	findReplaceHandler := handler.NewFindReplaceHandler(repo, subscribeDir)
+	mux.Handle("/api/admin/find-replace", auth.RequireAdmin(tokenStore, userRepo, findReplaceHandler))
+	mux.Handle("/api/admin/find-replace/", auth.RequireAdmin(tokenStore, userRepo, findReplaceHandler))
 	mux.Handle("/api/admin/probe-config", auth.RequireAdmin(tokenStore, userRepo, handler.NewProbeConfigHandler(repo)))
-	mux.Handle("/api/admin/probe-sync", auth.RequireAdmin(tokenStore, userRepo, handler.NewProbeSyncHandler(repo)))
+	probeConfigsHandler := handler.NewProbeConfigsHandler(repo)
+	mux.Handle("/api/admin/probe-configs", auth.RequireAdmin(tokenStore, userRepo, probeConfigsHandler))
+	mux.Handle("/api/admin/probe-configs/", auth.RequireAdmin(tokenStore, userRepo, probeConfigsHandler))
+	mux.Handle("/api/admin/probe-push", auth.RequireAdmin(tokenStore, userRepo, handler.NewProbePushHandler(repo)))
+	probeAnnotationsHandler := handler.NewProbeAnnotationsHandler(repo)
+	mux.Handle("/api/admin/probe-annotations", auth.RequireAdmin(tokenStore, userRepo, probeAnnotationsHandler))
+	mux.Handle("/api/admin/probe-annotations/sync", auth.RequireAdmin(tokenStore, userRepo, probeAnnotationsHandler))
+	servedSnapshotsHandler := handler.NewServedSnapshotsHandler(repo)
+	mux.Handle("/api/admin/served-snapshots", auth.RequireAdmin(tokenStore, userRepo, servedSnapshotsHandler))
+	mux.Handle("/api/admin/served-snapshots/", auth.RequireAdmin(tokenStore, userRepo, servedSnapshotsHandler))
+	federationPeersHandler := handler.NewFederationPeersHandler(repo)
+	mux.Handle("/api/admin/federation/peers", auth.RequireAdmin(tokenStore, userRepo, federationPeersHandler))
+	mux.Handle("/api/admin/federation/peers/", auth.RequireAdmin(tokenStore, userRepo, federationPeersHandler))
+	federationUpstreamHandler := handler.NewFederationUpstreamHandler(repo)
+	mux.Handle("/api/admin/federation/upstream", auth.RequireAdmin(tokenStore, userRepo, federationUpstreamHandler))
+	mux.Handle("/api/admin/federation/upstream/", auth.RequireAdmin(tokenStore, userRepo, federationUpstreamHandler))
+	replicationHandler := handler.NewReplicationHandler(repo, replicator)
+	mux.Handle("/api/admin/replication", auth.RequireAdmin(tokenStore, userRepo, replicationHandler))
+	mux.Handle("/api/admin/replication/", auth.RequireAdmin(tokenStore, userRepo, replicationHandler))
+	grafanaHandler := handler.NewGrafanaDatasourceHandler(repo)
+	mux.Handle("/api/grafana", grafanaHandler)
+	mux.Handle("/api/grafana/", grafanaHandler)
+	mux.Handle("/api/admin/probe-alerts", auth.RequireAdmin(tokenStore, userRepo, handler.NewProbeAlertsHandler(repo)))
+	mux.Handle("/api/admin/probe-sync", handler.OnlineOnly(auth.RequireAdmin(tokenStore, userRepo, handler.NewProbeSyncHandler(repo))))
+	// 节点部署（SSH / agent 运行安装脚本并登记节点，DNS 凭据用于签发证书）为可选模块，需设置 NODE_DEPLOYMENT_ENABLED=true 启用
+	if nodeDeploymentEnabled, _ := strconv.ParseBool(strings.TrimSpace(os.Getenv("NODE_DEPLOYMENT_ENABLED"))); nodeDeploymentEnabled {
+		nodeDeploymentsHandler := handler.OnlineOnly(auth.RequireAdmin(tokenStore, userRepo, handler.NewNodeDeploymentsHandler(repo)))
+		mux.Handle("/api/admin/node-deployments", nodeDeploymentsHandler)
+		mux.Handle("/api/admin/node-deployments/", nodeDeploymentsHandler)
+		mux.Handle("/api/node-deployments/report", handler.NewNodeDeploymentReportHandler(repo))
+		dnsCredentialsHandler := auth.RequireAdmin(tokenStore, userRepo, handler.NewDNSCredentialsHandler(repo))
+		mux.Handle("/api/admin/dns-credentials", dnsCredentialsHandler)
+		mux.Handle("/api/admin/dns-credentials/", dnsCredentialsHandler)
+	}
 	mux.Handle("/api/admin/rules/", auth.RequireAdmin(tokenStore, userRepo, http.StripPrefix("/api/admin/rules/", handler.NewRuleEditorHandler(subscribeDir, repo))))
-	mux.Handle("/api/admin/rule-templates", auth.RequireAdmin(tokenStore, userRepo, handler.NewRuleTemplatesHandler()))
-	mux.Handle("/api/admin/rule-templates/", auth.RequireAdmin(tokenStore, userRepo, handler.NewRuleTemplatesHandler()))
+	mux.Handle("/api/admin/rule-templates", auth.RequireAdmin(tokenStore, userRepo, handler.NewRuleTemplatesHandler(repo)))
+	mux.Handle("/api/admin/rule-templates/", auth.RequireAdmin(tokenStore, userRepo, handler.NewRuleTemplatesHandler(repo)))
 	mux.Handle("/api/admin/nodes", auth.RequireAdmin(tokenStore, userRepo, handler.NewNodesHandler(repo, subscribeDir)))
 	mux.Handle("/api/admin/nodes/", auth.RequireAdmin(tokenStore, userRepo, handler.NewNodesHandler(repo, subscribeDir)))
-	mux.Handle("/api/admin/sync-external-subscriptions", auth.RequireAdmin(tokenStore, userRepo, handler.NewSyncExternalSubscriptionsHandler(repo, subscribeDir)))
-	mux.Handle("/api/admin/sync-external-subscription", auth.RequireAdmin(tokenStore, userRepo, handler.NewSyncSingleExternalSubscriptionHandler(repo, subscribeDir)))
+	mux.Handle("/api/admin/sync-external-subscriptions", handler.OnlineOnly(auth.RequireAdmin(tokenStore, userRepo, handler.NewSyncExternalSubscriptionsHandler(repo, subscribeDir))))
+	mux.Handle("/api/admin/sync-external-subscription", handler.OnlineOnly(auth.RequireAdmin(tokenStore, userRepo, handler.NewSyncSingleExternalSubscriptionHandler(repo, subscribeDir))))
 	mux.Handle("/api/admin/rules/latest", auth.RequireAdmin(tokenStore, userRepo, handler.NewRuleMetadataHandler(subscribeDir, repo)))
 	mux.Handle("/api/admin/custom-rules", auth.RequireAdmin(tokenStore, userRepo, handler.NewCustomRulesHandler(repo)))
 	mux.Handle("/api/admin/custom-rules/", auth.RequireAdmin(tokenStore, userRepo, handler.NewCustomRuleHandler(repo)))
@@ -155,45 +360,103 @@ func main() {
 	mux.Handle("/api/admin/templates", auth.RequireAdmin(tokenStore, userRepo, handler.NewTemplatesHandler(repo)))
 	mux.Handle("/api/admin/templates/", auth.RequireAdmin(tokenStore, userRepo, handler.NewTemplateHandler(repo)))
 	mux.Handle("/api/admin/templates/convert", auth.RequireAdmin(tokenStore, userRepo, handler.NewTemplateConvertHandler()))
-	mux.Handle("/api/admin/templates/fetch-source", auth.RequireAdmin(tokenStore, userRepo, handler.NewTemplateFetchSourceHandler()))
+	mux.Handle("/api/admin/templates/fetch-source", handler.OnlineOnly(auth.RequireAdmin(tokenStore, userRepo, handler.NewTemplateFetchSourceHandler())))
 	mux.Handle("/api/admin/backup/download", auth.RequireAdmin(tokenStore, userRepo, handler.NewBackupDownloadHandler(repo)))
 	mux.Handle("/api/admin/backup/restore", auth.RequireAdmin(tokenStore, userRepo, handler.NewBackupRestoreHandler(repo)))
-	mux.Handle("/api/admin/update/check", auth.RequireAdmin(tokenStore, userRepo, handler.NewUpdateCheckHandler()))
-	mux.Handle("/api/admin/update/apply", auth.RequireAdmin(tokenStore, userRepo, handler.NewUpdateApplyHandler()))
-	mux.Handle("/api/admin/update/apply-sse", auth.RequireAdmin(tokenStore, userRepo, handler.NewUpdateApplySSEHandler()))
-	mux.Handle("/api/admin/proxy-groups/sync", auth.RequireAdmin(tokenStore, userRepo, handler.NewProxyGroupsSyncHandler(repo, proxyGroupsStore)))
+	mux.Handle("/api/admin/update/check", handler.OnlineOnly(auth.RequireAdmin(tokenStore, userRepo, handler.NewUpdateCheckHandler())))
+	mux.Handle("/api/admin/update/apply", handler.OnlineOnly(auth.RequireAdmin(tokenStore, userRepo, handler.NewUpdateApplyHandler())))
+	mux.Handle("/api/admin/update/apply-sse", handler.OnlineOnly(auth.RequireAdmin(tokenStore, userRepo, handler.NewUpdateApplySSEHandler())))
+	mux.Handle("/api/admin/proxy-groups/sync", handler.OnlineOnly(auth.RequireAdmin(tokenStore, userRepo, handler.NewProxyGroupsSyncHandler(repo, proxyGroupsStore))))
 
 	// TCPing endpoint (admin only)
-	mux.Handle("/api/admin/tcping", auth.RequireAdmin(tokenStore, userRepo, handler.NewTCPingHandler()))
-	mux.Handle("/api/admin/tcping/batch", auth.RequireAdmin(tokenStore, userRepo, handler.NewTCPingBatchHandler()))
+	mux.Handle("/api/admin/tcping", auth.RequireAdmin(tokenStore, userRepo, handler.NewTCPingHandler(repo)))
+	mux.Handle("/api/admin/tcping/batch", auth.RequireAdmin(tokenStore, userRepo, handler.NewTCPingBatchHandler(repo)))
 
 	// User endpoints (all authenticated users)
 	mux.Handle("/api/proxy-groups", auth.RequireToken(tokenStore, handler.NewProxyGroupsHandler(proxyGroupsStore)))
 	mux.Handle("/api/user/password", auth.RequireToken(tokenStore, handler.NewPasswordHandler(authManager)))
+	mux.Handle("/api/user/login-code", auth.RequireToken(tokenStore, handler.NewLoginCodeHandler(repo)))
+	passkeysHandler := handler.NewPasskeysHandler(repo)
+	mux.Handle("/api/user/passkeys", auth.RequireToken(tokenStore, passkeysHandler))
+	mux.Handle("/api/user/passkeys/", auth.RequireToken(tokenStore, passkeysHandler))
 	mux.Handle("/api/user/profile", auth.RequireToken(tokenStore, handler.NewProfileHandler(repo)))
 	mux.Handle("/api/user/settings", auth.RequireToken(tokenStore, handler.NewUserSettingsHandler(repo, tokenStore)))
+	mux.Handle("/api/user/avatar", auth.RequireToken(tokenStore, handler.NewAvatarUploadHandler(repo)))
+	mux.Handle("/api/avatars/", handler.NewAvatarServeHandler())
 	mux.Handle("/api/user/config", auth.RequireToken(tokenStore, handler.NewUserConfigHandler(repo)))
+	mux.Handle("/api/user/nodes", auth.RequireToken(tokenStore, handler.NewUserNodesHandler(repo, subscribeDir)))
+	mux.Handle("/api/user/preferences", auth.RequireToken(tokenStore, handler.NewUserPreferencesHandler(repo)))
+	notificationsHandler := handler.NewNotificationsHandler(repo)
+	mux.Handle("/api/user/notifications", auth.RequireToken(tokenStore, notificationsHandler))
+	mux.Handle("/api/user/notifications/", auth.RequireToken(tokenStore, notificationsHandler))
 	mux.Handle("/api/user/token", auth.RequireToken(tokenStore, handler.NewUserTokenHandler(repo)))
+	mux.Handle("/api/user/tokens", auth.RequireToken(tokenStore, handler.NewUserNamedTokensHandler(repo)))
+	mux.Handle("/api/user/node-pool/trend", auth.RequireScope(tokenStore, auth.ScopeTrafficRead, handler.NewNodePoolTrendHandler(repo)))
+	mux.Handle("/api/user/probe-status", auth.RequireScope(tokenStore, auth.ScopeNodeStatusRead, handler.NewProbeStatusHandler(repo)))
+	mux.Handle("/api/user/embed-tokens", auth.RequireToken(tokenStore, handler.NewEmbedTokenHandler(tokenStore)))
 	mux.Handle("/api/user/external-subscriptions", auth.RequireToken(tokenStore, handler.NewExternalSubscriptionsHandler(repo)))
 	mux.Handle("/api/user/external-subscriptions/nodes", auth.RequireToken(tokenStore, handler.NewExternalSubscriptionNodesHandler(repo)))
 	mux.Handle("/api/user/external-subscriptions/check-filter", auth.RequireToken(tokenStore, handler.NewExternalSubscriptionCheckFilterHandler(repo)))
+	mux.Handle("/api/external-subscriptions/", auth.RequireToken(tokenStore, handler.NewExternalSubscriptionDiffHandler(repo)))
 	mux.Handle("/api/user/proxy-provider-configs", auth.RequireToken(tokenStore, handler.NewProxyProviderConfigsHandler(repo)))
-	mux.Handle("/api/user/proxy-provider-cache/refresh", auth.RequireToken(tokenStore, handler.NewProxyProviderCacheRefreshHandler(repo)))
+	mux.Handle("/api/user/proxy-provider-cache/refresh", handler.OnlineOnly(auth.RequireToken(tokenStore, handler.NewProxyProviderCacheRefreshHandler(repo))))
 	mux.Handle("/api/user/proxy-provider-cache/status", auth.RequireToken(tokenStore, handler.NewProxyProviderCacheStatusHandler(repo)))
 	mux.Handle("/api/user/proxy-provider-nodes", auth.RequireToken(tokenStore, handler.NewProxyProviderNodesHandler(repo)))
 	mux.Handle("/api/proxy-provider/", handler.NewProxyProviderServeHandler(repo))
+	mux.Handle("/api/offline/", handler.NewOfflineAssetHandler())
+	mux.Handle("/api/rule-cache/", handler.NewRuleCacheHandler(repo))
+	mux.Handle("/api/geo/", handler.NewGeoDataHandler(repo))
 
 	// Debug日志相关endpoint
 	mux.Handle("/api/user/debug/", auth.RequireToken(tokenStore, handler.NewDebugHandler(repo)))
 
-	mux.Handle("/api/traffic/summary", auth.RequireToken(tokenStore, trafficHandler))
+	mux.Handle("/api/traffic/summary", auth.RequireScope(tokenStore, auth.ScopeTrafficRead, trafficHandler))
+	mux.Handle("/api/traffic/live", auth.RequireScope(tokenStore, auth.ScopeTrafficRead, handler.NewLiveTrafficHandler(repo)))
+	mux.Handle("/api/traffic/servers/", auth.RequireAdmin(tokenStore, userRepo, handler.NewProbeServerHistoryHandler(repo)))
+	trafficCollectorHandler := handler.NewTrafficCollectorHandler(repo, trafficCollector)
+	mux.Handle("/api/admin/traffic-collector", auth.RequireAdmin(tokenStore, userRepo, trafficCollectorHandler))
+	mux.Handle("/api/admin/traffic-collector/collect", auth.RequireAdmin(tokenStore, userRepo, trafficCollectorHandler))
+	mux.Handle("/api/admin/traffic-collector/runs", auth.RequireAdmin(tokenStore, userRepo, trafficCollectorHandler))
+	trafficAlertRulesHandler := handler.NewTrafficAlertRulesHandler(repo)
+	mux.Handle("/api/admin/traffic-alerts", auth.RequireAdmin(tokenStore, userRepo, trafficAlertRulesHandler))
+	mux.Handle("/api/admin/traffic-alerts/", auth.RequireAdmin(tokenStore, userRepo, trafficAlertRulesHandler))
+	nodeTagRulesHandler := handler.NewNodeTagRulesHandler(repo)
+	mux.Handle("/api/admin/node-tag-rules", auth.RequireAdmin(tokenStore, userRepo, nodeTagRulesHandler))
+	mux.Handle("/api/admin/node-tag-rules/", auth.RequireAdmin(tokenStore, userRepo, nodeTagRulesHandler))
+	contentSigningHandler := handler.NewContentSigningHandler(repo)
+	mux.Handle("/api/admin/content-signing", auth.RequireAdmin(tokenStore, userRepo, contentSigningHandler))
+	mux.Handle("/api/admin/content-signing/rotate", auth.RequireAdmin(tokenStore, userRepo, contentSigningHandler))
+	webhooksHandler := handler.NewWebhooksHandler(repo)
+	mux.Handle("/api/admin/webhooks", auth.RequireAdmin(tokenStore, userRepo, webhooksHandler))
+	mux.Handle("/api/admin/webhooks/", auth.RequireAdmin(tokenStore, userRepo, webhooksHandler))
+
+	smtpSettingsHandler := handler.NewSMTPSettingsHandler(repo)
+	mux.Handle("/api/admin/smtp", auth.RequireAdmin(tokenStore, userRepo, smtpSettingsHandler))
+	mux.Handle("/api/admin/smtp/test", auth.RequireAdmin(tokenStore, userRepo, smtpSettingsHandler))
+	ldapSettingsHandler := handler.NewLDAPSettingsHandler(repo)
+	mux.Handle("/api/admin/ldap", auth.RequireAdmin(tokenStore, userRepo, ldapSettingsHandler))
+	mux.Handle("/api/admin/ldap/test", auth.RequireAdmin(tokenStore, userRepo, ldapSettingsHandler))
+	mux.Handle("/api/admin/audit", auth.RequireAdmin(tokenStore, userRepo, handler.NewAuditLogHandler(repo)))
+	mux.Handle("/api/admin/metrics", auth.RequireAdmin(tokenStore, userRepo, handler.NewMetricsHandler()))
+
+	cdnSettingsHandler := handler.NewCDNSettingsHandler(repo)
+	mux.Handle("/api/admin/cdn", auth.RequireAdmin(tokenStore, userRepo, cdnSettingsHandler))
+	mux.Handle("/api/admin/cdn/purge", auth.RequireAdmin(tokenStore, userRepo, cdnSettingsHandler))
 	mux.Handle("/api/subscriptions", auth.RequireToken(tokenStore, handler.NewSubscriptionListHandler(repo)))
+	mux.Handle("/api/search", auth.RequireToken(tokenStore, handler.NewSearchHandler(repo)))
 	mux.Handle("/api/dns/resolve", auth.RequireToken(tokenStore, handler.NewDNSHandler()))
 	mux.Handle("/api/subscribe-files", auth.RequireToken(tokenStore, handler.NewSubscribeFilesListHandler(repo)))
 
 	// Create subscription handler (shared between endpoint and short links)
 	subscriptionHandler := handler.NewSubscriptionHandlerConcrete(repo, subscribeDir)
-	mux.Handle("/api/clash/subscribe", handler.NewSubscriptionEndpoint(tokenStore, repo, subscribeDir))
+	mux.Handle("/api/clash/subscribe", handler.AccessLog("subscribe", handler.NewSubscriptionEndpoint(tokenStore, repo, subscribeDir)))
+	mux.Handle("/api/user/config-bundle", auth.RequireToken(tokenStore, handler.NewConfigBundleHandler(repo, subscriptionHandler)))
+	mux.Handle("/api/convert", auth.RequireToken(tokenStore, handler.NewConvertHandler(subscriptionHandler)))
+	mux.Handle("/api/convert/batch", auth.RequireToken(tokenStore, handler.NewConvertBatchHandler(subscriptionHandler)))
+	mux.Handle("/api/convert/parse", auth.RequireToken(tokenStore, handler.NewConvertParseHandler()))
+	mux.Handle("/api/convert/targets", auth.RequireToken(tokenStore, handler.NewConvertTargetsHandler()))
+	mux.Handle("/api/admin/subscribe-files/test-matrix", auth.RequireAdmin(tokenStore, userRepo, handler.NewConversionMatrixHandler(repo, subscriptionHandler)))
+	mux.Handle("/api/content-signing/public-key", handler.NewContentSigningPublicKeyHandler(repo))
 
 	// Short link reset endpoint (authenticated)
 	mux.Handle("/api/user/short-link", auth.RequireToken(tokenStore, handler.NewShortLinkResetHandler(repo)))
@@ -227,27 +490,110 @@ func main() {
 
 	// 静默模式中间件
 	silentModeManager := handler.NewSilentModeManager(repo, tokenStore)
-	handlerWithSilentMode := silentModeManager.Middleware(mux)
+	// 审计日志中间件：记录所有成功的管理员写操作
+	handlerWithAudit := handler.AuditAdminActions(tokenStore, repo, mux)
+	handlerWithSilentMode := silentModeManager.Middleware(handlerWithAudit)
 	handlerWithCORS := withCORS(handlerWithSilentMode, allowedOrigins)
 
-	srv := &http.Server{
-		Addr:              addr,
-		Handler:           handlerWithCORS,
-		ReadHeaderTimeout: 5 * time.Second,
+	collectorCtx, stopCollector := context.WithCancel(context.Background())
+	go trafficCollector.Run(collectorCtx)
+
+	liveCtx, stopLive := context.WithCancel(context.Background())
+	go liveTraffic.Run(liveCtx)
+
+	dailyCtx, stopDaily := context.WithCancel(context.Background())
+	go startDailyJobs(dailyCtx, repo)
+
+	scheduleCtx, stopSchedule := context.WithCancel(context.Background())
+	go handler.StartNodeScheduler(scheduleCtx, repo, subscribeDir)
+
+	startupGate.Ready(handler.WithRequestID(handler.Metrics(handlerWithCORS)))
+	logger.Info("服务启动完成，开始处理请求", "address", addr)
+
+	waitForShutdown(srv, stopCollector, stopLive, stopDaily, stopSchedule, stopProxySync, stopWebhooks, stopFederation, stopGeoData, stopReplica)
+
+	// 等待副本完成关闭前的最后一次同步后再关闭数据库
+	<-replicaDone
+}
+
+// logMigrationProgress 输出启动迁移的状态变化和耗时较长的步骤
+func logMigrationProgress(progress storage.MigrationProgress) {
+	switch progress.State {
+	case storage.MigrationStateWaiting:
+		logger.Info("[数据库迁移] 另一个实例正在迁移，等待迁移锁", "holder", progress.LockOwner)
+	case storage.MigrationStateRunning:
+		if progress.Step == "schema" {
+			logger.Info("[数据库迁移] 开始检查并迁移数据库结构")
+		} else {
+			logger.Info("[数据库迁移] 正在重建数据表", "step", progress.Step, "rows", progress.Rows,
+				"elapsed", time.Since(progress.StartedAt).Round(time.Millisecond).String())
+		}
+	case storage.MigrationStateReady:
+		logger.Info("[数据库迁移] 数据库结构已是最新", "elapsed", time.Since(progress.StartedAt).Round(time.Millisecond).String())
+	case storage.MigrationStateFailed:
+		logger.Error("[数据库迁移] 迁移失败", "error", progress.Error)
 	}
+}
 
-	collectorCtx, stopCollector := context.WithCancel(context.Background())
-	go startTrafficCollector(collectorCtx, trafficHandler)
+// readPoolConnsFromEnv 读取只读连接池大小：DB_READ_POOL_CONNS 为主库文件上只读连接池的最大连接数，
+// 未设置时不启用。只读连接与主库共用同一个 WAL 文件，写入提交后立即可读
+func readPoolConnsFromEnv() (int, error) {
+	raw := strings.TrimSpace(os.Getenv("DB_READ_POOL_CONNS"))
+	if raw == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return 0, errors.New("DB_READ_POOL_CONNS 必须是正整数")
+	}
+	return n, nil
+}
 
-	go func() {
-		logger.Info("HTTP服务器启动", "version", version.Version, "address", addr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Error("HTTP服务器运行失败", "error", err)
-			os.Exit(1)
+// replicaConfigFromEnv 读取数据库副本配置：
+// DB_REPLICA_URL（目录、file:///dir 或 s3://bucket/prefix）、DB_REPLICA_INTERVAL（如 10s）、
+// DB_REPLICA_RETAIN（保留快照数）、DB_REPLICA_RESTORE（if-missing / always）、
+// DB_REPLICA_SKIP_SECRET_KEY、DB_REPLICA_S3_ENDPOINT / DB_REPLICA_S3_REGION / DB_REPLICA_S3_PATH_STYLE
+// 以及 AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY
+func replicaConfigFromEnv() (storage.ReplicaConfig, error) {
+	cfg := storage.ReplicaConfig{
+		URL:         strings.TrimSpace(os.Getenv("DB_REPLICA_URL")),
+		S3Endpoint:  strings.TrimSpace(os.Getenv("DB_REPLICA_S3_ENDPOINT")),
+		S3Region:    strings.TrimSpace(os.Getenv("DB_REPLICA_S3_REGION")),
+		S3AccessKey: strings.TrimSpace(os.Getenv("AWS_ACCESS_KEY_ID")),
+		S3SecretKey: strings.TrimSpace(os.Getenv("AWS_SECRET_ACCESS_KEY")),
+	}
+	if cfg.S3Region == "" {
+		cfg.S3Region = strings.TrimSpace(os.Getenv("AWS_REGION"))
+	}
+	cfg.S3PathStyle, _ = strconv.ParseBool(strings.TrimSpace(os.Getenv("DB_REPLICA_S3_PATH_STYLE")))
+	cfg.SkipSecretKey, _ = strconv.ParseBool(strings.TrimSpace(os.Getenv("DB_REPLICA_SKIP_SECRET_KEY")))
+
+	if raw := strings.TrimSpace(os.Getenv("DB_REPLICA_INTERVAL")); raw != "" {
+		interval, err := time.ParseDuration(raw)
+		if err != nil || interval < time.Second {
+			return cfg, errors.New("DB_REPLICA_INTERVAL 必须是不小于 1s 的时长")
 		}
-	}()
+		cfg.Interval = interval
+	}
+	if raw := strings.TrimSpace(os.Getenv("DB_REPLICA_RETAIN")); raw != "" {
+		retain, err := strconv.Atoi(raw)
+		if err != nil || retain < 1 {
+			return cfg, errors.New("DB_REPLICA_RETAIN 必须是正整数")
+		}
+		cfg.Retain = retain
+	}
+	mode, err := storage.ValidateReplicaRestoreMode(os.Getenv("DB_REPLICA_RESTORE"))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Restore = mode
+	return cfg, nil
+}
 
-	waitForShutdown(srv, stopCollector, stopProxySync)
+// isAirGapped 读取 AIR_GAPPED 环境变量（1/true 开启离线模式）
+func isAirGapped() bool {
+	enabled, _ := strconv.ParseBool(strings.TrimSpace(os.Getenv("AIR_GAPPED")))
+	return enabled
 }
 
 func getAddr() string {
@@ -292,65 +638,64 @@ func waitForShutdown(srv *http.Server, cancels ...context.CancelFunc) {
 	}
 }
 
-func startTrafficCollector(ctx context.Context, trafficHandler *handler.TrafficSummaryHandler) {
-	if trafficHandler == nil {
+// startDailyJobs 每日执行的后台任务：记录节点池构成快照、检查订阅到期提醒
+func startDailyJobs(ctx context.Context, repo *storage.TrafficRepository) {
+	if repo == nil {
 		return
 	}
 
-	// 带重试的流量收集函数
-	runWithRetry := func() {
-		logger.Info("[流量收集器] 开始每日流量收集", "start_time", time.Now().Format("2006-01-02 15:04:05"))
-
-		maxRetries := 3
-		retryDelay := 30 * time.Second
-
-		for attempt := 1; attempt <= maxRetries; attempt++ {
-			runCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-			err := trafficHandler.RecordDailyUsage(runCtx)
-			cancel()
-
-			if err == nil {
-				logger.Info("[流量收集器] 每日流量收集成功")
-				return
-			}
-
-			logger.Warn("[流量收集器] 每日流量收集失败", "attempt", attempt, "max_retries", maxRetries, "error", err)
-
-			// 如果是探针配置未找到错误，不需要重试
-			if errors.Is(err, storage.ErrProbeConfigNotFound) {
-				logger.Info("[流量收集器] 探针未配置，跳过重试")
-				return
-			}
-
-			if attempt < maxRetries {
-				logger.Info("[流量收集器] 准备重试", "delay", retryDelay)
-				select {
-				case <-ctx.Done():
-					logger.Info("[流量收集器] 重试已取消（服务器关闭）")
-					return
-				case <-time.After(retryDelay):
-					// 继续重试
-				}
-			}
+	record := func() {
+		runCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		defer cancel()
+		if err := handler.RecordNodePoolSnapshots(runCtx, repo); err != nil {
+			logger.Error("[节点池快照] 记录快照失败", "error", err)
+		}
+		// 每日检查即将到期的外部订阅并写入站内通知
+		if err := handler.NotifyExpiringSubscriptions(runCtx, repo); err != nil {
+			logger.Error("[通知] 检查订阅到期失败", "error", err)
+		}
+		if err := handler.PruneAuditLog(runCtx, repo); err != nil {
+			logger.Error("[审计日志] 清理过期记录失败", "error", err)
+		}
+		if err := handler.PruneSubscriptionPulls(runCtx, repo); err != nil {
+			logger.Error("[订阅统计] 清理过期记录失败", "error", err)
+		}
+		if err := handler.PruneSubscriptionClientIPs(runCtx, repo); err != nil {
+			logger.Error("[订阅统计] 清理过期的客户端 IP 失败", "error", err)
+		}
+		if err := handler.PruneRuleCache(runCtx, repo); err != nil {
+			logger.Error("[规则缓存] 清理长时间未使用的缓存失败", "error", err)
+		}
+		// 通知管理员原本每天拉取、最近长时间未拉取的订阅
+		if err := handler.NotifyStaleSubscriptions(runCtx, repo); err != nil {
+			logger.Error("[订阅统计] 检查长时间未拉取的订阅失败", "error", err)
+		}
+		// 先删除到期的试用账号，再停用其他已到期的账号，并提醒即将到期的用户
+		if err := handler.CleanupExpiredTrialAccounts(runCtx, repo); err != nil {
+			logger.Error("[试用账号] 清理到期试用账号失败", "error", err)
+		}
+		if err := handler.DeactivateExpiredUsers(runCtx, repo); err != nil {
+			logger.Error("[账号到期] 停用到期账号失败", "error", err)
+		}
+		if err := handler.NotifyExpiringUsers(runCtx, repo); err != nil {
+			logger.Error("[账号到期] 检查即将到期账号失败", "error", err)
 		}
-
-		logger.Error("[流量收集器] 达到最大重试次数后仍失败", "max_retries", maxRetries)
 	}
 
-	runWithRetry()
+	record()
 
 	ticker := time.NewTicker(24 * time.Hour)
 	defer ticker.Stop()
 
-	logger.Info("[流量收集器] 定时调度器已启动", "interval", "24小时")
+	logger.Info("[每日任务] 定时调度器已启动", "interval", "24小时")
 
 	for {
 		select {
 		case <-ctx.Done():
-			logger.Info("[流量收集器] 定时调度器已停止")
+			logger.Info("[每日任务] 定时调度器已停止")
 			return
 		case <-ticker.C:
-			runWithRetry()
+			record()
 		}
 	}
 }
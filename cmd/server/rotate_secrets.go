@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+// runRotateSecrets 维护命令 rotate-secrets：用当前 SECRET_KEY 重新加密仍由旧密钥加密的敏感数据，返回进程退出码。
+// 轮换步骤：所有实例改用新的 SECRET_KEY 并把旧密钥放入 SECRET_KEY_PREVIOUS 后执行一次（面板无需停机），
+// 成功后即可移除 SECRET_KEY_PREVIOUS。
+func runRotateSecrets(dbPath string) int {
+	repo, err := storage.NewTrafficRepository(dbPath)
+	if err != nil {
+		logger.Error("流量数据库初始化失败", "error", err)
+		return 1
+	}
+	defer repo.Close()
+
+	reencrypted, unreadable, err := repo.ReencryptSecrets(context.Background())
+	if err != nil {
+		logger.Error("重新加密敏感数据失败", "error", err)
+		return 1
+	}
+	logger.Info("[密钥轮换] 已用当前密钥重新加密敏感数据", "count", reencrypted)
+	if unreadable > 0 {
+		logger.Warn("[密钥轮换] 部分敏感数据无法用已配置的密钥解密，请在 SECRET_KEY_PREVIOUS 中加入旧密钥后重试", "count", unreadable)
+		return 1
+	}
+	return 0
+}
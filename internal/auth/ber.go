@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// LDAP 使用的 BER 编码的最小实现：只支持单字节标签和定长长度，足够完成绑定与搜索。
+
+const (
+	berClassApplication = 0x40
+	berClassContext     = 0x80
+	berConstructed      = 0x20
+
+	berTagBoolean     = 0x01
+	berTagInteger     = 0x02
+	berTagOctetString = 0x04
+	berTagEnumerated  = 0x0a
+	berTagSequence    = 0x30
+	berTagSet         = 0x31
+
+	// berMaxLength LDAP 响应单个元素的长度上限，防止恶意服务器耗尽内存
+	berMaxLength = 16 << 20
+)
+
+var errBERMalformed = errors.New("malformed BER data")
+
+// berElement is a decoded BER TLV. Children is filled for constructed elements.
+type berElement struct {
+	Tag      byte
+	Value    []byte
+	Children []berElement
+}
+
+func (e berElement) constructed() bool {
+	return e.Tag&berConstructed != 0
+}
+
+func (e berElement) String() string {
+	return string(e.Value)
+}
+
+func (e berElement) Int() (int64, error) {
+	if len(e.Value) == 0 || len(e.Value) > 8 {
+		return 0, errBERMalformed
+	}
+	var v int64
+	if e.Value[0]&0x80 != 0 {
+		v = -1
+	}
+	for _, b := range e.Value {
+		v = v<<8 | int64(b)
+	}
+	return v, nil
+}
+
+func berEncodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var buf []byte
+	for n > 0 {
+		buf = append([]byte{byte(n)}, buf...)
+		n >>= 8
+	}
+	return append([]byte{0x80 | byte(len(buf))}, buf...)
+}
+
+func berTLV(tag byte, value []byte) []byte {
+	out := append([]byte{tag}, berEncodeLength(len(value))...)
+	return append(out, value...)
+}
+
+func berSequence(tag byte, children ...[]byte) []byte {
+	var value []byte
+	for _, child := range children {
+		value = append(value, child...)
+	}
+	return berTLV(tag, value)
+}
+
+func berInteger(tag byte, v int64) []byte {
+	var buf []byte
+	for {
+		buf = append([]byte{byte(v)}, buf...)
+		if (v >= -0x80 && v < 0x80) || len(buf) == 8 {
+			break
+		}
+		v >>= 8
+	}
+	return berTLV(tag, buf)
+}
+
+func berOctetString(tag byte, s string) []byte {
+	return berTLV(tag, []byte(s))
+}
+
+func berBoolean(v bool) []byte {
+	if v {
+		return berTLV(berTagBoolean, []byte{0xff})
+	}
+	return berTLV(berTagBoolean, []byte{0x00})
+}
+
+// readBERElement reads one complete element from r and decodes its children.
+func readBERElement(r io.Reader) (berElement, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return berElement{}, err
+	}
+	tag := header[0]
+	if tag&0x1f == 0x1f {
+		return berElement{}, fmt.Errorf("%w: multi-byte tags are not supported", errBERMalformed)
+	}
+
+	length := int(header[1])
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 {
+			return berElement{}, fmt.Errorf("%w: unsupported length encoding", errBERMalformed)
+		}
+		lenBytes := make([]byte, n)
+		if _, err := io.ReadFull(r, lenBytes); err != nil {
+			return berElement{}, err
+		}
+		length = 0
+		for _, b := range lenBytes {
+			length = length<<8 | int(b)
+		}
+	}
+	if length > berMaxLength {
+		return berElement{}, fmt.Errorf("%w: element too large", errBERMalformed)
+	}
+
+	value := make([]byte, length)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return berElement{}, err
+	}
+	return decodeBERValue(tag, value, 0)
+}
+
+func decodeBERValue(tag byte, value []byte, depth int) (berElement, error) {
+	elem := berElement{Tag: tag, Value: value}
+	if !elem.constructed() {
+		return elem, nil
+	}
+	if depth > 16 {
+		return berElement{}, fmt.Errorf("%w: nesting too deep", errBERMalformed)
+	}
+
+	rest := value
+	for len(rest) > 0 {
+		if len(rest) < 2 {
+			return berElement{}, errBERMalformed
+		}
+		childTag := rest[0]
+		length := int(rest[1])
+		offset := 2
+		if length&0x80 != 0 {
+			n := length & 0x7f
+			if n == 0 || n > 4 || len(rest) < 2+n {
+				return berElement{}, errBERMalformed
+			}
+			length = 0
+			for _, b := range rest[2 : 2+n] {
+				length = length<<8 | int(b)
+			}
+			offset += n
+		}
+		if length < 0 || len(rest) < offset+length {
+			return berElement{}, errBERMalformed
+		}
+		child, err := decodeBERValue(childTag, rest[offset:offset+length], depth+1)
+		if err != nil {
+			return berElement{}, err
+		}
+		elem.Children = append(elem.Children, child)
+		rest = rest[offset+length:]
+	}
+	return elem, nil
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestBEREncodeDecodeRoundTrip(t *testing.T) {
+	for _, length := range []int{0, 1, 127, 128, 255, 256, 70000} {
+		value := strings.Repeat("x", length)
+		elem, err := readBERElement(bytes.NewReader(berOctetString(berTagOctetString, value)))
+		if err != nil {
+			t.Fatalf("length %d: unexpected error: %v", length, err)
+		}
+		if elem.Tag != berTagOctetString || elem.String() != value {
+			t.Errorf("length %d: decoded tag %#x with %d bytes", length, elem.Tag, len(elem.Value))
+		}
+	}
+
+	for _, v := range []int64{0, 1, -1, 127, 128, -128, -129, 255, 256, 1 << 40, math.MaxInt64, math.MinInt64} {
+		elem, err := readBERElement(bytes.NewReader(berInteger(berTagInteger, v)))
+		if err != nil {
+			t.Fatalf("integer %d: unexpected error: %v", v, err)
+		}
+		got, err := elem.Int()
+		if err != nil || got != v {
+			t.Errorf("integer %d: decoded %d, %v", v, got, err)
+		}
+	}
+}
+
+func TestBERSequenceRoundTrip(t *testing.T) {
+	message := berSequence(berTagSequence,
+		berInteger(berTagInteger, 7),
+		berSequence(berClassApplication|berConstructed|0,
+			berInteger(berTagInteger, 3),
+			berOctetString(berTagOctetString, "cn=admin"),
+			berOctetString(berClassContext|0, strings.Repeat("p", 200)),
+		),
+		berBoolean(true),
+	)
+
+	elem, err := readBERElement(bytes.NewReader(message))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(elem.Children) != 3 {
+		t.Fatalf("expected 3 children, got %d", len(elem.Children))
+	}
+	if id, _ := elem.Children[0].Int(); id != 7 {
+		t.Errorf("message id = %d, expected 7", id)
+	}
+	bind := elem.Children[1]
+	if bind.Tag != berClassApplication|berConstructed|0 || len(bind.Children) != 3 {
+		t.Fatalf("unexpected bind element: tag %#x, %d children", bind.Tag, len(bind.Children))
+	}
+	if bind.Children[1].String() != "cn=admin" || len(bind.Children[2].Value) != 200 {
+		t.Errorf("unexpected bind fields: %q, %d bytes", bind.Children[1].String(), len(bind.Children[2].Value))
+	}
+	if got := elem.Children[2].Value; !bytes.Equal(got, []byte{0xff}) {
+		t.Errorf("boolean = % x, expected ff", got)
+	}
+}
+
+func TestReadBERElementRejectsMalformedInput(t *testing.T) {
+	nested := berOctetString(berTagOctetString, "x")
+	for i := 0; i < 18; i++ {
+		nested = berSequence(berTagSequence, nested)
+	}
+
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr error
+	}{
+		{"empty", nil, io.EOF},
+		{"truncated header", []byte{0x04}, io.ErrUnexpectedEOF},
+		{"truncated value", []byte{0x04, 0x05, 'a', 'b'}, io.ErrUnexpectedEOF},
+		{"truncated long length", []byte{0x04, 0x82, 0x01}, io.ErrUnexpectedEOF},
+		{"indefinite length", []byte{0x30, 0x80, 0x00, 0x00}, errBERMalformed},
+		{"length of more than four bytes", []byte{0x04, 0x85, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00}, errBERMalformed},
+		{"element too large", []byte{0x04, 0x84, 0x7f, 0xff, 0xff, 0xff}, errBERMalformed},
+		{"multi-byte tag", []byte{0x1f, 0x01, 0x00}, errBERMalformed},
+		{"child overruns parent", []byte{0x30, 0x03, 0x04, 0x05, 0x00}, errBERMalformed},
+		{"child header cut off", []byte{0x30, 0x01, 0x04}, errBERMalformed},
+		{"child long length cut off", []byte{0x30, 0x02, 0x04, 0x82}, errBERMalformed},
+		{"child indefinite length", []byte{0x30, 0x02, 0x04, 0x80}, errBERMalformed},
+		{"nesting too deep", nested, errBERMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readBERElement(bytes.NewReader(tt.input))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("readBERElement(% x) error = %v, expected %v", tt.input, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBERIntRejectsInvalidLengths(t *testing.T) {
+	for _, value := range [][]byte{nil, make([]byte, 9)} {
+		if _, err := (berElement{Tag: berTagInteger, Value: value}).Int(); !errors.Is(err, errBERMalformed) {
+			t.Errorf("Int() with %d bytes: error = %v, expected %v", len(value), err, errBERMalformed)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		expected any
+		consumed int
+	}{
+		{"small uint", []byte{0x17}, int64(23), 1},
+		{"uint8", []byte{0x18, 0x18}, int64(24), 2},
+		{"uint16", []byte{0x19, 0x01, 0x00}, int64(256), 3},
+		{"uint32", []byte{0x1a, 0x00, 0x01, 0x00, 0x00}, int64(65536), 5},
+		{"negative", []byte{0x20}, int64(-1), 1},
+		{"negative uint8", []byte{0x38, 0x63}, int64(-100), 2},
+		{"byte string", []byte{0x43, 0x01, 0x02, 0x03}, []byte{0x01, 0x02, 0x03}, 4},
+		{"text string", []byte{0x63, 'a', 'b', 'c'}, "abc", 4},
+		{"array", []byte{0x82, 0x01, 0x20}, []any{int64(1), int64(-1)}, 3},
+		{"map", []byte{0xa2, 0x61, 'a', 0x01, 0x26, 0xf5}, map[any]any{"a": int64(1), int64(-7): true}, 6},
+		{"false", []byte{0xf4}, false, 1},
+		{"null", []byte{0xf6}, nil, 1},
+		{"tag is skipped", []byte{0xc1, 0x01}, int64(1), 2},
+		{"trailing data is not consumed", []byte{0x01, 0xff, 0xff}, int64(1), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, consumed, err := decodeCBOR(tt.input)
+			if err != nil {
+				t.Fatalf("decodeCBOR(% x) error: %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(value, tt.expected) {
+				t.Errorf("decodeCBOR(% x) = %#v, expected %#v", tt.input, value, tt.expected)
+			}
+			if consumed != tt.consumed {
+				t.Errorf("decodeCBOR(% x) consumed %d bytes, expected %d", tt.input, consumed, tt.consumed)
+			}
+		})
+	}
+}
+
+func TestDecodeCBORRejectsMalformedInput(t *testing.T) {
+	huge := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr error  // checked with errors.Is when set
+		wantMsg string // substring of the error otherwise
+	}{
+		{name: "empty", input: nil, wantErr: errCBORTruncated},
+		{name: "missing uint8 argument", input: []byte{0x18}, wantErr: errCBORTruncated},
+		{name: "truncated uint16 argument", input: []byte{0x19, 0x01}, wantErr: errCBORTruncated},
+		{name: "truncated uint64 argument", input: []byte{0x1b, 0x00, 0x00}, wantErr: errCBORTruncated},
+		{name: "truncated byte string", input: []byte{0x43, 0x01}, wantErr: errCBORTruncated},
+		{name: "truncated text string", input: []byte{0x65, 'a', 'b'}, wantErr: errCBORTruncated},
+		{name: "truncated array", input: []byte{0x83, 0x01, 0x02}, wantErr: errCBORTruncated},
+		{name: "truncated map value", input: []byte{0xa1, 0x01}, wantErr: errCBORTruncated},
+		{name: "oversized byte string length", input: append([]byte{0x5b}, huge...), wantErr: errCBORTruncated},
+		{name: "oversized array length", input: append([]byte{0x9b}, huge...), wantErr: errCBORTruncated},
+		{name: "oversized map length", input: append([]byte{0xbb}, huge...), wantErr: errCBORTruncated},
+		{name: "uint overflows int64", input: append([]byte{0x1b}, huge...), wantMsg: "integer overflow"},
+		{name: "negative overflows int64", input: append([]byte{0x3b}, huge...), wantMsg: "integer overflow"},
+		{name: "indefinite length", input: []byte{0x5f, 0x41, 0x00, 0xff}, wantMsg: "unsupported additional info"},
+		{name: "reserved additional info", input: []byte{0x1c}, wantMsg: "unsupported additional info"},
+		{name: "byte string map key", input: []byte{0xa1, 0x41, 0x00, 0x01}, wantMsg: "unsupported map key type"},
+		{name: "float", input: []byte{0xf9, 0x3c, 0x00}, wantMsg: "unsupported major type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := decodeCBOR(tt.input)
+			if err == nil {
+				t.Fatalf("decodeCBOR(% x) succeeded, expected an error", tt.input)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("decodeCBOR(% x) error = %v, expected %v", tt.input, err, tt.wantErr)
+			}
+			if tt.wantMsg != "" && !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("decodeCBOR(% x) error = %v, expected it to contain %q", tt.input, err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestDecodeCBORNestingLimit(t *testing.T) {
+	nested := func(prefix byte, depth int) []byte {
+		return append(bytes.Repeat([]byte{prefix}, depth), 0x00)
+	}
+
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr bool
+	}{
+		{"arrays at the limit", nested(0x81, cborMaxDepth), false},
+		{"arrays past the limit", nested(0x81, cborMaxDepth+1), true},
+		{"tags past the limit", nested(0xc1, cborMaxDepth+1), true},
+		{"maps past the limit", append(bytes.Repeat([]byte{0xa1, 0x00}, cborMaxDepth+1), 0x00), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := decodeCBOR(tt.input)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "nesting too deep") {
+					t.Errorf("expected nesting error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
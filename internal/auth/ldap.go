@@ -0,0 +1,537 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/storage"
+)
+
+// LDAP / Active Directory 登录：先用服务账号（或匿名）绑定并按过滤器查找用户条目，再用用户 DN 和密码绑定验证。
+
+const (
+	ldapDialTimeout    = 10 * time.Second
+	ldapRequestTimeout = 15 * time.Second
+
+	ldapOpBindRequest      = berClassApplication | berConstructed | 0
+	ldapOpBindResponse     = berClassApplication | berConstructed | 1
+	ldapOpUnbindRequest    = berClassApplication | 2
+	ldapOpSearchRequest    = berClassApplication | berConstructed | 3
+	ldapOpSearchEntry      = berClassApplication | berConstructed | 4
+	ldapOpSearchDone       = berClassApplication | berConstructed | 5
+	ldapOpSearchReference  = berClassApplication | berConstructed | 19
+	ldapOpExtendedRequest  = berClassApplication | berConstructed | 23
+	ldapOpExtendedResponse = berClassApplication | berConstructed | 24
+
+	ldapResultSuccess            = 0
+	ldapResultInvalidCredentials = 49
+	ldapStartTLSOID              = "1.3.6.1.4.1.1466.20037"
+	ldapScopeWholeSubtree        = 2
+	ldapDerefNever               = 0
+)
+
+var (
+	// ErrLDAPInvalidCredentials is returned when the user was not found or the password is wrong.
+	ErrLDAPInvalidCredentials = errors.New("ldap: invalid credentials")
+	// ErrLDAPAmbiguousUser is returned when the user filter matches more than one entry.
+	ErrLDAPAmbiguousUser = errors.New("ldap: user filter matched more than one entry")
+)
+
+// LDAPUser is the directory entry that authenticated successfully.
+type LDAPUser struct {
+	DN          string `json:"dn"`
+	Username    string `json:"username"`
+	Email       string `json:"email"`
+	DisplayName string `json:"display_name"`
+}
+
+// LDAPResultError is a non-success LDAP result code.
+type LDAPResultError struct {
+	Op      string
+	Code    int64
+	Message string
+}
+
+func (e *LDAPResultError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ldap %s failed: result code %d", e.Op, e.Code)
+	}
+	return fmt.Sprintf("ldap %s failed: result code %d: %s", e.Op, e.Code, e.Message)
+}
+
+// LDAPAuthenticate verifies username/password against the configured directory.
+func LDAPAuthenticate(ctx context.Context, settings storage.LDAPSettings, username, password string) (LDAPUser, error) {
+	username = strings.TrimSpace(username)
+	// 空密码会被服务器当作匿名绑定而“成功”，必须在本地拒绝
+	if username == "" || password == "" {
+		return LDAPUser{}, ErrLDAPInvalidCredentials
+	}
+
+	conn, err := dialLDAP(ctx, settings)
+	if err != nil {
+		return LDAPUser{}, err
+	}
+	defer conn.close()
+
+	if err := conn.bind(settings.BindDN, settings.BindPassword); err != nil {
+		return LDAPUser{}, fmt.Errorf("service bind: %w", err)
+	}
+
+	filter := strings.ReplaceAll(settings.EffectiveUserFilter(), "%s", EscapeLDAPFilter(username))
+	emailAttr := settings.EffectiveEmailAttribute()
+	nameAttr := settings.EffectiveNameAttribute()
+	entries, err := conn.search(settings.BaseDN, filter, []string{emailAttr, nameAttr}, 2)
+	if err != nil {
+		return LDAPUser{}, err
+	}
+	switch len(entries) {
+	case 0:
+		return LDAPUser{}, ErrLDAPInvalidCredentials
+	case 1:
+	default:
+		return LDAPUser{}, ErrLDAPAmbiguousUser
+	}
+	entry := entries[0]
+
+	if err := conn.bind(entry.dn, password); err != nil {
+		var resultErr *LDAPResultError
+		if errors.As(err, &resultErr) && resultErr.Code == ldapResultInvalidCredentials {
+			return LDAPUser{}, ErrLDAPInvalidCredentials
+		}
+		return LDAPUser{}, err
+	}
+
+	return LDAPUser{
+		DN:          entry.dn,
+		Username:    username,
+		Email:       entry.first(emailAttr),
+		DisplayName: entry.first(nameAttr),
+	}, nil
+}
+
+// EscapeLDAPFilter escapes a value for use inside an LDAP search filter (RFC 4515).
+func EscapeLDAPFilter(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch c {
+		case '*', '(', ')', '\\', 0:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// ValidateLDAPUserFilter checks that a user filter contains the %s placeholder and is a valid search filter.
+func ValidateLDAPUserFilter(filter string) error {
+	if !strings.Contains(filter, "%s") {
+		return errors.New("ldap user filter must contain %s")
+	}
+	_, err := compileLDAPFilter(strings.ReplaceAll(filter, "%s", "user"))
+	return err
+}
+
+type ldapConn struct {
+	conn      net.Conn
+	messageID int64
+}
+
+type ldapEntry struct {
+	dn         string
+	attributes map[string][]string
+}
+
+func (e ldapEntry) first(attr string) string {
+	for name, values := range e.attributes {
+		if strings.EqualFold(name, attr) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+func dialLDAP(ctx context.Context, settings storage.LDAPSettings) (*ldapConn, error) {
+	parsed, err := url.Parse(strings.TrimSpace(settings.URL))
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid ldap url %q", settings.URL)
+	}
+
+	host := parsed.Host
+	useTLS := false
+	switch strings.ToLower(parsed.Scheme) {
+	case "ldap":
+		if parsed.Port() == "" {
+			host = net.JoinHostPort(parsed.Hostname(), "389")
+		}
+	case "ldaps":
+		useTLS = true
+		if parsed.Port() == "" {
+			host = net.JoinHostPort(parsed.Hostname(), "636")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported ldap scheme %q", parsed.Scheme)
+	}
+
+	dialer := &net.Dialer{Timeout: ldapDialTimeout}
+	raw, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, fmt.Errorf("connect ldap server: %w", err)
+	}
+
+	deadline := time.Now().Add(ldapRequestTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = raw.SetDeadline(deadline)
+
+	tlsConfig := &tls.Config{ServerName: parsed.Hostname(), InsecureSkipVerify: settings.SkipTLSVerify}
+	if useTLS {
+		tlsConn := tls.Client(raw, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = raw.Close()
+			return nil, fmt.Errorf("ldaps handshake: %w", err)
+		}
+		return &ldapConn{conn: tlsConn}, nil
+	}
+
+	conn := &ldapConn{conn: raw}
+	if settings.StartTLS {
+		if err := conn.startTLS(ctx, tlsConfig); err != nil {
+			_ = raw.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (c *ldapConn) close() {
+	c.messageID++
+	_, _ = c.conn.Write(berSequence(berTagSequence, berInteger(berTagInteger, c.messageID), berTLV(ldapOpUnbindRequest, nil)))
+	_ = c.conn.Close()
+}
+
+func (c *ldapConn) send(op []byte) (int64, error) {
+	c.messageID++
+	msg := berSequence(berTagSequence, berInteger(berTagInteger, c.messageID), op)
+	if _, err := c.conn.Write(msg); err != nil {
+		return 0, fmt.Errorf("ldap write: %w", err)
+	}
+	return c.messageID, nil
+}
+
+// receive reads the next message for id and returns its protocol operation.
+func (c *ldapConn) receive(id int64) (berElement, error) {
+	for {
+		msg, err := readBERElement(c.conn)
+		if err != nil {
+			return berElement{}, fmt.Errorf("ldap read: %w", err)
+		}
+		if msg.Tag != berTagSequence || len(msg.Children) < 2 {
+			return berElement{}, errBERMalformed
+		}
+		gotID, err := msg.Children[0].Int()
+		if err != nil {
+			return berElement{}, err
+		}
+		// 消息 ID 0 为服务器主动通知（如断开连接），其他 ID 不属于当前请求时忽略
+		if gotID == 0 {
+			if err := resultFromOp("notice", msg.Children[1]); err != nil {
+				return berElement{}, err
+			}
+			return berElement{}, errors.New("ldap: unsolicited notification from server")
+		}
+		if gotID != id {
+			continue
+		}
+		return msg.Children[1], nil
+	}
+}
+
+// resultFromOp converts an LDAPResult (resultCode, matchedDN, diagnosticMessage) to an error.
+func resultFromOp(name string, op berElement) error {
+	if len(op.Children) < 3 {
+		return errBERMalformed
+	}
+	code, err := op.Children[0].Int()
+	if err != nil {
+		return err
+	}
+	if code == ldapResultSuccess {
+		return nil
+	}
+	return &LDAPResultError{Op: name, Code: code, Message: op.Children[2].String()}
+}
+
+func (c *ldapConn) startTLS(ctx context.Context, config *tls.Config) error {
+	id, err := c.send(berSequence(ldapOpExtendedRequest, berOctetString(berClassContext|0, ldapStartTLSOID)))
+	if err != nil {
+		return err
+	}
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if op.Tag != ldapOpExtendedResponse {
+		return fmt.Errorf("%w: unexpected starttls response", errBERMalformed)
+	}
+	if err := resultFromOp("starttls", op); err != nil {
+		return err
+	}
+
+	tlsConn := tls.Client(c.conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return fmt.Errorf("ldap starttls handshake: %w", err)
+	}
+	c.conn = tlsConn
+	return nil
+}
+
+// bind performs a simple bind; an empty dn and password is an anonymous bind.
+func (c *ldapConn) bind(dn, password string) error {
+	id, err := c.send(berSequence(ldapOpBindRequest,
+		berInteger(berTagInteger, 3),
+		berOctetString(berTagOctetString, dn),
+		berOctetString(berClassContext|0, password),
+	))
+	if err != nil {
+		return err
+	}
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if op.Tag != ldapOpBindResponse {
+		return fmt.Errorf("%w: unexpected bind response", errBERMalformed)
+	}
+	return resultFromOp("bind", op)
+}
+
+func (c *ldapConn) search(baseDN, filter string, attributes []string, sizeLimit int64) ([]ldapEntry, error) {
+	encodedFilter, err := compileLDAPFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	attrs := make([][]byte, 0, len(attributes))
+	for _, attr := range attributes {
+		attrs = append(attrs, berOctetString(berTagOctetString, attr))
+	}
+
+	id, err := c.send(berSequence(ldapOpSearchRequest,
+		berOctetString(berTagOctetString, baseDN),
+		berInteger(berTagEnumerated, ldapScopeWholeSubtree),
+		berInteger(berTagEnumerated, ldapDerefNever),
+		berInteger(berTagInteger, sizeLimit),
+		berInteger(berTagInteger, int64(ldapRequestTimeout/time.Second)),
+		berBoolean(false),
+		encodedFilter,
+		berSequence(berTagSequence, attrs...),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []ldapEntry
+	for {
+		op, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch op.Tag {
+		case ldapOpSearchEntry:
+			if len(op.Children) < 2 {
+				return nil, errBERMalformed
+			}
+			entry := ldapEntry{dn: op.Children[0].String(), attributes: make(map[string][]string)}
+			for _, attr := range op.Children[1].Children {
+				if len(attr.Children) < 2 {
+					continue
+				}
+				name := attr.Children[0].String()
+				for _, v := range attr.Children[1].Children {
+					entry.attributes[name] = append(entry.attributes[name], v.String())
+				}
+			}
+			entries = append(entries, entry)
+		case ldapOpSearchReference:
+			// 不跟随引用
+		case ldapOpSearchDone:
+			if err := resultFromOp("search", op); err != nil {
+				// sizeLimitExceeded（4）说明匹配到多个条目
+				var resultErr *LDAPResultError
+				if errors.As(err, &resultErr) && resultErr.Code == 4 {
+					return nil, ErrLDAPAmbiguousUser
+				}
+				return nil, err
+			}
+			return entries, nil
+		default:
+			return nil, fmt.Errorf("%w: unexpected search response", errBERMalformed)
+		}
+	}
+}
+
+// compileLDAPFilter encodes an RFC 4515 string filter such as
+// (&(objectClass=person)(|(uid=alice)(mail=alice@example.com))).
+func compileLDAPFilter(filter string) ([]byte, error) {
+	filter = strings.TrimSpace(filter)
+	if !strings.HasPrefix(filter, "(") {
+		filter = "(" + filter + ")"
+	}
+	encoded, rest, err := parseLDAPFilter(filter, 0)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(rest) != "" {
+		return nil, fmt.Errorf("invalid ldap filter: trailing %q", rest)
+	}
+	return encoded, nil
+}
+
+func parseLDAPFilter(s string, depth int) ([]byte, string, error) {
+	if depth > 16 {
+		return nil, "", errors.New("invalid ldap filter: nesting too deep")
+	}
+	if !strings.HasPrefix(s, "(") {
+		return nil, "", fmt.Errorf("invalid ldap filter near %q", s)
+	}
+	s = s[1:]
+	if s == "" {
+		return nil, "", errors.New("invalid ldap filter: unexpected end")
+	}
+
+	switch s[0] {
+	case '&', '|':
+		tag := byte(berClassContext | berConstructed | 0)
+		if s[0] == '|' {
+			tag = berClassContext | berConstructed | 1
+		}
+		s = s[1:]
+		var parts [][]byte
+		for strings.HasPrefix(s, "(") {
+			part, rest, err := parseLDAPFilter(s, depth+1)
+			if err != nil {
+				return nil, "", err
+			}
+			parts = append(parts, part)
+			s = rest
+		}
+		if !strings.HasPrefix(s, ")") || len(parts) == 0 {
+			return nil, "", errors.New("invalid ldap filter: malformed set")
+		}
+		return berSequence(tag, parts...), s[1:], nil
+	case '!':
+		part, rest, err := parseLDAPFilter(s[1:], depth+1)
+		if err != nil {
+			return nil, "", err
+		}
+		if !strings.HasPrefix(rest, ")") {
+			return nil, "", errors.New("invalid ldap filter: malformed not")
+		}
+		return berSequence(berClassContext|berConstructed|2, part), rest[1:], nil
+	}
+
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, "", errors.New("invalid ldap filter: missing )")
+	}
+	item, rest := s[:end], s[end+1:]
+	encoded, err := encodeLDAPFilterItem(item)
+	if err != nil {
+		return nil, "", err
+	}
+	return encoded, rest, nil
+}
+
+func encodeLDAPFilterItem(item string) ([]byte, error) {
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, fmt.Errorf("invalid ldap filter item %q", item)
+	}
+	attr, value := item[:eq], item[eq+1:]
+
+	var tag byte
+	switch attr[len(attr)-1] {
+	case '>':
+		tag, attr = berClassContext|berConstructed|5, attr[:len(attr)-1]
+	case '<':
+		tag, attr = berClassContext|berConstructed|6, attr[:len(attr)-1]
+	case '~':
+		tag, attr = berClassContext|berConstructed|8, attr[:len(attr)-1]
+	}
+	attr = strings.TrimSpace(attr)
+	if attr == "" {
+		return nil, fmt.Errorf("invalid ldap filter item %q", item)
+	}
+
+	if tag != 0 {
+		unescaped, err := unescapeLDAPFilterValue(value)
+		if err != nil {
+			return nil, err
+		}
+		return berSequence(tag, berOctetString(berTagOctetString, attr), berOctetString(berTagOctetString, unescaped)), nil
+	}
+	if value == "*" {
+		return berOctetString(berClassContext|7, attr), nil
+	}
+	if !strings.Contains(value, "*") {
+		unescaped, err := unescapeLDAPFilterValue(value)
+		if err != nil {
+			return nil, err
+		}
+		return berSequence(berClassContext|berConstructed|3, berOctetString(berTagOctetString, attr), berOctetString(berTagOctetString, unescaped)), nil
+	}
+
+	// 子串匹配：initial*any*final
+	pieces := strings.Split(value, "*")
+	var subs [][]byte
+	for i, piece := range pieces {
+		if piece == "" {
+			continue
+		}
+		unescaped, err := unescapeLDAPFilterValue(piece)
+		if err != nil {
+			return nil, err
+		}
+		var subTag byte = berClassContext | 1
+		switch i {
+		case 0:
+			subTag = berClassContext | 0
+		case len(pieces) - 1:
+			subTag = berClassContext | 2
+		}
+		subs = append(subs, berOctetString(subTag, unescaped))
+	}
+	return berSequence(berClassContext|berConstructed|4, berOctetString(berTagOctetString, attr), berSequence(berTagSequence, subs...)), nil
+}
+
+func unescapeLDAPFilterValue(value string) (string, error) {
+	if !strings.Contains(value, "\\") {
+		return value, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			b.WriteByte(value[i])
+			continue
+		}
+		if i+3 > len(value) {
+			return "", fmt.Errorf("invalid ldap filter escape in %q", value)
+		}
+		decoded, err := hex.DecodeString(value[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("invalid ldap filter escape in %q", value)
+		}
+		b.Write(decoded)
+		i += 2
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEscapeLDAPFilter(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"alice", "alice"},
+		{"a*b", `a\2ab`},
+		{"(admin)", `\28admin\29`},
+		{`dom\user`, `dom\5cuser`},
+		{"nul\x00byte", `nul\00byte`},
+		{"*)(uid=*))(|(uid=*", `\2a\29\28uid=\2a\29\29\28|\28uid=\2a`},
+		{"张三", "张三"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := EscapeLDAPFilter(tt.input); got != tt.expected {
+			t.Errorf("EscapeLDAPFilter(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+// TestLDAPUserFilterInjection builds the search filter the way LDAPAuthenticate does and checks that
+// a hostile username still compiles to a single equality match on the literal value.
+func TestLDAPUserFilterInjection(t *testing.T) {
+	usernames := []string{
+		"alice",
+		"*",
+		"admin)(|(uid=*",
+		"*)(objectClass=*",
+		`a\b*c`,
+		"x\x00y",
+	}
+
+	for _, username := range usernames {
+		filter := strings.ReplaceAll("(&(objectClass=person)(uid=%s))", "%s", EscapeLDAPFilter(username))
+		encoded, err := compileLDAPFilter(filter)
+		if err != nil {
+			t.Fatalf("username %q: compile %q: %v", username, filter, err)
+		}
+		and, err := readBERElement(bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatalf("username %q: decode filter: %v", username, err)
+		}
+		if and.Tag != berClassContext|berConstructed|0 || len(and.Children) != 2 {
+			t.Fatalf("username %q: expected an AND of two items, got tag %#x with %d children", username, and.Tag, len(and.Children))
+		}
+		match := and.Children[1]
+		if match.Tag != berClassContext|berConstructed|3 || len(match.Children) != 2 {
+			t.Fatalf("username %q: expected an equality match, got tag %#x", username, match.Tag)
+		}
+		if attr, value := match.Children[0].String(), match.Children[1].String(); attr != "uid" || value != username {
+			t.Errorf("username %q: filter matches %s=%q", username, attr, value)
+		}
+	}
+}
+
+func TestUnescapeLDAPFilterValueRoundTrip(t *testing.T) {
+	for _, value := range []string{"plain", `*()\`, "\x00\x01", "张三*"} {
+		got, err := unescapeLDAPFilterValue(EscapeLDAPFilter(value))
+		if err != nil || got != value {
+			t.Errorf("round trip of %q = %q, %v", value, got, err)
+		}
+	}
+
+	for _, value := range []string{`\`, `\2`, `\zz`} {
+		if _, err := unescapeLDAPFilterValue(value); err == nil {
+			t.Errorf("unescapeLDAPFilterValue(%q) succeeded, expected an error", value)
+		}
+	}
+}
@@ -8,9 +8,13 @@ import (
 
 	"golang.org/x/crypto/bcrypt"
 
+	"miaomiaowu/internal/logger"
 	"miaomiaowu/internal/storage"
 )
 
+// ErrExternalAccount is returned when a password operation targets an account managed by LDAP.
+var ErrExternalAccount = errors.New("password is managed by the external directory")
+
 type Credentials struct {
 	Username     string `json:"username"`
 	PasswordHash string `json:"password_hash"`
@@ -40,7 +44,7 @@ func (m *Manager) Authenticate(ctx context.Context, username, password string) (
 	user, err := m.repo.GetUser(ctx, username)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
-			return false, nil
+			return m.provisionLDAPUser(ctx, username, password)
 		}
 		return false, err
 	}
@@ -49,6 +53,10 @@ func (m *Manager) Authenticate(ctx context.Context, username, password string) (
 		return false, nil
 	}
 
+	if user.AuthSource == storage.AuthSourceLDAP {
+		return m.authenticateLDAP(ctx, username, password)
+	}
+
 	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
 		return false, nil
 	}
@@ -56,6 +64,52 @@ func (m *Manager) Authenticate(ctx context.Context, username, password string) (
 	return true, nil
 }
 
+// authenticateLDAP verifies an existing LDAP account against the directory. Directory errors are logged and
+// treated as a failed login so an unreachable server never lets anyone in.
+func (m *Manager) authenticateLDAP(ctx context.Context, username, password string) (bool, error) {
+	settings, err := m.repo.GetLDAPSettings(ctx)
+	if err != nil {
+		return false, err
+	}
+	if !settings.Enabled {
+		logger.Warn("[LDAP] LDAP 登录已关闭，拒绝目录账号登录", "username", username)
+		return false, nil
+	}
+
+	if _, err := LDAPAuthenticate(ctx, settings, username, password); err != nil {
+		if !errors.Is(err, ErrLDAPInvalidCredentials) {
+			logger.Error("[LDAP] 目录认证失败", "username", username, "error", err)
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// provisionLDAPUser creates a local account on the first successful LDAP login when auto-create is enabled.
+func (m *Manager) provisionLDAPUser(ctx context.Context, username, password string) (bool, error) {
+	settings, err := m.repo.GetLDAPSettings(ctx)
+	if err != nil {
+		return false, err
+	}
+	if !settings.Enabled || !settings.AutoCreate {
+		return false, nil
+	}
+
+	ldapUser, err := LDAPAuthenticate(ctx, settings, username, password)
+	if err != nil {
+		if !errors.Is(err, ErrLDAPInvalidCredentials) {
+			logger.Error("[LDAP] 目录认证失败", "username", username, "error", err)
+		}
+		return false, nil
+	}
+
+	if err := m.repo.CreateLDAPUser(ctx, username, ldapUser.Email, ldapUser.DisplayName, settings.DefaultRole); err != nil {
+		return false, err
+	}
+	logger.Info("[LDAP] 首次登录，已创建本地账号", "username", username, "dn", ldapUser.DN, "role", settings.DefaultRole)
+	return true, nil
+}
+
 func (m *Manager) Update(ctx context.Context, username, password string) error {
 	if username == "" && password == "" {
 		return errors.New("username or password must be provided")
@@ -108,6 +162,10 @@ func (m *Manager) ChangePassword(ctx context.Context, username, currentPassword,
 		return errors.New("user is disabled")
 	}
 
+	if user.AuthSource == storage.AuthSourceLDAP {
+		return ErrExternalAccount
+	}
+
 	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword)) != nil {
 		return errors.New("current password is incorrect")
 	}
@@ -170,6 +228,13 @@ func (m *Manager) ValidatePassword(ctx context.Context, username, password strin
 		return errors.New("user is disabled")
 	}
 
+	if user.AuthSource == storage.AuthSourceLDAP {
+		if ok, err := m.authenticateLDAP(ctx, username, password); err != nil || !ok {
+			return errors.New("password is incorrect")
+		}
+		return nil
+	}
+
 	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
 		return errors.New("password is incorrect")
 	}
@@ -2,6 +2,8 @@ package auth
 
 import (
 	"context"
+	"time"
+
 	"miaomiaowu/internal/storage"
 )
 
@@ -25,6 +27,6 @@ func (a *RepositoryAdapter) GetUser(ctx context.Context, username string) (User,
 	return User{
 		Username: storageUser.Username,
 		Role:     storageUser.Role,
-		IsActive: storageUser.IsActive,
+		IsActive: storageUser.IsActive && !storageUser.Expired(time.Now()), // 到期账号视为已停用
 	}, nil
 }
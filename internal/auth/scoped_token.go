@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 受限令牌的访问范围，用于将流量图表、节点状态以只读方式嵌入到其他面板（iframe）
+const (
+	ScopeTrafficRead    = "traffic:read"
+	ScopeNodeStatusRead = "nodes:read"
+)
+
+// MaxScopedTokenTTL 受限令牌的最长有效期
+const MaxScopedTokenTTL = 24 * time.Hour
+
+var knownScopes = []string{ScopeTrafficRead, ScopeNodeStatusRead}
+
+// IsKnownScope reports whether scope is a supported scoped-token scope.
+func IsKnownScope(scope string) bool {
+	return slices.Contains(knownScopes, scope)
+}
+
+// IssueScoped creates a short-lived token that only grants read access to the given scopes.
+// Scoped tokens are kept in memory only and do not survive a restart.
+func (s *TokenStore) IssueScoped(username string, scopes []string, ttl time.Duration) (string, time.Time, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return "", time.Time{}, errors.New("username is required")
+	}
+	if len(scopes) == 0 {
+		return "", time.Time{}, errors.New("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !IsKnownScope(scope) {
+			return "", time.Time{}, errors.New("unknown scope: " + scope)
+		}
+	}
+	if ttl <= 0 || ttl > MaxScopedTokenTTL {
+		return "", time.Time{}, errors.New("invalid scoped token ttl")
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiry := time.Now().Add(ttl)
+
+	s.mu.Lock()
+	s.tokens[token] = session{username: username, expiry: expiry, scopes: slices.Clone(scopes)}
+	s.mu.Unlock()
+
+	return token, expiry, nil
+}
+
+// RevokeScoped revokes a scoped token owned by username. Full session tokens are left untouched.
+func (s *TokenStore) RevokeScoped(token, username string) bool {
+	token = strings.TrimSpace(token)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.tokens[token]
+	if !ok || len(sess.scopes) == 0 || sess.username != username {
+		return false
+	}
+	delete(s.tokens, token)
+	return true
+}
+
+// LookupScope returns the username for a full session token, or for a scoped token that
+// includes scope. scoped reports whether the token is a scoped (read-only) token.
+func (s *TokenStore) LookupScope(token, scope string) (username string, scoped bool, ok bool) {
+	sess, ok := s.lookup(token)
+	if !ok {
+		return "", false, false
+	}
+	if len(sess.scopes) == 0 {
+		return sess.username, false, true
+	}
+	if !slices.Contains(sess.scopes, scope) {
+		return "", true, false
+	}
+	return sess.username, true, true
+}
+
+// RequireScope behaves like RequireToken but also accepts scoped tokens carrying scope.
+// Scoped tokens are limited to GET and HEAD requests.
+func RequireScope(store *TokenStore, scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimSpace(r.Header.Get(AuthHeader))
+		// iframe 无法设置请求头，使用查询参数传递
+		if token == "" {
+			token = strings.TrimSpace(r.URL.Query().Get("token"))
+		}
+
+		username, scoped, ok := store.LookupScope(token, scope)
+		if !ok {
+			WriteUnauthorizedResponse(w)
+			return
+		}
+		if scoped && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"error":"forbidden"}`))
+			return
+		}
+
+		ctx := ContextWithUsername(r.Context(), username)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -16,6 +16,8 @@ import (
 type session struct {
 	username string
 	expiry   time.Time
+	// scopes 非空时为受限令牌，只能访问 RequireScope 中对应范围的只读接口
+	scopes []string
 }
 
 type contextKey string
@@ -93,6 +95,23 @@ func (s *TokenStore) RevokeAll() {
 	s.mu.Unlock()
 }
 
+// RevokeUser drops every login session of the user, e.g. after a password reset.
+// Scoped API tokens are kept; they are managed separately by their owner.
+func (s *TokenStore) RevokeUser(username string) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return
+	}
+
+	s.mu.Lock()
+	for token, sess := range s.tokens {
+		if sess.username == username && len(sess.scopes) == 0 {
+			delete(s.tokens, token)
+		}
+	}
+	s.mu.Unlock()
+}
+
 // LoadSession adds a session to the in-memory store. Used to restore sessions from database on startup.
 func (s *TokenStore) LoadSession(token, username string, expiry time.Time) {
 	token = strings.TrimSpace(token)
@@ -122,33 +141,43 @@ func (s *TokenStore) UpdateUsername(oldUsername, newUsername string) {
 	s.mu.Lock()
 	for token, sess := range s.tokens {
 		if sess.username == oldUsername {
-			s.tokens[token] = session{username: newUsername, expiry: sess.expiry}
+			sess.username = newUsername
+			s.tokens[token] = sess
 		}
 	}
 	s.mu.Unlock()
 }
 
 // Lookup returns the username associated with the provided token if the session is valid.
+// Scoped tokens are not accepted here; they only work through RequireScope.
 func (s *TokenStore) Lookup(token string) (string, bool) {
+	sess, ok := s.lookup(token)
+	if !ok || len(sess.scopes) > 0 {
+		return "", false
+	}
+	return sess.username, true
+}
+
+func (s *TokenStore) lookup(token string) (session, bool) {
 	token = strings.TrimSpace(token)
 	if token == "" {
-		return "", false
+		return session{}, false
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	session, ok := s.tokens[token]
+	sess, ok := s.tokens[token]
 	if !ok {
-		return "", false
+		return session{}, false
 	}
 
-	if time.Now().After(session.expiry) {
+	if time.Now().After(sess.expiry) {
 		delete(s.tokens, token)
-		return "", false
+		return session{}, false
 	}
 
-	return session.username, true
+	return sess, true
 }
 
 func ContextWithUsername(ctx context.Context, username string) context.Context {
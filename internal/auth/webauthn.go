@@ -0,0 +1,299 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+)
+
+// WebAuthn（passkey）的最小实现：只接受 "none" 或忽略证明（attestation）内容，
+// 仅校验 clientDataJSON、RP ID 哈希、用户在场标志和签名。支持 ES256 / RS256 / EdDSA。
+
+// COSE 算法标识
+const (
+	COSEAlgES256 int64 = -7
+	COSEAlgEdDSA int64 = -8
+	COSEAlgRS256 int64 = -257
+)
+
+// SupportedCOSEAlgorithms 注册时告知浏览器可接受的公钥算法，按优先级排序
+var SupportedCOSEAlgorithms = []int64{COSEAlgES256, COSEAlgEdDSA, COSEAlgRS256}
+
+const (
+	authDataFlagUserPresent  = 0x01
+	authDataFlagUserVerified = 0x04
+	authDataFlagAttestedData = 0x40
+)
+
+var (
+	ErrWebAuthnInvalidClientData = errors.New("webauthn: invalid client data")
+	ErrWebAuthnInvalidAuthData   = errors.New("webauthn: invalid authenticator data")
+	ErrWebAuthnInvalidSignature  = errors.New("webauthn: signature verification failed")
+	ErrWebAuthnUnsupportedKey    = errors.New("webauthn: unsupported public key")
+)
+
+// WebAuthnRelyingParty 描述校验时使用的依赖方信息
+type WebAuthnRelyingParty struct {
+	ID      string   // RP ID，通常为站点域名
+	Origins []string // 允许的来源，如 https://example.com
+}
+
+// WebAuthnRegistration 注册成功后需要保存的凭据信息
+type WebAuthnRegistration struct {
+	CredentialID []byte
+	PublicKey    []byte // COSE_Key 原始编码
+	SignCount    uint32
+}
+
+type webauthnClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type webauthnAuthData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// EncodeWebAuthnID encodes binary IDs and challenges the way browsers do in clientDataJSON (base64url without padding).
+func EncodeWebAuthnID(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeWebAuthnID accepts base64url with or without padding.
+func DecodeWebAuthnID(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// VerifyWebAuthnRegistration validates a navigator.credentials.create() response and extracts the credential.
+func (rp WebAuthnRelyingParty) VerifyWebAuthnRegistration(challenge, clientDataJSON, attestationObject []byte, requireUserVerification bool) (WebAuthnRegistration, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return WebAuthnRegistration{}, err
+	}
+
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return WebAuthnRegistration{}, fmt.Errorf("webauthn: decode attestation object: %w", err)
+	}
+	attestation, ok := decoded.(map[any]any)
+	if !ok {
+		return WebAuthnRegistration{}, errors.New("webauthn: attestation object is not a map")
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return WebAuthnRegistration{}, errors.New("webauthn: attestation object missing authData")
+	}
+
+	authData, err := parseWebAuthnAuthData(rawAuthData)
+	if err != nil {
+		return WebAuthnRegistration{}, err
+	}
+	if err := rp.verifyAuthData(authData, requireUserVerification); err != nil {
+		return WebAuthnRegistration{}, err
+	}
+	if authData.flags&authDataFlagAttestedData == 0 || len(authData.credentialID) == 0 {
+		return WebAuthnRegistration{}, fmt.Errorf("%w: missing attested credential data", ErrWebAuthnInvalidAuthData)
+	}
+	if _, err := parseCOSEKey(authData.publicKey); err != nil {
+		return WebAuthnRegistration{}, err
+	}
+
+	return WebAuthnRegistration{
+		CredentialID: authData.credentialID,
+		PublicKey:    authData.publicKey,
+		SignCount:    authData.signCount,
+	}, nil
+}
+
+// VerifyWebAuthnAssertion validates a navigator.credentials.get() response against a stored COSE public key
+// and returns the authenticator's new sign counter.
+func (rp WebAuthnRelyingParty) VerifyWebAuthnAssertion(challenge, clientDataJSON, rawAuthData, signature, coseKey []byte, storedSignCount uint32, requireUserVerification bool) (uint32, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := parseWebAuthnAuthData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.verifyAuthData(authData, requireUserVerification); err != nil {
+		return 0, err
+	}
+
+	key, err := parseCOSEKey(coseKey)
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := make([]byte, 0, len(rawAuthData)+len(clientDataHash))
+	signed = append(signed, rawAuthData...)
+	signed = append(signed, clientDataHash[:]...)
+	if !key.verify(signed, signature) {
+		return 0, ErrWebAuthnInvalidSignature
+	}
+
+	// 计数器不增反减说明凭据可能被克隆；两者均为 0 表示认证器不支持计数
+	if (authData.signCount != 0 || storedSignCount != 0) && authData.signCount <= storedSignCount {
+		return 0, errors.New("webauthn: sign counter did not increase, credential may be cloned")
+	}
+
+	return authData.signCount, nil
+}
+
+func (rp WebAuthnRelyingParty) verifyClientData(clientDataJSON []byte, expectedType string, challenge []byte) error {
+	var clientData webauthnClientData
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return fmt.Errorf("%w: %v", ErrWebAuthnInvalidClientData, err)
+	}
+	if clientData.Type != expectedType {
+		return fmt.Errorf("%w: unexpected type %q", ErrWebAuthnInvalidClientData, clientData.Type)
+	}
+	received, err := DecodeWebAuthnID(clientData.Challenge)
+	if err != nil || len(challenge) == 0 || subtle.ConstantTimeCompare(received, challenge) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrWebAuthnInvalidClientData)
+	}
+	if !slices.Contains(rp.Origins, clientData.Origin) {
+		return fmt.Errorf("%w: origin %q is not allowed", ErrWebAuthnInvalidClientData, clientData.Origin)
+	}
+	return nil
+}
+
+func (rp WebAuthnRelyingParty) verifyAuthData(authData webauthnAuthData, requireUserVerification bool) error {
+	expected := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.rpIDHash, expected[:]) {
+		return fmt.Errorf("%w: rp id hash mismatch", ErrWebAuthnInvalidAuthData)
+	}
+	if authData.flags&authDataFlagUserPresent == 0 {
+		return fmt.Errorf("%w: user not present", ErrWebAuthnInvalidAuthData)
+	}
+	if requireUserVerification && authData.flags&authDataFlagUserVerified == 0 {
+		return fmt.Errorf("%w: user not verified", ErrWebAuthnInvalidAuthData)
+	}
+	return nil
+}
+
+// parseWebAuthnAuthData 解析认证器数据：rpIdHash(32) | flags(1) | signCount(4) | [attestedCredentialData] | [extensions]
+func parseWebAuthnAuthData(data []byte) (webauthnAuthData, error) {
+	if len(data) < 37 {
+		return webauthnAuthData{}, fmt.Errorf("%w: too short", ErrWebAuthnInvalidAuthData)
+	}
+
+	authData := webauthnAuthData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if authData.flags&authDataFlagAttestedData == 0 {
+		return authData, nil
+	}
+
+	// attestedCredentialData: aaguid(16) | credentialIdLength(2) | credentialId | credentialPublicKey(COSE)
+	rest := data[37:]
+	if len(rest) < 18 {
+		return webauthnAuthData{}, fmt.Errorf("%w: truncated attested credential data", ErrWebAuthnInvalidAuthData)
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+		return webauthnAuthData{}, fmt.Errorf("%w: invalid credential id length", ErrWebAuthnInvalidAuthData)
+	}
+	authData.credentialID = append([]byte(nil), rest[:idLen]...)
+	rest = rest[idLen:]
+
+	_, consumed, err := decodeCBOR(rest)
+	if err != nil {
+		return webauthnAuthData{}, fmt.Errorf("%w: credential public key: %v", ErrWebAuthnInvalidAuthData, err)
+	}
+	authData.publicKey = append([]byte(nil), rest[:consumed]...)
+	return authData, nil
+}
+
+type coseKey struct {
+	alg     int64
+	ecdsa   *ecdsa.PublicKey
+	rsa     *rsa.PublicKey
+	ed25519 ed25519.PublicKey
+}
+
+// parseCOSEKey 解析 COSE_Key（RFC 9053），仅支持 EC2/P-256、RSA、OKP/Ed25519
+func parseCOSEKey(data []byte) (*coseKey, error) {
+	decoded, _, err := decodeCBOR(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnUnsupportedKey, err)
+	}
+	m, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, ErrWebAuthnUnsupportedKey
+	}
+
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+	bytesParam := func(label int64) []byte {
+		b, _ := m[label].([]byte)
+		return b
+	}
+
+	switch {
+	case kty == 2 && alg == COSEAlgES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, y := bytesParam(-2), bytesParam(-3)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("%w: invalid EC2 key", ErrWebAuthnUnsupportedKey)
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("%w: point not on curve", ErrWebAuthnUnsupportedKey)
+		}
+		return &coseKey{alg: alg, ecdsa: pub}, nil
+	case kty == 3 && alg == COSEAlgRS256:
+		n, e := bytesParam(-1), bytesParam(-2)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("%w: invalid RSA key", ErrWebAuthnUnsupportedKey)
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		return &coseKey{alg: alg, rsa: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}}, nil
+	case kty == 1 && alg == COSEAlgEdDSA:
+		crv, _ := m[int64(-1)].(int64)
+		x := bytesParam(-2)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: invalid OKP key", ErrWebAuthnUnsupportedKey)
+		}
+		return &coseKey{alg: alg, ed25519: ed25519.PublicKey(x)}, nil
+	}
+	return nil, fmt.Errorf("%w: kty=%d alg=%d", ErrWebAuthnUnsupportedKey, kty, alg)
+}
+
+func (k *coseKey) verify(message, signature []byte) bool {
+	switch k.alg {
+	case COSEAlgES256:
+		digest := sha256.Sum256(message)
+		return ecdsa.VerifyASN1(k.ecdsa, digest[:], signature)
+	case COSEAlgRS256:
+		digest := sha256.Sum256(message)
+		return rsa.VerifyPKCS1v15(k.rsa, crypto.SHA256, digest[:], signature) == nil
+	case COSEAlgEdDSA:
+		return ed25519.Verify(k.ed25519, message, signature)
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var testRelyingParty = WebAuthnRelyingParty{ID: "example.com", Origins: []string{"https://example.com"}}
+
+// testCOSEKey encodes an Ed25519 public key as a COSE_Key: {1: 1, 3: -8, -1: 6, -2: x}
+func testCOSEKey(pub ed25519.PublicKey) []byte {
+	key := []byte{0xa4, 0x01, 0x01, 0x03, 0x27, 0x20, 0x06, 0x21, 0x58, 0x20}
+	return append(key, pub...)
+}
+
+func testAuthData(rpID string, flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
+
+func testClientData(t *testing.T, typ string, challenge []byte, origin string) []byte {
+	t.Helper()
+	data, err := json.Marshal(webauthnClientData{Type: typ, Challenge: EncodeWebAuthnID(challenge), Origin: origin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestVerifyWebAuthnAssertion(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge := []byte("server-challenge")
+
+	type assertion struct {
+		clientData []byte
+		authData   []byte
+		storedSign uint32
+		requireUV  bool
+		tamper     bool
+	}
+	valid := func() assertion {
+		return assertion{
+			clientData: testClientData(t, "webauthn.get", challenge, "https://example.com"),
+			authData:   testAuthData("example.com", authDataFlagUserPresent, 5),
+			storedSign: 4,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		modify    func(a *assertion)
+		wantErr   error  // checked with errors.Is when set
+		wantMsg   string // substring of the error otherwise
+		wantCount uint32
+	}{
+		{name: "valid", modify: func(a *assertion) {}, wantCount: 5},
+		{name: "user verified when required", modify: func(a *assertion) {
+			a.authData = testAuthData("example.com", authDataFlagUserPresent|authDataFlagUserVerified, 5)
+			a.requireUV = true
+		}, wantCount: 5},
+		{name: "authenticator without counter", modify: func(a *assertion) {
+			a.authData = testAuthData("example.com", authDataFlagUserPresent, 0)
+			a.storedSign = 0
+		}, wantCount: 0},
+		{name: "rp id hash mismatch", modify: func(a *assertion) {
+			a.authData = testAuthData("evil.example", authDataFlagUserPresent, 5)
+		}, wantErr: ErrWebAuthnInvalidAuthData, wantMsg: "rp id hash mismatch"},
+		{name: "user not present", modify: func(a *assertion) {
+			a.authData = testAuthData("example.com", authDataFlagUserVerified, 5)
+		}, wantErr: ErrWebAuthnInvalidAuthData, wantMsg: "user not present"},
+		{name: "user not verified when required", modify: func(a *assertion) {
+			a.requireUV = true
+		}, wantErr: ErrWebAuthnInvalidAuthData, wantMsg: "user not verified"},
+		{name: "sign count went backwards", modify: func(a *assertion) {
+			a.storedSign = 6
+		}, wantMsg: "sign counter did not increase"},
+		{name: "sign count repeated", modify: func(a *assertion) {
+			a.storedSign = 5
+		}, wantMsg: "sign counter did not increase"},
+		{name: "counter reset to zero", modify: func(a *assertion) {
+			a.authData = testAuthData("example.com", authDataFlagUserPresent, 0)
+		}, wantMsg: "sign counter did not increase"},
+		{name: "challenge mismatch", modify: func(a *assertion) {
+			a.clientData = testClientData(t, "webauthn.get", []byte("other-challenge"), "https://example.com")
+		}, wantErr: ErrWebAuthnInvalidClientData, wantMsg: "challenge mismatch"},
+		{name: "registration client data", modify: func(a *assertion) {
+			a.clientData = testClientData(t, "webauthn.create", challenge, "https://example.com")
+		}, wantErr: ErrWebAuthnInvalidClientData, wantMsg: "unexpected type"},
+		{name: "origin not allowed", modify: func(a *assertion) {
+			a.clientData = testClientData(t, "webauthn.get", challenge, "https://evil.example")
+		}, wantErr: ErrWebAuthnInvalidClientData, wantMsg: "is not allowed"},
+		{name: "truncated auth data", modify: func(a *assertion) {
+			a.authData = a.authData[:36]
+		}, wantErr: ErrWebAuthnInvalidAuthData, wantMsg: "too short"},
+		{name: "tampered signature", modify: func(a *assertion) {
+			a.tamper = true
+		}, wantErr: ErrWebAuthnInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := valid()
+			tt.modify(&a)
+
+			clientDataHash := sha256.Sum256(a.clientData)
+			signature := ed25519.Sign(priv, append(append([]byte(nil), a.authData...), clientDataHash[:]...))
+			if a.tamper {
+				signature[0] ^= 0xff
+			}
+
+			count, err := testRelyingParty.VerifyWebAuthnAssertion(challenge, a.clientData, a.authData, signature, testCOSEKey(pub), a.storedSign, a.requireUV)
+			if tt.wantErr == nil && tt.wantMsg == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if count != tt.wantCount {
+					t.Errorf("sign count = %d, expected %d", count, tt.wantCount)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("assertion accepted, expected an error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, expected %v", err, tt.wantErr)
+			}
+			if tt.wantMsg != "" && !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("error = %v, expected it to contain %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestVerifyWebAuthnAssertionRejectsEmptyChallenge(t *testing.T) {
+	clientData := testClientData(t, "webauthn.get", nil, "https://example.com")
+	_, err := testRelyingParty.VerifyWebAuthnAssertion(nil, clientData, testAuthData("example.com", authDataFlagUserPresent, 1), nil, nil, 0, false)
+	if !errors.Is(err, ErrWebAuthnInvalidClientData) {
+		t.Errorf("error = %v, expected %v", err, ErrWebAuthnInvalidClientData)
+	}
+}
@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+	"gopkg.in/yaml.v3"
+
+	"miaomiaowu/internal/logger"
+)
+
+const (
+	// airGappedAssetsDir 离线模式下由面板自身提供的规则集与地理数据库目录，
+	// 目录结构与离线配置包一致（ruleset/<name>.<ext> 及 GeoIP.dat 等），可直接解压离线包到此处
+	airGappedAssetsDir    = "data/offline"
+	airGappedAssetsPrefix = "/api/offline/"
+)
+
+// ErrAirGapped 离线模式下尝试访问外部网络时返回
+var ErrAirGapped = errors.New("离线模式已启用，禁止访问外部网络")
+
+var (
+	airGappedMode      atomic.Bool
+	airGappedGuardOnce sync.Once
+)
+
+// SetAirGappedMode enables or disables air-gapped mode. When enabled every outbound connection
+// (imports, geo downloads, probe pulls, update checks) is refused and generated configs only
+// reference URLs served by the panel itself.
+func SetAirGappedMode(enabled bool) {
+	airGappedMode.Store(enabled)
+	if enabled {
+		airGappedGuardOnce.Do(installOutboundGuard)
+	}
+}
+
+// IsAirGappedMode reports whether the instance runs in air-gapped mode.
+func IsAirGappedMode() bool {
+	return airGappedMode.Load()
+}
+
+// installOutboundGuard 在默认拨号器上拦截出站连接，覆盖所有基于默认 Transport 的客户端及 WebSocket 探针连接
+func installOutboundGuard() {
+	if transport, ok := http.DefaultTransport.(*http.Transport); ok {
+		next := transport.DialContext
+		if next == nil {
+			next = (&net.Dialer{}).DialContext
+		}
+		transport.DialContext = guardOutboundDial(next)
+	}
+
+	next := websocket.DefaultDialer.NetDialContext
+	if next == nil {
+		next = (&net.Dialer{}).DialContext
+	}
+	websocket.DefaultDialer.NetDialContext = guardOutboundDial(next)
+}
+
+func guardOutboundDial(next func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if IsAirGappedMode() && !isLoopbackAddress(addr) {
+			logger.Warn("[离线模式] 已拦截出站连接", "address", addr)
+			return nil, ErrAirGapped
+		}
+		return next(ctx, network, addr)
+	}
+}
+
+func isLoopbackAddress(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// rejectInAirGappedMode 离线模式下拒绝需要访问外部网络的请求，返回 true 表示已写入响应
+func rejectInAirGappedMode(w http.ResponseWriter) bool {
+	if !IsAirGappedMode() {
+		return false
+	}
+	writeError(w, http.StatusForbidden, ErrAirGapped)
+	return true
+}
+
+// OnlineOnly wraps handlers whose whole purpose is fetching from external networks
+// (update checks, remote syncs) so they answer 403 in air-gapped mode.
+func OnlineOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rejectInAirGappedMode(w) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// panelBaseURL 根据请求推断面板自身的访问地址，只有来自受信任反向代理的请求才采信 X-Forwarded-Host / X-Forwarded-Proto
+func panelBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+	if !isTrustedProxy(remoteHost(r)) {
+		return scheme + "://" + host
+	}
+
+	if proto := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Proto"), ",")[0]); proto != "" {
+		scheme = strings.ToLower(proto)
+	}
+	if forwarded := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Host"), ",")[0]); forwarded != "" {
+		host = forwarded
+	}
+
+	return scheme + "://" + host
+}
+
+// rewriteAirGappedURLs 将配置中的远程规则集与地理数据库地址改写为面板自身的离线资源地址
+func rewriteAirGappedURLs(doc *yaml.Node, baseURL string) {
+	if doc == nil || doc.Kind != yaml.MappingNode {
+		return
+	}
+	assetsBase := strings.TrimRight(baseURL, "/") + airGappedAssetsPrefix
+
+	if providers := mappingValue(doc, "rule-providers"); providers != nil && providers.Kind == yaml.MappingNode {
+		used := make(map[string]struct{})
+		for i := 0; i+1 < len(providers.Content); i += 2 {
+			name := providers.Content[i].Value
+			provider := providers.Content[i+1]
+			if provider.Kind != yaml.MappingNode {
+				continue
+			}
+
+			source := mappingScalar(provider, "url")
+			if mappingScalar(provider, "type") != "http" || source == "" || strings.HasPrefix(source, assetsBase) {
+				continue
+			}
+
+			fileName := uniqueBundleName(bundleFileName(name, source, mappingScalar(provider, "format")), used)
+			setMappingScalar(provider, "url", assetsBase+bundleRuleSetDir+"/"+fileName)
+			deleteMappingKey(provider, "proxy")
+		}
+	}
+
+	geoxURL := mappingValue(doc, "geox-url")
+	if geoxURL == nil || geoxURL.Kind != yaml.MappingNode {
+		geoxURL = &yaml.Node{Kind: yaml.MappingNode}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "geox-url"}, geoxURL)
+	}
+	for _, geo := range bundleGeoFiles {
+		setMappingScalar(geoxURL, geo.Key, assetsBase+geo.Filename)
+	}
+}
+
+// readAirGappedAsset 读取离线资源目录中的文件，name 为相对路径
+func readAirGappedAsset(name string) ([]byte, error) {
+	cleaned := path.Clean("/" + name)
+	if cleaned == "/" {
+		return nil, os.ErrNotExist
+	}
+	return os.ReadFile(filepath.Join(airGappedAssetsDir, filepath.FromSlash(strings.TrimPrefix(cleaned, "/"))))
+}
+
+type offlineAssetHandler struct{}
+
+// NewOfflineAssetHandler serves rule sets and geo databases from data/offline so that
+// clients inside an isolated network can update them from the panel.
+func NewOfflineAssetHandler() http.Handler {
+	return &offlineAssetHandler{}
+}
+
+func (h *offlineAssetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, http.MethodGet, http.MethodHead)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, airGappedAssetsPrefix)
+	cleaned := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if cleaned == "" || cleaned == "." {
+		http.NotFound(w, r)
+		return
+	}
+
+	filePath := filepath.Join(airGappedAssetsDir, filepath.FromSlash(cleaned))
+	info, err := os.Stat(filePath)
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.ServeFile(w, r, filePath)
+}
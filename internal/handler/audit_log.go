@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	// auditRetention 审计日志保留时长
+	auditRetention = 180 * 24 * time.Hour
+	maxAuditLimit  = 500
+)
+
+type auditContextKey struct{}
+
+// auditRecord 由具体的处理器补充的审计详情，未补充时只记录方法和路径
+type auditRecord struct {
+	action string
+	target string
+	before string
+	after  string
+}
+
+// recordAudit lets a handler describe the admin action it just performed. It is a no-op when the
+// request is not being audited (e.g. a GET or a call outside AuditAdminActions).
+func recordAudit(ctx context.Context, action, target, before, after string) {
+	record, ok := ctx.Value(auditContextKey{}).(*auditRecord)
+	if !ok || record == nil {
+		return
+	}
+	record.action = action
+	record.target = target
+	record.before = before
+	record.after = after
+}
+
+// AuditAdminActions records every successful mutating request below /api/admin/ in the audit log
+// with the acting admin, client IP and the before/after summary supplied via recordAudit.
+func AuditAdminActions(tokens *auth.TokenStore, repo *storage.TrafficRepository, next http.Handler) http.Handler {
+	if tokens == nil || repo == nil {
+		panic("audit middleware requires token store and repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/admin/") || !isMutatingMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		record := &auditRecord{}
+		recorder := &accessLogWriter{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), auditContextKey{}, record)))
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status >= http.StatusBadRequest {
+			return
+		}
+
+		token := strings.TrimSpace(r.Header.Get(auth.AuthHeader))
+		if token == "" {
+			token = strings.TrimSpace(r.URL.Query().Get("token"))
+		}
+		actor, _ := tokens.Lookup(token)
+
+		action := record.action
+		if action == "" {
+			action = r.Method + " " + strings.TrimPrefix(r.URL.Path, "/api/admin/")
+		}
+		entry := storage.AuditEntry{
+			Actor:     actor,
+			IP:        getClientIP(r),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Action:    action,
+			Target:    record.target,
+			Before:    record.before,
+			After:     record.after,
+			Status:    status,
+			RequestID: logger.RequestIDFromContext(r.Context()),
+		}
+		if err := repo.CreateAuditEntry(context.WithoutCancel(r.Context()), entry); err != nil {
+			logger.WarnContext(r.Context(), "[审计日志] 记录失败", "action", action, "error", err)
+		}
+	})
+}
+
+// contentAuditSummary 文件内容的审计摘要：行数、字节数和内容指纹
+func contentAuditSummary(data []byte) string {
+	if data == nil {
+		return ""
+	}
+	return fmt.Sprintf("lines=%d bytes=%d revision=%s", bytes.Count(data, []byte("\n"))+1, len(data), fileRevision(data))
+}
+
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// PruneAuditLog removes audit entries older than the retention period.
+func PruneAuditLog(ctx context.Context, repo *storage.TrafficRepository) error {
+	removed, err := repo.PruneAuditEntries(ctx, time.Now().Add(-auditRetention))
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		logger.Info("[审计日志] 已清理过期记录", "count", removed)
+	}
+	return nil
+}
+
+type auditEntryResponse struct {
+	ID        int64     `json:"id"`
+	Actor     string    `json:"actor"`
+	IP        string    `json:"ip"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Before    string    `json:"before"`
+	After     string    `json:"after"`
+	Status    int       `json:"status"`
+	RequestID string    `json:"request_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type auditLogHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewAuditLogHandler lists audit entries (GET) filtered by actor, action prefix, target and a
+// since/until time range, newest first with limit/offset paging.
+func NewAuditLogHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("audit log handler requires repository")
+	}
+
+	return &auditLogHandler{repo: repo}
+}
+
+func (h *auditLogHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := storage.AuditFilter{
+		Actor:  strings.TrimSpace(query.Get("actor")),
+		Action: strings.TrimSpace(query.Get("action")),
+		Target: strings.TrimSpace(query.Get("target")),
+		Limit:  50,
+	}
+
+	var err error
+	if filter.Since, err = parseAuditTime(query.Get("since")); err != nil {
+		writeBadRequest(w, "无效的 since 参数")
+		return
+	}
+	if filter.Until, err = parseAuditTime(query.Get("until")); err != nil {
+		writeBadRequest(w, "无效的 until 参数")
+		return
+	}
+	if raw := strings.TrimSpace(query.Get("limit")); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			writeBadRequest(w, "无效的 limit 参数")
+			return
+		}
+		filter.Limit = min(limit, maxAuditLimit)
+	}
+	if raw := strings.TrimSpace(query.Get("offset")); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			writeBadRequest(w, "无效的 offset 参数")
+			return
+		}
+		filter.Offset = offset
+	}
+
+	entries, total, err := h.repo.ListAuditEntries(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	results := make([]auditEntryResponse, 0, len(entries))
+	for _, e := range entries {
+		results = append(results, auditEntryResponse{
+			ID:        e.ID,
+			Actor:     e.Actor,
+			IP:        e.IP,
+			Method:    e.Method,
+			Path:      e.Path,
+			Action:    e.Action,
+			Target:    e.Target,
+			Before:    e.Before,
+			After:     e.After,
+			Status:    e.Status,
+			RequestID: e.RequestID,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"entries": results, "total": total})
+}
+
+// parseAuditTime 支持 RFC3339 时间或 YYYY-MM-DD 日期，空值表示不限
+func parseAuditTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
@@ -3,8 +3,13 @@ package handler
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"miaomiaowu/internal/auth"
@@ -34,29 +39,107 @@ type credentialsRequest struct {
 	Password string `json:"password"`
 }
 
-// getClientIP extracts the client IP address from the request
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header first (for proxied requests)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
+// trustedProxies 允许设置 X-Forwarded-* / X-Real-IP 的反向代理网段，默认只信任本机回环地址
+var trustedProxies atomic.Pointer[[]*net.IPNet]
+
+// SetTrustedProxies configures the reverse proxies whose X-Forwarded-* and X-Real-IP headers are
+// honoured. Entries are IPs or CIDRs; empty entries are ignored. Loopback is always trusted.
+func SetTrustedProxies(entries []string) error {
+	nets := []*net.IPNet{
+		{IP: net.IPv4(127, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+		{IP: net.IPv6loopback, Mask: net.CIDRMask(128, 128)},
+	}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
 		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		nets = append(nets, ipNet)
 	}
+	trustedProxies.Store(&nets)
+	return nil
+}
 
-	// Check X-Real-IP header
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return strings.TrimSpace(xri)
+func isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	nets := trustedProxies.Load()
+	if nets == nil {
+		return parsed.IsLoopback()
+	}
+	for _, ipNet := range *nets {
+		if ipNet.Contains(parsed) {
+			return true
+		}
 	}
+	return false
+}
 
-	// Fall back to RemoteAddr
+// getClientIP extracts the client IP address from the request. Forwarding headers are only
+// honoured when the connection comes from a trusted proxy, otherwise any client could spoof them.
+// remoteHost 返回直接连接方（客户端或反向代理）的 IP
+func remoteHost(r *http.Request) string {
 	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		return host
+	}
 	if idx := strings.LastIndex(ip, ":"); idx != -1 {
-		ip = ip[:idx]
+		return ip[:idx]
 	}
 	return ip
 }
 
+func getClientIP(r *http.Request) string {
+	ip := remoteHost(r)
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+
+	// X-Forwarded-For 从右往左取第一个不受信任的地址，左侧的条目可以被客户端伪造
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop == "" {
+				continue
+			}
+			if i == 0 || !isTrustedProxy(hop) {
+				return hop
+			}
+		}
+	}
+
+	if xri := strings.TrimSpace(r.Header.Get("X-Real-IP")); xri != "" {
+		return xri
+	}
+	return ip
+}
+
+const (
+	// accountLockThreshold 连续密码错误多少次后锁定账户
+	accountLockThreshold = 5
+	// accountLockDuration 账户锁定时长，到期自动解锁，管理员也可手动解锁
+	accountLockDuration = 15 * time.Minute
+)
+
 func NewLoginHandler(manager *auth.Manager, tokens *auth.TokenStore, repo *storage.TrafficRepository, rateLimiter *LoginRateLimiter) http.Handler {
 	if manager == nil || tokens == nil {
 		panic("login handler requires manager and token store")
@@ -85,11 +168,43 @@ func NewLoginHandler(manager *auth.Manager, tokens *auth.TokenStore, repo *stora
 		// 检查速率限制
 		if rateLimiter != nil {
 			if err := rateLimiter.Check(clientIP, username); err != nil {
+				var limited *RateLimitError
+				if errors.As(err, &limited) {
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+				}
 				writeError(w, http.StatusTooManyRequests, errors.New("too many login attempts, please try again later"))
 				return
 			}
 		}
 
+		// 检查账户是否因该 IP 上连续登录失败被锁定。唯一的管理员不做硬锁定，只受指数退避限制，
+		// 避免有人刷失败把所有管理员锁在面板外
+		lockable := repo != nil
+		if repo != nil {
+			lastAdmin, err := repo.IsLastActiveAdmin(r.Context(), username)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			lockable = !lastAdmin
+		}
+		if lockable {
+			lockout, err := repo.GetUserLockout(r.Context(), username, clientIP)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if lockout.Locked(time.Now()) {
+				logger.Warn("🔒 [LOGIN_LOCKED] 账户已锁定，拒绝登录",
+					"username", username,
+					"client_ip", clientIP,
+					"locked_until", lockout.LockedUntil.Local().Format("2006-01-02 15:04:05"))
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(*lockout.LockedUntil).Seconds()))))
+				writeError(w, http.StatusLocked, errors.New("account temporarily locked due to too many failed logins, please try again later"))
+				return
+			}
+		}
+
 		ok, err := manager.Authenticate(r.Context(), username, payload.Password)
 		if err != nil {
 			writeError(w, http.StatusInternalServerError, err)
@@ -101,6 +216,17 @@ func NewLoginHandler(manager *auth.Manager, tokens *auth.TokenStore, repo *stora
 			if rateLimiter != nil {
 				rateLimiter.RecordFailure(clientIP, username)
 			}
+			if lockable {
+				lockout, err := repo.RecordLoginFailure(r.Context(), username, clientIP, accountLockThreshold, accountLockDuration)
+				if err != nil {
+					logger.Warn("[认证] 记录登录失败次数失败", "username", username, "error", err)
+				} else if lockout.Locked(time.Now()) {
+					logger.Warn("🔒 [LOGIN_LOCKED] 连续登录失败，账户已临时锁定",
+						"username", username,
+						"client_ip", clientIP,
+						"locked_until", lockout.LockedUntil.Local().Format("2006-01-02 15:04:05"))
+				}
+			}
 			logger.Warn("🔐 [LOGIN_FAIL] 登录失败",
 				"username", username,
 				"client_ip", clientIP,
@@ -113,6 +239,11 @@ func NewLoginHandler(manager *auth.Manager, tokens *auth.TokenStore, repo *stora
 		if rateLimiter != nil {
 			rateLimiter.RecordSuccess(clientIP, username)
 		}
+		if repo != nil {
+			if err := repo.ResetLoginFailures(r.Context(), username, clientIP); err != nil {
+				logger.Warn("[认证] 重置登录失败次数失败", "username", username, "error", err)
+			}
+		}
 
 		user, err := manager.User(r.Context(), username)
 		if err != nil {
@@ -158,19 +289,23 @@ func NewLoginHandler(manager *auth.Manager, tokens *auth.TokenStore, repo *stora
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		_ = json.NewEncoder(w).Encode(loginResponse{
-			Token:     token,
-			ExpiresAt: expiry,
-			Username:  user.Username,
-			Email:     user.Email,
-			Nickname:  user.Nickname,
-			Avatar:    user.AvatarURL,
-			Role:      user.Role,
-			IsAdmin:   user.Role == storage.RoleAdmin,
-		})
+		_ = json.NewEncoder(w).Encode(newLoginResponse(token, expiry, user))
 	})
 }
 
+func newLoginResponse(token string, expiry time.Time, user storage.User) loginResponse {
+	return loginResponse{
+		Token:     token,
+		ExpiresAt: expiry,
+		Username:  user.Username,
+		Email:     user.Email,
+		Nickname:  user.Nickname,
+		Avatar:    user.AvatarURL,
+		Role:      user.Role,
+		IsAdmin:   user.Role == storage.RoleAdmin,
+	}
+}
+
 func NewCredentialsHandler(manager *auth.Manager, tokens *auth.TokenStore) http.Handler {
 	if manager == nil || tokens == nil {
 		panic("credentials handler requires manager and token store")
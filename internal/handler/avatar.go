@@ -0,0 +1,291 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	avatarDir           = "data/avatars"
+	avatarURLPrefix     = "/api/avatars/"
+	maxAvatarUploadSize = 5 << 20
+	avatarMaxDimension  = 256
+	// 解码前限制像素总数，防止超大图片耗尽内存
+	avatarMaxSourcePixels = 40_000_000
+)
+
+var avatarFilenamePattern = regexp.MustCompile(`^[a-f0-9]{32}\.png$`)
+
+// allowedAvatarFormats 支持上传的图片格式（image.DecodeConfig 返回的格式名）
+var allowedAvatarFormats = map[string]struct{}{
+	"png":  {},
+	"jpeg": {},
+	"gif":  {},
+}
+
+// NewAvatarUploadHandler handles avatar upload (POST multipart field "avatar") and removal (DELETE).
+// 上传的图片会被缩放并统一转换为 PNG，保存在 data/avatars 目录下
+func NewAvatarUploadHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("avatar upload handler requires repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username := auth.UsernameFromContext(r.Context())
+		if strings.TrimSpace(username) == "" {
+			writeError(w, http.StatusUnauthorized, errUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			handleAvatarUpload(w, r, repo, username)
+		case http.MethodDelete:
+			handleAvatarDelete(w, r, repo, username)
+		default:
+			methodNotAllowed(w, http.MethodPost, http.MethodDelete)
+		}
+	})
+}
+
+func handleAvatarUpload(w http.ResponseWriter, r *http.Request, repo *storage.TrafficRepository, username string) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarUploadSize+1<<20)
+	if err := r.ParseMultipartForm(maxAvatarUploadSize); err != nil {
+		writeBadRequest(w, "头像文件过大或格式错误")
+		return
+	}
+
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		writeBadRequest(w, "缺少头像文件")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxAvatarUploadSize+1))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(data) > maxAvatarUploadSize {
+		writeBadRequest(w, "头像文件不能超过 5MB")
+		return
+	}
+
+	encoded, err := processAvatarImage(data)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	user, err := repo.GetUser(r.Context(), username)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			writeError(w, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	filename, err := saveAvatarFile(encoded)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	avatarURL := avatarURLPrefix + filename
+	if err := repo.UpdateUserProfile(r.Context(), username, storage.UserProfileUpdate{
+		Email:     user.Email,
+		Nickname:  user.Nickname,
+		AvatarURL: avatarURL,
+	}); err != nil {
+		removeLocalAvatar(avatarURL)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// 删除旧的本地头像文件
+	if user.AvatarURL != avatarURL {
+		removeLocalAvatar(user.AvatarURL)
+	}
+
+	logger.Info("[头像] 用户上传头像", "username", username, "file", filename)
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"avatar_url": avatarURL,
+	})
+}
+
+func handleAvatarDelete(w http.ResponseWriter, r *http.Request, repo *storage.TrafficRepository, username string) {
+	user, err := repo.GetUser(r.Context(), username)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			writeError(w, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := repo.UpdateUserProfile(r.Context(), username, storage.UserProfileUpdate{
+		Email:    user.Email,
+		Nickname: user.Nickname,
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	removeLocalAvatar(user.AvatarURL)
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"avatar_url": "",
+	})
+}
+
+// NewAvatarServeHandler serves uploaded avatars from data/avatars.
+func NewAvatarServeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			methodNotAllowed(w, http.MethodGet, http.MethodHead)
+			return
+		}
+
+		filename := strings.TrimPrefix(r.URL.Path, avatarURLPrefix)
+		if !avatarFilenamePattern.MatchString(filename) {
+			http.NotFound(w, r)
+			return
+		}
+
+		path := filepath.Join(avatarDir, filename)
+		if _, err := os.Stat(path); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		// 文件名随机生成且内容不可变，可以长期缓存
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		w.Header().Set("Content-Type", "image/png")
+		http.ServeFile(w, r, path)
+	})
+}
+
+// processAvatarImage 校验图片格式，缩放到不超过 avatarMaxDimension 并编码为 PNG
+func processAvatarImage(data []byte) ([]byte, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New("无法识别的图片格式")
+	}
+	if _, ok := allowedAvatarFormats[format]; !ok {
+		return nil, fmt.Errorf("不支持的图片格式: %s", format)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > avatarMaxSourcePixels {
+		return nil, errors.New("图片尺寸无效或过大")
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New("图片解码失败")
+	}
+
+	resized := resizeAvatar(img, avatarMaxDimension)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, resized); err != nil {
+		return nil, fmt.Errorf("encode avatar: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// resizeAvatar 按比例缩小图片（区域平均采样），不会放大小图
+func resizeAvatar(src image.Image, maxDim int) image.Image {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	rgba := image.NewNRGBA(image.Rect(0, 0, srcW, srcH))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	if srcW <= maxDim && srcH <= maxDim {
+		return rgba
+	}
+
+	dstW, dstH := maxDim, maxDim
+	if srcW > srcH {
+		dstH = max(1, srcH*maxDim/srcW)
+	} else {
+		dstW = max(1, srcW*maxDim/srcH)
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0 := y * srcH / dstH
+		y1 := max(y0+1, (y+1)*srcH/dstH)
+		for x := 0; x < dstW; x++ {
+			x0 := x * srcW / dstW
+			x1 := max(x0+1, (x+1)*srcW/dstW)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := rgba.NRGBAAt(sx, sy)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					b += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)})
+		}
+	}
+
+	return dst
+}
+
+func saveAvatarFile(data []byte) (string, error) {
+	if err := os.MkdirAll(avatarDir, 0o755); err != nil {
+		return "", fmt.Errorf("create avatar dir: %w", err)
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate avatar name: %w", err)
+	}
+	filename := hex.EncodeToString(buf) + ".png"
+
+	if err := os.WriteFile(filepath.Join(avatarDir, filename), data, 0o644); err != nil {
+		return "", fmt.Errorf("write avatar: %w", err)
+	}
+	return filename, nil
+}
+
+// removeLocalAvatar 删除由本服务托管的头像文件，外部链接会被忽略
+func removeLocalAvatar(avatarURL string) {
+	filename := strings.TrimPrefix(strings.TrimSpace(avatarURL), avatarURLPrefix)
+	if filename == avatarURL || !avatarFilenamePattern.MatchString(filename) {
+		return
+	}
+
+	if err := os.Remove(filepath.Join(avatarDir, filename)); err != nil && !os.IsNotExist(err) {
+		logger.Warn("[头像] 删除旧头像失败", "file", filename, "error", err)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"miaomiaowu/internal/logger"
 	"miaomiaowu/internal/storage"
 )
 
@@ -298,6 +299,6 @@ func writeBackupError(w http.ResponseWriter, status int, err error) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(map[string]string{
-		"error": err.Error(),
+		"error": logger.Redact(err.Error()),
 	})
 }
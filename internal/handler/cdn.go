@@ -0,0 +1,357 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	// defaultSubscriptionCacheControl 未配置时订阅内容要求每次重新校验
+	defaultSubscriptionCacheControl = "no-cache"
+	maxCacheControlLength           = 256
+	// cdnPurgeDebounce 合并短时间内的多次文件修改，只发送一次清除请求
+	cdnPurgeDebounce = 2 * time.Second
+	cdnPurgeTimeout  = 15 * time.Second
+	// cdnPurgeMaxTags Cloudflare 单次按标签清除的上限
+	cdnPurgeMaxTags = 30
+)
+
+// cloudflareAPIBase Cloudflare API 地址
+var cloudflareAPIBase = "https://api.cloudflare.com/client/v4"
+
+var cacheControlDirectivePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*(=([A-Za-z0-9-]+|"[^"\\]*"))?$`)
+
+// validateCacheControl 校验订阅文件的 Cache-Control 配置
+func validateCacheControl(value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	if len(value) > maxCacheControlLength {
+		return fmt.Errorf("Cache-Control 不能超过 %d 个字符", maxCacheControlLength)
+	}
+	for _, directive := range strings.Split(value, ",") {
+		if !cacheControlDirectivePattern.MatchString(strings.TrimSpace(directive)) {
+			return fmt.Errorf("无效的 Cache-Control 指令: %s", strings.TrimSpace(directive))
+		}
+	}
+	return nil
+}
+
+// subscriptionCacheTag 订阅文件对应的 CDN 缓存标签，文件内容变化时按标签清除缓存
+func subscriptionCacheTag(filename string) string {
+	sum := sha256.Sum256([]byte(filename))
+	return "mmw-file-" + hex.EncodeToString(sum[:8])
+}
+
+type cdnPurgeResult struct {
+	At      time.Time `json:"at"`
+	Files   []string  `json:"files,omitempty"`
+	Success bool      `json:"success"`
+	Message string    `json:"message,omitempty"`
+}
+
+// cdnPurger sends Cloudflare purge requests for changed subscription files.
+type cdnPurger struct {
+	repo   *storage.TrafficRepository
+	client *http.Client
+
+	mu      sync.Mutex
+	pending map[string]struct{}
+	timer   *time.Timer
+	last    *cdnPurgeResult
+}
+
+var globalCDNPurger atomic.Pointer[cdnPurger]
+
+// StartCDNPurger enables purging the CDN cache whenever a subscription file is written.
+func StartCDNPurger(repo *storage.TrafficRepository) {
+	if repo == nil {
+		panic("cdn purger requires repository")
+	}
+
+	globalCDNPurger.Store(&cdnPurger{
+		repo:    repo,
+		client:  &http.Client{Timeout: cdnPurgeTimeout},
+		pending: make(map[string]struct{}),
+	})
+}
+
+// notifySubscribeFileChanged 订阅文件内容写入后调用，失效该文件的转换缓存，并按文件名合并后异步清除 CDN 缓存
+func notifySubscribeFileChanged(path string) {
+	subscriptionConversionCache.invalidateFile(filepath.Base(path))
+
+	purger := globalCDNPurger.Load()
+	if purger == nil {
+		return
+	}
+	purger.schedule(filepath.Base(path))
+}
+
+func (p *cdnPurger) schedule(filename string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pending[filename] = struct{}{}
+	if p.timer == nil {
+		p.timer = time.AfterFunc(cdnPurgeDebounce, p.flush)
+	}
+}
+
+func (p *cdnPurger) flush() {
+	p.mu.Lock()
+	files := make([]string, 0, len(p.pending))
+	for name := range p.pending {
+		files = append(files, name)
+	}
+	p.pending = make(map[string]struct{})
+	p.timer = nil
+	p.mu.Unlock()
+
+	sort.Strings(files)
+	ctx, cancel := context.WithTimeout(context.Background(), cdnPurgeTimeout)
+	defer cancel()
+	if _, err := p.purge(ctx, files); err != nil {
+		logger.Warn("[CDN] 清除缓存失败", "files", files, "error", err)
+	}
+}
+
+// purge 清除指定文件的缓存；files 为空或配置为清除全部时清除整个 zone。未启用时返回 nil 结果
+func (p *cdnPurger) purge(ctx context.Context, files []string) (*cdnPurgeResult, error) {
+	settings, err := p.repo.GetCDNSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !settings.Enabled {
+		return nil, nil
+	}
+	if settings.ZoneID == "" || settings.APIToken == "" {
+		return nil, errors.New("CDN 清除缓存需要配置 zone_id 和 api_token")
+	}
+	if IsAirGappedMode() {
+		return nil, errors.New("离线模式下不发送 CDN 清除请求")
+	}
+
+	purgeEverything := settings.PurgeEverything || len(files) == 0
+	result := &cdnPurgeResult{At: time.Now(), Files: files}
+	if purgeEverything {
+		err = p.send(ctx, settings, map[string]any{"purge_everything": true})
+	} else {
+		tags := make([]string, 0, len(files))
+		for _, name := range files {
+			tags = append(tags, subscriptionCacheTag(name))
+		}
+		for start := 0; start < len(tags) && err == nil; start += cdnPurgeMaxTags {
+			end := min(start+cdnPurgeMaxTags, len(tags))
+			err = p.send(ctx, settings, map[string]any{"tags": tags[start:end]})
+		}
+	}
+	if err != nil {
+		result.Message = err.Error()
+	} else {
+		result.Success = true
+		logger.Info("[CDN] 已清除缓存", "files", files, "purge_everything", purgeEverything)
+	}
+
+	p.mu.Lock()
+	p.last = result
+	p.mu.Unlock()
+	return result, err
+}
+
+func (p *cdnPurger) send(ctx context.Context, settings storage.CDNSettings, body map[string]any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("%s/zones/%s/purge_cache", cloudflareAPIBase, settings.ZoneID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+settings.APIToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求 Cloudflare 失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var parsed struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return fmt.Errorf("Cloudflare 响应解析失败 (HTTP %d)", resp.StatusCode)
+	}
+	if !parsed.Success {
+		messages := make([]string, 0, len(parsed.Errors))
+		for _, e := range parsed.Errors {
+			messages = append(messages, fmt.Sprintf("%d: %s", e.Code, e.Message))
+		}
+		return fmt.Errorf("Cloudflare 清除缓存失败 (HTTP %d): %s", resp.StatusCode, strings.Join(messages, "; "))
+	}
+	return nil
+}
+
+func (p *cdnPurger) lastResult() *cdnPurgeResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.last
+}
+
+type cdnSettingsRequest struct {
+	Enabled         bool    `json:"enabled"`
+	ZoneID          string  `json:"zone_id"`
+	APIToken        *string `json:"api_token"` // nil keeps the saved token, "" clears it
+	PurgeEverything bool    `json:"purge_everything"`
+}
+
+type cdnSettingsResponse struct {
+	Enabled         bool            `json:"enabled"`
+	ZoneID          string          `json:"zone_id"`
+	HasAPIToken     bool            `json:"has_api_token"`
+	PurgeEverything bool            `json:"purge_everything"`
+	LastPurge       *cdnPurgeResult `json:"last_purge,omitempty"`
+}
+
+type cdnSettingsHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewCDNSettingsHandler manages the Cloudflare purge settings (GET/PUT) and a manual purge of all
+// subscription files at /purge (POST).
+func NewCDNSettingsHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("cdn settings handler requires repository")
+	}
+
+	return &cdnSettingsHandler{repo: repo}
+}
+
+func (h *cdnSettingsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/purge") {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		h.handlePurge(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.respondSettings(w, r)
+	case http.MethodPut:
+		h.handleUpdate(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+	}
+}
+
+func (h *cdnSettingsHandler) respondSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.repo.GetCDNSettings(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := cdnSettingsResponse{
+		Enabled:         settings.Enabled,
+		ZoneID:          settings.ZoneID,
+		HasAPIToken:     settings.APIToken != "",
+		PurgeEverything: settings.PurgeEverything,
+	}
+	if purger := globalCDNPurger.Load(); purger != nil {
+		resp.LastPurge = purger.lastResult()
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func (h *cdnSettingsHandler) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	var payload cdnSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	current, err := h.repo.GetCDNSettings(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	settings := storage.CDNSettings{
+		Enabled:         payload.Enabled,
+		ZoneID:          strings.TrimSpace(payload.ZoneID),
+		APIToken:        current.APIToken,
+		PurgeEverything: payload.PurgeEverything,
+	}
+	if payload.APIToken != nil {
+		settings.APIToken = strings.TrimSpace(*payload.APIToken)
+	}
+	if settings.Enabled && (settings.ZoneID == "" || settings.APIToken == "") {
+		writeBadRequest(w, "启用 CDN 缓存清除需要填写 Zone ID 和 API Token")
+		return
+	}
+
+	if err := h.repo.UpdateCDNSettings(r.Context(), settings); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logger.Info("[CDN] 缓存清除设置已更新", "enabled", settings.Enabled, "zone_id", settings.ZoneID)
+	h.respondSettings(w, r)
+}
+
+func (h *cdnSettingsHandler) handlePurge(w http.ResponseWriter, r *http.Request) {
+	purger := globalCDNPurger.Load()
+	if purger == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("CDN 缓存清除未启动"))
+		return
+	}
+
+	files, err := h.repo.ListSubscribeFiles(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	filenames := make([]string, 0, len(files))
+	for _, file := range files {
+		filenames = append(filenames, file.Filename)
+	}
+
+	result, err := purger.purge(r.Context(), filenames)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	if result == nil {
+		writeBadRequest(w, "CDN 缓存清除未启用")
+		return
+	}
+	respondJSON(w, http.StatusOK, result)
+}
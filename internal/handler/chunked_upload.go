@@ -0,0 +1,521 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// maxChunkedUploadSize 分片上传允许的最大文件大小
+	maxChunkedUploadSize   = 200 << 20
+	defaultUploadChunkSize = 5 << 20
+	minUploadChunkSize     = 256 << 10
+	maxUploadChunkSize     = 16 << 20
+	// uploadSessionTTL 上传会话无活动超过该时长后被清理
+	uploadSessionTTL = 24 * time.Hour
+)
+
+// 上传会话状态
+const (
+	uploadStatusUploading  = "uploading"
+	uploadStatusQueued     = "queued"
+	uploadStatusProcessing = "processing"
+	uploadStatusCompleted  = "completed"
+	uploadStatusFailed     = "failed"
+)
+
+type uploadSession struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Filename    string            `json:"filename"`
+	Size        int64             `json:"size"`
+	SHA256      string            `json:"sha256"`
+	ChunkSize   int64             `json:"chunk_size"`
+	TotalChunks int               `json:"total_chunks"`
+	Received    []int             `json:"received"`
+	Status      string            `json:"status"`
+	Error       string            `json:"error,omitempty"`
+	File        *subscribeFileDTO `json:"file,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+
+	received map[int]bool
+	dir      string
+}
+
+type createUploadRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Filename    string `json:"filename"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	ChunkSize   int64  `json:"chunk_size"`
+}
+
+type chunkedUploadHandler struct {
+	repo       *storage.TrafficRepository
+	stagingDir string
+	jobs       *jobQueue
+
+	mu       sync.Mutex
+	sessions map[string]*uploadSession
+}
+
+// NewChunkedUploadHandler accepts large subscribe file uploads in resumable chunks:
+//
+//	POST   /api/admin/uploads                    start a session (name, filename, size, sha256, chunk_size)
+//	PUT    /api/admin/uploads/{id}/chunks/{n}    upload chunk n (0-based, optional X-Chunk-SHA256 header)
+//	GET    /api/admin/uploads/{id}               received chunks and processing status
+//	POST   /api/admin/uploads/{id}/complete      assemble, verify the checksum and queue the import
+//	DELETE /api/admin/uploads/{id}               abort and remove the staged chunks
+//
+// Chunks can be re-sent in any order until the session is completed. Assembling, validating and
+// saving the file run on a background job queue so a large upload is not bound to a request timeout.
+func NewChunkedUploadHandler(repo *storage.TrafficRepository, stagingDir string) http.Handler {
+	if repo == nil {
+		panic("chunked upload handler requires repository")
+	}
+
+	return &chunkedUploadHandler{
+		repo:       repo,
+		stagingDir: stagingDir,
+		jobs:       newJobQueue("upload-import", 1, 16),
+		sessions:   make(map[string]*uploadSession),
+	}
+}
+
+func (h *chunkedUploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/uploads"), "/")
+	segments := strings.Split(path, "/")
+
+	switch {
+	case path == "" && r.Method == http.MethodPost:
+		h.handleCreate(w, r)
+	case path == "":
+		methodNotAllowed(w, http.MethodPost)
+	case len(segments) == 1 && r.Method == http.MethodGet:
+		h.handleStatus(w, segments[0])
+	case len(segments) == 1 && r.Method == http.MethodDelete:
+		h.handleAbort(w, segments[0])
+	case len(segments) == 1:
+		methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+	case len(segments) == 2 && segments[1] == "complete" && r.Method == http.MethodPost:
+		h.handleComplete(w, segments[0])
+	case len(segments) == 3 && segments[1] == "chunks" && r.Method == http.MethodPut:
+		h.handleChunk(w, r, segments[0], segments[2])
+	default:
+		writeError(w, http.StatusNotFound, errors.New("接口不存在"))
+	}
+}
+
+func (h *chunkedUploadHandler) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var payload createUploadRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	filename := filepath.Base(strings.TrimSpace(payload.Filename))
+	if filename == "" || filename == "." || filename == string(filepath.Separator) {
+		writeBadRequest(w, "缺少文件名 filename")
+		return
+	}
+	if ext := filepath.Ext(filename); ext != ".yaml" && ext != ".yml" {
+		filename += ".yaml"
+	}
+	name := strings.TrimSpace(payload.Name)
+	if name == "" {
+		name = strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+	if payload.Size <= 0 || payload.Size > maxChunkedUploadSize {
+		writeBadRequest(w, fmt.Sprintf("文件大小必须在 1 到 %d 字节之间", maxChunkedUploadSize))
+		return
+	}
+	checksum := strings.ToLower(strings.TrimSpace(payload.SHA256))
+	if !validSHA256Hex(checksum) {
+		writeBadRequest(w, "sha256 必须是 64 位十六进制字符串")
+		return
+	}
+	chunkSize := payload.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = defaultUploadChunkSize
+	}
+	if chunkSize < minUploadChunkSize || chunkSize > maxUploadChunkSize {
+		writeBadRequest(w, fmt.Sprintf("chunk_size 必须在 %d 到 %d 字节之间", minUploadChunkSize, maxUploadChunkSize))
+		return
+	}
+
+	id, err := generateUploadID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.cleanupExpired()
+
+	dir := filepath.Join(h.stagingDir, id)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("创建上传目录失败: %w", err))
+		return
+	}
+
+	now := time.Now()
+	session := &uploadSession{
+		ID:          id,
+		Name:        name,
+		Description: strings.TrimSpace(payload.Description),
+		Filename:    filename,
+		Size:        payload.Size,
+		SHA256:      checksum,
+		ChunkSize:   chunkSize,
+		TotalChunks: int((payload.Size + chunkSize - 1) / chunkSize),
+		Status:      uploadStatusUploading,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		received:    make(map[int]bool),
+		dir:         dir,
+	}
+
+	h.mu.Lock()
+	h.sessions[id] = session
+	view := session.view()
+	h.mu.Unlock()
+
+	logger.Info("[分片上传] 创建上传会话", "id", id, "filename", filename, "size", payload.Size, "chunks", session.TotalChunks)
+	respondJSON(w, http.StatusCreated, map[string]any{"upload": view})
+}
+
+func (h *chunkedUploadHandler) handleChunk(w http.ResponseWriter, r *http.Request, id, rawIndex string) {
+	h.mu.Lock()
+	session, ok := h.sessions[id]
+	var expected int64
+	index, err := strconv.Atoi(rawIndex)
+	if ok && err == nil && index >= 0 && index < session.TotalChunks {
+		expected = session.chunkLength(index)
+	}
+	status := ""
+	if ok {
+		status = session.Status
+	}
+	h.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("上传会话不存在或已过期"))
+		return
+	}
+	if expected == 0 {
+		writeBadRequest(w, "无效的分片序号")
+		return
+	}
+	if !acceptsChunks(status) {
+		writeError(w, http.StatusConflict, errors.New("上传已提交，不能再修改分片"))
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, expected+1))
+	if err != nil {
+		writeBadRequest(w, "读取分片失败")
+		return
+	}
+	if int64(len(data)) != expected {
+		writeBadRequest(w, fmt.Sprintf("分片 %d 大小应为 %d 字节，实际为 %d 字节", index, expected, len(data)))
+		return
+	}
+	if want := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Chunk-SHA256"))); want != "" {
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != want {
+			writeBadRequest(w, fmt.Sprintf("分片 %d 校验和不匹配", index))
+			return
+		}
+	}
+
+	partPath := filepath.Join(session.dir, fmt.Sprintf("%06d.part", index))
+	tmpPath := partPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("保存分片失败: %w", err))
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !acceptsChunks(session.Status) {
+		_ = os.Remove(tmpPath)
+		writeError(w, http.StatusConflict, errors.New("上传已提交，不能再修改分片"))
+		return
+	}
+	if err := os.Rename(tmpPath, partPath); err != nil {
+		_ = os.Remove(tmpPath)
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("保存分片失败: %w", err))
+		return
+	}
+	session.received[index] = true
+	session.UpdatedAt = time.Now()
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"index":    index,
+		"received": len(session.received),
+		"total":    session.TotalChunks,
+	})
+}
+
+func (h *chunkedUploadHandler) handleStatus(w http.ResponseWriter, id string) {
+	h.mu.Lock()
+	session, ok := h.sessions[id]
+	var view uploadSession
+	if ok {
+		view = session.view()
+	}
+	h.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("上传会话不存在或已过期"))
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]any{
+		"upload":  view,
+		"missing": view.missing(),
+	})
+}
+
+func (h *chunkedUploadHandler) handleComplete(w http.ResponseWriter, id string) {
+	h.mu.Lock()
+	session, ok := h.sessions[id]
+	if !ok {
+		h.mu.Unlock()
+		writeError(w, http.StatusNotFound, errors.New("上传会话不存在或已过期"))
+		return
+	}
+	if !acceptsChunks(session.Status) {
+		view := session.view()
+		h.mu.Unlock()
+		respondJSON(w, http.StatusAccepted, map[string]any{"upload": view})
+		return
+	}
+	if missing := session.view().missing(); len(missing) > 0 {
+		h.mu.Unlock()
+		respondJSON(w, http.StatusBadRequest, map[string]any{
+			"error":   fmt.Sprintf("还有 %d 个分片未上传", len(missing)),
+			"missing": missing,
+		})
+		return
+	}
+	previous := session.Status
+	session.Status = uploadStatusQueued
+	session.Error = ""
+	session.UpdatedAt = time.Now()
+	view := session.view()
+	h.mu.Unlock()
+
+	if err := h.jobs.Enqueue("upload "+id, func(ctx context.Context) error {
+		return h.process(ctx, session)
+	}); err != nil {
+		h.mu.Lock()
+		session.Status = previous
+		h.mu.Unlock()
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, map[string]any{"upload": view})
+}
+
+func (h *chunkedUploadHandler) handleAbort(w http.ResponseWriter, id string) {
+	h.mu.Lock()
+	session, ok := h.sessions[id]
+	if ok && (session.Status == uploadStatusQueued || session.Status == uploadStatusProcessing) {
+		h.mu.Unlock()
+		writeError(w, http.StatusConflict, errors.New("上传正在处理中，无法取消"))
+		return
+	}
+	delete(h.sessions, id)
+	h.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("上传会话不存在或已过期"))
+		return
+	}
+	_ = os.RemoveAll(session.dir)
+	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// process 在后台任务中拼接分片、校验整体 sha256 和 YAML 格式，然后保存为上传类型的订阅文件
+func (h *chunkedUploadHandler) process(ctx context.Context, session *uploadSession) error {
+	h.setStatus(session, uploadStatusProcessing, "", nil)
+
+	file, err := h.importSession(ctx, session)
+	if err != nil {
+		h.setStatus(session, uploadStatusFailed, err.Error(), nil)
+		return err
+	}
+	_ = os.RemoveAll(session.dir)
+
+	dto := convertSubscribeFile(file)
+	h.setStatus(session, uploadStatusCompleted, "", &dto)
+	logger.Info("[分片上传] 导入完成", "id", session.ID, "filename", file.Filename, "size", session.Size)
+	return nil
+}
+
+func (h *chunkedUploadHandler) importSession(ctx context.Context, session *uploadSession) (storage.SubscribeFile, error) {
+	content, err := assembleUploadChunks(session)
+	if err != nil {
+		return storage.SubscribeFile{}, err
+	}
+
+	var yamlCheck map[string]any
+	if err := yaml.Unmarshal(content, &yamlCheck); err != nil {
+		return storage.SubscribeFile{}, errors.New("文件不是有效的YAML格式")
+	}
+
+	subscribesDir := "subscribes"
+	if err := os.MkdirAll(subscribesDir, 0755); err != nil {
+		return storage.SubscribeFile{}, errors.New("创建订阅目录失败")
+	}
+	filePath := filepath.Join(subscribesDir, session.Filename)
+	if _, err := os.Stat(filePath); err == nil {
+		return storage.SubscribeFile{}, errors.New("订阅文件名已存在")
+	}
+	if err := os.WriteFile(filePath, content, 0644); err != nil {
+		return storage.SubscribeFile{}, errors.New("保存订阅文件失败")
+	}
+
+	created, err := h.repo.CreateSubscribeFile(ctx, storage.SubscribeFile{
+		Name:        session.Name,
+		Description: session.Description,
+		Type:        storage.SubscribeTypeUpload,
+		Filename:    session.Filename,
+	})
+	if err != nil {
+		_ = os.Remove(filePath)
+		if errors.Is(err, storage.ErrSubscribeFileExists) {
+			return storage.SubscribeFile{}, errors.New("订阅名称已存在")
+		}
+		return storage.SubscribeFile{}, err
+	}
+	notifySubscribeFileChanged(filePath)
+	return created, nil
+}
+
+// assembleUploadChunks 按顺序拼接分片并校验大小和 sha256
+func assembleUploadChunks(session *uploadSession) ([]byte, error) {
+	content := make([]byte, 0, session.Size)
+	for i := 0; i < session.TotalChunks; i++ {
+		data, err := os.ReadFile(filepath.Join(session.dir, fmt.Sprintf("%06d.part", i)))
+		if err != nil {
+			return nil, fmt.Errorf("读取分片 %d 失败: %w", i, err)
+		}
+		content = append(content, data...)
+	}
+	if int64(len(content)) != session.Size {
+		return nil, fmt.Errorf("文件大小不匹配：应为 %d 字节，实际为 %d 字节", session.Size, len(content))
+	}
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != session.SHA256 {
+		return nil, errors.New("文件 sha256 校验失败，请重新上传")
+	}
+	return content, nil
+}
+
+func (h *chunkedUploadHandler) setStatus(session *uploadSession, status, message string, file *subscribeFileDTO) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	session.Status = status
+	session.Error = message
+	session.File = file
+	session.UpdatedAt = time.Now()
+}
+
+// cleanupExpired 清理长时间无活动的会话及其暂存分片，处理中的会话不受影响
+func (h *chunkedUploadHandler) cleanupExpired() {
+	cutoff := time.Now().Add(-uploadSessionTTL)
+	var dirs []string
+
+	h.mu.Lock()
+	for id, session := range h.sessions {
+		if session.UpdatedAt.After(cutoff) || session.Status == uploadStatusQueued || session.Status == uploadStatusProcessing {
+			continue
+		}
+		delete(h.sessions, id)
+		dirs = append(dirs, session.dir)
+	}
+	h.mu.Unlock()
+
+	for _, dir := range dirs {
+		_ = os.RemoveAll(dir)
+	}
+	if len(dirs) > 0 {
+		logger.Info("[分片上传] 清理过期上传会话", "count", len(dirs))
+	}
+}
+
+// acceptsChunks 上传中或导入失败（可重传分片后再次提交）的会话允许写入分片
+func acceptsChunks(status string) bool {
+	return status == uploadStatusUploading || status == uploadStatusFailed
+}
+
+// chunkLength 返回第 index 个分片应有的字节数，最后一个分片可能较短
+func (s *uploadSession) chunkLength(index int) int64 {
+	if index == s.TotalChunks-1 {
+		return s.Size - int64(index)*s.ChunkSize
+	}
+	return s.ChunkSize
+}
+
+// view 返回可以在锁外读取的副本
+func (s *uploadSession) view() uploadSession {
+	v := *s
+	v.Received = make([]int, 0, len(s.received))
+	for index := range s.received {
+		v.Received = append(v.Received, index)
+	}
+	sort.Ints(v.Received)
+	v.received = nil
+	return v
+}
+
+func (s uploadSession) missing() []int {
+	missing := []int{}
+	next := 0
+	for i := 0; i < s.TotalChunks; i++ {
+		if next < len(s.Received) && s.Received[next] == i {
+			next++
+			continue
+		}
+		missing = append(missing, i)
+	}
+	return missing
+}
+
+func validSHA256Hex(value string) bool {
+	if len(value) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
+
+func generateUploadID() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
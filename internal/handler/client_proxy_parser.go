@@ -0,0 +1,647 @@
+package handler
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Surge / Loon / Quantumult X 节点行反向解析为 Clash 节点。
+// Surge 与 Loon 都是 "名称 = 类型, 服务器, 端口, ..." 的形式：Surge 的认证参数用 key=value，
+// Loon 的加密方式、密码等按位置排列，两种写法在同一个解析器里兼容。
+// Quantumult X 是 "类型=服务器:端口, key=value, ..., tag=名称" 的形式。
+
+// clientConfigProxySections 完整配置中存放节点的段落（小写）
+var clientConfigProxySections = map[string]struct{}{
+	"proxy":        {},
+	"server_local": {},
+}
+
+// clientConfigIgnoredTypes 不代表实际代理节点的类型
+var clientConfigIgnoredTypes = map[string]struct{}{
+	"direct":         {},
+	"reject":         {},
+	"reject-tinygif": {},
+	"reject-drop":    {},
+	"reject-no-drop": {},
+	"block":          {},
+	"external":       {},
+}
+
+// surgeIPVersions Surge ip-version 取值到 Clash 取值的映射
+var surgeIPVersions = map[string]string{
+	"dual":      "dual",
+	"v4-only":   "ipv4",
+	"v6-only":   "ipv6",
+	"prefer-v4": "ipv4-prefer",
+	"prefer-v6": "ipv6-prefer",
+}
+
+// qxProxyTypes Quantumult X 节点行的类型前缀
+var qxProxyTypes = map[string]struct{}{
+	"shadowsocks": {},
+	"vmess":       {},
+	"vless":       {},
+	"trojan":      {},
+	"http":        {},
+	"socks5":      {},
+}
+
+// errClientProxyIgnored marks lines that are valid but are not proxies (DIRECT, REJECT, ...).
+var errClientProxyIgnored = errors.New("not a proxy")
+
+// clientProxyLine is one proxy line taken from a Surge/Loon/QX config.
+type clientProxyLine struct {
+	Line int
+	Text string
+}
+
+// extractClientProxyLines returns the proxy lines of a config. When the content has [Section] headers
+// only [Proxy] / [server_local] are read, otherwise every non-comment line is a candidate.
+func extractClientProxyLines(content string) []clientProxyLine {
+	hasSections := false
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	var all []clientProxyLine
+	inProxySection := false
+	var sectioned []clientProxyLine
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			hasSections = true
+			_, inProxySection = clientConfigProxySections[strings.ToLower(strings.TrimSpace(line[1:len(line)-1]))]
+			continue
+		}
+		entry := clientProxyLine{Line: lineNo, Text: line}
+		all = append(all, entry)
+		if inProxySection {
+			sectioned = append(sectioned, entry)
+		}
+	}
+	if hasSections {
+		return sectioned
+	}
+	return all
+}
+
+// isQuantumultXLine 判断是否是 Quantumult X 节点行（类型=服务器:端口）
+func isQuantumultXLine(line string) bool {
+	key, _, ok := strings.Cut(line, "=")
+	if !ok {
+		return false
+	}
+	_, known := qxProxyTypes[strings.ToLower(strings.TrimSpace(key))]
+	return known && strings.Contains(strings.ToLower(line), "tag=")
+}
+
+// isLoonProxyLine 判断是否是 Loon 写法：第 4 个字段起是按位置排列的加密方式或密码，而不是 key=value
+func isLoonProxyLine(line string) bool {
+	_, rest, ok := strings.Cut(line, "=")
+	if !ok {
+		return false
+	}
+	fields := splitConfigFields(rest)
+	if len(fields) < 4 {
+		return false
+	}
+	return !strings.Contains(fields[3], "=") || strings.HasPrefix(fields[3], `"`)
+}
+
+// splitConfigFields splits a comma separated proxy line, keeping commas inside double quotes.
+func splitConfigFields(s string) []string {
+	var fields []string
+	var b strings.Builder
+	inQuote := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			b.WriteRune(r)
+		case r == ',' && !inQuote:
+			fields = append(fields, strings.TrimSpace(b.String()))
+			b.Reset()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	fields = append(fields, strings.TrimSpace(b.String()))
+	return fields
+}
+
+func unquoteConfigValue(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// configFields are the positional and key=value parts of a proxy line.
+type configFields struct {
+	positional []string
+	options    map[string]string
+}
+
+func parseConfigFields(fields []string) configFields {
+	parsed := configFields{options: make(map[string]string)}
+	for _, field := range fields {
+		if field == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(field, "=")
+		// 带引号的位置参数（如 Loon 的密码）里可能含有 '='
+		if !ok || strings.HasPrefix(field, `"`) {
+			parsed.positional = append(parsed.positional, unquoteConfigValue(field))
+			continue
+		}
+		parsed.options[strings.ToLower(strings.TrimSpace(key))] = unquoteConfigValue(value)
+	}
+	return parsed
+}
+
+// get returns the first non-empty option among keys.
+func (f configFields) get(keys ...string) string {
+	for _, key := range keys {
+		if v := f.options[key]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// pos returns the positional argument at i, or "" when absent.
+func (f configFields) pos(i int) string {
+	if i < len(f.positional) {
+		return f.positional[i]
+	}
+	return ""
+}
+
+// setBool copies a true/false option to the proxy under key.
+func (f configFields) setBool(proxy map[string]any, key string, optionKeys ...string) {
+	for _, optionKey := range optionKeys {
+		if v, ok := f.options[optionKey]; ok {
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				proxy[key] = b
+				return
+			}
+		}
+	}
+}
+
+// parseSurgeProxyLine parses a Surge or Loon proxy line: name = type, server, port, ...
+func parseSurgeProxyLine(line string) (map[string]any, error) {
+	name, rest, ok := strings.Cut(line, "=")
+	if !ok {
+		return nil, errors.New("missing '='")
+	}
+	name = unquoteConfigValue(name)
+	if name == "" {
+		return nil, errors.New("missing proxy name")
+	}
+
+	fields := splitConfigFields(rest)
+	proxyType := strings.ToLower(unquoteConfigValue(fields[0]))
+	if _, ignored := clientConfigIgnoredTypes[proxyType]; ignored || len(fields) == 1 {
+		return nil, errClientProxyIgnored
+	}
+	if proxyType == "wireguard" {
+		return nil, errors.New("wireguard proxies reference a separate [WireGuard] section and cannot be imported from a single line")
+	}
+	if len(fields) < 3 {
+		return nil, errors.New("missing server or port")
+	}
+
+	server := unquoteConfigValue(fields[1])
+	port, err := strconv.Atoi(unquoteConfigValue(fields[2]))
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid port %q", fields[2])
+	}
+	f := parseConfigFields(fields[3:])
+
+	proxy := map[string]any{
+		"name":   name,
+		"server": server,
+		"port":   port,
+	}
+
+	switch proxyType {
+	case "ss", "shadowsocks":
+		proxy["type"] = "ss"
+		proxy["cipher"] = firstNonEmpty(f.get("encrypt-method", "method"), f.pos(0))
+		proxy["password"] = firstNonEmpty(f.get("password"), f.pos(1))
+		if mode := f.get("obfs", "obfs-name"); mode != "" {
+			opts := map[string]any{"mode": mode}
+			if host := f.get("obfs-host"); host != "" {
+				opts["host"] = host
+			}
+			if path := f.get("obfs-uri"); path != "" {
+				opts["path"] = path
+			}
+			proxy["plugin"] = "obfs"
+			proxy["plugin-opts"] = opts
+		}
+	case "ssr", "shadowsocksr":
+		proxy["type"] = "ssr"
+		proxy["cipher"] = firstNonEmpty(f.get("encrypt-method", "method"), f.pos(0))
+		proxy["password"] = firstNonEmpty(f.get("password"), f.pos(1))
+		proxy["protocol"] = f.get("protocol")
+		proxy["obfs"] = f.get("obfs")
+		if v := f.get("protocol-param"); v != "" {
+			proxy["protocol-param"] = v
+		}
+		if v := f.get("obfs-param"); v != "" {
+			proxy["obfs-param"] = v
+		}
+	case "vmess":
+		proxy["type"] = "vmess"
+		// Loon: vmess, server, port, cipher, "uuid"
+		uuid := f.get("username", "uuid")
+		cipher := "auto"
+		if uuid == "" {
+			cipher = firstNonEmpty(f.pos(0), cipher)
+			uuid = f.pos(1)
+		}
+		proxy["uuid"] = uuid
+		proxy["cipher"] = cipher
+		alterID := 0
+		if v := f.get("alterid"); v != "" {
+			alterID, _ = strconv.Atoi(v)
+		} else if v := f.get("vmess-aead"); v == "false" {
+			alterID = 1
+		}
+		proxy["alterId"] = alterID
+		applyConfigTLS(proxy, f, "servername")
+		applyConfigTransport(proxy, f)
+	case "vless":
+		proxy["type"] = "vless"
+		proxy["uuid"] = firstNonEmpty(f.get("uuid", "username"), f.pos(0))
+		if flow := f.get("flow"); flow != "" {
+			proxy["flow"] = flow
+		}
+		applyConfigTLS(proxy, f, "servername")
+		applyConfigTransport(proxy, f)
+		if publicKey := f.get("public-key"); publicKey != "" {
+			reality := map[string]any{"public-key": publicKey}
+			if shortID := f.get("short-id"); shortID != "" {
+				reality["short-id"] = shortID
+			}
+			proxy["reality-opts"] = reality
+			proxy["tls"] = true
+		}
+	case "trojan":
+		proxy["type"] = "trojan"
+		proxy["password"] = firstNonEmpty(f.get("password"), f.pos(0))
+		applyConfigTLS(proxy, f, "sni")
+		applyConfigTransport(proxy, f)
+		delete(proxy, "tls")
+	case "http", "https":
+		proxy["type"] = "http"
+		if proxyType == "https" {
+			proxy["tls"] = true
+		}
+		setConfigCredentials(proxy, f)
+		applyConfigTLS(proxy, f, "sni")
+	case "socks5", "socks5-tls":
+		proxy["type"] = "socks5"
+		if proxyType == "socks5-tls" {
+			proxy["tls"] = true
+		}
+		setConfigCredentials(proxy, f)
+		applyConfigTLS(proxy, f, "sni")
+	case "snell":
+		proxy["type"] = "snell"
+		proxy["psk"] = firstNonEmpty(f.get("psk"), f.pos(0))
+		if v, err := strconv.Atoi(f.get("version")); err == nil {
+			proxy["version"] = v
+		}
+		if mode := f.get("obfs"); mode != "" {
+			opts := map[string]any{"mode": mode}
+			if host := f.get("obfs-host"); host != "" {
+				opts["host"] = host
+			}
+			proxy["obfs-opts"] = opts
+		}
+	case "tuic", "tuic-v5":
+		proxy["type"] = "tuic"
+		if v := f.get("uuid"); v != "" {
+			proxy["uuid"] = v
+		}
+		if v := f.get("password"); v != "" {
+			proxy["password"] = v
+		}
+		if v := f.get("token"); v != "" {
+			proxy["token"] = v
+		}
+		if v := f.get("alpn"); v != "" {
+			proxy["alpn"] = []any{v}
+		}
+		applyConfigTLS(proxy, f, "sni")
+		delete(proxy, "tls")
+	case "hysteria2":
+		proxy["type"] = "hysteria2"
+		proxy["password"] = firstNonEmpty(f.get("password"), f.pos(0))
+		if v := f.get("salamander-password"); v != "" {
+			proxy["obfs"] = "salamander"
+			proxy["obfs-password"] = v
+		}
+		if v := f.get("port-hopping"); v != "" {
+			proxy["ports"] = strings.ReplaceAll(v, ";", ",")
+		}
+		if v := f.get("download-bandwidth"); v != "" {
+			proxy["down"] = v + " Mbps"
+		}
+		applyConfigTLS(proxy, f, "sni")
+		delete(proxy, "tls")
+	case "anytls":
+		proxy["type"] = "anytls"
+		proxy["password"] = firstNonEmpty(f.get("password"), f.pos(0))
+		applyConfigTLS(proxy, f, "sni")
+		delete(proxy, "tls")
+	default:
+		return nil, fmt.Errorf("unsupported proxy type %q", proxyType)
+	}
+
+	applyConfigCommon(proxy, f)
+	applyConfigShadowTLS(proxy, f)
+	return proxy, nil
+}
+
+// parseQuantumultXLine parses a Quantumult X server line: type=server:port, key=value, ..., tag=name
+func parseQuantumultXLine(line string) (map[string]any, error) {
+	fields := splitConfigFields(line)
+	proxyType, address, ok := strings.Cut(fields[0], "=")
+	if !ok {
+		return nil, errors.New("missing '='")
+	}
+	proxyType = strings.ToLower(strings.TrimSpace(proxyType))
+	host, portText, err := net.SplitHostPort(strings.TrimSpace(address))
+	if err != nil {
+		return nil, fmt.Errorf("invalid server address %q", address)
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid port %q", portText)
+	}
+	f := parseConfigFields(fields[1:])
+	name := f.get("tag")
+	if name == "" {
+		return nil, errors.New("missing tag")
+	}
+
+	proxy := map[string]any{
+		"name":   name,
+		"server": host,
+		"port":   port,
+	}
+
+	obfs := strings.ToLower(f.get("obfs"))
+	switch proxyType {
+	case "shadowsocks":
+		proxy["cipher"] = f.get("method")
+		proxy["password"] = f.get("password")
+		if protocol := f.get("ssr-protocol"); protocol != "" {
+			proxy["type"] = "ssr"
+			proxy["protocol"] = protocol
+			if v := f.get("ssr-protocol-param"); v != "" {
+				proxy["protocol-param"] = v
+			}
+			proxy["obfs"] = firstNonEmpty(obfs, "plain")
+			if v := f.get("obfs-host"); v != "" {
+				proxy["obfs-param"] = v
+			}
+			break
+		}
+		proxy["type"] = "ss"
+		switch obfs {
+		case "":
+		case "http", "tls":
+			opts := map[string]any{"mode": obfs}
+			if v := f.get("obfs-host"); v != "" {
+				opts["host"] = v
+			}
+			if v := f.get("obfs-uri"); v != "" {
+				opts["path"] = v
+			}
+			proxy["plugin"] = "obfs"
+			proxy["plugin-opts"] = opts
+		case "ws", "wss":
+			opts := map[string]any{"mode": "websocket"}
+			if obfs == "wss" {
+				opts["tls"] = true
+			}
+			if v := f.get("obfs-host"); v != "" {
+				opts["host"] = v
+			}
+			if v := f.get("obfs-uri"); v != "" {
+				opts["path"] = v
+			}
+			proxy["plugin"] = "v2ray-plugin"
+			proxy["plugin-opts"] = opts
+		default:
+			return nil, fmt.Errorf("unsupported shadowsocks obfs %q", obfs)
+		}
+	case "vmess", "vless":
+		proxy["type"] = proxyType
+		proxy["uuid"] = f.get("password")
+		if proxyType == "vmess" {
+			proxy["cipher"] = firstNonEmpty(f.get("method"), "auto")
+			proxy["alterId"] = 0
+			if f.get("aead") == "false" {
+				proxy["alterId"] = 1
+			}
+		} else if flow := f.get("vless-flow"); flow != "" {
+			proxy["flow"] = flow
+		}
+		if err := applyQXObfs(proxy, f, obfs, "servername"); err != nil {
+			return nil, err
+		}
+		if publicKey := f.get("reality-base64-pubkey"); publicKey != "" {
+			reality := map[string]any{"public-key": publicKey}
+			if shortID := f.get("reality-hex-shortid"); shortID != "" {
+				reality["short-id"] = shortID
+			}
+			proxy["reality-opts"] = reality
+			proxy["tls"] = true
+		}
+	case "trojan":
+		proxy["type"] = "trojan"
+		proxy["password"] = f.get("password")
+		if err := applyQXObfs(proxy, f, obfs, "sni"); err != nil {
+			return nil, err
+		}
+		delete(proxy, "tls")
+	case "http", "socks5":
+		proxy["type"] = proxyType
+		setConfigCredentials(proxy, f)
+		f.setBool(proxy, "tls", "over-tls")
+		applyQXTLS(proxy, f, "sni")
+	default:
+		return nil, fmt.Errorf("unsupported proxy type %q", proxyType)
+	}
+
+	f.setBool(proxy, "udp", "udp-relay")
+	f.setBool(proxy, "tfo", "fast-open")
+	return proxy, nil
+}
+
+// applyQXObfs maps the Quantumult X obfs option to a Clash transport and TLS settings.
+func applyQXObfs(proxy map[string]any, f configFields, obfs, sniKey string) error {
+	switch obfs {
+	case "", "over-tls":
+		if obfs == "over-tls" || f.get("over-tls") == "true" {
+			proxy["tls"] = true
+		}
+	case "ws", "wss":
+		proxy["network"] = "ws"
+		wsOpts := map[string]any{}
+		if v := f.get("obfs-uri"); v != "" {
+			wsOpts["path"] = v
+		}
+		if v := f.get("obfs-host"); v != "" {
+			wsOpts["headers"] = map[string]any{"Host": v}
+		}
+		proxy["ws-opts"] = wsOpts
+		if obfs == "wss" {
+			proxy["tls"] = true
+		}
+	case "http":
+		proxy["network"] = "http"
+		httpOpts := map[string]any{}
+		if v := f.get("obfs-uri"); v != "" {
+			httpOpts["path"] = []any{v}
+		}
+		if v := f.get("obfs-host"); v != "" {
+			httpOpts["headers"] = map[string]any{"Host": []any{v}}
+		}
+		proxy["http-opts"] = httpOpts
+	default:
+		return fmt.Errorf("unsupported obfs %q", obfs)
+	}
+	applyQXTLS(proxy, f, sniKey)
+	return nil
+}
+
+func applyQXTLS(proxy map[string]any, f configFields, sniKey string) {
+	if v := f.get("tls-host"); v != "" {
+		proxy[sniKey] = v
+	}
+	if v, ok := f.options["tls-verification"]; ok {
+		if verify, err := strconv.ParseBool(v); err == nil {
+			proxy["skip-cert-verify"] = !verify
+		}
+	}
+	if v := f.get("tls-cert-sha256"); v != "" {
+		proxy["fingerprint"] = v
+	}
+	if v := f.get("tls-alpn"); v != "" {
+		proxy["alpn"] = []any{v}
+	}
+}
+
+// applyConfigTLS reads the Surge/Loon TLS options; sniKey is "servername" for vmess/vless and "sni" otherwise.
+func applyConfigTLS(proxy map[string]any, f configFields, sniKey string) {
+	f.setBool(proxy, "tls", "tls", "over-tls")
+	if sni := f.get("sni", "tls-name"); sni != "" {
+		proxy[sniKey] = sni
+	}
+	f.setBool(proxy, "skip-cert-verify", "skip-cert-verify")
+	if v := f.get("server-cert-fingerprint-sha256", "tls-cert-sha256"); v != "" {
+		proxy["fingerprint"] = v
+	}
+}
+
+// applyConfigTransport reads the Surge (ws=true, ws-path, ws-headers) and Loon (transport, path, host) transports.
+func applyConfigTransport(proxy map[string]any, f configFields) {
+	network := strings.ToLower(f.get("transport"))
+	if f.get("ws") == "true" {
+		network = "ws"
+	}
+	path := f.get("ws-path", "path")
+	host := f.get("host")
+	if headers := f.get("ws-headers"); headers != "" {
+		for _, header := range strings.Split(headers, "|") {
+			key, value, ok := strings.Cut(header, ":")
+			if ok && strings.EqualFold(strings.TrimSpace(key), "host") {
+				host = unquoteConfigValue(value)
+			}
+		}
+	}
+
+	switch network {
+	case "ws":
+		proxy["network"] = "ws"
+		wsOpts := map[string]any{}
+		if path != "" {
+			wsOpts["path"] = path
+		}
+		if host != "" {
+			wsOpts["headers"] = map[string]any{"Host": host}
+		}
+		proxy["ws-opts"] = wsOpts
+	case "http":
+		proxy["network"] = "http"
+		httpOpts := map[string]any{}
+		if path != "" {
+			httpOpts["path"] = []any{path}
+		}
+		if host != "" {
+			httpOpts["headers"] = map[string]any{"Host": []any{host}}
+		}
+		proxy["http-opts"] = httpOpts
+	}
+}
+
+// setConfigCredentials reads username/password from options or, for Loon, from positional arguments.
+func setConfigCredentials(proxy map[string]any, f configFields) {
+	if v := firstNonEmpty(f.get("username"), f.pos(0)); v != "" {
+		proxy["username"] = v
+	}
+	if v := firstNonEmpty(f.get("password"), f.pos(1)); v != "" {
+		proxy["password"] = v
+	}
+}
+
+func applyConfigCommon(proxy map[string]any, f configFields) {
+	f.setBool(proxy, "udp", "udp-relay", "udp")
+	f.setBool(proxy, "tfo", "tfo", "fast-open")
+	if v, ok := surgeIPVersions[f.get("ip-version")]; ok {
+		proxy["ip-version"] = v
+	}
+	if v := f.get("underlying-proxy"); v != "" {
+		proxy["dialer-proxy"] = v
+	}
+}
+
+func applyConfigShadowTLS(proxy map[string]any, f configFields) {
+	password := f.get("shadow-tls-password")
+	if password == "" {
+		return
+	}
+	opts := map[string]any{"password": password}
+	if host := f.get("shadow-tls-sni"); host != "" {
+		opts["host"] = host
+	}
+	if v, err := strconv.Atoi(f.get("shadow-tls-version")); err == nil {
+		opts["version"] = v
+	}
+	proxy["plugin"] = "shadow-tls"
+	proxy["plugin-opts"] = opts
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
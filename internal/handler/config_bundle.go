@@ -0,0 +1,444 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	bundleRuleSetDir       = "ruleset"
+	bundleMaxFileSize      = 64 << 20
+	bundleDownloadTimeout  = 60 * time.Second
+	bundleManifestFilename = "manifest.json"
+)
+
+// bundleGeoFiles 是 mihomo 在配置目录中默认查找的地理数据库文件名及默认下载地址
+var bundleGeoFiles = []struct {
+	Key        string
+	Filename   string
+	DefaultURL string
+}{
+	{Key: "geoip", Filename: "GeoIP.dat", DefaultURL: "https://github.com/MetaCubeX/meta-rules-dat/releases/download/latest/geoip.dat"},
+	{Key: "geosite", Filename: "GeoSite.dat", DefaultURL: "https://github.com/MetaCubeX/meta-rules-dat/releases/download/latest/geosite.dat"},
+	{Key: "mmdb", Filename: "Country.mmdb", DefaultURL: "https://github.com/MetaCubeX/meta-rules-dat/releases/download/latest/country.mmdb"},
+	{Key: "asn", Filename: "GeoLite2-ASN.mmdb", DefaultURL: "https://github.com/xishang0128/geoip/releases/download/latest/GeoLite2-ASN.mmdb"},
+}
+
+var bundleUnsafeNameChars = regexp.MustCompile(`[^\p{L}\p{N}._-]+`)
+
+type bundleManifestEntry struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Path   string `json:"path,omitempty"`
+	Bytes  int    `json:"bytes,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type bundleManifest struct {
+	Subscription  string                `json:"subscription"`
+	GeneratedAt   time.Time             `json:"generated_at"`
+	RuleProviders []bundleManifestEntry `json:"rule_providers"`
+	GeoDatabases  []bundleManifestEntry `json:"geo_databases"`
+}
+
+type configBundleHandler struct {
+	repo         *storage.TrafficRepository
+	subscription *SubscriptionHandler
+}
+
+// NewConfigBundleHandler packages a generated Clash config together with its rule-provider files
+// and geo databases into a zip that works on devices without network access to those sources.
+func NewConfigBundleHandler(repo *storage.TrafficRepository, subscription *SubscriptionHandler) http.Handler {
+	if repo == nil || subscription == nil {
+		panic("config bundle handler requires repository and subscription handler")
+	}
+
+	return &configBundleHandler{repo: repo, subscription: subscription}
+}
+
+func (h *configBundleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	username := auth.UsernameFromContext(r.Context())
+	if username == "" {
+		writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	filename := strings.TrimSpace(r.URL.Query().Get("filename"))
+	if filename == "" {
+		writeBadRequest(w, "缺少 filename 参数")
+		return
+	}
+	includeGeo := r.URL.Query().Get("geo") != "0"
+
+	config, err := renderSubscriptionConfig(h.subscription, r, filename)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(config, &root); err != nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		writeError(w, http.StatusBadRequest, errors.New("生成的配置不是有效的 Clash YAML"))
+		return
+	}
+	doc := root.Content[0]
+
+	client := importFetchClient(bundleDownloadTimeout, false)
+	manifest := bundleManifest{
+		Subscription:  filename,
+		GeneratedAt:   time.Now(),
+		RuleProviders: []bundleManifestEntry{},
+		GeoDatabases:  []bundleManifestEntry{},
+	}
+	files := make(map[string][]byte)
+
+	h.mirrorRuleProviders(r.Context(), client, doc, files, &manifest)
+	if includeGeo {
+		h.mirrorGeoDatabases(r.Context(), client, doc, files, &manifest)
+	}
+
+	rendered, err := MarshalYAMLWithIndent(&root)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	files["config.yaml"] = []byte(RemoveUnicodeEscapeQuotes(string(rendered)))
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	files[bundleManifestFilename] = manifestData
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		data := files[name]
+		fw, err := zw.Create(name)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if _, err := fw.Write(data); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	bundleName := strings.TrimSuffix(path.Base(filename), path.Ext(filename)) + "-offline.zip"
+	logger.Info("[离线包] 生成完成",
+		"user", username,
+		"filename", filename,
+		"rule_providers", len(manifest.RuleProviders),
+		"geo_databases", len(manifest.GeoDatabases),
+		"bytes", buf.Len())
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename*=UTF-8''"+url.PathEscape(bundleName))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// renderSubscriptionConfig 复用订阅接口生成 Clash 配置，保证与客户端拉取的内容一致
+func renderSubscriptionConfig(subscription *SubscriptionHandler, r *http.Request, filename string) ([]byte, error) {
+	query := url.Values{}
+	query.Set("filename", filename)
+	// 显式指定 clashmeta，避免订阅文件设置了默认转换类型时返回非 Clash 格式
+	query.Set("t", "clashmeta")
+
+	subURL := *r.URL
+	subURL.Path = "/api/clash/subscribe"
+	subURL.RawQuery = query.Encode()
+
+	subRequest := r.Clone(r.Context())
+	subRequest.URL = &subURL
+	subRequest.RequestURI = subURL.RequestURI()
+	// 伪装为非浏览器客户端，避免订阅接口按浏览器逻辑处理
+	subRequest.Header.Set("User-Agent", "clash.meta")
+
+	recorder := newBufferedResponseWriter()
+	subscription.ServeHTTP(recorder, subRequest)
+
+	if recorder.status != http.StatusOK {
+		var payload struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(recorder.body.Bytes(), &payload) == nil && payload.Error != "" {
+			return nil, fmt.Errorf("生成配置失败: %s", payload.Error)
+		}
+		return nil, fmt.Errorf("生成配置失败: 状态码=%d", recorder.status)
+	}
+
+	return recorder.body.Bytes(), nil
+}
+
+// mirrorRuleProviders 下载 http 类型的 rule-provider 并改写为本地 file 类型
+func (h *configBundleHandler) mirrorRuleProviders(ctx context.Context, client *http.Client, doc *yaml.Node, files map[string][]byte, manifest *bundleManifest) {
+	providers := mappingValue(doc, "rule-providers")
+	if providers == nil || providers.Kind != yaml.MappingNode {
+		return
+	}
+
+	used := make(map[string]struct{})
+	for i := 0; i+1 < len(providers.Content); i += 2 {
+		name := providers.Content[i].Value
+		provider := providers.Content[i+1]
+		if provider.Kind != yaml.MappingNode {
+			continue
+		}
+
+		providerType := mappingScalar(provider, "type")
+		source := mappingScalar(provider, "url")
+		if providerType != "http" || source == "" {
+			continue
+		}
+
+		entry := bundleManifestEntry{Name: name, Source: source}
+		data, err := downloadBundleFile(ctx, client, source)
+		if err != nil {
+			// 下载失败时保留原始 http 配置，设备联网后仍可使用
+			entry.Error = err.Error()
+			logger.Warn("[离线包] 规则集下载失败", "provider", name, "url", source, "error", err)
+			manifest.RuleProviders = append(manifest.RuleProviders, entry)
+			continue
+		}
+
+		filePath := bundleRuleSetDir + "/" + uniqueBundleName(bundleFileName(name, source, mappingScalar(provider, "format")), used)
+		files[filePath] = data
+
+		setMappingScalar(provider, "type", "file")
+		setMappingScalar(provider, "path", "./"+filePath)
+		deleteMappingKey(provider, "url")
+		deleteMappingKey(provider, "interval")
+		deleteMappingKey(provider, "proxy")
+
+		entry.Path = filePath
+		entry.Bytes = len(data)
+		manifest.RuleProviders = append(manifest.RuleProviders, entry)
+	}
+}
+
+// mirrorGeoDatabases 按 geox-url（未配置时使用默认地址）下载地理数据库，并关闭自动更新
+func (h *configBundleHandler) mirrorGeoDatabases(ctx context.Context, client *http.Client, doc *yaml.Node, files map[string][]byte, manifest *bundleManifest) {
+	geoxURL := mappingValue(doc, "geox-url")
+
+	downloaded := 0
+	for _, geo := range bundleGeoFiles {
+		source := geo.DefaultURL
+		if geoxURL != nil && geoxURL.Kind == yaml.MappingNode {
+			if custom := mappingScalar(geoxURL, geo.Key); custom != "" {
+				source = custom
+			}
+		}
+
+		entry := bundleManifestEntry{Name: geo.Key, Source: source}
+		data, err := downloadBundleFile(ctx, client, source)
+		if err != nil {
+			entry.Error = err.Error()
+			logger.Warn("[离线包] 地理数据库下载失败", "type", geo.Key, "url", source, "error", err)
+			manifest.GeoDatabases = append(manifest.GeoDatabases, entry)
+			continue
+		}
+
+		files[geo.Filename] = data
+		entry.Path = geo.Filename
+		entry.Bytes = len(data)
+		manifest.GeoDatabases = append(manifest.GeoDatabases, entry)
+		downloaded++
+	}
+
+	if downloaded > 0 {
+		setMappingScalarTagged(doc, "geo-auto-update", "false", "!!bool")
+	}
+}
+
+func downloadBundleFile(ctx context.Context, client *http.Client, source string) ([]byte, error) {
+	parsed, err := url.Parse(source)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, fmt.Errorf("不支持的地址: %s", source)
+	}
+
+	// 离线模式下配置已指向面板自身的离线资源，直接读取本地文件
+	if IsAirGappedMode() {
+		name, ok := strings.CutPrefix(parsed.Path, airGappedAssetsPrefix)
+		if !ok {
+			return nil, ErrAirGapped
+		}
+		return readAirGappedAsset(name)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "clash-meta/2.4.0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("状态码=%d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, bundleMaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > bundleMaxFileSize {
+		return nil, fmt.Errorf("文件超过 %d MB", bundleMaxFileSize>>20)
+	}
+	return data, nil
+}
+
+// bundleFileName 根据规则集格式或 URL 扩展名决定本地文件名
+func bundleFileName(name, source, format string) string {
+	base := strings.Trim(bundleUnsafeNameChars.ReplaceAllString(name, "_"), "_")
+	if base == "" {
+		base = "provider"
+	}
+
+	ext := ""
+	switch strings.ToLower(format) {
+	case "yaml":
+		ext = ".yaml"
+	case "text":
+		ext = ".list"
+	case "mrs":
+		ext = ".mrs"
+	}
+	if ext == "" {
+		if parsed, err := url.Parse(source); err == nil {
+			ext = strings.ToLower(path.Ext(parsed.Path))
+		}
+	}
+	if ext == "" {
+		ext = ".yaml"
+	}
+
+	return base + ext
+}
+
+func uniqueBundleName(name string, used map[string]struct{}) string {
+	candidate := name
+	ext := path.Ext(name)
+	for i := 2; ; i++ {
+		if _, ok := used[candidate]; !ok {
+			used[candidate] = struct{}{}
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func mappingScalar(node *yaml.Node, key string) string {
+	value := mappingValue(node, key)
+	if value == nil || value.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return strings.TrimSpace(value.Value)
+}
+
+func setMappingScalar(node *yaml.Node, key, value string) {
+	setMappingScalarTagged(node, key, value, "!!str")
+}
+
+func setMappingScalarTagged(node *yaml.Node, key, value, tag string) {
+	if existing := mappingValue(node, key); existing != nil {
+		existing.Kind = yaml.ScalarNode
+		existing.Style = 0
+		existing.Tag = tag
+		existing.Value = value
+		existing.Content = nil
+		return
+	}
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value},
+	)
+}
+
+func deleteMappingKey(node *yaml.Node, key string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// bufferedResponseWriter 捕获内部调用的响应
+type bufferedResponseWriter struct {
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func newBufferedResponseWriter() *bufferedResponseWriter {
+	return &bufferedResponseWriter{header: make(http.Header)}
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(data)
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
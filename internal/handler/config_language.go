@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+
+	"miaomiaowu/internal/logger"
+)
+
+// 生成配置的语言：用户偏好 config_language 为 en 时，下发的配置中代理组名称与提示节点按词典翻译为英文。
+// 词典键可以是完整名称（含图标），也可以是去掉开头图标后的文字，后者翻译时保留原图标
+const (
+	maxGroupNameTranslations      = 500
+	maxGroupNameTranslationLength = 128
+)
+
+// expiryWarningNodeFormat 套餐到期提示节点的名称格式，翻译后同样必须包含一个 %s
+const expiryWarningNodeFormat = "⚠️ 套餐将于 %s 到期"
+
+// defaultGroupNameTranslations 内置词典。完整名称来自生成器使用的 sublink 分类名称，
+// 其余为常见规则模板中的代理组
+var defaultGroupNameTranslations = map[string]string{
+	"♻️ 自动选择":  "Auto Select",
+	"🚀 节点选择":   "Node Select",
+	"🐟 漏网之鱼":   "Fall Back",
+	"🛑 广告拦截":   "Ad Block",
+	"💬 AI 服务":  "AI Services",
+	"📺 哔哩哔哩":   "Bilibili",
+	"📹 油管视频":   "Youtube",
+	"🔍 谷歌服务":   "Google",
+	"🏠 私有网络":   "Private",
+	"🔒 国内服务":   "Location:CN",
+	"📲 电报消息":   "Telegram",
+	"🐱 Github": "Github",
+	"Ⓜ️ 微软服务":  "Microsoft",
+	"🍏 苹果服务":   "Apple",
+	"🌐 社交媒体":   "Social Media",
+	"🎬 流媒体":    "Streaming",
+	"🎮 游戏平台":   "Gaming",
+	"📚 教育资源":   "Education",
+	"💰 金融服务":   "Financial",
+	"☁️ 云服务":   "Cloud Services",
+	"🌐 非中国":    "Non-China",
+
+	"自动选择":  "Auto Select",
+	"节点选择":  "Node Select",
+	"手动切换":  "Manual Select",
+	"故障转移":  "Fallback",
+	"负载均衡":  "Load Balance",
+	"漏网之鱼":  "Final",
+	"遵循规则":  "Follow Rules",
+	"全球直连":  "Direct",
+	"全球拦截":  "Block",
+	"广告拦截":  "Ad Block",
+	"应用净化":  "App Purify",
+	"测速工具":  "Speedtest",
+	"非标端口":  "Non-standard Ports",
+	"谷歌FCM": "Google FCM",
+	"谷歌服务":  "Google",
+	"苹果服务":  "Apple",
+	"微软服务":  "Microsoft",
+	"AI服务":  "AI Services",
+	"电报信息":  "Telegram",
+	"电报消息":  "Telegram",
+	"即时通讯":  "Messaging",
+	"社交媒体":  "Social Media",
+	"国外媒体":  "Global Media",
+	"国内媒体":  "Domestic Media",
+	"国外电商":  "Global Shopping",
+	"游戏平台":  "Gaming",
+	"其他地区":  "Other Regions",
+	"香港节点":  "Hong Kong",
+	"台湾节点":  "Taiwan",
+	"日本节点":  "Japan",
+	"韩国节点":  "Korea",
+	"新加坡节点": "Singapore",
+	"美国节点":  "United States",
+	"英国节点":  "United Kingdom",
+	"德国节点":  "Germany",
+	"法国节点":  "France",
+	"荷兰节点":  "Netherlands",
+	"土耳其节点": "Turkey",
+	"加拿大节点": "Canada",
+
+	quotaWarningNodeName:    "⚠️ Traffic almost used up",
+	expiryWarningNodeFormat: "⚠️ Plan expires on %s",
+}
+
+// groupNameDictionary 合并内置词典与管理员覆盖项，覆盖项翻译为空时删除对应的内置条目
+func groupNameDictionary(overrides map[string]string) map[string]string {
+	dict := make(map[string]string, len(defaultGroupNameTranslations)+len(overrides))
+	for source, translation := range defaultGroupNameTranslations {
+		dict[source] = translation
+	}
+	for source, translation := range overrides {
+		if translation == "" {
+			delete(dict, source)
+			continue
+		}
+		dict[source] = translation
+	}
+	return dict
+}
+
+// normalizeGroupNameTranslations 校验并规范化管理员提交的词典覆盖项
+func normalizeGroupNameTranslations(overrides map[string]string) (map[string]string, error) {
+	if len(overrides) > maxGroupNameTranslations {
+		return nil, fmt.Errorf("词典最多 %d 条", maxGroupNameTranslations)
+	}
+	normalized := make(map[string]string, len(overrides))
+	for source, translation := range overrides {
+		source = strings.TrimSpace(source)
+		translation = strings.TrimSpace(translation)
+		if source == "" {
+			return nil, fmt.Errorf("词典中的名称不能为空")
+		}
+		if len(source) > maxGroupNameTranslationLength || len(translation) > maxGroupNameTranslationLength {
+			return nil, fmt.Errorf("词典条目过长: %s", source)
+		}
+		if strings.ContainsAny(source+translation, ",\n\r") {
+			return nil, fmt.Errorf("词典条目不能包含逗号或换行: %s", source)
+		}
+		if source == expiryWarningNodeFormat && translation != "" && strings.Count(translation, "%s") != 1 {
+			return nil, fmt.Errorf("%s 的翻译必须包含一个 %%s 作为日期占位符", source)
+		}
+		normalized[source] = translation
+	}
+	return normalized, nil
+}
+
+// translateGroupName 按词典翻译名称：先匹配完整名称，再匹配去掉开头图标后的文字并保留图标
+func translateGroupName(dict map[string]string, name string) (string, bool) {
+	if translation, ok := dict[name]; ok {
+		return translation, true
+	}
+	idx := strings.IndexFunc(name, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	})
+	if idx <= 0 {
+		return "", false
+	}
+	prefix, text := name[:idx], strings.TrimSpace(name[idx:])
+	if translation, ok := dict[text]; ok {
+		return prefix + translation, true
+	}
+	return "", false
+}
+
+// translateExpiryWarningName 生成套餐到期提示节点名称，dict 为 nil 时使用中文
+func translateExpiryWarningName(dict map[string]string, date string) string {
+	format := expiryWarningNodeFormat
+	if translation, ok := dict[expiryWarningNodeFormat]; ok && strings.Count(translation, "%s") == 1 {
+		format = translation
+	}
+	return fmt.Sprintf(format, date)
+}
+
+// translateConfigGroupNames 翻译配置中的代理组名称，并同步更新其他代理组和规则中的引用。
+// 翻译后与已有代理组或节点重名的代理组保持原名
+func translateConfigGroupNames(data []byte, dict map[string]string) ([]byte, error) {
+	doc, err := parseProxyGroupDocument(data)
+	if err != nil {
+		// 没有 proxy-groups 的配置无需翻译
+		return data, nil
+	}
+
+	renamed := 0
+	for _, groupNode := range doc.groups.Content {
+		if groupNode.Kind != yaml.MappingNode {
+			continue
+		}
+		name := yamlMappingValue(groupNode, "name")
+		translation, ok := translateGroupName(dict, name)
+		if !ok || translation == name {
+			continue
+		}
+		if err := doc.rename(name, translation); err != nil {
+			logger.Debug("[配置语言] 代理组保持原名", "group", name, "translation", translation, "error", err)
+			continue
+		}
+		renamed++
+	}
+	if renamed == 0 {
+		return data, nil
+	}
+	return MarshalYAMLWithIndent(&doc.root)
+}
+
+// configLanguageDictionary 返回用户生成配置使用的翻译词典，语言为中文时返回 nil
+func (h *SubscriptionHandler) configLanguageDictionary(ctx context.Context, username string) map[string]string {
+	if h.repo == nil || username == "" {
+		return nil
+	}
+	prefs, err := h.repo.GetUserPreferences(ctx, username)
+	if err != nil {
+		logger.WarnContext(ctx, "[配置语言] 读取用户偏好失败", "user", username, "error", err)
+		return nil
+	}
+	if prefs.ConfigLanguage() != "en" {
+		return nil
+	}
+	cfg, err := h.repo.GetSystemConfig(ctx)
+	if err != nil {
+		logger.WarnContext(ctx, "[配置语言] 读取词典失败", "error", err)
+		return groupNameDictionary(nil)
+	}
+	return groupNameDictionary(cfg.GroupNameTranslations)
+}
@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	configSignatureHeader      = "X-Config-Signature"
+	configSignatureKeyIDHeader = "X-Config-Signature-Key-Id"
+	// configSignatureCommentPrefix 嵌入式签名行的前缀，签名覆盖该行之前的全部字节
+	configSignatureCommentPrefix = "# miaomiaowu-signature:"
+	contentSigningAlgorithm      = "ed25519"
+)
+
+// contentSigningKeyID 公钥指纹（SHA-256 前 8 字节），便于校验方确认使用的密钥
+func contentSigningKeyID(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+// signSubscription signs the generated config with the instance key when content signing is enabled.
+// Header mode leaves the body untouched and sends a detached signature; comment mode appends a
+// trailing "# miaomiaowu-signature: ..." line to YAML output and falls back to headers otherwise.
+func (h *SubscriptionHandler) signSubscription(ctx context.Context, w http.ResponseWriter, data []byte, contentType string) []byte {
+	if h.repo == nil {
+		return data
+	}
+	cfg, err := h.repo.GetSystemConfig(ctx)
+	if err != nil || cfg.ContentSigning == "" {
+		return data
+	}
+
+	key, err := h.repo.GetContentSigningKey(ctx)
+	if err != nil {
+		logger.Warn("[内容签名] 读取签名密钥失败，返回未签名内容", "error", err)
+		return data
+	}
+	keyID := contentSigningKeyID(key.PublicKey)
+
+	if cfg.ContentSigning == storage.ContentSigningComment && isYAMLContentType(contentType) {
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			data = append(data, '\n')
+		}
+		signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key.PrivateKey, data))
+		line := configSignatureCommentPrefix + " " + contentSigningAlgorithm + " keyid=" + keyID + " sig=" + signature + "\n"
+		return append(data, line...)
+	}
+
+	w.Header().Set(configSignatureHeader, base64.StdEncoding.EncodeToString(ed25519.Sign(key.PrivateKey, data)))
+	w.Header().Set(configSignatureKeyIDHeader, keyID)
+	return data
+}
+
+type contentSigningKeyResponse struct {
+	Mode         string    `json:"mode"`
+	Algorithm    string    `json:"algorithm"`
+	KeyID        string    `json:"key_id"`
+	PublicKey    string    `json:"public_key"`
+	PublicKeyPEM string    `json:"public_key_pem"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func buildContentSigningKeyResponse(ctx context.Context, repo *storage.TrafficRepository) (contentSigningKeyResponse, error) {
+	cfg, err := repo.GetSystemConfig(ctx)
+	if err != nil {
+		return contentSigningKeyResponse{}, err
+	}
+	key, err := repo.GetContentSigningKey(ctx)
+	if err != nil {
+		return contentSigningKeyResponse{}, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.PublicKey)
+	if err != nil {
+		return contentSigningKeyResponse{}, err
+	}
+
+	return contentSigningKeyResponse{
+		Mode:         cfg.ContentSigning,
+		Algorithm:    contentSigningAlgorithm,
+		KeyID:        contentSigningKeyID(key.PublicKey),
+		PublicKey:    base64.StdEncoding.EncodeToString(key.PublicKey),
+		PublicKeyPEM: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		CreatedAt:    key.CreatedAt,
+	}, nil
+}
+
+type contentSigningPublicKeyHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewContentSigningPublicKeyHandler publishes the instance public key so downstream automation can
+// verify signed configs without logging in.
+func NewContentSigningPublicKeyHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("content signing public key handler requires repository")
+	}
+
+	return &contentSigningPublicKeyHandler{repo: repo}
+}
+
+func (h *contentSigningPublicKeyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	resp, err := buildContentSigningKeyResponse(r.Context(), h.repo)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+type contentSigningSettingsRequest struct {
+	Mode string `json:"mode"`
+}
+
+type contentSigningHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewContentSigningHandler manages content signing: GET/PUT the signing mode and POST /rotate to
+// generate a new instance key.
+func NewContentSigningHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("content signing handler requires repository")
+	}
+
+	return &contentSigningHandler{repo: repo}
+}
+
+func (h *contentSigningHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/rotate") {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		h.handleRotate(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.respondStatus(w, r)
+	case http.MethodPut:
+		h.handleUpdate(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+	}
+}
+
+func (h *contentSigningHandler) respondStatus(w http.ResponseWriter, r *http.Request) {
+	resp, err := buildContentSigningKeyResponse(r.Context(), h.repo)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func (h *contentSigningHandler) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	var payload contentSigningSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	mode := strings.ToLower(strings.TrimSpace(payload.Mode))
+	switch mode {
+	case "", storage.ContentSigningHeader, storage.ContentSigningComment:
+	default:
+		writeBadRequest(w, "签名方式只能为 header、comment 或空（关闭）")
+		return
+	}
+
+	cfg, err := h.repo.GetSystemConfig(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	cfg.ContentSigning = mode
+	if err := h.repo.UpdateSystemConfig(r.Context(), cfg); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logger.Info("[内容签名] 签名方式已更新", "mode", mode)
+	h.respondStatus(w, r)
+}
+
+func (h *contentSigningHandler) handleRotate(w http.ResponseWriter, r *http.Request) {
+	key, err := h.repo.RotateContentSigningKey(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logger.Info("[内容签名] 签名密钥已轮换", "key_id", contentSigningKeyID(key.PublicKey))
+	h.respondStatus(w, r)
+}
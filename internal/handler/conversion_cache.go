@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/substore"
+)
+
+const (
+	// conversionCacheMaxEntries 超出后淘汰最久未使用的条目
+	conversionCacheMaxEntries = 256
+	// conversionCacheTTL 兜底过期时间，文件变更会立即失效对应条目
+	conversionCacheTTL = 30 * time.Minute
+)
+
+type conversionCacheEntry struct {
+	key       string
+	filename  string
+	data      []byte
+	warnings  []substore.ConversionWarning
+	createdAt time.Time
+}
+
+// conversionCache caches converted subscription output. Entries are keyed by the hash of the
+// YAML being converted plus the client type and the produce options, so any change to the rule
+// file or the nodes in it produces a new key; notifySubscribeFileChanged also drops the file's
+// entries right away to free the memory.
+type conversionCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // 前端为最近使用
+	files   map[string]map[string]struct{}
+}
+
+var subscriptionConversionCache = newConversionCache()
+
+func newConversionCache() *conversionCache {
+	return &conversionCache{
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		files:   make(map[string]map[string]struct{}),
+	}
+}
+
+// conversionCacheKey 由输入内容哈希、转换类型和影响输出的选项组成
+func conversionCacheKey(yamlData []byte, clientType string, compatibilityMode bool, providerURL string) string {
+	hash := sha256.New()
+	hash.Write(yamlData)
+	hash.Write([]byte{0})
+	hash.Write([]byte(clientType))
+	hash.Write([]byte{0})
+	if compatibilityMode {
+		hash.Write([]byte{1})
+	} else {
+		hash.Write([]byte{0})
+	}
+	hash.Write([]byte(providerURL))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (c *conversionCache) get(key string) ([]byte, []substore.ConversionWarning, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, nil, false
+	}
+	entry := elem.Value.(*conversionCacheEntry)
+	if time.Since(entry.createdAt) > conversionCacheTTL {
+		c.removeLocked(elem)
+		return nil, nil, false
+	}
+	c.order.MoveToFront(elem)
+	// 返回副本，避免调用方修改缓存内容
+	return bytes.Clone(entry.data), entry.warnings, true
+}
+
+func (c *conversionCache) set(key, filename string, data []byte, warnings []substore.ConversionWarning) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.removeLocked(elem)
+	}
+	entry := &conversionCacheEntry{
+		key:       key,
+		filename:  filename,
+		data:      bytes.Clone(data),
+		warnings:  warnings,
+		createdAt: time.Now(),
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	if c.files[filename] == nil {
+		c.files[filename] = make(map[string]struct{})
+	}
+	c.files[filename][key] = struct{}{}
+
+	for c.order.Len() > conversionCacheMaxEntries {
+		c.removeLocked(c.order.Back())
+	}
+}
+
+// invalidateFile 删除指定订阅文件的所有转换结果
+func (c *conversionCache) invalidateFile(filename string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for key := range c.files[filename] {
+		if elem, ok := c.entries[key]; ok {
+			c.removeLocked(elem)
+			removed++
+		}
+	}
+	return removed
+}
+
+// clear 删除全部转换结果
+func (c *conversionCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+	c.files = make(map[string]map[string]struct{})
+}
+
+func (c *conversionCache) removeLocked(elem *list.Element) {
+	entry := c.order.Remove(elem).(*conversionCacheEntry)
+	delete(c.entries, entry.key)
+	if keys := c.files[entry.filename]; keys != nil {
+		delete(keys, entry.key)
+		if len(keys) == 0 {
+			delete(c.files, entry.filename)
+		}
+	}
+}
+
+// InvalidateConversionCache drops every cached conversion, e.g. after settings that affect the
+// producers' output changed.
+func InvalidateConversionCache() {
+	subscriptionConversionCache.clear()
+}
+
+// convertSubscriptionCached wraps convertSubscription with the conversion cache. filename is the
+// subscription file the data was rendered from and is only used for invalidation.
+func (h *SubscriptionHandler) convertSubscriptionCached(ctx context.Context, filename string, yamlData []byte, clientType string) ([]byte, []substore.ConversionWarning, error) {
+	systemConfig, _ := h.repo.GetSystemConfig(ctx)
+	key := conversionCacheKey(yamlData, clientType, systemConfig.ClientCompatibilityMode, subscriptionURLFrom(ctx))
+
+	if data, warnings, ok := subscriptionConversionCache.get(key); ok {
+		logger.DebugContext(ctx, "[转换缓存] 命中", "filename", filename, "client_type", clientType)
+		return data, warnings, nil
+	}
+
+	data, warnings, err := h.convertSubscription(ctx, yamlData, clientType)
+	if err != nil {
+		return nil, nil, err
+	}
+	subscriptionConversionCache.set(key, filepath.Base(filename), data, warnings)
+	return data, warnings, nil
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+	"miaomiaowu/internal/substore"
+)
+
+const (
+	conversionMatrixOK      = "ok"
+	conversionMatrixDropped = "dropped"
+	conversionMatrixFailed  = "failed"
+)
+
+type conversionMatrixEntry struct {
+	Target      string                       `json:"target"`
+	Status      string                       `json:"status"`
+	Error       string                       `json:"error,omitempty"`
+	Bytes       int                          `json:"bytes"`
+	Nodes       int                          `json:"nodes"`
+	Dropped     int                          `json:"dropped"`
+	Warnings    []substore.ConversionWarning `json:"warnings"`
+	ContentType string                       `json:"content_type"`
+	Extension   string                       `json:"extension"`
+	DurationMs  int64                        `json:"duration_ms"`
+}
+
+type conversionMatrixHandler struct {
+	repo         *storage.TrafficRepository
+	subscription *SubscriptionHandler
+}
+
+// NewConversionMatrixHandler runs every registered conversion target over a subscribe file's
+// node set and reports which targets succeed, which drop nodes, and the size of each output.
+func NewConversionMatrixHandler(repo *storage.TrafficRepository, subscription *SubscriptionHandler) http.Handler {
+	if repo == nil || subscription == nil {
+		panic("conversion matrix handler requires repository and subscription handler")
+	}
+
+	return &conversionMatrixHandler{repo: repo, subscription: subscription}
+}
+
+func (h *conversionMatrixHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	username := auth.UsernameFromContext(r.Context())
+	if username == "" {
+		writeError(w, http.StatusUnauthorized, errors.New("用户未认证"))
+		return
+	}
+
+	filename := strings.TrimSpace(r.URL.Query().Get("filename"))
+	if filename == "" {
+		writeBadRequest(w, "缺少 filename 参数")
+		return
+	}
+	if _, err := h.repo.GetSubscribeFileByFilename(r.Context(), filename); err != nil {
+		if errors.Is(err, storage.ErrSubscribeFileNotFound) {
+			writeError(w, http.StatusNotFound, errors.New("订阅文件不存在"))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// 使用订阅接口生成的 Clash 配置作为输入，节点集合与用户实际拉取的一致
+	config, err := renderSubscriptionConfig(h.subscription, r, filename)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	total := countConfigProxies(config)
+
+	factory := substore.GetDefaultFactory()
+	targets := factory.GetSupportedTargets()
+	results := make([]conversionMatrixEntry, 0, len(targets))
+	summary := map[string]int{conversionMatrixOK: 0, conversionMatrixDropped: 0, conversionMatrixFailed: 0}
+
+	for _, target := range targets {
+		format := factory.GetOutputFormat(target)
+		entry := conversionMatrixEntry{
+			Target:      target,
+			Warnings:    []substore.ConversionWarning{},
+			ContentType: format.ContentType,
+			Extension:   format.Extension,
+		}
+
+		start := time.Now()
+		data, warnings, err := h.subscription.convertSubscription(r.Context(), config, target)
+		entry.DurationMs = time.Since(start).Milliseconds()
+
+		switch {
+		case err != nil:
+			entry.Status = conversionMatrixFailed
+			entry.Error = err.Error()
+		case len(warnings) > 0:
+			entry.Status = conversionMatrixDropped
+			entry.Warnings = warnings
+		default:
+			entry.Status = conversionMatrixOK
+		}
+		if err == nil {
+			entry.Bytes = len(data)
+			entry.Dropped = len(warnings)
+			entry.Nodes = max(total-entry.Dropped, 0)
+		}
+
+		summary[entry.Status]++
+		results = append(results, entry)
+	}
+
+	logger.Info("[转换矩阵] 测试完成",
+		"user", username,
+		"filename", filename,
+		"nodes", total,
+		"ok", summary[conversionMatrixOK],
+		"dropped", summary[conversionMatrixDropped],
+		"failed", summary[conversionMatrixFailed])
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"filename":    filename,
+		"total_nodes": total,
+		"summary":     summary,
+		"targets":     results,
+	})
+}
+
+// countConfigProxies 统计 Clash 配置中 proxies 的数量，解析失败时返回 0
+func countConfigProxies(config []byte) int {
+	var parsed struct {
+		Proxies []yaml.Node `yaml:"proxies"`
+	}
+	if err := yaml.Unmarshal(config, &parsed); err != nil {
+		return 0
+	}
+	return len(parsed.Proxies)
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/substore"
+)
+
+const (
+	conversionWarningsHeader       = "X-Conversion-Warnings"
+	conversionWarningDetailsHeader = "X-Conversion-Warning-Details"
+	// maxConversionWarningHeaderBytes 警告详情头的最大长度，超出部分只保留数量
+	maxConversionWarningHeaderBytes = 4096
+)
+
+type convertRequest struct {
+	Content   string            `json:"content"`
+	Target    string            `json:"target"`
+	Transform *convertTransform `json:"transform"` // 可选，转换前筛选、重命名和排序节点
+}
+
+type convertResponse struct {
+	Content     string                       `json:"content"`
+	ContentType string                       `json:"content_type"`
+	Extension   string                       `json:"extension"`
+	Warnings    []substore.ConversionWarning `json:"warnings"`
+	Filtered    int                          `json:"filtered"` // 被 transform 筛掉的节点数
+}
+
+type convertHandler struct {
+	subscription *SubscriptionHandler
+}
+
+// NewConvertHandler converts a Clash YAML config (or proxies list) to another client format.
+// Proxies the target can't express are skipped and listed in warnings.
+func NewConvertHandler(subscription *SubscriptionHandler) http.Handler {
+	if subscription == nil {
+		panic("convert handler requires subscription handler")
+	}
+
+	return &convertHandler{subscription: subscription}
+}
+
+func (h *convertHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var payload convertRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10<<20)).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	target := strings.TrimSpace(payload.Target)
+	if target == "" {
+		writeBadRequest(w, "缺少转换目标 target")
+		return
+	}
+	if strings.TrimSpace(payload.Content) == "" {
+		writeBadRequest(w, "缺少转换内容 content")
+		return
+	}
+
+	content, filtered, ok := transformConvertContent(w, payload.Content, payload.Transform)
+	if !ok {
+		return
+	}
+
+	data, warnings, err := h.subscription.convertSubscription(r.Context(), content, target)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	if warnings == nil {
+		warnings = []substore.ConversionWarning{}
+	}
+	if len(warnings) > 0 {
+		logger.Info("[转换] 部分节点无法转换，已跳过", "target", target, "count", len(warnings))
+	}
+
+	format := substore.GetDefaultFactory().GetOutputFormat(target)
+	respondJSON(w, http.StatusOK, convertResponse{
+		Content:     string(data),
+		ContentType: format.ContentType,
+		Extension:   format.Extension,
+		Warnings:    warnings,
+		Filtered:    filtered,
+	})
+}
+
+// transformConvertContent 按请求中的 transform 预处理待转换内容，返回被筛掉的节点数；出错时已写入响应
+func transformConvertContent(w http.ResponseWriter, content string, transform *convertTransform) ([]byte, int, bool) {
+	if transform == nil {
+		return []byte(content), 0, true
+	}
+	compiled, err := transform.compile()
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return nil, 0, false
+	}
+	data, filtered, err := applyConvertTransform([]byte(content), compiled)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return nil, 0, false
+	}
+	return data, filtered, true
+}
+
+// setConversionWarningHeaders 通过响应头返回被跳过的节点：X-Conversion-Warnings 为数量，
+// X-Conversion-Warning-Details 为 URL 编码的 JSON 数组（过长时截断条目）
+func setConversionWarningHeaders(w http.ResponseWriter, warnings []substore.ConversionWarning) {
+	if len(warnings) == 0 {
+		return
+	}
+	w.Header().Set(conversionWarningsHeader, strconv.Itoa(len(warnings)))
+
+	for n := len(warnings); n > 0; n /= 2 {
+		encoded, err := json.Marshal(warnings[:n])
+		if err != nil {
+			return
+		}
+		escaped := url.PathEscape(string(encoded))
+		if len(escaped) <= maxConversionWarningHeaderBytes {
+			w.Header().Set(conversionWarningDetailsHeader, escaped)
+			return
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/substore"
+)
+
+// maxConvertBatchTargets 一次批量转换允许的最多目标数
+const maxConvertBatchTargets = 20
+
+type convertBatchRequest struct {
+	Content   string            `json:"content"`
+	Targets   []string          `json:"targets"`
+	Transform *convertTransform `json:"transform"`
+	Format    string            `json:"format"` // json（默认）或 zip
+	Name      string            `json:"name"`   // zip 中的文件名前缀，默认 config
+}
+
+type convertBatchResult struct {
+	Target      string                       `json:"target"`
+	Content     string                       `json:"content"`
+	ContentType string                       `json:"content_type"`
+	Extension   string                       `json:"extension"`
+	Warnings    []substore.ConversionWarning `json:"warnings"`
+	Error       string                       `json:"error,omitempty"`
+}
+
+type convertBatchHandler struct {
+	subscription *SubscriptionHandler
+}
+
+// NewConvertBatchHandler converts one Clash YAML config to several targets in a single request and
+// returns every output as JSON, or as a zip archive when format is "zip". A target that fails to
+// convert is reported with its error without failing the others.
+func NewConvertBatchHandler(subscription *SubscriptionHandler) http.Handler {
+	if subscription == nil {
+		panic("convert batch handler requires subscription handler")
+	}
+
+	return &convertBatchHandler{subscription: subscription}
+}
+
+func (h *convertBatchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var payload convertBatchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10<<20)).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	if strings.TrimSpace(payload.Content) == "" {
+		writeBadRequest(w, "缺少转换内容 content")
+		return
+	}
+	targets := make([]string, 0, len(payload.Targets))
+	seen := make(map[string]bool, len(payload.Targets))
+	for _, target := range payload.Targets {
+		target = strings.TrimSpace(target)
+		if target == "" || seen[target] {
+			continue
+		}
+		seen[target] = true
+		targets = append(targets, target)
+	}
+	if len(targets) == 0 {
+		writeBadRequest(w, "缺少转换目标 targets")
+		return
+	}
+	if len(targets) > maxConvertBatchTargets {
+		writeBadRequest(w, fmt.Sprintf("一次最多转换 %d 个目标", maxConvertBatchTargets))
+		return
+	}
+	format := strings.ToLower(strings.TrimSpace(payload.Format))
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "zip" {
+		writeBadRequest(w, "format 只能是 json 或 zip")
+		return
+	}
+
+	content, filtered, ok := transformConvertContent(w, payload.Content, payload.Transform)
+	if !ok {
+		return
+	}
+
+	results := make([]convertBatchResult, 0, len(targets))
+	failed := 0
+	for _, target := range targets {
+		outputFormat := substore.GetDefaultFactory().GetOutputFormat(target)
+		result := convertBatchResult{
+			Target:      target,
+			ContentType: outputFormat.ContentType,
+			Extension:   outputFormat.Extension,
+			Warnings:    []substore.ConversionWarning{},
+		}
+		data, warnings, err := h.subscription.convertSubscription(r.Context(), content, target)
+		if err != nil {
+			result.Error = err.Error()
+			failed++
+		} else {
+			result.Content = string(data)
+			if warnings != nil {
+				result.Warnings = warnings
+			}
+		}
+		results = append(results, result)
+	}
+	logger.Info("[转换] 批量转换完成", "targets", len(targets), "failed", failed, "format", format)
+
+	if format == "json" {
+		respondJSON(w, http.StatusOK, map[string]any{
+			"results":  results,
+			"filtered": filtered,
+		})
+		return
+	}
+
+	if failed == len(results) {
+		writeBadRequest(w, results[0].Target+": "+results[0].Error)
+		return
+	}
+	name := convertBatchArchiveName(payload.Name)
+	archive, err := buildConvertBatchArchive(name, results)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename*=UTF-8''"+url.PathEscape(name+".zip"))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(archive)
+}
+
+// buildConvertBatchArchive 将每个目标的输出写入 zip，文件名为 <name>-<target><扩展名>；
+// 转换失败的目标和被跳过的节点记录在 errors.txt 中
+func buildConvertBatchArchive(name string, results []convertBatchResult) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	var report strings.Builder
+	for _, result := range results {
+		if result.Error != "" {
+			fmt.Fprintf(&report, "%s: %s\n", result.Target, result.Error)
+			continue
+		}
+		for _, warning := range result.Warnings {
+			fmt.Fprintf(&report, "%s: 跳过节点 %s（%s）\n", result.Target, warning.Name, warning.Reason)
+		}
+
+		extension := result.Extension
+		if extension == "" {
+			extension = ".txt"
+		}
+		fw, err := zw.Create(name + "-" + result.Target + extension)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fw.Write([]byte(result.Content)); err != nil {
+			return nil, err
+		}
+	}
+
+	if report.Len() > 0 {
+		fw, err := zw.Create("errors.txt")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fw.Write([]byte(report.String())); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// convertBatchArchiveName 只保留文件名中安全的字符，默认 config
+func convertBatchArchiveName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		case r > 127:
+			return r
+		default:
+			return -1
+		}
+	}, strings.TrimSpace(name))
+	name = strings.Trim(name, ".")
+	if name == "" {
+		return "config"
+	}
+	return name
+}
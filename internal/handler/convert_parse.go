@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/substore"
+)
+
+// 反向转换支持的输入格式
+const (
+	parseFormatAuto    = "auto"
+	parseFormatClash   = "clash"
+	parseFormatSingbox = "sing-box"
+	parseFormatURI     = "uri"
+	parseFormatSurge   = "surge"
+	parseFormatLoon    = "loon"
+	parseFormatQX      = "qx"
+	parseFormatWG      = "wireguard"
+)
+
+// maxParseWarningNameLength 警告中引用原始行时保留的最大长度
+const maxParseWarningNameLength = 80
+
+type convertParseRequest struct {
+	Content string `json:"content"`
+	Format  string `json:"format"` // auto（默认）、clash、sing-box、uri、surge、loon、qx、wireguard
+}
+
+type convertParseResponse struct {
+	Format   string                       `json:"format"`
+	Count    int                          `json:"count"`
+	Proxies  []map[string]any             `json:"proxies"`
+	Warnings []substore.ConversionWarning `json:"warnings"`
+}
+
+// NewConvertParseHandler parses a Surge/Loon/Quantumult X/sing-box/Clash/WireGuard config or a URI list and
+// returns the proxies as Clash proxy maps, ready to be imported as nodes. Lines that can't be parsed
+// are skipped and listed in warnings.
+func NewConvertParseHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+
+		var payload convertParseRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10<<20)).Decode(&payload); err != nil {
+			writeBadRequest(w, "请求数据格式错误")
+			return
+		}
+		if strings.TrimSpace(payload.Content) == "" {
+			writeBadRequest(w, "缺少解析内容 content")
+			return
+		}
+
+		format, proxies, warnings, err := parseClientConfig([]byte(payload.Content), payload.Format)
+		if err != nil {
+			writeBadRequest(w, err.Error())
+			return
+		}
+		if len(warnings) > 0 {
+			logger.Info("[转换] 部分节点无法解析，已跳过", "format", format, "count", len(warnings))
+		}
+
+		respondJSON(w, http.StatusOK, convertParseResponse{
+			Format:   format,
+			Count:    len(proxies),
+			Proxies:  proxies,
+			Warnings: warnings,
+		})
+	})
+}
+
+// parseClientConfig 按指定格式（或自动识别）把客户端配置解析为 Clash 节点，返回实际使用的格式
+func parseClientConfig(content []byte, format string) (string, []map[string]any, []substore.ConversionWarning, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" || format == parseFormatAuto {
+		format = detectClientConfigFormat(content)
+	}
+
+	var proxies []map[string]any
+	warnings := []substore.ConversionWarning{}
+	switch format {
+	case parseFormatClash:
+		var config struct {
+			Proxies []map[string]any `yaml:"proxies"`
+		}
+		if err := yaml.Unmarshal(content, &config); err != nil {
+			return format, nil, nil, fmt.Errorf("解析 Clash 配置失败: %w", err)
+		}
+		for i, proxy := range config.Proxies {
+			if getString(proxy, "name", "") == "" || getString(proxy, "type", "") == "" {
+				warnings = append(warnings, substore.ConversionWarning{Name: fmt.Sprintf("proxies[%d]", i), Reason: "missing name or type"})
+				continue
+			}
+			proxies = append(proxies, proxy)
+		}
+	case parseFormatSingbox, "singbox":
+		format = parseFormatSingbox
+		parsed, err := ParseSingboxSubscription(content)
+		if err != nil {
+			return format, nil, nil, fmt.Errorf("解析 sing-box 配置失败: %w", err)
+		}
+		proxies = parsed
+	case parseFormatWG, "wg":
+		format = parseFormatWG
+		proxy, err := ParseWireGuardConfig(string(content), "")
+		if err != nil {
+			return format, nil, nil, fmt.Errorf("解析 WireGuard 配置失败: %w", err)
+		}
+		proxies = append(proxies, proxy)
+	case parseFormatURI:
+		text := string(content)
+		if decoded, err := base64DecodeURLSafe(strings.TrimSpace(text)); err == nil && strings.Contains(decoded, "://") {
+			text = decoded
+		}
+		for _, line := range strings.Split(text, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || !strings.Contains(line, "://") {
+				continue
+			}
+			proxy, err := ParseProxyURL(line)
+			if err != nil {
+				warnings = append(warnings, substore.ConversionWarning{Name: truncateParseWarningName(line), Reason: err.Error()})
+				continue
+			}
+			proxies = append(proxies, proxy)
+		}
+	case parseFormatSurge, parseFormatLoon, parseFormatQX, "quantumultx", "quanx":
+		if format != parseFormatSurge && format != parseFormatLoon {
+			format = parseFormatQX
+		}
+		wireGuardSections := surgeWireGuardSections(string(content))
+		for _, line := range extractClientProxyLines(string(content)) {
+			var proxy map[string]any
+			var err error
+			if isQuantumultXLine(line.Text) {
+				proxy, err = parseQuantumultXLine(line.Text)
+			} else if wgProxy, ok, wgErr := parseSurgeWireGuardLine(line.Text, wireGuardSections); ok {
+				proxy, err = wgProxy, wgErr
+			} else {
+				proxy, err = parseSurgeProxyLine(line.Text)
+			}
+			if errors.Is(err, errClientProxyIgnored) {
+				continue
+			}
+			if err != nil {
+				warnings = append(warnings, substore.ConversionWarning{
+					Name:   fmt.Sprintf("line %d: %s", line.Line, truncateParseWarningName(line.Text)),
+					Reason: err.Error(),
+				})
+				continue
+			}
+			proxies = append(proxies, proxy)
+		}
+	default:
+		return format, nil, nil, fmt.Errorf("不支持的格式: %s", format)
+	}
+
+	if len(proxies) == 0 {
+		return format, nil, warnings, errors.New("未解析到任何节点")
+	}
+	return format, proxies, warnings, nil
+}
+
+// detectClientConfigFormat 根据内容特征识别配置格式
+func detectClientConfigFormat(content []byte) string {
+	if isSingboxJSON(content) {
+		return parseFormatSingbox
+	}
+	if isWireGuardConfig(content) {
+		return parseFormatWG
+	}
+
+	trimmed := strings.TrimSpace(string(content))
+	if strings.Contains(trimmed, "proxies:") {
+		var probe struct {
+			Proxies []any `yaml:"proxies"`
+		}
+		if err := yaml.Unmarshal(content, &probe); err == nil && len(probe.Proxies) > 0 {
+			return parseFormatClash
+		}
+	}
+
+	if isURIListFormat(trimmed) {
+		return parseFormatURI
+	}
+	if decoded, err := base64DecodeURLSafe(trimmed); err == nil && strings.Contains(decoded, "://") {
+		return parseFormatURI
+	}
+
+	for _, line := range extractClientProxyLines(trimmed) {
+		if isQuantumultXLine(line.Text) {
+			return parseFormatQX
+		}
+		if isLoonProxyLine(line.Text) {
+			return parseFormatLoon
+		}
+	}
+	return parseFormatSurge
+}
+
+func truncateParseWarningName(line string) string {
+	if name, _, ok := strings.Cut(line, "="); ok && !strings.Contains(line, "://") {
+		if _, isQX := qxProxyTypes[strings.ToLower(strings.TrimSpace(name))]; !isQX {
+			return strings.TrimSpace(name)
+		}
+	}
+	runes := []rune(line)
+	if len(runes) > maxParseWarningNameLength {
+		return string(runes[:maxParseWarningNameLength]) + "..."
+	}
+	return line
+}
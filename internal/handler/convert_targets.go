@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+
+	"miaomiaowu/internal/substore"
+)
+
+type convertTarget struct {
+	Target      string `json:"target"`
+	ContentType string `json:"content_type"`
+	Extension   string `json:"extension"`
+	Plugin      bool   `json:"plugin"` // 通过插件注册（含启动时从定义文件加载）的转换类型
+	Description string `json:"description,omitempty"`
+}
+
+// NewConvertTargetsHandler lists every conversion target accepted by ?t= and /api/convert,
+// including producers registered as plugins.
+func NewConvertTargetsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+
+		factory := substore.GetDefaultFactory()
+		targets := factory.GetSupportedTargets()
+		items := make([]convertTarget, 0, len(targets))
+		for _, target := range targets {
+			format := factory.GetOutputFormat(target)
+			items = append(items, convertTarget{
+				Target:      target,
+				ContentType: format.ContentType,
+				Extension:   format.Extension,
+				Plugin:      factory.IsPlugin(target),
+				Description: factory.GetDescription(target),
+			})
+		}
+
+		respondJSON(w, http.StatusOK, map[string]any{
+			"targets": items,
+		})
+	})
+}
@@ -0,0 +1,282 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"miaomiaowu/internal/storage"
+
+	"gopkg.in/yaml.v3"
+)
+
+// convertTransform 转换前对节点列表的筛选和改写，按 筛选 -> 重命名 -> 地区映射 -> 排序 的顺序执行
+type convertTransform struct {
+	Include      string            `json:"include"`       // 名称匹配该正则的节点才保留
+	Exclude      string            `json:"exclude"`       // 名称匹配该正则的节点被移除
+	Types        []string          `json:"types"`         // 只保留这些协议类型
+	Regions      []string          `json:"regions"`       // 只保留这些地区（如 HK、JP）
+	Rename       []convertRename   `json:"rename"`        // 依次执行的正则替换
+	RegionNames  map[string]string `json:"region_names"`  // 地区代码 -> 显示名称，如 {"HK": "🇭🇰 香港"}
+	RegionFormat string            `json:"region_format"` // 地区映射后的名称格式，默认 "{region} {name}"
+	Sort         string            `json:"sort"`          // name、region、type、server，前缀 - 表示倒序
+}
+
+type convertRename struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"` // 支持 $1 等分组引用
+}
+
+const defaultConvertRegionFormat = "{region} {name}"
+
+var convertSortKeys = map[string]bool{"name": true, "region": true, "type": true, "server": true}
+
+// compiledConvertTransform 校验后的转换规则
+type compiledConvertTransform struct {
+	include      *regexp.Regexp
+	exclude      *regexp.Regexp
+	types        map[string]bool
+	regions      map[string]bool
+	rename       []compiledConvertRename
+	regionNames  map[string]string
+	regionFormat string
+	sortKey      string
+	sortDesc     bool
+}
+
+type compiledConvertRename struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// transformProxy 转换过程中的单个节点
+type transformProxy struct {
+	node         *yaml.Node
+	originalName string
+	name         string
+	region       string
+}
+
+// compile 校验正则和排序字段，错误信息可以直接返回给用户
+func (t *convertTransform) compile() (*compiledConvertTransform, error) {
+	compiled := &compiledConvertTransform{
+		regionNames:  make(map[string]string, len(t.RegionNames)),
+		regionFormat: strings.TrimSpace(t.RegionFormat),
+	}
+
+	var err error
+	if pattern := strings.TrimSpace(t.Include); pattern != "" {
+		if compiled.include, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("include 正则无效: %w", err)
+		}
+	}
+	if pattern := strings.TrimSpace(t.Exclude); pattern != "" {
+		if compiled.exclude, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("exclude 正则无效: %w", err)
+		}
+	}
+	if len(t.Types) > 0 {
+		compiled.types = make(map[string]bool, len(t.Types))
+		for _, proxyType := range t.Types {
+			if proxyType = strings.ToLower(strings.TrimSpace(proxyType)); proxyType != "" {
+				compiled.types[proxyType] = true
+			}
+		}
+	}
+	if len(t.Regions) > 0 {
+		compiled.regions = make(map[string]bool, len(t.Regions))
+		for _, region := range t.Regions {
+			if region = strings.ToUpper(strings.TrimSpace(region)); region != "" {
+				compiled.regions[region] = true
+			}
+		}
+	}
+	for i, rule := range t.Rename {
+		if strings.TrimSpace(rule.Pattern) == "" {
+			return nil, fmt.Errorf("第 %d 条重命名规则缺少 pattern", i+1)
+		}
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 条重命名规则正则无效: %w", i+1, err)
+		}
+		compiled.rename = append(compiled.rename, compiledConvertRename{pattern: pattern, replacement: rule.Replacement})
+	}
+	for region, label := range t.RegionNames {
+		if region = strings.ToUpper(strings.TrimSpace(region)); region != "" {
+			compiled.regionNames[region] = label
+		}
+	}
+	if compiled.regionFormat == "" {
+		compiled.regionFormat = defaultConvertRegionFormat
+	} else if !strings.Contains(compiled.regionFormat, "{name}") {
+		return nil, errors.New("region_format 必须包含 {name}")
+	}
+
+	sortKey := strings.TrimSpace(t.Sort)
+	if strings.HasPrefix(sortKey, "-") {
+		compiled.sortDesc = true
+		sortKey = sortKey[1:]
+	}
+	if sortKey != "" && !convertSortKeys[sortKey] {
+		return nil, fmt.Errorf("不支持的排序字段 %q，可选 name、region、type、server", t.Sort)
+	}
+	compiled.sortKey = sortKey
+
+	return compiled, nil
+}
+
+// applyConvertTransform 对 YAML 中的 proxies 执行筛选、重命名和排序，并同步更新 proxy-groups 中的节点引用。
+// 返回改写后的 YAML 和被移除的节点数
+func applyConvertTransform(content []byte, transform *compiledConvertTransform) ([]byte, int, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return nil, 0, errors.New("no 'proxies' field found in YAML")
+	}
+	doc := root.Content[0]
+	proxiesNode := mappingValue(doc, "proxies")
+	if proxiesNode == nil {
+		return nil, 0, errors.New("no 'proxies' field found in YAML")
+	}
+	if proxiesNode.Kind != yaml.SequenceNode {
+		return nil, 0, errors.New("'proxies' field is not an array")
+	}
+
+	kept := make([]*transformProxy, 0, len(proxiesNode.Content))
+	removed := make(map[string]bool)
+	removedCount := 0
+	for _, node := range proxiesNode.Content {
+		name := mappingScalar(node, "name")
+		proxy := &transformProxy{node: node, originalName: name, name: name, region: storage.DetectNodeRegion(name)}
+		if !transform.matches(proxy) {
+			removed[name] = true
+			removedCount++
+			continue
+		}
+		kept = append(kept, proxy)
+	}
+	// 同名节点只要有一个保留，代理组中的引用就不能删除
+	for _, proxy := range kept {
+		delete(removed, proxy.originalName)
+	}
+
+	renamed := make(map[string]string)
+	used := make(map[string]bool, len(kept))
+	for _, proxy := range kept {
+		name := transform.rewriteName(proxy)
+		// 改名后重名时追加序号，避免客户端因重复名称拒绝加载
+		unique := name
+		for i := 2; used[unique]; i++ {
+			unique = fmt.Sprintf("%s %d", name, i)
+		}
+		used[unique] = true
+		if unique != proxy.originalName {
+			proxy.name = unique
+			renamed[proxy.originalName] = unique
+			setMappingScalar(proxy.node, "name", unique)
+		}
+	}
+
+	transform.sort(kept)
+
+	proxiesNode.Content = proxiesNode.Content[:0]
+	for _, proxy := range kept {
+		proxiesNode.Content = append(proxiesNode.Content, proxy.node)
+	}
+
+	if groupsNode := mappingValue(doc, "proxy-groups"); groupsNode != nil && (len(removed) > 0 || len(renamed) > 0) {
+		rewriteProxyGroupReferences(groupsNode, removed, renamed)
+		fillEmptyProxyGroups(groupsNode)
+	}
+
+	data, err := MarshalYAMLWithIndent(&root)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, removedCount, nil
+}
+
+func (t *compiledConvertTransform) matches(proxy *transformProxy) bool {
+	if t.include != nil && !t.include.MatchString(proxy.name) {
+		return false
+	}
+	if t.exclude != nil && t.exclude.MatchString(proxy.name) {
+		return false
+	}
+	if t.types != nil && !t.types[strings.ToLower(mappingScalar(proxy.node, "type"))] {
+		return false
+	}
+	if t.regions != nil && !t.regions[proxy.region] {
+		return false
+	}
+	return true
+}
+
+func (t *compiledConvertTransform) rewriteName(proxy *transformProxy) string {
+	name := proxy.name
+	for _, rule := range t.rename {
+		name = rule.pattern.ReplaceAllString(name, rule.replacement)
+	}
+	name = strings.TrimSpace(name)
+
+	if label := t.regionNames[proxy.region]; label != "" && !strings.HasPrefix(name, label) {
+		name = strings.NewReplacer("{region}", label, "{name}", name).Replace(t.regionFormat)
+		name = strings.TrimSpace(name)
+	}
+	if name == "" {
+		return proxy.name
+	}
+	return name
+}
+
+func (t *compiledConvertTransform) sort(proxies []*transformProxy) {
+	if t.sortKey == "" {
+		return
+	}
+	value := func(proxy *transformProxy) string {
+		switch t.sortKey {
+		case "region":
+			return proxy.region
+		case "type", "server":
+			return strings.ToLower(mappingScalar(proxy.node, t.sortKey))
+		default:
+			return proxy.name
+		}
+	}
+	sort.SliceStable(proxies, func(i, j int) bool {
+		if t.sortDesc {
+			return value(proxies[j]) < value(proxies[i])
+		}
+		return value(proxies[i]) < value(proxies[j])
+	})
+}
+
+// rewriteProxyGroupReferences 从代理组中移除被筛掉的节点，并把改名的节点替换为新名称
+func rewriteProxyGroupReferences(groupsNode *yaml.Node, removed map[string]bool, renamed map[string]string) {
+	if groupsNode.Kind != yaml.SequenceNode {
+		return
+	}
+	for _, group := range groupsNode.Content {
+		members := mappingValue(group, "proxies")
+		if members == nil || members.Kind != yaml.SequenceNode {
+			continue
+		}
+		kept := members.Content[:0]
+		for _, member := range members.Content {
+			if removed[member.Value] {
+				continue
+			}
+			if name, ok := renamed[member.Value]; ok {
+				member.Value = name
+				member.Style = 0
+				member.Tag = "!!str"
+			}
+			kept = append(kept, member)
+		}
+		members.Content = kept
+	}
+}
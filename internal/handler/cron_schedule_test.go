@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"testing"
+	"time"
+)
+
+func cronBits(values ...int) uint64 {
+	var bits uint64
+	for _, v := range values {
+		bits |= 1 << uint(v)
+	}
+	return bits
+}
+
+func TestParseCronField(t *testing.T) {
+	minute, dom, dow := cronFields[0], cronFields[2], cronFields[4]
+
+	tests := []struct {
+		value    string
+		field    cronField
+		expected uint64
+	}{
+		{"5", minute, cronBits(5)},
+		{"*/15", minute, cronBits(0, 15, 30, 45)},
+		{"5/20", minute, cronBits(5, 25, 45)},
+		{"1-5", dom, cronBits(1, 2, 3, 4, 5)},
+		{"10-20/5", minute, cronBits(10, 15, 20)},
+		{"1,15,31", dom, cronBits(1, 15, 31)},
+		{"1-3,10-30/10", dom, cronBits(1, 2, 3, 10, 20, 30)},
+		{"*/10", dom, cronBits(1, 11, 21, 31)},
+		{"0,7", dow, cronBits(0, 7)},
+	}
+
+	for _, tt := range tests {
+		got, err := parseCronField(tt.value, tt.field)
+		if err != nil {
+			t.Errorf("parseCronField(%q, %s) error: %v", tt.value, tt.field.name, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("parseCronField(%q, %s) = %b, expected %b", tt.value, tt.field.name, got, tt.expected)
+		}
+	}
+}
+
+func TestParseCronScheduleRejectsInvalidExpressions(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1- * * * *",
+		"1,,2 * * * *",
+	} {
+		if _, err := parseCronSchedule(expr); err == nil {
+			t.Errorf("parseCronSchedule(%q) succeeded, expected an error", expr)
+		}
+	}
+}
+
+func TestParseCronScheduleDayRestrictions(t *testing.T) {
+	tests := []struct {
+		expr          string
+		domRestricted bool
+		dowRestricted bool
+	}{
+		{"0 0 * * *", false, false},
+		{"0 0 */2 * *", false, false},
+		{"0 0 * * */2", false, false},
+		{"0 0 1 * *", true, false},
+		{"0 0 * * 1-5", false, true},
+		{"0 0 1,15 * 1", true, true},
+		{"0 0 */10 * 1", false, true},
+	}
+
+	for _, tt := range tests {
+		schedule, err := parseCronSchedule(tt.expr)
+		if err != nil {
+			t.Fatalf("parseCronSchedule(%q) error: %v", tt.expr, err)
+		}
+		if schedule.domRestricted != tt.domRestricted || schedule.dowRestricted != tt.dowRestricted {
+			t.Errorf("parseCronSchedule(%q) restricted dom=%t dow=%t, expected dom=%t dow=%t",
+				tt.expr, schedule.domRestricted, schedule.dowRestricted, tt.domRestricted, tt.dowRestricted)
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	// 2026-10-16 是周五
+	after := time.Date(2026, 10, 16, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected time.Time
+	}{
+		{"every 15 minutes", "*/15 * * * *", time.Date(2026, 10, 16, 10, 45, 0, 0, time.UTC)},
+		{"daily alias", "@daily", time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)},
+		{"weekdays", "0 9 * * 1-5", time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)},
+		{"sunday as 7", "0 0 * * 7", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"monthly alias", "@monthly", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"month list", "0 0 1 1,7 *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// 日和周都被限制时任一匹配即可：周一 10-19 早于 21 日
+		{"dom or dow", "0 12 1,21 * 1", time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)},
+		// */10 不算限制，必须同时满足日（1、11、21、31）和周一
+		{"stepped dom and dow", "0 12 */10 * 1", time.Date(2026, 12, 21, 12, 0, 0, 0, time.UTC)},
+		// */7 只包含周日，同样不算限制：下一个恰好是周日的 21 日
+		{"dom and stepped dow", "0 12 21 * */7", time.Date(2027, 2, 21, 12, 0, 0, 0, time.UTC)},
+		{"never", "0 0 31 2 *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := parseCronSchedule(tt.expr)
+			if err != nil {
+				t.Fatalf("parseCronSchedule(%q) error: %v", tt.expr, err)
+			}
+			if got := schedule.Next(after); !got.Equal(tt.expected) {
+				t.Errorf("Next(%q) = %v, expected %v", tt.expr, got, tt.expected)
+			}
+		})
+	}
+}
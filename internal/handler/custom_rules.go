@@ -388,6 +388,7 @@ func syncCustomRulesToFile(ctx context.Context, repo *storage.TrafficRepository,
 	if err := os.WriteFile(filePath, modified, 0644); err != nil {
 		return nil, fmt.Errorf("write file: %w", err)
 	}
+	notifySubscribeFileChanged(filePath)
 
 	return addedGroups, nil
 }
@@ -514,6 +515,7 @@ func checkAndAddMissingProxyGroupsForRule(ctx context.Context, repo *storage.Tra
 				logger.Info("Warning: failed to write file", "value", filePath, "error", err)
 				continue
 			}
+			notifySubscribeFileChanged(filePath)
 		}
 	}
 
@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"miaomiaowu/internal/logger"
+)
+
+// danglingRefIssue 引用了文件中不存在的节点或代理组
+type danglingRefIssue struct {
+	Kind   string `json:"kind"` // "group" 代理组成员，"rule" 规则目标
+	Group  string `json:"group,omitempty"`
+	Rule   string `json:"rule,omitempty"`
+	Index  int    `json:"index"` // 成员或规则在列表中的位置
+	Target string `json:"target"`
+}
+
+type danglingRefFile struct {
+	Filename string             `json:"filename"`
+	Name     string             `json:"name"`
+	Issues   []danglingRefIssue `json:"issues"`
+	Status   string             `json:"status,omitempty"` // 修复结果: "fixed", "invalid", "error"
+	Fixed    int                `json:"fixed,omitempty"`
+	Version  int64              `json:"version,omitempty"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// danglingRefs 检查代理组成员和规则目标是否指向文件中存在的节点、代理组或内置策略
+func (d *proxyGroupDocument) danglingRefs() []danglingRefIssue {
+	issues := []danglingRefIssue{}
+	for _, groupNode := range d.groups.Content {
+		if groupNode.Kind != yaml.MappingNode {
+			continue
+		}
+		group := yamlMappingValue(groupNode, "name")
+		for i, member := range scalarValues(groupField(groupNode, "proxies", false)) {
+			if d.validMember(group, member) != nil {
+				issues = append(issues, danglingRefIssue{Kind: "group", Group: group, Index: i, Target: member})
+			}
+		}
+	}
+
+	if d.rules == nil || d.rules.Kind != yaml.SequenceNode {
+		return issues
+	}
+	for i, ruleNode := range d.rules.Content {
+		if ruleNode.Kind != yaml.ScalarNode {
+			continue
+		}
+		target := ruleTargetName(ruleNode.Value)
+		if target == "" || target == "GLOBAL" || d.validMember("", target) == nil {
+			continue
+		}
+		issues = append(issues, danglingRefIssue{Kind: "rule", Rule: ruleNode.Value, Index: i, Target: target})
+	}
+	return issues
+}
+
+// ruleTargetName 返回规则指向的策略名称，无法确定时返回空
+func ruleTargetName(rule string) string {
+	parts := strings.Split(rule, ",")
+	if len(parts) < 2 || strings.EqualFold(strings.TrimSpace(parts[0]), "SUB-RULE") {
+		return ""
+	}
+	target := len(parts) - 1
+	for target > 1 && isRuleOption(strings.TrimSpace(parts[target])) {
+		target--
+	}
+	return strings.TrimSpace(parts[target])
+}
+
+// removeDanglingRefs 删除无效的代理组成员和规则，变空的代理组补充 DIRECT，返回删除数量
+func (d *proxyGroupDocument) removeDanglingRefs() int {
+	removed := 0
+	for _, groupNode := range d.groups.Content {
+		if groupNode.Kind != yaml.MappingNode {
+			continue
+		}
+		group := yamlMappingValue(groupNode, "name")
+		proxiesNode := groupField(groupNode, "proxies", false)
+		if proxiesNode == nil || proxiesNode.Kind != yaml.SequenceNode {
+			continue
+		}
+		kept := make([]*yaml.Node, 0, len(proxiesNode.Content))
+		for _, member := range proxiesNode.Content {
+			if member.Kind == yaml.ScalarNode && d.validMember(group, member.Value) != nil {
+				removed++
+				continue
+			}
+			kept = append(kept, member)
+		}
+		proxiesNode.Content = kept
+	}
+	fillEmptyProxyGroups(d.groups)
+
+	if d.rules != nil && d.rules.Kind == yaml.SequenceNode {
+		kept := make([]*yaml.Node, 0, len(d.rules.Content))
+		for _, ruleNode := range d.rules.Content {
+			if ruleNode.Kind == yaml.ScalarNode {
+				target := ruleTargetName(ruleNode.Value)
+				if target != "" && target != "GLOBAL" && d.validMember("", target) != nil {
+					removed++
+					continue
+				}
+			}
+			kept = append(kept, ruleNode)
+		}
+		d.rules.Content = kept
+	}
+	return removed
+}
+
+// loadProxyGroupDocument 读取订阅文件，文件中没有 proxy-groups 时返回 nil
+func loadProxyGroupDocument(filename string) (*proxyGroupDocument, string, error) {
+	filePath := filepath.Join("subscribes", filepath.Base(filename))
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, filePath, err
+	}
+	doc, err := parseProxyGroupDocument(content)
+	if err != nil {
+		return nil, filePath, err
+	}
+	return doc, filePath, nil
+}
+
+// handleDanglingRefs GET /api/admin/subscribe-files/dangling-refs 扫描全部订阅文件中引用不存在节点的代理组成员和规则
+func (h *subscribeFilesHandler) handleDanglingRefs(w http.ResponseWriter, r *http.Request) {
+	files, err := h.repo.ListSubscribeFiles(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	results := []danglingRefFile{}
+	total := 0
+	for _, file := range files {
+		doc, _, err := loadProxyGroupDocument(file.Filename)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				results = append(results, danglingRefFile{Filename: file.Filename, Name: file.Name, Issues: []danglingRefIssue{}, Error: err.Error()})
+			}
+			continue
+		}
+		issues := doc.danglingRefs()
+		if len(issues) == 0 {
+			continue
+		}
+		total += len(issues)
+		results = append(results, danglingRefFile{Filename: file.Filename, Name: file.Name, Issues: issues})
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"files":        results,
+		"total_issues": total,
+	})
+}
+
+// handleFixDanglingRefs POST /api/admin/subscribe-files/dangling-refs/fix 删除无效引用，
+// files 为空时处理全部存在问题的文件，每个修改的文件都会保存版本
+func (h *subscribeFilesHandler) handleFixDanglingRefs(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Files []string `json:"files"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, "请求格式不正确")
+			return
+		}
+	}
+
+	files, err := h.repo.ListSubscribeFiles(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	selected := make(map[string]struct{}, len(req.Files))
+	for _, name := range req.Files {
+		selected[strings.TrimSpace(name)] = struct{}{}
+	}
+
+	results := []danglingRefFile{}
+	for _, file := range files {
+		if _, ok := selected[file.Filename]; len(selected) > 0 && !ok {
+			continue
+		}
+		doc, filePath, err := loadProxyGroupDocument(file.Filename)
+		if err != nil {
+			if len(selected) > 0 {
+				results = append(results, danglingRefFile{Filename: file.Filename, Name: file.Name, Issues: []danglingRefIssue{}, Status: "error", Error: err.Error()})
+			}
+			continue
+		}
+		issues := doc.danglingRefs()
+		if len(issues) == 0 {
+			continue
+		}
+
+		result := danglingRefFile{Filename: file.Filename, Name: file.Name, Issues: issues}
+		result.Fixed = doc.removeDanglingRefs()
+		version, _, err := h.saveSubscribeFileNode(r.Context(), file, filePath, &doc.root)
+		switch {
+		case errors.Is(err, errClashConfigInvalid):
+			result.Status = "invalid"
+			result.Error = err.Error()
+			result.Fixed = 0
+		case err != nil:
+			result.Status = "error"
+			result.Error = err.Error()
+			result.Fixed = 0
+		default:
+			result.Status = "fixed"
+			result.Version = version
+			logger.Info("[无效引用] 已清理订阅文件中的无效引用", "filename", file.Filename, "removed", result.Fixed)
+		}
+		results = append(results, result)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{"files": results})
+}
@@ -0,0 +1,374 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/storage"
+)
+
+// DNS 凭据库：保存 DNS 服务商 API 凭据（加密存储），节点部署签发 TLS 证书时通过 acme.sh 的 DNS-01 验证使用。
+// 每个凭据限定可用的域名范围，同一范围内的节点部署共用一个凭据。
+const dnsCredentialsPath = "/api/admin/dns-credentials"
+
+// dnsProvider acme.sh 的 DNS API 插件及其读取的环境变量
+type dnsProvider struct {
+	Label    string
+	Hook     string
+	Required []string
+	Optional []string
+}
+
+var dnsProviders = map[string]dnsProvider{
+	"cloudflare": {
+		Label:    "Cloudflare",
+		Hook:     "dns_cf",
+		Required: []string{"CF_Token"},
+		Optional: []string{"CF_Account_ID", "CF_Zone_ID"},
+	},
+	"aliyun": {
+		Label:    "阿里云",
+		Hook:     "dns_ali",
+		Required: []string{"Ali_Key", "Ali_Secret"},
+	},
+	"dnspod": {
+		Label:    "DNSPod",
+		Hook:     "dns_dp",
+		Required: []string{"DP_Id", "DP_Key"},
+	},
+	"tencentcloud": {
+		Label:    "腾讯云",
+		Hook:     "dns_tencent",
+		Required: []string{"Tencent_SecretId", "Tencent_SecretKey"},
+	},
+	"route53": {
+		Label:    "AWS Route 53",
+		Hook:     "dns_aws",
+		Required: []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"},
+	},
+	"godaddy": {
+		Label:    "GoDaddy",
+		Hook:     "dns_gd",
+		Required: []string{"GD_Key", "GD_Secret"},
+	},
+}
+
+func (p dnsProvider) allows(key string) bool {
+	for _, k := range p.Required {
+		if k == key {
+			return true
+		}
+	}
+	for _, k := range p.Optional {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+type dnsProviderDTO struct {
+	Name     string   `json:"name"`
+	Label    string   `json:"label"`
+	Required []string `json:"required"`
+	Optional []string `json:"optional"`
+}
+
+type dnsCredentialDTO struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Provider   string     `json:"provider"`
+	Domains    []string   `json:"domains"`
+	Keys       []string   `json:"keys"` // 已保存的变量名，值不返回
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+func convertDNSCredential(c storage.DNSCredential) dnsCredentialDTO {
+	keys := make([]string, 0, len(c.Values))
+	for key := range c.Values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	domains := c.Domains
+	if domains == nil {
+		domains = []string{}
+	}
+	return dnsCredentialDTO{
+		ID:         c.ID,
+		Name:       c.Name,
+		Provider:   c.Provider,
+		Domains:    domains,
+		Keys:       keys,
+		LastUsedAt: c.LastUsedAt,
+		CreatedAt:  c.CreatedAt,
+		UpdatedAt:  c.UpdatedAt,
+	}
+}
+
+type dnsCredentialRequest struct {
+	Name     string   `json:"name"`
+	Provider string   `json:"provider"`
+	Domains  []string `json:"domains"`
+	// Values 更新时省略的变量保持原值，值为空字符串表示删除
+	Values map[string]string `json:"values"`
+}
+
+type dnsCredentialsHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewDNSCredentialsHandler 管理 DNS 凭据：GET 列表（含支持的服务商），POST 创建，PUT/DELETE /{id}
+func NewDNSCredentialsHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("dns credentials handler requires repository")
+	}
+
+	return &dnsCredentialsHandler{repo: repo}
+}
+
+func (h *dnsCredentialsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	username := auth.UsernameFromContext(r.Context())
+	if username == "" {
+		writeError(w, http.StatusUnauthorized, errors.New("用户未认证"))
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, dnsCredentialsPath), "/")
+	if rest == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.handleList(w, r, username)
+		case http.MethodPost:
+			h.handleCreate(w, r, username)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+		return
+	}
+
+	id, err := strconv.ParseInt(rest, 10, 64)
+	if err != nil || id <= 0 {
+		writeBadRequest(w, "凭据 ID 无效")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		h.handleUpdate(w, r, id, username)
+	case http.MethodDelete:
+		if err := h.repo.DeleteDNSCredential(r.Context(), id, username); err != nil {
+			switch {
+			case errors.Is(err, storage.ErrDNSCredentialNotFound):
+				writeError(w, http.StatusNotFound, errors.New("凭据不存在"))
+			case errors.Is(err, storage.ErrDNSCredentialInUse):
+				writeError(w, http.StatusConflict, errors.New("凭据正被节点部署使用，请先修改或删除相关部署"))
+			default:
+				writeError(w, http.StatusInternalServerError, err)
+			}
+			return
+		}
+		recordAudit(r.Context(), "dns_credential.delete", rest, "", "")
+		respondJSON(w, http.StatusOK, map[string]any{"status": "deleted"})
+	default:
+		methodNotAllowed(w, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (h *dnsCredentialsHandler) handleList(w http.ResponseWriter, r *http.Request, username string) {
+	credentials, err := h.repo.ListDNSCredentials(r.Context(), username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]dnsCredentialDTO, 0, len(credentials))
+	for _, c := range credentials {
+		items = append(items, convertDNSCredential(c))
+	}
+	providers := make([]dnsProviderDTO, 0, len(dnsProviders))
+	for name, p := range dnsProviders {
+		optional := p.Optional
+		if optional == nil {
+			optional = []string{}
+		}
+		providers = append(providers, dnsProviderDTO{Name: name, Label: p.Label, Required: p.Required, Optional: optional})
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].Name < providers[j].Name })
+	respondJSON(w, http.StatusOK, map[string]any{"credentials": items, "providers": providers})
+}
+
+func (h *dnsCredentialsHandler) handleCreate(w http.ResponseWriter, r *http.Request, username string) {
+	var req dnsCredentialRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	c := storage.DNSCredential{
+		Username: username,
+		Name:     strings.TrimSpace(req.Name),
+		Provider: strings.ToLower(strings.TrimSpace(req.Provider)),
+		Domains:  req.Domains,
+		Values:   map[string]string{},
+	}
+	if err := mergeDNSCredentialValues(&c, req.Values); err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	if err := validateDNSCredential(c); err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	created, err := h.repo.CreateDNSCredential(r.Context(), c)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	recordAudit(r.Context(), "dns_credential.create", created.Name, "", fmt.Sprintf("provider=%s domains=%s", created.Provider, strings.Join(created.Domains, ",")))
+	respondJSON(w, http.StatusCreated, map[string]any{"credential": convertDNSCredential(created)})
+}
+
+func (h *dnsCredentialsHandler) handleUpdate(w http.ResponseWriter, r *http.Request, id int64, username string) {
+	var req dnsCredentialRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	existing, err := h.repo.GetDNSCredential(r.Context(), id, username)
+	if err != nil {
+		if errors.Is(err, storage.ErrDNSCredentialNotFound) {
+			writeError(w, http.StatusNotFound, errors.New("凭据不存在"))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	updated := existing
+	if name := strings.TrimSpace(req.Name); name != "" {
+		updated.Name = name
+	}
+	if req.Domains != nil {
+		updated.Domains = req.Domains
+	}
+	if err := mergeDNSCredentialValues(&updated, req.Values); err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	if err := validateDNSCredential(updated); err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	saved, err := h.repo.UpdateDNSCredential(r.Context(), updated)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	recordAudit(r.Context(), "dns_credential.update", saved.Name, strings.Join(existing.Domains, ","), strings.Join(saved.Domains, ","))
+	respondJSON(w, http.StatusOK, map[string]any{"credential": convertDNSCredential(saved)})
+}
+
+// mergeDNSCredentialValues 将请求中的变量合并到凭据，空值表示删除该变量
+func mergeDNSCredentialValues(c *storage.DNSCredential, values map[string]string) error {
+	provider, ok := dnsProviders[c.Provider]
+	if !ok {
+		return fmt.Errorf("不支持的 DNS 服务商: %s", c.Provider)
+	}
+	if c.Values == nil {
+		c.Values = map[string]string{}
+	}
+	for key, value := range values {
+		key = strings.TrimSpace(key)
+		if !provider.allows(key) {
+			return fmt.Errorf("%s 不支持变量 %s", provider.Label, key)
+		}
+		if value = strings.TrimSpace(value); value == "" {
+			delete(c.Values, key)
+			continue
+		}
+		c.Values[key] = value
+	}
+	return nil
+}
+
+func validateDNSCredential(c storage.DNSCredential) error {
+	if c.Name == "" {
+		return errors.New("凭据名称不能为空")
+	}
+	provider, ok := dnsProviders[c.Provider]
+	if !ok {
+		return fmt.Errorf("不支持的 DNS 服务商: %s", c.Provider)
+	}
+	for _, key := range provider.Required {
+		if c.Values[key] == "" {
+			return fmt.Errorf("缺少必填变量 %s", key)
+		}
+	}
+	hasDomain := false
+	for _, domain := range c.Domains {
+		domain = strings.TrimPrefix(strings.TrimSpace(domain), "*.")
+		if domain == "" {
+			continue
+		}
+		if !strings.Contains(domain, ".") || strings.ContainsAny(domain, " /:") {
+			return fmt.Errorf("域名无效: %s", domain)
+		}
+		hasDomain = true
+	}
+	if !hasDomain {
+		return errors.New("至少需要一个可用域名")
+	}
+	return nil
+}
+
+// acmeIssueScript 生成签发证书的命令：导出服务商变量，按需安装 acme.sh，通过 DNS-01 签发并安装证书到
+// /etc/ssl/miaomiaowu/<domain>/，最后导出 MMW_TLS_DOMAIN / MMW_TLS_CERT / MMW_TLS_KEY 供后续安装脚本使用。
+// 证书未到续期时间时 acme.sh --issue 返回 2，视为成功
+func acmeIssueScript(c storage.DNSCredential, domain string) (string, error) {
+	provider, ok := dnsProviders[c.Provider]
+	if !ok {
+		return "", fmt.Errorf("不支持的 DNS 服务商: %s", c.Provider)
+	}
+	if !c.Allows(domain) {
+		return "", fmt.Errorf("凭据 %s 不能用于域名 %s", c.Name, domain)
+	}
+
+	dir := "/etc/ssl/miaomiaowu/" + domain
+	cert, key := dir+"/fullchain.pem", dir+"/privkey.pem"
+
+	keys := make([]string, 0, len(c.Values))
+	for k := range c.Values {
+		if provider.allows(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "export %s=%s; ", k, shellQuote(c.Values[k]))
+	}
+	b.WriteString(`ACME_SH="$HOME/.acme.sh/acme.sh"; `)
+	b.WriteString(`[ -x "$ACME_SH" ] || curl -fsSL https://get.acme.sh | sh || exit 1; `)
+	fmt.Fprintf(&b, `"$ACME_SH" --issue --server letsencrypt --dns %s -d %s --keylength ec-256; rc=$?; `, provider.Hook, shellQuote(domain))
+	b.WriteString(`if [ $rc -ne 0 ] && [ $rc -ne 2 ]; then echo "certificate issue failed: $rc"; exit $rc; fi; `)
+	fmt.Fprintf(&b, `mkdir -p %s && "$ACME_SH" --install-cert -d %s --ecc --fullchain-file %s --key-file %s || exit 1; `,
+		shellQuote(dir), shellQuote(domain), shellQuote(cert), shellQuote(key))
+	for _, k := range keys {
+		fmt.Fprintf(&b, "unset %s; ", k)
+	}
+	fmt.Fprintf(&b, "export MMW_TLS_DOMAIN=%s MMW_TLS_CERT=%s MMW_TLS_KEY=%s", shellQuote(domain), shellQuote(cert), shellQuote(key))
+	return b.String(), nil
+}
@@ -0,0 +1,413 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	smtpTimeout = 30 * time.Second
+
+	EmailTemplateTrafficAlert  = "traffic_alert"
+	EmailTemplateExpiringPlan  = "expiring_plan"
+	EmailTemplatePasswordReset = "password_reset"
+	EmailTemplateTest          = "test"
+
+	EmailTemplatePasswordResetLink = "password_reset_link"
+)
+
+// ErrSMTPDisabled is returned when an email is requested but SMTP is not configured.
+var ErrSMTPDisabled = errors.New("未启用邮件通知")
+
+type emailTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+func mustEmailTemplate(name, subject, body string) emailTemplate {
+	return emailTemplate{
+		subject: template.Must(template.New(name + "_subject").Parse(subject)),
+		body:    template.Must(template.New(name + "_body").Parse(body)),
+	}
+}
+
+// emailTemplates 邮件模板，使用 text/template 语法渲染
+var emailTemplates = map[string]emailTemplate{
+	EmailTemplateTrafficAlert: mustEmailTemplate(EmailTemplateTrafficAlert,
+		`[妙妙屋] {{.Title}}`,
+		`{{.Content}}
+
+时间：{{.Time}}
+`),
+	EmailTemplateExpiringPlan: mustEmailTemplate(EmailTemplateExpiringPlan,
+		`[妙妙屋] 外部订阅「{{.Name}}」即将到期`,
+		`您好 {{.Username}}，
+
+您的外部订阅「{{.Name}}」将于 {{.Expire}} 到期（剩余约 {{.DaysLeft}} 天），请及时续费，避免节点不可用。
+`),
+	EmailTemplatePasswordReset: mustEmailTemplate(EmailTemplatePasswordReset,
+		`[妙妙屋] 账号密码已重置`,
+		`您好 {{.Username}}，
+
+管理员已重置您的登录密码。{{if .Password}}
+新密码：{{.Password}}
+{{end}}
+请登录后及时修改密码。如非本人知晓的操作，请联系管理员。
+`),
+	EmailTemplatePasswordResetLink: mustEmailTemplate(EmailTemplatePasswordResetLink,
+		`[妙妙屋] 重置登录密码`,
+		`您好 {{.Username}}，
+
+我们收到了重置您登录密码的请求。请在 {{.Minutes}} 分钟内（{{.Expire}} 前）打开以下链接设置新密码：
+
+{{.Link}}
+
+链接只能使用一次。如非本人操作，请忽略本邮件，您的密码不会被修改。
+`),
+	EmailTemplateTest: mustEmailTemplate(EmailTemplateTest,
+		`[妙妙屋] 测试邮件`,
+		`这是一封测试邮件，收到说明 SMTP 配置正确。
+
+发送时间：{{.Time}}
+`),
+}
+
+func renderEmail(name string, data any) (string, string, error) {
+	tmpl, ok := emailTemplates[name]
+	if !ok {
+		return "", "", fmt.Errorf("未知的邮件模板: %s", name)
+	}
+	var subject, body bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, data); err != nil {
+		return "", "", fmt.Errorf("渲染邮件标题失败: %w", err)
+	}
+	if err := tmpl.body.Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("渲染邮件内容失败: %w", err)
+	}
+	return strings.TrimSpace(subject.String()), body.String(), nil
+}
+
+// buildEmailMessage 生成 UTF-8 纯文本邮件，正文使用 base64 编码
+func buildEmailMessage(settings storage.SMTPSettings, to []string, subject, body string) []byte {
+	from := mail.Address{Name: settings.FromName, Address: settings.FromAddress}
+	recipients := make([]string, 0, len(to))
+	for _, addr := range to {
+		recipients = append(recipients, (&mail.Address{Address: addr}).String())
+	}
+
+	id := make([]byte, 12)
+	_, _ = rand.Read(id)
+	domain := settings.FromAddress[strings.LastIndex(settings.FromAddress, "@")+1:]
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	for len(encoded) > 76 {
+		msg.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	msg.WriteString(encoded + "\r\n")
+	return msg.Bytes()
+}
+
+// sendSMTPMail 通过 SMTP 发送邮件，离线模式下只允许本机邮件服务器
+func sendSMTPMail(ctx context.Context, settings storage.SMTPSettings, to []string, subject, body string) error {
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(settings.Host, strconv.Itoa(settings.Port))
+	conn, err := guardOutboundDial((&net.Dialer{}).DialContext)(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("连接 SMTP 服务器失败: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	tlsConfig := &tls.Config{ServerName: settings.Host}
+	if settings.Encryption == storage.SMTPEncryptionTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, settings.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP 握手失败: %w", err)
+	}
+	defer client.Close()
+
+	if settings.Encryption == storage.SMTPEncryptionSTARTTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP 服务器不支持 STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS 失败: %w", err)
+		}
+	}
+
+	if settings.Username != "" {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(smtp.PlainAuth("", settings.Username, settings.Password, settings.Host)); err != nil {
+				return fmt.Errorf("SMTP 认证失败: %w", err)
+			}
+		}
+	}
+
+	if err := client.Mail(settings.FromAddress); err != nil {
+		return fmt.Errorf("设置发件人失败: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("设置收件人 %s 失败: %w", rcpt, err)
+		}
+	}
+	wc, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("发送邮件失败: %w", err)
+	}
+	if _, err := wc.Write(buildEmailMessage(settings, to, subject, body)); err != nil {
+		wc.Close()
+		return fmt.Errorf("发送邮件失败: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("发送邮件失败: %w", err)
+	}
+	return client.Quit()
+}
+
+// sendTemplatedEmail 使用模板渲染并发送邮件，SMTP 未启用时返回 ErrSMTPDisabled
+func sendTemplatedEmail(ctx context.Context, repo *storage.TrafficRepository, to, name string, data any) error {
+	settings, err := repo.GetSMTPSettings(ctx)
+	if err != nil {
+		return err
+	}
+	if !settings.Enabled {
+		return ErrSMTPDisabled
+	}
+	subject, body, err := renderEmail(name, data)
+	if err != nil {
+		return err
+	}
+	return sendSMTPMail(ctx, settings, []string{to}, subject, body)
+}
+
+// emailUserAsync 在后台向用户的邮箱发送模板邮件；用户没有邮箱或未启用 SMTP 时静默跳过
+func emailUserAsync(repo *storage.TrafficRepository, username, name string, data any) {
+	if repo == nil {
+		return
+	}
+	go func() {
+		ctx := context.Background()
+		user, err := repo.GetUser(ctx, username)
+		if err != nil {
+			logger.Warn("[邮件] 读取用户信息失败", "username", username, "error", err)
+			return
+		}
+		email := strings.TrimSpace(user.Email)
+		if email == "" {
+			return
+		}
+		if err := sendTemplatedEmail(ctx, repo, email, name, data); err != nil {
+			if !errors.Is(err, ErrSMTPDisabled) {
+				logger.Warn("[邮件] 发送邮件失败", "username", username, "template", name, "error", err)
+			}
+			return
+		}
+		logger.Info("[邮件] 已发送邮件", "username", username, "template", name)
+	}()
+}
+
+type smtpSettingsRequest struct {
+	Enabled     bool    `json:"enabled"`
+	Host        string  `json:"host"`
+	Port        int     `json:"port"`
+	Username    string  `json:"username"`
+	Password    *string `json:"password"` // nil keeps the saved password, "" clears it
+	FromAddress string  `json:"from_address"`
+	FromName    string  `json:"from_name"`
+	Encryption  string  `json:"encryption"`
+}
+
+type smtpSettingsResponse struct {
+	Enabled     bool     `json:"enabled"`
+	Host        string   `json:"host"`
+	Port        int      `json:"port"`
+	Username    string   `json:"username"`
+	HasPassword bool     `json:"has_password"`
+	FromAddress string   `json:"from_address"`
+	FromName    string   `json:"from_name"`
+	Encryption  string   `json:"encryption"`
+	Templates   []string `json:"templates"`
+}
+
+type smtpSettingsHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewSMTPSettingsHandler manages the SMTP settings for email notifications (GET/PUT) and sends a
+// test email at /test (POST).
+func NewSMTPSettingsHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("smtp settings handler requires repository")
+	}
+
+	return &smtpSettingsHandler{repo: repo}
+}
+
+func (h *smtpSettingsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/test") {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		h.handleTest(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.respondSettings(w, r)
+	case http.MethodPut:
+		h.handleUpdate(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+	}
+}
+
+func (h *smtpSettingsHandler) respondSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.repo.GetSMTPSettings(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, smtpSettingsResponse{
+		Enabled:     settings.Enabled,
+		Host:        settings.Host,
+		Port:        settings.Port,
+		Username:    settings.Username,
+		HasPassword: settings.Password != "",
+		FromAddress: settings.FromAddress,
+		FromName:    settings.FromName,
+		Encryption:  settings.Encryption,
+		Templates:   []string{EmailTemplateTrafficAlert, EmailTemplateExpiringPlan, EmailTemplatePasswordReset, EmailTemplatePasswordResetLink},
+	})
+}
+
+func (h *smtpSettingsHandler) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	var payload smtpSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	current, err := h.repo.GetSMTPSettings(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	settings := storage.SMTPSettings{
+		Enabled:     payload.Enabled,
+		Host:        strings.TrimSpace(payload.Host),
+		Port:        payload.Port,
+		Username:    strings.TrimSpace(payload.Username),
+		Password:    current.Password,
+		FromAddress: strings.TrimSpace(payload.FromAddress),
+		FromName:    strings.TrimSpace(payload.FromName),
+		Encryption:  strings.ToLower(strings.TrimSpace(payload.Encryption)),
+	}
+	if payload.Password != nil {
+		settings.Password = *payload.Password
+	}
+	if settings.Encryption == "" {
+		settings.Encryption = storage.SMTPEncryptionSTARTTLS
+	}
+	switch settings.Encryption {
+	case storage.SMTPEncryptionNone, storage.SMTPEncryptionSTARTTLS, storage.SMTPEncryptionTLS:
+	default:
+		writeBadRequest(w, "encryption 只能是 none、starttls 或 tls")
+		return
+	}
+	if settings.Port == 0 {
+		settings.Port = 587
+		if settings.Encryption == storage.SMTPEncryptionTLS {
+			settings.Port = 465
+		}
+	}
+	if settings.Port < 1 || settings.Port > 65535 {
+		writeBadRequest(w, "端口无效")
+		return
+	}
+	if settings.FromAddress != "" {
+		if _, err := mail.ParseAddress(settings.FromAddress); err != nil {
+			writeBadRequest(w, "发件人地址无效")
+			return
+		}
+	}
+	if settings.Enabled && (settings.Host == "" || settings.FromAddress == "") {
+		writeBadRequest(w, "启用邮件通知需要填写 SMTP 服务器和发件人地址")
+		return
+	}
+
+	if err := h.repo.UpdateSMTPSettings(r.Context(), settings); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logger.Info("[邮件] SMTP 设置已更新", "enabled", settings.Enabled, "host", settings.Host, "port", settings.Port)
+	h.respondSettings(w, r)
+}
+
+func (h *smtpSettingsHandler) handleTest(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		To string `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+	to, err := mail.ParseAddress(strings.TrimSpace(payload.To))
+	if err != nil {
+		writeBadRequest(w, "收件人地址无效")
+		return
+	}
+
+	data := map[string]string{"Time": time.Now().Format("2006-01-02 15:04:05")}
+	if err := sendTemplatedEmail(r.Context(), h.repo, to.Address, EmailTemplateTest, data); err != nil {
+		if errors.Is(err, ErrSMTPDisabled) {
+			writeBadRequest(w, err.Error())
+			return
+		}
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"success": true})
+}
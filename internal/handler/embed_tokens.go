@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+)
+
+const defaultEmbedTokenTTL = time.Hour
+
+// embedScopeEndpoints 各访问范围可读取的接口，随令牌一起返回方便嵌入
+var embedScopeEndpoints = map[string][]string{
+	auth.ScopeTrafficRead:    {"/api/traffic/summary", "/api/user/node-pool/trend"},
+	auth.ScopeNodeStatusRead: {"/api/user/probe-status"},
+}
+
+type embedTokenRequest struct {
+	Scopes     []string `json:"scopes"`
+	TTLMinutes int      `json:"ttl_minutes"`
+}
+
+type embedTokenResponse struct {
+	Token     string    `json:"token"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Endpoints []string  `json:"endpoints"`
+}
+
+type embedTokenHandler struct {
+	tokens *auth.TokenStore
+}
+
+// NewEmbedTokenHandler mints short-lived read-only tokens (POST) for embedding the traffic chart and
+// node status views in another dashboard, and revokes them (DELETE ?token=).
+func NewEmbedTokenHandler(tokens *auth.TokenStore) http.Handler {
+	if tokens == nil {
+		panic("embed token handler requires token store")
+	}
+
+	return &embedTokenHandler{tokens: tokens}
+}
+
+func (h *embedTokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.handleIssue(w, r)
+	case http.MethodDelete:
+		h.handleRevoke(w, r)
+	default:
+		methodNotAllowed(w, http.MethodPost, http.MethodDelete)
+	}
+}
+
+func (h *embedTokenHandler) handleIssue(w http.ResponseWriter, r *http.Request) {
+	username := auth.UsernameFromContext(r.Context())
+
+	var payload embedTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	scopes := make([]string, 0, len(payload.Scopes))
+	seen := make(map[string]bool, len(payload.Scopes))
+	for _, scope := range payload.Scopes {
+		scope = strings.TrimSpace(scope)
+		if !auth.IsKnownScope(scope) {
+			writeBadRequest(w, "未知的访问范围: "+scope)
+			return
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		writeBadRequest(w, "至少需要指定一个访问范围")
+		return
+	}
+
+	ttl := defaultEmbedTokenTTL
+	if payload.TTLMinutes != 0 {
+		ttl = time.Duration(payload.TTLMinutes) * time.Minute
+		if ttl <= 0 || ttl > auth.MaxScopedTokenTTL {
+			writeBadRequest(w, "有效期需在 1 分钟到 24 小时之间")
+			return
+		}
+	}
+
+	token, expiry, err := h.tokens.IssueScoped(username, scopes, ttl)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	endpoints := make([]string, 0)
+	for _, scope := range scopes {
+		for _, endpoint := range embedScopeEndpoints[scope] {
+			endpoints = append(endpoints, endpoint+"?token="+url.QueryEscape(token))
+		}
+	}
+
+	logger.Info("[嵌入令牌] 已签发只读令牌", "user", username, "scopes", scopes, "expires_at", expiry.Format("2006-01-02 15:04:05"))
+	respondJSON(w, http.StatusCreated, embedTokenResponse{
+		Token:     token,
+		Scopes:    scopes,
+		ExpiresAt: expiry,
+		Endpoints: endpoints,
+	})
+}
+
+func (h *embedTokenHandler) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSpace(r.URL.Query().Get("token"))
+	if token == "" {
+		writeBadRequest(w, "缺少 token 参数")
+		return
+	}
+
+	// 只能撤销自己签发的受限令牌
+	if !h.tokens.RevokeScoped(token, auth.UsernameFromContext(r.Context())) {
+		writeError(w, http.StatusNotFound, errors.New("令牌不存在或已过期"))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
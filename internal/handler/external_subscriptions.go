@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"miaomiaowu/internal/logger"
 	"net/http"
+	"net/textproto"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -18,22 +22,200 @@ type externalSubscriptionRequest struct {
 	URL         string `json:"url"`
 	UserAgent   string `json:"user_agent"`
 	TrafficMode string `json:"traffic_mode"` // 流量统计方式: "download", "upload", "both"
+	// 节点重命名规则，未传时保留现有值
+	NamePrefix      *string `json:"name_prefix"`
+	NameSuffix      *string `json:"name_suffix"`
+	NameRegex       *string `json:"name_regex"`
+	NameReplacement *string `json:"name_replacement"`
+	// 拉取订阅使用的出站代理（http/socks5），空为全局设置，"direct" 为直连；未传时保留现有值
+	FetchProxy *string `json:"fetch_proxy"`
+	// 拉取订阅时附加的请求头（例如认证头）；未传时保留现有值
+	Headers map[string]string `json:"headers"`
 }
 
 type externalSubscriptionResponse struct {
-	ID          int64   `json:"id"`
-	Name        string  `json:"name"`
-	URL         string  `json:"url"`
-	UserAgent   string  `json:"user_agent"`
-	NodeCount   int     `json:"node_count"`
-	LastSyncAt  *string `json:"last_sync_at"`
-	Upload      int64   `json:"upload"`       // 已上传流量（字节）
-	Download    int64   `json:"download"`     // 已下载流量（字节）
-	Total       int64   `json:"total"`        // 总流量（字节）
-	Expire      *string `json:"expire"`       // 过期时间
-	TrafficMode string  `json:"traffic_mode"` // 流量统计方式: "download", "upload", "both"
-	CreatedAt   string  `json:"created_at"`
-	UpdatedAt   string  `json:"updated_at"`
+	ID              int64             `json:"id"`
+	UUID            string            `json:"uuid"`
+	Name            string            `json:"name"`
+	URL             string            `json:"url"`
+	UserAgent       string            `json:"user_agent"`
+	NodeCount       int               `json:"node_count"`
+	LastSyncAt      *string           `json:"last_sync_at"`
+	Upload          int64             `json:"upload"`       // 已上传流量（字节）
+	Download        int64             `json:"download"`     // 已下载流量（字节）
+	Total           int64             `json:"total"`        // 总流量（字节）
+	Expire          *string           `json:"expire"`       // 过期时间（UTC，RFC3339）
+	TrafficMode     string            `json:"traffic_mode"` // 流量统计方式: "download", "upload", "both"
+	ExpireUnix      *int64            `json:"expire_unix"`
+	RemainingDays   *int              `json:"remaining_days"`
+	RemainingText   string            `json:"remaining_days_text"`
+	NamePrefix      string            `json:"name_prefix"`
+	NameSuffix      string            `json:"name_suffix"`
+	NameRegex       string            `json:"name_regex"`
+	NameReplacement string            `json:"name_replacement"`
+	FetchProxy      string            `json:"fetch_proxy"`
+	Headers         map[string]string `json:"headers"`
+	CreatedAt       string            `json:"created_at"`
+	UpdatedAt       string            `json:"updated_at"`
+	// 可靠性评分，仅在列表接口中返回
+	Reliability *externalSubscriptionReliability `json:"reliability,omitempty"`
+}
+
+// convertExternalSubscriptionResponse 将存储层的外部订阅转换为接口响应
+func convertExternalSubscriptionResponse(sub storage.ExternalSubscription) externalSubscriptionResponse {
+	var lastSyncAt *string
+	if sub.LastSyncAt != nil {
+		formatted := sub.LastSyncAt.Format(time.RFC3339)
+		lastSyncAt = &formatted
+	}
+
+	var (
+		expire        *string
+		expireUnix    *int64
+		remainingDays *int
+		remainingText string
+	)
+	if sub.Expire != nil {
+		formatted := sub.Expire.UTC().Format(time.RFC3339)
+		expire = &formatted
+		unix := sub.Expire.Unix()
+		expireUnix = &unix
+		days, text := humanizeRemainingDays(*sub.Expire, time.Now())
+		remainingDays = &days
+		remainingText = text
+	}
+
+	return externalSubscriptionResponse{
+		ID:              sub.ID,
+		UUID:            sub.UUID,
+		Name:            sub.Name,
+		URL:             sub.URL,
+		UserAgent:       sub.UserAgent,
+		NodeCount:       sub.NodeCount,
+		LastSyncAt:      lastSyncAt,
+		Upload:          sub.Upload,
+		Download:        sub.Download,
+		Total:           sub.Total,
+		Expire:          expire,
+		ExpireUnix:      expireUnix,
+		RemainingDays:   remainingDays,
+		RemainingText:   remainingText,
+		TrafficMode:     sub.TrafficMode,
+		NamePrefix:      sub.NamePrefix,
+		NameSuffix:      sub.NameSuffix,
+		NameRegex:       sub.NameRegex,
+		NameReplacement: sub.NameReplacement,
+		FetchProxy:      sub.FetchProxy,
+		Headers:         sub.Headers,
+		CreatedAt:       sub.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:       sub.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// humanizeRemainingDays 计算距离过期的整天数（已过期为负数）以及对应的展示文案，
+// 对应响应中的 remaining_days / remaining_days_text，如 "剩余 12 天"、"今天到期"、"已过期 3 天"
+func humanizeRemainingDays(expire, now time.Time) (int, string) {
+	remaining := expire.Sub(now)
+	if remaining < 0 {
+		days := int(-remaining.Hours() / 24)
+		if days == 0 {
+			return 0, "今天已过期"
+		}
+		return -days, fmt.Sprintf("已过期 %d 天", days)
+	}
+	days := int(remaining.Hours() / 24)
+	if days == 0 {
+		return 0, "今天到期"
+	}
+	return days, fmt.Sprintf("剩余 %d 天", days)
+}
+
+// maxSubscriptionHeaders 每个外部订阅允许的自定义请求头数量上限
+const maxSubscriptionHeaders = 20
+
+// reservedSubscriptionHeaders 由 HTTP 客户端管理、不允许自定义的请求头
+var reservedSubscriptionHeaders = map[string]struct{}{
+	"Host":              {},
+	"Content-Length":    {},
+	"Connection":        {},
+	"Transfer-Encoding": {},
+	"Upgrade":           {},
+}
+
+// sanitizeSubscriptionHeaders 规范化并校验自定义请求头，User-Agent 请使用单独的字段
+func sanitizeSubscriptionHeaders(headers map[string]string) (map[string]string, error) {
+	sanitized := make(map[string]string, len(headers))
+	if len(headers) > maxSubscriptionHeaders {
+		return nil, fmt.Errorf("too many headers (max %d)", maxSubscriptionHeaders)
+	}
+
+	for name, value := range headers {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !isValidHeaderName(name) {
+			return nil, fmt.Errorf("invalid header name: %s", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("invalid header value for %s", name)
+		}
+
+		canonical := textproto.CanonicalMIMEHeaderKey(name)
+		if _, reserved := reservedSubscriptionHeaders[canonical]; reserved {
+			return nil, fmt.Errorf("header %s cannot be customized", canonical)
+		}
+		if canonical == "User-Agent" {
+			return nil, errors.New("use the user_agent field to set User-Agent")
+		}
+		sanitized[canonical] = strings.TrimSpace(value)
+	}
+
+	return sanitized, nil
+}
+
+func isValidHeaderName(name string) bool {
+	for _, c := range name {
+		if c > 0x7e || c <= 0x20 || strings.ContainsRune("()<>@,;:\\\"/[]?={}", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// applySubscriptionRequestHeaders 设置拉取订阅请求的 User-Agent（为空时使用 clash-meta）和自定义请求头
+func applySubscriptionRequestHeaders(req *http.Request, userAgent string, headers map[string]string) {
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if strings.TrimSpace(userAgent) == "" {
+		userAgent = "clash-meta/2.4.0"
+	}
+	req.Header.Set("User-Agent", userAgent)
+}
+
+// applyRenamePayload 将请求中的重命名规则覆盖到订阅上，并校验正则表达式
+func applyRenamePayload(sub *storage.ExternalSubscription, payload externalSubscriptionRequest) error {
+	if payload.NamePrefix != nil {
+		sub.NamePrefix = *payload.NamePrefix
+	}
+	if payload.NameSuffix != nil {
+		sub.NameSuffix = *payload.NameSuffix
+	}
+	if payload.NameRegex != nil {
+		sub.NameRegex = strings.TrimSpace(*payload.NameRegex)
+	}
+	if payload.NameReplacement != nil {
+		sub.NameReplacement = *payload.NameReplacement
+	}
+
+	if sub.NameRegex != "" {
+		if _, err := regexp.Compile(sub.NameRegex); err != nil {
+			return fmt.Errorf("invalid name regex: %w", err)
+		}
+	}
+
+	return nil
 }
 
 func NewExternalSubscriptionsHandler(repo *storage.TrafficRepository) http.Handler {
@@ -70,35 +252,18 @@ func handleListExternalSubscriptions(w http.ResponseWriter, r *http.Request, rep
 		return
 	}
 
+	reliability, err := computeExternalSubscriptionReliability(r.Context(), repo, username, subs)
+	if err != nil {
+		logger.Info("[外部订阅] 计算可靠性评分失败", "error", err)
+	}
+
 	resp := make([]externalSubscriptionResponse, 0, len(subs))
 	for _, sub := range subs {
-		var lastSyncAt *string
-		if sub.LastSyncAt != nil {
-			formatted := sub.LastSyncAt.Format(time.RFC3339)
-			lastSyncAt = &formatted
-		}
-
-		var expire *string
-		if sub.Expire != nil {
-			formatted := sub.Expire.Format(time.RFC3339)
-			expire = &formatted
-		}
-
-		resp = append(resp, externalSubscriptionResponse{
-			ID:          sub.ID,
-			Name:        sub.Name,
-			URL:         sub.URL,
-			UserAgent:   sub.UserAgent,
-			NodeCount:   sub.NodeCount,
-			LastSyncAt:  lastSyncAt,
-			Upload:      sub.Upload,
-			Download:    sub.Download,
-			Total:       sub.Total,
-			Expire:      expire,
-			TrafficMode: sub.TrafficMode,
-			CreatedAt:   sub.CreatedAt.Format(time.RFC3339),
-			UpdatedAt:   sub.UpdatedAt.Format(time.RFC3339),
-		})
+		item := convertExternalSubscriptionResponse(sub)
+		if rel, ok := reliability[sub.ID]; ok {
+			item.Reliability = &rel
+		}
+		resp = append(resp, item)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -134,12 +299,27 @@ func handleCreateExternalSubscription(w http.ResponseWriter, r *http.Request, re
 		userAgent = "clash-meta/2.4.0"
 	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	var fetchProxy string
+	if payload.FetchProxy != nil {
+		fetchProxy = strings.TrimSpace(*payload.FetchProxy)
+	}
+	if err := validateFetchProxyURL(fetchProxy); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	headers, err := sanitizeSubscriptionHeaders(payload.Headers)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	client := externalSubscriptionClient(&storage.ExternalSubscription{Name: name, FetchProxy: fetchProxy}, 30*time.Second, nil)
 	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, url, nil)
 	if err != nil {
 		logger.Info("[外部订阅] 创建请求失败", "name", name, "error", err)
 	} else {
-		req.Header.Set("User-Agent", userAgent)
+		applySubscriptionRequestHeaders(req, userAgent, headers)
 		logger.Info("[外部订阅] 获取流量信息", "name", name, "user_agent", userAgent)
 		resp, err := client.Do(req)
 		if err != nil {
@@ -165,7 +345,7 @@ func handleCreateExternalSubscription(w http.ResponseWriter, r *http.Request, re
 		logger.Info("[外部订阅] 未获取到流量信息，尝试使用 clash-meta UA 重新获取", "name", name)
 		retryReq, err := http.NewRequestWithContext(r.Context(), http.MethodGet, url, nil)
 		if err == nil {
-			retryReq.Header.Set("User-Agent", clashMetaUA)
+			applySubscriptionRequestHeaders(retryReq, clashMetaUA, headers)
 			retryResp, err := client.Do(retryReq)
 			if err == nil {
 				defer retryResp.Body.Close()
@@ -196,6 +376,12 @@ func handleCreateExternalSubscription(w http.ResponseWriter, r *http.Request, re
 		Download:    trafficDownload,
 		Total:       trafficTotal,
 		Expire:      trafficExpire,
+		FetchProxy:  fetchProxy,
+		Headers:     headers,
+	}
+	if err := applyRenamePayload(&sub, payload); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
 	}
 
 	id, err := repo.CreateExternalSubscription(r.Context(), sub)
@@ -214,33 +400,7 @@ func handleCreateExternalSubscription(w http.ResponseWriter, r *http.Request, re
 		return
 	}
 
-	var lastSyncAt *string
-	if created.LastSyncAt != nil {
-		formatted := created.LastSyncAt.Format(time.RFC3339)
-		lastSyncAt = &formatted
-	}
-
-	var expire *string
-	if created.Expire != nil {
-		formatted := created.Expire.Format(time.RFC3339)
-		expire = &formatted
-	}
-
-	resp := externalSubscriptionResponse{
-		ID:          created.ID,
-		Name:        created.Name,
-		URL:         created.URL,
-		UserAgent:   created.UserAgent,
-		NodeCount:   created.NodeCount,
-		LastSyncAt:  lastSyncAt,
-		Upload:      created.Upload,
-		Download:    created.Download,
-		Total:       created.Total,
-		Expire:      expire,
-		TrafficMode: created.TrafficMode,
-		CreatedAt:   created.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:   created.UpdatedAt.Format(time.RFC3339),
-	}
+	resp := convertExternalSubscriptionResponse(created)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -254,7 +414,7 @@ func handleUpdateExternalSubscription(w http.ResponseWriter, r *http.Request, re
 		return
 	}
 
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	id, err := resolveExternalSubscriptionID(r.Context(), repo, username, idStr)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, errors.New("invalid subscription id"))
 		return
@@ -295,18 +455,44 @@ func handleUpdateExternalSubscription(w http.ResponseWriter, r *http.Request, re
 	}
 
 	sub := storage.ExternalSubscription{
-		ID:          id,
-		Username:    username,
-		Name:        name,
-		URL:         url,
-		UserAgent:   payload.UserAgent, // 会在存储层使用默认值如果为空
-		TrafficMode: trafficMode,
-		NodeCount:   existing.NodeCount,
-		LastSyncAt:  existing.LastSyncAt,
-		Upload:      existing.Upload,
-		Download:    existing.Download,
-		Total:       existing.Total,
-		Expire:      existing.Expire,
+		ID:              id,
+		Username:        username,
+		Name:            name,
+		URL:             url,
+		UserAgent:       payload.UserAgent, // 会在存储层使用默认值如果为空
+		TrafficMode:     trafficMode,
+		NodeCount:       existing.NodeCount,
+		LastSyncAt:      existing.LastSyncAt,
+		Upload:          existing.Upload,
+		Download:        existing.Download,
+		Total:           existing.Total,
+		Expire:          existing.Expire,
+		NamePrefix:      existing.NamePrefix,
+		NameSuffix:      existing.NameSuffix,
+		NameRegex:       existing.NameRegex,
+		NameReplacement: existing.NameReplacement,
+		FetchProxy:      existing.FetchProxy,
+		Headers:         existing.Headers,
+	}
+	if err := applyRenamePayload(&sub, payload); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if payload.FetchProxy != nil {
+		fetchProxy := strings.TrimSpace(*payload.FetchProxy)
+		if err := validateFetchProxyURL(fetchProxy); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		sub.FetchProxy = fetchProxy
+	}
+	if payload.Headers != nil {
+		headers, err := sanitizeSubscriptionHeaders(payload.Headers)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		sub.Headers = headers
 	}
 
 	if err := repo.UpdateExternalSubscription(r.Context(), sub); err != nil {
@@ -324,33 +510,7 @@ func handleUpdateExternalSubscription(w http.ResponseWriter, r *http.Request, re
 		return
 	}
 
-	var lastSyncAt *string
-	if updated.LastSyncAt != nil {
-		formatted := updated.LastSyncAt.Format(time.RFC3339)
-		lastSyncAt = &formatted
-	}
-
-	var expire *string
-	if updated.Expire != nil {
-		formatted := updated.Expire.Format(time.RFC3339)
-		expire = &formatted
-	}
-
-	resp := externalSubscriptionResponse{
-		ID:          updated.ID,
-		Name:        updated.Name,
-		URL:         updated.URL,
-		UserAgent:   updated.UserAgent,
-		NodeCount:   updated.NodeCount,
-		LastSyncAt:  lastSyncAt,
-		Upload:      updated.Upload,
-		Download:    updated.Download,
-		Total:       updated.Total,
-		Expire:      expire,
-		TrafficMode: updated.TrafficMode,
-		CreatedAt:   updated.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:   updated.UpdatedAt.Format(time.RFC3339),
-	}
+	resp := convertExternalSubscriptionResponse(updated)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -364,7 +524,7 @@ func handleDeleteExternalSubscription(w http.ResponseWriter, r *http.Request, re
 		return
 	}
 
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	id, err := resolveExternalSubscriptionID(r.Context(), repo, username, idStr)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, errors.New("invalid subscription id"))
 		return
@@ -402,7 +562,7 @@ func NewExternalSubscriptionNodesHandler(repo *storage.TrafficRepository) http.H
 			return
 		}
 
-		id, err := strconv.ParseInt(idStr, 10, 64)
+		id, err := resolveExternalSubscriptionID(r.Context(), repo, username, idStr)
 		if err != nil {
 			writeError(w, http.StatusBadRequest, errors.New("invalid subscription id"))
 			return
@@ -496,3 +656,19 @@ func NewExternalSubscriptionCheckFilterHandler(repo *storage.TrafficRepository)
 		})
 	})
 }
+
+// resolveExternalSubscriptionID 解析数字 ID 或 UUID 形式的外部订阅标识
+func resolveExternalSubscriptionID(ctx context.Context, repo *storage.TrafficRepository, username, value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if storage.IsPublicID(value) {
+		id, err := repo.ExternalSubscriptionIDByUUID(ctx, value, username)
+		if err != nil {
+			return 0, err
+		}
+		if id == 0 {
+			return 0, errors.New("subscription not found")
+		}
+		return id, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
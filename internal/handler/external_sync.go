@@ -9,6 +9,7 @@ import (
 	"miaomiaowu/internal/logger"
 	"net/http"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -80,6 +81,7 @@ func syncExternalSubscriptionsManual(ctx context.Context, repo *storage.TrafficR
 		nodeCount, updatedSub, err := syncSingleExternalSubscription(ctx, client, repo, subscribeDir, username, sub, userSettings)
 		if err != nil {
 			logger.Info("[外部订阅同步-手动] 同步订阅失败", "index", i+1, "total", len(externalSubs), "name", sub.Name, "error", err)
+			notifyExternalSyncFailure(ctx, repo, username, sub, err)
 			continue
 		}
 
@@ -190,6 +192,7 @@ func syncExternalSubscriptions(ctx context.Context, repo *storage.TrafficReposit
 		nodeCount, updatedSub, err := syncSingleExternalSubscription(ctx, client, repo, subscribeDir, username, sub, userSettings)
 		if err != nil {
 			logger.Info("[外部订阅同步-自动] 同步订阅失败", "index", i+1, "total", len(subsToSync), "name", sub.Name, "error", err)
+			notifyExternalSyncFailure(ctx, repo, username, sub, err)
 			continue
 		}
 
@@ -258,20 +261,19 @@ func getUsedExternalSubscriptionURLs(ctx context.Context, repo *storage.TrafficR
 	return usedURLs, nil
 }
 
-// syncSingleExternalSubscription fetches and syncs nodes from a single external subscription
-// Returns: node count, updated subscription info, error
-func syncSingleExternalSubscription(ctx context.Context, client *http.Client, repo *storage.TrafficRepository, subscribeDir, username string, sub storage.ExternalSubscription, settings storage.UserSettings) (int, storage.ExternalSubscription, error) {
-	matchRule := settings.MatchRule
-	syncScope := settings.SyncScope
-	keepNodeName := settings.KeepNodeName
-
+// fetchExternalSubscriptionNodes fetches an external subscription and converts its proxies to nodes
+// tagged with the subscription name, applying the subscription's rename rules.
+func fetchExternalSubscriptionNodes(ctx context.Context, client *http.Client, repo *storage.TrafficRepository, username string, sub storage.ExternalSubscription, settings storage.UserSettings) ([]storage.Node, storage.ExternalSubscription, error) {
 	logger.Info("[外部订阅同步] 开始获取订阅内容", "name", sub.Name, "url", sub.URL)
 
+	// 订阅或全局配置了出站代理时，通过代理拉取
+	client = externalSubscriptionClient(&sub, 30*time.Second, client)
+
 	// Fetch subscription content
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sub.URL, nil)
 	if err != nil {
 		logger.Info("[外部订阅同步] 创建HTTP请求失败", "error", err)
-		return 0, sub, fmt.Errorf("create request: %w", err)
+		return nil, sub, fmt.Errorf("create request: %w", err)
 	}
 
 	// 使用订阅保存的 User-Agent，如果为空则使用默认值
@@ -279,13 +281,13 @@ func syncSingleExternalSubscription(ctx context.Context, client *http.Client, re
 	if userAgent == "" {
 		userAgent = "clash-meta/2.4.0"
 	}
-	req.Header.Set("User-Agent", userAgent)
-	logger.Info("[外部订阅同步] 使用 User-Agent", "user_agent", userAgent)
+	applySubscriptionRequestHeaders(req, userAgent, sub.Headers)
+	logger.Info("[外部订阅同步] 使用 User-Agent", "user_agent", userAgent, "extra_headers", len(sub.Headers))
 
 	resp, err := client.Do(req)
 	if err != nil {
 		logger.Info("[外部订阅同步] 请求订阅URL失败", "error", err)
-		return 0, sub, fmt.Errorf("fetch subscription: %w", err)
+		return nil, sub, fmt.Errorf("fetch subscription: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -293,7 +295,7 @@ func syncSingleExternalSubscription(ctx context.Context, client *http.Client, re
 
 	if resp.StatusCode != http.StatusOK {
 		logger.Info("[外部订阅同步] 订阅返回非200状态码", "status_code", resp.StatusCode)
-		return 0, sub, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, sub, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
 	// Parse subscription-userinfo header if sync_traffic is enabled
@@ -308,7 +310,7 @@ func syncSingleExternalSubscription(ctx context.Context, client *http.Client, re
 			clashMetaUA := "clash-meta/2.4.0"
 			trafficReq, err := http.NewRequestWithContext(ctx, http.MethodGet, sub.URL, nil)
 			if err == nil {
-				trafficReq.Header.Set("User-Agent", clashMetaUA)
+				applySubscriptionRequestHeaders(trafficReq, clashMetaUA, sub.Headers)
 				trafficResp, err := client.Do(trafficReq)
 				if err == nil {
 					defer trafficResp.Body.Close()
@@ -329,7 +331,7 @@ func syncSingleExternalSubscription(ctx context.Context, client *http.Client, re
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		logger.Info("[外部订阅同步] 读取响应内容失败", "error", err)
-		return 0, sub, fmt.Errorf("read response body: %w", err)
+		return nil, sub, fmt.Errorf("read response body: %w", err)
 	}
 
 	logger.Info("[外部订阅同步] 成功获取订阅内容", "size", len(body))
@@ -346,6 +348,20 @@ func syncSingleExternalSubscription(ctx context.Context, client *http.Client, re
 		}
 	}
 
+	// 如果没有 proxies，尝试 sing-box JSON 格式 (outbounds)
+	if len(proxies) == 0 && isSingboxJSON(body) {
+		logger.Info("[外部订阅同步] 尝试解析为 sing-box 格式", "name", sub.Name)
+		singboxProxies, err := ParseSingboxSubscription(body)
+		if err == nil {
+			for _, p := range singboxProxies {
+				proxies = append(proxies, p)
+			}
+			logger.Info("[外部订阅同步] 解析为 sing-box 格式成功", "name", sub.Name, "count", len(proxies))
+		} else {
+			logger.Info("[外部订阅同步] 解析 sing-box 格式失败", "name", sub.Name, "error", err)
+		}
+	}
+
 	// 如果 YAML 解析失败或没有 proxies，尝试 v2ray 格式 (base64 编码的 URI 列表)
 	if len(proxies) == 0 {
 		logger.Info("[外部订阅同步] 尝试解析为 v2ray 格式", "name", sub.Name)
@@ -361,11 +377,17 @@ func syncSingleExternalSubscription(ctx context.Context, client *http.Client, re
 
 	if len(proxies) == 0 {
 		logger.Info("[外部订阅同步] 订阅中未找到节点(proxies)数据")
-		return 0, sub, fmt.Errorf("no proxies found in subscription")
+		return nil, sub, fmt.Errorf("no proxies found in subscription")
 	}
 
 	logger.Info("[外部订阅同步] 解析到节点", "name", sub.Name, "count", len(proxies))
 
+	renameNode, err := newExternalNodeRenamer(sub)
+	if err != nil {
+		logger.Info("[外部订阅同步] 重命名规则无效，跳过重命名", "name", sub.Name, "error", err)
+		renameNode = func(name string) string { return name }
+	}
+
 	// Convert to storage.Node format
 	nodesToUpdate := make([]storage.Node, 0, len(proxies))
 
@@ -380,6 +402,12 @@ func syncSingleExternalSubscription(ctx context.Context, client *http.Client, re
 			continue
 		}
 
+		// 应用订阅的重命名规则，避免与手动添加的节点重名
+		if renamed := renameNode(proxyName); renamed != "" && renamed != proxyName {
+			proxyName = renamed
+			proxyMap["name"] = proxyName
+		}
+
 		// Marshal proxy to JSON for storage
 		clashConfigBytes, err := json.Marshal(proxyMap)
 		if err != nil {
@@ -404,6 +432,7 @@ func syncSingleExternalSubscription(ctx context.Context, client *http.Client, re
 			ClashConfig:  string(clashConfigBytes),
 			Enabled:      true,
 			Tag:          sub.Name, // Use external subscription name as tag
+			SourceURL:    sub.URL,
 		}
 
 		nodesToUpdate = append(nodesToUpdate, node)
@@ -411,11 +440,34 @@ func syncSingleExternalSubscription(ctx context.Context, client *http.Client, re
 
 	if len(nodesToUpdate) == 0 {
 		logger.Info("[外部订阅同步] 没有有效的节点可以同步")
-		return 0, sub, fmt.Errorf("no valid nodes to sync")
+		return nil, sub, fmt.Errorf("no valid nodes to sync")
+	}
+
+	return nodesToUpdate, sub, nil
+}
+
+// syncSingleExternalSubscription fetches and syncs nodes from a single external subscription
+// Returns: node count, updated subscription info, error
+func syncSingleExternalSubscription(ctx context.Context, client *http.Client, repo *storage.TrafficRepository, subscribeDir, username string, sub storage.ExternalSubscription, settings storage.UserSettings) (syncedCount int, _ storage.ExternalSubscription, err error) {
+	// 记录每次同步的结果，用于计算订阅来源的可靠性评分
+	defer func() {
+		recordExternalSubscriptionSyncRun(ctx, repo, username, sub, syncedCount, err)
+	}()
+
+	matchRule := settings.MatchRule
+	syncScope := settings.SyncScope
+	keepNodeName := settings.KeepNodeName
+
+	nodesToUpdate, sub, err := fetchExternalSubscriptionNodes(ctx, client, repo, username, sub, settings)
+	if err != nil {
+		return 0, sub, err
 	}
 
 	logger.Info("[外部订阅同步] 准备同步节点", "count", len(nodesToUpdate))
 
+	// 记录与上次同步相比的节点变化
+	recordExternalSubscriptionDiff(ctx, repo, username, sub, nodesToUpdate)
+
 	// Get existing nodes once
 	existingNodes, err := repo.ListNodes(ctx, username)
 	if err != nil {
@@ -425,8 +477,10 @@ func syncSingleExternalSubscription(ctx context.Context, client *http.Client, re
 
 	logger.Info("[外部订阅同步] 数据库中已有节点", "count", len(existingNodes))
 
+	// 按名称匹配时使用规范化后的名称（未启用时即精确匹配）
+	normalizer := loadNodeNameNormalizer(ctx, repo)
+
 	// Sync nodes to database (replace nodes based on match rule)
-	syncedCount := 0
 	updatedCount := 0
 	createdCount := 0
 	skippedCount := 0
@@ -494,7 +548,7 @@ func syncSingleExternalSubscription(ctx context.Context, client *http.Client, re
 		default:
 			// Default: match by node name
 			for i := range existingNodes {
-				if existingNodes[i].NodeName == node.NodeName {
+				if normalizer.Equal(existingNodes[i].NodeName, node.NodeName) {
 					existingNode = &existingNodes[i]
 					logger.Info("[外部订阅同步] 节点 按名称匹配成功", "node_name", node.NodeName)
 					break
@@ -552,7 +606,7 @@ func syncSingleExternalSubscription(ctx context.Context, client *http.Client, re
 
 			// Sync to YAML files (handle name change if needed)
 			if subscribeDir != "" {
-				if err := syncNodeToYAMLFiles(subscribeDir, oldNodeName, existingNode.NodeName, existingNode.ClashConfig); err != nil {
+				if err := syncNodeToYAMLFiles(subscribeDir, oldNodeName, existingNode.NodeName, existingNode.ClashOutput()); err != nil {
 					logger.Info("[外部订阅同步] 同步节点 到YAML文件失败", "node_name", existingNode.NodeName, "error", err)
 				}
 			}
@@ -589,6 +643,36 @@ func syncSingleExternalSubscription(ctx context.Context, client *http.Client, re
 	return syncedCount, sub, nil
 }
 
+// newExternalNodeRenamer 根据外部订阅的重命名规则构建节点名称转换函数
+// 先执行正则替换，再添加前缀和后缀
+func newExternalNodeRenamer(sub storage.ExternalSubscription) (func(string) string, error) {
+	var pattern *regexp.Regexp
+	if expr := strings.TrimSpace(sub.NameRegex); expr != "" {
+		compiled, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("compile name regex: %w", err)
+		}
+		pattern = compiled
+	}
+
+	prefix := sub.NamePrefix
+	suffix := sub.NameSuffix
+	replacement := sub.NameReplacement
+
+	return func(name string) string {
+		if pattern != nil {
+			name = pattern.ReplaceAllString(name, replacement)
+		}
+		if prefix != "" && !strings.HasPrefix(name, prefix) {
+			name = prefix + name
+		}
+		if suffix != "" && !strings.HasSuffix(name, suffix) {
+			name = name + suffix
+		}
+		return strings.TrimSpace(name)
+	}, nil
+}
+
 // ParseTrafficInfoHeader parses subscription-userinfo header and returns traffic info
 // Format: upload=0; download=685404160; total=1073741824; expire=1705276800
 // This function only parses the header, does not update database
@@ -619,9 +703,11 @@ func ParseTrafficInfoHeader(userInfo string) (upload, download, total int64, exp
 				total = v
 			}
 		case "expire":
-			if v, err := strconv.ParseInt(value, 10, 64); err == nil {
-				expireTime := time.Unix(v, 0)
+			// expire=0 或无法解析表示不过期，显式清空，避免沿用之前的到期时间
+			if expireTime, ok := parseExpireValue(value); ok {
 				expire = &expireTime
+			} else {
+				expire = nil
 			}
 		}
 	}
@@ -629,6 +715,52 @@ func ParseTrafficInfoHeader(userInfo string) (upload, download, total int64, exp
 	return
 }
 
+// expireLayouts 机场返回的非时间戳格式的过期时间
+var expireLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006/01/02 15:04:05",
+	"2006-01-02",
+	"2006/01/02",
+	"2006.01.02",
+}
+
+// parseExpireValue 解析 subscription-userinfo 中的 expire，统一转换为 UTC。
+// 支持 unix 秒（整数或小数，毫秒时间戳会自动识别）、ISO 8601 字符串以及 "2025-12-31" 这类日期；
+// 只有日期时视为当天结束（UTC 23:59:59）。0 或负数表示不过期，返回 false。
+func parseExpireValue(value string) (time.Time, bool) {
+	value = strings.Trim(strings.TrimSpace(value), `"'`)
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		if f <= 0 {
+			return time.Time{}, false
+		}
+		seconds := int64(f)
+		if seconds > 1e11 {
+			// 毫秒时间戳
+			return time.UnixMilli(seconds).UTC(), true
+		}
+		return time.Unix(seconds, 0).UTC(), true
+	}
+
+	for _, layout := range expireLayouts {
+		parsed, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+		if !strings.Contains(layout, "15") {
+			parsed = parsed.Add(24*time.Hour - time.Second)
+		}
+		return parsed.UTC(), true
+	}
+	return time.Time{}, false
+}
+
 // parseAndUpdateTrafficInfo parses subscription-userinfo header and updates traffic info
 // Format: upload=0; download=685404160; total=1073741824; expire=1705276800
 func parseAndUpdateTrafficInfo(ctx context.Context, repo *storage.TrafficRepository, sub *storage.ExternalSubscription, userInfo string) {
@@ -684,17 +816,13 @@ func parseAndUpdateTrafficInfo(ctx context.Context, repo *storage.TrafficReposit
 				logger.Info("[外部订阅同步] 解析总流量失败", "value", value, "error", err)
 			}
 		case "expire":
-			if v, err := strconv.ParseInt(value, 10, 64); err == nil {
-				expireTime := time.Unix(v, 0)
-				sub.Expire = &expireTime
-				logger.Info("[外部订阅同步] 解析过期时间", "expire", expireTime.Format("2006-01-02 15:04:05"))
-			} else if f, err := strconv.ParseFloat(value, 64); err == nil {
-				// 支持带小数点的值，取整
-				expireTime := time.Unix(int64(f), 0)
+			if expireTime, ok := parseExpireValue(value); ok {
 				sub.Expire = &expireTime
-				logger.Info("[外部订阅同步] 解析过期时间(浮点)", "expire", expireTime.Format("2006-01-02 15:04:05"))
+				logger.Info("[外部订阅同步] 解析过期时间", "raw", value, "expire", expireTime.Format(time.RFC3339))
 			} else {
-				logger.Info("[外部订阅同步] 解析过期时间失败", "value", value, "error", err)
+				// 机场改为不过期时清空旧的到期时间
+				sub.Expire = nil
+				logger.Info("[外部订阅同步] 解析过期时间失败或不过期", "value", value)
 			}
 		}
 	}
@@ -829,7 +957,7 @@ func (h *SyncSingleExternalSubscriptionHandler) ServeHTTP(w http.ResponseWriter,
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{
-			"error": fmt.Sprintf("同步失败: %v", err),
+			"error": logger.Redact(fmt.Sprintf("同步失败: %v", err)),
 		})
 		return
 	}
@@ -872,7 +1000,7 @@ func (h *SyncExternalSubscriptionsHandler) ServeHTTP(w http.ResponseWriter, r *h
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{
-			"error": fmt.Sprintf("同步失败: %v", err),
+			"error": logger.Redact(fmt.Sprintf("同步失败: %v", err)),
 		})
 		return
 	}
@@ -1332,6 +1460,7 @@ func updateYAMLFileWithProxyProviderNodes(subscribeDir, filename, providerName,
 	if err := os.WriteFile(filePath, []byte(result), 0644); err != nil {
 		return fmt.Errorf("write file: %w", err)
 	}
+	notifySubscribeFileChanged(filePath)
 
 	logger.Info("[代理集合同步] 文件 更新完成", "value", filename)
 	return nil
@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+type externalSubscriptionDiffResponse struct {
+	ID             int64                                    `json:"id"`
+	SubscriptionID int64                                    `json:"subscription_id"`
+	Added          []string                                 `json:"added"`
+	Removed        []string                                 `json:"removed"`
+	Changed        []storage.ExternalSubscriptionNodeChange `json:"changed"`
+	NodeCount      int                                      `json:"node_count"`
+	CreatedAt      string                                   `json:"created_at"`
+}
+
+// computeExternalSubscriptionDiff 对比上次同步的节点快照与本次获取的节点，得出新增、删除、变更的节点
+func computeExternalSubscriptionDiff(previous map[string]string, nodes []storage.Node) (added, removed []string, changed []storage.ExternalSubscriptionNodeChange, snapshot map[string]string) {
+	added = []string{}
+	removed = []string{}
+	changed = []storage.ExternalSubscriptionNodeChange{}
+	snapshot = make(map[string]string, len(nodes))
+
+	for _, node := range nodes {
+		snapshot[node.NodeName] = node.ClashConfig
+	}
+
+	for name, config := range snapshot {
+		prevConfig, ok := previous[name]
+		if !ok {
+			added = append(added, name)
+			continue
+		}
+		if fields := diffProxyConfigFields(prevConfig, config); len(fields) > 0 {
+			changed = append(changed, storage.ExternalSubscriptionNodeChange{Name: name, Fields: fields})
+		}
+	}
+
+	for name := range previous {
+		if _, ok := snapshot[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Slice(changed, func(i, j int) bool { return changed[i].Name < changed[j].Name })
+
+	return added, removed, changed, snapshot
+}
+
+// diffProxyConfigFields 返回两个节点配置中取值不同的顶层字段（忽略 name）
+func diffProxyConfigFields(before, after string) []string {
+	var beforeMap, afterMap map[string]any
+	if err := json.Unmarshal([]byte(before), &beforeMap); err != nil {
+		return []string{"config"}
+	}
+	if err := json.Unmarshal([]byte(after), &afterMap); err != nil {
+		return []string{"config"}
+	}
+
+	keys := make(map[string]struct{}, len(beforeMap)+len(afterMap))
+	for k := range beforeMap {
+		keys[k] = struct{}{}
+	}
+	for k := range afterMap {
+		keys[k] = struct{}{}
+	}
+
+	var fields []string
+	for k := range keys {
+		if k == "name" {
+			continue
+		}
+		if !reflect.DeepEqual(beforeMap[k], afterMap[k]) {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// recordExternalSubscriptionDiff 计算并保存本次同步相对于上次同步的节点差异
+func recordExternalSubscriptionDiff(ctx context.Context, repo *storage.TrafficRepository, username string, sub storage.ExternalSubscription, nodes []storage.Node) {
+	if repo == nil || sub.ID <= 0 {
+		return
+	}
+
+	previous := map[string]string{}
+	latest, err := repo.GetLatestExternalSubscriptionDiff(ctx, sub.ID, username)
+	if err == nil {
+		previous = latest.NodeSnapshot
+	} else if !errors.Is(err, storage.ErrExternalSubscriptionDiffNotFound) {
+		logger.Info("[外部订阅同步] 获取上次同步快照失败", "name", sub.Name, "error", err)
+		return
+	}
+
+	added, removed, changed, snapshot := computeExternalSubscriptionDiff(previous, nodes)
+
+	if _, err := repo.RecordExternalSubscriptionDiff(ctx, storage.ExternalSubscriptionDiff{
+		SubscriptionID: sub.ID,
+		Username:       username,
+		Added:          added,
+		Removed:        removed,
+		Changed:        changed,
+		NodeSnapshot:   snapshot,
+	}); err != nil {
+		logger.Info("[外部订阅同步] 保存同步差异失败", "name", sub.Name, "error", err)
+		return
+	}
+
+	logger.Info("[外部订阅同步] 同步差异", "name", sub.Name, "added", len(added), "removed", len(removed), "changed", len(changed))
+}
+
+// NewExternalSubscriptionDiffHandler serves GET /api/external-subscriptions/{id}/diff.
+// 默认返回最近一次同步的差异，?history=N 返回最近 N 次记录
+func NewExternalSubscriptionDiffHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("external subscription diff handler requires repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+
+		username := auth.UsernameFromContext(r.Context())
+		if strings.TrimSpace(username) == "" {
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+
+		path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/external-subscriptions/"), "/")
+		parts := strings.Split(path, "/")
+		if len(parts) != 2 || parts[1] != "diff" {
+			writeError(w, http.StatusNotFound, errors.New("not found"))
+			return
+		}
+
+		id, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || id <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("invalid subscription id"))
+			return
+		}
+
+		if _, err := repo.GetExternalSubscription(r.Context(), id, username); err != nil {
+			if errors.Is(err, storage.ErrExternalSubscriptionNotFound) {
+				writeError(w, http.StatusNotFound, errors.New("subscription not found"))
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		limit := 1
+		if raw := strings.TrimSpace(r.URL.Query().Get("history")); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed <= 0 {
+				writeBadRequest(w, "history 参数无效")
+				return
+			}
+			limit = parsed
+		}
+
+		diffs, err := repo.ListExternalSubscriptionDiffs(r.Context(), id, username, limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		history := make([]externalSubscriptionDiffResponse, 0, len(diffs))
+		for _, diff := range diffs {
+			history = append(history, externalSubscriptionDiffResponse{
+				ID:             diff.ID,
+				SubscriptionID: diff.SubscriptionID,
+				Added:          diff.Added,
+				Removed:        diff.Removed,
+				Changed:        diff.Changed,
+				NodeCount:      len(diff.NodeSnapshot),
+				CreatedAt:      diff.CreatedAt.Format(time.RFC3339),
+			})
+		}
+
+		var latest *externalSubscriptionDiffResponse
+		if len(history) > 0 {
+			latest = &history[0]
+		}
+
+		respondJSON(w, http.StatusOK, map[string]any{
+			"diff":    latest,
+			"history": history,
+		})
+	})
+}
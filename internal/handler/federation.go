@@ -0,0 +1,270 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+	"miaomiaowu/internal/version"
+)
+
+const (
+	// federationExportPath 主实例对从实例开放的导出接口
+	federationExportPath = "/api/federation/export"
+	// federationTokenHeader 从实例携带令牌的请求头，也可以使用 Authorization: Bearer
+	federationTokenHeader = "X-Federation-Token"
+	// federationExportVersion 导出数据格式版本，结构不兼容时递增
+	federationExportVersion = 1
+)
+
+// federationExport 主实例导出给从实例的节点池和订阅文件
+type federationExport struct {
+	Version         int              `json:"version"`
+	InstanceVersion string           `json:"instance_version"`
+	GeneratedAt     time.Time        `json:"generated_at"`
+	Nodes           []federationNode `json:"nodes"`
+	Files           []federationFile `json:"files"`
+}
+
+type federationNode struct {
+	UUID           string         `json:"uuid"`
+	NodeName       string         `json:"node_name"`
+	RawURL         string         `json:"raw_url"`
+	Protocol       string         `json:"protocol"`
+	ParsedConfig   string         `json:"parsed_config"`
+	ClashConfig    string         `json:"clash_config"`
+	Enabled        bool           `json:"enabled"`
+	Tag            string         `json:"tag"`
+	OriginalServer string         `json:"original_server"`
+	CustomFields   map[string]any `json:"custom_fields,omitempty"`
+}
+
+type federationFile struct {
+	UUID                string     `json:"uuid"`
+	Name                string     `json:"name"`
+	Description         string     `json:"description"`
+	URL                 string     `json:"url"`
+	Type                string     `json:"type"`
+	Filename            string     `json:"filename"`
+	AutoSyncCustomRules bool       `json:"auto_sync_custom_rules"`
+	ExpireAt            *time.Time `json:"expire_at,omitempty"`
+	CacheControl        string     `json:"cache_control"`
+	DefaultTarget       string     `json:"default_target"`
+	Content             string     `json:"content"`
+}
+
+// NewFederationExportHandler 从实例拉取主实例节点池和订阅文件的接口，使用管理员创建的同步令牌认证。
+// 响应带 ETag，内容未变化时返回 304。
+func NewFederationExportHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("federation export handler requires repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+
+		token := strings.TrimSpace(r.Header.Get(federationTokenHeader))
+		if token == "" {
+			token = strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		}
+		peer, err := repo.AuthenticateFederationPeer(r.Context(), token, getClientIP(r))
+		if err != nil {
+			if !errors.Is(err, storage.ErrFederationPeerNotFound) {
+				logger.Warn("[实例同步] 校验同步令牌失败", "error", err)
+			}
+			auth.WriteUnauthorizedResponse(w)
+			return
+		}
+
+		payload, err := buildFederationExport(r, repo, peer.Owner)
+		if err != nil {
+			logger.Error("[实例同步] 生成导出数据失败", "peer", peer.Name, "error", err)
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		// ETag 只取决于节点和文件内容，生成时间不参与计算
+		generatedAt := payload.GeneratedAt
+		payload.GeneratedAt = time.Time{}
+		stable, err := json.Marshal(payload)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		sum := sha256.Sum256(stable)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-store")
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		payload.GeneratedAt = generatedAt
+		logger.Info("[实例同步] 从实例拉取节点池", "peer", peer.Name, "ip", peer.LastSeenIP, "nodes", len(payload.Nodes), "files", len(payload.Files))
+		respondJSON(w, http.StatusOK, payload)
+	})
+}
+
+func buildFederationExport(r *http.Request, repo *storage.TrafficRepository, owner string) (federationExport, error) {
+	ctx := r.Context()
+	export := federationExport{
+		Version:         federationExportVersion,
+		InstanceVersion: version.Version,
+		GeneratedAt:     time.Now().UTC(),
+		Nodes:           []federationNode{},
+		Files:           []federationFile{},
+	}
+
+	nodes, err := repo.ListNodes(ctx, owner)
+	if err != nil {
+		return export, err
+	}
+	for _, node := range nodes {
+		export.Nodes = append(export.Nodes, federationNode{
+			UUID:           node.UUID,
+			NodeName:       node.NodeName,
+			RawURL:         node.RawURL,
+			Protocol:       node.Protocol,
+			ParsedConfig:   node.ParsedConfig,
+			ClashConfig:    node.ClashConfig,
+			Enabled:        node.Enabled,
+			Tag:            node.Tag,
+			OriginalServer: node.OriginalServer,
+			CustomFields:   node.CustomFields,
+		})
+	}
+
+	files, err := repo.ListSubscribeFiles(ctx)
+	if err != nil {
+		return export, err
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(filepath.Join("subscribes", file.Filename))
+		if err != nil {
+			logger.Warn("[实例同步] 读取订阅文件失败，跳过", "filename", file.Filename, "error", err)
+			continue
+		}
+		export.Files = append(export.Files, federationFile{
+			UUID:                file.UUID,
+			Name:                file.Name,
+			Description:         file.Description,
+			URL:                 file.URL,
+			Type:                file.Type,
+			Filename:            file.Filename,
+			AutoSyncCustomRules: file.AutoSyncCustomRules,
+			ExpireAt:            file.ExpireAt,
+			CacheControl:        file.CacheControl,
+			DefaultTarget:       file.DefaultTarget,
+			Content:             string(content),
+		})
+	}
+
+	return export, nil
+}
+
+type federationPeerDTO struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Owner      string     `json:"owner"`
+	TokenHint  string     `json:"token_hint"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	LastSeenIP string     `json:"last_seen_ip,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func convertFederationPeer(peer storage.FederationPeer) federationPeerDTO {
+	return federationPeerDTO{
+		ID:         peer.ID,
+		Name:       peer.Name,
+		Owner:      peer.Owner,
+		TokenHint:  peer.TokenHint,
+		LastSeenAt: peer.LastSeenAt,
+		LastSeenIP: peer.LastSeenIP,
+		CreatedAt:  peer.CreatedAt,
+	}
+}
+
+// NewFederationPeersHandler 管理允许拉取本实例的从实例：GET 列表，POST 创建（令牌只返回一次），DELETE /{id} 吊销
+func NewFederationPeersHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("federation peers handler requires repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idPart := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/federation/peers"), "/")
+
+		switch {
+		case idPart == "" && r.Method == http.MethodGet:
+			peers, err := repo.ListFederationPeers(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			items := make([]federationPeerDTO, 0, len(peers))
+			for _, peer := range peers {
+				items = append(items, convertFederationPeer(peer))
+			}
+			respondJSON(w, http.StatusOK, map[string]any{"peers": items})
+
+		case idPart == "" && r.Method == http.MethodPost:
+			var payload struct {
+				Name string `json:"name"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				writeBadRequest(w, "请求数据格式错误")
+				return
+			}
+			if strings.TrimSpace(payload.Name) == "" {
+				writeBadRequest(w, "从实例名称不能为空")
+				return
+			}
+			owner := auth.UsernameFromContext(r.Context())
+			peer, token, err := repo.CreateFederationPeer(r.Context(), payload.Name, owner)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			recordAudit(r.Context(), "federation.peer.create", peer.Name, "", "owner="+owner)
+			respondJSON(w, http.StatusCreated, map[string]any{
+				"peer":  convertFederationPeer(peer),
+				"token": token,
+			})
+
+		case idPart != "" && r.Method == http.MethodDelete:
+			id, err := strconv.ParseInt(idPart, 10, 64)
+			if err != nil || id <= 0 {
+				writeBadRequest(w, "从实例 ID 无效")
+				return
+			}
+			if err := repo.DeleteFederationPeer(r.Context(), id); err != nil {
+				if errors.Is(err, storage.ErrFederationPeerNotFound) {
+					writeError(w, http.StatusNotFound, err)
+					return
+				}
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			recordAudit(r.Context(), "federation.peer.delete", idPart, "", "")
+			respondJSON(w, http.StatusOK, map[string]any{"status": "deleted"})
+
+		case idPart == "":
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		default:
+			methodNotAllowed(w, http.MethodDelete)
+		}
+	})
+}
@@ -0,0 +1,546 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	// federationCheckInterval 检查是否到达拉取间隔的频率
+	federationCheckInterval = time.Minute
+	federationFetchTimeout  = 60 * time.Second
+	// federationMaxExportSize 主实例导出数据的大小上限
+	federationMaxExportSize = 64 << 20
+	maxFederationInterval   = 24 * 60
+)
+
+// federationSyncMu 保证定时同步和手动同步不会同时执行
+var federationSyncMu sync.Mutex
+
+// federationSyncReport 一次同步的变更统计
+type federationSyncReport struct {
+	NotModified  bool     `json:"not_modified"`
+	Nodes        int      `json:"nodes"` // 当前从上游镜像的节点数
+	Files        int      `json:"files"` // 当前从上游镜像的订阅文件数
+	NodesCreated int      `json:"nodes_created"`
+	NodesUpdated int      `json:"nodes_updated"`
+	NodesDeleted int      `json:"nodes_deleted"`
+	FilesCreated int      `json:"files_created"`
+	FilesUpdated int      `json:"files_updated"`
+	FilesDeleted int      `json:"files_deleted"`
+	Skipped      []string `json:"skipped,omitempty"`
+}
+
+// StartFederationSync 定时从主实例拉取节点池和订阅文件，未配置上游时只做空检查
+func StartFederationSync(ctx context.Context, repo *storage.TrafficRepository) {
+	if repo == nil {
+		panic("federation sync requires repository")
+	}
+
+	ticker := time.NewTicker(federationCheckInterval)
+	defer ticker.Stop()
+	for {
+		up, err := repo.GetFederationUpstream(ctx)
+		if err != nil {
+			logger.Warn("[实例同步] 读取上游配置失败", "error", err)
+		} else if up.Due(time.Now()) {
+			if IsAirGappedMode() {
+				logger.Debug("[实例同步] 离线模式下跳过拉取上游")
+			} else if report, err := syncFederationUpstream(ctx, repo, up); err != nil {
+				logger.Warn("[实例同步] 拉取上游失败", "upstream", up.URL, "error", err)
+			} else if !report.NotModified {
+				logger.Info("[实例同步] 已同步上游节点池", "upstream", up.URL,
+					"nodes_created", report.NodesCreated, "nodes_updated", report.NodesUpdated, "nodes_deleted", report.NodesDeleted,
+					"files_created", report.FilesCreated, "files_updated", report.FilesUpdated, "files_deleted", report.FilesDeleted)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// federationExportURL 将上游地址补全为导出接口地址，既可以填面板根地址也可以填完整接口地址
+func federationExportURL(base string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(base))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", errors.New("上游地址必须是 http(s) 地址")
+	}
+	if !strings.HasSuffix(parsed.Path, federationExportPath) {
+		parsed.Path = strings.TrimSuffix(parsed.Path, "/") + federationExportPath
+	}
+	return parsed.String(), nil
+}
+
+// syncFederationUpstream 拉取上游导出数据并镜像到本地，结果写回上游配置
+func syncFederationUpstream(ctx context.Context, repo *storage.TrafficRepository, up storage.FederationUpstream) (federationSyncReport, error) {
+	federationSyncMu.Lock()
+	defer federationSyncMu.Unlock()
+
+	report, etag, err := pullFederationUpstream(ctx, repo, up)
+	result := storage.FederationSyncResult{At: time.Now(), ETag: etag, Err: err}
+	if err == nil && report.NotModified {
+		result.Nodes, result.Files = up.LastNodes, up.LastFiles
+	} else if err == nil {
+		result.Nodes, result.Files = report.Nodes, report.Files
+	}
+	if recordErr := repo.RecordFederationSync(ctx, result); recordErr != nil {
+		logger.Warn("[实例同步] 记录同步结果失败", "error", recordErr)
+	}
+	return report, err
+}
+
+func pullFederationUpstream(ctx context.Context, repo *storage.TrafficRepository, up storage.FederationUpstream) (federationSyncReport, string, error) {
+	var report federationSyncReport
+
+	endpoint, err := federationExportURL(up.URL)
+	if err != nil {
+		return report, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return report, "", err
+	}
+	req.Header.Set(federationTokenHeader, up.Token)
+	req.Header.Set("Accept", "application/json")
+	if up.ETag != "" {
+		req.Header.Set("If-None-Match", up.ETag)
+	}
+
+	resp, err := importFetchClient(federationFetchTimeout, false).Do(req)
+	if err != nil {
+		return report, "", fmt.Errorf("请求上游失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		report.NotModified = true
+		return report, up.ETag, nil
+	case http.StatusUnauthorized:
+		return report, "", errors.New("上游拒绝了同步令牌")
+	default:
+		return report, "", fmt.Errorf("上游返回状态码 %d", resp.StatusCode)
+	}
+
+	var export federationExport
+	if err := json.NewDecoder(io.LimitReader(resp.Body, federationMaxExportSize)).Decode(&export); err != nil {
+		return report, "", fmt.Errorf("解析上游数据失败: %w", err)
+	}
+	if export.Version != federationExportVersion {
+		return report, "", fmt.Errorf("上游数据格式版本 %d 不受支持", export.Version)
+	}
+
+	if up.SyncNodes {
+		if err := applyFederationNodes(ctx, repo, up.Username, export.Nodes, &report); err != nil {
+			return report, "", err
+		}
+	}
+	if up.SyncFiles {
+		if err := applyFederationFiles(ctx, repo, export.Files, &report); err != nil {
+			return report, "", err
+		}
+	}
+	return report, resp.Header.Get("ETag"), nil
+}
+
+// applyFederationNodes 按 UUID 创建或更新上游节点，删除之前同步过但上游已不存在的节点。
+// 本地设置的探针绑定保持不变。
+func applyFederationNodes(ctx context.Context, repo *storage.TrafficRepository, username string, nodes []federationNode, report *federationSyncReport) error {
+	synced, err := repo.ListFederationSynced(ctx, storage.FederationKindNode)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]struct{}, len(nodes))
+	for _, remote := range nodes {
+		if remote.UUID == "" {
+			continue
+		}
+		seen[remote.UUID] = struct{}{}
+
+		id, err := repo.NodeIDByUUID(ctx, remote.UUID, username)
+		if err != nil && !errors.Is(err, storage.ErrNodeNotFound) {
+			return err
+		}
+
+		var local storage.Node
+		if id > 0 {
+			existing, err := repo.GetNode(ctx, id, username)
+			if err != nil {
+				return err
+			}
+			local = existing
+			local.RawURL = remote.RawURL
+			local.NodeName = remote.NodeName
+			local.Protocol = remote.Protocol
+			local.ParsedConfig = remote.ParsedConfig
+			local.ClashConfig = remote.ClashConfig
+			local.Enabled = remote.Enabled
+			local.Tag = remote.Tag
+			local.OriginalServer = remote.OriginalServer
+			if !nodeMatchesFederation(existing, local) || !reflect.DeepEqual(normalizeCustomFields(existing.CustomFields), normalizeCustomFields(remote.CustomFields)) {
+				if local, err = repo.UpdateNode(ctx, local); err != nil {
+					report.Skipped = append(report.Skipped, "node "+remote.NodeName+": "+err.Error())
+					continue
+				}
+				report.NodesUpdated++
+			}
+		} else {
+			local, err = repo.CreateNode(ctx, storage.Node{
+				UUID:           remote.UUID,
+				Username:       username,
+				RawURL:         remote.RawURL,
+				NodeName:       remote.NodeName,
+				Protocol:       remote.Protocol,
+				ParsedConfig:   remote.ParsedConfig,
+				ClashConfig:    remote.ClashConfig,
+				Enabled:        remote.Enabled,
+				Tag:            remote.Tag,
+				OriginalServer: remote.OriginalServer,
+			})
+			if err != nil {
+				report.Skipped = append(report.Skipped, "node "+remote.NodeName+": "+err.Error())
+				continue
+			}
+			report.NodesCreated++
+		}
+
+		if !reflect.DeepEqual(normalizeCustomFields(local.CustomFields), normalizeCustomFields(remote.CustomFields)) {
+			if _, err := repo.SetNodeCustomFields(ctx, local.ID, username, remote.CustomFields); err != nil {
+				report.Skipped = append(report.Skipped, "node "+remote.NodeName+" custom fields: "+err.Error())
+			}
+		}
+		if err := repo.MarkFederationSynced(ctx, storage.FederationKindNode, remote.UUID); err != nil {
+			return err
+		}
+		report.Nodes++
+	}
+
+	for uuid := range synced {
+		if _, ok := seen[uuid]; ok {
+			continue
+		}
+		id, err := repo.NodeIDByUUID(ctx, uuid, username)
+		if err == nil {
+			if err := repo.DeleteNode(ctx, id, username); err != nil && !errors.Is(err, storage.ErrNodeNotFound) {
+				return err
+			}
+			report.NodesDeleted++
+		} else if !errors.Is(err, storage.ErrNodeNotFound) {
+			return err
+		}
+		if err := repo.UnmarkFederationSynced(ctx, storage.FederationKindNode, uuid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func nodeMatchesFederation(a, b storage.Node) bool {
+	return a.RawURL == b.RawURL && a.NodeName == b.NodeName && a.Protocol == b.Protocol &&
+		a.ParsedConfig == b.ParsedConfig && a.ClashConfig == b.ClashConfig && a.Enabled == b.Enabled &&
+		a.Tag == b.Tag && a.OriginalServer == b.OriginalServer
+}
+
+// normalizeCustomFields 经 JSON 往返统一数值类型，nil 与空 map 视为相同
+func normalizeCustomFields(fields map[string]any) map[string]any {
+	if len(fields) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return fields
+	}
+	var normalized map[string]any
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return fields
+	}
+	return normalized
+}
+
+// applyFederationFiles 按 UUID 镜像订阅文件元数据和内容；本地已有同名但不是来自上游的文件不会被覆盖
+func applyFederationFiles(ctx context.Context, repo *storage.TrafficRepository, files []federationFile, report *federationSyncReport) error {
+	synced, err := repo.ListFederationSynced(ctx, storage.FederationKindFile)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll("subscribes", 0755); err != nil {
+		return fmt.Errorf("创建订阅目录失败: %w", err)
+	}
+
+	seen := make(map[string]struct{}, len(files))
+	for _, remote := range files {
+		if remote.UUID == "" {
+			continue
+		}
+		filename, ok := sanitizeRuleFilename(remote.Filename)
+		if !ok {
+			report.Skipped = append(report.Skipped, "file "+remote.Filename+": 文件名无效")
+			continue
+		}
+		seen[remote.UUID] = struct{}{}
+
+		id, err := repo.SubscribeFileIDByUUID(ctx, remote.UUID)
+		if err != nil && !errors.Is(err, storage.ErrSubscribeFileNotFound) {
+			return err
+		}
+
+		target := storage.SubscribeFile{
+			UUID:                remote.UUID,
+			Name:                remote.Name,
+			Description:         remote.Description,
+			URL:                 remote.URL,
+			Type:                remote.Type,
+			Filename:            filename,
+			AutoSyncCustomRules: remote.AutoSyncCustomRules,
+			ExpireAt:            remote.ExpireAt,
+			CacheControl:        remote.CacheControl,
+			DefaultTarget:       remote.DefaultTarget,
+		}
+
+		created := false
+		oldFilename := ""
+		if id > 0 {
+			existing, err := repo.GetSubscribeFileByID(ctx, id)
+			if err != nil {
+				return err
+			}
+			target.ID = existing.ID
+			oldFilename = existing.Filename
+		} else {
+			if other, err := repo.GetSubscribeFileByFilename(ctx, filename); err == nil && other.UUID != remote.UUID {
+				report.Skipped = append(report.Skipped, "file "+filename+": 本地已存在同名订阅文件")
+				continue
+			}
+			createdFile, err := repo.CreateSubscribeFile(ctx, target)
+			if err != nil {
+				report.Skipped = append(report.Skipped, "file "+filename+": "+err.Error())
+				continue
+			}
+			target.ID = createdFile.ID
+			created = true
+		}
+		if _, err := repo.UpdateSubscribeFile(ctx, target); err != nil {
+			report.Skipped = append(report.Skipped, "file "+filename+": "+err.Error())
+			continue
+		}
+
+		path := filepath.Join("subscribes", filename)
+		current, readErr := os.ReadFile(path)
+		contentChanged := readErr != nil || string(current) != remote.Content
+		if contentChanged {
+			if err := os.WriteFile(path, []byte(remote.Content), 0644); err != nil {
+				return fmt.Errorf("写入订阅文件失败: %w", err)
+			}
+			notifySubscribeFileChanged(path)
+		}
+		if oldFilename != "" && oldFilename != filename {
+			_ = os.Remove(filepath.Join("subscribes", oldFilename))
+			contentChanged = true
+		}
+
+		switch {
+		case created:
+			report.FilesCreated++
+		case contentChanged:
+			report.FilesUpdated++
+		}
+		if err := repo.MarkFederationSynced(ctx, storage.FederationKindFile, remote.UUID); err != nil {
+			return err
+		}
+		report.Files++
+	}
+
+	for uuid := range synced {
+		if _, ok := seen[uuid]; ok {
+			continue
+		}
+		id, err := repo.SubscribeFileIDByUUID(ctx, uuid)
+		if err == nil {
+			file, err := repo.GetSubscribeFileByID(ctx, id)
+			if err != nil {
+				return err
+			}
+			if err := repo.DeleteSubscribeFile(ctx, id); err != nil && !errors.Is(err, storage.ErrSubscribeFileNotFound) {
+				return err
+			}
+			_ = os.Remove(filepath.Join("subscribes", file.Filename))
+			report.FilesDeleted++
+		} else if !errors.Is(err, storage.ErrSubscribeFileNotFound) {
+			return err
+		}
+		if err := repo.UnmarkFederationSynced(ctx, storage.FederationKindFile, uuid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type federationUpstreamRequest struct {
+	URL             string `json:"url"`
+	Token           string `json:"token"`
+	IntervalMinutes int    `json:"interval_minutes"`
+	Enabled         bool   `json:"enabled"`
+	SyncNodes       bool   `json:"sync_nodes"`
+	SyncFiles       bool   `json:"sync_files"`
+}
+
+type federationUpstreamResponse struct {
+	URL             string     `json:"url"`
+	TokenSet        bool       `json:"token_set"`
+	Username        string     `json:"username"`
+	IntervalMinutes int        `json:"interval_minutes"`
+	Enabled         bool       `json:"enabled"`
+	SyncNodes       bool       `json:"sync_nodes"`
+	SyncFiles       bool       `json:"sync_files"`
+	LastSyncAt      *time.Time `json:"last_sync_at,omitempty"`
+	LastSuccessAt   *time.Time `json:"last_success_at,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+	LastNodes       int        `json:"last_nodes"`
+	LastFiles       int        `json:"last_files"`
+}
+
+func convertFederationUpstream(up storage.FederationUpstream) federationUpstreamResponse {
+	return federationUpstreamResponse{
+		URL:             up.URL,
+		TokenSet:        up.Token != "",
+		Username:        up.Username,
+		IntervalMinutes: up.IntervalMinutes,
+		Enabled:         up.Enabled,
+		SyncNodes:       up.SyncNodes,
+		SyncFiles:       up.SyncFiles,
+		LastSyncAt:      up.LastSyncAt,
+		LastSuccessAt:   up.LastSuccessAt,
+		LastError:       up.LastError,
+		LastNodes:       up.LastNodes,
+		LastFiles:       up.LastFiles,
+	}
+}
+
+// NewFederationUpstreamHandler 配置本实例镜像的主实例：GET 查看，PUT 保存（token 留空保持不变），
+// POST .../sync 立即同步。同步的节点归属于保存配置的管理员。
+func NewFederationUpstreamHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("federation upstream handler requires repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/federation/upstream"), "/")
+
+		switch {
+		case action == "" && r.Method == http.MethodGet:
+			up, err := repo.GetFederationUpstream(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			respondJSON(w, http.StatusOK, convertFederationUpstream(up))
+
+		case action == "" && r.Method == http.MethodPut:
+			var payload federationUpstreamRequest
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				writeBadRequest(w, "请求数据格式错误")
+				return
+			}
+			current, err := repo.GetFederationUpstream(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+
+			up := storage.FederationUpstream{
+				URL:             strings.TrimSpace(payload.URL),
+				Token:           strings.TrimSpace(payload.Token),
+				Username:        auth.UsernameFromContext(r.Context()),
+				IntervalMinutes: payload.IntervalMinutes,
+				Enabled:         payload.Enabled,
+				SyncNodes:       payload.SyncNodes,
+				SyncFiles:       payload.SyncFiles,
+			}
+			if up.Token == "" {
+				up.Token = current.Token
+			}
+			if up.IntervalMinutes == 0 {
+				up.IntervalMinutes = storage.DefaultFederationIntervalMinutes
+			}
+			if up.IntervalMinutes < 1 || up.IntervalMinutes > maxFederationInterval {
+				writeBadRequest(w, fmt.Sprintf("同步间隔必须在 1-%d 分钟之间", maxFederationInterval))
+				return
+			}
+			if up.Enabled {
+				if _, err := federationExportURL(up.URL); err != nil {
+					writeBadRequest(w, err.Error())
+					return
+				}
+				if up.Token == "" {
+					writeBadRequest(w, "同步令牌不能为空")
+					return
+				}
+			}
+
+			if err := repo.SaveFederationUpstream(r.Context(), up); err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			recordAudit(r.Context(), "federation.upstream.update", up.URL,
+				fmt.Sprintf("url=%s enabled=%t", current.URL, current.Enabled),
+				fmt.Sprintf("url=%s enabled=%t", up.URL, up.Enabled))
+
+			saved, err := repo.GetFederationUpstream(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			respondJSON(w, http.StatusOK, convertFederationUpstream(saved))
+
+		case action == "sync" && r.Method == http.MethodPost:
+			if rejectInAirGappedMode(w) {
+				return
+			}
+			up, err := repo.GetFederationUpstream(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if up.URL == "" || up.Token == "" {
+				writeBadRequest(w, "尚未配置上游实例")
+				return
+			}
+			report, err := syncFederationUpstream(r.Context(), repo, up)
+			if err != nil {
+				writeError(w, http.StatusBadGateway, err)
+				return
+			}
+			recordAudit(r.Context(), "federation.upstream.sync", up.URL, "",
+				fmt.Sprintf("nodes +%d ~%d -%d, files +%d ~%d -%d", report.NodesCreated, report.NodesUpdated, report.NodesDeleted, report.FilesCreated, report.FilesUpdated, report.FilesDeleted))
+			respondJSON(w, http.StatusOK, report)
+
+		case action == "":
+			methodNotAllowed(w, http.MethodGet, http.MethodPut)
+		case action == "sync":
+			methodNotAllowed(w, http.MethodPost)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
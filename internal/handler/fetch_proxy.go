@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+// fetchProxyDirect 外部订阅上设置该值时忽略全局代理，直接连接
+const fetchProxyDirect = "direct"
+
+// validateFetchProxyURL 校验出站代理地址，仅支持 http/https/socks5/socks5h
+func validateFetchProxyURL(raw string) error {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || strings.EqualFold(raw, fetchProxyDirect) {
+		return nil
+	}
+
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("代理地址格式错误: %w", err)
+	}
+
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return errors.New("代理地址仅支持 http、https、socks5、socks5h 协议")
+	}
+
+	if parsed.Host == "" {
+		return errors.New("代理地址缺少主机")
+	}
+
+	return nil
+}
+
+// newFetchHTTPClient 创建用于拉取订阅的 HTTP 客户端，proxyURL 为空或 direct 时直连
+func newFetchHTTPClient(timeout time.Duration, proxyURL string, skipCertVerify bool) (*http.Client, error) {
+	client := &http.Client{Timeout: timeout}
+
+	proxyURL = strings.TrimSpace(proxyURL)
+	useProxy := proxyURL != "" && !strings.EqualFold(proxyURL, fetchProxyDirect)
+	if !useProxy && !skipCertVerify {
+		return client, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if useProxy {
+		if err := validateFetchProxyURL(proxyURL); err != nil {
+			return nil, err
+		}
+		parsed, _ := url.Parse(proxyURL)
+		transport.Proxy = http.ProxyURL(parsed)
+	}
+	if skipCertVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	client.Transport = transport
+
+	return client, nil
+}
+
+// globalFetchProxy 全局出站代理地址，启动时及系统配置更新时写入
+var globalFetchProxy atomic.Value
+
+// SetGlobalFetchProxy updates the instance-wide outbound proxy used by subscription fetchers.
+func SetGlobalFetchProxy(proxyURL string) {
+	globalFetchProxy.Store(strings.TrimSpace(proxyURL))
+}
+
+// resolveFetchProxy 返回外部订阅实际使用的代理地址：订阅级设置优先，其次为全局设置
+func resolveFetchProxy(subscriptionProxy string) string {
+	if proxy := strings.TrimSpace(subscriptionProxy); proxy != "" {
+		if strings.EqualFold(proxy, fetchProxyDirect) {
+			return ""
+		}
+		return proxy
+	}
+
+	proxy, _ := globalFetchProxy.Load().(string)
+	return proxy
+}
+
+// importFetchClient 返回导入类请求（节点导入、订阅文件导入）使用的 HTTP 客户端，使用全局代理
+func importFetchClient(timeout time.Duration, skipCertVerify bool) *http.Client {
+	proxyURL := resolveFetchProxy("")
+	client, err := newFetchHTTPClient(timeout, proxyURL, skipCertVerify)
+	if err != nil {
+		logger.Info("[订阅代理] 代理配置无效，使用直连", "proxy", redactProxyURL(proxyURL), "error", err)
+		client, _ = newFetchHTTPClient(timeout, "", skipCertVerify)
+	}
+	return client
+}
+
+// fetchClientForProxy 根据代理设置返回客户端，代理无效时记录日志并回退到 fallback
+func fetchClientForProxy(proxyURL string, timeout time.Duration, fallback *http.Client) *http.Client {
+	if proxyURL == "" {
+		if fallback != nil {
+			return fallback
+		}
+		return &http.Client{Timeout: timeout}
+	}
+
+	client, err := newFetchHTTPClient(timeout, proxyURL, false)
+	if err != nil {
+		logger.Info("[订阅代理] 代理配置无效，使用直连", "proxy", redactProxyURL(proxyURL), "error", err)
+		if fallback != nil {
+			return fallback
+		}
+		return &http.Client{Timeout: timeout}
+	}
+	return client
+}
+
+// externalSubscriptionClient 返回拉取指定外部订阅时使用的 HTTP 客户端
+func externalSubscriptionClient(sub *storage.ExternalSubscription, timeout time.Duration, fallback *http.Client) *http.Client {
+	proxyURL := resolveFetchProxy(sub.FetchProxy)
+	if proxyURL != "" {
+		logger.Info("[订阅代理] 通过代理拉取订阅", "name", sub.Name, "proxy", redactProxyURL(proxyURL))
+	}
+	return fetchClientForProxy(proxyURL, timeout, fallback)
+}
+
+// redactProxyURL 隐藏代理地址中的认证信息，避免写入日志
+func redactProxyURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.User == nil {
+		return raw
+	}
+	return parsed.Redacted()
+}
@@ -0,0 +1,447 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	findReplacePrefix = "/api/admin/find-replace"
+	// maxFindReplacePreview 每个文件预览的最大变更行数
+	maxFindReplacePreview = 20
+)
+
+type findReplaceRequest struct {
+	Find    string   `json:"find"`
+	Replace string   `json:"replace"`
+	Regex   bool     `json:"regex"`
+	Files   []string `json:"files"` // 为空时处理全部订阅文件
+	DryRun  bool     `json:"dry_run"`
+}
+
+type findReplaceLine struct {
+	Line   int    `json:"line"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+type findReplaceFileResult struct {
+	Filename string            `json:"filename"`
+	Matches  int               `json:"matches"`
+	Status   string            `json:"status"` // "changed", "preview", "invalid", "error", "restored", "conflict", "skipped"
+	Error    string            `json:"error,omitempty"`
+	Preview  []findReplaceLine `json:"preview,omitempty"`
+}
+
+type bulkReplacementDTO struct {
+	ID           int64                         `json:"id"`
+	Find         string                        `json:"find"`
+	Replace      string                        `json:"replace"`
+	Regex        bool                          `json:"regex"`
+	Files        []storage.BulkReplacementFile `json:"files"`
+	CreatedBy    string                        `json:"created_by"`
+	CreatedAt    time.Time                     `json:"created_at"`
+	RolledBackAt *time.Time                    `json:"rolled_back_at,omitempty"`
+}
+
+func convertBulkReplacement(run storage.BulkReplacement) bulkReplacementDTO {
+	files := run.Files
+	if files == nil {
+		files = []storage.BulkReplacementFile{}
+	}
+	return bulkReplacementDTO{
+		ID:           run.ID,
+		Find:         run.Find,
+		Replace:      run.Replacement,
+		Regex:        run.Regex,
+		Files:        files,
+		CreatedBy:    run.CreatedBy,
+		CreatedAt:    run.CreatedAt,
+		RolledBackAt: run.RolledBackAt,
+	}
+}
+
+type findReplaceHandler struct {
+	repo         *storage.TrafficRepository
+	subscribeDir string
+}
+
+// NewFindReplaceHandler performs find-and-replace (literal or regex) across all subscription YAML files.
+// Runs can be previewed with dry_run, every changed file is versioned, and a run can be rolled back
+// via POST /api/admin/find-replace/{id}/rollback.
+func NewFindReplaceHandler(repo *storage.TrafficRepository, subscribeDir string) http.Handler {
+	if repo == nil {
+		panic("find replace handler requires repository")
+	}
+
+	return &findReplaceHandler{repo: repo, subscribeDir: subscribeDir}
+}
+
+func (h *findReplaceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, findReplacePrefix), "/")
+
+	switch {
+	case path == "" && r.Method == http.MethodGet:
+		h.handleList(w, r)
+	case path == "" && r.Method == http.MethodPost:
+		h.handleReplace(w, r)
+	case strings.HasSuffix(path, "/rollback") && r.Method == http.MethodPost:
+		h.handleRollback(w, r, strings.TrimSuffix(path, "/rollback"))
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (h *findReplaceHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	runs, err := h.repo.ListBulkReplacements(r.Context(), 50)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]bulkReplacementDTO, 0, len(runs))
+	for _, run := range runs {
+		items = append(items, convertBulkReplacement(run))
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"runs": items})
+}
+
+// findReplacer 字面量或正则替换
+type findReplacer struct {
+	find    string
+	replace string
+	re      *regexp.Regexp
+}
+
+func newFindReplacer(find, replace string, isRegex bool) (*findReplacer, error) {
+	if find == "" {
+		return nil, errors.New("查找内容不能为空")
+	}
+	replacer := &findReplacer{find: find, replace: replace}
+	if isRegex {
+		re, err := regexp.Compile(find)
+		if err != nil {
+			return nil, fmt.Errorf("正则表达式无效: %w", err)
+		}
+		replacer.re = re
+	}
+	return replacer, nil
+}
+
+func (f *findReplacer) count(content string) int {
+	if f.re != nil {
+		return len(f.re.FindAllStringIndex(content, -1))
+	}
+	return strings.Count(content, f.find)
+}
+
+func (f *findReplacer) apply(content string) string {
+	if f.re != nil {
+		return f.re.ReplaceAllString(content, f.replace)
+	}
+	return strings.ReplaceAll(content, f.find, f.replace)
+}
+
+// preview 列出发生变化的行（按行替换，跨行的正则匹配只体现在结果中）
+func (f *findReplacer) preview(content string) []findReplaceLine {
+	var lines []findReplaceLine
+	for i, line := range strings.Split(content, "\n") {
+		if f.count(line) == 0 {
+			continue
+		}
+		lines = append(lines, findReplaceLine{Line: i + 1, Before: line, After: f.apply(line)})
+		if len(lines) >= maxFindReplacePreview {
+			break
+		}
+	}
+	return lines
+}
+
+// targetFiles 返回要处理的订阅文件名，names 为空时为目录下全部 YAML 文件
+func (h *findReplaceHandler) targetFiles(names []string) ([]string, error) {
+	if len(names) > 0 {
+		files := make([]string, 0, len(names))
+		for _, name := range names {
+			name = strings.TrimSpace(name)
+			if name == "" || filepath.Base(name) != name || !isYAMLFile(name) {
+				return nil, fmt.Errorf("无效的文件名: %s", name)
+			}
+			files = append(files, name)
+		}
+		return files, nil
+	}
+
+	entries, err := os.ReadDir(h.subscribeDir)
+	if err != nil {
+		return nil, fmt.Errorf("读取订阅目录失败: %w", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || !isYAMLFile(entry.Name()) || entry.Name() == ".keep.yaml" {
+			continue
+		}
+		files = append(files, entry.Name())
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (h *findReplaceHandler) handleReplace(w http.ResponseWriter, r *http.Request) {
+	var req findReplaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBadRequest(w, "请求格式不正确")
+		return
+	}
+
+	replacer, err := newFindReplacer(req.Find, req.Replace, req.Regex)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	files, err := h.targetFiles(req.Files)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	type pendingFile struct {
+		filename string
+		before   string
+		after    string
+		matches  int
+	}
+
+	ctx := r.Context()
+	results := make([]findReplaceFileResult, 0, len(files))
+	var pending []pendingFile
+	totalMatches := 0
+	invalid := false
+	for _, filename := range files {
+		result := findReplaceFileResult{Filename: filename}
+		data, err := os.ReadFile(filepath.Join(h.subscribeDir, filename))
+		if err != nil {
+			result.Status = "error"
+			result.Error = "读取文件失败"
+			results = append(results, result)
+			continue
+		}
+
+		before := string(data)
+		result.Matches = replacer.count(before)
+		if result.Matches == 0 {
+			continue
+		}
+		after := replacer.apply(before)
+		result.Preview = replacer.preview(before)
+		result.Status = "preview"
+		totalMatches += result.Matches
+
+		// 替换后必须仍是有效的 YAML，否则整个操作不写入任何文件
+		var check map[string]any
+		if err := yaml.Unmarshal([]byte(after), &check); err != nil {
+			result.Status = "invalid"
+			result.Error = "替换后不是有效的YAML: " + err.Error()
+			invalid = true
+		} else if after != before {
+			pending = append(pending, pendingFile{filename: filename, before: before, after: after, matches: result.Matches})
+		}
+		results = append(results, result)
+	}
+
+	if req.DryRun || invalid {
+		status := http.StatusOK
+		if invalid && !req.DryRun {
+			status = http.StatusBadRequest
+		}
+		respondJSON(w, status, map[string]any{
+			"dry_run":       req.DryRun,
+			"applied":       false,
+			"total_matches": totalMatches,
+			"files":         results,
+		})
+		return
+	}
+
+	username := auth.UsernameFromContext(ctx)
+	createdBy := "admin"
+	if username != "" {
+		createdBy = username
+	}
+
+	run := storage.BulkReplacement{Find: req.Find, Replacement: req.Replace, Regex: req.Regex, CreatedBy: createdBy}
+	changed := make(map[string]struct{}, len(pending))
+	for _, file := range pending {
+		record, err := h.writeVersioned(ctx, file.filename, file.before, file.after, createdBy)
+		if err != nil {
+			logger.Warn("[批量替换] 写入文件失败", "filename", file.filename, "error", err)
+			setFindReplaceResult(results, file.filename, "error", err.Error())
+			continue
+		}
+		record.Matches = file.matches
+		run.Files = append(run.Files, record)
+		changed[file.filename] = struct{}{}
+		setFindReplaceResult(results, file.filename, "changed", "")
+	}
+
+	var runID int64
+	if len(run.Files) > 0 {
+		saved, err := h.repo.CreateBulkReplacement(ctx, run)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		runID = saved.ID
+	}
+
+	logger.Info("[批量替换] 替换完成", "find", req.Find, "regex", req.Regex, "files", len(changed), "matches", totalMatches)
+	respondJSON(w, http.StatusOK, map[string]any{
+		"id":            runID,
+		"dry_run":       false,
+		"applied":       len(changed) > 0,
+		"total_matches": totalMatches,
+		"files":         results,
+	})
+}
+
+func setFindReplaceResult(results []findReplaceFileResult, filename, status, message string) {
+	for i := range results {
+		if results[i].Filename == filename {
+			results[i].Status = status
+			results[i].Error = message
+			return
+		}
+	}
+}
+
+// writeVersioned 写入新内容并记录版本；写入前的内容与最新版本不同时先归档，保证可以回滚
+func (h *findReplaceHandler) writeVersioned(ctx context.Context, filename, before, after, createdBy string) (storage.BulkReplacementFile, error) {
+	record := storage.BulkReplacementFile{Filename: filename}
+
+	latest, err := h.repo.LatestRuleVersion(ctx, filename)
+	switch {
+	case err == nil && latest.Content == before:
+		record.BeforeVersion = latest.Version
+	case err == nil || errors.Is(err, storage.ErrRuleVersionNotFound):
+		if record.BeforeVersion, err = h.repo.SaveRuleVersion(ctx, filename, before, createdBy); err != nil {
+			return record, fmt.Errorf("保存原始版本失败: %w", err)
+		}
+	default:
+		return record, err
+	}
+
+	path := filepath.Join(h.subscribeDir, filename)
+	if err := os.WriteFile(path, []byte(after), 0644); err != nil {
+		return record, fmt.Errorf("保存文件失败: %w", err)
+	}
+	notifySubscribeFileChanged(path)
+
+	if record.AfterVersion, err = h.repo.SaveRuleVersion(ctx, filename, after, createdBy); err != nil {
+		return record, fmt.Errorf("保存版本记录失败: %w", err)
+	}
+	return record, nil
+}
+
+// handleRollback 将一次批量替换涉及的文件恢复为替换前的版本；替换后又被修改过的文件需要 force 才会覆盖
+func (h *findReplaceHandler) handleRollback(w http.ResponseWriter, r *http.Request, idSegment string) {
+	id, err := strconv.ParseInt(idSegment, 10, 64)
+	if err != nil || id <= 0 {
+		writeBadRequest(w, "无效的替换记录ID")
+		return
+	}
+	force := r.URL.Query().Get("force") == "true"
+
+	ctx := r.Context()
+	run, err := h.repo.GetBulkReplacement(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrBulkReplacementNotFound) {
+			writeError(w, http.StatusNotFound, errors.New("替换记录不存在"))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if run.RolledBackAt != nil {
+		writeError(w, http.StatusConflict, errors.New("该替换已回滚"))
+		return
+	}
+
+	createdBy := auth.UsernameFromContext(ctx)
+	if createdBy == "" {
+		createdBy = "admin"
+	}
+
+	results := make([]findReplaceFileResult, 0, len(run.Files))
+	conflicts := 0
+	for _, file := range run.Files {
+		result := findReplaceFileResult{Filename: file.Filename, Matches: file.Matches}
+		before, err := h.repo.GetRuleVersion(ctx, file.Filename, file.BeforeVersion)
+		if err != nil {
+			result.Status = "error"
+			result.Error = "找不到替换前的版本"
+			results = append(results, result)
+			continue
+		}
+
+		path := filepath.Join(h.subscribeDir, file.Filename)
+		current, err := os.ReadFile(path)
+		if err != nil {
+			result.Status = "skipped"
+			result.Error = "文件不存在"
+			results = append(results, result)
+			continue
+		}
+		if !force {
+			after, err := h.repo.GetRuleVersion(ctx, file.Filename, file.AfterVersion)
+			if err != nil || after.Content != string(current) {
+				result.Status = "conflict"
+				result.Error = "文件在替换后已被修改"
+				conflicts++
+				results = append(results, result)
+				continue
+			}
+		}
+
+		if err := os.WriteFile(path, []byte(before.Content), 0644); err != nil {
+			result.Status = "error"
+			result.Error = "保存文件失败"
+			results = append(results, result)
+			continue
+		}
+		notifySubscribeFileChanged(path)
+		if _, err := h.repo.SaveRuleVersion(ctx, file.Filename, before.Content, createdBy); err != nil {
+			logger.Warn("[批量替换] 保存回滚版本失败", "filename", file.Filename, "error", err)
+		}
+		result.Status = "restored"
+		results = append(results, result)
+	}
+
+	if conflicts == 0 {
+		if err := h.repo.MarkBulkReplacementRolledBack(ctx, id); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	logger.Info("[批量替换] 回滚完成", "id", id, "files", len(results), "conflicts", conflicts)
+	respondJSON(w, http.StatusOK, map[string]any{
+		"id":          id,
+		"rolled_back": conflicts == 0,
+		"files":       results,
+	})
+}
@@ -0,0 +1,539 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+// 地理数据库托管：面板按系统设置 geo_data_interval（小时）定时下载 GeoIP / GeoSite / MMDB 以及管理员添加的
+// .mrs 等文件，并通过 /api/geo/{name} 提供下载。开启后生成的配置中 geox-url 指向面板，客户端无需直连 GitHub
+const (
+	geoDataDir           = "data/geo"
+	geoDataPrefix        = "/api/geo/"
+	geoDataCheckInterval = 10 * time.Minute // 定时任务检查是否有文件到期的间隔
+	geoDataRetryInterval = time.Hour        // 从未下载成功的文件失败后的重试间隔
+	geoDataFetchTimeout  = 5 * time.Minute  // 下载单个文件的超时，geosite.dat 等文件较大
+)
+
+// geoDataNamePattern 限制文件名，防止路径穿越，也避免把任意文件类型挂到面板上
+var geoDataNamePattern = regexp.MustCompile(`(?i)^[a-z0-9][a-z0-9._-]{0,63}\.(dat|mmdb|mrs|metadb)$`)
+
+// geoDataLocks 同一文件同时只允许一个下载
+var geoDataLocks sync.Map // name -> *sync.Mutex
+
+func geoDataFilePath(name string) string {
+	return filepath.Join(geoDataDir, name)
+}
+
+// ensureBuiltinGeoData 登记 geox-url 使用的内置地理数据库，已存在的记录（包括管理员修改过的地址）保持不变
+func ensureBuiltinGeoData(ctx context.Context, repo *storage.TrafficRepository) error {
+	for _, geo := range bundleGeoFiles {
+		if err := repo.EnsureBuiltinGeoDataFile(ctx, geo.Filename, geo.DefaultURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateGeoDataFile 下载一个地理数据库。上游未变化时只记录检查时间；下载失败时保留旧文件并记录错误
+func updateGeoDataFile(ctx context.Context, repo *storage.TrafficRepository, name string) (storage.GeoDataFile, error) {
+	lock, _ := geoDataLocks.LoadOrStore(name, &sync.Mutex{})
+	mu := lock.(*sync.Mutex)
+	mu.Lock()
+	defer mu.Unlock()
+
+	file, err := repo.GetGeoDataFile(ctx, name)
+	if err != nil {
+		return storage.GeoDataFile{}, err
+	}
+	if IsAirGappedMode() {
+		return file, ErrAirGapped
+	}
+
+	mirrored, fetchErr := mirrorRemoteFile(ctx, file.URL, geoDataFilePath(name), file.ETag, file.LastModified, geoDataFetchTimeout)
+	if fetchErr != nil {
+		if err := repo.RecordGeoDataFetch(ctx, file, false, fetchErr.Error()); err != nil {
+			logger.Warn("[地理数据] 记录下载结果失败", "name", name, "error", err)
+		}
+		return file, fetchErr
+	}
+	if !mirrored.NotModified {
+		file.Size = mirrored.Size
+		file.SHA256 = mirrored.SHA256
+		file.ETag = mirrored.ETag
+		file.LastModified = mirrored.LastModified
+		logger.Info("[地理数据] 已更新", "name", name, "bytes", mirrored.Size)
+	}
+	if err := repo.RecordGeoDataFetch(ctx, file, !mirrored.NotModified, ""); err != nil {
+		logger.Warn("[地理数据] 记录下载结果失败", "name", name, "error", err)
+	}
+	return repo.GetGeoDataFile(ctx, name)
+}
+
+// geoDataDue 判断文件是否需要更新：超过更新间隔，或从未下载成功且距上次失败已超过重试间隔
+func geoDataDue(file storage.GeoDataFile, interval time.Duration, now time.Time) bool {
+	if !file.Enabled {
+		return false
+	}
+	if file.CheckedAt == nil {
+		return true
+	}
+	since := now.Sub(*file.CheckedAt)
+	if file.UpdatedAt == nil {
+		return since >= min(interval, geoDataRetryInterval)
+	}
+	return since >= interval
+}
+
+// StartGeoDataUpdater 定时更新面板托管的地理数据库，geo_data_interval 为 0 或离线模式下不下载
+func StartGeoDataUpdater(ctx context.Context, repo *storage.TrafficRepository) {
+	if repo == nil {
+		panic("geo data updater requires repository")
+	}
+	if err := ensureBuiltinGeoData(ctx, repo); err != nil {
+		logger.Warn("[地理数据] 登记内置地理数据库失败", "error", err)
+	}
+
+	ticker := time.NewTicker(geoDataCheckInterval)
+	defer ticker.Stop()
+	for {
+		if cfg, err := repo.GetSystemConfig(ctx); err != nil {
+			logger.Warn("[地理数据] 读取系统设置失败", "error", err)
+		} else if cfg.GeoDataInterval > 0 && !IsAirGappedMode() {
+			updateDueGeoData(ctx, repo, time.Duration(cfg.GeoDataInterval)*time.Hour)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func updateDueGeoData(ctx context.Context, repo *storage.TrafficRepository, interval time.Duration) {
+	files, err := repo.ListGeoDataFiles(ctx)
+	if err != nil {
+		logger.Warn("[地理数据] 读取文件列表失败", "error", err)
+		return
+	}
+	now := time.Now()
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return
+		}
+		if !geoDataDue(file, interval, now) {
+			continue
+		}
+		if _, err := updateGeoDataFile(ctx, repo, file.Name); err != nil {
+			logger.Warn("[地理数据] 下载失败", "name", file.Name, "url", file.URL, "error", err)
+		}
+	}
+}
+
+// rewriteGeoDataURLs 将配置中的 geox-url 以及与托管文件地址相同的规则集改为面板的 /api/geo/ 地址。
+// 只改写已启用且下载成功的文件，尚未下载的文件继续使用原地址
+func rewriteGeoDataURLs(ctx context.Context, repo *storage.TrafficRepository, doc *yaml.Node, baseURL string) {
+	if repo == nil || doc == nil || doc.Kind != yaml.MappingNode {
+		return
+	}
+	files, err := repo.ListGeoDataFiles(ctx)
+	if err != nil {
+		logger.Warn("[地理数据] 读取文件列表失败", "error", err)
+		return
+	}
+
+	geoBase := strings.TrimRight(baseURL, "/") + geoDataPrefix
+	served := make(map[string]string) // name -> 面板地址
+	byURL := make(map[string]string)  // 上游地址 -> 面板地址
+	for _, file := range files {
+		if !file.Enabled || file.UpdatedAt == nil {
+			continue
+		}
+		if _, err := os.Stat(geoDataFilePath(file.Name)); err != nil {
+			continue
+		}
+		served[file.Name] = geoBase + url.PathEscape(file.Name)
+		byURL[file.URL] = served[file.Name]
+	}
+	if len(served) == 0 {
+		return
+	}
+
+	if providers := mappingValue(doc, "rule-providers"); providers != nil && providers.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(providers.Content); i += 2 {
+			provider := providers.Content[i+1]
+			if provider.Kind != yaml.MappingNode || mappingScalar(provider, "type") != "http" {
+				continue
+			}
+			if local, ok := byURL[strings.TrimSpace(mappingScalar(provider, "url"))]; ok {
+				setMappingScalar(provider, "url", local)
+				deleteMappingKey(provider, "proxy")
+			}
+		}
+	}
+
+	geoxURL := mappingValue(doc, "geox-url")
+	if geoxURL == nil || geoxURL.Kind != yaml.MappingNode {
+		geoxURL = &yaml.Node{Kind: yaml.MappingNode}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "geox-url"}, geoxURL)
+	}
+	for _, geo := range bundleGeoFiles {
+		if local, ok := served[geo.Filename]; ok {
+			setMappingScalar(geoxURL, geo.Key, local)
+		}
+	}
+}
+
+type geoDataHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewGeoDataHandler serves the panel-hosted geo databases at /api/geo/{name}. A file that has not
+// been downloaded yet is fetched on first request unless the panel is air-gapped.
+func NewGeoDataHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("geo data handler requires repository")
+	}
+	return &geoDataHandler{repo: repo}
+}
+
+func (h *geoDataHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, http.MethodGet, http.MethodHead)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, geoDataPrefix)
+	if !geoDataNamePattern.MatchString(name) {
+		http.NotFound(w, r)
+		return
+	}
+	// 未开启托管（更新间隔为 0）时不对外提供
+	if cfg, err := h.repo.GetSystemConfig(r.Context()); err != nil || cfg.GeoDataInterval <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+	file, err := h.repo.GetGeoDataFile(r.Context(), name)
+	if err != nil || !file.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	filePath := geoDataFilePath(name)
+	if _, err := os.Stat(filePath); err != nil {
+		if IsAirGappedMode() {
+			writeError(w, http.StatusServiceUnavailable, ErrAirGapped)
+			return
+		}
+		// 客户端断开不应中断下载，下载结果会被后续请求复用
+		if file, err = updateGeoDataFile(context.WithoutCancel(r.Context()), h.repo, name); err != nil {
+			writeError(w, http.StatusBadGateway, fmt.Errorf("下载地理数据失败: %w", err))
+			return
+		}
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if file.SHA256 != "" {
+		w.Header().Set("ETag", `"`+file.SHA256[:16]+`"`)
+	}
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+type geoDataFileDTO struct {
+	Name      string     `json:"name"`
+	URL       string     `json:"url"`
+	ServedURL string     `json:"served_url"`
+	Builtin   bool       `json:"builtin"`
+	Enabled   bool       `json:"enabled"`
+	Cached    bool       `json:"cached"`
+	Size      int64      `json:"size"`
+	SHA256    string     `json:"sha256"`
+	UpdatedAt *time.Time `json:"updated_at"`
+	CheckedAt *time.Time `json:"checked_at"`
+	LastError string     `json:"last_error"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func convertGeoDataFile(f storage.GeoDataFile, baseURL string) geoDataFileDTO {
+	_, err := os.Stat(geoDataFilePath(f.Name))
+	return geoDataFileDTO{
+		Name:      f.Name,
+		URL:       f.URL,
+		ServedURL: strings.TrimRight(baseURL, "/") + geoDataPrefix + url.PathEscape(f.Name),
+		Builtin:   f.Builtin,
+		Enabled:   f.Enabled,
+		Cached:    err == nil,
+		Size:      f.Size,
+		SHA256:    f.SHA256,
+		UpdatedAt: f.UpdatedAt,
+		CheckedAt: f.CheckedAt,
+		LastError: f.LastError,
+		CreatedAt: f.CreatedAt,
+	}
+}
+
+type geoDataFileRequest struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	Enabled *bool  `json:"enabled"`
+}
+
+type geoDataAdminHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewGeoDataAdminHandler manages the panel-hosted geo databases: list (GET), add a custom file (POST),
+// change the source or enabled state (PUT /{name}), delete a custom file (DELETE /{name}) and update
+// now (POST /update for every enabled file, POST /{name}/update for one).
+func NewGeoDataAdminHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("geo data admin handler requires repository")
+	}
+	return &geoDataAdminHandler{repo: repo}
+}
+
+func (h *geoDataAdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := ensureBuiltinGeoData(r.Context(), h.repo); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/geo-data"), "/")
+	name, action, _ := strings.Cut(rest, "/")
+
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		h.handleList(w, r)
+	case name == "" && r.Method == http.MethodPost:
+		h.handleCreate(w, r)
+	case name == "":
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	case name == "update" && action == "" && r.Method == http.MethodPost:
+		h.handleUpdateAll(w, r)
+	case name == "update" && action == "":
+		methodNotAllowed(w, http.MethodPost)
+	case action == "" && r.Method == http.MethodPut:
+		h.handleModify(w, r, name)
+	case action == "" && r.Method == http.MethodDelete:
+		h.handleDelete(w, r, name)
+	case action == "update" && r.Method == http.MethodPost:
+		h.handleUpdate(w, r, name)
+	case action == "":
+		methodNotAllowed(w, http.MethodPut, http.MethodDelete)
+	case action == "update":
+		methodNotAllowed(w, http.MethodPost)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("接口不存在"))
+	}
+}
+
+func (h *geoDataAdminHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	files, err := h.repo.ListGeoDataFiles(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	baseURL := panelBaseURL(r)
+	items := make([]geoDataFileDTO, 0, len(files))
+	for _, f := range files {
+		items = append(items, convertGeoDataFile(f, baseURL))
+	}
+
+	interval := 0
+	if cfg, err := h.repo.GetSystemConfig(r.Context()); err == nil {
+		interval = cfg.GeoDataInterval
+	}
+	respondJSON(w, http.StatusOK, map[string]any{
+		"enabled":        interval > 0,
+		"interval_hours": interval,
+		"files":          items,
+	})
+}
+
+func decodeGeoDataFileRequest(r *http.Request) (geoDataFileRequest, error) {
+	var req geoDataFileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, errors.New("请求数据格式错误")
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.URL = strings.TrimSpace(req.URL)
+	if req.URL != "" {
+		parsed, err := url.Parse(req.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return req, errors.New("下载地址必须是 http 或 https 链接")
+		}
+	}
+	return req, nil
+}
+
+func (h *geoDataAdminHandler) handleCreate(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeGeoDataFileRequest(r)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	if !geoDataNamePattern.MatchString(req.Name) {
+		writeBadRequest(w, "文件名只能包含字母、数字、点、下划线和连字符，扩展名为 .dat、.mmdb、.mrs 或 .metadb")
+		return
+	}
+	if req.URL == "" {
+		writeBadRequest(w, "请提供下载地址")
+		return
+	}
+
+	file, err := h.repo.CreateGeoDataFile(r.Context(), req.Name, req.URL)
+	if err != nil {
+		if errors.Is(err, storage.ErrGeoDataFileExists) {
+			writeError(w, http.StatusConflict, errors.New("文件名已存在"))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if req.Enabled != nil && !*req.Enabled {
+		if file, err = h.repo.UpdateGeoDataFile(r.Context(), file.Name, file.URL, false); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	recordAudit(r.Context(), "geo_data.create", file.Name, "", file.URL)
+	respondJSON(w, http.StatusCreated, map[string]any{"file": convertGeoDataFile(file, panelBaseURL(r))})
+}
+
+func (h *geoDataAdminHandler) handleModify(w http.ResponseWriter, r *http.Request, name string) {
+	req, err := decodeGeoDataFileRequest(r)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	current, err := h.repo.GetGeoDataFile(r.Context(), name)
+	if err != nil {
+		writeGeoDataError(w, err)
+		return
+	}
+
+	source, enabled := current.URL, current.Enabled
+	if req.URL != "" {
+		source = req.URL
+	}
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	file, err := h.repo.UpdateGeoDataFile(r.Context(), name, source, enabled)
+	if err != nil {
+		writeGeoDataError(w, err)
+		return
+	}
+	recordAudit(r.Context(), "geo_data.update", name,
+		fmt.Sprintf("url=%s enabled=%t", current.URL, current.Enabled),
+		fmt.Sprintf("url=%s enabled=%t", file.URL, file.Enabled))
+	respondJSON(w, http.StatusOK, map[string]any{"file": convertGeoDataFile(file, panelBaseURL(r))})
+}
+
+func (h *geoDataAdminHandler) handleDelete(w http.ResponseWriter, r *http.Request, name string) {
+	current, err := h.repo.GetGeoDataFile(r.Context(), name)
+	if err != nil {
+		writeGeoDataError(w, err)
+		return
+	}
+	if err := h.repo.DeleteGeoDataFile(r.Context(), name); err != nil {
+		writeGeoDataError(w, err)
+		return
+	}
+	if err := os.Remove(geoDataFilePath(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Warn("[地理数据] 删除文件失败", "name", name, "error", err)
+	}
+	geoDataLocks.Delete(name)
+	recordAudit(r.Context(), "geo_data.delete", name, current.URL, "")
+	respondJSON(w, http.StatusOK, map[string]any{"deleted": name})
+}
+
+func (h *geoDataAdminHandler) handleUpdate(w http.ResponseWriter, r *http.Request, name string) {
+	if rejectInAirGappedMode(w) {
+		return
+	}
+	file, err := updateGeoDataFile(r.Context(), h.repo, name)
+	if err != nil {
+		if errors.Is(err, storage.ErrGeoDataFileNotFound) {
+			writeGeoDataError(w, err)
+			return
+		}
+		writeError(w, http.StatusBadGateway, fmt.Errorf("下载地理数据失败: %w", err))
+		return
+	}
+	recordAudit(r.Context(), "geo_data.refresh", name, "", file.URL)
+	respondJSON(w, http.StatusOK, map[string]any{"file": convertGeoDataFile(file, panelBaseURL(r))})
+}
+
+func (h *geoDataAdminHandler) handleUpdateAll(w http.ResponseWriter, r *http.Request) {
+	if rejectInAirGappedMode(w) {
+		return
+	}
+	files, err := h.repo.ListGeoDataFiles(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// 单个文件失败不影响其他文件，失败原因由 last_error 体现
+	baseURL := panelBaseURL(r)
+	items := make([]geoDataFileDTO, 0, len(files))
+	updated, failed := 0, []string{}
+	for _, f := range files {
+		if f.Enabled {
+			if latest, err := updateGeoDataFile(r.Context(), h.repo, f.Name); err != nil {
+				failed = append(failed, f.Name)
+				if latest, err := h.repo.GetGeoDataFile(r.Context(), f.Name); err == nil {
+					f = latest
+				}
+			} else {
+				updated++
+				f = latest
+			}
+		}
+		items = append(items, convertGeoDataFile(f, baseURL))
+	}
+	recordAudit(r.Context(), "geo_data.refresh", "*", "", fmt.Sprintf("updated=%d failed=%d", updated, len(failed)))
+	respondJSON(w, http.StatusOK, map[string]any{
+		"files":   items,
+		"updated": updated,
+		"failed":  failed,
+	})
+}
+
+func writeGeoDataError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrGeoDataFileNotFound):
+		writeError(w, http.StatusNotFound, errors.New("地理数据文件不存在"))
+	case errors.Is(err, storage.ErrGeoDataFileBuiltin):
+		writeError(w, http.StatusBadRequest, errors.New("内置地理数据库不能删除，可以停用"))
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
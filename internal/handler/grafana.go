@@ -0,0 +1,493 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+// Grafana JSON 数据源（grafana-json-datasource / simpod-json-datasource）支持的指标
+const (
+	grafanaMetricTrafficUsed       = "traffic_used"
+	grafanaMetricTrafficLimit      = "traffic_limit"
+	grafanaMetricTrafficRemaining  = "traffic_remaining"
+	grafanaMetricServerTraffic     = "probe_server_traffic"
+	grafanaMetricNodeAvailability  = "node_availability"
+	grafanaMetricSubscriptionPulls = "subscription_pulls"
+	grafanaDefaultMaxDataPoints    = 1000
+	grafanaMaxQueryRange           = 400 * 24 * time.Hour
+	subscriptionPullRetention      = 400 * 24 * time.Hour // 拉取次数保留时长，与最大查询范围一致
+)
+
+// grafanaPullGroupings subscription_pulls 可选的分组维度
+var grafanaPullGroupings = []string{"user", "filename", "client_type"}
+
+type grafanaMetric struct {
+	Label    string                 `json:"label"`
+	Value    string                 `json:"value"`
+	Payloads []grafanaMetricPayload `json:"payloads,omitempty"`
+}
+
+type grafanaMetricPayload struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Type  string `json:"type"` // select 或 input
+}
+
+type grafanaOption struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+type grafanaQueryRequest struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	IntervalMs    int64 `json:"intervalMs"`
+	MaxDataPoints int   `json:"maxDataPoints"`
+	Targets       []struct {
+		Target  string         `json:"target"`
+		RefID   string         `json:"refId"`
+		Hide    bool           `json:"hide"`
+		Payload map[string]any `json:"payload"`
+		Data    map[string]any `json:"data"` // 旧版 simple-json 数据源的附加参数
+	} `json:"targets"`
+}
+
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	RefID      string       `json:"refId,omitempty"`
+	Datapoints [][2]float64 `json:"datapoints"` // [value, unix 毫秒]
+}
+
+type grafanaDatasourceHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewGrafanaDatasourceHandler serves a grafana-json-datasource compatible API under /api/grafana for
+// traffic history, node availability (derived from probe alert history) and subscription pulls.
+// Requests are authenticated with the Grafana token in system config, sent as a bearer token, as
+// the basic auth password or as ?token=.
+func NewGrafanaDatasourceHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("grafana datasource handler requires repository")
+	}
+
+	return &grafanaDatasourceHandler{repo: repo}
+}
+
+func (h *grafanaDatasourceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cfg, err := h.repo.GetSystemConfig(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if cfg.GrafanaToken == "" {
+		writeError(w, http.StatusNotFound, errors.New("未启用 Grafana 数据源"))
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(grafanaRequestToken(r)), []byte(cfg.GrafanaToken)) != 1 {
+		writeError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/grafana"), "/")
+	switch path {
+	case "":
+		// 数据源的“保存并测试”只检查根路径是否返回 200
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	case "/search":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		names := make([]string, 0, len(grafanaMetrics()))
+		for _, metric := range grafanaMetrics() {
+			names = append(names, metric.Value)
+		}
+		respondJSON(w, http.StatusOK, names)
+	case "/metrics":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		respondJSON(w, http.StatusOK, grafanaMetrics())
+	case "/metric-payload-options":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		h.handlePayloadOptions(w, r)
+	case "/query":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		h.handleQuery(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func grafanaRequestToken(r *http.Request) string {
+	if header := strings.TrimSpace(r.Header.Get("Authorization")); header != "" {
+		if scheme, token, ok := strings.Cut(header, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	return strings.TrimSpace(r.URL.Query().Get("token"))
+}
+
+func grafanaMetrics() []grafanaMetric {
+	serverPayload := []grafanaMetricPayload{{Name: "server", Label: "探针服务器", Type: "select"}}
+	return []grafanaMetric{
+		{Label: "总已用流量（字节/天）", Value: grafanaMetricTrafficUsed},
+		{Label: "总流量额度（字节/天）", Value: grafanaMetricTrafficLimit},
+		{Label: "总剩余流量（字节/天）", Value: grafanaMetricTrafficRemaining},
+		{Label: "探针服务器已用流量（字节/天）", Value: grafanaMetricServerTraffic, Payloads: serverPayload},
+		{Label: "节点可用率（%）", Value: grafanaMetricNodeAvailability, Payloads: serverPayload},
+		{Label: "订阅拉取次数", Value: grafanaMetricSubscriptionPulls, Payloads: []grafanaMetricPayload{
+			{Name: "group_by", Label: "分组", Type: "select"},
+			{Name: "user", Label: "用户", Type: "input"},
+		}},
+	}
+}
+
+func (h *grafanaDatasourceHandler) handlePayloadOptions(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Metric string `json:"metric"`
+		Name   string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	options := []grafanaOption{}
+	switch payload.Name {
+	case "server":
+		names, err := h.probeServerNames(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		for _, name := range names {
+			options = append(options, grafanaOption{Label: name, Value: name})
+		}
+	case "group_by":
+		for _, group := range grafanaPullGroupings {
+			options = append(options, grafanaOption{Label: group, Value: group})
+		}
+	}
+	respondJSON(w, http.StatusOK, options)
+}
+
+func (h *grafanaDatasourceHandler) handleQuery(w http.ResponseWriter, r *http.Request) {
+	var payload grafanaQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+	from, to := payload.Range.From, payload.Range.To
+	if from.IsZero() || to.IsZero() || !to.After(from) {
+		writeBadRequest(w, "range.from 和 range.to 无效")
+		return
+	}
+	if to.Sub(from) > grafanaMaxQueryRange {
+		from = to.Add(-grafanaMaxQueryRange)
+	}
+	maxPoints := payload.MaxDataPoints
+	if maxPoints <= 0 {
+		maxPoints = grafanaDefaultMaxDataPoints
+	}
+	interval := time.Duration(payload.IntervalMs) * time.Millisecond
+
+	result := []grafanaSeries{}
+	for _, target := range payload.Targets {
+		if target.Hide || target.Target == "" {
+			continue
+		}
+		options := target.Payload
+		if options == nil {
+			options = target.Data
+		}
+
+		var series []grafanaSeries
+		var err error
+		switch target.Target {
+		case grafanaMetricTrafficUsed, grafanaMetricTrafficLimit, grafanaMetricTrafficRemaining:
+			series, err = h.queryTraffic(r.Context(), target.Target, from, to)
+		case grafanaMetricServerTraffic:
+			series, err = h.queryServerTraffic(r.Context(), from, to, grafanaPayloadString(options, "server"))
+		case grafanaMetricNodeAvailability:
+			step := grafanaStep(from, to, interval, maxPoints, time.Minute)
+			series, err = h.queryAvailability(r.Context(), from, to, step, grafanaPayloadString(options, "server"))
+		case grafanaMetricSubscriptionPulls:
+			step := grafanaStep(from, to, interval, maxPoints, time.Hour)
+			series, err = h.queryPulls(r.Context(), from, to, step, grafanaPayloadString(options, "group_by"), grafanaPayloadString(options, "user"))
+		default:
+			writeBadRequest(w, fmt.Sprintf("未知指标: %s", target.Target))
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		for i := range series {
+			series[i].RefID = target.RefID
+		}
+		result = append(result, series...)
+	}
+	respondJSON(w, http.StatusOK, result)
+}
+
+func grafanaPayloadString(payload map[string]any, key string) string {
+	if value, ok := payload[key].(string); ok {
+		return strings.TrimSpace(value)
+	}
+	return ""
+}
+
+// grafanaStep 按面板的 interval 计算分桶宽度，不小于 unit 且为 unit 的整数倍，桶数量不超过 maxPoints
+func grafanaStep(from, to time.Time, interval time.Duration, maxPoints int, unit time.Duration) time.Duration {
+	step := max(interval, unit)
+	if span := to.Sub(from); span/step > time.Duration(maxPoints) {
+		step = span / time.Duration(maxPoints)
+	}
+	return (step + unit - 1) / unit * unit
+}
+
+func grafanaTimestamp(t time.Time) float64 {
+	return float64(t.UnixMilli())
+}
+
+func (h *grafanaDatasourceHandler) queryTraffic(ctx context.Context, metric string, from, to time.Time) ([]grafanaSeries, error) {
+	records, err := h.repo.ListTrafficRecordsBetween(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	series := grafanaSeries{Target: metric, Datapoints: make([][2]float64, 0, len(records))}
+	for _, record := range records {
+		value := record.TotalUsed
+		switch metric {
+		case grafanaMetricTrafficLimit:
+			value = record.TotalLimit
+		case grafanaMetricTrafficRemaining:
+			value = record.TotalRemaining
+		}
+		series.Datapoints = append(series.Datapoints, [2]float64{float64(value), grafanaTimestamp(record.Date)})
+	}
+	return []grafanaSeries{series}, nil
+}
+
+func (h *grafanaDatasourceHandler) queryServerTraffic(ctx context.Context, from, to time.Time, server string) ([]grafanaSeries, error) {
+	configs, err := h.repo.ListProbeConfigs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string)
+	for _, cfg := range configs {
+		for _, srv := range cfg.Servers {
+			names[collectionServerKey(cfg.ID, srv.ServerID)] = srv.Name
+		}
+	}
+
+	records, err := h.repo.ListProbeServerDailyBetween(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*grafanaSeries)
+	var order []string
+	for _, record := range records {
+		name, ok := names[collectionServerKey(record.ConfigID, record.ServerID)]
+		if !ok {
+			name = record.ServerID
+		}
+		if server != "" && name != server {
+			continue
+		}
+		series, ok := byName[name]
+		if !ok {
+			series = &grafanaSeries{Target: name, Datapoints: [][2]float64{}}
+			byName[name] = series
+			order = append(order, name)
+		}
+		series.Datapoints = append(series.Datapoints, [2]float64{float64(record.UsedBytes), grafanaTimestamp(record.Date)})
+	}
+
+	sort.Strings(order)
+	result := make([]grafanaSeries, 0, len(order))
+	for _, name := range order {
+		result = append(result, *byName[name])
+	}
+	return result, nil
+}
+
+// queryAvailability 根据探针告警历史计算每个分桶内的在线时间占比
+func (h *grafanaDatasourceHandler) queryAvailability(ctx context.Context, from, to time.Time, step time.Duration, server string) ([]grafanaSeries, error) {
+	names, err := h.probeServerNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	outages, err := h.repo.ListProbeOutages(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	byServer := make(map[string][]storage.ProbeOutage)
+	for _, outage := range outages {
+		if !slices.Contains(names, outage.ServerName) {
+			names = append(names, outage.ServerName)
+		}
+		byServer[outage.ServerName] = append(byServer[outage.ServerName], outage)
+	}
+	sort.Strings(names)
+
+	result := []grafanaSeries{}
+	for _, name := range names {
+		if server != "" && name != server {
+			continue
+		}
+		series := grafanaSeries{Target: name, Datapoints: [][2]float64{}}
+		for start := from.Truncate(step); start.Before(to) && start.Before(now); start = start.Add(step) {
+			end := start.Add(step)
+			if end.After(now) {
+				end = now
+			}
+			var down time.Duration
+			for _, outage := range byServer[name] {
+				outageEnd := now
+				if outage.ResolvedAt != nil {
+					outageEnd = *outage.ResolvedAt
+				}
+				overlapStart, overlapEnd := outage.StartedAt, outageEnd
+				if overlapStart.Before(start) {
+					overlapStart = start
+				}
+				if overlapEnd.After(end) {
+					overlapEnd = end
+				}
+				if overlapEnd.After(overlapStart) {
+					down += overlapEnd.Sub(overlapStart)
+				}
+			}
+			availability := 100.0
+			if span := end.Sub(start); span > 0 {
+				availability = 100 * (1 - float64(down)/float64(span))
+			}
+			series.Datapoints = append(series.Datapoints, [2]float64{availability, grafanaTimestamp(start)})
+		}
+		result = append(result, series)
+	}
+	return result, nil
+}
+
+func (h *grafanaDatasourceHandler) queryPulls(ctx context.Context, from, to time.Time, step time.Duration, groupBy, user string) ([]grafanaSeries, error) {
+	pulls, err := h.repo.ListSubscriptionPulls(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make(map[string]map[int64]int64)
+	for _, pull := range pulls {
+		if user != "" && pull.Username != user {
+			continue
+		}
+		key := grafanaMetricSubscriptionPulls
+		switch groupBy {
+		case "user":
+			key = pull.Username
+		case "filename":
+			key = pull.Filename
+		case "client_type":
+			key = pull.ClientType
+			if key == "" {
+				key = "clash"
+			}
+		}
+		if buckets[key] == nil {
+			buckets[key] = make(map[int64]int64)
+		}
+		buckets[key][pull.Hour.Truncate(step).UnixMilli()] += pull.Count
+	}
+	if len(buckets) == 0 {
+		buckets[grafanaMetricSubscriptionPulls] = map[int64]int64{}
+	}
+
+	keys := make([]string, 0, len(buckets))
+	for key := range buckets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]grafanaSeries, 0, len(keys))
+	for _, key := range keys {
+		series := grafanaSeries{Target: key, Datapoints: [][2]float64{}}
+		for start := from.Truncate(step); start.Before(to); start = start.Add(step) {
+			series.Datapoints = append(series.Datapoints, [2]float64{float64(buckets[key][start.UnixMilli()]), grafanaTimestamp(start)})
+		}
+		result = append(result, series)
+	}
+	return result, nil
+}
+
+func (h *grafanaDatasourceHandler) probeServerNames(ctx context.Context) ([]string, error) {
+	configs, err := h.repo.ListProbeConfigs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, cfg := range configs {
+		for _, srv := range cfg.Servers {
+			if name := strings.TrimSpace(srv.Name); name != "" && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// recordSubscriptionPull 统计一次订阅拉取，供 Grafana 数据源使用，失败只记录日志不影响下发
+func recordSubscriptionPull(ctx context.Context, repo *storage.TrafficRepository, username, filename, clientType string) {
+	if repo == nil || username == "" || filename == "" {
+		return
+	}
+	if err := repo.RecordSubscriptionPull(ctx, username, filename, clientType, time.Now()); err != nil {
+		logger.Warn("[订阅统计] 记录订阅拉取失败", "user", username, "filename", filename, "error", err)
+	}
+}
+
+// PruneSubscriptionPulls 删除超过保留时长的订阅拉取统计
+func PruneSubscriptionPulls(ctx context.Context, repo *storage.TrafficRepository) error {
+	if repo == nil {
+		return nil
+	}
+	removed, err := repo.PruneSubscriptionPulls(ctx, time.Now().Add(-subscriptionPullRetention))
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		logger.Info("[订阅统计] 已清理过期的订阅拉取统计", "rows", removed)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"miaomiaowu/internal/storage"
+)
+
+type healthResponse struct {
+	Status    string                    `json:"status"` // ok、starting、migrating、failed
+	Migration storage.MigrationProgress `json:"migration"`
+}
+
+// NewHealthHandler reports whether the server is up. While the startup schema migration is running
+// (or waiting for another instance's migration lock) it answers 200 with status "migrating" so
+// container health checks don't kill a slow but healthy start; only a failed migration returns 503.
+func NewHealthHandler() http.Handler {
+	return newHealthHandler(nil)
+}
+
+// newHealthHandler reports "starting" after the migration while started returns false.
+func newHealthHandler(started func() bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			methodNotAllowed(w, http.MethodGet, http.MethodHead)
+			return
+		}
+
+		progress := storage.CurrentMigrationProgress()
+		resp := healthResponse{Status: "ok", Migration: progress}
+		status := http.StatusOK
+		switch progress.State {
+		case storage.MigrationStatePending:
+			resp.Status = "starting"
+		case storage.MigrationStateWaiting, storage.MigrationStateRunning:
+			resp.Status = "migrating"
+		case storage.MigrationStateFailed:
+			resp.Status = "failed"
+			status = http.StatusServiceUnavailable
+		default:
+			if started != nil && !started() {
+				resp.Status = "starting"
+			}
+		}
+		respondJSON(w, status, resp)
+	})
+}
+
+// StartupGate serves /api/health while the server is still starting and answers 503 to every other
+// request until Ready hands it the real handler. It lets the HTTP listener come up before the
+// database migration finishes.
+type StartupGate struct {
+	ready  atomic.Pointer[http.Handler]
+	health http.Handler
+}
+
+// NewStartupGate creates a gate that only serves the health endpoint.
+func NewStartupGate() *StartupGate {
+	g := &StartupGate{}
+	g.health = newHealthHandler(func() bool { return g.ready.Load() != nil })
+	return g
+}
+
+// Ready routes all further requests to next.
+func (g *StartupGate) Ready(next http.Handler) {
+	g.ready.Store(&next)
+}
+
+func (g *StartupGate) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if next := g.ready.Load(); next != nil {
+		(*next).ServeHTTP(w, r)
+		return
+	}
+	if strings.TrimSuffix(r.URL.Path, "/") == "/api/health" {
+		g.health.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Retry-After", "5")
+	writeError(w, http.StatusServiceUnavailable, errors.New("服务正在启动（数据库迁移中），请稍后重试"))
+}
@@ -0,0 +1,331 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	// maxInvitationUses 单个邀请码允许的最大注册次数
+	maxInvitationUses = 1000
+	// minRegisterPasswordLength 自助注册的最短密码长度，与修改密码一致
+	minRegisterPasswordLength = 8
+)
+
+// registerUsernamePattern 自助注册的用户名只允许字母、数字和 _ . -
+var registerUsernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,32}$`)
+
+type invitationRequest struct {
+	Code            string     `json:"code"`
+	Role            string     `json:"role"`
+	SubscriptionIDs []int64    `json:"subscription_ids"`
+	MaxUses         int        `json:"max_uses"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+	Note            string     `json:"note"`
+}
+
+type invitationResponse struct {
+	ID              int64      `json:"id"`
+	Code            string     `json:"code"`
+	Role            string     `json:"role"`
+	SubscriptionIDs []int64    `json:"subscription_ids"`
+	MaxUses         int        `json:"max_uses"`
+	UsedCount       int        `json:"used_count"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+	Usable          bool       `json:"usable"`
+	Note            string     `json:"note"`
+	CreatedBy       string     `json:"created_by"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+type registerRequest struct {
+	InviteCode string `json:"invite_code"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	Email      string `json:"email"`
+	Nickname   string `json:"nickname"`
+}
+
+func convertInvitationResponse(inv storage.Invitation) invitationResponse {
+	subscriptionIDs := inv.SubscriptionIDs
+	if subscriptionIDs == nil {
+		subscriptionIDs = []int64{}
+	}
+	return invitationResponse{
+		ID:              inv.ID,
+		Code:            inv.Code,
+		Role:            inv.Role,
+		SubscriptionIDs: subscriptionIDs,
+		MaxUses:         inv.MaxUses,
+		UsedCount:       inv.UsedCount,
+		ExpiresAt:       inv.ExpiresAt,
+		Usable:          inv.Usable(time.Now()),
+		Note:            inv.Note,
+		CreatedBy:       inv.CreatedBy,
+		CreatedAt:       inv.CreatedAt,
+	}
+}
+
+type invitationsHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewInvitationsHandler lets admins list (GET), create (POST) and revoke (DELETE ?id=) invite codes.
+func NewInvitationsHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("invitations handler requires repository")
+	}
+
+	return &invitationsHandler{repo: repo}
+}
+
+func (h *invitationsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.handleList(w, r)
+	case http.MethodPost:
+		h.handleCreate(w, r)
+	case http.MethodDelete:
+		h.handleDelete(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+
+func (h *invitationsHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	invitations, err := h.repo.ListInvitations(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]invitationResponse, 0, len(invitations))
+	for _, inv := range invitations {
+		items = append(items, convertInvitationResponse(inv))
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"invitations": items})
+}
+
+func (h *invitationsHandler) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var payload invitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	role := strings.ToLower(strings.TrimSpace(payload.Role))
+	if role == "" {
+		role = storage.RoleUser
+	}
+	if role != storage.RoleUser && role != storage.RoleAdmin {
+		writeBadRequest(w, "角色只能是 user 或 admin")
+		return
+	}
+	if payload.MaxUses < 0 || payload.MaxUses > maxInvitationUses {
+		writeBadRequest(w, fmt.Sprintf("可用次数需在 1-%d 之间", maxInvitationUses))
+		return
+	}
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		writeBadRequest(w, "过期时间必须晚于当前时间")
+		return
+	}
+	code := strings.ToUpper(strings.TrimSpace(payload.Code))
+	if code != "" && !registerUsernamePattern.MatchString(code) {
+		writeBadRequest(w, "邀请码只能包含字母、数字和 _ . -，长度 3-32")
+		return
+	}
+
+	subscriptionIDs := make([]int64, 0, len(payload.SubscriptionIDs))
+	seen := make(map[int64]struct{}, len(payload.SubscriptionIDs))
+	for _, id := range payload.SubscriptionIDs {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		if _, err := h.repo.GetSubscribeFileByID(r.Context(), id); err != nil {
+			if errors.Is(err, storage.ErrSubscribeFileNotFound) {
+				writeBadRequest(w, fmt.Sprintf("订阅 %d 不存在", id))
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		subscriptionIDs = append(subscriptionIDs, id)
+	}
+
+	inv, err := h.repo.CreateInvitation(r.Context(), storage.Invitation{
+		Code:            code,
+		Role:            role,
+		SubscriptionIDs: subscriptionIDs,
+		MaxUses:         payload.MaxUses,
+		ExpiresAt:       payload.ExpiresAt,
+		Note:            payload.Note,
+		CreatedBy:       auth.UsernameFromContext(r.Context()),
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrInvitationExists) {
+			writeError(w, http.StatusConflict, errors.New("邀请码已存在"))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	recordAudit(r.Context(), "invitation.create", strconv.FormatInt(inv.ID, 10), "",
+		fmt.Sprintf("role=%s max_uses=%d subscriptions=%v", inv.Role, inv.MaxUses, inv.SubscriptionIDs))
+
+	respondJSON(w, http.StatusCreated, map[string]any{"invitation": convertInvitationResponse(inv)})
+}
+
+func (h *invitationsHandler) handleDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeBadRequest(w, "邀请码 ID 无效")
+		return
+	}
+
+	if err := h.repo.DeleteInvitation(r.Context(), id); err != nil {
+		if errors.Is(err, storage.ErrInvitationNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	recordAudit(r.Context(), "invitation.delete", strconv.FormatInt(id, 10), "", "")
+	respondJSON(w, http.StatusOK, map[string]any{"status": "deleted"})
+}
+
+// NewRegisterHandler creates an account by redeeming an invite code (public, rate limited per client IP).
+// Without a code the request only succeeds when open registration is enabled; the account is then
+// created inactive and waits in the admin approval queue.
+func NewRegisterHandler(repo *storage.TrafficRepository, rateLimiter *LoginRateLimiter) http.Handler {
+	if repo == nil {
+		panic("register handler requires repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+
+		var payload registerRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&payload); err != nil {
+			writeBadRequest(w, "请求数据格式错误")
+			return
+		}
+
+		username := strings.TrimSpace(payload.Username)
+		password := strings.TrimSpace(payload.Password)
+		openRegistration := false
+		if strings.TrimSpace(payload.InviteCode) == "" {
+			systemConfig, err := repo.GetSystemConfig(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if !systemConfig.OpenRegistration {
+				writeBadRequest(w, "缺少邀请码")
+				return
+			}
+			openRegistration = true
+		}
+		if !registerUsernamePattern.MatchString(username) {
+			writeBadRequest(w, "用户名只能包含字母、数字和 _ . -，长度 3-32")
+			return
+		}
+		if len(password) < minRegisterPasswordLength {
+			writeBadRequest(w, fmt.Sprintf("密码至少需要 %d 个字符", minRegisterPasswordLength))
+			return
+		}
+
+		clientIP := getClientIP(r)
+
+		// 邀请码可被暴力猜测，与登录共用限流
+		if rateLimiter != nil {
+			if err := rateLimiter.Check(clientIP, ""); err != nil {
+				writeError(w, http.StatusTooManyRequests, errors.New("too many attempts, please try again later"))
+				return
+			}
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if openRegistration {
+			user, err := repo.CreatePendingUser(r.Context(), username, string(hash), payload.Email, payload.Nickname)
+			if err != nil {
+				if errors.Is(err, storage.ErrUserExists) {
+					writeError(w, http.StatusConflict, errors.New("用户已存在"))
+					return
+				}
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+
+			logger.Info("📝 [REGISTER_PENDING] 开放注册账号等待审核", "username", user.Username, "client_ip", clientIP)
+
+			respondJSON(w, http.StatusAccepted, map[string]any{
+				"username": user.Username,
+				"email":    user.Email,
+				"nickname": user.Nickname,
+				"role":     user.Role,
+				"status":   storage.UserApprovalPending,
+			})
+			return
+		}
+
+		user, inv, err := repo.RegisterWithInvitation(r.Context(), storage.InvitationRegistration{
+			Code:         payload.InviteCode,
+			Username:     username,
+			Email:        payload.Email,
+			Nickname:     payload.Nickname,
+			PasswordHash: string(hash),
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, storage.ErrInvitationInvalid):
+				if rateLimiter != nil {
+					rateLimiter.RecordFailure(clientIP, "")
+				}
+				logger.Warn("📝 [REGISTER_FAIL] 邀请码无效或已用完", "client_ip", clientIP, "username", username)
+				writeError(w, http.StatusForbidden, errors.New("邀请码无效、已过期或已用完"))
+			case errors.Is(err, storage.ErrUserExists):
+				writeError(w, http.StatusConflict, errors.New("用户已存在"))
+			default:
+				writeError(w, http.StatusInternalServerError, err)
+			}
+			return
+		}
+
+		logger.Info("📝 [REGISTER_OK] 邀请码注册成功",
+			"username", user.Username,
+			"role", user.Role,
+			"invitation_id", inv.ID,
+			"client_ip", clientIP)
+
+		respondJSON(w, http.StatusCreated, map[string]any{
+			"username": user.Username,
+			"email":    user.Email,
+			"nickname": user.Nickname,
+			"role":     user.Role,
+		})
+	})
+}
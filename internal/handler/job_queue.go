@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"miaomiaowu/internal/logger"
+)
+
+// errJobQueueFull 队列已满时拒绝新任务，由调用方提示稍后重试
+var errJobQueueFull = errors.New("后台任务队列已满，请稍后重试")
+
+// jobQueue 在固定数量的后台 worker 中依次执行耗时任务（如大文件导入），避免受单个请求超时限制
+type jobQueue struct {
+	name  string
+	tasks chan queuedJob
+}
+
+type queuedJob struct {
+	label string
+	run   func(ctx context.Context) error
+}
+
+// newJobQueue 创建队列并启动 workers 个 worker，capacity 为排队任务的上限
+func newJobQueue(name string, workers, capacity int) *jobQueue {
+	q := &jobQueue{name: name, tasks: make(chan queuedJob, capacity)}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+// Enqueue 将任务加入队列，不阻塞调用方
+func (q *jobQueue) Enqueue(label string, run func(ctx context.Context) error) error {
+	select {
+	case q.tasks <- queuedJob{label: label, run: run}:
+		return nil
+	default:
+		return errJobQueueFull
+	}
+}
+
+func (q *jobQueue) work() {
+	for job := range q.tasks {
+		q.execute(job)
+	}
+}
+
+func (q *jobQueue) execute(job queuedJob) {
+	start := time.Now()
+	logger.Info("[后台任务] 开始执行", "queue", q.name, "job", job.label)
+
+	err := func() (err error) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				err = fmt.Errorf("任务异常: %v", rec)
+			}
+		}()
+		return job.run(context.Background())
+	}()
+
+	if err != nil {
+		logger.Warn("[后台任务] 执行失败", "queue", q.name, "job", job.label, "duration", time.Since(start), "error", err)
+		return
+	}
+	logger.Info("[后台任务] 执行完成", "queue", q.name, "job", job.label, "duration", time.Since(start))
+}
@@ -0,0 +1,375 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+// 应急封禁：根据外泄的订阅令牌 / 订阅链接或发现的客户端 IP，一次调用完成轮换令牌、吊销命名令牌、
+// 注销登录会话、停用账号并记录审计日志。停用账号本身不会让已泄露的订阅链接失效，所以令牌一定会被轮换。
+// 同一出口 IP（CGNAT、公司网络）后面可能有无关用户，按 IP 匹配到的用户只作为候选返回，
+// 需要先 dry_run 预览，再在 confirm_users 中逐个确认后才会处理
+const (
+	killSwitchIPWindow                = 30 * 24 * time.Hour // 按 IP 查找时只匹配这段时间内拉取过订阅的用户
+	subscriptionClientIPRetention     = 90 * 24 * time.Hour // 订阅客户端 IP 的保留时长
+	subscriptionClientIPWriteInterval = 10 * time.Minute    // 同一用户同一 IP 在这段时间内只写一次数据库
+	killSwitchTokenHintLength         = 6
+)
+
+type killSwitchRequest struct {
+	Token        string   `json:"token"` // 订阅令牌、命名令牌、短链接或完整订阅地址
+	IP           string   `json:"ip"`
+	Reason       string   `json:"reason"`
+	DryRun       bool     `json:"dry_run"`       // 只返回会受影响的用户，不做任何修改
+	ConfirmUsers []string `json:"confirm_users"` // 按 IP 匹配到的用户中确认要处理的用户名
+}
+
+type killSwitchUserResult struct {
+	Username           string     `json:"username"`
+	Role               string     `json:"role"`
+	MatchedBy          string     `json:"matched_by"` // user_token / named_token / short_code / ip
+	WasActive          bool       `json:"was_active"`
+	TokenRotated       bool       `json:"token_rotated"`
+	NamedTokensRevoked int64      `json:"named_tokens_revoked"`
+	SessionsRevoked    bool       `json:"sessions_revoked"`
+	Disabled           bool       `json:"disabled"`
+	LastSeenAt         *time.Time `json:"last_seen_at,omitempty"` // 按 IP 匹配时该 IP 最后一次拉取订阅的时间
+	IPPulls            int64      `json:"ip_pulls,omitempty"`
+	Skipped            bool       `json:"skipped,omitempty"` // 按 IP 匹配但未确认，未做任何处理
+	Note               string     `json:"note,omitempty"`
+	Error              string     `json:"error,omitempty"`
+}
+
+type killSwitchHandler struct {
+	repo   *storage.TrafficRepository
+	tokens *auth.TokenStore
+}
+
+// NewKillSwitchHandler returns the incident-response endpoint for leaked subscription links: given a
+// token or an IP it revokes the matched users' credentials, disables them and reports what was done.
+func NewKillSwitchHandler(repo *storage.TrafficRepository, tokens *auth.TokenStore) http.Handler {
+	if repo == nil || tokens == nil {
+		panic("kill switch handler requires repository and token store")
+	}
+	return &killSwitchHandler{repo: repo, tokens: tokens}
+}
+
+func (h *killSwitchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req killSwitchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+	req.Token = strings.TrimSpace(req.Token)
+	req.IP = strings.TrimSpace(req.IP)
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Token == "" && req.IP == "" {
+		writeBadRequest(w, "请提供令牌或 IP")
+		return
+	}
+	if req.IP != "" && net.ParseIP(req.IP) == nil {
+		writeBadRequest(w, "IP 地址无效")
+		return
+	}
+
+	matches, err := h.match(r.Context(), req)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(matches) == 0 {
+		writeError(w, http.StatusNotFound, errors.New("未找到匹配的令牌或 IP"))
+		return
+	}
+
+	actor := auth.UsernameFromContext(r.Context())
+	usernames := make([]string, 0, len(matches))
+	revoked := make([]killSwitchUserResult, 0, len(matches))
+	for i := range matches {
+		if req.DryRun {
+			usernames = append(usernames, matches[i].Username)
+			continue
+		}
+		if matches[i].MatchedBy == "ip" && !slices.Contains(req.ConfirmUsers, matches[i].Username) {
+			matches[i].Skipped = true
+			matches[i].Note = "按 IP 匹配的用户需要先 dry_run 预览，再在 confirm_users 中确认"
+			continue
+		}
+		h.revoke(r.Context(), &matches[i], actor)
+		usernames = append(usernames, matches[i].Username)
+		revoked = append(revoked, matches[i])
+	}
+
+	summary := killSwitchAuditSummary(req)
+	if req.DryRun {
+		recordAudit(r.Context(), "abuse.kill_switch.dry_run", strings.Join(usernames, ","), summary, "")
+	} else if len(revoked) > 0 {
+		recordAudit(r.Context(), "abuse.kill_switch", strings.Join(usernames, ","), summary, killSwitchResultSummary(revoked))
+		logger.Warn("[应急封禁] 已封禁泄露的订阅", "users", usernames, "ip", req.IP, "token", killSwitchTokenHint(req.Token), "reason", req.Reason, "actor", actor)
+	}
+
+	response := map[string]any{
+		"dry_run": req.DryRun,
+		"reason":  req.Reason,
+		"users":   matches,
+		"at":      time.Now(),
+	}
+	if req.Token != "" {
+		response["token_hint"] = killSwitchTokenHint(req.Token)
+	}
+	if req.IP != "" {
+		response["ip"] = req.IP
+	}
+	respondJSON(w, http.StatusOK, response)
+}
+
+// match 找出令牌所属用户以及在 killSwitchIPWindow 内从该 IP 拉取过订阅的用户，同一用户只出现一次
+func (h *killSwitchHandler) match(ctx context.Context, req killSwitchRequest) ([]killSwitchUserResult, error) {
+	var matches []killSwitchUserResult
+	seen := make(map[string]int)
+	add := func(username, matchedBy string) (*killSwitchUserResult, error) {
+		if idx, ok := seen[username]; ok {
+			return &matches[idx], nil
+		}
+		user, err := h.repo.GetUser(ctx, username)
+		if err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		seen[username] = len(matches)
+		matches = append(matches, killSwitchUserResult{
+			Username:  user.Username,
+			Role:      user.Role,
+			MatchedBy: matchedBy,
+			WasActive: user.IsActive,
+		})
+		return &matches[len(matches)-1], nil
+	}
+
+	if req.Token != "" {
+		for _, candidate := range killSwitchTokenCandidates(req.Token) {
+			username, kind, err := h.repo.FindTokenOwner(ctx, candidate)
+			if errors.Is(err, storage.ErrTokenNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if _, err := add(username, kind); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	if req.IP != "" {
+		clients, err := h.repo.ListSubscriptionClientIPsByIP(ctx, req.IP, time.Now().Add(-killSwitchIPWindow))
+		if err != nil {
+			return nil, err
+		}
+		for _, client := range clients {
+			result, err := add(client.Username, "ip")
+			if err != nil {
+				return nil, err
+			}
+			if result == nil {
+				continue
+			}
+			lastSeen := client.LastSeenAt
+			result.LastSeenAt = &lastSeen
+			result.IPPulls = client.Pulls
+		}
+	}
+
+	return matches, nil
+}
+
+// revoke 轮换主令牌（旧的订阅地址和短链接随之失效）、吊销全部命名令牌，非管理员账号还会注销登录会话并停用
+func (h *killSwitchHandler) revoke(ctx context.Context, result *killSwitchUserResult, actor string) {
+	var errs []string
+
+	if _, err := h.repo.ResetUserToken(ctx, result.Username); err != nil {
+		errs = append(errs, "轮换令牌失败: "+err.Error())
+	} else {
+		result.TokenRotated = true
+	}
+
+	revoked, err := h.repo.RevokeAllUserNamedTokens(ctx, result.Username)
+	if err != nil {
+		errs = append(errs, "吊销命名令牌失败: "+err.Error())
+	}
+	result.NamedTokensRevoked = revoked
+
+	switch {
+	case result.Role == storage.RoleAdmin:
+		result.Note = "管理员账号只轮换订阅令牌，不会被停用"
+	case result.Username == actor:
+		result.Note = "不能停用当前登录的账号"
+	default:
+		h.tokens.RevokeUser(result.Username)
+		result.SessionsRevoked = true
+		if result.WasActive {
+			if err := h.repo.UpdateUserStatus(ctx, result.Username, false); err != nil {
+				errs = append(errs, "停用账号失败: "+err.Error())
+			} else {
+				result.Disabled = true
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		result.Error = strings.Join(errs, "; ")
+		logger.Error("[应急封禁] 处理用户失败", "user", result.Username, "error", result.Error)
+	}
+}
+
+// killSwitchTokenCandidates 从输入中提取可能的令牌：完整订阅地址取 token 参数或路径最后一段，
+// 6 位短链接（前 3 位文件 + 后 3 位用户）取用户短码
+func killSwitchTokenCandidates(raw string) []string {
+	value := raw
+	if parsed, err := url.Parse(raw); err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") {
+		if token := strings.TrimSpace(parsed.Query().Get("token")); token != "" {
+			value = token
+		} else {
+			segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+			value = segments[len(segments)-1]
+		}
+	}
+
+	candidates := []string{value}
+	if len(value) == 6 {
+		candidates = append(candidates, value[3:])
+	}
+	return candidates
+}
+
+// killSwitchTokenHint 日志和响应中只保留令牌末尾几位
+func killSwitchTokenHint(token string) string {
+	if token == "" {
+		return ""
+	}
+	candidates := killSwitchTokenCandidates(token)
+	value := candidates[0]
+	if len(value) <= killSwitchTokenHintLength {
+		return value
+	}
+	return "…" + value[len(value)-killSwitchTokenHintLength:]
+}
+
+func killSwitchAuditSummary(req killSwitchRequest) string {
+	var parts []string
+	if req.Token != "" {
+		parts = append(parts, "token="+killSwitchTokenHint(req.Token))
+	}
+	if req.IP != "" {
+		parts = append(parts, "ip="+req.IP)
+	}
+	if req.Reason != "" {
+		parts = append(parts, "reason="+req.Reason)
+	}
+	return strings.Join(parts, " ")
+}
+
+func killSwitchResultSummary(results []killSwitchUserResult) string {
+	parts := make([]string, 0, len(results))
+	for _, result := range results {
+		parts = append(parts, fmt.Sprintf("%s(token_rotated=%t named_revoked=%d disabled=%t)",
+			result.Username, result.TokenRotated, result.NamedTokensRevoked, result.Disabled))
+	}
+	return strings.Join(parts, " ")
+}
+
+// subscriptionClientIPWrite 同一用户同一 IP 最近一次写库的时间和之后累计的拉取次数
+type subscriptionClientIPWrite struct {
+	mu      sync.Mutex
+	written time.Time
+	pending int64
+}
+
+// subscriptionClientIPWrites username|ip -> *subscriptionClientIPWrite
+var subscriptionClientIPWrites sync.Map
+
+// recordSubscriptionClientIP 记录拉取订阅的客户端 IP，供应急封禁按 IP 查找用户，失败只记录日志不影响下发。
+// 同一用户同一 IP 每 subscriptionClientIPWriteInterval 最多写一次数据库，期间的拉取次数在下次写入时一并累加
+func recordSubscriptionClientIP(ctx context.Context, repo *storage.TrafficRepository, username, ip string) {
+	if repo == nil || username == "" || ip == "" {
+		return
+	}
+
+	now := time.Now()
+	value, _ := subscriptionClientIPWrites.LoadOrStore(username+"|"+ip, &subscriptionClientIPWrite{})
+	entry := value.(*subscriptionClientIPWrite)
+	entry.mu.Lock()
+	entry.pending++
+	if now.Sub(entry.written) < subscriptionClientIPWriteInterval {
+		entry.mu.Unlock()
+		return
+	}
+	pulls := entry.pending
+	entry.pending = 0
+	entry.written = now
+	entry.mu.Unlock()
+
+	if err := repo.RecordSubscriptionClientIP(ctx, username, ip, pulls, now); err != nil {
+		logger.Warn("[订阅统计] 记录订阅客户端 IP 失败", "user", username, "error", err)
+	}
+}
+
+// flushSubscriptionClientIPs 写入超过写入间隔仍未落库的拉取次数，并清理这些内存条目
+func flushSubscriptionClientIPs(ctx context.Context, repo *storage.TrafficRepository, now time.Time) {
+	subscriptionClientIPWrites.Range(func(key, value any) bool {
+		entry := value.(*subscriptionClientIPWrite)
+		entry.mu.Lock()
+		if now.Sub(entry.written) < subscriptionClientIPWriteInterval {
+			entry.mu.Unlock()
+			return true
+		}
+		pulls := entry.pending
+		subscriptionClientIPWrites.Delete(key)
+		entry.mu.Unlock()
+
+		if pulls > 0 {
+			username, ip, _ := strings.Cut(key.(string), "|")
+			if err := repo.RecordSubscriptionClientIP(ctx, username, ip, pulls, entry.written); err != nil {
+				logger.Warn("[订阅统计] 记录订阅客户端 IP 失败", "user", username, "error", err)
+			}
+		}
+		return true
+	})
+}
+
+// PruneSubscriptionClientIPs 写入累计的拉取次数，并删除超过保留时长的订阅客户端 IP
+func PruneSubscriptionClientIPs(ctx context.Context, repo *storage.TrafficRepository) error {
+	if repo == nil {
+		return nil
+	}
+	flushSubscriptionClientIPs(ctx, repo, time.Now())
+	removed, err := repo.PruneSubscriptionClientIPs(ctx, time.Now().Add(-subscriptionClientIPRetention))
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		logger.Info("[订阅统计] 已清理过期的订阅客户端 IP", "rows", removed)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+type ldapSettingsRequest struct {
+	Enabled        bool    `json:"enabled"`
+	URL            string  `json:"url"`
+	StartTLS       bool    `json:"start_tls"`
+	SkipTLSVerify  bool    `json:"skip_tls_verify"`
+	BindDN         string  `json:"bind_dn"`
+	BindPassword   *string `json:"bind_password"` // nil keeps the saved password, "" clears it
+	BaseDN         string  `json:"base_dn"`
+	UserFilter     string  `json:"user_filter"`
+	EmailAttribute string  `json:"email_attribute"`
+	NameAttribute  string  `json:"name_attribute"`
+	AutoCreate     bool    `json:"auto_create"`
+	DefaultRole    string  `json:"default_role"`
+}
+
+type ldapSettingsResponse struct {
+	Enabled         bool   `json:"enabled"`
+	URL             string `json:"url"`
+	StartTLS        bool   `json:"start_tls"`
+	SkipTLSVerify   bool   `json:"skip_tls_verify"`
+	BindDN          string `json:"bind_dn"`
+	HasBindPassword bool   `json:"has_bind_password"`
+	BaseDN          string `json:"base_dn"`
+	UserFilter      string `json:"user_filter"`
+	EmailAttribute  string `json:"email_attribute"`
+	NameAttribute   string `json:"name_attribute"`
+	AutoCreate      bool   `json:"auto_create"`
+	DefaultRole     string `json:"default_role"`
+}
+
+type ldapSettingsHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewLDAPSettingsHandler manages the LDAP login backend (GET/PUT) and tries a directory login with the
+// saved settings at /test (POST).
+func NewLDAPSettingsHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("ldap settings handler requires repository")
+	}
+
+	return &ldapSettingsHandler{repo: repo}
+}
+
+func (h *ldapSettingsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/test") {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		h.handleTest(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.respondSettings(w, r)
+	case http.MethodPut:
+		h.handleUpdate(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+	}
+}
+
+func (h *ldapSettingsHandler) respondSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.repo.GetLDAPSettings(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, ldapSettingsResponse{
+		Enabled:         settings.Enabled,
+		URL:             settings.URL,
+		StartTLS:        settings.StartTLS,
+		SkipTLSVerify:   settings.SkipTLSVerify,
+		BindDN:          settings.BindDN,
+		HasBindPassword: settings.BindPassword != "",
+		BaseDN:          settings.BaseDN,
+		UserFilter:      settings.EffectiveUserFilter(),
+		EmailAttribute:  settings.EffectiveEmailAttribute(),
+		NameAttribute:   settings.EffectiveNameAttribute(),
+		AutoCreate:      settings.AutoCreate,
+		DefaultRole:     settings.DefaultRole,
+	})
+}
+
+func (h *ldapSettingsHandler) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	var payload ldapSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	current, err := h.repo.GetLDAPSettings(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	settings := storage.LDAPSettings{
+		Enabled:        payload.Enabled,
+		URL:            strings.TrimSpace(payload.URL),
+		StartTLS:       payload.StartTLS,
+		SkipTLSVerify:  payload.SkipTLSVerify,
+		BindDN:         strings.TrimSpace(payload.BindDN),
+		BindPassword:   current.BindPassword,
+		BaseDN:         strings.TrimSpace(payload.BaseDN),
+		UserFilter:     strings.TrimSpace(payload.UserFilter),
+		EmailAttribute: strings.TrimSpace(payload.EmailAttribute),
+		NameAttribute:  strings.TrimSpace(payload.NameAttribute),
+		AutoCreate:     payload.AutoCreate,
+		DefaultRole:    strings.TrimSpace(payload.DefaultRole),
+	}
+	if payload.BindPassword != nil {
+		settings.BindPassword = *payload.BindPassword
+	}
+	if settings.DefaultRole == "" {
+		settings.DefaultRole = storage.RoleUser
+	}
+	if settings.DefaultRole != storage.RoleUser && settings.DefaultRole != storage.RoleAdmin {
+		writeBadRequest(w, "default_role 只能是 user 或 admin")
+		return
+	}
+	if settings.URL != "" {
+		parsed, err := url.Parse(settings.URL)
+		if err != nil || parsed.Host == "" || (parsed.Scheme != "ldap" && parsed.Scheme != "ldaps") {
+			writeBadRequest(w, "LDAP 地址必须是 ldap:// 或 ldaps:// 开头")
+			return
+		}
+		if parsed.Scheme == "ldaps" && settings.StartTLS {
+			writeBadRequest(w, "ldaps:// 地址不需要再启用 StartTLS")
+			return
+		}
+	}
+	if err := auth.ValidateLDAPUserFilter(settings.EffectiveUserFilter()); err != nil {
+		writeBadRequest(w, "用户过滤器无效: "+err.Error())
+		return
+	}
+	if settings.Enabled && (settings.URL == "" || settings.BaseDN == "") {
+		writeBadRequest(w, "启用 LDAP 登录需要填写服务器地址和 Base DN")
+		return
+	}
+
+	if err := h.repo.UpdateLDAPSettings(r.Context(), settings); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	recordAudit(r.Context(), "ldap.update", settings.URL,
+		fmt.Sprintf("enabled=%t url=%s base_dn=%s", current.Enabled, current.URL, current.BaseDN),
+		fmt.Sprintf("enabled=%t url=%s base_dn=%s", settings.Enabled, settings.URL, settings.BaseDN))
+	logger.Info("[LDAP] LDAP 设置已更新", "enabled", settings.Enabled, "url", settings.URL, "base_dn", settings.BaseDN)
+	h.respondSettings(w, r)
+}
+
+func (h *ldapSettingsHandler) handleTest(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+	if strings.TrimSpace(payload.Username) == "" || payload.Password == "" {
+		writeBadRequest(w, "用户名和密码不能为空")
+		return
+	}
+
+	settings, err := h.repo.GetLDAPSettings(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if settings.URL == "" {
+		writeBadRequest(w, "请先保存 LDAP 服务器地址")
+		return
+	}
+
+	user, err := auth.LDAPAuthenticate(r.Context(), settings, payload.Username, payload.Password)
+	if err != nil {
+		if errors.Is(err, auth.ErrLDAPInvalidCredentials) || errors.Is(err, auth.ErrLDAPAmbiguousUser) {
+			respondJSON(w, http.StatusOK, map[string]any{"success": false, "error": err.Error()})
+			return
+		}
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"success": true, "user": user})
+}
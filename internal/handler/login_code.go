@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	// loginCodeTTL 登录码有效期，足够在电视盒子上输入即可
+	loginCodeTTL = 5 * time.Minute
+	// loginCodeSessionTTL 通过登录码登录的会话有效期
+	loginCodeSessionTTL = 24 * time.Hour
+)
+
+type loginCodeExchangeRequest struct {
+	Code string `json:"code"`
+}
+
+// NewLoginCodeHandler lets a logged-in user mint (POST) or revoke (DELETE) a short-lived login code.
+func NewLoginCodeHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("login code handler requires repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username := auth.UsernameFromContext(r.Context())
+		if username == "" {
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			code, expiresAt, err := repo.CreateLoginCode(r.Context(), username, loginCodeTTL)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+
+			logger.Info("🔐 [LOGIN_CODE] 已生成登录码", "username", username, "expires_at", expiresAt.Local().Format("2006-01-02 15:04:05"))
+			respondJSON(w, http.StatusOK, map[string]any{
+				"code":        code,
+				"expires_at":  expiresAt,
+				"ttl_seconds": int(loginCodeTTL.Seconds()),
+			})
+		case http.MethodDelete:
+			if err := repo.RevokeLoginCodes(r.Context(), username); err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			respondJSON(w, http.StatusOK, map[string]any{"status": "revoked"})
+		default:
+			methodNotAllowed(w, http.MethodPost, http.MethodDelete)
+		}
+	})
+}
+
+// NewLoginCodeExchangeHandler exchanges a login code for a session token without requiring the password.
+func NewLoginCodeExchangeHandler(tokens *auth.TokenStore, repo *storage.TrafficRepository, rateLimiter *LoginRateLimiter) http.Handler {
+	if tokens == nil || repo == nil {
+		panic("login code exchange handler requires token store and repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+
+		var payload loginCodeExchangeRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&payload); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		// 允许用户输入 "123 456" 或 "123-456"
+		code := strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(payload.Code))
+		if code == "" {
+			writeError(w, http.StatusBadRequest, errors.New("code is required"))
+			return
+		}
+
+		clientIP := getClientIP(r)
+
+		// 6 位数字空间较小，必须限制尝试次数
+		if rateLimiter != nil {
+			if err := rateLimiter.Check(clientIP, ""); err != nil {
+				writeError(w, http.StatusTooManyRequests, errors.New("too many login attempts, please try again later"))
+				return
+			}
+		}
+
+		username, err := repo.ConsumeLoginCode(r.Context(), code)
+		if err != nil {
+			if !errors.Is(err, storage.ErrLoginCodeInvalid) {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if rateLimiter != nil {
+				rateLimiter.RecordFailure(clientIP, "")
+			}
+			logger.Warn("🔐 [LOGIN_CODE_FAIL] 登录码无效或已过期", "client_ip", clientIP)
+			writeError(w, http.StatusUnauthorized, errors.New("invalid or expired code"))
+			return
+		}
+
+		user, err := repo.GetUser(r.Context(), username)
+		if err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				writeError(w, http.StatusUnauthorized, errors.New("invalid or expired code"))
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !user.IsActive {
+			writeError(w, http.StatusUnauthorized, errors.New("invalid or expired code"))
+			return
+		}
+
+		if rateLimiter != nil {
+			rateLimiter.RecordSuccess(clientIP, "")
+		}
+
+		token, expiry, err := tokens.IssueWithTTL(username, loginCodeSessionTTL)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if err := repo.CreateSession(r.Context(), token, username, expiry); err != nil {
+			logger.Warn("[认证] 会话持久化失败", "username", username, "error", err)
+		}
+
+		logger.Info("🔐 [LOGIN_OK] 登录码登录成功",
+			"username", username,
+			"client_ip", clientIP,
+			"expires_at", expiry.Format("2006-01-02 15:04:05"))
+
+		respondJSON(w, http.StatusOK, newLoginResponse(token, expiry, user))
+	})
+}
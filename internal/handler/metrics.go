@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/metrics"
+)
+
+type metricsHandler struct{}
+
+// NewMetricsHandler exposes the per-endpoint and per-statement duration/size histograms together
+// with the recent slow operations. GET returns the snapshot (?limit=N keeps the N series with the
+// highest total duration per kind), DELETE resets all counters.
+func NewMetricsHandler() http.Handler {
+	return &metricsHandler{}
+}
+
+func (h *metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		snapshot := metrics.GetSnapshot()
+		if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+			limit, err := strconv.Atoi(raw)
+			if err != nil || limit <= 0 {
+				writeBadRequest(w, "无效的 limit 参数")
+				return
+			}
+			if len(snapshot.HTTP) > limit {
+				snapshot.HTTP = snapshot.HTTP[:limit]
+			}
+			if len(snapshot.DB) > limit {
+				snapshot.DB = snapshot.DB[:limit]
+			}
+		}
+		respondJSON(w, http.StatusOK, snapshot)
+	case http.MethodDelete:
+		metrics.Reset()
+		logger.Info("[性能统计] 已重置统计数据")
+		respondJSON(w, http.StatusOK, map[string]string{"status": "reset"})
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+	}
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	// maxNodeCustomFields 单个节点允许的自定义字段数量
+	maxNodeCustomFields = 64
+	// maxNodeCustomFieldsBytes 自定义字段请求体大小上限
+	maxNodeCustomFieldsBytes = 64 << 10
+)
+
+// handleCustomFields 读取（GET）或整体替换（PUT）节点的自定义字段。自定义字段会合并进节点的
+// Clash 输出，用于解析器尚未支持的新版 mihomo 选项；以 _singbox 为键的对象会并入 sing-box 出站
+func (h *nodesHandler) handleCustomFields(w http.ResponseWriter, r *http.Request, idSegment string) {
+	username := auth.UsernameFromContext(r.Context())
+	if username == "" {
+		writeError(w, http.StatusUnauthorized, errors.New("用户未认证"))
+		return
+	}
+
+	nodeID, err := strconv.ParseInt(idSegment, 10, 64)
+	if err != nil || nodeID <= 0 {
+		writeBadRequest(w, "无效的节点ID")
+		return
+	}
+
+	existing, err := h.repo.GetNode(r.Context(), nodeID, username)
+	if err != nil {
+		if errors.Is(err, storage.ErrNodeNotFound) {
+			writeError(w, http.StatusNotFound, errors.New("节点不存在"))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		fields := existing.CustomFields
+		if fields == nil {
+			fields = map[string]any{}
+		}
+		respondJSON(w, http.StatusOK, map[string]any{"custom_fields": fields})
+		return
+	}
+
+	var req struct {
+		CustomFields map[string]any `json:"custom_fields"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxNodeCustomFieldsBytes)).Decode(&req); err != nil {
+		writeBadRequest(w, "请求格式不正确")
+		return
+	}
+	if err := validateNodeCustomFields(req.CustomFields); err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	updated, err := h.repo.SetNodeCustomFields(r.Context(), nodeID, username, req.CustomFields)
+	if err != nil {
+		if errors.Is(err, storage.ErrNodeNotFound) {
+			writeError(w, http.StatusNotFound, errors.New("节点不存在"))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logger.Info("[节点更新] 自定义字段已更新", "id", updated.ID, "node_name", updated.NodeName, "count", len(updated.CustomFields))
+
+	// 整体替换订阅文件中的代理条目，确保被删除的自定义字段也会从 YAML 中移除
+	if updated.ClashConfig != "" {
+		if err := h.yamlSyncManager.ReplaceNode(updated.NodeName, updated.ClashOutput()); err != nil {
+			// Log error but don't fail the request
+		}
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"node": convertNode(updated),
+	})
+}
+
+// validateNodeCustomFields 校验自定义字段：不能覆盖身份字段，键名不能为空或包含空白字符
+func validateNodeCustomFields(fields map[string]any) error {
+	if len(fields) > maxNodeCustomFields {
+		return fmt.Errorf("自定义字段最多 %d 个", maxNodeCustomFields)
+	}
+	for key := range fields {
+		if key == "" || strings.ContainsFunc(key, unicode.IsSpace) {
+			return fmt.Errorf("自定义字段名 %q 无效", key)
+		}
+		if slices.Contains(storage.ProtectedNodeCustomFields, key) {
+			return fmt.Errorf("自定义字段不能覆盖 %s", key)
+		}
+	}
+	if raw, ok := fields["_singbox"]; ok {
+		if _, ok := raw.(map[string]any); !ok {
+			return errors.New("_singbox 必须是对象")
+		}
+	}
+	return nil
+}
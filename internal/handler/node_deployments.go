@@ -0,0 +1,778 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 节点部署：在出口服务器上运行常见的一键安装脚本（xray / sing-box），从输出中提取分享链接登记为节点，
+// 并按配置绑定探针服务器。两种方式：
+//   - ssh：面板使用保存的 SSH 凭据登录执行，之后可随时重新执行以刷新节点；
+//   - agent：面板生成一次性展示的令牌和命令，由管理员在服务器上执行，输出上报到 /api/node-deployments/report，
+//     再次执行同一命令即可刷新。
+const (
+	nodeDeploymentsPath      = "/api/admin/node-deployments"
+	nodeDeploymentReportPath = "/api/node-deployments/report"
+	// nodeDeploymentTokenHeader 上报时携带令牌的请求头，也可以使用 Authorization: Bearer
+	nodeDeploymentTokenHeader = "X-Deployment-Token"
+
+	nodeDeploymentScriptCustom = "custom"
+	nodeDeploymentDialTimeout  = 15 * time.Second
+	nodeDeploymentRunTimeout   = 15 * time.Minute
+	// maxNodeDeploymentOutput 执行输出只保留末尾部分，足够包含安装完成后打印的分享链接
+	maxNodeDeploymentOutput = 256 << 10
+	maxNodeDeploymentReport = 1 << 20
+)
+
+// nodeDeploymentScript 预置的安装脚本：未安装（或要求重装）时执行 Install，之后用 Links 打印分享链接
+type nodeDeploymentScript struct {
+	Install string
+	Binary  string
+	Links   string
+}
+
+var nodeDeploymentScripts = map[string]nodeDeploymentScript{
+	"sing-box": {
+		Install: "bash <(wget -qO- -o- https://github.com/233boy/sing-box/raw/main/install.sh)",
+		Binary:  "sb",
+		Links:   "sb url",
+	},
+	"xray": {
+		Install: "bash <(wget -qO- -o- https://github.com/233boy/Xray/raw/main/install.sh)",
+		Binary:  "xray",
+		Links:   "xray url",
+	},
+}
+
+var (
+	ansiEscapePattern = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+	shareLinkPattern  = regexp.MustCompile(`(?i)\b(?:vless|vmess|trojan|ssr|ss|hysteria2|hy2|hysteria|tuic|anytls|socks5?|wireguard|wg)://[^\s'"<>]+`)
+)
+
+type nodeDeploymentDTO struct {
+	ID            int64      `json:"id"`
+	Name          string     `json:"name"`
+	Mode          string     `json:"mode"`
+	Script        string     `json:"script"`
+	Command       string     `json:"command"`
+	Host          string     `json:"host"`
+	Port          int        `json:"port"`
+	SSHUser       string     `json:"ssh_user"`
+	AuthType      string     `json:"auth_type"`
+	HasCredential bool       `json:"has_credential"`
+	HostKey       string     `json:"host_key"`
+	TokenHint     string     `json:"token_hint"`
+	Tag           string     `json:"tag"`
+	ProbeServer   string     `json:"probe_server"`
+	TLSDomain     string     `json:"tls_domain"`
+	DNSCredential int64      `json:"dns_credential_id"`
+	NodeIDs       []int64    `json:"node_ids"`
+	Status        string     `json:"status"`
+	LastError     string     `json:"last_error"`
+	Log           string     `json:"log,omitempty"`
+	LastRunAt     *time.Time `json:"last_run_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func convertNodeDeployment(d storage.NodeDeployment, withLog bool) nodeDeploymentDTO {
+	dto := nodeDeploymentDTO{
+		ID:            d.ID,
+		Name:          d.Name,
+		Mode:          d.Mode,
+		Script:        d.Script,
+		Command:       d.Command,
+		Host:          d.Host,
+		Port:          d.Port,
+		SSHUser:       d.SSHUser,
+		AuthType:      d.AuthType,
+		HasCredential: d.Credential != "",
+		HostKey:       d.HostKey,
+		TokenHint:     d.TokenHint,
+		Tag:           d.Tag,
+		ProbeServer:   d.ProbeServer,
+		TLSDomain:     d.TLSDomain,
+		DNSCredential: d.DNSCredentialID,
+		NodeIDs:       d.NodeIDs,
+		Status:        d.Status,
+		LastError:     d.LastError,
+		LastRunAt:     d.LastRunAt,
+		CreatedAt:     d.CreatedAt,
+		UpdatedAt:     d.UpdatedAt,
+	}
+	if dto.NodeIDs == nil {
+		dto.NodeIDs = []int64{}
+	}
+	if withLog {
+		dto.Log = d.Log
+	}
+	return dto
+}
+
+type nodeDeploymentRequest struct {
+	Name        string `json:"name"`
+	Mode        string `json:"mode"`
+	Script      string `json:"script"`
+	Command     string `json:"command"`
+	Host        string `json:"host"`
+	Port        int    `json:"port"`
+	SSHUser     string `json:"ssh_user"`
+	Password    string `json:"password"`
+	PrivateKey  string `json:"private_key"`
+	Tag         string `json:"tag"`
+	ProbeServer string `json:"probe_server"`
+	// TLSDomain 部署前通过 DNS 凭据签发证书的域名（仅 ssh 方式）
+	TLSDomain       string `json:"tls_domain"`
+	DNSCredentialID int64  `json:"dns_credential_id"`
+	// Run 创建后是否立即执行（仅 ssh 方式），默认 true
+	Run *bool `json:"run"`
+}
+
+type nodeDeploymentsHandler struct {
+	repo  *storage.TrafficRepository
+	queue *jobQueue
+
+	mu      sync.Mutex
+	running map[int64]bool
+}
+
+// NewNodeDeploymentsHandler 管理节点部署：GET 列表，POST 创建，GET/DELETE /{id}，POST /{id}/run 重新执行（刷新节点）
+func NewNodeDeploymentsHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("node deployments handler requires repository")
+	}
+
+	return &nodeDeploymentsHandler{
+		repo:    repo,
+		queue:   newJobQueue("node-deploy", 2, 16),
+		running: make(map[int64]bool),
+	}
+}
+
+func (h *nodeDeploymentsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	username := auth.UsernameFromContext(r.Context())
+	if username == "" {
+		writeError(w, http.StatusUnauthorized, errors.New("用户未认证"))
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, nodeDeploymentsPath), "/")
+	if rest == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.handleList(w, r, username)
+		case http.MethodPost:
+			h.handleCreate(w, r, username)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+		return
+	}
+
+	idPart, action, _ := strings.Cut(rest, "/")
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil || id <= 0 {
+		writeBadRequest(w, "部署 ID 无效")
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		d, ok := h.load(w, r, id, username)
+		if ok {
+			respondJSON(w, http.StatusOK, map[string]any{"deployment": convertNodeDeployment(d, true)})
+		}
+	case action == "" && r.Method == http.MethodDelete:
+		if err := h.repo.DeleteNodeDeployment(r.Context(), id, username); err != nil {
+			if errors.Is(err, storage.ErrNodeDeploymentNotFound) {
+				writeError(w, http.StatusNotFound, errors.New("部署不存在"))
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		recordAudit(r.Context(), "node_deployment.delete", idPart, "", "")
+		respondJSON(w, http.StatusOK, map[string]any{"status": "deleted"})
+	case action == "run" && r.Method == http.MethodPost:
+		h.handleRun(w, r, id, username)
+	case action == "":
+		methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+	case action == "run":
+		methodNotAllowed(w, http.MethodPost)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("接口不存在"))
+	}
+}
+
+func (h *nodeDeploymentsHandler) load(w http.ResponseWriter, r *http.Request, id int64, username string) (storage.NodeDeployment, bool) {
+	d, err := h.repo.GetNodeDeployment(r.Context(), id, username)
+	if err != nil {
+		if errors.Is(err, storage.ErrNodeDeploymentNotFound) {
+			writeError(w, http.StatusNotFound, errors.New("部署不存在"))
+			return storage.NodeDeployment{}, false
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return storage.NodeDeployment{}, false
+	}
+	return d, true
+}
+
+func (h *nodeDeploymentsHandler) handleList(w http.ResponseWriter, r *http.Request, username string) {
+	deployments, err := h.repo.ListNodeDeployments(r.Context(), username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]nodeDeploymentDTO, 0, len(deployments))
+	for _, d := range deployments {
+		items = append(items, convertNodeDeployment(d, false))
+	}
+	scripts := make([]string, 0, len(nodeDeploymentScripts)+1)
+	for name := range nodeDeploymentScripts {
+		scripts = append(scripts, name)
+	}
+	scripts = append(scripts, nodeDeploymentScriptCustom)
+	respondJSON(w, http.StatusOK, map[string]any{"deployments": items, "scripts": scripts})
+}
+
+func (h *nodeDeploymentsHandler) handleCreate(w http.ResponseWriter, r *http.Request, username string) {
+	var req nodeDeploymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	d, err := buildNodeDeployment(req, username)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	if d.TLSDomain != "" {
+		credential, err := h.repo.GetDNSCredential(r.Context(), d.DNSCredentialID, username)
+		if err != nil {
+			if errors.Is(err, storage.ErrDNSCredentialNotFound) {
+				writeBadRequest(w, "DNS 凭据不存在")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !credential.Allows(d.TLSDomain) {
+			writeBadRequest(w, fmt.Sprintf("DNS 凭据 %s 不能用于域名 %s", credential.Name, d.TLSDomain))
+			return
+		}
+	}
+
+	created, token, err := h.repo.CreateNodeDeployment(r.Context(), d)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	recordAudit(r.Context(), "node_deployment.create", created.Name, "", fmt.Sprintf("mode=%s script=%s host=%s", created.Mode, created.Script, created.Host))
+
+	response := map[string]any{}
+	if created.Mode == storage.NodeDeploymentModeAgent {
+		response["agent_token"] = token
+		response["agent_command"] = nodeDeploymentAgentCommand(created, token, panelBaseURL(r))
+	} else if req.Run == nil || *req.Run {
+		if err := h.start(created, false); err != nil {
+			response["error"] = err.Error()
+		} else {
+			created.Status = storage.NodeDeploymentStatusRunning
+		}
+	}
+	response["deployment"] = convertNodeDeployment(created, false)
+	respondJSON(w, http.StatusCreated, response)
+}
+
+func (h *nodeDeploymentsHandler) handleRun(w http.ResponseWriter, r *http.Request, id int64, username string) {
+	var payload struct {
+		Reinstall bool `json:"reinstall"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+			writeBadRequest(w, "请求数据格式错误")
+			return
+		}
+	}
+
+	d, ok := h.load(w, r, id, username)
+	if !ok {
+		return
+	}
+	if d.Mode != storage.NodeDeploymentModeSSH {
+		writeBadRequest(w, "agent 方式的部署需要在服务器上重新执行部署命令")
+		return
+	}
+
+	if err := h.start(d, payload.Reinstall); err != nil {
+		status := http.StatusServiceUnavailable
+		if !errors.Is(err, errJobQueueFull) {
+			status = http.StatusConflict
+		}
+		writeError(w, status, err)
+		return
+	}
+	recordAudit(r.Context(), "node_deployment.run", d.Name, "", fmt.Sprintf("reinstall=%v", payload.Reinstall))
+
+	d.Status = storage.NodeDeploymentStatusRunning
+	respondJSON(w, http.StatusAccepted, map[string]any{"deployment": convertNodeDeployment(d, false)})
+}
+
+// start 将 SSH 部署加入后台队列，同一部署同时只允许执行一次
+func (h *nodeDeploymentsHandler) start(d storage.NodeDeployment, reinstall bool) error {
+	h.mu.Lock()
+	if h.running[d.ID] {
+		h.mu.Unlock()
+		return errors.New("部署正在执行中")
+	}
+	h.running[d.ID] = true
+	h.mu.Unlock()
+
+	err := h.queue.Enqueue(fmt.Sprintf("%s@%s", d.Name, d.Host), func(ctx context.Context) error {
+		defer func() {
+			h.mu.Lock()
+			delete(h.running, d.ID)
+			h.mu.Unlock()
+		}()
+		ctx, cancel := context.WithTimeout(ctx, nodeDeploymentRunTimeout)
+		defer cancel()
+		return runNodeDeployment(ctx, h.repo, d, reinstall)
+	})
+	if err != nil {
+		h.mu.Lock()
+		delete(h.running, d.ID)
+		h.mu.Unlock()
+		return err
+	}
+
+	if err := h.repo.UpdateNodeDeploymentStatus(context.Background(), d.ID, storage.NodeDeploymentStatusRunning, "", d.Log, nil); err != nil {
+		logger.Warn("[节点部署] 更新状态失败", "deployment", d.Name, "error", err)
+	}
+	return nil
+}
+
+// buildNodeDeployment 校验创建请求
+func buildNodeDeployment(req nodeDeploymentRequest, username string) (storage.NodeDeployment, error) {
+	d := storage.NodeDeployment{
+		Username:    username,
+		Name:        strings.TrimSpace(req.Name),
+		Mode:        strings.ToLower(strings.TrimSpace(req.Mode)),
+		Script:      strings.TrimSpace(req.Script),
+		Command:     strings.TrimSpace(req.Command),
+		Host:        strings.TrimSpace(req.Host),
+		Port:        req.Port,
+		SSHUser:     strings.TrimSpace(req.SSHUser),
+		Tag:         strings.TrimSpace(req.Tag),
+		ProbeServer: strings.TrimSpace(req.ProbeServer),
+		TLSDomain:   strings.ToLower(strings.TrimSuffix(strings.TrimSpace(req.TLSDomain), ".")),
+	}
+	if d.Name == "" {
+		return d, errors.New("部署名称不能为空")
+	}
+	if d.Mode == "" {
+		d.Mode = storage.NodeDeploymentModeSSH
+	}
+	if d.Mode != storage.NodeDeploymentModeSSH && d.Mode != storage.NodeDeploymentModeAgent {
+		return d, errors.New("部署方式只能是 ssh 或 agent")
+	}
+	if d.Script == "" {
+		d.Script = "sing-box"
+	}
+	if _, ok := nodeDeploymentScripts[d.Script]; !ok && d.Script != nodeDeploymentScriptCustom {
+		return d, fmt.Errorf("不支持的安装脚本: %s", d.Script)
+	}
+	if d.Script == nodeDeploymentScriptCustom && d.Command == "" {
+		return d, errors.New("自定义脚本需要填写执行命令")
+	}
+	if d.Script != nodeDeploymentScriptCustom {
+		d.Command = ""
+	}
+
+	if d.TLSDomain != "" {
+		// agent 方式的命令由管理员复制到服务器执行，不能携带 DNS 凭据
+		if d.Mode == storage.NodeDeploymentModeAgent {
+			return d, errors.New("签发证书仅支持 ssh 方式的部署")
+		}
+		if req.DNSCredentialID <= 0 {
+			return d, errors.New("签发证书需要选择 DNS 凭据")
+		}
+		if strings.HasPrefix(d.TLSDomain, "*.") || !strings.Contains(d.TLSDomain, ".") || strings.ContainsAny(d.TLSDomain, " /:'") {
+			return d, fmt.Errorf("证书域名无效: %s", d.TLSDomain)
+		}
+		d.DNSCredentialID = req.DNSCredentialID
+	}
+
+	if d.Mode == storage.NodeDeploymentModeAgent {
+		return d, nil
+	}
+
+	if d.Host == "" {
+		return d, errors.New("服务器地址不能为空")
+	}
+	if d.Port == 0 {
+		d.Port = 22
+	}
+	if d.Port < 1 || d.Port > 65535 {
+		return d, errors.New("SSH 端口无效")
+	}
+	if d.SSHUser == "" {
+		d.SSHUser = "root"
+	}
+	switch {
+	case strings.TrimSpace(req.PrivateKey) != "":
+		if _, err := ssh.ParsePrivateKey([]byte(req.PrivateKey)); err != nil {
+			return d, fmt.Errorf("私钥无效: %v", err)
+		}
+		d.AuthType = "key"
+		d.Credential = req.PrivateKey
+	case req.Password != "":
+		d.AuthType = "password"
+		d.Credential = req.Password
+	default:
+		return d, errors.New("需要提供 SSH 密码或私钥")
+	}
+	return d, nil
+}
+
+// nodeDeploymentShellCommand 生成在服务器上执行的命令：预置脚本未安装或要求重装时先安装，再打印分享链接
+func nodeDeploymentShellCommand(d storage.NodeDeployment, reinstall bool) string {
+	if d.Script == nodeDeploymentScriptCustom {
+		return d.Command
+	}
+	script := nodeDeploymentScripts[d.Script]
+	if reinstall {
+		return script.Install + "; " + script.Links
+	}
+	return fmt.Sprintf("command -v %s >/dev/null 2>&1 || %s; %s", script.Binary, script.Install, script.Links)
+}
+
+// nodeDeploymentAgentCommand 生成 agent 方式在服务器上执行的命令，输出通过 curl 上报给面板
+func nodeDeploymentAgentCommand(d storage.NodeDeployment, token, baseURL string) string {
+	return fmt.Sprintf("bash -c %s 2>&1 | curl -fsS -X POST -H %s --data-binary @- %s",
+		shellQuote(nodeDeploymentShellCommand(d, false)),
+		shellQuote(nodeDeploymentTokenHeader+": "+token),
+		shellQuote(strings.TrimRight(baseURL, "/")+nodeDeploymentReportPath))
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// runNodeDeployment 通过 SSH 执行部署并登记节点，结果写回部署记录
+func runNodeDeployment(ctx context.Context, repo *storage.TrafficRepository, d storage.NodeDeployment, reinstall bool) error {
+	logger.Info("[节点部署] 开始执行", "deployment", d.Name, "host", d.Host, "script", d.Script, "reinstall", reinstall)
+
+	command := nodeDeploymentShellCommand(d, reinstall)
+	if d.TLSDomain != "" {
+		credential, err := repo.GetDNSCredential(ctx, d.DNSCredentialID, d.Username)
+		if err == nil {
+			var issue string
+			if issue, err = acmeIssueScript(credential, d.TLSDomain); err == nil {
+				command = issue + "; " + command
+			}
+		}
+		if err != nil {
+			err = fmt.Errorf("签发证书失败: %w", err)
+			if updateErr := repo.UpdateNodeDeploymentStatus(context.Background(), d.ID, storage.NodeDeploymentStatusFailed, err.Error(), "", nil); updateErr != nil {
+				logger.Warn("[节点部署] 更新状态失败", "deployment", d.Name, "error", updateErr)
+			}
+			return err
+		}
+		defer func() {
+			if err := repo.TouchDNSCredential(context.Background(), credential.ID); err != nil {
+				logger.Warn("[节点部署] 更新 DNS 凭据使用时间失败", "credential", credential.Name, "error", err)
+			}
+		}()
+	}
+
+	output, err := runNodeDeploymentSSH(ctx, repo, d, command)
+	if err != nil {
+		if updateErr := repo.UpdateNodeDeploymentStatus(context.Background(), d.ID, storage.NodeDeploymentStatusFailed, err.Error(), output, nil); updateErr != nil {
+			logger.Warn("[节点部署] 更新状态失败", "deployment", d.Name, "error", updateErr)
+		}
+		return err
+	}
+
+	return finishNodeDeployment(ctx, repo, d, output)
+}
+
+// finishNodeDeployment 从执行输出中登记节点并记录结果
+func finishNodeDeployment(ctx context.Context, repo *storage.TrafficRepository, d storage.NodeDeployment, output string) error {
+	nodeIDs, err := registerNodeDeploymentNodes(ctx, repo, d, output)
+	status, lastError := storage.NodeDeploymentStatusSucceeded, ""
+	if err != nil {
+		status, lastError = storage.NodeDeploymentStatusFailed, err.Error()
+	}
+	if updateErr := repo.UpdateNodeDeploymentStatus(context.Background(), d.ID, status, lastError, output, nodeIDs); updateErr != nil {
+		logger.Warn("[节点部署] 更新状态失败", "deployment", d.Name, "error", updateErr)
+	}
+	if err != nil {
+		return err
+	}
+	logger.Info("[节点部署] 节点已登记", "deployment", d.Name, "nodes", len(nodeIDs))
+	return nil
+}
+
+// runNodeDeploymentSSH 登录服务器执行命令，返回合并后的输出。首次连接时记录主机密钥指纹，之后不匹配则拒绝连接
+func runNodeDeploymentSSH(ctx context.Context, repo *storage.TrafficRepository, d storage.NodeDeployment, command string) (string, error) {
+	var authMethod ssh.AuthMethod
+	switch d.AuthType {
+	case "key":
+		signer, err := ssh.ParsePrivateKey([]byte(d.Credential))
+		if err != nil {
+			return "", fmt.Errorf("私钥无效: %w", err)
+		}
+		authMethod = ssh.PublicKeys(signer)
+	case "password":
+		authMethod = ssh.Password(d.Credential)
+	default:
+		return "", errors.New("缺少 SSH 凭据")
+	}
+
+	var pinned string
+	config := &ssh.ClientConfig{
+		User:    d.SSHUser,
+		Auth:    []ssh.AuthMethod{authMethod},
+		Timeout: nodeDeploymentDialTimeout,
+		HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			fingerprint := ssh.FingerprintSHA256(key)
+			if d.HostKey == "" {
+				pinned = fingerprint
+				return nil
+			}
+			if fingerprint != d.HostKey {
+				return fmt.Errorf("主机密钥不匹配：%s，已记录的是 %s", fingerprint, d.HostKey)
+			}
+			return nil
+		},
+	}
+
+	client, err := ssh.Dial("tcp", net.JoinHostPort(d.Host, strconv.Itoa(d.Port)), config)
+	if err != nil {
+		return "", fmt.Errorf("SSH 连接失败: %w", err)
+	}
+	defer client.Close()
+
+	if pinned != "" {
+		if err := repo.SetNodeDeploymentHostKey(ctx, d.ID, pinned); err != nil {
+			logger.Warn("[节点部署] 记录主机密钥失败", "deployment", d.Name, "error", err)
+		}
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("创建 SSH 会话失败: %w", err)
+	}
+	defer session.Close()
+
+	output := &tailBuffer{limit: maxNodeDeploymentOutput}
+	session.Stdout = output
+	session.Stderr = output
+
+	remote := "bash -c " + shellQuote(command)
+	if d.SSHUser != "root" {
+		remote = "sudo -n " + remote
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- session.Run(remote) }()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		_ = session.Signal(ssh.SIGKILL)
+		client.Close()
+		return output.String(), fmt.Errorf("执行超时: %w", ctx.Err())
+	}
+	if err != nil {
+		return output.String(), fmt.Errorf("执行命令失败: %w", err)
+	}
+	return output.String(), nil
+}
+
+// registerNodeDeploymentNodes 解析输出中的分享链接并登记为节点。再次执行时按顺序更新之前登记的节点，
+// 多出的链接新建节点；配置了探针服务器时完成绑定
+func registerNodeDeploymentNodes(ctx context.Context, repo *storage.TrafficRepository, d storage.NodeDeployment, output string) ([]int64, error) {
+	links := extractShareLinks(output)
+	if len(links) == 0 {
+		return nil, errors.New("输出中未找到可识别的分享链接")
+	}
+
+	type parsedLink struct {
+		raw   string
+		proxy map[string]any
+	}
+	parsed := make([]parsedLink, 0, len(links))
+	for _, link := range links {
+		proxy, err := ParseProxyURL(link)
+		if err != nil {
+			logger.Warn("[节点部署] 分享链接解析失败", "deployment", d.Name, "error", err)
+			continue
+		}
+		parsed = append(parsed, parsedLink{raw: link, proxy: proxy})
+	}
+	if len(parsed) == 0 {
+		return nil, errors.New("输出中的分享链接均无法解析")
+	}
+
+	normalizer := loadNodeNameNormalizer(ctx, repo)
+	nodeIDs := make([]int64, 0, len(parsed))
+	for i, item := range parsed {
+		name := d.Name
+		if len(parsed) > 1 {
+			name = fmt.Sprintf("%s %d", d.Name, i+1)
+		}
+		item.proxy["name"] = name
+		clashConfig, err := json.Marshal(item.proxy)
+		if err != nil {
+			return nodeIDs, fmt.Errorf("编码节点配置失败: %w", err)
+		}
+		protocol, _ := item.proxy["type"].(string)
+
+		node := storage.Node{
+			Username:     d.Username,
+			RawURL:       item.raw,
+			NodeName:     name,
+			Protocol:     protocol,
+			ParsedConfig: string(clashConfig),
+			ClashConfig:  string(clashConfig),
+			Enabled:      true,
+			Tag:          d.Tag,
+		}
+
+		var saved storage.Node
+		existing, err := storage.Node{}, storage.ErrNodeNotFound
+		if i < len(d.NodeIDs) {
+			existing, err = repo.GetNode(ctx, d.NodeIDs[i], d.Username)
+		}
+		if err == nil {
+			node.ID = existing.ID
+			node.Enabled = existing.Enabled
+			node.ProbeServer = existing.ProbeServer
+			node.OriginalServer = existing.OriginalServer
+			if node.Tag == "" {
+				node.Tag = existing.Tag
+			}
+			saved, err = repo.UpdateNode(ctx, node)
+		} else if errors.Is(err, storage.ErrNodeNotFound) {
+			saved, err = repo.CreateNode(ctx, node)
+		}
+		if err != nil {
+			return nodeIDs, fmt.Errorf("登记节点 %s 失败: %w", name, err)
+		}
+		nodeIDs = append(nodeIDs, saved.ID)
+
+		probeServer := d.ProbeServer
+		if strings.EqualFold(probeServer, probeBindingAuto) {
+			probeServer = resolveProbeServerByName(ctx, repo, normalizer, name)
+		}
+		if probeServer != "" && probeServer != saved.ProbeServer {
+			if err := repo.UpdateNodeProbeServer(ctx, saved.ID, d.Username, probeServer); err != nil {
+				logger.Warn("[节点部署] 绑定探针服务器失败", "node", name, "probe_server", probeServer, "error", err)
+			}
+		}
+	}
+	return nodeIDs, nil
+}
+
+// extractShareLinks 去掉终端颜色控制符后提取输出中的分享链接（去重，保持顺序）
+func extractShareLinks(output string) []string {
+	cleaned := ansiEscapePattern.ReplaceAllString(output, "")
+	seen := make(map[string]bool)
+	var links []string
+	for _, link := range shareLinkPattern.FindAllString(cleaned, -1) {
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// tailBuffer 只保留写入内容的末尾 limit 字节
+type tailBuffer struct {
+	mu    sync.Mutex
+	limit int
+	data  []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = append(b.data, p...)
+	if len(b.data) > b.limit {
+		b.data = append(b.data[:0], b.data[len(b.data)-b.limit:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.data)
+}
+
+// NewNodeDeploymentReportHandler 接收 agent 方式部署的执行输出，使用部署令牌认证
+func NewNodeDeploymentReportHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("node deployment report handler requires repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+
+		token := strings.TrimSpace(r.Header.Get(nodeDeploymentTokenHeader))
+		if token == "" {
+			token = strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		}
+		d, err := repo.GetNodeDeploymentByToken(r.Context(), token)
+		if err != nil {
+			if errors.Is(err, storage.ErrNodeDeploymentNotFound) {
+				writeError(w, http.StatusUnauthorized, errors.New("部署令牌无效"))
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxNodeDeploymentReport))
+		if err != nil {
+			writeBadRequest(w, "上报内容过大")
+			return
+		}
+
+		if err := finishNodeDeployment(r.Context(), repo, d, string(body)); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		updated, err := repo.GetNodeDeployment(r.Context(), d.ID, d.Username)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]any{
+			"status": updated.Status,
+			"nodes":  len(updated.NodeIDs),
+		})
+	})
+}
@@ -0,0 +1,279 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+type nodeImportSourceDTO struct {
+	SourceURL   string    `json:"source_url"`
+	ImportBatch string    `json:"import_batch"`
+	NodeCount   int       `json:"node_count"`
+	Tags        []string  `json:"tags"`
+	ImportedAt  time.Time `json:"imported_at"`
+}
+
+// nodeImportSourceRequest 选择一组导入的节点：source_url 和 import_batch 至少填写一个，都填写时取交集
+type nodeImportSourceRequest struct {
+	SourceURL   string `json:"source_url"`
+	ImportBatch string `json:"import_batch"`
+}
+
+// handleListSources 列出节点的导入来源（订阅地址 + 批次），与用户后来修改的标签无关
+func (h *nodesHandler) handleListSources(w http.ResponseWriter, r *http.Request) {
+	username := auth.UsernameFromContext(r.Context())
+	if username == "" {
+		writeError(w, http.StatusUnauthorized, errors.New("用户未认证"))
+		return
+	}
+
+	sources, err := h.repo.ListNodeImportSources(r.Context(), username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]nodeImportSourceDTO, 0, len(sources))
+	for _, source := range sources {
+		items = append(items, nodeImportSourceDTO{
+			SourceURL:   source.SourceURL,
+			ImportBatch: source.ImportBatch,
+			NodeCount:   source.NodeCount,
+			Tags:        source.Tags,
+			ImportedAt:  source.ImportedAt,
+		})
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"sources": items,
+	})
+}
+
+// loadSourceNodes 解析请求并返回选中的节点，出错时已写入响应
+func (h *nodesHandler) loadSourceNodes(w http.ResponseWriter, r *http.Request, username string) (nodeImportSourceRequest, []storage.Node, bool) {
+	var req nodeImportSourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBadRequest(w, "请求格式不正确")
+		return req, nil, false
+	}
+	req.SourceURL = strings.TrimSpace(req.SourceURL)
+	req.ImportBatch = strings.TrimSpace(req.ImportBatch)
+	if req.SourceURL == "" && req.ImportBatch == "" {
+		writeBadRequest(w, "source_url 和 import_batch 至少填写一个")
+		return req, nil, false
+	}
+
+	nodes, err := h.repo.ListNodesBySource(r.Context(), username, req.SourceURL, req.ImportBatch)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return req, nil, false
+	}
+	if len(nodes) == 0 {
+		writeError(w, http.StatusNotFound, errors.New("没有来自该来源的节点"))
+		return req, nil, false
+	}
+	return req, nodes, true
+}
+
+// handleDeleteSource 删除来自指定来源的全部节点
+func (h *nodesHandler) handleDeleteSource(w http.ResponseWriter, r *http.Request) {
+	username := auth.UsernameFromContext(r.Context())
+	if username == "" {
+		writeError(w, http.StatusUnauthorized, errors.New("用户未认证"))
+		return
+	}
+
+	req, nodes, ok := h.loadSourceNodes(w, r, username)
+	if !ok {
+		return
+	}
+
+	deleted := h.deleteNodes(r, username, nodes)
+	logger.Info("[节点来源] 已删除来源节点", "user", username, "source_url", logger.Redact(req.SourceURL), "import_batch", req.ImportBatch, "deleted", len(deleted))
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"status":  "deleted",
+		"deleted": len(deleted),
+		"total":   len(nodes),
+	})
+}
+
+// handleRefreshSource 重新拉取来源订阅，只更新该来源的节点：按名称匹配的节点更新配置（保留标签、启用状态和探针绑定），
+// 新增的节点归入同一来源，订阅中已不存在的节点被删除
+func (h *nodesHandler) handleRefreshSource(w http.ResponseWriter, r *http.Request) {
+	username := auth.UsernameFromContext(r.Context())
+	if username == "" {
+		writeError(w, http.StatusUnauthorized, errors.New("用户未认证"))
+		return
+	}
+
+	req, nodes, ok := h.loadSourceNodes(w, r, username)
+	if !ok {
+		return
+	}
+	if req.SourceURL == "" {
+		req.SourceURL = nodes[0].SourceURL
+		for _, node := range nodes {
+			if node.SourceURL != req.SourceURL {
+				writeBadRequest(w, "该批次包含多个来源，请指定 source_url")
+				return
+			}
+		}
+	}
+	if req.SourceURL == "" {
+		writeBadRequest(w, "该批次没有来源订阅地址，无法刷新")
+		return
+	}
+
+	// 已保存为外部订阅时沿用其 User-Agent、请求头、代理和重命名规则
+	sub := storage.ExternalSubscription{Name: req.SourceURL, URL: req.SourceURL}
+	if subs, err := h.repo.ListExternalSubscriptions(r.Context(), username); err == nil {
+		for _, s := range subs {
+			if s.URL == req.SourceURL {
+				sub = s
+				break
+			}
+		}
+	}
+	settings, err := h.repo.GetUserSettings(r.Context(), username)
+	if err != nil {
+		settings = storage.UserSettings{}
+	}
+	settings.SyncTraffic = settings.SyncTraffic && sub.ID > 0
+
+	fetched, _, err := fetchExternalSubscriptionNodes(r.Context(), &http.Client{Timeout: 30 * time.Second}, h.repo, username, sub, settings)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, errors.New(logger.Redact("拉取来源订阅失败: "+err.Error())))
+		return
+	}
+
+	existing, err := h.repo.ListNodes(r.Context(), username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	normalizer := loadNodeNameNormalizer(r.Context(), h.repo)
+	inSource := make(map[int64]bool, len(nodes))
+	for _, node := range nodes {
+		inSource[node.ID] = true
+	}
+	otherKeys := make(map[string]bool)
+	for _, node := range existing {
+		if !inSource[node.ID] {
+			otherKeys[normalizer.Key(node.NodeName)] = true
+		}
+	}
+	byKey := make(map[string]int, len(nodes))
+	for i, node := range nodes {
+		byKey[normalizer.Key(node.NodeName)] = i
+	}
+
+	matched := make(map[int64]bool, len(nodes))
+	updated := 0
+	var toCreate []storage.Node
+	for _, node := range fetched {
+		key := normalizer.Key(node.NodeName)
+		idx, ok := byKey[key]
+		if !ok {
+			if otherKeys[key] {
+				logger.Info("[节点来源] 跳过与其他节点重名的新节点", "node_name", node.NodeName)
+				continue
+			}
+			otherKeys[key] = true
+			node.Tag = nodes[0].Tag
+			node.SourceURL = req.SourceURL
+			node.ImportBatch = req.ImportBatch
+			toCreate = append(toCreate, node)
+			continue
+		}
+
+		current := nodes[idx]
+		if matched[current.ID] {
+			continue
+		}
+		matched[current.ID] = true
+		current.Protocol = node.Protocol
+		current.ParsedConfig = setNodeConfigName(node.ParsedConfig, current.NodeName)
+		current.ClashConfig = setNodeConfigName(node.ClashConfig, current.NodeName)
+		saved, err := h.repo.UpdateNode(r.Context(), current)
+		if err != nil {
+			logger.Info("[节点来源] 更新节点失败", "node_name", current.NodeName, "error", err)
+			continue
+		}
+		if h.subscribeDir != "" {
+			if err := syncNodeToYAMLFiles(h.subscribeDir, saved.NodeName, saved.NodeName, saved.ClashOutput()); err != nil {
+				logger.Info("[节点来源] 同步节点到YAML文件失败", "node_name", saved.NodeName, "error", err)
+			}
+		}
+		updated++
+	}
+
+	var created []storage.Node
+	if len(toCreate) > 0 {
+		created, err = h.repo.BatchCreateNodes(r.Context(), toCreate)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		emitNodeWebhook(WebhookEventNodeCreated, username, created)
+	}
+
+	var stale []storage.Node
+	for _, node := range nodes {
+		if !matched[node.ID] {
+			stale = append(stale, node)
+		}
+	}
+	deleted := h.deleteNodes(r, username, stale)
+
+	logger.Info("[节点来源] 来源节点已刷新", "user", username, "source_url", logger.Redact(req.SourceURL), "import_batch", req.ImportBatch, "updated", updated, "created", len(created), "deleted", len(deleted))
+	respondJSON(w, http.StatusOK, map[string]any{
+		"status":  "refreshed",
+		"updated": updated,
+		"created": len(created),
+		"deleted": len(deleted),
+	})
+}
+
+// deleteNodes 删除节点并同步到 YAML 文件，返回实际删除的节点
+func (h *nodesHandler) deleteNodes(r *http.Request, username string, nodes []storage.Node) []storage.Node {
+	deleted := make([]storage.Node, 0, len(nodes))
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if err := h.repo.DeleteNode(r.Context(), node.ID, username); err != nil {
+			continue
+		}
+		deleted = append(deleted, node)
+		if node.NodeName != "" {
+			names = append(names, node.NodeName)
+		}
+	}
+	if len(names) > 0 {
+		if err := h.yamlSyncManager.BatchDeleteNodes(names); err != nil {
+			logger.Info("[节点来源] YAML 同步失败", "error", err)
+		}
+	}
+	emitNodeWebhook(WebhookEventNodeDeleted, username, deleted)
+	return deleted
+}
+
+// setNodeConfigName 将节点配置 JSON 中的 name 改为 name，解析失败时原样返回
+func setNodeConfigName(config, name string) string {
+	var parsed map[string]any
+	if err := json.Unmarshal([]byte(config), &parsed); err != nil {
+		return config
+	}
+	parsed["name"] = name
+	data, err := json.Marshal(parsed)
+	if err != nil {
+		return config
+	}
+	return string(data)
+}
@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	// nodeNameSeparators 节点名称中常见的分隔符，规范化时与空白、标点一起去除
+	nodeNameSeparators = "丨｜・·•"
+	// probeBindingAuto 绑定探针服务器时按节点名称自动匹配的特殊值
+	probeBindingAuto = "auto"
+)
+
+// nodeNameTraditionalPairs 节点名称中常见的繁体字到简体字映射（每两个字符为一组：繁、简）
+const nodeNameTraditionalPairs = "臺台灣湾國国韓韩東东爾尔蘭兰馬马來来亞亚羅罗紐纽約约聖圣義义專专線线節节點点門门" +
+	"電电訊讯網网雲云機机廣广滬沪蘇苏華华條条務务際际級级實实驗验優优質质備备測测試试連连動动聯联" +
+	"倫伦盧卢維维納纳麥麦緬缅賓宾邊边錄录龍龙鳳凤劃划區区號号組组轉转發发負负載载極极屬属獨独標标" +
+	"準准進进階阶頂顶無无價价費费餘余時时間间過过計计層层殼壳島岛鐵铁"
+
+var nodeNameTraditionalMap = func() map[rune]rune {
+	runes := []rune(nodeNameTraditionalPairs)
+	m := make(map[rune]rune, len(runes)/2)
+	for i := 0; i+1 < len(runes); i += 2 {
+		m[runes[i]] = runes[i+1]
+	}
+	return m
+}()
+
+// nodeNameNormalizer 生成节点名称的规范化匹配键，使 "香港 01"、"ＨＫ－01"、"HK-1" 得到相同的键。
+// 未启用时键即为去除首尾空白的原名称，匹配行为与之前一致。
+type nodeNameNormalizer struct {
+	enabled    bool
+	simplify   bool
+	stripEmoji bool
+}
+
+func newNodeNameNormalizer(cfg storage.SystemConfig) nodeNameNormalizer {
+	return nodeNameNormalizer{
+		enabled:    cfg.NodeNameNormalize,
+		simplify:   cfg.NodeNameSimplify,
+		stripEmoji: cfg.NodeNameStripEmoji,
+	}
+}
+
+// loadNodeNameNormalizer 读取系统配置中的规范化选项，读取失败时退回精确匹配
+func loadNodeNameNormalizer(ctx context.Context, repo *storage.TrafficRepository) nodeNameNormalizer {
+	if repo == nil {
+		return nodeNameNormalizer{}
+	}
+	cfg, err := repo.GetSystemConfig(ctx)
+	if err != nil {
+		logger.Warn("[节点名称规范化] 读取系统配置失败，使用精确匹配", "error", err)
+		return nodeNameNormalizer{}
+	}
+	return newNodeNameNormalizer(cfg)
+}
+
+// Key 返回节点名称的匹配键：全角转半角、可选繁转简和去除 emoji、地区名称转为地区代码、
+// 去除空白与分隔符、统一大小写并去掉编号前导零
+func (n nodeNameNormalizer) Key(name string) string {
+	name = strings.TrimSpace(name)
+	if !n.enabled {
+		return name
+	}
+
+	var folded strings.Builder
+	for _, r := range name {
+		switch {
+		case r == 0x3000:
+			r = ' '
+		case r >= 0xFF01 && r <= 0xFF5E:
+			r -= 0xFEE0
+		}
+		if n.simplify {
+			if s, ok := nodeNameTraditionalMap[r]; ok {
+				r = s
+			}
+		}
+		if r == 0xFE0F || r == 0x200D || (n.stripEmoji && isEmojiRune(r)) {
+			continue
+		}
+		folded.WriteRune(unicode.ToLower(r))
+	}
+
+	lower := folded.String()
+	for _, item := range storage.NodeRegionKeywords {
+		lower = strings.ReplaceAll(lower, item.Keyword, strings.ToLower(item.Region))
+	}
+
+	var key strings.Builder
+	var digits strings.Builder
+	flushDigits := func() {
+		if digits.Len() == 0 {
+			return
+		}
+		number := strings.TrimLeft(digits.String(), "0")
+		if number == "" {
+			number = "0"
+		}
+		key.WriteString(number)
+		digits.Reset()
+	}
+	for _, r := range lower {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+			continue
+		}
+		flushDigits()
+		if unicode.IsSpace(r) || unicode.IsPunct(r) || strings.ContainsRune(nodeNameSeparators, r) {
+			continue
+		}
+		if unicode.IsSymbol(r) && !isEmojiRune(r) {
+			continue
+		}
+		key.WriteRune(r)
+	}
+	flushDigits()
+
+	if key.Len() == 0 {
+		return name
+	}
+	return key.String()
+}
+
+// Equal 判断两个节点名称规范化后是否相同
+func (n nodeNameNormalizer) Equal(a, b string) bool {
+	return n.Key(a) == n.Key(b)
+}
+
+// isEmojiRune 判断字符是否属于 emoji（含国旗区域指示符、杂项符号与装饰符号）
+func isEmojiRune(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF:
+		return true
+	case r >= 0x2600 && r <= 0x27BF:
+		return true
+	case r >= 0x2B00 && r <= 0x2BFF:
+		return true
+	case r == 0x20E3 || (r >= 0xE0020 && r <= 0xE007F):
+		return true
+	}
+	return false
+}
+
+// findNodeNameConflict 返回与 name 规范化后相同的已有节点名称（排除 excludeID），没有冲突时返回空字符串
+func findNodeNameConflict(nodes []storage.Node, normalizer nodeNameNormalizer, name string, excludeID int64) string {
+	key := normalizer.Key(name)
+	for _, node := range nodes {
+		if node.ID == excludeID {
+			continue
+		}
+		if normalizer.Key(node.NodeName) == key {
+			return node.NodeName
+		}
+	}
+	return ""
+}
+
+// resolveProbeServerByName 在已配置的探针服务器中查找与 name 规范化后相同的服务器名称，找不到时返回空字符串
+func resolveProbeServerByName(ctx context.Context, repo *storage.TrafficRepository, normalizer nodeNameNormalizer, name string) string {
+	configs, err := repo.ListProbeConfigs(ctx)
+	if err != nil {
+		logger.Warn("[节点名称规范化] 获取探针服务器列表失败", "error", err)
+		return ""
+	}
+
+	key := normalizer.Key(name)
+	for _, cfg := range configs {
+		for _, srv := range cfg.Servers {
+			if strings.TrimSpace(srv.Name) == strings.TrimSpace(name) {
+				return srv.Name
+			}
+		}
+	}
+	for _, cfg := range configs {
+		for _, srv := range cfg.Servers {
+			if normalizer.Key(srv.Name) == key {
+				return srv.Name
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	defaultNodePoolTrendDays = 30
+	maxNodePoolTrendDays     = 365
+)
+
+type nodePoolSnapshotPayload struct {
+	Date         string         `json:"date"`
+	TotalNodes   int            `json:"total_nodes"`
+	EnabledNodes int            `json:"enabled_nodes"`
+	ByProtocol   map[string]int `json:"by_protocol"`
+	ByTag        map[string]int `json:"by_tag"`
+	ByRegion     map[string]int `json:"by_region"`
+}
+
+// buildNodePoolSnapshot 统计节点池的协议、标签、地区分布
+func buildNodePoolSnapshot(username string, date time.Time, nodes []storage.Node) storage.NodePoolSnapshot {
+	snapshot := storage.NodePoolSnapshot{
+		Date:       date,
+		Username:   username,
+		TotalNodes: len(nodes),
+		ByProtocol: make(map[string]int),
+		ByTag:      make(map[string]int),
+		ByRegion:   make(map[string]int),
+	}
+
+	for _, node := range nodes {
+		if node.Enabled {
+			snapshot.EnabledNodes++
+		}
+
+		protocol := strings.ToLower(strings.TrimSpace(node.Protocol))
+		if protocol == "" {
+			protocol = "unknown"
+		}
+		snapshot.ByProtocol[protocol]++
+
+		tag := strings.TrimSpace(node.Tag)
+		if tag == "" {
+			tag = "personal"
+		}
+		snapshot.ByTag[tag]++
+
+		snapshot.ByRegion[storage.DetectNodeRegion(node.NodeName)]++
+	}
+
+	return snapshot
+}
+
+// RecordNodePoolSnapshots 为所有拥有节点的用户记录当日节点池快照
+func RecordNodePoolSnapshots(ctx context.Context, repo *storage.TrafficRepository) error {
+	if repo == nil {
+		return errors.New("node pool snapshot requires repository")
+	}
+
+	usernames, err := repo.ListNodeUsernames(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	recorded := 0
+	for _, username := range usernames {
+		nodes, err := repo.ListNodes(ctx, username)
+		if err != nil {
+			logger.Warn("[节点池快照] 获取用户节点失败", "username", username, "error", err)
+			continue
+		}
+
+		snapshot := buildNodePoolSnapshot(username, now, nodes)
+		if err := repo.RecordNodePoolSnapshot(ctx, snapshot); err != nil {
+			logger.Warn("[节点池快照] 保存快照失败", "username", username, "error", err)
+			continue
+		}
+		recorded++
+	}
+
+	logger.Info("[节点池快照] 快照记录完成", "users", recorded)
+	return nil
+}
+
+// NewNodePoolTrendHandler returns the current user's node pool composition history.
+func NewNodePoolTrendHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("node pool trend handler requires repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+
+		username := auth.UsernameFromContext(r.Context())
+		if strings.TrimSpace(username) == "" {
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+
+		days := defaultNodePoolTrendDays
+		if raw := strings.TrimSpace(r.URL.Query().Get("days")); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed <= 0 {
+				writeBadRequest(w, "days 参数无效")
+				return
+			}
+			if parsed > maxNodePoolTrendDays {
+				parsed = maxNodePoolTrendDays
+			}
+			days = parsed
+		}
+
+		snapshots, err := repo.ListNodePoolSnapshots(r.Context(), username, days)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		history := make([]nodePoolSnapshotPayload, 0, len(snapshots))
+		for _, snapshot := range snapshots {
+			history = append(history, nodePoolSnapshotPayload{
+				Date:         snapshot.Date.Format("2006-01-02"),
+				TotalNodes:   snapshot.TotalNodes,
+				EnabledNodes: snapshot.EnabledNodes,
+				ByProtocol:   snapshot.ByProtocol,
+				ByTag:        snapshot.ByTag,
+				ByRegion:     snapshot.ByRegion,
+			})
+		}
+
+		respondJSON(w, http.StatusOK, map[string]any{
+			"history": history,
+		})
+	})
+}
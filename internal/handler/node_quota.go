@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+// EnforceProbeServerQuotas disables the nodes bound to probe servers whose cycle usage (from the
+// per-server snapshots of the day of now) reached the monthly limit, and re-enables them once the
+// server is back under its limit, e.g. after the cycle reset. It only applies to users with probe
+// binding and auto-disable enabled; nodes of other users that were disabled earlier are restored.
+func EnforceProbeServerQuotas(ctx context.Context, repo *storage.TrafficRepository, now time.Time) error {
+	if repo == nil {
+		return errors.New("quota enforcement requires repository")
+	}
+
+	records, err := repo.ListProbeServerDailyOn(ctx, now)
+	if err != nil {
+		return err
+	}
+	configs, err := repo.ListProbeConfigs(ctx)
+	if err != nil && !errors.Is(err, storage.ErrProbeConfigNotFound) {
+		return err
+	}
+
+	names := make(map[string]string)
+	for _, cfg := range configs {
+		for _, srv := range cfg.Servers {
+			names[fmt.Sprintf("%d:%s", cfg.ID, srv.ServerID)] = strings.TrimSpace(srv.Name)
+		}
+	}
+
+	// 节点按服务器名称绑定；同名服务器任一超额即视为超额，没有当天快照的服务器状态未知，保持不变
+	over := make(map[string]storage.ProbeServerTrafficRecord)
+	under := make(map[string]struct{})
+	for _, record := range records {
+		name := names[fmt.Sprintf("%d:%s", record.ConfigID, record.ServerID)]
+		if name == "" {
+			continue
+		}
+		if record.LimitBytes > 0 && record.UsedBytes >= record.LimitBytes {
+			over[name] = record
+		} else {
+			under[name] = struct{}{}
+		}
+	}
+	// 仍超额或状态未知的服务器，其节点保持禁用
+	keepSet := make(map[string]struct{})
+	for _, name := range names {
+		_, isUnder := under[name]
+		_, isOver := over[name]
+		if isOver || !isUnder {
+			keepSet[name] = struct{}{}
+		}
+	}
+	keep := make([]string, 0, len(keepSet))
+	for name := range keepSet {
+		keep = append(keep, name)
+	}
+	sort.Strings(keep)
+
+	users, err := repo.ListUsers(ctx, 1000)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		settings, err := repo.GetUserSettings(ctx, user.Username)
+		if err != nil {
+			if !errors.Is(err, storage.ErrUserSettingsNotFound) {
+				logger.Warn("[流量超额] 读取用户设置失败", "username", user.Username, "error", err)
+			}
+			continue
+		}
+
+		restoreKeep := keep
+		if settings.EnableProbeBinding && settings.AutoDisableOverQuota {
+			for name, record := range over {
+				disabled, err := repo.DisableNodesOverQuota(ctx, user.Username, name)
+				if err != nil {
+					logger.Warn("[流量超额] 禁用节点失败", "username", user.Username, "probe_server", name, "error", err)
+					continue
+				}
+				if disabled > 0 {
+					logger.Info("[流量超额] 服务器流量超额，已禁用绑定节点", "username", user.Username, "probe_server", name, "count", disabled)
+					emitWebhookEvent(WebhookEventQuotaExceeded, map[string]any{
+						"username":       user.Username,
+						"probe_server":   name,
+						"used_bytes":     record.UsedBytes,
+						"limit_bytes":    record.LimitBytes,
+						"disabled_nodes": disabled,
+					})
+				}
+			}
+		} else {
+			// 功能关闭后恢复之前自动禁用的节点
+			restoreKeep = nil
+		}
+
+		restored, err := repo.RestoreQuotaDisabledNodes(ctx, user.Username, restoreKeep)
+		if err != nil {
+			logger.Warn("[流量超额] 恢复节点失败", "username", user.Username, "error", err)
+			continue
+		}
+		if restored > 0 {
+			logger.Info("[流量超额] 已重新启用自动禁用的节点", "username", user.Username, "count", restored)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,549 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	nodeScheduleInterval = time.Minute
+	// nodeScheduleLookback 首次评估 cron 计划时向前查找最近一次触发的范围
+	nodeScheduleLookback = 7 * 24 * time.Hour
+)
+
+type nodeScheduleRequest struct {
+	Windows     []storage.NodeScheduleWindow `json:"windows"`
+	EnableCron  string                       `json:"enable_cron"`
+	DisableCron string                       `json:"disable_cron"`
+	Timezone    string                       `json:"timezone"`
+}
+
+type nodeScheduleDTO struct {
+	NodeID           int64                        `json:"node_id"`
+	NodeName         string                       `json:"node_name"`
+	Windows          []storage.NodeScheduleWindow `json:"windows"`
+	EnableCron       string                       `json:"enable_cron"`
+	DisableCron      string                       `json:"disable_cron"`
+	Timezone         string                       `json:"timezone"`
+	ScheduleDisabled bool                         `json:"schedule_disabled"`
+	UpdatedAt        time.Time                    `json:"updated_at"`
+}
+
+func convertNodeSchedule(schedule storage.NodeSchedule) nodeScheduleDTO {
+	windows := schedule.Windows
+	if windows == nil {
+		windows = []storage.NodeScheduleWindow{}
+	}
+	return nodeScheduleDTO{
+		NodeID:           schedule.NodeID,
+		NodeName:         schedule.NodeName,
+		Windows:          windows,
+		EnableCron:       schedule.EnableCron,
+		DisableCron:      schedule.DisableCron,
+		Timezone:         schedule.Timezone,
+		ScheduleDisabled: schedule.ScheduleDisabled,
+		UpdatedAt:        schedule.UpdatedAt,
+	}
+}
+
+// parseScheduleClock 解析 HH:MM，返回当天的分钟数
+func parseScheduleClock(value string) (int, error) {
+	parsed, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("时间格式应为 HH:MM: %s", value)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// validateNodeSchedule 校验定时计划：时间窗口与 cron 二选一，cron 模式需要同时提供启用和禁用表达式
+func validateNodeSchedule(schedule storage.NodeSchedule) error {
+	hasCron := strings.TrimSpace(schedule.EnableCron) != "" || strings.TrimSpace(schedule.DisableCron) != ""
+	if len(schedule.Windows) > 0 && hasCron {
+		return errors.New("时间窗口和 cron 表达式只能选择一种")
+	}
+	if len(schedule.Windows) == 0 && !hasCron {
+		return errors.New("请设置时间窗口或 cron 表达式")
+	}
+
+	for _, window := range schedule.Windows {
+		if _, err := parseScheduleClock(window.Start); err != nil {
+			return err
+		}
+		if _, err := parseScheduleClock(window.End); err != nil {
+			return err
+		}
+		for _, day := range window.Days {
+			if day < 0 || day > 6 {
+				return fmt.Errorf("星期取值范围为 0-6（0 为周日）: %d", day)
+			}
+		}
+	}
+
+	if hasCron {
+		if strings.TrimSpace(schedule.EnableCron) == "" || strings.TrimSpace(schedule.DisableCron) == "" {
+			return errors.New("cron 模式需要同时设置启用和禁用表达式")
+		}
+		if _, err := parseCronSchedule(schedule.EnableCron); err != nil {
+			return fmt.Errorf("启用 cron 表达式无效: %w", err)
+		}
+		if _, err := parseCronSchedule(schedule.DisableCron); err != nil {
+			return fmt.Errorf("禁用 cron 表达式无效: %w", err)
+		}
+	}
+
+	if tz := strings.TrimSpace(schedule.Timezone); tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			return fmt.Errorf("无效的时区: %s", tz)
+		}
+	}
+	return nil
+}
+
+func scheduleHasDay(days []int, weekday time.Weekday) bool {
+	if len(days) == 0 {
+		return true
+	}
+	for _, day := range days {
+		if day == int(weekday) {
+			return true
+		}
+	}
+	return false
+}
+
+// windowsActive 判断 now 是否落在任一时间窗口内；跨午夜的窗口按开始的那天匹配星期
+func windowsActive(windows []storage.NodeScheduleWindow, now time.Time) bool {
+	minute := now.Hour()*60 + now.Minute()
+	for _, window := range windows {
+		start, err := parseScheduleClock(window.Start)
+		if err != nil {
+			continue
+		}
+		end, err := parseScheduleClock(window.End)
+		if err != nil {
+			continue
+		}
+
+		today := scheduleHasDay(window.Days, now.Weekday())
+		switch {
+		case start == end:
+			if today {
+				return true
+			}
+		case start < end:
+			if today && minute >= start && minute < end {
+				return true
+			}
+		default:
+			yesterday := scheduleHasDay(window.Days, now.AddDate(0, 0, -1).Weekday())
+			if (today && minute >= start) || (yesterday && minute < end) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lastCronFire 返回 (since, now] 内表达式最后一次触发的时间，没有触发时为零值
+func lastCronFire(schedule *cronSchedule, since, now time.Time) time.Time {
+	var last time.Time
+	for t := since; ; {
+		next := schedule.Next(t)
+		if next.IsZero() || next.After(now) {
+			return last
+		}
+		last, t = next, next
+	}
+}
+
+// nodeScheduleWantsEnabled 计算节点在 now 时应处于的状态；cron 模式下 (since, now] 内没有触发时 known 为 false
+func nodeScheduleWantsEnabled(schedule storage.NodeSchedule, now, since time.Time) (enabled, known bool) {
+	if len(schedule.Windows) > 0 {
+		return windowsActive(schedule.Windows, now), true
+	}
+
+	enableCron, err := parseCronSchedule(schedule.EnableCron)
+	if err != nil {
+		return false, false
+	}
+	disableCron, err := parseCronSchedule(schedule.DisableCron)
+	if err != nil {
+		return false, false
+	}
+
+	enabledAt := lastCronFire(enableCron, since, now)
+	disabledAt := lastCronFire(disableCron, since, now)
+	if enabledAt.IsZero() && disabledAt.IsZero() {
+		return false, false
+	}
+	return !enabledAt.Before(disabledAt), true
+}
+
+// nodeScheduler 每分钟评估节点定时计划，切换节点启用状态并通知受影响的订阅文件
+type nodeScheduler struct {
+	repo         *storage.TrafficRepository
+	subscribeDir string
+	reload       chan struct{}
+	lastCheck    map[int64]time.Time
+}
+
+var globalNodeScheduler atomic.Pointer[nodeScheduler]
+
+// StartNodeScheduler runs the node schedules until ctx is cancelled.
+func StartNodeScheduler(ctx context.Context, repo *storage.TrafficRepository, subscribeDir string) {
+	if repo == nil {
+		return
+	}
+
+	s := &nodeScheduler{
+		repo:         repo,
+		subscribeDir: subscribeDir,
+		reload:       make(chan struct{}, 1),
+		lastCheck:    make(map[int64]time.Time),
+	}
+	globalNodeScheduler.Store(s)
+	defer globalNodeScheduler.CompareAndSwap(s, nil)
+
+	ticker := time.NewTicker(nodeScheduleInterval)
+	defer ticker.Stop()
+
+	logger.Info("[节点定时] 调度器已启动")
+	for {
+		s.apply(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			logger.Info("[节点定时] 调度器已停止")
+			return
+		case <-ticker.C:
+		case <-s.reload:
+		}
+	}
+}
+
+// ReloadNodeSchedules makes the node scheduler evaluate the schedules immediately.
+func ReloadNodeSchedules() {
+	s := globalNodeScheduler.Load()
+	if s == nil {
+		return
+	}
+	select {
+	case s.reload <- struct{}{}:
+	default:
+	}
+}
+
+func (s *nodeScheduler) apply(ctx context.Context, now time.Time) {
+	schedules, err := s.repo.ListNodeSchedules(ctx, "")
+	if err != nil {
+		logger.Warn("[节点定时] 读取定时计划失败", "error", err)
+		return
+	}
+
+	defaultLoc := time.UTC
+	if cfg, err := s.repo.GetSystemConfig(ctx); err == nil {
+		if loc, err := collectorLocation(cfg.CollectorTimezone); err == nil {
+			defaultLoc = loc
+		}
+	}
+
+	var changed []string
+	seen := make(map[int64]struct{}, len(schedules))
+	for _, schedule := range schedules {
+		seen[schedule.NodeID] = struct{}{}
+
+		loc := defaultLoc
+		if tz := strings.TrimSpace(schedule.Timezone); tz != "" {
+			if loaded, err := time.LoadLocation(tz); err == nil {
+				loc = loaded
+			}
+		}
+
+		since, ok := s.lastCheck[schedule.NodeID]
+		if !ok || schedule.UpdatedAt.After(since) {
+			since = now.Add(-nodeScheduleLookback)
+		}
+		s.lastCheck[schedule.NodeID] = now
+
+		enabled, known := nodeScheduleWantsEnabled(schedule, now.In(loc), since.In(loc))
+		if !known {
+			continue
+		}
+		// 已处于目标状态时无需操作：需要启用但并非由计划禁用的节点保持原状
+		if enabled != schedule.ScheduleDisabled {
+			continue
+		}
+
+		updated, err := s.repo.SetNodeScheduleState(ctx, schedule.NodeID, enabled)
+		if err != nil {
+			logger.Warn("[节点定时] 切换节点状态失败", "node_id", schedule.NodeID, "error", err)
+			continue
+		}
+		if updated {
+			logger.Info("[节点定时] 已切换节点状态", "node_id", schedule.NodeID, "node_name", schedule.NodeName, "enabled", enabled)
+			changed = append(changed, schedule.NodeName)
+		}
+	}
+
+	for nodeID := range s.lastCheck {
+		if _, ok := seen[nodeID]; !ok {
+			delete(s.lastCheck, nodeID)
+		}
+	}
+
+	notifyFilesReferencingNodes(s.subscribeDir, changed)
+}
+
+// notifyFilesReferencingNodes 通知包含这些节点的订阅文件内容已变化（清除 CDN 缓存）
+func notifyFilesReferencingNodes(subscribeDir string, names []string) {
+	if subscribeDir == "" || len(names) == 0 {
+		return
+	}
+
+	entries, err := os.ReadDir(subscribeDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		path := filepath.Join(subscribeDir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		for _, name := range names {
+			if bytes.Contains(data, []byte(name)) {
+				notifySubscribeFileChanged(path)
+				break
+			}
+		}
+	}
+}
+
+// stripNodesFromSubscription 从订阅 YAML 中移除指定节点及其在代理组、规则中的引用；
+// 代理组因此变为空时补充 DIRECT，避免客户端因空代理组报错
+func stripNodesFromSubscription(data []byte, names []string) ([]byte, bool) {
+	if len(names) == 0 {
+		return data, false
+	}
+	remove := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		remove[name] = struct{}{}
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return data, false
+	}
+	docNode := root.Content[0]
+
+	var removed []string
+	for i := 0; i+1 < len(docNode.Content); i += 2 {
+		if docNode.Content[i].Value != "proxies" || docNode.Content[i+1].Kind != yaml.SequenceNode {
+			continue
+		}
+		proxiesNode := docNode.Content[i+1]
+		kept := make([]*yaml.Node, 0, len(proxiesNode.Content))
+		for _, proxyNode := range proxiesNode.Content {
+			name := yamlMappingValue(proxyNode, "name")
+			if _, ok := remove[name]; ok && name != "" {
+				removed = append(removed, name)
+				continue
+			}
+			kept = append(kept, proxyNode)
+		}
+		proxiesNode.Content = kept
+		break
+	}
+	if len(removed) == 0 {
+		return data, false
+	}
+
+	for i := 0; i+1 < len(docNode.Content); i += 2 {
+		switch docNode.Content[i].Value {
+		case "proxy-groups":
+			groupsNode := docNode.Content[i+1]
+			for _, name := range removed {
+				removeNodeFromProxyGroupsNode(groupsNode, name)
+			}
+			fillEmptyProxyGroups(groupsNode)
+		case "rules":
+			for _, name := range removed {
+				removeNodeFromRulesNode(docNode.Content[i+1], name)
+			}
+		}
+	}
+
+	fixShortIdStyleInNode(&root)
+	output, err := MarshalYAMLWithIndent(&root)
+	if err != nil {
+		return data, false
+	}
+	return []byte(RemoveUnicodeEscapeQuotes(string(output))), true
+}
+
+func yamlMappingValue(node *yaml.Node, key string) string {
+	if node.Kind != yaml.MappingNode {
+		return ""
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1].Value
+		}
+	}
+	return ""
+}
+
+// fillEmptyProxyGroups 为没有任何节点来源的代理组补充 DIRECT
+func fillEmptyProxyGroups(groupsNode *yaml.Node) {
+	if groupsNode.Kind != yaml.SequenceNode {
+		return
+	}
+	for _, groupNode := range groupsNode.Content {
+		if groupNode.Kind != yaml.MappingNode {
+			continue
+		}
+		if yamlMappingValue(groupNode, "include-all") == "true" || yamlMappingValue(groupNode, "include-all-proxies") == "true" {
+			continue
+		}
+		hasUse := false
+		var proxiesNode *yaml.Node
+		for i := 0; i+1 < len(groupNode.Content); i += 2 {
+			switch groupNode.Content[i].Value {
+			case "use":
+				hasUse = len(groupNode.Content[i+1].Content) > 0
+			case "proxies":
+				proxiesNode = groupNode.Content[i+1]
+			}
+		}
+		if !hasUse && proxiesNode != nil && proxiesNode.Kind == yaml.SequenceNode && len(proxiesNode.Content) == 0 {
+			proxiesNode.Content = append(proxiesNode.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "DIRECT"})
+		}
+	}
+}
+
+func (h *nodesHandler) handleListSchedules(w http.ResponseWriter, r *http.Request) {
+	username := auth.UsernameFromContext(r.Context())
+	schedules, err := h.repo.ListNodeSchedules(r.Context(), username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]nodeScheduleDTO, 0, len(schedules))
+	for _, schedule := range schedules {
+		items = append(items, convertNodeSchedule(schedule))
+	}
+	respondJSON(w, http.StatusOK, map[string]any{
+		"schedules": items,
+	})
+}
+
+// handleSchedule 读取、设置或删除节点的定时启用计划
+func (h *nodesHandler) handleSchedule(w http.ResponseWriter, r *http.Request, idSegment string) {
+	username := auth.UsernameFromContext(r.Context())
+	if username == "" {
+		writeError(w, http.StatusUnauthorized, errors.New("用户未认证"))
+		return
+	}
+
+	nodeID, err := strconv.ParseInt(idSegment, 10, 64)
+	if err != nil || nodeID <= 0 {
+		writeBadRequest(w, "无效的节点ID")
+		return
+	}
+
+	ctx := r.Context()
+	switch r.Method {
+	case http.MethodGet:
+		schedule, err := h.repo.GetNodeSchedule(ctx, nodeID, username)
+		if err != nil {
+			if errors.Is(err, storage.ErrNodeScheduleNotFound) {
+				respondJSON(w, http.StatusOK, map[string]any{"schedule": nil})
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]any{"schedule": convertNodeSchedule(schedule)})
+
+	case http.MethodPut:
+		var req nodeScheduleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, "请求格式不正确")
+			return
+		}
+
+		schedule := storage.NodeSchedule{
+			NodeID:      nodeID,
+			Username:    username,
+			Windows:     req.Windows,
+			EnableCron:  strings.TrimSpace(req.EnableCron),
+			DisableCron: strings.TrimSpace(req.DisableCron),
+			Timezone:    strings.TrimSpace(req.Timezone),
+		}
+		if err := validateNodeSchedule(schedule); err != nil {
+			writeBadRequest(w, err.Error())
+			return
+		}
+
+		saved, err := h.repo.SaveNodeSchedule(ctx, schedule)
+		if err != nil {
+			if errors.Is(err, storage.ErrNodeNotFound) {
+				writeError(w, http.StatusNotFound, errors.New("节点不存在"))
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		ReloadNodeSchedules()
+
+		logger.Info("[节点定时] 已保存定时计划", "node_id", nodeID, "node_name", saved.NodeName, "windows", len(saved.Windows))
+		respondJSON(w, http.StatusOK, map[string]any{"schedule": convertNodeSchedule(saved)})
+
+	case http.MethodDelete:
+		schedule, err := h.repo.GetNodeSchedule(ctx, nodeID, username)
+		if err != nil {
+			if errors.Is(err, storage.ErrNodeScheduleNotFound) {
+				writeError(w, http.StatusNotFound, errors.New("节点没有定时计划"))
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		restored, err := h.repo.DeleteNodeSchedule(ctx, nodeID, username)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if restored {
+			notifyFilesReferencingNodes(h.subscribeDir, []string{schedule.NodeName})
+		}
+
+		logger.Info("[节点定时] 已删除定时计划", "node_id", nodeID, "restored", restored)
+		respondJSON(w, http.StatusOK, map[string]any{"message": "定时计划已删除"})
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+type nodeTagRulePayload struct {
+	ID         int64     `json:"id"`
+	Name       string    `json:"name"`
+	MatchField string    `json:"match_field"` // source_url、region、protocol
+	Pattern    string    `json:"pattern"`
+	Tag        string    `json:"tag"`
+	Priority   int       `json:"priority"`
+	Override   bool      `json:"override"`
+	Enabled    bool      `json:"enabled"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type nodeTagRuleRequest struct {
+	Name       string `json:"name"`
+	MatchField string `json:"match_field"`
+	Pattern    string `json:"pattern"`
+	Tag        string `json:"tag"`
+	Priority   int    `json:"priority"`
+	Override   bool   `json:"override"`
+	Enabled    *bool  `json:"enabled"`
+}
+
+func convertNodeTagRule(rule storage.NodeTagRule) nodeTagRulePayload {
+	return nodeTagRulePayload{
+		ID:         rule.ID,
+		Name:       rule.Name,
+		MatchField: rule.MatchField,
+		Pattern:    rule.Pattern,
+		Tag:        rule.Tag,
+		Priority:   rule.Priority,
+		Override:   rule.Override,
+		Enabled:    rule.Enabled,
+		CreatedAt:  rule.CreatedAt,
+		UpdatedAt:  rule.UpdatedAt,
+	}
+}
+
+type nodeTagRulesHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewNodeTagRulesHandler manages the auto-tag rules applied to batch imported nodes under
+// /api/admin/node-tag-rules.
+func NewNodeTagRulesHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("node tag rules handler requires repository")
+	}
+
+	return &nodeTagRulesHandler{repo: repo}
+}
+
+func (h *nodeTagRulesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	idPart := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/node-tag-rules"), "/")
+	if idPart == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.handleList(w, r)
+		case http.MethodPost:
+			h.handleSave(w, r, 0)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+		return
+	}
+
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil || id <= 0 {
+		writeBadRequest(w, "无效的标签规则ID")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		h.handleSave(w, r, id)
+	case http.MethodDelete:
+		h.handleDelete(w, r, id)
+	default:
+		methodNotAllowed(w, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (h *nodeTagRulesHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.repo.ListNodeTagRules(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]nodeTagRulePayload, 0, len(rules))
+	for _, rule := range rules {
+		items = append(items, convertNodeTagRule(rule))
+	}
+
+	defaultTag := storage.DefaultNodeTag
+	if cfg, err := h.repo.GetSystemConfig(r.Context()); err == nil && cfg.DefaultNodeTag != "" {
+		defaultTag = cfg.DefaultNodeTag
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"rules":       items,
+		"default_tag": defaultTag,
+	})
+}
+
+func (h *nodeTagRulesHandler) handleSave(w http.ResponseWriter, r *http.Request, id int64) {
+	var payload nodeTagRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	switch strings.TrimSpace(payload.MatchField) {
+	case storage.NodeTagMatchSourceURL, storage.NodeTagMatchRegion, storage.NodeTagMatchProtocol:
+	default:
+		writeBadRequest(w, "匹配字段必须为 source_url、region 或 protocol")
+		return
+	}
+	if strings.TrimSpace(payload.Pattern) == "" {
+		writeBadRequest(w, "匹配内容不能为空")
+		return
+	}
+	if strings.TrimSpace(payload.Tag) == "" {
+		writeBadRequest(w, "标签不能为空")
+		return
+	}
+
+	rule := storage.NodeTagRule{
+		ID:         id,
+		Name:       payload.Name,
+		MatchField: payload.MatchField,
+		Pattern:    payload.Pattern,
+		Tag:        payload.Tag,
+		Priority:   payload.Priority,
+		Override:   payload.Override,
+		Enabled:    payload.Enabled == nil || *payload.Enabled,
+	}
+
+	var saved storage.NodeTagRule
+	var err error
+	if id == 0 {
+		saved, err = h.repo.CreateNodeTagRule(r.Context(), rule)
+	} else {
+		saved, err = h.repo.UpdateNodeTagRule(r.Context(), rule)
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrNodeTagRuleNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logger.Info("[节点标签] 自动标签规则已保存", "id", saved.ID, "match_field", saved.MatchField, "tag", saved.Tag)
+	respondJSON(w, http.StatusOK, map[string]any{
+		"rule": convertNodeTagRule(saved),
+	})
+}
+
+func (h *nodeTagRulesHandler) handleDelete(w http.ResponseWriter, r *http.Request, id int64) {
+	if err := h.repo.DeleteNodeTagRule(r.Context(), id); err != nil {
+		if errors.Is(err, storage.ErrNodeTagRuleNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"message": "标签规则已删除",
+	})
+}
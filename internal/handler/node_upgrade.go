@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+	"miaomiaowu/internal/validator"
+)
+
+type nodeUpgradeEntry struct {
+	ID           int64                        `json:"id"`
+	NodeName     string                       `json:"node_name"`
+	Protocol     string                       `json:"protocol"`
+	Deprecations []validator.ProxyDeprecation `json:"deprecations"`
+	Applied      []string                     `json:"applied,omitempty"`
+}
+
+type nodeUpgradeRequest struct {
+	NodeIDs []int64 `json:"node_ids"` // 为空时处理全部节点
+	DryRun  bool    `json:"dry_run"`
+}
+
+// scanNodeDeprecations 扫描节点中的过时设置，无法解析 Clash 配置的节点跳过
+func scanNodeDeprecations(nodes []storage.Node) ([]nodeUpgradeEntry, map[int64]map[string]any) {
+	entries := make([]nodeUpgradeEntry, 0)
+	configs := make(map[int64]map[string]any)
+	for _, node := range nodes {
+		var clashConfig map[string]any
+		if err := json.Unmarshal([]byte(node.ClashConfig), &clashConfig); err != nil || clashConfig == nil {
+			continue
+		}
+		deprecations := validator.CheckProxyDeprecations(clashConfig)
+		if len(deprecations) == 0 {
+			continue
+		}
+		configs[node.ID] = clashConfig
+		entries = append(entries, nodeUpgradeEntry{
+			ID:           node.ID,
+			NodeName:     node.NodeName,
+			Protocol:     node.Protocol,
+			Deprecations: deprecations,
+		})
+	}
+	return entries, configs
+}
+
+// handleUpgradeReport 列出使用过时设置的节点（弃用的加密方式、alterId>0、旧版混淆/流控等）
+func (h *nodesHandler) handleUpgradeReport(w http.ResponseWriter, r *http.Request) {
+	username := auth.UsernameFromContext(r.Context())
+	if username == "" {
+		writeError(w, http.StatusUnauthorized, errors.New("用户未认证"))
+		return
+	}
+
+	nodes, err := h.repo.ListNodes(r.Context(), username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	entries, _ := scanNodeDeprecations(nodes)
+	fixable := 0
+	for _, entry := range entries {
+		if slices.ContainsFunc(entry.Deprecations, func(d validator.ProxyDeprecation) bool { return d.Fixable }) {
+			fixable++
+		}
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"nodes":          entries,
+		"total_nodes":    len(nodes),
+		"affected_nodes": len(entries),
+		"fixable_nodes":  fixable,
+	})
+}
+
+// handleUpgradeApply 批量应用可自动修复的升级（dry_run 时只返回将要修改的内容），并同步到订阅文件
+func (h *nodesHandler) handleUpgradeApply(w http.ResponseWriter, r *http.Request) {
+	username := auth.UsernameFromContext(r.Context())
+	if username == "" {
+		writeError(w, http.StatusUnauthorized, errors.New("用户未认证"))
+		return
+	}
+
+	var req nodeUpgradeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBadRequest(w, "请求格式不正确")
+		return
+	}
+
+	nodes, err := h.repo.ListNodes(r.Context(), username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(req.NodeIDs) > 0 {
+		nodes = slices.DeleteFunc(nodes, func(node storage.Node) bool {
+			return !slices.Contains(req.NodeIDs, node.ID)
+		})
+	}
+
+	entries, configs := scanNodeDeprecations(nodes)
+	nodesByID := make(map[int64]storage.Node, len(nodes))
+	for _, node := range nodes {
+		nodesByID[node.ID] = node
+	}
+
+	updatedCount := 0
+	failCount := 0
+	results := make([]nodeUpgradeEntry, 0, len(entries))
+	for _, entry := range entries {
+		fixed, applied := validator.FixProxyDeprecations(configs[entry.ID])
+		if len(applied) == 0 {
+			continue
+		}
+		entry.Applied = applied
+
+		if !req.DryRun {
+			data, err := json.Marshal(fixed)
+			if err != nil {
+				failCount++
+				continue
+			}
+			node := nodesByID[entry.ID]
+			// ParsedConfig 与 ClashConfig 相同时一并更新，避免编辑页显示旧值
+			if node.ParsedConfig == node.ClashConfig {
+				node.ParsedConfig = string(data)
+			}
+			node.ClashConfig = string(data)
+
+			updated, err := h.repo.UpdateNode(r.Context(), node)
+			if err != nil {
+				logger.Info("[节点升级] 更新节点失败", "node_name", node.NodeName, "error", err)
+				failCount++
+				continue
+			}
+			// 修复会删除旧字段，需要整体替换订阅文件中的代理条目
+			if err := h.yamlSyncManager.ReplaceNode(updated.NodeName, updated.ClashOutput()); err != nil {
+				// Log error but don't fail the request
+			}
+		}
+
+		updatedCount++
+		results = append(results, entry)
+	}
+
+	if !req.DryRun {
+		logger.Info("[节点升级] 批量修复完成", "user", username, "updated", updatedCount, "failed", failCount)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"dry_run": req.DryRun,
+		"updated": updatedCount,
+		"failed":  failCount,
+		"nodes":   results,
+	})
+}
@@ -1,7 +1,7 @@
 package handler
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -15,6 +15,7 @@ import (
 
 	"miaomiaowu/internal/auth"
 	"miaomiaowu/internal/storage"
+	"miaomiaowu/internal/validator"
 
 	"gopkg.in/yaml.v3"
 )
@@ -107,6 +108,31 @@ func decodeProxyURLFields(proxy map[string]any) {
 	}
 }
 
+// checkNodeClashConfig 按协议校验 Clash 配置（必填字段、端口范围、加密方式等），
+// 有错误时写入 400 响应并返回 false
+func checkNodeClashConfig(w http.ResponseWriter, clashConfig map[string]interface{}, logPrefix string) bool {
+	var errs []validator.ValidationIssue
+	for _, issue := range validator.ValidateProxy(clashConfig) {
+		if issue.Level == validator.ErrorLevel {
+			errs = append(errs, issue)
+		}
+	}
+	if len(errs) == 0 {
+		return true
+	}
+
+	messages := make([]string, 0, len(errs))
+	for _, issue := range errs {
+		messages = append(messages, issue.Message)
+	}
+	logger.Info(logPrefix+" Clash配置校验失败", "node_name", clashConfig["name"], "issues", strings.Join(messages, "; "))
+	respondJSON(w, http.StatusBadRequest, map[string]any{
+		"error":  "Clash配置校验失败: " + strings.Join(messages, "；"),
+		"issues": errs,
+	})
+	return false
+}
+
 type nodesHandler struct {
 	repo            *storage.TrafficRepository
 	subscribeDir    string
@@ -130,6 +156,20 @@ func (h *nodesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/api/admin/nodes")
 	path = strings.Trim(path, "/")
 
+	// 路径中的节点既可以用数字 ID 也可以用 UUID 引用
+	if first, rest, _ := strings.Cut(path, "/"); storage.IsPublicID(first) {
+		id, err := h.repo.NodeIDByUUID(r.Context(), first, auth.UsernameFromContext(r.Context()))
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, storage.ErrNodeNotFound) {
+				status = http.StatusNotFound
+			}
+			writeError(w, status, err)
+			return
+		}
+		path = strings.TrimSuffix(strconv.FormatInt(id, 10)+"/"+rest, "/")
+	}
+
 	switch {
 	case path == "" && r.Method == http.MethodGet:
 		h.handleList(w, r)
@@ -139,6 +179,15 @@ func (h *nodesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.handleBatchCreate(w, r)
 	case path == "fetch-subscription" && r.Method == http.MethodPost:
 		h.handleFetchSubscription(w, r)
+	case path == "schedules" && r.Method == http.MethodGet:
+		h.handleListSchedules(w, r)
+	case path == "upgrade-report" && r.Method == http.MethodGet:
+		h.handleUpgradeReport(w, r)
+	case path == "upgrade" && r.Method == http.MethodPost:
+		h.handleUpgradeApply(w, r)
+	case strings.HasSuffix(path, "/schedule"):
+		idSegment := strings.TrimSuffix(path, "/schedule")
+		h.handleSchedule(w, r, idSegment)
 	case strings.HasSuffix(path, "/probe-binding") && r.Method == http.MethodPut:
 		idSegment := strings.TrimSuffix(path, "/probe-binding")
 		h.handleUpdateProbeBinding(w, r, idSegment)
@@ -151,7 +200,10 @@ func (h *nodesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case strings.HasSuffix(path, "/config") && r.Method == http.MethodPut:
 		idSegment := strings.TrimSuffix(path, "/config")
 		h.handleUpdateConfig(w, r, idSegment)
-	case path != "" && path != "batch" && path != "fetch-subscription" && !strings.HasSuffix(path, "/probe-binding") && !strings.HasSuffix(path, "/server") && !strings.HasSuffix(path, "/restore-server") && !strings.HasSuffix(path, "/config") && (r.Method == http.MethodPut || r.Method == http.MethodPatch):
+	case strings.HasSuffix(path, "/custom-fields") && (r.Method == http.MethodGet || r.Method == http.MethodPut):
+		idSegment := strings.TrimSuffix(path, "/custom-fields")
+		h.handleCustomFields(w, r, idSegment)
+	case path != "" && path != "batch" && path != "fetch-subscription" && !strings.HasSuffix(path, "/probe-binding") && !strings.HasSuffix(path, "/server") && !strings.HasSuffix(path, "/restore-server") && !strings.HasSuffix(path, "/config") && !strings.HasSuffix(path, "/custom-fields") && (r.Method == http.MethodPut || r.Method == http.MethodPatch):
 		h.handleUpdate(w, r, path)
 	case path != "" && path != "batch" && path != "fetch-subscription" && r.Method == http.MethodDelete:
 		h.handleDelete(w, r, path)
@@ -161,6 +213,12 @@ func (h *nodesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.handleBatchDelete(w, r)
 	case path == "batch-rename" && r.Method == http.MethodPost:
 		h.handleBatchRename(w, r)
+	case path == "sources" && r.Method == http.MethodGet:
+		h.handleListSources(w, r)
+	case path == "sources/delete" && r.Method == http.MethodPost:
+		h.handleDeleteSource(w, r)
+	case path == "sources/refresh" && r.Method == http.MethodPost:
+		h.handleRefreshSource(w, r)
 	default:
 		allowed := []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
 		methodNotAllowed(w, allowed...)
@@ -180,8 +238,10 @@ func (h *nodesHandler) handleList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	dtos := convertNodes(nodes)
+	annotateProbeAlerts(r.Context(), h.repo, dtos)
 	respondJSON(w, http.StatusOK, map[string]any{
-		"nodes": convertNodes(nodes),
+		"nodes": dtos,
 	})
 }
 
@@ -217,6 +277,15 @@ func (h *nodesHandler) handleCreate(w http.ResponseWriter, r *http.Request) {
 		writeBadRequest(w, fmt.Sprintf("节点名称 \"%s\" 已存在，请使用其他名称", req.NodeName))
 		return
 	}
+	if conflict, err := h.normalizedNodeNameConflict(r.Context(), username, req.NodeName, 0); err != nil {
+		logger.Info("[节点创建] 检查节点名称重复失败", "error", err)
+		writeError(w, http.StatusInternalServerError, errors.New("服务器错误"))
+		return
+	} else if conflict != "" {
+		logger.Info("[节点创建] 节点名称规范化后重复", "node_name", req.NodeName, "existing", conflict)
+		writeBadRequest(w, fmt.Sprintf("节点名称 \"%s\" 与已有节点 \"%s\" 规范化后相同，请使用其他名称", req.NodeName, conflict))
+		return
+	}
 
 	// 校验Clash配置格式
 	if req.ClashConfig != "" {
@@ -233,6 +302,10 @@ func (h *nodesHandler) handleCreate(w http.ResponseWriter, r *http.Request) {
 			writeBadRequest(w, "Clash配置中的name字段必须与节点名称一致")
 			return
 		}
+
+		if !checkNodeClashConfig(w, clashConfig, "[节点创建]") {
+			return
+		}
 	}
 
 	logger.Info("[节点创建] 校验通过 - 节点名称, 用户", "node_name", req.NodeName, "user", username)
@@ -256,6 +329,7 @@ func (h *nodesHandler) handleCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	logger.Info("[节点创建] 成功 - ID, 节点名称", "id", created.ID, "node_name", created.NodeName)
+	emitNodeWebhook(WebhookEventNodeCreated, username, []storage.Node{created})
 
 	respondJSON(w, http.StatusCreated, map[string]any{
 		"node": convertNode(created),
@@ -283,12 +357,34 @@ func (h *nodesHandler) handleBatchCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// 启用节点名称规范化时，跳过与已有节点或本批次节点规范化后同名的节点
+	normalizer := loadNodeNameNormalizer(r.Context(), h.repo)
+	seenKeys := make(map[string]struct{})
+	if normalizer.enabled {
+		existing, err := h.repo.ListNodes(r.Context(), username)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		for _, node := range existing {
+			seenKeys[normalizer.Key(node.NodeName)] = struct{}{}
+		}
+	}
+
 	nodes := make([]storage.Node, 0, len(req.Nodes))
 	for _, n := range req.Nodes {
 		// 允许 Clash 订阅节点没有 RawURL，但必须有 NodeName 和 ClashConfig
 		if n.NodeName == "" || n.ClashConfig == "" {
 			continue
 		}
+		if normalizer.enabled {
+			key := normalizer.Key(n.NodeName)
+			if _, dup := seenKeys[key]; dup {
+				logger.Info("[节点批量创建] 跳过规范化后重复的节点", "node_name", n.NodeName)
+				continue
+			}
+			seenKeys[key] = struct{}{}
+		}
 		nodes = append(nodes, storage.Node{
 			Username:     username,
 			RawURL:       n.RawURL, // 可以为空（Clash 订阅节点）
@@ -298,6 +394,7 @@ func (h *nodesHandler) handleBatchCreate(w http.ResponseWriter, r *http.Request)
 			ClashConfig:  n.ClashConfig,
 			Enabled:      n.Enabled,
 			Tag:          n.Tag,
+			SourceURL:    n.SourceURL,
 		})
 	}
 
@@ -311,6 +408,7 @@ func (h *nodesHandler) handleBatchCreate(w http.ResponseWriter, r *http.Request)
 		writeError(w, http.StatusBadRequest, err)
 		return
 	}
+	emitNodeWebhook(WebhookEventNodeCreated, username, created)
 
 	respondJSON(w, http.StatusCreated, map[string]any{
 		"nodes": convertNodes(created),
@@ -370,6 +468,15 @@ func (h *nodesHandler) handleUpdate(w http.ResponseWriter, r *http.Request, idSe
 			writeBadRequest(w, fmt.Sprintf("节点名称 \"%s\" 已存在，请使用其他名称", req.NodeName))
 			return
 		}
+		if conflict, err := h.normalizedNodeNameConflict(r.Context(), username, req.NodeName, id); err != nil {
+			logger.Info("[节点更新] 检查节点名称重复失败", "error", err)
+			writeError(w, http.StatusInternalServerError, errors.New("服务器错误"))
+			return
+		} else if conflict != "" {
+			logger.Info("[节点更新] 节点名称规范化后重复", "node_name", req.NodeName, "existing", conflict)
+			writeBadRequest(w, fmt.Sprintf("节点名称 \"%s\" 与已有节点 \"%s\" 规范化后相同，请使用其他名称", req.NodeName, conflict))
+			return
+		}
 	}
 
 	// 如果Clash配置被修改，需要校验格式
@@ -391,6 +498,10 @@ func (h *nodesHandler) handleUpdate(w http.ResponseWriter, r *http.Request, idSe
 			writeBadRequest(w, "Clash配置中的name字段必须与节点名称一致")
 			return
 		}
+
+		if !checkNodeClashConfig(w, clashConfig, "[节点更新]") {
+			return
+		}
 	}
 
 	logger.Info("[节点更新] 校验通过 - 节点ID, 旧名称, 新名称", "value", id, "param", oldNodeName, "node_name", req.NodeName)
@@ -432,7 +543,7 @@ func (h *nodesHandler) handleUpdate(w http.ResponseWriter, r *http.Request, idSe
 	// Sync node changes to YAML files using the sync manager
 	if updated.ClashConfig != "" {
 		newNodeName := updated.NodeName
-		if err := h.yamlSyncManager.SyncNode(oldNodeName, newNodeName, updated.ClashConfig); err != nil {
+		if err := h.yamlSyncManager.SyncNode(oldNodeName, newNodeName, updated.ClashOutput()); err != nil {
 			// Log error but don't fail the request
 			// The node update was successful, YAML sync is best-effort
 			// You could add logging here if needed
@@ -522,7 +633,7 @@ func (h *nodesHandler) handleUpdateServer(w http.ResponseWriter, r *http.Request
 	// Sync node changes to YAML files (server address update) using the sync manager
 	if updated.ClashConfig != "" {
 		nodeName := updated.NodeName
-		if err := h.yamlSyncManager.SyncNode(nodeName, nodeName, updated.ClashConfig); err != nil {
+		if err := h.yamlSyncManager.SyncNode(nodeName, nodeName, updated.ClashOutput()); err != nil {
 			// Log error but don't fail the request
 		}
 	}
@@ -598,7 +709,7 @@ func (h *nodesHandler) handleRestoreServer(w http.ResponseWriter, r *http.Reques
 	// Sync node changes to YAML files (restore server address) using the sync manager
 	if updated.ClashConfig != "" {
 		nodeName := updated.NodeName
-		if err := h.yamlSyncManager.SyncNode(nodeName, nodeName, updated.ClashConfig); err != nil {
+		if err := h.yamlSyncManager.SyncNode(nodeName, nodeName, updated.ClashOutput()); err != nil {
 			// Log error but don't fail the request
 		}
 	}
@@ -644,6 +755,9 @@ func (h *nodesHandler) handleUpdateConfig(w http.ResponseWriter, r *http.Request
 			return
 		}
 	}
+	if !checkNodeClashConfig(w, clashConfigMap, "[节点配置更新]") {
+		return
+	}
 
 	// Get existing node
 	node, err := h.repo.GetNode(r.Context(), id, username)
@@ -680,7 +794,7 @@ func (h *nodesHandler) handleUpdateConfig(w http.ResponseWriter, r *http.Request
 	if updated.ClashConfig != "" {
 		// If node name changed, update old name to new name in YAML files
 		newNodeName := updated.NodeName
-		if err := h.yamlSyncManager.SyncNode(oldNodeName, newNodeName, updated.ClashConfig); err != nil {
+		if err := h.yamlSyncManager.SyncNode(oldNodeName, newNodeName, updated.ClashOutput()); err != nil {
 			// Log error but don't fail the request
 		}
 	}
@@ -729,6 +843,7 @@ func (h *nodesHandler) handleDelete(w http.ResponseWriter, r *http.Request, idSe
 			// Log error but don't fail the request
 		}
 	}
+	emitNodeWebhook(WebhookEventNodeDeleted, username, []storage.Node{node})
 
 	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
@@ -740,10 +855,12 @@ func (h *nodesHandler) handleClearAll(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	existing, _ := h.repo.ListNodes(r.Context(), username)
 	if err := h.repo.DeleteAllUserNodes(r.Context(), username); err != nil {
 		writeError(w, http.StatusInternalServerError, err)
 		return
 	}
+	emitNodeWebhook(WebhookEventNodeDeleted, username, existing)
 
 	respondJSON(w, http.StatusOK, map[string]string{"status": "cleared"})
 }
@@ -771,12 +888,14 @@ func (h *nodesHandler) handleBatchDelete(w http.ResponseWriter, r *http.Request)
 
 	// Get all node names before deletion for YAML sync
 	nodeNames := make([]string, 0, len(req.NodeIDs))
+	nodesByID := make(map[int64]storage.Node, len(req.NodeIDs))
 	for _, id := range req.NodeIDs {
 		node, err := h.repo.GetNode(r.Context(), id, username)
 		if err != nil {
 			// Skip nodes that don't exist or can't be accessed
 			continue
 		}
+		nodesByID[id] = node
 		if node.NodeName != "" {
 			nodeNames = append(nodeNames, node.NodeName)
 		}
@@ -784,13 +903,18 @@ func (h *nodesHandler) handleBatchDelete(w http.ResponseWriter, r *http.Request)
 
 	// Delete nodes from database
 	deletedCount := 0
+	deletedNodes := make([]storage.Node, 0, len(req.NodeIDs))
 	for _, id := range req.NodeIDs {
 		if err := h.repo.DeleteNode(r.Context(), id, username); err != nil {
 			// Continue with other deletions even if one fails
 			continue
 		}
 		deletedCount++
+		if node, ok := nodesByID[id]; ok {
+			deletedNodes = append(deletedNodes, node)
+		}
 	}
+	emitNodeWebhook(WebhookEventNodeDeleted, username, deletedNodes)
 
 	// Batch sync deletion to YAML files using the sync manager
 	// This is done in a single locked operation for efficiency
@@ -885,7 +1009,7 @@ func (h *nodesHandler) handleBatchRename(w http.ResponseWriter, r *http.Request)
 			yamlUpdates = append(yamlUpdates, NodeUpdate{
 				OldName:         oldNodeName,
 				NewName:         update.NewName,
-				ClashConfigJSON: updated.ClashConfig,
+				ClashConfigJSON: updated.ClashOutput(),
 			})
 		}
 
@@ -918,37 +1042,49 @@ type nodeRequest struct {
 	ClashConfig  string `json:"clash_config"`
 	Enabled      bool   `json:"enabled"`
 	Tag          string `json:"tag"`
+	SourceURL    string `json:"source_url"` // 批量导入时节点来源的订阅地址
 }
 
 type nodeDTO struct {
-	ID             int64     `json:"id"`
-	RawURL         string    `json:"raw_url"`
-	NodeName       string    `json:"node_name"`
-	Protocol       string    `json:"protocol"`
-	ParsedConfig   string    `json:"parsed_config"`
-	ClashConfig    string    `json:"clash_config"`
-	Enabled        bool      `json:"enabled"`
-	Tag            string    `json:"tag"`
-	OriginalServer string    `json:"original_server"`
-	ProbeServer    string    `json:"probe_server"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID               int64              `json:"id"`
+	UUID             string             `json:"uuid"`
+	RawURL           string             `json:"raw_url"`
+	NodeName         string             `json:"node_name"`
+	Protocol         string             `json:"protocol"`
+	ParsedConfig     string             `json:"parsed_config"`
+	ClashConfig      string             `json:"clash_config"`
+	Enabled          bool               `json:"enabled"`
+	Tag              string             `json:"tag"`
+	OriginalServer   string             `json:"original_server"`
+	ProbeServer      string             `json:"probe_server"`
+	ProbeAnnotations map[string]string  `json:"probe_annotations,omitempty"` // 从探针面板同步的服务器信息（地区、价格等）
+	CustomFields     map[string]any     `json:"custom_fields,omitempty"`     // 合并进 Clash 输出的自定义字段
+	ProbeAlert       *nodeProbeAlertDTO `json:"probe_alert,omitempty"`       // 绑定的探针服务器当前的告警
+	SourceURL        string             `json:"source_url"`                  // 导入来源的订阅地址，手动添加的节点为空
+	ImportBatch      string             `json:"import_batch"`                // 导入批次 ID
+	CreatedAt        time.Time          `json:"created_at"`
+	UpdatedAt        time.Time          `json:"updated_at"`
 }
 
 func convertNode(node storage.Node) nodeDTO {
 	return nodeDTO{
-		ID:             node.ID,
-		RawURL:         node.RawURL,
-		NodeName:       node.NodeName,
-		Protocol:       node.Protocol,
-		ParsedConfig:   node.ParsedConfig,
-		ClashConfig:    node.ClashConfig,
-		Enabled:        node.Enabled,
-		Tag:            node.Tag,
-		OriginalServer: node.OriginalServer,
-		ProbeServer:    node.ProbeServer,
-		CreatedAt:      node.CreatedAt,
-		UpdatedAt:      node.UpdatedAt,
+		ID:               node.ID,
+		UUID:             node.UUID,
+		RawURL:           node.RawURL,
+		NodeName:         node.NodeName,
+		Protocol:         node.Protocol,
+		ParsedConfig:     node.ParsedConfig,
+		ClashConfig:      node.ClashConfig,
+		Enabled:          node.Enabled,
+		Tag:              node.Tag,
+		OriginalServer:   node.OriginalServer,
+		ProbeServer:      node.ProbeServer,
+		ProbeAnnotations: node.ProbeAnnotations,
+		CustomFields:     node.CustomFields,
+		SourceURL:        node.SourceURL,
+		ImportBatch:      node.ImportBatch,
+		CreatedAt:        node.CreatedAt,
+		UpdatedAt:        node.UpdatedAt,
 	}
 }
 
@@ -968,9 +1104,10 @@ func (h *nodesHandler) handleFetchSubscription(w http.ResponseWriter, r *http.Re
 	}
 
 	var req struct {
-		URL            string `json:"url"`
-		UserAgent      string `json:"user_agent"`
-		SkipCertVerify bool   `json:"skip_cert_verify"`
+		URL            string            `json:"url"`
+		UserAgent      string            `json:"user_agent"`
+		SkipCertVerify bool              `json:"skip_cert_verify"`
+		Headers        map[string]string `json:"headers"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -989,17 +1126,13 @@ func (h *nodesHandler) handleFetchSubscription(w http.ResponseWriter, r *http.Re
 		userAgent = "clash-meta/2.4.0"
 	}
 
-	// 创建HTTP客户端并获取订阅内容
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	if rejectInAirGappedMode(w) {
+		return
 	}
 
-	// 如果需要跳过证书验证
-	if req.SkipCertVerify {
-		client.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-	}
+	// 创建HTTP客户端并获取订阅内容
+	// 使用全局出站代理（如已配置），并按需跳过证书验证
+	client := importFetchClient(30*time.Second, req.SkipCertVerify)
 
 	httpReq, err := http.NewRequest("GET", req.URL, nil)
 	if err != nil {
@@ -1007,8 +1140,14 @@ func (h *nodesHandler) handleFetchSubscription(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	// 添加User-Agent头
-	httpReq.Header.Set("User-Agent", userAgent)
+	headers, err := sanitizeSubscriptionHeaders(req.Headers)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// 添加User-Agent头及自定义请求头
+	applySubscriptionRequestHeaders(httpReq, userAgent, headers)
 
 	logger.Info("[订阅获取] 开始请求外部订阅", "url", req.URL, "user_agent", userAgent, "skip_cert_verify", req.SkipCertVerify)
 
@@ -1082,7 +1221,7 @@ func (h *nodesHandler) handleFetchSubscription(w http.ResponseWriter, r *http.Re
 			clashMetaUA := "clash-meta/2.4.0"
 			trafficReq, err := http.NewRequest("GET", req.URL, nil)
 			if err == nil {
-				trafficReq.Header.Set("User-Agent", clashMetaUA)
+				applySubscriptionRequestHeaders(trafficReq, clashMetaUA, headers)
 				trafficResp, err := client.Do(trafficReq)
 				if err == nil {
 					defer trafficResp.Body.Close()
@@ -1219,7 +1358,17 @@ func (h *nodesHandler) handleUpdateProbeBinding(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	if err := h.repo.UpdateNodeProbeServer(r.Context(), nodeID, username, req.ProbeServer); err != nil {
+	probeServer, err := h.resolveProbeBinding(r.Context(), nodeID, username, req.ProbeServer)
+	if err != nil {
+		if errors.Is(err, storage.ErrNodeNotFound) {
+			writeError(w, http.StatusNotFound, errors.New("节点不存在"))
+			return
+		}
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	if err := h.repo.UpdateNodeProbeServer(r.Context(), nodeID, username, probeServer); err != nil {
 		if errors.Is(err, storage.ErrNodeNotFound) {
 			writeError(w, http.StatusNotFound, errors.New("节点不存在"))
 			return
@@ -1238,3 +1387,47 @@ func (h *nodesHandler) handleUpdateProbeBinding(w http.ResponseWriter, r *http.R
 		"node": convertNode(node),
 	})
 }
+
+// normalizedNodeNameConflict 启用节点名称规范化时，返回与 name 规范化后相同的已有节点名称
+func (h *nodesHandler) normalizedNodeNameConflict(ctx context.Context, username, name string, excludeID int64) (string, error) {
+	normalizer := loadNodeNameNormalizer(ctx, h.repo)
+	if !normalizer.enabled {
+		return "", nil
+	}
+	nodes, err := h.repo.ListNodes(ctx, username)
+	if err != nil {
+		return "", err
+	}
+	return findNodeNameConflict(nodes, normalizer, name, excludeID), nil
+}
+
+// resolveProbeBinding 将请求中的探针服务器名称对应到已配置的服务器。
+// "auto" 按节点名称自动匹配；启用节点名称规范化时，"HK-01" 可匹配到名为 "香港 01" 的服务器。
+func (h *nodesHandler) resolveProbeBinding(ctx context.Context, nodeID int64, username, probeServer string) (string, error) {
+	probeServer = strings.TrimSpace(probeServer)
+	if probeServer == "" {
+		return "", nil
+	}
+
+	normalizer := loadNodeNameNormalizer(ctx, h.repo)
+	if strings.EqualFold(probeServer, probeBindingAuto) {
+		node, err := h.repo.GetNode(ctx, nodeID, username)
+		if err != nil {
+			return "", err
+		}
+		matched := resolveProbeServerByName(ctx, h.repo, normalizer, node.NodeName)
+		if matched == "" {
+			return "", fmt.Errorf("未找到与节点 \"%s\" 匹配的探针服务器", node.NodeName)
+		}
+		logger.Info("[节点探针绑定] 按节点名称自动匹配探针服务器", "node_name", node.NodeName, "probe_server", matched)
+		return matched, nil
+	}
+
+	if !normalizer.enabled {
+		return probeServer, nil
+	}
+	if matched := resolveProbeServerByName(ctx, h.repo, normalizer, probeServer); matched != "" {
+		return matched, nil
+	}
+	return probeServer, nil
+}
@@ -0,0 +1,304 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+// expiringPlanNoticeDays 外部订阅距离到期不足该天数时发送提醒
+const expiringPlanNoticeDays = 7
+
+type notificationResponse struct {
+	ID        int64   `json:"id"`
+	Type      string  `json:"type"`
+	Title     string  `json:"title"`
+	Content   string  `json:"content"`
+	Read      bool    `json:"read"`
+	ReadAt    *string `json:"read_at"`
+	CreatedAt string  `json:"created_at"`
+}
+
+type notificationsHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewNotificationsHandler serves the current user's notification inbox under /api/user/notifications.
+func NewNotificationsHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("notifications handler requires repository")
+	}
+
+	return &notificationsHandler{repo: repo}
+}
+
+func (h *notificationsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	username := auth.UsernameFromContext(r.Context())
+	if strings.TrimSpace(username) == "" {
+		writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/user/notifications"), "/")
+	switch path {
+	case "":
+		switch r.Method {
+		case http.MethodGet:
+			h.handleList(w, r, username)
+		case http.MethodDelete:
+			h.handleDelete(w, r, username)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		}
+	case "unread-count":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		h.respondUnreadCount(w, r, username, nil)
+	case "read":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		h.handleMarkRead(w, r, username)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (h *notificationsHandler) handleList(w http.ResponseWriter, r *http.Request, username string) {
+	unreadOnly, _ := strconv.ParseBool(r.URL.Query().Get("unread"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	notifications, err := h.repo.ListNotifications(r.Context(), username, unreadOnly, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	unread, err := h.repo.CountUnreadNotifications(r.Context(), username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]notificationResponse, 0, len(notifications))
+	for _, n := range notifications {
+		items = append(items, convertNotificationResponse(n))
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"notifications": items,
+		"unread_count":  unread,
+	})
+}
+
+func (h *notificationsHandler) handleMarkRead(w http.ResponseWriter, r *http.Request, username string) {
+	var payload struct {
+		IDs []int64 `json:"ids"` // 为空时全部标记为已读
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeBadRequest(w, "请求数据格式错误")
+			return
+		}
+	}
+
+	updated, err := h.repo.MarkNotificationsRead(r.Context(), username, payload.IDs)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.respondUnreadCount(w, r, username, map[string]any{"updated": updated})
+}
+
+func (h *notificationsHandler) handleDelete(w http.ResponseWriter, r *http.Request, username string) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeBadRequest(w, "通知 ID 无效")
+		return
+	}
+
+	if err := h.repo.DeleteNotification(r.Context(), username, id); err != nil {
+		if errors.Is(err, storage.ErrNotificationNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.respondUnreadCount(w, r, username, nil)
+}
+
+func (h *notificationsHandler) respondUnreadCount(w http.ResponseWriter, r *http.Request, username string, extra map[string]any) {
+	unread, err := h.repo.CountUnreadNotifications(r.Context(), username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := map[string]any{"unread_count": unread}
+	for k, v := range extra {
+		resp[k] = v
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// NewNotificationAnnounceHandler lets admins broadcast an announcement to all (or selected) users.
+func NewNotificationAnnounceHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("notification announce handler requires repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+
+		var payload struct {
+			Title     string   `json:"title"`
+			Content   string   `json:"content"`
+			Usernames []string `json:"usernames"` // 为空时发送给所有用户
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&payload); err != nil {
+			writeBadRequest(w, "请求数据格式错误")
+			return
+		}
+
+		title := strings.TrimSpace(payload.Title)
+		if title == "" {
+			writeBadRequest(w, "公告标题不能为空")
+			return
+		}
+
+		recipients := payload.Usernames
+		if len(recipients) == 0 {
+			users, err := repo.ListUsers(r.Context(), 1000)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			for _, user := range users {
+				recipients = append(recipients, user.Username)
+			}
+		}
+
+		sent := 0
+		for _, username := range recipients {
+			username = strings.TrimSpace(username)
+			if username == "" {
+				continue
+			}
+			if _, err := repo.CreateNotification(r.Context(), storage.Notification{
+				Username: username,
+				Type:     storage.NotificationTypeAnnouncement,
+				Title:    title,
+				Content:  payload.Content,
+			}); err != nil {
+				logger.Warn("[通知] 发送公告失败", "username", username, "error", err)
+				continue
+			}
+			sent++
+		}
+
+		logger.Info("[通知] 管理员发布公告", "title", title, "recipients", sent)
+
+		respondJSON(w, http.StatusOK, map[string]any{
+			"sent": sent,
+		})
+	})
+}
+
+func convertNotificationResponse(n storage.Notification) notificationResponse {
+	var readAt *string
+	if n.ReadAt != nil {
+		formatted := n.ReadAt.Format(time.RFC3339)
+		readAt = &formatted
+	}
+
+	return notificationResponse{
+		ID:        n.ID,
+		Type:      n.Type,
+		Title:     n.Title,
+		Content:   n.Content,
+		Read:      n.ReadAt != nil,
+		ReadAt:    readAt,
+		CreatedAt: n.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// notifyUser 向用户收件箱写入一条通知，失败时仅记录日志；返回是否新建了通知（去重命中时为 false）
+func notifyUser(ctx context.Context, repo *storage.TrafficRepository, n storage.Notification) bool {
+	if repo == nil {
+		return false
+	}
+	created, err := repo.CreateNotification(ctx, n)
+	if err != nil {
+		logger.Warn("[通知] 写入通知失败", "username", n.Username, "type", n.Type, "error", err)
+		return false
+	}
+	return created
+}
+
+// notifyExternalSyncFailure 记录外部订阅同步失败通知，同一订阅每天最多提醒一次
+func notifyExternalSyncFailure(ctx context.Context, repo *storage.TrafficRepository, username string, sub storage.ExternalSubscription, syncErr error) {
+	notifyUser(ctx, repo, storage.Notification{
+		Username:  username,
+		Type:      storage.NotificationTypeSyncFailure,
+		Title:     fmt.Sprintf("外部订阅「%s」同步失败", sub.Name),
+		Content:   syncErr.Error(),
+		DedupeKey: fmt.Sprintf("sync_failure:%d:%s", sub.ID, time.Now().Format("2006-01-02")),
+	})
+}
+
+// NotifyExpiringSubscriptions 为即将到期的外部订阅生成提醒，每个到期时间只提醒一次
+func NotifyExpiringSubscriptions(ctx context.Context, repo *storage.TrafficRepository) error {
+	if repo == nil {
+		return errors.New("notification requires repository")
+	}
+
+	subs, err := repo.ListAllExternalSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	deadline := now.AddDate(0, 0, expiringPlanNoticeDays)
+	for _, sub := range subs {
+		if sub.Expire == nil || sub.Expire.Before(now) || sub.Expire.After(deadline) {
+			continue
+		}
+
+		daysLeft := int(sub.Expire.Sub(now).Hours() / 24)
+		created := notifyUser(ctx, repo, storage.Notification{
+			Username:  sub.Username,
+			Type:      storage.NotificationTypeExpiringPlan,
+			Title:     fmt.Sprintf("外部订阅「%s」即将到期", sub.Name),
+			Content:   fmt.Sprintf("订阅将于 %s 到期（剩余约 %d 天）", sub.Expire.Format("2006-01-02"), daysLeft),
+			DedupeKey: fmt.Sprintf("expiring_plan:%d:%s", sub.ID, sub.Expire.Format("2006-01-02")),
+		})
+		if created {
+			emailUserAsync(repo, sub.Username, EmailTemplateExpiringPlan, map[string]any{
+				"Username": sub.Username,
+				"Name":     sub.Name,
+				"Expire":   sub.Expire.Format("2006-01-02"),
+				"DaysLeft": daysLeft,
+			})
+		}
+	}
+
+	return nil
+}
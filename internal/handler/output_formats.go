@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+
+	"miaomiaowu/internal/storage"
+	"miaomiaowu/internal/substore"
+)
+
+// SetOutputFormatOverrides applies the per-target content type / extension overrides from the
+// system config to the producer registry.
+func SetOutputFormatOverrides(overrides map[string]storage.OutputFormatOverride) {
+	formats := make(map[string]substore.OutputFormat, len(overrides))
+	for target, override := range overrides {
+		formats[target] = substore.OutputFormat{
+			ContentType: override.ContentType,
+			Extension:   override.Extension,
+		}
+	}
+	substore.GetDefaultFactory().SetOutputFormatOverrides(formats)
+}
+
+// normalizeOutputFormatOverrides 校验并规范化输出格式覆盖配置，目标必须是已注册的转换类型
+func normalizeOutputFormatOverrides(overrides map[string]storage.OutputFormatOverride) (map[string]storage.OutputFormatOverride, error) {
+	factory := substore.GetDefaultFactory()
+	normalized := make(map[string]storage.OutputFormatOverride, len(overrides))
+	for target, override := range overrides {
+		target = strings.TrimSpace(target)
+		if !factory.HasOutputFormat(target) {
+			return nil, fmt.Errorf("未知的转换类型: %s", target)
+		}
+
+		contentType := strings.TrimSpace(override.ContentType)
+		if contentType != "" {
+			if _, _, err := mime.ParseMediaType(contentType); err != nil {
+				return nil, fmt.Errorf("%s 的 content_type 无效: %w", target, err)
+			}
+		}
+
+		extension := strings.TrimSpace(override.Extension)
+		if extension != "" {
+			if !strings.HasPrefix(extension, ".") {
+				extension = "." + extension
+			}
+			if len(extension) == 1 || strings.ContainsAny(extension, `/\;" `) {
+				return nil, fmt.Errorf("%s 的扩展名无效: %s", target, override.Extension)
+			}
+		}
+
+		if contentType == "" && extension == "" {
+			continue
+		}
+		normalized[target] = storage.OutputFormatOverride{ContentType: contentType, Extension: extension}
+	}
+	return normalized, nil
+}
+
+// isYAMLContentType 判断输出是否为 YAML，需要进行字段重排等后处理
+func isYAMLContentType(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	switch mediaType {
+	case "text/yaml", "text/x-yaml", "application/yaml", "application/x-yaml":
+		return true
+	}
+	return false
+}
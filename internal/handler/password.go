@@ -51,6 +51,10 @@ func NewPasswordHandler(manager *auth.Manager) http.Handler {
 
 		// Authenticate with current password and update to new password
 		if err := manager.ChangePassword(r.Context(), username, current, newPassword); err != nil {
+			if errors.Is(err, auth.ErrExternalAccount) {
+				writeError(w, http.StatusBadRequest, errors.New("LDAP 账号的密码由目录服务器管理，请在目录中修改"))
+				return
+			}
 			writeError(w, http.StatusBadRequest, errors.New("current password is incorrect or update failed"))
 			return
 		}
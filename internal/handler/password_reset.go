@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+// passwordResetTTL 重置链接有效期
+const passwordResetTTL = 30 * time.Minute
+
+// passwordResetBaseURL 生成重置链接使用的面板地址，为空时根据请求推断
+var passwordResetBaseURL atomic.Pointer[string]
+
+// SetPasswordResetBaseURL pins the panel address used in reset links. Without it links are built
+// from the request's Host, or X-Forwarded-Host when the request comes from a trusted proxy.
+func SetPasswordResetBaseURL(baseURL string) {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	passwordResetBaseURL.Store(&baseURL)
+}
+
+func passwordResetLink(r *http.Request, token string) string {
+	baseURL := ""
+	if pinned := passwordResetBaseURL.Load(); pinned != nil {
+		baseURL = *pinned
+	}
+	if baseURL == "" {
+		baseURL = panelBaseURL(r)
+	}
+	return baseURL + "/reset-password?token=" + url.QueryEscape(token)
+}
+
+type forgotPasswordRequest struct {
+	Login string `json:"login"` // 用户名或邮箱
+}
+
+type resetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// NewForgotPasswordHandler emails a time-limited reset link to the account's address (public, rate limited).
+// The response is the same whether or not the account exists, so it can't be used to probe usernames.
+func NewForgotPasswordHandler(repo *storage.TrafficRepository, rateLimiter *LoginRateLimiter) http.Handler {
+	if repo == nil {
+		panic("forgot password handler requires repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+
+		var payload forgotPasswordRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&payload); err != nil {
+			writeBadRequest(w, "请求数据格式错误")
+			return
+		}
+		login := strings.TrimSpace(payload.Login)
+		if login == "" {
+			writeBadRequest(w, "请输入用户名或邮箱")
+			return
+		}
+
+		settings, err := repo.GetSMTPSettings(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !settings.Enabled {
+			writeError(w, http.StatusServiceUnavailable, ErrSMTPDisabled)
+			return
+		}
+
+		clientIP := getClientIP(r)
+
+		// 每次请求都计入失败次数，防止利用该接口向他人邮箱批量发信
+		if rateLimiter != nil {
+			if err := rateLimiter.Check(clientIP, ""); err != nil {
+				writeError(w, http.StatusTooManyRequests, errors.New("too many attempts, please try again later"))
+				return
+			}
+			rateLimiter.RecordFailure(clientIP, "")
+		}
+
+		accepted := map[string]any{"status": "accepted", "message": "如果账号存在且绑定了邮箱，重置链接已发送"}
+
+		user, err := repo.FindUserForPasswordReset(r.Context(), login)
+		if err != nil {
+			if !errors.Is(err, storage.ErrUserNotFound) {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			logger.Warn("🔑 [PASSWORD_RESET] 账号不存在", "client_ip", clientIP)
+			respondJSON(w, http.StatusAccepted, accepted)
+			return
+		}
+		if !user.IsActive || strings.TrimSpace(user.Email) == "" {
+			logger.Warn("🔑 [PASSWORD_RESET] 账号已禁用或未绑定邮箱", "username", user.Username, "client_ip", clientIP)
+			respondJSON(w, http.StatusAccepted, accepted)
+			return
+		}
+		if user.AuthSource == storage.AuthSourceLDAP {
+			logger.Warn("🔑 [PASSWORD_RESET] LDAP 账号的密码由目录服务器管理，不发送重置链接", "username", user.Username, "client_ip", clientIP)
+			respondJSON(w, http.StatusAccepted, accepted)
+			return
+		}
+
+		token, expiresAt, err := repo.CreatePasswordReset(r.Context(), user.Username, passwordResetTTL)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		emailUserAsync(repo, user.Username, EmailTemplatePasswordResetLink, map[string]any{
+			"Username": user.Username,
+			"Link":     passwordResetLink(r, token),
+			"Minutes":  int(passwordResetTTL.Minutes()),
+			"Expire":   expiresAt.Local().Format("2006-01-02 15:04:05"),
+		})
+
+		logger.Info("🔑 [PASSWORD_RESET] 已发送重置链接", "username", user.Username, "client_ip", clientIP)
+		respondJSON(w, http.StatusAccepted, accepted)
+	})
+}
+
+// NewResetPasswordHandler sets a new password with a reset token and signs the user out everywhere.
+func NewResetPasswordHandler(tokens *auth.TokenStore, repo *storage.TrafficRepository, rateLimiter *LoginRateLimiter) http.Handler {
+	if tokens == nil || repo == nil {
+		panic("reset password handler requires token store and repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+
+		var payload resetPasswordRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&payload); err != nil {
+			writeBadRequest(w, "请求数据格式错误")
+			return
+		}
+		token := strings.TrimSpace(payload.Token)
+		password := strings.TrimSpace(payload.NewPassword)
+		if token == "" {
+			writeBadRequest(w, "缺少重置令牌")
+			return
+		}
+		if len(password) < minRegisterPasswordLength {
+			writeBadRequest(w, fmt.Sprintf("密码至少需要 %d 个字符", minRegisterPasswordLength))
+			return
+		}
+
+		clientIP := getClientIP(r)
+		if rateLimiter != nil {
+			if err := rateLimiter.Check(clientIP, ""); err != nil {
+				writeError(w, http.StatusTooManyRequests, errors.New("too many attempts, please try again later"))
+				return
+			}
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		username, err := repo.ResetPasswordWithToken(r.Context(), token, string(hash))
+		if err != nil {
+			if !errors.Is(err, storage.ErrPasswordResetInvalid) {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			if rateLimiter != nil {
+				rateLimiter.RecordFailure(clientIP, "")
+			}
+			logger.Warn("🔑 [PASSWORD_RESET_FAIL] 重置令牌无效或已过期", "client_ip", clientIP)
+			writeBadRequest(w, "重置链接无效或已过期")
+			return
+		}
+
+		tokens.RevokeUser(username)
+
+		logger.Info("🔑 [PASSWORD_RESET_OK] 密码已通过邮件链接重置", "username", username, "client_ip", clientIP)
+		respondJSON(w, http.StatusOK, map[string]any{"status": "reset"})
+	})
+}
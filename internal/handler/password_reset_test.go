@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPasswordResetLink(t *testing.T) {
+	if err := SetTrustedProxies([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatalf("SetTrustedProxies: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = SetTrustedProxies(nil)
+		SetPasswordResetBaseURL("")
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		pinned     string
+		expected   string
+	}{
+		{
+			name:       "direct request uses host",
+			remoteAddr: "203.0.113.7:52000",
+			expected:   "http://panel.example.com/reset-password?token=abc",
+		},
+		{
+			name:       "spoofed forwarded host from untrusted client is ignored",
+			remoteAddr: "203.0.113.7:52000",
+			headers:    map[string]string{"X-Forwarded-Host": "evil.example.net", "X-Forwarded-Proto": "https"},
+			expected:   "http://panel.example.com/reset-password?token=abc",
+		},
+		{
+			name:       "trusted proxy forwarded host is honoured",
+			remoteAddr: "10.1.2.3:40000",
+			headers:    map[string]string{"X-Forwarded-Host": "mmw.example.org", "X-Forwarded-Proto": "https"},
+			expected:   "https://mmw.example.org/reset-password?token=abc",
+		},
+		{
+			name:       "pinned base url wins",
+			remoteAddr: "10.1.2.3:40000",
+			headers:    map[string]string{"X-Forwarded-Host": "evil.example.net"},
+			pinned:     "https://panel.example.com/",
+			expected:   "https://panel.example.com/reset-password?token=abc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetPasswordResetBaseURL(tt.pinned)
+			r := httptest.NewRequest("POST", "http://panel.example.com/api/password/forgot", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			if got := passwordResetLink(r, "abc"); got != tt.expected {
+				t.Errorf("passwordResetLink() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -3,12 +3,14 @@ package handler
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"math"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"miaomiaowu/internal/logger"
 	"miaomiaowu/internal/storage"
 )
 
@@ -17,31 +19,46 @@ type probeConfigHandler struct {
 }
 
 type probeServerPayload struct {
-	ID                  int64   `json:"id"`
-	ServerID            string  `json:"server_id"`
-	Name                string  `json:"name"`
-	TrafficMethod       string  `json:"traffic_method"`
-	MonthlyTrafficGB    float64 `json:"monthly_traffic_gb"`
-	MonthlyTrafficBytes int64   `json:"monthly_traffic_bytes"`
-	Position            int     `json:"position"`
+	ID                  int64      `json:"id"`
+	ServerID            string     `json:"server_id"`
+	Name                string     `json:"name"`
+	TrafficMethod       string     `json:"traffic_method"`
+	MonthlyTrafficGB    float64    `json:"monthly_traffic_gb"`
+	MonthlyTrafficBytes int64      `json:"monthly_traffic_bytes"`
+	TrafficMultiplier   float64    `json:"traffic_multiplier"`
+	IncludeInTotal      bool       `json:"include_in_total"`
+	ResetDay            int        `json:"reset_day"`
+	ResetTimezone       string     `json:"reset_timezone"`
+	CycleStart          *time.Time `json:"cycle_start,omitempty"`
+	Position            int        `json:"position"`
 }
 
 type probeConfigPayload struct {
-	ProbeType string               `json:"probe_type"`
-	Address   string               `json:"address"`
-	Servers   []probeServerPayload `json:"servers"`
-	CreatedAt time.Time            `json:"created_at"`
-	UpdatedAt time.Time            `json:"updated_at"`
+	ID          int64                   `json:"id"`
+	Name        string                  `json:"name"`
+	ProbeType   string                  `json:"probe_type"`
+	Address     string                  `json:"address"`
+	TrafficUnit string                  `json:"traffic_unit"`
+	Credentials probeCredentialsPayload `json:"credentials"`
+	Servers     []probeServerPayload    `json:"servers"`
+	CreatedAt   time.Time               `json:"created_at"`
+	UpdatedAt   time.Time               `json:"updated_at"`
 }
 
 type probeConfigUpdateRequest struct {
-	ProbeType string `json:"probe_type"`
-	Address   string `json:"address"`
-	Servers   []struct {
-		ServerID         string  `json:"server_id"`
-		Name             string  `json:"name"`
-		TrafficMethod    string  `json:"traffic_method"`
-		MonthlyTrafficGB float64 `json:"monthly_traffic_gb"`
+	Name        string                   `json:"name"`
+	ProbeType   string                   `json:"probe_type"`
+	Address     string                   `json:"address"`
+	Credentials *probeCredentialsRequest `json:"credentials"`
+	Servers     []struct {
+		ServerID          string  `json:"server_id"`
+		Name              string  `json:"name"`
+		TrafficMethod     string  `json:"traffic_method"`
+		MonthlyTrafficGB  float64 `json:"monthly_traffic_gb"`
+		TrafficMultiplier float64 `json:"traffic_multiplier"`
+		IncludeInTotal    *bool   `json:"include_in_total"`
+		ResetDay          int     `json:"reset_day"`
+		ResetTimezone     string  `json:"reset_timezone"`
 	} `json:"servers"`
 }
 
@@ -73,9 +90,10 @@ func (h *probeConfigHandler) handleGet(w http.ResponseWriter, r *http.Request) {
 			// Return empty config instead of 404 when not configured yet
 			respondJSON(w, http.StatusOK, map[string]any{
 				"config": probeConfigPayload{
-					ProbeType: "nezha",
-					Address:   "",
-					Servers:   []probeServerPayload{},
+					ProbeType:   "nezha",
+					Address:     "",
+					TrafficUnit: h.trafficUnit(r),
+					Servers:     []probeServerPayload{},
 				},
 			})
 			return
@@ -85,7 +103,7 @@ func (h *probeConfigHandler) handleGet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	respondJSON(w, http.StatusOK, map[string]any{
-		"config": convertProbeConfigResponse(cfg),
+		"config": convertProbeConfigResponse(cfg, h.trafficUnit(r)),
 	})
 }
 
@@ -96,110 +114,158 @@ func (h *probeConfigHandler) handleUpdate(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	type sanitizedServer struct {
-		ServerID            string
-		Name                string
-		TrafficMethod       string
-		MonthlyTrafficBytes int64
+	trafficUnit := h.trafficUnit(r)
+	cfg, errMsg := buildProbeConfig(payload, trafficUnit)
+	if errMsg != "" {
+		writeBadRequest(w, errMsg)
+		return
+	}
+
+	before := ""
+	if current, err := h.repo.GetProbeConfig(r.Context()); err == nil {
+		cfg.Credentials = mergeProbeCredentials(current.Credentials, payload.Credentials)
+		before = probeConfigAuditSummary(current)
+	}
+
+	updated, err := h.repo.UpsertProbeConfig(r.Context(), cfg)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	ReloadLiveTraffic()
+	recordAudit(r.Context(), "probe_config.update", strconv.FormatInt(updated.ID, 10), before, probeConfigAuditSummary(updated))
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"config": convertProbeConfigResponse(updated, trafficUnit),
+	})
+}
+
+func (h *probeConfigHandler) handleDelete(w http.ResponseWriter, r *http.Request) {
+	current, _ := h.repo.GetProbeConfig(r.Context())
+	if err := h.repo.DeleteProbeConfig(r.Context()); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	ReloadLiveTraffic()
+	recordAudit(r.Context(), "probe_config.delete", strconv.FormatInt(current.ID, 10), probeConfigAuditSummary(current), "")
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"message": "探针配置已删除",
+	})
+}
+
+// trafficUnit returns the instance-wide unit used to interpret monthly_traffic_gb values.
+func (h *probeConfigHandler) trafficUnit(r *http.Request) string {
+	cfg, err := h.repo.GetSystemConfig(r.Context())
+	if err != nil {
+		return storage.TrafficUnitBinary
 	}
+	return cfg.TrafficUnit
+}
 
+// buildProbeConfig validates an update request and converts it to a storage config.
+// The returned message is non-empty when the request is invalid.
+func buildProbeConfig(payload probeConfigUpdateRequest, trafficUnit string) (storage.ProbeConfig, string) {
 	probeType := strings.ToLower(strings.TrimSpace(payload.ProbeType))
 	if _, ok := getAllowedProbeTypes()[probeType]; !ok {
-		writeBadRequest(w, "不支持的探针类型")
-		return
+		return storage.ProbeConfig{}, "不支持的探针类型"
 	}
 
 	address := strings.TrimSpace(payload.Address)
 	if address == "" {
-		writeBadRequest(w, "探针地址不能为空")
-		return
+		return storage.ProbeConfig{}, "探针地址不能为空"
 	}
 
 	if len(payload.Servers) == 0 {
-		writeBadRequest(w, "请至少配置一个服务器")
-		return
+		return storage.ProbeConfig{}, "请至少配置一个服务器"
 	}
 
+	unitSize := trafficUnitSize(trafficUnit)
+
 	allowedMethods := getAllowedTrafficMethods()
-	sanitized := make([]sanitizedServer, 0, len(payload.Servers))
+	servers := make([]storage.ProbeServer, 0, len(payload.Servers))
 	for idx, srv := range payload.Servers {
 		serverID := strings.TrimSpace(srv.ServerID)
 		if serverID == "" {
-			writeBadRequest(w, formatServerError(idx, "服务器 ID 不能为空"))
-			return
+			return storage.ProbeConfig{}, formatServerError(idx, "服务器 ID 不能为空")
 		}
 
 		name := strings.TrimSpace(srv.Name)
 		if name == "" {
-			writeBadRequest(w, formatServerError(idx, "服务器名称不能为空"))
-			return
+			return storage.ProbeConfig{}, formatServerError(idx, "服务器名称不能为空")
 		}
 
 		method := strings.ToLower(strings.TrimSpace(srv.TrafficMethod))
 		if _, ok := allowedMethods[method]; !ok {
-			writeBadRequest(w, formatServerError(idx, "不支持的流量计算方式"))
-			return
+			return storage.ProbeConfig{}, formatServerError(idx, "不支持的流量计算方式")
 		}
 
 		if srv.MonthlyTrafficGB < 0 {
-			writeBadRequest(w, formatServerError(idx, "月流量不能为负数"))
-			return
+			return storage.ProbeConfig{}, formatServerError(idx, "月流量不能为负数")
 		}
 
-		monthlyBytes := int64(math.Round(srv.MonthlyTrafficGB * bytesPerGigabyte))
+		monthlyBytes := int64(math.Round(srv.MonthlyTrafficGB * unitSize))
 		if monthlyBytes < 0 {
 			monthlyBytes = 0
 		}
 
-		sanitized = append(sanitized, sanitizedServer{
+		if srv.TrafficMultiplier < 0 {
+			return storage.ProbeConfig{}, formatServerError(idx, "流量倍率不能为负数")
+		}
+		multiplier := srv.TrafficMultiplier
+		if multiplier == 0 {
+			multiplier = 1
+		}
+
+		// 未指定时默认计入总流量
+		includeInTotal := true
+		if srv.IncludeInTotal != nil {
+			includeInTotal = *srv.IncludeInTotal
+		}
+
+		// 账单周期重置日，0 表示直接使用探针统计的流量
+		if srv.ResetDay < 0 || srv.ResetDay > 31 {
+			return storage.ProbeConfig{}, formatServerError(idx, "流量重置日需在 1-31 之间")
+		}
+		resetTimezone := strings.TrimSpace(srv.ResetTimezone)
+		if resetTimezone != "" {
+			if _, err := time.LoadLocation(resetTimezone); err != nil {
+				return storage.ProbeConfig{}, formatServerError(idx, "无效的时区")
+			}
+		}
+
+		servers = append(servers, storage.ProbeServer{
 			ServerID:            serverID,
 			Name:                name,
 			TrafficMethod:       method,
 			MonthlyTrafficBytes: monthlyBytes,
+			TrafficMultiplier:   multiplier,
+			IncludeInTotal:      includeInTotal,
+			ResetDay:            srv.ResetDay,
+			ResetTimezone:       resetTimezone,
 		})
 	}
 
-	servers := make([]storage.ProbeServer, 0, len(sanitized))
-	for _, srv := range sanitized {
-		servers = append(servers, storage.ProbeServer{
-			ServerID:            srv.ServerID,
-			Name:                srv.Name,
-			TrafficMethod:       srv.TrafficMethod,
-			MonthlyTrafficBytes: srv.MonthlyTrafficBytes,
-		})
-	}
-
-	updated, err := h.repo.UpsertProbeConfig(r.Context(), storage.ProbeConfig{
-		ProbeType: probeType,
-		Address:   address,
-		Servers:   servers,
-	})
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err)
-		return
-	}
-
-	respondJSON(w, http.StatusOK, map[string]any{
-		"config": convertProbeConfigResponse(updated),
-	})
-}
-
-func (h *probeConfigHandler) handleDelete(w http.ResponseWriter, r *http.Request) {
-	if err := h.repo.DeleteProbeConfig(r.Context()); err != nil {
-		writeError(w, http.StatusInternalServerError, err)
-		return
-	}
-
-	respondJSON(w, http.StatusOK, map[string]any{
-		"message": "探针配置已删除",
-	})
+	return storage.ProbeConfig{
+		Name:        strings.TrimSpace(payload.Name),
+		ProbeType:   probeType,
+		Address:     address,
+		Credentials: mergeProbeCredentials(storage.ProbeCredentials{}, payload.Credentials),
+		Servers:     servers,
+	}, ""
 }
 
-func convertProbeConfigResponse(cfg storage.ProbeConfig) probeConfigPayload {
+func convertProbeConfigResponse(cfg storage.ProbeConfig, trafficUnit string) probeConfigPayload {
+	unitSize := trafficUnitSize(trafficUnit)
 	servers := make([]probeServerPayload, 0, len(cfg.Servers))
 	for _, srv := range cfg.Servers {
-		gb := float64(srv.MonthlyTrafficBytes) / bytesPerGigabyte
+		gb := float64(srv.MonthlyTrafficBytes) / unitSize
 		gb = math.Round(gb*100) / 100
+		var cycleStart *time.Time
+		if srv.ResetDay > 0 {
+			start := storage.ProbeServerCycleStart(time.Now(), srv.ResetDay, srv.ResetTimezone)
+			cycleStart = &start
+		}
 		servers = append(servers, probeServerPayload{
 			ID:                  srv.ID,
 			ServerID:            srv.ServerID,
@@ -207,17 +273,34 @@ func convertProbeConfigResponse(cfg storage.ProbeConfig) probeConfigPayload {
 			TrafficMethod:       srv.TrafficMethod,
 			MonthlyTrafficGB:    gb,
 			MonthlyTrafficBytes: srv.MonthlyTrafficBytes,
+			TrafficMultiplier:   srv.TrafficMultiplier,
+			IncludeInTotal:      srv.IncludeInTotal,
+			ResetDay:            srv.ResetDay,
+			ResetTimezone:       srv.ResetTimezone,
+			CycleStart:          cycleStart,
 			Position:            srv.Position,
 		})
 	}
 
 	return probeConfigPayload{
-		ProbeType: cfg.ProbeType,
-		Address:   cfg.Address,
-		Servers:   servers,
-		CreatedAt: cfg.CreatedAt,
-		UpdatedAt: cfg.UpdatedAt,
+		ID:          cfg.ID,
+		Name:        cfg.Name,
+		ProbeType:   cfg.ProbeType,
+		Address:     cfg.Address,
+		TrafficUnit: trafficUnit,
+		Credentials: convertProbeCredentialsResponse(cfg),
+		Servers:     servers,
+		CreatedAt:   cfg.CreatedAt,
+		UpdatedAt:   cfg.UpdatedAt,
+	}
+}
+
+// probeConfigAuditSummary 审计日志中的探针配置摘要，不包含凭据
+func probeConfigAuditSummary(cfg storage.ProbeConfig) string {
+	if cfg.ID == 0 && cfg.Address == "" {
+		return ""
 	}
+	return fmt.Sprintf("name=%s type=%s address=%s servers=%d", cfg.Name, cfg.ProbeType, logger.Redact(cfg.Address), len(cfg.Servers))
 }
 
 func formatServerError(idx int, message string) string {
@@ -226,17 +309,20 @@ func formatServerError(idx int, message string) string {
 
 func getAllowedProbeTypes() map[string]struct{} {
 	return map[string]struct{}{
-		storage.ProbeTypeNezha:   {},
-		storage.ProbeTypeNezhaV0: {},
-		storage.ProbeTypeDstatus: {},
-		storage.ProbeTypeKomari:  {},
+		storage.ProbeTypeNezha:      {},
+		storage.ProbeTypeNezhaV0:    {},
+		storage.ProbeTypeDstatus:    {},
+		storage.ProbeTypeKomari:     {},
+		storage.ProbeTypeUptimeKuma: {},
 	}
 }
 
 func getAllowedTrafficMethods() map[string]struct{} {
 	return map[string]struct{}{
-		storage.TrafficMethodUp:   {},
-		storage.TrafficMethodDown: {},
-		storage.TrafficMethodBoth: {},
+		storage.TrafficMethodUp:            {},
+		storage.TrafficMethodDown:          {},
+		storage.TrafficMethodBoth:          {},
+		storage.TrafficMethodMax:           {},
+		storage.TrafficMethodSumMultiplier: {},
 	}
 }
@@ -0,0 +1,316 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	probeAlertStateFiring   = "firing"
+	probeAlertStateResolved = "resolved"
+	// probeAlertTokenHeader 无法在 URL 中附带 token 时使用的请求头
+	probeAlertTokenHeader = "X-Alert-Token"
+)
+
+// probeAlertResolvedKeywords 未提供 status 时根据消息内容判断告警是否已恢复（哪吒/Komari 默认通知文案）
+var probeAlertResolvedKeywords = []string{"resolved", "recovered", "恢复", "online", "上线"}
+
+// probeAlertPayload 告警 Webhook 请求体。哪吒/Komari 的 Webhook 内容可自定义，推荐模板：
+// {"source":"nezha","server_id":"#SERVER.ID#","server_name":"#SERVER.NAME#","message":"#NEZHA#"}
+type probeAlertPayload struct {
+	Source     string `json:"source"`
+	ServerID   string `json:"server_id"`
+	ServerName string `json:"server_name"`
+	Server     string `json:"server"` // server_name 的别名
+	Status     string `json:"status"` // firing/alert/down 或 resolved/recovered/up；为空时根据 message 判断
+	Message    string `json:"message"`
+}
+
+type nodeProbeAlertDTO struct {
+	Source    string    `json:"source"`
+	Message   string    `json:"message"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+type probeAlertDTO struct {
+	ServerName string    `json:"server_name"`
+	ServerID   string    `json:"server_id"`
+	Source     string    `json:"source"`
+	Message    string    `json:"message"`
+	StartedAt  time.Time `json:"started_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Nodes      []string  `json:"nodes"`
+}
+
+type probeAlertWebhookHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewProbeAlertWebhookHandler accepts alert webhooks from Nezha/Komari panels, authenticated with the
+// shared secret in system config. Alerts are correlated to nodes through their bound probe server.
+func NewProbeAlertWebhookHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("probe alert webhook handler requires repository")
+	}
+
+	return &probeAlertWebhookHandler{repo: repo}
+}
+
+func (h *probeAlertWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	cfg, err := h.repo.GetSystemConfig(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if cfg.ProbeAlertToken == "" {
+		writeError(w, http.StatusNotFound, errors.New("未启用探针告警接收"))
+		return
+	}
+
+	token := strings.TrimSpace(r.URL.Query().Get("token"))
+	if token == "" {
+		token = strings.TrimSpace(r.Header.Get(probeAlertTokenHeader))
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.ProbeAlertToken)) != 1 {
+		writeError(w, http.StatusUnauthorized, errors.New("invalid token"))
+		return
+	}
+
+	payload, err := decodeProbeAlertPayload(w, r)
+	if err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	serverName := h.resolveServerName(r.Context(), payload)
+	if serverName == "" {
+		writeBadRequest(w, "缺少 server_id 或 server_name")
+		return
+	}
+
+	source := strings.ToLower(strings.TrimSpace(payload.Source))
+	if source == "" {
+		source = storage.ProbeTypeNezha
+	}
+
+	state := probeAlertState(payload.Status, payload.Message)
+	if state == probeAlertStateResolved {
+		cleared, err := h.repo.ClearProbeAlert(r.Context(), serverName)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if cleared {
+			logger.Info("[探针告警] 告警已恢复", "server", serverName, "source", source)
+		}
+	} else {
+		alert := storage.ProbeAlert{
+			ServerName: serverName,
+			ServerID:   payload.ServerID,
+			Source:     source,
+			Message:    strings.TrimSpace(payload.Message),
+		}
+		if err := h.repo.RaiseProbeAlert(r.Context(), alert); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		logger.Info("[探针告警] 收到告警", "server", serverName, "source", source, "message", alert.Message)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"server_name": serverName,
+		"state":       state,
+	})
+}
+
+// resolveServerName 优先按 server_id 匹配已配置的探针服务器，匹配不到时使用请求中的名称
+func (h *probeAlertWebhookHandler) resolveServerName(ctx context.Context, payload probeAlertPayload) string {
+	if serverID := strings.TrimSpace(payload.ServerID); serverID != "" {
+		name, err := h.repo.ResolveProbeServerName(ctx, serverID)
+		if err == nil {
+			return name
+		}
+		if !errors.Is(err, storage.ErrProbeServerNotFound) {
+			logger.Warn("[探针告警] 查询探针服务器失败", "server_id", serverID, "error", err)
+		}
+	}
+	name := strings.TrimSpace(payload.ServerName)
+	if name == "" {
+		name = strings.TrimSpace(payload.Server)
+	}
+	// 启用节点名称规范化时，将面板中的名称对应到已配置的探针服务器，确保与节点绑定一致
+	if normalizer := loadNodeNameNormalizer(ctx, h.repo); name != "" && normalizer.enabled {
+		if matched := resolveProbeServerByName(ctx, h.repo, normalizer, name); matched != "" {
+			return matched
+		}
+	}
+	return name
+}
+
+// decodeProbeAlertPayload 支持 JSON 与表单两种 Webhook 请求格式
+func decodeProbeAlertPayload(w http.ResponseWriter, r *http.Request) (probeAlertPayload, error) {
+	var payload probeAlertPayload
+	r.Body = http.MaxBytesReader(w, r.Body, 64<<10)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data" {
+		if err := r.ParseForm(); err != nil {
+			return payload, err
+		}
+		payload = probeAlertPayload{
+			Source:     r.PostForm.Get("source"),
+			ServerID:   r.PostForm.Get("server_id"),
+			ServerName: r.PostForm.Get("server_name"),
+			Server:     r.PostForm.Get("server"),
+			Status:     r.PostForm.Get("status"),
+			Message:    r.PostForm.Get("message"),
+		}
+		return payload, nil
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	return payload, err
+}
+
+// probeAlertState 根据 status 字段（或消息关键字）判断是触发还是恢复
+func probeAlertState(status, message string) string {
+	switch strings.ToLower(strings.TrimSpace(status)) {
+	case "resolved", "recovered", "ok", "up", "online", "clear", "cleared":
+		return probeAlertStateResolved
+	case "":
+		lower := strings.ToLower(message)
+		for _, keyword := range probeAlertResolvedKeywords {
+			if strings.Contains(lower, keyword) {
+				return probeAlertStateResolved
+			}
+		}
+	}
+	return probeAlertStateFiring
+}
+
+type probeAlertsHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewProbeAlertsHandler lists active probe alerts with their bound nodes (GET) and lets admins clear
+// an alert manually (DELETE ?server=) when the panel never sends the recovery notification.
+func NewProbeAlertsHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("probe alerts handler requires repository")
+	}
+
+	return &probeAlertsHandler{repo: repo}
+}
+
+func (h *probeAlertsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.handleList(w, r)
+	case http.MethodDelete:
+		h.handleClear(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+	}
+}
+
+func (h *probeAlertsHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	alerts, err := h.repo.ListProbeAlerts(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	boundNodes := make(map[string][]string)
+	if username := auth.UsernameFromContext(r.Context()); username != "" {
+		nodes, err := h.repo.ListNodes(r.Context(), username)
+		if err != nil {
+			logger.Info("[探针告警] 获取节点列表失败", "username", username, "error", err)
+		}
+		for _, node := range nodes {
+			if node.ProbeServer != "" {
+				boundNodes[node.ProbeServer] = append(boundNodes[node.ProbeServer], node.NodeName)
+			}
+		}
+	}
+
+	items := make([]probeAlertDTO, 0, len(alerts))
+	for _, alert := range alerts {
+		nodes := boundNodes[alert.ServerName]
+		if nodes == nil {
+			nodes = []string{}
+		}
+		items = append(items, probeAlertDTO{
+			ServerName: alert.ServerName,
+			ServerID:   alert.ServerID,
+			Source:     alert.Source,
+			Message:    alert.Message,
+			StartedAt:  alert.StartedAt,
+			UpdatedAt:  alert.UpdatedAt,
+			Nodes:      nodes,
+		})
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{"alerts": items})
+}
+
+func (h *probeAlertsHandler) handleClear(w http.ResponseWriter, r *http.Request) {
+	serverName := strings.TrimSpace(r.URL.Query().Get("server"))
+	if serverName == "" {
+		writeBadRequest(w, "缺少 server 参数")
+		return
+	}
+
+	cleared, err := h.repo.ClearProbeAlert(r.Context(), serverName)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !cleared {
+		writeError(w, http.StatusNotFound, errors.New("告警不存在"))
+		return
+	}
+
+	logger.Info("[探针告警] 管理员手动清除告警", "server", serverName, "user", auth.UsernameFromContext(r.Context()))
+	respondJSON(w, http.StatusOK, map[string]any{"status": "cleared"})
+}
+
+// annotateProbeAlerts 为绑定了告警中探针服务器的节点附加告警信息，供节点列表标记
+func annotateProbeAlerts(ctx context.Context, repo *storage.TrafficRepository, nodes []nodeDTO) {
+	alerts, err := repo.ListProbeAlerts(ctx)
+	if err != nil {
+		logger.Info("[探针告警] 获取告警列表失败", "error", err)
+		return
+	}
+	if len(alerts) == 0 {
+		return
+	}
+
+	byServer := make(map[string]storage.ProbeAlert, len(alerts))
+	for _, alert := range alerts {
+		byServer[alert.ServerName] = alert
+	}
+	for i := range nodes {
+		if alert, ok := byServer[nodes[i].ProbeServer]; ok && nodes[i].ProbeServer != "" {
+			nodes[i].ProbeAlert = &nodeProbeAlertDTO{
+				Source:    alert.Source,
+				Message:   alert.Message,
+				StartedAt: alert.StartedAt,
+			}
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+// 从探针面板同步到节点的服务器信息字段
+const (
+	annotationLocation     = "location"
+	annotationPrice        = "price"
+	annotationBillingCycle = "billing_cycle"
+	annotationExpiresAt    = "expires_at"
+	annotationBandwidth    = "bandwidth"
+	annotationTraffic      = "traffic"
+	annotationRoute        = "route"
+	annotationGroup        = "group"
+	annotationTags         = "tags"
+	annotationNote         = "note"
+)
+
+// setAnnotation 忽略空值
+func setAnnotation(annotations map[string]string, key, value string) {
+	if value = strings.TrimSpace(value); value != "" {
+		annotations[key] = value
+	}
+}
+
+// nezhaServerAnnotations 解析哪吒 v1 的国家代码和公开备注（官方前端的 billingDataMod / planDataMod 格式），
+// 备注不是 JSON 时整体作为备注
+func nezhaServerAnnotations(countryCode, publicNote string) map[string]string {
+	annotations := make(map[string]string)
+	setAnnotation(annotations, annotationLocation, strings.ToUpper(countryCode))
+
+	publicNote = strings.TrimSpace(publicNote)
+	var note struct {
+		Billing struct {
+			EndDate string `json:"endDate"`
+			Cycle   string `json:"cycle"`
+			Amount  string `json:"amount"`
+		} `json:"billingDataMod"`
+		Plan struct {
+			Bandwidth    string `json:"bandwidth"`
+			TrafficVol   string `json:"trafficVol"`
+			NetworkRoute string `json:"networkRoute"`
+			Extra        string `json:"extra"`
+		} `json:"planDataMod"`
+	}
+	if strings.HasPrefix(publicNote, "{") && json.Unmarshal([]byte(publicNote), &note) == nil {
+		setAnnotation(annotations, annotationPrice, note.Billing.Amount)
+		setAnnotation(annotations, annotationBillingCycle, note.Billing.Cycle)
+		if !strings.HasPrefix(note.Billing.EndDate, "0000") {
+			setAnnotation(annotations, annotationExpiresAt, note.Billing.EndDate)
+		}
+		setAnnotation(annotations, annotationBandwidth, note.Plan.Bandwidth)
+		setAnnotation(annotations, annotationTraffic, note.Plan.TrafficVol)
+		setAnnotation(annotations, annotationRoute, note.Plan.NetworkRoute)
+		setAnnotation(annotations, annotationNote, note.Plan.Extra)
+	} else {
+		setAnnotation(annotations, annotationNote, publicNote)
+	}
+
+	if len(annotations) == 0 {
+		return nil
+	}
+	return annotations
+}
+
+// komariNodeInfo Komari /api/nodes 返回的服务器信息
+type komariNodeInfo struct {
+	UUID         string      `json:"uuid"`
+	Name         string      `json:"name"`
+	TrafficLimit json.Number `json:"traffic_limit"`
+	Region       string      `json:"region"`
+	Price        json.Number `json:"price"`
+	BillingCycle json.Number `json:"billing_cycle"`
+	Currency     string      `json:"currency"`
+	ExpiredAt    string      `json:"expired_at"`
+	Group        string      `json:"group"`
+	Tags         string      `json:"tags"`
+	PublicRemark string      `json:"public_remark"`
+}
+
+func (n komariNodeInfo) annotations() map[string]string {
+	annotations := make(map[string]string)
+	setAnnotation(annotations, annotationLocation, n.Region)
+	setAnnotation(annotations, annotationGroup, n.Group)
+	setAnnotation(annotations, annotationNote, n.PublicRemark)
+
+	// Komari 价格为 -1 表示免费，0 表示未设置
+	if price, err := n.Price.Float64(); err == nil {
+		switch {
+		case price < 0:
+			annotations[annotationPrice] = "free"
+		case price > 0:
+			annotations[annotationPrice] = strings.TrimSpace(n.Currency) + strconv.FormatFloat(price, 'f', -1, 64)
+		}
+	}
+	if days, err := n.BillingCycle.Int64(); err == nil && days > 0 {
+		annotations[annotationBillingCycle] = komariBillingCycle(days)
+	}
+	if expiredAt, err := time.Parse(time.RFC3339, strings.TrimSpace(n.ExpiredAt)); err == nil && expiredAt.Year() > 1 {
+		annotations[annotationExpiresAt] = expiredAt.Format("2006-01-02")
+	}
+
+	tags := make([]string, 0)
+	for _, tag := range strings.Split(n.Tags, ";") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > 0 {
+		annotations[annotationTags] = strings.Join(tags, ",")
+	}
+
+	if len(annotations) == 0 {
+		return nil
+	}
+	return annotations
+}
+
+// komariBillingCycle 将 Komari 以天为单位的计费周期转为常见写法
+func komariBillingCycle(days int64) string {
+	switch {
+	case days >= 28 && days <= 31:
+		return "monthly"
+	case days >= 89 && days <= 92:
+		return "quarterly"
+	case days >= 180 && days <= 184:
+		return "semiannually"
+	case days >= 365 && days <= 366:
+		return "annually"
+	default:
+		return fmt.Sprintf("%dd", days)
+	}
+}
+
+// supportsProbeAnnotations 只有哪吒 v1 和 Komari 提供服务器自定义信息
+func supportsProbeAnnotations(probeType string) bool {
+	return probeType == storage.ProbeTypeNezha || probeType == storage.ProbeTypeKomari
+}
+
+// SyncProbeAnnotations pulls server metadata (location, price, tags...) from the Nezha / Komari panels
+// and stores it by probe server name, so every node bound to that server shows it. It returns the
+// number of servers synced; one unreachable panel does not stop the others.
+func SyncProbeAnnotations(ctx context.Context, repo *storage.TrafficRepository) (int, error) {
+	if IsAirGappedMode() {
+		return 0, ErrAirGapped
+	}
+
+	configs, err := repo.ListProbeConfigs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	fetcher := &probeSyncHandler{client: &http.Client{Timeout: 15 * time.Second}, repo: repo}
+	synced := 0
+	var firstErr error
+	for _, cfg := range configs {
+		if !supportsProbeAnnotations(cfg.ProbeType) {
+			continue
+		}
+
+		authCtx, err := withProbeConfigAuth(ctx, fetcher.client, cfg)
+		if err == nil {
+			var servers []probeSyncServer
+			servers, err = fetcher.fetchServers(authCtx, cfg.ProbeType, strings.TrimRight(strings.TrimSpace(cfg.Address), "/"))
+			if err == nil {
+				synced += saveProbeAnnotations(ctx, repo, cfg, servers)
+				continue
+			}
+		}
+
+		logger.Warn("[探针标注] 获取探针服务器信息失败", "config", cfg.Name, "error", err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if err := repo.PruneProbeServerAnnotations(ctx); err != nil {
+		logger.Warn("[探针标注] 清理失效的服务器信息失败", "error", err)
+	}
+
+	if synced == 0 && firstErr != nil {
+		return 0, firstErr
+	}
+	logger.Info("[探针标注] 服务器信息同步完成", "servers", synced)
+	return synced, nil
+}
+
+// saveProbeAnnotations 按服务器 ID 匹配已保存的探针服务器，以服务器名称（节点绑定键）保存
+func saveProbeAnnotations(ctx context.Context, repo *storage.TrafficRepository, cfg storage.ProbeConfig, servers []probeSyncServer) int {
+	byID := make(map[string]probeSyncServer, len(servers))
+	for _, srv := range servers {
+		byID[strings.TrimSpace(srv.ServerID)] = srv
+	}
+
+	saved := 0
+	for _, srv := range cfg.Servers {
+		remote, ok := byID[strings.TrimSpace(srv.ServerID)]
+		if !ok || strings.TrimSpace(srv.Name) == "" {
+			continue
+		}
+		if err := repo.SaveProbeServerAnnotations(ctx, srv.Name, remote.Annotations); err != nil {
+			logger.Warn("[探针标注] 保存服务器信息失败", "server", srv.Name, "error", err)
+			continue
+		}
+		saved++
+	}
+	return saved
+}
+
+type probeAnnotationsEntry struct {
+	ServerName  string            `json:"server_name"`
+	Annotations map[string]string `json:"annotations"`
+	SyncedAt    time.Time         `json:"synced_at"`
+}
+
+type probeAnnotationsHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewProbeAnnotationsHandler lists the synced probe server metadata (GET) and triggers a sync at /sync (POST).
+func NewProbeAnnotationsHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("probe annotations handler requires repository")
+	}
+
+	return &probeAnnotationsHandler{repo: repo}
+}
+
+func (h *probeAnnotationsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/sync") {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		if rejectInAirGappedMode(w) {
+			return
+		}
+		synced, err := SyncProbeAnnotations(r.Context(), h.repo)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]int{"synced": synced})
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	entries, err := h.repo.ListProbeServerAnnotations(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	result := make([]probeAnnotationsEntry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, probeAnnotationsEntry{
+			ServerName:  entry.ServerName,
+			Annotations: entry.Annotations,
+			SyncedAt:    entry.SyncedAt,
+		})
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"servers": result})
+}
@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+// nezhaLoginTokenTTL 哪吒 v1 登录令牌的缓存时长（面板默认有效期为 1 小时）
+const nezhaLoginTokenTTL = 30 * time.Minute
+
+type probeAuthContextKey struct{}
+
+type cachedProbeToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+var (
+	probeTokenCacheMu sync.Mutex
+	probeTokenCache   = make(map[string]cachedProbeToken)
+)
+
+type probeCredentialsRequest struct {
+	Token    string `json:"token"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Clear 为 true 时删除已保存的凭据
+	Clear bool `json:"clear"`
+}
+
+// probeCredentialsPayload 返回给前端的凭据信息，不包含令牌和密码明文
+type probeCredentialsPayload struct {
+	Username    string `json:"username"`
+	TokenSet    bool   `json:"token_set"`
+	PasswordSet bool   `json:"password_set"`
+	Unreadable  bool   `json:"unreadable,omitempty"`
+}
+
+func (c *probeCredentialsRequest) toStorage() storage.ProbeCredentials {
+	if c == nil {
+		return storage.ProbeCredentials{}
+	}
+	return storage.ProbeCredentials{
+		Token:    strings.TrimSpace(c.Token),
+		Username: strings.TrimSpace(c.Username),
+		Password: c.Password,
+	}
+}
+
+// mergeProbeCredentials 合并更新请求与已保存的凭据：未填写的字段保留原值，以免前端回传明文
+func mergeProbeCredentials(existing storage.ProbeCredentials, req *probeCredentialsRequest) storage.ProbeCredentials {
+	if req == nil {
+		return existing
+	}
+	if req.Clear {
+		return storage.ProbeCredentials{}
+	}
+
+	merged := existing
+	incoming := req.toStorage()
+	if incoming.Token != "" {
+		merged.Token = incoming.Token
+	}
+	if incoming.Username != "" {
+		merged.Username = incoming.Username
+	}
+	if incoming.Password != "" {
+		merged.Password = incoming.Password
+	}
+	return merged
+}
+
+func convertProbeCredentialsResponse(cfg storage.ProbeConfig) probeCredentialsPayload {
+	return probeCredentialsPayload{
+		Username:    cfg.Credentials.Username,
+		TokenSet:    cfg.Credentials.Token != "",
+		PasswordSet: cfg.Credentials.Password != "",
+		Unreadable:  cfg.CredentialsUnreadable,
+	}
+}
+
+// withProbeAuth 将探针请求需要携带的认证头放入上下文，供各探针采集函数使用
+func withProbeAuth(ctx context.Context, header http.Header) context.Context {
+	if len(header) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, probeAuthContextKey{}, header)
+}
+
+// probeAuthHeader 返回上下文中的探针认证头（用于 WebSocket 握手），未配置时为 nil
+func probeAuthHeader(ctx context.Context) http.Header {
+	header, _ := ctx.Value(probeAuthContextKey{}).(http.Header)
+	if header == nil {
+		return nil
+	}
+	return header.Clone()
+}
+
+// applyProbeAuth 为探针 HTTP 请求附加认证头
+func applyProbeAuth(req *http.Request) {
+	for key, values := range probeAuthHeader(req.Context()) {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+}
+
+// withProbeConfigAuth 根据探针配置的凭据生成认证头并放入上下文：
+// 令牌作为 Bearer 发送；哪吒 v1 使用账号密码登录换取 JWT，其他探针使用 HTTP Basic 认证
+func withProbeConfigAuth(ctx context.Context, client *http.Client, cfg storage.ProbeConfig) (context.Context, error) {
+	creds := cfg.Credentials
+	if creds.IsZero() {
+		if cfg.CredentialsUnreadable {
+			return ctx, errors.New("探针凭据无法解密，请重新填写")
+		}
+		return ctx, nil
+	}
+
+	header := http.Header{}
+	switch {
+	case creds.Token != "":
+		header.Set("Authorization", "Bearer "+creds.Token)
+	case cfg.ProbeType == storage.ProbeTypeNezha:
+		token, err := nezhaLoginToken(ctx, client, cfg)
+		if err != nil {
+			return ctx, err
+		}
+		header.Set("Authorization", "Bearer "+token)
+		header.Set("Cookie", "nz-jwt="+token)
+	default:
+		basic := base64.StdEncoding.EncodeToString([]byte(creds.Username + ":" + creds.Password))
+		header.Set("Authorization", "Basic "+basic)
+	}
+
+	return withProbeAuth(ctx, header), nil
+}
+
+// nezhaLoginToken 使用账号密码登录哪吒 v1 面板获取 JWT，结果按配置缓存
+func nezhaLoginToken(ctx context.Context, client *http.Client, cfg storage.ProbeConfig) (string, error) {
+	cacheKey := fmt.Sprintf("%d|%s|%s", cfg.ID, strings.TrimRight(cfg.Address, "/"), cfg.Credentials.Username)
+
+	probeTokenCacheMu.Lock()
+	cached, ok := probeTokenCache[cacheKey]
+	probeTokenCacheMu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.token, nil
+	}
+
+	base, err := url.Parse(strings.TrimSpace(cfg.Address))
+	if err != nil {
+		return "", fmt.Errorf("invalid probe address: %w", err)
+	}
+	target := base.ResolveReference(&url.URL{Path: "/api/v1/login"})
+
+	body, err := json.Marshal(map[string]string{
+		"username": cfg.Credentials.Username,
+		"password": cfg.Credentials.Password,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("探针登录失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("read login response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("探针登录失败: 状态码=%d", resp.StatusCode)
+	}
+
+	var payload struct {
+		Success bool   `json:"success"`
+		Error   string `json:"error"`
+		Data    struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return "", fmt.Errorf("parse login response: %w", err)
+	}
+	if payload.Data.Token == "" {
+		if payload.Error != "" {
+			return "", fmt.Errorf("探针登录失败: %s", payload.Error)
+		}
+		return "", errors.New("探针登录失败: 未返回令牌")
+	}
+
+	probeTokenCacheMu.Lock()
+	probeTokenCache[cacheKey] = cachedProbeToken{token: payload.Data.Token, expiresAt: time.Now().Add(nezhaLoginTokenTTL)}
+	probeTokenCacheMu.Unlock()
+
+	logger.Info("[探针认证] 哪吒面板登录成功", "config", cfg.Name)
+	return payload.Data.Token, nil
+}
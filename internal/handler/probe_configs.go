@@ -0,0 +1,341 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+// probeConfigsHandler manages several named probe configurations (e.g. Nezha and Komari side by side).
+type probeConfigsHandler struct {
+	*probeConfigHandler
+	sync *probeSyncHandler
+}
+
+type probeDiscoveredServer struct {
+	probeSyncServer
+	Imported bool `json:"imported"`
+}
+
+type probeDiscoverImportRequest struct {
+	// ServerIDs 为空时导入全部尚未导入的服务器
+	ServerIDs []string `json:"server_ids"`
+}
+
+func NewProbeConfigsHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("probe configs handler requires repository")
+	}
+
+	return &probeConfigsHandler{
+		probeConfigHandler: &probeConfigHandler{repo: repo},
+		sync:               &probeSyncHandler{client: &http.Client{Timeout: 15 * time.Second}, repo: repo},
+	}
+}
+
+func (h *probeConfigsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	idPart := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/probe-configs"), "/")
+	if idPart == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.handleList(w, r)
+		case http.MethodPost:
+			h.handleCreate(w, r)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+		return
+	}
+
+	idPart, action, _ := strings.Cut(idPart, "/")
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil || id <= 0 {
+		writeBadRequest(w, "无效的探针配置ID")
+		return
+	}
+
+	if action == "discover" {
+		switch r.Method {
+		case http.MethodGet:
+			h.handleDiscover(w, r, id)
+		case http.MethodPost:
+			h.handleDiscoverImport(w, r, id)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+		return
+	}
+	if action != "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.handleGetOne(w, r, id)
+	case http.MethodPut:
+		h.handleUpdateOne(w, r, id)
+	case http.MethodDelete:
+		h.handleDeleteOne(w, r, id)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (h *probeConfigsHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	configs, err := h.repo.ListProbeConfigs(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	trafficUnit := h.trafficUnit(r)
+	items := make([]probeConfigPayload, 0, len(configs))
+	for _, cfg := range configs {
+		items = append(items, convertProbeConfigResponse(cfg, trafficUnit))
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"configs": items,
+	})
+}
+
+func (h *probeConfigsHandler) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var payload probeConfigUpdateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	trafficUnit := h.trafficUnit(r)
+	cfg, errMsg := buildProbeConfig(payload, trafficUnit)
+	if errMsg != "" {
+		writeBadRequest(w, errMsg)
+		return
+	}
+
+	created, err := h.repo.CreateProbeConfig(r.Context(), cfg)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	ReloadLiveTraffic()
+	recordAudit(r.Context(), "probe_config.create", strconv.FormatInt(created.ID, 10), "", probeConfigAuditSummary(created))
+
+	respondJSON(w, http.StatusCreated, map[string]any{
+		"config": convertProbeConfigResponse(created, trafficUnit),
+	})
+}
+
+func (h *probeConfigsHandler) handleGetOne(w http.ResponseWriter, r *http.Request, id int64) {
+	cfg, err := h.repo.GetProbeConfigByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, storage.ErrProbeConfigNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"config": convertProbeConfigResponse(cfg, h.trafficUnit(r)),
+	})
+}
+
+func (h *probeConfigsHandler) handleUpdateOne(w http.ResponseWriter, r *http.Request, id int64) {
+	var payload probeConfigUpdateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	trafficUnit := h.trafficUnit(r)
+	cfg, errMsg := buildProbeConfig(payload, trafficUnit)
+	if errMsg != "" {
+		writeBadRequest(w, errMsg)
+		return
+	}
+	cfg.ID = id
+
+	current, err := h.repo.GetProbeConfigByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, storage.ErrProbeConfigNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	cfg.Credentials = mergeProbeCredentials(current.Credentials, payload.Credentials)
+
+	updated, err := h.repo.UpdateProbeConfig(r.Context(), cfg)
+	if err != nil {
+		if errors.Is(err, storage.ErrProbeConfigNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	ReloadLiveTraffic()
+	recordAudit(r.Context(), "probe_config.update", strconv.FormatInt(id, 10), probeConfigAuditSummary(current), probeConfigAuditSummary(updated))
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"config": convertProbeConfigResponse(updated, trafficUnit),
+	})
+}
+
+func (h *probeConfigsHandler) handleDeleteOne(w http.ResponseWriter, r *http.Request, id int64) {
+	before := ""
+	if current, err := h.repo.GetProbeConfigByID(r.Context(), id); err == nil {
+		before = probeConfigAuditSummary(current)
+	}
+	if err := h.repo.DeleteProbeConfigByID(r.Context(), id); err != nil {
+		if errors.Is(err, storage.ErrProbeConfigNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	ReloadLiveTraffic()
+	recordAudit(r.Context(), "probe_config.delete", strconv.FormatInt(id, 10), before, "")
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"message": "探针配置已删除",
+	})
+}
+
+// discover 从探针面板读取服务器列表，并标记已导入的服务器
+func (h *probeConfigsHandler) discover(r *http.Request, id int64) (storage.ProbeConfig, []probeDiscoveredServer, int, error) {
+	cfg, err := h.repo.GetProbeConfigByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, storage.ErrProbeConfigNotFound) {
+			return storage.ProbeConfig{}, nil, http.StatusNotFound, err
+		}
+		return storage.ProbeConfig{}, nil, http.StatusInternalServerError, err
+	}
+
+	ctx, err := withProbeConfigAuth(r.Context(), h.sync.client, cfg)
+	if err != nil {
+		return storage.ProbeConfig{}, nil, http.StatusBadGateway, err
+	}
+
+	servers, err := h.sync.fetchServers(ctx, cfg.ProbeType, strings.TrimRight(cfg.Address, "/"))
+	if err != nil {
+		logger.Info("[探针发现] 获取服务器列表失败", "config", cfg.Name, "type", cfg.ProbeType, "error", err)
+		return storage.ProbeConfig{}, nil, http.StatusBadGateway, err
+	}
+
+	imported := make(map[string]struct{}, len(cfg.Servers))
+	for _, srv := range cfg.Servers {
+		imported[srv.ServerID] = struct{}{}
+	}
+
+	discovered := make([]probeDiscoveredServer, 0, len(servers))
+	for _, srv := range servers {
+		_, ok := imported[srv.ServerID]
+		discovered = append(discovered, probeDiscoveredServer{probeSyncServer: srv, Imported: ok})
+	}
+
+	return cfg, discovered, http.StatusOK, nil
+}
+
+func (h *probeConfigsHandler) handleDiscover(w http.ResponseWriter, r *http.Request, id int64) {
+	if rejectInAirGappedMode(w) {
+		return
+	}
+
+	_, discovered, status, err := h.discover(r, id)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"servers": discovered,
+	})
+}
+
+// handleDiscoverImport 将探针面板中发现的服务器批量追加到探针配置，已导入的服务器保持不变
+func (h *probeConfigsHandler) handleDiscoverImport(w http.ResponseWriter, r *http.Request, id int64) {
+	if rejectInAirGappedMode(w) {
+		return
+	}
+
+	var payload probeDiscoverImportRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&payload); err != nil {
+			writeBadRequest(w, "请求数据格式错误")
+			return
+		}
+	}
+
+	cfg, discovered, status, err := h.discover(r, id)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+
+	selected := make(map[string]struct{}, len(payload.ServerIDs))
+	for _, serverID := range payload.ServerIDs {
+		if serverID = strings.TrimSpace(serverID); serverID != "" {
+			selected[serverID] = struct{}{}
+		}
+	}
+
+	trafficUnit := h.trafficUnit(r)
+	unitSize := trafficUnitSize(trafficUnit)
+	added := 0
+	for _, srv := range discovered {
+		if srv.Imported {
+			continue
+		}
+		if len(selected) > 0 {
+			if _, ok := selected[srv.ServerID]; !ok {
+				continue
+			}
+		}
+
+		method := srv.TrafficMethod
+		if _, ok := getAllowedTrafficMethods()[method]; !ok {
+			method = storage.TrafficMethodBoth
+		}
+		monthlyBytes := int64(math.Round(srv.MonthlyTrafficGB * unitSize))
+		if monthlyBytes < 0 {
+			monthlyBytes = 0
+		}
+
+		cfg.Servers = append(cfg.Servers, storage.ProbeServer{
+			ServerID:            srv.ServerID,
+			Name:                srv.Name,
+			TrafficMethod:       method,
+			MonthlyTrafficBytes: monthlyBytes,
+			TrafficMultiplier:   1,
+			IncludeInTotal:      true,
+		})
+		added++
+	}
+
+	if added > 0 {
+		cfg, err = h.repo.UpdateProbeConfig(r.Context(), cfg)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	logger.Info("[探针发现] 批量导入服务器", "config", cfg.Name, "added", added)
+	respondJSON(w, http.StatusOK, map[string]any{
+		"added":  added,
+		"config": convertProbeConfigResponse(cfg, trafficUnit),
+	})
+}
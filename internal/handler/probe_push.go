@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+type probePushRequest struct {
+	ConfigID int64 `json:"config_id"`
+	Servers  []struct {
+		ServerID string `json:"server_id"`
+		Up       int64  `json:"up"`
+		Down     int64  `json:"down"`
+	} `json:"servers"`
+}
+
+type probePushHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewProbePushHandler accepts cumulative traffic counters pushed by probe agents. In air-gapped mode
+// these reports replace pulling from the probe panel.
+func NewProbePushHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("probe push handler requires repository")
+	}
+
+	return &probePushHandler{repo: repo}
+}
+
+func (h *probePushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var payload probePushRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+	if payload.ConfigID <= 0 {
+		writeBadRequest(w, "缺少 config_id")
+		return
+	}
+
+	cfg, err := h.repo.GetProbeConfigByID(r.Context(), payload.ConfigID)
+	if err != nil {
+		if errors.Is(err, storage.ErrProbeConfigNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	known := make(map[string]struct{}, len(cfg.Servers))
+	for _, srv := range cfg.Servers {
+		known[srv.ServerID] = struct{}{}
+	}
+
+	reports := make([]storage.ProbePushReport, 0, len(payload.Servers))
+	ignored := make([]string, 0)
+	for _, item := range payload.Servers {
+		serverID := strings.TrimSpace(item.ServerID)
+		if _, ok := known[serverID]; !ok {
+			ignored = append(ignored, serverID)
+			continue
+		}
+		if item.Up < 0 || item.Down < 0 {
+			writeBadRequest(w, "流量不能为负数")
+			return
+		}
+		reports = append(reports, storage.ProbePushReport{
+			ConfigID:  cfg.ID,
+			ServerID:  serverID,
+			UpBytes:   item.Up,
+			DownBytes: item.Down,
+		})
+	}
+
+	if err := h.repo.SaveProbePushReports(r.Context(), cfg.ID, reports); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logger.Info("[探针推送] 已接收流量数据", "config", cfg.Name, "accepted", len(reports), "ignored", len(ignored))
+	respondJSON(w, http.StatusOK, map[string]any{
+		"accepted": len(reports),
+		"ignored":  ignored,
+	})
+}
+
+// fetchPushedTotals 使用探针推送的流量数据计算配置的流量（离线模式下不主动拉取探针）
+func (h *TrafficSummaryHandler) fetchPushedTotals(ctx context.Context, cfg storage.ProbeConfig) (int64, int64, int64, error) {
+	reports, err := h.repo.ListProbePushReports(ctx, cfg.ID)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	var totalLimit int64
+	var totalUsed int64
+	for _, srv := range cfg.Servers {
+		totalLimit += srv.MonthlyTrafficBytes
+
+		report, ok := reports[srv.ServerID]
+		if !ok {
+			logger.Info("[探针推送] 服务器尚未推送流量数据", "server_id", srv.ServerID)
+			continue
+		}
+
+		used := computeServerUsage(srv, report.UpBytes, report.DownBytes)
+		used = h.cycleUsage(ctx, cfg.ID, srv, used)
+		if used < 0 {
+			used = 0
+		}
+		if srv.MonthlyTrafficBytes > 0 && used > srv.MonthlyTrafficBytes {
+			used = srv.MonthlyTrafficBytes
+		}
+		h.recordServerUsage(ctx, cfg.ID, srv, used)
+		totalUsed += used
+	}
+
+	totalRemaining := totalLimit - totalUsed
+	if totalRemaining < 0 {
+		totalRemaining = 0
+	}
+
+	return totalLimit, totalRemaining, totalUsed, nil
+}
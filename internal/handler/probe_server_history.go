@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	probeServerHistoryPrefix = "/api/traffic/servers/"
+	maxProbeServerHistory    = 366
+)
+
+type probeServerHistoryResponse struct {
+	ServerID   int64                   `json:"server_id"`
+	ConfigID   int64                   `json:"config_id"`
+	Name       string                  `json:"name"`
+	Unit       string                  `json:"unit"`
+	LimitGB    float64                 `json:"limit_gb"`
+	CycleStart string                  `json:"cycle_start"`
+	History    []probeServerDailyUsage `json:"history"`
+}
+
+type probeServerDailyUsage struct {
+	Date        string  `json:"date"`
+	UsedGB      float64 `json:"used_gb"`
+	DailyUsedGB float64 `json:"daily_used_gb"`
+	LimitGB     float64 `json:"limit_gb"`
+}
+
+type probeServerHistoryHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewProbeServerHistoryHandler serves /api/traffic/servers/{id}/history: the daily usage snapshots of
+// one probe server, by default for its current billing cycle (or calendar month without a reset day).
+func NewProbeServerHistoryHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("probe server history handler requires repository")
+	}
+
+	return &probeServerHistoryHandler{repo: repo}
+}
+
+// recordServerUsage 记录单台探针服务器当天的周期用量，供按服务器绘制流量图表
+func (h *TrafficSummaryHandler) recordServerUsage(ctx context.Context, configID int64, srv storage.ProbeServer, used int64) {
+	markServerCollected(ctx, configID, srv.ServerID)
+	if h.repo == nil {
+		return
+	}
+	if err := h.repo.RecordProbeServerDaily(ctx, configID, srv.ServerID, h.rolloverNow(ctx), used, srv.MonthlyTrafficBytes); err != nil {
+		logger.Warn("[流量统计] 记录服务器流量快照失败", "server_id", srv.ServerID, "error", err)
+	}
+}
+
+func (h *probeServerHistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, probeServerHistoryPrefix), "/")
+	idPart, action, _ := strings.Cut(path, "/")
+	if action != "history" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil || id <= 0 {
+		writeBadRequest(w, "无效的服务器 ID")
+		return
+	}
+
+	days := 0
+	if raw := strings.TrimSpace(r.URL.Query().Get("days")); raw != "" {
+		days, err = strconv.Atoi(raw)
+		if err != nil || days <= 0 || days > maxProbeServerHistory {
+			writeBadRequest(w, "days 参数无效，范围 1-366")
+			return
+		}
+	}
+
+	ctx := r.Context()
+	srv, err := h.repo.GetProbeServerByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrProbeServerNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	cfg, err := h.repo.GetSystemConfig(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	loc, err := collectorLocation(cfg.CollectorTimezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	now := time.Now().In(loc)
+
+	cycleStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	if srv.ResetDay > 0 {
+		cycleStart = storage.ProbeServerCycleStart(now, srv.ResetDay, srv.ResetTimezone)
+	}
+	since := cycleStart
+	if days > 0 {
+		since = time.Date(now.Year(), now.Month(), now.Day()-days+1, 0, 0, 0, 0, loc)
+	}
+
+	records, err := h.repo.ListProbeServerDaily(ctx, srv.ConfigID, srv.ServerID, since)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	unitSize := trafficUnitSize(cfg.TrafficUnit)
+	history := make([]probeServerDailyUsage, 0, len(records))
+	var prevUsed int64
+	for i, record := range records {
+		// 用量为周期累计值，回落（进入新周期）时当天增量即为当前用量
+		delta := record.UsedBytes
+		if i > 0 && record.UsedBytes >= prevUsed {
+			delta = record.UsedBytes - prevUsed
+		}
+		prevUsed = record.UsedBytes
+
+		history = append(history, probeServerDailyUsage{
+			Date:        record.Date.Format("2006-01-02"),
+			UsedGB:      roundUpTwoDecimals(bytesToUnit(record.UsedBytes, unitSize)),
+			DailyUsedGB: roundUpTwoDecimals(bytesToUnit(delta, unitSize)),
+			LimitGB:     roundUpTwoDecimals(bytesToUnit(record.LimitBytes, unitSize)),
+		})
+	}
+
+	respondJSON(w, http.StatusOK, probeServerHistoryResponse{
+		ServerID:   srv.ID,
+		ConfigID:   srv.ConfigID,
+		Name:       srv.Name,
+		Unit:       trafficUnitLabel(cfg.TrafficUnit),
+		LimitGB:    roundUpTwoDecimals(bytesToUnit(srv.MonthlyTrafficBytes, unitSize)),
+		CycleStart: cycleStart.Format("2006-01-02"),
+		History:    history,
+	})
+}
@@ -26,8 +26,11 @@ type probeSyncHandler struct {
 }
 
 type probeSyncRequest struct {
-	ProbeType string `json:"probe_type"`
-	Address   string `json:"address"`
+	ProbeType   string                   `json:"probe_type"`
+	Address     string                   `json:"address"`
+	Credentials *probeCredentialsRequest `json:"credentials"`
+	// ConfigID 未提供 credentials 时使用已保存探针配置的凭据
+	ConfigID int64 `json:"config_id"`
 }
 
 type probeSyncServer struct {
@@ -35,6 +38,8 @@ type probeSyncServer struct {
 	Name             string  `json:"name"`
 	TrafficMethod    string  `json:"traffic_method"`
 	MonthlyTrafficGB float64 `json:"monthly_traffic_gb"`
+	// Annotations 面板中的服务器信息（地区、价格、标签等），同步到绑定的节点
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 type probeSyncResponse struct {
@@ -71,26 +76,30 @@ func (h *probeSyncHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var servers []probeSyncServer
-	var err error
-
-	logger.Info("[探针同步] 开始获取探针信息", "type", probeType, "address", address)
-
-	switch probeType {
-	case storage.ProbeTypeNezha:
-		servers, err = h.fetchNezhaServers(r.Context(), address)
-	case storage.ProbeTypeNezhaV0:
-		servers, err = h.fetchNezhaV0Servers(r.Context(), address)
-	case storage.ProbeTypeDstatus:
-		servers, err = h.fetchDstatusServers(r.Context(), address)
-	case storage.ProbeTypeKomari:
-		servers, err = h.fetchKomariServers(r.Context(), address)
-	default:
+	if _, ok := getAllowedProbeTypes()[probeType]; !ok {
 		logger.Info("[探针同步] 不支持的探针类型", "type", probeType)
 		writeBadRequest(w, "不支持的探针类型")
 		return
 	}
 
+	cfg := storage.ProbeConfig{ProbeType: probeType, Address: address, Credentials: payload.Credentials.toStorage()}
+	if payload.Credentials == nil && payload.ConfigID > 0 {
+		if saved, err := h.repo.GetProbeConfigByID(r.Context(), payload.ConfigID); err == nil {
+			cfg.ID = saved.ID
+			cfg.Credentials = saved.Credentials
+			cfg.CredentialsUnreadable = saved.CredentialsUnreadable
+		}
+	}
+
+	ctx, err := withProbeConfigAuth(r.Context(), h.client, cfg)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	logger.Info("[探针同步] 开始获取探针信息", "type", probeType, "address", address)
+
+	servers, err := h.fetchServers(ctx, probeType, address)
 	if err != nil {
 		logger.Info("[探针同步] 获取探针信息失败", "type", probeType, "address", address, "error", err)
 		writeError(w, http.StatusBadGateway, err)
@@ -101,6 +110,24 @@ func (h *probeSyncHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, probeSyncResponse{Servers: servers})
 }
 
+// fetchServers 按探针类型从探针面板读取服务器列表
+func (h *probeSyncHandler) fetchServers(ctx context.Context, probeType, address string) ([]probeSyncServer, error) {
+	switch probeType {
+	case storage.ProbeTypeNezha:
+		return h.fetchNezhaServers(ctx, address)
+	case storage.ProbeTypeNezhaV0:
+		return h.fetchNezhaV0Servers(ctx, address)
+	case storage.ProbeTypeDstatus:
+		return h.fetchDstatusServers(ctx, address)
+	case storage.ProbeTypeKomari:
+		return h.fetchKomariServers(ctx, address)
+	case storage.ProbeTypeUptimeKuma:
+		return h.fetchUptimeKumaServers(ctx, address)
+	default:
+		return nil, fmt.Errorf("unsupported probe type: %s", probeType)
+	}
+}
+
 func (h *probeSyncHandler) fetchNezhaServers(ctx context.Context, address string) ([]probeSyncServer, error) {
 	logger.Info("[探针同步-Nezha] 开始解析地址", "address", address)
 
@@ -129,7 +156,7 @@ func (h *probeSyncHandler) fetchNezhaServers(ctx context.Context, address string
 	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	conn, resp, err := websocket.DefaultDialer.DialContext(dialCtx, target.String(), nil)
+	conn, resp, err := websocket.DefaultDialer.DialContext(dialCtx, target.String(), probeAuthHeader(ctx))
 	if err != nil {
 		var respInfo string
 		if resp != nil {
@@ -166,8 +193,10 @@ func (h *probeSyncHandler) fetchNezhaServers(ctx context.Context, address string
 	}
 
 	type nezhaServer struct {
-		ID   json.Number `json:"id"`
-		Name string      `json:"name"`
+		ID          json.Number `json:"id"`
+		Name        string      `json:"name"`
+		CountryCode string      `json:"country_code"`
+		PublicNote  string      `json:"public_note"`
 	}
 
 	type nezhaSnapshot struct {
@@ -244,6 +273,7 @@ func (h *probeSyncHandler) fetchNezhaServers(ctx context.Context, address string
 			Name:             name,
 			TrafficMethod:    "both",
 			MonthlyTrafficGB: 0,
+			Annotations:      nezhaServerAnnotations(srv.CountryCode, srv.PublicNote),
 		})
 	}
 
@@ -269,6 +299,7 @@ func (h *probeSyncHandler) fetchDstatusServers(ctx context.Context, address stri
 		logger.Info("[探针同步-Dstatus] 创建请求失败", "error", err)
 		return nil, err
 	}
+	applyProbeAuth(req)
 
 	resp, err := h.client.Do(req)
 	if err != nil {
@@ -350,6 +381,7 @@ func (h *probeSyncHandler) fetchDstatusServers(ctx context.Context, address stri
 		payload, _ := json.Marshal(map[string][]string{"serverIds": serverIDs})
 		statsReq, err := http.NewRequestWithContext(ctx, http.MethodPost, statsTarget.String(), bytes.NewReader(payload))
 		if err == nil {
+			applyProbeAuth(statsReq)
 			statsReq.Header.Set("Content-Type", "application/json")
 			statsReq.Header.Set("Accept", "application/json")
 
@@ -421,6 +453,7 @@ func (h *probeSyncHandler) fetchNezhaV0Servers(ctx context.Context, address stri
 		logger.Info("[探针同步-NezhaV0] 创建请求失败", "error", err)
 		return nil, err
 	}
+	applyProbeAuth(req)
 
 	resp, err := h.client.Do(req)
 	var serverResp struct {
@@ -542,6 +575,7 @@ func (h *probeSyncHandler) fetchKomariServers(ctx context.Context, address strin
 		logger.Info("[探针同步-Komari] 创建请求失败", "error", err)
 		return nil, err
 	}
+	applyProbeAuth(req)
 
 	resp, err := h.client.Do(req)
 	if err != nil {
@@ -566,11 +600,7 @@ func (h *probeSyncHandler) fetchKomariServers(ctx context.Context, address strin
 	}
 
 	var nodesResp struct {
-		Data []struct {
-			UUID         string      `json:"uuid"`
-			Name         string      `json:"name"`
-			TrafficLimit json.Number `json:"traffic_limit"`
-		} `json:"data"`
+		Data []komariNodeInfo `json:"data"`
 	}
 
 	decoder := json.NewDecoder(bytes.NewReader(bodyBytes))
@@ -607,6 +637,7 @@ func (h *probeSyncHandler) fetchKomariServers(ctx context.Context, address strin
 			Name:             name,
 			TrafficMethod:    "both",
 			MonthlyTrafficGB: monthlyGB,
+			Annotations:      node.annotations(),
 		})
 	}
 
@@ -634,7 +665,7 @@ func (h *probeSyncHandler) fetchNezhaV0ServersViaWebSocket(ctx context.Context,
 	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	conn, resp, err := websocket.DefaultDialer.DialContext(dialCtx, target.String(), nil)
+	conn, resp, err := websocket.DefaultDialer.DialContext(dialCtx, target.String(), probeAuthHeader(ctx))
 	if err != nil {
 		if resp != nil {
 			logger.Info("[探针同步-NezhaV0-WS] WebSocket连接失败，收到HTTP状态码", "status", resp.StatusCode)
@@ -0,0 +1,346 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	ProbeStatusUp          = "up"
+	ProbeStatusDown        = "down"
+	ProbeStatusPending     = "pending"
+	ProbeStatusMaintenance = "maintenance"
+	ProbeStatusUnknown     = "unknown"
+)
+
+// uptimeKumaMonitor 是从 Uptime Kuma 状态页读取到的单个监控项
+type uptimeKumaMonitor struct {
+	ID        string
+	Name      string
+	Status    string
+	Message   string
+	PingMs    *float64
+	Uptime24h *float64
+	LastCheck time.Time
+}
+
+// parseUptimeKumaAddress 解析状态页地址，如 https://kuma.example.com/status/<slug>
+func parseUptimeKumaAddress(address string) (*url.URL, string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(address))
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid probe address: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, "", errors.New("Uptime Kuma 地址必须以 http:// 或 https:// 开头")
+	}
+
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	slug := ""
+	prefix := ""
+	for i, segment := range segments {
+		if segment == "status" && i+1 < len(segments) {
+			slug = segments[i+1]
+			prefix = strings.Join(segments[:i], "/")
+			break
+		}
+	}
+	if slug == "" {
+		return nil, "", errors.New("Uptime Kuma 地址需包含状态页路径，如 https://kuma.example.com/status/<slug>")
+	}
+
+	base := &url.URL{Scheme: parsed.Scheme, Host: parsed.Host}
+	if prefix != "" {
+		// 支持反向代理到子路径的部署
+		base.Path = "/" + prefix
+	}
+	return base, slug, nil
+}
+
+func uptimeKumaStatusName(status int) string {
+	switch status {
+	case 0:
+		return ProbeStatusDown
+	case 1:
+		return ProbeStatusUp
+	case 2:
+		return ProbeStatusPending
+	case 3:
+		return ProbeStatusMaintenance
+	default:
+		return ProbeStatusUnknown
+	}
+}
+
+func getUptimeKumaJSON(ctx context.Context, client *http.Client, target string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	applyProbeAuth(req)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("服务器接口返回异常: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("服务器接口返回异常: 状态码=%d", resp.StatusCode)
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("parse response: %w", err)
+	}
+	return nil
+}
+
+// fetchUptimeKumaMonitors 通过公开状态页 API 读取监控项列表及最新心跳
+func fetchUptimeKumaMonitors(ctx context.Context, client *http.Client, address string) ([]uptimeKumaMonitor, error) {
+	base, slug, err := parseUptimeKumaAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	escapedSlug := url.PathEscape(slug)
+	pageURL := strings.TrimRight(base.String(), "/") + "/api/status-page/" + escapedSlug
+	heartbeatURL := strings.TrimRight(base.String(), "/") + "/api/status-page/heartbeat/" + escapedSlug
+
+	var page struct {
+		PublicGroupList []struct {
+			Name        string `json:"name"`
+			MonitorList []struct {
+				ID   json.Number `json:"id"`
+				Name string      `json:"name"`
+			} `json:"monitorList"`
+		} `json:"publicGroupList"`
+	}
+	if err := getUptimeKumaJSON(ctx, client, pageURL, &page); err != nil {
+		logger.Info("[探针-UptimeKuma] 获取状态页失败", "url", pageURL, "error", err)
+		return nil, err
+	}
+
+	var heartbeats struct {
+		HeartbeatList map[string][]struct {
+			Status int      `json:"status"`
+			Time   string   `json:"time"`
+			Msg    string   `json:"msg"`
+			Ping   *float64 `json:"ping"`
+		} `json:"heartbeatList"`
+		UptimeList map[string]float64 `json:"uptimeList"`
+	}
+	if err := getUptimeKumaJSON(ctx, client, heartbeatURL, &heartbeats); err != nil {
+		logger.Info("[探针-UptimeKuma] 获取心跳失败", "url", heartbeatURL, "error", err)
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	monitors := make([]uptimeKumaMonitor, 0)
+	for _, group := range page.PublicGroupList {
+		for _, item := range group.MonitorList {
+			id := item.ID.String()
+			if id == "" {
+				continue
+			}
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+
+			monitor := uptimeKumaMonitor{
+				ID:     id,
+				Name:   strings.TrimSpace(item.Name),
+				Status: ProbeStatusUnknown,
+			}
+
+			// 心跳按时间升序返回，最后一条为最新状态
+			if beats := heartbeats.HeartbeatList[id]; len(beats) > 0 {
+				latest := beats[len(beats)-1]
+				monitor.Status = uptimeKumaStatusName(latest.Status)
+				monitor.Message = latest.Msg
+				monitor.PingMs = latest.Ping
+				if ts, err := time.ParseInLocation("2006-01-02 15:04:05.000", latest.Time, time.UTC); err == nil {
+					monitor.LastCheck = ts
+				} else if ts, err := time.ParseInLocation("2006-01-02 15:04:05", latest.Time, time.UTC); err == nil {
+					monitor.LastCheck = ts
+				}
+			}
+			if uptime, ok := heartbeats.UptimeList[id+"_24"]; ok {
+				value := uptime
+				monitor.Uptime24h = &value
+			}
+
+			monitors = append(monitors, monitor)
+		}
+	}
+
+	sort.SliceStable(monitors, func(i, j int) bool {
+		a, errA := strconv.Atoi(monitors[i].ID)
+		b, errB := strconv.Atoi(monitors[j].ID)
+		if errA != nil || errB != nil {
+			return monitors[i].ID < monitors[j].ID
+		}
+		return a < b
+	})
+
+	return monitors, nil
+}
+
+func (h *probeSyncHandler) fetchUptimeKumaServers(ctx context.Context, address string) ([]probeSyncServer, error) {
+	logger.Info("[探针同步-UptimeKuma] 请求监控项列表", "address", address)
+
+	monitors, err := fetchUptimeKumaMonitors(ctx, h.client, address)
+	if err != nil {
+		return nil, err
+	}
+	if len(monitors) == 0 {
+		return nil, errors.New("未从状态页获取到监控项，请确认状态页已添加监控")
+	}
+
+	servers := make([]probeSyncServer, 0, len(monitors))
+	for i, monitor := range monitors {
+		name := monitor.Name
+		if name == "" {
+			name = fmt.Sprintf("监控 %d", i+1)
+		}
+		// Uptime Kuma 不提供流量数据，月流量需手动填写
+		servers = append(servers, probeSyncServer{
+			ServerID:         monitor.ID,
+			Name:             name,
+			TrafficMethod:    storage.TrafficMethodBoth,
+			MonthlyTrafficGB: 0,
+		})
+	}
+
+	logger.Info("[探针同步-UptimeKuma] 成功获取监控项", "server_count", len(servers))
+	return servers, nil
+}
+
+type probeServerStatusPayload struct {
+	ConfigID   int64      `json:"config_id"`
+	ConfigName string     `json:"config_name"`
+	ServerID   string     `json:"server_id"`
+	Name       string     `json:"name"`
+	Status     string     `json:"status"`
+	Message    string     `json:"message,omitempty"`
+	PingMs     *float64   `json:"ping_ms,omitempty"`
+	Uptime24h  *float64   `json:"uptime_24h,omitempty"`
+	LastCheck  *time.Time `json:"last_check,omitempty"`
+	Nodes      []string   `json:"nodes"`
+}
+
+type probeStatusHandler struct {
+	client *http.Client
+	repo   *storage.TrafficRepository
+}
+
+// NewProbeStatusHandler reports up/down status of configured probe servers together with the nodes bound to them.
+func NewProbeStatusHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("probe status handler requires repository")
+	}
+
+	return &probeStatusHandler{client: &http.Client{Timeout: 15 * time.Second}, repo: repo}
+}
+
+func (h *probeStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	configs, err := h.repo.ListProbeConfigs(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// 节点通过 probe_server（探针服务器名称）绑定
+	boundNodes := make(map[string][]string)
+	if username := auth.UsernameFromContext(r.Context()); username != "" {
+		nodes, err := h.repo.ListNodes(r.Context(), username)
+		if err != nil {
+			logger.Info("[探针状态] 获取节点列表失败", "username", username, "error", err)
+		}
+		for _, node := range nodes {
+			probeServer := strings.TrimSpace(node.ProbeServer)
+			if probeServer == "" {
+				continue
+			}
+			boundNodes[probeServer] = append(boundNodes[probeServer], node.NodeName)
+		}
+	}
+
+	// 目前仅 Uptime Kuma 提供在线状态
+	supported := false
+	servers := make([]probeServerStatusPayload, 0)
+	for _, cfg := range configs {
+		if cfg.ProbeType != storage.ProbeTypeUptimeKuma {
+			continue
+		}
+		supported = true
+
+		// 离线模式下无法访问状态页，状态保持未知
+		monitorByID := make(map[string]uptimeKumaMonitor)
+		if !IsAirGappedMode() {
+			ctx, err := withProbeConfigAuth(r.Context(), h.client, cfg)
+			var monitors []uptimeKumaMonitor
+			if err == nil {
+				monitors, err = fetchUptimeKumaMonitors(ctx, h.client, cfg.Address)
+			}
+			if err != nil {
+				logger.Warn("[探针状态] 获取 Uptime Kuma 状态失败", "config", cfg.Name, "error", err)
+			}
+			for _, monitor := range monitors {
+				monitorByID[monitor.ID] = monitor
+			}
+		}
+
+		for _, srv := range cfg.Servers {
+			item := probeServerStatusPayload{
+				ConfigID:   cfg.ID,
+				ConfigName: cfg.Name,
+				ServerID:   srv.ServerID,
+				Name:       srv.Name,
+				Status:     ProbeStatusUnknown,
+				Nodes:      boundNodes[srv.Name],
+			}
+			if item.Nodes == nil {
+				item.Nodes = []string{}
+			}
+			if monitor, ok := monitorByID[srv.ServerID]; ok {
+				item.Status = monitor.Status
+				item.Message = monitor.Message
+				item.PingMs = monitor.PingMs
+				item.Uptime24h = monitor.Uptime24h
+				if !monitor.LastCheck.IsZero() {
+					lastCheck := monitor.LastCheck
+					item.LastCheck = &lastCheck
+				}
+			}
+			servers = append(servers, item)
+		}
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"supported": supported,
+		"servers":   servers,
+	})
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+// 可靠性评分中各项指标的权重，合计为 1
+const (
+	reliabilityChurnWeight   = 0.3
+	reliabilityDeadWeight    = 0.4
+	reliabilityFailureWeight = 0.3
+)
+
+// nodeHealthMaxAge 超过该时间的连通性检测结果不参与评分
+const nodeHealthMaxAge = 7 * 24 * time.Hour
+
+// externalSubscriptionReliability 外部订阅（机场）的可靠性评分，分数越高越可靠
+type externalSubscriptionReliability struct {
+	Score        int     `json:"score"`         // 0-100
+	HasData      bool    `json:"has_data"`      // 没有任何同步记录和检测结果时为 false，此时分数无意义
+	ChurnRate    float64 `json:"churn_rate"`    // 每次同步平均新增+移除的节点占比
+	DeadRatio    float64 `json:"dead_ratio"`    // 最近检测不通的节点占比
+	CheckedNodes int     `json:"checked_nodes"` // 参与死节点统计的节点数
+	DeadNodes    int     `json:"dead_nodes"`
+	SyncRuns     int     `json:"sync_runs"`
+	SyncFailures int     `json:"sync_failures"`
+	FailureRate  float64 `json:"failure_rate"`
+	LastError    string  `json:"last_error,omitempty"` // 最近一次同步失败的原因
+}
+
+// recordExternalSubscriptionSyncRun 保存一次同步的结果，失败不影响同步流程
+func recordExternalSubscriptionSyncRun(ctx context.Context, repo *storage.TrafficRepository, username string, sub storage.ExternalSubscription, nodeCount int, syncErr error) {
+	if repo == nil || sub.ID <= 0 {
+		return
+	}
+
+	run := storage.ExternalSubscriptionSyncRun{
+		SubscriptionID: sub.ID,
+		Username:       username,
+		Success:        syncErr == nil,
+		NodeCount:      nodeCount,
+	}
+	if syncErr != nil {
+		run.Error = logger.Redact(syncErr.Error())
+	}
+	if err := repo.RecordExternalSubscriptionSyncRun(ctx, run); err != nil {
+		logger.Info("[外部订阅同步] 保存同步记录失败", "name", sub.Name, "error", err)
+	}
+}
+
+// computeExternalSubscriptionReliability 汇总节点变动率、死节点比例和同步失败率，计算每个外部订阅的评分
+func computeExternalSubscriptionReliability(ctx context.Context, repo *storage.TrafficRepository, username string, subs []storage.ExternalSubscription) (map[int64]externalSubscriptionReliability, error) {
+	nodes, err := repo.ListNodes(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	health, err := repo.ListNodeHealth(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[int64]externalSubscriptionReliability, len(subs))
+	for _, sub := range subs {
+		var rel externalSubscriptionReliability
+
+		diffs, err := repo.ListExternalSubscriptionDiffs(ctx, sub.ID, username, 0)
+		if err != nil {
+			return nil, err
+		}
+		churnSamples := 0
+		churnTotal := 0.0
+		for _, diff := range diffs {
+			// 上次同步的节点数；首次同步（此前没有快照）不计入变动率
+			previous := len(diff.NodeSnapshot) - len(diff.Added) + len(diff.Removed)
+			if previous <= 0 {
+				continue
+			}
+			churnTotal += math.Min(float64(len(diff.Added)+len(diff.Removed))/float64(previous), 1)
+			churnSamples++
+		}
+		if churnSamples > 0 {
+			rel.ChurnRate = churnTotal / float64(churnSamples)
+		}
+
+		runs, err := repo.ListExternalSubscriptionSyncRuns(ctx, sub.ID, username)
+		if err != nil {
+			return nil, err
+		}
+		rel.SyncRuns = len(runs)
+		for _, run := range runs {
+			if run.Success {
+				continue
+			}
+			if rel.SyncFailures == 0 {
+				rel.LastError = run.Error
+			}
+			rel.SyncFailures++
+		}
+		if rel.SyncRuns > 0 {
+			rel.FailureRate = float64(rel.SyncFailures) / float64(rel.SyncRuns)
+		}
+
+		for _, node := range nodes {
+			if node.SourceURL != sub.URL && node.RawURL != sub.URL {
+				continue
+			}
+			check, ok := health[node.ID]
+			if !ok || time.Since(check.CheckedAt) > nodeHealthMaxAge {
+				continue
+			}
+			rel.CheckedNodes++
+			if !check.Alive {
+				rel.DeadNodes++
+			}
+		}
+		if rel.CheckedNodes > 0 {
+			rel.DeadRatio = float64(rel.DeadNodes) / float64(rel.CheckedNodes)
+		}
+
+		rel.HasData = churnSamples > 0 || rel.SyncRuns > 0 || rel.CheckedNodes > 0
+		penalty := reliabilityChurnWeight*rel.ChurnRate + reliabilityDeadWeight*rel.DeadRatio + reliabilityFailureWeight*rel.FailureRate
+		rel.Score = int(math.Round(100 * (1 - math.Min(penalty, 1))))
+		rel.ChurnRate = roundRatio(rel.ChurnRate)
+		rel.DeadRatio = roundRatio(rel.DeadRatio)
+		rel.FailureRate = roundRatio(rel.FailureRate)
+		result[sub.ID] = rel
+	}
+	return result, nil
+}
+
+// roundRatio 保留三位小数
+func roundRatio(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
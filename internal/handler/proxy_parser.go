@@ -1167,12 +1167,7 @@ func parseWireGuardURL(uri string) (map[string]any, error) {
 
 		switch key {
 		case "reserved":
-			parts := strings.Split(value, ",")
-			if len(parts) == 3 {
-				reserved := make([]int, 3)
-				for i, p := range parts {
-					reserved[i], _ = strconv.Atoi(strings.TrimSpace(p))
-				}
+			if reserved := parseWireGuardReserved(value); reserved != nil {
 				node["reserved"] = reserved
 			}
 		case "address", "ip":
@@ -1193,6 +1188,16 @@ func parseWireGuardURL(uri string) (map[string]any, error) {
 			node["public-key"] = value
 		case "privatekey":
 			node["private-key"] = value
+		case "presharedkey", "pre-shared-key", "preshared-key":
+			node["pre-shared-key"] = value
+		case "keepalive", "persistent-keepalive":
+			if keepalive, err := strconv.Atoi(value); err == nil && keepalive > 0 {
+				node["persistent-keepalive"] = keepalive
+			}
+		case "dns":
+			if dns := splitWireGuardList(value); len(dns) > 0 {
+				node["dns"] = dns
+			}
 		case "udp":
 			node["udp"] = value == "true" || value == "1"
 		case "allowed-ips":
@@ -762,6 +762,7 @@ func syncProxyProviderModeChange(repo *storage.TrafficRepository, config *storag
 			logger.Info("[代理集合模式切换] 保存文件失败", "filename", file.Filename, "error", err)
 			continue
 		}
+		notifySubscribeFileChanged(filePath)
 
 		syncedCount++
 		logger.Info("[代理集合模式切换] 文件同步完成", "filename", file.Filename)
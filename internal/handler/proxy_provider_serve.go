@@ -98,13 +98,15 @@ func getGeoIPCountryCode(ipOrHost string) string {
 
 // NewProxyProviderServeHandler handles serving filtered proxies for "妙妙屋处理" mode
 // URL: /api/proxy-provider/{config_id}?token={user_token}
+// Responses carry a strong ETag of the node list, so clients sending If-None-Match (mihomo does)
+// get 304 Not Modified instead of redownloading an unchanged provider.
 func NewProxyProviderServeHandler(repo *storage.TrafficRepository) http.Handler {
 	if repo == nil {
 		panic("proxy provider serve handler requires repository")
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
+		if !isSubscriptionRead(r.Method) {
 			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
 			return
 		}
@@ -172,8 +174,7 @@ func NewProxyProviderServeHandler(repo *storage.TrafficRepository) http.Handler
 		if entry, ok := cache.Get(configID); ok && !cache.IsExpired(entry) {
 			logger.Info("[ProxyProviderServe] 使用缓存", "id", configID, "node_count", entry.NodeCount)
 			w.Header().Set("Content-Type", "text/yaml; charset=utf-8")
-			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write(entry.YAMLData)
+			serveSubscriptionContent(w, r, entry.YAMLData, "")
 			return
 		}
 
@@ -187,8 +188,7 @@ func NewProxyProviderServeHandler(repo *storage.TrafficRepository) http.Handler
 
 		// Output directly without download
 		w.Header().Set("Content-Type", "text/yaml; charset=utf-8")
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write(entry.YAMLData)
+		serveSubscriptionContent(w, r, entry.YAMLData, "")
 	})
 }
 
@@ -210,7 +210,7 @@ func fetchSubscriptionContent(sub *storage.ExternalSubscription) ([]byte, error)
 	logger.Info("[SubscriptionCache] 缓存未命中，正在拉取", "url", sub.URL)
 
 	// 拉取订阅内容
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := externalSubscriptionClient(sub, 30*time.Second, nil)
 	req, err := http.NewRequest(http.MethodGet, sub.URL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
@@ -220,7 +220,7 @@ func fetchSubscriptionContent(sub *storage.ExternalSubscription) ([]byte, error)
 	if userAgent == "" {
 		userAgent = "clash-meta/2.4.0"
 	}
-	req.Header.Set("User-Agent", userAgent)
+	applySubscriptionRequestHeaders(req, userAgent, sub.Headers)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -288,7 +288,17 @@ func preprocessSubscriptionContent(content []byte) ([]byte, error) {
 		}
 	}
 
-	// 3. 检查是否是 URI 协议格式（非 base64，每行一个 URI）
+	// 3. 检查是否是 sing-box JSON 格式（outbounds）
+	if isSingboxJSON(content) {
+		logger.Info("[预处理] 检测到 sing-box JSON 格式，尝试转换为 YAML")
+		proxies, err := ParseSingboxSubscription(content)
+		if err != nil {
+			return nil, fmt.Errorf("sing-box 格式转换失败: %w", err)
+		}
+		return yaml.Marshal(map[string]interface{}{"proxies": proxies})
+	}
+
+	// 3.1 检查是否是 URI 协议格式（非 base64，每行一个 URI）
 	if isURIListFormat(trimmed) {
 		logger.Info("[预处理] 检测到 URI 列表格式，尝试转换为 YAML")
 		yamlContent, err := convertURIListToYAML(trimmed)
@@ -1283,17 +1293,19 @@ func parseWireguardURI(uri string) (map[string]interface{}, error) {
 	}
 
 	// Reserved
-	if reserved := params["reserved"]; reserved != "" {
-		parts := strings.Split(reserved, ",")
-		reservedInts := make([]int, 0, 3)
-		for _, p := range parts {
-			if v, err := strconv.Atoi(strings.TrimSpace(p)); err == nil {
-				reservedInts = append(reservedInts, v)
-			}
-		}
-		if len(reservedInts) == 3 {
-			proxy["reserved"] = reservedInts
-		}
+	if reserved := parseWireGuardReserved(params["reserved"]); reserved != nil {
+		proxy["reserved"] = reserved
+	}
+
+	// Pre-shared key / keepalive / DNS
+	if psk := firstNonEmpty(params["presharedkey"], params["pre-shared-key"], params["preshared-key"]); psk != "" {
+		proxy["pre-shared-key"] = psk
+	}
+	if keepalive, err := strconv.Atoi(firstNonEmpty(params["keepalive"], params["persistent-keepalive"])); err == nil && keepalive > 0 {
+		proxy["persistent-keepalive"] = keepalive
+	}
+	if dns := splitWireGuardList(params["dns"]); len(dns) > 0 {
+		proxy["dns"] = dns
 	}
 
 	// Address/IP
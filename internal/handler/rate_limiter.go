@@ -11,15 +11,44 @@ import (
 // 使用英文错误消息, 防止老外看不懂
 var ErrRateLimited = errors.New("rate limit exceeded")
 
+const (
+	// failureBaseDelay 第一次失败后的最短重试间隔，之后每次失败翻倍
+	failureBaseDelay = time.Second
+	// failureMaxDelay 指数退避的上限
+	failureMaxDelay = time.Minute
+)
+
+// RateLimitError 携带可重试的等待时间，errors.Is(err, ErrRateLimited) 仍然成立
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string { return ErrRateLimited.Error() }
+
+func (e *RateLimitError) Is(target error) bool { return target == ErrRateLimited }
+
 type attemptInfo struct {
-	count     int
-	firstTime time.Time
-	lockUntil time.Time
+	count       int
+	firstTime   time.Time
+	lastFailure time.Time
+	lockUntil   time.Time
+}
+
+// failureDelay 连续失败 count 次后需要等待的时间：1s、2s、4s…，最多 failureMaxDelay
+func failureDelay(count int) time.Duration {
+	if count <= 0 {
+		return 0
+	}
+	delay := failureBaseDelay
+	for i := 1; i < count && delay < failureMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, failureMaxDelay)
 }
 
 type LoginRateLimiter struct {
 	ipAttempts      sync.Map // IP -> *attemptInfo
-	accountAttempts sync.Map // username -> *attemptInfo
+	accountAttempts sync.Map // username@IP -> *attemptInfo
 	maxAttempts     int
 	windowDuration  time.Duration
 	lockDuration    time.Duration
@@ -37,7 +66,7 @@ func NewLoginRateLimiter() *LoginRateLimiter {
 func (l *LoginRateLimiter) Check(ip, username string) error {
 	now := time.Now()
 
-	if err := l.checkAttempts(&l.ipAttempts, ip, now); err != nil {
+	if err := l.checkAttempts(&l.ipAttempts, ip, now, true); err != nil {
 		logger.Warn("🚫🚫🚫 [RATE_LIMIT] 登录被限制（IP）",
 			"ip", ip,
 			"username", username,
@@ -45,8 +74,10 @@ func (l *LoginRateLimiter) Check(ip, username string) error {
 		return err
 	}
 
+	// 账户只做指数退避，超过阈值后的锁定由数据库中的账户锁定负责，管理员可在用户列表中查看并解锁。
+	// 退避按 (用户名, IP) 计算，其他 IP 的失败不会拖慢账户本人
 	if username != "" {
-		if err := l.checkAttempts(&l.accountAttempts, username, now); err != nil {
+		if err := l.checkAttempts(&l.accountAttempts, accountAttemptKey(username, ip), now, false); err != nil {
 			logger.Warn("🚫🚫🚫 [RATE_LIMIT] 登录被限制（账户）",
 				"ip", ip,
 				"username", username,
@@ -58,7 +89,7 @@ func (l *LoginRateLimiter) Check(ip, username string) error {
 	return nil
 }
 
-func (l *LoginRateLimiter) checkAttempts(store *sync.Map, key string, now time.Time) error {
+func (l *LoginRateLimiter) checkAttempts(store *sync.Map, key string, now time.Time, lock bool) error {
 	val, _ := store.Load(key)
 	if val == nil {
 		return nil
@@ -67,7 +98,7 @@ func (l *LoginRateLimiter) checkAttempts(store *sync.Map, key string, now time.T
 	info := val.(*attemptInfo)
 
 	if !info.lockUntil.IsZero() && now.Before(info.lockUntil) {
-		return ErrRateLimited
+		return &RateLimitError{RetryAfter: info.lockUntil.Sub(now)}
 	}
 
 	if !info.lockUntil.IsZero() && now.After(info.lockUntil) {
@@ -80,10 +111,14 @@ func (l *LoginRateLimiter) checkAttempts(store *sync.Map, key string, now time.T
 		return nil
 	}
 
-	if info.count >= l.maxAttempts {
+	if lock && info.count >= l.maxAttempts {
 		// Lock the key
 		info.lockUntil = now.Add(l.lockDuration)
-		return ErrRateLimited
+		return &RateLimitError{RetryAfter: l.lockDuration}
+	}
+
+	if retryAt := info.lastFailure.Add(failureDelay(info.count)); now.Before(retryAt) {
+		return &RateLimitError{RetryAfter: retryAt.Sub(now)}
 	}
 
 	return nil
@@ -94,7 +129,7 @@ func (l *LoginRateLimiter) RecordFailure(ip, username string) {
 
 	l.recordAttempt(&l.ipAttempts, ip, now)
 	if username != "" {
-		l.recordAttempt(&l.accountAttempts, username, now)
+		l.recordAttempt(&l.accountAttempts, accountAttemptKey(username, ip), now)
 	}
 }
 
@@ -102,8 +137,9 @@ func (l *LoginRateLimiter) recordAttempt(store *sync.Map, key string, now time.T
 	val, loaded := store.Load(key)
 	if !loaded {
 		store.Store(key, &attemptInfo{
-			count:     1,
-			firstTime: now,
+			count:       1,
+			firstTime:   now,
+			lastFailure: now,
 		})
 		return
 	}
@@ -112,18 +148,24 @@ func (l *LoginRateLimiter) recordAttempt(store *sync.Map, key string, now time.T
 
 	if now.Sub(info.firstTime) > l.windowDuration {
 		store.Store(key, &attemptInfo{
-			count:     1,
-			firstTime: now,
+			count:       1,
+			firstTime:   now,
+			lastFailure: now,
 		})
 		return
 	}
 
 	info.count++
+	info.lastFailure = now
 }
 
 func (l *LoginRateLimiter) RecordSuccess(ip, username string) {
 	l.ipAttempts.Delete(ip)
 	if username != "" {
-		l.accountAttempts.Delete(username)
+		l.accountAttempts.Delete(accountAttemptKey(username, ip))
 	}
 }
+
+func accountAttemptKey(username, ip string) string {
+	return username + "@" + ip
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+type pendingRegistrationEntry struct {
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Nickname  string    `json:"nickname"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type registrationDecisionRequest struct {
+	Username string `json:"username"`
+}
+
+type registrationApprovalsHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewRegistrationApprovalsHandler serves the open-registration approval queue:
+// GET lists pending accounts, POST /approve activates one and POST /reject deletes it.
+func NewRegistrationApprovalsHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("registration approvals handler requires repository")
+	}
+
+	return &registrationApprovalsHandler{repo: repo}
+}
+
+func (h *registrationApprovalsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/registrations"), "/")
+
+	switch {
+	case path == "" && r.Method == http.MethodGet:
+		h.handleList(w, r)
+	case (path == "approve" || path == "reject") && r.Method == http.MethodPost:
+		h.handleDecision(w, r, path == "approve")
+	case path == "":
+		methodNotAllowed(w, http.MethodGet)
+	case path == "approve" || path == "reject":
+		methodNotAllowed(w, http.MethodPost)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *registrationApprovalsHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	users, err := h.repo.ListPendingUsers(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	entries := make([]pendingRegistrationEntry, 0, len(users))
+	for _, user := range users {
+		entries = append(entries, pendingRegistrationEntry{
+			Username:  user.Username,
+			Email:     user.Email,
+			Nickname:  user.Nickname,
+			CreatedAt: user.CreatedAt,
+		})
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"registrations": entries})
+}
+
+func (h *registrationApprovalsHandler) handleDecision(w http.ResponseWriter, r *http.Request, approve bool) {
+	var payload registrationDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+	username := strings.TrimSpace(payload.Username)
+	if username == "" {
+		writeBadRequest(w, "用户名不能为空")
+		return
+	}
+
+	var err error
+	if approve {
+		err = h.repo.ApprovePendingUser(r.Context(), username)
+	} else {
+		err = h.repo.RejectPendingUser(r.Context(), username)
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrPendingUserNotFound) {
+			writeError(w, http.StatusNotFound, errors.New("待审核的注册不存在"))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if approve {
+		logger.Info("📝 [REGISTER_APPROVED] 注册已通过审核", "username", username)
+		recordAudit(r.Context(), "registration.approve", username, "approval_status=pending", "is_active=true")
+		respondJSON(w, http.StatusOK, map[string]any{"status": "approved"})
+		return
+	}
+
+	logger.Info("📝 [REGISTER_REJECTED] 注册已被拒绝", "username", username)
+	recordAudit(r.Context(), "registration.reject", username, "approval_status=pending", "")
+	respondJSON(w, http.StatusOK, map[string]any{"status": "rejected"})
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+// replicaShutdownTimeout 关闭时最后一次同步的超时时间
+const replicaShutdownTimeout = 30 * time.Second
+
+// StartReplicator 按间隔把数据库增量同步到副本，ctx 取消后再同步一次，确保关闭前的写入不丢失
+func StartReplicator(ctx context.Context, replicator *storage.Replicator) {
+	if replicator == nil {
+		return
+	}
+
+	status := replicator.Status()
+	logger.Info("[数据库副本] 持续复制已启动", "target", status.Target, "interval", replicator.Interval())
+
+	sync := func(ctx context.Context, force bool) {
+		uploaded, err := replicator.SyncNow(ctx, force)
+		if err != nil {
+			logger.Warn("[数据库副本] 同步失败", "error", err)
+			return
+		}
+		if uploaded {
+			logger.Debug("[数据库副本] 已上传新快照", "generations", replicator.Status().Generations)
+		}
+	}
+
+	sync(ctx, false)
+	ticker := time.NewTicker(replicator.Interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			finalCtx, cancel := context.WithTimeout(context.Background(), replicaShutdownTimeout)
+			sync(finalCtx, false)
+			cancel()
+			logger.Info("[数据库副本] 持续复制已停止")
+			return
+		case <-ticker.C:
+			sync(ctx, false)
+		}
+	}
+}
+
+type replicationStatusResponse struct {
+	Enabled  bool                   `json:"enabled"`
+	Status   *storage.ReplicaStatus `json:"status,omitempty"`
+	ReadPool *storage.ReadPoolStats `json:"read_pool,omitempty"`
+}
+
+// NewReplicationHandler 管理员查看数据库副本和只读连接池状态（GET）或立即同步（POST .../sync）。
+// replicator 为 nil 表示未配置副本。
+func NewReplicationHandler(repo *storage.TrafficRepository, replicator *storage.Replicator) http.Handler {
+	if repo == nil {
+		panic("replication handler requires repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/replication"), "/")
+		switch action {
+		case "":
+			if r.Method != http.MethodGet {
+				methodNotAllowed(w, http.MethodGet)
+				return
+			}
+			response := replicationStatusResponse{ReadPool: repo.ReadPoolStats()}
+			if replicator != nil {
+				status := replicator.Status()
+				response.Enabled = true
+				response.Status = &status
+			}
+			respondJSON(w, http.StatusOK, response)
+		case "sync":
+			if r.Method != http.MethodPost {
+				methodNotAllowed(w, http.MethodPost)
+				return
+			}
+			if replicator == nil {
+				writeBadRequest(w, "未配置数据库副本（DB_REPLICA_URL）")
+				return
+			}
+			uploaded, err := replicator.SyncNow(r.Context(), true)
+			if err != nil {
+				logger.Warn("[数据库副本] 手动同步失败", "error", err)
+				writeError(w, http.StatusBadGateway, err)
+				return
+			}
+			status := replicator.Status()
+			respondJSON(w, http.StatusOK, map[string]any{
+				"uploaded": uploaded,
+				"status":   status,
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
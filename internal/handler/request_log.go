@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/logger"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// WithRequestID assigns every request an ID (reusing a sane incoming X-Request-ID from a reverse
+// proxy), echoes it in the response header and stores it in the request context so that
+// logger.*Context calls made while handling the request carry it.
+func WithRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimSpace(r.Header.Get(requestIDHeader))
+		if !validRequestID(id) {
+			id = logger.NewRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logger.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID 只接受长度有限的可打印标识，避免日志注入
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// accessLogWriter 记录响应状态码和字节数
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// AccessLog writes one log line per request with status, size and duration. Query strings are
+// left out because subscription URLs carry the user's token.
+func AccessLog(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &accessLogWriter{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		args := []any{
+			"endpoint", name,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"bytes", recorder.bytes,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client_ip", getClientIP(r),
+			"user_agent", r.UserAgent(),
+		}
+		switch {
+		case status >= http.StatusInternalServerError:
+			logger.ErrorContext(r.Context(), "[访问日志] 请求完成", args...)
+		case status >= http.StatusBadRequest:
+			logger.WarnContext(r.Context(), "[访问日志] 请求完成", args...)
+		default:
+			logger.InfoContext(r.Context(), "[访问日志] 请求完成", args...)
+		}
+	})
+}
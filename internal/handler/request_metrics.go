@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/metrics"
+)
+
+// countingBody 统计实际读取的请求体字节数
+type countingBody struct {
+	io.ReadCloser
+	bytes int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += int64(n)
+	return n, err
+}
+
+// Metrics records duration and request/response size of every request per endpoint, and logs
+// requests slower than the configured threshold. Path segments that look like IDs or tokens are
+// collapsed so that the number of series stays bounded.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &accessLogWriter{ResponseWriter: w}
+		var body *countingBody
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &countingBody{ReadCloser: r.Body}
+			r.Body = body
+		}
+
+		next.ServeHTTP(recorder, r)
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		requestBytes := int64(0)
+		if body != nil {
+			requestBytes = body.bytes
+		}
+		if r.ContentLength > requestBytes {
+			requestBytes = r.ContentLength
+		}
+		name := metricsEndpointName(r.URL.Path)
+		metrics.ObserveHTTP(r.Context(), r.Method+" "+name, time.Since(start), requestBytes, recorder.bytes,
+			status >= http.StatusInternalServerError, r.Method+" "+r.URL.Path)
+	})
+}
+
+// metricsEndpointName 将请求路径归一化为指标名称，非 /api 路径统一记为 static
+func metricsEndpointName(path string) string {
+	if !strings.HasPrefix(path, "/api/") {
+		return "static"
+	}
+	segments := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	for i, segment := range segments {
+		if looksLikeIdentifier(segment) {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// looksLikeIdentifier 判断路径片段是否为数字 ID 或较长的随机标识（如 token、短链码）
+func looksLikeIdentifier(segment string) bool {
+	if segment == "" {
+		return false
+	}
+	digits := true
+	for _, c := range segment {
+		if c < '0' || c > '9' {
+			digits = false
+			break
+		}
+	}
+	if digits {
+		return true
+	}
+	if len(segment) < 16 {
+		return false
+	}
+	hasDigit := false
+	for _, c := range segment {
+		if c >= '0' && c <= '9' {
+			hasDigit = true
+			break
+		}
+	}
+	return hasDigit
+}
@@ -0,0 +1,436 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+// 规则集缓存代理：开启后生成的配置中 rule-providers 与 geox-url 的远程地址改写为面板自身的
+// /api/rule-cache/ 地址，面板按需下载并缓存到本地，客户端即使无法直连 GitHub 等站点也能更新规则。
+// 只有生成配置时登记过的地址才会被下载，避免被当作开放代理
+const (
+	ruleCacheDir             = "data/rule_cache"
+	ruleCachePrefix          = "/api/rule-cache/"
+	ruleCacheRefreshInterval = 12 * time.Hour      // 缓存超过这个时间后下次请求时重新检查上游
+	ruleCacheFetchTimeout    = 60 * time.Second    // 下载单个文件的超时
+	ruleCacheRetention       = 30 * 24 * time.Hour // 超过这个时间没有客户端下载的缓存会被清理
+)
+
+// ruleCacheLocks 同一文件同时只允许一个下载，其余请求等待后直接使用结果
+var ruleCacheLocks sync.Map // id -> *sync.Mutex
+
+func ruleCacheFilePath(id string) string {
+	return filepath.Join(ruleCacheDir, id)
+}
+
+// rewriteRuleCacheURLs 将配置中的远程规则集与地理数据库地址改写为面板的缓存代理地址，并登记这些地址
+func rewriteRuleCacheURLs(ctx context.Context, repo *storage.TrafficRepository, doc *yaml.Node, baseURL string) {
+	if repo == nil || doc == nil || doc.Kind != yaml.MappingNode {
+		return
+	}
+	panelBase := strings.TrimRight(baseURL, "/")
+	cacheBase := panelBase + ruleCachePrefix
+
+	// 已经指向面板自身的地址（地理数据、缓存代理本身）不再登记
+	register := func(source, fileName string) (string, bool) {
+		parsed, err := url.Parse(source)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || strings.HasPrefix(source, panelBase+"/") {
+			return "", false
+		}
+		id, err := repo.RegisterRuleCacheURL(ctx, source)
+		if err != nil {
+			logger.Warn("[规则缓存] 登记地址失败", "url", source, "error", err)
+			return "", false
+		}
+		return cacheBase + id + "/" + url.PathEscape(fileName), true
+	}
+
+	if providers := mappingValue(doc, "rule-providers"); providers != nil && providers.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(providers.Content); i += 2 {
+			name := providers.Content[i].Value
+			provider := providers.Content[i+1]
+			if provider.Kind != yaml.MappingNode || mappingScalar(provider, "type") != "http" {
+				continue
+			}
+			source := mappingScalar(provider, "url")
+			if mirrored, ok := register(source, bundleFileName(name, source, mappingScalar(provider, "format"))); ok {
+				setMappingScalar(provider, "url", mirrored)
+				deleteMappingKey(provider, "proxy")
+			}
+		}
+	}
+
+	// 地理数据库未配置 geox-url 时客户端使用默认的 GitHub 地址，同样改写为缓存代理
+	geoxURL := mappingValue(doc, "geox-url")
+	if geoxURL == nil || geoxURL.Kind != yaml.MappingNode {
+		geoxURL = &yaml.Node{Kind: yaml.MappingNode}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "geox-url"}, geoxURL)
+	}
+	for _, geo := range bundleGeoFiles {
+		source := mappingScalar(geoxURL, geo.Key)
+		if source == "" {
+			source = geo.DefaultURL
+		}
+		if mirrored, ok := register(source, geo.Filename); ok {
+			setMappingScalar(geoxURL, geo.Key, mirrored)
+		}
+	}
+}
+
+// refreshRuleCacheEntry 下载或重新验证缓存文件。force 为 false 时缓存未过期直接返回；
+// 上游不可用但本地已有缓存时返回旧内容（只记录错误），没有缓存时返回错误
+func refreshRuleCacheEntry(ctx context.Context, repo *storage.TrafficRepository, id string, force bool) (storage.RuleCacheEntry, error) {
+	lock, _ := ruleCacheLocks.LoadOrStore(id, &sync.Mutex{})
+	mu := lock.(*sync.Mutex)
+	mu.Lock()
+	defer mu.Unlock()
+
+	// 加锁后重新读取，等待期间其他请求可能已经完成下载
+	entry, err := repo.GetRuleCacheEntry(ctx, id)
+	if err != nil {
+		return storage.RuleCacheEntry{}, err
+	}
+	filePath := ruleCacheFilePath(id)
+	_, statErr := os.Stat(filePath)
+	cached := statErr == nil
+	if cached && !force && entry.FetchedAt != nil && time.Since(*entry.FetchedAt) < ruleCacheRefreshInterval {
+		return entry, nil
+	}
+	if IsAirGappedMode() {
+		if cached {
+			return entry, nil
+		}
+		return entry, ErrAirGapped
+	}
+
+	mirrored, fetchErr := mirrorRemoteFile(ctx, entry.URL, filePath, entry.ETag, entry.LastModified, ruleCacheFetchTimeout)
+	if fetchErr != nil {
+		if err := repo.UpdateRuleCacheFetch(ctx, entry, fetchErr.Error()); err != nil {
+			logger.Warn("[规则缓存] 记录下载结果失败", "url", entry.URL, "error", err)
+		}
+		if cached {
+			logger.Warn("[规则缓存] 上游下载失败，继续使用旧缓存", "url", entry.URL, "error", fetchErr)
+			return entry, nil
+		}
+		return entry, fetchErr
+	}
+	if !mirrored.NotModified {
+		entry.Size = mirrored.Size
+		entry.SHA256 = mirrored.SHA256
+		entry.ETag = mirrored.ETag
+		entry.LastModified = mirrored.LastModified
+		logger.Info("[规则缓存] 已更新缓存", "url", entry.URL, "bytes", mirrored.Size)
+	}
+	if err := repo.UpdateRuleCacheFetch(ctx, entry, ""); err != nil {
+		logger.Warn("[规则缓存] 记录下载结果失败", "url", entry.URL, "error", err)
+	}
+	return entry, nil
+}
+
+// mirroredFile 是 mirrorRemoteFile 下载结果的元数据
+type mirroredFile struct {
+	NotModified  bool
+	Size         int64
+	SHA256       string
+	ETag         string
+	LastModified string
+}
+
+// mirrorRemoteFile 下载 source 并原子写入 filePath。本地文件存在时带上 etag / lastModified 做条件请求，
+// 上游返回 304 时 NotModified 为 true 且不改动本地文件
+func mirrorRemoteFile(ctx context.Context, source, filePath, etag, lastModified string, timeout time.Duration) (mirroredFile, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return mirroredFile{}, err
+	}
+	req.Header.Set("User-Agent", "clash-meta/2.4.0")
+	_, statErr := os.Stat(filePath)
+	cached := statErr == nil
+	if cached {
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	resp, err := importFetchClient(timeout, false).Do(req)
+	if err != nil {
+		return mirroredFile{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached {
+		return mirroredFile{NotModified: true}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return mirroredFile{}, fmt.Errorf("状态码=%d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, bundleMaxFileSize+1))
+	if err != nil {
+		return mirroredFile{}, err
+	}
+	if len(data) > bundleMaxFileSize {
+		return mirroredFile{}, fmt.Errorf("文件超过 %d MB", bundleMaxFileSize>>20)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return mirroredFile{}, err
+	}
+	tmpPath := filePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return mirroredFile{}, err
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		os.Remove(tmpPath)
+		return mirroredFile{}, err
+	}
+
+	sum := sha256.Sum256(data)
+	return mirroredFile{
+		Size:         int64(len(data)),
+		SHA256:       hex.EncodeToString(sum[:]),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
+
+type ruleCacheHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewRuleCacheHandler serves mirrored rule sets and geo databases at /api/rule-cache/{id}/{name},
+// downloading them from the registered upstream URL on first use and when the cache is stale.
+func NewRuleCacheHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("rule cache handler requires repository")
+	}
+	return &ruleCacheHandler{repo: repo}
+}
+
+func (h *ruleCacheHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, http.MethodGet, http.MethodHead)
+		return
+	}
+
+	id, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, ruleCachePrefix), "/")
+	if id == "" || strings.ContainsAny(id, `./\`) {
+		http.NotFound(w, r)
+		return
+	}
+
+	// 客户端断开不应中断下载，下载结果会被后续请求复用
+	entry, err := refreshRuleCacheEntry(context.WithoutCancel(r.Context()), h.repo, id, false)
+	if err != nil {
+		if errors.Is(err, storage.ErrRuleCacheEntryNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if errors.Is(err, ErrAirGapped) {
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		writeError(w, http.StatusBadGateway, fmt.Errorf("下载规则失败: %w", err))
+		return
+	}
+
+	file, err := os.Open(ruleCacheFilePath(id))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		if err := h.repo.RecordRuleCacheHit(r.Context(), id); err != nil {
+			logger.Warn("[规则缓存] 记录下载次数失败", "id", id, "error", err)
+		}
+	}
+	if entry.SHA256 != "" {
+		w.Header().Set("ETag", `"`+entry.SHA256[:16]+`"`)
+	}
+	if name == "" {
+		name = id
+	}
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
+
+type ruleCacheEntryDTO struct {
+	ID           string     `json:"id"`
+	URL          string     `json:"url"`
+	Size         int64      `json:"size"`
+	SHA256       string     `json:"sha256"`
+	Cached       bool       `json:"cached"`
+	FetchedAt    *time.Time `json:"fetched_at"`
+	LastError    string     `json:"last_error"`
+	Hits         int64      `json:"hits"`
+	LastAccessAt time.Time  `json:"last_access_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+func convertRuleCacheEntry(e storage.RuleCacheEntry) ruleCacheEntryDTO {
+	_, err := os.Stat(ruleCacheFilePath(e.ID))
+	return ruleCacheEntryDTO{
+		ID:           e.ID,
+		URL:          e.URL,
+		Size:         e.Size,
+		SHA256:       e.SHA256,
+		Cached:       err == nil,
+		FetchedAt:    e.FetchedAt,
+		LastError:    e.LastError,
+		Hits:         e.Hits,
+		LastAccessAt: e.LastAccessAt,
+		CreatedAt:    e.CreatedAt,
+	}
+}
+
+type ruleCacheAdminHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewRuleCacheAdminHandler lists the mirrored files (GET), clears the cache (DELETE), removes one
+// entry (DELETE /{id}) or forces a re-download (POST /{id}/refresh).
+func NewRuleCacheAdminHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("rule cache admin handler requires repository")
+	}
+	return &ruleCacheAdminHandler{repo: repo}
+}
+
+func (h *ruleCacheAdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/rule-cache"), "/")
+	id, action, _ := strings.Cut(rest, "/")
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		h.handleList(w, r)
+	case id == "" && r.Method == http.MethodDelete:
+		h.handleDelete(w, r, nil)
+	case id == "":
+		methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+	case action == "" && r.Method == http.MethodDelete:
+		h.handleDelete(w, r, []string{id})
+	case action == "refresh" && r.Method == http.MethodPost:
+		h.handleRefresh(w, r, id)
+	case action == "":
+		methodNotAllowed(w, http.MethodDelete)
+	case action == "refresh":
+		methodNotAllowed(w, http.MethodPost)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("接口不存在"))
+	}
+}
+
+func (h *ruleCacheAdminHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.repo.ListRuleCacheEntries(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	items := make([]ruleCacheEntryDTO, 0, len(entries))
+	var total int64
+	for _, e := range entries {
+		item := convertRuleCacheEntry(e)
+		if item.Cached {
+			total += item.Size
+		}
+		items = append(items, item)
+	}
+
+	enabled := false
+	if cfg, err := h.repo.GetSystemConfig(r.Context()); err == nil {
+		enabled = cfg.RuleCacheProxy
+	}
+	respondJSON(w, http.StatusOK, map[string]any{
+		"enabled":     enabled,
+		"entries":     items,
+		"total_bytes": total,
+	})
+}
+
+func (h *ruleCacheAdminHandler) handleDelete(w http.ResponseWriter, r *http.Request, ids []string) {
+	removed, err := h.repo.DeleteRuleCacheEntries(r.Context(), ids)
+	removeRuleCacheFiles(removed)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(ids) > 0 && len(removed) == 0 {
+		writeError(w, http.StatusNotFound, errors.New("缓存不存在"))
+		return
+	}
+	recordAudit(r.Context(), "rule_cache.delete", strings.Join(ids, ","), "", fmt.Sprintf("removed=%d", len(removed)))
+	respondJSON(w, http.StatusOK, map[string]any{"removed": len(removed)})
+}
+
+func (h *ruleCacheAdminHandler) handleRefresh(w http.ResponseWriter, r *http.Request, id string) {
+	if rejectInAirGappedMode(w) {
+		return
+	}
+	entry, err := refreshRuleCacheEntry(r.Context(), h.repo, id, true)
+	if err != nil {
+		if errors.Is(err, storage.ErrRuleCacheEntryNotFound) {
+			writeError(w, http.StatusNotFound, errors.New("缓存不存在"))
+			return
+		}
+		writeError(w, http.StatusBadGateway, fmt.Errorf("下载规则失败: %w", err))
+		return
+	}
+	// 上游失败但保留旧缓存时同样返回 200，由 last_error 体现
+	if latest, err := h.repo.GetRuleCacheEntry(r.Context(), id); err == nil {
+		entry = latest
+	}
+	recordAudit(r.Context(), "rule_cache.refresh", id, "", entry.URL)
+	respondJSON(w, http.StatusOK, map[string]any{"entry": convertRuleCacheEntry(entry)})
+}
+
+func removeRuleCacheFiles(ids []string) {
+	for _, id := range ids {
+		if err := os.Remove(ruleCacheFilePath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Warn("[规则缓存] 删除缓存文件失败", "id", id, "error", err)
+		}
+		ruleCacheLocks.Delete(id)
+	}
+}
+
+// PruneRuleCache 清理长时间没有客户端下载的缓存
+func PruneRuleCache(ctx context.Context, repo *storage.TrafficRepository) error {
+	if repo == nil {
+		return nil
+	}
+	ids, err := repo.ListStaleRuleCacheEntryIDs(ctx, time.Now().Add(-ruleCacheRetention))
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	removed, err := repo.DeleteRuleCacheEntries(ctx, ids)
+	removeRuleCacheFiles(removed)
+	if err != nil {
+		return err
+	}
+	logger.Info("[规则缓存] 已清理长时间未使用的缓存", "count", len(removed))
+	return nil
+}
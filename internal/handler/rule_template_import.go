@@ -0,0 +1,380 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+	"miaomiaowu/internal/substore"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 规则模板导入：从 URL 导入社区规则模板到 rule_templates 目录。Clash 配置原样保存，ACL4SSR 风格的 ini
+// （ruleset= / custom_proxy_group=）转换为 Clash 配置后保存。记录导入来源，支持一键重新导入，
+// 每次写入都会保存一个历史版本，可以查看和恢复。
+const (
+	ruleTemplatesDir          = "rule_templates"
+	ruleTemplateFetchTimeout  = 30 * time.Second
+	maxRuleTemplateSourceSize = 5 << 20
+)
+
+type ruleTemplateSourceDTO struct {
+	SourceURL      string    `json:"source_url"`
+	Format         string    `json:"format"`
+	LastImportedAt time.Time `json:"last_imported_at"`
+	LastCheckedAt  time.Time `json:"last_checked_at"`
+}
+
+func convertRuleTemplateSource(s storage.RuleTemplateSource) ruleTemplateSourceDTO {
+	return ruleTemplateSourceDTO{
+		SourceURL:      s.SourceURL,
+		Format:         s.Format,
+		LastImportedAt: s.LastImportedAt,
+		LastCheckedAt:  s.LastCheckedAt,
+	}
+}
+
+type ruleTemplateVersionDTO struct {
+	Version     int       `json:"version"`
+	Action      string    `json:"action"`
+	SourceURL   string    `json:"source_url"`
+	ContentHash string    `json:"content_hash"`
+	Content     string    `json:"content,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func convertRuleTemplateVersion(v storage.RuleTemplateVersion) ruleTemplateVersionDTO {
+	return ruleTemplateVersionDTO{
+		Version:     v.Version,
+		Action:      v.Action,
+		SourceURL:   v.SourceURL,
+		ContentHash: v.ContentHash,
+		Content:     v.Content,
+		CreatedAt:   v.CreatedAt,
+	}
+}
+
+// validRuleTemplateName 防止目录穿越
+func validRuleTemplateName(name string) bool {
+	return name != "" && !strings.Contains(name, "..") && !strings.Contains(name, "/") && !strings.Contains(name, "\\")
+}
+
+// handleImport 从 URL 导入规则模板：{url, name, overwrite}
+func (h *RuleTemplatesHandler) handleImport(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL       string `json:"url"`
+		Name      string `json:"name"`
+		Overwrite bool   `json:"overwrite"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	parsed, err := url.Parse(req.URL)
+	if req.URL == "" || err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		writeBadRequest(w, "模板地址无效")
+		return
+	}
+	if rejectInAirGappedMode(w) {
+		return
+	}
+
+	filename := strings.TrimSpace(req.Name)
+	if filename == "" {
+		filename = strings.TrimSuffix(path.Base(parsed.Path), path.Ext(parsed.Path))
+		if unescaped, err := url.PathUnescape(filename); err == nil {
+			filename = unescaped
+		}
+	}
+	if !strings.HasSuffix(filename, ".yaml") && !strings.HasSuffix(filename, ".yml") {
+		filename += ".yaml"
+	}
+	if !validRuleTemplateName(filename) || filename == ".yaml" {
+		writeBadRequest(w, "模板文件名无效")
+		return
+	}
+	if _, err := os.Stat(filepath.Join(ruleTemplatesDir, filename)); err == nil && !req.Overwrite {
+		writeError(w, http.StatusConflict, fmt.Errorf("模板文件 %s 已存在", filename))
+		return
+	}
+
+	raw, err := fetchRuleTemplateSource(r.Context(), req.URL)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("获取模板失败: %w", err))
+		return
+	}
+	content, format, err := convertRuleTemplateContent(raw)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	version, err := h.saveRuleTemplate(r.Context(), filename, content, "import", req.URL)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	source := storage.RuleTemplateSource{
+		Filename:    filename,
+		SourceURL:   req.URL,
+		Format:      format,
+		ContentHash: storage.RuleTemplateContentHash(raw),
+	}
+	if err := h.repo.UpsertRuleTemplateSource(r.Context(), source); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	recordAudit(r.Context(), "rule_template.import", filename, "", req.URL)
+	logger.Info("[规则模板] 导入完成", "filename", filename, "url", req.URL, "format", format, "version", version)
+
+	respondJSON(w, http.StatusCreated, map[string]any{
+		"filename": filename,
+		"format":   format,
+		"version":  version,
+	})
+}
+
+// handleReimport 重新从导入来源拉取模板；内容未变化时不产生新版本，force 为 true 时强制覆盖
+func (h *RuleTemplatesHandler) handleReimport(w http.ResponseWriter, r *http.Request, filename string) {
+	var req struct {
+		Force bool `json:"force"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeBadRequest(w, "请求数据格式错误")
+			return
+		}
+	}
+
+	source, err := h.repo.GetRuleTemplateSource(r.Context(), filename)
+	if err != nil {
+		if errors.Is(err, storage.ErrRuleTemplateSourceNotFound) {
+			writeError(w, http.StatusNotFound, errors.New("该模板不是从 URL 导入的"))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if rejectInAirGappedMode(w) {
+		return
+	}
+
+	raw, err := fetchRuleTemplateSource(r.Context(), source.SourceURL)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("获取模板失败: %w", err))
+		return
+	}
+	hash := storage.RuleTemplateContentHash(raw)
+	_, statErr := os.Stat(filepath.Join(ruleTemplatesDir, filename))
+	if hash == source.ContentHash && !req.Force && statErr == nil {
+		if err := h.repo.TouchRuleTemplateSource(r.Context(), filename); err != nil {
+			logger.Warn("[规则模板] 更新检查时间失败", "filename", filename, "error", err)
+		}
+		respondJSON(w, http.StatusOK, map[string]any{"filename": filename, "changed": false})
+		return
+	}
+
+	content, format, err := convertRuleTemplateContent(raw)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	version, err := h.saveRuleTemplate(r.Context(), filename, content, "reimport", source.SourceURL)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	source.Format = format
+	source.ContentHash = hash
+	source.LastImportedAt = time.Time{}
+	if err := h.repo.UpsertRuleTemplateSource(r.Context(), source); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	recordAudit(r.Context(), "rule_template.reimport", filename, "", source.SourceURL)
+	logger.Info("[规则模板] 重新导入完成", "filename", filename, "url", source.SourceURL, "version", version)
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"filename": filename,
+		"changed":  true,
+		"version":  version,
+	})
+}
+
+// handleVersions 处理 /{name}/versions、/{name}/versions/{version} 与 /{name}/versions/{version}/restore
+func (h *RuleTemplatesHandler) handleVersions(w http.ResponseWriter, r *http.Request, filename, rest string) {
+	if rest == "" {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		versions, err := h.repo.ListRuleTemplateVersions(r.Context(), filename)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		items := make([]ruleTemplateVersionDTO, 0, len(versions))
+		for _, v := range versions {
+			items = append(items, convertRuleTemplateVersion(v))
+		}
+		response := map[string]any{"versions": items}
+		if source, err := h.repo.GetRuleTemplateSource(r.Context(), filename); err == nil {
+			response["source"] = convertRuleTemplateSource(source)
+		}
+		respondJSON(w, http.StatusOK, response)
+		return
+	}
+
+	versionPart, action, _ := strings.Cut(rest, "/")
+	number, err := strconv.Atoi(versionPart)
+	if err != nil || number <= 0 {
+		writeBadRequest(w, "版本号无效")
+		return
+	}
+	version, err := h.repo.GetRuleTemplateVersion(r.Context(), filename, number)
+	if err != nil {
+		if errors.Is(err, storage.ErrRuleTemplateVersionNotFound) {
+			writeError(w, http.StatusNotFound, errors.New("版本不存在"))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		respondJSON(w, http.StatusOK, map[string]any{"version": convertRuleTemplateVersion(version)})
+	case action == "restore" && r.Method == http.MethodPost:
+		saved, err := h.saveRuleTemplate(r.Context(), filename, version.Content, "restore", version.SourceURL)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		recordAudit(r.Context(), "rule_template.restore", filename, "", fmt.Sprintf("version=%d", number))
+		respondJSON(w, http.StatusOK, map[string]any{"filename": filename, "version": saved})
+	case action == "":
+		methodNotAllowed(w, http.MethodGet)
+	case action == "restore":
+		methodNotAllowed(w, http.MethodPost)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("接口不存在"))
+	}
+}
+
+// saveRuleTemplate 写入模板文件并保存历史版本。模板首次被改写时先把原内容保存为初始版本；
+// 内容与当前文件相同时不写入，返回 0
+func (h *RuleTemplatesHandler) saveRuleTemplate(ctx context.Context, filename, content, action, sourceURL string) (int, error) {
+	if err := os.MkdirAll(ruleTemplatesDir, 0755); err != nil {
+		return 0, fmt.Errorf("创建模板目录失败: %w", err)
+	}
+	templatePath := filepath.Join(ruleTemplatesDir, filename)
+
+	if current, err := os.ReadFile(templatePath); err == nil {
+		if string(current) == content {
+			return 0, nil
+		}
+		h.snapshotRuleTemplate(ctx, filename, string(current))
+	}
+
+	tmpPath := templatePath + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(content), 0644); err != nil {
+		return 0, fmt.Errorf("保存模板失败: %w", err)
+	}
+	if err := os.Rename(tmpPath, templatePath); err != nil {
+		os.Remove(tmpPath)
+		return 0, fmt.Errorf("保存模板失败: %w", err)
+	}
+
+	version, err := h.repo.AddRuleTemplateVersion(ctx, storage.RuleTemplateVersion{
+		Filename:  filename,
+		Action:    action,
+		SourceURL: sourceURL,
+		Content:   content,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// snapshotRuleTemplate 模板还没有历史版本时（内置模板或手动上传的文件），把当前内容保存为初始版本
+func (h *RuleTemplatesHandler) snapshotRuleTemplate(ctx context.Context, filename, content string) {
+	versions, err := h.repo.ListRuleTemplateVersions(ctx, filename)
+	if err != nil || len(versions) > 0 {
+		return
+	}
+	if _, err := h.repo.AddRuleTemplateVersion(ctx, storage.RuleTemplateVersion{Filename: filename, Action: "initial", Content: content}); err != nil {
+		logger.Warn("[规则模板] 保存初始版本失败", "filename", filename, "error", err)
+	}
+}
+
+func fetchRuleTemplateSource(ctx context.Context, sourceURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "clash-meta/2.4.0")
+
+	resp, err := importFetchClient(ruleTemplateFetchTimeout, false).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("HTTP " + resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRuleTemplateSourceSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxRuleTemplateSourceSize {
+		return "", errors.New("模板内容过大")
+	}
+	return string(data), nil
+}
+
+// convertRuleTemplateContent 识别模板格式：Clash 配置原样返回，ACL4SSR ini 转换为 Clash 配置
+func convertRuleTemplateContent(raw string) (string, string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return "", "", errors.New("模板内容为空")
+	}
+	if substore.DetectTemplateType(raw) == "surge" {
+		return "", "", errors.New("暂不支持导入 Surge 模板")
+	}
+
+	var config map[string]any
+	if err := yaml.Unmarshal([]byte(raw), &config); err == nil && config != nil {
+		if _, ok := config["proxy-groups"]; ok {
+			return raw, storage.RuleTemplateFormatClash, nil
+		}
+		if _, ok := config["rules"]; ok {
+			return raw, storage.RuleTemplateFormatClash, nil
+		}
+	}
+
+	rulesets, proxyGroups := substore.ParseACLConfig(raw)
+	if len(rulesets) == 0 && len(proxyGroups) == 0 {
+		return "", "", errors.New("无法识别的模板格式，仅支持 Clash 配置或 ACL4SSR 风格的 ini")
+	}
+	rules, providers, err := substore.GenerateClashRules(rulesets)
+	if err != nil {
+		return "", "", fmt.Errorf("转换规则失败: %w", err)
+	}
+	content := substore.MergeToClashTemplate(substore.GetDefaultClashTemplate(), substore.GenerateClashProxyGroups(proxyGroups, nil), rules, providers)
+	return content, storage.RuleTemplateFormatACL, nil
+}
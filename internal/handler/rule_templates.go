@@ -2,18 +2,28 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
 )
 
-type RuleTemplatesHandler struct{}
+type RuleTemplatesHandler struct {
+	repo *storage.TrafficRepository
+}
+
+func NewRuleTemplatesHandler(repo *storage.TrafficRepository) *RuleTemplatesHandler {
+	if repo == nil {
+		panic("rule templates handler requires repository")
+	}
 
-func NewRuleTemplatesHandler() *RuleTemplatesHandler {
-	return &RuleTemplatesHandler{}
+	return &RuleTemplatesHandler{repo: repo}
 }
 
 func (h *RuleTemplatesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -42,10 +52,38 @@ func (h *RuleTemplatesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 			return
 		}
 		h.handleRenameTemplate(w, r)
+	case path == "/import":
+		// Import template from URL
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		h.handleImport(w, r)
 	default:
 		// Extract template name from path (remove leading slash)
 		templateName := strings.TrimPrefix(path, "/")
 
+		// /{name}/reimport 与 /{name}/versions[...]
+		if name, action, ok := strings.Cut(templateName, "/"); ok {
+			if !validRuleTemplateName(name) {
+				writeBadRequest(w, "模板文件名无效")
+				return
+			}
+			switch {
+			case action == "reimport":
+				if r.Method != http.MethodPost {
+					methodNotAllowed(w, http.MethodPost)
+					return
+				}
+				h.handleReimport(w, r, name)
+			case action == "versions" || strings.HasPrefix(action, "versions/"):
+				h.handleVersions(w, r, name, strings.TrimPrefix(strings.TrimPrefix(action, "versions"), "/"))
+			default:
+				writeError(w, http.StatusNotFound, errors.New("接口不存在"))
+			}
+			return
+		}
+
 		switch r.Method {
 		case http.MethodGet:
 			// Get specific template content
@@ -80,10 +118,19 @@ func (h *RuleTemplatesHandler) handleListTemplates(w http.ResponseWriter, r *htt
 		}
 	}
 
+	// 导入来源，供前端显示来源并提供重新导入
+	sources := make(map[string]ruleTemplateSourceDTO)
+	if imported, err := h.repo.ListRuleTemplateSources(r.Context()); err == nil {
+		for _, s := range imported {
+			sources[s.Filename] = convertRuleTemplateSource(s)
+		}
+	}
+
 	// Return JSON response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"templates": templates,
+		"sources":   sources,
 	})
 }
 
@@ -146,8 +193,8 @@ func (h *RuleTemplatesHandler) handleUpdateTemplate(w http.ResponseWriter, r *ht
 		return
 	}
 
-	// Write content to file
-	if err := os.WriteFile(templatePath, []byte(payload.Content), 0644); err != nil {
+	// Write content to file (and keep a version for history)
+	if _, err := h.saveRuleTemplate(r.Context(), templateName, payload.Content, "edit", ""); err != nil {
 		http.Error(w, "Failed to save template", http.StatusInternalServerError)
 		return
 	}
@@ -184,6 +231,9 @@ func (h *RuleTemplatesHandler) handleDeleteTemplate(w http.ResponseWriter, r *ht
 		http.Error(w, "Failed to delete template", http.StatusInternalServerError)
 		return
 	}
+	if err := h.repo.DeleteRuleTemplateHistory(r.Context(), templateName); err != nil {
+		logger.Warn("[规则模板] 删除导入来源及历史版本失败", "filename", templateName, "error", err)
+	}
 
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
@@ -257,6 +307,9 @@ func (h *RuleTemplatesHandler) handleRenameTemplate(w http.ResponseWriter, r *ht
 		http.Error(w, "Failed to rename template", http.StatusInternalServerError)
 		return
 	}
+	if err := h.repo.RenameRuleTemplateHistory(r.Context(), oldName, newName); err != nil {
+		logger.Warn("[规则模板] 迁移导入来源及历史版本失败", "old", oldName, "new", newName, "error", err)
+	}
 
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
@@ -12,6 +12,7 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
 	"miaomiaowu/internal/storage"
 )
 
@@ -229,10 +230,12 @@ func (h *RuleEditorHandler) handleUpdate(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
+	previous, _ := os.ReadFile(resolved)
 	if err := os.WriteFile(resolved, []byte(payload.Content), 0o644); err != nil {
 		http.Error(w, "写入规则文件失败", http.StatusInternalServerError)
 		return
 	}
+	notifySubscribeFileChanged(resolved)
 
 	username := auth.UsernameOrDefault(r.Context(), "unknown")
 
@@ -245,6 +248,7 @@ func (h *RuleEditorHandler) handleUpdate(w http.ResponseWriter, r *http.Request,
 		}
 		newVersion = v
 	}
+	recordAudit(r.Context(), "rule_file.update", filename, contentAuditSummary(previous), contentAuditSummary([]byte(payload.Content)))
 
 	respondJSON(w, http.StatusOK, map[string]any{"version": newVersion})
 }
@@ -282,7 +286,7 @@ func methodNotAllowed(w http.ResponseWriter, methods ...string) {
 }
 
 func writeBadRequest(w http.ResponseWriter, message string) {
-	respondJSON(w, http.StatusBadRequest, map[string]string{"error": message})
+	respondJSON(w, http.StatusBadRequest, map[string]string{"error": logger.Redact(message)})
 }
 
 func respondJSON(w http.ResponseWriter, status int, payload any) {
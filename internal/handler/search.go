@@ -0,0 +1,335 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/storage"
+)
+
+// Result types returned by the global search
+const (
+	searchTypeNode         = "node"
+	searchTypeFile         = "file"
+	searchTypeUser         = "user"
+	searchTypeSubscription = "subscription"
+	searchTypeRule         = "rule"
+)
+
+const (
+	defaultSearchLimit = 10 // 每种类型默认返回的最大结果数
+	maxSearchLimit     = 50
+	maxSearchQueryLen  = 100
+)
+
+// searchTypes 结果类型的固定顺序，也是 types 参数的合法取值
+var searchTypes = []string{searchTypeNode, searchTypeFile, searchTypeSubscription, searchTypeUser, searchTypeRule}
+
+// searchAdminTypes 仅管理员可搜索的类型
+var searchAdminTypes = map[string]bool{
+	searchTypeSubscription: true,
+	searchTypeUser:         true,
+	searchTypeRule:         true,
+}
+
+type searchResult struct {
+	Type     string `json:"type"`
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle,omitempty"`
+	Path     string `json:"path"`  // 前端跳转路由
+	Match    string `json:"match"` // 命中的字段
+	score    int
+}
+
+type searchResponse struct {
+	Query   string         `json:"query"`
+	Results []searchResult `json:"results"`
+	Counts  map[string]int `json:"counts"` // 每种类型命中的总数（截断前）
+}
+
+// searchCandidate 是一条可搜索的记录，fields 按优先级排列（字段名 -> 取值）
+type searchCandidate struct {
+	result searchResult
+	fields [][2]string
+}
+
+type searchHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewSearchHandler returns GET /api/search?q=, searching nodes, subscribe files, subscriptions,
+// users and custom rules in one call. Regular users only get their own nodes and the files
+// assigned to them; the other types are admin-only.
+func NewSearchHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("search handler requires repository")
+	}
+
+	return &searchHandler{repo: repo}
+}
+
+func (h *searchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	username := auth.UsernameFromContext(r.Context())
+	if strings.TrimSpace(username) == "" {
+		writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		writeBadRequest(w, "缺少 q 参数")
+		return
+	}
+	if utf8.RuneCountInString(q) > maxSearchQueryLen {
+		writeBadRequest(w, "搜索关键字过长")
+		return
+	}
+
+	limit := defaultSearchLimit
+	if raw := strings.TrimSpace(query.Get("limit")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			writeBadRequest(w, "limit 必须为正整数")
+			return
+		}
+		limit = min(parsed, maxSearchLimit)
+	}
+
+	user, err := h.repo.GetUser(r.Context(), username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	isAdmin := user.Role == storage.RoleAdmin
+
+	types, err := parseSearchTypes(query.Get("types"))
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	resp := searchResponse{Query: q, Results: []searchResult{}, Counts: map[string]int{}}
+	needle := strings.ToLower(q)
+	for _, typ := range types {
+		if searchAdminTypes[typ] && !isAdmin {
+			continue
+		}
+		candidates, err := h.searchCandidates(r.Context(), typ, username, isAdmin)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		matched := matchSearchCandidates(candidates, needle)
+		resp.Counts[typ] = len(matched)
+		if len(matched) > limit {
+			matched = matched[:limit]
+		}
+		resp.Results = append(resp.Results, matched...)
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// parseSearchTypes 解析逗号分隔的 types 参数，为空时搜索全部类型
+func parseSearchTypes(raw string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return searchTypes, nil
+	}
+	wanted := make(map[string]bool)
+	for _, part := range strings.Split(raw, ",") {
+		typ := strings.ToLower(strings.TrimSpace(part))
+		if typ == "" {
+			continue
+		}
+		typ = strings.TrimSuffix(typ, "s") // 同时接受 nodes、files 等复数写法
+		if !slices.Contains(searchTypes, typ) {
+			return nil, errors.New("未知的搜索类型: " + part)
+		}
+		wanted[typ] = true
+	}
+
+	types := make([]string, 0, len(wanted))
+	for _, t := range searchTypes {
+		if wanted[t] {
+			types = append(types, t)
+		}
+	}
+	return types, nil
+}
+
+func (h *searchHandler) searchCandidates(ctx context.Context, typ, username string, isAdmin bool) ([]searchCandidate, error) {
+	var candidates []searchCandidate
+	switch typ {
+	case searchTypeNode:
+		nodes, err := h.repo.ListNodes(ctx, username)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			candidates = append(candidates, searchCandidate{
+				result: searchResult{
+					Type:     searchTypeNode,
+					ID:       strconv.FormatInt(node.ID, 10),
+					Title:    node.NodeName,
+					Subtitle: strings.TrimSpace(node.Protocol + " " + node.OriginalServer),
+					Path:     "/nodes",
+				},
+				fields: [][2]string{
+					{"name", node.NodeName},
+					{"server", node.OriginalServer},
+					{"tag", node.Tag},
+					{"protocol", node.Protocol},
+					{"probe_server", node.ProbeServer},
+				},
+			})
+		}
+	case searchTypeFile:
+		var files []storage.SubscribeFile
+		var err error
+		path := "/subscribe-files"
+		if isAdmin {
+			files, err = h.repo.ListSubscribeFiles(ctx)
+		} else {
+			files, err = h.repo.GetUserSubscriptions(ctx, username)
+			path = "/subscription"
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			candidates = append(candidates, searchCandidate{
+				result: searchResult{
+					Type:     searchTypeFile,
+					ID:       strconv.FormatInt(file.ID, 10),
+					Title:    file.Name,
+					Subtitle: file.Filename,
+					Path:     path,
+				},
+				fields: [][2]string{
+					{"name", file.Name},
+					{"filename", file.Filename},
+					{"description", file.Description},
+				},
+			})
+		}
+	case searchTypeSubscription:
+		links, err := h.repo.ListSubscriptionLinks(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, link := range links {
+			candidates = append(candidates, searchCandidate{
+				result: searchResult{
+					Type:     searchTypeSubscription,
+					ID:       strconv.FormatInt(link.ID, 10),
+					Title:    link.Name,
+					Subtitle: link.RuleFilename,
+					Path:     "/subscription",
+				},
+				fields: [][2]string{
+					{"name", link.Name},
+					{"filename", link.RuleFilename},
+					{"description", link.Description},
+				},
+			})
+		}
+	case searchTypeUser:
+		users, err := h.repo.ListUsers(ctx, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range users {
+			candidates = append(candidates, searchCandidate{
+				result: searchResult{
+					Type:     searchTypeUser,
+					ID:       u.Username,
+					Title:    u.Username,
+					Subtitle: u.Nickname,
+					Path:     "/users",
+				},
+				fields: [][2]string{
+					{"username", u.Username},
+					{"nickname", u.Nickname},
+					{"email", u.Email},
+					{"remark", u.Remark},
+				},
+			})
+		}
+	case searchTypeRule:
+		rules, err := h.repo.ListCustomRules(ctx, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range rules {
+			candidates = append(candidates, searchCandidate{
+				result: searchResult{
+					Type:     searchTypeRule,
+					ID:       strconv.FormatInt(rule.ID, 10),
+					Title:    rule.Name,
+					Subtitle: rule.Type,
+					Path:     "/custom-rules",
+				},
+				fields: [][2]string{
+					{"name", rule.Name},
+					{"content", rule.Content},
+				},
+			})
+		}
+	}
+	return candidates, nil
+}
+
+// matchSearchCandidates 返回命中 needle 的记录，按得分排序：
+// 完全匹配 > 前缀匹配 > 包含，靠前字段（名称）的命中优先于后面的字段
+func matchSearchCandidates(candidates []searchCandidate, needle string) []searchResult {
+	var matched []searchResult
+	for _, candidate := range candidates {
+		best := 0
+		for i, field := range candidate.fields {
+			value := strings.ToLower(field[1])
+			score := 0
+			switch {
+			case value == needle:
+				score = 300
+			case strings.HasPrefix(value, needle):
+				score = 200
+			case strings.Contains(value, needle):
+				score = 100
+			default:
+				continue
+			}
+			score -= i * 10
+			if score > best {
+				best = score
+				candidate.result.Match = field[0]
+			}
+		}
+		if best > 0 {
+			candidate.result.score = best
+			matched = append(matched, candidate.result)
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		if matched[i].score != matched[j].score {
+			return matched[i].score > matched[j].score
+		}
+		return strings.ToLower(matched[i].Title) < strings.ToLower(matched[j].Title)
+	})
+	return matched
+}
@@ -0,0 +1,303 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	// servedSnapshotDiffContext 差异输出中变更行前后保留的上下文行数
+	servedSnapshotDiffContext = 3
+	// maxLineDiffCells 逐行对比的最大计算量（行数乘积），超出时整段视为替换
+	maxLineDiffCells = 4_000_000
+)
+
+type servedSnapshotDTO struct {
+	ID         int64     `json:"id"`
+	Username   string    `json:"username"`
+	Filename   string    `json:"filename"`
+	ClientType string    `json:"client_type"`
+	Day        string    `json:"day"`
+	SHA256     string    `json:"sha256"`
+	Size       int       `json:"size"`
+	Content    string    `json:"content,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func convertServedSnapshot(snap storage.ServedSnapshot) servedSnapshotDTO {
+	return servedSnapshotDTO{
+		ID:         snap.ID,
+		Username:   snap.Username,
+		Filename:   snap.Filename,
+		ClientType: snap.ClientType,
+		Day:        snap.Day,
+		SHA256:     snap.SHA256,
+		Size:       snap.Size,
+		Content:    string(snap.Content),
+		CreatedAt:  snap.CreatedAt,
+		UpdatedAt:  snap.UpdatedAt,
+	}
+}
+
+// archiveServedSubscription 开启归档时保存当天下发给用户的订阅内容，失败只记录日志不影响下发
+func archiveServedSubscription(ctx context.Context, repo *storage.TrafficRepository, username, filename, clientType string, data []byte) {
+	if repo == nil || username == "" || filename == "" {
+		return
+	}
+	cfg, err := repo.GetSystemConfig(ctx)
+	if err != nil || cfg.SnapshotRetentionDays <= 0 {
+		return
+	}
+
+	now := time.Now()
+	if loc, err := collectorLocation(cfg.CollectorTimezone); err == nil {
+		now = now.In(loc)
+	}
+	if err := repo.SaveServedSnapshot(ctx, username, filename, clientType, data, now, cfg.SnapshotRetentionDays); err != nil {
+		logger.Warn("[订阅归档] 保存订阅快照失败", "user", username, "filename", filename, "error", err)
+	}
+}
+
+type servedSnapshotsHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewServedSnapshotsHandler lists archived subscriptions (GET ?username=&filename=), returns one
+// snapshot with its content (GET /{id}) and diffs two snapshots (GET /diff?from=&to=).
+func NewServedSnapshotsHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("served snapshots handler requires repository")
+	}
+
+	return &servedSnapshotsHandler{repo: repo}
+}
+
+func (h *servedSnapshotsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/served-snapshots"), "/")
+	switch path {
+	case "":
+		h.handleList(w, r)
+	case "diff":
+		h.handleDiff(w, r)
+	default:
+		id, err := strconv.ParseInt(path, 10, 64)
+		if err != nil || id <= 0 {
+			writeBadRequest(w, "快照 ID 无效")
+			return
+		}
+		h.handleGet(w, r, id)
+	}
+}
+
+func (h *servedSnapshotsHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	snapshots, err := h.repo.ListServedSnapshots(r.Context(), r.URL.Query().Get("username"), r.URL.Query().Get("filename"), limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]servedSnapshotDTO, 0, len(snapshots))
+	for _, snap := range snapshots {
+		items = append(items, convertServedSnapshot(snap))
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"snapshots": items})
+}
+
+func (h *servedSnapshotsHandler) handleGet(w http.ResponseWriter, r *http.Request, id int64) {
+	snap, ok := h.loadSnapshot(w, r, id)
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"snapshot": convertServedSnapshot(snap)})
+}
+
+func (h *servedSnapshotsHandler) handleDiff(w http.ResponseWriter, r *http.Request) {
+	fromID, errFrom := strconv.ParseInt(r.URL.Query().Get("from"), 10, 64)
+	toID, errTo := strconv.ParseInt(r.URL.Query().Get("to"), 10, 64)
+	if errFrom != nil || errTo != nil || fromID <= 0 || toID <= 0 {
+		writeBadRequest(w, "需要 from 和 to 两个快照 ID")
+		return
+	}
+
+	from, ok := h.loadSnapshot(w, r, fromID)
+	if !ok {
+		return
+	}
+	to, ok := h.loadSnapshot(w, r, toID)
+	if !ok {
+		return
+	}
+
+	fromLabel := fmt.Sprintf("%s/%s@%s", from.Username, from.Filename, from.Day)
+	toLabel := fmt.Sprintf("%s/%s@%s", to.Username, to.Filename, to.Day)
+	diff := unifiedLineDiff(fromLabel, toLabel, string(from.Content), string(to.Content), servedSnapshotDiffContext)
+
+	// 元数据中不重复返回完整内容
+	from.Content, to.Content = nil, nil
+	respondJSON(w, http.StatusOK, map[string]any{
+		"from":      convertServedSnapshot(from),
+		"to":        convertServedSnapshot(to),
+		"identical": from.SHA256 == to.SHA256,
+		"diff":      diff,
+	})
+}
+
+func (h *servedSnapshotsHandler) loadSnapshot(w http.ResponseWriter, r *http.Request, id int64) (storage.ServedSnapshot, bool) {
+	snap, err := h.repo.GetServedSnapshot(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, storage.ErrServedSnapshotNotFound) {
+			writeError(w, http.StatusNotFound, fmt.Errorf("快照 %d 不存在", id))
+			return storage.ServedSnapshot{}, false
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return storage.ServedSnapshot{}, false
+	}
+	return snap, true
+}
+
+type lineDiffOp struct {
+	kind byte // ' ' 相同，'-' 删除，'+' 新增
+	text string
+}
+
+// diffLines 逐行对比：先去掉相同的首尾，中间部分用 LCS 求最小差异；计算量过大时整段视为替换
+func diffLines(a, b []string) []lineDiffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]lineDiffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, lineDiffOp{kind: ' ', text: line})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	n, m := len(midA), len(midB)
+	if n*m > maxLineDiffCells {
+		for _, line := range midA {
+			ops = append(ops, lineDiffOp{kind: '-', text: line})
+		}
+		for _, line := range midB {
+			ops = append(ops, lineDiffOp{kind: '+', text: line})
+		}
+	} else {
+		// lcs[i*(m+1)+j] 为 midA[i:] 与 midB[j:] 的最长公共子序列长度
+		lcs := make([]int32, (n+1)*(m+1))
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if midA[i] == midB[j] {
+					lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j+1] + 1
+				} else {
+					lcs[i*(m+1)+j] = max(lcs[(i+1)*(m+1)+j], lcs[i*(m+1)+j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < n && j < m {
+			switch {
+			case midA[i] == midB[j]:
+				ops = append(ops, lineDiffOp{kind: ' ', text: midA[i]})
+				i++
+				j++
+			case lcs[(i+1)*(m+1)+j] >= lcs[i*(m+1)+j+1]:
+				ops = append(ops, lineDiffOp{kind: '-', text: midA[i]})
+				i++
+			default:
+				ops = append(ops, lineDiffOp{kind: '+', text: midB[j]})
+				j++
+			}
+		}
+		for ; i < n; i++ {
+			ops = append(ops, lineDiffOp{kind: '-', text: midA[i]})
+		}
+		for ; j < m; j++ {
+			ops = append(ops, lineDiffOp{kind: '+', text: midB[j]})
+		}
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, lineDiffOp{kind: ' ', text: line})
+	}
+	return ops
+}
+
+// unifiedLineDiff 生成 unified diff 格式的文本差异，内容相同时返回空字符串
+func unifiedLineDiff(fromLabel, toLabel, from, to string, contextLines int) string {
+	if from == to {
+		return ""
+	}
+	ops := diffLines(strings.Split(from, "\n"), strings.Split(to, "\n"))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromLabel, toLabel)
+
+	// 行号（从 1 开始）：oldLine/newLine 为 ops[k] 之前已消费的行数
+	oldLines := make([]int, len(ops)+1)
+	newLines := make([]int, len(ops)+1)
+	for k, op := range ops {
+		oldLines[k+1], newLines[k+1] = oldLines[k], newLines[k]
+		if op.kind != '+' {
+			oldLines[k+1]++
+		}
+		if op.kind != '-' {
+			newLines[k+1]++
+		}
+	}
+
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+		// 向后合并间隔不超过 2*contextLines 行的变更为同一个 hunk
+		start := max(k-contextLines, 0)
+		end := k
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*contextLines {
+				end = min(end+contextLines, len(ops))
+				break
+			}
+			end = run
+		}
+
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n",
+			oldLines[start]+1, oldLines[end]-oldLines[start],
+			newLines[start]+1, newLines[end]-newLines[start])
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.text)
+			out.WriteByte('\n')
+		}
+		k = end
+	}
+
+	return out.String()
+}
@@ -32,7 +32,7 @@ func NewShortLinkHandler(repo *storage.TrafficRepository, subscriptionHandler *S
 }
 
 func (h *shortLinkHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	if !isSubscriptionRead(r.Method) {
 		http.NotFound(w, r)
 		return
 	}
@@ -130,7 +130,13 @@ func isAllowedPath(path string) bool {
 	allowedPrefixes := []string{
 		"/api/clash/subscribe",
 		"/api/proxy-provider/",
-		"/t/", // 临时订阅
+		"/api/offline/", // 离线模式下的规则集与地理数据库
+		"/api/rule-cache/", // 规则集缓存代理
+		"/api/geo/",        // 面板托管的地理数据库
+		"/t/",           // 临时订阅
+		"/api/probe-alerts", // 探针告警 Webhook（使用共享密钥鉴权）
+		"/api/health",       // 容器健康检查
+		"/api/grafana",      // Grafana 数据源（使用独立令牌鉴权）
 	}
 
 	for _, prefix := range allowedPrefixes {
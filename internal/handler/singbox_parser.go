@@ -0,0 +1,407 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// singboxSkippedOutboundTypes 不代表实际代理节点的 sing-box 出站类型
+var singboxSkippedOutboundTypes = map[string]struct{}{
+	"direct":   {},
+	"block":    {},
+	"dns":      {},
+	"selector": {},
+	"urltest":  {},
+}
+
+// isSingboxJSON 检查内容是否是 sing-box 配置（包含 outbounds 或 endpoints 的 JSON 对象）
+func isSingboxJSON(content []byte) bool {
+	trimmed := strings.TrimSpace(string(content))
+	if !strings.HasPrefix(trimmed, "{") {
+		return false
+	}
+
+	var probe struct {
+		Outbounds []json.RawMessage `json:"outbounds"`
+		Endpoints []json.RawMessage `json:"endpoints"`
+	}
+	if err := json.Unmarshal([]byte(trimmed), &probe); err != nil {
+		return false
+	}
+
+	return len(probe.Outbounds) > 0 || len(probe.Endpoints) > 0
+}
+
+// ParseSingboxSubscription parses sing-box JSON configuration and maps its outbounds
+// (and wireguard endpoints) back to Clash format proxies.
+// Outbounds that are not real proxies (direct/block/selector/...) are skipped.
+func ParseSingboxSubscription(content []byte) ([]map[string]any, error) {
+	var config struct {
+		Outbounds []map[string]any `json:"outbounds"`
+		Endpoints []map[string]any `json:"endpoints"`
+	}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("parse sing-box json: %w", err)
+	}
+
+	entries := make([]map[string]any, 0, len(config.Outbounds)+len(config.Endpoints))
+	entries = append(entries, config.Outbounds...)
+	entries = append(entries, config.Endpoints...)
+
+	var proxies []map[string]any
+	for _, outbound := range entries {
+		outboundType := strings.ToLower(getString(outbound, "type", ""))
+		if _, skip := singboxSkippedOutboundTypes[outboundType]; skip {
+			continue
+		}
+
+		proxy, err := convertSingboxOutbound(outbound)
+		if err != nil {
+			continue
+		}
+		proxies = append(proxies, proxy)
+	}
+
+	if len(proxies) == 0 {
+		return nil, errors.New("no supported outbounds found in sing-box config")
+	}
+
+	return proxies, nil
+}
+
+// convertSingboxOutbound 将单个 sing-box 出站转换为 Clash 节点
+func convertSingboxOutbound(outbound map[string]any) (map[string]any, error) {
+	outboundType := strings.ToLower(getString(outbound, "type", ""))
+	name := getString(outbound, "tag", "")
+	if name == "" {
+		return nil, errors.New("outbound tag is required")
+	}
+
+	if outboundType == "wireguard" {
+		return convertSingboxWireGuard(outbound, name)
+	}
+
+	server := getString(outbound, "server", "")
+	port := getInt(outbound, "server_port", 0)
+	if server == "" || port == 0 {
+		return nil, fmt.Errorf("outbound %s: server and server_port are required", name)
+	}
+
+	proxy := map[string]any{
+		"name":   name,
+		"server": server,
+		"port":   port,
+	}
+
+	switch outboundType {
+	case "shadowsocks":
+		proxy["type"] = "ss"
+		proxy["cipher"] = getString(outbound, "method", "")
+		proxy["password"] = getString(outbound, "password", "")
+		if plugin := getString(outbound, "plugin", ""); plugin != "" {
+			applySingboxSSPlugin(proxy, plugin, getString(outbound, "plugin_opts", ""))
+		}
+		if uot, ok := outbound["udp_over_tcp"].(bool); ok && uot {
+			proxy["udp-over-tcp"] = true
+		}
+	case "vmess":
+		proxy["type"] = "vmess"
+		proxy["uuid"] = getString(outbound, "uuid", "")
+		proxy["alterId"] = getInt(outbound, "alter_id", 0)
+		proxy["cipher"] = getString(outbound, "security", "auto")
+		applySingboxTLS(proxy, outbound, "servername")
+		applySingboxTransport(proxy, outbound)
+	case "vless":
+		proxy["type"] = "vless"
+		proxy["uuid"] = getString(outbound, "uuid", "")
+		if flow := getString(outbound, "flow", ""); flow != "" {
+			proxy["flow"] = flow
+		}
+		if encoding := getString(outbound, "packet_encoding", ""); encoding != "" {
+			proxy["packet-encoding"] = encoding
+		}
+		applySingboxTLS(proxy, outbound, "servername")
+		applySingboxTransport(proxy, outbound)
+	case "trojan":
+		proxy["type"] = "trojan"
+		proxy["password"] = getString(outbound, "password", "")
+		applySingboxTLS(proxy, outbound, "sni")
+		applySingboxTransport(proxy, outbound)
+	case "hysteria":
+		proxy["type"] = "hysteria"
+		if up := getInt(outbound, "up_mbps", 0); up > 0 {
+			proxy["up"] = up
+		}
+		if down := getInt(outbound, "down_mbps", 0); down > 0 {
+			proxy["down"] = down
+		}
+		if auth := getString(outbound, "auth_str", ""); auth != "" {
+			proxy["auth-str"] = auth
+		}
+		if obfs := getString(outbound, "obfs", ""); obfs != "" {
+			proxy["obfs"] = obfs
+		}
+		applySingboxTLS(proxy, outbound, "sni")
+	case "hysteria2":
+		proxy["type"] = "hysteria2"
+		proxy["password"] = getString(outbound, "password", "")
+		if up := getInt(outbound, "up_mbps", 0); up > 0 {
+			proxy["up"] = up
+		}
+		if down := getInt(outbound, "down_mbps", 0); down > 0 {
+			proxy["down"] = down
+		}
+		if obfs, ok := outbound["obfs"].(map[string]any); ok {
+			if obfsType := getString(obfs, "type", ""); obfsType != "" {
+				proxy["obfs"] = obfsType
+				proxy["obfs-password"] = getString(obfs, "password", "")
+			}
+		}
+		applySingboxTLS(proxy, outbound, "sni")
+	case "tuic":
+		proxy["type"] = "tuic"
+		proxy["uuid"] = getString(outbound, "uuid", "")
+		proxy["password"] = getString(outbound, "password", "")
+		if cc := getString(outbound, "congestion_control", ""); cc != "" {
+			proxy["congestion-controller"] = cc
+		}
+		if mode := getString(outbound, "udp_relay_mode", ""); mode != "" {
+			proxy["udp-relay-mode"] = mode
+		}
+		if zeroRTT, ok := outbound["zero_rtt_handshake"].(bool); ok && zeroRTT {
+			proxy["reduce-rtt"] = true
+		}
+		applySingboxTLS(proxy, outbound, "sni")
+	case "anytls":
+		proxy["type"] = "anytls"
+		proxy["password"] = getString(outbound, "password", "")
+		applySingboxTLS(proxy, outbound, "sni")
+	case "socks":
+		proxy["type"] = "socks5"
+		if username := getString(outbound, "username", ""); username != "" {
+			proxy["username"] = username
+			proxy["password"] = getString(outbound, "password", "")
+		}
+	case "http":
+		proxy["type"] = "http"
+		if username := getString(outbound, "username", ""); username != "" {
+			proxy["username"] = username
+			proxy["password"] = getString(outbound, "password", "")
+		}
+		applySingboxTLS(proxy, outbound, "sni")
+	default:
+		return nil, fmt.Errorf("unsupported sing-box outbound type: %s", outboundType)
+	}
+
+	// sing-box 默认同时启用 tcp/udp，仅当 network 限定为 tcp 时关闭 udp
+	if outboundType != "http" {
+		proxy["udp"] = getString(outbound, "network", "") != "tcp"
+	}
+
+	return proxy, nil
+}
+
+// applySingboxTLS 映射 sing-box tls 字段，sniKey 为目标协议在 Clash 中使用的 SNI 字段名
+func applySingboxTLS(proxy map[string]any, outbound map[string]any, sniKey string) {
+	tls, ok := outbound["tls"].(map[string]any)
+	if !ok {
+		return
+	}
+	if enabled, ok := tls["enabled"].(bool); !ok || !enabled {
+		return
+	}
+
+	switch proxy["type"] {
+	case "vmess", "vless", "http":
+		proxy["tls"] = true
+	}
+
+	if serverName := getString(tls, "server_name", ""); serverName != "" {
+		proxy[sniKey] = serverName
+	}
+	if insecure, ok := tls["insecure"].(bool); ok && insecure {
+		proxy["skip-cert-verify"] = true
+	}
+	if alpn, ok := tls["alpn"].([]any); ok && len(alpn) > 0 {
+		proxy["alpn"] = alpn
+	}
+	if utls, ok := tls["utls"].(map[string]any); ok {
+		if fingerprint := getString(utls, "fingerprint", ""); fingerprint != "" {
+			proxy["client-fingerprint"] = fingerprint
+		}
+	}
+	if reality, ok := tls["reality"].(map[string]any); ok {
+		if enabled, ok := reality["enabled"].(bool); ok && enabled {
+			realityOpts := map[string]any{
+				"public-key": getString(reality, "public_key", ""),
+			}
+			if shortID := getString(reality, "short_id", ""); shortID != "" {
+				realityOpts["short-id"] = shortID
+			}
+			proxy["reality-opts"] = realityOpts
+		}
+	}
+}
+
+// applySingboxTransport 映射 sing-box transport 字段到 Clash network/*-opts
+func applySingboxTransport(proxy map[string]any, outbound map[string]any) {
+	transport, ok := outbound["transport"].(map[string]any)
+	if !ok {
+		return
+	}
+
+	switch strings.ToLower(getString(transport, "type", "")) {
+	case "ws":
+		proxy["network"] = "ws"
+		wsOpts := map[string]any{}
+		if path := getString(transport, "path", ""); path != "" {
+			wsOpts["path"] = path
+		}
+		if headers, ok := transport["headers"].(map[string]any); ok && len(headers) > 0 {
+			wsOpts["headers"] = headers
+		}
+		if maxEarlyData := getInt(transport, "max_early_data", 0); maxEarlyData > 0 {
+			wsOpts["max-early-data"] = maxEarlyData
+		}
+		if headerName := getString(transport, "early_data_header_name", ""); headerName != "" {
+			wsOpts["early-data-header-name"] = headerName
+		}
+		proxy["ws-opts"] = wsOpts
+	case "httpupgrade":
+		proxy["network"] = "ws"
+		wsOpts := map[string]any{
+			"v2ray-http-upgrade": true,
+		}
+		if path := getString(transport, "path", ""); path != "" {
+			wsOpts["path"] = path
+		}
+		if host := getString(transport, "host", ""); host != "" {
+			wsOpts["headers"] = map[string]any{"Host": host}
+		}
+		proxy["ws-opts"] = wsOpts
+	case "grpc":
+		proxy["network"] = "grpc"
+		proxy["grpc-opts"] = map[string]any{
+			"grpc-service-name": getString(transport, "service_name", ""),
+		}
+	case "http":
+		proxy["network"] = "h2"
+		h2Opts := map[string]any{}
+		if path := getString(transport, "path", ""); path != "" {
+			h2Opts["path"] = path
+		}
+		if hosts, ok := transport["host"].([]any); ok && len(hosts) > 0 {
+			h2Opts["host"] = hosts
+		}
+		proxy["h2-opts"] = h2Opts
+	}
+}
+
+// applySingboxSSPlugin 映射 sing-box shadowsocks 插件（obfs-local / v2ray-plugin）
+func applySingboxSSPlugin(proxy map[string]any, plugin, pluginOpts string) {
+	opts := map[string]any{}
+	for _, part := range strings.Split(pluginOpts, ";") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if kv[0] == "" {
+			continue
+		}
+		if len(kv) == 2 {
+			opts[kv[0]] = kv[1]
+		} else {
+			opts[kv[0]] = true
+		}
+	}
+
+	switch plugin {
+	case "obfs-local":
+		proxy["plugin"] = "obfs"
+		pluginMap := map[string]any{}
+		if mode, ok := opts["obfs"]; ok {
+			pluginMap["mode"] = mode
+		}
+		if host, ok := opts["obfs-host"]; ok {
+			pluginMap["host"] = host
+		}
+		proxy["plugin-opts"] = pluginMap
+	case "v2ray-plugin":
+		proxy["plugin"] = "v2ray-plugin"
+		pluginMap := map[string]any{"mode": "websocket"}
+		if host, ok := opts["host"]; ok {
+			pluginMap["host"] = host
+		}
+		if path, ok := opts["path"]; ok {
+			pluginMap["path"] = path
+		}
+		if _, ok := opts["tls"]; ok {
+			pluginMap["tls"] = true
+		}
+		proxy["plugin-opts"] = pluginMap
+	}
+}
+
+// convertSingboxWireGuard 转换 wireguard 出站（旧版 outbound 及新版 endpoint 两种结构）
+func convertSingboxWireGuard(outbound map[string]any, name string) (map[string]any, error) {
+	proxy := map[string]any{
+		"name":        name,
+		"type":        "wireguard",
+		"private-key": getString(outbound, "private_key", ""),
+		"udp":         true,
+	}
+
+	server := getString(outbound, "server", "")
+	port := getInt(outbound, "server_port", 0)
+	publicKey := getString(outbound, "peer_public_key", "")
+	preSharedKey := getString(outbound, "pre_shared_key", "")
+	reserved := outbound["reserved"]
+
+	// 新版 endpoint 结构: 服务器信息在 peers[0]
+	if peers, ok := outbound["peers"].([]any); ok && len(peers) > 0 {
+		if peer, ok := peers[0].(map[string]any); ok {
+			server = getString(peer, "address", server)
+			port = getInt(peer, "port", port)
+			publicKey = getString(peer, "public_key", publicKey)
+			preSharedKey = getString(peer, "pre_shared_key", preSharedKey)
+			if peerReserved, ok := peer["reserved"]; ok {
+				reserved = peerReserved
+			}
+			if allowedIPs, ok := peer["allowed_ips"].([]any); ok && len(allowedIPs) > 0 {
+				proxy["allowed-ips"] = allowedIPs
+			}
+		}
+	}
+
+	if server == "" || port == 0 {
+		return nil, fmt.Errorf("outbound %s: server and server_port are required", name)
+	}
+
+	proxy["server"] = server
+	proxy["port"] = port
+	proxy["public-key"] = publicKey
+	if preSharedKey != "" {
+		proxy["pre-shared-key"] = preSharedKey
+	}
+	if reserved != nil {
+		proxy["reserved"] = reserved
+	}
+	if mtu := getInt(outbound, "mtu", 0); mtu > 0 {
+		proxy["mtu"] = mtu
+	}
+
+	addresses, ok := outbound["local_address"].([]any)
+	if !ok {
+		addresses, _ = outbound["address"].([]any)
+	}
+	for _, addr := range addresses {
+		cidr, _ := addr.(string)
+		ip := strings.SplitN(cidr, "/", 2)[0]
+		if strings.Contains(ip, ":") {
+			proxy["ipv6"] = ip
+		} else if ip != "" {
+			proxy["ip"] = ip
+		}
+	}
+
+	return proxy, nil
+}
@@ -0,0 +1,446 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+	"miaomiaowu/internal/validator"
+)
+
+// builtinGroupMembers 代理组中可直接引用的内置策略
+var builtinGroupMembers = map[string]struct{}{
+	"DIRECT":      {},
+	"REJECT":      {},
+	"REJECT-DROP": {},
+	"PASS":        {},
+	"COMPATIBLE":  {},
+}
+
+type proxyGroupDTO struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Proxies []string `json:"proxies"`
+	Use     []string `json:"use,omitempty"`
+}
+
+// proxyGroupOperation 对代理组的一次修改：
+// rename 需要 group 和 name；reorder 需要 order（全部代理组名称的新顺序）；
+// set_proxies 需要 group 和 proxies；add_proxy / remove_proxy 需要 group 和 proxy，add_proxy 可选 index
+type proxyGroupOperation struct {
+	Op      string   `json:"op"`
+	Group   string   `json:"group,omitempty"`
+	Name    string   `json:"name,omitempty"`
+	Order   []string `json:"order,omitempty"`
+	Proxies []string `json:"proxies,omitempty"`
+	Proxy   string   `json:"proxy,omitempty"`
+	Index   *int     `json:"index,omitempty"`
+}
+
+// proxyGroupDocument 订阅文件的 yaml.Node 视图，修改时保留注释和其他字段
+type proxyGroupDocument struct {
+	root    yaml.Node
+	proxies *yaml.Node
+	groups  *yaml.Node
+	rules   *yaml.Node
+}
+
+func parseProxyGroupDocument(data []byte) (*proxyGroupDocument, error) {
+	doc := &proxyGroupDocument{}
+	if err := yaml.Unmarshal(data, &doc.root); err != nil {
+		return nil, fmt.Errorf("订阅文件不是有效的YAML格式: %w", err)
+	}
+	if len(doc.root.Content) == 0 || doc.root.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("订阅文件格式不正确")
+	}
+
+	docNode := doc.root.Content[0]
+	for i := 0; i+1 < len(docNode.Content); i += 2 {
+		switch docNode.Content[i].Value {
+		case "proxies":
+			doc.proxies = docNode.Content[i+1]
+		case "proxy-groups":
+			doc.groups = docNode.Content[i+1]
+		case "rules":
+			doc.rules = docNode.Content[i+1]
+		}
+	}
+	if doc.groups == nil || doc.groups.Kind != yaml.SequenceNode {
+		return nil, errors.New("订阅文件中没有 proxy-groups")
+	}
+	return doc, nil
+}
+
+// groupField 返回代理组中字段的值节点，create 为 true 时不存在则创建空序列
+func groupField(groupNode *yaml.Node, key string, create bool) *yaml.Node {
+	for i := 0; i+1 < len(groupNode.Content); i += 2 {
+		if groupNode.Content[i].Value == key {
+			return groupNode.Content[i+1]
+		}
+	}
+	if !create {
+		return nil
+	}
+	value := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	groupNode.Content = append(groupNode.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+	return value
+}
+
+func scalarValues(node *yaml.Node) []string {
+	values := []string{}
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return values
+	}
+	for _, item := range node.Content {
+		if item.Kind == yaml.ScalarNode {
+			values = append(values, item.Value)
+		}
+	}
+	return values
+}
+
+func (d *proxyGroupDocument) list() []proxyGroupDTO {
+	groups := make([]proxyGroupDTO, 0, len(d.groups.Content))
+	for _, groupNode := range d.groups.Content {
+		if groupNode.Kind != yaml.MappingNode {
+			continue
+		}
+		group := proxyGroupDTO{
+			Name:    yamlMappingValue(groupNode, "name"),
+			Type:    yamlMappingValue(groupNode, "type"),
+			Proxies: scalarValues(groupField(groupNode, "proxies", false)),
+		}
+		if use := groupField(groupNode, "use", false); use != nil {
+			group.Use = scalarValues(use)
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+func (d *proxyGroupDocument) find(name string) *yaml.Node {
+	for _, groupNode := range d.groups.Content {
+		if groupNode.Kind == yaml.MappingNode && yamlMappingValue(groupNode, "name") == name {
+			return groupNode
+		}
+	}
+	return nil
+}
+
+// validMember 代理组成员必须是节点、其他代理组或内置策略
+func (d *proxyGroupDocument) validMember(group, member string) error {
+	if member == group {
+		return fmt.Errorf("代理组 %s 不能引用自身", group)
+	}
+	if _, ok := builtinGroupMembers[member]; ok {
+		return nil
+	}
+	if d.find(member) != nil {
+		return nil
+	}
+	if d.proxies != nil {
+		for _, proxyNode := range d.proxies.Content {
+			if yamlMappingValue(proxyNode, "name") == member {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("代理组 %s 的成员 %s 不存在", group, member)
+}
+
+func (d *proxyGroupDocument) apply(op proxyGroupOperation) error {
+	switch op.Op {
+	case "rename":
+		return d.rename(op.Group, strings.TrimSpace(op.Name))
+	case "reorder":
+		return d.reorder(op.Order)
+	case "set_proxies":
+		groupNode := d.find(op.Group)
+		if groupNode == nil {
+			return fmt.Errorf("代理组不存在: %s", op.Group)
+		}
+		seen := make(map[string]struct{}, len(op.Proxies))
+		content := make([]*yaml.Node, 0, len(op.Proxies))
+		for _, member := range op.Proxies {
+			if _, dup := seen[member]; dup {
+				return fmt.Errorf("代理组 %s 的成员 %s 重复", op.Group, member)
+			}
+			seen[member] = struct{}{}
+			if err := d.validMember(op.Group, member); err != nil {
+				return err
+			}
+			content = append(content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: member})
+		}
+		groupField(groupNode, "proxies", true).Content = content
+		return nil
+	case "add_proxy":
+		groupNode := d.find(op.Group)
+		if groupNode == nil {
+			return fmt.Errorf("代理组不存在: %s", op.Group)
+		}
+		if err := d.validMember(op.Group, op.Proxy); err != nil {
+			return err
+		}
+		proxies := groupField(groupNode, "proxies", true)
+		for _, item := range proxies.Content {
+			if item.Value == op.Proxy {
+				return fmt.Errorf("代理组 %s 已包含 %s", op.Group, op.Proxy)
+			}
+		}
+		index := len(proxies.Content)
+		if op.Index != nil {
+			if *op.Index < 0 || *op.Index > len(proxies.Content) {
+				return fmt.Errorf("插入位置超出范围: %d", *op.Index)
+			}
+			index = *op.Index
+		}
+		item := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: op.Proxy}
+		proxies.Content = append(proxies.Content[:index], append([]*yaml.Node{item}, proxies.Content[index:]...)...)
+		return nil
+	case "remove_proxy":
+		groupNode := d.find(op.Group)
+		if groupNode == nil {
+			return fmt.Errorf("代理组不存在: %s", op.Group)
+		}
+		proxies := groupField(groupNode, "proxies", false)
+		if proxies != nil {
+			for i, item := range proxies.Content {
+				if item.Value == op.Proxy {
+					proxies.Content = append(proxies.Content[:i], proxies.Content[i+1:]...)
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("代理组 %s 不包含 %s", op.Group, op.Proxy)
+	default:
+		return fmt.Errorf("不支持的操作: %s", op.Op)
+	}
+}
+
+// rename 重命名代理组，并同步更新其他代理组和规则中的引用
+func (d *proxyGroupDocument) rename(oldName, newName string) error {
+	groupNode := d.find(oldName)
+	if groupNode == nil {
+		return fmt.Errorf("代理组不存在: %s", oldName)
+	}
+	if newName == "" {
+		return errors.New("新名称不能为空")
+	}
+	if newName == oldName {
+		return nil
+	}
+	if _, builtin := builtinGroupMembers[newName]; builtin || d.find(newName) != nil {
+		return fmt.Errorf("名称已被使用: %s", newName)
+	}
+	if d.proxies != nil {
+		for _, proxyNode := range d.proxies.Content {
+			if yamlMappingValue(proxyNode, "name") == newName {
+				return fmt.Errorf("名称已被节点使用: %s", newName)
+			}
+		}
+	}
+
+	for i := 0; i+1 < len(groupNode.Content); i += 2 {
+		if groupNode.Content[i].Value == "name" {
+			groupNode.Content[i+1].Value = newName
+			break
+		}
+	}
+	updateProxyGroupsNode(d.groups, oldName, newName)
+	if d.rules != nil && d.rules.Kind == yaml.SequenceNode {
+		for _, ruleNode := range d.rules.Content {
+			if ruleNode.Kind == yaml.ScalarNode {
+				ruleNode.Value = renameRuleTarget(ruleNode.Value, oldName, newName)
+			}
+		}
+	}
+	return nil
+}
+
+// renameRuleTarget 替换规则的目标策略，目标之后可能跟有 no-resolve 等参数
+func renameRuleTarget(rule, oldName, newName string) string {
+	parts := strings.Split(rule, ",")
+	if len(parts) < 2 {
+		return rule
+	}
+	target := len(parts) - 1
+	for target > 1 && isRuleOption(strings.TrimSpace(parts[target])) {
+		target--
+	}
+	if strings.TrimSpace(parts[target]) != oldName {
+		return rule
+	}
+	parts[target] = newName
+	return strings.Join(parts, ",")
+}
+
+func isRuleOption(value string) bool {
+	switch value {
+	case "no-resolve", "src":
+		return true
+	}
+	return false
+}
+
+// reorder 按给定顺序重排代理组，order 必须恰好包含全部代理组
+func (d *proxyGroupDocument) reorder(order []string) error {
+	byName := make(map[string]*yaml.Node, len(d.groups.Content))
+	for _, groupNode := range d.groups.Content {
+		if groupNode.Kind == yaml.MappingNode {
+			byName[yamlMappingValue(groupNode, "name")] = groupNode
+		}
+	}
+	if len(order) != len(byName) || len(order) != len(d.groups.Content) {
+		return errors.New("order 必须包含全部代理组")
+	}
+
+	content := make([]*yaml.Node, 0, len(order))
+	for _, name := range order {
+		groupNode, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("代理组不存在或重复: %s", name)
+		}
+		delete(byName, name)
+		content = append(content, groupNode)
+	}
+	d.groups.Content = content
+	return nil
+}
+
+// handleProxyGroups 以结构化方式读取和修改订阅文件的代理组：
+// GET 列出代理组，PATCH 依次执行 operations，全部成功后才写回文件
+// errClashConfigInvalid 修改后的订阅文件未通过 Clash 配置校验
+var errClashConfigInvalid = errors.New("配置校验失败")
+
+// saveSubscribeFileNode 校验并写回修改后的订阅文件，记录版本并更新修改时间，返回版本号和保存的内容
+func (h *subscribeFilesHandler) saveSubscribeFileNode(ctx context.Context, subscribeFile storage.SubscribeFile, filePath string, root *yaml.Node) (int64, string, error) {
+	fixShortIdStyleInNode(root)
+	output, err := MarshalYAMLWithIndent(root)
+	if err != nil {
+		return 0, "", err
+	}
+	contentToSave := RemoveUnicodeEscapeQuotes(string(output))
+
+	var yamlCheck map[string]any
+	if err := yaml.Unmarshal([]byte(contentToSave), &yamlCheck); err != nil {
+		return 0, "", err
+	}
+	if result := validator.ValidateClashConfig(yamlCheck); !result.Valid {
+		var messages []string
+		for _, issue := range result.Issues {
+			if issue.Level == validator.ErrorLevel {
+				messages = append(messages, issue.Message)
+			}
+		}
+		return 0, "", fmt.Errorf("%w: %s", errClashConfigInvalid, strings.Join(messages, "; "))
+	}
+
+	if err := os.WriteFile(filePath, []byte(contentToSave), 0644); err != nil {
+		return 0, "", errors.New("保存文件失败")
+	}
+	notifySubscribeFileChanged(filePath)
+
+	filename := subscribeFile.Filename
+	version, err := h.repo.SaveRuleVersion(ctx, filename, contentToSave, "admin")
+	if err != nil {
+		logger.Warn("[订阅文件] 保存版本记录失败", "filename", filename, "error", err)
+	}
+	subscribeFile.UpdatedAt = time.Now()
+	if _, err := h.repo.UpdateSubscribeFile(ctx, subscribeFile); err != nil {
+		logger.Warn("[订阅文件] 更新订阅信息失败", "filename", filename, "error", err)
+	}
+	return version, contentToSave, nil
+}
+
+func (h *subscribeFilesHandler) handleProxyGroups(w http.ResponseWriter, r *http.Request, filename string) {
+	filename, err := url.QueryUnescape(filename)
+	if err != nil || filename == "" {
+		writeBadRequest(w, "无效的文件名")
+		return
+	}
+
+	subscribeFile, err := h.repo.GetSubscribeFileByFilename(r.Context(), filename)
+	if err != nil {
+		if errors.Is(err, storage.ErrSubscribeFileNotFound) {
+			writeError(w, http.StatusNotFound, errors.New("订阅文件不存在"))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	filePath := filepath.Join("subscribes", filepath.Base(filename))
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			writeError(w, http.StatusNotFound, errors.New("文件不存在"))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, errors.New("读取文件失败"))
+		return
+	}
+
+	doc, err := parseProxyGroupDocument(content)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		respondJSON(w, http.StatusOK, map[string]any{
+			"groups": doc.list(),
+		})
+		return
+	case http.MethodPatch:
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPatch)
+		return
+	}
+
+	var req struct {
+		Operations []proxyGroupOperation `json:"operations"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBadRequest(w, "请求格式不正确")
+		return
+	}
+	if len(req.Operations) == 0 {
+		writeBadRequest(w, "operations 不能为空")
+		return
+	}
+
+	for i, op := range req.Operations {
+		if err := doc.apply(op); err != nil {
+			writeBadRequest(w, fmt.Sprintf("第 %d 个操作失败: %s", i+1, err.Error()))
+			return
+		}
+	}
+
+	version, _, err := h.saveSubscribeFileNode(r.Context(), subscribeFile, filePath, &doc.root)
+	if err != nil {
+		if errors.Is(err, errClashConfigInvalid) {
+			writeBadRequest(w, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logger.Info("[代理组] 已更新订阅文件代理组", "filename", filename, "operations", len(req.Operations))
+	respondJSON(w, http.StatusOK, map[string]any{
+		"groups":  doc.list(),
+		"version": version,
+	})
+}
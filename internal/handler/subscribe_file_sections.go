@@ -0,0 +1,326 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+// sectionUpdateRequest 局部更新：content 为该部分的 YAML；offset/limit 用于替换序列中的一段，
+// revision 为读取时返回的文件版本标识，文件在此期间被修改时拒绝写入
+type sectionUpdateRequest struct {
+	Content  string `json:"content"`
+	Revision string `json:"revision"`
+	Offset   *int   `json:"offset"`
+	Limit    *int   `json:"limit"`
+}
+
+type sectionResponse struct {
+	Filename string `json:"filename"`
+	Section  string `json:"section"`
+	Group    string `json:"group,omitempty"`
+	Content  string `json:"content"`
+	Revision string `json:"revision"`
+	Total    *int   `json:"total,omitempty"` // 序列的总条目数
+	Offset   int    `json:"offset,omitempty"`
+	Version  int64  `json:"version,omitempty"`
+}
+
+// fileRevision 文件内容的版本标识
+func fileRevision(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// sectionKeyIndex 返回顶层字段在文档映射中的键位置，不存在时返回 -1
+func sectionKeyIndex(docNode *yaml.Node, section string) int {
+	for i := 0; i+1 < len(docNode.Content); i += 2 {
+		if docNode.Content[i].Value == section {
+			return i
+		}
+	}
+	return -1
+}
+
+// findGroupIndex 返回代理组在 proxy-groups 序列中的位置，不存在时返回 -1
+func findGroupIndex(groups *yaml.Node, name string) int {
+	if groups == nil || groups.Kind != yaml.SequenceNode {
+		return -1
+	}
+	for i, groupNode := range groups.Content {
+		if groupNode.Kind == yaml.MappingNode && yamlMappingValue(groupNode, "name") == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// sliceBounds 规范化 offset/limit，limit 为 0 表示到末尾
+func sliceBounds(total int, offset, limit *int) (int, int, error) {
+	start, end := 0, total
+	if offset != nil {
+		if *offset < 0 || *offset > total {
+			return 0, 0, fmt.Errorf("offset 超出范围 0-%d", total)
+		}
+		start = *offset
+	}
+	if limit != nil {
+		if *limit < 0 {
+			return 0, 0, errors.New("limit 不能为负数")
+		}
+		if *limit > 0 && start+*limit < total {
+			end = start + *limit
+		}
+	}
+	return start, end, nil
+}
+
+func optionalInt(value string) (*int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+func marshalSectionNode(node *yaml.Node) (string, error) {
+	output, err := MarshalYAMLWithIndent(node)
+	if err != nil {
+		return "", err
+	}
+	return RemoveUnicodeEscapeQuotes(string(output)), nil
+}
+
+// handleSection GET/PUT /api/admin/subscribe-files/{filename}/section?section=rules
+// 或 ?group=名称 读写订阅文件的单个顶层字段或单个代理组，序列字段支持 offset/limit 分段读写，
+// 避免大文件在编辑时整体往返
+func (h *subscribeFilesHandler) handleSection(w http.ResponseWriter, r *http.Request, filename string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+		return
+	}
+
+	filename, err := url.QueryUnescape(filename)
+	if err != nil || filename == "" {
+		writeBadRequest(w, "无效的文件名")
+		return
+	}
+
+	query := r.URL.Query()
+	section := strings.TrimSpace(query.Get("section"))
+	group := strings.TrimSpace(query.Get("group"))
+	if group != "" {
+		if section != "" && section != "proxy-groups" {
+			writeBadRequest(w, "group 只能与 proxy-groups 一起使用")
+			return
+		}
+		section = "proxy-groups"
+	}
+	if section == "" {
+		writeBadRequest(w, "缺少 section 参数")
+		return
+	}
+
+	subscribeFile, err := h.repo.GetSubscribeFileByFilename(r.Context(), filename)
+	if err != nil {
+		if errors.Is(err, storage.ErrSubscribeFileNotFound) {
+			writeError(w, http.StatusNotFound, errors.New("订阅文件不存在"))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	filePath := filepath.Join("subscribes", filepath.Base(filename))
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			writeError(w, http.StatusNotFound, errors.New("文件不存在"))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, errors.New("读取文件失败"))
+		return
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		writeBadRequest(w, "订阅文件不是有效的YAML格式")
+		return
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		writeBadRequest(w, "订阅文件格式不正确")
+		return
+	}
+	docNode := root.Content[0]
+
+	if r.Method == http.MethodGet {
+		h.respondSection(w, r, subscribeFile.Filename, docNode, section, group, fileRevision(content))
+		return
+	}
+
+	var req sectionUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBadRequest(w, "请求格式不正确")
+		return
+	}
+	if req.Revision != "" && req.Revision != fileRevision(content) {
+		writeError(w, http.StatusConflict, errors.New("文件已被修改，请重新加载后再保存"))
+		return
+	}
+
+	var parsed yaml.Node
+	if err := yaml.Unmarshal([]byte(req.Content), &parsed); err != nil {
+		writeBadRequest(w, "内容不是有效的YAML格式: "+err.Error())
+		return
+	}
+	replacement := &parsed
+	if parsed.Kind == yaml.DocumentNode && len(parsed.Content) > 0 {
+		replacement = parsed.Content[0]
+	} else if parsed.Kind == 0 {
+		// 空内容视为空序列，用于删除一段条目
+		replacement = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	}
+
+	if err := replaceSection(docNode, section, group, replacement, req.Offset, req.Limit); err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	version, saved, err := h.saveSubscribeFileNode(r.Context(), subscribeFile, filePath, &root)
+	if err != nil {
+		if errors.Is(err, errClashConfigInvalid) {
+			writeBadRequest(w, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logger.Info("[订阅文件] 已局部更新订阅文件", "filename", filename, "section", section, "group", group)
+	respondJSON(w, http.StatusOK, map[string]any{
+		"filename": subscribeFile.Filename,
+		"section":  section,
+		"group":    group,
+		"revision": fileRevision([]byte(saved)),
+		"version":  version,
+	})
+}
+
+func (h *subscribeFilesHandler) respondSection(w http.ResponseWriter, r *http.Request, filename string, docNode *yaml.Node, section, group, revision string) {
+	keyIndex := sectionKeyIndex(docNode, section)
+	if keyIndex < 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("订阅文件中没有 %s", section))
+		return
+	}
+	node := docNode.Content[keyIndex+1]
+
+	resp := sectionResponse{Filename: filename, Section: section, Group: group, Revision: revision}
+	if group != "" {
+		index := findGroupIndex(node, group)
+		if index < 0 {
+			writeError(w, http.StatusNotFound, fmt.Errorf("代理组 %s 不存在", group))
+			return
+		}
+		node = node.Content[index]
+	} else if node.Kind == yaml.SequenceNode {
+		offset, err := optionalInt(r.URL.Query().Get("offset"))
+		if err != nil {
+			writeBadRequest(w, "offset 无效")
+			return
+		}
+		limit, err := optionalInt(r.URL.Query().Get("limit"))
+		if err != nil {
+			writeBadRequest(w, "limit 无效")
+			return
+		}
+		start, end, err := sliceBounds(len(node.Content), offset, limit)
+		if err != nil {
+			writeBadRequest(w, err.Error())
+			return
+		}
+		total := len(node.Content)
+		resp.Total = &total
+		resp.Offset = start
+		slice := *node
+		slice.Content = node.Content[start:end]
+		node = &slice
+	}
+
+	content, err := marshalSectionNode(node)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	resp.Content = content
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// replaceSection 用 replacement 替换顶层字段、单个代理组或序列中的一段
+func replaceSection(docNode *yaml.Node, section, group string, replacement *yaml.Node, offset, limit *int) error {
+	keyIndex := sectionKeyIndex(docNode, section)
+
+	if group != "" {
+		if keyIndex < 0 {
+			return errors.New("订阅文件中没有 proxy-groups")
+		}
+		groups := docNode.Content[keyIndex+1]
+		index := findGroupIndex(groups, group)
+		if index < 0 {
+			return fmt.Errorf("代理组 %s 不存在", group)
+		}
+		if replacement.Kind != yaml.MappingNode {
+			return errors.New("代理组内容必须是映射")
+		}
+		if name := yamlMappingValue(replacement, "name"); name != group {
+			return errors.New("不能在此修改代理组名称，请使用代理组重命名接口")
+		}
+		groups.Content[index] = replacement
+		return nil
+	}
+
+	if offset != nil || limit != nil {
+		if keyIndex < 0 {
+			return fmt.Errorf("订阅文件中没有 %s", section)
+		}
+		existing := docNode.Content[keyIndex+1]
+		if existing.Kind != yaml.SequenceNode || replacement.Kind != yaml.SequenceNode {
+			return errors.New("offset/limit 只能用于列表字段，内容也必须是列表")
+		}
+		start, end, err := sliceBounds(len(existing.Content), offset, limit)
+		if err != nil {
+			return err
+		}
+		items := make([]*yaml.Node, 0, len(existing.Content)-(end-start)+len(replacement.Content))
+		items = append(items, existing.Content[:start]...)
+		items = append(items, replacement.Content...)
+		items = append(items, existing.Content[end:]...)
+		existing.Content = items
+		return nil
+	}
+
+	if keyIndex < 0 {
+		docNode.Content = append(docNode.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: section}, replacement)
+		return nil
+	}
+	if existing := docNode.Content[keyIndex+1]; existing.Kind == yaml.SequenceNode && replacement.Kind != yaml.SequenceNode {
+		return fmt.Errorf("%s 的内容必须是列表", section)
+	}
+	docNode.Content[keyIndex+1] = replacement
+	return nil
+}
@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"miaomiaowu/internal/storage"
+	"miaomiaowu/internal/substore"
 	"miaomiaowu/internal/validator"
 
 	"gopkg.in/yaml.v3"
@@ -44,6 +45,20 @@ func (h *subscribeFilesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 	path := strings.TrimPrefix(r.URL.Path, "/api/admin/subscribe-files")
 	path = strings.Trim(path, "/")
 
+	// 更新和删除时订阅文件既可以用数字 ID 也可以用 UUID 引用
+	if storage.IsPublicID(path) {
+		id, err := h.repo.SubscribeFileIDByUUID(r.Context(), path)
+		if err != nil {
+			if errors.Is(err, storage.ErrSubscribeFileNotFound) {
+				writeError(w, http.StatusNotFound, errors.New("订阅文件不存在"))
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		path = strconv.FormatInt(id, 10)
+	}
+
 	switch {
 	case path == "" && r.Method == http.MethodGet:
 		h.handleList(w, r)
@@ -55,6 +70,10 @@ func (h *subscribeFilesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 		h.handleUpload(w, r)
 	case path == "create-from-config" && r.Method == http.MethodPost:
 		h.handleCreateFromConfig(w, r)
+	case path == "dangling-refs" && r.Method == http.MethodGet:
+		h.handleDanglingRefs(w, r)
+	case path == "dangling-refs/fix" && r.Method == http.MethodPost:
+		h.handleFixDanglingRefs(w, r)
 	case strings.HasSuffix(path, "/content") && r.Method == http.MethodGet:
 		// GET /api/admin/subscribe-files/{filename}/content
 		filename := strings.TrimSuffix(path, "/content")
@@ -63,6 +82,14 @@ func (h *subscribeFilesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 		// PUT /api/admin/subscribe-files/{filename}/content
 		filename := strings.TrimSuffix(path, "/content")
 		h.handleUpdateContent(w, r, filename)
+	case strings.HasSuffix(path, "/section"):
+		// GET/PUT /api/admin/subscribe-files/{filename}/section?section=rules 或 ?group=名称
+		filename := strings.TrimSuffix(path, "/section")
+		h.handleSection(w, r, filename)
+	case strings.HasSuffix(path, "/proxy-groups"):
+		// GET/PATCH /api/admin/subscribe-files/{filename}/proxy-groups
+		filename := strings.TrimSuffix(path, "/proxy-groups")
+		h.handleProxyGroups(w, r, filename)
 	case path != "" && path != "import" && path != "upload" && path != "create-from-config" && (r.Method == http.MethodPut || r.Method == http.MethodPatch):
 		h.handleUpdate(w, r, path)
 	case path != "" && path != "import" && path != "upload" && path != "create-from-config" && r.Method == http.MethodDelete:
@@ -164,11 +191,13 @@ func (h *subscribeFilesHandler) handleImport(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// 创建HTTP客户端并获取订阅内容
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	if rejectInAirGappedMode(w) {
+		return
 	}
 
+	// 创建HTTP客户端并获取订阅内容（使用全局出站代理）
+	client := importFetchClient(30*time.Second, false)
+
 	httpReq, err := http.NewRequest("GET", req.URL, nil)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, errors.New("无效的订阅URL"))
@@ -234,6 +263,7 @@ func (h *subscribeFilesHandler) handleImport(w http.ResponseWriter, r *http.Requ
 		writeError(w, http.StatusInternalServerError, errors.New("保存订阅文件失败"))
 		return
 	}
+	notifySubscribeFileChanged(filePath)
 
 	// 保存到数据库
 	file := storage.SubscribeFile{
@@ -320,6 +350,7 @@ func (h *subscribeFilesHandler) handleUpload(w http.ResponseWriter, r *http.Requ
 		writeError(w, http.StatusInternalServerError, errors.New("保存订阅文件失败"))
 		return
 	}
+	notifySubscribeFileChanged(filePath)
 
 	// 保存到数据库
 	subscribeFile := storage.SubscribeFile{
@@ -402,6 +433,23 @@ func (h *subscribeFilesHandler) handleUpdate(w http.ResponseWriter, r *http.Requ
 		// 为空时清除过期时间
 		existing.ExpireAt = nil
 	}
+	oldCacheControl := existing.CacheControl
+	if req.CacheControl != nil {
+		if err := validateCacheControl(*req.CacheControl); err != nil {
+			writeBadRequest(w, err.Error())
+			return
+		}
+		existing.CacheControl = strings.TrimSpace(*req.CacheControl)
+	}
+	oldDefaultTarget := existing.DefaultTarget
+	if req.DefaultTarget != nil {
+		target := strings.TrimSpace(*req.DefaultTarget)
+		if target != "" && !substore.GetDefaultFactory().HasOutputFormat(target) {
+			writeBadRequest(w, "未知的默认转换类型: "+target)
+			return
+		}
+		existing.DefaultTarget = target
+	}
 
 	// 处理文件名更新
 	oldFilename := existing.Filename
@@ -455,6 +503,11 @@ func (h *subscribeFilesHandler) handleUpdate(w http.ResponseWriter, r *http.Requ
 			}
 		}
 		// 如果旧文件不存在，只更新数据库记录，不报错
+		// 旧地址在 CDN 上的缓存需要清除
+		notifySubscribeFileChanged(oldFilename)
+	}
+	if updated.CacheControl != oldCacheControl || updated.DefaultTarget != oldDefaultTarget {
+		notifySubscribeFileChanged(updated.Filename)
 	}
 
 	// If auto_sync was just enabled (changed from false to true), trigger immediate sync
@@ -508,6 +561,7 @@ func (h *subscribeFilesHandler) handleDelete(w http.ResponseWriter, r *http.Requ
 	// 删除物理文件
 	filePath := filepath.Join("subscribes", file.Filename)
 	_ = os.Remove(filePath) // 忽略错误，即使文件不存在也继续
+	notifySubscribeFileChanged(filePath)
 
 	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
@@ -550,15 +604,20 @@ type subscribeFileRequest struct {
 	Filename            string  `json:"filename"`
 	AutoSyncCustomRules *bool   `json:"auto_sync_custom_rules,omitempty"` // Pointer to distinguish between false and not provided
 	ExpireAt            *string `json:"expire_at,omitempty"`
+	CacheControl        *string `json:"cache_control,omitempty"`  // nil keeps the current value
+	DefaultTarget       *string `json:"default_target,omitempty"` // nil keeps the current value; "" serves the file as-is
 }
 
 type subscribeFileDTO struct {
 	ID                  int64      `json:"id"`
+	UUID                string     `json:"uuid"`
 	Name                string     `json:"name"`
 	Description         string     `json:"description"`
 	Type                string     `json:"type"`
 	Filename            string     `json:"filename"`
 	ExpireAt            *time.Time `json:"expire_at,omitempty"`
+	CacheControl        string     `json:"cache_control"`
+	DefaultTarget       string     `json:"default_target"`
 	AutoSyncCustomRules bool       `json:"auto_sync_custom_rules"`
 	CreatedAt           time.Time  `json:"created_at"`
 	UpdatedAt           time.Time  `json:"updated_at"`
@@ -568,11 +627,14 @@ type subscribeFileDTO struct {
 func convertSubscribeFile(file storage.SubscribeFile) subscribeFileDTO {
 	return subscribeFileDTO{
 		ID:                  file.ID,
+		UUID:                file.UUID,
 		Name:                file.Name,
 		Description:         file.Description,
 		Type:                file.Type,
 		Filename:            file.Filename,
 		ExpireAt:            file.ExpireAt,
+		CacheControl:        file.CacheControl,
+		DefaultTarget:       file.DefaultTarget,
 		AutoSyncCustomRules: file.AutoSyncCustomRules,
 		CreatedAt:           file.CreatedAt,
 		UpdatedAt:           file.UpdatedAt,
@@ -761,6 +823,7 @@ func (h *subscribeFilesHandler) handleCreateFromConfig(w http.ResponseWriter, r
 		writeError(w, http.StatusInternalServerError, errors.New("保存订阅文件失败"))
 		return
 	}
+	notifySubscribeFileChanged(filePath)
 
 	// 保存到数据库
 	file := storage.SubscribeFile{
@@ -925,6 +988,7 @@ func (h *subscribeFilesHandler) handleUpdateContent(w http.ResponseWriter, r *ht
 		writeError(w, http.StatusInternalServerError, errors.New("保存文件失败"))
 		return
 	}
+	notifySubscribeFileChanged(filePath)
 
 	// 保存版本记录
 	version, err := h.repo.SaveRuleVersion(r.Context(), filename, contentToSave, "admin")
@@ -166,18 +166,11 @@ func (s *subscriptionEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request)
 }
 
 func (s *subscriptionEndpoint) authorizeRequest(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
-	if r.Method != http.MethodGet {
+	if !isSubscriptionRead(r.Method) {
 		// allow handler to respond with method restrictions
 		return r, true
 	}
 
-	// Check for username parameter (from composite short link - already authenticated by short link handler)
-	queryUsername := strings.TrimSpace(r.URL.Query().Get("username"))
-	if queryUsername != "" {
-		ctx := auth.ContextWithUsername(r.Context(), queryUsername)
-		return r.WithContext(ctx), true
-	}
-
 	// Check for token parameter (legacy/direct access)
 	queryToken := strings.TrimSpace(r.URL.Query().Get("token"))
 	if queryToken != "" && s.repo != nil {
@@ -210,8 +203,12 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	requestStart := time.Now()
 	var stepStart time.Time
 
-	if r.Method != http.MethodGet {
-		writeError(w, http.StatusMethodNotAllowed, errors.New("only GET is supported"))
+	if !isSubscriptionRead(r.Method) {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("only GET and HEAD are supported"))
+		return
+	}
+
+	if !h.checkSubscriptionStrictMode(w, r) {
 		return
 	}
 
@@ -269,7 +266,7 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 			}
 		}
 	}
-	logger.Info("[⏱️ 耗时监测] 文件查找完成", "step", "file_lookup", "duration_ms", time.Since(stepStart).Milliseconds(), "filename", filename)
+	logger.DebugContext(r.Context(), "[⏱️ 耗时监测] 文件查找完成", "step", "file_lookup", "duration_ms", time.Since(stepStart).Milliseconds(), "filename", filename)
 
 	cleanedName := filepath.Clean(filename)
 	if strings.HasPrefix(cleanedName, "..") || filepath.IsAbs(cleanedName) {
@@ -298,7 +295,7 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	if hasSubscribeFile && subscribeFile.ExpireAt != nil {
 		now := time.Now()
 		if !subscribeFile.ExpireAt.After(now) {
-			logger.Info("[Subscription] 订阅已过期", "filename", filename, "expire_at", subscribeFile.ExpireAt.Format("2006-01-02 15:04:05"))
+			logger.InfoContext(r.Context(), "[Subscription] 订阅已过期", "filename", filename, "expire_at", subscribeFile.ExpireAt.Format("2006-01-02 15:04:05"))
 			h.serveTokenInvalidResponse(w, r)
 			return
 		}
@@ -315,7 +312,7 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		}
 		return
 	}
-	logger.Info("[⏱️ 耗时监测] 文件读取完成", "step", "file_read", "duration_ms", time.Since(stepStart).Milliseconds(), "bytes", len(data))
+	logger.DebugContext(r.Context(), "[⏱️ 耗时监测] 文件读取完成", "step", "file_read", "duration_ms", time.Since(stepStart).Milliseconds(), "bytes", len(data))
 
 	// MMW 同步
 	stepStart = time.Now()
@@ -329,7 +326,31 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 			data = updatedData
 		}
 	}
-	logger.Info("[⏱️ 耗时监测] MMW 同步完成", "step", "mmw_sync", "duration_ms", time.Since(stepStart).Milliseconds())
+	logger.DebugContext(r.Context(), "[⏱️ 耗时监测] MMW 同步完成", "step", "mmw_sync", "duration_ms", time.Since(stepStart).Milliseconds())
+
+	// 移除当前处于定时禁用时段的节点
+	if h.repo != nil {
+		names, err := h.repo.ListScheduleDisabledNodeNames(r.Context())
+		if err != nil {
+			logger.InfoContext(r.Context(), "[Subscription] 获取定时禁用节点失败", "error", err)
+		} else if stripped, ok := stripNodesFromSubscription(data, names); ok {
+			data = stripped
+			logger.InfoContext(r.Context(), "[Subscription] 已移除定时禁用的节点", "count", len(names))
+		}
+	}
+
+	// 开启告警移除时，移除绑定了告警中探针服务器的节点，告警恢复后自动恢复
+	if h.repo != nil {
+		if systemConfig, err := h.repo.GetSystemConfig(r.Context()); err == nil && systemConfig.ProbeAlertExclude {
+			names, err := h.repo.ListProbeAlertNodeNames(r.Context())
+			if err != nil {
+				logger.InfoContext(r.Context(), "[Subscription] 获取告警节点失败", "error", err)
+			} else if stripped, ok := stripNodesFromSubscription(data, names); ok {
+				data = stripped
+				logger.InfoContext(r.Context(), "[Subscription] 已移除探针告警中的节点", "count", len(names))
+			}
+		}
+	}
 
 	// 外部订阅同步
 	stepStart = time.Now()
@@ -337,19 +358,19 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	if username != "" && h.repo != nil {
 		settings, err := h.repo.GetUserSettings(r.Context(), username)
 		if err == nil && settings.ForceSyncExternal {
-			logger.Info("[Subscription] 用户启用强制同步", "user", username, "cache_expire_minutes", settings.CacheExpireMinutes)
+			logger.InfoContext(r.Context(), "[Subscription] 用户启用强制同步", "user", username, "cache_expire_minutes", settings.CacheExpireMinutes)
 
 			// Get external subscriptions referenced in current file
 			usedExternalSubs, err := GetExternalSubscriptionsFromFile(r.Context(), data, username, h.repo)
 			if err != nil {
-				logger.Info("[Subscription] 获取文件中的外部订阅失败", "error", err)
+				logger.InfoContext(r.Context(), "[Subscription] 获取文件中的外部订阅失败", "error", err)
 			} else if len(usedExternalSubs) > 0 {
-				logger.Info("[Subscription] 找到当前文件引用的外部订阅", "count", len(usedExternalSubs))
+				logger.InfoContext(r.Context(), "[Subscription] 找到当前文件引用的外部订阅", "count", len(usedExternalSubs))
 
 				// Get user's external subscriptions to check cache and get URLs
 				allExternalSubs, err := h.repo.ListExternalSubscriptions(r.Context(), username)
 				if err != nil {
-					logger.Info("[Subscription] 获取外部订阅列表失败", "error", err)
+					logger.InfoContext(r.Context(), "[Subscription] 获取外部订阅列表失败", "error", err)
 				} else {
 					// Filter to only sync subscriptions that are referenced in the current file
 					var subsToSync []storage.ExternalSubscription
@@ -362,7 +383,7 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 						}
 					}
 
-					logger.Info("[Subscription] 强制同步已启用，将同步引用的外部订阅", "sync_count", len(subsToSync), "total_count", len(allExternalSubs))
+					logger.InfoContext(r.Context(), "[Subscription] 强制同步已启用，将同步引用的外部订阅", "sync_count", len(subsToSync), "total_count", len(allExternalSubs))
 
 					// Check if we need to sync based on cache expiration
 					shouldSync := false
@@ -371,7 +392,7 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 						for _, sub := range subsToSync {
 							if sub.LastSyncAt == nil {
 								// Never synced before
-								logger.Info("[Subscription] 订阅从未同步过，将进行同步", "name", sub.Name, "url", sub.URL)
+								logger.InfoContext(r.Context(), "[Subscription] 订阅从未同步过，将进行同步", "name", sub.Name, "url", sub.URL)
 								shouldSync = true
 								break
 							}
@@ -380,47 +401,47 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 							elapsed := time.Since(*sub.LastSyncAt).Minutes()
 							if elapsed >= float64(settings.CacheExpireMinutes) {
 								// Cache expired
-								logger.Info("[Subscription] 订阅缓存已过期，将进行同步", "name", sub.Name, "url", sub.URL, "elapsed_minutes", elapsed, "expire_minutes", settings.CacheExpireMinutes)
+								logger.InfoContext(r.Context(), "[Subscription] 订阅缓存已过期，将进行同步", "name", sub.Name, "url", sub.URL, "elapsed_minutes", elapsed, "expire_minutes", settings.CacheExpireMinutes)
 								shouldSync = true
 								break
 							}
 						}
 						if !shouldSync {
-							logger.Info("[Subscription] All referenced subscriptions are within cache time, skipping sync")
+							logger.InfoContext(r.Context(), "[Subscription] All referenced subscriptions are within cache time, skipping sync")
 						}
 					} else {
 						// Cache expire minutes is 0, always sync
-						logger.Info("[Subscription] Cache expire minutes is 0, will always sync referenced subscriptions")
+						logger.InfoContext(r.Context(), "[Subscription] Cache expire minutes is 0, will always sync referenced subscriptions")
 						shouldSync = true
 					}
 
 					if shouldSync {
-						logger.Info("[Subscription] 开始同步用户的外部订阅(仅引用的订阅)", "user", username)
+						logger.InfoContext(r.Context(), "[Subscription] 开始同步用户的外部订阅(仅引用的订阅)", "user", username)
 						// Sync only the referenced external subscriptions
 						if err := syncReferencedExternalSubscriptions(r.Context(), h.repo, h.baseDir, username, subsToSync); err != nil {
-							logger.Info("[Subscription] 同步外部订阅失败", "error", err)
+							logger.InfoContext(r.Context(), "[Subscription] 同步外部订阅失败", "error", err)
 							// Log error but don't fail the request
 							// The sync is best-effort
 						} else {
-							logger.Info("[Subscription] External subscriptions sync completed successfully")
+							logger.InfoContext(r.Context(), "[Subscription] External subscriptions sync completed successfully")
 
 							// Re-read the subscription file after sync to get updated nodes
 							updatedData, err := os.ReadFile(resolvedPath)
 							if err != nil {
-								logger.Info("[Subscription] 同步后重新读取订阅文件失败", "error", err)
+								logger.InfoContext(r.Context(), "[Subscription] 同步后重新读取订阅文件失败", "error", err)
 							} else {
 								data = updatedData
-								logger.Info("[Subscription] 同步后重新读取订阅文件成功", "bytes", len(data))
+								logger.InfoContext(r.Context(), "[Subscription] 同步后重新读取订阅文件成功", "bytes", len(data))
 							}
 						}
 					}
 				}
 			} else {
-				logger.Info("[Subscription] No external subscriptions referenced in current file, skipping sync")
+				logger.InfoContext(r.Context(), "[Subscription] No external subscriptions referenced in current file, skipping sync")
 			}
 		}
 	}
-	logger.Info("[⏱️ 耗时监测] 外部订阅同步完成", "step", "external_sync", "duration_ms", time.Since(stepStart).Milliseconds())
+	logger.DebugContext(r.Context(), "[⏱️ 耗时监测] 外部订阅同步完成", "step", "external_sync", "duration_ms", time.Since(stepStart).Milliseconds())
 
 	// 流量信息收集
 	stepStart = time.Now()
@@ -442,7 +463,7 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 				var yamlConfig map[string]any
 				if err := yaml.Unmarshal(data, &yamlConfig); err == nil {
 					if proxies, ok := yamlConfig["proxies"].([]any); ok {
-						logger.Info("[Subscription] 找到订阅YAML中的代理节点", "count", len(proxies))
+						logger.InfoContext(r.Context(), "[Subscription] 找到订阅YAML中的代理节点", "count", len(proxies))
 						// 收集所有节点名称
 						usedNodeNames := make(map[string]bool)
 						for _, proxy := range proxies {
@@ -455,7 +476,7 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 
 						// 如果有节点名称，从数据库查询这些节点
 						if len(usedNodeNames) > 0 {
-							logger.Info("[Subscription] 查询数据库中的节点", "count", len(usedNodeNames))
+							logger.InfoContext(r.Context(), "[Subscription] 查询数据库中的节点", "count", len(usedNodeNames))
 							nodes, err := h.repo.ListNodes(r.Context(), username)
 							if err == nil {
 								// 收集使用到的外部订阅名称（通过 tag 识别）
@@ -472,15 +493,15 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 												usedProbeServers = make(map[string]struct{})
 											}
 											usedProbeServers[node.ProbeServer] = struct{}{}
-											logger.Info("[Subscription] 检测到探针节点绑定服务器", "node_name", node.NodeName, "probe_server", node.ProbeServer)
+											logger.InfoContext(r.Context(), "[Subscription] 检测到探针节点绑定服务器", "node_name", node.NodeName, "probe_server", node.ProbeServer)
 										}
 
 										// 如果开启了流量同步，收集外部订阅节点
 										if settings.SyncTraffic {
 											// 如果 tag 不是默认值，说明是外部订阅节点
-											if node.Tag != "" && node.Tag != "手动输入" {
+											if node.Tag != "" && node.Tag != storage.DefaultNodeTag {
 												usedExternalSubs[node.Tag] = true
-												logger.Info("[Subscription] 节点来自外部订阅", "node_name", node.NodeName, "tag", node.Tag)
+												logger.InfoContext(r.Context(), "[Subscription] 节点来自外部订阅", "node_name", node.NodeName, "tag", node.Tag)
 											}
 										}
 									}
@@ -488,7 +509,7 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 
 								// 如果开启了流量同步且有使用到外部订阅的节点，汇总这些订阅的流量
 								if settings.SyncTraffic && len(usedExternalSubs) > 0 {
-									logger.Info("[Subscription] 用户启用流量同步，找到使用中的外部订阅", "user", username, "count", len(usedExternalSubs), "tags", getKeys(usedExternalSubs))
+									logger.InfoContext(r.Context(), "[Subscription] 用户启用流量同步，找到使用中的外部订阅", "user", username, "count", len(usedExternalSubs), "tags", getKeys(usedExternalSubs))
 									externalSubs, err := h.repo.ListExternalSubscriptions(r.Context(), username)
 									if err == nil {
 										now := time.Now()
@@ -498,13 +519,13 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 												// 如果有过期时间且已过期，则跳过
 												// 如果过期时间为空，表示长期订阅，不跳过
 												if sub.Expire != nil && sub.Expire.Before(now) {
-													logger.Info("[Subscription] 跳过已过期的外部订阅", "name", sub.Name, "expire", sub.Expire.Format("2006-01-02 15:04:05"))
+													logger.InfoContext(r.Context(), "[Subscription] 跳过已过期的外部订阅", "name", sub.Name, "expire", sub.Expire.Format("2006-01-02 15:04:05"))
 													continue
 												}
 												if sub.Expire == nil {
-													logger.Info("[Subscription] 添加长期外部订阅流量", "name", sub.Name, "upload", sub.Upload, "download", sub.Download, "total", sub.Total, "mode", sub.TrafficMode)
+													logger.InfoContext(r.Context(), "[Subscription] 添加长期外部订阅流量", "name", sub.Name, "upload", sub.Upload, "download", sub.Download, "total", sub.Total, "mode", sub.TrafficMode)
 												} else {
-													logger.Info("[Subscription] 添加外部订阅流量", "name", sub.Name, "upload", sub.Upload, "download", sub.Download, "total", sub.Total, "mode", sub.TrafficMode, "expire", sub.Expire.Format("2006-01-02 15:04:05"))
+													logger.InfoContext(r.Context(), "[Subscription] 添加外部订阅流量", "name", sub.Name, "upload", sub.Upload, "download", sub.Download, "total", sub.Total, "mode", sub.TrafficMode, "expire", sub.Expire.Format("2006-01-02 15:04:05"))
 												}
 												externalTrafficLimit += sub.Total
 												// 根据 TrafficMode 计算已用流量
@@ -518,15 +539,15 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 												}
 											}
 										}
-										logger.Info("[Subscription] 外部订阅流量汇总", "limit_bytes", externalTrafficLimit, "limit_gb", float64(externalTrafficLimit)/(1024*1024*1024), "used_bytes", externalTrafficUsed, "used_gb", float64(externalTrafficUsed)/(1024*1024*1024))
+										logger.InfoContext(r.Context(), "[Subscription] 外部订阅流量汇总", "limit_bytes", externalTrafficLimit, "limit_gb", float64(externalTrafficLimit)/(1024*1024*1024), "used_bytes", externalTrafficUsed, "used_gb", float64(externalTrafficUsed)/(1024*1024*1024))
 									} else {
-										logger.Info("[Subscription] 获取外部订阅列表失败", "error", err)
+										logger.InfoContext(r.Context(), "[Subscription] 获取外部订阅列表失败", "error", err)
 									}
 								} else if settings.SyncTraffic {
-									logger.Info("[Subscription] 用户启用流量同步但未找到使用中的外部订阅节点", "user", username)
+									logger.InfoContext(r.Context(), "[Subscription] 用户启用流量同步但未找到使用中的外部订阅节点", "user", username)
 								}
 							} else {
-								logger.Info("[Subscription] 获取节点列表失败", "error", err)
+								logger.InfoContext(r.Context(), "[Subscription] 获取节点列表失败", "error", err)
 							}
 						}
 					}
@@ -534,7 +555,7 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 			}
 		}
 	}
-	logger.Info("[⏱️ 耗时监测] 流量信息收集完成", "step", "traffic_info", "duration_ms", time.Since(stepStart).Milliseconds())
+	logger.DebugContext(r.Context(), "[⏱️ 耗时监测] 流量信息收集完成", "step", "traffic_info", "duration_ms", time.Since(stepStart).Milliseconds())
 
 	// 节点排序
 	stepStart = time.Now()
@@ -544,7 +565,7 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		settings, err := h.repo.GetUserSettings(r.Context(), username)
 		if err == nil {
 			nodeOrder = settings.NodeOrder
-			logger.Info("[Subscription] 用户节点排序配置", "user", username, "node_count", len(nodeOrder))
+			logger.InfoContext(r.Context(), "[Subscription] 用户节点排序配置", "user", username, "node_count", len(nodeOrder))
 		}
 	}
 
@@ -561,10 +582,10 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 						proxiesNode := rootMap.Content[i+1]
 						if proxiesNode.Kind == yaml.SequenceNode {
 							if err := sortProxiesByNodeOrder(r.Context(), h.repo, username, proxiesNode, nodeOrder); err != nil {
-								logger.Info("[Subscription] 转换前按节点顺序排序失败", "error", err)
+								logger.InfoContext(r.Context(), "[Subscription] 转换前按节点顺序排序失败", "error", err)
 							} else {
 								shouldRewrite = true
-								logger.Info("[Subscription] Successfully sorted proxies by node order before conversion")
+								logger.InfoContext(r.Context(), "[Subscription] Successfully sorted proxies by node order before conversion")
 							}
 						}
 						break
@@ -577,17 +598,84 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 				if reorderedData, err := MarshalYAMLWithIndent(&yamlNode); err == nil {
 					fixed := RemoveUnicodeEscapeQuotes(string(reorderedData))
 					data = []byte(fixed)
-					logger.Info("[Subscription] Rewrote YAML data with sorted proxies")
+					logger.InfoContext(r.Context(), "[Subscription] Rewrote YAML data with sorted proxies")
 				}
 			}
 		}
 	}
-	logger.Info("[⏱️ 耗时监测] 节点排序完成", "step", "node_order", "duration_ms", time.Since(stepStart).Milliseconds())
+	logger.DebugContext(r.Context(), "[⏱️ 耗时监测] 节点排序完成", "step", "node_order", "duration_ms", time.Since(stepStart).Milliseconds())
+
+	// 试用账号只下发排序后的前几个节点
+	trial, isTrial := lookupTrialAccount(r.Context(), h.repo, username)
+	if isTrial && trial.MaxNodes > 0 {
+		if limited, err := limitTrialProxies(data, trial.MaxNodes); err != nil {
+			logger.WarnContext(r.Context(), "[Subscription] 限制试用账号节点数失败", "user", username, "error", err)
+		} else {
+			data = limited
+		}
+	}
+
+	// 流量统计获取
+	stepStart = time.Now()
+	// 尝试获取流量信息，如果探针报错则跳过流量统计，不影响订阅输出
+	// 如果开启了探针绑定，只统计订阅文件中使用的节点绑定的探针服务器流量
+	totalLimit, _, totalUsed, err := h.summary.fetchTotals(r.Context(), username, usedProbeServers)
+	hasTrafficInfo := err == nil
+	logger.DebugContext(r.Context(), "[⏱️ 耗时监测] 流量统计获取完成", "step", "traffic_fetch", "duration_ms", time.Since(stepStart).Milliseconds())
+
+	// 判断是否需要包含探针流量：
+	// 1. 探针服务器绑定关闭时，始终包含探针流量
+	// 2. 探针服务器绑定开启时，只有使用了探针节点才包含探针流量
+	includeProbeTraffic := !probeBindingEnabled || usesProbeNodes
+	finalLimit, finalUsed := externalTrafficLimit, externalTrafficUsed
+	if includeProbeTraffic && hasTrafficInfo {
+		finalLimit = totalLimit + externalTrafficLimit
+		finalUsed = totalUsed + externalTrafficUsed
+	}
+	var expireAt *time.Time
+	if hasSubscribeFile {
+		expireAt = subscribeFile.ExpireAt
+	}
+	// 试用账号按试用配额和账号到期时间展示；面板没有按账号统计的流量，已用流量不计入
+	trialQuota := isTrial && trial.TrafficQuota > 0
+	if isTrial {
+		if trialQuota {
+			finalLimit, finalUsed = trial.TrafficQuota, 0
+		}
+		if expireAt == nil || trial.ExpiresAt.Before(*expireAt) {
+			expireAt = &trial.ExpiresAt
+		}
+	}
+
+	// 用户选择英文配置时按词典翻译代理组名称与提示节点，为 nil 表示保持中文
+	languageDict := h.configLanguageDictionary(r.Context(), username)
+
+	// 流量即将用尽或套餐即将到期时，在节点列表顶部插入提示节点（转换前插入，所有客户端格式都能看到）
+	if warnings := h.subscriptionWarnings(r.Context(), finalLimit, finalUsed, expireAt, languageDict); len(warnings) > 0 {
+		if injected, err := injectWarningNodes(data, warnings); err != nil {
+			logger.WarnContext(r.Context(), "[Subscription] 插入提示节点失败", "error", err)
+		} else {
+			data = injected
+		}
+	}
+
+	// 代理组名称翻译同样在转换前进行，所有客户端格式一致
+	if languageDict != nil {
+		if translated, err := translateConfigGroupNames(data, languageDict); err != nil {
+			logger.WarnContext(r.Context(), "[Subscription] 翻译代理组名称失败", "error", err)
+		} else {
+			data = translated
+		}
+	}
 
 	// 格式转换
 	stepStart = time.Now()
 	// 根据参数t的类型调用substore的转换代码
 	clientType := strings.TrimSpace(r.URL.Query().Get("t"))
+	// 未指定 t 时使用订阅文件声明的默认转换类型
+	if clientType == "" && hasSubscribeFile {
+		clientType = subscribeFile.DefaultTarget
+	}
 	// 默认浏览器打开时直接输入文本, 不再下载问卷
 	contentType := "text/yaml; charset=utf-8; charset=UTF-8"
 	ext := filepath.Ext(filename)
@@ -598,46 +686,24 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	// clash 和 clashmeta 类型直接输出源文件, 不需要转换
 	if clientType != "" && clientType != "clash" && clientType != "clashmeta" {
 		// Convert subscription using substore producers
-		convertedData, err := h.convertSubscription(r.Context(), data, clientType)
+		convertedData, warnings, err := h.convertSubscriptionCached(withSubscriptionURL(r.Context(), subscriptionProviderURL(r)), filename, data, clientType)
 		if err != nil {
 			writeError(w, http.StatusBadRequest, fmt.Errorf("failed to convert subscription for client %s: %w", clientType, err))
 			return
 		}
 		data = convertedData
-
-		// Set content type and extension based on client type
-		switch clientType {
-		case "surge", "surgemac", "loon", "qx", "surfboard", "shadowrocket", "clash-to-surge":
-			// Text-based formats
-			contentType = "text/plain; charset=utf-8"
-			ext = ".txt"
-		case "sing-box":
-			// JSON format
-			contentType = "application/json; charset=utf-8"
-			ext = ".json"
-		case "v2ray":
-			// Base64 format
-			contentType = "text/plain; charset=utf-8"
-			ext = ".txt"
-		case "uri":
-			// URI format
-			contentType = "text/plain; charset=utf-8"
-			ext = ".txt"
-		default:
-			// YAML-based formats (clash, clashmeta, stash, shadowrocket, egern)
-			contentType = "text/yaml; charset=utf-8"
-			ext = ".yaml"
+		if len(warnings) > 0 {
+			logger.InfoContext(r.Context(), "[Subscription] 部分节点无法转换，已跳过", "client_type", clientType, "count", len(warnings))
+			setConversionWarningHeaders(w, warnings)
 		}
 	}
-	logger.Info("[⏱️ 耗时监测] 格式转换完成", "step", "format_convert", "duration_ms", time.Since(stepStart).Milliseconds(), "client_type", clientType)
-
-	// 流量统计获取
-	stepStart = time.Now()
-	// 尝试获取流量信息，如果探针报错则跳过流量统计，不影响订阅输出
-	// 如果开启了探针绑定，只统计订阅文件中使用的节点绑定的探针服务器流量
-	totalLimit, _, totalUsed, err := h.summary.fetchTotals(r.Context(), username, usedProbeServers)
-	hasTrafficInfo := err == nil
-	logger.Info("[⏱️ 耗时监测] 流量统计获取完成", "step", "traffic_fetch", "duration_ms", time.Since(stepStart).Milliseconds())
+	if clientType != "" {
+		// 根据转换目标在 producer 注册表中的格式（含系统配置中的覆盖）设置 content type 和扩展名
+		format := substore.GetDefaultFactory().GetOutputFormat(clientType)
+		contentType = format.ContentType
+		ext = format.Extension
+	}
+	logger.DebugContext(r.Context(), "[⏱️ 耗时监测] 格式转换完成", "step", "format_convert", "duration_ms", time.Since(stepStart).Milliseconds(), "client_type", clientType)
 
 	// 使用订阅名称
 	attachmentName := url.PathEscape(displayName)
@@ -646,7 +712,7 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	stepStart = time.Now()
 	// 对于 YAML 格式的数据，重新排序以将 rule-providers 放在最后
 	// 注意：节点排序已经在转换之前完成，这里只处理其他的YAML重排需求
-	if contentType == "text/yaml; charset=utf-8" || contentType == "text/yaml; charset=utf-8; charset=UTF-8" {
+	if isYAMLContentType(contentType) {
 		// 使用 yaml.Node 来保持原始类型信息（避免 563905e2 被解析为科学计数法）
 		var yamlNode yaml.Node
 		if err := yaml.Unmarshal(data, &yamlNode); err == nil {
@@ -703,6 +769,19 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 					// 添加到最后
 					rootMap.Content = append(rootMap.Content, keyNode, valueNode)
 				}
+
+				// 离线模式下规则集与地理数据库改为从面板自身下载；开启地理数据托管时 geox-url 指向面板托管的文件，
+				// 开启规则集缓存代理时其余远程地址改为面板的缓存地址
+				if IsAirGappedMode() {
+					rewriteAirGappedURLs(rootMap, panelBaseURL(r))
+				} else if systemConfig, err := h.repo.GetSystemConfig(r.Context()); err == nil {
+					if systemConfig.GeoDataInterval > 0 {
+						rewriteGeoDataURLs(r.Context(), h.repo, rootMap, panelBaseURL(r))
+					}
+					if systemConfig.RuleCacheProxy {
+						rewriteRuleCacheURLs(r.Context(), h.repo, rootMap, panelBaseURL(r))
+					}
+				}
 			}
 
 			// 重新序列化为 YAML (使用2空格缩进)
@@ -713,41 +792,26 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 			}
 		}
 	}
-	logger.Info("[⏱️ 耗时监测] YAML 重排序完成", "step", "yaml_reorder", "duration_ms", time.Since(stepStart).Milliseconds())
+	logger.DebugContext(r.Context(), "[⏱️ 耗时监测] YAML 重排序完成", "step", "yaml_reorder", "duration_ms", time.Since(stepStart).Milliseconds())
 
 	w.Header().Set("Content-Type", contentType)
 	// 只有在有流量信息时才添加 subscription-userinfo 头
-	if hasTrafficInfo || externalTrafficLimit > 0 {
-		var finalLimit, finalUsed int64
-
-		// 判断是否需要包含探针流量：
-		// 1. 探针服务器绑定关闭时，始终包含探针流量
-		// 2. 探针服务器绑定开启时，只有使用了探针节点才包含探针流量
-		includeProbeTraffic := !probeBindingEnabled || usesProbeNodes
-
+	if hasTrafficInfo || externalTrafficLimit > 0 || trialQuota {
 		if includeProbeTraffic && hasTrafficInfo {
-			finalLimit = totalLimit + externalTrafficLimit
-			finalUsed = totalUsed + externalTrafficUsed
-			logger.Info("[Subscription] 最终流量统计", "user", username)
-			logger.Info("[Subscription] 探针流量", "limit_bytes", totalLimit, "limit_gb", float64(totalLimit)/(1024*1024*1024), "used_bytes", totalUsed, "used_gb", float64(totalUsed)/(1024*1024*1024))
+			logger.InfoContext(r.Context(), "[Subscription] 最终流量统计", "user", username)
+			logger.InfoContext(r.Context(), "[Subscription] 探针流量", "limit_bytes", totalLimit, "limit_gb", float64(totalLimit)/(1024*1024*1024), "used_bytes", totalUsed, "used_gb", float64(totalUsed)/(1024*1024*1024))
 		} else {
 			// 仅统计外部订阅流量
-			finalLimit = externalTrafficLimit
-			finalUsed = externalTrafficUsed
-			logger.Info("[Subscription] 最终流量统计(仅外部订阅)", "user", username)
-			logger.Info("[Subscription] 探针流量未包含(探针绑定已开启但未使用探针节点)")
+			logger.InfoContext(r.Context(), "[Subscription] 最终流量统计(仅外部订阅)", "user", username)
+			logger.InfoContext(r.Context(), "[Subscription] 探针流量未包含(探针绑定已开启但未使用探针节点)")
 		}
 
-		logger.Info("[Subscription] 外部订阅流量", "limit_bytes", externalTrafficLimit, "limit_gb", float64(externalTrafficLimit)/(1024*1024*1024), "used_bytes", externalTrafficUsed, "used_gb", float64(externalTrafficUsed)/(1024*1024*1024))
-		logger.Info("[Subscription] 总流量", "limit_bytes", finalLimit, "limit_gb", float64(finalLimit)/(1024*1024*1024), "used_bytes", finalUsed, "used_gb", float64(finalUsed)/(1024*1024*1024))
+		logger.InfoContext(r.Context(), "[Subscription] 外部订阅流量", "limit_bytes", externalTrafficLimit, "limit_gb", float64(externalTrafficLimit)/(1024*1024*1024), "used_bytes", externalTrafficUsed, "used_gb", float64(externalTrafficUsed)/(1024*1024*1024))
+		logger.InfoContext(r.Context(), "[Subscription] 总流量", "limit_bytes", finalLimit, "limit_gb", float64(finalLimit)/(1024*1024*1024), "used_bytes", finalUsed, "used_gb", float64(finalUsed)/(1024*1024*1024))
 
-		var expireAt *time.Time
-		if hasSubscribeFile {
-			expireAt = subscribeFile.ExpireAt
-		}
 		headerValue := buildSubscriptionHeader(finalLimit, finalUsed, expireAt)
 		w.Header().Set("subscription-userinfo", headerValue)
-		logger.Info("[Subscription] 设置订阅用户信息头", "header", headerValue)
+		logger.InfoContext(r.Context(), "[Subscription] 设置订阅用户信息头", "header", headerValue)
 	}
 	w.Header().Set("profile-update-interval", "24")
 	// 只有非浏览器访问时才添加 content-disposition 头（避免浏览器直接下载）
@@ -756,12 +820,23 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	if !isBrowser {
 		w.Header().Set("content-disposition", "attachment;filename*=UTF-8''"+attachmentName)
 	}
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write(data)
+	data = h.signSubscription(r.Context(), w, data, contentType)
+	cacheControl := ""
+	if hasSubscribeFile {
+		cacheControl = subscribeFile.CacheControl
+		w.Header().Set("Cache-Tag", subscriptionCacheTag(filename))
+	}
+	if r.Method == http.MethodGet {
+		archiveServedSubscription(r.Context(), h.repo, username, filename, clientType, data)
+		recordSubscriptionPull(r.Context(), h.repo, username, filename, clientType)
+		recordSubscriptionClientIP(r.Context(), h.repo, username, getClientIP(r))
+	}
+	serveSubscriptionContent(w, r, data, cacheControl)
 
 	// 📥 订阅获取日志 - 方便管理员搜索和追踪
-	logger.Info("📥📥📥 [SUB_FETCH] 用户获取订阅",
+	logger.InfoContext(r.Context(), "📥📥📥 [SUB_FETCH] 用户获取订阅",
 		"user", username,
+		"method", r.Method,
 		"subscription", displayName,
 		"filename", filename,
 		"client_type", clientType,
@@ -774,7 +849,19 @@ func (h *SubscriptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		silentMgr.RecordSubscriptionAccessWithIP(username, getClientIP(r))
 	}
 
-	logger.Info("[⏱️ 耗时监测] 请求处理完成", "total_duration_ms", time.Since(requestStart).Milliseconds(), "username", username, "filename", filename)
+	if r.Method != http.MethodHead {
+		emitWebhookEvent(WebhookEventSubscriptionPulled, map[string]any{
+			"username":     username,
+			"subscription": displayName,
+			"filename":     filename,
+			"client_type":  clientType,
+			"ip":           getClientIP(r),
+			"user_agent":   userAgent,
+			"bytes":        len(data),
+		})
+	}
+
+	logger.DebugContext(r.Context(), "[⏱️ 耗时监测] 请求处理完成", "total_duration_ms", time.Since(requestStart).Milliseconds(), "username", username, "filename", filename)
 }
 
 func (h *SubscriptionHandler) resolveSubscription(ctx context.Context, name string) (storage.SubscriptionLink, error) {
@@ -871,7 +958,7 @@ func GetExternalSubscriptionsFromFile(ctx context.Context, data []byte, username
 						logger.Info("[Subscription] 从节点找到外部订阅URL", "node_name", node.NodeName, "url", node.RawURL)
 					}
 					// 如果节点有 Tag（外部订阅名称），记录下来
-					if node.Tag != "" && node.Tag != "手动输入" {
+					if node.Tag != "" && node.Tag != storage.DefaultNodeTag {
 						usedTags[node.Tag] = true
 						logger.Info("[Subscription] 节点来自外部订阅", "node_name", node.NodeName, "tag", node.Tag)
 					}
@@ -1050,6 +1137,7 @@ func syncReferencedExternalSubscriptions(ctx context.Context, repo *storage.Traf
 		nodeCount, updatedSub, err := syncSingleExternalSubscription(ctx, client, repo, subscribeDir, username, sub, userSettings)
 		if err != nil {
 			logger.Info("[⏱️ 耗时监测] 同步订阅失败", "name", sub.Name, "url", sub.URL, "error", err, "duration_ms", time.Since(subSyncStart).Milliseconds())
+			notifyExternalSyncFailure(ctx, repo, username, sub, err)
 			continue
 		}
 
@@ -1134,7 +1222,7 @@ func (h *SubscriptionHandler) serveTokenInvalidResponse(w http.ResponseWriter, r
 
 	// 如果指定了客户端类型且不是clash/clashmeta，进行转换
 	if clientType != "" && clientType != "clash" && clientType != "clashmeta" {
-		convertedData, err := h.convertSubscription(r.Context(), data, clientType)
+		convertedData, _, err := h.convertSubscription(r.Context(), data, clientType)
 		if err != nil {
 			// 转换失败，记录日志但继续返回YAML
 			logger.Info("[Token Invalid] 转换失败", "client_type", clientType, "error", err)
@@ -1142,20 +1230,9 @@ func (h *SubscriptionHandler) serveTokenInvalidResponse(w http.ResponseWriter, r
 			data = convertedData
 
 			// 根据客户端类型设置content type和扩展名
-			switch clientType {
-			case "surge", "surgemac", "loon", "qx", "surfboard", "shadowrocket", "clash-to-surge":
-				contentType = "text/plain; charset=utf-8"
-				ext = ".txt"
-			case "sing-box":
-				contentType = "application/json; charset=utf-8"
-				ext = ".json"
-			case "v2ray", "uri":
-				contentType = "text/plain; charset=utf-8"
-				ext = ".txt"
-			default:
-				contentType = "text/yaml; charset=utf-8"
-				ext = ".yaml"
-			}
+			format := substore.GetDefaultFactory().GetOutputFormat(clientType)
+			contentType = format.ContentType
+			ext = format.Extension
 		}
 	}
 
@@ -1166,54 +1243,81 @@ func (h *SubscriptionHandler) serveTokenInvalidResponse(w http.ResponseWriter, r
 	if clientType == "" {
 		w.Header().Set("content-disposition", "attachment;filename*=UTF-8''"+attachmentName)
 	}
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write(data)
+	serveSubscriptionContent(w, r, data, "")
 
 	// ⚠️ Token失效日志 - 方便管理员追踪无效访问
 	logger.Info("⚠️⚠️⚠️ [SUB_INVALID] Token失效或过期访问", "client_type", clientType)
 }
 
+type subscriptionURLKey struct{}
+
+// withSubscriptionURL 记录当前订阅的访问地址，供 mihomo-provider 等引用面板订阅作为 proxy-provider 的转换使用
+func withSubscriptionURL(ctx context.Context, subscriptionURL string) context.Context {
+	return context.WithValue(ctx, subscriptionURLKey{}, subscriptionURL)
+}
+
+func subscriptionURLFrom(ctx context.Context) string {
+	subscriptionURL, _ := ctx.Value(subscriptionURLKey{}).(string)
+	return subscriptionURL
+}
+
+// subscriptionProviderURL 返回当前订阅以 Clash Meta 格式输出的地址，作为 proxy-provider 的拉取地址。
+// 显式指定 t=clashmeta，避免订阅文件默认转换类型为 mihomo-provider 时 provider 拉到的仍是不含节点的配置
+func subscriptionProviderURL(r *http.Request) string {
+	query := r.URL.Query()
+	query.Set("t", "clashmeta")
+	return panelBaseURL(r) + r.URL.Path + "?" + query.Encode()
+}
+
 // convertSubscription converts a YAML subscription file to the specified client format
-func (h *SubscriptionHandler) convertSubscription(ctx context.Context, yamlData []byte, clientType string) ([]byte, error) {
+// 返回的 warnings 列出因目标客户端不支持而被跳过的节点，其余节点仍正常输出
+func (h *SubscriptionHandler) convertSubscription(ctx context.Context, yamlData []byte, clientType string) ([]byte, []substore.ConversionWarning, error) {
 	// 使用 yaml.Node 解析, 解决值前导零的问题
 	var rootNode yaml.Node
 	if err := yaml.Unmarshal(yamlData, &rootNode); err != nil {
-		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+		return nil, nil, fmt.Errorf("failed to parse YAML: %w", err)
 	}
 
 	config, err := yamlNodeToMap(&rootNode)
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert YAML node: %w", err)
+		return nil, nil, fmt.Errorf("failed to convert YAML node: %w", err)
 	}
 
 	// 读取yaml中proxies属性的节点列表
 	proxiesRaw, ok := config["proxies"]
 	if !ok {
-		return nil, errors.New("no 'proxies' field found in YAML")
+		return nil, nil, errors.New("no 'proxies' field found in YAML")
 	}
 
 	proxiesArray, ok := proxiesRaw.([]interface{})
 	if !ok {
-		return nil, errors.New("'proxies' field is not an array")
+		return nil, nil, errors.New("'proxies' field is not an array")
 	}
 
 	// 转换成substore的Proxy结构
 	var proxies []substore.Proxy
-	for _, p := range proxiesArray {
+	var warnings []substore.ConversionWarning
+	for i, p := range proxiesArray {
 		proxyMap, ok := p.(map[string]interface{})
 		if !ok {
+			warnings = append(warnings, substore.ConversionWarning{
+				Name:   fmt.Sprintf("#%d", i+1),
+				Reason: "invalid proxy entry",
+			})
 			continue
 		}
 		proxies = append(proxies, substore.Proxy(proxyMap))
 	}
 
 	if len(proxies) == 0 {
-		return nil, errors.New("no valid proxies found in YAML")
+		return nil, nil, errors.New("no valid proxies found in YAML")
 	}
 
-	// clash-to-surge 类型使用 BuildCompleteSurgeConfig 生成完整的 Surge 配置
+	// clash-to-surge 类型始终生成完整的 Surge 配置（[General] / [Proxy Group] / [Rule]）
 	if clientType == "clash-to-surge" {
-		return h.convertClashToSurge(config, proxies)
+		opts := &substore.ProduceOptions{}
+		profile := substore.BuildSurgeProfile(proxies, config, opts)
+		return []byte(profile), append(warnings, opts.Warnings...), nil
 	}
 
 	factory := substore.GetDefaultFactory()
@@ -1221,7 +1325,7 @@ func (h *SubscriptionHandler) convertSubscription(ctx context.Context, yamlData
 	// 根据客户端类型获取Producer
 	producer, err := factory.GetProducer(clientType)
 	if err != nil {
-		return nil, fmt.Errorf("unsupported client type '%s': %w", clientType, err)
+		return nil, nil, fmt.Errorf("unsupported client type '%s': %w", clientType, err)
 	}
 
 	// 调用Produce方法生成转换后的节点, 传入完整配置供需要的 Producer 使用（如 Stash）
@@ -1230,150 +1334,21 @@ func (h *SubscriptionHandler) convertSubscription(ctx context.Context, yamlData
 	opts := &substore.ProduceOptions{
 		FullConfig:              config,
 		ClientCompatibilityMode: systemConfig.ClientCompatibilityMode,
+		ProviderURL:             subscriptionURLFrom(ctx),
 	}
 	result, err := producer.Produce(proxies, "", opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to produce subscription: %w", err)
+		return nil, nil, fmt.Errorf("failed to produce subscription: %w", err)
 	}
+	warnings = append(warnings, opts.Warnings...)
 	switch v := result.(type) {
 	case string:
-		return []byte(v), nil
+		return []byte(v), warnings, nil
 	case []byte:
-		return v, nil
+		return v, warnings, nil
 	default:
-		return nil, fmt.Errorf("unexpected result type from producer: %T, expected string or []byte", result)
-	}
-}
-
-// convertClashToSurge converts Clash config to Surge format with rules
-func (h *SubscriptionHandler) convertClashToSurge(config map[string]interface{}, proxies []substore.Proxy) ([]byte, error) {
-	// 解析 Clash 配置结构
-	clashConfig := &substore.ClashConfig{}
-
-	// 解析基本字段
-	if port, ok := config["port"].(int); ok {
-		clashConfig.Port = port
-	}
-	if socksPort, ok := config["socks-port"].(int); ok {
-		clashConfig.SocksPort = socksPort
-	}
-	if allowLan, ok := config["allow-lan"].(bool); ok {
-		clashConfig.AllowLan = allowLan
-	}
-	if mode, ok := config["mode"].(string); ok {
-		clashConfig.Mode = mode
-	}
-	if logLevel, ok := config["log-level"].(string); ok {
-		clashConfig.LogLevel = logLevel
-	}
-	if externalController, ok := config["external-controller"].(string); ok {
-		clashConfig.ExternalController = externalController
-	}
-
-	// 解析 DNS 配置
-	if dnsRaw, ok := config["dns"].(map[string]interface{}); ok {
-		if enable, ok := dnsRaw["enable"].(bool); ok {
-			clashConfig.DNS.Enable = enable
-		}
-		if ipv6, ok := dnsRaw["ipv6"].(bool); ok {
-			clashConfig.DNS.IPv6 = ipv6
-		}
-		if enhancedMode, ok := dnsRaw["enhanced-mode"].(string); ok {
-			clashConfig.DNS.EnhancedMode = enhancedMode
-		}
-		if nameservers, ok := dnsRaw["nameserver"].([]interface{}); ok {
-			for _, ns := range nameservers {
-				if nsStr, ok := ns.(string); ok {
-					clashConfig.DNS.Nameserver = append(clashConfig.DNS.Nameserver, nsStr)
-				}
-			}
-		}
-		if defaultNS, ok := dnsRaw["default-nameserver"].([]interface{}); ok {
-			for _, ns := range defaultNS {
-				if nsStr, ok := ns.(string); ok {
-					clashConfig.DNS.DefaultNameserver = append(clashConfig.DNS.DefaultNameserver, nsStr)
-				}
-			}
-		}
+		return nil, nil, fmt.Errorf("unexpected result type from producer: %T, expected string or []byte", result)
 	}
-
-	// 解析 proxy-groups
-	if groupsRaw, ok := config["proxy-groups"].([]interface{}); ok {
-		for _, g := range groupsRaw {
-			if gMap, ok := g.(map[string]interface{}); ok {
-				group := substore.ClashProxyGroup{}
-				if name, ok := gMap["name"].(string); ok {
-					group.Name = name
-				}
-				if gType, ok := gMap["type"].(string); ok {
-					group.Type = gType
-				}
-				if url, ok := gMap["url"].(string); ok {
-					group.URL = url
-				}
-				if interval, ok := gMap["interval"].(int); ok {
-					group.Interval = interval
-				}
-				if tolerance, ok := gMap["tolerance"].(int); ok {
-					group.Tolerance = tolerance
-				}
-				if proxiesArr, ok := gMap["proxies"].([]interface{}); ok {
-					for _, p := range proxiesArr {
-						if pStr, ok := p.(string); ok {
-							group.Proxies = append(group.Proxies, pStr)
-						}
-					}
-				}
-				clashConfig.ProxyGroups = append(clashConfig.ProxyGroups, group)
-			}
-		}
-	}
-
-	// 解析 rules
-	if rulesRaw, ok := config["rules"].([]interface{}); ok {
-		for _, r := range rulesRaw {
-			if rStr, ok := r.(string); ok {
-				clashConfig.Rules = append(clashConfig.Rules, rStr)
-			}
-		}
-	}
-
-	// 解析 rule-providers
-	if providersRaw, ok := config["rule-providers"].(map[string]interface{}); ok {
-		clashConfig.RuleProviders = make(map[string]substore.ClashRuleProvider)
-		for name, p := range providersRaw {
-			if pMap, ok := p.(map[string]interface{}); ok {
-				provider := substore.ClashRuleProvider{}
-				if pType, ok := pMap["type"].(string); ok {
-					provider.Type = pType
-				}
-				if behavior, ok := pMap["behavior"].(string); ok {
-					provider.Behavior = behavior
-				}
-				if url, ok := pMap["url"].(string); ok {
-					provider.URL = url
-				}
-				if path, ok := pMap["path"].(string); ok {
-					provider.Path = path
-				}
-				if interval, ok := pMap["interval"].(int); ok {
-					provider.Interval = interval
-				}
-				if format, ok := pMap["format"].(string); ok {
-					provider.Format = format
-				}
-				clashConfig.RuleProviders[name] = provider
-			}
-		}
-	}
-
-	// 使用 BuildCompleteSurgeConfig 生成完整 Surge 配置
-	surgeConfig, err := substore.BuildCompleteSurgeConfig(clashConfig, proxies, nil, false)
-	if err != nil {
-		return nil, fmt.Errorf("failed to build Surge config: %w", err)
-	}
-
-	return []byte(surgeConfig), nil
 }
 
 // fixWireGuardAllowedIPs fixes allowed-ips field type for WireGuard nodes
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// isSubscriptionRead 订阅接口接受 GET 和 HEAD（客户端用 HEAD 检查更新和大小）
+func isSubscriptionRead(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// subscriptionETag 根据生成的订阅内容计算强 ETag，内容不变时 ETag 不变
+func subscriptionETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// serveSubscriptionContent writes the generated subscription with an ETag. HEAD requests get the
+// headers only (including Content-Length), If-None-Match yields 304 and Range/If-Range requests
+// get partial content so large configs can be resumed on unreliable connections.
+// Headers such as Content-Type must be set before calling. cacheControl is the per-file
+// Cache-Control setting; empty means no-cache.
+func serveSubscriptionContent(w http.ResponseWriter, r *http.Request, data []byte, cacheControl string) {
+	w.Header().Set("ETag", subscriptionETag(data))
+	// 默认内容随流量、节点实时生成，客户端需要每次重新校验；放在 CDN 后时可按文件配置缓存
+	if cacheControl == "" {
+		cacheControl = defaultSubscriptionCacheControl
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+// 订阅长时间未拉取提醒：根据 subscription_pulls 中的拉取统计，找出此前几乎每天都会拉取、
+// 但最近 N 天一次都没有拉取的订阅（多半是客户端失效或用户已不再使用），通知管理员
+const (
+	stalePullBaselineDays  = 14 // 判断是否"每天拉取"的观察期天数，紧接在未拉取的 N 天之前
+	stalePullMinActiveDays = 10 // 观察期内至少这么多天有拉取才视为每天拉取
+	defaultStalePullDays   = 3  // 未开启提醒时列表接口默认使用的天数
+	maxStalePullDays       = 90 // 与系统设置 stale_pull_days 的上限一致
+)
+
+type staleSubscriptionEntry struct {
+	Username   string    `json:"username"`
+	Filename   string    `json:"filename"`
+	LastPullAt time.Time `json:"last_pull_at"`
+	ActiveDays int       `json:"active_days"` // 观察期内有拉取的天数
+	IdleDays   int       `json:"idle_days"`   // 距最后一次拉取的天数
+}
+
+// findStaleSubscriptions 返回观察期内几乎每天拉取、但最近 days 天没有拉取的订阅，按最后拉取时间升序排列。
+// 已停用或已删除用户的订阅不在结果中
+func findStaleSubscriptions(ctx context.Context, repo *storage.TrafficRepository, days int, now time.Time) ([]staleSubscriptionEntry, error) {
+	idleSince := now.AddDate(0, 0, -days)
+	pulls, err := repo.ListSubscriptionPulls(ctx, idleSince.AddDate(0, 0, -stalePullBaselineDays), now)
+	if err != nil {
+		return nil, err
+	}
+
+	type pullStats struct {
+		last       time.Time
+		activeDays map[string]bool
+	}
+	stats := make(map[[2]string]*pullStats)
+	for _, pull := range pulls {
+		key := [2]string{pull.Username, pull.Filename}
+		s := stats[key]
+		if s == nil {
+			s = &pullStats{activeDays: make(map[string]bool)}
+			stats[key] = s
+		}
+		if pull.Hour.After(s.last) {
+			s.last = pull.Hour
+		}
+		if pull.Hour.Before(idleSince) {
+			s.activeDays[pull.Hour.Format("2006-01-02")] = true
+		}
+	}
+	if len(stats) == 0 {
+		return nil, nil
+	}
+
+	users, err := repo.ListUsers(ctx, 1000)
+	if err != nil {
+		return nil, err
+	}
+	active := make(map[string]bool, len(users))
+	for _, user := range users {
+		if user.IsActive {
+			active[user.Username] = true
+		}
+	}
+
+	var entries []staleSubscriptionEntry
+	for key, s := range stats {
+		// 拉取统计按小时聚合，最后一次拉取所在的小时结束前都不算未拉取
+		if !active[key[0]] || len(s.activeDays) < stalePullMinActiveDays || !s.last.Add(time.Hour).Before(idleSince) {
+			continue
+		}
+		entries = append(entries, staleSubscriptionEntry{
+			Username:   key[0],
+			Filename:   key[1],
+			LastPullAt: s.last,
+			ActiveDays: len(s.activeDays),
+			IdleDays:   int(now.Sub(s.last).Hours() / 24),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].LastPullAt.Equal(entries[j].LastPullAt) {
+			return entries[i].LastPullAt.Before(entries[j].LastPullAt)
+		}
+		if entries[i].Username != entries[j].Username {
+			return entries[i].Username < entries[j].Username
+		}
+		return entries[i].Filename < entries[j].Filename
+	})
+	return entries, nil
+}
+
+// NotifyStaleSubscriptions 每日检查长时间未拉取的订阅并通知管理员，同一订阅每次停止拉取只提醒一次
+func NotifyStaleSubscriptions(ctx context.Context, repo *storage.TrafficRepository) error {
+	if repo == nil {
+		return errors.New("stale subscription alerts require repository")
+	}
+
+	cfg, err := repo.GetSystemConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if cfg.StalePullDays <= 0 {
+		return nil
+	}
+
+	entries, err := findStaleSubscriptions(ctx, repo, cfg.StalePullDays, time.Now())
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	admins, err := listAdminUsernames(ctx, repo)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		title := fmt.Sprintf("用户「%s」的订阅已 %d 天未拉取", entry.Username, entry.IdleDays)
+		content := fmt.Sprintf("订阅「%s」此前 %d 天中有 %d 天被拉取，最后一次拉取于 %s，之后再无拉取记录，可能是客户端失效或用户已不再使用",
+			entry.Filename, stalePullBaselineDays, entry.ActiveDays, entry.LastPullAt.Local().Format("2006-01-02 15:04"))
+		// 以最后拉取时间去重：恢复拉取后再次中断会重新提醒
+		dedupeKey := fmt.Sprintf("stale_pull:%s:%s:%s", entry.Username, entry.Filename, entry.LastPullAt.UTC().Format("2006-01-02T15"))
+		for _, admin := range admins {
+			if notifyUser(ctx, repo, storage.Notification{
+				Username:  admin,
+				Type:      storage.NotificationTypeStalePull,
+				Title:     title,
+				Content:   content,
+				DedupeKey: dedupeKey,
+			}) {
+				logger.Info("[订阅统计] 订阅长时间未拉取", "user", entry.Username, "filename", entry.Filename, "last_pull_at", entry.LastPullAt, "admin", admin)
+			}
+		}
+	}
+	return nil
+}
+
+// NewStaleSubscriptionsHandler lists regularly pulled subscriptions that have not been fetched for
+// ?days= days (defaults to the configured stale_pull_days).
+func NewStaleSubscriptionsHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("stale subscriptions handler requires repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+
+		days := defaultStalePullDays
+		if cfg, err := repo.GetSystemConfig(r.Context()); err == nil && cfg.StalePullDays > 0 {
+			days = cfg.StalePullDays
+		}
+		if raw := strings.TrimSpace(r.URL.Query().Get("days")); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed <= 0 || parsed > maxStalePullDays {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("days 必须在 1-%d 之间", maxStalePullDays))
+				return
+			}
+			days = parsed
+		}
+
+		entries, err := findStaleSubscriptions(r.Context(), repo, days, time.Now())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if entries == nil {
+			entries = []staleSubscriptionEntry{}
+		}
+		respondJSON(w, http.StatusOK, map[string]any{
+			"days":            days,
+			"baseline_days":   stalePullBaselineDays,
+			"min_active_days": stalePullMinActiveDays,
+			"subscriptions":   entries,
+		})
+	})
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/substore"
+)
+
+// subscriptionQueryParams 订阅地址可识别的查询参数，严格模式下其余参数一律拒绝
+var subscriptionQueryParams = []string{"filename", "t", "token"}
+
+// checkSubscriptionStrictMode 严格模式下校验订阅请求的查询参数与 ?t= 转换目标，
+// 未知目标不再静默返回原始 YAML，而是返回 400 并列出支持的目标。返回 false 表示已写入错误响应
+func (h *SubscriptionHandler) checkSubscriptionStrictMode(w http.ResponseWriter, r *http.Request) bool {
+	if h.repo == nil {
+		return true
+	}
+	systemConfig, err := h.repo.GetSystemConfig(r.Context())
+	if err != nil || !systemConfig.StrictMode {
+		return true
+	}
+
+	query := r.URL.Query()
+	var unknown []string
+	for key := range query {
+		if !slices.Contains(subscriptionQueryParams, key) {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		slices.Sort(unknown)
+		logger.WarnContext(r.Context(), "[Subscription] 严格模式拒绝未知参数", "params", strings.Join(unknown, ","))
+		respondJSON(w, http.StatusBadRequest, map[string]any{
+			"error":          fmt.Sprintf("unknown query parameter(s): %s", strings.Join(unknown, ", ")),
+			"allowed_params": subscriptionQueryParams,
+		})
+		return false
+	}
+
+	// 未带 filename 的旧版链接中 t 表示订阅名称，不是转换目标
+	if strings.TrimSpace(query.Get("filename")) == "" {
+		return true
+	}
+	target := strings.TrimSpace(query.Get("t"))
+	factory := substore.GetDefaultFactory()
+	if target == "" || factory.HasOutputFormat(target) {
+		return true
+	}
+
+	supported := factory.GetSupportedTargets()
+	logger.WarnContext(r.Context(), "[Subscription] 严格模式拒绝未知转换目标", "client_type", target)
+	respondJSON(w, http.StatusBadRequest, map[string]any{
+		"error":             fmt.Sprintf("unsupported target %q, use ?t= with one of: %s", target, strings.Join(supported, ", ")),
+		"supported_targets": supported,
+	})
+	return false
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"miaomiaowu/internal/logger"
+)
+
+const quotaWarningNodeName = "⚠️ 流量即将用尽"
+
+// subscriptionWarnings 根据系统配置的阈值返回需要插入订阅的提示节点名称，dict 不为 nil 时按词典翻译
+func (h *SubscriptionHandler) subscriptionWarnings(ctx context.Context, limit, used int64, expireAt *time.Time, dict map[string]string) []string {
+	if h.repo == nil {
+		return nil
+	}
+	cfg, err := h.repo.GetSystemConfig(ctx)
+	if err != nil {
+		logger.WarnContext(ctx, "[Subscription] 读取提示节点配置失败", "error", err)
+		return nil
+	}
+
+	var names []string
+	if cfg.QuotaWarningPercent > 0 && limit > 0 && used*100 >= limit*int64(cfg.QuotaWarningPercent) {
+		name := quotaWarningNodeName
+		if translation, ok := dict[name]; ok {
+			name = translation
+		}
+		names = append(names, name)
+	}
+	if cfg.ExpiryWarningDays > 0 && expireAt != nil {
+		remaining := time.Until(*expireAt)
+		if remaining > 0 && remaining <= time.Duration(cfg.ExpiryWarningDays)*24*time.Hour {
+			names = append(names, translateExpiryWarningName(dict, expireAt.Format("2006-01-02")))
+		}
+	}
+	return names
+}
+
+// injectWarningNodes 将提示节点插入到 proxies 顶部，并追加到第一个 select 代理组末尾，
+// 使其在客户端可见但不会成为默认选中的节点。提示节点指向本机无效端口，无法实际连接
+func injectWarningNodes(data []byte, names []string) ([]byte, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return data, nil
+	}
+	docNode := root.Content[0]
+
+	var proxiesNode, groupsNode *yaml.Node
+	for i := 0; i+1 < len(docNode.Content); i += 2 {
+		switch docNode.Content[i].Value {
+		case "proxies":
+			proxiesNode = docNode.Content[i+1]
+		case "proxy-groups":
+			groupsNode = docNode.Content[i+1]
+		}
+	}
+	if proxiesNode == nil || proxiesNode.Kind != yaml.SequenceNode {
+		return data, nil
+	}
+
+	warnings := make([]*yaml.Node, 0, len(names))
+	for _, name := range names {
+		warnings = append(warnings, warningProxyNode(name))
+	}
+	proxiesNode.Content = append(warnings, proxiesNode.Content...)
+
+	if groupsNode != nil && groupsNode.Kind == yaml.SequenceNode {
+		for _, groupNode := range groupsNode.Content {
+			if groupNode.Kind != yaml.MappingNode || yamlMappingValue(groupNode, "type") != "select" {
+				continue
+			}
+			members := groupField(groupNode, "proxies", true)
+			for _, name := range names {
+				members.Content = append(members.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name})
+			}
+			break
+		}
+	}
+
+	return MarshalYAMLWithIndent(&root)
+}
+
+func warningProxyNode(name string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, kv := range [][2]string{
+		{"name", name},
+		{"type", "ss"},
+		{"server", "127.0.0.1"},
+		{"port", "1"},
+		{"cipher", "aes-128-gcm"},
+		{"password", "warning"},
+	} {
+		tag := "!!str"
+		if kv[0] == "port" {
+			tag = "!!int"
+		}
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: kv[0]},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: kv[1]},
+		)
+	}
+	return node
+}
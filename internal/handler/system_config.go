@@ -0,0 +1,286 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/metrics"
+	"miaomiaowu/internal/storage"
+)
+
+type systemConfigRequest struct {
+	StrictMode            *bool   `json:"strict_mode"`             // Reject unknown subscription targets / query parameters; nil keeps current value
+	OpenRegistration      *bool   `json:"open_registration"`       // Allow sign-up without invite code (pending admin approval); nil keeps current value
+	GrafanaToken          *string `json:"grafana_token"`           // Grafana datasource bearer token; nil keeps current value, empty disables
+	ProbeAlertToken       *string `json:"probe_alert_token"`       // Alert webhook secret; nil keeps current value, empty disables
+	ProbeAlertExclude     *bool   `json:"probe_alert_exclude"`     // Pull alerting nodes from generated configs; nil keeps current value
+	FetchProxy            *string `json:"fetch_proxy"`             // Global outbound proxy for subscription fetchers; nil keeps current value
+	LiveTraffic           *bool   `json:"live_traffic"`            // Stream live stats from Nezha panels; nil keeps current value
+	QuotaWarningPercent   *int    `json:"quota_warning_percent"`   // Warn in subscriptions at this quota usage (0 disables); nil keeps current value
+	ExpiryWarningDays     *int    `json:"expiry_warning_days"`     // Warn in subscriptions this many days before expiry (0 disables); nil keeps current value
+	SnapshotRetentionDays *int    `json:"snapshot_retention_days"` // Days to keep daily snapshots of served subscriptions (0 disables); nil keeps current value
+	NodeNameNormalize     *bool   `json:"node_name_normalize"`     // Enable normalized node name matching; nil keeps current value
+	NodeNameSimplify      *bool   `json:"node_name_simplify"`      // Fold traditional Chinese to simplified during normalization; nil keeps current value
+	NodeNameStripEmoji    *bool   `json:"node_name_strip_emoji"`   // Strip emoji during normalization; nil keeps current value
+	DefaultNodeTag        *string `json:"default_node_tag"`        // Default tag for new nodes; nil keeps current value, empty restores "手动输入"
+	SlowThresholdMs       *int    `json:"slow_threshold_ms"`       // Slow operation threshold in milliseconds (0 restores the default); nil keeps current value
+	StalePullDays         *int    `json:"stale_pull_days"`         // Days without a pull before admins are notified about a regularly pulled subscription (0 disables); nil keeps current value
+	RuleCacheProxy        *bool   `json:"rule_cache_proxy"`        // Serve rule sets and geo databases in generated configs through the panel's cache; nil keeps current value
+	GeoDataInterval       *int    `json:"geo_data_interval"`       // Hours between updates of the panel-hosted geo databases (0 disables); nil keeps current value
+	TrafficUnit           string  `json:"traffic_unit"`            // "binary" or "decimal"; empty keeps current value
+
+	// OutputFormats overrides content type / extension per conversion target; nil keeps current value
+	OutputFormats map[string]storage.OutputFormatOverride `json:"output_formats"`
+
+	// GroupNameTranslations replaces the admin overrides of the zh -> en group name dictionary; nil keeps current value
+	GroupNameTranslations map[string]string `json:"group_name_translations"`
+}
+
+type systemConfigResponse struct {
+	StrictMode            bool   `json:"strict_mode"`             // Reject unknown subscription targets / query parameters
+	OpenRegistration      bool   `json:"open_registration"`       // Allow sign-up without invite code (pending admin approval)
+	GrafanaTokenSet       bool   `json:"grafana_token_set"`       // Whether a Grafana datasource bearer token is configured; the token itself is never returned
+	ProbeAlertTokenSet    bool   `json:"probe_alert_token_set"`   // Whether an alert webhook secret is configured; the secret itself is never returned
+	ProbeAlertExclude     bool   `json:"probe_alert_exclude"`     // Pull alerting nodes from generated configs
+	FetchProxy            string `json:"fetch_proxy"`             // Global outbound proxy for subscription fetchers
+	LiveTraffic           bool   `json:"live_traffic"`            // Stream live stats from Nezha panels for /api/traffic/live
+	QuotaWarningPercent   int    `json:"quota_warning_percent"`   // Quota usage percentage that injects a warning node; 0 disables
+	ExpiryWarningDays     int    `json:"expiry_warning_days"`     // Days before expiry that inject a warning node; 0 disables
+	SnapshotRetentionDays int    `json:"snapshot_retention_days"` // Days to keep daily snapshots of served subscriptions; 0 disables
+	NodeNameNormalize     bool   `json:"node_name_normalize"`     // Normalized node name matching enabled
+	NodeNameSimplify      bool   `json:"node_name_simplify"`      // Traditional to simplified folding during normalization
+	NodeNameStripEmoji    bool   `json:"node_name_strip_emoji"`   // Emoji stripping during normalization
+	DefaultNodeTag        string `json:"default_node_tag"`        // Default tag for new nodes
+	SlowThresholdMs       int    `json:"slow_threshold_ms"`       // Slow operation threshold in milliseconds; 0 uses the default
+	StalePullDays         int    `json:"stale_pull_days"`         // Days without a pull before admins are notified about a regularly pulled subscription; 0 disables
+	RuleCacheProxy        bool   `json:"rule_cache_proxy"`        // Rule sets and geo databases in generated configs are served through the panel's cache
+	GeoDataInterval       int    `json:"geo_data_interval"`       // Hours between updates of the panel-hosted geo databases; 0 disables
+	TrafficUnit           string `json:"traffic_unit"`            // "binary" (GiB) or "decimal" (GB)
+
+	OutputFormats map[string]storage.OutputFormatOverride `json:"output_formats"` // Per-target content type / extension overrides
+
+	GroupNameTranslations        map[string]string `json:"group_name_translations"`         // Admin overrides of the zh -> en group name dictionary
+	DefaultGroupNameTranslations map[string]string `json:"default_group_name_translations"` // Built-in zh -> en group name dictionary
+}
+
+// NewSystemConfigHandler serves instance-wide settings that change every user's subscriptions or
+// the panel's own behaviour, so it is only mounted behind auth.RequireAdmin. Secrets are write-only:
+// GET reports whether they are configured but never returns them.
+func NewSystemConfigHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("system config handler requires repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handleGetSystemConfig(w, r, repo)
+		case http.MethodPut:
+			handleUpdateSystemConfig(w, r, repo)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPut)
+		}
+	})
+}
+
+func handleGetSystemConfig(w http.ResponseWriter, r *http.Request, repo *storage.TrafficRepository) {
+	cfg, err := repo.GetSystemConfig(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("get system config: %w", err))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, newSystemConfigResponse(cfg))
+}
+
+func handleUpdateSystemConfig(w http.ResponseWriter, r *http.Request, repo *storage.TrafficRepository) {
+	var payload systemConfigRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Validate outbound fetch proxy
+	var fetchProxy *string
+	if payload.FetchProxy != nil {
+		trimmed := strings.TrimSpace(*payload.FetchProxy)
+		if strings.EqualFold(trimmed, fetchProxyDirect) {
+			trimmed = ""
+		}
+		if err := validateFetchProxyURL(trimmed); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		fetchProxy = &trimmed
+	}
+
+	// Validate output format overrides
+	var outputFormats map[string]storage.OutputFormatOverride
+	if payload.OutputFormats != nil {
+		normalized, err := normalizeOutputFormatOverrides(payload.OutputFormats)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		outputFormats = normalized
+	}
+
+	// Validate soft quota / expiry warning thresholds
+	if payload.QuotaWarningPercent != nil && (*payload.QuotaWarningPercent < 0 || *payload.QuotaWarningPercent > 100) {
+		writeError(w, http.StatusBadRequest, errors.New("quota_warning_percent must be between 0 and 100"))
+		return
+	}
+	if payload.ExpiryWarningDays != nil && (*payload.ExpiryWarningDays < 0 || *payload.ExpiryWarningDays > 365) {
+		writeError(w, http.StatusBadRequest, errors.New("expiry_warning_days must be between 0 and 365"))
+		return
+	}
+	if payload.SnapshotRetentionDays != nil && (*payload.SnapshotRetentionDays < 0 || *payload.SnapshotRetentionDays > 365) {
+		writeError(w, http.StatusBadRequest, errors.New("snapshot_retention_days must be between 0 and 365"))
+		return
+	}
+	if payload.SlowThresholdMs != nil && (*payload.SlowThresholdMs < 0 || *payload.SlowThresholdMs > 600000) {
+		writeError(w, http.StatusBadRequest, errors.New("slow_threshold_ms must be between 0 and 600000"))
+		return
+	}
+	if payload.StalePullDays != nil && (*payload.StalePullDays < 0 || *payload.StalePullDays > 90) {
+		writeError(w, http.StatusBadRequest, errors.New("stale_pull_days must be between 0 and 90"))
+		return
+	}
+	if payload.GeoDataInterval != nil && (*payload.GeoDataInterval < 0 || *payload.GeoDataInterval > 720) {
+		writeError(w, http.StatusBadRequest, errors.New("geo_data_interval must be between 0 and 720"))
+		return
+	}
+
+	// Validate group name dictionary overrides
+	var groupNameTranslations map[string]string
+	if payload.GroupNameTranslations != nil {
+		normalized, err := normalizeGroupNameTranslations(payload.GroupNameTranslations)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		groupNameTranslations = normalized
+	}
+
+	// Validate traffic unit
+	trafficUnit := strings.TrimSpace(payload.TrafficUnit)
+	if trafficUnit != "" && trafficUnit != storage.TrafficUnitBinary && trafficUnit != storage.TrafficUnitDecimal {
+		writeError(w, http.StatusBadRequest, errors.New("traffic_unit must be 'binary' or 'decimal'"))
+		return
+	}
+
+	cfg, err := repo.GetSystemConfig(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("get system config: %w", err))
+		return
+	}
+	if payload.StrictMode != nil {
+		cfg.StrictMode = *payload.StrictMode
+	}
+	if payload.OpenRegistration != nil {
+		cfg.OpenRegistration = *payload.OpenRegistration
+	}
+	if payload.GrafanaToken != nil {
+		cfg.GrafanaToken = strings.TrimSpace(*payload.GrafanaToken)
+	}
+	if payload.ProbeAlertToken != nil {
+		cfg.ProbeAlertToken = strings.TrimSpace(*payload.ProbeAlertToken)
+	}
+	if payload.ProbeAlertExclude != nil {
+		cfg.ProbeAlertExclude = *payload.ProbeAlertExclude
+	}
+	if fetchProxy != nil {
+		cfg.FetchProxy = *fetchProxy
+	}
+	if outputFormats != nil {
+		cfg.OutputFormats = outputFormats
+	}
+	liveTrafficChanged := payload.LiveTraffic != nil && *payload.LiveTraffic != cfg.LiveTraffic
+	if payload.LiveTraffic != nil {
+		cfg.LiveTraffic = *payload.LiveTraffic
+	}
+	if payload.QuotaWarningPercent != nil {
+		cfg.QuotaWarningPercent = *payload.QuotaWarningPercent
+	}
+	if payload.ExpiryWarningDays != nil {
+		cfg.ExpiryWarningDays = *payload.ExpiryWarningDays
+	}
+	if payload.SnapshotRetentionDays != nil {
+		cfg.SnapshotRetentionDays = *payload.SnapshotRetentionDays
+	}
+	if payload.NodeNameNormalize != nil {
+		cfg.NodeNameNormalize = *payload.NodeNameNormalize
+	}
+	if payload.NodeNameSimplify != nil {
+		cfg.NodeNameSimplify = *payload.NodeNameSimplify
+	}
+	if payload.NodeNameStripEmoji != nil {
+		cfg.NodeNameStripEmoji = *payload.NodeNameStripEmoji
+	}
+	if payload.DefaultNodeTag != nil {
+		cfg.DefaultNodeTag = strings.TrimSpace(*payload.DefaultNodeTag)
+	}
+	if payload.SlowThresholdMs != nil {
+		cfg.SlowThresholdMs = *payload.SlowThresholdMs
+	}
+	if payload.StalePullDays != nil {
+		cfg.StalePullDays = *payload.StalePullDays
+	}
+	if payload.RuleCacheProxy != nil {
+		cfg.RuleCacheProxy = *payload.RuleCacheProxy
+	}
+	if payload.GeoDataInterval != nil {
+		cfg.GeoDataInterval = *payload.GeoDataInterval
+	}
+	if groupNameTranslations != nil {
+		cfg.GroupNameTranslations = groupNameTranslations
+	}
+	if trafficUnit != "" {
+		cfg.TrafficUnit = trafficUnit
+	}
+	if err := repo.UpdateSystemConfig(r.Context(), cfg); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("update system config: %w", err))
+		return
+	}
+	SetGlobalFetchProxy(cfg.FetchProxy)
+	SetOutputFormatOverrides(cfg.OutputFormats)
+	metrics.SetSlowThreshold(time.Duration(cfg.SlowThresholdMs) * time.Millisecond)
+	InvalidateConversionCache()
+	if liveTrafficChanged {
+		ReloadLiveTraffic()
+	}
+
+	respondJSON(w, http.StatusOK, newSystemConfigResponse(cfg))
+}
+
+// newSystemConfigResponse converts the stored config to its API form, reducing secrets to "is set" flags.
+func newSystemConfigResponse(cfg storage.SystemConfig) systemConfigResponse {
+	return systemConfigResponse{
+		StrictMode:                   cfg.StrictMode,
+		OpenRegistration:             cfg.OpenRegistration,
+		GrafanaTokenSet:              cfg.GrafanaToken != "",
+		ProbeAlertTokenSet:           cfg.ProbeAlertToken != "",
+		ProbeAlertExclude:            cfg.ProbeAlertExclude,
+		FetchProxy:                   cfg.FetchProxy,
+		OutputFormats:                cfg.OutputFormats,
+		LiveTraffic:                  cfg.LiveTraffic,
+		QuotaWarningPercent:          cfg.QuotaWarningPercent,
+		ExpiryWarningDays:            cfg.ExpiryWarningDays,
+		SnapshotRetentionDays:        cfg.SnapshotRetentionDays,
+		NodeNameNormalize:            cfg.NodeNameNormalize,
+		NodeNameSimplify:             cfg.NodeNameSimplify,
+		NodeNameStripEmoji:           cfg.NodeNameStripEmoji,
+		DefaultNodeTag:               cfg.DefaultNodeTag,
+		SlowThresholdMs:              cfg.SlowThresholdMs,
+		StalePullDays:                cfg.StalePullDays,
+		RuleCacheProxy:               cfg.RuleCacheProxy,
+		GeoDataInterval:              cfg.GeoDataInterval,
+		GroupNameTranslations:        cfg.GroupNameTranslations,
+		DefaultGroupNameTranslations: groupNameDictionary(nil),
+		TrafficUnit:                  cfg.TrafficUnit,
+	}
+}
@@ -1,13 +1,16 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"time"
 
+	"miaomiaowu/internal/auth"
 	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
 )
 
 // TCPingRequest represents a TCP ping request
@@ -15,6 +18,7 @@ type TCPingRequest struct {
 	Host    string `json:"host"`
 	Port    int    `json:"port"`
 	Timeout int    `json:"timeout"` // timeout in milliseconds, default 5000
+	NodeID  int64  `json:"node_id"` // optional, the result is saved as the node's latest health check
 }
 
 // TCPingResponse represents a TCP ping response
@@ -25,7 +29,11 @@ type TCPingResponse struct {
 }
 
 // tcping handler
-func NewTCPingHandler() http.Handler {
+func NewTCPingHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("tcping handler requires repository")
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			writeJSONError(w, http.StatusMethodNotAllowed, "only POST is supported")
@@ -77,6 +85,7 @@ func NewTCPingHandler() http.Handler {
 			resp.Success = true
 			resp.Latency = latency
 		}
+		recordNodeHealth(r.Context(), repo, req, resp)
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
@@ -85,7 +94,11 @@ func NewTCPingHandler() http.Handler {
 }
 
 // 批量tcping延迟检测
-func NewTCPingBatchHandler() http.Handler {
+func NewTCPingBatchHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("tcping batch handler requires repository")
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			writeJSONError(w, http.StatusMethodNotAllowed, "only POST is supported")
@@ -147,6 +160,9 @@ func NewTCPingBatchHandler() http.Handler {
 		for range requests {
 			<-done
 		}
+		for i, req := range requests {
+			recordNodeHealth(r.Context(), repo, req, results[i])
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
@@ -154,6 +170,22 @@ func NewTCPingBatchHandler() http.Handler {
 	})
 }
 
+// recordNodeHealth 请求带有 node_id 时保存检测结果，用于统计订阅来源的死节点比例
+func recordNodeHealth(ctx context.Context, repo *storage.TrafficRepository, req TCPingRequest, resp TCPingResponse) {
+	if req.NodeID <= 0 {
+		return
+	}
+	if err := repo.RecordNodeHealth(ctx, storage.NodeHealth{
+		NodeID:    req.NodeID,
+		Username:  auth.UsernameFromContext(ctx),
+		Alive:     resp.Success,
+		LatencyMs: resp.Latency,
+		Error:     resp.Error,
+	}); err != nil {
+		logger.Debug("[TCPing] 保存节点检测结果失败", "node_id", req.NodeID, "error", err)
+	}
+}
+
 func writeJSONError(w http.ResponseWriter, status int, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
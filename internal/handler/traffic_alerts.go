@@ -0,0 +1,318 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+// EvaluateTrafficAlerts checks the per-server snapshots recorded for the day of now against the
+// enabled alert rules and notifies every admin when a server crosses a threshold. Each rule fires at
+// most once per server and billing cycle.
+func EvaluateTrafficAlerts(ctx context.Context, repo *storage.TrafficRepository, now time.Time) error {
+	if repo == nil {
+		return errors.New("traffic alerts require repository")
+	}
+
+	rules, err := repo.ListTrafficAlertRules(ctx)
+	if err != nil {
+		return err
+	}
+	enabled := rules[:0]
+	for _, rule := range rules {
+		if rule.Enabled {
+			enabled = append(enabled, rule)
+		}
+	}
+	if len(enabled) == 0 {
+		return nil
+	}
+
+	records, err := repo.ListProbeServerDailyOn(ctx, now)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	configs, err := repo.ListProbeConfigs(ctx)
+	if err != nil {
+		return err
+	}
+	type serverInfo struct {
+		configName string
+		server     storage.ProbeServer
+	}
+	servers := make(map[string]serverInfo)
+	for _, cfg := range configs {
+		for _, srv := range cfg.Servers {
+			servers[fmt.Sprintf("%d:%s", cfg.ID, srv.ServerID)] = serverInfo{configName: cfg.Name, server: srv}
+		}
+	}
+
+	admins, err := listAdminUsernames(ctx, repo)
+	if err != nil {
+		return err
+	}
+	if len(admins) == 0 {
+		return nil
+	}
+
+	unitSize := trafficUnitSize(storage.TrafficUnitBinary)
+	unitLabel := trafficUnitLabel(storage.TrafficUnitBinary)
+	if cfg, err := repo.GetSystemConfig(ctx); err == nil {
+		unitSize = trafficUnitSize(cfg.TrafficUnit)
+		unitLabel = trafficUnitLabel(cfg.TrafficUnit)
+	}
+
+	for _, record := range records {
+		if record.LimitBytes <= 0 {
+			continue
+		}
+		info, ok := servers[fmt.Sprintf("%d:%s", record.ConfigID, record.ServerID)]
+		if !ok {
+			continue
+		}
+
+		percent := usagePercentage(record.UsedBytes, record.LimitBytes)
+		cycle := now.Format("2006-01")
+		if info.server.ResetDay > 0 {
+			cycle = storage.ProbeServerCycleStart(now, info.server.ResetDay, info.server.ResetTimezone).Format("2006-01-02")
+		}
+
+		for _, rule := range enabled {
+			if !rule.Matches(record.ConfigID, record.ServerID) || percent < rule.ThresholdPercent {
+				continue
+			}
+
+			title := fmt.Sprintf("服务器「%s」流量已达 %s%%", info.server.Name, formatAlertPercent(rule.ThresholdPercent))
+			content := fmt.Sprintf("探针「%s」的服务器「%s」本周期已用 %.2f %s / %.2f %s（%.2f%%）",
+				info.configName, info.server.Name,
+				bytesToUnit(record.UsedBytes, unitSize), unitLabel,
+				bytesToUnit(record.LimitBytes, unitSize), unitLabel,
+				percent)
+			if rule.Name != "" {
+				content += "，告警规则：" + rule.Name
+			}
+			dedupeKey := fmt.Sprintf("traffic_alert:%d:%d:%s:%s", rule.ID, record.ConfigID, record.ServerID, cycle)
+
+			for _, admin := range admins {
+				created, err := repo.CreateNotification(ctx, storage.Notification{
+					Username:  admin,
+					Type:      storage.NotificationTypeTrafficAlert,
+					Title:     title,
+					Content:   content,
+					DedupeKey: dedupeKey,
+				})
+				if err != nil {
+					logger.Warn("[流量告警] 写入通知失败", "username", admin, "error", err)
+					continue
+				}
+				if created {
+					logger.Info("[流量告警] 服务器流量超过阈值", "server", info.server.Name, "threshold", rule.ThresholdPercent, "percent", percent, "username", admin)
+					emailUserAsync(repo, admin, EmailTemplateTrafficAlert, map[string]any{
+						"Title":   title,
+						"Content": content,
+						"Time":    now.Format("2006-01-02 15:04:05"),
+					})
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// listAdminUsernames 返回所有启用的管理员用户名
+func listAdminUsernames(ctx context.Context, repo *storage.TrafficRepository) ([]string, error) {
+	users, err := repo.ListUsers(ctx, 1000)
+	if err != nil {
+		return nil, err
+	}
+
+	var admins []string
+	for _, user := range users {
+		if user.Role == storage.RoleAdmin && user.IsActive {
+			admins = append(admins, user.Username)
+		}
+	}
+	return admins, nil
+}
+
+func formatAlertPercent(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+type trafficAlertRulePayload struct {
+	ID               int64     `json:"id"`
+	Name             string    `json:"name"`
+	ThresholdPercent float64   `json:"threshold_percent"`
+	ConfigID         int64     `json:"config_id"`
+	ServerID         string    `json:"server_id"`
+	Enabled          bool      `json:"enabled"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+type trafficAlertRuleRequest struct {
+	Name             string  `json:"name"`
+	ThresholdPercent float64 `json:"threshold_percent"`
+	ConfigID         int64   `json:"config_id"`
+	ServerID         string  `json:"server_id"`
+	Enabled          *bool   `json:"enabled"`
+}
+
+func convertTrafficAlertRule(rule storage.TrafficAlertRule) trafficAlertRulePayload {
+	return trafficAlertRulePayload{
+		ID:               rule.ID,
+		Name:             rule.Name,
+		ThresholdPercent: rule.ThresholdPercent,
+		ConfigID:         rule.ConfigID,
+		ServerID:         rule.ServerID,
+		Enabled:          rule.Enabled,
+		CreatedAt:        rule.CreatedAt,
+		UpdatedAt:        rule.UpdatedAt,
+	}
+}
+
+type trafficAlertRulesHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewTrafficAlertRulesHandler manages traffic threshold alert rules under /api/admin/traffic-alerts.
+func NewTrafficAlertRulesHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("traffic alert rules handler requires repository")
+	}
+
+	return &trafficAlertRulesHandler{repo: repo}
+}
+
+func (h *trafficAlertRulesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	idPart := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/traffic-alerts"), "/")
+	if idPart == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.handleList(w, r)
+		case http.MethodPost:
+			h.handleSave(w, r, 0)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+		return
+	}
+
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil || id <= 0 {
+		writeBadRequest(w, "无效的告警规则ID")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		h.handleSave(w, r, id)
+	case http.MethodDelete:
+		h.handleDelete(w, r, id)
+	default:
+		methodNotAllowed(w, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (h *trafficAlertRulesHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.repo.ListTrafficAlertRules(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]trafficAlertRulePayload, 0, len(rules))
+	for _, rule := range rules {
+		items = append(items, convertTrafficAlertRule(rule))
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"rules": items,
+	})
+}
+
+func (h *trafficAlertRulesHandler) handleSave(w http.ResponseWriter, r *http.Request, id int64) {
+	var payload trafficAlertRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	if payload.ThresholdPercent <= 0 || payload.ThresholdPercent > 1000 {
+		writeBadRequest(w, "阈值百分比需在 0-1000 之间")
+		return
+	}
+	serverID := strings.TrimSpace(payload.ServerID)
+	if payload.ConfigID < 0 || (payload.ConfigID == 0 && serverID != "") {
+		writeBadRequest(w, "指定服务器时必须同时指定探针配置")
+		return
+	}
+	if payload.ConfigID > 0 {
+		if _, err := h.repo.GetProbeConfigByID(r.Context(), payload.ConfigID); err != nil {
+			if errors.Is(err, storage.ErrProbeConfigNotFound) {
+				writeBadRequest(w, "探针配置不存在")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	rule := storage.TrafficAlertRule{
+		ID:               id,
+		Name:             payload.Name,
+		ThresholdPercent: payload.ThresholdPercent,
+		ConfigID:         payload.ConfigID,
+		ServerID:         serverID,
+		Enabled:          payload.Enabled == nil || *payload.Enabled,
+	}
+
+	var saved storage.TrafficAlertRule
+	var err error
+	if id == 0 {
+		saved, err = h.repo.CreateTrafficAlertRule(r.Context(), rule)
+	} else {
+		saved, err = h.repo.UpdateTrafficAlertRule(r.Context(), rule)
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrTrafficAlertRuleNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logger.Info("[流量告警] 告警规则已保存", "id", saved.ID, "threshold", saved.ThresholdPercent)
+	respondJSON(w, http.StatusOK, map[string]any{
+		"rule": convertTrafficAlertRule(saved),
+	})
+}
+
+func (h *trafficAlertRulesHandler) handleDelete(w http.ResponseWriter, r *http.Request, id int64) {
+	if err := h.repo.DeleteTrafficAlertRule(r.Context(), id); err != nil {
+		if errors.Is(err, storage.ErrTrafficAlertRuleNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"message": "告警规则已删除",
+	})
+}
@@ -0,0 +1,343 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	// collectorServerAttempts 单个探针在一次收集中的最大尝试次数
+	collectorServerAttempts = 3
+	// collectorServerBackoff 首次重试前的等待时间，之后每次翻倍
+	collectorServerBackoff = 2 * time.Second
+	// defaultCollectorConcurrency 未配置时同时收集的探针面板数
+	defaultCollectorConcurrency = 4
+	// maxCollectorConcurrency 允许配置的最大并发数
+	maxCollectorConcurrency = 32
+	// maxCollectorPanelInterval 单个探针面板请求间隔的上限（毫秒）
+	maxCollectorPanelInterval = 60_000
+)
+
+// collectionReport 记录一次计划收集中各探针服务器的结果，通过 context 传递给流量获取逻辑
+type collectionReport struct {
+	mu           sync.Mutex
+	collected    map[string]struct{}
+	serversTotal int
+	failures     []storage.TrafficCollectionFailure
+	concurrency  int
+	panels       []storage.TrafficCollectionPanel
+}
+
+type collectionReportKey struct{}
+
+func withCollectionReport(ctx context.Context, report *collectionReport) context.Context {
+	return context.WithValue(ctx, collectionReportKey{}, report)
+}
+
+func collectionReportFrom(ctx context.Context) *collectionReport {
+	report, _ := ctx.Value(collectionReportKey{}).(*collectionReport)
+	return report
+}
+
+func collectionServerKey(configID int64, serverID string) string {
+	return fmt.Sprintf("%d/%s", configID, serverID)
+}
+
+// markServerCollected 标记服务器已成功取得流量数据
+func markServerCollected(ctx context.Context, configID int64, serverID string) {
+	report := collectionReportFrom(ctx)
+	if report == nil {
+		return
+	}
+	report.mu.Lock()
+	defer report.mu.Unlock()
+	if report.collected == nil {
+		report.collected = make(map[string]struct{})
+	}
+	report.collected[collectionServerKey(configID, serverID)] = struct{}{}
+}
+
+func (r *collectionReport) addFailure(cfg storage.ProbeConfig, srv storage.ProbeServer, attempts int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = append(r.failures, storage.TrafficCollectionFailure{
+		ConfigID:   cfg.ID,
+		ConfigName: cfg.Name,
+		ServerID:   srv.ServerID,
+		ServerName: srv.Name,
+		Attempts:   attempts,
+		Error:      err.Error(),
+	})
+}
+
+func (r *collectionReport) addPanel(panel storage.TrafficCollectionPanel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.panels = append(r.panels, panel)
+}
+
+func (r *collectionReport) isCollected(configID int64, serverID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.collected[collectionServerKey(configID, serverID)]
+	return ok
+}
+
+// toRun 生成持久化的收集记录
+func (r *collectionReport) toRun(startedAt time.Time, collectErr error) storage.TrafficCollectionRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	run := storage.TrafficCollectionRun{
+		StartedAt:     startedAt,
+		FinishedAt:    time.Now(),
+		Status:        storage.TrafficCollectionSuccess,
+		ServersTotal:  r.serversTotal,
+		ServersFailed: len(r.failures),
+		Failures:      r.failures,
+		Concurrency:   r.concurrency,
+		Panels:        r.panels,
+	}
+	switch {
+	case collectErr != nil:
+		run.Status = storage.TrafficCollectionFailed
+		run.Error = collectErr.Error()
+	case len(r.failures) > 0:
+		run.Status = storage.TrafficCollectionPartial
+	}
+	return run
+}
+
+// collectableServers 返回参与总流量统计、需要收集的服务器
+func collectableServers(cfg storage.ProbeConfig) []storage.ProbeServer {
+	if cfg.ProbeType == storage.ProbeTypeUptimeKuma {
+		return nil
+	}
+	servers := make([]storage.ProbeServer, 0, len(cfg.Servers))
+	for _, srv := range cfg.Servers {
+		if srv.IncludeInTotal && strings.TrimSpace(srv.ServerID) != "" {
+			servers = append(servers, srv)
+		}
+	}
+	return servers
+}
+
+// reportsPerServer 该探针类型是否逐台记录服务器用量（dstatus 只返回汇总数据）
+func reportsPerServer(cfg storage.ProbeConfig) bool {
+	return cfg.ProbeType != storage.ProbeTypeDstatus || IsAirGappedMode()
+}
+
+// collectorLimits 读取收集并发数与单个面板的请求间隔
+func collectorLimits(cfg storage.SystemConfig) (int, time.Duration) {
+	concurrency := cfg.CollectorConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultCollectorConcurrency
+	}
+	concurrency = min(concurrency, maxCollectorConcurrency)
+
+	interval := min(max(cfg.CollectorPanelInterval, 0), maxCollectorPanelInterval)
+	return concurrency, time.Duration(interval) * time.Millisecond
+}
+
+// panelGate 限制对同一个探针面板的访问：同一时间只有一个请求，且相邻请求至少间隔 interval
+type panelGate struct {
+	slot     chan struct{}
+	interval time.Duration
+	last     time.Time
+}
+
+func newPanelGate(interval time.Duration) *panelGate {
+	return &panelGate{slot: make(chan struct{}, 1), interval: interval}
+}
+
+// acquire 等待面板空闲并满足请求间隔，返回的函数用于释放
+func (g *panelGate) acquire(ctx context.Context) (func(), error) {
+	select {
+	case g.slot <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if wait := time.Until(g.last.Add(g.interval)); wait > 0 && !g.last.IsZero() {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			<-g.slot
+			return nil, ctx.Err()
+		}
+	}
+	return func() {
+		g.last = time.Now()
+		<-g.slot
+	}, nil
+}
+
+// probePanelKey 同一面板地址（host）上的多个探针配置共用一个限流器
+func probePanelKey(cfg storage.ProbeConfig) string {
+	address := strings.TrimSpace(cfg.Address)
+	if parsed, err := url.Parse(address); err == nil && parsed.Host != "" {
+		return strings.ToLower(parsed.Host)
+	}
+	return strings.ToLower(address)
+}
+
+type probeTotalsResult struct {
+	limit, remaining, used int64
+	attempts               int
+	err                    error
+}
+
+// collectProbeTotals 计划收集使用的探针流量汇总：每个探针失败后按指数退避重试，
+// 部分探针或服务器失败时仍返回其余探针的结果，失败详情写入 context 中的收集报告
+func (h *TrafficSummaryHandler) collectProbeTotals(ctx context.Context) (int64, int64, int64, error) {
+	if h.repo == nil {
+		return 0, 0, 0, errors.New("traffic repository not configured")
+	}
+
+	configs, err := h.repo.ListProbeConfigs(ctx)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if len(configs) == 0 {
+		return 0, 0, 0, storage.ErrProbeConfigNotFound
+	}
+
+	report := collectionReportFrom(ctx)
+	if report == nil {
+		report = &collectionReport{}
+		ctx = withCollectionReport(ctx, report)
+	}
+
+	var concurrency int
+	var interval time.Duration
+	if systemConfig, err := h.repo.GetSystemConfig(ctx); err == nil {
+		concurrency, interval = collectorLimits(systemConfig)
+	} else {
+		concurrency, interval = collectorLimits(storage.SystemConfig{})
+	}
+	concurrency = min(concurrency, len(configs))
+	report.mu.Lock()
+	report.concurrency = concurrency
+	report.mu.Unlock()
+
+	gates := make(map[string]*panelGate)
+	for _, cfg := range configs {
+		if key := probePanelKey(cfg); gates[key] == nil {
+			gates[key] = newPanelGate(interval)
+		}
+	}
+
+	// 按并发数同时收集多个探针面板，同一面板的请求由 panelGate 串行并限速
+	results := make([]probeTotalsResult, len(configs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, cfg := range configs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			started := time.Now()
+			var res probeTotalsResult
+			res.limit, res.remaining, res.used, res.attempts, res.err = h.fetchConfigTotalsWithRetry(ctx, cfg, gates[probePanelKey(cfg)])
+			results[i] = res
+
+			panel := storage.TrafficCollectionPanel{
+				ConfigID:   cfg.ID,
+				ConfigName: cfg.Name,
+				ProbeType:  cfg.ProbeType,
+				Servers:    len(collectableServers(cfg)),
+				Attempts:   res.attempts,
+				DurationMs: time.Since(started).Milliseconds(),
+			}
+			if res.err != nil {
+				panel.Error = res.err.Error()
+			}
+			report.addPanel(panel)
+		}()
+	}
+	wg.Wait()
+
+	report.mu.Lock()
+	sort.Slice(report.panels, func(a, b int) bool { return report.panels[a].ConfigID < report.panels[b].ConfigID })
+	report.mu.Unlock()
+
+	var totalLimit, totalRemaining, totalUsed int64
+	var firstErr error
+	succeeded := 0
+	for i, cfg := range configs {
+		servers := collectableServers(cfg)
+		report.mu.Lock()
+		report.serversTotal += len(servers)
+		report.mu.Unlock()
+
+		limit, remaining, used, attempts, err := results[i].limit, results[i].remaining, results[i].used, results[i].attempts, results[i].err
+		if err != nil {
+			logger.Warn("[流量收集器] 探针多次重试后仍失败", "config", cfg.Name, "attempts", attempts, "error", err)
+			for _, srv := range servers {
+				report.addFailure(cfg, srv, attempts, err)
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		succeeded++
+		totalLimit += limit
+		totalRemaining += remaining
+		totalUsed += used
+
+		if !reportsPerServer(cfg) {
+			continue
+		}
+		for _, srv := range servers {
+			if !report.isCollected(cfg.ID, srv.ServerID) {
+				logger.Warn("[流量收集器] 服务器未返回流量数据", "config", cfg.Name, "server_id", srv.ServerID, "name", srv.Name)
+				report.addFailure(cfg, srv, attempts, errors.New("服务器未在探针数据中找到"))
+			}
+		}
+	}
+
+	if succeeded == 0 {
+		return 0, 0, 0, firstErr
+	}
+
+	return totalLimit, totalRemaining, totalUsed, nil
+}
+
+// fetchConfigTotalsWithRetry 获取单个探针的流量，失败后按 2s、4s… 退避重试；每次请求都经过面板限流
+func (h *TrafficSummaryHandler) fetchConfigTotalsWithRetry(ctx context.Context, cfg storage.ProbeConfig, gate *panelGate) (int64, int64, int64, int, error) {
+	delay := collectorServerBackoff
+	attempt := 1
+	for {
+		release, err := gate.acquire(ctx)
+		if err != nil {
+			return 0, 0, 0, attempt, err
+		}
+		limit, remaining, used, err := h.fetchConfigTotals(ctx, cfg, nil)
+		release()
+		if err == nil || attempt == collectorServerAttempts {
+			return limit, remaining, used, attempt, err
+		}
+
+		logger.Info("[流量收集器] 探针获取失败，准备重试", "config", cfg.Name, "attempt", attempt, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return 0, 0, 0, attempt, err
+		case <-time.After(delay):
+		}
+		delay *= 2
+		attempt++
+	}
+}
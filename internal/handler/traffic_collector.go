@@ -0,0 +1,488 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	defaultCollectorSchedule = "0 0 * * *"
+	collectorRunTimeout      = 2 * time.Minute
+	collectorMaxRetries      = 3
+	collectorRetryDelay      = 30 * time.Second
+)
+
+// ErrCollectorBusy 已有流量收集任务正在执行
+var ErrCollectorBusy = errors.New("流量收集正在进行中")
+
+// TrafficCollector records the daily traffic snapshot on a cron schedule. The schedule and the
+// timezone used for the daily rollover come from the system config.
+type TrafficCollector struct {
+	summary    *TrafficSummaryHandler
+	repo       *storage.TrafficRepository
+	running    sync.Mutex
+	reschedule chan struct{}
+}
+
+// NewTrafficCollector creates a collector that records snapshots through the traffic summary handler.
+func NewTrafficCollector(summary *TrafficSummaryHandler, repo *storage.TrafficRepository) *TrafficCollector {
+	if summary == nil || repo == nil {
+		panic("traffic collector requires summary handler and repository")
+	}
+
+	return &TrafficCollector{
+		summary:    summary,
+		repo:       repo,
+		reschedule: make(chan struct{}, 1),
+	}
+}
+
+// collectorLocation 解析收集器时区，空值表示 UTC（与历史记录的日期口径一致）
+func collectorLocation(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// loadCollectorSettings 读取系统配置中的收集计划和时区，配置无效时回退默认值
+func loadCollectorSettings(ctx context.Context, repo *storage.TrafficRepository) (*cronSchedule, *time.Location) {
+	var cfg storage.SystemConfig
+	if repo != nil {
+		loaded, err := repo.GetSystemConfig(ctx)
+		if err != nil {
+			logger.Warn("[流量收集器] 读取系统配置失败，使用默认计划", "error", err)
+		} else {
+			cfg = loaded
+		}
+	}
+
+	expr := strings.TrimSpace(cfg.CollectorSchedule)
+	if expr == "" {
+		expr = defaultCollectorSchedule
+	}
+	schedule, err := parseCronSchedule(expr)
+	if err != nil {
+		logger.Warn("[流量收集器] 收集计划无效，使用默认计划", "schedule", expr, "error", err)
+		schedule, _ = parseCronSchedule(defaultCollectorSchedule)
+	}
+
+	loc, err := collectorLocation(cfg.CollectorTimezone)
+	if err != nil {
+		logger.Warn("[流量收集器] 时区无效，使用 UTC", "timezone", cfg.CollectorTimezone, "error", err)
+		loc = time.UTC
+	}
+
+	return schedule, loc
+}
+
+// Run 按计划执行流量收集，直到 ctx 取消。启动时若错过了上一次计划的收集（例如服务重启），会立即补收一次
+func (c *TrafficCollector) Run(ctx context.Context) {
+	schedule, loc := loadCollectorSettings(ctx, c.repo)
+	if c.missedRun(ctx, schedule, loc) {
+		c.collectWithRetry(ctx)
+	}
+
+	logger.Info("[流量收集器] 定时调度器已启动")
+
+	for {
+		schedule, loc = loadCollectorSettings(ctx, c.repo)
+		next := schedule.Next(time.Now().In(loc))
+		if next.IsZero() {
+			logger.Warn("[流量收集器] 收集计划没有可执行的时间，调度器已暂停")
+			select {
+			case <-ctx.Done():
+				logger.Info("[流量收集器] 定时调度器已停止")
+				return
+			case <-c.reschedule:
+				continue
+			}
+		}
+
+		logger.Info("[流量收集器] 下次收集时间", "next_run", next.Format("2006-01-02 15:04:05 MST"))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.Info("[流量收集器] 定时调度器已停止")
+			return
+		case <-c.reschedule:
+			timer.Stop()
+		case <-timer.C:
+			c.collectWithRetry(ctx)
+		}
+	}
+}
+
+// missedRun 判断最近一次记录之后是否已经到过计划的收集时间
+func (c *TrafficCollector) missedRun(ctx context.Context, schedule *cronSchedule, loc *time.Location) bool {
+	lastAt, ok, err := c.repo.LastTrafficRecordAt(ctx)
+	if err != nil {
+		logger.Warn("[流量收集器] 读取最近记录时间失败", "error", err)
+		return true
+	}
+	if !ok {
+		return true
+	}
+
+	next := schedule.Next(lastAt.In(loc))
+	return !next.IsZero() && !next.After(time.Now())
+}
+
+// Reschedule makes the running scheduler reload its settings.
+func (c *TrafficCollector) Reschedule() {
+	select {
+	case c.reschedule <- struct{}{}:
+	default:
+	}
+}
+
+// Collect runs a single collection immediately. It returns ErrCollectorBusy when another run is in progress.
+func (c *TrafficCollector) Collect(ctx context.Context) error {
+	if !c.running.TryLock() {
+		return ErrCollectorBusy
+	}
+	defer c.running.Unlock()
+
+	runCtx, cancel := context.WithTimeout(ctx, collectorRunTimeout)
+	defer cancel()
+
+	startedAt := time.Now()
+	report := &collectionReport{}
+	err := c.summary.RecordDailyUsage(withCollectionReport(runCtx, report))
+	run := report.toRun(startedAt, err)
+	if saveErr := c.repo.RecordTrafficCollectionRun(context.WithoutCancel(ctx), run); saveErr != nil {
+		logger.Warn("[流量收集器] 保存收集状态失败", "error", saveErr)
+	}
+	emitWebhookEvent(WebhookEventTrafficCollected, convertTrafficCollectionRun(run))
+	if err != nil {
+		return err
+	}
+	if run.Status == storage.TrafficCollectionPartial {
+		logger.Warn("[流量收集器] 部分服务器流量收集失败", "failed", run.ServersFailed, "total", run.ServersTotal)
+	}
+
+	now := c.summary.rolloverNow(runCtx)
+	if err := EvaluateTrafficAlerts(runCtx, c.repo, now); err != nil {
+		logger.Warn("[流量告警] 评估告警规则失败", "error", err)
+	}
+	if err := EnforceProbeServerQuotas(runCtx, c.repo, now); err != nil {
+		logger.Warn("[流量超额] 处理超额节点失败", "error", err)
+	}
+	// 顺带同步探针面板中的服务器信息到绑定的节点
+	if !IsAirGappedMode() {
+		if _, err := SyncProbeAnnotations(runCtx, c.repo); err != nil {
+			logger.Warn("[探针标注] 同步服务器信息失败", "error", err)
+		}
+	}
+	return nil
+}
+
+// collectWithRetry 带重试的计划收集
+func (c *TrafficCollector) collectWithRetry(ctx context.Context) {
+	logger.Info("[流量收集器] 开始流量收集", "start_time", time.Now().Format("2006-01-02 15:04:05"))
+
+	for attempt := 1; attempt <= collectorMaxRetries; attempt++ {
+		err := c.Collect(ctx)
+		if err == nil {
+			logger.Info("[流量收集器] 流量收集成功")
+			return
+		}
+
+		logger.Warn("[流量收集器] 流量收集失败", "attempt", attempt, "max_retries", collectorMaxRetries, "error", err)
+
+		// 探针未配置或已有收集任务在执行时不需要重试
+		if errors.Is(err, storage.ErrProbeConfigNotFound) || errors.Is(err, ErrCollectorBusy) {
+			return
+		}
+
+		if attempt < collectorMaxRetries {
+			delay := collectorRetryDelay << (attempt - 1)
+			logger.Info("[流量收集器] 准备重试", "delay", delay)
+			select {
+			case <-ctx.Done():
+				logger.Info("[流量收集器] 重试已取消（服务器关闭）")
+				return
+			case <-time.After(delay):
+			}
+		}
+	}
+
+	logger.Error("[流量收集器] 达到最大重试次数后仍失败", "max_retries", collectorMaxRetries)
+}
+
+// rolloverNow 返回按收集器时区换算后的当前时间，用于确定每日记录归属的日期
+func (h *TrafficSummaryHandler) rolloverNow(ctx context.Context) time.Time {
+	if h.repo == nil {
+		return time.Now().UTC()
+	}
+	cfg, err := h.repo.GetSystemConfig(ctx)
+	if err != nil {
+		return time.Now().UTC()
+	}
+	loc, err := collectorLocation(cfg.CollectorTimezone)
+	if err != nil {
+		return time.Now().UTC()
+	}
+	return time.Now().In(loc)
+}
+
+type trafficCollectorSettingsRequest struct {
+	Schedule        string `json:"schedule"`
+	Timezone        string `json:"timezone"`
+	Concurrency     *int   `json:"concurrency"`       // Probe panels collected in parallel (0 = default); nil keeps current value
+	PanelIntervalMs *int   `json:"panel_interval_ms"` // Minimum gap between requests to one panel; nil keeps current value
+}
+
+type trafficCollectorStatusResponse struct {
+	Schedule        string                      `json:"schedule"`
+	Timezone        string                      `json:"timezone"`
+	Concurrency     int                         `json:"concurrency"`
+	PanelIntervalMs int                         `json:"panel_interval_ms"`
+	NextRunAt       *time.Time                  `json:"next_run_at,omitempty"`
+	LastCollectedAt *time.Time                  `json:"last_collected_at,omitempty"`
+	LastRun         *trafficCollectionRunResult `json:"last_run,omitempty"`
+}
+
+type trafficCollectionRunResult struct {
+	ID            int64                              `json:"id"`
+	StartedAt     time.Time                          `json:"started_at"`
+	FinishedAt    time.Time                          `json:"finished_at"`
+	Status        string                             `json:"status"`
+	ServersTotal  int                                `json:"servers_total"`
+	ServersFailed int                                `json:"servers_failed"`
+	Failures      []storage.TrafficCollectionFailure `json:"failures"`
+	DurationMs    int64                              `json:"duration_ms"`
+	Concurrency   int                                `json:"concurrency"`
+	Panels        []storage.TrafficCollectionPanel   `json:"panels"`
+	Error         string                             `json:"error,omitempty"`
+}
+
+func convertTrafficCollectionRun(run storage.TrafficCollectionRun) trafficCollectionRunResult {
+	failures := run.Failures
+	if failures == nil {
+		failures = []storage.TrafficCollectionFailure{}
+	}
+	panels := run.Panels
+	if panels == nil {
+		panels = []storage.TrafficCollectionPanel{}
+	}
+	return trafficCollectionRunResult{
+		ID:            run.ID,
+		StartedAt:     run.StartedAt,
+		FinishedAt:    run.FinishedAt,
+		Status:        run.Status,
+		ServersTotal:  run.ServersTotal,
+		ServersFailed: run.ServersFailed,
+		Failures:      failures,
+		DurationMs:    run.Duration().Milliseconds(),
+		Concurrency:   run.Concurrency,
+		Panels:        panels,
+		Error:         run.Error,
+	}
+}
+
+type trafficCollectorHandler struct {
+	repo      *storage.TrafficRepository
+	collector *TrafficCollector
+}
+
+// NewTrafficCollectorHandler exposes the collector schedule settings (GET/PUT), a manual
+// "collect now" action at /collect (POST) and the recent collection outcomes at /runs (GET).
+func NewTrafficCollectorHandler(repo *storage.TrafficRepository, collector *TrafficCollector) http.Handler {
+	if repo == nil || collector == nil {
+		panic("traffic collector handler requires repository and collector")
+	}
+
+	return &trafficCollectorHandler{repo: repo, collector: collector}
+}
+
+func (h *trafficCollectorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/collect") {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		h.handleCollect(w, r)
+		return
+	}
+	if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/runs") {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		h.handleRuns(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.handleGet(w, r)
+	case http.MethodPut:
+		h.handleUpdate(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+	}
+}
+
+func (h *trafficCollectorHandler) status(r *http.Request) (trafficCollectorStatusResponse, error) {
+	cfg, err := h.repo.GetSystemConfig(r.Context())
+	if err != nil {
+		return trafficCollectorStatusResponse{}, err
+	}
+
+	concurrency, interval := collectorLimits(cfg)
+	resp := trafficCollectorStatusResponse{
+		Schedule:        cfg.CollectorSchedule,
+		Timezone:        cfg.CollectorTimezone,
+		Concurrency:     concurrency,
+		PanelIntervalMs: int(interval.Milliseconds()),
+	}
+	if resp.Schedule == "" {
+		resp.Schedule = defaultCollectorSchedule
+	}
+	if resp.Timezone == "" {
+		resp.Timezone = "UTC"
+	}
+	schedule, loc := loadCollectorSettings(r.Context(), h.repo)
+	if next := schedule.Next(time.Now().In(loc)); !next.IsZero() {
+		resp.NextRunAt = &next
+	}
+	if lastAt, ok, err := h.repo.LastTrafficRecordAt(r.Context()); err == nil && ok {
+		resp.LastCollectedAt = &lastAt
+	}
+	if run, ok, err := h.repo.LatestTrafficCollectionRun(r.Context()); err == nil && ok {
+		result := convertTrafficCollectionRun(run)
+		resp.LastRun = &result
+	}
+	return resp, nil
+}
+
+func (h *trafficCollectorHandler) handleRuns(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			writeBadRequest(w, "无效的 limit 参数")
+			return
+		}
+		limit = parsed
+	}
+
+	runs, err := h.repo.ListTrafficCollectionRuns(r.Context(), limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	results := make([]trafficCollectionRunResult, 0, len(runs))
+	for _, run := range runs {
+		results = append(results, convertTrafficCollectionRun(run))
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"runs": results})
+}
+
+func (h *trafficCollectorHandler) handleGet(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.status(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func (h *trafficCollectorHandler) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	var payload trafficCollectorSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	schedule := strings.TrimSpace(payload.Schedule)
+	if schedule != "" {
+		parsed, err := parseCronSchedule(schedule)
+		if err != nil {
+			writeBadRequest(w, err.Error())
+			return
+		}
+		if parsed.Next(time.Now()).IsZero() {
+			writeBadRequest(w, "收集计划没有可执行的时间")
+			return
+		}
+	}
+	timezone := strings.TrimSpace(payload.Timezone)
+	if strings.EqualFold(timezone, "UTC") {
+		timezone = ""
+	}
+	if _, err := collectorLocation(timezone); err != nil {
+		writeBadRequest(w, "无效的时区")
+		return
+	}
+	if payload.Concurrency != nil && (*payload.Concurrency < 0 || *payload.Concurrency > maxCollectorConcurrency) {
+		writeBadRequest(w, fmt.Sprintf("并发数必须在 0-%d 之间", maxCollectorConcurrency))
+		return
+	}
+	if payload.PanelIntervalMs != nil && (*payload.PanelIntervalMs < 0 || *payload.PanelIntervalMs > maxCollectorPanelInterval) {
+		writeBadRequest(w, fmt.Sprintf("面板请求间隔必须在 0-%d 毫秒之间", maxCollectorPanelInterval))
+		return
+	}
+
+	cfg, err := h.repo.GetSystemConfig(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	cfg.CollectorSchedule = schedule
+	cfg.CollectorTimezone = timezone
+	if payload.Concurrency != nil {
+		cfg.CollectorConcurrency = *payload.Concurrency
+	}
+	if payload.PanelIntervalMs != nil {
+		cfg.CollectorPanelInterval = *payload.PanelIntervalMs
+	}
+	if err := h.repo.UpdateSystemConfig(r.Context(), cfg); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.collector.Reschedule()
+	logger.Info("[流量收集器] 收集计划已更新", "schedule", schedule, "timezone", timezone, "concurrency", cfg.CollectorConcurrency, "panel_interval_ms", cfg.CollectorPanelInterval)
+
+	resp, err := h.status(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func (h *trafficCollectorHandler) handleCollect(w http.ResponseWriter, r *http.Request) {
+	logger.Info("[流量收集器] 手动触发流量收集")
+	if err := h.collector.Collect(r.Context()); err != nil {
+		if errors.Is(err, ErrCollectorBusy) {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	resp, err := h.status(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,569 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	// liveTrafficResyncInterval 定期重新读取配置，启动或停止探针连接
+	liveTrafficResyncInterval = time.Minute
+	// liveTrafficReadTimeout 超过该时间未收到数据视为连接断开
+	liveTrafficReadTimeout = 30 * time.Second
+	liveTrafficMinBackoff  = 5 * time.Second
+	liveTrafficMaxBackoff  = time.Minute
+	// liveTrafficCycleRefresh 账单周期用量换算写库，按该间隔刷新而不是每帧计算
+	liveTrafficCycleRefresh = time.Minute
+	// liveTrafficOnlineWindow 服务器最后上报时间在该窗口内视为在线
+	liveTrafficOnlineWindow = 30 * time.Second
+	// liveTrafficStreamInterval SSE 推送间隔
+	liveTrafficStreamInterval = 2 * time.Second
+)
+
+// liveServerState 单台服务器的实时流量状态
+type liveServerState struct {
+	configID    int64
+	configName  string
+	server      storage.ProbeServer
+	online      bool
+	netInSpeed  int64
+	netOutSpeed int64
+	rawUsed     int64
+	cycleOffset int64
+	offsetAt    time.Time
+	updatedAt   time.Time
+}
+
+// liveStream 一个探针配置的 WebSocket 连接
+type liveStream struct {
+	signature string
+	cancel    context.CancelFunc
+}
+
+// LiveTrafficCollector keeps WebSocket connections to the Nezha panels open and maintains an
+// in-memory view of the current traffic of every configured server. It only runs while live
+// traffic is enabled in the system config.
+type LiveTrafficCollector struct {
+	summary *TrafficSummaryHandler
+	repo    *storage.TrafficRepository
+	reload  chan struct{}
+
+	mu      sync.RWMutex
+	servers map[string]*liveServerState
+	streams map[int64]*liveStream
+}
+
+var globalLiveTraffic atomic.Pointer[LiveTrafficCollector]
+
+// NewLiveTrafficCollector creates the live traffic collector; Run starts it.
+func NewLiveTrafficCollector(summary *TrafficSummaryHandler, repo *storage.TrafficRepository) *LiveTrafficCollector {
+	if summary == nil || repo == nil {
+		panic("live traffic collector requires summary handler and repository")
+	}
+
+	c := &LiveTrafficCollector{
+		summary: summary,
+		repo:    repo,
+		reload:  make(chan struct{}, 1),
+		servers: make(map[string]*liveServerState),
+		streams: make(map[int64]*liveStream),
+	}
+	globalLiveTraffic.Store(c)
+	return c
+}
+
+// ReloadLiveTraffic makes the live collector re-read the system and probe configs immediately.
+func ReloadLiveTraffic() {
+	c := globalLiveTraffic.Load()
+	if c == nil {
+		return
+	}
+	select {
+	case c.reload <- struct{}{}:
+	default:
+	}
+}
+
+// Run 维护探针连接直到 ctx 取消
+func (c *LiveTrafficCollector) Run(ctx context.Context) {
+	ticker := time.NewTicker(liveTrafficResyncInterval)
+	defer ticker.Stop()
+
+	for {
+		c.syncStreams(ctx)
+		select {
+		case <-ctx.Done():
+			c.stopAll()
+			return
+		case <-ticker.C:
+		case <-c.reload:
+		}
+	}
+}
+
+// liveStreamSignature 配置变化（地址、服务器列表等）时重新建立连接
+func liveStreamSignature(cfg storage.ProbeConfig) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s|%d", cfg.Address, cfg.UpdatedAt.UnixNano())
+	for _, srv := range cfg.Servers {
+		fmt.Fprintf(&b, "|%s:%s:%s:%d:%d", srv.ServerID, srv.Name, srv.TrafficMethod, srv.MonthlyTrafficBytes, srv.ResetDay)
+	}
+	return b.String()
+}
+
+func (c *LiveTrafficCollector) syncStreams(ctx context.Context) {
+	desired := make(map[int64]storage.ProbeConfig)
+
+	sysCfg, err := c.repo.GetSystemConfig(ctx)
+	if err != nil {
+		logger.Warn("[实时流量] 读取系统配置失败", "error", err)
+		return
+	}
+	if sysCfg.LiveTraffic && !IsAirGappedMode() {
+		configs, err := c.repo.ListProbeConfigs(ctx)
+		if err != nil {
+			logger.Warn("[实时流量] 读取探针配置失败", "error", err)
+			return
+		}
+		for _, cfg := range configs {
+			if cfg.ProbeType == storage.ProbeTypeNezha && len(cfg.Servers) > 0 {
+				desired[cfg.ID] = cfg
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, stream := range c.streams {
+		cfg, ok := desired[id]
+		if ok && liveStreamSignature(cfg) == stream.signature {
+			delete(desired, id)
+			continue
+		}
+		stream.cancel()
+		delete(c.streams, id)
+		c.dropServersLocked(id)
+	}
+
+	for id, cfg := range desired {
+		streamCtx, cancel := context.WithCancel(ctx)
+		c.streams[id] = &liveStream{signature: liveStreamSignature(cfg), cancel: cancel}
+		go c.runStream(streamCtx, cfg)
+	}
+}
+
+func (c *LiveTrafficCollector) stopAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, stream := range c.streams {
+		stream.cancel()
+		delete(c.streams, id)
+	}
+	c.servers = make(map[string]*liveServerState)
+}
+
+func (c *LiveTrafficCollector) dropServersLocked(configID int64) {
+	for key, state := range c.servers {
+		if state.configID == configID {
+			delete(c.servers, key)
+		}
+	}
+}
+
+// runStream 保持单个探针的连接，断开后按指数退避重连
+func (c *LiveTrafficCollector) runStream(ctx context.Context, cfg storage.ProbeConfig) {
+	logger.Info("[实时流量] 连接探针", "config", cfg.Name)
+	backoff := liveTrafficMinBackoff
+	for {
+		received, err := c.stream(ctx, cfg)
+		if ctx.Err() != nil {
+			logger.Info("[实时流量] 探针连接已停止", "config", cfg.Name)
+			return
+		}
+		if received {
+			backoff = liveTrafficMinBackoff
+		}
+		logger.Warn("[实时流量] 探针连接中断，准备重连", "config", cfg.Name, "delay", backoff, "error", err)
+
+		c.markOffline(cfg.ID)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, liveTrafficMaxBackoff)
+	}
+}
+
+// nezhaWebSocketURL 将探针地址转换为哪吒 v1 的服务器状态 WebSocket 地址
+func nezhaWebSocketURL(address string) (string, error) {
+	base, err := url.Parse(strings.TrimSpace(address))
+	if err != nil {
+		return "", fmt.Errorf("invalid probe address: %w", err)
+	}
+
+	switch strings.ToLower(base.Scheme) {
+	case "", "http":
+		base.Scheme = "ws"
+	case "https":
+		base.Scheme = "wss"
+	case "ws", "wss":
+		// keep as is
+	default:
+		base.Scheme = "wss"
+	}
+
+	return base.ResolveReference(&url.URL{Path: "/api/v1/ws/server"}).String(), nil
+}
+
+// stream 读取探针推送的服务器状态直到出错；received 表示本次连接是否收到过数据
+func (c *LiveTrafficCollector) stream(ctx context.Context, cfg storage.ProbeConfig) (received bool, err error) {
+	target, err := nezhaWebSocketURL(cfg.Address)
+	if err != nil {
+		return false, err
+	}
+
+	authCtx, err := withProbeConfigAuth(ctx, c.summary.client, cfg)
+	if err != nil {
+		return false, err
+	}
+
+	dialCtx, cancel := context.WithTimeout(authCtx, 10*time.Second)
+	defer cancel()
+	conn, resp, err := websocket.DefaultDialer.DialContext(dialCtx, target, probeAuthHeader(authCtx))
+	if err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return false, fmt.Errorf("connect probe websocket: %w", err)
+	}
+	defer conn.Close()
+
+	// ctx 取消时关闭连接以结束阻塞的读取
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(liveTrafficReadTimeout)); err != nil {
+			return received, err
+		}
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return received, fmt.Errorf("read probe websocket: %w", err)
+		}
+		if err := c.applyFrame(authCtx, cfg, message); err != nil {
+			logger.Warn("[实时流量] 解析探针数据失败", "config", cfg.Name, "error", err)
+			continue
+		}
+		received = true
+	}
+}
+
+type liveNezhaServer struct {
+	ID         json.Number `json:"id"`
+	LastActive time.Time   `json:"last_active"`
+	State      struct {
+		NetInTransfer  json.Number `json:"net_in_transfer"`
+		NetOutTransfer json.Number `json:"net_out_transfer"`
+		NetInSpeed     json.Number `json:"net_in_speed"`
+		NetOutSpeed    json.Number `json:"net_out_speed"`
+	} `json:"state"`
+}
+
+// applyFrame 将一帧服务器状态写入实时视图
+func (c *LiveTrafficCollector) applyFrame(ctx context.Context, cfg storage.ProbeConfig, message []byte) error {
+	message = bytes.TrimSpace(message)
+	if len(message) == 0 {
+		return errors.New("empty probe websocket payload")
+	}
+
+	var snapshot struct {
+		Servers []liveNezhaServer `json:"servers"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(message))
+	decoder.UseNumber()
+	if message[0] == '[' {
+		var frames []struct {
+			Servers []liveNezhaServer `json:"servers"`
+		}
+		if err := decoder.Decode(&frames); err != nil {
+			return err
+		}
+		if len(frames) == 0 {
+			return errors.New("probe websocket payload missing frames")
+		}
+		snapshot.Servers = frames[len(frames)-1].Servers
+	} else if err := decoder.Decode(&snapshot); err != nil {
+		return err
+	}
+
+	observed := make(map[string]liveNezhaServer, len(snapshot.Servers))
+	for _, entry := range snapshot.Servers {
+		id := strings.TrimSpace(entry.ID.String())
+		if v, err := entry.ID.Int64(); err == nil {
+			id = strconv.FormatInt(v, 10)
+		}
+		observed[id] = entry
+	}
+
+	now := time.Now()
+	for _, srv := range cfg.Servers {
+		entry, ok := observed[strings.TrimSpace(srv.ServerID)]
+		if !ok {
+			continue
+		}
+
+		raw := computeServerUsage(srv, jsonNumberToInt64(entry.State.NetOutTransfer), jsonNumberToInt64(entry.State.NetInTransfer))
+		key := collectionServerKey(cfg.ID, srv.ServerID)
+
+		c.mu.RLock()
+		state := c.servers[key]
+		refreshOffset := state == nil || now.Sub(state.offsetAt) >= liveTrafficCycleRefresh
+		c.mu.RUnlock()
+
+		offset := int64(0)
+		if refreshOffset {
+			offset = raw - c.summary.cycleUsage(ctx, cfg.ID, srv, raw)
+		}
+
+		c.mu.Lock()
+		if _, streaming := c.streams[cfg.ID]; !streaming {
+			c.mu.Unlock()
+			return nil
+		}
+		state = c.servers[key]
+		if state == nil {
+			state = &liveServerState{configID: cfg.ID}
+			c.servers[key] = state
+		}
+		if refreshOffset {
+			state.cycleOffset = offset
+			state.offsetAt = now
+		}
+		state.configName = cfg.Name
+		state.server = srv
+		state.rawUsed = raw
+		state.netInSpeed = jsonNumberToInt64(entry.State.NetInSpeed)
+		state.netOutSpeed = jsonNumberToInt64(entry.State.NetOutSpeed)
+		state.online = entry.LastActive.IsZero() || now.Sub(entry.LastActive) < liveTrafficOnlineWindow
+		state.updatedAt = now
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+func (c *LiveTrafficCollector) markOffline(configID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, state := range c.servers {
+		if state.configID == configID {
+			state.online = false
+			state.netInSpeed = 0
+			state.netOutSpeed = 0
+		}
+	}
+}
+
+type liveTrafficServer struct {
+	ConfigID     int64     `json:"config_id"`
+	ConfigName   string    `json:"config_name"`
+	ServerID     string    `json:"server_id"`
+	Name         string    `json:"name"`
+	Online       bool      `json:"online"`
+	NetInSpeed   int64     `json:"net_in_speed"`  // bytes/s
+	NetOutSpeed  int64     `json:"net_out_speed"` // bytes/s
+	UsedGB       float64   `json:"used_gb"`
+	LimitGB      float64   `json:"limit_gb"`
+	UsagePercent float64   `json:"usage_percentage"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	includeInSum bool
+	usedBytes    int64
+	limitBytes   int64
+}
+
+type liveTrafficTotals struct {
+	UsedGB       float64 `json:"used_gb"`
+	LimitGB      float64 `json:"limit_gb"`
+	UsagePercent float64 `json:"usage_percentage"`
+	NetInSpeed   int64   `json:"net_in_speed"`
+	NetOutSpeed  int64   `json:"net_out_speed"`
+}
+
+type liveTrafficResponse struct {
+	Enabled bool                `json:"enabled"`
+	Unit    string              `json:"unit"`
+	Servers []liveTrafficServer `json:"servers"`
+	Total   liveTrafficTotals   `json:"total"`
+	At      time.Time           `json:"at"`
+}
+
+// snapshot 生成实时视图；filter 非空时只包含绑定的探针服务器
+func (c *LiveTrafficCollector) snapshot(filter map[string]struct{}, unitSize float64) []liveTrafficServer {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	servers := make([]liveTrafficServer, 0, len(c.servers))
+	for _, state := range c.servers {
+		if filter != nil {
+			if _, ok := filter[strings.TrimSpace(state.server.Name)]; !ok {
+				continue
+			}
+		}
+
+		used := max(state.rawUsed-state.cycleOffset, 0)
+		limit := state.server.MonthlyTrafficBytes
+		if limit > 0 && used > limit {
+			used = limit
+		}
+		servers = append(servers, liveTrafficServer{
+			ConfigID:     state.configID,
+			ConfigName:   state.configName,
+			ServerID:     state.server.ServerID,
+			Name:         state.server.Name,
+			Online:       state.online,
+			NetInSpeed:   state.netInSpeed,
+			NetOutSpeed:  state.netOutSpeed,
+			UsedGB:       roundUpTwoDecimals(bytesToUnit(used, unitSize)),
+			LimitGB:      roundUpTwoDecimals(bytesToUnit(limit, unitSize)),
+			UsagePercent: roundUpTwoDecimals(usagePercentage(used, limit)),
+			UpdatedAt:    state.updatedAt,
+			includeInSum: state.server.IncludeInTotal,
+			usedBytes:    used,
+			limitBytes:   limit,
+		})
+	}
+
+	sort.Slice(servers, func(i, j int) bool {
+		if servers[i].ConfigID != servers[j].ConfigID {
+			return servers[i].ConfigID < servers[j].ConfigID
+		}
+		return servers[i].Name < servers[j].Name
+	})
+	return servers
+}
+
+type liveTrafficHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewLiveTrafficHandler serves the live traffic view at /api/traffic/live. With ?stream=1 (or an
+// Accept: text/event-stream header) the view is pushed as server-sent events every few seconds.
+func NewLiveTrafficHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("live traffic handler requires repository")
+	}
+
+	return &liveTrafficHandler{repo: repo}
+}
+
+func (h *liveTrafficHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	ctx := r.Context()
+	var filter map[string]struct{}
+	if username := auth.UsernameFromContext(ctx); username != "" {
+		filter = boundProbeServerFilter(ctx, h.repo, username)
+	}
+
+	if r.URL.Query().Get("stream") == "1" || strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		h.serveStream(w, r, filter)
+		return
+	}
+
+	resp, err := h.build(ctx, filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func (h *liveTrafficHandler) build(ctx context.Context, filter map[string]struct{}) (liveTrafficResponse, error) {
+	cfg, err := h.repo.GetSystemConfig(ctx)
+	if err != nil {
+		return liveTrafficResponse{}, err
+	}
+
+	unitSize := trafficUnitSize(cfg.TrafficUnit)
+	resp := liveTrafficResponse{
+		Enabled: cfg.LiveTraffic,
+		Unit:    trafficUnitLabel(cfg.TrafficUnit),
+		Servers: []liveTrafficServer{},
+		At:      time.Now(),
+	}
+
+	collector := globalLiveTraffic.Load()
+	if collector == nil || !cfg.LiveTraffic {
+		return resp, nil
+	}
+
+	resp.Servers = collector.snapshot(filter, unitSize)
+	var used, limit int64
+	for _, srv := range resp.Servers {
+		resp.Total.NetInSpeed += srv.NetInSpeed
+		resp.Total.NetOutSpeed += srv.NetOutSpeed
+		if srv.includeInSum {
+			used += srv.usedBytes
+			limit += srv.limitBytes
+		}
+	}
+	resp.Total.UsedGB = roundUpTwoDecimals(bytesToUnit(used, unitSize))
+	resp.Total.LimitGB = roundUpTwoDecimals(bytesToUnit(limit, unitSize))
+	resp.Total.UsagePercent = roundUpTwoDecimals(usagePercentage(used, limit))
+	return resp, nil
+}
+
+func (h *liveTrafficHandler) serveStream(w http.ResponseWriter, r *http.Request, filter map[string]struct{}) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "SSE not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	ticker := time.NewTicker(liveTrafficStreamInterval)
+	defer ticker.Stop()
+
+	for {
+		resp, err := h.build(r.Context(), filter)
+		if err != nil {
+			return
+		}
+		data, _ := json.Marshal(resp)
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
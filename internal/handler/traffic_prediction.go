@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/storage"
+)
+
+// predictionTrendDays 预测时使用最近若干天的日均用量，记录不足时退回整个周期的日均值
+const predictionTrendDays = 7
+
+type trafficPrediction struct {
+	ProjectedUsedGB     float64                 `json:"projected_used_gb"`
+	LimitGB             float64                 `json:"limit_gb"`
+	ProjectedPercentage float64                 `json:"projected_percentage"`
+	ExceedsQuota        bool                    `json:"exceeds_quota"`
+	Servers             []serverTrafficForecast `json:"servers"`
+}
+
+type serverTrafficForecast struct {
+	ServerID            int64   `json:"server_id"`
+	ConfigID            int64   `json:"config_id"`
+	Name                string  `json:"name"`
+	CycleStart          string  `json:"cycle_start"`
+	CycleEnd            string  `json:"cycle_end"` // exclusive: the day the next cycle starts
+	UsedGB              float64 `json:"used_gb"`
+	LimitGB             float64 `json:"limit_gb"`
+	DailyAverageGB      float64 `json:"daily_average_gb"`
+	ProjectedUsedGB     float64 `json:"projected_used_gb"`
+	ProjectedPercentage float64 `json:"projected_percentage"`
+	ExceedsQuota        bool    `json:"exceeds_quota"`
+	ExceedsOn           string  `json:"exceeds_on,omitempty"` // predicted day the quota runs out
+}
+
+// serverForecast 单台服务器的预测结果（字节）
+type serverForecast struct {
+	used      int64
+	projected int64
+	daily     float64
+	exceedsOn time.Time
+}
+
+// civilDay 将时间截断为其所在日期（UTC 零点），便于按天计算间隔
+func civilDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func daysBetween(from, to time.Time) int {
+	return int(civilDay(to).Sub(civilDay(from)).Hours() / 24)
+}
+
+// serverCycleBounds 返回服务器当前账单周期的起止日期；未设置重置日时按自然月计算
+func serverCycleBounds(now time.Time, srv storage.ProbeServer) (time.Time, time.Time) {
+	if srv.ResetDay <= 0 {
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 1, 0)
+	}
+
+	start := storage.ProbeServerCycleStart(now, srv.ResetDay, srv.ResetTimezone)
+	// 周期不超过 31 天，往后 32 天必然落在下一个周期内
+	end := storage.ProbeServerCycleStart(start.AddDate(0, 0, 32), srv.ResetDay, srv.ResetTimezone)
+	return start, end
+}
+
+// forecastServer 根据周期内的每日快照推算周期结束时的用量。
+// 日均值优先取最近 predictionTrendDays 天，反映近期的使用趋势
+func forecastServer(records []storage.ProbeServerTrafficRecord, cycleStart, cycleEnd time.Time, limit int64) (serverForecast, bool) {
+	if len(records) == 0 {
+		return serverForecast{}, false
+	}
+
+	latest := records[len(records)-1]
+	var daily float64
+	if elapsed := daysBetween(cycleStart, latest.Date) + 1; elapsed > 0 {
+		daily = float64(latest.UsedBytes) / float64(elapsed)
+	}
+	for _, record := range records[:len(records)-1] {
+		span := daysBetween(record.Date, latest.Date)
+		if span > predictionTrendDays || record.UsedBytes > latest.UsedBytes {
+			continue
+		}
+		daily = float64(latest.UsedBytes-record.UsedBytes) / float64(span)
+		break
+	}
+
+	remaining := max(daysBetween(latest.Date, cycleEnd)-1, 0)
+	forecast := serverForecast{
+		used:      latest.UsedBytes,
+		projected: latest.UsedBytes + int64(math.Round(daily*float64(remaining))),
+		daily:     daily,
+	}
+	if limit > 0 && forecast.projected > limit {
+		if latest.UsedBytes >= limit {
+			forecast.exceedsOn = latest.Date
+		} else if daily > 0 {
+			days := int(math.Ceil(float64(limit-latest.UsedBytes) / daily))
+			forecast.exceedsOn = latest.Date.AddDate(0, 0, days)
+		}
+	}
+	return forecast, true
+}
+
+// predictUsage 基于每日快照预测各探针服务器（以及计入总量的服务器合计）在账单周期结束时的用量。
+// 开启探针绑定的用户只看到绑定的服务器；没有任何快照时返回 nil
+func (h *TrafficSummaryHandler) predictUsage(ctx context.Context, username string, unitSize float64) (*trafficPrediction, error) {
+	if h.repo == nil {
+		return nil, nil
+	}
+
+	var filter map[string]struct{}
+	if username != "" {
+		filter = boundProbeServerFilter(ctx, h.repo, username)
+	}
+
+	configs, err := h.repo.ListProbeConfigs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := h.rolloverNow(ctx)
+
+	prediction := &trafficPrediction{Servers: []serverTrafficForecast{}}
+	var projectedTotal, limitTotal int64
+	for _, cfg := range configs {
+		for _, srv := range cfg.Servers {
+			if filter != nil {
+				if _, ok := filter[strings.TrimSpace(srv.Name)]; !ok {
+					continue
+				}
+			}
+
+			cycleStart, cycleEnd := serverCycleBounds(now, srv)
+			records, err := h.repo.ListProbeServerDaily(ctx, cfg.ID, srv.ServerID, cycleStart)
+			if err != nil {
+				return nil, err
+			}
+			forecast, ok := forecastServer(records, cycleStart, cycleEnd, srv.MonthlyTrafficBytes)
+			if !ok {
+				continue
+			}
+
+			limit := srv.MonthlyTrafficBytes
+			entry := serverTrafficForecast{
+				ServerID:            srv.ID,
+				ConfigID:            cfg.ID,
+				Name:                srv.Name,
+				CycleStart:          cycleStart.Format("2006-01-02"),
+				CycleEnd:            cycleEnd.Format("2006-01-02"),
+				UsedGB:              roundUpTwoDecimals(bytesToUnit(forecast.used, unitSize)),
+				LimitGB:             roundUpTwoDecimals(bytesToUnit(limit, unitSize)),
+				DailyAverageGB:      roundUpTwoDecimals(forecast.daily / unitSize),
+				ProjectedUsedGB:     roundUpTwoDecimals(bytesToUnit(forecast.projected, unitSize)),
+				ProjectedPercentage: roundUpTwoDecimals(usagePercentage(forecast.projected, limit)),
+				ExceedsQuota:        limit > 0 && forecast.projected > limit,
+			}
+			if !forecast.exceedsOn.IsZero() {
+				entry.ExceedsOn = forecast.exceedsOn.Format("2006-01-02")
+			}
+			prediction.Servers = append(prediction.Servers, entry)
+
+			if srv.IncludeInTotal {
+				projectedTotal += forecast.projected
+				limitTotal += limit
+			}
+		}
+	}
+
+	if len(prediction.Servers) == 0 {
+		return nil, nil
+	}
+
+	prediction.ProjectedUsedGB = roundUpTwoDecimals(bytesToUnit(projectedTotal, unitSize))
+	prediction.LimitGB = roundUpTwoDecimals(bytesToUnit(limitTotal, unitSize))
+	prediction.ProjectedPercentage = roundUpTwoDecimals(usagePercentage(projectedTotal, limitTotal))
+	prediction.ExceedsQuota = limitTotal > 0 && projectedTotal > limitTotal
+	return prediction, nil
+}
@@ -23,7 +23,10 @@ import (
 	"miaomiaowu/internal/storage"
 )
 
-const bytesPerGigabyte = 1073741824.0
+const (
+	bytesPerGigabyte        = 1073741824.0
+	bytesPerDecimalGigabyte = 1000000000.0
+)
 
 type TrafficSummaryHandler struct {
 	client *http.Client
@@ -31,8 +34,9 @@ type TrafficSummaryHandler struct {
 }
 
 type trafficSummaryResponse struct {
-	Metrics trafficSummaryMetrics `json:"metrics"`
-	History []trafficDailyUsage   `json:"history"`
+	Metrics    trafficSummaryMetrics `json:"metrics"`
+	History    []trafficDailyUsage   `json:"history"`
+	Prediction *trafficPrediction    `json:"prediction,omitempty"`
 }
 
 type trafficSummaryMetrics struct {
@@ -40,6 +44,7 @@ type trafficSummaryMetrics struct {
 	TotalUsedGB      float64 `json:"total_used_gb"`
 	TotalRemainingGB float64 `json:"total_remaining_gb"`
 	UsagePercentage  float64 `json:"usage_percentage"`
+	Unit             string  `json:"unit"` // "GiB" (binary) or "GB" (decimal)
 }
 
 type trafficDailyUsage struct {
@@ -120,21 +125,31 @@ func (h *TrafficSummaryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 		logger.Info("[流量] 记录快照失败", "error", err)
 	}
 
-	history, err := h.loadHistory(ctx, 30)
+	trafficUnit := h.trafficUnit(ctx)
+	unitSize := trafficUnitSize(trafficUnit)
+
+	history, err := h.loadHistory(ctx, 30, unitSize)
 	if err != nil {
 		logger.Info("[流量] 加载历史记录失败", "error", err)
 	}
 
+	prediction, err := h.predictUsage(ctx, username, unitSize)
+	if err != nil {
+		logger.Info("[流量] 计算用量预测失败", "error", err)
+	}
+
 	metrics := trafficSummaryMetrics{
-		TotalLimitGB:     roundUpTwoDecimals(bytesToGigabytes(totalLimit)),
-		TotalUsedGB:      roundUpTwoDecimals(bytesToGigabytes(totalUsed)),
-		TotalRemainingGB: roundUpTwoDecimals(bytesToGigabytes(totalRemaining)),
+		TotalLimitGB:     roundUpTwoDecimals(bytesToUnit(totalLimit, unitSize)),
+		TotalUsedGB:      roundUpTwoDecimals(bytesToUnit(totalUsed, unitSize)),
+		TotalRemainingGB: roundUpTwoDecimals(bytesToUnit(totalRemaining, unitSize)),
 		UsagePercentage:  roundUpTwoDecimals(usagePercentage(totalUsed, totalLimit)),
+		Unit:             trafficUnitLabel(trafficUnit),
 	}
 
 	response := trafficSummaryResponse{
-		Metrics: metrics,
-		History: history,
+		Metrics:    metrics,
+		History:    history,
+		Prediction: prediction,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -147,7 +162,7 @@ func (h *TrafficSummaryHandler) RecordDailyUsage(ctx context.Context) error {
 	var totalLimit, totalRemaining, totalUsed int64
 	var probeErr error
 
-	totalLimit, totalRemaining, totalUsed, probeErr = h.fetchTotals(ctx, "", nil)
+	totalLimit, totalRemaining, totalUsed, probeErr = h.collectProbeTotals(ctx)
 	if probeErr != nil {
 		if errors.Is(probeErr, storage.ErrProbeConfigNotFound) {
 			logger.Info("[流量记录] 探针未配置，仅使用外部订阅流量")
@@ -229,6 +244,11 @@ func (h *TrafficSummaryHandler) syncAndFetchExternalSubscriptionTraffic(ctx cont
 		return 0, 0
 	}
 
+	if IsAirGappedMode() {
+		logger.Info("[流量记录] 离线模式已启用，跳过外部订阅同步")
+		return 0, 0
+	}
+
 	// Get all external subscriptions from all users
 	subs, err := h.repo.ListAllExternalSubscriptions(ctx)
 	if err != nil {
@@ -302,9 +322,10 @@ func (h *TrafficSummaryHandler) fetchExternalSubscriptionTrafficInfo(ctx context
 	if userAgent == "" {
 		userAgent = "clash-meta/2.4.0"
 	}
-	req.Header.Set("User-Agent", userAgent)
+	applySubscriptionRequestHeaders(req, userAgent, sub.Headers)
 
-	resp, err := h.client.Do(req)
+	client := externalSubscriptionClient(&sub, 15*time.Second, h.client)
+	resp, err := client.Do(req)
 	if err != nil {
 		return sub, fmt.Errorf("fetch subscription: %w", err)
 	}
@@ -362,39 +383,72 @@ func (h *TrafficSummaryHandler) fetchTotals(ctx context.Context, username string
 		}
 	} else if username != "" {
 		// No explicit filter provided, check if probe binding is enabled for this user
-		userSettings, err := h.repo.GetUserSettings(ctx, username)
-		if err == nil && userSettings.EnableProbeBinding {
-			// Get all nodes for this user
-			nodes, err := h.repo.ListNodes(ctx, username)
-			if err == nil {
-				// Collect unique probe server names that are bound to nodes
-				boundProbeServers := make(map[string]struct{})
-				for _, node := range nodes {
-					name := strings.TrimSpace(node.ProbeServer)
-					if name != "" {
-						boundProbeServers[name] = struct{}{}
-					}
-				}
-
-				if len(boundProbeServers) > 0 {
-					probeFilter = boundProbeServers
-				} else {
-					logger.Info("[Traffic Fetch] Probe binding enabled but no nodes have bound servers, returning zero traffic")
-					return 0, 0, 0, nil
-				}
+		if boundProbeServers := boundProbeServerFilter(ctx, h.repo, username); boundProbeServers != nil {
+			if len(boundProbeServers) == 0 {
+				logger.Info("[Traffic Fetch] Probe binding enabled but no nodes have bound servers, returning zero traffic")
+				return 0, 0, 0, nil
 			}
+			probeFilter = boundProbeServers
 		}
 	}
 
-	cfg, err := h.repo.GetProbeConfig(ctx)
+	configs, err := h.repo.ListProbeConfigs(ctx)
 	if err != nil {
 		return 0, 0, 0, err
 	}
+	if len(configs) == 0 {
+		return 0, 0, 0, storage.ErrProbeConfigNotFound
+	}
+
+	// 多个探针配置的流量累加，单个探针失败不影响其他探针
+	var totalLimit, totalRemaining, totalUsed int64
+	var firstErr error
+	succeeded := 0
+	for _, cfg := range configs {
+		limit, remaining, used, err := h.fetchConfigTotals(ctx, cfg, probeFilter)
+		if err != nil {
+			logger.Warn("[流量获取] 探针配置获取流量失败", "config", cfg.Name, "type", cfg.ProbeType, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		succeeded++
+		totalLimit += limit
+		totalRemaining += remaining
+		totalUsed += used
+	}
+
+	if succeeded == 0 {
+		return 0, 0, 0, firstErr
+	}
 
+	return totalLimit, totalRemaining, totalUsed, nil
+}
+
+// fetchConfigTotals returns limit/remaining/used for a single probe configuration, honoring the probe filter.
+func (h *TrafficSummaryHandler) fetchConfigTotals(ctx context.Context, cfg storage.ProbeConfig, probeFilter map[string]struct{}) (int64, int64, int64, error) {
 	if len(cfg.Servers) == 0 {
 		return 0, 0, 0, errors.New("no probe servers configured")
 	}
 
+	// Drop servers that are excluded from the global total (e.g. monitoring-only hosts)
+	includedServers := make([]storage.ProbeServer, 0, len(cfg.Servers))
+	for _, srv := range cfg.Servers {
+		if !srv.IncludeInTotal {
+			logger.Info("[流量获取] 服务器不计入总流量，已跳过", "server_id", srv.ServerID, "name", srv.Name)
+			continue
+		}
+		includedServers = append(includedServers, srv)
+	}
+
+	if len(includedServers) == 0 {
+		logger.Info("[流量获取] 所有探针服务器均不计入总流量，返回零流量")
+		return 0, 0, 0, nil
+	}
+
+	cfg.Servers = includedServers
+
 	// Apply probe filter if one was determined
 	if probeFilter != nil {
 		filteredServers := make([]storage.ProbeServer, 0, len(cfg.Servers))
@@ -431,11 +485,23 @@ func (h *TrafficSummaryHandler) fetchTotals(ctx context.Context, username string
 	}
 
 	logger.Info("[流量获取] 探针信息",
+		"config", cfg.Name,
 		"type", cfg.ProbeType,
 		"address", cfg.Address,
 		"server_count", len(cfg.Servers),
 		"server_ids", serverIDs)
 
+	// 离线模式下不访问探针面板，使用探针推送的数据
+	if IsAirGappedMode() {
+		return h.fetchPushedTotals(ctx, cfg)
+	}
+
+	// 私有探针面板需携带令牌或账号密码
+	ctx, err := withProbeConfigAuth(ctx, h.client, cfg)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
 	switch cfg.ProbeType {
 	case storage.ProbeTypeNezha:
 		return h.fetchNezhaTotals(ctx, cfg)
@@ -445,6 +511,10 @@ func (h *TrafficSummaryHandler) fetchTotals(ctx context.Context, username string
 		return h.fetchBatchSummary(ctx, cfg.Address, serverIDs)
 	case storage.ProbeTypeKomari:
 		return h.fetchKomariTotals(ctx, cfg)
+	case storage.ProbeTypeUptimeKuma:
+		// Uptime Kuma 只提供在线状态，流量统计依赖外部订阅
+		logger.Info("[流量获取] Uptime Kuma 探针不提供流量数据")
+		return 0, 0, 0, nil
 	default:
 		return 0, 0, 0, fmt.Errorf("unsupported probe type: %s", cfg.ProbeType)
 	}
@@ -478,7 +548,7 @@ func (h *TrafficSummaryHandler) fetchNezhaTotals(ctx context.Context, cfg storag
 	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	conn, resp, err := websocket.DefaultDialer.DialContext(dialCtx, target.String(), nil)
+	conn, resp, err := websocket.DefaultDialer.DialContext(dialCtx, target.String(), probeAuthHeader(ctx))
 	if err != nil {
 		if resp != nil {
 			resp.Body.Close()
@@ -589,15 +659,8 @@ func (h *TrafficSummaryHandler) fetchNezhaTotals(ctx context.Context, cfg storag
 			continue
 		}
 
-		var used int64
-		switch strings.ToLower(strings.TrimSpace(srv.TrafficMethod)) {
-		case storage.TrafficMethodUp:
-			used = wsEntry.NetOut
-		case storage.TrafficMethodDown:
-			used = wsEntry.NetIn
-		default:
-			used = wsEntry.NetIn + wsEntry.NetOut
-		}
+		used := computeServerUsage(srv, wsEntry.NetOut, wsEntry.NetIn)
+		used = h.cycleUsage(ctx, cfg.ID, srv, used)
 
 		if used < 0 {
 			used = 0
@@ -605,6 +668,7 @@ func (h *TrafficSummaryHandler) fetchNezhaTotals(ctx context.Context, cfg storag
 		if srv.MonthlyTrafficBytes > 0 && used > srv.MonthlyTrafficBytes {
 			used = srv.MonthlyTrafficBytes
 		}
+		h.recordServerUsage(ctx, cfg.ID, srv, used)
 
 		logger.Info("[Nezha] 服务器流量",
 			"server_id", id,
@@ -648,6 +712,7 @@ func (h *TrafficSummaryHandler) fetchNezhaV0Totals(ctx context.Context, cfg stor
 	if err != nil {
 		return 0, 0, 0, err
 	}
+	applyProbeAuth(req)
 
 	type nezhaV0Server struct {
 		ID     json.Number `json:"id"`
@@ -748,15 +813,8 @@ func (h *TrafficSummaryHandler) fetchNezhaV0Totals(ctx context.Context, cfg stor
 			continue
 		}
 
-		var used int64
-		switch strings.ToLower(strings.TrimSpace(srv.TrafficMethod)) {
-		case storage.TrafficMethodUp:
-			used = entry.NetOut
-		case storage.TrafficMethodDown:
-			used = entry.NetIn
-		default:
-			used = entry.NetIn + entry.NetOut
-		}
+		used := computeServerUsage(srv, entry.NetOut, entry.NetIn)
+		used = h.cycleUsage(ctx, cfg.ID, srv, used)
 
 		if used < 0 {
 			used = 0
@@ -764,6 +822,7 @@ func (h *TrafficSummaryHandler) fetchNezhaV0Totals(ctx context.Context, cfg stor
 		if srv.MonthlyTrafficBytes > 0 && used > srv.MonthlyTrafficBytes {
 			used = srv.MonthlyTrafficBytes
 		}
+		h.recordServerUsage(ctx, cfg.ID, srv, used)
 
 		logger.Info("[Nezha V0] 服务器流量",
 			"server_id", id,
@@ -828,6 +887,7 @@ func (h *TrafficSummaryHandler) fetchKomariTotals(ctx context.Context, cfg stora
 	if err != nil {
 		return 0, 0, 0, err
 	}
+	applyProbeAuth(req)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
 
@@ -900,15 +960,8 @@ func (h *TrafficSummaryHandler) fetchKomariTotals(ctx context.Context, cfg stora
 			continue
 		}
 
-		var used int64
-		switch strings.ToLower(strings.TrimSpace(srv.TrafficMethod)) {
-		case storage.TrafficMethodUp:
-			used = usage.Up
-		case storage.TrafficMethodDown:
-			used = usage.Down
-		default:
-			used = usage.Up + usage.Down
-		}
+		used := computeServerUsage(srv, usage.Up, usage.Down)
+		used = h.cycleUsage(ctx, cfg.ID, srv, used)
 
 		if used < 0 {
 			used = 0
@@ -916,6 +969,7 @@ func (h *TrafficSummaryHandler) fetchKomariTotals(ctx context.Context, cfg stora
 		if srv.MonthlyTrafficBytes > 0 && used > srv.MonthlyTrafficBytes {
 			used = srv.MonthlyTrafficBytes
 		}
+		h.recordServerUsage(ctx, cfg.ID, srv, used)
 
 		logger.Info("[Komari] 服务器流量",
 			"server_id", id,
@@ -954,6 +1008,7 @@ func (h *TrafficSummaryHandler) fetchBatchTraffic(ctx context.Context, base *url
 	if err != nil {
 		return 0, 0, 0, err
 	}
+	applyProbeAuth(req)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("User-Agent", "miaomiaowu/0.1")
@@ -1013,6 +1068,69 @@ func (h *TrafficSummaryHandler) fetchBatchTraffic(ctx context.Context, base *url
 	return totalLimit, totalRemaining, totalUsed, nil
 }
 
+// computeServerUsage applies the server's traffic counting method to the observed upload/download bytes.
+func computeServerUsage(srv storage.ProbeServer, up, down int64) int64 {
+	switch strings.ToLower(strings.TrimSpace(srv.TrafficMethod)) {
+	case storage.TrafficMethodUp:
+		return up
+	case storage.TrafficMethodDown:
+		return down
+	case storage.TrafficMethodMax:
+		if up > down {
+			return up
+		}
+		return down
+	case storage.TrafficMethodSumMultiplier:
+		multiplier := srv.TrafficMultiplier
+		if multiplier <= 0 {
+			multiplier = 1
+		}
+		return int64(math.Round(float64(up+down) * multiplier))
+	default:
+		return up + down
+	}
+}
+
+// boundProbeServerFilter returns the probe server names bound to the user's nodes when probe binding
+// is enabled (empty when none are bound), or nil when the user's traffic is not filtered.
+func boundProbeServerFilter(ctx context.Context, repo *storage.TrafficRepository, username string) map[string]struct{} {
+	userSettings, err := repo.GetUserSettings(ctx, username)
+	if err != nil || !userSettings.EnableProbeBinding {
+		return nil
+	}
+
+	nodes, err := repo.ListNodes(ctx, username)
+	if err != nil {
+		return nil
+	}
+
+	// Collect unique probe server names that are bound to nodes
+	boundProbeServers := make(map[string]struct{})
+	for _, node := range nodes {
+		name := strings.TrimSpace(node.ProbeServer)
+		if name != "" {
+			boundProbeServers[name] = struct{}{}
+		}
+	}
+	return boundProbeServers
+}
+
+// cycleUsage converts the probe's cumulative counter into usage for the server's own billing cycle.
+// Servers without a reset day keep the counter as reported by the probe.
+func (h *TrafficSummaryHandler) cycleUsage(ctx context.Context, configID int64, srv storage.ProbeServer, used int64) int64 {
+	if srv.ResetDay <= 0 {
+		return used
+	}
+
+	cycleStart := storage.ProbeServerCycleStart(time.Now(), srv.ResetDay, srv.ResetTimezone)
+	cycleUsed, err := h.repo.ApplyProbeServerCycle(ctx, configID, srv.ServerID, cycleStart, used)
+	if err != nil {
+		logger.Warn("[流量统计] 计算账单周期用量失败，使用探针原始数据", "server_id", srv.ServerID, "error", err)
+		return used
+	}
+	return cycleUsed
+}
+
 func jsonNumberToInt64(n json.Number) int64 {
 	if n == "" {
 		return 0
@@ -1034,11 +1152,42 @@ func roundUpTwoDecimals(value float64) float64 {
 }
 
 func bytesToGigabytes(total int64) float64 {
-	if total <= 0 {
+	return bytesToUnit(total, bytesPerGigabyte)
+}
+
+func bytesToUnit(total int64, unitSize float64) float64 {
+	if total <= 0 || unitSize <= 0 {
 		return 0
 	}
 
-	return float64(total) / bytesPerGigabyte
+	return float64(total) / unitSize
+}
+
+// trafficUnitSize returns the number of bytes in one reported "GB" for the given unit preference.
+func trafficUnitSize(unit string) float64 {
+	if unit == storage.TrafficUnitDecimal {
+		return bytesPerDecimalGigabyte
+	}
+	return bytesPerGigabyte
+}
+
+func trafficUnitLabel(unit string) string {
+	if unit == storage.TrafficUnitDecimal {
+		return "GB"
+	}
+	return "GiB"
+}
+
+// trafficUnit returns the instance-wide unit preference, falling back to binary units.
+func (h *TrafficSummaryHandler) trafficUnit(ctx context.Context) string {
+	if h.repo == nil {
+		return storage.TrafficUnitBinary
+	}
+	cfg, err := h.repo.GetSystemConfig(ctx)
+	if err != nil {
+		return storage.TrafficUnitBinary
+	}
+	return cfg.TrafficUnit
 }
 
 func usagePercentage(used, limit int64) float64 {
@@ -1054,10 +1203,10 @@ func (h *TrafficSummaryHandler) recordSnapshot(ctx context.Context, totalLimit,
 		return nil
 	}
 
-	return h.repo.RecordDaily(ctx, time.Now(), totalLimit, totalUsed, totalRemaining)
+	return h.repo.RecordDaily(ctx, h.rolloverNow(ctx), totalLimit, totalUsed, totalRemaining)
 }
 
-func (h *TrafficSummaryHandler) loadHistory(ctx context.Context, days int) ([]trafficDailyUsage, error) {
+func (h *TrafficSummaryHandler) loadHistory(ctx context.Context, days int, unitSize float64) ([]trafficDailyUsage, error) {
 	if h.repo == nil {
 		return nil, nil
 	}
@@ -1093,7 +1242,7 @@ func (h *TrafficSummaryHandler) loadHistory(ctx context.Context, days int) ([]tr
 
 		usages = append(usages, trafficDailyUsage{
 			Date:   record.Date.Format("2006-01-02"),
-			UsedGB: roundUpTwoDecimals(bytesToGigabytes(delta)),
+			UsedGB: roundUpTwoDecimals(bytesToUnit(delta, unitSize)),
 		})
 	}
 
@@ -1213,7 +1362,7 @@ func (h *TrafficSummaryHandler) fetchNezhaV0TotalsViaWebSocket(ctx context.Conte
 	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	conn, resp, err := websocket.DefaultDialer.DialContext(dialCtx, target.String(), nil)
+	conn, resp, err := websocket.DefaultDialer.DialContext(dialCtx, target.String(), probeAuthHeader(ctx))
 	if err != nil {
 		if resp != nil {
 			resp.Body.Close()
@@ -1318,6 +1467,6 @@ func writeError(w http.ResponseWriter, status int, err error) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(map[string]string{
-		"error": err.Error(),
+		"error": logger.Redact(err.Error()),
 	})
 }
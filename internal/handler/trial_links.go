@@ -0,0 +1,509 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	// maxTrialDurationHours 试用账号最长有效期（30 天）
+	maxTrialDurationHours = 30 * 24
+	// maxTrialLinkUses 单个试用链接允许创建的最多账号数
+	maxTrialLinkUses = 1000
+)
+
+type trialLinkRequest struct {
+	Code            string     `json:"code"`
+	SubscriptionIDs []int64    `json:"subscription_ids"`
+	MaxNodes        int        `json:"max_nodes"`
+	TrafficQuota    int64      `json:"traffic_quota"` // 字节
+	DurationHours   int        `json:"duration_hours"`
+	MaxUses         int        `json:"max_uses"`
+	ExpiresAt       *time.Time `json:"expires_at"` // 链接本身的过期时间
+	Note            string     `json:"note"`
+}
+
+type trialLinkResponse struct {
+	ID              int64      `json:"id"`
+	Code            string     `json:"code"`
+	SubscriptionIDs []int64    `json:"subscription_ids"`
+	MaxNodes        int        `json:"max_nodes"`
+	TrafficQuota    int64      `json:"traffic_quota"`
+	DurationHours   int        `json:"duration_hours"`
+	MaxUses         int        `json:"max_uses"`
+	UsedCount       int        `json:"used_count"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+	Usable          bool       `json:"usable"`
+	Note            string     `json:"note"`
+	CreatedBy       string     `json:"created_by"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+type trialAccountResponse struct {
+	Username     string    `json:"username"`
+	TrialLinkID  int64     `json:"trial_link_id"`
+	ClientIP     string    `json:"client_ip"`
+	MaxNodes     int       `json:"max_nodes"`
+	TrafficQuota int64     `json:"traffic_quota"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	Expired      bool      `json:"expired"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type trialRedeemRequest struct {
+	Code string `json:"code"`
+}
+
+type trialSubscriptionEntry struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+func convertTrialLinkResponse(link storage.TrialLink) trialLinkResponse {
+	subscriptionIDs := link.SubscriptionIDs
+	if subscriptionIDs == nil {
+		subscriptionIDs = []int64{}
+	}
+	return trialLinkResponse{
+		ID:              link.ID,
+		Code:            link.Code,
+		SubscriptionIDs: subscriptionIDs,
+		MaxNodes:        link.MaxNodes,
+		TrafficQuota:    link.TrafficQuota,
+		DurationHours:   link.DurationHours,
+		MaxUses:         link.MaxUses,
+		UsedCount:       link.UsedCount,
+		ExpiresAt:       link.ExpiresAt,
+		Usable:          link.Usable(time.Now()),
+		Note:            link.Note,
+		CreatedBy:       link.CreatedBy,
+		CreatedAt:       link.CreatedAt,
+	}
+}
+
+type trialLinksHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewTrialLinksHandler lets admins list (GET), create (POST) and revoke (DELETE ?id=) trial links.
+// GET ?accounts=1 lists the trial accounts instead, optionally filtered by ?id=.
+func NewTrialLinksHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("trial links handler requires repository")
+	}
+
+	return &trialLinksHandler{repo: repo}
+}
+
+func (h *trialLinksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Query().Get("accounts") != "" {
+			h.handleListAccounts(w, r)
+			return
+		}
+		h.handleList(w, r)
+	case http.MethodPost:
+		h.handleCreate(w, r)
+	case http.MethodDelete:
+		h.handleDelete(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+
+func (h *trialLinksHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	links, err := h.repo.ListTrialLinks(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]trialLinkResponse, 0, len(links))
+	for _, link := range links {
+		items = append(items, convertTrialLinkResponse(link))
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"trial_links": items})
+}
+
+func (h *trialLinksHandler) handleListAccounts(w http.ResponseWriter, r *http.Request) {
+	var linkID int64
+	if raw := strings.TrimSpace(r.URL.Query().Get("id")); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed <= 0 {
+			writeBadRequest(w, "试用链接 ID 无效")
+			return
+		}
+		linkID = parsed
+	}
+
+	accounts, err := h.repo.ListTrialAccounts(r.Context(), linkID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	now := time.Now()
+	items := make([]trialAccountResponse, 0, len(accounts))
+	for _, account := range accounts {
+		items = append(items, trialAccountResponse{
+			Username:     account.Username,
+			TrialLinkID:  account.TrialLinkID,
+			ClientIP:     account.ClientIP,
+			MaxNodes:     account.MaxNodes,
+			TrafficQuota: account.TrafficQuota,
+			ExpiresAt:    account.ExpiresAt,
+			Expired:      !account.ExpiresAt.After(now),
+			CreatedAt:    account.CreatedAt,
+		})
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"accounts": items})
+}
+
+func (h *trialLinksHandler) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var payload trialLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	if len(payload.SubscriptionIDs) == 0 {
+		writeBadRequest(w, "请至少选择一个订阅")
+		return
+	}
+	if payload.MaxUses < 0 || payload.MaxUses > maxTrialLinkUses {
+		writeBadRequest(w, fmt.Sprintf("可用次数需在 1-%d 之间", maxTrialLinkUses))
+		return
+	}
+	if payload.DurationHours < 0 || payload.DurationHours > maxTrialDurationHours {
+		writeBadRequest(w, fmt.Sprintf("试用时长需在 1-%d 小时之间", maxTrialDurationHours))
+		return
+	}
+	if payload.MaxNodes < 0 {
+		writeBadRequest(w, "节点数不能为负数")
+		return
+	}
+	if payload.TrafficQuota < 0 {
+		writeBadRequest(w, "流量配额不能为负数")
+		return
+	}
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		writeBadRequest(w, "过期时间必须晚于当前时间")
+		return
+	}
+	code := strings.ToUpper(strings.TrimSpace(payload.Code))
+	if code != "" && !registerUsernamePattern.MatchString(code) {
+		writeBadRequest(w, "试用码只能包含字母、数字和 _ . -，长度 3-32")
+		return
+	}
+
+	subscriptionIDs := make([]int64, 0, len(payload.SubscriptionIDs))
+	seen := make(map[int64]struct{}, len(payload.SubscriptionIDs))
+	for _, id := range payload.SubscriptionIDs {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		if _, err := h.repo.GetSubscribeFileByID(r.Context(), id); err != nil {
+			if errors.Is(err, storage.ErrSubscribeFileNotFound) {
+				writeBadRequest(w, fmt.Sprintf("订阅 %d 不存在", id))
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		subscriptionIDs = append(subscriptionIDs, id)
+	}
+
+	link, err := h.repo.CreateTrialLink(r.Context(), storage.TrialLink{
+		Code:            code,
+		SubscriptionIDs: subscriptionIDs,
+		MaxNodes:        payload.MaxNodes,
+		TrafficQuota:    payload.TrafficQuota,
+		DurationHours:   payload.DurationHours,
+		MaxUses:         payload.MaxUses,
+		ExpiresAt:       payload.ExpiresAt,
+		Note:            payload.Note,
+		CreatedBy:       auth.UsernameFromContext(r.Context()),
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrTrialLinkExists) {
+			writeError(w, http.StatusConflict, errors.New("试用码已存在"))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	recordAudit(r.Context(), "trial_link.create", strconv.FormatInt(link.ID, 10), "",
+		fmt.Sprintf("max_uses=%d duration_hours=%d max_nodes=%d traffic_quota=%d subscriptions=%v", link.MaxUses, link.DurationHours, link.MaxNodes, link.TrafficQuota, link.SubscriptionIDs))
+
+	respondJSON(w, http.StatusCreated, map[string]any{"trial_link": convertTrialLinkResponse(link)})
+}
+
+func (h *trialLinksHandler) handleDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeBadRequest(w, "试用链接 ID 无效")
+		return
+	}
+
+	if err := h.repo.DeleteTrialLink(r.Context(), id); err != nil {
+		if errors.Is(err, storage.ErrTrialLinkNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	recordAudit(r.Context(), "trial_link.delete", strconv.FormatInt(id, 10), "", "")
+	respondJSON(w, http.StatusOK, map[string]any{"status": "deleted"})
+}
+
+// NewTrialRedeemHandler creates a trial account the first time a client opens a trial link (public,
+// rate limited per client IP). Revisiting the link from the same IP returns the existing account's
+// subscription links instead of creating another one; the password is only returned on creation.
+func NewTrialRedeemHandler(repo *storage.TrafficRepository, rateLimiter *LoginRateLimiter) http.Handler {
+	if repo == nil {
+		panic("trial redeem handler requires repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+
+		var payload trialRedeemRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&payload); err != nil {
+			writeBadRequest(w, "请求数据格式错误")
+			return
+		}
+		code := strings.TrimSpace(payload.Code)
+		if code == "" {
+			writeBadRequest(w, "缺少试用码")
+			return
+		}
+
+		clientIP := getClientIP(r)
+
+		// 试用码可被暴力猜测，与登录共用限流
+		if rateLimiter != nil {
+			if err := rateLimiter.Check(clientIP, ""); err != nil {
+				writeError(w, http.StatusTooManyRequests, errors.New("too many attempts, please try again later"))
+				return
+			}
+		}
+
+		invalid := func() {
+			if rateLimiter != nil {
+				rateLimiter.RecordFailure(clientIP, "")
+			}
+			logger.Warn("🎁 [TRIAL_FAIL] 试用链接无效或已用完", "client_ip", clientIP)
+			writeError(w, http.StatusForbidden, errors.New("试用链接无效、已过期或已用完"))
+		}
+
+		link, err := repo.GetTrialLinkByCode(r.Context(), code)
+		if err != nil {
+			if errors.Is(err, storage.ErrTrialLinkNotFound) {
+				invalid()
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		// 同一 IP 再次打开链接时返回已创建的账号
+		if account, err := repo.FindActiveTrialAccount(r.Context(), link.ID, clientIP, time.Now()); err == nil {
+			respondTrialAccount(w, r, repo, account, "", http.StatusOK)
+			return
+		} else if !errors.Is(err, storage.ErrTrialAccountNotFound) {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		password, err := generateRandomPassword(12)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		var account storage.TrialAccount
+		for attempt := 0; attempt < 3; attempt++ {
+			suffix, genErr := generateRandomPassword(8)
+			if genErr != nil {
+				writeError(w, http.StatusInternalServerError, genErr)
+				return
+			}
+			_, account, err = repo.RedeemTrialLink(r.Context(), storage.TrialRedemption{
+				Code:         code,
+				Username:     "trial_" + strings.ToLower(suffix),
+				PasswordHash: string(hash),
+				ClientIP:     clientIP,
+			})
+			if !errors.Is(err, storage.ErrUserExists) {
+				break
+			}
+		}
+		if err != nil {
+			if errors.Is(err, storage.ErrTrialLinkInvalid) {
+				invalid()
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		logger.Info("🎁 [TRIAL_OK] 试用账号已创建",
+			"username", account.Username,
+			"trial_link_id", link.ID,
+			"expires_at", account.ExpiresAt,
+			"client_ip", clientIP)
+
+		respondTrialAccount(w, r, repo, account, password, http.StatusCreated)
+	})
+}
+
+// respondTrialAccount 返回试用账号的到期时间、限制和订阅链接
+func respondTrialAccount(w http.ResponseWriter, r *http.Request, repo *storage.TrafficRepository, account storage.TrialAccount, password string, status int) {
+	token, err := repo.GetOrCreateUserToken(r.Context(), account.Username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	files, err := repo.GetUserSubscriptions(r.Context(), account.Username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	subscriptions := make([]trialSubscriptionEntry, 0, len(files))
+	for _, file := range files {
+		query := url.Values{}
+		query.Set("filename", file.Filename)
+		query.Set("token", token)
+		subscriptions = append(subscriptions, trialSubscriptionEntry{
+			Name: file.Name,
+			URL:  panelBaseURL(r) + "/api/clash/subscribe?" + query.Encode(),
+		})
+	}
+
+	response := map[string]any{
+		"username":      account.Username,
+		"expires_at":    account.ExpiresAt,
+		"max_nodes":     account.MaxNodes,
+		"traffic_quota": account.TrafficQuota,
+		"subscriptions": subscriptions,
+	}
+	if password != "" {
+		response["password"] = password
+	}
+	respondJSON(w, status, response)
+}
+
+// lookupTrialAccount 返回用户的试用限制，普通账号返回 false
+func lookupTrialAccount(ctx context.Context, repo *storage.TrafficRepository, username string) (storage.TrialAccount, bool) {
+	if repo == nil || username == "" {
+		return storage.TrialAccount{}, false
+	}
+	account, err := repo.GetTrialAccount(ctx, username)
+	if err != nil {
+		if !errors.Is(err, storage.ErrTrialAccountNotFound) {
+			logger.Warn("[试用账号] 读取试用限制失败", "user", username, "error", err)
+		}
+		return storage.TrialAccount{}, false
+	}
+	return account, true
+}
+
+// limitTrialProxies 只保留 YAML 中前 maxNodes 个节点，并从代理组中移除其余节点
+func limitTrialProxies(data []byte, maxNodes int) ([]byte, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	if len(root.Content) == 0 {
+		return data, nil
+	}
+	doc := root.Content[0]
+	proxiesNode := mappingValue(doc, "proxies")
+	if proxiesNode == nil || proxiesNode.Kind != yaml.SequenceNode || len(proxiesNode.Content) <= maxNodes {
+		return data, nil
+	}
+
+	kept := make(map[string]bool, maxNodes)
+	for _, node := range proxiesNode.Content[:maxNodes] {
+		kept[mappingScalar(node, "name")] = true
+	}
+	removed := make(map[string]bool)
+	for _, node := range proxiesNode.Content[maxNodes:] {
+		if name := mappingScalar(node, "name"); !kept[name] {
+			removed[name] = true
+		}
+	}
+	proxiesNode.Content = proxiesNode.Content[:maxNodes]
+
+	if groupsNode := mappingValue(doc, "proxy-groups"); groupsNode != nil {
+		rewriteProxyGroupReferences(groupsNode, removed, nil)
+		fillEmptyProxyGroups(groupsNode)
+	}
+
+	output, err := MarshalYAMLWithIndent(&root)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(RemoveUnicodeEscapeQuotes(string(output))), nil
+}
+
+// CleanupExpiredTrialAccounts 删除已到期的试用账号及其节点、订阅绑定、令牌等数据。
+// 管理员延长了有效期或取消到期时间的账号会保留
+func CleanupExpiredTrialAccounts(ctx context.Context, repo *storage.TrafficRepository) error {
+	if repo == nil {
+		return errors.New("trial cleanup requires repository")
+	}
+
+	accounts, err := repo.ListTrialAccounts(ctx, 0)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, account := range accounts {
+		// 以账号当前的到期时间为准，管理员可能调整过
+		user, err := repo.GetUser(ctx, account.Username)
+		if err != nil {
+			logger.Warn("[试用账号] 读取试用账号失败", "user", account.Username, "error", err)
+			continue
+		}
+		if user.ExpiresAt == nil || user.ExpiresAt.After(now) {
+			continue
+		}
+		if err := repo.DeleteUser(ctx, account.Username); err != nil {
+			logger.Warn("[试用账号] 清理到期试用账号失败", "user", account.Username, "error", err)
+			continue
+		}
+		removeLocalAvatar(user.AvatarURL)
+		logger.Info("[试用账号] 已清理到期试用账号", "user", account.Username, "trial_link_id", account.TrialLinkID)
+	}
+	return nil
+}
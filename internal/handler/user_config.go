@@ -20,6 +20,7 @@ type userConfigRequest struct {
 	CacheExpireMinutes      int     `json:"cache_expire_minutes"`
 	SyncTraffic             bool    `json:"sync_traffic"`
 	EnableProbeBinding      bool    `json:"enable_probe_binding"`
+	AutoDisableOverQuota    *bool   `json:"auto_disable_over_quota"` // nil keeps current value
 	CustomRulesEnabled      bool    `json:"custom_rules_enabled"`
 	EnableShortLink         bool    `json:"enable_short_link"`
 	UseNewTemplateSystem    *bool   `json:"use_new_template_system"` // nil means not provided, default true
@@ -39,6 +40,7 @@ type userConfigResponse struct {
 	CacheExpireMinutes      int     `json:"cache_expire_minutes"`
 	SyncTraffic             bool    `json:"sync_traffic"`
 	EnableProbeBinding      bool    `json:"enable_probe_binding"`
+	AutoDisableOverQuota    bool    `json:"auto_disable_over_quota"` // Disable bound nodes while their probe server is over quota
 	CustomRulesEnabled      bool    `json:"custom_rules_enabled"`
 	EnableShortLink         bool    `json:"enable_short_link"`
 	UseNewTemplateSystem    bool    `json:"use_new_template_system"`
@@ -48,6 +50,7 @@ type userConfigResponse struct {
 	ClientCompatibilityMode bool    `json:"client_compatibility_mode"` // Auto-filter incompatible nodes for clients
 	SilentMode              bool    `json:"silent_mode"`               // Silent mode: return 404 for all requests except subscription
 	SilentModeTimeout       int     `json:"silent_mode_timeout"`       // Minutes to allow access after subscription fetch
+
 }
 
 func NewUserConfigHandler(repo *storage.TrafficRepository) http.Handler {
@@ -120,6 +123,7 @@ func handleGetUserConfig(w http.ResponseWriter, r *http.Request, repo *storage.T
 		CacheExpireMinutes:      settings.CacheExpireMinutes,
 		SyncTraffic:             settings.SyncTraffic,
 		EnableProbeBinding:      settings.EnableProbeBinding,
+		AutoDisableOverQuota:    settings.AutoDisableOverQuota,
 		CustomRulesEnabled:      true, // 自定义规则始终启用
 		EnableShortLink:         settings.EnableShortLink,
 		UseNewTemplateSystem:    settings.UseNewTemplateSystem,
@@ -182,6 +186,13 @@ func handleUpdateUserConfig(w http.ResponseWriter, r *http.Request, repo *storag
 		return
 	}
 
+	autoDisableOverQuota := false
+	if payload.AutoDisableOverQuota != nil {
+		autoDisableOverQuota = *payload.AutoDisableOverQuota
+	} else if current, err := repo.GetUserSettings(r.Context(), username); err == nil {
+		autoDisableOverQuota = current.AutoDisableOverQuota
+	}
+
 	settings := storage.UserSettings{
 		Username:             username,
 		ForceSyncExternal:    payload.ForceSyncExternal,
@@ -191,6 +202,7 @@ func handleUpdateUserConfig(w http.ResponseWriter, r *http.Request, repo *storag
 		CacheExpireMinutes:   cacheExpireMinutes,
 		SyncTraffic:          payload.SyncTraffic,
 		EnableProbeBinding:   payload.EnableProbeBinding,
+		AutoDisableOverQuota: autoDisableOverQuota,
 		CustomRulesEnabled:   true, // 自定义规则始终启用
 		EnableShortLink:      payload.EnableShortLink,
 		UseNewTemplateSystem: useNewTemplateSystem,
@@ -208,16 +220,20 @@ func handleUpdateUserConfig(w http.ResponseWriter, r *http.Request, repo *storag
 	if silentModeTimeout <= 0 {
 		silentModeTimeout = 15
 	}
-	systemConfig := storage.SystemConfig{
-		ProxyGroupsSourceURL:    proxyGroupsSourceURL,
-		ClientCompatibilityMode: payload.ClientCompatibilityMode,
-		SilentMode:              payload.SilentMode,
-		SilentModeTimeout:       silentModeTimeout,
+	systemConfig, err := repo.GetSystemConfig(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("get system config: %w", err))
+		return
 	}
+	systemConfig.ProxyGroupsSourceURL = proxyGroupsSourceURL
+	systemConfig.ClientCompatibilityMode = payload.ClientCompatibilityMode
+	systemConfig.SilentMode = payload.SilentMode
+	systemConfig.SilentModeTimeout = silentModeTimeout
 	if err := repo.UpdateSystemConfig(r.Context(), systemConfig); err != nil {
 		writeError(w, http.StatusInternalServerError, fmt.Errorf("update system config: %w", err))
 		return
 	}
+	InvalidateConversionCache()
 
 	resp := userConfigResponse{
 		ForceSyncExternal:       settings.ForceSyncExternal,
@@ -227,6 +243,7 @@ func handleUpdateUserConfig(w http.ResponseWriter, r *http.Request, repo *storag
 		CacheExpireMinutes:      settings.CacheExpireMinutes,
 		SyncTraffic:             settings.SyncTraffic,
 		EnableProbeBinding:      settings.EnableProbeBinding,
+		AutoDisableOverQuota:    settings.AutoDisableOverQuota,
 		CustomRulesEnabled:      true, // 自定义规则始终启用
 		EnableShortLink:         settings.EnableShortLink,
 		UseNewTemplateSystem:    settings.UseNewTemplateSystem,
@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+// maxExpiringUsersDays 即将到期账号列表允许查询的最大天数
+const maxExpiringUsersDays = 365
+
+type userExpiryRequest struct {
+	Username  string     `json:"username"`
+	ExpiresAt *time.Time `json:"expires_at"` // null 表示永不到期
+}
+
+type expiringUserEntry struct {
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Nickname  string    `json:"nickname"`
+	IsActive  bool      `json:"is_active"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Expired   bool      `json:"expired"`
+	DaysLeft  int       `json:"days_left"`
+}
+
+// NewUserExpiryHandler sets or clears the expiry date of a user account (POST).
+func NewUserExpiryHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("user expiry handler requires repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, errors.New("only POST is supported"))
+			return
+		}
+
+		var payload userExpiryRequest
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		username := strings.TrimSpace(payload.Username)
+		if username == "" {
+			writeError(w, http.StatusBadRequest, errors.New("username is required"))
+			return
+		}
+
+		targetUser, err := repo.GetUser(r.Context(), username)
+		if err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				writeError(w, http.StatusNotFound, errors.New("user not found"))
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if targetUser.Role == storage.RoleAdmin && payload.ExpiresAt != nil {
+			writeError(w, http.StatusBadRequest, errors.New("不能为管理员设置到期时间"))
+			return
+		}
+
+		if err := repo.UpdateUserExpiry(r.Context(), username, payload.ExpiresAt); err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				writeError(w, http.StatusNotFound, errors.New("user not found"))
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		recordAudit(r.Context(), "user.expiry", username, formatUserExpiry(targetUser.ExpiresAt), formatUserExpiry(payload.ExpiresAt))
+
+		// 设置为已过去的时间时立即停用
+		if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) && targetUser.IsActive {
+			if err := DeactivateExpiredUsers(r.Context(), repo); err != nil {
+				logger.Warn("[账号到期] 停用到期账号失败", "user", username, "error", err)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
+	})
+}
+
+// NewExpiringUsersHandler lists accounts that expire within ?days= (default 7), including already expired ones.
+func NewExpiringUsersHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("expiring users handler requires repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errors.New("only GET is supported"))
+			return
+		}
+
+		days := expiringPlanNoticeDays
+		if raw := strings.TrimSpace(r.URL.Query().Get("days")); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed <= 0 || parsed > maxExpiringUsersDays {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("days 必须在 1-%d 之间", maxExpiringUsersDays))
+				return
+			}
+			days = parsed
+		}
+
+		users, err := repo.ListUsers(r.Context(), 1000)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		now := time.Now()
+		deadline := now.AddDate(0, 0, days)
+		entries := make([]expiringUserEntry, 0)
+		for _, user := range users {
+			if user.ExpiresAt == nil || user.ExpiresAt.After(deadline) {
+				continue
+			}
+			entry := expiringUserEntry{
+				Username:  user.Username,
+				Email:     user.Email,
+				Nickname:  user.Nickname,
+				IsActive:  user.IsActive,
+				ExpiresAt: *user.ExpiresAt,
+				Expired:   user.Expired(now),
+			}
+			if !entry.Expired {
+				entry.DaysLeft = int(user.ExpiresAt.Sub(now).Hours() / 24)
+			}
+			entries = append(entries, entry)
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].ExpiresAt.Before(entries[j].ExpiresAt) })
+
+		respondJSON(w, http.StatusOK, map[string]any{"days": days, "users": entries})
+	})
+}
+
+// DeactivateExpiredUsers 停用已到期的账号并通知管理员
+func DeactivateExpiredUsers(ctx context.Context, repo *storage.TrafficRepository) error {
+	if repo == nil {
+		return errors.New("user expiry requires repository")
+	}
+
+	expired, err := repo.DeactivateExpiredUsers(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	admins, err := listAdminUsernames(ctx, repo)
+	if err != nil {
+		logger.Warn("[账号到期] 获取管理员列表失败", "error", err)
+	}
+	day := time.Now().Format("2006-01-02")
+	for _, username := range expired {
+		logger.Info("[账号到期] 账号已到期，已自动停用", "user", username)
+		for _, admin := range admins {
+			notifyUser(ctx, repo, storage.Notification{
+				Username:  admin,
+				Type:      storage.NotificationTypeUserExpiry,
+				Title:     fmt.Sprintf("用户「%s」已到期", username),
+				Content:   "账号已自动停用，订阅链接不再可用",
+				DedupeKey: fmt.Sprintf("user_expired:%s:%s", username, day),
+			})
+		}
+	}
+	return nil
+}
+
+// NotifyExpiringUsers 提醒即将到期的用户本人
+func NotifyExpiringUsers(ctx context.Context, repo *storage.TrafficRepository) error {
+	if repo == nil {
+		return errors.New("user expiry requires repository")
+	}
+
+	users, err := repo.ListUsers(ctx, 1000)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	deadline := now.AddDate(0, 0, expiringPlanNoticeDays)
+	for _, user := range users {
+		if !user.IsActive || user.ExpiresAt == nil || user.Expired(now) || user.ExpiresAt.After(deadline) {
+			continue
+		}
+		daysLeft := int(user.ExpiresAt.Sub(now).Hours() / 24)
+		notifyUser(ctx, repo, storage.Notification{
+			Username:  user.Username,
+			Type:      storage.NotificationTypeUserExpiry,
+			Title:     "账号即将到期",
+			Content:   fmt.Sprintf("账号将于 %s 到期（剩余约 %d 天），到期后订阅链接将失效", user.ExpiresAt.Format("2006-01-02"), daysLeft),
+			DedupeKey: fmt.Sprintf("user_expiring:%s:%s", user.Username, user.ExpiresAt.Format("2006-01-02")),
+		})
+	}
+	return nil
+}
+
+func formatUserExpiry(expiresAt *time.Time) string {
+	if expiresAt == nil {
+		return "expires_at=never"
+	}
+	return "expires_at=" + expiresAt.UTC().Format(time.RFC3339)
+}
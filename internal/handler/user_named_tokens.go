@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	// maxUserNamedTokens 每个用户允许的命名令牌数量
+	maxUserNamedTokens = 20
+	// maxUserNamedTokenLabelLength 令牌名称的最大字符数
+	maxUserNamedTokenLabelLength = 64
+)
+
+type userNamedTokenRequest struct {
+	Label     string     `json:"label"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type userNamedTokenResponse struct {
+	ID         int64      `json:"id"`
+	Label      string     `json:"label"`
+	Token      string     `json:"token"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	Expired    bool       `json:"expired"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func convertUserNamedToken(token storage.UserNamedToken) userNamedTokenResponse {
+	return userNamedTokenResponse{
+		ID:         token.ID,
+		Label:      token.Label,
+		Token:      token.Token,
+		ExpiresAt:  token.ExpiresAt,
+		Expired:    token.Expired(time.Now()),
+		LastUsedAt: token.LastUsedAt,
+		CreatedAt:  token.CreatedAt,
+	}
+}
+
+type userNamedTokensHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewUserNamedTokensHandler lets users list (GET), create (POST) and revoke (DELETE ?id=) labeled
+// subscription tokens. Named tokens are accepted everywhere the primary user token is.
+func NewUserNamedTokensHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("user named tokens handler requires repository")
+	}
+
+	return &userNamedTokensHandler{repo: repo}
+}
+
+func (h *userNamedTokensHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	username := auth.UsernameFromContext(r.Context())
+	if username == "" {
+		writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.handleList(w, r, username)
+	case http.MethodPost:
+		h.handleCreate(w, r, username)
+	case http.MethodDelete:
+		h.handleRevoke(w, r, username)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+
+func (h *userNamedTokensHandler) handleList(w http.ResponseWriter, r *http.Request, username string) {
+	tokens, err := h.repo.ListUserNamedTokens(r.Context(), username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]userNamedTokenResponse, 0, len(tokens))
+	for _, token := range tokens {
+		items = append(items, convertUserNamedToken(token))
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"tokens": items})
+}
+
+func (h *userNamedTokensHandler) handleCreate(w http.ResponseWriter, r *http.Request, username string) {
+	var payload userNamedTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	label := strings.TrimSpace(payload.Label)
+	if label == "" {
+		writeBadRequest(w, "令牌名称不能为空")
+		return
+	}
+	if utf8.RuneCountInString(label) > maxUserNamedTokenLabelLength {
+		writeBadRequest(w, "令牌名称过长")
+		return
+	}
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		writeBadRequest(w, "过期时间必须晚于当前时间")
+		return
+	}
+
+	existing, err := h.repo.ListUserNamedTokens(r.Context(), username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(existing) >= maxUserNamedTokens {
+		writeBadRequest(w, "令牌数量已达上限，请先撤销不再使用的令牌")
+		return
+	}
+
+	token, err := h.repo.CreateUserNamedToken(r.Context(), username, label, payload.ExpiresAt)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logger.Info("[用户令牌] 创建命名令牌", "user", username, "id", token.ID, "label", token.Label)
+
+	respondJSON(w, http.StatusCreated, map[string]any{"token": convertUserNamedToken(token)})
+}
+
+func (h *userNamedTokensHandler) handleRevoke(w http.ResponseWriter, r *http.Request, username string) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeBadRequest(w, "令牌 ID 无效")
+		return
+	}
+
+	if err := h.repo.RevokeUserNamedToken(r.Context(), id, username); err != nil {
+		if errors.Is(err, storage.ErrNamedTokenNotFound) {
+			writeError(w, http.StatusNotFound, errors.New("令牌不存在"))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logger.Info("[用户令牌] 撤销命名令牌", "user", username, "id", id)
+
+	respondJSON(w, http.StatusOK, map[string]any{"status": "revoked"})
+}
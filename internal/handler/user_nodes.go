@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+type userNodesHandler struct {
+	repo         *storage.TrafficRepository
+	subscribeDir string
+}
+
+// NewUserNodesHandler lists the nodes contained in the subscriptions assigned to the current user.
+// Only the name, region and status are exposed; credential-bearing fields stay admin-only.
+func NewUserNodesHandler(repo *storage.TrafficRepository, subscribeDir string) http.Handler {
+	if repo == nil {
+		panic("user nodes handler requires repository")
+	}
+
+	return &userNodesHandler{repo: repo, subscribeDir: subscribeDir}
+}
+
+func (h *userNodesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	username := auth.UsernameFromContext(r.Context())
+	if username == "" {
+		writeError(w, http.StatusUnauthorized, errors.New("用户未认证"))
+		return
+	}
+
+	files, err := h.repo.GetUserSubscriptions(r.Context(), username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	names := make(map[string]struct{})
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(h.subscribeDir, filepath.Base(file.Filename)))
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				logger.Warn("[用户节点] 读取订阅文件失败", "file", file.Filename, "error", err)
+			}
+			continue
+		}
+		var config struct {
+			Proxies []struct {
+				Name string `yaml:"name"`
+			} `yaml:"proxies"`
+		}
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			logger.Warn("[用户节点] 解析订阅文件失败", "file", file.Filename, "error", err)
+			continue
+		}
+		for _, proxy := range config.Proxies {
+			if proxy.Name != "" {
+				names[proxy.Name] = struct{}{}
+			}
+		}
+	}
+
+	nodes, err := h.nodeOwnersNodes(r, username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	result := make([]nodeSummaryDTO, 0, len(names))
+	seen := make(map[string]struct{}, len(names))
+	for _, node := range nodes {
+		if _, ok := names[node.NodeName]; !ok {
+			continue
+		}
+		if _, dup := seen[node.NodeName]; dup {
+			continue
+		}
+		seen[node.NodeName] = struct{}{}
+		result = append(result, convertNodeSummary(node))
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{"nodes": result})
+}
+
+// nodeOwnersNodes 返回管理员和当前用户名下的节点，订阅文件中的节点通常由管理员维护
+func (h *userNodesHandler) nodeOwnersNodes(r *http.Request, username string) ([]storage.Node, error) {
+	owners := []string{username}
+	admins, err := h.repo.ListAdminUsernames(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	for _, admin := range admins {
+		if admin != username {
+			owners = append(owners, admin)
+		}
+	}
+
+	var nodes []storage.Node
+	for _, owner := range owners {
+		owned, err := h.repo.ListNodes(r.Context(), owner)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, owned...)
+	}
+	return nodes, nil
+}
+
+// nodeSummaryDTO 普通用户可见的节点信息，不包含 raw_url / parsed_config 等带凭据的字段
+type nodeSummaryDTO struct {
+	ID       int64  `json:"id"`
+	UUID     string `json:"uuid"`
+	NodeName string `json:"node_name"`
+	Region   string `json:"region"`
+	Status   string `json:"status"`
+}
+
+func convertNodeSummary(node storage.Node) nodeSummaryDTO {
+	status := "disabled"
+	if node.Enabled {
+		status = "enabled"
+	}
+	return nodeSummaryDTO{
+		ID:       node.ID,
+		UUID:     node.UUID,
+		NodeName: node.NodeName,
+		Region:   node.ProbeAnnotations[annotationLocation],
+		Status:   status,
+	}
+}
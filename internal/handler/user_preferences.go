@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/storage"
+	"miaomiaowu/internal/substore"
+)
+
+// NewUserPreferencesHandler stores generic per-user UI/behavior preferences server-side.
+// GET 返回全部偏好设置；PUT/PATCH 合并提交的键值，值为 null 时删除该键
+func NewUserPreferencesHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("user preferences handler requires repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username := auth.UsernameFromContext(r.Context())
+		if strings.TrimSpace(username) == "" {
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			prefs, err := repo.GetUserPreferences(r.Context(), username)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			respondJSON(w, http.StatusOK, map[string]any{"preferences": prefs})
+		case http.MethodPut, http.MethodPatch:
+			var updates storage.UserPreferences
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, storage.MaxUserPreferencesSize)).Decode(&updates); err != nil {
+				writeBadRequest(w, "请求数据格式错误")
+				return
+			}
+
+			if err := validateUserPreferences(updates); err != nil {
+				writeBadRequest(w, err.Error())
+				return
+			}
+
+			prefs, err := repo.UpdateUserPreferences(r.Context(), username, updates)
+			if err != nil {
+				if errors.Is(err, storage.ErrUserPreferencesTooLarge) {
+					writeBadRequest(w, "偏好设置数据过大")
+					return
+				}
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			respondJSON(w, http.StatusOK, map[string]any{"preferences": prefs})
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodPatch)
+		}
+	})
+}
+
+// validateUserPreferences 校验已知偏好键的取值类型，未知键不做限制
+func validateUserPreferences(updates storage.UserPreferences) error {
+	for key, raw := range updates {
+		if string(raw) == "null" {
+			continue
+		}
+
+		switch key {
+		case storage.PreferenceDefaultTarget:
+			var target string
+			if err := json.Unmarshal(raw, &target); err != nil {
+				return fmt.Errorf("%s 必须是字符串", key)
+			}
+			if target != "" {
+				if _, err := substore.GetDefaultFactory().GetProducer(target); err != nil {
+					return fmt.Errorf("不支持的输出格式: %s", target)
+				}
+			}
+		case storage.PreferenceLanguage:
+			var language string
+			if err := json.Unmarshal(raw, &language); err != nil {
+				return fmt.Errorf("%s 必须是字符串", key)
+			}
+		case storage.PreferenceConfigLanguage:
+			var language string
+			if err := json.Unmarshal(raw, &language); err != nil {
+				return fmt.Errorf("%s 必须是字符串", key)
+			}
+			if language != "" && language != "zh" && language != "en" {
+				return fmt.Errorf("%s 只支持 zh 或 en", key)
+			}
+		case storage.PreferenceDefaultFilters:
+			var filters []string
+			if err := json.Unmarshal(raw, &filters); err != nil {
+				return fmt.Errorf("%s 必须是字符串数组", key)
+			}
+		}
+	}
+	return nil
+}
@@ -94,6 +94,11 @@ func NewUserSettingsHandler(repo *storage.TrafficRepository, tokens *auth.TokenS
 			return
 		}
 
+		// 头像被替换时清理旧的本地头像文件
+		if strings.TrimSpace(payload.AvatarURL) != currentUser.AvatarURL {
+			removeLocalAvatar(currentUser.AvatarURL)
+		}
+
 		user, err := repo.GetUser(r.Context(), username)
 		if err != nil {
 			writeError(w, http.StatusInternalServerError, err)
@@ -0,0 +1,311 @@
+package handler
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	maxSubscriptionImportSize = 2 << 20
+
+	subscriptionImportMerge   = "merge"
+	subscriptionImportReplace = "replace"
+)
+
+type subscriptionImportRowError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+type subscriptionImportUserReport struct {
+	Username string   `json:"username"`
+	Before   []string `json:"before"`
+	After    []string `json:"after"`
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+}
+
+type subscriptionImportReport struct {
+	DryRun  bool                           `json:"dry_run"`
+	Mode    string                         `json:"mode"`
+	Applied bool                           `json:"applied"`
+	Rows    int                            `json:"rows"`
+	Users   []subscriptionImportUserReport `json:"users"`
+	Errors  []subscriptionImportRowError   `json:"errors"`
+}
+
+// subscriptionImportRow 一行 CSV：用户名、订阅名称（或文件名）、动作（assign / unassign，默认 assign）
+type subscriptionImportRow struct {
+	line         int
+	username     string
+	subscription string
+	unassign     bool
+}
+
+type userSubscriptionsImportHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewUserSubscriptionsImportHandler bulk assigns/unassigns subscriptions from a CSV of
+// username,subscription[,action] rows (POST, raw text/csv body or multipart field "file").
+// ?dry_run=1 only reports the resulting changes; ?mode=replace makes each listed user end up with
+// exactly the assigned subscriptions instead of merging into the current ones. Nothing is applied
+// while any row has errors.
+func NewUserSubscriptionsImportHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("user subscriptions import handler requires repository")
+	}
+
+	return &userSubscriptionsImportHandler{repo: repo}
+}
+
+func (h *userSubscriptionsImportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	query := r.URL.Query()
+	dryRun, _ := strconv.ParseBool(query.Get("dry_run"))
+	mode := strings.ToLower(strings.TrimSpace(query.Get("mode")))
+	if mode == "" {
+		mode = subscriptionImportMerge
+	}
+	if mode != subscriptionImportMerge && mode != subscriptionImportReplace {
+		writeBadRequest(w, "mode 只能是 merge 或 replace")
+		return
+	}
+
+	body, err := readSubscriptionImportBody(w, r)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+	rows, rowErrors := parseSubscriptionImportCSV(body)
+	if len(rows) == 0 && len(rowErrors) == 0 {
+		writeBadRequest(w, "CSV 中没有可导入的数据")
+		return
+	}
+
+	report, plan, err := h.plan(r, rows, rowErrors, mode)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	report.DryRun = dryRun
+
+	if dryRun {
+		respondJSON(w, http.StatusOK, report)
+		return
+	}
+	if len(report.Errors) > 0 {
+		respondJSON(w, http.StatusUnprocessableEntity, report)
+		return
+	}
+
+	for _, username := range sortedKeys(plan) {
+		if err := h.repo.SetUserSubscriptions(r.Context(), username, plan[username]); err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("更新用户 %s 的订阅失败: %w", username, err))
+			return
+		}
+	}
+	report.Applied = true
+	recordAudit(r.Context(), "user.subscriptions_import", "", "", fmt.Sprintf("mode=%s rows=%d users=%d", mode, report.Rows, len(report.Users)))
+	logger.Info("[订阅分配] CSV 批量分配完成", "mode", mode, "rows", report.Rows, "users", len(report.Users))
+
+	respondJSON(w, http.StatusOK, report)
+}
+
+// plan 计算每个用户导入后的订阅 ID 列表，并生成报告
+func (h *userSubscriptionsImportHandler) plan(r *http.Request, rows []subscriptionImportRow, rowErrors []subscriptionImportRowError, mode string) (subscriptionImportReport, map[string][]int64, error) {
+	ctx := r.Context()
+	report := subscriptionImportReport{Mode: mode, Rows: len(rows), Errors: rowErrors, Users: []subscriptionImportUserReport{}}
+	if report.Errors == nil {
+		report.Errors = []subscriptionImportRowError{}
+	}
+
+	files, err := h.repo.ListSubscribeFiles(ctx)
+	if err != nil {
+		return report, nil, err
+	}
+	byName := make(map[string]storage.SubscribeFile, len(files)*2)
+	names := make(map[int64]string, len(files))
+	for _, file := range files {
+		names[file.ID] = file.Name
+		byName[strings.ToLower(file.Filename)] = file
+	}
+	// 名称优先于文件名
+	for _, file := range files {
+		byName[strings.ToLower(file.Name)] = file
+	}
+
+	current := make(map[string][]int64)
+	plan := make(map[string][]int64)
+	for _, row := range rows {
+		if _, ok := current[row.username]; !ok {
+			if _, err := h.repo.GetUser(ctx, row.username); err != nil {
+				if errors.Is(err, storage.ErrUserNotFound) {
+					report.Errors = append(report.Errors, subscriptionImportRowError{Line: row.line, Message: "用户不存在: " + row.username})
+					continue
+				}
+				return report, nil, err
+			}
+			ids, err := h.repo.GetUserSubscriptionIDs(ctx, row.username)
+			if err != nil {
+				return report, nil, err
+			}
+			current[row.username] = ids
+			if mode == subscriptionImportReplace {
+				plan[row.username] = []int64{}
+			} else {
+				plan[row.username] = slices.Clone(ids)
+			}
+		}
+
+		file, ok := byName[strings.ToLower(row.subscription)]
+		if !ok {
+			report.Errors = append(report.Errors, subscriptionImportRowError{Line: row.line, Message: "订阅不存在: " + row.subscription})
+			continue
+		}
+
+		ids := plan[row.username]
+		if row.unassign {
+			ids = slices.DeleteFunc(ids, func(id int64) bool { return id == file.ID })
+		} else if !slices.Contains(ids, file.ID) {
+			ids = append(ids, file.ID)
+		}
+		plan[row.username] = ids
+	}
+
+	for _, username := range sortedKeys(plan) {
+		before, after := current[username], plan[username]
+		entry := subscriptionImportUserReport{
+			Username: username,
+			Before:   subscriptionNames(before, names),
+			After:    subscriptionNames(after, names),
+			Added:    []string{},
+			Removed:  []string{},
+		}
+		for _, id := range after {
+			if !slices.Contains(before, id) {
+				entry.Added = append(entry.Added, names[id])
+			}
+		}
+		for _, id := range before {
+			if !slices.Contains(after, id) {
+				entry.Removed = append(entry.Removed, names[id])
+			}
+		}
+		report.Users = append(report.Users, entry)
+	}
+
+	return report, plan, nil
+}
+
+func subscriptionNames(ids []int64, names map[int64]string) []string {
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, names[id])
+	}
+	return result
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// readSubscriptionImportBody 读取 multipart 上传的 file 字段或原始请求体
+func readSubscriptionImportBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSubscriptionImportSize)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxSubscriptionImportSize); err != nil {
+			return nil, errors.New("解析上传文件失败")
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, errors.New("缺少上传文件 file")
+		}
+		defer file.Close()
+		return io.ReadAll(file)
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, errors.New("读取请求体失败")
+	}
+	return data, nil
+}
+
+// parseSubscriptionImportCSV 解析 CSV，首行为 username 开头时视为表头，空行和 # 开头的行会被忽略
+func parseSubscriptionImportCSV(data []byte) ([]subscriptionImportRow, []subscriptionImportRowError) {
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(data), "\ufeff")))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	var (
+		rows   []subscriptionImportRow
+		errs   []subscriptionImportRowError
+		header = true
+	)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				line = parseErr.Line
+			}
+			errs = append(errs, subscriptionImportRowError{Line: line, Message: "CSV 格式错误: " + err.Error()})
+			break
+		}
+
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+		if header {
+			header = false
+			if strings.EqualFold(record[0], "username") {
+				continue
+			}
+		}
+		if len(record) == 1 && record[0] == "" {
+			continue
+		}
+		if len(record) < 2 || record[0] == "" || record[1] == "" {
+			errs = append(errs, subscriptionImportRowError{Line: line, Message: "每行需要用户名和订阅名称"})
+			continue
+		}
+
+		row := subscriptionImportRow{line: line, username: record[0], subscription: record[1]}
+		if len(record) > 2 {
+			switch strings.ToLower(record[2]) {
+			case "", "assign", "add":
+			case "unassign", "remove":
+				row.unassign = true
+			default:
+				errs = append(errs, subscriptionImportRowError{Line: line, Message: "未知的动作: " + record[2]})
+				continue
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, errs
+}
@@ -4,8 +4,10 @@ import (
 	"crypto/rand"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -20,6 +22,18 @@ type userEntry struct {
 	Role     string `json:"role"`
 	IsActive bool   `json:"is_active"`
 	Remark   string `json:"remark"`
+
+	// 账号来源：local 本地密码，ldap 由 LDAP 目录认证
+	AuthSource string `json:"auth_source"`
+
+	// 账号到期时间，到期后自动停用
+	ExpiresAt *time.Time `json:"expires_at"`
+	Expired   bool       `json:"expired"`
+
+	// 连续登录失败次数与临时锁定状态
+	FailedLogins int        `json:"failed_logins"`
+	Locked       bool       `json:"locked"`
+	LockedUntil  *time.Time `json:"locked_until,omitempty"`
 }
 
 type userStatusRequest struct {
@@ -30,6 +44,7 @@ type userStatusRequest struct {
 type userResetRequest struct {
 	Username    string `json:"username"`
 	NewPassword string `json:"new_password"`
+	NotifyEmail bool   `json:"notify_email"` // 通过邮件将新密码发送给用户
 }
 
 type userResetResponse struct {
@@ -64,10 +79,16 @@ func NewUserListHandler(repo *storage.TrafficRepository) http.Handler {
 			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
+		lockouts, err := repo.ListUserLockouts(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
 
+		now := time.Now()
 		entries := make([]userEntry, 0, len(users))
 		for _, user := range users {
-			entries = append(entries, userEntry{
+			entry := userEntry{
 				Username: user.Username,
 				Email:    user.Email,
 				Nickname: user.Nickname,
@@ -75,7 +96,20 @@ func NewUserListHandler(repo *storage.TrafficRepository) http.Handler {
 				Role:     user.Role,
 				IsActive: user.IsActive,
 				Remark:   user.Remark,
-			})
+
+				AuthSource: user.AuthSource,
+
+				ExpiresAt: user.ExpiresAt,
+				Expired:   user.Expired(now),
+			}
+			if lockout, ok := lockouts[user.Username]; ok {
+				entry.FailedLogins = lockout.FailedLogins
+				if lockout.Locked(now) {
+					entry.Locked = true
+					entry.LockedUntil = lockout.LockedUntil
+				}
+			}
+			entries = append(entries, entry)
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -83,6 +117,47 @@ func NewUserListHandler(repo *storage.TrafficRepository) http.Handler {
 	})
 }
 
+// NewUserUnlockHandler clears the temporary lock and failed login counter of an account.
+func NewUserUnlockHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("user unlock handler requires repository")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, errors.New("only POST is supported"))
+			return
+		}
+
+		var payload struct {
+			Username string `json:"username"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		username := strings.TrimSpace(payload.Username)
+		if username == "" {
+			writeError(w, http.StatusBadRequest, errors.New("username is required"))
+			return
+		}
+
+		if err := repo.UnlockUser(r.Context(), username); err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				writeError(w, http.StatusNotFound, errors.New("user not found"))
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		recordAudit(r.Context(), "user.unlock", username, "", "")
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "unlocked"})
+	})
+}
+
 func NewUserStatusHandler(repo *storage.TrafficRepository) http.Handler {
 	if repo == nil {
 		panic("user status handler requires repository")
@@ -121,6 +196,10 @@ func NewUserStatusHandler(repo *storage.TrafficRepository) http.Handler {
 			writeError(w, http.StatusBadRequest, errors.New("不能修改管理员状态"))
 			return
 		}
+		if payload.IsActive && targetUser.Expired(time.Now()) {
+			writeError(w, http.StatusBadRequest, errors.New("账号已到期，请先修改到期时间"))
+			return
+		}
 
 		if err := repo.UpdateUserStatus(r.Context(), username, payload.IsActive); err != nil {
 			if errors.Is(err, storage.ErrUserNotFound) {
@@ -130,6 +209,8 @@ func NewUserStatusHandler(repo *storage.TrafficRepository) http.Handler {
 			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
+		recordAudit(r.Context(), "user.status", username,
+			fmt.Sprintf("is_active=%t", targetUser.IsActive), fmt.Sprintf("is_active=%t", payload.IsActive))
 
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
@@ -175,6 +256,11 @@ func NewUserResetPasswordHandler(repo *storage.TrafficRepository) http.Handler {
 			return
 		}
 
+		if targetUser.AuthSource == storage.AuthSourceLDAP {
+			writeError(w, http.StatusBadRequest, errors.New("LDAP 账号的密码由目录服务器管理，不能在此重置"))
+			return
+		}
+
 		newPassword := strings.TrimSpace(payload.NewPassword)
 		if newPassword == "" {
 			generated, err := generateRandomPassword(12)
@@ -200,6 +286,15 @@ func NewUserResetPasswordHandler(repo *storage.TrafficRepository) http.Handler {
 			return
 		}
 
+		recordAudit(r.Context(), "user.reset_password", username, "", fmt.Sprintf("notify_email=%t", payload.NotifyEmail))
+
+		if payload.NotifyEmail {
+			emailUserAsync(repo, username, EmailTemplatePasswordReset, map[string]any{
+				"Username": username,
+				"Password": newPassword,
+			})
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(userResetResponse{Username: username, Password: newPassword})
 	})
@@ -263,6 +358,8 @@ func NewUserCreateHandler(repo *storage.TrafficRepository) http.Handler {
 			return
 		}
 
+		recordAudit(r.Context(), "user.create", username, "", fmt.Sprintf("role=%s email=%s nickname=%s", role, email, nickname))
+
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(userCreateResponse{
 			Username: username,
@@ -326,6 +423,9 @@ func NewUserDeleteHandler(repo *storage.TrafficRepository) http.Handler {
 			return
 		}
 
+		removeLocalAvatar(targetUser.AvatarURL)
+		recordAudit(r.Context(), "user.delete", username, fmt.Sprintf("role=%s email=%s is_active=%t", targetUser.Role, targetUser.Email, targetUser.IsActive), "")
+
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
 	})
@@ -378,6 +478,7 @@ func NewUserRemarkHandler(repo *storage.TrafficRepository) http.Handler {
 			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
+		recordAudit(r.Context(), "user.remark", username, "", "remark="+payload.Remark)
 
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
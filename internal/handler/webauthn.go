@@ -0,0 +1,502 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"miaomiaowu/internal/auth"
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	// webauthnChallengeTTL 注册/登录挑战的有效期
+	webauthnChallengeTTL = 5 * time.Minute
+	// webauthnTimeoutMillis 提示浏览器的操作超时时间
+	webauthnTimeoutMillis = 120000
+	// passkeySessionTTL 通过 passkey 登录的会话有效期
+	passkeySessionTTL = 24 * time.Hour
+	// maxPasskeysPerUser 每个用户最多注册的 passkey 数量
+	maxPasskeysPerUser = 10
+	// maxPasskeyNameLength passkey 备注名的最大长度
+	maxPasskeyNameLength = 64
+)
+
+// webauthnRPConfig 由 WEBAUTHN_RP_ID / WEBAUTHN_ORIGINS 配置；为空时按请求的访问地址推断
+type webauthnRPConfig struct {
+	id      string
+	origins []string
+}
+
+var webauthnRP atomic.Pointer[webauthnRPConfig]
+
+// SetWebAuthnRelyingParty pins the relying party ID and allowed origins used for passkeys.
+// Leave them empty to derive both from the request (including reverse proxy headers).
+func SetWebAuthnRelyingParty(rpID string, origins []string) {
+	cfg := &webauthnRPConfig{id: strings.TrimSpace(rpID)}
+	for _, origin := range origins {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			cfg.origins = append(cfg.origins, origin)
+		}
+	}
+	webauthnRP.Store(cfg)
+}
+
+// webauthnRelyingParty 返回本次请求使用的依赖方信息
+func webauthnRelyingParty(r *http.Request) auth.WebAuthnRelyingParty {
+	baseURL := panelBaseURL(r)
+	rp := auth.WebAuthnRelyingParty{}
+	if cfg := webauthnRP.Load(); cfg != nil {
+		rp.ID = cfg.id
+		rp.Origins = cfg.origins
+	}
+	if len(rp.Origins) == 0 {
+		rp.Origins = []string{baseURL}
+	}
+	if rp.ID == "" {
+		host := strings.TrimPrefix(strings.TrimPrefix(baseURL, "https://"), "http://")
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		rp.ID = strings.ToLower(strings.Trim(host, "[]"))
+	}
+	return rp
+}
+
+type webauthnChallenge struct {
+	username  string
+	challenge []byte
+	expiresAt time.Time
+}
+
+// webauthnChallengeStore 保存尚未完成的注册/登录挑战，挑战只能使用一次
+type webauthnChallengeStore struct {
+	mu      sync.Mutex
+	entries map[string]webauthnChallenge
+}
+
+func newWebAuthnChallengeStore() *webauthnChallengeStore {
+	return &webauthnChallengeStore{entries: make(map[string]webauthnChallenge)}
+}
+
+// issue 生成新的挑战，返回挑战 ID 与挑战内容
+func (s *webauthnChallengeStore) issue(username string) (string, []byte, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", nil, err
+	}
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", nil, err
+	}
+	id := auth.EncodeWebAuthnID(idBytes)
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, entry := range s.entries {
+		if now.After(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+	s.entries[id] = webauthnChallenge{username: username, challenge: challenge, expiresAt: now.Add(webauthnChallengeTTL)}
+	return id, challenge, nil
+}
+
+// consume 取出并删除挑战，过期或不存在时返回 false
+func (s *webauthnChallengeStore) consume(id string) (webauthnChallenge, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[id]
+	if !ok {
+		return webauthnChallenge{}, false
+	}
+	delete(s.entries, id)
+	if time.Now().After(entry.expiresAt) {
+		return webauthnChallenge{}, false
+	}
+	return entry, true
+}
+
+type passkeyResponse struct {
+	ID         int64   `json:"id"`
+	Name       string  `json:"name"`
+	CreatedAt  string  `json:"created_at"`
+	LastUsedAt *string `json:"last_used_at"`
+}
+
+// passkeyCredentialPayload 浏览器返回的 PublicKeyCredential，二进制字段均为 base64url
+type passkeyCredentialPayload struct {
+	ChallengeID string `json:"challenge_id"`
+	Name        string `json:"name"`
+	ID          string `json:"id"`
+	Response    struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+	} `json:"response"`
+}
+
+func decodePasskeyPayload(w http.ResponseWriter, r *http.Request) (passkeyCredentialPayload, bool) {
+	var payload passkeyCredentialPayload
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&payload); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return payload, false
+	}
+	if strings.TrimSpace(payload.ChallengeID) == "" {
+		writeBadRequest(w, "缺少 challenge_id")
+		return payload, false
+	}
+	return payload, true
+}
+
+func convertPasskeyResponse(cred storage.WebAuthnCredential) passkeyResponse {
+	resp := passkeyResponse{
+		ID:        cred.ID,
+		Name:      cred.Name,
+		CreatedAt: cred.CreatedAt.Format(time.RFC3339),
+	}
+	if cred.LastUsedAt != nil {
+		lastUsed := cred.LastUsedAt.Format(time.RFC3339)
+		resp.LastUsedAt = &lastUsed
+	}
+	return resp
+}
+
+type passkeysHandler struct {
+	repo       *storage.TrafficRepository
+	challenges *webauthnChallengeStore
+}
+
+// NewPasskeysHandler lets a logged-in user register, list and remove passkeys under /api/user/passkeys.
+func NewPasskeysHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("passkeys handler requires repository")
+	}
+
+	return &passkeysHandler{repo: repo, challenges: newWebAuthnChallengeStore()}
+}
+
+func (h *passkeysHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	username := auth.UsernameFromContext(r.Context())
+	if strings.TrimSpace(username) == "" {
+		writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/user/passkeys"), "/")
+	switch path {
+	case "":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		h.handleList(w, r, username)
+	case "register/begin":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		h.handleRegisterBegin(w, r, username)
+	case "register/finish":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		h.handleRegisterFinish(w, r, username)
+	default:
+		id, err := strconv.ParseInt(path, 10, 64)
+		if err != nil || id <= 0 {
+			writeError(w, http.StatusNotFound, errors.New("not found"))
+			return
+		}
+		if r.Method != http.MethodDelete {
+			methodNotAllowed(w, http.MethodDelete)
+			return
+		}
+		h.handleDelete(w, r, username, id)
+	}
+}
+
+func (h *passkeysHandler) handleList(w http.ResponseWriter, r *http.Request, username string) {
+	creds, err := h.repo.ListWebAuthnCredentials(r.Context(), username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]passkeyResponse, 0, len(creds))
+	for _, cred := range creds {
+		items = append(items, convertPasskeyResponse(cred))
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"passkeys": items})
+}
+
+func (h *passkeysHandler) handleRegisterBegin(w http.ResponseWriter, r *http.Request, username string) {
+	user, err := h.repo.GetUser(r.Context(), username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	existing, err := h.repo.ListWebAuthnCredentials(r.Context(), username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(existing) >= maxPasskeysPerUser {
+		writeBadRequest(w, "passkey 数量已达上限")
+		return
+	}
+
+	challengeID, challenge, err := h.challenges.issue(username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	rp := webauthnRelyingParty(r)
+	params := make([]map[string]any, 0, len(auth.SupportedCOSEAlgorithms))
+	for _, alg := range auth.SupportedCOSEAlgorithms {
+		params = append(params, map[string]any{"type": "public-key", "alg": alg})
+	}
+	// 已注册的凭据加入排除列表，避免同一认证器重复注册
+	exclude := make([]map[string]any, 0, len(existing))
+	for _, cred := range existing {
+		exclude = append(exclude, map[string]any{"type": "public-key", "id": cred.CredentialID})
+	}
+	displayName := user.Nickname
+	if displayName == "" {
+		displayName = user.Username
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"challenge_id": challengeID,
+		"publicKey": map[string]any{
+			"challenge": auth.EncodeWebAuthnID(challenge),
+			"rp":        map[string]any{"id": rp.ID, "name": "妙妙屋"},
+			"user": map[string]any{
+				"id":          auth.EncodeWebAuthnID([]byte(user.Username)),
+				"name":        user.Username,
+				"displayName": displayName,
+			},
+			"pubKeyCredParams":   params,
+			"excludeCredentials": exclude,
+			"timeout":            webauthnTimeoutMillis,
+			"attestation":        "none",
+			"authenticatorSelection": map[string]any{
+				"residentKey":      "preferred",
+				"userVerification": "preferred",
+			},
+		},
+	})
+}
+
+func (h *passkeysHandler) handleRegisterFinish(w http.ResponseWriter, r *http.Request, username string) {
+	payload, ok := decodePasskeyPayload(w, r)
+	if !ok {
+		return
+	}
+
+	entry, ok := h.challenges.consume(payload.ChallengeID)
+	if !ok || entry.username != username {
+		writeBadRequest(w, "注册请求已过期，请重试")
+		return
+	}
+
+	name := strings.TrimSpace(payload.Name)
+	if len([]rune(name)) > maxPasskeyNameLength {
+		writeBadRequest(w, "passkey 名称过长")
+		return
+	}
+	if name == "" {
+		name = "Passkey " + time.Now().Format("2006-01-02")
+	}
+
+	clientData, err1 := auth.DecodeWebAuthnID(payload.Response.ClientDataJSON)
+	attestation, err2 := auth.DecodeWebAuthnID(payload.Response.AttestationObject)
+	if err1 != nil || err2 != nil {
+		writeBadRequest(w, "凭据数据编码无效")
+		return
+	}
+
+	registration, err := webauthnRelyingParty(r).VerifyWebAuthnRegistration(entry.challenge, clientData, attestation, false)
+	if err != nil {
+		logger.Warn("🔐 [PASSKEY] 注册校验失败", "username", username, "error", err)
+		writeBadRequest(w, "passkey 校验失败")
+		return
+	}
+
+	cred, err := h.repo.CreateWebAuthnCredential(r.Context(), storage.WebAuthnCredential{
+		Username:     username,
+		CredentialID: auth.EncodeWebAuthnID(registration.CredentialID),
+		PublicKey:    registration.PublicKey,
+		SignCount:    registration.SignCount,
+		Name:         name,
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrWebAuthnCredentialExists) {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logger.Info("🔐 [PASSKEY] 已注册 passkey", "username", username, "name", cred.Name)
+	respondJSON(w, http.StatusCreated, map[string]any{"passkey": convertPasskeyResponse(cred)})
+}
+
+func (h *passkeysHandler) handleDelete(w http.ResponseWriter, r *http.Request, username string, id int64) {
+	if err := h.repo.DeleteWebAuthnCredential(r.Context(), username, id); err != nil {
+		if errors.Is(err, storage.ErrWebAuthnCredentialNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	logger.Info("🔐 [PASSKEY] 已删除 passkey", "username", username, "id", id)
+	respondJSON(w, http.StatusOK, map[string]any{"status": "deleted"})
+}
+
+// NewPasskeyLoginHandler serves the password-less login ceremony under /api/login/passkey/{begin,finish}.
+func NewPasskeyLoginHandler(tokens *auth.TokenStore, repo *storage.TrafficRepository, rateLimiter *LoginRateLimiter) http.Handler {
+	if tokens == nil || repo == nil {
+		panic("passkey login handler requires token store and repository")
+	}
+
+	challenges := newWebAuthnChallengeStore()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+
+		switch strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/login/passkey"), "/") {
+		case "begin":
+			// 使用可发现凭据（discoverable credential），无需预先输入用户名
+			challengeID, challenge, err := challenges.issue("")
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			respondJSON(w, http.StatusOK, map[string]any{
+				"challenge_id": challengeID,
+				"publicKey": map[string]any{
+					"challenge":        auth.EncodeWebAuthnID(challenge),
+					"rpId":             webauthnRelyingParty(r).ID,
+					"timeout":          webauthnTimeoutMillis,
+					"userVerification": "preferred",
+				},
+			})
+		case "finish":
+			finishPasskeyLogin(w, r, tokens, repo, rateLimiter, challenges)
+		default:
+			writeError(w, http.StatusNotFound, errors.New("not found"))
+		}
+	})
+}
+
+func finishPasskeyLogin(w http.ResponseWriter, r *http.Request, tokens *auth.TokenStore, repo *storage.TrafficRepository, rateLimiter *LoginRateLimiter, challenges *webauthnChallengeStore) {
+	payload, ok := decodePasskeyPayload(w, r)
+	if !ok {
+		return
+	}
+
+	clientIP := getClientIP(r)
+	if rateLimiter != nil {
+		if err := rateLimiter.Check(clientIP, ""); err != nil {
+			writeError(w, http.StatusTooManyRequests, errors.New("too many login attempts, please try again later"))
+			return
+		}
+	}
+
+	fail := func(reason string, args ...any) {
+		if rateLimiter != nil {
+			rateLimiter.RecordFailure(clientIP, "")
+		}
+		logger.Warn("🔐 [LOGIN_FAIL] passkey 登录失败", append([]any{"client_ip", clientIP, "reason", reason}, args...)...)
+		writeError(w, http.StatusUnauthorized, errors.New("passkey authentication failed"))
+	}
+
+	entry, ok := challenges.consume(payload.ChallengeID)
+	if !ok {
+		fail("challenge expired")
+		return
+	}
+
+	cred, err := repo.GetWebAuthnCredential(r.Context(), payload.ID)
+	if err != nil {
+		if errors.Is(err, storage.ErrWebAuthnCredentialNotFound) {
+			fail("unknown credential")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	clientData, err1 := auth.DecodeWebAuthnID(payload.Response.ClientDataJSON)
+	authData, err2 := auth.DecodeWebAuthnID(payload.Response.AuthenticatorData)
+	signature, err3 := auth.DecodeWebAuthnID(payload.Response.Signature)
+	if err1 != nil || err2 != nil || err3 != nil {
+		fail("invalid encoding", "username", cred.Username)
+		return
+	}
+
+	signCount, err := webauthnRelyingParty(r).VerifyWebAuthnAssertion(entry.challenge, clientData, authData, signature, cred.PublicKey, cred.SignCount, false)
+	if err != nil {
+		fail(err.Error(), "username", cred.Username)
+		return
+	}
+
+	user, err := repo.GetUser(r.Context(), cred.Username)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			fail("user not found", "username", cred.Username)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !user.IsActive {
+		fail("user disabled", "username", cred.Username)
+		return
+	}
+
+	if err := repo.TouchWebAuthnCredential(r.Context(), cred.ID, signCount); err != nil {
+		logger.Warn("[认证] 更新 passkey 计数失败", "username", cred.Username, "error", err)
+	}
+	if rateLimiter != nil {
+		rateLimiter.RecordSuccess(clientIP, "")
+	}
+
+	token, expiry, err := tokens.IssueWithTTL(user.Username, passkeySessionTTL)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := repo.CreateSession(r.Context(), token, user.Username, expiry); err != nil {
+		logger.Warn("[认证] 会话持久化失败", "username", user.Username, "error", err)
+	}
+
+	logger.Info("🔐 [LOGIN_OK] passkey 登录成功",
+		"username", user.Username,
+		"client_ip", clientIP,
+		"name", cred.Name,
+		"expires_at", expiry.Format("2006-01-02 15:04:05"))
+
+	respondJSON(w, http.StatusOK, newLoginResponse(token, expiry, user))
+}
@@ -0,0 +1,584 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"miaomiaowu/internal/logger"
+	"miaomiaowu/internal/storage"
+)
+
+const (
+	webhooksPrefix = "/api/admin/webhooks"
+
+	WebhookEventNodeCreated        = "node.created"
+	WebhookEventNodeDeleted        = "node.deleted"
+	WebhookEventSubscriptionPulled = "subscription.pulled"
+	WebhookEventTrafficCollected   = "traffic.collected"
+	WebhookEventQuotaExceeded      = "quota.exceeded"
+	WebhookEventPing               = "ping"
+
+	webhookTimeout    = 10 * time.Second
+	webhookQueueSize  = 256
+	webhookMaxWorkers = 4
+)
+
+// webhookRetryDelays 失败后的重试间隔，共投递 len+1 次
+var webhookRetryDelays = []time.Duration{10 * time.Second, time.Minute, 5 * time.Minute}
+
+var webhookEvents = []string{
+	WebhookEventNodeCreated,
+	WebhookEventNodeDeleted,
+	WebhookEventSubscriptionPulled,
+	WebhookEventTrafficCollected,
+	WebhookEventQuotaExceeded,
+}
+
+type webhookEvent struct {
+	name string
+	data any
+	at   time.Time
+	// target 非 0 时只投递给指定 webhook（测试投递）
+	target int64
+}
+
+type webhookPayload struct {
+	ID        int64     `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// webhookDispatcher fans events out to the configured webhooks and retries failed deliveries.
+type webhookDispatcher struct {
+	repo    *storage.TrafficRepository
+	client  *http.Client
+	queue   chan webhookEvent
+	workers chan struct{}
+}
+
+var globalWebhookDispatcher atomic.Pointer[webhookDispatcher]
+
+// StartWebhookDispatcher delivers emitted events until ctx is cancelled.
+func StartWebhookDispatcher(ctx context.Context, repo *storage.TrafficRepository) {
+	if repo == nil {
+		panic("webhook dispatcher requires repository")
+	}
+
+	d := &webhookDispatcher{
+		repo:    repo,
+		client:  &http.Client{Timeout: webhookTimeout},
+		queue:   make(chan webhookEvent, webhookQueueSize),
+		workers: make(chan struct{}, webhookMaxWorkers),
+	}
+	globalWebhookDispatcher.Store(d)
+	defer globalWebhookDispatcher.CompareAndSwap(d, nil)
+
+	logger.Info("[Webhook] 事件分发已启动")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-d.queue:
+			d.dispatch(ctx, ev)
+		}
+	}
+}
+
+// emitWebhookEvent 异步发送事件，队列已满或分发器未启动时丢弃
+func emitWebhookEvent(event string, data any) {
+	enqueueWebhookEvent(webhookEvent{name: event, data: data, at: time.Now()})
+}
+
+func enqueueWebhookEvent(ev webhookEvent) bool {
+	d := globalWebhookDispatcher.Load()
+	if d == nil {
+		return false
+	}
+	select {
+	case d.queue <- ev:
+		return true
+	default:
+		logger.Warn("[Webhook] 事件队列已满，丢弃事件", "event", ev.name)
+		return false
+	}
+}
+
+func (d *webhookDispatcher) dispatch(ctx context.Context, ev webhookEvent) {
+	hooks, err := d.repo.ListWebhooks(ctx)
+	if err != nil {
+		logger.Warn("[Webhook] 读取 webhook 配置失败", "event", ev.name, "error", err)
+		return
+	}
+
+	for _, hook := range hooks {
+		if ev.target != 0 {
+			if hook.ID != ev.target {
+				continue
+			}
+		} else if !hook.Enabled || !hook.Subscribes(ev.name) {
+			continue
+		}
+
+		delivery, err := d.repo.CreateWebhookDelivery(ctx, storage.WebhookDelivery{
+			WebhookID: hook.ID,
+			Event:     ev.name,
+			Payload:   "{}",
+		})
+		if err != nil {
+			logger.Warn("[Webhook] 创建投递记录失败", "webhook", hook.Name, "error", err)
+			continue
+		}
+
+		body, err := json.Marshal(webhookPayload{ID: delivery.ID, Event: ev.name, CreatedAt: ev.at, Data: ev.data})
+		if err != nil {
+			logger.Warn("[Webhook] 事件序列化失败", "event", ev.name, "error", err)
+			return
+		}
+		delivery.Payload = string(body)
+
+		select {
+		case d.workers <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		go func(hook storage.Webhook, delivery storage.WebhookDelivery) {
+			defer func() { <-d.workers }()
+			d.deliver(ctx, hook, delivery)
+		}(hook, delivery)
+	}
+}
+
+// deliver 投递并按 webhookRetryDelays 重试，每次尝试后更新投递记录
+func (d *webhookDispatcher) deliver(ctx context.Context, hook storage.Webhook, delivery storage.WebhookDelivery) {
+	for attempt := 0; ; attempt++ {
+		status, err := d.send(ctx, hook, delivery)
+		delivery.Attempts = attempt + 1
+		delivery.ResponseStatus = status
+		delivery.Error = ""
+		retryable := err != nil && !errors.Is(err, ErrAirGapped) && (status == 0 || status == http.StatusTooManyRequests || status >= 500)
+
+		switch {
+		case err == nil:
+			delivery.Status = storage.WebhookDeliverySuccess
+		case retryable && attempt < len(webhookRetryDelays):
+			delivery.Status = storage.WebhookDeliveryPending
+			delivery.Error = err.Error()
+		default:
+			delivery.Status = storage.WebhookDeliveryFailed
+			delivery.Error = err.Error()
+		}
+
+		if updateErr := d.repo.UpdateWebhookDelivery(context.WithoutCancel(ctx), delivery); updateErr != nil {
+			logger.Warn("[Webhook] 更新投递记录失败", "delivery", delivery.ID, "error", updateErr)
+		}
+		if delivery.Status != storage.WebhookDeliveryPending {
+			if delivery.Status == storage.WebhookDeliveryFailed {
+				logger.Warn("[Webhook] 投递失败", "webhook", hook.Name, "event", delivery.Event, "attempts", delivery.Attempts, "error", err)
+			}
+			return
+		}
+
+		timer := time.NewTimer(webhookRetryDelays[attempt])
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// send 发送一次请求；签名为 HMAC-SHA256(secret, timestamp + "." + body)
+func (d *webhookDispatcher) send(ctx context.Context, hook storage.Webhook, delivery storage.WebhookDelivery) (int, error) {
+	if IsAirGappedMode() {
+		return 0, ErrAirGapped
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader([]byte(delivery.Payload)))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "miaomiaowu-webhook")
+	req.Header.Set("X-MMW-Event", delivery.Event)
+	req.Header.Set("X-MMW-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-MMW-Timestamp", timestamp)
+	if hook.Secret != "" {
+		req.Header.Set("X-MMW-Signature", "sha256="+signWebhookPayload(hook.Secret, timestamp, []byte(delivery.Payload)))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+type webhookNode struct {
+	ID       int64  `json:"id"`
+	UUID     string `json:"uuid"`
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+}
+
+// emitNodeWebhook 发送节点创建/删除事件
+func emitNodeWebhook(event, username string, nodes []storage.Node) {
+	if len(nodes) == 0 {
+		return
+	}
+	items := make([]webhookNode, 0, len(nodes))
+	for _, node := range nodes {
+		items = append(items, webhookNode{ID: node.ID, UUID: node.UUID, Name: node.NodeName, Protocol: node.Protocol})
+	}
+	emitWebhookEvent(event, map[string]any{"username": username, "nodes": items})
+}
+
+func signWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+type webhookRequest struct {
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`
+	Secret  *string  `json:"secret"` // 为空时保留原值（创建时自动生成）
+	Events  []string `json:"events"`
+	Enabled *bool    `json:"enabled"`
+}
+
+type webhookDTO struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Enabled   bool      `json:"enabled"`
+	HasSecret bool      `json:"has_secret"`
+	Secret    string    `json:"secret,omitempty"` // 仅在生成新密钥时返回一次
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type webhookDeliveryDTO struct {
+	ID             int64     `json:"id"`
+	Event          string    `json:"event"`
+	Payload        string    `json:"payload"`
+	Status         string    `json:"status"`
+	Attempts       int       `json:"attempts"`
+	ResponseStatus int       `json:"response_status"`
+	Error          string    `json:"error,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func convertWebhook(hook storage.Webhook) webhookDTO {
+	events := hook.Events
+	if events == nil {
+		events = []string{}
+	}
+	return webhookDTO{
+		ID:        hook.ID,
+		Name:      hook.Name,
+		URL:       hook.URL,
+		Events:    events,
+		Enabled:   hook.Enabled,
+		HasSecret: hook.Secret != "",
+		CreatedAt: hook.CreatedAt,
+		UpdatedAt: hook.UpdatedAt,
+	}
+}
+
+type webhooksHandler struct {
+	repo *storage.TrafficRepository
+}
+
+// NewWebhooksHandler manages outgoing webhooks:
+//
+//	GET/POST   /api/admin/webhooks
+//	PUT/DELETE /api/admin/webhooks/{id}
+//	GET        /api/admin/webhooks/{id}/deliveries
+//	POST       /api/admin/webhooks/{id}/test
+func NewWebhooksHandler(repo *storage.TrafficRepository) http.Handler {
+	if repo == nil {
+		panic("webhooks handler requires repository")
+	}
+
+	return &webhooksHandler{repo: repo}
+}
+
+func (h *webhooksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, webhooksPrefix), "/")
+
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.handleList(w, r)
+		case http.MethodPost:
+			h.handleCreate(w, r)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+		return
+	}
+
+	idPart, action, _ := strings.Cut(path, "/")
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil || id <= 0 {
+		writeBadRequest(w, "无效的 webhook ID")
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodPut:
+		h.handleUpdate(w, r, id)
+	case action == "" && r.Method == http.MethodDelete:
+		h.handleDelete(w, r, id)
+	case action == "deliveries" && r.Method == http.MethodGet:
+		h.handleDeliveries(w, r, id)
+	case action == "test" && r.Method == http.MethodPost:
+		h.handleTest(w, r, id)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (h *webhooksHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	hooks, err := h.repo.ListWebhooks(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]webhookDTO, 0, len(hooks))
+	for _, hook := range hooks {
+		items = append(items, convertWebhook(hook))
+	}
+	respondJSON(w, http.StatusOK, map[string]any{
+		"webhooks": items,
+		"events":   webhookEvents,
+	})
+}
+
+// applyWebhookRequest 校验请求并合并到 hook；返回是否生成了新密钥
+func applyWebhookRequest(hook *storage.Webhook, req webhookRequest) (bool, error) {
+	hook.Name = strings.TrimSpace(req.Name)
+	if hook.Name == "" {
+		return false, errors.New("名称不能为空")
+	}
+
+	hook.URL = strings.TrimSpace(req.URL)
+	parsed, err := url.Parse(hook.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return false, errors.New("URL 必须是有效的 http(s) 地址")
+	}
+
+	events := make([]string, 0, len(req.Events))
+	seen := make(map[string]struct{}, len(req.Events))
+	for _, event := range req.Events {
+		event = strings.TrimSpace(event)
+		if event == "" {
+			continue
+		}
+		if _, ok := seen[event]; ok {
+			continue
+		}
+		known := event == "*"
+		for _, e := range webhookEvents {
+			if e == event {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return false, fmt.Errorf("未知的事件类型: %s", event)
+		}
+		seen[event] = struct{}{}
+		events = append(events, event)
+	}
+	hook.Events = events
+
+	if req.Enabled != nil {
+		hook.Enabled = *req.Enabled
+	}
+
+	generated := false
+	if req.Secret != nil {
+		hook.Secret = strings.TrimSpace(*req.Secret)
+	}
+	if hook.Secret == "" {
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			return false, fmt.Errorf("生成密钥失败: %w", err)
+		}
+		hook.Secret = secret
+		generated = true
+	}
+	return generated, nil
+}
+
+func (h *webhooksHandler) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	hook := storage.Webhook{Enabled: true}
+	generated, err := applyWebhookRequest(&hook, req)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	created, err := h.repo.CreateWebhook(r.Context(), hook)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	dto := convertWebhook(created)
+	if generated {
+		dto.Secret = created.Secret
+	}
+	logger.Info("[Webhook] 已创建", "name", created.Name, "events", created.Events)
+	respondJSON(w, http.StatusCreated, dto)
+}
+
+func (h *webhooksHandler) handleUpdate(w http.ResponseWriter, r *http.Request, id int64) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBadRequest(w, "请求数据格式错误")
+		return
+	}
+
+	hook, err := h.repo.GetWebhook(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, storage.ErrWebhookNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	generated, err := applyWebhookRequest(&hook, req)
+	if err != nil {
+		writeBadRequest(w, err.Error())
+		return
+	}
+
+	updated, err := h.repo.UpdateWebhook(r.Context(), hook)
+	if err != nil {
+		if errors.Is(err, storage.ErrWebhookNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	dto := convertWebhook(updated)
+	if generated {
+		dto.Secret = updated.Secret
+	}
+	respondJSON(w, http.StatusOK, dto)
+}
+
+func (h *webhooksHandler) handleDelete(w http.ResponseWriter, r *http.Request, id int64) {
+	if err := h.repo.DeleteWebhook(r.Context(), id); err != nil {
+		if errors.Is(err, storage.ErrWebhookNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"success": true})
+}
+
+func (h *webhooksHandler) handleDeliveries(w http.ResponseWriter, r *http.Request, id int64) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	deliveries, err := h.repo.ListWebhookDeliveries(r.Context(), id, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]webhookDeliveryDTO, 0, len(deliveries))
+	for _, d := range deliveries {
+		items = append(items, webhookDeliveryDTO{
+			ID:             d.ID,
+			Event:          d.Event,
+			Payload:        d.Payload,
+			Status:         d.Status,
+			Attempts:       d.Attempts,
+			ResponseStatus: d.ResponseStatus,
+			Error:          d.Error,
+			CreatedAt:      d.CreatedAt,
+			UpdatedAt:      d.UpdatedAt,
+		})
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"deliveries": items})
+}
+
+func (h *webhooksHandler) handleTest(w http.ResponseWriter, r *http.Request, id int64) {
+	if _, err := h.repo.GetWebhook(r.Context(), id); err != nil {
+		if errors.Is(err, storage.ErrWebhookNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	queued := enqueueWebhookEvent(webhookEvent{
+		name:   WebhookEventPing,
+		data:   map[string]any{"message": "miaomiaowu webhook test"},
+		at:     time.Now(),
+		target: id,
+	})
+	if !queued {
+		writeError(w, http.StatusServiceUnavailable, errors.New("webhook 分发器未运行或队列已满"))
+		return
+	}
+	respondJSON(w, http.StatusAccepted, map[string]any{"queued": true})
+}
@@ -0,0 +1,315 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// WireGuard 配置（wg-quick 的 .conf 文件、Surge 的 [WireGuard 名称] 段落）解析为 Clash 节点。
+// 字段对应关系：
+//   PrivateKey → private-key，Address → ip / ipv6，DNS → dns，MTU → mtu，
+//   PublicKey → public-key，PresharedKey → pre-shared-key，Endpoint → server / port，
+//   AllowedIPs → allowed-ips，PersistentKeepalive → persistent-keepalive，Reserved → reserved
+
+// isWireGuardConfig 判断内容是否为 wg-quick 格式的配置文件
+func isWireGuardConfig(content []byte) bool {
+	lower := strings.ToLower(string(content))
+	return strings.Contains(lower, "[interface]") && strings.Contains(lower, "[peer]")
+}
+
+// ParseWireGuardConfig parses a wg-quick style config ([Interface] + [Peer]) into a Clash wireguard
+// proxy. Only the first peer is used; name defaults to the endpoint.
+func ParseWireGuardConfig(content, name string) (map[string]any, error) {
+	iface := map[string]string{}
+	peer := map[string]string{}
+	var current map[string]string
+	peers := 0
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			switch strings.ToLower(strings.TrimSpace(line[1 : len(line)-1])) {
+			case "interface":
+				current = iface
+			case "peer":
+				peers++
+				if peers == 1 {
+					current = peer
+				} else {
+					current = nil
+				}
+			default:
+				current = nil
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if existing, ok := current[key]; ok && existing != "" {
+			// Address / AllowedIPs / DNS 可以写多行
+			value = existing + "," + value
+		}
+		current[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if peers == 0 {
+		return nil, errors.New("missing [Peer] section")
+	}
+
+	server, port, err := splitWireGuardEndpoint(peer["endpoint"])
+	if err != nil {
+		return nil, err
+	}
+	proxy := map[string]any{
+		"type":        "wireguard",
+		"server":      server,
+		"port":        port,
+		"private-key": iface["privatekey"],
+		"public-key":  peer["publickey"],
+		"udp":         true,
+	}
+	if proxy["private-key"] == "" || proxy["public-key"] == "" {
+		return nil, errors.New("missing PrivateKey or PublicKey")
+	}
+	applyWireGuardAddresses(proxy, iface["address"])
+	if dns := splitWireGuardList(iface["dns"]); len(dns) > 0 {
+		proxy["dns"] = dns
+	}
+	if mtu, err := strconv.Atoi(iface["mtu"]); err == nil && mtu > 0 {
+		proxy["mtu"] = mtu
+	}
+	if psk := peer["presharedkey"]; psk != "" {
+		proxy["pre-shared-key"] = psk
+	}
+	if allowed := splitWireGuardList(peer["allowedips"]); len(allowed) > 0 {
+		proxy["allowed-ips"] = allowed
+	}
+	if keepalive, err := strconv.Atoi(peer["persistentkeepalive"]); err == nil && keepalive > 0 {
+		proxy["persistent-keepalive"] = keepalive
+	}
+	reserved := peer["reserved"]
+	if reserved == "" {
+		reserved = iface["reserved"]
+	}
+	if values := parseWireGuardReserved(reserved); values != nil {
+		proxy["reserved"] = values
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = fmt.Sprintf("WireGuard %s:%d", server, port)
+	}
+	proxy["name"] = name
+	return proxy, nil
+}
+
+// surgeWireGuardSections 收集 Surge 配置中的 [WireGuard 名称] 段落，键为小写的选项名
+func surgeWireGuardSections(content string) map[string]map[string]string {
+	sections := map[string]map[string]string{}
+	var current map[string]string
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			header := strings.TrimSpace(line[1 : len(line)-1])
+			current = nil
+			if len(header) > len("wireguard ") && strings.EqualFold(header[:len("wireguard ")], "wireguard ") {
+				current = map[string]string{}
+				sections[strings.TrimSpace(header[len("wireguard "):])] = current
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			current[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		}
+	}
+	return sections
+}
+
+// parseSurgeWireGuardProxy 根据节点行的 section-name 找到对应段落，生成 Clash wireguard 节点
+func parseSurgeWireGuardProxy(name string, options map[string]string, sections map[string]map[string]string) (map[string]any, error) {
+	sectionName := strings.TrimSpace(options["section-name"])
+	if sectionName == "" {
+		return nil, errors.New("wireguard proxy is missing section-name")
+	}
+	section, ok := sections[sectionName]
+	if !ok {
+		return nil, fmt.Errorf("[WireGuard %s] section not found", sectionName)
+	}
+
+	peer := parseSurgePeer(section["peer"])
+	server, port, err := splitWireGuardEndpoint(peer["endpoint"])
+	if err != nil {
+		return nil, err
+	}
+	proxy := map[string]any{
+		"name":        name,
+		"type":        "wireguard",
+		"server":      server,
+		"port":        port,
+		"private-key": section["private-key"],
+		"public-key":  peer["public-key"],
+		"udp":         true,
+	}
+	if proxy["private-key"] == "" || proxy["public-key"] == "" {
+		return nil, errors.New("missing private-key or peer public-key")
+	}
+	if ip := section["self-ip"]; ip != "" {
+		proxy["ip"] = ip
+	}
+	if ipv6 := section["self-ip-v6"]; ipv6 != "" {
+		proxy["ipv6"] = ipv6
+	}
+	if dns := splitWireGuardList(section["dns-server"]); len(dns) > 0 {
+		proxy["dns"] = dns
+	}
+	if mtu, err := strconv.Atoi(section["mtu"]); err == nil && mtu > 0 {
+		proxy["mtu"] = mtu
+	}
+	if psk := peer["preshared-key"]; psk != "" {
+		proxy["pre-shared-key"] = psk
+	}
+	if allowed := splitWireGuardList(peer["allowed-ips"]); len(allowed) > 0 {
+		proxy["allowed-ips"] = allowed
+	}
+	if keepalive, err := strconv.Atoi(peer["keepalive"]); err == nil && keepalive > 0 {
+		proxy["persistent-keepalive"] = keepalive
+	}
+	if values := parseWireGuardReserved(peer["client-id"]); values != nil {
+		proxy["reserved"] = values
+	}
+	if version, ok := surgeIPVersions[strings.ToLower(strings.TrimSpace(options["ip-version"]))]; ok {
+		proxy["ip-version"] = version
+	}
+	return proxy, nil
+}
+
+// parseSurgePeer 解析 peer = (public-key = xxx, allowed-ips = "0.0.0.0/0, ::/0", endpoint = host:port)
+func parseSurgePeer(raw string) map[string]string {
+	raw = strings.TrimSpace(raw)
+	raw = strings.TrimSuffix(strings.TrimPrefix(raw, "("), ")")
+	peer := map[string]string{}
+	for _, field := range splitConfigFields(raw) {
+		if key, value, ok := strings.Cut(field, "="); ok {
+			peer[strings.ToLower(strings.TrimSpace(key))] = unquoteConfigValue(value)
+		}
+	}
+	return peer
+}
+
+// splitWireGuardEndpoint 拆分 host:port / [v6]:port，端口缺省为 51820
+func splitWireGuardEndpoint(endpoint string) (string, int, error) {
+	endpoint = strings.TrimSpace(endpoint)
+	if endpoint == "" {
+		return "", 0, errors.New("missing peer endpoint")
+	}
+	host, rawPort, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return strings.Trim(endpoint, "[]"), 51820, nil
+	}
+	port, err := strconv.Atoi(rawPort)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid endpoint port %q", rawPort)
+	}
+	return host, port, nil
+}
+
+// applyWireGuardAddresses 将 Address 中的 IPv4 / IPv6 地址（去掉前缀长度）写入 ip / ipv6
+func applyWireGuardAddresses(proxy map[string]any, addresses string) {
+	for _, address := range splitWireGuardList(addresses) {
+		address = strings.Trim(address, "[]")
+		if idx := strings.Index(address, "/"); idx != -1 {
+			address = address[:idx]
+		}
+		ip := net.ParseIP(address)
+		if ip == nil {
+			continue
+		}
+		if ip.To4() != nil {
+			if _, exists := proxy["ip"]; !exists {
+				proxy["ip"] = address
+			}
+		} else if _, exists := proxy["ipv6"]; !exists {
+			proxy["ipv6"] = address
+		}
+	}
+}
+
+func splitWireGuardList(value string) []string {
+	value = strings.Trim(strings.TrimSpace(value), `"[]`)
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.Trim(strings.TrimSpace(item), `"`); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseWireGuardReserved 解析 reserved 字段，支持 "1,2,3"、"1/2/3"、"[1,2,3]" 以及 3 字节的 base64（如 WARP 的 client_id）
+func parseWireGuardReserved(value string) []int {
+	value = strings.Trim(strings.TrimSpace(value), "[]")
+	if value == "" {
+		return nil
+	}
+	parts := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '/' })
+	if len(parts) == 3 {
+		reserved := make([]int, 0, 3)
+		for _, part := range parts {
+			n, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || n < 0 || n > 255 {
+				reserved = nil
+				break
+			}
+			reserved = append(reserved, n)
+		}
+		if reserved != nil {
+			return reserved
+		}
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(value); err == nil && len(decoded) == 3 {
+		return []int{int(decoded[0]), int(decoded[1]), int(decoded[2])}
+	}
+	return nil
+}
+
+// parseSurgeWireGuardLine 处理 Surge 的 "名称 = wireguard, section-name = xxx" 节点行；
+// 第二个返回值表示该行是否为 wireguard 节点
+func parseSurgeWireGuardLine(line string, sections map[string]map[string]string) (map[string]any, bool, error) {
+	name, rest, ok := strings.Cut(line, "=")
+	if !ok {
+		return nil, false, nil
+	}
+	fields := splitConfigFields(rest)
+	if !strings.EqualFold(unquoteConfigValue(fields[0]), "wireguard") {
+		return nil, false, nil
+	}
+	proxy, err := parseSurgeWireGuardProxy(unquoteConfigValue(name), parseConfigFields(fields[1:]).options, sections)
+	return proxy, true, err
+}
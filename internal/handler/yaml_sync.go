@@ -305,6 +305,12 @@ func fixShortIdStyleInNode(node *yaml.Node) {
 
 // syncNodeToYAMLFiles updates node information in all YAML subscription files
 func syncNodeToYAMLFiles(subscribeDir, oldNodeName, newNodeName string, clashConfigJSON string) error {
+	return syncNodeToYAMLFilesWithMode(subscribeDir, oldNodeName, newNodeName, clashConfigJSON, false)
+}
+
+// syncNodeToYAMLFilesWithMode 同 syncNodeToYAMLFiles；replace 为 true 时整体替换代理条目，
+// 用于移除已删除的字段（默认的原地合并只会更新或新增字段）
+func syncNodeToYAMLFilesWithMode(subscribeDir, oldNodeName, newNodeName string, clashConfigJSON string, replace bool) error {
 	if subscribeDir == "" {
 		return fmt.Errorf("subscribe directory is empty")
 	}
@@ -379,7 +385,7 @@ func syncNodeToYAMLFiles(subscribeDir, oldNodeName, newNodeName string, clashCon
 
 			// If name matches old name
 			if proxyName == oldNodeName {
-				if nameChanged {
+				if nameChanged || replace {
 					// Name changed: replace with new config at current position
 					newProxies = append(newProxies, newClashConfig)
 					modified = true
@@ -498,7 +504,7 @@ func syncNodeToYAMLFiles(subscribeDir, oldNodeName, newNodeName string, clashCon
 
 								// If this proxy matches the one being updated
 								if proxyName == oldNodeName {
-									if nameChanged {
+									if nameChanged || replace {
 										// Replace entire proxy node with new config
 										proxiesNode.Content[j] = util.ReorderProxyFieldsToNode(newClashConfig)
 									} else {
@@ -579,6 +585,7 @@ func syncNodeToYAMLFiles(subscribeDir, oldNodeName, newNodeName string, clashCon
 		if err := os.WriteFile(filePath, []byte(fixed), 0644); err != nil {
 			continue // Skip files we can't write
 		}
+		notifySubscribeFileChanged(filePath)
 	}
 
 	return nil
@@ -777,6 +784,7 @@ func batchSyncNodesToYAMLFiles(subscribeDir string, updates []NodeUpdate) error
 		if err := os.WriteFile(filePath, []byte(fixed), 0644); err != nil {
 			continue
 		}
+		notifySubscribeFileChanged(filePath)
 
 		logger.Info("[YAML同步] 批量更新文件", "filename", filename)
 	}
@@ -1198,6 +1206,7 @@ func deleteNodeFromYAMLFilesWithLog(subscribeDir, nodeName string) ([]string, er
 		if err := os.WriteFile(filePath, []byte(result), 0644); err != nil {
 			continue // Skip files we can't write
 		}
+		notifySubscribeFileChanged(filePath)
 	}
 
 	return affectedFiles, nil
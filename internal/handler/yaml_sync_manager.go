@@ -37,6 +37,25 @@ func (m *YAMLSyncManager) SyncNode(oldNodeName, newNodeName string, clashConfigJ
 	return err
 }
 
+// ReplaceNode replaces a node's proxy entry in YAML files, dropping keys absent from the new config
+func (m *YAMLSyncManager) ReplaceNode(nodeName string, clashConfigJSON string) error {
+	if m.subscribeDir == "" {
+		return nil // No-op if subscribe directory is not configured
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	logger.Info("[YAML同步] 开始替换节点", "node_name", nodeName)
+	err := syncNodeToYAMLFilesWithMode(m.subscribeDir, nodeName, nodeName, clashConfigJSON, true)
+	if err != nil {
+		logger.Info("[YAML同步] 节点替换失败", "node_name", nodeName, "error", err)
+	} else {
+		logger.Info("[YAML同步] 节点替换成功", "node_name", nodeName)
+	}
+	return err
+}
+
 // DeleteNode deletes a node from YAML files with proper locking
 func (m *YAMLSyncManager) DeleteNode(nodeName string) error {
 	if m.subscribeDir == "" {
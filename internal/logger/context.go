@@ -0,0 +1,73 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+)
+
+type requestIDKey struct{}
+
+// RequestIDKey 日志中请求 ID 属性的键名
+const RequestIDKey = "request_id"
+
+// NewRequestID 生成 16 位十六进制的请求 ID
+func NewRequestID() string {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf[:])
+}
+
+// WithRequestID 将请求 ID 写入 context，之后使用该 context 记录的日志都会带上 request_id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext 返回 context 中的请求 ID，不存在时返回空字符串
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler 从 context 中提取请求 ID 并附加到每条日志
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestIDFromContext(ctx); id != "" {
+		record.AddAttrs(slog.String(RequestIDKey, id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// 带 context 的全局便捷方法，日志会附带请求 ID
+func InfoContext(ctx context.Context, msg string, args ...any) {
+	GetLogger().InfoContext(ctx, msg, sanitizeArgs(args)...)
+}
+
+func WarnContext(ctx context.Context, msg string, args ...any) {
+	GetLogger().WarnContext(ctx, msg, sanitizeArgs(args)...)
+}
+
+func ErrorContext(ctx context.Context, msg string, args ...any) {
+	GetLogger().ErrorContext(ctx, msg, sanitizeArgs(args)...)
+}
+
+func DebugContext(ctx context.Context, msg string, args ...any) {
+	GetLogger().DebugContext(ctx, msg, sanitizeArgs(args)...)
+}
@@ -19,19 +19,42 @@ type Logger struct {
 var (
 	defaultLogger *Logger
 	once          sync.Once
+	// baseLevel 控制台日志级别，由 LOG_LEVEL 环境变量决定，关闭debug日志后恢复到该级别
+	baseLevel = slog.LevelInfo
 )
 
-// Init 初始化全局logger
+// Init 初始化全局logger，日志级别取自 LOG_LEVEL（debug / info / warn / error，默认 info）
 func Init() *Logger {
 	once.Do(func() {
-		handler := newTextHandler(os.Stdout, slog.LevelInfo)
+		level, err := ParseLevel(os.Getenv("LOG_LEVEL"))
+		baseLevel = level
+		handler := newTextHandler(os.Stdout, baseLevel)
 		defaultLogger = &Logger{
 			Logger: slog.New(handler),
 		}
+		if err != nil {
+			defaultLogger.Warn("LOG_LEVEL 无效，使用默认级别", "value", os.Getenv("LOG_LEVEL"), "level", baseLevel.String())
+		}
 	})
 	return defaultLogger
 }
 
+// ParseLevel 解析日志级别名称，空值返回 info；无法识别时返回 info 和错误
+func ParseLevel(value string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q", value)
+	}
+}
+
 // GetLogger 获取全局logger实例
 func GetLogger() *Logger {
 	if defaultLogger == nil {
@@ -42,6 +65,10 @@ func GetLogger() *Logger {
 
 // newTextHandler 创建自定义文本handler（中文友好的格式）
 func newTextHandler(w io.Writer, level slog.Level) slog.Handler {
+	return contextHandler{newBaseTextHandler(w, level)}
+}
+
+func newBaseTextHandler(w io.Writer, level slog.Level) slog.Handler {
 	return slog.NewTextHandler(w, &slog.HandlerOptions{
 		Level: level,
 		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
@@ -66,7 +93,8 @@ func newTextHandler(w io.Writer, level slog.Level) slog.Handler {
 				}
 				return slog.String("level", levelStr)
 			}
-			return a
+			// 消息与属性值统一脱敏，避免令牌、节点密码、探针凭据写入日志
+			return redactAttr(a)
 		},
 	})
 }
@@ -116,7 +144,7 @@ func (l *Logger) DisableDebugLog() string {
 	l.debugFile = nil
 
 	// 恢复仅控制台输出
-	handler := newTextHandler(os.Stdout, slog.LevelInfo)
+	handler := newTextHandler(os.Stdout, baseLevel)
 	l.Logger = slog.New(handler)
 
 	return filePath
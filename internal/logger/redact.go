@@ -0,0 +1,74 @@
+package logger
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redactedPlaceholder = "***"
+
+// redactRule 描述一条脱敏规则，replacement 中可引用捕获组
+type redactRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+var redactRules = []redactRule{
+	// vmess:// 与 ssr:// 整段都是 base64 编码的配置（包含 uuid / 密码）
+	{
+		pattern:     regexp.MustCompile(`(?i)\b(vmess|ssr)://[A-Za-z0-9+/=_-]+`),
+		replacement: "${1}://" + redactedPlaceholder,
+	},
+	// scheme://userinfo@host 形式：ss/trojan/vless/hysteria2/tuic/socks5/http 代理以及带账号密码的探针地址
+	// 贪婪匹配到最后一个 @，兼容密码中未转义的 @
+	{
+		pattern:     regexp.MustCompile(`(?i)\b([a-z][a-z0-9+.-]*)://[^\s/?#"'<>]+@`),
+		replacement: "${1}://" + redactedPlaceholder + "@",
+	},
+	// URL 查询参数中的令牌、密码等
+	{
+		pattern:     regexp.MustCompile(`(?i)([?&;](?:token|access_token|api_key|apikey|key|password|passwd|pass|secret|auth|sign|uuid)=)[^&\s"'#]+`),
+		replacement: "${1}" + redactedPlaceholder,
+	},
+	// Authorization 头
+	{
+		pattern:     regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]{8,}`),
+		replacement: "${1} " + redactedPlaceholder,
+	},
+	// JSON / YAML 中的敏感字段，如 "password":"xxx" 或 password: xxx
+	{
+		pattern:     regexp.MustCompile(`(?i)("?\b(?:password|passwd|token|secret|uuid|auth-str|auth_str|private-key|private_key|pre-shared-key|psk|obfs-password)"?\s*[:=]\s*"?)[^\s",}'&]+`),
+		replacement: "${1}" + redactedPlaceholder,
+	},
+}
+
+// Redact 移除字符串中的令牌、节点链接中的密码以及探针凭据
+func Redact(s string) string {
+	if s == "" {
+		return s
+	}
+	// 快速路径：不包含任何可能命中规则的特征时直接返回
+	if !strings.ContainsAny(s, ":=@") {
+		return s
+	}
+	for _, rule := range redactRules {
+		s = rule.pattern.ReplaceAllString(s, rule.replacement)
+	}
+	return s
+}
+
+// redactAttr 对日志属性值脱敏，错误值会被转换为脱敏后的字符串
+func redactAttr(a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		if redacted := Redact(a.Value.String()); redacted != a.Value.String() {
+			return slog.String(a.Key, redacted)
+		}
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok && err != nil {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+	}
+	return a
+}
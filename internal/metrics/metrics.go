@@ -0,0 +1,281 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"miaomiaowu/internal/logger"
+)
+
+// 指标类别
+const (
+	KindHTTP = "http"
+	KindDB   = "db"
+)
+
+const (
+	// DefaultSlowThreshold 未配置时的慢操作阈值
+	DefaultSlowThreshold = 500 * time.Millisecond
+	// maxSeries 每个类别最多保留的指标条目数，超出后归入 OtherSeries，避免路径或 SQL 过多占用内存
+	maxSeries = 500
+	// maxSlowEntries 保留的最近慢操作条数
+	maxSlowEntries = 200
+	// OtherSeries 超出条目上限后的汇总条目名称
+	OtherSeries = "other"
+)
+
+// durationBuckets 耗时直方图的上界（毫秒）
+var durationBuckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// sizeBuckets 请求/响应大小直方图的上界（字节）
+var sizeBuckets = []float64{256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20}
+
+// Histogram 固定分桶的直方图，最后一个桶统计超过最大上界的值
+type Histogram struct {
+	Buckets []float64 `json:"buckets"`
+	Counts  []int64   `json:"counts"`
+	Count   int64     `json:"count"`
+	Sum     float64   `json:"sum"`
+	Max     float64   `json:"max"`
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{Buckets: buckets, Counts: make([]int64, len(buckets)+1)}
+}
+
+func (h *Histogram) observe(value float64) {
+	idx := sort.SearchFloat64s(h.Buckets, value)
+	h.Counts[idx]++
+	h.Count++
+	h.Sum += value
+	if value > h.Max {
+		h.Max = value
+	}
+}
+
+// Quantile 按分桶估算分位数，返回所在桶的上界（落在最后一个桶时返回最大值）
+func (h *Histogram) Quantile(q float64) float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(h.Count)))
+	var seen int64
+	for i, count := range h.Counts {
+		seen += count
+		if seen >= rank {
+			if i < len(h.Buckets) {
+				return math.Min(h.Buckets[i], h.Max)
+			}
+			return h.Max
+		}
+	}
+	return h.Max
+}
+
+func (h *Histogram) clone() *Histogram {
+	if h == nil {
+		return nil
+	}
+	c := *h
+	c.Counts = append([]int64(nil), h.Counts...)
+	return &c
+}
+
+// Series 单个接口或 SQL 语句的统计
+type Series struct {
+	Kind         string     `json:"kind"`
+	Name         string     `json:"name"`
+	Count        int64      `json:"count"`
+	Errors       int64      `json:"errors"`
+	DurationMs   *Histogram `json:"duration_ms"`
+	RequestSize  *Histogram `json:"request_bytes,omitempty"`
+	ResponseSize *Histogram `json:"response_bytes,omitempty"`
+	P50Ms        float64    `json:"p50_ms"`
+	P95Ms        float64    `json:"p95_ms"`
+	P99Ms        float64    `json:"p99_ms"`
+}
+
+// SlowEntry 一次超过阈值的操作
+type SlowEntry struct {
+	Kind       string    `json:"kind"`
+	Name       string    `json:"name"`
+	DurationMs int64     `json:"duration_ms"`
+	Detail     string    `json:"detail,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+// Snapshot 某一时刻的全部统计
+type Snapshot struct {
+	Since           time.Time   `json:"since"`
+	SlowThresholdMs int64       `json:"slow_threshold_ms"`
+	HTTP            []Series    `json:"http"`
+	DB              []Series    `json:"db"`
+	Slow            []SlowEntry `json:"slow"`
+}
+
+type registry struct {
+	mu     sync.Mutex
+	since  time.Time
+	series map[string]map[string]*Series
+	slow   []SlowEntry
+	next   int
+}
+
+var (
+	defaultRegistry = &registry{since: time.Now(), series: map[string]map[string]*Series{}}
+	slowThreshold   atomic.Int64
+)
+
+// SetSlowThreshold 设置慢操作阈值，小于等于 0 时恢复默认值
+func SetSlowThreshold(threshold time.Duration) {
+	if threshold <= 0 {
+		threshold = DefaultSlowThreshold
+	}
+	slowThreshold.Store(int64(threshold))
+}
+
+// SlowThreshold 返回当前的慢操作阈值
+func SlowThreshold() time.Duration {
+	if threshold := slowThreshold.Load(); threshold > 0 {
+		return time.Duration(threshold)
+	}
+	return DefaultSlowThreshold
+}
+
+// ObserveHTTP 记录一次 HTTP 请求的耗时和请求/响应大小，超过阈值时写入慢操作日志
+func ObserveHTTP(ctx context.Context, name string, duration time.Duration, requestBytes, responseBytes int64, failed bool, detail string) {
+	defaultRegistry.observe(KindHTTP, name, duration, requestBytes, responseBytes, failed)
+	checkSlow(ctx, KindHTTP, name, duration, detail)
+}
+
+// ObserveDB 记录一次数据库操作的耗时，超过阈值时写入慢操作日志
+func ObserveDB(ctx context.Context, statement string, duration time.Duration, failed bool) {
+	defaultRegistry.observe(KindDB, statement, duration, -1, -1, failed)
+	checkSlow(ctx, KindDB, statement, duration, "")
+}
+
+func checkSlow(ctx context.Context, kind, name string, duration time.Duration, detail string) {
+	if duration < SlowThreshold() {
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	entry := SlowEntry{
+		Kind:       kind,
+		Name:       name,
+		DurationMs: duration.Milliseconds(),
+		Detail:     detail,
+		RequestID:  logger.RequestIDFromContext(ctx),
+		At:         time.Now(),
+	}
+	defaultRegistry.recordSlow(entry)
+	logger.WarnContext(ctx, "[慢操作] 操作耗时超过阈值", "kind", kind, "name", name, "duration_ms", entry.DurationMs, "threshold_ms", SlowThreshold().Milliseconds(), "detail", detail)
+}
+
+func (r *registry) observe(kind, name string, duration time.Duration, requestBytes, responseBytes int64, failed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	byName := r.series[kind]
+	if byName == nil {
+		byName = map[string]*Series{}
+		r.series[kind] = byName
+	}
+	s := byName[name]
+	if s == nil {
+		if len(byName) >= maxSeries {
+			name = OtherSeries
+			s = byName[name]
+		}
+		if s == nil {
+			s = &Series{Kind: kind, Name: name, DurationMs: newHistogram(durationBuckets)}
+			if kind == KindHTTP {
+				s.RequestSize = newHistogram(sizeBuckets)
+				s.ResponseSize = newHistogram(sizeBuckets)
+			}
+			byName[name] = s
+		}
+	}
+
+	s.Count++
+	if failed {
+		s.Errors++
+	}
+	s.DurationMs.observe(float64(duration.Microseconds()) / 1000)
+	if s.RequestSize != nil && requestBytes >= 0 {
+		s.RequestSize.observe(float64(requestBytes))
+	}
+	if s.ResponseSize != nil && responseBytes >= 0 {
+		s.ResponseSize.observe(float64(responseBytes))
+	}
+}
+
+func (r *registry) recordSlow(entry SlowEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.slow) < maxSlowEntries {
+		r.slow = append(r.slow, entry)
+		return
+	}
+	r.slow[r.next] = entry
+	r.next = (r.next + 1) % maxSlowEntries
+}
+
+// GetSnapshot 返回当前统计的副本，条目按总耗时从高到低排序，慢操作按时间从新到旧排序
+func GetSnapshot() Snapshot {
+	r := defaultRegistry
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := Snapshot{
+		Since:           r.since,
+		SlowThresholdMs: SlowThreshold().Milliseconds(),
+		HTTP:            r.collect(KindHTTP),
+		DB:              r.collect(KindDB),
+		Slow:            make([]SlowEntry, 0, len(r.slow)),
+	}
+	for i := len(r.slow) - 1; i >= 0; i-- {
+		snapshot.Slow = append(snapshot.Slow, r.slow[(r.next+i)%len(r.slow)])
+	}
+	return snapshot
+}
+
+func (r *registry) collect(kind string) []Series {
+	items := make([]Series, 0, len(r.series[kind]))
+	for _, s := range r.series[kind] {
+		item := *s
+		item.DurationMs = s.DurationMs.clone()
+		item.RequestSize = s.RequestSize.clone()
+		item.ResponseSize = s.ResponseSize.clone()
+		item.P50Ms = item.DurationMs.Quantile(0.5)
+		item.P95Ms = item.DurationMs.Quantile(0.95)
+		item.P99Ms = item.DurationMs.Quantile(0.99)
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].DurationMs.Sum != items[j].DurationMs.Sum {
+			return items[i].DurationMs.Sum > items[j].DurationMs.Sum
+		}
+		return items[i].Name < items[j].Name
+	})
+	return items
+}
+
+// Reset 清空全部统计和慢操作记录
+func Reset() {
+	r := defaultRegistry
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.since = time.Now()
+	r.series = map[string]map[string]*Series{}
+	r.slow = nil
+	r.next = 0
+}
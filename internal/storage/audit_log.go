@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuditEntry records one mutating admin action. Before/After are short human-readable summaries
+// of the affected object, never full secrets or file contents.
+type AuditEntry struct {
+	ID        int64
+	Actor     string
+	IP        string
+	Method    string
+	Path      string
+	Action    string
+	Target    string
+	Before    string
+	After     string
+	Status    int
+	RequestID string
+	CreatedAt time.Time
+}
+
+// AuditFilter narrows ListAuditEntries. Zero values mean "no filter".
+type AuditFilter struct {
+	Actor  string
+	Action string // 前缀匹配，如 "user." 匹配所有用户相关操作
+	Target string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+	Offset int
+}
+
+// CreateAuditEntry stores an audit entry.
+func (r *TrafficRepository) CreateAuditEntry(ctx context.Context, entry AuditEntry) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	if _, err := r.db.ExecContext(ctx, `INSERT INTO audit_log (actor, ip, method, path, action, target, before_summary, after_summary, status, request_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.Actor, entry.IP, entry.Method, entry.Path, entry.Action, entry.Target, entry.Before, entry.After, entry.Status, entry.RequestID); err != nil {
+		return fmt.Errorf("insert audit entry: %w", err)
+	}
+	return nil
+}
+
+// ListAuditEntries returns matching entries newest first together with the total match count.
+func (r *TrafficRepository) ListAuditEntries(ctx context.Context, filter AuditFilter) ([]AuditEntry, int, error) {
+	if r == nil || r.db == nil {
+		return nil, 0, errors.New("traffic repository not initialized")
+	}
+
+	var (
+		conditions []string
+		args       []any
+	)
+	if filter.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, filter.Actor)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "substr(action, 1, ?) = ?")
+		args = append(args, len(filter.Action), filter.Action)
+	}
+	if filter.Target != "" {
+		conditions = append(conditions, "target = ?")
+		args = append(args, filter.Target)
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, sqliteTimestamp(filter.Since))
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, sqliteTimestamp(filter.Until))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM audit_log`+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count audit entries: %w", err)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := r.db.QueryContext(ctx, `SELECT id, actor, ip, method, path, action, target, before_summary, after_summary, status, request_id, created_at FROM audit_log`+where+` ORDER BY id DESC LIMIT ? OFFSET ?`,
+		append(args, limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.Actor, &e.IP, &e.Method, &e.Path, &e.Action, &e.Target, &e.Before, &e.After, &e.Status, &e.RequestID, &e.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("scan audit entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("iterate audit entries: %w", err)
+	}
+
+	return entries, total, nil
+}
+
+// PruneAuditEntries removes entries created before the cutoff and returns how many were deleted.
+func (r *TrafficRepository) PruneAuditEntries(ctx context.Context, before time.Time) (int64, error) {
+	if r == nil || r.db == nil {
+		return 0, errors.New("traffic repository not initialized")
+	}
+
+	res, err := r.db.ExecContext(ctx, `DELETE FROM audit_log WHERE created_at < ?`, sqliteTimestamp(before))
+	if err != nil {
+		return 0, fmt.Errorf("prune audit entries: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// sqliteTimestamp 格式化为与 CURRENT_TIMESTAMP 相同的 UTC 文本，保证按字符串比较的正确性
+func sqliteTimestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
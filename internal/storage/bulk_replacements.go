@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrBulkReplacementNotFound is returned when a find-and-replace run does not exist.
+var ErrBulkReplacementNotFound = errors.New("bulk replacement not found")
+
+// BulkReplacementFile records one file changed by a find-and-replace run.
+type BulkReplacementFile struct {
+	Filename      string `json:"filename"`
+	Matches       int    `json:"matches"`
+	BeforeVersion int64  `json:"before_version"`
+	AfterVersion  int64  `json:"after_version"`
+}
+
+// BulkReplacement is a find-and-replace run across the subscription files.
+type BulkReplacement struct {
+	ID           int64
+	Find         string
+	Replacement  string
+	Regex        bool
+	Files        []BulkReplacementFile
+	CreatedBy    string
+	CreatedAt    time.Time
+	RolledBackAt *time.Time
+}
+
+// CreateBulkReplacement stores a completed find-and-replace run.
+func (r *TrafficRepository) CreateBulkReplacement(ctx context.Context, run BulkReplacement) (BulkReplacement, error) {
+	if r == nil || r.db == nil {
+		return BulkReplacement{}, errors.New("traffic repository not initialized")
+	}
+
+	files := run.Files
+	if files == nil {
+		files = []BulkReplacementFile{}
+	}
+	filesJSON, err := json.Marshal(files)
+	if err != nil {
+		return BulkReplacement{}, fmt.Errorf("encode bulk replacement files: %w", err)
+	}
+
+	res, err := r.db.ExecContext(ctx, `INSERT INTO bulk_replacements (find, replacement, is_regex, files, created_by) VALUES (?, ?, ?, ?, ?)`,
+		run.Find, run.Replacement, boolToInt(run.Regex), string(filesJSON), strings.TrimSpace(run.CreatedBy))
+	if err != nil {
+		return BulkReplacement{}, fmt.Errorf("insert bulk replacement: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return BulkReplacement{}, fmt.Errorf("bulk replacement last insert id: %w", err)
+	}
+
+	return r.GetBulkReplacement(ctx, id)
+}
+
+func scanBulkReplacement(scanner interface{ Scan(dest ...any) error }) (BulkReplacement, error) {
+	var (
+		run        BulkReplacement
+		isRegex    int
+		filesJSON  string
+		rolledBack sql.NullTime
+	)
+	if err := scanner.Scan(&run.ID, &run.Find, &run.Replacement, &isRegex, &filesJSON, &run.CreatedBy, &run.CreatedAt, &rolledBack); err != nil {
+		return BulkReplacement{}, err
+	}
+	run.Regex = isRegex == 1
+	if err := json.Unmarshal([]byte(filesJSON), &run.Files); err != nil {
+		return BulkReplacement{}, fmt.Errorf("decode bulk replacement files: %w", err)
+	}
+	if rolledBack.Valid {
+		t := rolledBack.Time
+		run.RolledBackAt = &t
+	}
+	return run, nil
+}
+
+const bulkReplacementColumns = `id, find, replacement, is_regex, files, created_by, created_at, rolled_back_at`
+
+// GetBulkReplacement returns a single find-and-replace run.
+func (r *TrafficRepository) GetBulkReplacement(ctx context.Context, id int64) (BulkReplacement, error) {
+	if r == nil || r.db == nil {
+		return BulkReplacement{}, errors.New("traffic repository not initialized")
+	}
+
+	run, err := scanBulkReplacement(r.db.QueryRowContext(ctx, `SELECT `+bulkReplacementColumns+` FROM bulk_replacements WHERE id = ?`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return BulkReplacement{}, ErrBulkReplacementNotFound
+		}
+		return BulkReplacement{}, fmt.Errorf("get bulk replacement: %w", err)
+	}
+	return run, nil
+}
+
+// ListBulkReplacements returns the most recent find-and-replace runs, newest first.
+func (r *TrafficRepository) ListBulkReplacements(ctx context.Context, limit int) ([]BulkReplacement, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	if limit <= 0 {
+		limit = 20
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+bulkReplacementColumns+` FROM bulk_replacements ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list bulk replacements: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []BulkReplacement
+	for rows.Next() {
+		run, err := scanBulkReplacement(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan bulk replacement: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate bulk replacements: %w", err)
+	}
+
+	return runs, nil
+}
+
+// MarkBulkReplacementRolledBack records that a find-and-replace run was rolled back.
+func (r *TrafficRepository) MarkBulkReplacementRolledBack(ctx context.Context, id int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	if _, err := r.db.ExecContext(ctx, `UPDATE bulk_replacements SET rolled_back_at = CURRENT_TIMESTAMP WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("mark bulk replacement rolled back: %w", err)
+	}
+	return nil
+}
+
+// GetRuleVersion returns a specific archived version of a rule file.
+func (r *TrafficRepository) GetRuleVersion(ctx context.Context, filename string, version int64) (RuleVersion, error) {
+	if r == nil || r.db == nil {
+		return RuleVersion{}, errors.New("traffic repository not initialized")
+	}
+
+	rv := RuleVersion{Filename: strings.TrimSpace(filename), Version: version}
+	err := r.db.QueryRowContext(ctx, `SELECT content, created_by, created_at FROM rule_versions WHERE filename = ? AND version = ?`, rv.Filename, version).Scan(&rv.Content, &rv.CreatedBy, &rv.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return RuleVersion{}, ErrRuleVersionNotFound
+		}
+		return RuleVersion{}, fmt.Errorf("get rule version: %w", err)
+	}
+	return rv, nil
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CDNSettings configures the Cloudflare cache purge fired when a subscription file changes.
+// PurgeEverything purges the whole zone instead of the changed files' cache tags.
+type CDNSettings struct {
+	Enabled         bool
+	ZoneID          string
+	APIToken        string
+	PurgeEverything bool
+	UpdatedAt       time.Time
+}
+
+// GetCDNSettings returns the CDN purge settings; an empty value is returned when none are saved.
+func (r *TrafficRepository) GetCDNSettings(ctx context.Context) (CDNSettings, error) {
+	if r == nil || r.db == nil {
+		return CDNSettings{}, errors.New("traffic repository not initialized")
+	}
+
+	var settings CDNSettings
+	var enabled, purgeEverything int
+	var sealedToken string
+	err := r.db.QueryRowContext(ctx, `SELECT enabled, zone_id, api_token, purge_everything, updated_at FROM cdn_settings WHERE id = 1`).
+		Scan(&enabled, &settings.ZoneID, &sealedToken, &purgeEverything, &settings.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return CDNSettings{}, nil
+	}
+	if err != nil {
+		return CDNSettings{}, fmt.Errorf("get cdn settings: %w", err)
+	}
+
+	token, err := r.secrets.Open(sealedToken)
+	if err != nil {
+		return CDNSettings{}, fmt.Errorf("open cdn api token: %w", err)
+	}
+	settings.APIToken = token
+	settings.Enabled = enabled != 0
+	settings.PurgeEverything = purgeEverything != 0
+	return settings, nil
+}
+
+// UpdateCDNSettings saves the CDN purge settings.
+func (r *TrafficRepository) UpdateCDNSettings(ctx context.Context, settings CDNSettings) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	sealedToken, err := r.secrets.Seal(strings.TrimSpace(settings.APIToken))
+	if err != nil {
+		return fmt.Errorf("seal cdn api token: %w", err)
+	}
+
+	const stmt = `
+INSERT INTO cdn_settings (id, enabled, zone_id, api_token, purge_everything, updated_at)
+VALUES (1, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(id) DO UPDATE SET
+    enabled = excluded.enabled,
+    zone_id = excluded.zone_id,
+    api_token = excluded.api_token,
+    purge_everything = excluded.purge_everything,
+    updated_at = CURRENT_TIMESTAMP;
+`
+	if _, err := r.db.ExecContext(ctx, stmt, boolToInt(settings.Enabled), strings.TrimSpace(settings.ZoneID), sealedToken, boolToInt(settings.PurgeEverything)); err != nil {
+		return fmt.Errorf("update cdn settings: %w", err)
+	}
+
+	return nil
+}
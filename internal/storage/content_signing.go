@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ContentSigningKey is the instance Ed25519 key used to sign generated configs.
+type ContentSigningKey struct {
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
+	CreatedAt  time.Time
+}
+
+// GetContentSigningKey returns the instance signing key, generating it on first use.
+func (r *TrafficRepository) GetContentSigningKey(ctx context.Context) (ContentSigningKey, error) {
+	if r == nil || r.db == nil {
+		return ContentSigningKey{}, errors.New("traffic repository not initialized")
+	}
+
+	var sealed, publicKey string
+	var createdAt time.Time
+	err := r.db.QueryRowContext(ctx, `SELECT private_key, public_key, created_at FROM content_signing_key WHERE id = 1`).Scan(&sealed, &publicKey, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		// 首次使用时生成；并发请求下只保留先写入的密钥
+		return r.saveContentSigningKey(ctx, false)
+	}
+	if err != nil {
+		return ContentSigningKey{}, fmt.Errorf("get content signing key: %w", err)
+	}
+
+	seed, err := r.secrets.Open(sealed)
+	if err != nil {
+		return ContentSigningKey{}, fmt.Errorf("open content signing key: %w", err)
+	}
+	rawSeed, err := base64.StdEncoding.DecodeString(seed)
+	if err != nil || len(rawSeed) != ed25519.SeedSize {
+		return ContentSigningKey{}, errors.New("invalid content signing key")
+	}
+
+	privateKey := ed25519.NewKeyFromSeed(rawSeed)
+	return ContentSigningKey{
+		PrivateKey: privateKey,
+		PublicKey:  privateKey.Public().(ed25519.PublicKey),
+		CreatedAt:  createdAt,
+	}, nil
+}
+
+// RotateContentSigningKey replaces the instance signing key with a newly generated one.
+// Configs signed with the previous key no longer verify against the published public key.
+func (r *TrafficRepository) RotateContentSigningKey(ctx context.Context) (ContentSigningKey, error) {
+	if r == nil || r.db == nil {
+		return ContentSigningKey{}, errors.New("traffic repository not initialized")
+	}
+
+	return r.saveContentSigningKey(ctx, true)
+}
+
+func (r *TrafficRepository) saveContentSigningKey(ctx context.Context, replace bool) (ContentSigningKey, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return ContentSigningKey{}, fmt.Errorf("generate content signing key: %w", err)
+	}
+	sealed, err := r.secrets.Seal(base64.StdEncoding.EncodeToString(privateKey.Seed()))
+	if err != nil {
+		return ContentSigningKey{}, fmt.Errorf("seal content signing key: %w", err)
+	}
+
+	stmt := `INSERT INTO content_signing_key (id, private_key, public_key, created_at) VALUES (1, ?, ?, ?)
+ON CONFLICT(id) DO UPDATE SET private_key = excluded.private_key, public_key = excluded.public_key, created_at = excluded.created_at`
+	if !replace {
+		stmt = `INSERT INTO content_signing_key (id, private_key, public_key, created_at) VALUES (1, ?, ?, ?) ON CONFLICT(id) DO NOTHING`
+	}
+
+	createdAt := time.Now().UTC()
+	result, err := r.db.ExecContext(ctx, stmt, sealed, base64.StdEncoding.EncodeToString(publicKey), createdAt)
+	if err != nil {
+		return ContentSigningKey{}, fmt.Errorf("save content signing key: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return r.GetContentSigningKey(ctx)
+	}
+
+	return ContentSigningKey{PrivateKey: privateKey, PublicKey: publicKey, CreatedAt: createdAt}, nil
+}
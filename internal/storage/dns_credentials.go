@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrDNSCredentialNotFound is returned when a DNS credential does not exist for the user.
+	ErrDNSCredentialNotFound = errors.New("dns credential not found")
+	// ErrDNSCredentialInUse is returned when deleting a credential that node deployments still reference.
+	ErrDNSCredentialInUse = errors.New("dns credential is used by node deployments")
+)
+
+// DNSCredential holds the API credentials of a DNS provider used for ACME DNS-01 validation when
+// provisioning exits. Values are stored encrypted; Domains scopes the credential to the zones it may
+// issue certificates for, so one credential can be shared by every deployment under those zones.
+type DNSCredential struct {
+	ID         int64
+	Username   string
+	Name       string
+	Provider   string
+	Values     map[string]string // Provider specific keys, e.g. CF_Token
+	Domains    []string          // Zones the credential may be used for, e.g. example.com
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Allows reports whether domain (or a wildcard / subdomain of it) falls within the credential's scope.
+func (c DNSCredential) Allows(domain string) bool {
+	domain = strings.TrimPrefix(strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), ".")), "*.")
+	if domain == "" {
+		return false
+	}
+	for _, zone := range c.Domains {
+		zone = strings.TrimPrefix(strings.ToLower(strings.TrimSuffix(strings.TrimSpace(zone), ".")), "*.")
+		if zone != "" && (domain == zone || strings.HasSuffix(domain, "."+zone)) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeDNSCredentialDomains lowercases, trims and de-duplicates the scope.
+func normalizeDNSCredentialDomains(domains []string) []string {
+	seen := make(map[string]bool, len(domains))
+	result := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+		if domain == "" || seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		result = append(result, domain)
+	}
+	return result
+}
+
+const dnsCredentialColumns = `id, username, name, provider, secret, domains, last_used_at, created_at, updated_at`
+
+func (r *TrafficRepository) scanDNSCredential(scanner interface{ Scan(...any) error }) (DNSCredential, error) {
+	var (
+		c       DNSCredential
+		sealed  string
+		domains string
+		lastUse sql.NullTime
+	)
+	if err := scanner.Scan(&c.ID, &c.Username, &c.Name, &c.Provider, &sealed, &domains, &lastUse, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return DNSCredential{}, err
+	}
+
+	plain, err := r.secrets.Open(sealed)
+	if err != nil {
+		return DNSCredential{}, fmt.Errorf("open dns credential: %w", err)
+	}
+	c.Values = map[string]string{}
+	if plain != "" {
+		if err := json.Unmarshal([]byte(plain), &c.Values); err != nil {
+			return DNSCredential{}, fmt.Errorf("decode dns credential: %w", err)
+		}
+	}
+	if domains != "" {
+		_ = json.Unmarshal([]byte(domains), &c.Domains)
+	}
+	if lastUse.Valid {
+		t := lastUse.Time
+		c.LastUsedAt = &t
+	}
+	return c, nil
+}
+
+func (r *TrafficRepository) encodeDNSCredential(c DNSCredential) (sealed, domains string, err error) {
+	values, err := json.Marshal(c.Values)
+	if err != nil {
+		return "", "", fmt.Errorf("encode dns credential: %w", err)
+	}
+	sealed, err = r.secrets.Seal(string(values))
+	if err != nil {
+		return "", "", fmt.Errorf("seal dns credential: %w", err)
+	}
+	scope, err := json.Marshal(normalizeDNSCredentialDomains(c.Domains))
+	if err != nil {
+		return "", "", fmt.Errorf("encode dns credential domains: %w", err)
+	}
+	return sealed, string(scope), nil
+}
+
+// CreateDNSCredential stores a new credential for c.Username.
+func (r *TrafficRepository) CreateDNSCredential(ctx context.Context, c DNSCredential) (DNSCredential, error) {
+	if r == nil || r.db == nil {
+		return DNSCredential{}, errors.New("traffic repository not initialized")
+	}
+
+	c.Username = strings.TrimSpace(c.Username)
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Username == "" || c.Name == "" || c.Provider == "" {
+		return DNSCredential{}, errors.New("dns credential username, name and provider are required")
+	}
+	if len(normalizeDNSCredentialDomains(c.Domains)) == 0 {
+		return DNSCredential{}, errors.New("dns credential requires at least one domain")
+	}
+
+	sealed, domains, err := r.encodeDNSCredential(c)
+	if err != nil {
+		return DNSCredential{}, err
+	}
+	res, err := r.db.ExecContext(ctx, `INSERT INTO dns_credentials (username, name, provider, secret, domains) VALUES (?, ?, ?, ?, ?)`,
+		c.Username, c.Name, c.Provider, sealed, domains)
+	if err != nil {
+		return DNSCredential{}, fmt.Errorf("create dns credential: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return DNSCredential{}, fmt.Errorf("dns credential id: %w", err)
+	}
+	return r.GetDNSCredential(ctx, id, c.Username)
+}
+
+// ListDNSCredentials returns the credentials of username ordered by name.
+func (r *TrafficRepository) ListDNSCredentials(ctx context.Context, username string) ([]DNSCredential, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+dnsCredentialColumns+` FROM dns_credentials WHERE username = ? ORDER BY name ASC, id ASC`, username)
+	if err != nil {
+		return nil, fmt.Errorf("list dns credentials: %w", err)
+	}
+	defer rows.Close()
+
+	var credentials []DNSCredential
+	for rows.Next() {
+		c, err := r.scanDNSCredential(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan dns credential: %w", err)
+		}
+		credentials = append(credentials, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate dns credentials: %w", err)
+	}
+	return credentials, nil
+}
+
+// GetDNSCredential returns a credential owned by username.
+func (r *TrafficRepository) GetDNSCredential(ctx context.Context, id int64, username string) (DNSCredential, error) {
+	if r == nil || r.db == nil {
+		return DNSCredential{}, errors.New("traffic repository not initialized")
+	}
+
+	c, err := r.scanDNSCredential(r.db.QueryRowContext(ctx, `SELECT `+dnsCredentialColumns+` FROM dns_credentials WHERE id = ? AND username = ?`, id, username))
+	if errors.Is(err, sql.ErrNoRows) {
+		return DNSCredential{}, ErrDNSCredentialNotFound
+	}
+	if err != nil {
+		return DNSCredential{}, fmt.Errorf("get dns credential: %w", err)
+	}
+	return c, nil
+}
+
+// UpdateDNSCredential replaces the name, scope and values of a credential.
+func (r *TrafficRepository) UpdateDNSCredential(ctx context.Context, c DNSCredential) (DNSCredential, error) {
+	if r == nil || r.db == nil {
+		return DNSCredential{}, errors.New("traffic repository not initialized")
+	}
+
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		return DNSCredential{}, errors.New("dns credential name is required")
+	}
+	if len(normalizeDNSCredentialDomains(c.Domains)) == 0 {
+		return DNSCredential{}, errors.New("dns credential requires at least one domain")
+	}
+
+	sealed, domains, err := r.encodeDNSCredential(c)
+	if err != nil {
+		return DNSCredential{}, err
+	}
+	res, err := r.db.ExecContext(ctx, `UPDATE dns_credentials SET name = ?, secret = ?, domains = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND username = ?`,
+		c.Name, sealed, domains, c.ID, c.Username)
+	if err != nil {
+		return DNSCredential{}, fmt.Errorf("update dns credential: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return DNSCredential{}, fmt.Errorf("dns credential update rows affected: %w", err)
+	}
+	if affected == 0 {
+		return DNSCredential{}, ErrDNSCredentialNotFound
+	}
+	return r.GetDNSCredential(ctx, c.ID, c.Username)
+}
+
+// DeleteDNSCredential removes a credential that no node deployment references.
+func (r *TrafficRepository) DeleteDNSCredential(ctx context.Context, id int64, username string) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	var inUse int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM node_deployments WHERE dns_credential_id = ? AND username = ?`, id, username).Scan(&inUse); err != nil {
+		return fmt.Errorf("count dns credential usage: %w", err)
+	}
+	if inUse > 0 {
+		return ErrDNSCredentialInUse
+	}
+
+	res, err := r.db.ExecContext(ctx, `DELETE FROM dns_credentials WHERE id = ? AND username = ?`, id, username)
+	if err != nil {
+		return fmt.Errorf("delete dns credential: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("dns credential delete rows affected: %w", err)
+	}
+	if affected == 0 {
+		return ErrDNSCredentialNotFound
+	}
+	return nil
+}
+
+// TouchDNSCredential records that a credential was used to issue a certificate.
+func (r *TrafficRepository) TouchDNSCredential(ctx context.Context, id int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	if _, err := r.db.ExecContext(ctx, `UPDATE dns_credentials SET last_used_at = ? WHERE id = ?`, time.Now().UTC(), id); err != nil {
+		return fmt.Errorf("touch dns credential: %w", err)
+	}
+	return nil
+}
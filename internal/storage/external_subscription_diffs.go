@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxExternalSubscriptionDiffs 每个外部订阅保留的差异记录条数
+const maxExternalSubscriptionDiffs = 20
+
+var ErrExternalSubscriptionDiffNotFound = errors.New("external subscription diff not found")
+
+// ExternalSubscriptionNodeChange describes a node whose configuration changed between syncs.
+type ExternalSubscriptionNodeChange struct {
+	Name   string   `json:"name"`
+	Fields []string `json:"fields"`
+}
+
+// ExternalSubscriptionDiff records what an external subscription changed during a sync.
+// NodeSnapshot maps node names to their Clash config JSON and is used as the baseline for the next sync.
+type ExternalSubscriptionDiff struct {
+	ID             int64
+	SubscriptionID int64
+	Username       string
+	Added          []string
+	Removed        []string
+	Changed        []ExternalSubscriptionNodeChange
+	NodeSnapshot   map[string]string
+	CreatedAt      time.Time
+}
+
+// RecordExternalSubscriptionDiff stores a sync diff and prunes old records for the subscription.
+func (r *TrafficRepository) RecordExternalSubscriptionDiff(ctx context.Context, diff ExternalSubscriptionDiff) (int64, error) {
+	if r == nil || r.db == nil {
+		return 0, errors.New("traffic repository not initialized")
+	}
+
+	if diff.SubscriptionID <= 0 {
+		return 0, errors.New("subscription id is required")
+	}
+
+	username := strings.TrimSpace(diff.Username)
+	if username == "" {
+		return 0, errors.New("username is required")
+	}
+
+	added, err := marshalJSONOrDefault(diff.Added, "[]")
+	if err != nil {
+		return 0, fmt.Errorf("encode added nodes: %w", err)
+	}
+	removed, err := marshalJSONOrDefault(diff.Removed, "[]")
+	if err != nil {
+		return 0, fmt.Errorf("encode removed nodes: %w", err)
+	}
+	changed, err := marshalJSONOrDefault(diff.Changed, "[]")
+	if err != nil {
+		return 0, fmt.Errorf("encode changed nodes: %w", err)
+	}
+	snapshot, err := marshalJSONOrDefault(diff.NodeSnapshot, "{}")
+	if err != nil {
+		return 0, fmt.Errorf("encode node snapshot: %w", err)
+	}
+
+	const stmt = `INSERT INTO external_subscription_diffs (subscription_id, username, added, removed, changed, node_snapshot) VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := r.db.ExecContext(ctx, stmt, diff.SubscriptionID, username, added, removed, changed, snapshot)
+	if err != nil {
+		return 0, fmt.Errorf("insert external subscription diff: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("get last insert id: %w", err)
+	}
+
+	const pruneStmt = `
+DELETE FROM external_subscription_diffs
+WHERE subscription_id = ? AND id NOT IN (
+    SELECT id FROM external_subscription_diffs WHERE subscription_id = ? ORDER BY id DESC LIMIT ?
+)`
+	if _, err := r.db.ExecContext(ctx, pruneStmt, diff.SubscriptionID, diff.SubscriptionID, maxExternalSubscriptionDiffs); err != nil {
+		return id, fmt.Errorf("prune external subscription diffs: %w", err)
+	}
+
+	return id, nil
+}
+
+// GetLatestExternalSubscriptionDiff returns the most recent sync diff for a subscription.
+func (r *TrafficRepository) GetLatestExternalSubscriptionDiff(ctx context.Context, subscriptionID int64, username string) (ExternalSubscriptionDiff, error) {
+	diffs, err := r.ListExternalSubscriptionDiffs(ctx, subscriptionID, username, 1)
+	if err != nil {
+		return ExternalSubscriptionDiff{}, err
+	}
+	if len(diffs) == 0 {
+		return ExternalSubscriptionDiff{}, ErrExternalSubscriptionDiffNotFound
+	}
+	return diffs[0], nil
+}
+
+// ListExternalSubscriptionDiffs returns sync diffs for a subscription, newest first.
+func (r *TrafficRepository) ListExternalSubscriptionDiffs(ctx context.Context, subscriptionID int64, username string, limit int) ([]ExternalSubscriptionDiff, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	if subscriptionID <= 0 {
+		return nil, errors.New("subscription id is required")
+	}
+
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, errors.New("username is required")
+	}
+
+	if limit <= 0 || limit > maxExternalSubscriptionDiffs {
+		limit = maxExternalSubscriptionDiffs
+	}
+
+	const stmt = `SELECT id, subscription_id, username, added, removed, changed, node_snapshot, created_at FROM external_subscription_diffs WHERE subscription_id = ? AND username = ? ORDER BY id DESC LIMIT ?`
+	rows, err := r.db.QueryContext(ctx, stmt, subscriptionID, username, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list external subscription diffs: %w", err)
+	}
+	defer rows.Close()
+
+	var diffs []ExternalSubscriptionDiff
+	for rows.Next() {
+		diff, err := scanExternalSubscriptionDiff(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan external subscription diff: %w", err)
+		}
+		diffs = append(diffs, diff)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate external subscription diffs: %w", err)
+	}
+
+	return diffs, nil
+}
+
+func scanExternalSubscriptionDiff(scanner rowScanner) (ExternalSubscriptionDiff, error) {
+	var (
+		diff     ExternalSubscriptionDiff
+		added    sql.NullString
+		removed  sql.NullString
+		changed  sql.NullString
+		snapshot sql.NullString
+	)
+
+	if err := scanner.Scan(&diff.ID, &diff.SubscriptionID, &diff.Username, &added, &removed, &changed, &snapshot, &diff.CreatedAt); err != nil {
+		return diff, err
+	}
+
+	diff.Added = []string{}
+	diff.Removed = []string{}
+	diff.Changed = []ExternalSubscriptionNodeChange{}
+	diff.NodeSnapshot = map[string]string{}
+
+	if added.Valid && added.String != "" {
+		if err := json.Unmarshal([]byte(added.String), &diff.Added); err != nil {
+			return diff, fmt.Errorf("decode added nodes: %w", err)
+		}
+	}
+	if removed.Valid && removed.String != "" {
+		if err := json.Unmarshal([]byte(removed.String), &diff.Removed); err != nil {
+			return diff, fmt.Errorf("decode removed nodes: %w", err)
+		}
+	}
+	if changed.Valid && changed.String != "" {
+		if err := json.Unmarshal([]byte(changed.String), &diff.Changed); err != nil {
+			return diff, fmt.Errorf("decode changed nodes: %w", err)
+		}
+	}
+	if snapshot.Valid && snapshot.String != "" {
+		if err := json.Unmarshal([]byte(snapshot.String), &diff.NodeSnapshot); err != nil {
+			return diff, fmt.Errorf("decode node snapshot: %w", err)
+		}
+	}
+
+	return diff, nil
+}
+
+func marshalJSONOrDefault(value any, fallback string) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	if string(data) == "null" {
+		return fallback, nil
+	}
+	return string(data), nil
+}
@@ -0,0 +1,357 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrFederationPeerNotFound is returned when a federation peer does not exist or its token is unknown.
+var ErrFederationPeerNotFound = errors.New("federation peer not found")
+
+const (
+	// FederationKindNode / FederationKindFile 记录从上游实例同步过来的对象类型
+	FederationKindNode = "node"
+	FederationKindFile = "file"
+
+	// DefaultFederationIntervalMinutes 从实例拉取上游的默认间隔
+	DefaultFederationIntervalMinutes = 10
+	federationTokenBytes             = 32
+	federationTokenHintLength        = 6
+)
+
+// FederationPeer is a secondary instance allowed to pull this instance's node pool and subscribe files.
+// Only the SHA-256 of its token is stored; the token itself is shown once on creation.
+type FederationPeer struct {
+	ID         int64
+	Name       string
+	Owner      string // Admin whose node pool is exported to the peer
+	TokenHint  string
+	LastSeenAt *time.Time
+	LastSeenIP string
+	CreatedAt  time.Time
+}
+
+// FederationUpstream is the primary instance this instance mirrors. There is at most one.
+type FederationUpstream struct {
+	URL             string
+	Token           string
+	Username        string // Local admin that receives the mirrored nodes
+	IntervalMinutes int
+	Enabled         bool
+	SyncNodes       bool
+	SyncFiles       bool
+	ETag            string
+	LastSyncAt      *time.Time
+	LastSuccessAt   *time.Time
+	LastError       string
+	LastNodes       int
+	LastFiles       int
+}
+
+// Due reports whether the upstream should be pulled again at now.
+func (u FederationUpstream) Due(now time.Time) bool {
+	if !u.Enabled || u.URL == "" {
+		return false
+	}
+	if u.LastSyncAt == nil {
+		return true
+	}
+	interval := u.IntervalMinutes
+	if interval <= 0 {
+		interval = DefaultFederationIntervalMinutes
+	}
+	return !u.LastSyncAt.Add(time.Duration(interval) * time.Minute).After(now)
+}
+
+// FederationSyncResult is the outcome of one pull from the upstream.
+type FederationSyncResult struct {
+	At    time.Time
+	ETag  string
+	Nodes int
+	Files int
+	Err   error
+}
+
+func hashFederationToken(token string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateFederationPeer registers a new peer and returns it with its plaintext token.
+func (r *TrafficRepository) CreateFederationPeer(ctx context.Context, name, owner string) (FederationPeer, string, error) {
+	if r == nil || r.db == nil {
+		return FederationPeer{}, "", errors.New("traffic repository not initialized")
+	}
+
+	name = strings.TrimSpace(name)
+	owner = strings.TrimSpace(owner)
+	if name == "" || owner == "" {
+		return FederationPeer{}, "", errors.New("peer name and owner are required")
+	}
+
+	raw := make([]byte, federationTokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return FederationPeer{}, "", fmt.Errorf("generate federation token: %w", err)
+	}
+	token := "mmwf_" + hex.EncodeToString(raw)
+	hint := token[len(token)-federationTokenHintLength:]
+
+	res, err := r.db.ExecContext(ctx, `INSERT INTO federation_peers (name, owner, token_hash, token_hint) VALUES (?, ?, ?, ?)`,
+		name, owner, hashFederationToken(token), hint)
+	if err != nil {
+		return FederationPeer{}, "", fmt.Errorf("create federation peer: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return FederationPeer{}, "", fmt.Errorf("federation peer id: %w", err)
+	}
+
+	peer, err := scanFederationPeer(r.db.QueryRowContext(ctx, `SELECT `+federationPeerColumns+` FROM federation_peers WHERE id = ?`, id))
+	if err != nil {
+		return FederationPeer{}, "", fmt.Errorf("get federation peer: %w", err)
+	}
+	return peer, token, nil
+}
+
+const federationPeerColumns = `id, name, owner, token_hint, last_seen_at, last_seen_ip, created_at`
+
+func scanFederationPeer(scanner interface{ Scan(...any) error }) (FederationPeer, error) {
+	var (
+		peer     FederationPeer
+		lastSeen sql.NullTime
+	)
+	if err := scanner.Scan(&peer.ID, &peer.Name, &peer.Owner, &peer.TokenHint, &lastSeen, &peer.LastSeenIP, &peer.CreatedAt); err != nil {
+		return FederationPeer{}, err
+	}
+	if lastSeen.Valid {
+		t := lastSeen.Time
+		peer.LastSeenAt = &t
+	}
+	return peer, nil
+}
+
+// ListFederationPeers returns all registered peers ordered by id.
+func (r *TrafficRepository) ListFederationPeers(ctx context.Context) ([]FederationPeer, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+federationPeerColumns+` FROM federation_peers ORDER BY id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("list federation peers: %w", err)
+	}
+	defer rows.Close()
+
+	var peers []FederationPeer
+	for rows.Next() {
+		peer, err := scanFederationPeer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan federation peer: %w", err)
+		}
+		peers = append(peers, peer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate federation peers: %w", err)
+	}
+	return peers, nil
+}
+
+// DeleteFederationPeer revokes a peer; its token stops working immediately.
+func (r *TrafficRepository) DeleteFederationPeer(ctx context.Context, id int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	res, err := r.db.ExecContext(ctx, `DELETE FROM federation_peers WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete federation peer: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("federation peer delete rows affected: %w", err)
+	}
+	if affected == 0 {
+		return ErrFederationPeerNotFound
+	}
+	return nil
+}
+
+// AuthenticateFederationPeer resolves the peer owning token and records the access.
+func (r *TrafficRepository) AuthenticateFederationPeer(ctx context.Context, token, remoteIP string) (FederationPeer, error) {
+	if r == nil || r.db == nil {
+		return FederationPeer{}, errors.New("traffic repository not initialized")
+	}
+	if strings.TrimSpace(token) == "" {
+		return FederationPeer{}, ErrFederationPeerNotFound
+	}
+
+	hash := hashFederationToken(token)
+	peer, err := scanFederationPeer(r.db.QueryRowContext(ctx, `SELECT `+federationPeerColumns+` FROM federation_peers WHERE token_hash = ?`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return FederationPeer{}, ErrFederationPeerNotFound
+	}
+	if err != nil {
+		return FederationPeer{}, fmt.Errorf("authenticate federation peer: %w", err)
+	}
+
+	now := time.Now().UTC()
+	if _, err := r.db.ExecContext(ctx, `UPDATE federation_peers SET last_seen_at = ?, last_seen_ip = ? WHERE id = ?`, now, remoteIP, peer.ID); err != nil {
+		return FederationPeer{}, fmt.Errorf("record federation peer access: %w", err)
+	}
+	peer.LastSeenAt = &now
+	peer.LastSeenIP = remoteIP
+	return peer, nil
+}
+
+// GetFederationUpstream returns the configured upstream, or a disabled default when none is configured.
+func (r *TrafficRepository) GetFederationUpstream(ctx context.Context) (FederationUpstream, error) {
+	if r == nil || r.db == nil {
+		return FederationUpstream{}, errors.New("traffic repository not initialized")
+	}
+
+	var (
+		up                    FederationUpstream
+		sealedToken           string
+		enabled, nodes, files int
+		lastSync, lastSuccess sql.NullTime
+	)
+	err := r.db.QueryRowContext(ctx, `SELECT url, token, username, interval_minutes, enabled, sync_nodes, sync_files, etag, last_sync_at, last_success_at, last_error, last_nodes, last_files FROM federation_upstream WHERE id = 1`).
+		Scan(&up.URL, &sealedToken, &up.Username, &up.IntervalMinutes, &enabled, &nodes, &files, &up.ETag, &lastSync, &lastSuccess, &up.LastError, &up.LastNodes, &up.LastFiles)
+	if errors.Is(err, sql.ErrNoRows) {
+		return FederationUpstream{IntervalMinutes: DefaultFederationIntervalMinutes, SyncNodes: true, SyncFiles: true}, nil
+	}
+	if err != nil {
+		return FederationUpstream{}, fmt.Errorf("get federation upstream: %w", err)
+	}
+
+	token, err := r.secrets.Open(sealedToken)
+	if err != nil {
+		return FederationUpstream{}, fmt.Errorf("open federation token: %w", err)
+	}
+	up.Token = token
+	up.Enabled = enabled != 0
+	up.SyncNodes = nodes != 0
+	up.SyncFiles = files != 0
+	if lastSync.Valid {
+		t := lastSync.Time
+		up.LastSyncAt = &t
+	}
+	if lastSuccess.Valid {
+		t := lastSuccess.Time
+		up.LastSuccessAt = &t
+	}
+	return up, nil
+}
+
+// SaveFederationUpstream stores the upstream connection settings. Changing the URL clears the
+// cached ETag so the next pull fetches everything.
+func (r *TrafficRepository) SaveFederationUpstream(ctx context.Context, up FederationUpstream) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	sealedToken, err := r.secrets.Seal(strings.TrimSpace(up.Token))
+	if err != nil {
+		return fmt.Errorf("seal federation token: %w", err)
+	}
+	if up.IntervalMinutes <= 0 {
+		up.IntervalMinutes = DefaultFederationIntervalMinutes
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+INSERT INTO federation_upstream (id, url, token, username, interval_minutes, enabled, sync_nodes, sync_files, updated_at)
+VALUES (1, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(id) DO UPDATE SET
+    etag = CASE WHEN federation_upstream.url = excluded.url THEN federation_upstream.etag ELSE '' END,
+    url = excluded.url,
+    token = excluded.token,
+    username = excluded.username,
+    interval_minutes = excluded.interval_minutes,
+    enabled = excluded.enabled,
+    sync_nodes = excluded.sync_nodes,
+    sync_files = excluded.sync_files,
+    updated_at = CURRENT_TIMESTAMP`,
+		strings.TrimSpace(up.URL), sealedToken, strings.TrimSpace(up.Username), up.IntervalMinutes,
+		boolToInt(up.Enabled), boolToInt(up.SyncNodes), boolToInt(up.SyncFiles))
+	if err != nil {
+		return fmt.Errorf("save federation upstream: %w", err)
+	}
+	return nil
+}
+
+// RecordFederationSync stores the outcome of a pull. The ETag and counters only change on success.
+func (r *TrafficRepository) RecordFederationSync(ctx context.Context, result FederationSyncResult) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	at := result.At.UTC()
+	var err error
+	if result.Err != nil {
+		_, err = r.db.ExecContext(ctx, `UPDATE federation_upstream SET last_sync_at = ?, last_error = ? WHERE id = 1`, at, result.Err.Error())
+	} else {
+		_, err = r.db.ExecContext(ctx, `UPDATE federation_upstream SET last_sync_at = ?, last_success_at = ?, last_error = '', etag = ?, last_nodes = ?, last_files = ? WHERE id = 1`,
+			at, at, result.ETag, result.Nodes, result.Files)
+	}
+	if err != nil {
+		return fmt.Errorf("record federation sync: %w", err)
+	}
+	return nil
+}
+
+// ListFederationSynced returns the public IDs of objects of kind that were mirrored from the upstream.
+func (r *TrafficRepository) ListFederationSynced(ctx context.Context, kind string) (map[string]struct{}, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT uuid FROM federation_synced WHERE kind = ?`, kind)
+	if err != nil {
+		return nil, fmt.Errorf("list federation synced: %w", err)
+	}
+	defer rows.Close()
+
+	synced := make(map[string]struct{})
+	for rows.Next() {
+		var uuid string
+		if err := rows.Scan(&uuid); err != nil {
+			return nil, fmt.Errorf("scan federation synced: %w", err)
+		}
+		synced[uuid] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate federation synced: %w", err)
+	}
+	return synced, nil
+}
+
+// MarkFederationSynced records that the object with the given public ID is mirrored from the upstream.
+func (r *TrafficRepository) MarkFederationSynced(ctx context.Context, kind, uuid string) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	if _, err := r.db.ExecContext(ctx, `INSERT OR IGNORE INTO federation_synced (kind, uuid) VALUES (?, ?)`, kind, uuid); err != nil {
+		return fmt.Errorf("mark federation synced: %w", err)
+	}
+	return nil
+}
+
+// UnmarkFederationSynced forgets a mirrored object, e.g. after it was removed upstream.
+func (r *TrafficRepository) UnmarkFederationSynced(ctx context.Context, kind, uuid string) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM federation_synced WHERE kind = ? AND uuid = ?`, kind, uuid); err != nil {
+		return fmt.Errorf("unmark federation synced: %w", err)
+	}
+	return nil
+}
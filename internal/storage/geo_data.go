@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrGeoDataFileNotFound is returned when a geo database name is not managed by the panel.
+	ErrGeoDataFileNotFound = errors.New("geo data file not found")
+	// ErrGeoDataFileExists is returned when adding a geo database whose name is already taken.
+	ErrGeoDataFileExists = errors.New("geo data file already exists")
+	// ErrGeoDataFileBuiltin is returned when trying to delete one of the built-in geo databases.
+	ErrGeoDataFileBuiltin = errors.New("built-in geo data file cannot be deleted")
+)
+
+// GeoDataFile is a GeoIP / GeoSite database (or rule set) the panel downloads on a schedule and
+// serves to clients. Built-in files are the databases referenced by geox-url and cannot be deleted.
+type GeoDataFile struct {
+	Name         string
+	URL          string
+	Builtin      bool
+	Enabled      bool
+	Size         int64
+	SHA256       string
+	ETag         string
+	LastModified string
+	UpdatedAt    *time.Time // last time the content changed
+	CheckedAt    *time.Time // last download attempt, successful or not
+	LastError    string
+	CreatedAt    time.Time
+}
+
+const geoDataFileColumns = `name, url, builtin, enabled, size, sha256, etag, last_modified, updated_at, checked_at, last_error, created_at`
+
+func scanGeoDataFile(scanner interface{ Scan(...any) error }) (GeoDataFile, error) {
+	var (
+		f                    GeoDataFile
+		builtin, enabled     int
+		updatedAt, checkedAt sql.NullTime
+	)
+	if err := scanner.Scan(&f.Name, &f.URL, &builtin, &enabled, &f.Size, &f.SHA256, &f.ETag, &f.LastModified, &updatedAt, &checkedAt, &f.LastError, &f.CreatedAt); err != nil {
+		return GeoDataFile{}, err
+	}
+	f.Builtin = builtin != 0
+	f.Enabled = enabled != 0
+	if updatedAt.Valid {
+		t := updatedAt.Time
+		f.UpdatedAt = &t
+	}
+	if checkedAt.Valid {
+		t := checkedAt.Time
+		f.CheckedAt = &t
+	}
+	return f, nil
+}
+
+// EnsureBuiltinGeoDataFile registers a built-in geo database with its default URL. Existing rows,
+// including a URL changed by an admin, are left untouched.
+func (r *TrafficRepository) EnsureBuiltinGeoDataFile(ctx context.Context, name, url string) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	if _, err := r.db.ExecContext(ctx, `INSERT INTO geo_data_files (name, url, builtin) VALUES (?, ?, 1) ON CONFLICT(name) DO NOTHING`, name, strings.TrimSpace(url)); err != nil {
+		return fmt.Errorf("ensure builtin geo data file: %w", err)
+	}
+	return nil
+}
+
+// ListGeoDataFiles returns every managed geo database, built-in files first.
+func (r *TrafficRepository) ListGeoDataFiles(ctx context.Context) ([]GeoDataFile, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+geoDataFileColumns+` FROM geo_data_files ORDER BY builtin DESC, name ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("list geo data files: %w", err)
+	}
+	defer rows.Close()
+
+	var files []GeoDataFile
+	for rows.Next() {
+		f, err := scanGeoDataFile(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan geo data file: %w", err)
+		}
+		files = append(files, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate geo data files: %w", err)
+	}
+	return files, nil
+}
+
+// GetGeoDataFile returns a managed geo database by name.
+func (r *TrafficRepository) GetGeoDataFile(ctx context.Context, name string) (GeoDataFile, error) {
+	if r == nil || r.db == nil {
+		return GeoDataFile{}, errors.New("traffic repository not initialized")
+	}
+
+	f, err := scanGeoDataFile(r.db.QueryRowContext(ctx, `SELECT `+geoDataFileColumns+` FROM geo_data_files WHERE name = ?`, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return GeoDataFile{}, ErrGeoDataFileNotFound
+	}
+	if err != nil {
+		return GeoDataFile{}, fmt.Errorf("get geo data file: %w", err)
+	}
+	return f, nil
+}
+
+// CreateGeoDataFile adds a custom geo database downloaded from url.
+func (r *TrafficRepository) CreateGeoDataFile(ctx context.Context, name, url string) (GeoDataFile, error) {
+	if r == nil || r.db == nil {
+		return GeoDataFile{}, errors.New("traffic repository not initialized")
+	}
+
+	res, err := r.db.ExecContext(ctx, `INSERT INTO geo_data_files (name, url) VALUES (?, ?) ON CONFLICT(name) DO NOTHING`, name, strings.TrimSpace(url))
+	if err != nil {
+		return GeoDataFile{}, fmt.Errorf("create geo data file: %w", err)
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return GeoDataFile{}, ErrGeoDataFileExists
+	}
+	return r.GetGeoDataFile(ctx, name)
+}
+
+// UpdateGeoDataFile changes the download URL and enabled state of a geo database. Changing the URL
+// clears the conditional request validators so the next update downloads the new source in full.
+func (r *TrafficRepository) UpdateGeoDataFile(ctx context.Context, name, url string, enabled bool) (GeoDataFile, error) {
+	if r == nil || r.db == nil {
+		return GeoDataFile{}, errors.New("traffic repository not initialized")
+	}
+
+	const stmt = `
+UPDATE geo_data_files
+SET enabled = ?,
+    etag = CASE WHEN url = ? THEN etag ELSE '' END,
+    last_modified = CASE WHEN url = ? THEN last_modified ELSE '' END,
+    url = ?
+WHERE name = ?`
+	url = strings.TrimSpace(url)
+	res, err := r.db.ExecContext(ctx, stmt, boolToInt(enabled), url, url, url, name)
+	if err != nil {
+		return GeoDataFile{}, fmt.Errorf("update geo data file: %w", err)
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return GeoDataFile{}, ErrGeoDataFileNotFound
+	}
+	return r.GetGeoDataFile(ctx, name)
+}
+
+// DeleteGeoDataFile removes a custom geo database. Built-in files can only be disabled.
+func (r *TrafficRepository) DeleteGeoDataFile(ctx context.Context, name string) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	f, err := r.GetGeoDataFile(ctx, name)
+	if err != nil {
+		return err
+	}
+	if f.Builtin {
+		return ErrGeoDataFileBuiltin
+	}
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM geo_data_files WHERE name = ?`, name); err != nil {
+		return fmt.Errorf("delete geo data file: %w", err)
+	}
+	return nil
+}
+
+// RecordGeoDataFetch stores the outcome of a download attempt. A non-empty fetchErr keeps the
+// previous content metadata; changed reports whether new content was written.
+func (r *TrafficRepository) RecordGeoDataFetch(ctx context.Context, f GeoDataFile, changed bool, fetchErr string) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	now := time.Now().UTC()
+	var err error
+	switch {
+	case fetchErr != "":
+		_, err = r.db.ExecContext(ctx, `UPDATE geo_data_files SET checked_at = ?, last_error = ? WHERE name = ?`, now, fetchErr, f.Name)
+	case changed:
+		_, err = r.db.ExecContext(ctx, `UPDATE geo_data_files SET size = ?, sha256 = ?, etag = ?, last_modified = ?, updated_at = ?, checked_at = ?, last_error = '' WHERE name = ?`,
+			f.Size, f.SHA256, f.ETag, f.LastModified, now, now, f.Name)
+	default:
+		_, err = r.db.ExecContext(ctx, `UPDATE geo_data_files SET checked_at = ?, last_error = '' WHERE name = ?`, now, f.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("record geo data fetch: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"miaomiaowu/internal/metrics"
+)
+
+// instrumentedDriverName wraps the sqlite driver and reports the duration of every statement to the
+// metrics package (including row iteration for queries).
+const instrumentedDriverName = "sqlite-metrics"
+
+// maxStatementNameLength keeps metric names readable; longer statements are truncated.
+const maxStatementNameLength = 160
+
+var (
+	statementWhitespace = regexp.MustCompile(`\s+`)
+	// statementPlaceholders collapses IN (?, ?, ?) lists so that statements built for a varying
+	// number of arguments share one metric.
+	statementPlaceholders = regexp.MustCompile(`\?(\s*,\s*\?)+`)
+)
+
+func init() {
+	db, err := sql.Open("sqlite", "")
+	if err != nil {
+		panic("open sqlite driver: " + err.Error())
+	}
+	base := db.Driver()
+	_ = db.Close()
+	sql.Register(instrumentedDriverName, &instrumentedDriver{base: base})
+}
+
+// statementName normalizes a SQL statement into a stable metric name.
+func statementName(query string) string {
+	name := strings.TrimSpace(statementWhitespace.ReplaceAllString(query, " "))
+	name = statementPlaceholders.ReplaceAllString(name, "?, ...")
+	if len(name) > maxStatementNameLength {
+		cut := maxStatementNameLength
+		for cut > 0 && !utf8RuneStart(name[cut]) {
+			cut--
+		}
+		name = name[:cut] + "..."
+	}
+	return name
+}
+
+func utf8RuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+func observeStatement(ctx context.Context, query string, start time.Time, err error) {
+	metrics.ObserveDB(ctx, statementName(query), time.Since(start), err != nil && !errors.Is(err, driver.ErrSkip))
+}
+
+type instrumentedDriver struct {
+	base driver.Driver
+}
+
+func (d *instrumentedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.base.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn}, nil
+}
+
+// instrumentedConn forwards to the sqlite connection. The optional interfaces database/sql looks for
+// are implemented here and fall back to driver.ErrSkip (or a no-op) when the wrapped connection
+// doesn't support them.
+type instrumentedConn struct {
+	driver.Conn
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	observeStatement(ctx, query, start, err)
+	return result, err
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != nil {
+		observeStatement(ctx, query, start, err)
+		return nil, err
+	}
+	return &instrumentedRows{Rows: rows, ctx: ctx, query: query, start: start}, nil
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var (
+		stmt driver.Stmt
+		err  error
+	)
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, query: query}, nil
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+type instrumentedStmt struct {
+	driver.Stmt
+	query string
+}
+
+func (s *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := s.Stmt.(driver.StmtExecContext)
+	if !ok {
+		return nil, errors.New("sqlite statement does not support ExecContext")
+	}
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, args)
+	observeStatement(ctx, s.query, start, err)
+	return result, err
+}
+
+func (s *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := s.Stmt.(driver.StmtQueryContext)
+	if !ok {
+		return nil, errors.New("sqlite statement does not support QueryContext")
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, args)
+	if err != nil {
+		observeStatement(ctx, s.query, start, err)
+		return nil, err
+	}
+	return &instrumentedRows{Rows: rows, ctx: ctx, query: s.query, start: start}, nil
+}
+
+// instrumentedRows reports the query once the rows are closed, so the time spent stepping through
+// the result set is included.
+type instrumentedRows struct {
+	driver.Rows
+	ctx    context.Context
+	query  string
+	start  time.Time
+	err    error
+	closed bool
+}
+
+func (r *instrumentedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err != nil && !errors.Is(err, io.EOF) {
+		r.err = err
+	}
+	return err
+}
+
+func (r *instrumentedRows) Close() error {
+	err := r.Rows.Close()
+	if !r.closed {
+		r.closed = true
+		observeStatement(r.ctx, r.query, r.start, r.err)
+	}
+	return err
+}
+
+func (r *instrumentedRows) ColumnTypeDatabaseTypeName(index int) string {
+	if typed, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return typed.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *instrumentedRows) ColumnTypeScanType(index int) reflect.Type {
+	if typed, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return typed.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(any)).Elem()
+}
+
+func (r *instrumentedRows) ColumnTypeNullable(index int) (bool, bool) {
+	if typed, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+		return typed.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *instrumentedRows) ColumnTypeLength(index int) (int64, bool) {
+	if typed, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return typed.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *instrumentedRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if typed, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return typed.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvitationExists   = errors.New("invitation code already exists")
+	// ErrInvitationInvalid 邀请码不存在、已过期或已用完，对外统一返回该错误
+	ErrInvitationInvalid = errors.New("invitation code is invalid, expired or used up")
+)
+
+// invitationCodeAlphabet 去掉了容易混淆的 0/O、1/I/L
+const invitationCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// Invitation 管理员生成的邀请码，注册时可预设角色与订阅
+type Invitation struct {
+	ID              int64
+	Code            string
+	Role            string
+	SubscriptionIDs []int64
+	MaxUses         int
+	UsedCount       int
+	ExpiresAt       *time.Time
+	Note            string
+	CreatedBy       string
+	CreatedAt       time.Time
+}
+
+// Usable reports whether the invitation can still be redeemed at the given time.
+func (inv Invitation) Usable(now time.Time) bool {
+	if inv.UsedCount >= inv.MaxUses {
+		return false
+	}
+	return inv.ExpiresAt == nil || now.Before(*inv.ExpiresAt)
+}
+
+// InvitationRegistration 通过邀请码注册时提交的账号信息
+type InvitationRegistration struct {
+	Code         string
+	Username     string
+	Email        string
+	Nickname     string
+	PasswordHash string
+}
+
+const invitationColumns = `id, code, role, subscription_ids, max_uses, used_count, expires_at, note, created_by, created_at`
+
+func scanInvitation(scanner interface{ Scan(...any) error }) (Invitation, error) {
+	var (
+		inv             Invitation
+		subscriptionIDs string
+		expiresAt       sql.NullTime
+	)
+	if err := scanner.Scan(&inv.ID, &inv.Code, &inv.Role, &subscriptionIDs, &inv.MaxUses, &inv.UsedCount, &expiresAt, &inv.Note, &inv.CreatedBy, &inv.CreatedAt); err != nil {
+		return Invitation{}, err
+	}
+	if subscriptionIDs != "" {
+		if err := json.Unmarshal([]byte(subscriptionIDs), &inv.SubscriptionIDs); err != nil {
+			return Invitation{}, fmt.Errorf("decode invitation subscriptions: %w", err)
+		}
+	}
+	if expiresAt.Valid {
+		t := expiresAt.Time
+		inv.ExpiresAt = &t
+	}
+	return inv, nil
+}
+
+// CreateInvitation stores a new invite code. A random code is generated when inv.Code is empty.
+func (r *TrafficRepository) CreateInvitation(ctx context.Context, inv Invitation) (Invitation, error) {
+	if r == nil || r.db == nil {
+		return Invitation{}, errors.New("traffic repository not initialized")
+	}
+
+	inv.Code = strings.ToUpper(strings.TrimSpace(inv.Code))
+	inv.Role = strings.ToLower(strings.TrimSpace(inv.Role))
+	if inv.Role != RoleAdmin {
+		inv.Role = RoleUser
+	}
+	if inv.MaxUses <= 0 {
+		inv.MaxUses = 1
+	}
+	if inv.SubscriptionIDs == nil {
+		inv.SubscriptionIDs = []int64{}
+	}
+	subscriptionIDs, err := json.Marshal(inv.SubscriptionIDs)
+	if err != nil {
+		return Invitation{}, fmt.Errorf("encode invitation subscriptions: %w", err)
+	}
+
+	var expiresAt any
+	if inv.ExpiresAt != nil {
+		expiresAt = inv.ExpiresAt.UTC()
+	}
+
+	generated := inv.Code == ""
+	for attempt := 0; attempt < 5; attempt++ {
+		if generated {
+			if inv.Code, err = randomInvitationCode(12); err != nil {
+				return Invitation{}, err
+			}
+		}
+
+		const stmt = `INSERT OR IGNORE INTO invitations (code, role, subscription_ids, max_uses, expires_at, note, created_by) VALUES (?, ?, ?, ?, ?, ?, ?)`
+		result, err := r.db.ExecContext(ctx, stmt, inv.Code, inv.Role, string(subscriptionIDs), inv.MaxUses, expiresAt, strings.TrimSpace(inv.Note), strings.TrimSpace(inv.CreatedBy))
+		if err != nil {
+			return Invitation{}, fmt.Errorf("create invitation: %w", err)
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected > 0 {
+			id, err := result.LastInsertId()
+			if err != nil {
+				return Invitation{}, fmt.Errorf("invitation last insert id: %w", err)
+			}
+			return r.GetInvitation(ctx, id)
+		}
+		if !generated {
+			return Invitation{}, ErrInvitationExists
+		}
+	}
+
+	return Invitation{}, errors.New("create invitation: too many collisions")
+}
+
+// GetInvitation returns an invitation by ID.
+func (r *TrafficRepository) GetInvitation(ctx context.Context, id int64) (Invitation, error) {
+	if r == nil || r.db == nil {
+		return Invitation{}, errors.New("traffic repository not initialized")
+	}
+
+	row := r.db.QueryRowContext(ctx, `SELECT `+invitationColumns+` FROM invitations WHERE id = ?`, id)
+	inv, err := scanInvitation(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Invitation{}, ErrInvitationNotFound
+		}
+		return Invitation{}, fmt.Errorf("get invitation: %w", err)
+	}
+	return inv, nil
+}
+
+// ListInvitations returns all invitations, newest first.
+func (r *TrafficRepository) ListInvitations(ctx context.Context) ([]Invitation, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+invitationColumns+` FROM invitations ORDER BY id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("list invitations: %w", err)
+	}
+	defer rows.Close()
+
+	var invitations []Invitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan invitation: %w", err)
+		}
+		invitations = append(invitations, inv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate invitations: %w", err)
+	}
+	return invitations, nil
+}
+
+// DeleteInvitation revokes an invitation. Accounts already registered with it are kept.
+func (r *TrafficRepository) DeleteInvitation(ctx context.Context, id int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM invitations WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete invitation: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delete invitation rows affected: %w", err)
+	}
+	if affected == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// RegisterWithInvitation consumes one use of the invite code and creates the account with the
+// invitation's role and subscriptions in a single transaction.
+func (r *TrafficRepository) RegisterWithInvitation(ctx context.Context, reg InvitationRegistration) (User, Invitation, error) {
+	if r == nil || r.db == nil {
+		return User{}, Invitation{}, errors.New("traffic repository not initialized")
+	}
+
+	code := strings.ToUpper(strings.TrimSpace(reg.Code))
+	username := strings.TrimSpace(reg.Username)
+	email := strings.TrimSpace(reg.Email)
+	nickname := strings.TrimSpace(reg.Nickname)
+	if code == "" {
+		return User{}, Invitation{}, ErrInvitationInvalid
+	}
+	if username == "" {
+		return User{}, Invitation{}, errors.New("username is required")
+	}
+	if reg.PasswordHash == "" {
+		return User{}, Invitation{}, errors.New("password hash is required")
+	}
+	if nickname == "" {
+		nickname = username
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return User{}, Invitation{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, `SELECT `+invitationColumns+` FROM invitations WHERE code = ?`, code)
+	inv, err := scanInvitation(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, Invitation{}, ErrInvitationInvalid
+		}
+		return User{}, Invitation{}, fmt.Errorf("get invitation: %w", err)
+	}
+	if !inv.Usable(time.Now().UTC()) {
+		return User{}, Invitation{}, ErrInvitationInvalid
+	}
+
+	// 条件更新防止并发注册超出可用次数
+	result, err := tx.ExecContext(ctx, `UPDATE invitations SET used_count = used_count + 1 WHERE id = ? AND used_count < max_uses`, inv.ID)
+	if err != nil {
+		return User{}, Invitation{}, fmt.Errorf("consume invitation: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return User{}, Invitation{}, ErrInvitationInvalid
+	}
+	inv.UsedCount++
+
+	const insertUser = `INSERT INTO users (username, password_hash, email, nickname, role, is_active, remark, invitation_id) VALUES (?, ?, ?, ?, ?, 1, '', ?)`
+	if _, err := tx.ExecContext(ctx, insertUser, username, reg.PasswordHash, email, nickname, inv.Role, inv.ID); err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			return User{}, Invitation{}, ErrUserExists
+		}
+		return User{}, Invitation{}, fmt.Errorf("create user: %w", err)
+	}
+
+	for _, id := range inv.SubscriptionIDs {
+		// 订阅可能在邀请码生成后被删除，忽略不存在的订阅
+		const stmt = `INSERT INTO user_subscriptions (username, subscription_id) SELECT ?, id FROM subscribe_files WHERE id = ?`
+		if _, err := tx.ExecContext(ctx, stmt, username, id); err != nil {
+			return User{}, Invitation{}, fmt.Errorf("assign invitation subscription %d: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return User{}, Invitation{}, fmt.Errorf("commit transaction: %w", err)
+	}
+
+	user, err := r.GetUser(ctx, username)
+	if err != nil {
+		return User{}, Invitation{}, err
+	}
+	return user, inv, nil
+}
+
+func randomInvitationCode(length int) (string, error) {
+	max := big.NewInt(int64(len(invitationCodeAlphabet)))
+	var builder strings.Builder
+	builder.Grow(length)
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("generate invitation code: %w", err)
+		}
+		builder.WriteByte(invitationCodeAlphabet[n.Int64()])
+	}
+	return builder.String(), nil
+}
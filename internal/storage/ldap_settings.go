@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// AuthSourceLocal users log in with the password stored in the users table.
+	AuthSourceLocal = "local"
+	// AuthSourceLDAP users are verified against the LDAP directory on every login.
+	AuthSourceLDAP = "ldap"
+
+	defaultLDAPUserFilter     = "(uid=%s)"
+	defaultLDAPEmailAttribute = "mail"
+	defaultLDAPNameAttribute  = "displayName"
+
+	// ldapPasswordHash LDAP 账号的本地密码占位，不是合法的 bcrypt 哈希，因此本地密码永远无法通过校验
+	ldapPasswordHash = "!ldap"
+)
+
+// LDAPSettings configures the LDAP / Active Directory login backend.
+type LDAPSettings struct {
+	Enabled        bool
+	URL            string // ldap://host:389 or ldaps://host:636
+	StartTLS       bool
+	SkipTLSVerify  bool
+	BindDN         string // Service account used to search users; empty binds anonymously
+	BindPassword   string
+	BaseDN         string
+	UserFilter     string // %s is replaced with the escaped login name, e.g. (sAMAccountName=%s)
+	EmailAttribute string
+	NameAttribute  string
+	AutoCreate     bool   // Create a local account on the first successful LDAP login
+	DefaultRole    string // Role assigned to auto-created accounts
+	UpdatedAt      time.Time
+}
+
+// EffectiveUserFilter returns the user filter, defaulting to (uid=%s).
+func (s LDAPSettings) EffectiveUserFilter() string {
+	if filter := strings.TrimSpace(s.UserFilter); filter != "" {
+		return filter
+	}
+	return defaultLDAPUserFilter
+}
+
+// EffectiveEmailAttribute returns the email attribute, defaulting to mail.
+func (s LDAPSettings) EffectiveEmailAttribute() string {
+	if attr := strings.TrimSpace(s.EmailAttribute); attr != "" {
+		return attr
+	}
+	return defaultLDAPEmailAttribute
+}
+
+// EffectiveNameAttribute returns the display name attribute, defaulting to displayName.
+func (s LDAPSettings) EffectiveNameAttribute() string {
+	if attr := strings.TrimSpace(s.NameAttribute); attr != "" {
+		return attr
+	}
+	return defaultLDAPNameAttribute
+}
+
+// GetLDAPSettings returns the LDAP settings; defaults are returned when none are saved.
+func (r *TrafficRepository) GetLDAPSettings(ctx context.Context) (LDAPSettings, error) {
+	if r == nil || r.db == nil {
+		return LDAPSettings{}, errors.New("traffic repository not initialized")
+	}
+
+	var settings LDAPSettings
+	var enabled, startTLS, skipVerify, autoCreate int
+	var sealedPassword string
+	err := r.db.QueryRowContext(ctx, `SELECT enabled, url, start_tls, skip_tls_verify, bind_dn, bind_password, base_dn, user_filter, email_attribute, name_attribute, auto_create, default_role, updated_at FROM ldap_settings WHERE id = 1`).
+		Scan(&enabled, &settings.URL, &startTLS, &skipVerify, &settings.BindDN, &sealedPassword, &settings.BaseDN, &settings.UserFilter,
+			&settings.EmailAttribute, &settings.NameAttribute, &autoCreate, &settings.DefaultRole, &settings.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return LDAPSettings{AutoCreate: true, DefaultRole: RoleUser}, nil
+	}
+	if err != nil {
+		return LDAPSettings{}, fmt.Errorf("get ldap settings: %w", err)
+	}
+
+	password, err := r.secrets.Open(sealedPassword)
+	if err != nil {
+		return LDAPSettings{}, fmt.Errorf("open ldap bind password: %w", err)
+	}
+	settings.BindPassword = password
+	settings.Enabled = enabled != 0
+	settings.StartTLS = startTLS != 0
+	settings.SkipTLSVerify = skipVerify != 0
+	settings.AutoCreate = autoCreate != 0
+	return settings, nil
+}
+
+// UpdateLDAPSettings saves the LDAP settings.
+func (r *TrafficRepository) UpdateLDAPSettings(ctx context.Context, settings LDAPSettings) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	sealedPassword, err := r.secrets.Seal(settings.BindPassword)
+	if err != nil {
+		return fmt.Errorf("seal ldap bind password: %w", err)
+	}
+	role := RoleUser
+	if settings.DefaultRole == RoleAdmin {
+		role = RoleAdmin
+	}
+
+	const stmt = `
+INSERT INTO ldap_settings (id, enabled, url, start_tls, skip_tls_verify, bind_dn, bind_password, base_dn, user_filter, email_attribute, name_attribute, auto_create, default_role, updated_at)
+VALUES (1, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(id) DO UPDATE SET
+    enabled = excluded.enabled,
+    url = excluded.url,
+    start_tls = excluded.start_tls,
+    skip_tls_verify = excluded.skip_tls_verify,
+    bind_dn = excluded.bind_dn,
+    bind_password = excluded.bind_password,
+    base_dn = excluded.base_dn,
+    user_filter = excluded.user_filter,
+    email_attribute = excluded.email_attribute,
+    name_attribute = excluded.name_attribute,
+    auto_create = excluded.auto_create,
+    default_role = excluded.default_role,
+    updated_at = CURRENT_TIMESTAMP;
+`
+	if _, err := r.db.ExecContext(ctx, stmt, boolToInt(settings.Enabled), strings.TrimSpace(settings.URL), boolToInt(settings.StartTLS),
+		boolToInt(settings.SkipTLSVerify), strings.TrimSpace(settings.BindDN), sealedPassword, strings.TrimSpace(settings.BaseDN),
+		strings.TrimSpace(settings.UserFilter), strings.TrimSpace(settings.EmailAttribute), strings.TrimSpace(settings.NameAttribute),
+		boolToInt(settings.AutoCreate), role); err != nil {
+		return fmt.Errorf("update ldap settings: %w", err)
+	}
+
+	return nil
+}
+
+// CreateLDAPUser creates the local account for a directory user on first login. The account has no
+// usable local password.
+func (r *TrafficRepository) CreateLDAPUser(ctx context.Context, username, email, nickname, role string) error {
+	if err := r.CreateUser(ctx, username, email, nickname, ldapPasswordHash, role, ""); err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, `UPDATE users SET auth_source = ? WHERE username = ?`, AuthSourceLDAP, strings.TrimSpace(username)); err != nil {
+		return fmt.Errorf("mark ldap user: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// LoginCodeLength 登录码位数
+const LoginCodeLength = 6
+
+var ErrLoginCodeInvalid = errors.New("login code is invalid or expired")
+
+// CreateLoginCode issues a single-use numeric code that can be exchanged for a session on another device.
+// Any code previously issued for the user is revoked, so only the latest one is valid.
+func (r *TrafficRepository) CreateLoginCode(ctx context.Context, username string, ttl time.Duration) (string, time.Time, error) {
+	if r == nil || r.db == nil {
+		return "", time.Time{}, errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return "", time.Time{}, errors.New("username is required")
+	}
+	if ttl <= 0 {
+		return "", time.Time{}, errors.New("ttl must be positive")
+	}
+
+	now := time.Now().UTC()
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM login_codes WHERE username = ? OR expires_at <= ? OR used_at IS NOT NULL`, username, now); err != nil {
+		return "", time.Time{}, fmt.Errorf("clear login codes: %w", err)
+	}
+
+	expiresAt := now.Add(ttl)
+	// 6 位码存在碰撞可能，主键冲突时重新生成
+	for attempt := 0; attempt < 5; attempt++ {
+		code, err := randomNumericCode(LoginCodeLength)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+
+		const stmt = `INSERT OR IGNORE INTO login_codes (code_hash, username, expires_at) VALUES (?, ?, ?)`
+		result, err := r.db.ExecContext(ctx, stmt, hashLoginCode(code), username, expiresAt)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("create login code: %w", err)
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected > 0 {
+			return code, expiresAt, nil
+		}
+	}
+
+	return "", time.Time{}, errors.New("create login code: too many collisions")
+}
+
+// ConsumeLoginCode validates the code and marks it as used, returning the owning username.
+func (r *TrafficRepository) ConsumeLoginCode(ctx context.Context, code string) (string, error) {
+	if r == nil || r.db == nil {
+		return "", errors.New("traffic repository not initialized")
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) != LoginCodeLength {
+		return "", ErrLoginCodeInvalid
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var (
+		username  string
+		expiresAt time.Time
+		usedAt    sql.NullTime
+	)
+	codeHash := hashLoginCode(code)
+	row := tx.QueryRowContext(ctx, `SELECT username, expires_at, used_at FROM login_codes WHERE code_hash = ?`, codeHash)
+	if err := row.Scan(&username, &expiresAt, &usedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrLoginCodeInvalid
+		}
+		return "", fmt.Errorf("get login code: %w", err)
+	}
+
+	now := time.Now().UTC()
+	if usedAt.Valid || !now.Before(expiresAt) {
+		return "", ErrLoginCodeInvalid
+	}
+
+	result, err := tx.ExecContext(ctx, `UPDATE login_codes SET used_at = ? WHERE code_hash = ? AND used_at IS NULL`, now, codeHash)
+	if err != nil {
+		return "", fmt.Errorf("consume login code: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return "", ErrLoginCodeInvalid
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return username, nil
+}
+
+// RevokeLoginCodes removes all pending login codes for the user.
+func (r *TrafficRepository) RevokeLoginCodes(ctx context.Context, username string) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return errors.New("username is required")
+	}
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM login_codes WHERE username = ?`, username); err != nil {
+		return fmt.Errorf("revoke login codes: %w", err)
+	}
+
+	return nil
+}
+
+func randomNumericCode(length int) (string, error) {
+	max := big.NewInt(10)
+	var builder strings.Builder
+	builder.Grow(length)
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("generate login code: %w", err)
+		}
+		builder.WriteByte(byte('0' + n.Int64()))
+	}
+	return builder.String(), nil
+}
+
+func hashLoginCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
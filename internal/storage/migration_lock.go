@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Migration states reported by CurrentMigrationProgress.
+const (
+	MigrationStatePending = "pending"
+	MigrationStateWaiting = "waiting_lock" // Another instance holds the migration lock
+	MigrationStateRunning = "migrating"
+	MigrationStateReady   = "ready"
+	MigrationStateFailed  = "failed"
+)
+
+const (
+	// migrationLockTTL is how long a migration lock stays valid without a heartbeat. A lock left by a
+	// crashed instance is taken over once it expires.
+	migrationLockTTL = 10 * time.Minute
+	// migrationLockRenewInterval is the minimum gap between two heartbeats of the lock holder.
+	migrationLockRenewInterval = 30 * time.Second
+	// migrationLockPollInterval is how often a waiting instance retries the lock.
+	migrationLockPollInterval = time.Second
+	// migrationBusyTimeoutMillis makes statements wait for another instance's write instead of failing.
+	migrationBusyTimeoutMillis = 5000
+)
+
+// MigrationProgress describes the schema migration run at startup.
+type MigrationProgress struct {
+	State     string    `json:"state"`
+	Step      string    `json:"step,omitempty"`
+	Rows      int64     `json:"rows,omitempty"` // Rows copied by the current table rebuild
+	LockOwner string    `json:"lock_owner,omitempty"`
+	StartedAt time.Time `json:"started_at,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+var migrationProgress = struct {
+	sync.Mutex
+	current MigrationProgress
+	hook    func(MigrationProgress)
+}{current: MigrationProgress{State: MigrationStatePending}}
+
+// CurrentMigrationProgress returns the state of the startup schema migration.
+func CurrentMigrationProgress() MigrationProgress {
+	migrationProgress.Lock()
+	defer migrationProgress.Unlock()
+	return migrationProgress.current
+}
+
+// SetMigrationProgressHook registers a callback invoked on every migration state or step change,
+// e.g. to log progress. It must not call back into the repository.
+func SetMigrationProgressHook(hook func(MigrationProgress)) {
+	migrationProgress.Lock()
+	defer migrationProgress.Unlock()
+	migrationProgress.hook = hook
+}
+
+func updateMigrationProgress(update func(*MigrationProgress)) {
+	migrationProgress.Lock()
+	update(&migrationProgress.current)
+	snapshot := migrationProgress.current
+	hook := migrationProgress.hook
+	migrationProgress.Unlock()
+
+	if hook != nil {
+		hook(snapshot)
+	}
+}
+
+// migrationLock is a row in schema_migration_lock that keeps two instances sharing one database
+// file from running the schema migration at the same time.
+type migrationLock struct {
+	db        *sql.DB
+	owner     string
+	renewedAt time.Time
+}
+
+func migrationLockOwner() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s/%d/%d", host, os.Getpid(), time.Now().UnixNano())
+}
+
+// acquireMigrationLock waits until the migration lock is free or expired and takes it.
+func acquireMigrationLock(ctx context.Context, db *sql.DB) (*migrationLock, error) {
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("PRAGMA busy_timeout = %d", migrationBusyTimeoutMillis)); err != nil {
+		return nil, fmt.Errorf("set busy timeout: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS schema_migration_lock (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    owner TEXT NOT NULL,
+    expires_at INTEGER NOT NULL
+)`); err != nil {
+		return nil, fmt.Errorf("create migration lock table: %w", err)
+	}
+
+	lock := &migrationLock{db: db, owner: migrationLockOwner()}
+	waiting := false
+	for {
+		now := time.Now()
+		result, err := db.ExecContext(ctx, `
+INSERT INTO schema_migration_lock (id, owner, expires_at) VALUES (1, ?, ?)
+ON CONFLICT(id) DO UPDATE SET owner = excluded.owner, expires_at = excluded.expires_at
+WHERE schema_migration_lock.expires_at < ?`, lock.owner, now.Add(migrationLockTTL).Unix(), now.Unix())
+		if err != nil {
+			return nil, fmt.Errorf("acquire migration lock: %w", err)
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected > 0 {
+			lock.renewedAt = now
+			return lock, nil
+		}
+
+		if !waiting {
+			waiting = true
+			var holder string
+			_ = db.QueryRowContext(ctx, `SELECT owner FROM schema_migration_lock WHERE id = 1`).Scan(&holder)
+			updateMigrationProgress(func(p *MigrationProgress) {
+				p.State = MigrationStateWaiting
+				p.LockOwner = holder
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(migrationLockPollInterval):
+		}
+	}
+}
+
+// renew extends the lock when the last heartbeat is older than migrationLockRenewInterval.
+func (l *migrationLock) renew() error {
+	if l == nil || time.Since(l.renewedAt) < migrationLockRenewInterval {
+		return nil
+	}
+	now := time.Now()
+	result, err := l.db.Exec(`UPDATE schema_migration_lock SET expires_at = ? WHERE id = 1 AND owner = ?`, now.Add(migrationLockTTL).Unix(), l.owner)
+	if err != nil {
+		return fmt.Errorf("renew migration lock: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return errors.New("migration lock was taken over by another instance")
+	}
+	l.renewedAt = now
+	return nil
+}
+
+func (l *migrationLock) release() {
+	if l == nil {
+		return
+	}
+	_, _ = l.db.Exec(`DELETE FROM schema_migration_lock WHERE id = 1 AND owner = ?`, l.owner)
+}
+
+// runMigrations runs migrate under the migration lock and publishes its progress.
+func (r *TrafficRepository) runMigrations() error {
+	lock, err := acquireMigrationLock(context.Background(), r.db)
+	if err != nil {
+		updateMigrationProgress(func(p *MigrationProgress) {
+			p.State = MigrationStateFailed
+			p.Error = err.Error()
+		})
+		return err
+	}
+	defer lock.release()
+
+	r.migrationLock = lock
+	defer func() { r.migrationLock = nil }()
+
+	updateMigrationProgress(func(p *MigrationProgress) {
+		p.State = MigrationStateRunning
+		p.Step = "schema"
+		p.Rows = 0
+		p.LockOwner = lock.owner
+		p.StartedAt = time.Now()
+		p.Error = ""
+	})
+
+	if err := r.migrate(); err != nil {
+		updateMigrationProgress(func(p *MigrationProgress) {
+			p.State = MigrationStateFailed
+			p.Error = err.Error()
+		})
+		return err
+	}
+
+	updateMigrationProgress(func(p *MigrationProgress) {
+		p.State = MigrationStateReady
+		p.Step = ""
+		p.Rows = 0
+		p.LockOwner = ""
+	})
+	return nil
+}
+
+// migrationStep reports the start of a long-running migration step, such as a table rebuild, and
+// keeps the migration lock alive.
+func (r *TrafficRepository) migrationStep(step string, rows int64) error {
+	updateMigrationProgress(func(p *MigrationProgress) {
+		p.Step = step
+		p.Rows = rows
+	})
+	return r.migrationLock.renew()
+}
+
+// countTableRows returns the row count of a table that is about to be rebuilt.
+func (r *TrafficRepository) countTableRows(table string) int64 {
+	var count int64
+	_ = r.db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&count)
+	return count
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ProtectedNodeCustomFields 自定义字段不能覆盖节点的身份字段，这些字段由解析器维护
+var ProtectedNodeCustomFields = []string{"name", "type", "server", "port"}
+
+// ClashOutput returns the node's Clash config with its custom fields merged in.
+func (n Node) ClashOutput() string {
+	return MergeNodeCustomFields(n.ClashConfig, n.CustomFields)
+}
+
+// MergeNodeCustomFields overlays custom fields onto a Clash proxy JSON. Protected keys are
+// skipped, and the original config is returned unchanged when it can't be parsed.
+func MergeNodeCustomFields(clashConfig string, fields map[string]any) string {
+	if len(fields) == 0 || clashConfig == "" {
+		return clashConfig
+	}
+	var proxy map[string]any
+	if err := json.Unmarshal([]byte(clashConfig), &proxy); err != nil || proxy == nil {
+		return clashConfig
+	}
+	for key, value := range fields {
+		if slices.Contains(ProtectedNodeCustomFields, key) {
+			continue
+		}
+		proxy[key] = value
+	}
+	merged, err := json.Marshal(proxy)
+	if err != nil {
+		return clashConfig
+	}
+	return string(merged)
+}
+
+// SetNodeCustomFields replaces the extra key/values stored on a node; an empty map clears them.
+func (r *TrafficRepository) SetNodeCustomFields(ctx context.Context, id int64, username string, fields map[string]any) (Node, error) {
+	if r == nil || r.db == nil {
+		return Node{}, errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	if id <= 0 || username == "" {
+		return Node{}, errors.New("node id and username are required")
+	}
+
+	encoded, err := encodeNodeCustomFields(fields)
+	if err != nil {
+		return Node{}, err
+	}
+
+	res, err := r.db.ExecContext(ctx, `UPDATE nodes SET custom_fields = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND username = ?`, encoded, id, username)
+	if err != nil {
+		return Node{}, fmt.Errorf("update node custom fields: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return Node{}, fmt.Errorf("node custom fields rows affected: %w", err)
+	}
+	if affected == 0 {
+		return Node{}, ErrNodeNotFound
+	}
+
+	return r.GetNode(ctx, id, username)
+}
+
+func encodeNodeCustomFields(fields map[string]any) (string, error) {
+	if len(fields) == 0 {
+		return "{}", nil
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("encode node custom fields: %w", err)
+	}
+	return string(data), nil
+}
+
+func decodeNodeCustomFields(raw string) map[string]any {
+	if raw == "" || raw == "{}" {
+		return nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(raw), &fields); err != nil || len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNodeDeploymentNotFound is returned when a node deployment does not exist or its agent token is unknown.
+var ErrNodeDeploymentNotFound = errors.New("node deployment not found")
+
+const (
+	// NodeDeploymentModeSSH 面板通过 SSH 登录服务器执行安装脚本；NodeDeploymentModeAgent 由服务器执行命令后用令牌上报分享链接
+	NodeDeploymentModeSSH   = "ssh"
+	NodeDeploymentModeAgent = "agent"
+
+	NodeDeploymentStatusPending   = "pending"
+	NodeDeploymentStatusRunning   = "running"
+	NodeDeploymentStatusSucceeded = "succeeded"
+	NodeDeploymentStatusFailed    = "failed"
+
+	nodeDeploymentTokenBytes      = 24
+	nodeDeploymentTokenHintLength = 6
+	// maxNodeDeploymentLog 只保留部署输出的末尾部分
+	maxNodeDeploymentLog = 32 << 10
+)
+
+// NodeDeployment provisions an exit server with an install script and registers the resulting share
+// links as nodes of Username. The SSH credential is stored encrypted so that the deployment can be
+// refreshed later; agent deployments store only the SHA-256 of their token.
+type NodeDeployment struct {
+	ID              int64
+	Username        string
+	Name            string
+	Mode            string
+	Script          string // Install script preset, or "custom" to run Command
+	Command         string
+	Host            string
+	Port            int
+	SSHUser         string
+	AuthType        string // "password" or "key"
+	Credential      string // Password or private key (plaintext in memory, sealed in the database)
+	HostKey         string // SHA256 fingerprint pinned on the first successful connection
+	TokenHint       string
+	Tag             string
+	ProbeServer     string // Probe server to bind, "auto" to match by node name, empty to skip
+	TLSDomain       string // Domain to issue a certificate for via ACME DNS-01, empty to skip
+	DNSCredentialID int64
+	NodeIDs         []int64
+	Status          string
+	LastError       string
+	Log             string
+	LastRunAt       *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+func hashNodeDeploymentToken(token string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	return hex.EncodeToString(sum[:])
+}
+
+const nodeDeploymentColumns = `id, username, name, mode, script, command, host, port, ssh_user, auth_type, credential, host_key, token_hint, tag, probe_server, tls_domain, dns_credential_id, node_ids, status, last_error, log, last_run_at, created_at, updated_at`
+
+func (r *TrafficRepository) scanNodeDeployment(scanner interface{ Scan(...any) error }) (NodeDeployment, error) {
+	var (
+		d          NodeDeployment
+		credential string
+		nodeIDs    string
+		lastRun    sql.NullTime
+	)
+	if err := scanner.Scan(&d.ID, &d.Username, &d.Name, &d.Mode, &d.Script, &d.Command, &d.Host, &d.Port, &d.SSHUser, &d.AuthType, &credential, &d.HostKey, &d.TokenHint, &d.Tag, &d.ProbeServer, &d.TLSDomain, &d.DNSCredentialID, &nodeIDs, &d.Status, &d.LastError, &d.Log, &lastRun, &d.CreatedAt, &d.UpdatedAt); err != nil {
+		return NodeDeployment{}, err
+	}
+	plain, err := r.secrets.Open(credential)
+	if err != nil {
+		return NodeDeployment{}, fmt.Errorf("open node deployment credential: %w", err)
+	}
+	d.Credential = plain
+	if nodeIDs != "" {
+		_ = json.Unmarshal([]byte(nodeIDs), &d.NodeIDs)
+	}
+	if lastRun.Valid {
+		t := lastRun.Time
+		d.LastRunAt = &t
+	}
+	return d, nil
+}
+
+// CreateNodeDeployment stores a new deployment. For agent deployments the plaintext agent token is
+// returned; it is shown only once.
+func (r *TrafficRepository) CreateNodeDeployment(ctx context.Context, d NodeDeployment) (NodeDeployment, string, error) {
+	if r == nil || r.db == nil {
+		return NodeDeployment{}, "", errors.New("traffic repository not initialized")
+	}
+
+	d.Username = strings.TrimSpace(d.Username)
+	d.Name = strings.TrimSpace(d.Name)
+	if d.Username == "" || d.Name == "" {
+		return NodeDeployment{}, "", errors.New("deployment username and name are required")
+	}
+	if d.Mode != NodeDeploymentModeSSH && d.Mode != NodeDeploymentModeAgent {
+		return NodeDeployment{}, "", fmt.Errorf("unsupported deployment mode %q", d.Mode)
+	}
+
+	sealed, err := r.secrets.Seal(d.Credential)
+	if err != nil {
+		return NodeDeployment{}, "", fmt.Errorf("seal node deployment credential: %w", err)
+	}
+
+	var token, tokenHash, hint string
+	if d.Mode == NodeDeploymentModeAgent {
+		raw := make([]byte, nodeDeploymentTokenBytes)
+		if _, err := rand.Read(raw); err != nil {
+			return NodeDeployment{}, "", fmt.Errorf("generate deployment token: %w", err)
+		}
+		token = "mmwd_" + hex.EncodeToString(raw)
+		tokenHash = hashNodeDeploymentToken(token)
+		hint = token[len(token)-nodeDeploymentTokenHintLength:]
+	}
+
+	res, err := r.db.ExecContext(ctx, `INSERT INTO node_deployments (username, name, mode, script, command, host, port, ssh_user, auth_type, credential, token_hash, token_hint, tag, probe_server, tls_domain, dns_credential_id, status) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.Username, d.Name, d.Mode, d.Script, d.Command, strings.TrimSpace(d.Host), d.Port, strings.TrimSpace(d.SSHUser), d.AuthType, sealed, tokenHash, hint, strings.TrimSpace(d.Tag), strings.TrimSpace(d.ProbeServer), strings.ToLower(strings.TrimSpace(d.TLSDomain)), d.DNSCredentialID, NodeDeploymentStatusPending)
+	if err != nil {
+		return NodeDeployment{}, "", fmt.Errorf("create node deployment: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return NodeDeployment{}, "", fmt.Errorf("node deployment id: %w", err)
+	}
+
+	created, err := r.GetNodeDeployment(ctx, id, d.Username)
+	if err != nil {
+		return NodeDeployment{}, "", err
+	}
+	return created, token, nil
+}
+
+// ListNodeDeployments returns the deployments of username, newest first.
+func (r *TrafficRepository) ListNodeDeployments(ctx context.Context, username string) ([]NodeDeployment, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+nodeDeploymentColumns+` FROM node_deployments WHERE username = ? ORDER BY id DESC`, username)
+	if err != nil {
+		return nil, fmt.Errorf("list node deployments: %w", err)
+	}
+	defer rows.Close()
+
+	var deployments []NodeDeployment
+	for rows.Next() {
+		d, err := r.scanNodeDeployment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan node deployment: %w", err)
+		}
+		deployments = append(deployments, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate node deployments: %w", err)
+	}
+	return deployments, nil
+}
+
+// GetNodeDeployment returns a deployment owned by username.
+func (r *TrafficRepository) GetNodeDeployment(ctx context.Context, id int64, username string) (NodeDeployment, error) {
+	if r == nil || r.db == nil {
+		return NodeDeployment{}, errors.New("traffic repository not initialized")
+	}
+
+	d, err := r.scanNodeDeployment(r.db.QueryRowContext(ctx, `SELECT `+nodeDeploymentColumns+` FROM node_deployments WHERE id = ? AND username = ?`, id, username))
+	if errors.Is(err, sql.ErrNoRows) {
+		return NodeDeployment{}, ErrNodeDeploymentNotFound
+	}
+	if err != nil {
+		return NodeDeployment{}, fmt.Errorf("get node deployment: %w", err)
+	}
+	return d, nil
+}
+
+// GetNodeDeploymentByToken resolves the agent deployment owning token.
+func (r *TrafficRepository) GetNodeDeploymentByToken(ctx context.Context, token string) (NodeDeployment, error) {
+	if r == nil || r.db == nil {
+		return NodeDeployment{}, errors.New("traffic repository not initialized")
+	}
+	if strings.TrimSpace(token) == "" {
+		return NodeDeployment{}, ErrNodeDeploymentNotFound
+	}
+
+	d, err := r.scanNodeDeployment(r.db.QueryRowContext(ctx, `SELECT `+nodeDeploymentColumns+` FROM node_deployments WHERE token_hash = ? AND mode = ?`, hashNodeDeploymentToken(token), NodeDeploymentModeAgent))
+	if errors.Is(err, sql.ErrNoRows) {
+		return NodeDeployment{}, ErrNodeDeploymentNotFound
+	}
+	if err != nil {
+		return NodeDeployment{}, fmt.Errorf("get node deployment by token: %w", err)
+	}
+	return d, nil
+}
+
+// UpdateNodeDeploymentStatus records the outcome of a run. nodeIDs replaces the registered nodes when
+// not nil; log keeps only its last maxNodeDeploymentLog bytes.
+func (r *TrafficRepository) UpdateNodeDeploymentStatus(ctx context.Context, id int64, status, lastError, log string, nodeIDs []int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	if len(log) > maxNodeDeploymentLog {
+		log = log[len(log)-maxNodeDeploymentLog:]
+	}
+
+	query := `UPDATE node_deployments SET status = ?, last_error = ?, log = ?, last_run_at = ?, updated_at = CURRENT_TIMESTAMP`
+	args := []any{status, lastError, log, time.Now().UTC()}
+	if nodeIDs != nil {
+		data, err := json.Marshal(nodeIDs)
+		if err != nil {
+			return fmt.Errorf("encode deployment node ids: %w", err)
+		}
+		query += `, node_ids = ?`
+		args = append(args, string(data))
+	}
+	query += ` WHERE id = ?`
+	args = append(args, id)
+
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("update node deployment: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("node deployment update rows affected: %w", err)
+	}
+	if affected == 0 {
+		return ErrNodeDeploymentNotFound
+	}
+	return nil
+}
+
+// SetNodeDeploymentHostKey pins the SSH host key fingerprint of a deployment.
+func (r *TrafficRepository) SetNodeDeploymentHostKey(ctx context.Context, id int64, fingerprint string) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	if _, err := r.db.ExecContext(ctx, `UPDATE node_deployments SET host_key = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, fingerprint, id); err != nil {
+		return fmt.Errorf("set node deployment host key: %w", err)
+	}
+	return nil
+}
+
+// DeleteNodeDeployment removes a deployment. The nodes it registered are kept.
+func (r *TrafficRepository) DeleteNodeDeployment(ctx context.Context, id int64, username string) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	res, err := r.db.ExecContext(ctx, `DELETE FROM node_deployments WHERE id = ? AND username = ?`, id, username)
+	if err != nil {
+		return fmt.Errorf("delete node deployment: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("node deployment delete rows affected: %w", err)
+	}
+	if affected == 0 {
+		return ErrNodeDeploymentNotFound
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NodeImportSource groups the nodes imported from the same subscription URL in the same batch.
+type NodeImportSource struct {
+	SourceURL   string
+	ImportBatch string
+	NodeCount   int
+	Tags        []string // Current tags of the nodes, which users may have edited since the import
+	ImportedAt  time.Time
+}
+
+// ListNodeImportSources returns the import sources of a user's nodes, most recent first. Nodes
+// added by hand before import tracking existed have neither a source URL nor a batch and are
+// not listed.
+func (r *TrafficRepository) ListNodeImportSources(ctx context.Context, username string) ([]NodeImportSource, error) {
+	nodes, err := r.ListNodes(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	type sourceKey struct{ url, batch string }
+	sources := make(map[sourceKey]*NodeImportSource)
+	tagSets := make(map[sourceKey]map[string]bool)
+	for _, node := range nodes {
+		if node.SourceURL == "" && node.ImportBatch == "" {
+			continue
+		}
+		key := sourceKey{node.SourceURL, node.ImportBatch}
+		source, ok := sources[key]
+		if !ok {
+			source = &NodeImportSource{SourceURL: node.SourceURL, ImportBatch: node.ImportBatch, ImportedAt: node.CreatedAt}
+			sources[key] = source
+			tagSets[key] = make(map[string]bool)
+		}
+		source.NodeCount++
+		if node.CreatedAt.Before(source.ImportedAt) {
+			source.ImportedAt = node.CreatedAt
+		}
+		if !tagSets[key][node.Tag] {
+			tagSets[key][node.Tag] = true
+			source.Tags = append(source.Tags, node.Tag)
+		}
+	}
+
+	result := make([]NodeImportSource, 0, len(sources))
+	for _, source := range sources {
+		sort.Strings(source.Tags)
+		result = append(result, *source)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].ImportedAt.Equal(result[j].ImportedAt) {
+			return result[i].ImportedAt.After(result[j].ImportedAt)
+		}
+		return result[i].ImportBatch < result[j].ImportBatch
+	})
+	return result, nil
+}
+
+// ListNodesBySource returns the user's nodes imported from sourceURL and/or in importBatch. An
+// empty argument matches any value, but at least one of them is required.
+func (r *TrafficRepository) ListNodesBySource(ctx context.Context, username, sourceURL, importBatch string) ([]Node, error) {
+	sourceURL = strings.TrimSpace(sourceURL)
+	importBatch = strings.TrimSpace(importBatch)
+	if sourceURL == "" && importBatch == "" {
+		return nil, errors.New("source url or import batch is required")
+	}
+
+	nodes, err := r.ListNodes(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []Node
+	for _, node := range nodes {
+		if sourceURL != "" && node.SourceURL != sourceURL {
+			continue
+		}
+		if importBatch != "" && node.ImportBatch != importBatch {
+			continue
+		}
+		matched = append(matched, node)
+	}
+	return matched, nil
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NodePoolSnapshot represents the composition of a user's node pool on a specific date.
+type NodePoolSnapshot struct {
+	Date         time.Time
+	Username     string
+	TotalNodes   int
+	EnabledNodes int
+	ByProtocol   map[string]int
+	ByTag        map[string]int
+	ByRegion     map[string]int
+	CreatedAt    time.Time
+}
+
+// ListNodeUsernames returns the distinct usernames that own at least one node.
+func (r *TrafficRepository) ListNodeUsernames(ctx context.Context) ([]string, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT DISTINCT username FROM nodes ORDER BY username ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("list node usernames: %w", err)
+	}
+	defer rows.Close()
+
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, fmt.Errorf("scan node username: %w", err)
+		}
+		usernames = append(usernames, username)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate node usernames: %w", err)
+	}
+
+	return usernames, nil
+}
+
+// RecordNodePoolSnapshot upserts the node pool composition for the snapshot's date and user.
+func (r *TrafficRepository) RecordNodePoolSnapshot(ctx context.Context, snapshot NodePoolSnapshot) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	username := strings.TrimSpace(snapshot.Username)
+	if username == "" {
+		return errors.New("username is required")
+	}
+
+	byProtocol, err := encodeCountMap(snapshot.ByProtocol)
+	if err != nil {
+		return fmt.Errorf("encode protocol counts: %w", err)
+	}
+	byTag, err := encodeCountMap(snapshot.ByTag)
+	if err != nil {
+		return fmt.Errorf("encode tag counts: %w", err)
+	}
+	byRegion, err := encodeCountMap(snapshot.ByRegion)
+	if err != nil {
+		return fmt.Errorf("encode region counts: %w", err)
+	}
+
+	normalized := snapshot.Date.UTC().Format("2006-01-02")
+
+	const stmt = `
+INSERT INTO node_pool_snapshots (date, username, total_nodes, enabled_nodes, by_protocol, by_tag, by_region)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(date, username) DO UPDATE SET
+    total_nodes = excluded.total_nodes,
+    enabled_nodes = excluded.enabled_nodes,
+    by_protocol = excluded.by_protocol,
+    by_tag = excluded.by_tag,
+    by_region = excluded.by_region,
+    created_at = CURRENT_TIMESTAMP;
+`
+
+	if _, err := r.db.ExecContext(ctx, stmt, normalized, username, snapshot.TotalNodes, snapshot.EnabledNodes, byProtocol, byTag, byRegion); err != nil {
+		return fmt.Errorf("upsert node pool snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// ListNodePoolSnapshots returns up to limit most recent snapshots for the user, ordered from oldest to newest.
+func (r *TrafficRepository) ListNodePoolSnapshots(ctx context.Context, username string, limit int) ([]NodePoolSnapshot, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, errors.New("username is required")
+	}
+
+	if limit <= 0 {
+		limit = 30
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+SELECT date, username, total_nodes, enabled_nodes, by_protocol, by_tag, by_region, created_at
+FROM (
+    SELECT * FROM node_pool_snapshots
+    WHERE username = ?
+    ORDER BY date DESC
+    LIMIT ?
+)
+ORDER BY date ASC;
+`, username, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list node pool snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []NodePoolSnapshot
+	for rows.Next() {
+		var (
+			snapshot   NodePoolSnapshot
+			dateStr    string
+			byProtocol string
+			byTag      string
+			byRegion   string
+		)
+
+		if err := rows.Scan(&dateStr, &snapshot.Username, &snapshot.TotalNodes, &snapshot.EnabledNodes, &byProtocol, &byTag, &byRegion, &snapshot.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan node pool snapshot: %w", err)
+		}
+
+		parsed, err := time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			return nil, fmt.Errorf("parse node pool snapshot date: %w", err)
+		}
+		snapshot.Date = parsed
+		snapshot.ByProtocol = decodeCountMap(byProtocol)
+		snapshot.ByTag = decodeCountMap(byTag)
+		snapshot.ByRegion = decodeCountMap(byRegion)
+
+		snapshots = append(snapshots, snapshot)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate node pool snapshots: %w", err)
+	}
+
+	return snapshots, nil
+}
+
+func encodeCountMap(counts map[string]int) (string, error) {
+	if len(counts) == 0 {
+		return "{}", nil
+	}
+	data, err := json.Marshal(counts)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func decodeCountMap(encoded string) map[string]int {
+	counts := make(map[string]int)
+	if strings.TrimSpace(encoded) == "" {
+		return counts
+	}
+	if err := json.Unmarshal([]byte(encoded), &counts); err != nil {
+		return make(map[string]int)
+	}
+	return counts
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DisableNodesOverQuota disables the user's enabled nodes bound to probeServer and marks them as
+// quota-disabled so they can be re-enabled when the server's cycle resets.
+func (r *TrafficRepository) DisableNodesOverQuota(ctx context.Context, username, probeServer string) (int64, error) {
+	if r == nil || r.db == nil {
+		return 0, errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	probeServer = strings.TrimSpace(probeServer)
+	if username == "" || probeServer == "" {
+		return 0, errors.New("username and probe server are required")
+	}
+
+	res, err := r.db.ExecContext(ctx, `UPDATE nodes SET enabled = 0, quota_disabled = 1, updated_at = CURRENT_TIMESTAMP WHERE username = ? AND probe_server = ? AND enabled = 1`, username, probeServer)
+	if err != nil {
+		return 0, fmt.Errorf("disable nodes over quota: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("disable nodes over quota rows affected: %w", err)
+	}
+	return affected, nil
+}
+
+// RestoreQuotaDisabledNodes re-enables the user's quota-disabled nodes, except those bound to one of
+// the probe servers in keep (still over quota or state unknown).
+func (r *TrafficRepository) RestoreQuotaDisabledNodes(ctx context.Context, username string, keep []string) (int64, error) {
+	if r == nil || r.db == nil {
+		return 0, errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return 0, errors.New("username is required")
+	}
+
+	query := `UPDATE nodes SET enabled = 1, quota_disabled = 0, updated_at = CURRENT_TIMESTAMP WHERE username = ? AND quota_disabled = 1`
+	args := []any{username}
+	if len(keep) > 0 {
+		query += ` AND COALESCE(probe_server, '') NOT IN (?` + strings.Repeat(", ?", len(keep)-1) + `)`
+		for _, name := range keep {
+			args = append(args, name)
+		}
+	}
+
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("restore quota disabled nodes: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("restore quota disabled nodes rows affected: %w", err)
+	}
+	return affected, nil
+}
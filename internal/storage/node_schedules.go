@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNodeScheduleNotFound is returned when a node has no schedule.
+var ErrNodeScheduleNotFound = errors.New("node schedule not found")
+
+// NodeScheduleWindow is a daily time range in which the node is enabled. End before Start
+// crosses midnight (e.g. 22:00-06:00); Start equal to End covers the whole day.
+type NodeScheduleWindow struct {
+	Days  []int  `json:"days,omitempty"` // Weekdays the window starts on (0 = Sunday); empty means every day
+	Start string `json:"start"`          // HH:MM
+	End   string `json:"end"`            // HH:MM
+}
+
+// NodeSchedule toggles a node's enabled state automatically, either by time windows or by a pair
+// of cron expressions (the one that fired last decides the state).
+type NodeSchedule struct {
+	NodeID           int64
+	Username         string
+	NodeName         string // Read-only, joined from nodes
+	Windows          []NodeScheduleWindow
+	EnableCron       string
+	DisableCron      string
+	Timezone         string // IANA timezone; empty uses the collector timezone
+	ScheduleDisabled bool   // The node is currently disabled by this schedule
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+const nodeScheduleColumns = `s.node_id, s.username, n.node_name, s.windows, s.enable_cron, s.disable_cron, s.timezone, s.schedule_disabled, s.created_at, s.updated_at`
+
+func scanNodeSchedule(scanner interface{ Scan(dest ...any) error }) (NodeSchedule, error) {
+	var (
+		schedule    NodeSchedule
+		windowsJSON string
+		disabled    int
+	)
+	if err := scanner.Scan(&schedule.NodeID, &schedule.Username, &schedule.NodeName, &windowsJSON, &schedule.EnableCron, &schedule.DisableCron, &schedule.Timezone, &disabled, &schedule.CreatedAt, &schedule.UpdatedAt); err != nil {
+		return NodeSchedule{}, err
+	}
+	if windowsJSON != "" {
+		if err := json.Unmarshal([]byte(windowsJSON), &schedule.Windows); err != nil {
+			return NodeSchedule{}, fmt.Errorf("decode node schedule windows: %w", err)
+		}
+	}
+	schedule.ScheduleDisabled = disabled == 1
+	return schedule, nil
+}
+
+// GetNodeSchedule returns the schedule of one of the user's nodes.
+func (r *TrafficRepository) GetNodeSchedule(ctx context.Context, nodeID int64, username string) (NodeSchedule, error) {
+	if r == nil || r.db == nil {
+		return NodeSchedule{}, errors.New("traffic repository not initialized")
+	}
+
+	row := r.db.QueryRowContext(ctx, `SELECT `+nodeScheduleColumns+` FROM node_schedules s JOIN nodes n ON n.id = s.node_id WHERE s.node_id = ? AND s.username = ?`, nodeID, strings.TrimSpace(username))
+	schedule, err := scanNodeSchedule(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return NodeSchedule{}, ErrNodeScheduleNotFound
+		}
+		return NodeSchedule{}, fmt.Errorf("get node schedule: %w", err)
+	}
+	return schedule, nil
+}
+
+// ListNodeSchedules returns the schedules of the user's nodes, or of all users when username is empty.
+func (r *TrafficRepository) ListNodeSchedules(ctx context.Context, username string) ([]NodeSchedule, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	query := `SELECT ` + nodeScheduleColumns + ` FROM node_schedules s JOIN nodes n ON n.id = s.node_id`
+	var args []any
+	if username = strings.TrimSpace(username); username != "" {
+		query += ` WHERE s.username = ?`
+		args = append(args, username)
+	}
+	query += ` ORDER BY s.node_id ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list node schedules: %w", err)
+	}
+	defer rows.Close()
+
+	var schedules []NodeSchedule
+	for rows.Next() {
+		schedule, err := scanNodeSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan node schedule: %w", err)
+		}
+		schedules = append(schedules, schedule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate node schedules: %w", err)
+	}
+
+	return schedules, nil
+}
+
+// SaveNodeSchedule creates or replaces the schedule of one of the user's nodes, keeping the
+// current schedule_disabled state.
+func (r *TrafficRepository) SaveNodeSchedule(ctx context.Context, schedule NodeSchedule) (NodeSchedule, error) {
+	if r == nil || r.db == nil {
+		return NodeSchedule{}, errors.New("traffic repository not initialized")
+	}
+
+	schedule.Username = strings.TrimSpace(schedule.Username)
+	if schedule.NodeID <= 0 || schedule.Username == "" {
+		return NodeSchedule{}, errors.New("node id and username are required")
+	}
+	if _, err := r.GetNode(ctx, schedule.NodeID, schedule.Username); err != nil {
+		return NodeSchedule{}, err
+	}
+
+	windows := schedule.Windows
+	if windows == nil {
+		windows = []NodeScheduleWindow{}
+	}
+	windowsJSON, err := json.Marshal(windows)
+	if err != nil {
+		return NodeSchedule{}, fmt.Errorf("encode node schedule windows: %w", err)
+	}
+
+	const stmt = `
+INSERT INTO node_schedules (node_id, username, windows, enable_cron, disable_cron, timezone, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(node_id) DO UPDATE SET
+    windows = excluded.windows,
+    enable_cron = excluded.enable_cron,
+    disable_cron = excluded.disable_cron,
+    timezone = excluded.timezone,
+    updated_at = CURRENT_TIMESTAMP
+`
+	if _, err := r.db.ExecContext(ctx, stmt, schedule.NodeID, schedule.Username, string(windowsJSON), strings.TrimSpace(schedule.EnableCron), strings.TrimSpace(schedule.DisableCron), strings.TrimSpace(schedule.Timezone)); err != nil {
+		return NodeSchedule{}, fmt.Errorf("save node schedule: %w", err)
+	}
+
+	return r.GetNodeSchedule(ctx, schedule.NodeID, schedule.Username)
+}
+
+// DeleteNodeSchedule removes the schedule of one of the user's nodes and re-enables the node if
+// the schedule had disabled it. restored reports whether the node was re-enabled.
+func (r *TrafficRepository) DeleteNodeSchedule(ctx context.Context, nodeID int64, username string) (restored bool, err error) {
+	if r == nil || r.db == nil {
+		return false, errors.New("traffic repository not initialized")
+	}
+
+	schedule, err := r.GetNodeSchedule(ctx, nodeID, username)
+	if err != nil {
+		return false, err
+	}
+	if schedule.ScheduleDisabled {
+		if restored, err = r.SetNodeScheduleState(ctx, nodeID, true); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM node_schedules WHERE node_id = ? AND username = ?`, nodeID, schedule.Username); err != nil {
+		return false, fmt.Errorf("delete node schedule: %w", err)
+	}
+	return restored, nil
+}
+
+// SetNodeScheduleState applies a schedule transition. Disabling only affects enabled nodes and
+// marks them as schedule-disabled; enabling only restores nodes the schedule disabled (and that
+// are not held back by the quota). changed reports whether the node's enabled state changed.
+func (r *TrafficRepository) SetNodeScheduleState(ctx context.Context, nodeID int64, enabled bool) (changed bool, err error) {
+	if r == nil || r.db == nil {
+		return false, errors.New("traffic repository not initialized")
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin node schedule transition: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var res sql.Result
+	if enabled {
+		res, err = tx.ExecContext(ctx, `UPDATE nodes SET enabled = 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND enabled = 0 AND quota_disabled = 0 AND EXISTS (SELECT 1 FROM node_schedules WHERE node_id = nodes.id AND schedule_disabled = 1)`, nodeID)
+		if err != nil {
+			return false, fmt.Errorf("enable scheduled node: %w", err)
+		}
+		if _, err = tx.ExecContext(ctx, `UPDATE node_schedules SET schedule_disabled = 0 WHERE node_id = ?`, nodeID); err != nil {
+			return false, fmt.Errorf("clear node schedule state: %w", err)
+		}
+	} else {
+		res, err = tx.ExecContext(ctx, `UPDATE nodes SET enabled = 0, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND enabled = 1`, nodeID)
+		if err != nil {
+			return false, fmt.Errorf("disable scheduled node: %w", err)
+		}
+		var affected int64
+		if affected, err = res.RowsAffected(); err != nil {
+			return false, fmt.Errorf("disable scheduled node rows affected: %w", err)
+		}
+		if affected > 0 {
+			if _, err = tx.ExecContext(ctx, `UPDATE node_schedules SET schedule_disabled = 1 WHERE node_id = ?`, nodeID); err != nil {
+				return false, fmt.Errorf("mark node schedule state: %w", err)
+			}
+		}
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("node schedule transition rows affected: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("commit node schedule transition: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// ListScheduleDisabledNodeNames returns the names of nodes currently disabled by their schedule.
+func (r *TrafficRepository) ListScheduleDisabledNodeNames(ctx context.Context) ([]string, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT n.node_name FROM node_schedules s JOIN nodes n ON n.id = s.node_id WHERE s.schedule_disabled = 1 AND n.enabled = 0`)
+	if err != nil {
+		return nil, fmt.Errorf("list schedule disabled nodes: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scan schedule disabled node: %w", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate schedule disabled nodes: %w", err)
+	}
+
+	return names, nil
+}
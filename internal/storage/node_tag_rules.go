@@ -0,0 +1,322 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultNodeTag is the tag of nodes created without one when SystemConfig.DefaultNodeTag is empty.
+const DefaultNodeTag = "手动输入"
+
+// UnknownNodeRegion is returned by DetectNodeRegion when a node name carries no region hint.
+const UnknownNodeRegion = "unknown"
+
+// Fields a NodeTagRule can match on.
+const (
+	NodeTagMatchSourceURL = "source_url" // Substring of the node's raw URL or its host (subscription imports keep the subscription URL)
+	NodeTagMatchRegion    = "region"     // Region codes detected from the node name, e.g. "HK,TW"
+	NodeTagMatchProtocol  = "protocol"   // Protocols, e.g. "vless,hysteria2"
+)
+
+// NodeRegionKeywords maps keywords in node names to region codes, matched in order.
+var NodeRegionKeywords = []struct {
+	Keyword string
+	Region  string
+}{
+	{"香港", "HK"}, {"hong kong", "HK"}, {"hongkong", "HK"},
+	{"台湾", "TW"}, {"臺灣", "TW"}, {"taiwan", "TW"},
+	{"日本", "JP"}, {"东京", "JP"}, {"大阪", "JP"}, {"japan", "JP"}, {"tokyo", "JP"},
+	{"新加坡", "SG"}, {"狮城", "SG"}, {"singapore", "SG"},
+	{"美国", "US"}, {"洛杉矶", "US"}, {"硅谷", "US"}, {"united states", "US"}, {"los angeles", "US"},
+	{"韩国", "KR"}, {"首尔", "KR"}, {"korea", "KR"}, {"seoul", "KR"},
+	{"英国", "GB"}, {"伦敦", "GB"}, {"united kingdom", "GB"}, {"london", "GB"},
+	{"德国", "DE"}, {"法兰克福", "DE"}, {"germany", "DE"}, {"frankfurt", "DE"},
+	{"法国", "FR"}, {"巴黎", "FR"}, {"france", "FR"}, {"paris", "FR"},
+	{"荷兰", "NL"}, {"netherlands", "NL"}, {"amsterdam", "NL"},
+	{"俄罗斯", "RU"}, {"russia", "RU"}, {"moscow", "RU"},
+	{"加拿大", "CA"}, {"canada", "CA"},
+	{"澳大利亚", "AU"}, {"澳洲", "AU"}, {"australia", "AU"}, {"sydney", "AU"},
+	{"印度", "IN"}, {"india", "IN"},
+	{"土耳其", "TR"}, {"turkey", "TR"},
+	{"马来西亚", "MY"}, {"malaysia", "MY"},
+	{"泰国", "TH"}, {"thailand", "TH"},
+	{"越南", "VN"}, {"vietnam", "VN"},
+	{"菲律宾", "PH"}, {"philippines", "PH"},
+	{"阿根廷", "AR"}, {"argentina", "AR"},
+	{"巴西", "BR"}, {"brazil", "BR"},
+	{"中国", "CN"}, {"china", "CN"},
+}
+
+// DetectNodeRegion returns the region code of a node name from its flag emoji or a region keyword,
+// or UnknownNodeRegion.
+func DetectNodeRegion(name string) string {
+	// 国旗 emoji 由两个区域指示符组成，例如 🇭🇰 -> HK
+	runes := []rune(name)
+	for i := 0; i+1 < len(runes); i++ {
+		if isRegionalIndicator(runes[i]) && isRegionalIndicator(runes[i+1]) {
+			return string([]rune{'A' + (runes[i] - 0x1F1E6), 'A' + (runes[i+1] - 0x1F1E6)})
+		}
+	}
+
+	lower := strings.ToLower(name)
+	for _, item := range NodeRegionKeywords {
+		if strings.Contains(lower, item.Keyword) {
+			return item.Region
+		}
+	}
+
+	return UnknownNodeRegion
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// NodeTagRule assigns Tag to nodes imported through BatchCreateNodes whose MatchField matches Pattern. Rules are evaluated
+// by ascending Priority and the first match wins. A rule only fills in nodes that arrive without a
+// tag unless Override is set, in which case it also replaces the tag chosen at import.
+type NodeTagRule struct {
+	ID         int64
+	Name       string
+	MatchField string
+	Pattern    string
+	Tag        string
+	Priority   int
+	Override   bool
+	Enabled    bool
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Matches reports whether the rule applies to node.
+func (rule NodeTagRule) Matches(node Node) bool {
+	switch rule.MatchField {
+	case NodeTagMatchSourceURL:
+		rawURL := strings.ToLower(strings.TrimSpace(node.RawURL))
+		if rawURL == "" {
+			return false
+		}
+		pattern := strings.ToLower(rule.Pattern)
+		if strings.Contains(rawURL, pattern) {
+			return true
+		}
+		if parsed, err := url.Parse(rawURL); err == nil && parsed.Hostname() != "" {
+			return strings.Contains(parsed.Hostname(), pattern)
+		}
+		return false
+	case NodeTagMatchRegion:
+		return nodeTagPatternContains(rule.Pattern, DetectNodeRegion(node.NodeName))
+	case NodeTagMatchProtocol:
+		return nodeTagPatternContains(rule.Pattern, node.Protocol)
+	}
+	return false
+}
+
+// nodeTagPatternContains reports whether value is one of the comma separated items of pattern.
+func nodeTagPatternContains(pattern, value string) bool {
+	for _, item := range strings.Split(pattern, ",") {
+		if item = strings.TrimSpace(item); item != "" && strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+const nodeTagRuleColumns = `id, name, match_field, pattern, tag, priority, override, enabled, created_at, updated_at`
+
+func scanNodeTagRule(scanner rowScanner) (NodeTagRule, error) {
+	var rule NodeTagRule
+	var override, enabled int
+	if err := scanner.Scan(&rule.ID, &rule.Name, &rule.MatchField, &rule.Pattern, &rule.Tag, &rule.Priority, &override, &enabled, &rule.CreatedAt, &rule.UpdatedAt); err != nil {
+		return NodeTagRule{}, err
+	}
+	rule.Override = override != 0
+	rule.Enabled = enabled != 0
+	return rule, nil
+}
+
+func validateNodeTagRule(rule NodeTagRule) (NodeTagRule, error) {
+	rule.Name = strings.TrimSpace(rule.Name)
+	rule.MatchField = strings.TrimSpace(rule.MatchField)
+	rule.Pattern = strings.TrimSpace(rule.Pattern)
+	rule.Tag = strings.TrimSpace(rule.Tag)
+	switch rule.MatchField {
+	case NodeTagMatchSourceURL, NodeTagMatchRegion, NodeTagMatchProtocol:
+	default:
+		return NodeTagRule{}, fmt.Errorf("unknown match field %q", rule.MatchField)
+	}
+	if rule.Pattern == "" {
+		return NodeTagRule{}, errors.New("pattern is required")
+	}
+	if rule.Tag == "" {
+		return NodeTagRule{}, errors.New("tag is required")
+	}
+	return rule, nil
+}
+
+// ListNodeTagRules returns every auto-tag rule in evaluation order.
+func (r *TrafficRepository) ListNodeTagRules(ctx context.Context) ([]NodeTagRule, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+nodeTagRuleColumns+` FROM node_tag_rules ORDER BY priority ASC, id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("list node tag rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []NodeTagRule
+	for rows.Next() {
+		rule, err := scanNodeTagRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan node tag rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate node tag rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// GetNodeTagRule returns a single auto-tag rule.
+func (r *TrafficRepository) GetNodeTagRule(ctx context.Context, id int64) (NodeTagRule, error) {
+	if r == nil || r.db == nil {
+		return NodeTagRule{}, errors.New("traffic repository not initialized")
+	}
+
+	rule, err := scanNodeTagRule(r.db.QueryRowContext(ctx, `SELECT `+nodeTagRuleColumns+` FROM node_tag_rules WHERE id = ?`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return NodeTagRule{}, ErrNodeTagRuleNotFound
+		}
+		return NodeTagRule{}, fmt.Errorf("get node tag rule: %w", err)
+	}
+
+	return rule, nil
+}
+
+// CreateNodeTagRule stores a new auto-tag rule.
+func (r *TrafficRepository) CreateNodeTagRule(ctx context.Context, rule NodeTagRule) (NodeTagRule, error) {
+	if r == nil || r.db == nil {
+		return NodeTagRule{}, errors.New("traffic repository not initialized")
+	}
+
+	rule, err := validateNodeTagRule(rule)
+	if err != nil {
+		return NodeTagRule{}, err
+	}
+
+	result, err := r.db.ExecContext(ctx, `INSERT INTO node_tag_rules (name, match_field, pattern, tag, priority, override, enabled) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		rule.Name, rule.MatchField, rule.Pattern, rule.Tag, rule.Priority, boolToInt(rule.Override), boolToInt(rule.Enabled))
+	if err != nil {
+		return NodeTagRule{}, fmt.Errorf("create node tag rule: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return NodeTagRule{}, fmt.Errorf("get node tag rule id: %w", err)
+	}
+
+	return r.GetNodeTagRule(ctx, id)
+}
+
+// UpdateNodeTagRule replaces an existing auto-tag rule.
+func (r *TrafficRepository) UpdateNodeTagRule(ctx context.Context, rule NodeTagRule) (NodeTagRule, error) {
+	if r == nil || r.db == nil {
+		return NodeTagRule{}, errors.New("traffic repository not initialized")
+	}
+
+	rule, err := validateNodeTagRule(rule)
+	if err != nil {
+		return NodeTagRule{}, err
+	}
+
+	result, err := r.db.ExecContext(ctx, `UPDATE node_tag_rules SET name = ?, match_field = ?, pattern = ?, tag = ?, priority = ?, override = ?, enabled = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		rule.Name, rule.MatchField, rule.Pattern, rule.Tag, rule.Priority, boolToInt(rule.Override), boolToInt(rule.Enabled), rule.ID)
+	if err != nil {
+		return NodeTagRule{}, fmt.Errorf("update node tag rule: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return NodeTagRule{}, ErrNodeTagRuleNotFound
+	}
+
+	return r.GetNodeTagRule(ctx, rule.ID)
+}
+
+// DeleteNodeTagRule removes an auto-tag rule.
+func (r *TrafficRepository) DeleteNodeTagRule(ctx context.Context, id int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM node_tag_rules WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete node tag rule: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrNodeTagRuleNotFound
+	}
+
+	return nil
+}
+
+// nodeTagger assigns tags to new nodes from the enabled auto-tag rules and the configured default tag.
+type nodeTagger struct {
+	rules      []NodeTagRule
+	defaultTag string
+}
+
+// loadNodeTagger reads the auto-tag rules and default tag. It must run outside of a transaction
+// because the repository uses a single connection.
+func (r *TrafficRepository) loadNodeTagger(ctx context.Context) (nodeTagger, error) {
+	defaultTag, err := r.defaultNodeTag(ctx)
+	if err != nil {
+		return nodeTagger{}, err
+	}
+	tagger := nodeTagger{defaultTag: defaultTag}
+
+	rules, err := r.ListNodeTagRules(ctx)
+	if err != nil {
+		return nodeTagger{}, err
+	}
+	for _, rule := range rules {
+		if rule.Enabled {
+			tagger.rules = append(tagger.rules, rule)
+		}
+	}
+	return tagger, nil
+}
+
+// defaultNodeTag returns the configured default tag, falling back to DefaultNodeTag.
+func (r *TrafficRepository) defaultNodeTag(ctx context.Context) (string, error) {
+	cfg, err := r.GetSystemConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+	if tag := strings.TrimSpace(cfg.DefaultNodeTag); tag != "" {
+		return tag, nil
+	}
+	return DefaultNodeTag, nil
+}
+
+// tag returns the tag a new node is stored with.
+func (t nodeTagger) tag(node Node) string {
+	tag := strings.TrimSpace(node.Tag)
+	for _, rule := range t.rules {
+		if (tag == "" || rule.Override) && rule.Matches(node) {
+			return rule.Tag
+		}
+	}
+	if tag == "" {
+		return t.defaultTag
+	}
+	return tag
+}
@@ -48,7 +48,7 @@ func (r *TrafficRepository) ListNodes(ctx context.Context, username string) ([]N
 		return nil, errors.New("username is required")
 	}
 
-	rows, err := r.db.QueryContext(ctx, `SELECT id, username, raw_url, node_name, protocol, parsed_config, clash_config, enabled, COALESCE(tag, 'personal'), COALESCE(original_server, ''), COALESCE(probe_server, ''), created_at, updated_at FROM nodes WHERE username = ? ORDER BY created_at DESC`, username)
+	rows, err := r.readQuery(ctx, `SELECT id, uuid, username, raw_url, node_name, protocol, parsed_config, clash_config, enabled, COALESCE(tag, 'personal'), COALESCE(original_server, ''), COALESCE(probe_server, ''), `+probeAnnotationsColumn+`, COALESCE(custom_fields, '{}'), source_url, import_batch, created_at, updated_at FROM nodes WHERE username = ? ORDER BY created_at DESC`, username)
 	if err != nil {
 		return nil, fmt.Errorf("list nodes: %w", err)
 	}
@@ -58,10 +58,13 @@ func (r *TrafficRepository) ListNodes(ctx context.Context, username string) ([]N
 	for rows.Next() {
 		var node Node
 		var enabled int
-		if err := rows.Scan(&node.ID, &node.Username, &node.RawURL, &node.NodeName, &node.Protocol, &node.ParsedConfig, &node.ClashConfig, &enabled, &node.Tag, &node.OriginalServer, &node.ProbeServer, &node.CreatedAt, &node.UpdatedAt); err != nil {
+		var annotations, customFields string
+		if err := rows.Scan(&node.ID, &node.UUID, &node.Username, &node.RawURL, &node.NodeName, &node.Protocol, &node.ParsedConfig, &node.ClashConfig, &enabled, &node.Tag, &node.OriginalServer, &node.ProbeServer, &annotations, &customFields, &node.SourceURL, &node.ImportBatch, &node.CreatedAt, &node.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("scan node: %w", err)
 		}
 		node.Enabled = enabled != 0
+		node.ProbeAnnotations = decodeProbeAnnotations(annotations)
+		node.CustomFields = decodeNodeCustomFields(customFields)
 		nodes = append(nodes, node)
 	}
 
@@ -89,14 +92,17 @@ func (r *TrafficRepository) GetNode(ctx context.Context, id int64, username stri
 	}
 
 	var enabled int
-	row := r.db.QueryRowContext(ctx, `SELECT id, username, raw_url, node_name, protocol, parsed_config, clash_config, enabled, COALESCE(tag, 'personal'), COALESCE(original_server, ''), COALESCE(probe_server, ''), created_at, updated_at FROM nodes WHERE id = ? AND username = ? LIMIT 1`, id, username)
-	if err := row.Scan(&node.ID, &node.Username, &node.RawURL, &node.NodeName, &node.Protocol, &node.ParsedConfig, &node.ClashConfig, &enabled, &node.Tag, &node.OriginalServer, &node.ProbeServer, &node.CreatedAt, &node.UpdatedAt); err != nil {
+	var annotations, customFields string
+	row := r.db.QueryRowContext(ctx, `SELECT id, uuid, username, raw_url, node_name, protocol, parsed_config, clash_config, enabled, COALESCE(tag, 'personal'), COALESCE(original_server, ''), COALESCE(probe_server, ''), `+probeAnnotationsColumn+`, COALESCE(custom_fields, '{}'), source_url, import_batch, created_at, updated_at FROM nodes WHERE id = ? AND username = ? LIMIT 1`, id, username)
+	if err := row.Scan(&node.ID, &node.UUID, &node.Username, &node.RawURL, &node.NodeName, &node.Protocol, &node.ParsedConfig, &node.ClashConfig, &enabled, &node.Tag, &node.OriginalServer, &node.ProbeServer, &annotations, &customFields, &node.SourceURL, &node.ImportBatch, &node.CreatedAt, &node.UpdatedAt); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return node, ErrNodeNotFound
 		}
 		return node, fmt.Errorf("get node: %w", err)
 	}
 	node.Enabled = enabled != 0
+	node.ProbeAnnotations = decodeProbeAnnotations(annotations)
+	node.CustomFields = decodeNodeCustomFields(customFields)
 
 	return node, nil
 }
@@ -126,8 +132,13 @@ func (r *TrafficRepository) CreateNode(ctx context.Context, node Node) (Node, er
 	if node.Protocol == "" {
 		return Node{}, errors.New("protocol is required")
 	}
+
 	if node.Tag == "" {
-		node.Tag = "手动输入"
+		defaultTag, err := r.defaultNodeTag(ctx)
+		if err != nil {
+			return Node{}, err
+		}
+		node.Tag = defaultTag
 	}
 
 	enabled := 0
@@ -135,7 +146,17 @@ func (r *TrafficRepository) CreateNode(ctx context.Context, node Node) (Node, er
 		enabled = 1
 	}
 
-	res, err := r.db.ExecContext(ctx, `INSERT INTO nodes (username, raw_url, node_name, protocol, parsed_config, clash_config, enabled, tag, original_server) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, node.Username, node.RawURL, node.NodeName, node.Protocol, node.ParsedConfig, node.ClashConfig, enabled, node.Tag, node.OriginalServer)
+	publicUUID, err := publicID(node.UUID)
+	if err != nil {
+		return Node{}, err
+	}
+
+	customFields, err := encodeNodeCustomFields(node.CustomFields)
+	if err != nil {
+		return Node{}, err
+	}
+
+	res, err := r.db.ExecContext(ctx, `INSERT INTO nodes (uuid, username, raw_url, node_name, protocol, parsed_config, clash_config, enabled, tag, original_server, custom_fields, source_url, import_batch) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, publicUUID, node.Username, node.RawURL, node.NodeName, node.Protocol, node.ParsedConfig, node.ClashConfig, enabled, node.Tag, node.OriginalServer, customFields, strings.TrimSpace(node.SourceURL), strings.TrimSpace(node.ImportBatch))
 	if err != nil {
 		return Node{}, fmt.Errorf("create node: %w", err)
 	}
@@ -177,8 +198,13 @@ func (r *TrafficRepository) UpdateNode(ctx context.Context, node Node) (Node, er
 	if node.Protocol == "" {
 		return Node{}, errors.New("protocol is required")
 	}
+
 	if node.Tag == "" {
-		node.Tag = "手动输入"
+		defaultTag, err := r.defaultNodeTag(ctx)
+		if err != nil {
+			return Node{}, err
+		}
+		node.Tag = defaultTag
 	}
 
 	enabled := 0
@@ -186,7 +212,7 @@ func (r *TrafficRepository) UpdateNode(ctx context.Context, node Node) (Node, er
 		enabled = 1
 	}
 
-	res, err := r.db.ExecContext(ctx, `UPDATE nodes SET raw_url = ?, node_name = ?, protocol = ?, parsed_config = ?, clash_config = ?, enabled = ?, tag = ?, original_server = ?, probe_server = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND username = ?`, node.RawURL, node.NodeName, node.Protocol, node.ParsedConfig, node.ClashConfig, enabled, node.Tag, node.OriginalServer, node.ProbeServer, node.ID, node.Username)
+	res, err := r.db.ExecContext(ctx, `UPDATE nodes SET raw_url = ?, node_name = ?, protocol = ?, parsed_config = ?, clash_config = ?, enabled = ?, tag = ?, original_server = ?, probe_server = ?, quota_disabled = CASE WHEN ? = 1 THEN 0 ELSE quota_disabled END, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND username = ?`, node.RawURL, node.NodeName, node.Protocol, node.ParsedConfig, node.ClashConfig, enabled, node.Tag, node.OriginalServer, node.ProbeServer, enabled, node.ID, node.Username)
 	if err != nil {
 		return Node{}, fmt.Errorf("update node: %w", err)
 	}
@@ -281,13 +307,25 @@ func (r *TrafficRepository) BatchCreateNodes(ctx context.Context, nodes []Node)
 		return nil, errors.New("nodes list is empty")
 	}
 
+	// 自动标签规则在事务外读取：仓库只有一个数据库连接
+	tagger, err := r.loadNodeTagger(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load node tag rules: %w", err)
+	}
+
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, fmt.Errorf("begin batch create nodes tx: %w", err)
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.PrepareContext(ctx, `INSERT INTO nodes (username, raw_url, node_name, protocol, parsed_config, clash_config, enabled, tag, original_server) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	// 同一次批量导入的节点共享一个批次 ID，之后可按批次列出、删除或刷新
+	batchID, err := publicID("")
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO nodes (uuid, username, raw_url, node_name, protocol, parsed_config, clash_config, enabled, tag, original_server, custom_fields, source_url, import_batch) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		return nil, fmt.Errorf("prepare insert node: %w", err)
 	}
@@ -314,8 +352,10 @@ func (r *TrafficRepository) BatchCreateNodes(ctx context.Context, nodes []Node)
 		if node.Protocol == "" {
 			return nil, fmt.Errorf("node %d: protocol is required", idx+1)
 		}
-		if node.Tag == "" {
-			node.Tag = "手动输入"
+		node.Tag = tagger.tag(node)
+		node.SourceURL = strings.TrimSpace(node.SourceURL)
+		if node.ImportBatch = strings.TrimSpace(node.ImportBatch); node.ImportBatch == "" {
+			node.ImportBatch = batchID
 		}
 
 		enabled := 0
@@ -323,7 +363,17 @@ func (r *TrafficRepository) BatchCreateNodes(ctx context.Context, nodes []Node)
 			enabled = 1
 		}
 
-		res, err := stmt.ExecContext(ctx, node.Username, node.RawURL, node.NodeName, node.Protocol, node.ParsedConfig, node.ClashConfig, enabled, node.Tag, node.OriginalServer)
+		publicUUID, err := publicID(node.UUID)
+		if err != nil {
+			return nil, err
+		}
+
+		customFields, err := encodeNodeCustomFields(node.CustomFields)
+		if err != nil {
+			return nil, fmt.Errorf("node %d: %w", idx+1, err)
+		}
+
+		res, err := stmt.ExecContext(ctx, publicUUID, node.Username, node.RawURL, node.NodeName, node.Protocol, node.ParsedConfig, node.ClashConfig, enabled, node.Tag, node.OriginalServer, customFields, node.SourceURL, node.ImportBatch)
 		if err != nil {
 			return nil, fmt.Errorf("insert node %d: %w", idx+1, err)
 		}
@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	NotificationTypeSyncFailure  = "sync_failure"
+	NotificationTypeAnnouncement = "announcement"
+	NotificationTypeExpiringPlan = "expiring_plan"
+	NotificationTypeTrafficAlert = "traffic_alert"
+	NotificationTypeUserExpiry   = "user_expiry"
+	NotificationTypeStalePull    = "stale_pull"
+)
+
+// maxNotificationsPerUser 每个用户保留的通知条数上限
+const maxNotificationsPerUser = 200
+
+var ErrNotificationNotFound = errors.New("notification not found")
+
+// Notification represents an in-app message shown in a user's inbox.
+// DedupeKey is optional; when set, repeated notifications with the same key are ignored.
+type Notification struct {
+	ID        int64
+	Username  string
+	Type      string
+	Title     string
+	Content   string
+	DedupeKey string
+	ReadAt    *time.Time
+	CreatedAt time.Time
+}
+
+// CreateNotification stores a notification. It returns false when a notification with the
+// same dedupe key already exists for the user.
+func (r *TrafficRepository) CreateNotification(ctx context.Context, n Notification) (bool, error) {
+	if r == nil || r.db == nil {
+		return false, errors.New("traffic repository not initialized")
+	}
+
+	username := strings.TrimSpace(n.Username)
+	if username == "" {
+		return false, errors.New("username is required")
+	}
+
+	title := strings.TrimSpace(n.Title)
+	if title == "" {
+		return false, errors.New("notification title is required")
+	}
+
+	notificationType := strings.TrimSpace(n.Type)
+	if notificationType == "" {
+		notificationType = NotificationTypeAnnouncement
+	}
+
+	const stmt = `INSERT OR IGNORE INTO notifications (username, type, title, content, dedupe_key) VALUES (?, ?, ?, ?, ?)`
+	result, err := r.db.ExecContext(ctx, stmt, username, notificationType, title, n.Content, strings.TrimSpace(n.DedupeKey))
+	if err != nil {
+		return false, fmt.Errorf("create notification: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	const pruneStmt = `
+DELETE FROM notifications
+WHERE username = ? AND id NOT IN (
+    SELECT id FROM notifications WHERE username = ? ORDER BY id DESC LIMIT ?
+)`
+	if _, err := r.db.ExecContext(ctx, pruneStmt, username, username, maxNotificationsPerUser); err != nil {
+		return true, fmt.Errorf("prune notifications: %w", err)
+	}
+
+	return true, nil
+}
+
+// ListNotifications returns the user's notifications, newest first.
+func (r *TrafficRepository) ListNotifications(ctx context.Context, username string, unreadOnly bool, limit int) ([]Notification, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, errors.New("username is required")
+	}
+
+	if limit <= 0 || limit > maxNotificationsPerUser {
+		limit = 50
+	}
+
+	query := `SELECT id, username, type, title, content, dedupe_key, read_at, created_at FROM notifications WHERE username = ?`
+	if unreadOnly {
+		query += ` AND read_at IS NULL`
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+
+	rows, err := r.db.QueryContext(ctx, query, username, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		var readAt sql.NullTime
+		if err := rows.Scan(&n.ID, &n.Username, &n.Type, &n.Title, &n.Content, &n.DedupeKey, &readAt, &n.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan notification: %w", err)
+		}
+		if readAt.Valid {
+			n.ReadAt = &readAt.Time
+		}
+		notifications = append(notifications, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate notifications: %w", err)
+	}
+
+	return notifications, nil
+}
+
+// CountUnreadNotifications returns the number of unread notifications for the user.
+func (r *TrafficRepository) CountUnreadNotifications(ctx context.Context, username string) (int, error) {
+	if r == nil || r.db == nil {
+		return 0, errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return 0, errors.New("username is required")
+	}
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM notifications WHERE username = ? AND read_at IS NULL`, username).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+// MarkNotificationsRead marks the given notifications as read. An empty ids slice marks all of them.
+func (r *TrafficRepository) MarkNotificationsRead(ctx context.Context, username string, ids []int64) (int64, error) {
+	if r == nil || r.db == nil {
+		return 0, errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return 0, errors.New("username is required")
+	}
+
+	query := `UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE username = ? AND read_at IS NULL`
+	args := []interface{}{username}
+	if len(ids) > 0 {
+		placeholders := make([]string, len(ids))
+		for i, id := range ids {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		query += ` AND id IN (` + strings.Join(placeholders, ",") + `)`
+	}
+
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("mark notifications read: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("get rows affected: %w", err)
+	}
+	return affected, nil
+}
+
+// DeleteNotification removes a notification from the user's inbox.
+func (r *TrafficRepository) DeleteNotification(ctx context.Context, username string, id int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return errors.New("username is required")
+	}
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM notifications WHERE id = ? AND username = ?`, id, username)
+	if err != nil {
+		return fmt.Errorf("delete notification: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if affected == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrPasswordResetInvalid = errors.New("password reset token is invalid or expired")
+
+// FindUserForPasswordReset resolves a username or email address to an account.
+func (r *TrafficRepository) FindUserForPasswordReset(ctx context.Context, login string) (User, error) {
+	if r == nil || r.db == nil {
+		return User{}, errors.New("traffic repository not initialized")
+	}
+
+	login = strings.TrimSpace(login)
+	if login == "" {
+		return User{}, ErrUserNotFound
+	}
+
+	// 用户名优先匹配，其次按邮箱（不区分大小写）
+	const query = `SELECT username FROM users WHERE username = ? OR (COALESCE(email, '') <> '' AND lower(email) = lower(?)) ORDER BY username = ? DESC, created_at ASC LIMIT 1`
+	var username string
+	if err := r.db.QueryRowContext(ctx, query, login, login, login).Scan(&username); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, ErrUserNotFound
+		}
+		return User{}, fmt.Errorf("find user for password reset: %w", err)
+	}
+
+	return r.GetUser(ctx, username)
+}
+
+// CreatePasswordReset issues a single-use reset token for the user. Earlier tokens of the user are revoked.
+func (r *TrafficRepository) CreatePasswordReset(ctx context.Context, username string, ttl time.Duration) (string, time.Time, error) {
+	if r == nil || r.db == nil {
+		return "", time.Time{}, errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return "", time.Time{}, errors.New("username is required")
+	}
+	if ttl <= 0 {
+		return "", time.Time{}, errors.New("ttl must be positive")
+	}
+
+	now := time.Now().UTC()
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM password_resets WHERE username = ? OR expires_at <= ? OR used_at IS NOT NULL`, username, now); err != nil {
+		return "", time.Time{}, fmt.Errorf("clear password resets: %w", err)
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, fmt.Errorf("generate password reset token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	expiresAt := now.Add(ttl)
+
+	const stmt = `INSERT INTO password_resets (token_hash, username, expires_at) VALUES (?, ?, ?)`
+	if _, err := r.db.ExecContext(ctx, stmt, hashPasswordResetToken(token), username, expiresAt); err != nil {
+		return "", time.Time{}, fmt.Errorf("create password reset: %w", err)
+	}
+
+	return token, expiresAt, nil
+}
+
+// ResetPasswordWithToken consumes the reset token, stores the new password hash and removes all
+// persisted sessions of the user in a single transaction. It returns the affected username.
+func (r *TrafficRepository) ResetPasswordWithToken(ctx context.Context, token, passwordHash string) (string, error) {
+	if r == nil || r.db == nil {
+		return "", errors.New("traffic repository not initialized")
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", ErrPasswordResetInvalid
+	}
+	if passwordHash == "" {
+		return "", errors.New("password hash is required")
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var (
+		username  string
+		expiresAt time.Time
+		usedAt    sql.NullTime
+	)
+	tokenHash := hashPasswordResetToken(token)
+	row := tx.QueryRowContext(ctx, `SELECT username, expires_at, used_at FROM password_resets WHERE token_hash = ?`, tokenHash)
+	if err := row.Scan(&username, &expiresAt, &usedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrPasswordResetInvalid
+		}
+		return "", fmt.Errorf("get password reset: %w", err)
+	}
+
+	now := time.Now().UTC()
+	if usedAt.Valid || !now.Before(expiresAt) {
+		return "", ErrPasswordResetInvalid
+	}
+
+	result, err := tx.ExecContext(ctx, `UPDATE password_resets SET used_at = ? WHERE token_hash = ? AND used_at IS NULL`, now, tokenHash)
+	if err != nil {
+		return "", fmt.Errorf("consume password reset: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return "", ErrPasswordResetInvalid
+	}
+
+	result, err = tx.ExecContext(ctx, `UPDATE users SET password_hash = ?, updated_at = CURRENT_TIMESTAMP WHERE username = ?`, passwordHash, username)
+	if err != nil {
+		return "", fmt.Errorf("update password: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return "", ErrPasswordResetInvalid
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE username = ?`, username); err != nil {
+		return "", fmt.Errorf("delete user sessions: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM login_codes WHERE username = ?`, username); err != nil {
+		return "", fmt.Errorf("delete user login codes: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return username, nil
+}
+
+func hashPasswordResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ProbeAlert is an active alert pushed by a probe panel for one probe server.
+type ProbeAlert struct {
+	ServerName string
+	ServerID   string
+	Source     string // nezha, komari, ...
+	Message    string
+	StartedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// ResolveProbeServerName returns the name of the configured probe server with the given server ID.
+func (r *TrafficRepository) ResolveProbeServerName(ctx context.Context, serverID string) (string, error) {
+	if r == nil || r.db == nil {
+		return "", errors.New("traffic repository not initialized")
+	}
+
+	var name string
+	err := r.db.QueryRowContext(ctx, `SELECT name FROM probe_servers WHERE server_id = ? ORDER BY id LIMIT 1`, strings.TrimSpace(serverID)).Scan(&name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrProbeServerNotFound
+		}
+		return "", fmt.Errorf("resolve probe server name: %w", err)
+	}
+	return name, nil
+}
+
+// RaiseProbeAlert records an alert for a probe server. Repeated alerts keep the original start time.
+func (r *TrafficRepository) RaiseProbeAlert(ctx context.Context, alert ProbeAlert) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	alert.ServerName = strings.TrimSpace(alert.ServerName)
+	if alert.ServerName == "" {
+		return errors.New("probe server name is required")
+	}
+
+	const stmt = `
+INSERT INTO probe_alerts (server_name, server_id, source, message, started_at, updated_at)
+VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+ON CONFLICT(server_name) DO UPDATE SET
+    server_id = excluded.server_id,
+    source = excluded.source,
+    message = excluded.message,
+    updated_at = CURRENT_TIMESTAMP
+`
+	if _, err := r.db.ExecContext(ctx, stmt, alert.ServerName, strings.TrimSpace(alert.ServerID), strings.TrimSpace(alert.Source), alert.Message); err != nil {
+		return fmt.Errorf("raise probe alert: %w", err)
+	}
+
+	const historyStmt = `
+INSERT INTO probe_alert_history (server_name, source, started_at)
+SELECT ?, ?, CURRENT_TIMESTAMP
+WHERE NOT EXISTS (SELECT 1 FROM probe_alert_history WHERE server_name = ? AND resolved_at IS NULL)
+`
+	if _, err := r.db.ExecContext(ctx, historyStmt, alert.ServerName, strings.TrimSpace(alert.Source), alert.ServerName); err != nil {
+		return fmt.Errorf("record probe alert history: %w", err)
+	}
+	return nil
+}
+
+// ClearProbeAlert removes the alert of a probe server and reports whether one was active.
+func (r *TrafficRepository) ClearProbeAlert(ctx context.Context, serverName string) (bool, error) {
+	if r == nil || r.db == nil {
+		return false, errors.New("traffic repository not initialized")
+	}
+
+	serverName = strings.TrimSpace(serverName)
+	res, err := r.db.ExecContext(ctx, `DELETE FROM probe_alerts WHERE server_name = ?`, serverName)
+	if err != nil {
+		return false, fmt.Errorf("clear probe alert: %w", err)
+	}
+	if _, err := r.db.ExecContext(ctx, `UPDATE probe_alert_history SET resolved_at = CURRENT_TIMESTAMP WHERE server_name = ? AND resolved_at IS NULL`, serverName); err != nil {
+		return false, fmt.Errorf("resolve probe alert history: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("clear probe alert rows affected: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// ListProbeAlerts returns all active probe alerts, oldest first.
+func (r *TrafficRepository) ListProbeAlerts(ctx context.Context) ([]ProbeAlert, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT server_name, server_id, source, message, started_at, updated_at FROM probe_alerts ORDER BY started_at ASC, server_name ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("list probe alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var alerts []ProbeAlert
+	for rows.Next() {
+		var alert ProbeAlert
+		if err := rows.Scan(&alert.ServerName, &alert.ServerID, &alert.Source, &alert.Message, &alert.StartedAt, &alert.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan probe alert: %w", err)
+		}
+		alerts = append(alerts, alert)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate probe alerts: %w", err)
+	}
+	return alerts, nil
+}
+
+// ListProbeAlertNodeNames returns the names of nodes bound to a probe server with an active alert.
+func (r *TrafficRepository) ListProbeAlertNodeNames(ctx context.Context) ([]string, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT DISTINCT n.node_name FROM nodes n JOIN probe_alerts a ON a.server_name = n.probe_server`)
+	if err != nil {
+		return nil, fmt.Errorf("list probe alert nodes: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scan probe alert node: %w", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate probe alert nodes: %w", err)
+	}
+	return names, nil
+}
+
+// ProbeOutage is one alert period of a probe server; ResolvedAt is nil while the alert is active.
+type ProbeOutage struct {
+	ServerName string
+	Source     string
+	StartedAt  time.Time
+	ResolvedAt *time.Time
+}
+
+// ListProbeOutages returns the alert periods that overlap [from, to), oldest first.
+func (r *TrafficRepository) ListProbeOutages(ctx context.Context, from, to time.Time) ([]ProbeOutage, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+SELECT server_name, source, started_at, resolved_at
+FROM probe_alert_history
+WHERE started_at < ? AND (resolved_at IS NULL OR resolved_at >= ?)
+ORDER BY started_at ASC, id ASC`, sqliteTimestamp(to), sqliteTimestamp(from))
+	if err != nil {
+		return nil, fmt.Errorf("list probe outages: %w", err)
+	}
+	defer rows.Close()
+
+	var outages []ProbeOutage
+	for rows.Next() {
+		var outage ProbeOutage
+		var resolvedAt sql.NullTime
+		if err := rows.Scan(&outage.ServerName, &outage.Source, &outage.StartedAt, &resolvedAt); err != nil {
+			return nil, fmt.Errorf("scan probe outage: %w", err)
+		}
+		if resolvedAt.Valid {
+			resolved := resolvedAt.Time
+			outage.ResolvedAt = &resolved
+		}
+		outages = append(outages, outage)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate probe outages: %w", err)
+	}
+	return outages, nil
+}
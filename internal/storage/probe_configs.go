@@ -0,0 +1,379 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const probeConfigColumns = `id, name, probe_type, address, credentials, created_at, updated_at`
+
+// ListProbeConfigs returns every probe configuration (oldest first) with its servers.
+func (r *TrafficRepository) ListProbeConfigs(ctx context.Context) ([]ProbeConfig, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+probeConfigColumns+` FROM probe_configs ORDER BY id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("list probe configs: %w", err)
+	}
+
+	var configs []ProbeConfig
+	for rows.Next() {
+		cfg, err := scanProbeConfig(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan probe config: %w", err)
+		}
+		if err := r.openProbeCredentials(&cfg); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		configs = append(configs, cfg)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("iterate probe configs: %w", err)
+	}
+	rows.Close()
+
+	for i := range configs {
+		servers, err := r.listProbeServers(ctx, configs[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		configs[i].Servers = servers
+	}
+
+	return configs, nil
+}
+
+// GetProbeConfigByID returns a single probe configuration with its servers.
+func (r *TrafficRepository) GetProbeConfigByID(ctx context.Context, id int64) (ProbeConfig, error) {
+	if r == nil || r.db == nil {
+		return ProbeConfig{}, errors.New("traffic repository not initialized")
+	}
+
+	row := r.db.QueryRowContext(ctx, `SELECT `+probeConfigColumns+` FROM probe_configs WHERE id = ?`, id)
+	cfg, err := scanProbeConfig(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ProbeConfig{}, ErrProbeConfigNotFound
+		}
+		return ProbeConfig{}, fmt.Errorf("get probe config: %w", err)
+	}
+	if err := r.openProbeCredentials(&cfg); err != nil {
+		return ProbeConfig{}, err
+	}
+
+	servers, err := r.listProbeServers(ctx, cfg.ID)
+	if err != nil {
+		return ProbeConfig{}, err
+	}
+	cfg.Servers = servers
+
+	return cfg, nil
+}
+
+// CreateProbeConfig stores a new named probe configuration with its server list.
+func (r *TrafficRepository) CreateProbeConfig(ctx context.Context, cfg ProbeConfig) (ProbeConfig, error) {
+	if r == nil || r.db == nil {
+		return ProbeConfig{}, errors.New("traffic repository not initialized")
+	}
+
+	cfg.ID = 0
+	id, err := r.saveProbeConfig(ctx, cfg)
+	if err != nil {
+		return ProbeConfig{}, err
+	}
+
+	return r.GetProbeConfigByID(ctx, id)
+}
+
+// UpdateProbeConfig updates the configuration identified by cfg.ID and replaces its server list.
+func (r *TrafficRepository) UpdateProbeConfig(ctx context.Context, cfg ProbeConfig) (ProbeConfig, error) {
+	if r == nil || r.db == nil {
+		return ProbeConfig{}, errors.New("traffic repository not initialized")
+	}
+	if cfg.ID <= 0 {
+		return ProbeConfig{}, ErrProbeConfigNotFound
+	}
+
+	id, err := r.saveProbeConfig(ctx, cfg)
+	if err != nil {
+		return ProbeConfig{}, err
+	}
+
+	return r.GetProbeConfigByID(ctx, id)
+}
+
+// DeleteProbeConfigByID deletes a probe configuration and clears node bindings to servers
+// that no longer exist in any remaining configuration.
+func (r *TrafficRepository) DeleteProbeConfigByID(ctx context.Context, id int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin delete probe config tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM probe_configs WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete probe config: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrProbeConfigNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM probe_servers WHERE config_id = ?`, id); err != nil {
+		return fmt.Errorf("delete probe servers: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM probe_server_cycles WHERE config_id = ?`, id); err != nil {
+		return fmt.Errorf("delete probe server cycles: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM probe_push_reports WHERE config_id = ?`, id); err != nil {
+		return fmt.Errorf("delete probe push reports: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM probe_server_traffic_daily WHERE config_id = ?`, id); err != nil {
+		return fmt.Errorf("delete probe server traffic history: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM traffic_alert_rules WHERE config_id = ?`, id); err != nil {
+		return fmt.Errorf("delete traffic alert rules: %w", err)
+	}
+
+	// 节点按服务器名称绑定，仅当名称不再出现在任何探针配置中时才解除绑定
+	if _, err := tx.ExecContext(ctx, `UPDATE nodes SET probe_server = '' WHERE probe_server != '' AND probe_server NOT IN (SELECT name FROM probe_servers)`); err != nil {
+		return fmt.Errorf("clear node probe bindings: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit delete probe config: %w", err)
+	}
+
+	return nil
+}
+
+func (r *TrafficRepository) listProbeServers(ctx context.Context, configID int64) ([]ProbeServer, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, config_id, server_id, name, traffic_method, monthly_traffic_bytes, traffic_multiplier, include_in_total, reset_day, reset_timezone, position, created_at, updated_at FROM probe_servers WHERE config_id = ? ORDER BY position ASC, id ASC`, configID)
+	if err != nil {
+		return nil, fmt.Errorf("list probe servers: %w", err)
+	}
+	defer rows.Close()
+
+	var servers []ProbeServer
+	for rows.Next() {
+		server, err := scanProbeServer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan probe server: %w", err)
+		}
+		servers = append(servers, server)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate probe servers: %w", err)
+	}
+
+	return servers, nil
+}
+
+// saveProbeConfig inserts (cfg.ID == 0) or updates a configuration and rewrites its servers in one transaction.
+func (r *TrafficRepository) saveProbeConfig(ctx context.Context, cfg ProbeConfig) (int64, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cfg, err := sanitizeProbeConfig(cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	sealedCredentials, err := r.sealProbeCredentials(cfg.Credentials)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin probe config tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	id := cfg.ID
+	if id == 0 {
+		result, err := tx.ExecContext(ctx, `INSERT INTO probe_configs (name, probe_type, address, credentials) VALUES (?, ?, ?, ?)`, cfg.Name, cfg.ProbeType, cfg.Address, sealedCredentials)
+		if err != nil {
+			return 0, fmt.Errorf("create probe config: %w", err)
+		}
+		id, err = result.LastInsertId()
+		if err != nil {
+			return 0, fmt.Errorf("create probe config id: %w", err)
+		}
+	} else {
+		result, err := tx.ExecContext(ctx, `UPDATE probe_configs SET name = ?, probe_type = ?, address = ?, credentials = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, cfg.Name, cfg.ProbeType, cfg.Address, sealedCredentials, id)
+		if err != nil {
+			return 0, fmt.Errorf("update probe config: %w", err)
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			return 0, ErrProbeConfigNotFound
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM probe_servers WHERE config_id = ?`, id); err != nil {
+		return 0, fmt.Errorf("clear probe servers: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO probe_servers (config_id, server_id, name, traffic_method, monthly_traffic_bytes, traffic_multiplier, include_in_total, reset_day, reset_timezone, position) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("prepare insert probe server: %w", err)
+	}
+	defer stmt.Close()
+
+	for idx, srv := range cfg.Servers {
+		if _, err := stmt.ExecContext(ctx, id, srv.ServerID, srv.Name, srv.TrafficMethod, srv.MonthlyTrafficBytes, srv.TrafficMultiplier, boolToInt(srv.IncludeInTotal), srv.ResetDay, srv.ResetTimezone, idx); err != nil {
+			return 0, fmt.Errorf("insert probe server %d: %w", idx+1, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit probe config: %w", err)
+	}
+
+	return id, nil
+}
+
+func sanitizeProbeConfig(cfg ProbeConfig) (ProbeConfig, error) {
+	cfg.ProbeType = strings.ToLower(strings.TrimSpace(cfg.ProbeType))
+	if _, ok := allowedProbeTypes[cfg.ProbeType]; !ok {
+		return ProbeConfig{}, errors.New("unsupported probe type")
+	}
+
+	cfg.Address = strings.TrimSpace(cfg.Address)
+	if cfg.Address == "" {
+		return ProbeConfig{}, errors.New("probe address is required")
+	}
+
+	cfg.Name = strings.TrimSpace(cfg.Name)
+	if cfg.Name == "" {
+		cfg.Name = defaultProbeConfigName(cfg)
+	}
+
+	cfg.Credentials.Token = strings.TrimSpace(cfg.Credentials.Token)
+	cfg.Credentials.Username = strings.TrimSpace(cfg.Credentials.Username)
+	if cfg.Credentials.Password != "" && cfg.Credentials.Username == "" {
+		return ProbeConfig{}, errors.New("probe username is required when a password is set")
+	}
+
+	if len(cfg.Servers) == 0 {
+		return ProbeConfig{}, errors.New("at least one server is required")
+	}
+
+	servers := make([]ProbeServer, 0, len(cfg.Servers))
+	for idx, srv := range cfg.Servers {
+		serverID := strings.TrimSpace(srv.ServerID)
+		if serverID == "" {
+			return ProbeConfig{}, fmt.Errorf("server %d: server id is required", idx+1)
+		}
+
+		name := strings.TrimSpace(srv.Name)
+		if name == "" {
+			return ProbeConfig{}, fmt.Errorf("server %d: server name is required", idx+1)
+		}
+
+		method := strings.ToLower(strings.TrimSpace(srv.TrafficMethod))
+		if _, ok := allowedTrafficMethods[method]; !ok {
+			return ProbeConfig{}, fmt.Errorf("server %d: unsupported traffic method", idx+1)
+		}
+
+		if srv.MonthlyTrafficBytes < 0 {
+			return ProbeConfig{}, fmt.Errorf("server %d: monthly traffic cannot be negative", idx+1)
+		}
+
+		multiplier := srv.TrafficMultiplier
+		if multiplier < 0 {
+			return ProbeConfig{}, fmt.Errorf("server %d: traffic multiplier cannot be negative", idx+1)
+		}
+		if multiplier == 0 {
+			multiplier = 1
+		}
+
+		if srv.ResetDay < 0 || srv.ResetDay > 31 {
+			return ProbeConfig{}, fmt.Errorf("server %d: reset day must be between 1 and 31", idx+1)
+		}
+		timezone := strings.TrimSpace(srv.ResetTimezone)
+		if timezone != "" {
+			if _, err := time.LoadLocation(timezone); err != nil {
+				return ProbeConfig{}, fmt.Errorf("server %d: invalid reset timezone", idx+1)
+			}
+		}
+
+		servers = append(servers, ProbeServer{
+			ServerID:            serverID,
+			Name:                name,
+			TrafficMethod:       method,
+			MonthlyTrafficBytes: srv.MonthlyTrafficBytes,
+			TrafficMultiplier:   multiplier,
+			IncludeInTotal:      srv.IncludeInTotal,
+			ResetDay:            srv.ResetDay,
+			ResetTimezone:       timezone,
+		})
+	}
+	cfg.Servers = servers
+
+	return cfg, nil
+}
+
+func (r *TrafficRepository) sealProbeCredentials(creds ProbeCredentials) (string, error) {
+	if creds.IsZero() {
+		return "", nil
+	}
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return "", fmt.Errorf("encode probe credentials: %w", err)
+	}
+	sealed, err := r.secrets.Seal(string(data))
+	if err != nil {
+		return "", fmt.Errorf("encrypt probe credentials: %w", err)
+	}
+	return sealed, nil
+}
+
+// openProbeCredentials decrypts the stored credentials. A config whose credentials cannot be decrypted
+// (e.g. the secret key changed) is still returned, flagged so the admin can re-enter them.
+func (r *TrafficRepository) openProbeCredentials(cfg *ProbeConfig) error {
+	sealed := cfg.sealedCredentials
+	cfg.sealedCredentials = ""
+	if sealed == "" {
+		return nil
+	}
+
+	data, err := r.secrets.Open(sealed)
+	if err != nil {
+		cfg.CredentialsUnreadable = true
+		return nil
+	}
+	if err := json.Unmarshal([]byte(data), &cfg.Credentials); err != nil {
+		return fmt.Errorf("decode probe credentials: %w", err)
+	}
+	return nil
+}
+
+// defaultProbeConfigName 未命名时使用探针地址的主机名
+func defaultProbeConfigName(cfg ProbeConfig) string {
+	if parsed, err := url.Parse(cfg.Address); err == nil && parsed.Hostname() != "" {
+		return parsed.Hostname()
+	}
+	return cfg.ProbeType
+}
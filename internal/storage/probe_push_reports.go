@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ProbePushReport is the latest cumulative traffic counter pushed by a probe agent for one server.
+type ProbePushReport struct {
+	ConfigID   int64
+	ServerID   string
+	UpBytes    int64
+	DownBytes  int64
+	ReportedAt time.Time
+}
+
+// SaveProbePushReports stores the pushed counters of a probe configuration, replacing earlier reports of the same servers.
+func (r *TrafficRepository) SaveProbePushReports(ctx context.Context, configID int64, reports []ProbePushReport) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin probe push tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO probe_push_reports (config_id, server_id, up_bytes, down_bytes, reported_at) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(config_id, server_id) DO UPDATE SET up_bytes = excluded.up_bytes, down_bytes = excluded.down_bytes, reported_at = excluded.reported_at`)
+	if err != nil {
+		return fmt.Errorf("prepare probe push report: %w", err)
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	for _, report := range reports {
+		if _, err := stmt.ExecContext(ctx, configID, report.ServerID, report.UpBytes, report.DownBytes, now); err != nil {
+			return fmt.Errorf("save probe push report %s: %w", report.ServerID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit probe push reports: %w", err)
+	}
+
+	return nil
+}
+
+// ListProbePushReports returns the latest pushed counters of a probe configuration keyed by server ID.
+func (r *TrafficRepository) ListProbePushReports(ctx context.Context, configID int64) (map[string]ProbePushReport, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT config_id, server_id, up_bytes, down_bytes, reported_at FROM probe_push_reports WHERE config_id = ?`, configID)
+	if err != nil {
+		return nil, fmt.Errorf("list probe push reports: %w", err)
+	}
+	defer rows.Close()
+
+	reports := make(map[string]ProbePushReport)
+	for rows.Next() {
+		var report ProbePushReport
+		if err := rows.Scan(&report.ConfigID, &report.ServerID, &report.UpBytes, &report.DownBytes, &report.ReportedAt); err != nil {
+			return nil, fmt.Errorf("scan probe push report: %w", err)
+		}
+		reports[report.ServerID] = report
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate probe push reports: %w", err)
+	}
+
+	return reports, nil
+}
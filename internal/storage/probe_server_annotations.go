@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// probeAnnotationsColumn 节点查询中附带绑定探针服务器的标注
+const probeAnnotationsColumn = `COALESCE((SELECT annotations FROM probe_server_annotations WHERE server_name = nodes.probe_server), '')`
+
+// ProbeServerAnnotations is the metadata synced from a probe panel for one server name.
+type ProbeServerAnnotations struct {
+	ServerName  string
+	Annotations map[string]string
+	SyncedAt    time.Time
+}
+
+// SaveProbeServerAnnotations replaces the metadata of a probe server; empty annotations remove the entry.
+func (r *TrafficRepository) SaveProbeServerAnnotations(ctx context.Context, serverName string, annotations map[string]string) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	serverName = strings.TrimSpace(serverName)
+	if serverName == "" {
+		return errors.New("server name is required")
+	}
+
+	if len(annotations) == 0 {
+		if _, err := r.db.ExecContext(ctx, `DELETE FROM probe_server_annotations WHERE server_name = ?`, serverName); err != nil {
+			return fmt.Errorf("delete probe server annotations: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(annotations)
+	if err != nil {
+		return fmt.Errorf("encode probe server annotations: %w", err)
+	}
+
+	const stmt = `
+INSERT INTO probe_server_annotations (server_name, annotations, synced_at)
+VALUES (?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(server_name) DO UPDATE SET annotations = excluded.annotations, synced_at = CURRENT_TIMESTAMP
+`
+	if _, err := r.db.ExecContext(ctx, stmt, serverName, string(data)); err != nil {
+		return fmt.Errorf("save probe server annotations: %w", err)
+	}
+
+	return nil
+}
+
+// ListProbeServerAnnotations returns the synced metadata of all probe servers ordered by name.
+func (r *TrafficRepository) ListProbeServerAnnotations(ctx context.Context) ([]ProbeServerAnnotations, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT server_name, annotations, synced_at FROM probe_server_annotations ORDER BY server_name ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("list probe server annotations: %w", err)
+	}
+	defer rows.Close()
+
+	var result []ProbeServerAnnotations
+	for rows.Next() {
+		var entry ProbeServerAnnotations
+		var encoded string
+		if err := rows.Scan(&entry.ServerName, &encoded, &entry.SyncedAt); err != nil {
+			return nil, fmt.Errorf("scan probe server annotations: %w", err)
+		}
+		entry.Annotations = decodeProbeAnnotations(encoded)
+		result = append(result, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate probe server annotations: %w", err)
+	}
+
+	return result, nil
+}
+
+func decodeProbeAnnotations(encoded string) map[string]string {
+	if encoded == "" {
+		return nil
+	}
+	var annotations map[string]string
+	if err := json.Unmarshal([]byte(encoded), &annotations); err != nil {
+		return nil
+	}
+	return annotations
+}
+
+// PruneProbeServerAnnotations removes metadata of servers that no longer exist in any probe configuration.
+func (r *TrafficRepository) PruneProbeServerAnnotations(ctx context.Context) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM probe_server_annotations WHERE server_name NOT IN (SELECT name FROM probe_servers)`); err != nil {
+		return fmt.Errorf("prune probe server annotations: %w", err)
+	}
+
+	return nil
+}
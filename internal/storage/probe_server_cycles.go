@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ProbeServerCycleStart returns the start of the billing cycle containing now for a server
+// that resets on resetDay in the given timezone. Reset days beyond the end of a month are
+// clamped to its last day (e.g. 31 resets on Feb 28/29).
+func ProbeServerCycleStart(now time.Time, resetDay int, timezone string) time.Time {
+	loc := time.Local
+	if tz := strings.TrimSpace(timezone); tz != "" {
+		if loaded, err := time.LoadLocation(tz); err == nil {
+			loc = loaded
+		}
+	}
+	if resetDay < 1 {
+		resetDay = 1
+	}
+
+	local := now.In(loc)
+	start := cycleResetDate(local.Year(), local.Month(), resetDay, loc)
+	if local.Before(start) {
+		start = cycleResetDate(local.Year(), local.Month()-1, resetDay, loc)
+	}
+	return start
+}
+
+func cycleResetDate(year int, month time.Month, resetDay int, loc *time.Location) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	lastDay := first.AddDate(0, 1, -1).Day()
+	if resetDay > lastDay {
+		resetDay = lastDay
+	}
+	return time.Date(first.Year(), first.Month(), resetDay, 0, 0, 0, 0, loc)
+}
+
+// ApplyProbeServerCycle converts a cumulative probe counter into the traffic used since cycleStart.
+// The first reading of a new cycle becomes the baseline; counter drops (probe agent restarts or
+// the probe's own monthly reset) carry the traffic seen so far so it is not lost.
+func (r *TrafficRepository) ApplyProbeServerCycle(ctx context.Context, configID int64, serverID string, cycleStart time.Time, raw int64) (int64, error) {
+	if r == nil || r.db == nil {
+		return 0, errors.New("traffic repository not initialized")
+	}
+	if raw < 0 {
+		raw = 0
+	}
+	start := cycleStart.UTC().Format(time.RFC3339)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin probe server cycle tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var (
+		storedStart string
+		baseline    int64
+		carried     int64
+		lastRaw     int64
+	)
+	err = tx.QueryRowContext(ctx, `SELECT cycle_start, baseline_bytes, carried_bytes, last_raw_bytes FROM probe_server_cycles WHERE config_id = ? AND server_id = ?`, configID, serverID).
+		Scan(&storedStart, &baseline, &carried, &lastRaw)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		// 首次记录：无法得知本周期之前的用量，以当前计数作为已用流量
+		baseline, carried = 0, 0
+	case err != nil:
+		return 0, fmt.Errorf("get probe server cycle: %w", err)
+	case storedStart != start:
+		// 进入新周期：以上次读数为基线重新计算
+		baseline, carried = lastRaw, 0
+		if raw < baseline {
+			baseline = 0
+		}
+	case raw < lastRaw:
+		// 计数器回退（探针重启或探针自身按自然月清零），保留已统计的部分
+		carried += lastRaw - baseline
+		baseline = 0
+	}
+
+	used := carried + raw - baseline
+	if used < 0 {
+		used = 0
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO probe_server_cycles (config_id, server_id, cycle_start, baseline_bytes, carried_bytes, last_raw_bytes, updated_at) VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(config_id, server_id) DO UPDATE SET cycle_start = excluded.cycle_start, baseline_bytes = excluded.baseline_bytes, carried_bytes = excluded.carried_bytes, last_raw_bytes = excluded.last_raw_bytes, updated_at = CURRENT_TIMESTAMP`,
+		configID, serverID, start, baseline, carried, raw); err != nil {
+		return 0, fmt.Errorf("save probe server cycle: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit probe server cycle: %w", err)
+	}
+
+	return used, nil
+}
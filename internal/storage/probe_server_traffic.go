@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ProbeServerTrafficRecord is one day's traffic snapshot of a single probe server.
+// UsedBytes is the usage of the server's billing cycle as of that day.
+type ProbeServerTrafficRecord struct {
+	ConfigID   int64
+	ServerID   string
+	Date       time.Time
+	UsedBytes  int64
+	LimitBytes int64
+}
+
+// RecordProbeServerDaily stores the server's usage for the day of date (in date's own location),
+// replacing any earlier snapshot of the same day.
+func (r *TrafficRepository) RecordProbeServerDaily(ctx context.Context, configID int64, serverID string, date time.Time, usedBytes, limitBytes int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	const stmt = `
+INSERT INTO probe_server_traffic_daily (config_id, server_id, date, used_bytes, limit_bytes)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(config_id, server_id, date) DO UPDATE SET
+    used_bytes = excluded.used_bytes,
+    limit_bytes = excluded.limit_bytes,
+    created_at = CURRENT_TIMESTAMP;
+`
+
+	if _, err := r.db.ExecContext(ctx, stmt, configID, serverID, date.Format("2006-01-02"), usedBytes, limitBytes); err != nil {
+		return fmt.Errorf("upsert probe server traffic record: %w", err)
+	}
+
+	return nil
+}
+
+// ListProbeServerDaily returns the server's daily snapshots from since (inclusive, compared by date) in ascending order.
+func (r *TrafficRepository) ListProbeServerDaily(ctx context.Context, configID int64, serverID string, since time.Time) ([]ProbeServerTrafficRecord, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+SELECT date, used_bytes, limit_bytes
+FROM probe_server_traffic_daily
+WHERE config_id = ? AND server_id = ? AND date >= ?
+ORDER BY date ASC;
+`, configID, serverID, since.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("list probe server traffic records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []ProbeServerTrafficRecord
+	for rows.Next() {
+		var dateStr string
+		record := ProbeServerTrafficRecord{ConfigID: configID, ServerID: serverID}
+		if err := rows.Scan(&dateStr, &record.UsedBytes, &record.LimitBytes); err != nil {
+			return nil, fmt.Errorf("scan probe server traffic record: %w", err)
+		}
+		parsed, err := time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			return nil, fmt.Errorf("parse probe server traffic date: %w", err)
+		}
+		record.Date = parsed
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate probe server traffic records: %w", err)
+	}
+
+	return records, nil
+}
+
+// ListProbeServerDailyOn returns the snapshots of every server for the day of date (in date's own location).
+func (r *TrafficRepository) ListProbeServerDailyOn(ctx context.Context, date time.Time) ([]ProbeServerTrafficRecord, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	day := date.Format("2006-01-02")
+	rows, err := r.db.QueryContext(ctx, `
+SELECT config_id, server_id, used_bytes, limit_bytes
+FROM probe_server_traffic_daily
+WHERE date = ?
+ORDER BY config_id ASC, server_id ASC;
+`, day)
+	if err != nil {
+		return nil, fmt.Errorf("list probe server traffic records: %w", err)
+	}
+	defer rows.Close()
+
+	parsedDay, _ := time.Parse("2006-01-02", day)
+	var records []ProbeServerTrafficRecord
+	for rows.Next() {
+		record := ProbeServerTrafficRecord{Date: parsedDay}
+		if err := rows.Scan(&record.ConfigID, &record.ServerID, &record.UsedBytes, &record.LimitBytes); err != nil {
+			return nil, fmt.Errorf("scan probe server traffic record: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate probe server traffic records: %w", err)
+	}
+
+	return records, nil
+}
+
+// ListProbeServerDailyBetween returns the snapshots of all servers dated within [from, to], ordered by
+// date, config and server.
+func (r *TrafficRepository) ListProbeServerDailyBetween(ctx context.Context, from, to time.Time) ([]ProbeServerTrafficRecord, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+SELECT config_id, server_id, date, used_bytes, limit_bytes
+FROM probe_server_traffic_daily
+WHERE date >= ? AND date <= ?
+ORDER BY date ASC, config_id ASC, server_id ASC;
+`, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("list probe server traffic records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []ProbeServerTrafficRecord
+	for rows.Next() {
+		var record ProbeServerTrafficRecord
+		var day string
+		if err := rows.Scan(&record.ConfigID, &record.ServerID, &day, &record.UsedBytes, &record.LimitBytes); err != nil {
+			return nil, fmt.Errorf("scan probe server traffic record: %w", err)
+		}
+		parsed, err := time.Parse("2006-01-02", day)
+		if err != nil {
+			return nil, fmt.Errorf("parse probe server traffic date: %w", err)
+		}
+		record.Date = parsed
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate probe server traffic records: %w", err)
+	}
+
+	return records, nil
+}
+
+// GetProbeServerByID returns a single probe server row.
+func (r *TrafficRepository) GetProbeServerByID(ctx context.Context, id int64) (ProbeServer, error) {
+	if r == nil || r.db == nil {
+		return ProbeServer{}, errors.New("traffic repository not initialized")
+	}
+
+	row := r.db.QueryRowContext(ctx, `SELECT id, config_id, server_id, name, traffic_method, monthly_traffic_bytes, traffic_multiplier, include_in_total, reset_day, reset_timezone, position, created_at, updated_at FROM probe_servers WHERE id = ?`, id)
+	srv, err := scanProbeServer(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ProbeServer{}, ErrProbeServerNotFound
+		}
+		return ProbeServer{}, fmt.Errorf("get probe server: %w", err)
+	}
+
+	return srv, nil
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxExternalSubscriptionSyncRuns 每个外部订阅保留的同步记录条数
+const maxExternalSubscriptionSyncRuns = 50
+
+// ExternalSubscriptionSyncRun records the outcome of one sync of an external subscription.
+type ExternalSubscriptionSyncRun struct {
+	ID             int64
+	SubscriptionID int64
+	Username       string
+	Success        bool
+	Error          string
+	NodeCount      int
+	CreatedAt      time.Time
+}
+
+// NodeHealth is the latest connectivity check result of a node.
+type NodeHealth struct {
+	NodeID    int64
+	Username  string
+	Alive     bool
+	LatencyMs float64
+	Error     string
+	CheckedAt time.Time
+}
+
+// RecordExternalSubscriptionSyncRun stores a sync result and prunes old records for the subscription.
+func (r *TrafficRepository) RecordExternalSubscriptionSyncRun(ctx context.Context, run ExternalSubscriptionSyncRun) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	if run.SubscriptionID <= 0 {
+		return errors.New("subscription id is required")
+	}
+	username := strings.TrimSpace(run.Username)
+	if username == "" {
+		return errors.New("username is required")
+	}
+
+	success := 0
+	if run.Success {
+		success = 1
+	}
+	if _, err := r.db.ExecContext(ctx, `INSERT INTO external_subscription_sync_runs (subscription_id, username, success, error, node_count) VALUES (?, ?, ?, ?, ?)`,
+		run.SubscriptionID, username, success, run.Error, run.NodeCount); err != nil {
+		return fmt.Errorf("insert external subscription sync run: %w", err)
+	}
+
+	const pruneStmt = `
+DELETE FROM external_subscription_sync_runs
+WHERE subscription_id = ? AND id NOT IN (
+    SELECT id FROM external_subscription_sync_runs WHERE subscription_id = ? ORDER BY id DESC LIMIT ?
+)`
+	if _, err := r.db.ExecContext(ctx, pruneStmt, run.SubscriptionID, run.SubscriptionID, maxExternalSubscriptionSyncRuns); err != nil {
+		return fmt.Errorf("prune external subscription sync runs: %w", err)
+	}
+	return nil
+}
+
+// ListExternalSubscriptionSyncRuns returns the recorded syncs of a subscription, newest first.
+func (r *TrafficRepository) ListExternalSubscriptionSyncRuns(ctx context.Context, subscriptionID int64, username string) ([]ExternalSubscriptionSyncRun, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id, subscription_id, username, success, error, node_count, created_at FROM external_subscription_sync_runs WHERE subscription_id = ? AND username = ? ORDER BY id DESC`, subscriptionID, strings.TrimSpace(username))
+	if err != nil {
+		return nil, fmt.Errorf("list external subscription sync runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []ExternalSubscriptionSyncRun
+	for rows.Next() {
+		var run ExternalSubscriptionSyncRun
+		var success int
+		if err := rows.Scan(&run.ID, &run.SubscriptionID, &run.Username, &success, &run.Error, &run.NodeCount, &run.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan external subscription sync run: %w", err)
+		}
+		run.Success = success != 0
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate external subscription sync runs: %w", err)
+	}
+	return runs, nil
+}
+
+// RecordNodeHealth stores the latest connectivity check of a node, replacing the previous one.
+func (r *TrafficRepository) RecordNodeHealth(ctx context.Context, health NodeHealth) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	if health.NodeID <= 0 {
+		return errors.New("node id is required")
+	}
+	username := strings.TrimSpace(health.Username)
+	if username == "" {
+		return errors.New("username is required")
+	}
+
+	alive := 0
+	if health.Alive {
+		alive = 1
+	}
+	const stmt = `
+INSERT INTO node_health (node_id, username, alive, latency_ms, error, checked_at) VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(node_id) DO UPDATE SET username = excluded.username, alive = excluded.alive, latency_ms = excluded.latency_ms, error = excluded.error, checked_at = excluded.checked_at`
+	if _, err := r.db.ExecContext(ctx, stmt, health.NodeID, username, alive, health.LatencyMs, health.Error); err != nil {
+		return fmt.Errorf("record node health: %w", err)
+	}
+	return nil
+}
+
+// ListNodeHealth returns the latest check of every node of the user that has been checked, keyed by node ID.
+func (r *TrafficRepository) ListNodeHealth(ctx context.Context, username string) (map[int64]NodeHealth, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT h.node_id, h.username, h.alive, h.latency_ms, h.error, h.checked_at FROM node_health h JOIN nodes n ON n.id = h.node_id WHERE h.username = ?`, strings.TrimSpace(username))
+	if err != nil {
+		return nil, fmt.Errorf("list node health: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[int64]NodeHealth)
+	for rows.Next() {
+		var health NodeHealth
+		var alive int
+		if err := rows.Scan(&health.NodeID, &health.Username, &alive, &health.LatencyMs, &health.Error, &health.CheckedAt); err != nil {
+			return nil, fmt.Errorf("scan node health: %w", err)
+		}
+		health.Alive = alive != 0
+		result[health.NodeID] = health
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate node health: %w", err)
+	}
+	return result, nil
+}
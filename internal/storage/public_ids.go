@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+// IDGenerator produces the stable public IDs (UUIDs) of nodes, subscribe files and external
+// subscriptions. Unlike autoincrement IDs they survive export/import into another instance.
+type IDGenerator interface {
+	NewID() (string, error)
+}
+
+type uuidV4Generator struct{}
+
+func (uuidV4Generator) NewID() (string, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// uuidV7Generator 生成按时间有序的 UUIDv7，便于按创建顺序排序
+type uuidV7Generator struct{}
+
+func (uuidV7Generator) NewID() (string, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+type idGeneratorHolder struct{ IDGenerator }
+
+var idGenerator atomic.Pointer[idGeneratorHolder]
+
+func init() {
+	idGenerator.Store(&idGeneratorHolder{uuidV4Generator{}})
+}
+
+// SetIDGenerator replaces the generator used for new public IDs.
+func SetIDGenerator(generator IDGenerator) {
+	if generator == nil {
+		panic("id generator is nil")
+	}
+	idGenerator.Store(&idGeneratorHolder{generator})
+}
+
+// IDGeneratorByName returns a built-in generator: "uuid4" (default) or "uuid7".
+func IDGeneratorByName(name string) (IDGenerator, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "uuid", "uuid4", "uuidv4":
+		return uuidV4Generator{}, nil
+	case "uuid7", "uuidv7":
+		return uuidV7Generator{}, nil
+	default:
+		return nil, fmt.Errorf("unknown id generator %q", name)
+	}
+}
+
+// publicID 返回要写入的公开 ID：保留调用方提供的值（导入时保持引用），否则生成新值
+func publicID(existing string) (string, error) {
+	if existing = strings.TrimSpace(existing); existing != "" {
+		return existing, nil
+	}
+	id, err := idGenerator.Load().NewID()
+	if err != nil {
+		return "", fmt.Errorf("generate public id: %w", err)
+	}
+	return id, nil
+}
+
+// IsPublicID reports whether value looks like a public ID rather than a numeric ID.
+func IsPublicID(value string) bool {
+	_, err := uuid.Parse(value)
+	return err == nil
+}
+
+// backfillPublicIDs 为缺少公开 ID 的已有记录生成 uuid，并创建唯一索引
+func (r *TrafficRepository) backfillPublicIDs(table string) error {
+	rows, err := r.db.Query(`SELECT id FROM ` + table + ` WHERE uuid IS NULL OR uuid = ''`)
+	if err != nil {
+		return fmt.Errorf("query %s without uuid: %w", table, err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan %s id: %w", table, err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate %s ids: %w", table, err)
+	}
+
+	for _, id := range ids {
+		value, err := publicID("")
+		if err != nil {
+			return err
+		}
+		if _, err := r.db.Exec(`UPDATE `+table+` SET uuid = ? WHERE id = ?`, value, id); err != nil {
+			return fmt.Errorf("backfill %s uuid: %w", table, err)
+		}
+	}
+
+	if _, err := r.db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_` + table + `_uuid ON ` + table + `(uuid) WHERE uuid != ''`); err != nil {
+		return fmt.Errorf("create %s uuid index: %w", table, err)
+	}
+	return nil
+}
+
+// NodeIDByUUID resolves the numeric ID of one of the user's nodes from its public ID.
+func (r *TrafficRepository) NodeIDByUUID(ctx context.Context, publicUUID, username string) (int64, error) {
+	if r == nil || r.db == nil {
+		return 0, errors.New("traffic repository not initialized")
+	}
+
+	var id int64
+	err := r.db.QueryRowContext(ctx, `SELECT id FROM nodes WHERE uuid = ? AND username = ?`, strings.TrimSpace(publicUUID), strings.TrimSpace(username)).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNodeNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("resolve node uuid: %w", err)
+	}
+	return id, nil
+}
+
+// SubscribeFileIDByUUID resolves the numeric ID of a subscribe file from its public ID.
+func (r *TrafficRepository) SubscribeFileIDByUUID(ctx context.Context, publicUUID string) (int64, error) {
+	if r == nil || r.db == nil {
+		return 0, errors.New("traffic repository not initialized")
+	}
+
+	var id int64
+	err := r.db.QueryRowContext(ctx, `SELECT id FROM subscribe_files WHERE uuid = ?`, strings.TrimSpace(publicUUID)).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrSubscribeFileNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("resolve subscribe file uuid: %w", err)
+	}
+	return id, nil
+}
+
+// ExternalSubscriptionIDByUUID resolves the numeric ID of one of the user's external subscriptions
+// from its public ID; 0 is returned when it does not exist.
+func (r *TrafficRepository) ExternalSubscriptionIDByUUID(ctx context.Context, publicUUID, username string) (int64, error) {
+	if r == nil || r.db == nil {
+		return 0, errors.New("traffic repository not initialized")
+	}
+
+	var id int64
+	err := r.db.QueryRowContext(ctx, `SELECT id FROM external_subscriptions WHERE uuid = ? AND username = ?`, strings.TrimSpace(publicUUID), strings.TrimSpace(username)).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("resolve external subscription uuid: %w", err)
+	}
+	return id, nil
+}
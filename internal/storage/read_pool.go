@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// defaultReadPoolConns is the connection pool size of the read pool.
+const defaultReadPoolConns = 4
+
+// readPoolRecheckInterval is how often a failed read pool is pinged before it serves reads again.
+const readPoolRecheckInterval = 5 * time.Second
+
+// readPool is a read-only connection pool on the primary database file. With WAL enabled its
+// readers never wait for the single writer connection, and every read transaction starts from the
+// latest committed write, so callers still see their own writes.
+type readPool struct {
+	db      *sql.DB
+	queries atomic.Int64
+	errors  atomic.Int64
+	healthy atomic.Bool
+}
+
+// ReadPoolStats reports the traffic served by the read pool.
+type ReadPoolStats struct {
+	Conns   int   `json:"conns"`
+	Queries int64 `json:"queries"`
+	Errors  int64 `json:"errors"`
+	Healthy bool  `json:"healthy"`
+}
+
+// AttachReadPool opens a read-only connection pool on the primary database file and routes
+// read-heavy list and subscription queries to it; writes always go to the primary connection.
+func (r *TrafficRepository) AttachReadPool(ctx context.Context, primaryPath string, maxConns int) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+	if primaryPath == "" || primaryPath == ":memory:" || strings.Contains(primaryPath, "mode=memory") {
+		return errors.New("read pool requires a file-backed database")
+	}
+	if maxConns <= 0 {
+		maxConns = defaultReadPoolConns
+	}
+
+	db, err := sql.Open(instrumentedDriverName, readOnlyDSN(primaryPath))
+	if err != nil {
+		return fmt.Errorf("open read pool: %w", err)
+	}
+	db.SetMaxOpenConns(maxConns)
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return fmt.Errorf("ping read pool: %w", err)
+	}
+
+	pool := &readPool{db: db}
+	pool.healthy.Store(true)
+	if previous := r.readPool.Swap(pool); previous != nil {
+		previous.close()
+	}
+	return nil
+}
+
+// ReadPoolStats returns the read pool counters, or nil when no read pool is attached.
+func (r *TrafficRepository) ReadPoolStats() *ReadPoolStats {
+	pool := r.readPool.Load()
+	if pool == nil {
+		return nil
+	}
+	return &ReadPoolStats{
+		Conns:   pool.db.Stats().MaxOpenConnections,
+		Queries: pool.queries.Load(),
+		Errors:  pool.errors.Load(),
+		Healthy: pool.healthy.Load(),
+	}
+}
+
+// pickReadPool returns the read pool, or nil when reads should go to the primary.
+func (r *TrafficRepository) pickReadPool() *readPool {
+	pool := r.readPool.Load()
+	if pool == nil || !pool.healthy.Load() {
+		return nil
+	}
+	return pool
+}
+
+// readQuery runs a read-only query on the read pool, falling back to the primary when the pool
+// fails. A failed pool is skipped until a ping against it succeeds.
+func (r *TrafficRepository) readQuery(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if pool := r.pickReadPool(); pool != nil {
+		pool.queries.Add(1)
+		rows, err := pool.db.QueryContext(ctx, query, args...)
+		if err == nil {
+			return rows, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		pool.markFailed()
+	}
+	return r.db.QueryContext(ctx, query, args...)
+}
+
+// readQueryRow runs a single-row read-only query on the read pool. Errors only surface on Scan,
+// so the returned row retries on the primary when the pool fails, the same way readQuery does.
+func (r *TrafficRepository) readQueryRow(ctx context.Context, query string, args ...any) rowScanner {
+	pool := r.pickReadPool()
+	if pool == nil {
+		return r.db.QueryRowContext(ctx, query, args...)
+	}
+	pool.queries.Add(1)
+	return &fallbackRow{
+		row: pool.db.QueryRowContext(ctx, query, args...),
+		fallback: func(err error) rowScanner {
+			if errors.Is(err, sql.ErrNoRows) || ctx.Err() != nil {
+				return nil
+			}
+			pool.markFailed()
+			return r.db.QueryRowContext(ctx, query, args...)
+		},
+	}
+}
+
+// fallbackRow scans a read pool row and retries on the primary when the pool query failed.
+type fallbackRow struct {
+	row      *sql.Row
+	fallback func(err error) rowScanner
+}
+
+func (f *fallbackRow) Scan(dest ...any) error {
+	err := f.row.Scan(dest...)
+	if err == nil {
+		return nil
+	}
+	if primary := f.fallback(err); primary != nil {
+		return primary.Scan(dest...)
+	}
+	return err
+}
+
+func (pool *readPool) markFailed() {
+	pool.errors.Add(1)
+	if pool.healthy.Swap(false) {
+		go pool.recheck()
+	}
+}
+
+// recheck pings the failed pool until it recovers or is closed.
+func (pool *readPool) recheck() {
+	for {
+		time.Sleep(readPoolRecheckInterval)
+		err := pool.db.PingContext(context.Background())
+		if err == nil {
+			pool.healthy.Store(true)
+			return
+		}
+		if errors.Is(err, sql.ErrConnDone) || strings.Contains(err.Error(), "database is closed") {
+			return
+		}
+	}
+}
+
+func (pool *readPool) close() {
+	if pool == nil {
+		return
+	}
+	_ = pool.db.Close()
+}
+
+// readOnlyDSN adds the query_only pragma so a read pool connection can never write.
+func readOnlyDSN(dsn string) string {
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + "_pragma=query_only(1)"
+}
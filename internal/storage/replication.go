@@ -0,0 +1,536 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ReplicaRestoreIfMissing restores the database from the replica only when no local database exists.
+	ReplicaRestoreIfMissing = "if-missing"
+	// ReplicaRestoreAlways replaces the local database with the latest replica generation on every start.
+	ReplicaRestoreAlways = "always"
+
+	defaultReplicaInterval = 10 * time.Second
+	defaultReplicaRetain   = 60
+	replicaManifestKey     = "manifest.json"
+	replicaGenerationsDir  = "generations"
+	replicaSecretKeyObject = "secret.key"
+)
+
+// ErrReplicaNotFound is returned when the replica target holds no generation to restore from.
+var ErrReplicaNotFound = errors.New("replica not found")
+
+// ReplicaConfig configures continuous replication of the SQLite database to a local path or an S3 bucket.
+type ReplicaConfig struct {
+	// URL is the replica target: a plain directory, file:///dir or s3://bucket/prefix.
+	URL string
+	// Interval is how often the database is checked for changes (default 10s).
+	Interval time.Duration
+	// Retain is the number of generations kept in the replica (default 60).
+	Retain int
+	// Restore is the restore-on-start mode: empty (disabled), "if-missing" or "always".
+	Restore string
+	// SkipSecretKey disables replicating the data-directory secret.key next to the database.
+	SkipSecretKey bool
+
+	S3Endpoint  string
+	S3Region    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PathStyle bool
+}
+
+// Enabled reports whether a replica target is configured.
+func (c ReplicaConfig) Enabled() bool {
+	return strings.TrimSpace(c.URL) != ""
+}
+
+func (c ReplicaConfig) interval() time.Duration {
+	if c.Interval <= 0 {
+		return defaultReplicaInterval
+	}
+	return c.Interval
+}
+
+func (c ReplicaConfig) retain() int {
+	if c.Retain <= 0 {
+		return defaultReplicaRetain
+	}
+	return c.Retain
+}
+
+// ValidateReplicaRestoreMode normalizes the restore-on-start mode.
+func ValidateReplicaRestoreMode(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "", "off", "false", "0":
+		return "", nil
+	case ReplicaRestoreIfMissing, ReplicaRestoreAlways:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid replica restore mode %q", mode)
+}
+
+// ReplicaGeneration describes one compressed database snapshot stored in the replica.
+type ReplicaGeneration struct {
+	Key       string    `json:"key"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+}
+
+type replicaManifest struct {
+	Version     int                 `json:"version"`
+	Generations []ReplicaGeneration `json:"generations"`
+	SecretKey   string              `json:"secret_key,omitempty"`
+}
+
+func (m *replicaManifest) latest() (ReplicaGeneration, bool) {
+	if len(m.Generations) == 0 {
+		return ReplicaGeneration{}, false
+	}
+	return m.Generations[len(m.Generations)-1], true
+}
+
+// replicaStore is the object storage behind a replica target.
+type replicaStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	// Get returns os.ErrNotExist when the object does not exist.
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+func openReplicaStore(cfg ReplicaConfig) (replicaStore, error) {
+	raw := strings.TrimSpace(cfg.URL)
+	if raw == "" {
+		return nil, errors.New("replica url is empty")
+	}
+	if !strings.Contains(raw, "://") {
+		return fileReplicaStore{dir: raw}, nil
+	}
+
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse replica url: %w", err)
+	}
+	switch parsed.Scheme {
+	case "file":
+		dir := parsed.Path
+		if parsed.Host != "" {
+			dir = filepath.Join(parsed.Host, parsed.Path)
+		}
+		if dir == "" {
+			return nil, errors.New("replica file url has no path")
+		}
+		return fileReplicaStore{dir: dir}, nil
+	case "s3":
+		return newS3ReplicaStore(cfg, parsed.Host, strings.Trim(parsed.Path, "/"))
+	}
+	return nil, fmt.Errorf("unsupported replica scheme %q", parsed.Scheme)
+}
+
+// fileReplicaStore keeps replica objects in a local (typically separately mounted) directory.
+type fileReplicaStore struct {
+	dir string
+}
+
+func (s fileReplicaStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(key))
+}
+
+func (s fileReplicaStore) Put(_ context.Context, key string, data []byte) error {
+	target := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("create replica directory: %w", err)
+	}
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write replica object: %w", err)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("write replica object: %w", err)
+	}
+	return nil
+}
+
+func (s fileReplicaStore) Get(_ context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s fileReplicaStore) Delete(_ context.Context, key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("delete replica object: %w", err)
+	}
+	return nil
+}
+
+func loadReplicaManifest(ctx context.Context, store replicaStore) (*replicaManifest, error) {
+	data, err := store.Get(ctx, replicaManifestKey)
+	if errors.Is(err, os.ErrNotExist) {
+		return &replicaManifest{Version: 1}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read replica manifest: %w", err)
+	}
+	var manifest replicaManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("decode replica manifest: %w", err)
+	}
+	sortReplicaGenerations(manifest.Generations)
+	return &manifest, nil
+}
+
+func saveReplicaManifest(ctx context.Context, store replicaStore, manifest *replicaManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode replica manifest: %w", err)
+	}
+	if err := store.Put(ctx, replicaManifestKey, data); err != nil {
+		return fmt.Errorf("write replica manifest: %w", err)
+	}
+	return nil
+}
+
+// ReplicaStatus is a point-in-time view of the replicator.
+type ReplicaStatus struct {
+	Target        string     `json:"target"`
+	IntervalMs    int64      `json:"interval_ms"`
+	Retain        int        `json:"retain"`
+	LastSyncAt    *time.Time `json:"last_sync_at,omitempty"`
+	LastUploadAt  *time.Time `json:"last_upload_at,omitempty"`
+	LastCheckAt   *time.Time `json:"last_check_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorAt   *time.Time `json:"last_error_at,omitempty"`
+	Generations   int        `json:"generations"`
+	LatestSize    int64      `json:"latest_size"`
+	LatestSHA256  string     `json:"latest_sha256,omitempty"`
+	UploadedTotal int64      `json:"uploaded_total"`
+}
+
+// Replicator continuously copies consistent snapshots of the database to a replica target.
+// Snapshots are taken with VACUUM INTO only when the database or its WAL changed, compressed,
+// uploaded as a new generation and recorded in a manifest that also applies retention.
+type Replicator struct {
+	repo   *TrafficRepository
+	dbPath string
+	cfg    ReplicaConfig
+	store  replicaStore
+
+	syncMu    sync.Mutex
+	lastStamp string
+	lastSum   string
+
+	mu     sync.Mutex
+	status ReplicaStatus
+}
+
+// NewReplicator creates a replicator for the database stored at dbPath.
+func NewReplicator(repo *TrafficRepository, dbPath string, cfg ReplicaConfig) (*Replicator, error) {
+	if repo == nil {
+		return nil, errors.New("replicator requires a repository")
+	}
+	store, err := openReplicaStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Replicator{
+		repo:   repo,
+		dbPath: dbPath,
+		cfg:    cfg,
+		store:  store,
+		status: ReplicaStatus{
+			Target:     redactReplicaURL(cfg.URL),
+			IntervalMs: cfg.interval().Milliseconds(),
+			Retain:     cfg.retain(),
+		},
+	}, nil
+}
+
+// Interval returns how often the replicator checks the database for changes.
+func (r *Replicator) Interval() time.Duration {
+	return r.cfg.interval()
+}
+
+// Status returns the current replication status.
+func (r *Replicator) Status() ReplicaStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// SyncNow uploads a new generation when the database changed since the last upload (or force is set).
+// It reports whether a generation was uploaded.
+func (r *Replicator) SyncNow(ctx context.Context, force bool) (bool, error) {
+	r.syncMu.Lock()
+	defer r.syncMu.Unlock()
+
+	uploaded, err := r.sync(ctx, force)
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.LastCheckAt = &now
+	if err != nil {
+		r.status.LastError = err.Error()
+		r.status.LastErrorAt = &now
+		return false, err
+	}
+	r.status.LastError = ""
+	r.status.LastErrorAt = nil
+	r.status.LastSyncAt = &now
+	if uploaded {
+		r.status.LastUploadAt = &now
+	}
+	return uploaded, nil
+}
+
+func (r *Replicator) sync(ctx context.Context, force bool) (bool, error) {
+	stamp := replicaFileStamp(r.dbPath)
+	if !force && stamp != "" && stamp == r.lastStamp {
+		return false, nil
+	}
+
+	snapshot, err := r.snapshot(ctx)
+	if err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256(snapshot)
+	digest := hex.EncodeToString(sum[:])
+	if !force && digest == r.lastSum {
+		r.lastStamp = stamp
+		return false, nil
+	}
+
+	manifest, err := loadReplicaManifest(ctx, r.store)
+	if err != nil {
+		return false, err
+	}
+	if latest, ok := manifest.latest(); ok && latest.SHA256 == digest && !force {
+		r.lastStamp, r.lastSum = stamp, digest
+		r.recordManifest(manifest, 0)
+		return false, nil
+	}
+
+	compressed, err := gzipBytes(snapshot)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now().UTC()
+	generation := ReplicaGeneration{
+		Key:       fmt.Sprintf("%s/%s-%s.db.gz", replicaGenerationsDir, now.Format("20060102T150405.000000000Z"), digest[:12]),
+		CreatedAt: now,
+		Size:      int64(len(snapshot)),
+		SHA256:    digest,
+	}
+	if err := r.store.Put(ctx, generation.Key, compressed); err != nil {
+		return false, fmt.Errorf("upload replica generation: %w", err)
+	}
+
+	if !r.cfg.SkipSecretKey && manifest.SecretKey == "" {
+		if key, ok, err := r.readSecretKey(); err != nil {
+			return false, err
+		} else if ok {
+			if err := r.store.Put(ctx, replicaSecretKeyObject, key); err != nil {
+				return false, fmt.Errorf("upload replica secret key: %w", err)
+			}
+			manifest.SecretKey = replicaSecretKeyObject
+		}
+	}
+
+	manifest.Version = 1
+	manifest.Generations = append(manifest.Generations, generation)
+	var expired []ReplicaGeneration
+	if retain := r.cfg.retain(); len(manifest.Generations) > retain {
+		expired = append(expired, manifest.Generations[:len(manifest.Generations)-retain]...)
+		manifest.Generations = append([]ReplicaGeneration(nil), manifest.Generations[len(manifest.Generations)-retain:]...)
+	}
+	if err := saveReplicaManifest(ctx, r.store, manifest); err != nil {
+		return false, err
+	}
+	// 清单已经不再引用过期的快照，删除失败只会留下孤立对象
+	for _, old := range expired {
+		_ = r.store.Delete(ctx, old.Key)
+	}
+
+	r.lastStamp, r.lastSum = stamp, digest
+	r.recordManifest(manifest, int64(len(compressed)))
+	return true, nil
+}
+
+func (r *Replicator) recordManifest(manifest *replicaManifest, uploaded int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.Generations = len(manifest.Generations)
+	if latest, ok := manifest.latest(); ok {
+		r.status.LatestSize = latest.Size
+		r.status.LatestSHA256 = latest.SHA256
+	}
+	r.status.UploadedTotal += uploaded
+}
+
+// snapshot writes a transactionally consistent copy of the database with VACUUM INTO.
+func (r *Replicator) snapshot(ctx context.Context) ([]byte, error) {
+	tmpDir, err := os.MkdirTemp(filepath.Dir(r.dbPath), ".replica-")
+	if err != nil {
+		return nil, fmt.Errorf("create replica snapshot directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	target := filepath.Join(tmpDir, "snapshot.db")
+	if _, err := r.repo.db.ExecContext(ctx, "VACUUM INTO ?", target); err != nil {
+		return nil, fmt.Errorf("snapshot database: %w", err)
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return nil, fmt.Errorf("read database snapshot: %w", err)
+	}
+	return data, nil
+}
+
+func (r *Replicator) readSecretKey() ([]byte, bool, error) {
+	if strings.TrimSpace(os.Getenv(secretKeyEnv)) != "" {
+		return nil, false, nil
+	}
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(r.dbPath), secretKeyFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("read secret key: %w", err)
+	}
+	return data, true, nil
+}
+
+// RestoreReplica restores the database at dbPath from the latest replica generation according to
+// cfg.Restore. It must run before the repository is opened. It reports whether a restore happened;
+// a missing replica is not an error for "if-missing" so that first starts work.
+func RestoreReplica(ctx context.Context, cfg ReplicaConfig, dbPath string) (bool, error) {
+	mode, err := ValidateReplicaRestoreMode(cfg.Restore)
+	if err != nil || mode == "" || !cfg.Enabled() {
+		return false, err
+	}
+	if mode == ReplicaRestoreIfMissing {
+		if _, err := os.Stat(dbPath); err == nil {
+			return false, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return false, fmt.Errorf("stat database: %w", err)
+		}
+	}
+
+	store, err := openReplicaStore(cfg)
+	if err != nil {
+		return false, err
+	}
+	manifest, err := loadReplicaManifest(ctx, store)
+	if err != nil {
+		return false, err
+	}
+	latest, ok := manifest.latest()
+	if !ok {
+		if mode == ReplicaRestoreIfMissing {
+			return false, nil
+		}
+		return false, ErrReplicaNotFound
+	}
+
+	compressed, err := store.Get(ctx, latest.Key)
+	if err != nil {
+		return false, fmt.Errorf("download replica generation %s: %w", latest.Key, err)
+	}
+	data, err := gunzipBytes(compressed)
+	if err != nil {
+		return false, fmt.Errorf("decompress replica generation %s: %w", latest.Key, err)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != latest.SHA256 {
+		return false, fmt.Errorf("replica generation %s checksum mismatch", latest.Key)
+	}
+
+	dir := filepath.Dir(dbPath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return false, fmt.Errorf("create traffic data directory: %w", err)
+	}
+	if _, err := os.Stat(dbPath); err == nil {
+		// 覆盖前保留原数据库，避免误配置时丢失本地数据
+		backup := fmt.Sprintf("%s.pre-restore-%s", dbPath, time.Now().Format("20060102150405"))
+		if err := os.Rename(dbPath, backup); err != nil {
+			return false, fmt.Errorf("keep local database: %w", err)
+		}
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, fmt.Errorf("remove stale %s file: %w", suffix, err)
+		}
+	}
+
+	tmp := dbPath + ".restore"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return false, fmt.Errorf("write restored database: %w", err)
+	}
+	if err := os.Rename(tmp, dbPath); err != nil {
+		_ = os.Remove(tmp)
+		return false, fmt.Errorf("write restored database: %w", err)
+	}
+
+	if manifest.SecretKey != "" && strings.TrimSpace(os.Getenv(secretKeyEnv)) == "" {
+		keyPath := filepath.Join(dir, secretKeyFilename)
+		if _, err := os.Stat(keyPath); errors.Is(err, os.ErrNotExist) {
+			key, err := store.Get(ctx, manifest.SecretKey)
+			if err != nil {
+				return true, fmt.Errorf("download replica secret key: %w", err)
+			}
+			if err := os.WriteFile(keyPath, key, 0o600); err != nil {
+				return true, fmt.Errorf("write secret key: %w", err)
+			}
+		}
+	}
+	return true, nil
+}
+
+// replicaFileStamp identifies the on-disk state of the database and its WAL so unchanged databases
+// can skip the snapshot entirely.
+func replicaFileStamp(dbPath string) string {
+	var parts []string
+	for _, path := range []string{dbPath, dbPath + "-wal"} {
+		info, err := os.Stat(path)
+		if err != nil {
+			parts = append(parts, "-")
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano()))
+	}
+	return strings.Join(parts, "|")
+}
+
+// redactReplicaURL hides credentials embedded in the replica URL.
+func redactReplicaURL(raw string) string {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || parsed.User == nil {
+		return strings.TrimSpace(raw)
+	}
+	return parsed.Redacted()
+}
+
+// sortReplicaGenerations orders generations oldest first.
+func sortReplicaGenerations(generations []ReplicaGeneration) {
+	sort.Slice(generations, func(i, j int) bool {
+		return generations[i].CreatedAt.Before(generations[j].CreatedAt)
+	})
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrRuleCacheEntryNotFound is returned when a rule cache ID was never registered.
+var ErrRuleCacheEntryNotFound = errors.New("rule cache entry not found")
+
+// RuleCacheEntry is a remote rule set or geo database mirrored by the panel. Entries are registered
+// when a generated config is rewritten to point at the mirror; only registered URLs are ever fetched.
+type RuleCacheEntry struct {
+	ID           string
+	URL          string
+	Size         int64
+	SHA256       string
+	ETag         string
+	LastModified string
+	FetchedAt    *time.Time
+	LastError    string
+	Hits         int64
+	LastAccessAt time.Time
+	CreatedAt    time.Time
+}
+
+// RuleCacheID returns the stable mirror ID of a remote URL.
+func RuleCacheID(url string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(url)))
+	return hex.EncodeToString(sum[:8])
+}
+
+const ruleCacheEntryColumns = `id, url, size, sha256, etag, last_modified, fetched_at, last_error, hits, last_access_at, created_at`
+
+func scanRuleCacheEntry(scanner interface{ Scan(...any) error }) (RuleCacheEntry, error) {
+	var (
+		e         RuleCacheEntry
+		fetchedAt sql.NullTime
+	)
+	if err := scanner.Scan(&e.ID, &e.URL, &e.Size, &e.SHA256, &e.ETag, &e.LastModified, &fetchedAt, &e.LastError, &e.Hits, &e.LastAccessAt, &e.CreatedAt); err != nil {
+		return RuleCacheEntry{}, err
+	}
+	if fetchedAt.Valid {
+		t := fetchedAt.Time
+		e.FetchedAt = &t
+	}
+	return e, nil
+}
+
+// RegisterRuleCacheURL makes url available through the mirror and returns its ID.
+func (r *TrafficRepository) RegisterRuleCacheURL(ctx context.Context, url string) (string, error) {
+	if r == nil || r.db == nil {
+		return "", errors.New("traffic repository not initialized")
+	}
+
+	url = strings.TrimSpace(url)
+	if url == "" {
+		return "", errors.New("rule cache url is required")
+	}
+	id := RuleCacheID(url)
+	if _, err := r.db.ExecContext(ctx, `INSERT INTO rule_cache_entries (id, url) VALUES (?, ?) ON CONFLICT(id) DO NOTHING`, id, url); err != nil {
+		return "", fmt.Errorf("register rule cache url: %w", err)
+	}
+	return id, nil
+}
+
+// GetRuleCacheEntry returns a registered mirror entry.
+func (r *TrafficRepository) GetRuleCacheEntry(ctx context.Context, id string) (RuleCacheEntry, error) {
+	if r == nil || r.db == nil {
+		return RuleCacheEntry{}, errors.New("traffic repository not initialized")
+	}
+
+	e, err := scanRuleCacheEntry(r.db.QueryRowContext(ctx, `SELECT `+ruleCacheEntryColumns+` FROM rule_cache_entries WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return RuleCacheEntry{}, ErrRuleCacheEntryNotFound
+	}
+	if err != nil {
+		return RuleCacheEntry{}, fmt.Errorf("get rule cache entry: %w", err)
+	}
+	return e, nil
+}
+
+// ListRuleCacheEntries returns every registered mirror entry, most recently used first.
+func (r *TrafficRepository) ListRuleCacheEntries(ctx context.Context) ([]RuleCacheEntry, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+ruleCacheEntryColumns+` FROM rule_cache_entries ORDER BY last_access_at DESC, url ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("list rule cache entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []RuleCacheEntry
+	for rows.Next() {
+		e, err := scanRuleCacheEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan rule cache entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rule cache entries: %w", err)
+	}
+	return entries, nil
+}
+
+// UpdateRuleCacheFetch stores the outcome of downloading an entry. A non-empty fetchErr keeps the
+// previous content metadata and only records the error.
+func (r *TrafficRepository) UpdateRuleCacheFetch(ctx context.Context, e RuleCacheEntry, fetchErr string) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	var err error
+	if fetchErr != "" {
+		_, err = r.db.ExecContext(ctx, `UPDATE rule_cache_entries SET last_error = ? WHERE id = ?`, fetchErr, e.ID)
+	} else {
+		_, err = r.db.ExecContext(ctx, `UPDATE rule_cache_entries SET size = ?, sha256 = ?, etag = ?, last_modified = ?, fetched_at = ?, last_error = '' WHERE id = ?`,
+			e.Size, e.SHA256, e.ETag, e.LastModified, time.Now().UTC(), e.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("update rule cache fetch: %w", err)
+	}
+	return nil
+}
+
+// RecordRuleCacheHit counts one client download of an entry.
+func (r *TrafficRepository) RecordRuleCacheHit(ctx context.Context, id string) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	if _, err := r.db.ExecContext(ctx, `UPDATE rule_cache_entries SET hits = hits + 1, last_access_at = ? WHERE id = ?`, time.Now().UTC(), id); err != nil {
+		return fmt.Errorf("record rule cache hit: %w", err)
+	}
+	return nil
+}
+
+// DeleteRuleCacheEntries removes the given entries, or every entry when ids is empty, and returns
+// the IDs that were removed so their cached files can be deleted.
+func (r *TrafficRepository) DeleteRuleCacheEntries(ctx context.Context, ids []string) ([]string, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	if len(ids) == 0 {
+		entries, err := r.ListRuleCacheEntries(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			ids = append(ids, e.ID)
+		}
+	}
+
+	var removed []string
+	for _, id := range ids {
+		res, err := r.db.ExecContext(ctx, `DELETE FROM rule_cache_entries WHERE id = ?`, id)
+		if err != nil {
+			return removed, fmt.Errorf("delete rule cache entry: %w", err)
+		}
+		if affected, err := res.RowsAffected(); err == nil && affected > 0 {
+			removed = append(removed, id)
+		}
+	}
+	return removed, nil
+}
+
+// ListStaleRuleCacheEntryIDs returns the entries no client has downloaded since before.
+func (r *TrafficRepository) ListStaleRuleCacheEntryIDs(ctx context.Context, before time.Time) ([]string, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id FROM rule_cache_entries WHERE last_access_at < ?`, before.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("list stale rule cache entries: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan stale rule cache entry: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate stale rule cache entries: %w", err)
+	}
+	return ids, nil
+}
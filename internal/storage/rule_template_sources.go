@@ -0,0 +1,281 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrRuleTemplateSourceNotFound is returned when a rule template was not imported from a URL.
+var ErrRuleTemplateSourceNotFound = errors.New("rule template source not found")
+
+// ErrRuleTemplateVersionNotFound is returned when a rule template version does not exist.
+var ErrRuleTemplateVersionNotFound = errors.New("rule template version not found")
+
+const (
+	// RuleTemplateFormatClash 源内容是 Clash 配置，原样保存
+	RuleTemplateFormatClash = "clash"
+	// RuleTemplateFormatACL 源内容是 ACL4SSR 风格的 ini（ruleset= / custom_proxy_group=），导入时转换为 Clash 配置
+	RuleTemplateFormatACL = "acl"
+
+	// maxRuleTemplateVersions 每个规则模板保留的历史版本数
+	maxRuleTemplateVersions = 20
+)
+
+// RuleTemplateSource records where a file in rule_templates was imported from so it can be re-imported.
+type RuleTemplateSource struct {
+	Filename       string
+	SourceURL      string
+	Format         string
+	ContentHash    string // SHA-256 of the fetched source content, used to detect upstream changes
+	LastImportedAt time.Time
+	LastCheckedAt  time.Time
+	CreatedAt      time.Time
+}
+
+// RuleTemplateVersion is one saved revision of a rule template file.
+type RuleTemplateVersion struct {
+	ID          int64
+	Filename    string
+	Version     int
+	Action      string // initial, import, reimport, edit, restore
+	SourceURL   string
+	ContentHash string
+	Content     string // Empty in listings
+	CreatedAt   time.Time
+}
+
+// RuleTemplateContentHash returns the hash used to compare rule template contents.
+func RuleTemplateContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// UpsertRuleTemplateSource creates or replaces the import source of a rule template.
+func (r *TrafficRepository) UpsertRuleTemplateSource(ctx context.Context, source RuleTemplateSource) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	source.Filename = strings.TrimSpace(source.Filename)
+	source.SourceURL = strings.TrimSpace(source.SourceURL)
+	if source.Filename == "" || source.SourceURL == "" {
+		return errors.New("rule template filename and source url are required")
+	}
+	now := time.Now().UTC()
+	if source.LastImportedAt.IsZero() {
+		source.LastImportedAt = now
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO rule_template_sources (filename, source_url, format, content_hash, last_imported_at, last_checked_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(filename) DO UPDATE SET
+			source_url = excluded.source_url,
+			format = excluded.format,
+			content_hash = excluded.content_hash,
+			last_imported_at = excluded.last_imported_at,
+			last_checked_at = excluded.last_checked_at
+	`, source.Filename, source.SourceURL, source.Format, source.ContentHash, source.LastImportedAt, now)
+	if err != nil {
+		return fmt.Errorf("upsert rule template source: %w", err)
+	}
+	return nil
+}
+
+// TouchRuleTemplateSource records a re-import check that found no upstream change.
+func (r *TrafficRepository) TouchRuleTemplateSource(ctx context.Context, filename string) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	if _, err := r.db.ExecContext(ctx, `UPDATE rule_template_sources SET last_checked_at = ? WHERE filename = ?`, time.Now().UTC(), filename); err != nil {
+		return fmt.Errorf("touch rule template source: %w", err)
+	}
+	return nil
+}
+
+func scanRuleTemplateSource(scanner interface{ Scan(...any) error }) (RuleTemplateSource, error) {
+	var s RuleTemplateSource
+	err := scanner.Scan(&s.Filename, &s.SourceURL, &s.Format, &s.ContentHash, &s.LastImportedAt, &s.LastCheckedAt, &s.CreatedAt)
+	return s, err
+}
+
+// GetRuleTemplateSource returns the import source of a rule template.
+func (r *TrafficRepository) GetRuleTemplateSource(ctx context.Context, filename string) (RuleTemplateSource, error) {
+	if r == nil || r.db == nil {
+		return RuleTemplateSource{}, errors.New("traffic repository not initialized")
+	}
+
+	s, err := scanRuleTemplateSource(r.db.QueryRowContext(ctx, `
+		SELECT filename, source_url, format, content_hash, last_imported_at, last_checked_at, created_at
+		FROM rule_template_sources WHERE filename = ?
+	`, filename))
+	if errors.Is(err, sql.ErrNoRows) {
+		return RuleTemplateSource{}, ErrRuleTemplateSourceNotFound
+	}
+	if err != nil {
+		return RuleTemplateSource{}, fmt.Errorf("get rule template source: %w", err)
+	}
+	return s, nil
+}
+
+// ListRuleTemplateSources returns the import sources of all imported rule templates.
+func (r *TrafficRepository) ListRuleTemplateSources(ctx context.Context) ([]RuleTemplateSource, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT filename, source_url, format, content_hash, last_imported_at, last_checked_at, created_at
+		FROM rule_template_sources ORDER BY filename ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list rule template sources: %w", err)
+	}
+	defer rows.Close()
+
+	var sources []RuleTemplateSource
+	for rows.Next() {
+		s, err := scanRuleTemplateSource(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan rule template source: %w", err)
+		}
+		sources = append(sources, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rule template sources: %w", err)
+	}
+	return sources, nil
+}
+
+// AddRuleTemplateVersion saves a new revision of a rule template and prunes the oldest revisions
+// beyond maxRuleTemplateVersions. The stored version number is returned.
+func (r *TrafficRepository) AddRuleTemplateVersion(ctx context.Context, v RuleTemplateVersion) (int, error) {
+	if r == nil || r.db == nil {
+		return 0, errors.New("traffic repository not initialized")
+	}
+	if strings.TrimSpace(v.Filename) == "" {
+		return 0, errors.New("rule template filename is required")
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin rule template version: %w", err)
+	}
+	defer tx.Rollback()
+
+	var latest int
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM rule_template_versions WHERE filename = ?`, v.Filename).Scan(&latest); err != nil {
+		return 0, fmt.Errorf("latest rule template version: %w", err)
+	}
+	v.Version = latest + 1
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO rule_template_versions (filename, version, action, source_url, content_hash, content)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, v.Filename, v.Version, v.Action, v.SourceURL, RuleTemplateContentHash(v.Content), v.Content); err != nil {
+		return 0, fmt.Errorf("insert rule template version: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM rule_template_versions WHERE filename = ? AND version <= ?`, v.Filename, v.Version-maxRuleTemplateVersions); err != nil {
+		return 0, fmt.Errorf("prune rule template versions: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit rule template version: %w", err)
+	}
+	return v.Version, nil
+}
+
+// ListRuleTemplateVersions returns the revisions of a rule template, newest first, without content.
+func (r *TrafficRepository) ListRuleTemplateVersions(ctx context.Context, filename string) ([]RuleTemplateVersion, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, filename, version, action, source_url, content_hash, created_at
+		FROM rule_template_versions WHERE filename = ? ORDER BY version DESC
+	`, filename)
+	if err != nil {
+		return nil, fmt.Errorf("list rule template versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []RuleTemplateVersion
+	for rows.Next() {
+		var v RuleTemplateVersion
+		if err := rows.Scan(&v.ID, &v.Filename, &v.Version, &v.Action, &v.SourceURL, &v.ContentHash, &v.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan rule template version: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rule template versions: %w", err)
+	}
+	return versions, nil
+}
+
+// GetRuleTemplateVersion returns one revision of a rule template including its content.
+func (r *TrafficRepository) GetRuleTemplateVersion(ctx context.Context, filename string, version int) (RuleTemplateVersion, error) {
+	if r == nil || r.db == nil {
+		return RuleTemplateVersion{}, errors.New("traffic repository not initialized")
+	}
+
+	var v RuleTemplateVersion
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, filename, version, action, source_url, content_hash, content, created_at
+		FROM rule_template_versions WHERE filename = ? AND version = ?
+	`, filename, version).Scan(&v.ID, &v.Filename, &v.Version, &v.Action, &v.SourceURL, &v.ContentHash, &v.Content, &v.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RuleTemplateVersion{}, ErrRuleTemplateVersionNotFound
+	}
+	if err != nil {
+		return RuleTemplateVersion{}, fmt.Errorf("get rule template version: %w", err)
+	}
+	return v, nil
+}
+
+// RenameRuleTemplateHistory moves the source and revisions of a rule template to its new filename.
+func (r *TrafficRepository) RenameRuleTemplateHistory(ctx context.Context, oldFilename, newFilename string) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin rename rule template: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE rule_template_sources SET filename = ? WHERE filename = ?`, newFilename, oldFilename); err != nil {
+		return fmt.Errorf("rename rule template source: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE rule_template_versions SET filename = ? WHERE filename = ?`, newFilename, oldFilename); err != nil {
+		return fmt.Errorf("rename rule template versions: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit rename rule template: %w", err)
+	}
+	return nil
+}
+
+// DeleteRuleTemplateHistory removes the source and revisions of a deleted rule template.
+func (r *TrafficRepository) DeleteRuleTemplateHistory(ctx context.Context, filename string) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM rule_template_sources WHERE filename = ?`, filename); err != nil {
+		return fmt.Errorf("delete rule template source: %w", err)
+	}
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM rule_template_versions WHERE filename = ?`, filename); err != nil {
+		return fmt.Errorf("delete rule template versions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	secretKeyFilename    = "secret.key"
+	secretKeyEnv         = "SECRET_KEY"
+	secretKeyPreviousEnv = "SECRET_KEY_PREVIOUS"
+	secretBoxPrefix      = "enc:"
+	secretBoxPrefixV1    = "enc:v1:" // no key id, opened by trying every configured key
+	secretBoxPrefixV2    = "enc:v2:" // followed by "<key id>:"
+)
+
+// secretKey is one AES-256-GCM key and the short id stored next to the values it sealed.
+type secretKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// secretBox encrypts secrets stored in the database (e.g. probe panel credentials) with AES-256-GCM.
+// The first key seals new values; the others are previous keys that are only used to open values
+// sealed before a rotation, until ReencryptSecrets has moved them to the current key.
+type secretBox struct {
+	keys []secretKey
+}
+
+// loadSecretBox derives the encryption key from the SECRET_KEY environment variable, or from
+// <dataDir>/secret.key which is generated on first start. dataDir may be empty for in-memory databases,
+// in which case an ephemeral key is used. Previous keys come from SECRET_KEY_PREVIOUS (comma-separated,
+// either old SECRET_KEY values or the hex contents of an old secret.key) and, when SECRET_KEY is set,
+// from an existing secret.key so switching from the generated file to the variable keeps old secrets readable.
+func loadSecretBox(dataDir string) (*secretBox, error) {
+	var current []byte
+	var previous [][]byte
+	if env := strings.TrimSpace(os.Getenv(secretKeyEnv)); env != "" {
+		current = deriveSecretKey(env)
+		if dataDir != "" {
+			if key, err := readSecretKeyFile(filepath.Join(dataDir, secretKeyFilename)); err == nil {
+				previous = append(previous, key)
+			}
+		}
+	} else if dataDir != "" {
+		loaded, err := loadOrCreateSecretKey(filepath.Join(dataDir, secretKeyFilename))
+		if err != nil {
+			return nil, err
+		}
+		current = loaded
+	} else {
+		current = make([]byte, 32)
+		if _, err := rand.Read(current); err != nil {
+			return nil, fmt.Errorf("generate secret key: %w", err)
+		}
+	}
+
+	for _, raw := range strings.Split(os.Getenv(secretKeyPreviousEnv), ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		// 64 位十六进制既可能是旧 secret.key 的内容，也可能是用作 SECRET_KEY 的随机串，两种都尝试
+		if key, err := hex.DecodeString(raw); err == nil && len(key) == 32 {
+			previous = append(previous, key)
+		}
+		previous = append(previous, deriveSecretKey(raw))
+	}
+
+	return newSecretBox(current, previous...)
+}
+
+func newSecretBox(current []byte, previous ...[]byte) (*secretBox, error) {
+	box := &secretBox{}
+	for _, key := range append([][]byte{current}, previous...) {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("create secret cipher: %w", err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("create secret cipher: %w", err)
+		}
+		id := secretKeyID(key)
+		if box.key(id) == nil {
+			box.keys = append(box.keys, secretKey{id: id, aead: aead})
+		}
+	}
+	return box, nil
+}
+
+// deriveSecretKey turns a SECRET_KEY value of any length into an AES-256 key.
+func deriveSecretKey(value string) []byte {
+	sum := sha256.Sum256([]byte(value))
+	return sum[:]
+}
+
+// secretKeyID identifies a key without revealing it.
+func secretKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+func (b *secretBox) key(id string) *secretKey {
+	for i := range b.keys {
+		if b.keys[i].id == id {
+			return &b.keys[i]
+		}
+	}
+	return nil
+}
+
+func readSecretKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read secret key: %w", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("invalid secret key file %s", path)
+	}
+	return key, nil
+}
+
+func loadOrCreateSecretKey(path string) ([]byte, error) {
+	key, err := readSecretKeyFile(path)
+	if err == nil {
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate secret key: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0o600); err != nil {
+		return nil, fmt.Errorf("write secret key: %w", err)
+	}
+	return key, nil
+}
+
+// Seal encrypts plaintext with the current key; an empty plaintext stays empty so "no secret" needs no key.
+func (b *secretBox) Seal(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	current := b.keys[0]
+	nonce := make([]byte, current.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+
+	sealed := current.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return secretBoxPrefixV2 + current.id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value produced by Seal with the current or a previous key.
+func (b *secretBox) Open(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	if rest, ok := strings.CutPrefix(value, secretBoxPrefixV2); ok {
+		id, encoded, ok := strings.Cut(rest, ":")
+		if !ok {
+			return "", errors.New("unsupported secret format")
+		}
+		key := b.key(id)
+		if key == nil {
+			return "", fmt.Errorf("secret was sealed with unknown key %s, add the old key to %s", id, secretKeyPreviousEnv)
+		}
+		return key.open(encoded)
+	}
+
+	encoded, ok := strings.CutPrefix(value, secretBoxPrefixV1)
+	if !ok {
+		return "", errors.New("unsupported secret format")
+	}
+	var err error
+	for _, key := range b.keys {
+		var plaintext string
+		if plaintext, err = key.open(encoded); err == nil {
+			return plaintext, nil
+		}
+	}
+	return "", err
+}
+
+// needsReseal reports whether a stored value was sealed by anything other than the current key.
+func (b *secretBox) needsReseal(value string) bool {
+	return strings.HasPrefix(value, secretBoxPrefix) && !strings.HasPrefix(value, secretBoxPrefixV2+b.keys[0].id+":")
+}
+
+func (k *secretKey) open(encoded string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("decode secret: %w", err)
+	}
+	if len(sealed) < k.aead.NonceSize() {
+		return "", errors.New("secret is too short")
+	}
+
+	nonce, ciphertext := sealed[:k.aead.NonceSize()], sealed[k.aead.NonceSize():]
+	plaintext, err := k.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret: %w", err)
+	}
+	return string(plaintext), nil
+}
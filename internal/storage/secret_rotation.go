@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// sealedSecretColumns lists every column holding a value sealed by secretBox. Each table is keyed by id.
+var sealedSecretColumns = []struct {
+	table  string
+	column string
+}{
+	{"cdn_settings", "api_token"},
+	{"content_signing_key", "private_key"},
+	{"dns_credentials", "secret"},
+	{"federation_upstream", "token"},
+	{"ldap_settings", "bind_password"},
+	{"node_deployments", "credential"},
+	{"probe_configs", "credentials"},
+	{"smtp_settings", "password"},
+	{"webhooks", "secret"},
+}
+
+// ReencryptSecrets re-seals every stored secret that was not sealed with the current key, so the
+// previous key can be removed from SECRET_KEY_PREVIOUS once it has run. It backs the rotate-secrets
+// maintenance command, which can run while the panel keeps serving. Secrets that no configured key
+// can open are left untouched and reported as unreadable.
+func (r *TrafficRepository) ReencryptSecrets(ctx context.Context) (reencrypted, unreadable int, err error) {
+	if r == nil || r.db == nil {
+		return 0, 0, errors.New("traffic repository not initialized")
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("begin reencrypt secrets: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	type sealedValue struct {
+		id    int64
+		value string
+	}
+	for _, col := range sealedSecretColumns {
+		rows, err := tx.QueryContext(ctx, `SELECT id, `+col.column+` FROM `+col.table+` WHERE `+col.column+` LIKE ?`, secretBoxPrefix+"%")
+		if err != nil {
+			return 0, 0, fmt.Errorf("list sealed %s.%s: %w", col.table, col.column, err)
+		}
+		var stale []sealedValue
+		for rows.Next() {
+			var v sealedValue
+			if err := rows.Scan(&v.id, &v.value); err != nil {
+				rows.Close()
+				return 0, 0, fmt.Errorf("scan sealed %s.%s: %w", col.table, col.column, err)
+			}
+			if r.secrets.needsReseal(v.value) {
+				stale = append(stale, v)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("iterate sealed %s.%s: %w", col.table, col.column, err)
+		}
+		rows.Close()
+
+		for _, v := range stale {
+			plaintext, err := r.secrets.Open(v.value)
+			if err != nil {
+				unreadable++
+				continue
+			}
+			sealed, err := r.secrets.Seal(plaintext)
+			if err != nil {
+				return 0, 0, err
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE `+col.table+` SET `+col.column+` = ? WHERE id = ?`, sealed, v.id); err != nil {
+				return 0, 0, fmt.Errorf("reencrypt %s.%s: %w", col.table, col.column, err)
+			}
+			reencrypted++
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("commit reencrypt secrets: %w", err)
+	}
+	return reencrypted, unreadable, nil
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var ErrServedSnapshotNotFound = errors.New("served snapshot not found")
+
+// servedSnapshotDayLayout 归档按天分组的日期格式
+const servedSnapshotDayLayout = "2006-01-02"
+
+// ServedSnapshot is the archived copy of a subscription served to a user on one day.
+// Content is only populated by GetServedSnapshot.
+type ServedSnapshot struct {
+	ID         int64
+	Username   string
+	Filename   string
+	ClientType string
+	Day        string // YYYY-MM-DD
+	SHA256     string
+	Size       int
+	Content    []byte
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// SaveServedSnapshot archives the served bytes for the day of now, replacing an earlier snapshot of
+// the same day only when the content changed. Snapshots older than retentionDays are pruned.
+func (r *TrafficRepository) SaveServedSnapshot(ctx context.Context, username, filename, clientType string, content []byte, now time.Time, retentionDays int) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	filename = strings.TrimSpace(filename)
+	if username == "" || filename == "" {
+		return errors.New("username and filename are required")
+	}
+	if retentionDays <= 0 {
+		return errors.New("retention days must be positive")
+	}
+
+	day := now.Format(servedSnapshotDayLayout)
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+
+	var existing string
+	err := r.db.QueryRowContext(ctx, `SELECT sha256 FROM served_snapshots WHERE username = ? AND filename = ? AND client_type = ? AND day = ?`, username, filename, clientType, day).Scan(&existing)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("query served snapshot: %w", err)
+	}
+	if existing == digest {
+		return nil
+	}
+
+	compressed, err := gzipBytes(content)
+	if err != nil {
+		return err
+	}
+
+	const stmt = `
+INSERT INTO served_snapshots (username, filename, client_type, day, sha256, size, content)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(username, filename, client_type, day) DO UPDATE SET
+    sha256 = excluded.sha256,
+    size = excluded.size,
+    content = excluded.content,
+    updated_at = CURRENT_TIMESTAMP
+`
+	if _, err := r.db.ExecContext(ctx, stmt, username, filename, clientType, day, digest, len(content), compressed); err != nil {
+		return fmt.Errorf("save served snapshot: %w", err)
+	}
+
+	cutoff := now.AddDate(0, 0, -retentionDays).Format(servedSnapshotDayLayout)
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM served_snapshots WHERE day <= ?`, cutoff); err != nil {
+		return fmt.Errorf("prune served snapshots: %w", err)
+	}
+
+	return nil
+}
+
+// ListServedSnapshots returns snapshot metadata, newest day first. Empty filters match everything.
+func (r *TrafficRepository) ListServedSnapshots(ctx context.Context, username, filename string, limit int) ([]ServedSnapshot, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+
+	query := `SELECT id, username, filename, client_type, day, sha256, size, created_at, updated_at FROM served_snapshots WHERE 1 = 1`
+	var args []any
+	if username = strings.TrimSpace(username); username != "" {
+		query += ` AND username = ?`
+		args = append(args, username)
+	}
+	if filename = strings.TrimSpace(filename); filename != "" {
+		query += ` AND filename = ?`
+		args = append(args, filename)
+	}
+	query += ` ORDER BY day DESC, username ASC, filename ASC, client_type ASC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list served snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []ServedSnapshot
+	for rows.Next() {
+		var snap ServedSnapshot
+		if err := rows.Scan(&snap.ID, &snap.Username, &snap.Filename, &snap.ClientType, &snap.Day, &snap.SHA256, &snap.Size, &snap.CreatedAt, &snap.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan served snapshot: %w", err)
+		}
+		snapshots = append(snapshots, snap)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate served snapshots: %w", err)
+	}
+	return snapshots, nil
+}
+
+// GetServedSnapshot returns a snapshot with its decompressed content.
+func (r *TrafficRepository) GetServedSnapshot(ctx context.Context, id int64) (ServedSnapshot, error) {
+	if r == nil || r.db == nil {
+		return ServedSnapshot{}, errors.New("traffic repository not initialized")
+	}
+
+	var (
+		snap       ServedSnapshot
+		compressed []byte
+	)
+	const query = `SELECT id, username, filename, client_type, day, sha256, size, content, created_at, updated_at FROM served_snapshots WHERE id = ?`
+	if err := r.db.QueryRowContext(ctx, query, id).Scan(&snap.ID, &snap.Username, &snap.Filename, &snap.ClientType, &snap.Day, &snap.SHA256, &snap.Size, &compressed, &snap.CreatedAt, &snap.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ServedSnapshot{}, ErrServedSnapshotNotFound
+		}
+		return ServedSnapshot{}, fmt.Errorf("get served snapshot: %w", err)
+	}
+
+	content, err := gunzipBytes(compressed)
+	if err != nil {
+		return ServedSnapshot{}, err
+	}
+	snap.Content = content
+	return snap, nil
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("gzip compress: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("gzip compress: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzipBytes(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("gzip decompress: %w", err)
+	}
+	defer zr.Close()
+	content, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("gzip decompress: %w", err)
+	}
+	return content, nil
+}
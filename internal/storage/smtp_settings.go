@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	SMTPEncryptionNone     = "none"
+	SMTPEncryptionSTARTTLS = "starttls"
+	SMTPEncryptionTLS      = "tls"
+)
+
+// SMTPSettings configures the outgoing mail server used for email notifications.
+type SMTPSettings struct {
+	Enabled     bool
+	Host        string
+	Port        int
+	Username    string
+	Password    string
+	FromAddress string
+	FromName    string
+	Encryption  string
+	UpdatedAt   time.Time
+}
+
+// GetSMTPSettings returns the SMTP settings; defaults are returned when none are saved.
+func (r *TrafficRepository) GetSMTPSettings(ctx context.Context) (SMTPSettings, error) {
+	if r == nil || r.db == nil {
+		return SMTPSettings{}, errors.New("traffic repository not initialized")
+	}
+
+	var settings SMTPSettings
+	var enabled int
+	var sealedPassword string
+	err := r.db.QueryRowContext(ctx, `SELECT enabled, host, port, username, password, from_address, from_name, encryption, updated_at FROM smtp_settings WHERE id = 1`).
+		Scan(&enabled, &settings.Host, &settings.Port, &settings.Username, &sealedPassword, &settings.FromAddress, &settings.FromName, &settings.Encryption, &settings.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return SMTPSettings{Port: 587, Encryption: SMTPEncryptionSTARTTLS}, nil
+	}
+	if err != nil {
+		return SMTPSettings{}, fmt.Errorf("get smtp settings: %w", err)
+	}
+
+	password, err := r.secrets.Open(sealedPassword)
+	if err != nil {
+		return SMTPSettings{}, fmt.Errorf("open smtp password: %w", err)
+	}
+	settings.Password = password
+	settings.Enabled = enabled != 0
+	return settings, nil
+}
+
+// UpdateSMTPSettings saves the SMTP settings.
+func (r *TrafficRepository) UpdateSMTPSettings(ctx context.Context, settings SMTPSettings) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	sealedPassword, err := r.secrets.Seal(settings.Password)
+	if err != nil {
+		return fmt.Errorf("seal smtp password: %w", err)
+	}
+
+	const stmt = `
+INSERT INTO smtp_settings (id, enabled, host, port, username, password, from_address, from_name, encryption, updated_at)
+VALUES (1, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(id) DO UPDATE SET
+    enabled = excluded.enabled,
+    host = excluded.host,
+    port = excluded.port,
+    username = excluded.username,
+    password = excluded.password,
+    from_address = excluded.from_address,
+    from_name = excluded.from_name,
+    encryption = excluded.encryption,
+    updated_at = CURRENT_TIMESTAMP;
+`
+	if _, err := r.db.ExecContext(ctx, stmt, boolToInt(settings.Enabled), strings.TrimSpace(settings.Host), settings.Port,
+		strings.TrimSpace(settings.Username), sealedPassword, strings.TrimSpace(settings.FromAddress), strings.TrimSpace(settings.FromName),
+		settings.Encryption); err != nil {
+		return fmt.Errorf("update smtp settings: %w", err)
+	}
+
+	return nil
+}
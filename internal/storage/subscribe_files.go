@@ -20,7 +20,7 @@ func (r *TrafficRepository) ListSubscribeFiles(ctx context.Context) ([]Subscribe
 		return nil, errors.New("traffic repository not initialized")
 	}
 
-	rows, err := r.db.QueryContext(ctx, `SELECT id, name, COALESCE(description, ''), url, type, filename, COALESCE(file_short_code, ''), COALESCE(auto_sync_custom_rules, 0), expire_at, created_at, updated_at FROM subscribe_files ORDER BY created_at DESC`)
+	rows, err := r.readQuery(ctx, `SELECT id, uuid, name, COALESCE(description, ''), url, type, filename, COALESCE(file_short_code, ''), COALESCE(auto_sync_custom_rules, 0), expire_at, COALESCE(cache_control, ''), COALESCE(default_target, ''), created_at, updated_at FROM subscribe_files ORDER BY created_at DESC`)
 	if err != nil {
 		return nil, fmt.Errorf("list subscribe files: %w", err)
 	}
@@ -31,7 +31,7 @@ func (r *TrafficRepository) ListSubscribeFiles(ctx context.Context) ([]Subscribe
 		var file SubscribeFile
 		var autoSync int
 		var expireAt sql.NullTime
-		if err := rows.Scan(&file.ID, &file.Name, &file.Description, &file.URL, &file.Type, &file.Filename, &file.FileShortCode, &autoSync, &expireAt, &file.CreatedAt, &file.UpdatedAt); err != nil {
+		if err := rows.Scan(&file.ID, &file.UUID, &file.Name, &file.Description, &file.URL, &file.Type, &file.Filename, &file.FileShortCode, &autoSync, &expireAt, &file.CacheControl, &file.DefaultTarget, &file.CreatedAt, &file.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("scan subscribe file: %w", err)
 		}
 		file.AutoSyncCustomRules = autoSync != 0
@@ -59,10 +59,10 @@ func (r *TrafficRepository) GetSubscribeFileByID(ctx context.Context, id int64)
 		return file, errors.New("subscribe file id is required")
 	}
 
-	row := r.db.QueryRowContext(ctx, `SELECT id, name, COALESCE(description, ''), url, type, filename, COALESCE(file_short_code, ''), COALESCE(auto_sync_custom_rules, 0), expire_at, created_at, updated_at FROM subscribe_files WHERE id = ? LIMIT 1`, id)
+	row := r.db.QueryRowContext(ctx, `SELECT id, uuid, name, COALESCE(description, ''), url, type, filename, COALESCE(file_short_code, ''), COALESCE(auto_sync_custom_rules, 0), expire_at, COALESCE(cache_control, ''), COALESCE(default_target, ''), created_at, updated_at FROM subscribe_files WHERE id = ? LIMIT 1`, id)
 	var autoSync int
 	var expireAt sql.NullTime
-	if err := row.Scan(&file.ID, &file.Name, &file.Description, &file.URL, &file.Type, &file.Filename, &file.FileShortCode, &autoSync, &expireAt, &file.CreatedAt, &file.UpdatedAt); err != nil {
+	if err := row.Scan(&file.ID, &file.UUID, &file.Name, &file.Description, &file.URL, &file.Type, &file.Filename, &file.FileShortCode, &autoSync, &expireAt, &file.CacheControl, &file.DefaultTarget, &file.CreatedAt, &file.UpdatedAt); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return file, ErrSubscribeFileNotFound
 		}
@@ -88,10 +88,10 @@ func (r *TrafficRepository) GetSubscribeFileByName(ctx context.Context, name str
 		return file, errors.New("subscribe file name is required")
 	}
 
-	row := r.db.QueryRowContext(ctx, `SELECT id, name, COALESCE(description, ''), url, type, filename, COALESCE(file_short_code, ''), COALESCE(auto_sync_custom_rules, 0), expire_at, created_at, updated_at FROM subscribe_files WHERE name = ? LIMIT 1`, name)
+	row := r.db.QueryRowContext(ctx, `SELECT id, uuid, name, COALESCE(description, ''), url, type, filename, COALESCE(file_short_code, ''), COALESCE(auto_sync_custom_rules, 0), expire_at, COALESCE(cache_control, ''), COALESCE(default_target, ''), created_at, updated_at FROM subscribe_files WHERE name = ? LIMIT 1`, name)
 	var autoSync int
 	var expireAt sql.NullTime
-	if err := row.Scan(&file.ID, &file.Name, &file.Description, &file.URL, &file.Type, &file.Filename, &file.FileShortCode, &autoSync, &expireAt, &file.CreatedAt, &file.UpdatedAt); err != nil {
+	if err := row.Scan(&file.ID, &file.UUID, &file.Name, &file.Description, &file.URL, &file.Type, &file.Filename, &file.FileShortCode, &autoSync, &expireAt, &file.CacheControl, &file.DefaultTarget, &file.CreatedAt, &file.UpdatedAt); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return file, ErrSubscribeFileNotFound
 		}
@@ -117,10 +117,10 @@ func (r *TrafficRepository) GetSubscribeFileByFilename(ctx context.Context, file
 		return file, errors.New("subscribe file filename is required")
 	}
 
-	row := r.db.QueryRowContext(ctx, `SELECT id, name, COALESCE(description, ''), url, type, filename, COALESCE(file_short_code, ''), COALESCE(auto_sync_custom_rules, 0), expire_at, created_at, updated_at FROM subscribe_files WHERE filename = ? LIMIT 1`, filename)
+	row := r.readQueryRow(ctx, `SELECT id, uuid, name, COALESCE(description, ''), url, type, filename, COALESCE(file_short_code, ''), COALESCE(auto_sync_custom_rules, 0), expire_at, COALESCE(cache_control, ''), COALESCE(default_target, ''), created_at, updated_at FROM subscribe_files WHERE filename = ? LIMIT 1`, filename)
 	var autoSync int
 	var expireAt sql.NullTime
-	if err := row.Scan(&file.ID, &file.Name, &file.Description, &file.URL, &file.Type, &file.Filename, &file.FileShortCode, &autoSync, &expireAt, &file.CreatedAt, &file.UpdatedAt); err != nil {
+	if err := row.Scan(&file.ID, &file.UUID, &file.Name, &file.Description, &file.URL, &file.Type, &file.Filename, &file.FileShortCode, &autoSync, &expireAt, &file.CacheControl, &file.DefaultTarget, &file.CreatedAt, &file.UpdatedAt); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return file, ErrSubscribeFileNotFound
 		}
@@ -166,6 +166,10 @@ func (r *TrafficRepository) CreateSubscribeFile(ctx context.Context, file Subscr
 	if file.ExpireAt != nil {
 		expireAt = *file.ExpireAt
 	}
+	publicUUID, err := publicID(file.UUID)
+	if err != nil {
+		return SubscribeFile{}, err
+	}
 	for i := 0; i < maxRetries; i++ {
 		newFileShortCode, err := generateFileShortCode()
 		if err != nil {
@@ -173,8 +177,8 @@ func (r *TrafficRepository) CreateSubscribeFile(ctx context.Context, file Subscr
 		}
 
 		// Default auto_sync_custom_rules to 1 (enabled) for new subscribe files
-		res, err := r.db.ExecContext(ctx, `INSERT INTO subscribe_files (name, description, url, type, filename, file_short_code, auto_sync_custom_rules, expire_at) VALUES (?, ?, ?, ?, ?, ?, 1, ?)`,
-			file.Name, file.Description, file.URL, file.Type, file.Filename, newFileShortCode, expireAt)
+		res, err := r.db.ExecContext(ctx, `INSERT INTO subscribe_files (uuid, name, description, url, type, filename, file_short_code, auto_sync_custom_rules, expire_at) VALUES (?, ?, ?, ?, ?, ?, ?, 1, ?)`,
+			publicUUID, file.Name, file.Description, file.URL, file.Type, file.Filename, newFileShortCode, expireAt)
 		if err != nil {
 			if strings.Contains(strings.ToLower(err.Error()), "unique") && strings.Contains(strings.ToLower(err.Error()), "file_short_code") {
 				// File short code collision, retry
@@ -235,8 +239,8 @@ func (r *TrafficRepository) UpdateSubscribeFile(ctx context.Context, file Subscr
 	if file.ExpireAt != nil {
 		expireAt = *file.ExpireAt
 	}
-	res, err := r.db.ExecContext(ctx, `UPDATE subscribe_files SET name = ?, description = ?, url = ?, type = ?, filename = ?, auto_sync_custom_rules = ?, expire_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
-		file.Name, file.Description, file.URL, file.Type, file.Filename, autoSyncInt, expireAt, file.ID)
+	res, err := r.db.ExecContext(ctx, `UPDATE subscribe_files SET name = ?, description = ?, url = ?, type = ?, filename = ?, auto_sync_custom_rules = ?, expire_at = ?, cache_control = ?, default_target = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		file.Name, file.Description, file.URL, file.Type, file.Filename, autoSyncInt, expireAt, strings.TrimSpace(file.CacheControl), strings.TrimSpace(file.DefaultTarget), file.ID)
 	if err != nil {
 		if strings.Contains(strings.ToLower(err.Error()), "unique") {
 			return SubscribeFile{}, ErrSubscribeFileExists
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SubscriptionClientIP records that a user's subscription was fetched from an IP address.
+type SubscriptionClientIP struct {
+	Username    string
+	IP          string
+	Pulls       int64
+	FirstSeenAt time.Time
+	LastSeenAt  time.Time
+}
+
+// RecordSubscriptionClientIP adds pulls subscription fetches of username from ip, the latest at the given time.
+func (r *TrafficRepository) RecordSubscriptionClientIP(ctx context.Context, username, ip string, pulls int64, at time.Time) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	ip = strings.TrimSpace(ip)
+	if username == "" || ip == "" || pulls <= 0 {
+		return nil
+	}
+
+	const stmt = `
+INSERT INTO subscription_client_ips (username, ip, pulls, first_seen_at, last_seen_at)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(username, ip) DO UPDATE SET pulls = pulls + excluded.pulls, last_seen_at = MAX(last_seen_at, excluded.last_seen_at)
+`
+	at = at.UTC()
+	if _, err := r.db.ExecContext(ctx, stmt, username, ip, pulls, at, at); err != nil {
+		return fmt.Errorf("record subscription client ip: %w", err)
+	}
+	return nil
+}
+
+// ListSubscriptionClientIPsByIP returns the users whose subscriptions were fetched from ip since the
+// given time, most recently seen first.
+func (r *TrafficRepository) ListSubscriptionClientIPsByIP(ctx context.Context, ip string, since time.Time) ([]SubscriptionClientIP, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+SELECT username, ip, pulls, first_seen_at, last_seen_at
+FROM subscription_client_ips
+WHERE ip = ? AND last_seen_at >= ?
+ORDER BY last_seen_at DESC, username ASC`, strings.TrimSpace(ip), since.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("list subscription client ips: %w", err)
+	}
+	defer rows.Close()
+
+	var clients []SubscriptionClientIP
+	for rows.Next() {
+		var c SubscriptionClientIP
+		if err := rows.Scan(&c.Username, &c.IP, &c.Pulls, &c.FirstSeenAt, &c.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("scan subscription client ip: %w", err)
+		}
+		clients = append(clients, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate subscription client ips: %w", err)
+	}
+	return clients, nil
+}
+
+// PruneSubscriptionClientIPs deletes IPs not seen since before and reports how many rows were removed.
+func (r *TrafficRepository) PruneSubscriptionClientIPs(ctx context.Context, before time.Time) (int64, error) {
+	if r == nil || r.db == nil {
+		return 0, errors.New("traffic repository not initialized")
+	}
+
+	res, err := r.db.ExecContext(ctx, `DELETE FROM subscription_client_ips WHERE last_seen_at < ?`, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("prune subscription client ips: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("prune subscription client ips rows affected: %w", err)
+	}
+	return affected, nil
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// subscriptionPullHourLayout 拉取次数按 UTC 小时聚合的时间格式
+const subscriptionPullHourLayout = "2006-01-02 15:00"
+
+// SubscriptionPullCount is the number of times one user fetched one subscription file with one client
+// type during an hour (UTC).
+type SubscriptionPullCount struct {
+	Hour       time.Time
+	Username   string
+	Filename   string
+	ClientType string
+	Count      int64
+}
+
+// RecordSubscriptionPull counts one subscription fetch in the hour of at.
+func (r *TrafficRepository) RecordSubscriptionPull(ctx context.Context, username, filename, clientType string, at time.Time) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	const stmt = `
+INSERT INTO subscription_pulls (hour, username, filename, client_type, count)
+VALUES (?, ?, ?, ?, 1)
+ON CONFLICT(hour, username, filename, client_type) DO UPDATE SET count = count + 1
+`
+	hour := at.UTC().Format(subscriptionPullHourLayout)
+	if _, err := r.db.ExecContext(ctx, stmt, hour, strings.TrimSpace(username), strings.TrimSpace(filename), strings.TrimSpace(clientType)); err != nil {
+		return fmt.Errorf("record subscription pull: %w", err)
+	}
+	return nil
+}
+
+// ListSubscriptionPulls returns the pull counts of the hours that overlap [from, to), oldest first.
+func (r *TrafficRepository) ListSubscriptionPulls(ctx context.Context, from, to time.Time) ([]SubscriptionPullCount, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+SELECT hour, username, filename, client_type, count
+FROM subscription_pulls
+WHERE hour >= ? AND hour <= ?
+ORDER BY hour ASC, username ASC, filename ASC, client_type ASC`,
+		from.UTC().Truncate(time.Hour).Format(subscriptionPullHourLayout), to.UTC().Add(-time.Nanosecond).Format(subscriptionPullHourLayout))
+	if err != nil {
+		return nil, fmt.Errorf("list subscription pulls: %w", err)
+	}
+	defer rows.Close()
+
+	var pulls []SubscriptionPullCount
+	for rows.Next() {
+		var pull SubscriptionPullCount
+		var hour string
+		if err := rows.Scan(&hour, &pull.Username, &pull.Filename, &pull.ClientType, &pull.Count); err != nil {
+			return nil, fmt.Errorf("scan subscription pull: %w", err)
+		}
+		parsed, err := time.Parse(subscriptionPullHourLayout, hour)
+		if err != nil {
+			return nil, fmt.Errorf("parse subscription pull hour: %w", err)
+		}
+		pull.Hour = parsed
+		pulls = append(pulls, pull)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate subscription pulls: %w", err)
+	}
+	return pulls, nil
+}
+
+// PruneSubscriptionPulls deletes pull counts older than before and reports how many rows were removed.
+func (r *TrafficRepository) PruneSubscriptionPulls(ctx context.Context, before time.Time) (int64, error) {
+	if r == nil || r.db == nil {
+		return 0, errors.New("traffic repository not initialized")
+	}
+
+	res, err := r.db.ExecContext(ctx, `DELETE FROM subscription_pulls WHERE hour < ?`, before.UTC().Format(subscriptionPullHourLayout))
+	if err != nil {
+		return 0, fmt.Errorf("prune subscription pulls: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("prune subscription pulls rows affected: %w", err)
+	}
+	return affected, nil
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -41,7 +42,14 @@ type TrafficRecord struct {
 
 // TrafficRepository manages persistence of traffic usage snapshots.
 type TrafficRepository struct {
-	db *sql.DB
+	db      *sql.DB
+	secrets *secretBox
+
+	// readPool 主库文件上的只读连接池，读多的列表和订阅查询走这里，写入始终走 db
+	readPool atomic.Pointer[readPool]
+
+	// migrationLock 启动迁移期间持有的迁移锁，迁移结束后为 nil
+	migrationLock *migrationLock
 }
 
 // SubscriptionLink represents a configurable subscription entry exposed to clients.
@@ -128,7 +136,7 @@ func scanSubscriptionLink(scanner rowScanner) (SubscriptionLink, error) {
 
 func scanProbeConfig(scanner rowScanner) (ProbeConfig, error) {
 	var cfg ProbeConfig
-	if err := scanner.Scan(&cfg.ID, &cfg.ProbeType, &cfg.Address, &cfg.CreatedAt, &cfg.UpdatedAt); err != nil {
+	if err := scanner.Scan(&cfg.ID, &cfg.Name, &cfg.ProbeType, &cfg.Address, &cfg.sealedCredentials, &cfg.CreatedAt, &cfg.UpdatedAt); err != nil {
 		return ProbeConfig{}, err
 	}
 	return cfg, nil
@@ -136,7 +144,7 @@ func scanProbeConfig(scanner rowScanner) (ProbeConfig, error) {
 
 func scanProbeServer(scanner rowScanner) (ProbeServer, error) {
 	var srv ProbeServer
-	if err := scanner.Scan(&srv.ID, &srv.ConfigID, &srv.ServerID, &srv.Name, &srv.TrafficMethod, &srv.MonthlyTrafficBytes, &srv.Position, &srv.CreatedAt, &srv.UpdatedAt); err != nil {
+	if err := scanner.Scan(&srv.ID, &srv.ConfigID, &srv.ServerID, &srv.Name, &srv.TrafficMethod, &srv.MonthlyTrafficBytes, &srv.TrafficMultiplier, &srv.IncludeInTotal, &srv.ResetDay, &srv.ResetTimezone, &srv.Position, &srv.CreatedAt, &srv.UpdatedAt); err != nil {
 		return ProbeServer{}, err
 	}
 	return srv, nil
@@ -145,11 +153,15 @@ func scanProbeServer(scanner rowScanner) (ProbeServer, error) {
 var (
 	ErrTokenNotFound                = errors.New("token not found")
 	ErrUserNotFound                 = errors.New("user not found")
+	ErrUserExpired                  = errors.New("user account expired")
 	ErrUserExists                   = errors.New("user already exists")
 	ErrRuleVersionNotFound          = errors.New("rule version not found")
 	ErrSubscriptionNotFound         = errors.New("subscription link not found")
 	ErrSubscriptionExists           = errors.New("subscription link already exists")
 	ErrProbeConfigNotFound          = errors.New("probe configuration not found")
+	ErrProbeServerNotFound          = errors.New("probe server not found")
+	ErrTrafficAlertRuleNotFound     = errors.New("traffic alert rule not found")
+	ErrNodeTagRuleNotFound          = errors.New("node tag rule not found")
 	ErrNodeNotFound                 = errors.New("node not found")
 	ErrSubscribeFileNotFound        = errors.New("subscribe file not found")
 	ErrSubscribeFileExists          = errors.New("subscribe file already exists")
@@ -172,23 +184,52 @@ var (
 )
 
 const (
-	ProbeTypeNezha   = "nezha"
-	ProbeTypeNezhaV0 = "nezhav0"
-	ProbeTypeDstatus = "dstatus"
-	ProbeTypeKomari  = "komari"
-
-	TrafficMethodUp   = "up"
-	TrafficMethodDown = "down"
-	TrafficMethodBoth = "both"
+	ProbeTypeNezha      = "nezha"
+	ProbeTypeNezhaV0    = "nezhav0"
+	ProbeTypeDstatus    = "dstatus"
+	ProbeTypeKomari     = "komari"
+	ProbeTypeUptimeKuma = "uptimekuma" // 仅提供在线状态，不提供流量数据
+
+	TrafficMethodUp            = "up"
+	TrafficMethodDown          = "down"
+	TrafficMethodBoth          = "both"
+	TrafficMethodMax           = "max"            // max(up, down)
+	TrafficMethodSumMultiplier = "sum_multiplier" // (up + down) * multiplier
+
+	TrafficUnitBinary  = "binary"  // 1 GB = 1024^3 bytes
+	TrafficUnitDecimal = "decimal" // 1 GB = 1000^3 bytes
+
+	ContentSigningHeader  = "header"  // detached signature in response headers
+	ContentSigningComment = "comment" // signature appended as a trailing "#" comment (YAML output only)
 )
 
 type ProbeConfig struct {
-	ID        int64
-	ProbeType string
-	Address   string
-	Servers   []ProbeServer
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID          int64
+	Name        string
+	ProbeType   string
+	Address     string
+	Credentials ProbeCredentials // Stored encrypted; empty for public panels
+	Servers     []ProbeServer
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+
+	// CredentialsUnreadable is set when stored credentials could not be decrypted with the current key
+	CredentialsUnreadable bool
+
+	sealedCredentials string
+}
+
+// ProbeCredentials authenticate collector requests against private probe panels.
+// Token is sent as a bearer token; Username/Password are used for panel login or HTTP basic auth.
+type ProbeCredentials struct {
+	Token    string `json:"token,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// IsZero reports whether no credentials are configured.
+func (c ProbeCredentials) IsZero() bool {
+	return c.Token == "" && c.Username == "" && c.Password == ""
 }
 
 type ProbeServer struct {
@@ -198,6 +239,10 @@ type ProbeServer struct {
 	Name                string
 	TrafficMethod       string
 	MonthlyTrafficBytes int64
+	TrafficMultiplier   float64 // Multiplier applied by the sum_multiplier traffic method
+	IncludeInTotal      bool    // Whether this server counts toward the global traffic totals
+	ResetDay            int     // Day of month the provider resets traffic (1-31); 0 means the probe counter is used as-is
+	ResetTimezone       string  // IANA timezone for ResetDay; empty means the server's local timezone
 	Position            int
 	CreatedAt           time.Time
 	UpdatedAt           time.Time
@@ -205,24 +250,30 @@ type ProbeServer struct {
 
 // Node represents a proxy node stored in the database.
 type Node struct {
-	ID             int64
-	Username       string
-	RawURL         string
-	NodeName       string
-	Protocol       string
-	ParsedConfig   string
-	ClashConfig    string
-	Enabled        bool
-	Tag            string
-	OriginalServer string
-	ProbeServer    string // Probe server name for binding
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
+	ID               int64
+	UUID             string // Stable public ID, kept across export/import
+	Username         string
+	RawURL           string
+	NodeName         string
+	Protocol         string
+	ParsedConfig     string
+	ClashConfig      string
+	Enabled          bool
+	Tag              string
+	OriginalServer   string
+	ProbeServer      string            // Probe server name for binding
+	ProbeAnnotations map[string]string // Metadata (location, price...) synced from the bound probe server; read-only
+	CustomFields     map[string]any    // Extra proxy keys merged into the Clash output (options the parser doesn't know yet)
+	SourceURL        string            // Subscription URL the node was imported from; empty for manual input
+	ImportBatch      string            // ID shared by the nodes created in one batch import
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
 }
 
 // SubscribeFile represents a subscription file configuration.
 type SubscribeFile struct {
 	ID                   int64
+	UUID                 string // Stable public ID, kept across export/import
 	Name                 string
 	Description          string
 	URL                  string
@@ -231,6 +282,8 @@ type SubscribeFile struct {
 	FileShortCode        string // 3-character code for file identification in composite short links
 	AutoSyncCustomRules  bool   // Whether to automatically sync custom rules to this file
 	ExpireAt             *time.Time // Optional expiration timestamp
+	CacheControl         string     // Cache-Control sent with the served subscription; empty means "no-cache"
+	DefaultTarget        string     // Client type used when the subscription URL has no ?t=; empty serves the file as-is
 	CreatedAt            time.Time
 	UpdatedAt            time.Time
 }
@@ -245,6 +298,7 @@ type UserSettings struct {
 	CacheExpireMinutes   int    // Cache expiration time in minutes
 	SyncTraffic          bool   // Sync traffic info from external subscriptions
 	EnableProbeBinding   bool   // Enable probe server binding for nodes
+	AutoDisableOverQuota bool   // Disable nodes whose bound probe server exceeded its quota until the cycle resets
 	CustomRulesEnabled   bool   // Enable custom rules feature
 	EnableShortLink      bool   // Enable short link feature for subscriptions
 	UseNewTemplateSystem bool   // Use new template system (database-based), default true
@@ -253,6 +307,7 @@ type UserSettings struct {
 	DebugEnabled         bool      // Enable debug logging to file
 	DebugLogPath         string    // Path to current debug log file
 	DebugStartedAt       *time.Time // When debug logging was started
+	Preferences          UserPreferences // Generic UI/behavior preferences, written via UpdateUserPreferences
 	CreatedAt            time.Time
 	UpdatedAt            time.Time
 }
@@ -263,11 +318,49 @@ type SystemConfig struct {
 	ClientCompatibilityMode bool   // Auto-filter incompatible nodes for clients
 	SilentMode              bool   // Silent mode: return 404 for all requests except subscription
 	SilentModeTimeout       int    // Minutes to allow access after subscription fetch (default 15)
+	TrafficUnit             string // "binary" (GiB) or "decimal" (GB) for all reported traffic numbers
+	FetchProxy              string // Outbound HTTP/SOCKS5 proxy URL used when fetching external subscriptions
+	CollectorSchedule       string // Cron expression (5 fields) for the traffic collector; empty means daily at midnight
+	CollectorTimezone       string // IANA timezone for the collector schedule and the daily record rollover; empty means UTC
+	CollectorConcurrency    int    // Probe panels fetched in parallel by the traffic collector; 0 means the default
+	CollectorPanelInterval  int    // Minimum milliseconds between requests to the same probe panel during collection; 0 disables the limit
+	ContentSigning          string // "" (off), "header" or "comment": how generated configs are signed with the instance key
+	LiveTraffic             bool   // Stream live server stats from Nezha panels over WebSocket for /api/traffic/live
+	QuotaWarningPercent     int    // Inject a warning node into subscriptions once this share of the quota is used; 0 disables
+	ExpiryWarningDays       int    // Inject a warning node into subscriptions this many days before expiry; 0 disables
+	StrictMode              bool   // Reject unknown ?t= targets and query parameters on subscription URLs instead of serving raw YAML
+	OpenRegistration        bool   // Allow sign-up without an invite code; such accounts stay inactive until an admin approves them
+	ProbeAlertToken         string // Shared secret for incoming Nezha/Komari alert webhooks (?token=); empty disables the endpoint
+	ProbeAlertExclude       bool   // Remove nodes bound to an alerting probe server from generated configs until the alert clears
+	SnapshotRetentionDays   int    // Archive the subscription bytes served to each user once per day and keep them this many days; 0 disables
+	NodeNameNormalize       bool   // Correlate node names through a normalized key (full-width to half-width, region names to codes) for matching, dedup and probe binding
+	NodeNameSimplify        bool   // Also fold traditional Chinese characters to simplified when normalizing node names
+	NodeNameStripEmoji      bool   // Also drop emoji (flags, symbols) when normalizing node names
+	GrafanaToken            string // Bearer token for the Grafana JSON datasource at /api/grafana; empty disables the endpoint
+	DefaultNodeTag          string // Tag given to new nodes that arrive without one and match no auto-tag rule; empty means "手动输入"
+	SlowThresholdMs         int    // Requests and database statements slower than this many milliseconds are logged as slow operations; 0 uses the default (500)
+	StalePullDays           int    // Notify admins when a subscription that was pulled almost daily has not been fetched for this many days; 0 disables
+	RuleCacheProxy          bool   // Rewrite rule-provider and geo database URLs in generated configs to the panel's caching mirror
+	GeoDataInterval         int    // Hours between scheduled updates of the panel-hosted GeoIP/GeoSite databases; 0 disables them
+
+	// OutputFormats overrides the content type / file extension of conversion targets, keyed by client type
+	OutputFormats map[string]OutputFormatOverride
+
+	// GroupNameTranslations overrides the built-in zh -> en dictionary used for users whose config
+	// language is English; an empty translation removes a built-in entry
+	GroupNameTranslations map[string]string
+}
+
+// OutputFormatOverride overrides how a conversion target is served; empty fields keep the built-in value.
+type OutputFormatOverride struct {
+	ContentType string `json:"content_type,omitempty"`
+	Extension   string `json:"extension,omitempty"`
 }
 
 // ExternalSubscription represents an external subscription URL imported by user.
 type ExternalSubscription struct {
 	ID          int64
+	UUID        string // Stable public ID, kept across export/import
 	Username    string
 	Name        string
 	URL         string
@@ -279,8 +372,15 @@ type ExternalSubscription struct {
 	Total       int64      // 总流量（字节）
 	Expire      *time.Time // 过期时间
 	TrafficMode string     // 流量统计方式: "download", "upload", "both"
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	// 节点重命名规则，每次同步时应用：先正则替换，再添加前缀/后缀
+	NamePrefix      string
+	NameSuffix      string
+	NameRegex       string
+	NameReplacement string
+	FetchProxy      string // 拉取订阅使用的代理，空表示使用全局设置，"direct" 表示直连
+	Headers         map[string]string // 拉取订阅时附加的请求头
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
 }
 
 // CustomRule represents a custom rule for DNS, rules, or rule-providers.
@@ -336,15 +436,18 @@ type ProxyProviderConfig struct {
 
 var (
 	allowedProbeTypes = map[string]struct{}{
-		ProbeTypeNezha:   {},
-		ProbeTypeNezhaV0: {},
-		ProbeTypeDstatus: {},
-		ProbeTypeKomari:  {},
+		ProbeTypeNezha:      {},
+		ProbeTypeNezhaV0:    {},
+		ProbeTypeDstatus:    {},
+		ProbeTypeKomari:     {},
+		ProbeTypeUptimeKuma: {},
 	}
 	allowedTrafficMethods = map[string]struct{}{
-		TrafficMethodUp:   {},
-		TrafficMethodDown: {},
-		TrafficMethodBoth: {},
+		TrafficMethodUp:            {},
+		TrafficMethodDown:          {},
+		TrafficMethodBoth:          {},
+		TrafficMethodMax:           {},
+		TrafficMethodSumMultiplier: {},
 	}
 )
 
@@ -360,7 +463,7 @@ func NewTrafficRepository(path string) (*TrafficRepository, error) {
 		}
 	}
 
-	db, err := sql.Open("sqlite", path)
+	db, err := sql.Open(instrumentedDriverName, path)
 	if err != nil {
 		return nil, fmt.Errorf("open sqlite db: %w", err)
 	}
@@ -372,8 +475,18 @@ func NewTrafficRepository(path string) (*TrafficRepository, error) {
 		return nil, fmt.Errorf("enable wal: %w", err)
 	}
 
-	repo := &TrafficRepository{db: db}
-	if err := repo.migrate(); err != nil {
+	secretsDir := ""
+	if path != ":memory:" && !strings.HasPrefix(path, "file:") {
+		secretsDir = filepath.Dir(path)
+	}
+	secrets, err := loadSecretBox(secretsDir)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	repo := &TrafficRepository{db: db, secrets: secrets}
+	if err := repo.runMigrations(); err != nil {
 		_ = db.Close()
 		return nil, err
 	}
@@ -386,6 +499,7 @@ func (r *TrafficRepository) Close() error {
 	if r == nil || r.db == nil {
 		return nil
 	}
+	r.readPool.Swap(nil).close()
 	return r.db.Close()
 }
 
@@ -502,6 +616,16 @@ CREATE TABLE IF NOT EXISTS users (
 		return err
 	}
 
+	// 账号到期时间，到期后订阅令牌失效并自动停用账号
+	if err := r.ensureUserColumn("expires_at", "TIMESTAMP"); err != nil {
+		return err
+	}
+
+	// 账号来源：local 使用本地密码，ldap 每次登录都到目录服务器验证
+	if err := r.ensureUserColumn("auth_source", "TEXT NOT NULL DEFAULT 'local'"); err != nil {
+		return err
+	}
+
 	const historySchema = `
 CREATE TABLE IF NOT EXISTS rule_versions (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -546,15 +670,21 @@ CREATE TABLE IF NOT EXISTS subscription_links (
 		return fmt.Errorf("create short_url index: %w", err)
 	}
 
-	// Migrate existing probe_configs table to add nezhav0 support BEFORE creating with IF NOT EXISTS
-	if err := r.migrateProbeConfigsForNezhaV0(); err != nil {
-		return fmt.Errorf("migrate probe_configs for nezhav0: %w", err)
+	// Migrate existing probe_configs table to accept new probe types (nezhav0, uptimekuma) BEFORE creating with IF NOT EXISTS
+	if err := r.migrateProbeConfigsProbeTypes(); err != nil {
+		return fmt.Errorf("migrate probe_configs probe types: %w", err)
+	}
+
+	// Drop the singleton constraint so several named probe configurations can coexist
+	if err := r.migrateProbeConfigsMultiple(); err != nil {
+		return fmt.Errorf("migrate probe_configs to multiple configs: %w", err)
 	}
 
 	const probeConfigSchema = `
 CREATE TABLE IF NOT EXISTS probe_configs (
-    id INTEGER PRIMARY KEY CHECK (id = 1),
-    probe_type TEXT NOT NULL CHECK (probe_type IN ('nezha','nezhav0','dstatus','komari')),
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL DEFAULT '',
+    probe_type TEXT NOT NULL CHECK (probe_type IN ('nezha','nezhav0','dstatus','komari','uptimekuma')),
     address TEXT NOT NULL,
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
@@ -565,13 +695,18 @@ CREATE TABLE IF NOT EXISTS probe_configs (
 		return fmt.Errorf("migrate probe_configs: %w", err)
 	}
 
+	// Add encrypted credentials column to probe_configs table (private probe panels)
+	if err := r.ensureProbeConfigColumn("credentials", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
 	const probeServersSchema = `
 CREATE TABLE IF NOT EXISTS probe_servers (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     config_id INTEGER NOT NULL,
     server_id TEXT NOT NULL,
     name TEXT NOT NULL,
-    traffic_method TEXT NOT NULL CHECK (traffic_method IN ('up','down','both')),
+    traffic_method TEXT NOT NULL CHECK (traffic_method IN ('up','down','both','max','sum_multiplier')),
     monthly_traffic_bytes INTEGER NOT NULL DEFAULT 0 CHECK (monthly_traffic_bytes >= 0),
     position INTEGER NOT NULL DEFAULT 0 CHECK (position >= 0),
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
@@ -585,6 +720,113 @@ CREATE TABLE IF NOT EXISTS probe_servers (
 		return fmt.Errorf("migrate probe_servers: %w", err)
 	}
 
+	// Add include_in_total column to probe_servers table (servers that are not proxy exits can be excluded)
+	if err := r.ensureProbeServerColumn("include_in_total", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+
+	// Add traffic_multiplier column to probe_servers table (used by the sum_multiplier method)
+	if err := r.ensureProbeServerColumn("traffic_multiplier", "REAL NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+
+	// Migrate existing probe_servers table to accept the max/sum_multiplier traffic methods
+	if err := r.migrateProbeServersTrafficMethods(); err != nil {
+		return fmt.Errorf("migrate probe_servers traffic methods: %w", err)
+	}
+
+	// Add billing cycle columns to probe_servers table (providers reset traffic on different days)
+	if err := r.ensureProbeServerColumn("reset_day", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := r.ensureProbeServerColumn("reset_timezone", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	// Per-server billing cycle baselines used to compute traffic used in the current cycle
+	const probeServerCyclesSchema = `
+CREATE TABLE IF NOT EXISTS probe_server_cycles (
+    config_id INTEGER NOT NULL,
+    server_id TEXT NOT NULL,
+    cycle_start TEXT NOT NULL,
+    baseline_bytes INTEGER NOT NULL DEFAULT 0,
+    carried_bytes INTEGER NOT NULL DEFAULT 0,
+    last_raw_bytes INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (config_id, server_id)
+);
+`
+	if _, err := r.db.Exec(probeServerCyclesSchema); err != nil {
+		return fmt.Errorf("migrate probe_server_cycles: %w", err)
+	}
+
+	// Traffic counters pushed by probe agents (used instead of pulling in air-gapped mode)
+	const probePushReportsSchema = `
+CREATE TABLE IF NOT EXISTS probe_push_reports (
+    config_id INTEGER NOT NULL,
+    server_id TEXT NOT NULL,
+    up_bytes INTEGER NOT NULL DEFAULT 0,
+    down_bytes INTEGER NOT NULL DEFAULT 0,
+    reported_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (config_id, server_id)
+);
+`
+	if _, err := r.db.Exec(probePushReportsSchema); err != nil {
+		return fmt.Errorf("migrate probe_push_reports: %w", err)
+	}
+
+	// Per-server daily traffic snapshots for charting each server's consumption
+	const probeServerTrafficDailySchema = `
+CREATE TABLE IF NOT EXISTS probe_server_traffic_daily (
+    config_id INTEGER NOT NULL,
+    server_id TEXT NOT NULL,
+    date TEXT NOT NULL,
+    used_bytes INTEGER NOT NULL DEFAULT 0,
+    limit_bytes INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (config_id, server_id, date)
+);
+`
+	if _, err := r.db.Exec(probeServerTrafficDailySchema); err != nil {
+		return fmt.Errorf("migrate probe_server_traffic_daily: %w", err)
+	}
+
+	// Traffic threshold alert rules, evaluated after each traffic collection
+	const trafficAlertRulesSchema = `
+CREATE TABLE IF NOT EXISTS traffic_alert_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL DEFAULT '',
+    threshold_percent REAL NOT NULL,
+    config_id INTEGER NOT NULL DEFAULT 0,
+    server_id TEXT NOT NULL DEFAULT '',
+    enabled INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+	if _, err := r.db.Exec(trafficAlertRulesSchema); err != nil {
+		return fmt.Errorf("migrate traffic_alert_rules: %w", err)
+	}
+
+	// Auto-tag rules applied to nodes imported through BatchCreateNodes
+	const nodeTagRulesSchema = `
+CREATE TABLE IF NOT EXISTS node_tag_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL DEFAULT '',
+    match_field TEXT NOT NULL,
+    pattern TEXT NOT NULL,
+    tag TEXT NOT NULL,
+    priority INTEGER NOT NULL DEFAULT 0,
+    override INTEGER NOT NULL DEFAULT 0,
+    enabled INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+	if _, err := r.db.Exec(nodeTagRulesSchema); err != nil {
+		return fmt.Errorf("migrate node_tag_rules: %w", err)
+	}
+
 	if err := r.ensureDefaultProbeConfig(); err != nil {
 		return err
 	}
@@ -627,10 +869,40 @@ CREATE INDEX IF NOT EXISTS idx_nodes_enabled ON nodes(enabled);
 		return err
 	}
 
+	// Add quota_disabled column: set when a node was disabled because its probe server exceeded its quota
+	if err := r.ensureNodeColumn("quota_disabled", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Add uuid column: stable public ID that survives export/import into another instance
+	if err := r.ensureNodeColumn("uuid", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := r.backfillPublicIDs("nodes"); err != nil {
+		return err
+	}
+
+	// Add custom_fields column: extra key/values merged into the node's Clash output
+	if err := r.ensureNodeColumn("custom_fields", "TEXT NOT NULL DEFAULT '{}'"); err != nil {
+		return err
+	}
+
+	// Add import source columns: the subscription URL and batch a node was imported with, kept
+	// independent of the user-editable tag
+	if err := r.ensureNodeColumn("source_url", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := r.ensureNodeColumn("import_batch", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
 	// Create tag index after ensuring column exists
 	if _, err := r.db.Exec(`CREATE INDEX IF NOT EXISTS idx_nodes_tag ON nodes(tag);`); err != nil {
 		return fmt.Errorf("create tag index: %w", err)
 	}
+	if _, err := r.db.Exec(`CREATE INDEX IF NOT EXISTS idx_nodes_import_source ON nodes(username, source_url, import_batch);`); err != nil {
+		return fmt.Errorf("create import source index: %w", err)
+	}
 
 	const subscribeFilesSchema = `
 CREATE TABLE IF NOT EXISTS subscribe_files (
@@ -755,6 +1027,30 @@ CREATE INDEX IF NOT EXISTS idx_external_subscriptions_url ON external_subscripti
 	if err := r.ensureExternalSubscriptionColumn("traffic_mode", "TEXT NOT NULL DEFAULT 'both'"); err != nil {
 		return err
 	}
+	if err := r.ensureExternalSubscriptionColumn("name_prefix", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := r.ensureExternalSubscriptionColumn("name_suffix", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := r.ensureExternalSubscriptionColumn("name_regex", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := r.ensureExternalSubscriptionColumn("name_replacement", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := r.ensureExternalSubscriptionColumn("fetch_proxy", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := r.ensureExternalSubscriptionColumn("request_headers", "TEXT NOT NULL DEFAULT '{}'"); err != nil {
+		return err
+	}
+	if err := r.ensureExternalSubscriptionColumn("uuid", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := r.backfillPublicIDs("external_subscriptions"); err != nil {
+		return err
+	}
 
 	// Add custom_rules_enabled to user_settings table
 	if err := r.ensureUserSettingsColumn("custom_rules_enabled", "INTEGER NOT NULL DEFAULT 0"); err != nil {
@@ -776,6 +1072,11 @@ CREATE INDEX IF NOT EXISTS idx_external_subscriptions_url ON external_subscripti
 		return err
 	}
 
+	// Add auto_disable_over_quota to user_settings table
+	if err := r.ensureUserSettingsColumn("auto_disable_over_quota", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
 	// Add node_order to user_settings table (JSON array of node IDs for display order)
 	if err := r.ensureUserSettingsColumn("node_order", "TEXT NOT NULL DEFAULT '[]'"); err != nil {
 		return err
@@ -792,6 +1093,11 @@ CREATE INDEX IF NOT EXISTS idx_external_subscriptions_url ON external_subscripti
 		return err
 	}
 
+	// Add preferences to user_settings table (generic JSON object of UI/behavior preferences)
+	if err := r.ensureUserSettingsColumn("preferences", "TEXT NOT NULL DEFAULT '{}'"); err != nil {
+		return err
+	}
+
 	// Add file_short_code column to subscribe_files table (3-character code)
 	if err := r.ensureSubscribeFileColumn("file_short_code", "TEXT NOT NULL DEFAULT ''"); err != nil {
 		return err
@@ -802,6 +1108,24 @@ CREATE INDEX IF NOT EXISTS idx_external_subscriptions_url ON external_subscripti
 		return err
 	}
 
+	// Add cache_control column to subscribe_files table (per-file CDN caching)
+	if err := r.ensureSubscribeFileColumn("cache_control", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	// Add default_target column to subscribe_files table (client type used when ?t= is missing)
+	if err := r.ensureSubscribeFileColumn("default_target", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	// Add uuid column to subscribe_files table (stable public ID)
+	if err := r.ensureSubscribeFileColumn("uuid", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := r.backfillPublicIDs("subscribe_files"); err != nil {
+		return err
+	}
+
 	// Create unique index for file_short_code in subscribe_files (only for non-empty values)
 	if _, err := r.db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_subscribe_files_file_short_code ON subscribe_files(file_short_code) WHERE file_short_code != '';`); err != nil {
 		return fmt.Errorf("create subscribe_files file_short_code index: %w", err)
@@ -850,130 +1174,931 @@ WHERE NOT EXISTS (SELECT 1 FROM system_config WHERE id = 1);
 		return err
 	}
 
-	const customRulesSchema = `
-CREATE TABLE IF NOT EXISTS custom_rules (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    name TEXT NOT NULL,
-    type TEXT NOT NULL CHECK (type IN ('dns','rules','rule-providers')),
-    mode TEXT NOT NULL CHECK (mode IN ('replace','prepend','append')),
-    content TEXT NOT NULL,
-    enabled INTEGER NOT NULL DEFAULT 1,
-    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    UNIQUE(name, type)
-);
-CREATE INDEX IF NOT EXISTS idx_custom_rules_type ON custom_rules(type);
-CREATE INDEX IF NOT EXISTS idx_custom_rules_enabled ON custom_rules(enabled);
-`
+	// Add traffic_unit column to system_config table (binary GiB by default)
+	if err := r.ensureSystemConfigColumn("traffic_unit", "TEXT NOT NULL DEFAULT 'binary'"); err != nil {
+		return err
+	}
 
-	if _, err := r.db.Exec(customRulesSchema); err != nil {
-		return fmt.Errorf("migrate custom_rules: %w", err)
+	// Add fetch_proxy column to system_config table (outbound proxy for subscription fetchers)
+	if err := r.ensureSystemConfigColumn("fetch_proxy", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
 	}
 
-	// Migrate existing custom_rules table to support 'append' mode
-	if err := r.migrateCustomRulesAppendMode(); err != nil {
-		return fmt.Errorf("migrate custom_rules append mode: %w", err)
+	// Add output_formats column to system_config table (per-target MIME/extension overrides, JSON)
+	if err := r.ensureSystemConfigColumn("output_formats", "TEXT NOT NULL DEFAULT '{}'"); err != nil {
+		return err
 	}
 
-	// Add auto_sync_custom_rules column to subscribe_files table
-	if err := r.ensureSubscribeFileColumn("auto_sync_custom_rules", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+	// Add traffic collector schedule columns to system_config table
+	if err := r.ensureSystemConfigColumn("collector_schedule", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := r.ensureSystemConfigColumn("collector_timezone", "TEXT NOT NULL DEFAULT ''"); err != nil {
 		return err
 	}
 
-	// Create custom_rule_applications table for tracking applied content
-	const customRuleApplicationsSchema = `
-CREATE TABLE IF NOT EXISTS custom_rule_applications (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    subscribe_file_id INTEGER NOT NULL,
-    custom_rule_id INTEGER NOT NULL,
-    rule_type TEXT NOT NULL,
-    rule_mode TEXT NOT NULL,
-    applied_content TEXT NOT NULL,
-    content_hash TEXT NOT NULL,
-    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (subscribe_file_id) REFERENCES subscribe_files(id) ON DELETE CASCADE,
-    FOREIGN KEY (custom_rule_id) REFERENCES custom_rules(id) ON DELETE CASCADE,
-    UNIQUE(subscribe_file_id, custom_rule_id, rule_type)
-);
-CREATE INDEX IF NOT EXISTS idx_custom_rule_applications_file ON custom_rule_applications(subscribe_file_id);
-CREATE INDEX IF NOT EXISTS idx_custom_rule_applications_rule ON custom_rule_applications(custom_rule_id);
-`
+	// Add content signing mode column to system_config table
+	if err := r.ensureSystemConfigColumn("content_signing", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
 
-	if _, err := r.db.Exec(customRuleApplicationsSchema); err != nil {
-		return fmt.Errorf("migrate custom_rule_applications: %w", err)
+	// Add live traffic streaming toggle to system_config table
+	if err := r.ensureSystemConfigColumn("live_traffic", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
 	}
 
-	// Templates table for ACL4SSR rule configuration
-	const templatesSchema = `
-CREATE TABLE IF NOT EXISTS templates (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    name TEXT NOT NULL,
-    category TEXT NOT NULL DEFAULT 'clash' CHECK (category IN ('clash','surge')),
-    template_url TEXT NOT NULL DEFAULT '',
-    rule_source TEXT NOT NULL DEFAULT '',
-    use_proxy INTEGER NOT NULL DEFAULT 0,
-    enable_include_all INTEGER NOT NULL DEFAULT 0,
-    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    UNIQUE(name)
-);
-CREATE INDEX IF NOT EXISTS idx_templates_category ON templates(category);
-`
+	// Add soft quota / expiry warning thresholds to system_config table
+	if err := r.ensureSystemConfigColumn("quota_warning_percent", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := r.ensureSystemConfigColumn("expiry_warning_days", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
 
-	if _, err := r.db.Exec(templatesSchema); err != nil {
-		return fmt.Errorf("migrate templates: %w", err)
+	// Add strict_mode to system_config table: reject unknown subscription targets / query parameters
+	if err := r.ensureSystemConfigColumn("strict_mode", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
 	}
 
-	// Proxy provider configs table
-	const proxyProviderConfigsSchema = `
-CREATE TABLE IF NOT EXISTS proxy_provider_configs (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    username TEXT NOT NULL,
-    external_subscription_id INTEGER NOT NULL,
-    name TEXT NOT NULL,
-    type TEXT NOT NULL DEFAULT 'http',
-    interval INTEGER DEFAULT 3600,
-    proxy TEXT DEFAULT 'DIRECT',
-    size_limit INTEGER DEFAULT 0,
-    header TEXT,
-    health_check_enabled INTEGER DEFAULT 1,
-    health_check_url TEXT DEFAULT 'https://www.gstatic.com/generate_204',
-    health_check_interval INTEGER DEFAULT 300,
-    health_check_timeout INTEGER DEFAULT 5000,
-    health_check_lazy INTEGER DEFAULT 1,
-    health_check_expected_status INTEGER DEFAULT 204,
-    filter TEXT,
-    exclude_filter TEXT,
-    exclude_type TEXT,
-    geo_ip_filter TEXT,
-    override TEXT,
-    process_mode TEXT DEFAULT 'client',
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (external_subscription_id) REFERENCES external_subscriptions(id) ON DELETE CASCADE
-);
-CREATE INDEX IF NOT EXISTS idx_proxy_provider_configs_username ON proxy_provider_configs(username);
-CREATE INDEX IF NOT EXISTS idx_proxy_provider_configs_external_subscription_id ON proxy_provider_configs(external_subscription_id);
-`
-	if _, err := r.db.Exec(proxyProviderConfigsSchema); err != nil {
-		return fmt.Errorf("migrate proxy_provider_configs: %w", err)
+	// Add open_registration to system_config table: sign-up without invite code, pending admin approval
+	if err := r.ensureSystemConfigColumn("open_registration", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
 	}
 
-	// 添加 geo_ip_filter 列（为旧数据库迁移）
-	if err := r.ensureProxyProviderConfigColumn("geo_ip_filter", "TEXT"); err != nil {
-		return fmt.Errorf("ensure geo_ip_filter column: %w", err)
+	// 探针告警 Webhook 的共享密钥，为空时不接收告警
+	if err := r.ensureSystemConfigColumn("probe_alert_token", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
 	}
 
-	return nil
-}
+	// 告警中的探针服务器绑定的节点是否从订阅中移除
+	if err := r.ensureSystemConfigColumn("probe_alert_exclude", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
 
-// ListSubscriptionLinks returns all configured subscription links ordered by creation.
-func (r *TrafficRepository) ListSubscriptionLinks(ctx context.Context) ([]SubscriptionLink, error) {
+	// 每日归档下发给用户的订阅内容，保留天数，0 表示不归档
+	if err := r.ensureSystemConfigColumn("snapshot_retention_days", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// 节点名称规范化匹配
+	if err := r.ensureSystemConfigColumn("node_name_normalize", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// 节点名称规范化时繁体转简体
+	if err := r.ensureSystemConfigColumn("node_name_simplify", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// 节点名称规范化时去除 emoji
+	if err := r.ensureSystemConfigColumn("node_name_strip_emoji", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// 流量收集器并发数
+	if err := r.ensureSystemConfigColumn("collector_concurrency", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// 流量收集器单个探针面板的请求间隔（毫秒）
+	if err := r.ensureSystemConfigColumn("collector_panel_interval_ms", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Grafana JSON 数据源的访问令牌
+	if err := r.ensureSystemConfigColumn("grafana_token", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	// 新节点的默认标签
+	if err := r.ensureSystemConfigColumn("default_node_tag", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	// 慢操作日志阈值（毫秒），0 表示使用默认值
+	if err := r.ensureSystemConfigColumn("slow_threshold_ms", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// 订阅长时间未拉取提醒的天数，0 表示关闭
+	if err := r.ensureSystemConfigColumn("stale_pull_days", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// 规则集缓存代理：生成的配置中规则集与地理数据库改为从面板镜像下载
+	if err := r.ensureSystemConfigColumn("rule_cache_proxy", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// 面板托管地理数据库的更新间隔（小时），0 表示关闭
+	if err := r.ensureSystemConfigColumn("geo_data_interval", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// 代理组名称中英文词典的管理员覆盖项（JSON）
+	if err := r.ensureSystemConfigColumn("group_name_translations", "TEXT NOT NULL DEFAULT '{}'"); err != nil {
+		return err
+	}
+
+	// Instance key used to sign generated configs (single row, private key sealed with the secret box)
+	const contentSigningKeySchema = `
+CREATE TABLE IF NOT EXISTS content_signing_key (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    private_key TEXT NOT NULL,
+    public_key TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+	if _, err := r.db.Exec(contentSigningKeySchema); err != nil {
+		return fmt.Errorf("migrate content_signing_key: %w", err)
+	}
+
+	// CDN (Cloudflare) purge settings, single row; the API token is sealed with the secret box
+	const cdnSettingsSchema = `
+CREATE TABLE IF NOT EXISTS cdn_settings (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    enabled INTEGER NOT NULL DEFAULT 0,
+    zone_id TEXT NOT NULL DEFAULT '',
+    api_token TEXT NOT NULL DEFAULT '',
+    purge_everything INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+	if _, err := r.db.Exec(cdnSettingsSchema); err != nil {
+		return fmt.Errorf("migrate cdn_settings: %w", err)
+	}
+
+	// Outcome of each traffic collection run; failures holds a JSON list of the servers that failed
+	const trafficCollectionRunsSchema = `
+CREATE TABLE IF NOT EXISTS traffic_collection_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL,
+    status TEXT NOT NULL,
+    servers_total INTEGER NOT NULL DEFAULT 0,
+    servers_failed INTEGER NOT NULL DEFAULT 0,
+    failures TEXT NOT NULL DEFAULT '[]',
+    error TEXT NOT NULL DEFAULT ''
+);
+`
+	if _, err := r.db.Exec(trafficCollectionRunsSchema); err != nil {
+		return fmt.Errorf("migrate traffic_collection_runs: %w", err)
+	}
+	// Collection metrics: parallelism used and per-panel durations (JSON list)
+	if err := r.ensureTrafficCollectionRunColumn("concurrency", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := r.ensureTrafficCollectionRunColumn("panels", "TEXT NOT NULL DEFAULT '[]'"); err != nil {
+		return err
+	}
+
+	// Metadata synced from the probe panels, keyed by probe server name like nodes.probe_server
+	const probeServerAnnotationsSchema = `
+CREATE TABLE IF NOT EXISTS probe_server_annotations (
+    server_name TEXT PRIMARY KEY,
+    annotations TEXT NOT NULL DEFAULT '{}',
+    synced_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+	if _, err := r.db.Exec(probeServerAnnotationsSchema); err != nil {
+		return fmt.Errorf("migrate probe_server_annotations: %w", err)
+	}
+
+	// Per-node enable/disable schedules; schedule_disabled marks nodes currently disabled by their schedule
+	const nodeSchedulesSchema = `
+CREATE TABLE IF NOT EXISTS node_schedules (
+    node_id INTEGER PRIMARY KEY,
+    username TEXT NOT NULL,
+    windows TEXT NOT NULL DEFAULT '[]',
+    enable_cron TEXT NOT NULL DEFAULT '',
+    disable_cron TEXT NOT NULL DEFAULT '',
+    timezone TEXT NOT NULL DEFAULT '',
+    schedule_disabled INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_node_schedules_username ON node_schedules(username);
+`
+	if _, err := r.db.Exec(nodeSchedulesSchema); err != nil {
+		return fmt.Errorf("migrate node_schedules: %w", err)
+	}
+
+	// Find-and-replace runs across subscription files; files holds the rule versions before and after each change
+	const bulkReplacementsSchema = `
+CREATE TABLE IF NOT EXISTS bulk_replacements (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    find TEXT NOT NULL,
+    replacement TEXT NOT NULL,
+    is_regex INTEGER NOT NULL DEFAULT 0,
+    files TEXT NOT NULL DEFAULT '[]',
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    rolled_back_at TIMESTAMP
+);
+`
+	if _, err := r.db.Exec(bulkReplacementsSchema); err != nil {
+		return fmt.Errorf("migrate bulk_replacements: %w", err)
+	}
+
+	// Admin-configured webhook endpoints; secret is sealed like other stored credentials
+	const webhooksSchema = `
+CREATE TABLE IF NOT EXISTS webhooks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL DEFAULT '',
+    events TEXT NOT NULL DEFAULT '[]',
+    enabled INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id INTEGER NOT NULL,
+    event TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    response_status INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id);
+`
+	if _, err := r.db.Exec(webhooksSchema); err != nil {
+		return fmt.Errorf("migrate webhooks: %w", err)
+	}
+
+	// SMTP settings for email notifications, single row; the password is sealed with the secret box
+	const smtpSettingsSchema = `
+CREATE TABLE IF NOT EXISTS smtp_settings (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    enabled INTEGER NOT NULL DEFAULT 0,
+    host TEXT NOT NULL DEFAULT '',
+    port INTEGER NOT NULL DEFAULT 587,
+    username TEXT NOT NULL DEFAULT '',
+    password TEXT NOT NULL DEFAULT '',
+    from_address TEXT NOT NULL DEFAULT '',
+    from_name TEXT NOT NULL DEFAULT '',
+    encryption TEXT NOT NULL DEFAULT 'starttls',
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+	if _, err := r.db.Exec(smtpSettingsSchema); err != nil {
+		return fmt.Errorf("migrate smtp_settings: %w", err)
+	}
+
+	const ldapSettingsSchema = `
+CREATE TABLE IF NOT EXISTS ldap_settings (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    enabled INTEGER NOT NULL DEFAULT 0,
+    url TEXT NOT NULL DEFAULT '',
+    start_tls INTEGER NOT NULL DEFAULT 0,
+    skip_tls_verify INTEGER NOT NULL DEFAULT 0,
+    bind_dn TEXT NOT NULL DEFAULT '',
+    bind_password TEXT NOT NULL DEFAULT '',
+    base_dn TEXT NOT NULL DEFAULT '',
+    user_filter TEXT NOT NULL DEFAULT '',
+    email_attribute TEXT NOT NULL DEFAULT '',
+    name_attribute TEXT NOT NULL DEFAULT '',
+    auto_create INTEGER NOT NULL DEFAULT 1,
+    default_role TEXT NOT NULL DEFAULT 'user',
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+	if _, err := r.db.Exec(ldapSettingsSchema); err != nil {
+		return fmt.Errorf("migrate ldap_settings: %w", err)
+	}
+
+	// Audit log of mutating admin actions
+	const auditLogSchema = `
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    actor TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    method TEXT NOT NULL DEFAULT '',
+    path TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL DEFAULT '',
+    target TEXT NOT NULL DEFAULT '',
+    before_summary TEXT NOT NULL DEFAULT '',
+    after_summary TEXT NOT NULL DEFAULT '',
+    status INTEGER NOT NULL DEFAULT 0,
+    request_id TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor, id);
+`
+	if _, err := r.db.Exec(auditLogSchema); err != nil {
+		return fmt.Errorf("migrate audit_log: %w", err)
+	}
+
+	const webauthnCredentialsSchema = `
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL,
+    credential_id TEXT NOT NULL UNIQUE,
+    public_key BLOB NOT NULL,
+    sign_count INTEGER NOT NULL DEFAULT 0,
+    name TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_username ON webauthn_credentials(username);
+`
+	if _, err := r.db.Exec(webauthnCredentialsSchema); err != nil {
+		return fmt.Errorf("migrate webauthn_credentials: %w", err)
+	}
+
+	const invitationsSchema = `
+CREATE TABLE IF NOT EXISTS invitations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT NOT NULL UNIQUE,
+    role TEXT NOT NULL DEFAULT 'user',
+    subscription_ids TEXT NOT NULL DEFAULT '[]',
+    max_uses INTEGER NOT NULL DEFAULT 1,
+    used_count INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP,
+    note TEXT NOT NULL DEFAULT '',
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+	if _, err := r.db.Exec(invitationsSchema); err != nil {
+		return fmt.Errorf("migrate invitations: %w", err)
+	}
+
+	// Record which invitation a self-registered user redeemed
+	if err := r.ensureUserColumn("invitation_id", "INTEGER"); err != nil {
+		return err
+	}
+
+	// Open registration: accounts wait in an approval queue until an admin activates them
+	if err := r.ensureUserColumn("approval_status", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	// Account lockout after repeated failed password logins
+	if err := r.ensureUserColumn("failed_login_count", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := r.ensureUserColumn("locked_until", "TIMESTAMP"); err != nil {
+		return err
+	}
+
+	// 登录锁定按 (用户名, 客户端 IP) 记录，其他 IP 的失败不会把账户本人锁在外面。
+	// users 表上的 failed_login_count / locked_until 不再使用
+	const loginLockoutsSchema = `
+CREATE TABLE IF NOT EXISTS login_lockouts (
+    username TEXT NOT NULL,
+    client_ip TEXT NOT NULL,
+    failed_count INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (username, client_ip)
+);
+`
+	if _, err := r.db.Exec(loginLockoutsSchema); err != nil {
+		return fmt.Errorf("migrate login_lockouts: %w", err)
+	}
+
+	// 试用链接：首次访问时自动创建限时试用账号，账号的限制单独保存，删除链接不影响已创建的账号
+	const trialLinksSchema = `
+CREATE TABLE IF NOT EXISTS trial_links (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT NOT NULL UNIQUE,
+    subscription_ids TEXT NOT NULL DEFAULT '[]',
+    max_nodes INTEGER NOT NULL DEFAULT 0,
+    traffic_quota INTEGER NOT NULL DEFAULT 0,
+    duration_hours INTEGER NOT NULL DEFAULT 72,
+    max_uses INTEGER NOT NULL DEFAULT 1,
+    used_count INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP,
+    note TEXT NOT NULL DEFAULT '',
+    created_by TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS trial_accounts (
+    username TEXT PRIMARY KEY,
+    trial_link_id INTEGER NOT NULL,
+    client_ip TEXT NOT NULL DEFAULT '',
+    max_nodes INTEGER NOT NULL DEFAULT 0,
+    traffic_quota INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_trial_accounts_link_ip ON trial_accounts(trial_link_id, client_ip);
+`
+	if _, err := r.db.Exec(trialLinksSchema); err != nil {
+		return fmt.Errorf("migrate trial_links: %w", err)
+	}
+
+	// 忘记密码的重置令牌，仅保存哈希
+	const passwordResetsSchema = `
+CREATE TABLE IF NOT EXISTS password_resets (
+    token_hash TEXT PRIMARY KEY,
+    username TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_password_resets_username ON password_resets(username);
+`
+	if _, err := r.db.Exec(passwordResetsSchema); err != nil {
+		return fmt.Errorf("migrate password_resets: %w", err)
+	}
+
+	// 用户的命名订阅令牌（如"家里路由器"、"手机"），与 user_tokens 中的主令牌并存
+	const userNamedTokensSchema = `
+CREATE TABLE IF NOT EXISTS user_named_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL,
+    label TEXT NOT NULL,
+    token TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_user_named_tokens_username ON user_named_tokens(username);
+`
+	if _, err := r.db.Exec(userNamedTokensSchema); err != nil {
+		return fmt.Errorf("migrate user_named_tokens: %w", err)
+	}
+
+	// 探针面板（哪吒/Komari）推送的告警，按探针服务器名称关联绑定的节点
+	const probeAlertsSchema = `
+CREATE TABLE IF NOT EXISTS probe_alerts (
+    server_name TEXT PRIMARY KEY,
+    server_id TEXT NOT NULL DEFAULT '',
+    source TEXT NOT NULL DEFAULT '',
+    message TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+	if _, err := r.db.Exec(probeAlertsSchema); err != nil {
+		return fmt.Errorf("migrate probe_alerts: %w", err)
+	}
+
+	// 探针告警历史：每次告警从触发到恢复记一行，用于计算节点可用率
+	const probeAlertHistorySchema = `
+CREATE TABLE IF NOT EXISTS probe_alert_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    server_name TEXT NOT NULL,
+    source TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_probe_alert_history_server ON probe_alert_history(server_name, resolved_at);
+CREATE INDEX IF NOT EXISTS idx_probe_alert_history_started ON probe_alert_history(started_at);
+`
+	if _, err := r.db.Exec(probeAlertHistorySchema); err != nil {
+		return fmt.Errorf("migrate probe_alert_history: %w", err)
+	}
+
+	// 订阅拉取次数，按小时、用户、文件和客户端类型聚合
+	const subscriptionPullsSchema = `
+CREATE TABLE IF NOT EXISTS subscription_pulls (
+    hour TEXT NOT NULL,
+    username TEXT NOT NULL,
+    filename TEXT NOT NULL,
+    client_type TEXT NOT NULL DEFAULT '',
+    count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (hour, username, filename, client_type)
+);
+`
+	if _, err := r.db.Exec(subscriptionPullsSchema); err != nil {
+		return fmt.Errorf("migrate subscription_pulls: %w", err)
+	}
+
+	// 每日归档的下发订阅内容（gzip 压缩），同一用户/文件/客户端类型每天保留最后一次
+	const servedSnapshotsSchema = `
+CREATE TABLE IF NOT EXISTS served_snapshots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL,
+    filename TEXT NOT NULL,
+    client_type TEXT NOT NULL DEFAULT '',
+    day TEXT NOT NULL,
+    sha256 TEXT NOT NULL,
+    size INTEGER NOT NULL DEFAULT 0,
+    content BLOB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(username, filename, client_type, day)
+);
+CREATE INDEX IF NOT EXISTS idx_served_snapshots_day ON served_snapshots(day);
+`
+	if _, err := r.db.Exec(servedSnapshotsSchema); err != nil {
+		return fmt.Errorf("migrate served_snapshots: %w", err)
+	}
+
+	// 实例间同步：federation_peers 为允许拉取本实例的从实例，federation_upstream 为本实例镜像的主实例（最多一个），
+	// federation_synced 记录从主实例同步过来的节点和订阅文件，上游删除后据此清理
+	const federationSchema = `
+CREATE TABLE IF NOT EXISTS federation_peers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    owner TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    token_hint TEXT NOT NULL DEFAULT '',
+    last_seen_at TIMESTAMP,
+    last_seen_ip TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS federation_upstream (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    url TEXT NOT NULL DEFAULT '',
+    token TEXT NOT NULL DEFAULT '',
+    username TEXT NOT NULL DEFAULT '',
+    interval_minutes INTEGER NOT NULL DEFAULT 10,
+    enabled INTEGER NOT NULL DEFAULT 0,
+    sync_nodes INTEGER NOT NULL DEFAULT 1,
+    sync_files INTEGER NOT NULL DEFAULT 1,
+    etag TEXT NOT NULL DEFAULT '',
+    last_sync_at TIMESTAMP,
+    last_success_at TIMESTAMP,
+    last_error TEXT NOT NULL DEFAULT '',
+    last_nodes INTEGER NOT NULL DEFAULT 0,
+    last_files INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS federation_synced (
+    kind TEXT NOT NULL,
+    uuid TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (kind, uuid)
+);
+`
+	if _, err := r.db.Exec(federationSchema); err != nil {
+		return fmt.Errorf("migrate federation: %w", err)
+	}
+
+	const customRulesSchema = `
+CREATE TABLE IF NOT EXISTS custom_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    type TEXT NOT NULL CHECK (type IN ('dns','rules','rule-providers')),
+    mode TEXT NOT NULL CHECK (mode IN ('replace','prepend','append')),
+    content TEXT NOT NULL,
+    enabled INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(name, type)
+);
+CREATE INDEX IF NOT EXISTS idx_custom_rules_type ON custom_rules(type);
+CREATE INDEX IF NOT EXISTS idx_custom_rules_enabled ON custom_rules(enabled);
+`
+
+	if _, err := r.db.Exec(customRulesSchema); err != nil {
+		return fmt.Errorf("migrate custom_rules: %w", err)
+	}
+
+	// Migrate existing custom_rules table to support 'append' mode
+	if err := r.migrateCustomRulesAppendMode(); err != nil {
+		return fmt.Errorf("migrate custom_rules append mode: %w", err)
+	}
+
+	// Add auto_sync_custom_rules column to subscribe_files table
+	if err := r.ensureSubscribeFileColumn("auto_sync_custom_rules", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Create custom_rule_applications table for tracking applied content
+	const customRuleApplicationsSchema = `
+CREATE TABLE IF NOT EXISTS custom_rule_applications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    subscribe_file_id INTEGER NOT NULL,
+    custom_rule_id INTEGER NOT NULL,
+    rule_type TEXT NOT NULL,
+    rule_mode TEXT NOT NULL,
+    applied_content TEXT NOT NULL,
+    content_hash TEXT NOT NULL,
+    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (subscribe_file_id) REFERENCES subscribe_files(id) ON DELETE CASCADE,
+    FOREIGN KEY (custom_rule_id) REFERENCES custom_rules(id) ON DELETE CASCADE,
+    UNIQUE(subscribe_file_id, custom_rule_id, rule_type)
+);
+CREATE INDEX IF NOT EXISTS idx_custom_rule_applications_file ON custom_rule_applications(subscribe_file_id);
+CREATE INDEX IF NOT EXISTS idx_custom_rule_applications_rule ON custom_rule_applications(custom_rule_id);
+`
+
+	if _, err := r.db.Exec(customRuleApplicationsSchema); err != nil {
+		return fmt.Errorf("migrate custom_rule_applications: %w", err)
+	}
+
+	// Templates table for ACL4SSR rule configuration
+	const templatesSchema = `
+CREATE TABLE IF NOT EXISTS templates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    category TEXT NOT NULL DEFAULT 'clash' CHECK (category IN ('clash','surge')),
+    template_url TEXT NOT NULL DEFAULT '',
+    rule_source TEXT NOT NULL DEFAULT '',
+    use_proxy INTEGER NOT NULL DEFAULT 0,
+    enable_include_all INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(name)
+);
+CREATE INDEX IF NOT EXISTS idx_templates_category ON templates(category);
+`
+
+	if _, err := r.db.Exec(templatesSchema); err != nil {
+		return fmt.Errorf("migrate templates: %w", err)
+	}
+
+	// Proxy provider configs table
+	const proxyProviderConfigsSchema = `
+CREATE TABLE IF NOT EXISTS proxy_provider_configs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL,
+    external_subscription_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    type TEXT NOT NULL DEFAULT 'http',
+    interval INTEGER DEFAULT 3600,
+    proxy TEXT DEFAULT 'DIRECT',
+    size_limit INTEGER DEFAULT 0,
+    header TEXT,
+    health_check_enabled INTEGER DEFAULT 1,
+    health_check_url TEXT DEFAULT 'https://www.gstatic.com/generate_204',
+    health_check_interval INTEGER DEFAULT 300,
+    health_check_timeout INTEGER DEFAULT 5000,
+    health_check_lazy INTEGER DEFAULT 1,
+    health_check_expected_status INTEGER DEFAULT 204,
+    filter TEXT,
+    exclude_filter TEXT,
+    exclude_type TEXT,
+    geo_ip_filter TEXT,
+    override TEXT,
+    process_mode TEXT DEFAULT 'client',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (external_subscription_id) REFERENCES external_subscriptions(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_proxy_provider_configs_username ON proxy_provider_configs(username);
+CREATE INDEX IF NOT EXISTS idx_proxy_provider_configs_external_subscription_id ON proxy_provider_configs(external_subscription_id);
+`
+	if _, err := r.db.Exec(proxyProviderConfigsSchema); err != nil {
+		return fmt.Errorf("migrate proxy_provider_configs: %w", err)
+	}
+
+	// 添加 geo_ip_filter 列（为旧数据库迁移）
+	if err := r.ensureProxyProviderConfigColumn("geo_ip_filter", "TEXT"); err != nil {
+		return fmt.Errorf("ensure geo_ip_filter column: %w", err)
+	}
+
+	// 外部订阅同步差异记录（新增/删除/变更的节点）
+	const externalSubscriptionDiffsSchema = `
+CREATE TABLE IF NOT EXISTS external_subscription_diffs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    subscription_id INTEGER NOT NULL,
+    username TEXT NOT NULL,
+    added TEXT NOT NULL DEFAULT '[]',
+    removed TEXT NOT NULL DEFAULT '[]',
+    changed TEXT NOT NULL DEFAULT '[]',
+    node_snapshot TEXT NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_external_subscription_diffs_subscription ON external_subscription_diffs(subscription_id, id);
+`
+	if _, err := r.db.Exec(externalSubscriptionDiffsSchema); err != nil {
+		return fmt.Errorf("migrate external_subscription_diffs: %w", err)
+	}
+
+	// 外部订阅同步结果和节点连通性检测结果，用于计算订阅来源的可靠性评分
+	const providerReliabilitySchema = `
+CREATE TABLE IF NOT EXISTS external_subscription_sync_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    subscription_id INTEGER NOT NULL,
+    username TEXT NOT NULL,
+    success INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    node_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_external_subscription_sync_runs_subscription ON external_subscription_sync_runs(subscription_id, id);
+CREATE TABLE IF NOT EXISTS node_health (
+    node_id INTEGER PRIMARY KEY,
+    username TEXT NOT NULL,
+    alive INTEGER NOT NULL DEFAULT 0,
+    latency_ms REAL NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    checked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_node_health_username ON node_health(username);
+`
+	if _, err := r.db.Exec(providerReliabilitySchema); err != nil {
+		return fmt.Errorf("migrate provider reliability: %w", err)
+	}
+
+	// 站内通知（同步失败、管理员公告、套餐到期提醒等）
+	const notificationsSchema = `
+CREATE TABLE IF NOT EXISTS notifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL,
+    type TEXT NOT NULL,
+    title TEXT NOT NULL,
+    content TEXT NOT NULL DEFAULT '',
+    dedupe_key TEXT NOT NULL DEFAULT '',
+    read_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_notifications_username ON notifications(username, id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_dedupe ON notifications(username, dedupe_key) WHERE dedupe_key != '';
+`
+	if _, err := r.db.Exec(notificationsSchema); err != nil {
+		return fmt.Errorf("migrate notifications: %w", err)
+	}
+
+	// 短时登录码（用于电视盒子等设备免输密码登录），仅保存哈希
+	const loginCodesSchema = `
+CREATE TABLE IF NOT EXISTS login_codes (
+    code_hash TEXT PRIMARY KEY,
+    username TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_login_codes_username ON login_codes(username);
+`
+	if _, err := r.db.Exec(loginCodesSchema); err != nil {
+		return fmt.Errorf("migrate login_codes: %w", err)
+	}
+
+	// Daily node pool composition snapshots (counts by protocol/tag/region)
+	const nodePoolSnapshotsSchema = `
+CREATE TABLE IF NOT EXISTS node_pool_snapshots (
+    date TEXT NOT NULL,
+    username TEXT NOT NULL,
+    total_nodes INTEGER NOT NULL DEFAULT 0,
+    enabled_nodes INTEGER NOT NULL DEFAULT 0,
+    by_protocol TEXT NOT NULL DEFAULT '{}',
+    by_tag TEXT NOT NULL DEFAULT '{}',
+    by_region TEXT NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (date, username)
+);
+CREATE INDEX IF NOT EXISTS idx_node_pool_snapshots_username ON node_pool_snapshots(username);
+`
+	if _, err := r.db.Exec(nodePoolSnapshotsSchema); err != nil {
+		return fmt.Errorf("migrate node_pool_snapshots: %w", err)
+	}
+
+	// 节点部署：通过 SSH 或服务器上报的方式运行安装脚本，并将生成的分享链接登记为节点
+	const nodeDeploymentsSchema = `
+CREATE TABLE IF NOT EXISTS node_deployments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL,
+    name TEXT NOT NULL,
+    mode TEXT NOT NULL,
+    script TEXT NOT NULL DEFAULT '',
+    command TEXT NOT NULL DEFAULT '',
+    host TEXT NOT NULL DEFAULT '',
+    port INTEGER NOT NULL DEFAULT 22,
+    ssh_user TEXT NOT NULL DEFAULT '',
+    auth_type TEXT NOT NULL DEFAULT '',
+    credential TEXT NOT NULL DEFAULT '',
+    host_key TEXT NOT NULL DEFAULT '',
+    token_hash TEXT NOT NULL DEFAULT '',
+    token_hint TEXT NOT NULL DEFAULT '',
+    tag TEXT NOT NULL DEFAULT '',
+    probe_server TEXT NOT NULL DEFAULT '',
+    node_ids TEXT NOT NULL DEFAULT '[]',
+    status TEXT NOT NULL DEFAULT 'pending',
+    last_error TEXT NOT NULL DEFAULT '',
+    log TEXT NOT NULL DEFAULT '',
+    last_run_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_node_deployments_username ON node_deployments(username);
+CREATE INDEX IF NOT EXISTS idx_node_deployments_token ON node_deployments(token_hash);
+`
+	if _, err := r.db.Exec(nodeDeploymentsSchema); err != nil {
+		return fmt.Errorf("migrate node_deployments: %w", err)
+	}
+	// 部署时通过 ACME DNS 验证签发证书的域名及所用 DNS 凭据
+	if err := r.ensureNodeDeploymentColumn("tls_domain", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := r.ensureNodeDeploymentColumn("dns_credential_id", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// DNS 服务商凭据：加密保存，按域名限定使用范围，供多个节点部署复用签发证书
+	const dnsCredentialsSchema = `
+CREATE TABLE IF NOT EXISTS dns_credentials (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL,
+    name TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    secret TEXT NOT NULL DEFAULT '',
+    domains TEXT NOT NULL DEFAULT '[]',
+    last_used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_dns_credentials_username ON dns_credentials(username);
+`
+	if _, err := r.db.Exec(dnsCredentialsSchema); err != nil {
+		return fmt.Errorf("migrate dns_credentials: %w", err)
+	}
+
+	// 规则模板导入来源及历史版本（rule_templates 目录下的文件）
+	const ruleTemplateHistorySchema = `
+CREATE TABLE IF NOT EXISTS rule_template_sources (
+    filename TEXT PRIMARY KEY,
+    source_url TEXT NOT NULL,
+    format TEXT NOT NULL DEFAULT 'clash',
+    content_hash TEXT NOT NULL DEFAULT '',
+    last_imported_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_checked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS rule_template_versions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    filename TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    action TEXT NOT NULL DEFAULT '',
+    source_url TEXT NOT NULL DEFAULT '',
+    content_hash TEXT NOT NULL DEFAULT '',
+    content TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(filename, version)
+);
+`
+	if _, err := r.db.Exec(ruleTemplateHistorySchema); err != nil {
+		return fmt.Errorf("migrate rule template history: %w", err)
+	}
+
+	// 拉取订阅的客户端 IP，按用户和 IP 聚合，供应急封禁按 IP 查找泄露链接的所属用户
+	const subscriptionClientIPsSchema = `
+CREATE TABLE IF NOT EXISTS subscription_client_ips (
+    username TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    pulls INTEGER NOT NULL DEFAULT 0,
+    first_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (username, ip)
+);
+CREATE INDEX IF NOT EXISTS idx_subscription_client_ips_ip ON subscription_client_ips(ip, last_seen_at);
+`
+	if _, err := r.db.Exec(subscriptionClientIPsSchema); err != nil {
+		return fmt.Errorf("migrate subscription_client_ips: %w", err)
+	}
+
+	// 规则集缓存代理：生成配置时登记的远程规则集与地理数据库地址，内容缓存在 data/rule_cache 目录
+	const ruleCacheEntriesSchema = `
+CREATE TABLE IF NOT EXISTS rule_cache_entries (
+    id TEXT PRIMARY KEY,
+    url TEXT NOT NULL UNIQUE,
+    size INTEGER NOT NULL DEFAULT 0,
+    sha256 TEXT NOT NULL DEFAULT '',
+    etag TEXT NOT NULL DEFAULT '',
+    last_modified TEXT NOT NULL DEFAULT '',
+    fetched_at TIMESTAMP,
+    last_error TEXT NOT NULL DEFAULT '',
+    hits INTEGER NOT NULL DEFAULT 0,
+    last_access_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+	if _, err := r.db.Exec(ruleCacheEntriesSchema); err != nil {
+		return fmt.Errorf("migrate rule_cache_entries: %w", err)
+	}
+
+	// GeoIP / GeoSite databases downloaded and served by the panel
+	const geoDataFilesSchema = `
+CREATE TABLE IF NOT EXISTS geo_data_files (
+    name TEXT PRIMARY KEY,
+    url TEXT NOT NULL,
+    builtin INTEGER NOT NULL DEFAULT 0,
+    enabled INTEGER NOT NULL DEFAULT 1,
+    size INTEGER NOT NULL DEFAULT 0,
+    sha256 TEXT NOT NULL DEFAULT '',
+    etag TEXT NOT NULL DEFAULT '',
+    last_modified TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP,
+    checked_at TIMESTAMP,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+	if _, err := r.db.Exec(geoDataFilesSchema); err != nil {
+		return fmt.Errorf("migrate geo_data_files: %w", err)
+	}
+
+	return nil
+}
+
+// ListSubscriptionLinks returns all configured subscription links ordered by creation.
+func (r *TrafficRepository) ListSubscriptionLinks(ctx context.Context) ([]SubscriptionLink, error) {
 	if r == nil || r.db == nil {
 		return nil, errors.New("traffic repository not initialized")
 	}
 
-	rows, err := r.db.QueryContext(ctx, `SELECT id, name, type, COALESCE(description, ''), rule_filename, buttons, COALESCE(short_url, ''), created_at, updated_at FROM subscription_links ORDER BY id ASC`)
+	rows, err := r.readQuery(ctx, `SELECT id, name, type, COALESCE(description, ''), rule_filename, buttons, COALESCE(short_url, ''), created_at, updated_at FROM subscription_links ORDER BY id ASC`)
 	if err != nil {
 		return nil, fmt.Errorf("list subscription links: %w", err)
 	}
@@ -1007,7 +2132,7 @@ func (r *TrafficRepository) GetSubscriptionByName(ctx context.Context, name stri
 		return link, errors.New("subscription name is required")
 	}
 
-	row := r.db.QueryRowContext(ctx, `SELECT id, name, type, COALESCE(description, ''), rule_filename, buttons, COALESCE(short_url, ''), created_at, updated_at FROM subscription_links WHERE name = ? LIMIT 1`, name)
+	row := r.readQueryRow(ctx, `SELECT id, name, type, COALESCE(description, ''), rule_filename, buttons, COALESCE(short_url, ''), created_at, updated_at FROM subscription_links WHERE name = ? LIMIT 1`, name)
 	result, err := scanSubscriptionLink(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -1198,172 +2323,76 @@ func (r *TrafficRepository) CountSubscriptionsByFilename(ctx context.Context, fi
 		return 0, fmt.Errorf("count subscription by filename: %w", err)
 	}
 
-	return count, nil
-}
-
-// GetProbeConfig returns the current probe configuration with associated servers.
-func (r *TrafficRepository) GetProbeConfig(ctx context.Context) (ProbeConfig, error) {
-	var cfg ProbeConfig
-	if r == nil || r.db == nil {
-		return cfg, errors.New("traffic repository not initialized")
-	}
-	if ctx == nil {
-		ctx = context.Background()
-	}
-
-	row := r.db.QueryRowContext(ctx, `SELECT id, probe_type, address, created_at, updated_at FROM probe_configs WHERE id = 1 LIMIT 1`)
-	result, err := scanProbeConfig(row)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return cfg, ErrProbeConfigNotFound
-		}
-		return cfg, fmt.Errorf("get probe config: %w", err)
-	}
-
-	rows, err := r.db.QueryContext(ctx, `SELECT id, config_id, server_id, name, traffic_method, monthly_traffic_bytes, position, created_at, updated_at FROM probe_servers WHERE config_id = ? ORDER BY position ASC, id ASC`, result.ID)
-	if err != nil {
-		return cfg, fmt.Errorf("list probe servers: %w", err)
-	}
-	defer rows.Close()
-
-	var servers []ProbeServer
-	for rows.Next() {
-		server, err := scanProbeServer(rows)
-		if err != nil {
-			return cfg, fmt.Errorf("scan probe server: %w", err)
-		}
-		servers = append(servers, server)
-	}
-
-	if err := rows.Err(); err != nil {
-		return cfg, fmt.Errorf("iterate probe servers: %w", err)
-	}
-
-	result.Servers = servers
-
-	return result, nil
-}
-
-// UpsertProbeConfig updates the singleton probe configuration and replaces its server list.
-func (r *TrafficRepository) UpsertProbeConfig(ctx context.Context, cfg ProbeConfig) (ProbeConfig, error) {
-	if r == nil || r.db == nil {
-		return ProbeConfig{}, errors.New("traffic repository not initialized")
-	}
-	if ctx == nil {
-		ctx = context.Background()
-	}
-
-	type sanitizedServer struct {
-		ServerID            string
-		Name                string
-		TrafficMethod       string
-		MonthlyTrafficBytes int64
-	}
-
-	cfg.ProbeType = strings.ToLower(strings.TrimSpace(cfg.ProbeType))
-	if _, ok := allowedProbeTypes[cfg.ProbeType]; !ok {
-		return ProbeConfig{}, errors.New("unsupported probe type")
-	}
-
-	cfg.Address = strings.TrimSpace(cfg.Address)
-	if cfg.Address == "" {
-		return ProbeConfig{}, errors.New("probe address is required")
-	}
-
-	if len(cfg.Servers) == 0 {
-		return ProbeConfig{}, errors.New("at least one server is required")
-	}
-
-	sanitized := make([]sanitizedServer, 0, len(cfg.Servers))
-	for idx, srv := range cfg.Servers {
-		serverID := strings.TrimSpace(srv.ServerID)
-		if serverID == "" {
-			return ProbeConfig{}, fmt.Errorf("server %d: server id is required", idx+1)
-		}
-
-		name := strings.TrimSpace(srv.Name)
-		if name == "" {
-			return ProbeConfig{}, fmt.Errorf("server %d: server name is required", idx+1)
-		}
-
-		method := strings.ToLower(strings.TrimSpace(srv.TrafficMethod))
-		if _, ok := allowedTrafficMethods[method]; !ok {
-			return ProbeConfig{}, fmt.Errorf("server %d: unsupported traffic method", idx+1)
-		}
-
-		if srv.MonthlyTrafficBytes < 0 {
-			return ProbeConfig{}, fmt.Errorf("server %d: monthly traffic cannot be negative", idx+1)
-		}
-
-		sanitized = append(sanitized, sanitizedServer{
-			ServerID:            serverID,
-			Name:                name,
-			TrafficMethod:       method,
-			MonthlyTrafficBytes: srv.MonthlyTrafficBytes,
-		})
-	}
-
-	tx, err := r.db.BeginTx(ctx, nil)
-	if err != nil {
-		return ProbeConfig{}, fmt.Errorf("begin probe config tx: %w", err)
-	}
-	defer tx.Rollback()
+	return count, nil
+}
 
-	if _, err := tx.ExecContext(ctx, `INSERT INTO probe_configs (id, probe_type, address) VALUES (1, ?, ?) ON CONFLICT(id) DO UPDATE SET probe_type = excluded.probe_type, address = excluded.address, updated_at = CURRENT_TIMESTAMP`, cfg.ProbeType, cfg.Address); err != nil {
-		return ProbeConfig{}, fmt.Errorf("upsert probe config: %w", err)
+// GetProbeConfig returns the primary (oldest) probe configuration with associated servers.
+// Callers that need every configuration should use ListProbeConfigs.
+func (r *TrafficRepository) GetProbeConfig(ctx context.Context) (ProbeConfig, error) {
+	var cfg ProbeConfig
+	if r == nil || r.db == nil {
+		return cfg, errors.New("traffic repository not initialized")
 	}
-
-	if _, err := tx.ExecContext(ctx, `DELETE FROM probe_servers WHERE config_id = 1`); err != nil {
-		return ProbeConfig{}, fmt.Errorf("clear probe servers: %w", err)
+	if ctx == nil {
+		ctx = context.Background()
 	}
 
-	stmt, err := tx.PrepareContext(ctx, `INSERT INTO probe_servers (config_id, server_id, name, traffic_method, monthly_traffic_bytes, position) VALUES (1, ?, ?, ?, ?, ?)`)
+	row := r.db.QueryRowContext(ctx, `SELECT `+probeConfigColumns+` FROM probe_configs ORDER BY id ASC LIMIT 1`)
+	result, err := scanProbeConfig(row)
 	if err != nil {
-		return ProbeConfig{}, fmt.Errorf("prepare insert probe server: %w", err)
-	}
-	defer stmt.Close()
-
-	for idx, srv := range sanitized {
-		if _, err := stmt.ExecContext(ctx, srv.ServerID, srv.Name, srv.TrafficMethod, srv.MonthlyTrafficBytes, idx); err != nil {
-			return ProbeConfig{}, fmt.Errorf("insert probe server %d: %w", idx+1, err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return cfg, ErrProbeConfigNotFound
 		}
+		return cfg, fmt.Errorf("get probe config: %w", err)
+	}
+	if err := r.openProbeCredentials(&result); err != nil {
+		return cfg, err
 	}
 
-	if err := tx.Commit(); err != nil {
-		return ProbeConfig{}, fmt.Errorf("commit probe config: %w", err)
+	servers, err := r.listProbeServers(ctx, result.ID)
+	if err != nil {
+		return cfg, err
 	}
+	result.Servers = servers
 
-	return r.GetProbeConfig(ctx)
+	return result, nil
 }
 
-// DeleteProbeConfig deletes the probe configuration and clears all node probe bindings.
-func (r *TrafficRepository) DeleteProbeConfig(ctx context.Context) error {
-	tx, err := r.db.BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("begin delete probe config tx: %w", err)
+// UpsertProbeConfig updates the primary probe configuration (creating it when none exists) and replaces its server list.
+func (r *TrafficRepository) UpsertProbeConfig(ctx context.Context, cfg ProbeConfig) (ProbeConfig, error) {
+	if r == nil || r.db == nil {
+		return ProbeConfig{}, errors.New("traffic repository not initialized")
 	}
-	defer tx.Rollback()
-
-	// Clear probe_server binding from all nodes
-	if _, err := tx.ExecContext(ctx, `UPDATE nodes SET probe_server = '' WHERE probe_server != ''`); err != nil {
-		return fmt.Errorf("clear node probe bindings: %w", err)
+	if ctx == nil {
+		ctx = context.Background()
 	}
 
-	// Delete probe_servers (will cascade from probe_configs deletion, but do it explicitly for clarity)
-	if _, err := tx.ExecContext(ctx, `DELETE FROM probe_servers WHERE config_id = 1`); err != nil {
-		return fmt.Errorf("delete probe servers: %w", err)
+	current, err := r.GetProbeConfig(ctx)
+	if err != nil {
+		if errors.Is(err, ErrProbeConfigNotFound) {
+			return r.CreateProbeConfig(ctx, cfg)
+		}
+		return ProbeConfig{}, err
 	}
 
-	// Delete probe config
-	if _, err := tx.ExecContext(ctx, `DELETE FROM probe_configs WHERE id = 1`); err != nil {
-		return fmt.Errorf("delete probe config: %w", err)
+	cfg.ID = current.ID
+	if strings.TrimSpace(cfg.Name) == "" {
+		cfg.Name = current.Name
 	}
+	return r.UpdateProbeConfig(ctx, cfg)
+}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("commit delete probe config: %w", err)
+// DeleteProbeConfig deletes the primary probe configuration and clears the node probe bindings that referenced it.
+func (r *TrafficRepository) DeleteProbeConfig(ctx context.Context) error {
+	current, err := r.GetProbeConfig(ctx)
+	if err != nil {
+		if errors.Is(err, ErrProbeConfigNotFound) {
+			return nil
+		}
+		return err
 	}
 
-	return nil
+	return r.DeleteProbeConfigByID(ctx, current.ID)
 }
 
 func (r *TrafficRepository) ensureDefaultProbeConfig() error {
@@ -1372,7 +2401,7 @@ func (r *TrafficRepository) ensureDefaultProbeConfig() error {
 	return nil
 }
 
-func (r *TrafficRepository) migrateProbeConfigsForNezhaV0() error {
+func (r *TrafficRepository) migrateProbeConfigsProbeTypes() error {
 	// Check if table exists first
 	rows, err := r.db.Query(`SELECT sql FROM sqlite_master WHERE type='table' AND name='probe_configs'`)
 	if err != nil {
@@ -1391,8 +2420,8 @@ func (r *TrafficRepository) migrateProbeConfigsForNezhaV0() error {
 	}
 	rows.Close()
 
-	// If schema already contains nezhav0, no migration needed
-	if strings.Contains(schemaSql, "nezhav0") {
+	// If schema already contains the newest probe type, no migration needed
+	if strings.Contains(schemaSql, "uptimekuma") {
 		return nil
 	}
 
@@ -1401,6 +2430,10 @@ func (r *TrafficRepository) migrateProbeConfigsForNezhaV0() error {
 		return nil
 	}
 
+	if err := r.migrationStep("rebuild probe_configs (probe types)", r.countTableRows("probe_configs")); err != nil {
+		return err
+	}
+
 	// Need to migrate: recreate table with new CHECK constraint
 	tx, err := r.db.Begin()
 	if err != nil {
@@ -1412,7 +2445,7 @@ func (r *TrafficRepository) migrateProbeConfigsForNezhaV0() error {
 	_, err = tx.Exec(`
 CREATE TABLE probe_configs_new (
     id INTEGER PRIMARY KEY CHECK (id = 1),
-    probe_type TEXT NOT NULL CHECK (probe_type IN ('nezha','nezhav0','dstatus','komari')),
+    probe_type TEXT NOT NULL CHECK (probe_type IN ('nezha','nezhav0','dstatus','komari','uptimekuma')),
     address TEXT NOT NULL,
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
@@ -1446,6 +2479,138 @@ CREATE TABLE probe_configs_new (
 	return nil
 }
 
+func (r *TrafficRepository) migrateProbeConfigsMultiple() error {
+	var schemaSql string
+	err := r.db.QueryRow(`SELECT sql FROM sqlite_master WHERE type='table' AND name='probe_configs'`).Scan(&schemaSql)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Table doesn't exist yet, no migration needed
+			return nil
+		}
+		return fmt.Errorf("query schema: %w", err)
+	}
+
+	// Only the legacy singleton table carries the id = 1 constraint
+	if !strings.Contains(schemaSql, "CHECK (id = 1)") {
+		return nil
+	}
+
+	if err := r.migrationStep("rebuild probe_configs (multiple configs)", r.countTableRows("probe_configs")); err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+CREATE TABLE probe_configs_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL DEFAULT '',
+    probe_type TEXT NOT NULL CHECK (probe_type IN ('nezha','nezhav0','dstatus','komari','uptimekuma')),
+    address TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`)
+	if err != nil {
+		return fmt.Errorf("create new table: %w", err)
+	}
+
+	_, err = tx.Exec(`
+INSERT INTO probe_configs_new (id, name, probe_type, address, created_at, updated_at)
+SELECT id, '默认探针', probe_type, address, created_at, updated_at
+FROM probe_configs`)
+	if err != nil {
+		return fmt.Errorf("copy data: %w", err)
+	}
+
+	if _, err := tx.Exec(`DROP TABLE probe_configs`); err != nil {
+		return fmt.Errorf("drop old table: %w", err)
+	}
+
+	if _, err := tx.Exec(`ALTER TABLE probe_configs_new RENAME TO probe_configs`); err != nil {
+		return fmt.Errorf("rename table: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r *TrafficRepository) migrateProbeServersTrafficMethods() error {
+	var schemaSql string
+	err := r.db.QueryRow(`SELECT sql FROM sqlite_master WHERE type='table' AND name='probe_servers'`).Scan(&schemaSql)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Table doesn't exist yet, no migration needed
+			return nil
+		}
+		return fmt.Errorf("query schema: %w", err)
+	}
+
+	// If schema already contains the new methods, no migration needed
+	if strings.Contains(schemaSql, "sum_multiplier") {
+		return nil
+	}
+
+	if err := r.migrationStep("rebuild probe_servers (traffic methods)", r.countTableRows("probe_servers")); err != nil {
+		return err
+	}
+
+	// Need to migrate: recreate table with new CHECK constraint
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+CREATE TABLE probe_servers_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    config_id INTEGER NOT NULL,
+    server_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    traffic_method TEXT NOT NULL CHECK (traffic_method IN ('up','down','both','max','sum_multiplier')),
+    monthly_traffic_bytes INTEGER NOT NULL DEFAULT 0 CHECK (monthly_traffic_bytes >= 0),
+    position INTEGER NOT NULL DEFAULT 0 CHECK (position >= 0),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    include_in_total INTEGER NOT NULL DEFAULT 1,
+    traffic_multiplier REAL NOT NULL DEFAULT 1,
+    FOREIGN KEY(config_id) REFERENCES probe_configs(id) ON DELETE CASCADE,
+    UNIQUE(config_id, server_id)
+)`)
+	if err != nil {
+		return fmt.Errorf("create new table: %w", err)
+	}
+
+	_, err = tx.Exec(`
+INSERT INTO probe_servers_new (id, config_id, server_id, name, traffic_method, monthly_traffic_bytes, position, created_at, updated_at, include_in_total, traffic_multiplier)
+SELECT id, config_id, server_id, name, traffic_method, monthly_traffic_bytes, position, created_at, updated_at, include_in_total, traffic_multiplier
+FROM probe_servers`)
+	if err != nil {
+		return fmt.Errorf("copy data: %w", err)
+	}
+
+	if _, err := tx.Exec(`DROP TABLE probe_servers`); err != nil {
+		return fmt.Errorf("drop old table: %w", err)
+	}
+
+	if _, err := tx.Exec(`ALTER TABLE probe_servers_new RENAME TO probe_servers`); err != nil {
+		return fmt.Errorf("rename table: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
 func (r *TrafficRepository) ensureUserColumn(name, definition string) error {
 	rows, err := r.db.Query(`PRAGMA table_info(users)`)
 	if err != nil {
@@ -1542,6 +2707,70 @@ func (r *TrafficRepository) ensureSubscriptionLinkColumn(name, definition string
 	return nil
 }
 
+func (r *TrafficRepository) ensureProbeConfigColumn(name, definition string) error {
+	rows, err := r.db.Query(`PRAGMA table_info(probe_configs)`)
+	if err != nil {
+		return fmt.Errorf("probe_configs table info: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			colName    string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &colName, &colType, &notNull, &defaultVal, &pk); err != nil {
+			return fmt.Errorf("scan table info: %w", err)
+		}
+		if strings.EqualFold(colName, name) {
+			return nil
+		}
+	}
+
+	alter := fmt.Sprintf("ALTER TABLE probe_configs ADD COLUMN %s %s", name, definition)
+	if _, err := r.db.Exec(alter); err != nil {
+		return fmt.Errorf("add column %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func (r *TrafficRepository) ensureProbeServerColumn(name, definition string) error {
+	rows, err := r.db.Query(`PRAGMA table_info(probe_servers)`)
+	if err != nil {
+		return fmt.Errorf("probe_servers table info: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			colName    string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &colName, &colType, &notNull, &defaultVal, &pk); err != nil {
+			return fmt.Errorf("scan table info: %w", err)
+		}
+		if strings.EqualFold(colName, name) {
+			return nil
+		}
+	}
+
+	alter := fmt.Sprintf("ALTER TABLE probe_servers ADD COLUMN %s %s", name, definition)
+	if _, err := r.db.Exec(alter); err != nil {
+		return fmt.Errorf("add column %s: %w", name, err)
+	}
+
+	return nil
+}
+
 func (r *TrafficRepository) ensureNodeColumn(name, definition string) error {
 	rows, err := r.db.Query(`PRAGMA table_info(nodes)`)
 	if err != nil {
@@ -1664,17 +2893,81 @@ CREATE INDEX IF NOT EXISTS idx_custom_rules_enabled ON custom_rules(enabled);
 		return fmt.Errorf("drop old table: %w", err)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("commit transaction: %w", err)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r *TrafficRepository) ensureSubscribeFileColumn(name, definition string) error {
+	rows, err := r.db.Query(`PRAGMA table_info(subscribe_files)`)
+	if err != nil {
+		return fmt.Errorf("subscribe_files table info: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			colName    string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &colName, &colType, &notNull, &defaultVal, &pk); err != nil {
+			return fmt.Errorf("scan table info: %w", err)
+		}
+		if strings.EqualFold(colName, name) {
+			return nil
+		}
+	}
+
+	alter := fmt.Sprintf("ALTER TABLE subscribe_files ADD COLUMN %s %s", name, definition)
+	if _, err := r.db.Exec(alter); err != nil {
+		return fmt.Errorf("add column %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func (r *TrafficRepository) ensureExternalSubscriptionColumn(name, definition string) error {
+	rows, err := r.db.Query(`PRAGMA table_info(external_subscriptions)`)
+	if err != nil {
+		return fmt.Errorf("external_subscriptions table info: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			colName    string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &colName, &colType, &notNull, &defaultVal, &pk); err != nil {
+			return fmt.Errorf("scan table info: %w", err)
+		}
+		if strings.EqualFold(colName, name) {
+			return nil
+		}
+	}
+
+	alter := fmt.Sprintf("ALTER TABLE external_subscriptions ADD COLUMN %s %s", name, definition)
+	if _, err := r.db.Exec(alter); err != nil {
+		return fmt.Errorf("add column %s: %w", name, err)
 	}
 
 	return nil
 }
 
-func (r *TrafficRepository) ensureSubscribeFileColumn(name, definition string) error {
-	rows, err := r.db.Query(`PRAGMA table_info(subscribe_files)`)
+func (r *TrafficRepository) ensureProxyProviderConfigColumn(name, definition string) error {
+	rows, err := r.db.Query(`PRAGMA table_info(proxy_provider_configs)`)
 	if err != nil {
-		return fmt.Errorf("subscribe_files table info: %w", err)
+		return fmt.Errorf("proxy_provider_configs table info: %w", err)
 	}
 	defer rows.Close()
 
@@ -1695,7 +2988,7 @@ func (r *TrafficRepository) ensureSubscribeFileColumn(name, definition string) e
 		}
 	}
 
-	alter := fmt.Sprintf("ALTER TABLE subscribe_files ADD COLUMN %s %s", name, definition)
+	alter := fmt.Sprintf("ALTER TABLE proxy_provider_configs ADD COLUMN %s %s", name, definition)
 	if _, err := r.db.Exec(alter); err != nil {
 		return fmt.Errorf("add column %s: %w", name, err)
 	}
@@ -1703,10 +2996,10 @@ func (r *TrafficRepository) ensureSubscribeFileColumn(name, definition string) e
 	return nil
 }
 
-func (r *TrafficRepository) ensureExternalSubscriptionColumn(name, definition string) error {
-	rows, err := r.db.Query(`PRAGMA table_info(external_subscriptions)`)
+func (r *TrafficRepository) ensureSystemConfigColumn(name, definition string) error {
+	rows, err := r.db.Query(`PRAGMA table_info(system_config)`)
 	if err != nil {
-		return fmt.Errorf("external_subscriptions table info: %w", err)
+		return fmt.Errorf("system_config table info: %w", err)
 	}
 	defer rows.Close()
 
@@ -1727,7 +3020,7 @@ func (r *TrafficRepository) ensureExternalSubscriptionColumn(name, definition st
 		}
 	}
 
-	alter := fmt.Sprintf("ALTER TABLE external_subscriptions ADD COLUMN %s %s", name, definition)
+	alter := fmt.Sprintf("ALTER TABLE system_config ADD COLUMN %s %s", name, definition)
 	if _, err := r.db.Exec(alter); err != nil {
 		return fmt.Errorf("add column %s: %w", name, err)
 	}
@@ -1735,10 +3028,10 @@ func (r *TrafficRepository) ensureExternalSubscriptionColumn(name, definition st
 	return nil
 }
 
-func (r *TrafficRepository) ensureProxyProviderConfigColumn(name, definition string) error {
-	rows, err := r.db.Query(`PRAGMA table_info(proxy_provider_configs)`)
+func (r *TrafficRepository) ensureTrafficCollectionRunColumn(name, definition string) error {
+	rows, err := r.db.Query(`PRAGMA table_info(traffic_collection_runs)`)
 	if err != nil {
-		return fmt.Errorf("proxy_provider_configs table info: %w", err)
+		return fmt.Errorf("traffic_collection_runs table info: %w", err)
 	}
 	defer rows.Close()
 
@@ -1759,7 +3052,7 @@ func (r *TrafficRepository) ensureProxyProviderConfigColumn(name, definition str
 		}
 	}
 
-	alter := fmt.Sprintf("ALTER TABLE proxy_provider_configs ADD COLUMN %s %s", name, definition)
+	alter := fmt.Sprintf("ALTER TABLE traffic_collection_runs ADD COLUMN %s %s", name, definition)
 	if _, err := r.db.Exec(alter); err != nil {
 		return fmt.Errorf("add column %s: %w", name, err)
 	}
@@ -1767,10 +3060,10 @@ func (r *TrafficRepository) ensureProxyProviderConfigColumn(name, definition str
 	return nil
 }
 
-func (r *TrafficRepository) ensureSystemConfigColumn(name, definition string) error {
-	rows, err := r.db.Query(`PRAGMA table_info(system_config)`)
+func (r *TrafficRepository) ensureNodeDeploymentColumn(name, definition string) error {
+	rows, err := r.db.Query(`PRAGMA table_info(node_deployments)`)
 	if err != nil {
-		return fmt.Errorf("system_config table info: %w", err)
+		return fmt.Errorf("node_deployments table info: %w", err)
 	}
 	defer rows.Close()
 
@@ -1791,7 +3084,7 @@ func (r *TrafficRepository) ensureSystemConfigColumn(name, definition string) er
 		}
 	}
 
-	alter := fmt.Sprintf("ALTER TABLE system_config ADD COLUMN %s %s", name, definition)
+	alter := fmt.Sprintf("ALTER TABLE node_deployments ADD COLUMN %s %s", name, definition)
 	if _, err := r.db.Exec(alter); err != nil {
 		return fmt.Errorf("add column %s: %w", name, err)
 	}
@@ -1812,12 +3105,13 @@ func (r *TrafficRepository) syncNicknames() error {
 }
 
 // RecordDaily upserts the aggregated traffic usage for the provided date.
+// The calendar date is taken in date's own location, so callers convert it to the rollover timezone first.
 func (r *TrafficRepository) RecordDaily(ctx context.Context, date time.Time, totalLimit, totalUsed, totalRemaining int64) error {
 	if r == nil || r.db == nil {
 		return errors.New("traffic repository not initialized")
 	}
 
-	normalized := date.UTC().Format("2006-01-02")
+	normalized := date.Format("2006-01-02")
 
 	const stmt = `
 INSERT INTO traffic_records (date, total_limit, total_used, total_remaining)
@@ -1836,6 +3130,24 @@ ON CONFLICT(date) DO UPDATE SET
 	return nil
 }
 
+// LastTrafficRecordAt returns when the most recent traffic record was written; ok is false when none exist.
+func (r *TrafficRepository) LastTrafficRecordAt(ctx context.Context) (time.Time, bool, error) {
+	if r == nil || r.db == nil {
+		return time.Time{}, false, errors.New("traffic repository not initialized")
+	}
+
+	var createdAt time.Time
+	err := r.db.QueryRowContext(ctx, `SELECT created_at FROM traffic_records ORDER BY created_at DESC LIMIT 1`).Scan(&createdAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, false, nil
+		}
+		return time.Time{}, false, fmt.Errorf("query last traffic record: %w", err)
+	}
+
+	return createdAt, true, nil
+}
+
 // ListRecent returns up to the requested number of most recent traffic records, ordered from newest to oldest.
 func (r *TrafficRepository) ListRecent(ctx context.Context, limit int) ([]TrafficRecord, error) {
 	if r == nil || r.db == nil {
@@ -1890,6 +3202,44 @@ LIMIT ?;
 	return records, nil
 }
 
+// ListTrafficRecordsBetween returns the daily traffic records dated within [from, to] in ascending order.
+func (r *TrafficRepository) ListTrafficRecordsBetween(ctx context.Context, from, to time.Time) ([]TrafficRecord, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+SELECT date, total_limit, total_used, total_remaining
+FROM traffic_records
+WHERE date >= ? AND date <= ?
+ORDER BY date ASC;
+`, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("list traffic records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []TrafficRecord
+	for rows.Next() {
+		var record TrafficRecord
+		var dateStr string
+		if err := rows.Scan(&dateStr, &record.TotalLimit, &record.TotalUsed, &record.TotalRemaining); err != nil {
+			return nil, fmt.Errorf("scan traffic record: %w", err)
+		}
+		parsed, err := time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			return nil, fmt.Errorf("parse traffic record date: %w", err)
+		}
+		record.Date = parsed
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate traffic records: %w", err)
+	}
+
+	return records, nil
+}
+
 // GetOrCreateUserToken returns the existing token for the given username or creates a new one.
 func (r *TrafficRepository) GetOrCreateUserToken(ctx context.Context, username string) (string, error) {
 	if r == nil || r.db == nil {
@@ -1991,10 +3341,20 @@ func (r *TrafficRepository) ValidateUserToken(ctx context.Context, token string)
 	const stmt = `SELECT username FROM user_tokens WHERE token = ? LIMIT 1;`
 	var username string
 	if err := r.db.QueryRowContext(ctx, stmt, token).Scan(&username); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return "", ErrTokenNotFound
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("query user token by value: %w", err)
+		}
+		// 不是主令牌时再查找未过期的命名令牌
+		named, err := r.validateNamedToken(ctx, token)
+		if err != nil {
+			return "", err
 		}
-		return "", fmt.Errorf("query user token by value: %w", err)
+		username = named
+	}
+
+	// 账号到期后令牌不再可用
+	if err := r.checkUserNotExpired(ctx, username); err != nil {
+		return "", err
 	}
 
 	return username, nil
@@ -2237,9 +3597,54 @@ func (r *TrafficRepository) GetUsernameByUserShortCode(ctx context.Context, user
 		return "", fmt.Errorf("query user by user short code: %w", err)
 	}
 
+	// 账号到期后短链接同样失效
+	if err := r.checkUserNotExpired(ctx, username); err != nil {
+		return "", err
+	}
+
 	return username, nil
 }
 
+// Kinds of subscription credentials returned by FindTokenOwner.
+const (
+	TokenKindUser      = "user_token"
+	TokenKindNamed     = "named_token"
+	TokenKindShortCode = "short_code"
+)
+
+// FindTokenOwner resolves a subscription token, named token or user short code to its owner without
+// the side effects of ValidateUserToken: expired tokens and accounts are still matched and last use
+// is not recorded. It returns ErrTokenNotFound when nothing matches.
+func (r *TrafficRepository) FindTokenOwner(ctx context.Context, token string) (username, kind string, err error) {
+	if r == nil || r.db == nil {
+		return "", "", errors.New("traffic repository not initialized")
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", "", ErrTokenNotFound
+	}
+
+	lookups := []struct {
+		kind string
+		stmt string
+	}{
+		{TokenKindUser, `SELECT username FROM user_tokens WHERE token = ? LIMIT 1`},
+		{TokenKindNamed, `SELECT username FROM user_named_tokens WHERE token = ? LIMIT 1`},
+		{TokenKindShortCode, `SELECT username FROM user_tokens WHERE user_short_code = ? LIMIT 1`},
+	}
+	for _, lookup := range lookups {
+		err := r.db.QueryRowContext(ctx, lookup.stmt, token).Scan(&username)
+		if err == nil {
+			return username, lookup.kind, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", "", fmt.Errorf("find %s owner: %w", lookup.kind, err)
+		}
+	}
+	return "", "", ErrTokenNotFound
+}
+
 // GetUserShortCode returns the user short code for a given username.
 func (r *TrafficRepository) GetUserShortCode(ctx context.Context, username string) (userShortCode string, err error) {
 	if r == nil || r.db == nil {
@@ -2375,10 +3780,17 @@ type User struct {
 	Role         string
 	IsActive     bool
 	Remark       string
+	ExpiresAt    *time.Time // Account expiry; nil never expires
+	AuthSource   string     // AuthSourceLocal or AuthSourceLDAP
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 }
 
+// Expired reports whether the account has passed its expiry time.
+func (u User) Expired(now time.Time) bool {
+	return u.ExpiresAt != nil && !u.ExpiresAt.After(now)
+}
+
 // UserProfileUpdate captures editable profile fields for a user.
 type UserProfileUpdate struct {
 	Email     string
@@ -2460,9 +3872,10 @@ func (r *TrafficRepository) GetUser(ctx context.Context, username string) (User,
 		return user, errors.New("username is required")
 	}
 
-	row := r.db.QueryRowContext(ctx, `SELECT username, password_hash, COALESCE(email, ''), COALESCE(nickname, ''), COALESCE(avatar_url, ''), COALESCE(role, ''), is_active, created_at, updated_at FROM users WHERE username = ? LIMIT 1`, username)
+	row := r.db.QueryRowContext(ctx, `SELECT username, password_hash, COALESCE(email, ''), COALESCE(nickname, ''), COALESCE(avatar_url, ''), COALESCE(role, ''), is_active, expires_at, COALESCE(auth_source, ''), created_at, updated_at FROM users WHERE username = ? LIMIT 1`, username)
 	var active int
-	if err := row.Scan(&user.Username, &user.PasswordHash, &user.Email, &user.Nickname, &user.AvatarURL, &user.Role, &active, &user.CreatedAt, &user.UpdatedAt); err != nil {
+	var expiresAt sql.NullTime
+	if err := row.Scan(&user.Username, &user.PasswordHash, &user.Email, &user.Nickname, &user.AvatarURL, &user.Role, &active, &expiresAt, &user.AuthSource, &user.CreatedAt, &user.UpdatedAt); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return user, ErrUserNotFound
 		}
@@ -2474,7 +3887,13 @@ func (r *TrafficRepository) GetUser(ctx context.Context, username string) (User,
 	if user.Role == "" {
 		user.Role = RoleUser
 	}
+	if user.AuthSource == "" {
+		user.AuthSource = AuthSourceLocal
+	}
 	user.IsActive = active != 0
+	if expiresAt.Valid {
+		user.ExpiresAt = &expiresAt.Time
+	}
 
 	return user, nil
 }
@@ -2489,7 +3908,7 @@ func (r *TrafficRepository) ListUsers(ctx context.Context, limit int) ([]User, e
 		limit = 10
 	}
 
-	rows, err := r.db.QueryContext(ctx, `SELECT username, password_hash, COALESCE(email, ''), COALESCE(nickname, ''), COALESCE(avatar_url, ''), COALESCE(role, ''), is_active, COALESCE(remark, ''), created_at, updated_at FROM users ORDER BY created_at ASC LIMIT ?`, limit)
+	rows, err := r.readQuery(ctx, `SELECT username, password_hash, COALESCE(email, ''), COALESCE(nickname, ''), COALESCE(avatar_url, ''), COALESCE(role, ''), is_active, COALESCE(remark, ''), expires_at, COALESCE(auth_source, ''), created_at, updated_at FROM users ORDER BY created_at ASC LIMIT ?`, limit)
 	if err != nil {
 		return nil, fmt.Errorf("list users: %w", err)
 	}
@@ -2499,7 +3918,8 @@ func (r *TrafficRepository) ListUsers(ctx context.Context, limit int) ([]User, e
 	for rows.Next() {
 		var user User
 		var active int
-		if err := rows.Scan(&user.Username, &user.PasswordHash, &user.Email, &user.Nickname, &user.AvatarURL, &user.Role, &active, &user.Remark, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&user.Username, &user.PasswordHash, &user.Email, &user.Nickname, &user.AvatarURL, &user.Role, &active, &user.Remark, &expiresAt, &user.AuthSource, &user.CreatedAt, &user.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("scan user: %w", err)
 		}
 		if user.Nickname == "" {
@@ -2508,7 +3928,13 @@ func (r *TrafficRepository) ListUsers(ctx context.Context, limit int) ([]User, e
 		if user.Role == "" {
 			user.Role = RoleUser
 		}
+		if user.AuthSource == "" {
+			user.AuthSource = AuthSourceLocal
+		}
 		user.IsActive = active != 0
+		if expiresAt.Valid {
+			user.ExpiresAt = &expiresAt.Time
+		}
 		users = append(users, user)
 	}
 
@@ -2519,6 +3945,34 @@ func (r *TrafficRepository) ListUsers(ctx context.Context, limit int) ([]User, e
 	return users, nil
 }
 
+// ListAdminUsernames returns the usernames of every admin account ordered by creation time.
+func (r *TrafficRepository) ListAdminUsernames(ctx context.Context) ([]string, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.readQuery(ctx, `SELECT username FROM users WHERE role = ? ORDER BY created_at ASC`, RoleAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("list admin usernames: %w", err)
+	}
+	defer rows.Close()
+
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, fmt.Errorf("scan admin username: %w", err)
+		}
+		usernames = append(usernames, username)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate admin usernames: %w", err)
+	}
+
+	return usernames, nil
+}
+
 // UpdateUserRemark updates the remark field for the specified user.
 func (r *TrafficRepository) UpdateUserRemark(ctx context.Context, username, remark string) error {
 	if r == nil || r.db == nil {
@@ -2619,7 +4073,8 @@ func (r *TrafficRepository) UpdateUserStatus(ctx context.Context, username strin
 		value = 1
 	}
 
-	res, err := r.db.ExecContext(ctx, `UPDATE users SET is_active = ?, updated_at = CURRENT_TIMESTAMP WHERE username = ?`, value, username)
+	// 手动启用待审核账号等同于审核通过
+	res, err := r.db.ExecContext(ctx, `UPDATE users SET is_active = ?, approval_status = CASE WHEN ? = 1 THEN '' ELSE approval_status END, updated_at = CURRENT_TIMESTAMP WHERE username = ?`, value, value, username)
 	if err != nil {
 		return fmt.Errorf("update user status: %w", err)
 	}
@@ -2671,12 +4126,94 @@ func (r *TrafficRepository) DeleteUser(ctx context.Context, username string) err
 		return fmt.Errorf("delete user nodes: %w", err)
 	}
 
+	// Delete user's notifications
+	_, err = tx.ExecContext(ctx, `DELETE FROM notifications WHERE username = ?`, username)
+	if err != nil {
+		return fmt.Errorf("delete user notifications: %w", err)
+	}
+
+	// Delete user's pending login codes
+	_, err = tx.ExecContext(ctx, `DELETE FROM login_codes WHERE username = ?`, username)
+	if err != nil {
+		return fmt.Errorf("delete user login codes: %w", err)
+	}
+
+	// Delete user's passkeys
+	_, err = tx.ExecContext(ctx, `DELETE FROM webauthn_credentials WHERE username = ?`, username)
+	if err != nil {
+		return fmt.Errorf("delete user webauthn credentials: %w", err)
+	}
+
+	// Delete user's password reset tokens
+	_, err = tx.ExecContext(ctx, `DELETE FROM password_resets WHERE username = ?`, username)
+	if err != nil {
+		return fmt.Errorf("delete user password resets: %w", err)
+	}
+
+	// Delete user's served subscription snapshots
+	_, err = tx.ExecContext(ctx, `DELETE FROM served_snapshots WHERE username = ?`, username)
+	if err != nil {
+		return fmt.Errorf("delete user served snapshots: %w", err)
+	}
+
+	// Revoke federation peers exporting the user's node pool
+	_, err = tx.ExecContext(ctx, `DELETE FROM federation_peers WHERE owner = ?`, username)
+	if err != nil {
+		return fmt.Errorf("delete user federation peers: %w", err)
+	}
+
+	// Delete user's named subscription tokens
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_named_tokens WHERE username = ?`, username)
+	if err != nil {
+		return fmt.Errorf("delete user named tokens: %w", err)
+	}
+
+	// Delete user's external subscription sync diffs
+	_, err = tx.ExecContext(ctx, `DELETE FROM external_subscription_diffs WHERE username = ?`, username)
+	if err != nil {
+		return fmt.Errorf("delete user external subscription diffs: %w", err)
+	}
+
 	// Delete user's external subscriptions
 	_, err = tx.ExecContext(ctx, `DELETE FROM external_subscriptions WHERE username = ?`, username)
 	if err != nil {
 		return fmt.Errorf("delete user external subscriptions: %w", err)
 	}
 
+	// Delete user's external subscription sync runs and node health checks
+	_, err = tx.ExecContext(ctx, `DELETE FROM external_subscription_sync_runs WHERE username = ?`, username)
+	if err != nil {
+		return fmt.Errorf("delete user external subscription sync runs: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM node_health WHERE username = ?`, username)
+	if err != nil {
+		return fmt.Errorf("delete user node health: %w", err)
+	}
+
+	// Delete user's trial account limits
+	_, err = tx.ExecContext(ctx, `DELETE FROM trial_accounts WHERE username = ?`, username)
+	if err != nil {
+		return fmt.Errorf("delete user trial account: %w", err)
+	}
+
+	// Delete user's node deployments (and their stored SSH credentials)
+	_, err = tx.ExecContext(ctx, `DELETE FROM node_deployments WHERE username = ?`, username)
+	if err != nil {
+		return fmt.Errorf("delete user node deployments: %w", err)
+	}
+
+	// Delete user's DNS provider credentials
+	_, err = tx.ExecContext(ctx, `DELETE FROM dns_credentials WHERE username = ?`, username)
+	if err != nil {
+		return fmt.Errorf("delete user dns credentials: %w", err)
+	}
+
+	// Delete user's subscription client IPs
+	_, err = tx.ExecContext(ctx, `DELETE FROM subscription_client_ips WHERE username = ?`, username)
+	if err != nil {
+		return fmt.Errorf("delete user subscription client ips: %w", err)
+	}
+
 	// Delete user's settings
 	_, err = tx.ExecContext(ctx, `DELETE FROM user_settings WHERE username = ?`, username)
 	if err != nil {
@@ -2819,6 +4356,46 @@ func (r *TrafficRepository) RenameUser(ctx context.Context, oldUsername, newUser
 		return fmt.Errorf("rename user tokens: %w", err)
 	}
 
+	if _, err = tx.ExecContext(ctx, `UPDATE user_named_tokens SET username = ? WHERE username = ?`, newUsername, oldUsername); err != nil {
+		return fmt.Errorf("rename user named tokens: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE served_snapshots SET username = ? WHERE username = ?`, newUsername, oldUsername); err != nil {
+		return fmt.Errorf("rename user served snapshots: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE federation_peers SET owner = ? WHERE owner = ?`, newUsername, oldUsername); err != nil {
+		return fmt.Errorf("rename user federation peers: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE federation_upstream SET username = ? WHERE username = ?`, newUsername, oldUsername); err != nil {
+		return fmt.Errorf("rename user federation upstream: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE notifications SET username = ? WHERE username = ?`, newUsername, oldUsername); err != nil {
+		return fmt.Errorf("rename user notifications: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE trial_accounts SET username = ? WHERE username = ?`, newUsername, oldUsername); err != nil {
+		return fmt.Errorf("rename user trial account: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE node_deployments SET username = ? WHERE username = ?`, newUsername, oldUsername); err != nil {
+		return fmt.Errorf("rename user node deployments: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE dns_credentials SET username = ? WHERE username = ?`, newUsername, oldUsername); err != nil {
+		return fmt.Errorf("rename user dns credentials: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE subscription_client_ips SET username = ? WHERE username = ?`, newUsername, oldUsername); err != nil {
+		return fmt.Errorf("rename user subscription client ips: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM login_codes WHERE username = ?`, oldUsername); err != nil {
+		return fmt.Errorf("clear user login codes: %w", err)
+	}
+
 	return nil
 }
 
@@ -3082,7 +4659,7 @@ func (r *TrafficRepository) GetUserSubscriptions(ctx context.Context, username s
 	}
 
 	const stmt = `
-		SELECT s.id, s.name, COALESCE(s.description, ''), COALESCE(s.url, ''), s.type, s.filename, COALESCE(s.file_short_code, ''), COALESCE(s.auto_sync_custom_rules, 0), s.expire_at, s.created_at, s.updated_at
+		SELECT s.id, s.uuid, s.name, COALESCE(s.description, ''), COALESCE(s.url, ''), s.type, s.filename, COALESCE(s.file_short_code, ''), COALESCE(s.auto_sync_custom_rules, 0), s.expire_at, s.created_at, s.updated_at
 		FROM subscribe_files s
 		INNER JOIN user_subscriptions us ON s.id = us.subscription_id
 		WHERE us.username = ?
@@ -3099,7 +4676,7 @@ func (r *TrafficRepository) GetUserSubscriptions(ctx context.Context, username s
 		var sub SubscribeFile
 		var autoSync int
 		var expireAt sql.NullTime
-		if err := rows.Scan(&sub.ID, &sub.Name, &sub.Description, &sub.URL, &sub.Type, &sub.Filename, &sub.FileShortCode, &autoSync, &expireAt, &sub.CreatedAt, &sub.UpdatedAt); err != nil {
+		if err := rows.Scan(&sub.ID, &sub.UUID, &sub.Name, &sub.Description, &sub.URL, &sub.Type, &sub.Filename, &sub.FileShortCode, &autoSync, &expireAt, &sub.CreatedAt, &sub.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("scan subscription: %w", err)
 		}
 		sub.AutoSyncCustomRules = autoSync != 0
@@ -3128,11 +4705,11 @@ func (r *TrafficRepository) GetUserSettings(ctx context.Context, username string
 		return settings, errors.New("username is required")
 	}
 
-	const stmt = `SELECT username, force_sync_external, COALESCE(match_rule, 'node_name'), COALESCE(sync_scope, 'saved_only'), COALESCE(keep_node_name, 1), COALESCE(cache_expire_minutes, 0), COALESCE(sync_traffic, 0), COALESCE(enable_probe_binding, 0), COALESCE(custom_rules_enabled, 0), COALESCE(enable_short_link, 0), COALESCE(use_new_template_system, 1), COALESCE(enable_proxy_provider, 0), COALESCE(node_order, '[]'), COALESCE(debug_enabled, 0), COALESCE(debug_log_path, ''), debug_started_at, created_at, updated_at FROM user_settings WHERE username = ? LIMIT 1`
-	var forceSyncInt, keepNodeNameInt, syncTrafficInt, enableProbeBindingInt, customRulesEnabledInt, enableShortLinkInt, useNewTemplateSystemInt, enableProxyProviderInt, debugEnabledInt int
-	var nodeOrderJSON string
+	const stmt = `SELECT username, force_sync_external, COALESCE(match_rule, 'node_name'), COALESCE(sync_scope, 'saved_only'), COALESCE(keep_node_name, 1), COALESCE(cache_expire_minutes, 0), COALESCE(sync_traffic, 0), COALESCE(enable_probe_binding, 0), COALESCE(custom_rules_enabled, 0), COALESCE(enable_short_link, 0), COALESCE(use_new_template_system, 1), COALESCE(enable_proxy_provider, 0), COALESCE(node_order, '[]'), COALESCE(debug_enabled, 0), COALESCE(debug_log_path, ''), debug_started_at, COALESCE(preferences, '{}'), COALESCE(auto_disable_over_quota, 0), created_at, updated_at FROM user_settings WHERE username = ? LIMIT 1`
+	var forceSyncInt, keepNodeNameInt, syncTrafficInt, enableProbeBindingInt, customRulesEnabledInt, enableShortLinkInt, useNewTemplateSystemInt, enableProxyProviderInt, debugEnabledInt, autoDisableOverQuotaInt int
+	var nodeOrderJSON, preferencesJSON string
 	var debugStartedAt sql.NullTime
-	err := r.db.QueryRowContext(ctx, stmt, username).Scan(&settings.Username, &forceSyncInt, &settings.MatchRule, &settings.SyncScope, &keepNodeNameInt, &settings.CacheExpireMinutes, &syncTrafficInt, &enableProbeBindingInt, &customRulesEnabledInt, &enableShortLinkInt, &useNewTemplateSystemInt, &enableProxyProviderInt, &nodeOrderJSON, &debugEnabledInt, &settings.DebugLogPath, &debugStartedAt, &settings.CreatedAt, &settings.UpdatedAt)
+	err := r.db.QueryRowContext(ctx, stmt, username).Scan(&settings.Username, &forceSyncInt, &settings.MatchRule, &settings.SyncScope, &keepNodeNameInt, &settings.CacheExpireMinutes, &syncTrafficInt, &enableProbeBindingInt, &customRulesEnabledInt, &enableShortLinkInt, &useNewTemplateSystemInt, &enableProxyProviderInt, &nodeOrderJSON, &debugEnabledInt, &settings.DebugLogPath, &debugStartedAt, &preferencesJSON, &autoDisableOverQuotaInt, &settings.CreatedAt, &settings.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return settings, ErrUserSettingsNotFound
@@ -3149,6 +4726,7 @@ func (r *TrafficRepository) GetUserSettings(ctx context.Context, username string
 	settings.UseNewTemplateSystem = useNewTemplateSystemInt == 1
 	settings.EnableProxyProvider = enableProxyProviderInt == 1
 	settings.DebugEnabled = debugEnabledInt == 1
+	settings.AutoDisableOverQuota = autoDisableOverQuotaInt == 1
 
 	// Parse node_order JSON
 	if nodeOrderJSON != "" && nodeOrderJSON != "[]" {
@@ -3165,6 +4743,8 @@ func (r *TrafficRepository) GetUserSettings(ctx context.Context, username string
 		settings.DebugStartedAt = &debugStartedAt.Time
 	}
 
+	settings.Preferences = parseUserPreferences(preferencesJSON)
+
 	return settings, nil
 }
 
@@ -3224,6 +4804,11 @@ func (r *TrafficRepository) UpsertUserSettings(ctx context.Context, settings Use
 		debugEnabledInt = 1
 	}
 
+	autoDisableOverQuotaInt := 0
+	if settings.AutoDisableOverQuota {
+		autoDisableOverQuotaInt = 1
+	}
+
 	matchRule := strings.TrimSpace(settings.MatchRule)
 	if matchRule == "" {
 		matchRule = "node_name"
@@ -3249,8 +4834,8 @@ func (r *TrafficRepository) UpsertUserSettings(ctx context.Context, settings Use
 	}
 
 	const stmt = `
-		INSERT INTO user_settings (username, force_sync_external, match_rule, sync_scope, keep_node_name, cache_expire_minutes, sync_traffic, enable_probe_binding, custom_rules_enabled, enable_short_link, use_new_template_system, enable_proxy_provider, node_order, debug_enabled, debug_log_path, debug_started_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		INSERT INTO user_settings (username, force_sync_external, match_rule, sync_scope, keep_node_name, cache_expire_minutes, sync_traffic, enable_probe_binding, custom_rules_enabled, enable_short_link, use_new_template_system, enable_proxy_provider, node_order, debug_enabled, debug_log_path, debug_started_at, auto_disable_over_quota, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
 		ON CONFLICT(username) DO UPDATE SET
 			force_sync_external = excluded.force_sync_external,
 			match_rule = excluded.match_rule,
@@ -3267,16 +4852,52 @@ func (r *TrafficRepository) UpsertUserSettings(ctx context.Context, settings Use
 			debug_enabled = excluded.debug_enabled,
 			debug_log_path = excluded.debug_log_path,
 			debug_started_at = excluded.debug_started_at,
+			auto_disable_over_quota = excluded.auto_disable_over_quota,
 			updated_at = CURRENT_TIMESTAMP
 	`
 
-	if _, err := r.db.ExecContext(ctx, stmt, username, forceSyncInt, matchRule, syncScope, keepNodeNameInt, cacheExpireMinutes, syncTrafficInt, enableProbeBindingInt, customRulesEnabledInt, enableShortLinkInt, useNewTemplateSystemInt, enableProxyProviderInt, nodeOrderJSON, debugEnabledInt, settings.DebugLogPath, settings.DebugStartedAt); err != nil {
+	if _, err := r.db.ExecContext(ctx, stmt, username, forceSyncInt, matchRule, syncScope, keepNodeNameInt, cacheExpireMinutes, syncTrafficInt, enableProbeBindingInt, customRulesEnabledInt, enableShortLinkInt, useNewTemplateSystemInt, enableProxyProviderInt, nodeOrderJSON, debugEnabledInt, settings.DebugLogPath, settings.DebugStartedAt, autoDisableOverQuotaInt); err != nil {
 		return fmt.Errorf("upsert user settings: %w", err)
 	}
 
 	return nil
 }
 
+const externalSubscriptionColumns = `id, uuid, username, name, url, COALESCE(user_agent, 'clash-meta/2.4.0'), node_count, last_sync_at, COALESCE(upload, 0), COALESCE(download, 0), COALESCE(total, 0), expire, COALESCE(traffic_mode, 'both'), COALESCE(name_prefix, ''), COALESCE(name_suffix, ''), COALESCE(name_regex, ''), COALESCE(name_replacement, ''), COALESCE(fetch_proxy, ''), COALESCE(request_headers, '{}'), created_at, updated_at`
+
+func scanExternalSubscription(scanner rowScanner) (ExternalSubscription, error) {
+	var sub ExternalSubscription
+	var lastSyncAt, expire sql.NullTime
+	var headersJSON string
+	if err := scanner.Scan(&sub.ID, &sub.UUID, &sub.Username, &sub.Name, &sub.URL, &sub.UserAgent, &sub.NodeCount, &lastSyncAt, &sub.Upload, &sub.Download, &sub.Total, &expire, &sub.TrafficMode, &sub.NamePrefix, &sub.NameSuffix, &sub.NameRegex, &sub.NameReplacement, &sub.FetchProxy, &headersJSON, &sub.CreatedAt, &sub.UpdatedAt); err != nil {
+		return sub, err
+	}
+	sub.Headers = map[string]string{}
+	if headersJSON != "" && headersJSON != "{}" {
+		if err := json.Unmarshal([]byte(headersJSON), &sub.Headers); err != nil {
+			sub.Headers = map[string]string{}
+		}
+	}
+	if lastSyncAt.Valid {
+		sub.LastSyncAt = &lastSyncAt.Time
+	}
+	if expire.Valid {
+		sub.Expire = &expire.Time
+	}
+	return sub, nil
+}
+
+func encodeSubscriptionHeaders(headers map[string]string) string {
+	if len(headers) == 0 {
+		return "{}"
+	}
+	data, err := json.Marshal(headers)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
 // ListExternalSubscriptions returns all external subscriptions for a user.
 func (r *TrafficRepository) ListExternalSubscriptions(ctx context.Context, username string) ([]ExternalSubscription, error) {
 	if r == nil || r.db == nil {
@@ -3288,8 +4909,8 @@ func (r *TrafficRepository) ListExternalSubscriptions(ctx context.Context, usern
 		return nil, errors.New("username is required")
 	}
 
-	const stmt = `SELECT id, username, name, url, COALESCE(user_agent, 'clash-meta/2.4.0'), node_count, last_sync_at, COALESCE(upload, 0), COALESCE(download, 0), COALESCE(total, 0), expire, COALESCE(traffic_mode, 'both'), created_at, updated_at FROM external_subscriptions WHERE username = ? ORDER BY created_at DESC`
-	rows, err := r.db.QueryContext(ctx, stmt, username)
+	const stmt = `SELECT ` + externalSubscriptionColumns + ` FROM external_subscriptions WHERE username = ? ORDER BY created_at DESC`
+	rows, err := r.readQuery(ctx, stmt, username)
 	if err != nil {
 		return nil, fmt.Errorf("list external subscriptions: %w", err)
 	}
@@ -3297,17 +4918,10 @@ func (r *TrafficRepository) ListExternalSubscriptions(ctx context.Context, usern
 
 	var subs []ExternalSubscription
 	for rows.Next() {
-		var sub ExternalSubscription
-		var lastSyncAt, expire sql.NullTime
-		if err := rows.Scan(&sub.ID, &sub.Username, &sub.Name, &sub.URL, &sub.UserAgent, &sub.NodeCount, &lastSyncAt, &sub.Upload, &sub.Download, &sub.Total, &expire, &sub.TrafficMode, &sub.CreatedAt, &sub.UpdatedAt); err != nil {
+		sub, err := scanExternalSubscription(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan external subscription: %w", err)
 		}
-		if lastSyncAt.Valid {
-			sub.LastSyncAt = &lastSyncAt.Time
-		}
-		if expire.Valid {
-			sub.Expire = &expire.Time
-		}
 		subs = append(subs, sub)
 	}
 
@@ -3334,9 +4948,8 @@ func (r *TrafficRepository) GetExternalSubscription(ctx context.Context, id int6
 		return sub, errors.New("username is required")
 	}
 
-	const stmt = `SELECT id, username, name, url, COALESCE(user_agent, 'clash-meta/2.4.0'), node_count, last_sync_at, COALESCE(upload, 0), COALESCE(download, 0), COALESCE(total, 0), expire, COALESCE(traffic_mode, 'both'), created_at, updated_at FROM external_subscriptions WHERE id = ? AND username = ? LIMIT 1`
-	var lastSyncAt, expire sql.NullTime
-	err := r.db.QueryRowContext(ctx, stmt, id, username).Scan(&sub.ID, &sub.Username, &sub.Name, &sub.URL, &sub.UserAgent, &sub.NodeCount, &lastSyncAt, &sub.Upload, &sub.Download, &sub.Total, &expire, &sub.TrafficMode, &sub.CreatedAt, &sub.UpdatedAt)
+	const stmt = `SELECT ` + externalSubscriptionColumns + ` FROM external_subscriptions WHERE id = ? AND username = ? LIMIT 1`
+	sub, err := scanExternalSubscription(r.db.QueryRowContext(ctx, stmt, id, username))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return sub, ErrExternalSubscriptionNotFound
@@ -3344,13 +4957,6 @@ func (r *TrafficRepository) GetExternalSubscription(ctx context.Context, id int6
 		return sub, fmt.Errorf("get external subscription: %w", err)
 	}
 
-	if lastSyncAt.Valid {
-		sub.LastSyncAt = &lastSyncAt.Time
-	}
-	if expire.Valid {
-		sub.Expire = &expire.Time
-	}
-
 	return sub, nil
 }
 
@@ -3385,8 +4991,13 @@ func (r *TrafficRepository) CreateExternalSubscription(ctx context.Context, sub
 		trafficMode = "both"
 	}
 
-	const stmt = `INSERT INTO external_subscriptions (username, name, url, user_agent, node_count, last_sync_at, upload, download, total, expire, traffic_mode) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	result, err := r.db.ExecContext(ctx, stmt, username, name, url, userAgent, sub.NodeCount, sub.LastSyncAt, sub.Upload, sub.Download, sub.Total, sub.Expire, trafficMode)
+	publicUUID, err := publicID(sub.UUID)
+	if err != nil {
+		return 0, err
+	}
+
+	const stmt = `INSERT INTO external_subscriptions (uuid, username, name, url, user_agent, node_count, last_sync_at, upload, download, total, expire, traffic_mode, name_prefix, name_suffix, name_regex, name_replacement, fetch_proxy, request_headers) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := r.db.ExecContext(ctx, stmt, publicUUID, username, name, url, userAgent, sub.NodeCount, sub.LastSyncAt, sub.Upload, sub.Download, sub.Total, sub.Expire, trafficMode, sub.NamePrefix, sub.NameSuffix, strings.TrimSpace(sub.NameRegex), sub.NameReplacement, strings.TrimSpace(sub.FetchProxy), encodeSubscriptionHeaders(sub.Headers))
 	if err != nil {
 		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
 			return 0, ErrExternalSubscriptionExists
@@ -3437,8 +5048,8 @@ func (r *TrafficRepository) UpdateExternalSubscription(ctx context.Context, sub
 		trafficMode = "both"
 	}
 
-	const stmt = `UPDATE external_subscriptions SET name = ?, url = ?, user_agent = ?, node_count = ?, last_sync_at = ?, upload = ?, download = ?, total = ?, expire = ?, traffic_mode = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND username = ?`
-	result, err := r.db.ExecContext(ctx, stmt, name, url, userAgent, sub.NodeCount, sub.LastSyncAt, sub.Upload, sub.Download, sub.Total, sub.Expire, trafficMode, sub.ID, username)
+	const stmt = `UPDATE external_subscriptions SET name = ?, url = ?, user_agent = ?, node_count = ?, last_sync_at = ?, upload = ?, download = ?, total = ?, expire = ?, traffic_mode = ?, name_prefix = ?, name_suffix = ?, name_regex = ?, name_replacement = ?, fetch_proxy = ?, request_headers = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND username = ?`
+	result, err := r.db.ExecContext(ctx, stmt, name, url, userAgent, sub.NodeCount, sub.LastSyncAt, sub.Upload, sub.Download, sub.Total, sub.Expire, trafficMode, sub.NamePrefix, sub.NameSuffix, strings.TrimSpace(sub.NameRegex), sub.NameReplacement, strings.TrimSpace(sub.FetchProxy), encodeSubscriptionHeaders(sub.Headers), sub.ID, username)
 	if err != nil {
 		return fmt.Errorf("update external subscription: %w", err)
 	}
@@ -3476,6 +5087,11 @@ func (r *TrafficRepository) DeleteExternalSubscription(ctx context.Context, id i
 		return fmt.Errorf("delete related proxy provider configs: %w", err)
 	}
 
+	const deleteDiffsStmt = `DELETE FROM external_subscription_diffs WHERE subscription_id = ? AND username = ?`
+	if _, err := r.db.ExecContext(ctx, deleteDiffsStmt, id, username); err != nil {
+		return fmt.Errorf("delete related sync diffs: %w", err)
+	}
+
 	const stmt = `DELETE FROM external_subscriptions WHERE id = ? AND username = ?`
 	result, err := r.db.ExecContext(ctx, stmt, id, username)
 	if err != nil {
@@ -3880,7 +5496,7 @@ func (r *TrafficRepository) ListAllExternalSubscriptions(ctx context.Context) ([
 		return nil, errors.New("traffic repository not initialized")
 	}
 
-	const stmt = `SELECT id, username, name, url, COALESCE(user_agent, 'clash-meta/2.4.0'), node_count, last_sync_at, COALESCE(upload, 0), COALESCE(download, 0), COALESCE(total, 0), expire, COALESCE(traffic_mode, 'both'), created_at, updated_at FROM external_subscriptions ORDER BY created_at DESC`
+	const stmt = `SELECT ` + externalSubscriptionColumns + ` FROM external_subscriptions ORDER BY created_at DESC`
 	rows, err := r.db.QueryContext(ctx, stmt)
 	if err != nil {
 		return nil, fmt.Errorf("list all external subscriptions: %w", err)
@@ -3889,18 +5505,10 @@ func (r *TrafficRepository) ListAllExternalSubscriptions(ctx context.Context) ([
 
 	var subs []ExternalSubscription
 	for rows.Next() {
-		var sub ExternalSubscription
-		var lastSyncAt sql.NullTime
-		var expire sql.NullTime
-		if err := rows.Scan(&sub.ID, &sub.Username, &sub.Name, &sub.URL, &sub.UserAgent, &sub.NodeCount, &lastSyncAt, &sub.Upload, &sub.Download, &sub.Total, &expire, &sub.TrafficMode, &sub.CreatedAt, &sub.UpdatedAt); err != nil {
+		sub, err := scanExternalSubscription(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan external subscription: %w", err)
 		}
-		if lastSyncAt.Valid {
-			sub.LastSyncAt = &lastSyncAt.Time
-		}
-		if expire.Valid {
-			sub.Expire = &expire.Time
-		}
 		subs = append(subs, sub)
 	}
 
@@ -3917,7 +5525,7 @@ func (r *TrafficRepository) GetSubscribeFilesWithAutoSync(ctx context.Context) (
 		return nil, errors.New("traffic repository not initialized")
 	}
 
-	const query = `SELECT id, name, COALESCE(description, ''), url, type, filename, COALESCE(file_short_code, ''), auto_sync_custom_rules, expire_at, created_at, updated_at
+	const query = `SELECT id, uuid, name, COALESCE(description, ''), url, type, filename, COALESCE(file_short_code, ''), auto_sync_custom_rules, expire_at, created_at, updated_at
 		FROM subscribe_files
 		WHERE auto_sync_custom_rules = 1
 		ORDER BY created_at DESC`
@@ -3933,7 +5541,7 @@ func (r *TrafficRepository) GetSubscribeFilesWithAutoSync(ctx context.Context) (
 		var file SubscribeFile
 		var autoSync int
 		var expireAt sql.NullTime
-		if err := rows.Scan(&file.ID, &file.Name, &file.Description, &file.URL, &file.Type, &file.Filename, &file.FileShortCode, &autoSync, &expireAt, &file.CreatedAt, &file.UpdatedAt); err != nil {
+		if err := rows.Scan(&file.ID, &file.UUID, &file.Name, &file.Description, &file.URL, &file.Type, &file.Filename, &file.FileShortCode, &autoSync, &expireAt, &file.CreatedAt, &file.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("scan subscribe file: %w", err)
 		}
 		file.AutoSyncCustomRules = autoSync != 0
@@ -4070,7 +5678,7 @@ func (r *TrafficRepository) ListProxyProviderConfigs(ctx context.Context, userna
 		return nil, errors.New("traffic repository not initialized")
 	}
 
-	rows, err := r.db.QueryContext(ctx, `
+	rows, err := r.readQuery(ctx, `
 		SELECT id, username, external_subscription_id, name, type, interval, proxy, size_limit,
 			COALESCE(header, ''), health_check_enabled, health_check_url, health_check_interval,
 			health_check_timeout, health_check_lazy, health_check_expected_status,
@@ -4277,28 +5885,52 @@ func (r *TrafficRepository) DeleteProxyProviderConfig(ctx context.Context, id in
 // Returns an empty SystemConfig if the row doesn't exist (should not happen after migration).
 func (r *TrafficRepository) GetSystemConfig(ctx context.Context) (SystemConfig, error) {
 	const query = `
-SELECT proxy_groups_source_url, client_compatibility_mode, silent_mode, silent_mode_timeout
+SELECT proxy_groups_source_url, client_compatibility_mode, silent_mode, silent_mode_timeout, traffic_unit, COALESCE(fetch_proxy, ''), COALESCE(output_formats, '{}'), COALESCE(collector_schedule, ''), COALESCE(collector_timezone, ''), COALESCE(content_signing, ''), COALESCE(live_traffic, 0), COALESCE(quota_warning_percent, 0), COALESCE(expiry_warning_days, 0), COALESCE(strict_mode, 0), COALESCE(open_registration, 0), COALESCE(probe_alert_token, ''), COALESCE(probe_alert_exclude, 0), COALESCE(snapshot_retention_days, 0), COALESCE(node_name_normalize, 0), COALESCE(node_name_simplify, 0), COALESCE(node_name_strip_emoji, 0), COALESCE(collector_concurrency, 0), COALESCE(collector_panel_interval_ms, 0), COALESCE(grafana_token, ''), COALESCE(default_node_tag, ''), COALESCE(slow_threshold_ms, 0), COALESCE(stale_pull_days, 0), COALESCE(rule_cache_proxy, 0), COALESCE(geo_data_interval, 0), COALESCE(group_name_translations, '{}')
 FROM system_config
 WHERE id = 1
 `
 
 	var cfg SystemConfig
-	var compatibilityMode, silentMode, silentModeTimeout int
-	err := r.db.QueryRowContext(ctx, query).Scan(&cfg.ProxyGroupsSourceURL, &compatibilityMode, &silentMode, &silentModeTimeout)
+	var compatibilityMode, silentMode, silentModeTimeout, liveTraffic, strictMode, openRegistration, probeAlertExclude, nodeNameNormalize, nodeNameSimplify, nodeNameStripEmoji, ruleCacheProxy int
+	var outputFormatsJSON, groupNameTranslationsJSON string
+	err := r.db.QueryRowContext(ctx, query).Scan(&cfg.ProxyGroupsSourceURL, &compatibilityMode, &silentMode, &silentModeTimeout, &cfg.TrafficUnit, &cfg.FetchProxy, &outputFormatsJSON, &cfg.CollectorSchedule, &cfg.CollectorTimezone, &cfg.ContentSigning, &liveTraffic, &cfg.QuotaWarningPercent, &cfg.ExpiryWarningDays, &strictMode, &openRegistration, &cfg.ProbeAlertToken, &probeAlertExclude, &cfg.SnapshotRetentionDays, &nodeNameNormalize, &nodeNameSimplify, &nodeNameStripEmoji, &cfg.CollectorConcurrency, &cfg.CollectorPanelInterval, &cfg.GrafanaToken, &cfg.DefaultNodeTag, &cfg.SlowThresholdMs, &cfg.StalePullDays, &ruleCacheProxy, &cfg.GeoDataInterval, &groupNameTranslationsJSON)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			// Return empty config if row doesn't exist (defensive)
-			return SystemConfig{SilentModeTimeout: 15}, nil
+			return SystemConfig{SilentModeTimeout: 15, TrafficUnit: TrafficUnitBinary}, nil
 		}
 		return SystemConfig{}, fmt.Errorf("query system config: %w", err)
 	}
 
 	cfg.ClientCompatibilityMode = compatibilityMode != 0
 	cfg.SilentMode = silentMode != 0
+	cfg.LiveTraffic = liveTraffic != 0
+	cfg.StrictMode = strictMode != 0
+	cfg.OpenRegistration = openRegistration != 0
+	cfg.ProbeAlertExclude = probeAlertExclude != 0
+	cfg.NodeNameNormalize = nodeNameNormalize != 0
+	cfg.NodeNameSimplify = nodeNameSimplify != 0
+	cfg.NodeNameStripEmoji = nodeNameStripEmoji != 0
+	cfg.RuleCacheProxy = ruleCacheProxy != 0
 	cfg.SilentModeTimeout = silentModeTimeout
 	if cfg.SilentModeTimeout <= 0 {
 		cfg.SilentModeTimeout = 15
 	}
+	if cfg.TrafficUnit != TrafficUnitDecimal {
+		cfg.TrafficUnit = TrafficUnitBinary
+	}
+	cfg.OutputFormats = map[string]OutputFormatOverride{}
+	if outputFormatsJSON != "" && outputFormatsJSON != "{}" {
+		if err := json.Unmarshal([]byte(outputFormatsJSON), &cfg.OutputFormats); err != nil {
+			cfg.OutputFormats = map[string]OutputFormatOverride{}
+		}
+	}
+	cfg.GroupNameTranslations = map[string]string{}
+	if groupNameTranslationsJSON != "" && groupNameTranslationsJSON != "{}" {
+		if err := json.Unmarshal([]byte(groupNameTranslationsJSON), &cfg.GroupNameTranslations); err != nil {
+			cfg.GroupNameTranslations = map[string]string{}
+		}
+	}
 	return cfg, nil
 }
 
@@ -4311,6 +5943,32 @@ SET proxy_groups_source_url = ?,
     client_compatibility_mode = ?,
     silent_mode = ?,
     silent_mode_timeout = ?,
+    traffic_unit = ?,
+    fetch_proxy = ?,
+    output_formats = ?,
+    collector_schedule = ?,
+    collector_timezone = ?,
+    content_signing = ?,
+    live_traffic = ?,
+    quota_warning_percent = ?,
+    expiry_warning_days = ?,
+    strict_mode = ?,
+    open_registration = ?,
+    probe_alert_token = ?,
+    probe_alert_exclude = ?,
+    snapshot_retention_days = ?,
+    node_name_normalize = ?,
+    node_name_simplify = ?,
+    node_name_strip_emoji = ?,
+    collector_concurrency = ?,
+    collector_panel_interval_ms = ?,
+    grafana_token = ?,
+    default_node_tag = ?,
+    slow_threshold_ms = ?,
+    stale_pull_days = ?,
+    rule_cache_proxy = ?,
+    geo_data_interval = ?,
+    group_name_translations = ?,
     updated_at = CURRENT_TIMESTAMP
 WHERE id = 1
 `
@@ -4327,8 +5985,36 @@ WHERE id = 1
 	if silentModeTimeout <= 0 {
 		silentModeTimeout = 15
 	}
+	trafficUnit := cfg.TrafficUnit
+	if trafficUnit != TrafficUnitDecimal {
+		trafficUnit = TrafficUnitBinary
+	}
+
+	fetchProxy := strings.TrimSpace(cfg.FetchProxy)
+
+	outputFormats := "{}"
+	if len(cfg.OutputFormats) > 0 {
+		data, err := json.Marshal(cfg.OutputFormats)
+		if err != nil {
+			return fmt.Errorf("encode output formats: %w", err)
+		}
+		outputFormats = string(data)
+	}
+
+	groupNameTranslations := "{}"
+	if len(cfg.GroupNameTranslations) > 0 {
+		data, err := json.Marshal(cfg.GroupNameTranslations)
+		if err != nil {
+			return fmt.Errorf("encode group name translations: %w", err)
+		}
+		groupNameTranslations = string(data)
+	}
+
+	collectorSchedule := strings.TrimSpace(cfg.CollectorSchedule)
+	collectorTimezone := strings.TrimSpace(cfg.CollectorTimezone)
+	contentSigning := strings.TrimSpace(cfg.ContentSigning)
 
-	result, err := r.db.ExecContext(ctx, updateStmt, cfg.ProxyGroupsSourceURL, compatibilityMode, silentMode, silentModeTimeout)
+	result, err := r.db.ExecContext(ctx, updateStmt, cfg.ProxyGroupsSourceURL, compatibilityMode, silentMode, silentModeTimeout, trafficUnit, fetchProxy, outputFormats, collectorSchedule, collectorTimezone, contentSigning, boolToInt(cfg.LiveTraffic), cfg.QuotaWarningPercent, cfg.ExpiryWarningDays, boolToInt(cfg.StrictMode), boolToInt(cfg.OpenRegistration), cfg.ProbeAlertToken, boolToInt(cfg.ProbeAlertExclude), cfg.SnapshotRetentionDays, boolToInt(cfg.NodeNameNormalize), boolToInt(cfg.NodeNameSimplify), boolToInt(cfg.NodeNameStripEmoji), cfg.CollectorConcurrency, cfg.CollectorPanelInterval, cfg.GrafanaToken, cfg.DefaultNodeTag, cfg.SlowThresholdMs, cfg.StalePullDays, boolToInt(cfg.RuleCacheProxy), cfg.GeoDataInterval, groupNameTranslations)
 	if err != nil {
 		return fmt.Errorf("update system config: %w", err)
 	}
@@ -4341,10 +6027,10 @@ WHERE id = 1
 	// If no rows were updated, insert the singleton row (defensive fallback)
 	if rowsAffected == 0 {
 		const insertStmt = `
-INSERT INTO system_config (id, proxy_groups_source_url, client_compatibility_mode, silent_mode, silent_mode_timeout)
-VALUES (1, ?, ?, ?, ?)
+INSERT INTO system_config (id, proxy_groups_source_url, client_compatibility_mode, silent_mode, silent_mode_timeout, traffic_unit, fetch_proxy, output_formats, collector_schedule, collector_timezone, content_signing, live_traffic, quota_warning_percent, expiry_warning_days, strict_mode, open_registration, probe_alert_token, probe_alert_exclude, snapshot_retention_days, node_name_normalize, node_name_simplify, node_name_strip_emoji, collector_concurrency, collector_panel_interval_ms, grafana_token, default_node_tag, slow_threshold_ms, stale_pull_days, rule_cache_proxy, geo_data_interval, group_name_translations)
+VALUES (1, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 `
-		if _, err := r.db.ExecContext(ctx, insertStmt, cfg.ProxyGroupsSourceURL, compatibilityMode, silentMode, silentModeTimeout); err != nil {
+		if _, err := r.db.ExecContext(ctx, insertStmt, cfg.ProxyGroupsSourceURL, compatibilityMode, silentMode, silentModeTimeout, trafficUnit, fetchProxy, outputFormats, collectorSchedule, collectorTimezone, contentSigning, boolToInt(cfg.LiveTraffic), cfg.QuotaWarningPercent, cfg.ExpiryWarningDays, boolToInt(cfg.StrictMode), boolToInt(cfg.OpenRegistration), cfg.ProbeAlertToken, boolToInt(cfg.ProbeAlertExclude), cfg.SnapshotRetentionDays, boolToInt(cfg.NodeNameNormalize), boolToInt(cfg.NodeNameSimplify), boolToInt(cfg.NodeNameStripEmoji), cfg.CollectorConcurrency, cfg.CollectorPanelInterval, cfg.GrafanaToken, cfg.DefaultNodeTag, cfg.SlowThresholdMs, cfg.StalePullDays, boolToInt(cfg.RuleCacheProxy), cfg.GeoDataInterval, groupNameTranslations); err != nil {
 			return fmt.Errorf("insert system config: %w", err)
 		}
 	}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TrafficAlertRule notifies admins when a probe server's usage reaches ThresholdPercent of its
+// monthly_traffic_bytes. ConfigID 0 applies to every probe configuration; an empty ServerID applies
+// to every server of the configuration.
+type TrafficAlertRule struct {
+	ID               int64
+	Name             string
+	ThresholdPercent float64
+	ConfigID         int64
+	ServerID         string
+	Enabled          bool
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// Matches reports whether the rule applies to the given server.
+func (rule TrafficAlertRule) Matches(configID int64, serverID string) bool {
+	if rule.ConfigID != 0 && rule.ConfigID != configID {
+		return false
+	}
+	return rule.ServerID == "" || rule.ServerID == serverID
+}
+
+const trafficAlertRuleColumns = `id, name, threshold_percent, config_id, server_id, enabled, created_at, updated_at`
+
+func scanTrafficAlertRule(scanner rowScanner) (TrafficAlertRule, error) {
+	var rule TrafficAlertRule
+	var enabled int
+	if err := scanner.Scan(&rule.ID, &rule.Name, &rule.ThresholdPercent, &rule.ConfigID, &rule.ServerID, &enabled, &rule.CreatedAt, &rule.UpdatedAt); err != nil {
+		return TrafficAlertRule{}, err
+	}
+	rule.Enabled = enabled != 0
+	return rule, nil
+}
+
+func validateTrafficAlertRule(rule TrafficAlertRule) (TrafficAlertRule, error) {
+	rule.Name = strings.TrimSpace(rule.Name)
+	rule.ServerID = strings.TrimSpace(rule.ServerID)
+	if rule.ThresholdPercent <= 0 || rule.ThresholdPercent > 1000 {
+		return TrafficAlertRule{}, errors.New("threshold percent must be between 0 and 1000")
+	}
+	if rule.ConfigID < 0 {
+		return TrafficAlertRule{}, errors.New("invalid probe config id")
+	}
+	if rule.ConfigID == 0 && rule.ServerID != "" {
+		return TrafficAlertRule{}, errors.New("server id requires a probe config id")
+	}
+	return rule, nil
+}
+
+// ListTrafficAlertRules returns every alert rule ordered by threshold.
+func (r *TrafficRepository) ListTrafficAlertRules(ctx context.Context) ([]TrafficAlertRule, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+trafficAlertRuleColumns+` FROM traffic_alert_rules ORDER BY threshold_percent ASC, id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("list traffic alert rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []TrafficAlertRule
+	for rows.Next() {
+		rule, err := scanTrafficAlertRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan traffic alert rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate traffic alert rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// GetTrafficAlertRule returns a single alert rule.
+func (r *TrafficRepository) GetTrafficAlertRule(ctx context.Context, id int64) (TrafficAlertRule, error) {
+	if r == nil || r.db == nil {
+		return TrafficAlertRule{}, errors.New("traffic repository not initialized")
+	}
+
+	rule, err := scanTrafficAlertRule(r.db.QueryRowContext(ctx, `SELECT `+trafficAlertRuleColumns+` FROM traffic_alert_rules WHERE id = ?`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return TrafficAlertRule{}, ErrTrafficAlertRuleNotFound
+		}
+		return TrafficAlertRule{}, fmt.Errorf("get traffic alert rule: %w", err)
+	}
+
+	return rule, nil
+}
+
+// CreateTrafficAlertRule stores a new alert rule.
+func (r *TrafficRepository) CreateTrafficAlertRule(ctx context.Context, rule TrafficAlertRule) (TrafficAlertRule, error) {
+	if r == nil || r.db == nil {
+		return TrafficAlertRule{}, errors.New("traffic repository not initialized")
+	}
+
+	rule, err := validateTrafficAlertRule(rule)
+	if err != nil {
+		return TrafficAlertRule{}, err
+	}
+
+	result, err := r.db.ExecContext(ctx, `INSERT INTO traffic_alert_rules (name, threshold_percent, config_id, server_id, enabled) VALUES (?, ?, ?, ?, ?)`,
+		rule.Name, rule.ThresholdPercent, rule.ConfigID, rule.ServerID, boolToInt(rule.Enabled))
+	if err != nil {
+		return TrafficAlertRule{}, fmt.Errorf("create traffic alert rule: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return TrafficAlertRule{}, fmt.Errorf("get traffic alert rule id: %w", err)
+	}
+
+	return r.GetTrafficAlertRule(ctx, id)
+}
+
+// UpdateTrafficAlertRule replaces an existing alert rule.
+func (r *TrafficRepository) UpdateTrafficAlertRule(ctx context.Context, rule TrafficAlertRule) (TrafficAlertRule, error) {
+	if r == nil || r.db == nil {
+		return TrafficAlertRule{}, errors.New("traffic repository not initialized")
+	}
+
+	rule, err := validateTrafficAlertRule(rule)
+	if err != nil {
+		return TrafficAlertRule{}, err
+	}
+
+	result, err := r.db.ExecContext(ctx, `UPDATE traffic_alert_rules SET name = ?, threshold_percent = ?, config_id = ?, server_id = ?, enabled = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		rule.Name, rule.ThresholdPercent, rule.ConfigID, rule.ServerID, boolToInt(rule.Enabled), rule.ID)
+	if err != nil {
+		return TrafficAlertRule{}, fmt.Errorf("update traffic alert rule: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return TrafficAlertRule{}, ErrTrafficAlertRuleNotFound
+	}
+
+	return r.GetTrafficAlertRule(ctx, rule.ID)
+}
+
+// DeleteTrafficAlertRule removes an alert rule.
+func (r *TrafficRepository) DeleteTrafficAlertRule(ctx context.Context, id int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM traffic_alert_rules WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete traffic alert rule: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrTrafficAlertRuleNotFound
+	}
+
+	return nil
+}
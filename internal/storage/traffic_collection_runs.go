@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 流量收集结果状态
+const (
+	TrafficCollectionSuccess = "success"
+	TrafficCollectionPartial = "partial"
+	TrafficCollectionFailed  = "failed"
+)
+
+// maxTrafficCollectionRuns 保留的收集记录条数
+const maxTrafficCollectionRuns = 100
+
+// TrafficCollectionFailure describes a probe server whose traffic could not be collected.
+type TrafficCollectionFailure struct {
+	ConfigID   int64  `json:"config_id"`
+	ConfigName string `json:"config_name"`
+	ServerID   string `json:"server_id,omitempty"`
+	ServerName string `json:"server_name,omitempty"`
+	Attempts   int    `json:"attempts"`
+	Error      string `json:"error"`
+}
+
+// TrafficCollectionPanel records how long one probe panel took during a collection.
+type TrafficCollectionPanel struct {
+	ConfigID   int64  `json:"config_id"`
+	ConfigName string `json:"config_name"`
+	ProbeType  string `json:"probe_type"`
+	Servers    int    `json:"servers"`
+	Attempts   int    `json:"attempts"`
+	DurationMs int64  `json:"duration_ms"` // Including retries and rate-limit waits
+	Error      string `json:"error,omitempty"`
+}
+
+// TrafficCollectionRun is the persisted outcome of one traffic collection.
+type TrafficCollectionRun struct {
+	ID            int64
+	StartedAt     time.Time
+	FinishedAt    time.Time
+	Status        string
+	ServersTotal  int
+	ServersFailed int
+	Failures      []TrafficCollectionFailure
+	Concurrency   int // Probe panels fetched in parallel during this run
+	Panels        []TrafficCollectionPanel
+	Error         string
+}
+
+// Duration returns the wall-clock time the collection took.
+func (run TrafficCollectionRun) Duration() time.Duration {
+	if run.FinishedAt.Before(run.StartedAt) {
+		return 0
+	}
+	return run.FinishedAt.Sub(run.StartedAt)
+}
+
+// RecordTrafficCollectionRun stores a collection outcome and prunes old runs.
+func (r *TrafficRepository) RecordTrafficCollectionRun(ctx context.Context, run TrafficCollectionRun) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	failures := run.Failures
+	if failures == nil {
+		failures = []TrafficCollectionFailure{}
+	}
+	encoded, err := json.Marshal(failures)
+	if err != nil {
+		return fmt.Errorf("encode collection failures: %w", err)
+	}
+
+	panels := run.Panels
+	if panels == nil {
+		panels = []TrafficCollectionPanel{}
+	}
+	encodedPanels, err := json.Marshal(panels)
+	if err != nil {
+		return fmt.Errorf("encode collection panels: %w", err)
+	}
+
+	if _, err := r.db.ExecContext(ctx, `INSERT INTO traffic_collection_runs (started_at, finished_at, status, servers_total, servers_failed, failures, concurrency, panels, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.StartedAt.UTC(), run.FinishedAt.UTC(), run.Status, run.ServersTotal, run.ServersFailed, string(encoded), run.Concurrency, string(encodedPanels), run.Error); err != nil {
+		return fmt.Errorf("insert traffic collection run: %w", err)
+	}
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM traffic_collection_runs WHERE id NOT IN (SELECT id FROM traffic_collection_runs ORDER BY id DESC LIMIT ?)`, maxTrafficCollectionRuns); err != nil {
+		return fmt.Errorf("prune traffic collection runs: %w", err)
+	}
+
+	return nil
+}
+
+// ListTrafficCollectionRuns returns the most recent collection runs, newest first.
+func (r *TrafficRepository) ListTrafficCollectionRuns(ctx context.Context, limit int) ([]TrafficCollectionRun, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+	if limit <= 0 || limit > maxTrafficCollectionRuns {
+		limit = maxTrafficCollectionRuns
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id, started_at, finished_at, status, servers_total, servers_failed, failures, concurrency, panels, error FROM traffic_collection_runs ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list traffic collection runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []TrafficCollectionRun
+	for rows.Next() {
+		run, err := scanTrafficCollectionRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate traffic collection runs: %w", err)
+	}
+
+	return runs, nil
+}
+
+// LatestTrafficCollectionRun returns the most recent collection run, if any.
+func (r *TrafficRepository) LatestTrafficCollectionRun(ctx context.Context) (TrafficCollectionRun, bool, error) {
+	runs, err := r.ListTrafficCollectionRuns(ctx, 1)
+	if err != nil {
+		return TrafficCollectionRun{}, false, err
+	}
+	if len(runs) == 0 {
+		return TrafficCollectionRun{}, false, nil
+	}
+	return runs[0], true, nil
+}
+
+func scanTrafficCollectionRun(rows *sql.Rows) (TrafficCollectionRun, error) {
+	var run TrafficCollectionRun
+	var failures, panels string
+	if err := rows.Scan(&run.ID, &run.StartedAt, &run.FinishedAt, &run.Status, &run.ServersTotal, &run.ServersFailed, &failures, &run.Concurrency, &panels, &run.Error); err != nil {
+		return TrafficCollectionRun{}, fmt.Errorf("scan traffic collection run: %w", err)
+	}
+	if err := json.Unmarshal([]byte(failures), &run.Failures); err != nil {
+		return TrafficCollectionRun{}, fmt.Errorf("decode collection failures: %w", err)
+	}
+	if err := json.Unmarshal([]byte(panels), &run.Panels); err != nil {
+		return TrafficCollectionRun{}, fmt.Errorf("decode collection panels: %w", err)
+	}
+	return run, nil
+}
@@ -0,0 +1,401 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTrialLinkNotFound    = errors.New("trial link not found")
+	ErrTrialLinkExists      = errors.New("trial link code already exists")
+	ErrTrialAccountNotFound = errors.New("trial account not found")
+	// ErrTrialLinkInvalid 试用链接不存在、已过期或已用完，对外统一返回该错误
+	ErrTrialLinkInvalid = errors.New("trial link is invalid, expired or used up")
+)
+
+// DefaultTrialDurationHours 试用账号默认有效期（3 天）
+const DefaultTrialDurationHours = 72
+
+// TrialLink 管理员生成的试用链接，每次兑换创建一个限时的普通用户
+type TrialLink struct {
+	ID              int64
+	Code            string
+	SubscriptionIDs []int64
+	MaxNodes        int   // 订阅中最多下发的节点数，0 表示不限制
+	TrafficQuota    int64 // 订阅信息中展示的流量总量（字节），0 表示沿用实际统计
+	DurationHours   int
+	MaxUses         int
+	UsedCount       int
+	ExpiresAt       *time.Time
+	Note            string
+	CreatedBy       string
+	CreatedAt       time.Time
+}
+
+// Usable reports whether the trial link can still be redeemed at the given time.
+func (link TrialLink) Usable(now time.Time) bool {
+	if link.UsedCount >= link.MaxUses {
+		return false
+	}
+	return link.ExpiresAt == nil || now.Before(*link.ExpiresAt)
+}
+
+// TrialAccount 通过试用链接创建的账号及其限制
+type TrialAccount struct {
+	Username     string
+	TrialLinkID  int64
+	ClientIP     string
+	MaxNodes     int
+	TrafficQuota int64
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
+
+// TrialRedemption 兑换试用链接时生成的账号信息
+type TrialRedemption struct {
+	Code         string
+	Username     string
+	PasswordHash string
+	ClientIP     string
+}
+
+const trialLinkColumns = `id, code, subscription_ids, max_nodes, traffic_quota, duration_hours, max_uses, used_count, expires_at, note, created_by, created_at`
+
+const trialAccountColumns = `username, trial_link_id, client_ip, max_nodes, traffic_quota, expires_at, created_at`
+
+func scanTrialLink(scanner interface{ Scan(...any) error }) (TrialLink, error) {
+	var (
+		link            TrialLink
+		subscriptionIDs string
+		expiresAt       sql.NullTime
+	)
+	if err := scanner.Scan(&link.ID, &link.Code, &subscriptionIDs, &link.MaxNodes, &link.TrafficQuota, &link.DurationHours, &link.MaxUses, &link.UsedCount, &expiresAt, &link.Note, &link.CreatedBy, &link.CreatedAt); err != nil {
+		return TrialLink{}, err
+	}
+	if subscriptionIDs != "" {
+		if err := json.Unmarshal([]byte(subscriptionIDs), &link.SubscriptionIDs); err != nil {
+			return TrialLink{}, fmt.Errorf("decode trial link subscriptions: %w", err)
+		}
+	}
+	if expiresAt.Valid {
+		t := expiresAt.Time
+		link.ExpiresAt = &t
+	}
+	return link, nil
+}
+
+func scanTrialAccount(scanner interface{ Scan(...any) error }) (TrialAccount, error) {
+	var account TrialAccount
+	if err := scanner.Scan(&account.Username, &account.TrialLinkID, &account.ClientIP, &account.MaxNodes, &account.TrafficQuota, &account.ExpiresAt, &account.CreatedAt); err != nil {
+		return TrialAccount{}, err
+	}
+	return account, nil
+}
+
+// CreateTrialLink stores a new trial link. A random code is generated when link.Code is empty.
+func (r *TrafficRepository) CreateTrialLink(ctx context.Context, link TrialLink) (TrialLink, error) {
+	if r == nil || r.db == nil {
+		return TrialLink{}, errors.New("traffic repository not initialized")
+	}
+
+	link.Code = strings.ToUpper(strings.TrimSpace(link.Code))
+	if link.MaxUses <= 0 {
+		link.MaxUses = 1
+	}
+	if link.DurationHours <= 0 {
+		link.DurationHours = DefaultTrialDurationHours
+	}
+	if link.MaxNodes < 0 {
+		link.MaxNodes = 0
+	}
+	if link.TrafficQuota < 0 {
+		link.TrafficQuota = 0
+	}
+	if link.SubscriptionIDs == nil {
+		link.SubscriptionIDs = []int64{}
+	}
+	subscriptionIDs, err := json.Marshal(link.SubscriptionIDs)
+	if err != nil {
+		return TrialLink{}, fmt.Errorf("encode trial link subscriptions: %w", err)
+	}
+
+	var expiresAt any
+	if link.ExpiresAt != nil {
+		expiresAt = link.ExpiresAt.UTC()
+	}
+
+	generated := link.Code == ""
+	for attempt := 0; attempt < 5; attempt++ {
+		if generated {
+			if link.Code, err = randomInvitationCode(16); err != nil {
+				return TrialLink{}, err
+			}
+		}
+
+		const stmt = `INSERT OR IGNORE INTO trial_links (code, subscription_ids, max_nodes, traffic_quota, duration_hours, max_uses, expires_at, note, created_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		result, err := r.db.ExecContext(ctx, stmt, link.Code, string(subscriptionIDs), link.MaxNodes, link.TrafficQuota, link.DurationHours, link.MaxUses, expiresAt, strings.TrimSpace(link.Note), strings.TrimSpace(link.CreatedBy))
+		if err != nil {
+			return TrialLink{}, fmt.Errorf("create trial link: %w", err)
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected > 0 {
+			id, err := result.LastInsertId()
+			if err != nil {
+				return TrialLink{}, fmt.Errorf("trial link last insert id: %w", err)
+			}
+			return r.GetTrialLink(ctx, id)
+		}
+		if !generated {
+			return TrialLink{}, ErrTrialLinkExists
+		}
+	}
+
+	return TrialLink{}, errors.New("create trial link: too many collisions")
+}
+
+// GetTrialLink returns a trial link by ID.
+func (r *TrafficRepository) GetTrialLink(ctx context.Context, id int64) (TrialLink, error) {
+	if r == nil || r.db == nil {
+		return TrialLink{}, errors.New("traffic repository not initialized")
+	}
+
+	row := r.db.QueryRowContext(ctx, `SELECT `+trialLinkColumns+` FROM trial_links WHERE id = ?`, id)
+	link, err := scanTrialLink(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return TrialLink{}, ErrTrialLinkNotFound
+		}
+		return TrialLink{}, fmt.Errorf("get trial link: %w", err)
+	}
+	return link, nil
+}
+
+// GetTrialLinkByCode returns a trial link by its code.
+func (r *TrafficRepository) GetTrialLinkByCode(ctx context.Context, code string) (TrialLink, error) {
+	if r == nil || r.db == nil {
+		return TrialLink{}, errors.New("traffic repository not initialized")
+	}
+
+	row := r.db.QueryRowContext(ctx, `SELECT `+trialLinkColumns+` FROM trial_links WHERE code = ?`, strings.ToUpper(strings.TrimSpace(code)))
+	link, err := scanTrialLink(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return TrialLink{}, ErrTrialLinkNotFound
+		}
+		return TrialLink{}, fmt.Errorf("get trial link: %w", err)
+	}
+	return link, nil
+}
+
+// ListTrialLinks returns all trial links, newest first.
+func (r *TrafficRepository) ListTrialLinks(ctx context.Context) ([]TrialLink, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+trialLinkColumns+` FROM trial_links ORDER BY id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("list trial links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []TrialLink
+	for rows.Next() {
+		link, err := scanTrialLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan trial link: %w", err)
+		}
+		links = append(links, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate trial links: %w", err)
+	}
+	return links, nil
+}
+
+// DeleteTrialLink revokes a trial link. Trial accounts already created with it keep running until they expire.
+func (r *TrafficRepository) DeleteTrialLink(ctx context.Context, id int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM trial_links WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete trial link: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delete trial link rows affected: %w", err)
+	}
+	if affected == 0 {
+		return ErrTrialLinkNotFound
+	}
+	return nil
+}
+
+// RedeemTrialLink consumes one use of the trial link and creates an expiring user with the link's
+// subscriptions and limits in a single transaction.
+func (r *TrafficRepository) RedeemTrialLink(ctx context.Context, redemption TrialRedemption) (User, TrialAccount, error) {
+	if r == nil || r.db == nil {
+		return User{}, TrialAccount{}, errors.New("traffic repository not initialized")
+	}
+
+	code := strings.ToUpper(strings.TrimSpace(redemption.Code))
+	username := strings.TrimSpace(redemption.Username)
+	if code == "" {
+		return User{}, TrialAccount{}, ErrTrialLinkInvalid
+	}
+	if username == "" {
+		return User{}, TrialAccount{}, errors.New("username is required")
+	}
+	if redemption.PasswordHash == "" {
+		return User{}, TrialAccount{}, errors.New("password hash is required")
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return User{}, TrialAccount{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, `SELECT `+trialLinkColumns+` FROM trial_links WHERE code = ?`, code)
+	link, err := scanTrialLink(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, TrialAccount{}, ErrTrialLinkInvalid
+		}
+		return User{}, TrialAccount{}, fmt.Errorf("get trial link: %w", err)
+	}
+	now := time.Now().UTC()
+	if !link.Usable(now) {
+		return User{}, TrialAccount{}, ErrTrialLinkInvalid
+	}
+
+	// 条件更新防止并发兑换超出可用次数
+	result, err := tx.ExecContext(ctx, `UPDATE trial_links SET used_count = used_count + 1 WHERE id = ? AND used_count < max_uses`, link.ID)
+	if err != nil {
+		return User{}, TrialAccount{}, fmt.Errorf("consume trial link: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return User{}, TrialAccount{}, ErrTrialLinkInvalid
+	}
+
+	account := TrialAccount{
+		Username:     username,
+		TrialLinkID:  link.ID,
+		ClientIP:     strings.TrimSpace(redemption.ClientIP),
+		MaxNodes:     link.MaxNodes,
+		TrafficQuota: link.TrafficQuota,
+		ExpiresAt:    now.Add(time.Duration(link.DurationHours) * time.Hour),
+		CreatedAt:    now,
+	}
+
+	const insertUser = `INSERT INTO users (username, password_hash, email, nickname, role, is_active, remark, expires_at) VALUES (?, ?, '', ?, ?, 1, ?, ?)`
+	if _, err := tx.ExecContext(ctx, insertUser, username, redemption.PasswordHash, username, RoleUser, "trial:"+link.Code, account.ExpiresAt); err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			return User{}, TrialAccount{}, ErrUserExists
+		}
+		return User{}, TrialAccount{}, fmt.Errorf("create user: %w", err)
+	}
+
+	const insertAccount = `INSERT INTO trial_accounts (username, trial_link_id, client_ip, max_nodes, traffic_quota, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	if _, err := tx.ExecContext(ctx, insertAccount, account.Username, account.TrialLinkID, account.ClientIP, account.MaxNodes, account.TrafficQuota, account.ExpiresAt, account.CreatedAt); err != nil {
+		return User{}, TrialAccount{}, fmt.Errorf("create trial account: %w", err)
+	}
+
+	for _, id := range link.SubscriptionIDs {
+		// 订阅可能在试用链接生成后被删除，忽略不存在的订阅
+		const stmt = `INSERT INTO user_subscriptions (username, subscription_id) SELECT ?, id FROM subscribe_files WHERE id = ?`
+		if _, err := tx.ExecContext(ctx, stmt, username, id); err != nil {
+			return User{}, TrialAccount{}, fmt.Errorf("assign trial subscription %d: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return User{}, TrialAccount{}, fmt.Errorf("commit transaction: %w", err)
+	}
+
+	user, err := r.GetUser(ctx, username)
+	if err != nil {
+		return User{}, TrialAccount{}, err
+	}
+	return user, account, nil
+}
+
+// GetTrialAccount returns the trial limits of a user, or ErrTrialAccountNotFound for regular accounts.
+func (r *TrafficRepository) GetTrialAccount(ctx context.Context, username string) (TrialAccount, error) {
+	if r == nil || r.db == nil {
+		return TrialAccount{}, errors.New("traffic repository not initialized")
+	}
+
+	row := r.db.QueryRowContext(ctx, `SELECT `+trialAccountColumns+` FROM trial_accounts WHERE username = ?`, strings.TrimSpace(username))
+	account, err := scanTrialAccount(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return TrialAccount{}, ErrTrialAccountNotFound
+		}
+		return TrialAccount{}, fmt.Errorf("get trial account: %w", err)
+	}
+	return account, nil
+}
+
+// FindActiveTrialAccount returns the unexpired trial account created from the link by the same client IP,
+// so that revisiting the link doesn't create another account.
+func (r *TrafficRepository) FindActiveTrialAccount(ctx context.Context, linkID int64, clientIP string, now time.Time) (TrialAccount, error) {
+	if r == nil || r.db == nil {
+		return TrialAccount{}, errors.New("traffic repository not initialized")
+	}
+
+	clientIP = strings.TrimSpace(clientIP)
+	if clientIP == "" {
+		return TrialAccount{}, ErrTrialAccountNotFound
+	}
+
+	row := r.db.QueryRowContext(ctx, `SELECT `+trialAccountColumns+` FROM trial_accounts WHERE trial_link_id = ? AND client_ip = ? AND expires_at > ? ORDER BY created_at DESC LIMIT 1`, linkID, clientIP, now.UTC())
+	account, err := scanTrialAccount(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return TrialAccount{}, ErrTrialAccountNotFound
+		}
+		return TrialAccount{}, fmt.Errorf("find trial account: %w", err)
+	}
+	return account, nil
+}
+
+// ListTrialAccounts returns the trial accounts, optionally limited to one link (linkID > 0), newest first.
+func (r *TrafficRepository) ListTrialAccounts(ctx context.Context, linkID int64) ([]TrialAccount, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	query := `SELECT ` + trialAccountColumns + ` FROM trial_accounts`
+	var args []any
+	if linkID > 0 {
+		query += ` WHERE trial_link_id = ?`
+		args = append(args, linkID)
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list trial accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var accounts []TrialAccount
+	for rows.Next() {
+		account, err := scanTrialAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan trial account: %w", err)
+		}
+		accounts = append(accounts, account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate trial accounts: %w", err)
+	}
+	return accounts, nil
+}
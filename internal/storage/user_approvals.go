@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// UserApprovalPending 开放注册创建的账号在管理员审核前处于该状态
+const UserApprovalPending = "pending"
+
+// ErrPendingUserNotFound 账号不存在或不在审核队列中
+var ErrPendingUserNotFound = errors.New("pending registration not found")
+
+// CreatePendingUser stores an open-registration account as inactive and queues it for approval.
+func (r *TrafficRepository) CreatePendingUser(ctx context.Context, username, passwordHash, email, nickname string) (User, error) {
+	if r == nil || r.db == nil {
+		return User{}, errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	email = strings.TrimSpace(email)
+	nickname = strings.TrimSpace(nickname)
+	if username == "" {
+		return User{}, errors.New("username is required")
+	}
+	if passwordHash == "" {
+		return User{}, errors.New("password hash is required")
+	}
+	if nickname == "" {
+		nickname = username
+	}
+
+	const stmt = `INSERT INTO users (username, password_hash, email, nickname, role, is_active, remark, approval_status) VALUES (?, ?, ?, ?, ?, 0, '', ?)`
+	if _, err := r.db.ExecContext(ctx, stmt, username, passwordHash, email, nickname, RoleUser, UserApprovalPending); err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			return User{}, ErrUserExists
+		}
+		return User{}, fmt.Errorf("create pending user: %w", err)
+	}
+
+	return r.GetUser(ctx, username)
+}
+
+// ListPendingUsers returns accounts awaiting approval, oldest first.
+func (r *TrafficRepository) ListPendingUsers(ctx context.Context) ([]User, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT username, COALESCE(email, ''), COALESCE(nickname, ''), COALESCE(role, ''), is_active, created_at, updated_at FROM users WHERE approval_status = ? ORDER BY created_at ASC`, UserApprovalPending)
+	if err != nil {
+		return nil, fmt.Errorf("list pending users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var (
+			user   User
+			active int
+		)
+		if err := rows.Scan(&user.Username, &user.Email, &user.Nickname, &user.Role, &active, &user.CreatedAt, &user.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan pending user: %w", err)
+		}
+		user.IsActive = active != 0
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate pending users: %w", err)
+	}
+	return users, nil
+}
+
+// ApprovePendingUser activates a queued account.
+func (r *TrafficRepository) ApprovePendingUser(ctx context.Context, username string) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	res, err := r.db.ExecContext(ctx, `UPDATE users SET is_active = 1, approval_status = '', updated_at = CURRENT_TIMESTAMP WHERE username = ? AND approval_status = ?`, strings.TrimSpace(username), UserApprovalPending)
+	if err != nil {
+		return fmt.Errorf("approve user: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("approve user rows affected: %w", err)
+	}
+	if affected == 0 {
+		return ErrPendingUserNotFound
+	}
+	return nil
+}
+
+// RejectPendingUser deletes a queued account so the username can be registered again.
+func (r *TrafficRepository) RejectPendingUser(ctx context.Context, username string) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	var status string
+	if err := r.db.QueryRowContext(ctx, `SELECT approval_status FROM users WHERE username = ?`, username).Scan(&status); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPendingUserNotFound
+		}
+		return fmt.Errorf("get approval status: %w", err)
+	}
+	if status != UserApprovalPending {
+		return ErrPendingUserNotFound
+	}
+
+	return r.DeleteUser(ctx, username)
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UpdateUserExpiry sets the account expiry of a user. A nil expiresAt removes the expiry.
+func (r *TrafficRepository) UpdateUserExpiry(ctx context.Context, username string, expiresAt *time.Time) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return errors.New("username is required")
+	}
+
+	var expires any
+	if expiresAt != nil {
+		expires = expiresAt.UTC()
+	}
+
+	res, err := r.db.ExecContext(ctx, `UPDATE users SET expires_at = ?, updated_at = CURRENT_TIMESTAMP WHERE username = ?`, expires, username)
+	if err != nil {
+		return fmt.Errorf("update user expiry: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("user expiry rows affected: %w", err)
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// DeactivateExpiredUsers disables every active account whose expiry has passed and returns their usernames.
+func (r *TrafficRepository) DeactivateExpiredUsers(ctx context.Context, now time.Time) ([]string, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT username, expires_at FROM users WHERE is_active = 1 AND expires_at IS NOT NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("list expiring users: %w", err)
+	}
+
+	var expired []string
+	for rows.Next() {
+		var (
+			username  string
+			expiresAt time.Time
+		)
+		if err := rows.Scan(&username, &expiresAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan expiring user: %w", err)
+		}
+		if !expiresAt.After(now) {
+			expired = append(expired, username)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("iterate expiring users: %w", err)
+	}
+	rows.Close()
+
+	for _, username := range expired {
+		if _, err := r.db.ExecContext(ctx, `UPDATE users SET is_active = 0, updated_at = CURRENT_TIMESTAMP WHERE username = ?`, username); err != nil {
+			return nil, fmt.Errorf("deactivate expired user %s: %w", username, err)
+		}
+	}
+	return expired, nil
+}
+
+// checkUserNotExpired returns ErrUserExpired when the account has an expiry in the past.
+func (r *TrafficRepository) checkUserNotExpired(ctx context.Context, username string) error {
+	var expiresAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, `SELECT expires_at FROM users WHERE username = ?`, username).Scan(&expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("query user expiry: %w", err)
+	}
+	if expiresAt.Valid && !expiresAt.Time.After(time.Now()) {
+		return fmt.Errorf("%w: %w", ErrTokenNotFound, ErrUserExpired)
+	}
+	return nil
+}
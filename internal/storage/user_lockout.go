@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// loginLockoutRetention 未锁定的失败记录保留多久，超过后清理
+const loginLockoutRetention = 24 * time.Hour
+
+// UserLockout 账户在某个客户端 IP 上的登录失败计数与锁定状态
+type UserLockout struct {
+	Username     string
+	ClientIP     string
+	FailedLogins int
+	LockedUntil  *time.Time
+}
+
+// Locked reports whether the account is still locked at the given time.
+func (l UserLockout) Locked(now time.Time) bool {
+	return l.LockedUntil != nil && now.Before(*l.LockedUntil)
+}
+
+// GetUserLockout returns the failed login counter and lock state of a user for one client IP.
+// Unknown usernames yield an empty lockout so callers don't reveal which accounts exist.
+func (r *TrafficRepository) GetUserLockout(ctx context.Context, username, clientIP string) (UserLockout, error) {
+	if r == nil || r.db == nil {
+		return UserLockout{}, errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	clientIP = strings.TrimSpace(clientIP)
+	lockout := UserLockout{Username: username, ClientIP: clientIP}
+	var lockedUntil sql.NullTime
+	err := r.db.QueryRowContext(ctx, `SELECT failed_count, locked_until FROM login_lockouts WHERE username = ? AND client_ip = ?`, username, clientIP).Scan(&lockout.FailedLogins, &lockedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return lockout, nil
+		}
+		return UserLockout{}, fmt.Errorf("get user lockout: %w", err)
+	}
+	if lockedUntil.Valid {
+		t := lockedUntil.Time
+		lockout.LockedUntil = &t
+	}
+	return lockout, nil
+}
+
+// ListUserLockouts returns the lock state of every user that has failed logins or a lock, keyed by
+// username. When several client IPs are tracked the highest counter and latest lock are reported.
+func (r *TrafficRepository) ListUserLockouts(ctx context.Context) (map[string]UserLockout, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT username, client_ip, failed_count, locked_until FROM login_lockouts`)
+	if err != nil {
+		return nil, fmt.Errorf("list user lockouts: %w", err)
+	}
+	defer rows.Close()
+
+	lockouts := make(map[string]UserLockout)
+	for rows.Next() {
+		var (
+			lockout     UserLockout
+			lockedUntil sql.NullTime
+		)
+		if err := rows.Scan(&lockout.Username, &lockout.ClientIP, &lockout.FailedLogins, &lockedUntil); err != nil {
+			return nil, fmt.Errorf("scan user lockout: %w", err)
+		}
+		merged := lockouts[lockout.Username]
+		merged.Username = lockout.Username
+		merged.FailedLogins = max(merged.FailedLogins, lockout.FailedLogins)
+		if lockedUntil.Valid && (merged.LockedUntil == nil || lockedUntil.Time.After(*merged.LockedUntil)) {
+			t := lockedUntil.Time
+			merged.LockedUntil = &t
+			merged.ClientIP = lockout.ClientIP
+		}
+		lockouts[lockout.Username] = merged
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate user lockouts: %w", err)
+	}
+	return lockouts, nil
+}
+
+// RecordLoginFailure increments the failed login counter of a user on one client IP and locks that
+// pair for lockFor once threshold consecutive failures are reached. The counter restarts after each
+// lock. Failures for unknown usernames are not recorded.
+func (r *TrafficRepository) RecordLoginFailure(ctx context.Context, username, clientIP string, threshold int, lockFor time.Duration) (UserLockout, error) {
+	if r == nil || r.db == nil {
+		return UserLockout{}, errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	clientIP = strings.TrimSpace(clientIP)
+	if username == "" {
+		return UserLockout{Username: username, ClientIP: clientIP}, nil
+	}
+
+	now := time.Now().UTC()
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM login_lockouts WHERE updated_at < ? AND (locked_until IS NULL OR locked_until < ?)`, now.Add(-loginLockoutRetention), now); err != nil {
+		return UserLockout{}, fmt.Errorf("prune login lockouts: %w", err)
+	}
+
+	lockedUntil := now.Add(lockFor)
+	const stmt = `
+INSERT INTO login_lockouts (username, client_ip, failed_count, locked_until, updated_at)
+SELECT username, ?, CASE WHEN 1 >= ? THEN 0 ELSE 1 END, CASE WHEN 1 >= ? THEN ? ELSE NULL END, ? FROM users WHERE username = ?
+ON CONFLICT(username, client_ip) DO UPDATE SET
+    failed_count = CASE WHEN failed_count + 1 >= ? THEN 0 ELSE failed_count + 1 END,
+    locked_until = CASE WHEN failed_count + 1 >= ? THEN ? ELSE locked_until END,
+    updated_at = excluded.updated_at
+`
+	if _, err := r.db.ExecContext(ctx, stmt, clientIP, threshold, threshold, lockedUntil, now, username, threshold, threshold, lockedUntil); err != nil {
+		return UserLockout{}, fmt.Errorf("record login failure: %w", err)
+	}
+
+	return r.GetUserLockout(ctx, username, clientIP)
+}
+
+// ResetLoginFailures clears the failed login counter of a user on one client IP after a successful login.
+func (r *TrafficRepository) ResetLoginFailures(ctx context.Context, username, clientIP string) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM login_lockouts WHERE username = ? AND client_ip = ?`, strings.TrimSpace(username), strings.TrimSpace(clientIP)); err != nil {
+		return fmt.Errorf("reset login failures: %w", err)
+	}
+	return nil
+}
+
+// UnlockUser clears the locks and failed login counters of a user on every client IP.
+func (r *TrafficRepository) UnlockUser(ctx context.Context, username string) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	var exists int
+	if err := r.db.QueryRowContext(ctx, `SELECT 1 FROM users WHERE username = ?`, username).Scan(&exists); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("unlock user: %w", err)
+	}
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM login_lockouts WHERE username = ?`, username); err != nil {
+		return fmt.Errorf("unlock user: %w", err)
+	}
+	return nil
+}
+
+// IsLastActiveAdmin reports whether username is the only active admin account. The login handler
+// never hard-locks that account so a failed-login flood can't lock every admin out of the panel.
+func (r *TrafficRepository) IsLastActiveAdmin(ctx context.Context, username string) (bool, error) {
+	if r == nil || r.db == nil {
+		return false, errors.New("traffic repository not initialized")
+	}
+
+	var isAdmin, others int
+	const stmt = `
+SELECT
+    COALESCE(SUM(CASE WHEN username = ? THEN 1 ELSE 0 END), 0),
+    COALESCE(SUM(CASE WHEN username <> ? THEN 1 ELSE 0 END), 0)
+FROM users WHERE role = ? AND is_active = 1
+`
+	username = strings.TrimSpace(username)
+	if err := r.db.QueryRowContext(ctx, stmt, username, username, RoleAdmin).Scan(&isAdmin, &others); err != nil {
+		return false, fmt.Errorf("count active admins: %w", err)
+	}
+	return isAdmin > 0 && others == 0, nil
+}
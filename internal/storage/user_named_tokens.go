@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrNamedTokenNotFound = errors.New("named token not found")
+
+// UserNamedToken is an extra subscription token with its own label, expiry and revocation.
+type UserNamedToken struct {
+	ID         int64
+	Username   string
+	Label      string
+	Token      string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// Expired reports whether the token has passed its expiry time.
+func (t UserNamedToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !t.ExpiresAt.After(now)
+}
+
+// CreateUserNamedToken issues a new labeled token for the user. A nil expiresAt never expires.
+func (r *TrafficRepository) CreateUserNamedToken(ctx context.Context, username, label string, expiresAt *time.Time) (UserNamedToken, error) {
+	if r == nil || r.db == nil {
+		return UserNamedToken{}, errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	label = strings.TrimSpace(label)
+	if username == "" || label == "" {
+		return UserNamedToken{}, errors.New("username and label are required")
+	}
+
+	var expires any
+	if expiresAt != nil {
+		expires = expiresAt.UTC()
+	}
+
+	token := uuid.NewString()
+	const stmt = `INSERT INTO user_named_tokens (username, label, token, expires_at) VALUES (?, ?, ?, ?)`
+	res, err := r.db.ExecContext(ctx, stmt, username, label, token, expires)
+	if err != nil {
+		return UserNamedToken{}, fmt.Errorf("create user named token: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return UserNamedToken{}, fmt.Errorf("user named token id: %w", err)
+	}
+
+	return r.getUserNamedToken(ctx, id, username)
+}
+
+// ListUserNamedTokens returns the user's named tokens, newest first, including expired ones.
+func (r *TrafficRepository) ListUserNamedTokens(ctx context.Context, username string) ([]UserNamedToken, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	const query = `SELECT id, username, label, token, expires_at, last_used_at, created_at FROM user_named_tokens WHERE username = ? ORDER BY created_at DESC, id DESC`
+	rows, err := r.db.QueryContext(ctx, query, strings.TrimSpace(username))
+	if err != nil {
+		return nil, fmt.Errorf("list user named tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []UserNamedToken
+	for rows.Next() {
+		token, err := scanUserNamedToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate user named tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// RevokeUserNamedToken deletes one of the user's named tokens.
+func (r *TrafficRepository) RevokeUserNamedToken(ctx context.Context, id int64, username string) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	res, err := r.db.ExecContext(ctx, `DELETE FROM user_named_tokens WHERE id = ? AND username = ?`, id, strings.TrimSpace(username))
+	if err != nil {
+		return fmt.Errorf("revoke user named token: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("revoke user named token rows affected: %w", err)
+	}
+	if affected == 0 {
+		return ErrNamedTokenNotFound
+	}
+
+	return nil
+}
+
+// RevokeAllUserNamedTokens deletes every named token of the user and reports how many were removed.
+func (r *TrafficRepository) RevokeAllUserNamedTokens(ctx context.Context, username string) (int64, error) {
+	if r == nil || r.db == nil {
+		return 0, errors.New("traffic repository not initialized")
+	}
+
+	res, err := r.db.ExecContext(ctx, `DELETE FROM user_named_tokens WHERE username = ?`, strings.TrimSpace(username))
+	if err != nil {
+		return 0, fmt.Errorf("revoke all user named tokens: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("revoke all user named tokens rows affected: %w", err)
+	}
+	return affected, nil
+}
+
+// validateNamedToken resolves an unexpired named token to its username and records its use.
+func (r *TrafficRepository) validateNamedToken(ctx context.Context, token string) (string, error) {
+	now := time.Now().UTC()
+
+	const stmt = `SELECT id, username FROM user_named_tokens WHERE token = ? AND (expires_at IS NULL OR expires_at > ?) LIMIT 1`
+	var (
+		id       int64
+		username string
+	)
+	if err := r.db.QueryRowContext(ctx, stmt, token, now).Scan(&id, &username); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrTokenNotFound
+		}
+		return "", fmt.Errorf("query user named token: %w", err)
+	}
+
+	// 最后使用时间仅供展示，写入失败不影响鉴权
+	_, _ = r.db.ExecContext(ctx, `UPDATE user_named_tokens SET last_used_at = ? WHERE id = ?`, now, id)
+
+	return username, nil
+}
+
+func (r *TrafficRepository) getUserNamedToken(ctx context.Context, id int64, username string) (UserNamedToken, error) {
+	const query = `SELECT id, username, label, token, expires_at, last_used_at, created_at FROM user_named_tokens WHERE id = ? AND username = ?`
+	token, err := scanUserNamedToken(r.db.QueryRowContext(ctx, query, id, username))
+	if errors.Is(err, sql.ErrNoRows) {
+		return UserNamedToken{}, ErrNamedTokenNotFound
+	}
+	return token, err
+}
+
+func scanUserNamedToken(scanner interface{ Scan(...any) error }) (UserNamedToken, error) {
+	var (
+		token      UserNamedToken
+		expiresAt  sql.NullTime
+		lastUsedAt sql.NullTime
+	)
+	if err := scanner.Scan(&token.ID, &token.Username, &token.Label, &token.Token, &expiresAt, &lastUsedAt, &token.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return UserNamedToken{}, err
+		}
+		return UserNamedToken{}, fmt.Errorf("scan user named token: %w", err)
+	}
+	if expiresAt.Valid {
+		t := expiresAt.Time
+		token.ExpiresAt = &t
+	}
+	if lastUsedAt.Valid {
+		t := lastUsedAt.Time
+		token.LastUsedAt = &t
+	}
+	return token, nil
+}
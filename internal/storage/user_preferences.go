@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Well-known preference keys. Unknown keys are stored as-is so the frontend can add new
+// preferences without a backend change.
+const (
+	PreferenceDefaultTarget  = "default_target"  // 默认订阅输出格式（客户端类型）
+	PreferenceLanguage       = "language"        // 界面语言，例如 zh-CN、en-US
+	PreferenceDefaultFilters = "default_filters" // 默认节点过滤关键字
+	PreferenceConfigLanguage = "config_language" // 生成配置中代理组名称与提示节点的语言：zh（默认）或 en
+)
+
+// MaxUserPreferencesSize limits the encoded size of a user's preferences.
+const MaxUserPreferencesSize = 64 << 10
+
+var ErrUserPreferencesTooLarge = errors.New("user preferences too large")
+
+// UserPreferences holds generic per-user preferences as raw JSON values keyed by name.
+type UserPreferences map[string]json.RawMessage
+
+// String returns the string preference for key, or def when missing or not a string.
+func (p UserPreferences) String(key, def string) string {
+	raw, ok := p[key]
+	if !ok {
+		return def
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return def
+	}
+	return value
+}
+
+// Bool returns the boolean preference for key, or def when missing or not a boolean.
+func (p UserPreferences) Bool(key string, def bool) bool {
+	raw, ok := p[key]
+	if !ok {
+		return def
+	}
+	var value bool
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return def
+	}
+	return value
+}
+
+// StringSlice returns the string array preference for key, or nil when missing or invalid.
+func (p UserPreferences) StringSlice(key string) []string {
+	raw, ok := p[key]
+	if !ok {
+		return nil
+	}
+	var value []string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil
+	}
+	return value
+}
+
+// Set stores value under key. A nil value removes the key.
+func (p UserPreferences) Set(key string, value any) error {
+	if value == nil {
+		delete(p, key)
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encode preference %s: %w", key, err)
+	}
+	p[key] = data
+	return nil
+}
+
+// DefaultTarget returns the preferred subscription output format.
+func (p UserPreferences) DefaultTarget() string {
+	return p.String(PreferenceDefaultTarget, "")
+}
+
+// Language returns the preferred UI language.
+func (p UserPreferences) Language() string {
+	return p.String(PreferenceLanguage, "")
+}
+
+// DefaultFilters returns the preferred default node filters.
+func (p UserPreferences) DefaultFilters() []string {
+	return p.StringSlice(PreferenceDefaultFilters)
+}
+
+// ConfigLanguage returns the language of generated proxy group names, "zh" unless set to "en".
+func (p UserPreferences) ConfigLanguage() string {
+	if p.String(PreferenceConfigLanguage, "") == "en" {
+		return "en"
+	}
+	return "zh"
+}
+
+func parseUserPreferences(encoded string) UserPreferences {
+	prefs := UserPreferences{}
+	if strings.TrimSpace(encoded) == "" {
+		return prefs
+	}
+	if err := json.Unmarshal([]byte(encoded), &prefs); err != nil || prefs == nil {
+		return UserPreferences{}
+	}
+	return prefs
+}
+
+// GetUserPreferences returns the stored preferences for a user (empty when none are saved).
+func (r *TrafficRepository) GetUserPreferences(ctx context.Context, username string) (UserPreferences, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, errors.New("username is required")
+	}
+
+	var encoded string
+	err := r.db.QueryRowContext(ctx, `SELECT COALESCE(preferences, '{}') FROM user_settings WHERE username = ? LIMIT 1`, username).Scan(&encoded)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return UserPreferences{}, nil
+		}
+		return nil, fmt.Errorf("get user preferences: %w", err)
+	}
+
+	return parseUserPreferences(encoded), nil
+}
+
+// UpdateUserPreferences merges updates into the user's stored preferences and returns the result.
+// Keys whose value is JSON null are removed.
+func (r *TrafficRepository) UpdateUserPreferences(ctx context.Context, username string, updates UserPreferences) (UserPreferences, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, errors.New("username is required")
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var encoded string
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(preferences, '{}') FROM user_settings WHERE username = ? LIMIT 1`, username).Scan(&encoded)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("get user preferences: %w", err)
+	}
+
+	prefs := parseUserPreferences(encoded)
+	for key, value := range updates {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if len(value) == 0 || string(value) == "null" {
+			delete(prefs, key)
+			continue
+		}
+		prefs[key] = value
+	}
+
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		return nil, fmt.Errorf("encode user preferences: %w", err)
+	}
+	if len(data) > MaxUserPreferencesSize {
+		return nil, ErrUserPreferencesTooLarge
+	}
+
+	const stmt = `
+		INSERT INTO user_settings (username, preferences, updated_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(username) DO UPDATE SET
+			preferences = excluded.preferences,
+			updated_at = CURRENT_TIMESTAMP`
+	if _, err := tx.ExecContext(ctx, stmt, username, string(data)); err != nil {
+		return nil, fmt.Errorf("update user preferences: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit user preferences: %w", err)
+	}
+
+	return prefs, nil
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrWebAuthnCredentialNotFound = errors.New("webauthn credential not found")
+	ErrWebAuthnCredentialExists   = errors.New("webauthn credential already registered")
+)
+
+// WebAuthnCredential 用户注册的 passkey，公钥以 COSE 格式保存
+type WebAuthnCredential struct {
+	ID           int64
+	Username     string
+	CredentialID string // base64url（无填充）编码的凭据 ID
+	PublicKey    []byte
+	SignCount    uint32
+	Name         string
+	CreatedAt    time.Time
+	LastUsedAt   *time.Time
+}
+
+const webauthnCredentialColumns = `id, username, credential_id, public_key, sign_count, name, created_at, last_used_at`
+
+func scanWebAuthnCredential(scanner interface{ Scan(...any) error }) (WebAuthnCredential, error) {
+	var (
+		cred       WebAuthnCredential
+		signCount  int64
+		lastUsedAt sql.NullTime
+	)
+	if err := scanner.Scan(&cred.ID, &cred.Username, &cred.CredentialID, &cred.PublicKey, &signCount, &cred.Name, &cred.CreatedAt, &lastUsedAt); err != nil {
+		return WebAuthnCredential{}, err
+	}
+	cred.SignCount = uint32(signCount)
+	if lastUsedAt.Valid {
+		t := lastUsedAt.Time
+		cred.LastUsedAt = &t
+	}
+	return cred, nil
+}
+
+// CreateWebAuthnCredential stores a newly registered passkey for the user.
+func (r *TrafficRepository) CreateWebAuthnCredential(ctx context.Context, cred WebAuthnCredential) (WebAuthnCredential, error) {
+	if r == nil || r.db == nil {
+		return WebAuthnCredential{}, errors.New("traffic repository not initialized")
+	}
+
+	cred.Username = strings.TrimSpace(cred.Username)
+	cred.CredentialID = strings.TrimSpace(cred.CredentialID)
+	cred.Name = strings.TrimSpace(cred.Name)
+	if cred.Username == "" {
+		return WebAuthnCredential{}, errors.New("username is required")
+	}
+	if cred.CredentialID == "" || len(cred.PublicKey) == 0 {
+		return WebAuthnCredential{}, errors.New("credential id and public key are required")
+	}
+
+	var exists int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(1) FROM webauthn_credentials WHERE credential_id = ?`, cred.CredentialID).Scan(&exists); err != nil {
+		return WebAuthnCredential{}, fmt.Errorf("check webauthn credential: %w", err)
+	}
+	if exists > 0 {
+		return WebAuthnCredential{}, ErrWebAuthnCredentialExists
+	}
+
+	const stmt = `INSERT INTO webauthn_credentials (username, credential_id, public_key, sign_count, name) VALUES (?, ?, ?, ?, ?)`
+	result, err := r.db.ExecContext(ctx, stmt, cred.Username, cred.CredentialID, cred.PublicKey, int64(cred.SignCount), cred.Name)
+	if err != nil {
+		return WebAuthnCredential{}, fmt.Errorf("create webauthn credential: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return WebAuthnCredential{}, fmt.Errorf("webauthn credential last insert id: %w", err)
+	}
+
+	row := r.db.QueryRowContext(ctx, `SELECT `+webauthnCredentialColumns+` FROM webauthn_credentials WHERE id = ?`, id)
+	created, err := scanWebAuthnCredential(row)
+	if err != nil {
+		return WebAuthnCredential{}, fmt.Errorf("get webauthn credential: %w", err)
+	}
+	return created, nil
+}
+
+// ListWebAuthnCredentials returns the user's passkeys, oldest first.
+func (r *TrafficRepository) ListWebAuthnCredentials(ctx context.Context, username string) ([]WebAuthnCredential, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, errors.New("username is required")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+webauthnCredentialColumns+` FROM webauthn_credentials WHERE username = ? ORDER BY id ASC`, username)
+	if err != nil {
+		return nil, fmt.Errorf("list webauthn credentials: %w", err)
+	}
+	defer rows.Close()
+
+	var creds []WebAuthnCredential
+	for rows.Next() {
+		cred, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan webauthn credential: %w", err)
+		}
+		creds = append(creds, cred)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webauthn credentials: %w", err)
+	}
+	return creds, nil
+}
+
+// GetWebAuthnCredential looks up a passkey by its credential ID.
+func (r *TrafficRepository) GetWebAuthnCredential(ctx context.Context, credentialID string) (WebAuthnCredential, error) {
+	if r == nil || r.db == nil {
+		return WebAuthnCredential{}, errors.New("traffic repository not initialized")
+	}
+
+	credentialID = strings.TrimSpace(credentialID)
+	if credentialID == "" {
+		return WebAuthnCredential{}, ErrWebAuthnCredentialNotFound
+	}
+
+	row := r.db.QueryRowContext(ctx, `SELECT `+webauthnCredentialColumns+` FROM webauthn_credentials WHERE credential_id = ?`, credentialID)
+	cred, err := scanWebAuthnCredential(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return WebAuthnCredential{}, ErrWebAuthnCredentialNotFound
+		}
+		return WebAuthnCredential{}, fmt.Errorf("get webauthn credential: %w", err)
+	}
+	return cred, nil
+}
+
+// TouchWebAuthnCredential records a successful assertion and stores the authenticator's new sign counter.
+func (r *TrafficRepository) TouchWebAuthnCredential(ctx context.Context, id int64, signCount uint32) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	const stmt = `UPDATE webauthn_credentials SET sign_count = ?, last_used_at = ? WHERE id = ?`
+	result, err := r.db.ExecContext(ctx, stmt, int64(signCount), time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("update webauthn credential: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+	return nil
+}
+
+// DeleteWebAuthnCredential removes one of the user's passkeys.
+func (r *TrafficRepository) DeleteWebAuthnCredential(ctx context.Context, username string, id int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM webauthn_credentials WHERE id = ? AND username = ?`, id, strings.TrimSpace(username))
+	if err != nil {
+		return fmt.Errorf("delete webauthn credential: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delete webauthn credential rows affected: %w", err)
+	}
+	if affected == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrWebhookNotFound is returned when a webhook does not exist.
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+const (
+	WebhookDeliveryPending = "pending"
+	WebhookDeliverySuccess = "success"
+	WebhookDeliveryFailed  = "failed"
+
+	// maxWebhookDeliveries 投递记录保留的最大条数
+	maxWebhookDeliveries = 1000
+)
+
+// Webhook is an admin-configured endpoint that receives signed JSON events.
+// An empty Events list subscribes to every event.
+type Webhook struct {
+	ID        int64
+	Name      string
+	URL       string
+	Secret    string
+	Events    []string
+	Enabled   bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// WebhookDelivery is one event sent (or being retried) to a webhook.
+type WebhookDelivery struct {
+	ID             int64
+	WebhookID      int64
+	Event          string
+	Payload        string
+	Status         string
+	Attempts       int
+	ResponseStatus int
+	Error          string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// Subscribes reports whether the webhook receives the event.
+func (w Webhook) Subscribes(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event || e == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *TrafficRepository) scanWebhook(scanner interface{ Scan(dest ...any) error }) (Webhook, error) {
+	var (
+		hook         Webhook
+		sealedSecret string
+		eventsJSON   string
+		enabled      int
+	)
+	if err := scanner.Scan(&hook.ID, &hook.Name, &hook.URL, &sealedSecret, &eventsJSON, &enabled, &hook.CreatedAt, &hook.UpdatedAt); err != nil {
+		return Webhook{}, err
+	}
+	secret, err := r.secrets.Open(sealedSecret)
+	if err != nil {
+		return Webhook{}, fmt.Errorf("open webhook secret: %w", err)
+	}
+	hook.Secret = secret
+	if err := json.Unmarshal([]byte(eventsJSON), &hook.Events); err != nil {
+		return Webhook{}, fmt.Errorf("decode webhook events: %w", err)
+	}
+	hook.Enabled = enabled != 0
+	return hook, nil
+}
+
+const webhookColumns = `id, name, url, secret, events, enabled, created_at, updated_at`
+
+// ListWebhooks returns all webhooks ordered by id.
+func (r *TrafficRepository) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+webhookColumns+` FROM webhooks ORDER BY id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var hooks []Webhook
+	for rows.Next() {
+		hook, err := r.scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook: %w", err)
+		}
+		hooks = append(hooks, hook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhooks: %w", err)
+	}
+
+	return hooks, nil
+}
+
+// GetWebhook returns a single webhook.
+func (r *TrafficRepository) GetWebhook(ctx context.Context, id int64) (Webhook, error) {
+	if r == nil || r.db == nil {
+		return Webhook{}, errors.New("traffic repository not initialized")
+	}
+
+	hook, err := r.scanWebhook(r.db.QueryRowContext(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Webhook{}, ErrWebhookNotFound
+		}
+		return Webhook{}, fmt.Errorf("get webhook: %w", err)
+	}
+	return hook, nil
+}
+
+func (r *TrafficRepository) encodeWebhook(hook Webhook) (string, string, error) {
+	sealedSecret, err := r.secrets.Seal(strings.TrimSpace(hook.Secret))
+	if err != nil {
+		return "", "", fmt.Errorf("seal webhook secret: %w", err)
+	}
+	events := hook.Events
+	if events == nil {
+		events = []string{}
+	}
+	eventsJSON, err := json.Marshal(events)
+	if err != nil {
+		return "", "", fmt.Errorf("encode webhook events: %w", err)
+	}
+	return sealedSecret, string(eventsJSON), nil
+}
+
+// CreateWebhook stores a new webhook.
+func (r *TrafficRepository) CreateWebhook(ctx context.Context, hook Webhook) (Webhook, error) {
+	if r == nil || r.db == nil {
+		return Webhook{}, errors.New("traffic repository not initialized")
+	}
+
+	sealedSecret, eventsJSON, err := r.encodeWebhook(hook)
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	res, err := r.db.ExecContext(ctx, `INSERT INTO webhooks (name, url, secret, events, enabled) VALUES (?, ?, ?, ?, ?)`,
+		strings.TrimSpace(hook.Name), strings.TrimSpace(hook.URL), sealedSecret, eventsJSON, boolToInt(hook.Enabled))
+	if err != nil {
+		return Webhook{}, fmt.Errorf("insert webhook: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Webhook{}, fmt.Errorf("webhook last insert id: %w", err)
+	}
+
+	return r.GetWebhook(ctx, id)
+}
+
+// UpdateWebhook replaces a webhook's settings.
+func (r *TrafficRepository) UpdateWebhook(ctx context.Context, hook Webhook) (Webhook, error) {
+	if r == nil || r.db == nil {
+		return Webhook{}, errors.New("traffic repository not initialized")
+	}
+
+	sealedSecret, eventsJSON, err := r.encodeWebhook(hook)
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	res, err := r.db.ExecContext(ctx, `UPDATE webhooks SET name = ?, url = ?, secret = ?, events = ?, enabled = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		strings.TrimSpace(hook.Name), strings.TrimSpace(hook.URL), sealedSecret, eventsJSON, boolToInt(hook.Enabled), hook.ID)
+	if err != nil {
+		return Webhook{}, fmt.Errorf("update webhook: %w", err)
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return Webhook{}, ErrWebhookNotFound
+	}
+
+	return r.GetWebhook(ctx, hook.ID)
+}
+
+// DeleteWebhook removes a webhook and its delivery log.
+func (r *TrafficRepository) DeleteWebhook(ctx context.Context, id int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	res, err := r.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete webhook: %w", err)
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return ErrWebhookNotFound
+	}
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id); err != nil {
+		return fmt.Errorf("delete webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// CreateWebhookDelivery records a pending delivery and prunes the oldest log entries.
+func (r *TrafficRepository) CreateWebhookDelivery(ctx context.Context, delivery WebhookDelivery) (WebhookDelivery, error) {
+	if r == nil || r.db == nil {
+		return WebhookDelivery{}, errors.New("traffic repository not initialized")
+	}
+
+	res, err := r.db.ExecContext(ctx, `INSERT INTO webhook_deliveries (webhook_id, event, payload, status) VALUES (?, ?, ?, ?)`,
+		delivery.WebhookID, delivery.Event, delivery.Payload, WebhookDeliveryPending)
+	if err != nil {
+		return WebhookDelivery{}, fmt.Errorf("insert webhook delivery: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return WebhookDelivery{}, fmt.Errorf("webhook delivery last insert id: %w", err)
+	}
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE id <= ?`, id-maxWebhookDeliveries); err != nil {
+		return WebhookDelivery{}, fmt.Errorf("prune webhook deliveries: %w", err)
+	}
+
+	delivery.ID = id
+	delivery.Status = WebhookDeliveryPending
+	return delivery, nil
+}
+
+// UpdateWebhookDelivery records the payload and outcome of a delivery attempt.
+func (r *TrafficRepository) UpdateWebhookDelivery(ctx context.Context, delivery WebhookDelivery) error {
+	if r == nil || r.db == nil {
+		return errors.New("traffic repository not initialized")
+	}
+
+	if _, err := r.db.ExecContext(ctx, `UPDATE webhook_deliveries SET payload = ?, status = ?, attempts = ?, response_status = ?, error = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		delivery.Payload, delivery.Status, delivery.Attempts, delivery.ResponseStatus, delivery.Error, delivery.ID); err != nil {
+		return fmt.Errorf("update webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns the most recent deliveries of a webhook, newest first.
+func (r *TrafficRepository) ListWebhookDeliveries(ctx context.Context, webhookID int64, limit int) ([]WebhookDelivery, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("traffic repository not initialized")
+	}
+
+	if limit <= 0 {
+		limit = 50
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id, webhook_id, event, payload, status, attempts, response_status, error, created_at, updated_at FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ?`, webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.ResponseStatus, &d.Error, &d.CreatedAt, &d.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
@@ -74,6 +74,7 @@ func (p *ClashProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 			}
 
 			if !supportedTypes[proxyType] {
+				opts.skip(proxy, "unsupported proxy type "+proxyType)
 				continue
 			}
 
@@ -81,6 +82,7 @@ func (p *ClashProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 			if proxyType == "ss" {
 				cipher := GetString(proxy, "cipher")
 				if !supportedSSCiphers[cipher] {
+					opts.skip(proxy, "unsupported shadowsocks cipher "+cipher)
 					continue
 				}
 			}
@@ -89,6 +91,7 @@ func (p *ClashProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 			if proxyType == "snell" {
 				version := GetInt(proxy, "version")
 				if version >= 4 {
+					opts.skip(proxy, "snell v4+ is not supported")
 					continue
 				}
 			}
@@ -96,6 +99,7 @@ func (p *ClashProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 			// Check VLESS flow and reality
 			if proxyType == "vless" {
 				if IsPresent(proxy, "flow") || IsPresent(proxy, "reality-opts") {
+					opts.skip(proxy, "vless flow/reality is not supported")
 					continue
 				}
 			}
@@ -105,6 +109,7 @@ func (p *ClashProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 			if network == "ws" {
 				if wsOpts := GetMap(proxy, "ws-opts"); wsOpts != nil {
 					if GetBool(wsOpts, "v2ray-http-upgrade") {
+						opts.skip(proxy, "ws with http upgrade is not supported")
 						continue
 					}
 				}
@@ -113,6 +118,7 @@ func (p *ClashProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 			// Check dialer proxy
 			if IsPresent(proxy, "underlying-proxy") || IsPresent(proxy, "dialer-proxy") {
 				// Clash doesn't support dialer proxy, skip this node
+				opts.skip(proxy, "dialer proxy is not supported")
 				continue
 			}
 		}
@@ -168,6 +174,18 @@ func (p *ClashProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 			}
 			transformed["pre-shared-key"] = GetString(transformed, "preshared-key")
 
+			// reserved 统一为 [a, b, c] 形式（兼容 "a,b,c"、"a/b/c" 和 base64），mtu 统一为整数
+			if IsPresent(transformed, "reserved") {
+				if reserved := wireGuardReserved(transformed["reserved"]); reserved != nil {
+					transformed["reserved"] = reserved
+				} else {
+					delete(transformed, "reserved")
+				}
+			}
+			if IsPresent(transformed, "mtu") {
+				transformed["mtu"] = GetInt(transformed, "mtu")
+			}
+
 			// allowed-ips: 确保是数组类型
 			if IsPresent(transformed, "allowed-ips") {
 				allowedIPs := transformed["allowed-ips"]
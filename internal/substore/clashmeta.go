@@ -99,12 +99,14 @@ func (p *ClashMetaProducer) Produce(proxies []Proxy, outputType string, opts *Pr
 			if proxyType == "snell" {
 				version := GetInt(proxy, "version")
 				if version >= 4 {
+					opts.skip(proxy, "snell v4+ is not supported")
 					continue
 				}
 			}
 
 			// Skip juicity and naive (不被 ClashMeta 支持)
 			if proxyType == "juicity" || proxyType == "naive" {
+				opts.skip(proxy, "unsupported proxy type "+proxyType)
 				continue
 			}
 
@@ -112,6 +114,7 @@ func (p *ClashMetaProducer) Produce(proxies []Proxy, outputType string, opts *Pr
 			if proxyType == "ss" {
 				cipher := GetString(proxy, "cipher")
 				if !supportedSSCiphers[cipher] {
+					opts.skip(proxy, "unsupported shadowsocks cipher "+cipher)
 					continue
 				}
 			}
@@ -120,15 +123,18 @@ func (p *ClashMetaProducer) Produce(proxies []Proxy, outputType string, opts *Pr
 			if proxyType == "anytls" {
 				network := GetString(proxy, "network")
 				if network != "" && network != "tcp" {
+					opts.skip(proxy, "anytls only supports tcp network")
 					continue
 				}
 				if network == "tcp" && IsPresent(proxy, "reality-opts") {
+					opts.skip(proxy, "anytls with reality is not supported")
 					continue
 				}
 			}
 
 			// Skip xhttp network
 			if GetString(proxy, "network") == "xhttp" {
+				opts.skip(proxy, "xhttp network is not supported")
 				continue
 			}
 		}
@@ -228,6 +234,18 @@ func (p *ClashMetaProducer) Produce(proxies []Proxy, outputType string, opts *Pr
 			}
 			transformed["pre-shared-key"] = GetString(transformed, "preshared-key")
 
+			// reserved 统一为 [a, b, c] 形式（兼容 "a,b,c"、"a/b/c" 和 base64），mtu 统一为整数
+			if IsPresent(transformed, "reserved") {
+				if reserved := wireGuardReserved(transformed["reserved"]); reserved != nil {
+					transformed["reserved"] = reserved
+				} else {
+					delete(transformed, "reserved")
+				}
+			}
+			if IsPresent(transformed, "mtu") {
+				transformed["mtu"] = GetInt(transformed, "mtu")
+			}
+
 			// allowed-ips: 确保是数组类型
 			if IsPresent(transformed, "allowed-ips") {
 				allowedIPs := transformed["allowed-ips"]
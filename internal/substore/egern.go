@@ -73,6 +73,7 @@ func (p *EgernProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 
 		// Filter unsupported proxy types
 		if !p.isSupportedType(proxyType) {
+			opts.skip(proxy, "unsupported proxy type "+proxyType)
 			continue
 		}
 
@@ -86,6 +87,7 @@ func (p *EgernProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 				if pluginOpts := GetMap(proxy, "plugin-opts"); pluginOpts != nil {
 					mode := GetString(pluginOpts, "mode")
 					if mode != "" && mode != "http" && mode != "tls" {
+						opts.skip(proxy, "unsupported obfs mode "+mode)
 						continue
 					}
 				}
@@ -93,6 +95,7 @@ func (p *EgernProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 
 			// Check cipher
 			if !supportedSSCiphers[cipher] {
+				opts.skip(proxy, "unsupported shadowsocks cipher "+cipher)
 				continue
 			}
 		}
@@ -101,6 +104,7 @@ func (p *EgernProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 		if proxyType == "vmess" {
 			network := GetString(proxy, "network")
 			if network != "" && network != "http" && network != "ws" && network != "tcp" {
+				opts.skip(proxy, "unsupported network "+network)
 				continue
 			}
 		}
@@ -109,6 +113,7 @@ func (p *EgernProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 		if proxyType == "trojan" {
 			network := GetString(proxy, "network")
 			if network != "" && network != "http" && network != "ws" && network != "tcp" {
+				opts.skip(proxy, "unsupported network "+network)
 				continue
 			}
 		}
@@ -121,16 +126,19 @@ func (p *EgernProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 			// Check flow support
 			if !opts.IncludeUnsupportedProxy {
 				if IsPresent(proxy, "flow") || IsPresent(proxy, "reality-opts") {
+					opts.skip(proxy, "vless flow/reality is not supported")
 					continue
 				}
 			} else {
 				if flow != "" && flow != "xtls-rprx-vision" {
+					opts.skip(proxy, "unsupported vless flow "+flow)
 					continue
 				}
 			}
 
 			// Check network
 			if network != "" && network != "http" && network != "ws" && network != "tcp" {
+				opts.skip(proxy, "unsupported network "+network)
 				continue
 			}
 		}
@@ -139,6 +147,7 @@ func (p *EgernProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 		if proxyType == "tuic" {
 			token := GetString(proxy, "token")
 			if token != "" {
+				opts.skip(proxy, "tuic v4 (token) is not supported")
 				continue
 			}
 		}
@@ -147,6 +156,7 @@ func (p *EgernProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 		if GetString(proxy, "network") == "ws" {
 			if wsOpts := GetMap(proxy, "ws-opts"); wsOpts != nil {
 				if GetBool(wsOpts, "v2ray-http-upgrade") {
+					opts.skip(proxy, "ws with http upgrade is not supported")
 					continue
 				}
 			}
@@ -191,6 +201,7 @@ func (p *EgernProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 		case "vless":
 			transformed, flow = p.transformVLess(proxy, original)
 		default:
+			opts.skip(proxy, "unsupported proxy type "+proxyType)
 			continue
 		}
 
@@ -204,7 +215,8 @@ func (p *EgernProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 			if IsPresent(original, "shadow-tls-password") {
 				version := GetInt(original, "shadow-tls-version")
 				if version != 3 {
-					return nil, fmt.Errorf("shadow-tls version %d is not supported", version)
+					opts.skip(proxy, fmt.Sprintf("shadow-tls version %d is not supported", version))
+					continue
 				}
 				transformed["shadow_tls"] = map[string]interface{}{
 					"password": GetString(original, "shadow-tls-password"),
@@ -214,7 +226,8 @@ func (p *EgernProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 				if pluginOpts := GetMap(original, "plugin-opts"); pluginOpts != nil {
 					version := GetInt(pluginOpts, "version")
 					if version != 3 {
-						return nil, fmt.Errorf("shadow-tls version %d is not supported", version)
+						opts.skip(proxy, fmt.Sprintf("shadow-tls version %d is not supported", version))
+						continue
 					}
 					transformed["shadow_tls"] = map[string]interface{}{
 						"password": GetString(pluginOpts, "password"),
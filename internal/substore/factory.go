@@ -2,12 +2,40 @@ package substore
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 )
 
+// OutputFormat describes how a conversion target is served over HTTP
+type OutputFormat struct {
+	ContentType string
+	Extension   string
+}
+
+// Built-in output formats
+var (
+	OutputFormatYAML = OutputFormat{ContentType: "text/yaml; charset=utf-8", Extension: ".yaml"}
+	OutputFormatText = OutputFormat{ContentType: "text/plain; charset=utf-8", Extension: ".txt"}
+	OutputFormatJSON = OutputFormat{ContentType: "application/json; charset=utf-8", Extension: ".json"}
+)
+
+// OutputFormatProvider is implemented by producers whose output is not YAML
+type OutputFormatProvider interface {
+	OutputFormat() OutputFormat
+}
+
+// DescriptionProvider is implemented by producers that describe their target, e.g. plugins
+type DescriptionProvider interface {
+	Description() string
+}
+
 // ProducerFactory creates and manages producers
 type ProducerFactory struct {
 	producers map[string]Producer
+	formats   map[string]OutputFormat
+	overrides map[string]OutputFormat
+	plugins   map[string]bool // Targets added through RegisterProducer
 	mu        sync.RWMutex
 }
 
@@ -15,6 +43,9 @@ type ProducerFactory struct {
 func NewProducerFactory() *ProducerFactory {
 	factory := &ProducerFactory{
 		producers: make(map[string]Producer),
+		formats:   make(map[string]OutputFormat),
+		overrides: make(map[string]OutputFormat),
+		plugins:   make(map[string]bool),
 	}
 
 	// Register default producers
@@ -28,18 +59,84 @@ func NewProducerFactory() *ProducerFactory {
 	factory.Register(NewSurgeMacProducer())
 	factory.Register(NewStashProducer())
 	factory.Register(NewQXProducer())
+	factory.Register(NewQuantumultProducer())
 	factory.Register(NewLoonProducer())
 	factory.Register(NewSingboxProducer())
 	factory.Register(NewEgernProducer())
+	factory.Register(NewXrayProducer())
+	factory.Register(NewMihomoProviderProducer())
+
+	// clash-to-surge 由订阅处理器基于模板转换，输出为 Surge 文本配置
+	factory.RegisterOutputFormat("clash-to-surge", OutputFormatText)
+
+	for _, producer := range registeredProducers() {
+		factory.registerPlugin(producer)
+	}
 
 	return factory
 }
 
-// Register registers a producer
+// Register registers a producer together with its output format (YAML unless the producer
+// implements OutputFormatProvider)
 func (f *ProducerFactory) Register(producer Producer) {
+	format := OutputFormatYAML
+	if provider, ok := producer.(OutputFormatProvider); ok {
+		format = provider.OutputFormat()
+	}
+
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	f.producers[producer.GetType()] = producer
+	f.formats[producer.GetType()] = format
+}
+
+// RegisterOutputFormat registers the output format of a target that is not backed by a producer
+func (f *ProducerFactory) RegisterOutputFormat(target string, format OutputFormat) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.formats[target] = format
+}
+
+// HasOutputFormat reports whether the target has a registered output format
+func (f *ProducerFactory) HasOutputFormat(target string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	_, ok := f.formats[target]
+	return ok
+}
+
+// SetOutputFormatOverrides replaces the configured per-target overrides. Empty fields of an
+// override fall back to the registered format.
+func (f *ProducerFactory) SetOutputFormatOverrides(overrides map[string]OutputFormat) {
+	next := make(map[string]OutputFormat, len(overrides))
+	for target, format := range overrides {
+		next[strings.TrimSpace(target)] = format
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.overrides = next
+}
+
+// GetOutputFormat returns the content type and file extension used to serve the target.
+// Unknown targets are served as YAML.
+func (f *ProducerFactory) GetOutputFormat(target string) OutputFormat {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	format, ok := f.formats[target]
+	if !ok {
+		format = OutputFormatYAML
+	}
+	if override, ok := f.overrides[target]; ok {
+		if override.ContentType != "" {
+			format.ContentType = override.ContentType
+		}
+		if override.Extension != "" {
+			format.Extension = override.Extension
+		}
+	}
+	return format
 }
 
 // GetProducer returns a producer by type
@@ -66,6 +163,19 @@ func (f *ProducerFactory) GetSupportedTypes() []string {
 	return types
 }
 
+// GetSupportedTargets returns every conversion target with a registered output format, sorted
+func (f *ProducerFactory) GetSupportedTargets() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	targets := make([]string, 0, len(f.formats))
+	for target := range f.formats {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
 // ConvertProxies converts proxies to the specified format
 func (f *ProducerFactory) ConvertProxies(proxies []Proxy, targetFormat string, opts *ProduceOptions) (interface{}, error) {
 	producer, err := f.GetProducer(targetFormat)
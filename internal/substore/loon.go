@@ -2,7 +2,6 @@ package substore
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
 )
 
@@ -33,6 +32,11 @@ func (p *LoonProducer) GetType() string {
 	return p.producerType
 }
 
+// OutputFormat returns the format used to serve the output
+func (p *LoonProducer) OutputFormat() OutputFormat {
+	return OutputFormatText
+}
+
 // Produce converts proxies to Loon format
 func (p *LoonProducer) Produce(proxies []Proxy, outputType string, opts *ProduceOptions) (interface{}, error) {
 	if opts == nil {
@@ -44,6 +48,7 @@ func (p *LoonProducer) Produce(proxies []Proxy, outputType string, opts *Produce
 		line, err := p.ProduceOne(proxy, outputType, opts)
 		if err != nil {
 			if !opts.IncludeUnsupportedProxy {
+				opts.skip(proxy, err.Error())
 				continue
 			}
 		}
@@ -102,6 +107,8 @@ func (p *LoonProducer) ProduceOne(proxy Proxy, outputType string, opts *ProduceO
 		return p.wireguard(proxy)
 	case "hysteria2":
 		return p.hysteria2(proxy)
+	case "anytls":
+		return p.anytls(proxy)
 	default:
 		return "", fmt.Errorf("platform Loon does not support proxy type: %s", proxyType)
 	}
@@ -729,14 +736,15 @@ func (p *LoonProducer) hysteria2(proxy Proxy) (string, error) {
 
 	// download-bandwidth
 	if IsPresent(proxy, "down") {
-		down := GetString(proxy, "down")
-		// Extract digits from down string (matches /\d+/ in JS)
-		re := regexp.MustCompile(`\d+`)
-		matches := re.FindString(down)
-		if matches == "" {
-			matches = "0"
+		result.Append(fmt.Sprintf(",download-bandwidth=%d", GetBandwidthMbps(proxy, "down")))
+	}
+
+	// port hopping
+	if ports := GetPortHopping(proxy); len(ports) > 0 {
+		result.Append(fmt.Sprintf(",port-hopping=\"%s\"", strings.Join(ports, ";")))
+		if interval := GetDurationSeconds(proxy, "hop-interval"); interval != "" {
+			result.Append(",port-hopping-interval=" + interval)
 		}
-		result.Append(fmt.Sprintf(",download-bandwidth=%s", matches))
 	}
 
 	result.AppendIfPresent(",ecn=%v", "ecn")
@@ -747,6 +755,52 @@ func (p *LoonProducer) hysteria2(proxy Proxy) (string, error) {
 	return result.String(), nil
 }
 
+func (p *LoonProducer) anytls(proxy Proxy) (string, error) {
+	if network := GetString(proxy, "network"); (network != "" && network != "tcp") || IsPresent(proxy, "reality-opts") {
+		return "", fmt.Errorf("network or reality is unsupported")
+	}
+
+	result := NewResult(proxy)
+	result.Append(fmt.Sprintf("%s=anytls,%s,%d,\"%s\"",
+		GetString(proxy, "name"),
+		GetString(proxy, "server"),
+		GetInt(proxy, "port"),
+		GetString(proxy, "password")))
+
+	// SNI - compatible with both SubStore's "sni" and miaomiaowu's "servername"
+	if sni := GetSNI(proxy); sni != "" {
+		result.Append(fmt.Sprintf(",tls-name=%s", sni))
+	}
+	result.AppendIfPresent(",tls-cert-sha256=%s", "tls-fingerprint")
+	result.AppendIfPresent(",tls-pubkey-sha256=%s", "tls-pubkey-sha256")
+	result.AppendIfPresent(",skip-cert-verify=%v", "skip-cert-verify")
+
+	// idle session
+	if interval := GetDurationSeconds(proxy, "idle-session-check-interval"); interval != "" {
+		result.Append(",idle-session-check-interval=" + interval)
+	}
+	if timeout := GetDurationSeconds(proxy, "idle-session-timeout"); timeout != "" {
+		result.Append(",idle-session-timeout=" + timeout)
+	}
+	result.AppendIfPresent(",min-idle-session=%d", "min-idle-session")
+
+	// tfo
+	result.AppendIfPresent(",fast-open=%v", "tfo")
+
+	// block-quic
+	p.appendBlockQuic(result, proxy)
+
+	// udp
+	if GetBool(proxy, "udp") {
+		result.Append(",udp=true")
+	}
+
+	// ip-version
+	p.appendIPVersion(result, proxy)
+
+	return result.String(), nil
+}
+
 // Helper methods
 
 func (p *LoonProducer) appendIPVersion(result *Result, proxy Proxy) {
@@ -0,0 +1,303 @@
+package substore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mappingPlaceholder matches {field} and {nested.field} in mapping templates. JSON braces such as
+// {"a":1} don't match because quotes are not allowed in field names.
+var mappingPlaceholder = regexp.MustCompile(`\{([A-Za-z0-9_.-]+)\}`)
+
+// ProducerDefinition describes a line-based producer loaded from a YAML or JSON file. Every proxy
+// becomes one line rendered from Template (or the per-type entry of Templates); placeholders are
+// filled from the proxy normalized to Clash Meta fields.
+//
+//	type: mylist
+//	format: text
+//	header: "[Proxy]"
+//	type_names: {ss: shadowsocks}
+//	templates:
+//	  ss: "{name} = {type}, {server}, {port}, {cipher}, {password}"
+//	options:
+//	  - ", sni={servername}"
+//	  - ", udp={udp}"
+type ProducerDefinition struct {
+	Type        string            `yaml:"type" json:"type"`
+	Description string            `yaml:"description" json:"description"`
+	Format      string            `yaml:"format" json:"format"` // text (default), yaml or json
+	ContentType string            `yaml:"content_type" json:"content_type"`
+	Extension   string            `yaml:"extension" json:"extension"`
+	Header      string            `yaml:"header" json:"header"`
+	Footer      string            `yaml:"footer" json:"footer"`
+	Separator   *string           `yaml:"separator" json:"separator"` // Between lines; defaults to a newline
+	Template    string            `yaml:"template" json:"template"`   // Used for proxy types without an entry in Templates
+	Templates   map[string]string `yaml:"templates" json:"templates"`
+	Options     []string          `yaml:"options" json:"options"` // Appended in order when all their placeholders resolve
+	TypeNames   map[string]string `yaml:"type_names" json:"type_names"`
+}
+
+// MappingProducer implements the Producer interface from a ProducerDefinition
+type MappingProducer struct {
+	def    ProducerDefinition
+	format OutputFormat
+}
+
+// NewMappingProducer validates the definition and creates a producer from it
+func NewMappingProducer(def ProducerDefinition) (*MappingProducer, error) {
+	def.Type = strings.TrimSpace(def.Type)
+	if !producerTypePattern.MatchString(def.Type) {
+		return nil, fmt.Errorf("invalid producer type %q", def.Type)
+	}
+	if strings.TrimSpace(def.Template) == "" && len(def.Templates) == 0 {
+		return nil, errors.New("template or templates is required")
+	}
+
+	var format OutputFormat
+	switch strings.ToLower(strings.TrimSpace(def.Format)) {
+	case "", "text":
+		format = OutputFormatText
+	case "yaml":
+		format = OutputFormatYAML
+	case "json":
+		format = OutputFormatJSON
+	default:
+		return nil, fmt.Errorf("unknown format %q", def.Format)
+	}
+	if contentType := strings.TrimSpace(def.ContentType); contentType != "" {
+		format.ContentType = contentType
+	}
+	if extension := strings.TrimSpace(def.Extension); extension != "" {
+		if !strings.HasPrefix(extension, ".") {
+			extension = "." + extension
+		}
+		format.Extension = extension
+	}
+
+	return &MappingProducer{def: def, format: format}, nil
+}
+
+// GetType returns the producer type
+func (p *MappingProducer) GetType() string {
+	return p.def.Type
+}
+
+// OutputFormat returns the format used to serve the output
+func (p *MappingProducer) OutputFormat() OutputFormat {
+	return p.format
+}
+
+// Description returns the description from the definition file
+func (p *MappingProducer) Description() string {
+	return p.def.Description
+}
+
+// Produce renders one line per proxy. Proxies without a template for their type, or whose
+// template references a missing field, are skipped.
+func (p *MappingProducer) Produce(proxies []Proxy, outputType string, opts *ProduceOptions) (interface{}, error) {
+	if opts == nil {
+		opts = &ProduceOptions{}
+	}
+
+	// 先统一转换为 ClashMeta 内部格式，模板字段与 Clash Meta 配置一致
+	clashProxies, err := NewClashMetaProducer().Produce(proxies, "internal", &ProduceOptions{
+		IncludeUnsupportedProxy: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	proxiesSlice, ok := clashProxies.([]Proxy)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type from ClashMeta producer")
+	}
+
+	lines := make([]string, 0, len(proxiesSlice))
+	for _, proxy := range proxiesSlice {
+		line, err := p.produceOne(proxy)
+		if err != nil {
+			opts.skip(proxy, err.Error())
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	if outputType == "internal" {
+		return lines, nil
+	}
+
+	separator := "\n"
+	if p.def.Separator != nil {
+		separator = *p.def.Separator
+	}
+
+	var sb strings.Builder
+	if p.def.Header != "" {
+		sb.WriteString(strings.TrimRight(p.def.Header, "\n"))
+		sb.WriteString("\n")
+	}
+	sb.WriteString(strings.Join(lines, separator))
+	if p.def.Footer != "" {
+		sb.WriteString("\n")
+		sb.WriteString(strings.TrimRight(p.def.Footer, "\n"))
+	}
+	sb.WriteString("\n")
+	return sb.String(), nil
+}
+
+func (p *MappingProducer) produceOne(proxy Proxy) (string, error) {
+	proxyType := GetString(proxy, "type")
+	template, ok := p.def.Templates[proxyType]
+	if !ok {
+		template = p.def.Template
+	}
+	if strings.TrimSpace(template) == "" {
+		return "", fmt.Errorf("platform %s does not support proxy type: %s", p.def.Type, proxyType)
+	}
+
+	line, missing := p.render(template, proxy)
+	if missing != "" {
+		return "", fmt.Errorf("missing field %s", missing)
+	}
+	for _, option := range p.def.Options {
+		if rendered, missing := p.render(option, proxy); missing == "" {
+			line += rendered
+		}
+	}
+	return line, nil
+}
+
+// render fills the placeholders of template and returns the first field that couldn't be resolved
+func (p *MappingProducer) render(template string, proxy Proxy) (string, string) {
+	missing := ""
+	rendered := mappingPlaceholder.ReplaceAllStringFunc(template, func(match string) string {
+		field := match[1 : len(match)-1]
+		value, ok := p.lookup(proxy, field)
+		if !ok && missing == "" {
+			missing = field
+		}
+		return value
+	})
+	return rendered, missing
+}
+
+func (p *MappingProducer) lookup(proxy Proxy, field string) (string, bool) {
+	if field == "type" {
+		proxyType := GetString(proxy, "type")
+		if name, ok := p.def.TypeNames[proxyType]; ok {
+			return name, true
+		}
+		return proxyType, proxyType != ""
+	}
+
+	var current interface{} = map[string]interface{}(proxy)
+	for _, key := range strings.Split(field, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if current, ok = m[key]; !ok || current == nil {
+			return "", false
+		}
+	}
+
+	switch v := current.(type) {
+	case string:
+		return v, v != ""
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, fmt.Sprintf("%v", item))
+		}
+		return strings.Join(items, ","), len(items) > 0
+	case []string:
+		return strings.Join(v, ","), len(v) > 0
+	case map[string]interface{}:
+		data, err := json.Marshal(v)
+		return string(data), err == nil
+	default:
+		return fmt.Sprintf("%v", v), true
+	}
+}
+
+// LoadProducerDefinitions reads every *.yaml, *.yml and *.json file in dir as a ProducerDefinition.
+// A missing directory yields no producers. Invalid files are reported in the returned error while
+// the valid ones are still returned.
+func LoadProducerDefinitions(dir string) ([]*MappingProducer, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read producer definitions: %w", err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".yaml", ".yml", ".json":
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var producers []*MappingProducer
+	var errs []error
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+
+		var def ProducerDefinition
+		if strings.EqualFold(filepath.Ext(name), ".json") {
+			err = json.Unmarshal(data, &def)
+		} else {
+			err = yaml.Unmarshal(data, &def)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		if strings.TrimSpace(def.Type) == "" {
+			def.Type = strings.TrimSuffix(name, filepath.Ext(name))
+		}
+
+		producer, err := NewMappingProducer(def)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		producers = append(producers, producer)
+	}
+
+	return producers, errors.Join(errs...)
+}
+
+// RegisterProducersFromDir loads the producer definitions in dir and registers them, returning the
+// registered target names.
+func RegisterProducersFromDir(dir string) ([]string, error) {
+	producers, loadErr := LoadProducerDefinitions(dir)
+
+	var registered []string
+	errs := []error{loadErr}
+	for _, producer := range producers {
+		if err := RegisterProducer(producer); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		registered = append(registered, producer.GetType())
+	}
+	return registered, errors.Join(errs...)
+}
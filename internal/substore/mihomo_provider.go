@@ -0,0 +1,254 @@
+package substore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mihomoProviderName is the proxy-provider that points back at the panel subscription
+const mihomoProviderName = "miaomiaowu"
+
+// Top-level keys written before and after the remaining config keys, so the output reads like a
+// hand-written Mihomo config: general settings first, then providers, groups and rules.
+var (
+	mihomoConfigHeadKeys = []string{
+		"mixed-port", "port", "socks-port", "redir-port", "tproxy-port", "allow-lan", "bind-address",
+		"mode", "log-level", "ipv6", "unified-delay", "tcp-concurrent", "external-controller", "secret",
+		"profile", "sniffer", "tun", "dns",
+	}
+	mihomoConfigTailKeys = []string{"proxy-providers", "proxy-groups", "rule-providers", "rules"}
+	mihomoGroupKeys      = []string{"name", "type", "proxies", "use", "filter", "url", "interval", "tolerance", "lazy"}
+	mihomoProviderKeys   = []string{"type", "url", "interval", "path", "health-check"}
+	mihomoHealthKeys     = []string{"enable", "url", "interval", "timeout", "lazy"}
+)
+
+// MihomoProviderProducer implements the Producer interface for a complete Mihomo config that loads
+// its nodes from the panel subscription through a proxy-provider instead of inlining them, so the
+// client refreshes nodes on the provider interval without re-importing the whole profile.
+type MihomoProviderProducer struct {
+	producerType string
+}
+
+// NewMihomoProviderProducer creates a new Mihomo proxy-provider producer
+func NewMihomoProviderProducer() *MihomoProviderProducer {
+	return &MihomoProviderProducer{
+		producerType: "mihomo-provider",
+	}
+}
+
+// GetType returns the producer type
+func (p *MihomoProviderProducer) GetType() string {
+	return p.producerType
+}
+
+// Produce builds the Mihomo config from opts.FullConfig. opts.ProviderURL must be the subscription
+// URL serving the nodes in Clash Meta format; the proxies themselves are only used for their names.
+func (p *MihomoProviderProducer) Produce(proxies []Proxy, outputType string, opts *ProduceOptions) (interface{}, error) {
+	if opts == nil || strings.TrimSpace(opts.ProviderURL) == "" {
+		return nil, errors.New("mihomo-provider requires the subscription URL to reference as proxy-provider")
+	}
+
+	config := make(map[string]interface{}, len(opts.FullConfig)+1)
+	for k, v := range opts.FullConfig {
+		config[k] = v
+	}
+	delete(config, "proxies")
+
+	providers := make(map[string]interface{})
+	if existing, ok := config["proxy-providers"].(map[string]interface{}); ok {
+		for k, v := range existing {
+			providers[k] = v
+		}
+	}
+	providerName := mihomoProviderName
+	for i := 2; providers[providerName] != nil; i++ {
+		providerName = fmt.Sprintf("%s-%d", mihomoProviderName, i)
+	}
+	providers[providerName] = map[string]interface{}{
+		"type":     "http",
+		"url":      strings.TrimSpace(opts.ProviderURL),
+		"interval": 3600,
+		"path":     "./proxy_providers/" + providerName + ".yaml",
+		"health-check": map[string]interface{}{
+			"enable":   true,
+			"url":      "https://www.gstatic.com/generate_204",
+			"interval": 300,
+			"timeout":  5000,
+			"lazy":     true,
+		},
+	}
+	config["proxy-providers"] = providers
+
+	nodeNames := make(map[string]bool, len(proxies))
+	for _, proxy := range proxies {
+		if name := GetString(proxy, "name"); name != "" {
+			nodeNames[name] = true
+		}
+	}
+
+	if groups, ok := config["proxy-groups"].([]interface{}); ok {
+		rewritten := make([]interface{}, 0, len(groups))
+		for _, group := range groups {
+			if groupMap, ok := group.(map[string]interface{}); ok {
+				group = useProviderInGroup(groupMap, providerName, nodeNames)
+			}
+			rewritten = append(rewritten, group)
+		}
+		config["proxy-groups"] = rewritten
+	}
+
+	if outputType == "internal" {
+		return config, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(mihomoConfigNode(config)); err != nil {
+		return nil, fmt.Errorf("marshal mihomo config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("marshal mihomo config: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// useProviderInGroup replaces the panel nodes listed in a proxy group with the provider. Groups that
+// only picked some of the nodes keep that selection through a filter on the node names.
+func useProviderInGroup(group map[string]interface{}, providerName string, nodeNames map[string]bool) map[string]interface{} {
+	members, _ := group["proxies"].([]interface{})
+	var kept []interface{}
+	var picked []string
+	for _, member := range members {
+		name, ok := member.(string)
+		if ok && nodeNames[name] {
+			picked = append(picked, name)
+			continue
+		}
+		kept = append(kept, member)
+	}
+	if len(picked) == 0 {
+		return group
+	}
+
+	result := make(map[string]interface{}, len(group)+2)
+	for k, v := range group {
+		result[k] = v
+	}
+	if len(kept) > 0 {
+		result["proxies"] = kept
+	} else {
+		delete(result, "proxies")
+	}
+
+	var use []interface{}
+	if existing, ok := group["use"].([]interface{}); ok {
+		use = append(use, existing...)
+	}
+	result["use"] = append(use, providerName)
+
+	// filter 作用于组内所有 provider，组内已有其它 provider 时不再追加，避免把它们的节点过滤掉
+	if len(picked) < len(nodeNames) && len(use) == 0 {
+		quoted := make([]string, 0, len(picked))
+		for _, name := range picked {
+			quoted = append(quoted, regexp.QuoteMeta(name))
+		}
+		result["filter"] = "^(?:" + strings.Join(quoted, "|") + ")$"
+	}
+	return result
+}
+
+// mihomoConfigNode encodes the config with a stable, readable key order
+func mihomoConfigNode(config map[string]interface{}) *yaml.Node {
+	root := orderedMappingNode(config, mihomoConfigHeadKeys, mihomoConfigTailKeys)
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		switch root.Content[i].Value {
+		case "proxy-providers":
+			providers, _ := config["proxy-providers"].(map[string]interface{})
+			node := &yaml.Node{Kind: yaml.MappingNode}
+			for _, name := range sortedKeys(providers) {
+				provider, ok := providers[name].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				providerNode := orderedMappingNode(provider, mihomoProviderKeys, nil)
+				if health, ok := provider["health-check"].(map[string]interface{}); ok {
+					setMappingValue(providerNode, "health-check", orderedMappingNode(health, mihomoHealthKeys, nil))
+				}
+				node.Content = append(node.Content, stringNode(name), providerNode)
+			}
+			root.Content[i+1] = node
+		case "proxy-groups":
+			groups, _ := config["proxy-groups"].([]interface{})
+			node := &yaml.Node{Kind: yaml.SequenceNode}
+			for _, group := range groups {
+				if groupMap, ok := group.(map[string]interface{}); ok {
+					node.Content = append(node.Content, orderedMappingNode(groupMap, mihomoGroupKeys, nil))
+				} else {
+					node.Content = append(node.Content, valueNode(group))
+				}
+			}
+			root.Content[i+1] = node
+		}
+	}
+	return root
+}
+
+// orderedMappingNode writes the head keys first, then the remaining keys sorted, then the tail keys
+func orderedMappingNode(m map[string]interface{}, head, tail []string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	add := func(key string) {
+		if value, ok := m[key]; ok {
+			node.Content = append(node.Content, stringNode(key), valueNode(value))
+		}
+	}
+	for _, key := range head {
+		add(key)
+	}
+	for _, key := range sortedKeys(m) {
+		if !slices.Contains(head, key) && !slices.Contains(tail, key) {
+			add(key)
+		}
+	}
+	for _, key := range tail {
+		add(key)
+	}
+	return node
+}
+
+func setMappingValue(node *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = value
+			return
+		}
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func stringNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+func valueNode(value interface{}) *yaml.Node {
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: fmt.Sprintf("%v", value)}
+	}
+	return &node
+}
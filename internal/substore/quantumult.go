@@ -0,0 +1,237 @@
+package substore
+
+import (
+	"fmt"
+	"strings"
+)
+
+const targetPlatformQuantumult = "Quantumult"
+
+// quantumultGroup is the group name every server line is tagged with
+const quantumultGroup = "miaomiaowu"
+
+// QuantumultProducer implements the legacy Quantumult (not Quantumult X) [SERVER] format,
+// still used by older iOS releases that can't run Quantumult X.
+type QuantumultProducer struct {
+	producerType string
+	helper       *ProxyHelper
+}
+
+// NewQuantumultProducer creates a new legacy Quantumult producer
+func NewQuantumultProducer() *QuantumultProducer {
+	return &QuantumultProducer{
+		producerType: "quantumult",
+		helper:       NewProxyHelper(),
+	}
+}
+
+// GetType returns the producer type
+func (p *QuantumultProducer) GetType() string {
+	return p.producerType
+}
+
+// OutputFormat returns the format used to serve the output
+func (p *QuantumultProducer) OutputFormat() OutputFormat {
+	return OutputFormatText
+}
+
+// Produce converts proxies to a legacy Quantumult [SERVER] section
+func (p *QuantumultProducer) Produce(proxies []Proxy, outputType string, opts *ProduceOptions) (interface{}, error) {
+	if opts == nil {
+		opts = &ProduceOptions{}
+	}
+
+	if outputType == "internal" {
+		return proxies, nil
+	}
+
+	result := []string{"[SERVER]"}
+	for _, proxy := range proxies {
+		line, err := p.produceOne(proxy)
+		if err != nil {
+			opts.skip(proxy, err.Error())
+			continue
+		}
+		result = append(result, line)
+	}
+
+	return strings.Join(result, "\n") + "\n", nil
+}
+
+// produceOne converts a single proxy to a "name = type, ..." server line
+func (p *QuantumultProducer) produceOne(proxy Proxy) (string, error) {
+	proxyType := p.helper.GetProxyType(proxy)
+
+	var fields []string
+	var err error
+	switch proxyType {
+	case "ss":
+		fields, err = p.shadowsocks(proxy)
+	case "ssr":
+		fields, err = p.shadowsocksr(proxy)
+	case "vmess":
+		fields, err = p.vmess(proxy)
+	case "http":
+		fields, err = p.http(proxy)
+	default:
+		return "", fmt.Errorf("platform %s does not support proxy type: %s", targetPlatformQuantumult, proxyType)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	fields = append(fields, "group="+quantumultGroup)
+	return quantumultName(GetString(proxy, "name")) + " = " + strings.Join(fields, ", "), nil
+}
+
+func (p *QuantumultProducer) shadowsocks(proxy Proxy) ([]string, error) {
+	cipher := GetString(proxy, "cipher")
+	if cipher == "" {
+		cipher = "none"
+	}
+	if strings.HasPrefix(cipher, "2022-") {
+		return nil, fmt.Errorf("cipher %s is not supported", cipher)
+	}
+
+	fields := []string{
+		"shadowsocks",
+		GetString(proxy, "server"),
+		fmt.Sprintf("%d", GetInt(proxy, "port")),
+		cipher,
+		quantumultQuote(GetString(proxy, "password")),
+		"upstream-proxy=false",
+		"upstream-proxy-auth=false",
+	}
+
+	if IsPresent(proxy, "plugin") {
+		if GetString(proxy, "plugin") != "obfs" {
+			return nil, fmt.Errorf("plugin %s is not supported", GetString(proxy, "plugin"))
+		}
+		pluginOpts := GetMap(proxy, "plugin-opts")
+		mode := GetString(pluginOpts, "mode")
+		if mode != "http" && mode != "tls" {
+			return nil, fmt.Errorf("obfs mode %s is not supported", mode)
+		}
+		fields = append(fields, "obfs="+mode)
+		if host := GetString(pluginOpts, "host"); host != "" {
+			fields = append(fields, "obfs-host="+host)
+		}
+	}
+
+	return fields, nil
+}
+
+func (p *QuantumultProducer) shadowsocksr(proxy Proxy) ([]string, error) {
+	fields := []string{
+		"shadowsocksr",
+		GetString(proxy, "server"),
+		fmt.Sprintf("%d", GetInt(proxy, "port")),
+		GetString(proxy, "cipher"),
+		quantumultQuote(GetString(proxy, "password")),
+		"protocol=" + GetString(proxy, "protocol"),
+	}
+	if protocolParam := GetString(proxy, "protocol-param"); protocolParam != "" {
+		fields = append(fields, "protocol_param="+protocolParam)
+	}
+	if obfs := GetString(proxy, "obfs"); obfs != "" {
+		fields = append(fields, "obfs="+obfs)
+	}
+	if obfsParam := GetString(proxy, "obfs-param"); obfsParam != "" {
+		fields = append(fields, "obfs_param="+quantumultQuote(obfsParam))
+	}
+	return fields, nil
+}
+
+func (p *QuantumultProducer) vmess(proxy Proxy) ([]string, error) {
+	cipher := GetString(proxy, "cipher")
+	switch cipher {
+	case "", "auto":
+		cipher = "chacha20-ietf-poly1305"
+	case "chacha20-ietf-poly1305", "aes-128-gcm", "none":
+	default:
+		return nil, fmt.Errorf("cipher %s is not supported", cipher)
+	}
+
+	fields := []string{
+		"vmess",
+		GetString(proxy, "server"),
+		fmt.Sprintf("%d", GetInt(proxy, "port")),
+		cipher,
+		quantumultQuote(GetString(proxy, "uuid")),
+	}
+
+	if GetBool(proxy, "tls") {
+		fields = append(fields, "over-tls=true")
+		if sni := GetString(proxy, "servername"); sni != "" {
+			fields = append(fields, "tls-host="+sni)
+		}
+		if GetBool(proxy, "skip-cert-verify") {
+			fields = append(fields, "certificate=0")
+		} else {
+			fields = append(fields, "certificate=1")
+		}
+	} else {
+		fields = append(fields, "over-tls=false", "certificate=1")
+	}
+
+	switch network := GetString(proxy, "network"); network {
+	case "", "tcp":
+	case "ws":
+		wsOpts := GetMap(proxy, "ws-opts")
+		if GetBool(wsOpts, "v2ray-http-upgrade") {
+			return nil, fmt.Errorf("platform %s does not support network %s with http upgrade", targetPlatformQuantumult, network)
+		}
+		fields = append(fields, "obfs=ws")
+		path := GetString(wsOpts, "path")
+		if path == "" {
+			path = "/"
+		}
+		fields = append(fields, "obfs-path="+quantumultQuote(path))
+		if host := GetString(GetMap(wsOpts, "headers"), "Host"); host != "" {
+			fields = append(fields, "obfs-header="+quantumultQuote("Host: "+host))
+		}
+	default:
+		return nil, fmt.Errorf("network %s is unsupported", network)
+	}
+
+	return fields, nil
+}
+
+func (p *QuantumultProducer) http(proxy Proxy) ([]string, error) {
+	username := GetString(proxy, "username")
+	password := GetString(proxy, "password")
+	if username == "" {
+		username = "none"
+	}
+	if password == "" {
+		password = "none"
+	}
+
+	fields := []string{
+		"http",
+		GetString(proxy, "server"),
+		fmt.Sprintf("%d", GetInt(proxy, "port")),
+		username,
+		password,
+	}
+	if GetBool(proxy, "tls") {
+		fields = append(fields, "over-tls=true")
+		if GetBool(proxy, "skip-cert-verify") {
+			fields = append(fields, "certificate=0")
+		} else {
+			fields = append(fields, "certificate=1")
+		}
+	} else {
+		fields = append(fields, "over-tls=false")
+	}
+	return fields, nil
+}
+
+// quantumultName 节点名中的 "=" 和 "," 会破坏行格式，替换为空格
+func quantumultName(name string) string {
+	return strings.TrimSpace(strings.NewReplacer("=", " ", ",", " ").Replace(name))
+}
+
+func quantumultQuote(value string) string {
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
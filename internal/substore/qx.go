@@ -26,6 +26,11 @@ func (p *QXProducer) GetType() string {
 	return p.producerType
 }
 
+// OutputFormat returns the format used to serve the output
+func (p *QXProducer) OutputFormat() OutputFormat {
+	return OutputFormatText
+}
+
 // Produce converts proxies to QuantumultX format
 func (p *QXProducer) Produce(proxies []Proxy, outputType string, opts *ProduceOptions) (interface{}, error) {
 	if opts == nil {
@@ -41,6 +46,7 @@ func (p *QXProducer) Produce(proxies []Proxy, outputType string, opts *ProduceOp
 		line, err := p.produceOne(proxy, outputType, opts)
 		if err != nil {
 			if !opts.IncludeUnsupportedProxy {
+				opts.skip(proxy, err.Error())
 				continue
 			}
 		}
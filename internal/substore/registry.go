@@ -0,0 +1,84 @@
+package substore
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// producerTypePattern restricts plugin target names to what can be passed as ?t= unescaped
+var producerTypePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// pluginRegistry holds the producers added through RegisterProducer. They are registered into the
+// default factory right away and into every factory created afterwards.
+var pluginRegistry = struct {
+	sync.Mutex
+	producers map[string]Producer
+}{producers: make(map[string]Producer)}
+
+// RegisterProducer adds a conversion target without touching the built-in producer list. Plugin
+// producers can't replace a built-in target; registering the same plugin type again replaces it.
+func RegisterProducer(producer Producer) error {
+	if producer == nil {
+		return errors.New("producer is nil")
+	}
+	producerType := producer.GetType()
+	if !producerTypePattern.MatchString(producerType) {
+		return fmt.Errorf("invalid producer type %q: use lowercase letters, digits, '-' and '_'", producerType)
+	}
+
+	// 先取默认工厂：首次创建时会读取插件注册表，不能在持有注册表锁时调用
+	factory := GetDefaultFactory()
+	if factory.HasOutputFormat(producerType) && !factory.IsPlugin(producerType) {
+		return fmt.Errorf("producer type %q is built in", producerType)
+	}
+
+	pluginRegistry.Lock()
+	pluginRegistry.producers[producerType] = producer
+	pluginRegistry.Unlock()
+
+	factory.registerPlugin(producer)
+	return nil
+}
+
+// registeredProducers returns the plugin producers sorted by type
+func registeredProducers() []Producer {
+	pluginRegistry.Lock()
+	defer pluginRegistry.Unlock()
+
+	producers := make([]Producer, 0, len(pluginRegistry.producers))
+	for _, producer := range pluginRegistry.producers {
+		producers = append(producers, producer)
+	}
+	sort.Slice(producers, func(i, j int) bool {
+		return producers[i].GetType() < producers[j].GetType()
+	})
+	return producers
+}
+
+func (f *ProducerFactory) registerPlugin(producer Producer) {
+	f.Register(producer)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.plugins[producer.GetType()] = true
+}
+
+// IsPlugin reports whether the target was added through RegisterProducer
+func (f *ProducerFactory) IsPlugin(target string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.plugins[target]
+}
+
+// GetDescription returns the description of the target's producer, if it provides one
+func (f *ProducerFactory) GetDescription(target string) string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if provider, ok := f.producers[target].(DescriptionProvider); ok {
+		return provider.Description()
+	}
+	return ""
+}
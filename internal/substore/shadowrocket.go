@@ -26,6 +26,11 @@ func (p *ShadowrocketProducer) GetType() string {
 	return p.producerType
 }
 
+// OutputFormat returns the format used to serve the output
+func (p *ShadowrocketProducer) OutputFormat() OutputFormat {
+	return OutputFormatText
+}
+
 // Produce converts proxies to Shadowrocket format
 func (p *ShadowrocketProducer) Produce(proxies []Proxy, outputType string, opts *ProduceOptions) (interface{}, error) {
 	if opts == nil {
@@ -46,16 +51,19 @@ func (p *ShadowrocketProducer) Produce(proxies []Proxy, outputType string, opts
 		if !opts.IncludeUnsupportedProxy {
 			// Snell v4+
 			if proxyType == "snell" && GetInt(proxy, "version") >= 4 {
+				opts.skip(proxy, "snell v4+ is not supported")
 				continue
 			}
 			// Unsupported types
 			if proxyType == "mieru" || proxyType == "sudoku" || proxyType == "naive" {
+				opts.skip(proxy, "unsupported proxy type "+proxyType)
 				continue
 			}
 			// VLESS with non-none encryption
 			if proxyType == "vless" {
 				encryption := GetString(proxy, "encryption")
 				if encryption != "" && encryption != "none" {
+					opts.skip(proxy, "unsupported vless encryption "+encryption)
 					continue
 				}
 			}
@@ -63,9 +71,11 @@ func (p *ShadowrocketProducer) Produce(proxies []Proxy, outputType string, opts
 			if proxyType == "anytls" {
 				network := GetString(proxy, "network")
 				if network != "" && network != "tcp" {
+					opts.skip(proxy, "anytls only supports tcp network")
 					continue
 				}
 				if network == "tcp" && IsPresent(proxy, "reality-opts") {
+					opts.skip(proxy, "anytls with reality is not supported")
 					continue
 				}
 			}
@@ -27,6 +27,11 @@ func (p *SingboxProducer) GetType() string {
 	return p.producerType
 }
 
+// OutputFormat returns the format used to serve the output
+func (p *SingboxProducer) OutputFormat() OutputFormat {
+	return OutputFormatJSON
+}
+
 // IP version mapping for sing-box
 var singboxIPVersions = map[string]string{
 	"ipv4":        "ipv4_only",
@@ -134,10 +139,19 @@ func (p *SingboxProducer) Produce(proxies []Proxy, outputType string, opts *Prod
 
 		if err != nil {
 			// Skip this proxy if there's an error and we're not including unsupported
+			opts.skip(proxy, err.Error())
 			continue
 		}
 
 		if parsed != nil {
+			// 节点自定义字段中的 _singbox 对象直接并入出站，用于解析器尚不支持的选项
+			if extra, ok := proxy["_singbox"].(map[string]interface{}); ok {
+				for key, value := range extra {
+					if key != "type" && key != "tag" {
+						parsed[key] = value
+					}
+				}
+			}
 			list = append(list, parsed)
 		}
 	}
@@ -146,10 +160,13 @@ func (p *SingboxProducer) Produce(proxies []Proxy, outputType string, opts *Prod
 		return list, nil
 	}
 
-	// Return JSON format
+	// Return JSON format; with the original Clash config available, output a complete configuration
 	result := map[string]interface{}{
 		"outbounds": list,
 	}
+	if IsFullConfigSource(opts.FullConfig) {
+		result = BuildSingboxConfig(list, opts.FullConfig)
+	}
 
 	jsonBytes, err := json.MarshalIndent(result, "", "  ")
 	if err != nil {
@@ -567,9 +584,15 @@ func (p *SingboxProducer) tlsParser(proxy Proxy, parsed map[string]interface{})
 		"enabled": false,
 	}
 
+	proxyType := p.helper.GetProxyType(proxy)
 	if GetBool(proxy, "tls") {
 		tls["enabled"] = true
 	}
+	// QUIC based protocols and anytls always use TLS even without "tls: true" in the Clash config
+	if singboxAlwaysTLS[proxyType] {
+		tls["enabled"] = true
+		tls["server_name"] = GetString(proxy, "server")
+	}
 
 	if servername := GetString(proxy, "servername"); servername != "" {
 		tls["server_name"] = servername
@@ -623,7 +646,6 @@ func (p *SingboxProducer) tlsParser(proxy Proxy, parsed map[string]interface{})
 		}
 	}
 
-	proxyType := p.helper.GetProxyType(proxy)
 	if proxyType != "hysteria" && proxyType != "hysteria2" && proxyType != "tuic" {
 		if clientFingerprint := GetString(proxy, "client-fingerprint"); clientFingerprint != "" {
 			tls["utls"] = map[string]interface{}{
@@ -670,6 +692,14 @@ func (p *SingboxProducer) tlsParser(proxy Proxy, parsed map[string]interface{})
 	}
 }
 
+// singboxAlwaysTLS 始终使用 TLS 的协议
+var singboxAlwaysTLS = map[string]bool{
+	"hysteria":  true,
+	"hysteria2": true,
+	"tuic":      true,
+	"anytls":    true,
+}
+
 // Parser implementations
 
 func (p *SingboxProducer) sshParser(proxy Proxy) (map[string]interface{}, error) {
@@ -1203,7 +1233,7 @@ func (p *SingboxProducer) hysteriaParser(proxy Proxy) (map[string]interface{}, e
 		},
 	}
 
-	if hopInterval := GetString(proxy, "hop-interval"); hopInterval != "" {
+	if hopInterval := GetAnyString(proxy, "hop-interval"); hopInterval != "" {
 		if matched, _ := regexp.MatchString(`^\d+$`, hopInterval); matched {
 			parsed["hop_interval"] = fmt.Sprintf("%ss", hopInterval)
 		} else {
@@ -1211,13 +1241,11 @@ func (p *SingboxProducer) hysteriaParser(proxy Proxy) (map[string]interface{}, e
 		}
 	}
 
-	if ports := GetString(proxy, "ports"); ports != "" {
-		portList := regexp.MustCompile(`\s*,\s*`).Split(ports, -1)
+	if portList := GetPortHopping(proxy); len(portList) > 0 {
 		serverPorts := make([]string, 0, len(portList))
-		for _, p := range portList {
-			rangeStr := regexp.MustCompile(`\s*-\s*`).ReplaceAllString(p, ":")
-			if strings.Contains(rangeStr, ":") {
-				serverPorts = append(serverPorts, rangeStr)
+		for _, rangeStr := range portList {
+			if start, end, ok := strings.Cut(rangeStr, "-"); ok {
+				serverPorts = append(serverPorts, start+":"+end)
 			} else {
 				serverPorts = append(serverPorts, fmt.Sprintf("%s:%s", rangeStr, rangeStr))
 			}
@@ -1317,7 +1345,7 @@ func (p *SingboxProducer) hysteria2Parser(proxy Proxy) (map[string]interface{},
 		},
 	}
 
-	if hopInterval := GetString(proxy, "hop-interval"); hopInterval != "" {
+	if hopInterval := GetAnyString(proxy, "hop-interval"); hopInterval != "" {
 		if matched, _ := regexp.MatchString(`^\d+$`, hopInterval); matched {
 			parsed["hop_interval"] = fmt.Sprintf("%ss", hopInterval)
 		} else {
@@ -1325,13 +1353,11 @@ func (p *SingboxProducer) hysteria2Parser(proxy Proxy) (map[string]interface{},
 		}
 	}
 
-	if ports := GetString(proxy, "ports"); ports != "" {
-		portList := regexp.MustCompile(`\s*,\s*`).Split(ports, -1)
+	if portList := GetPortHopping(proxy); len(portList) > 0 {
 		serverPorts := make([]string, 0, len(portList))
-		for _, p := range portList {
-			rangeStr := regexp.MustCompile(`\s*-\s*`).ReplaceAllString(p, ":")
-			if strings.Contains(rangeStr, ":") {
-				serverPorts = append(serverPorts, rangeStr)
+		for _, rangeStr := range portList {
+			if start, end, ok := strings.Cut(rangeStr, "-"); ok {
+				serverPorts = append(serverPorts, start+":"+end)
 			} else {
 				serverPorts = append(serverPorts, fmt.Sprintf("%s:%s", rangeStr, rangeStr))
 			}
@@ -1339,11 +1365,11 @@ func (p *SingboxProducer) hysteria2Parser(proxy Proxy) (map[string]interface{},
 		parsed["server_ports"] = serverPorts
 	}
 
-	if up := GetInt(proxy, "up"); up > 0 {
+	if up := GetBandwidthMbps(proxy, "up"); up > 0 {
 		parsed["up_mbps"] = up
 	}
 
-	if down := GetInt(proxy, "down"); down > 0 {
+	if down := GetBandwidthMbps(proxy, "down"); down > 0 {
 		parsed["down_mbps"] = down
 	}
 
@@ -1412,8 +1438,12 @@ func (p *SingboxProducer) tuic5Parser(proxy Proxy) (map[string]interface{}, erro
 		parsed["udp_over_stream"] = true
 	}
 
-	if heartbeatInterval := GetString(proxy, "heartbeat-interval"); heartbeatInterval != "" {
-		parsed["heartbeat"] = fmt.Sprintf("%sms", heartbeatInterval)
+	if heartbeatInterval := GetAnyString(proxy, "heartbeat-interval"); heartbeatInterval != "" {
+		if matched, _ := regexp.MatchString(`^\d+$`, heartbeatInterval); matched {
+			parsed["heartbeat"] = fmt.Sprintf("%sms", heartbeatInterval)
+		} else {
+			parsed["heartbeat"] = heartbeatInterval
+		}
 	}
 
 	p.networkParser(proxy, parsed)
@@ -1445,19 +1475,15 @@ func (p *SingboxProducer) anytlsParser(proxy Proxy) (map[string]interface{}, err
 		},
 	}
 
-	if idleSessionCheckInterval := GetString(proxy, "idle-session-check-interval"); idleSessionCheckInterval != "" {
-		if matched, _ := regexp.MatchString(`^\d+$`, idleSessionCheckInterval); matched {
-			parsed["idle_session_check_interval"] = fmt.Sprintf("%ss", idleSessionCheckInterval)
-		}
+	if idleSessionCheckInterval := GetDurationSeconds(proxy, "idle-session-check-interval"); idleSessionCheckInterval != "" {
+		parsed["idle_session_check_interval"] = fmt.Sprintf("%ss", idleSessionCheckInterval)
 	}
 
-	if idleSessionTimeout := GetString(proxy, "idle-session-timeout"); idleSessionTimeout != "" {
-		if matched, _ := regexp.MatchString(`^\d+$`, idleSessionTimeout); matched {
-			parsed["idle_session_timeout"] = fmt.Sprintf("%ss", idleSessionTimeout)
-		}
+	if idleSessionTimeout := GetDurationSeconds(proxy, "idle-session-timeout"); idleSessionTimeout != "" {
+		parsed["idle_session_timeout"] = fmt.Sprintf("%ss", idleSessionTimeout)
 	}
 
-	if minIdleSession := GetString(proxy, "min-idle-session"); minIdleSession != "" {
+	if minIdleSession := GetAnyString(proxy, "min-idle-session"); minIdleSession != "" {
 		if matched, _ := regexp.MatchString(`^\d+$`, minIdleSession); matched {
 			parsed["min_idle_session"], _ = strconv.Atoi(minIdleSession)
 		}
@@ -1477,14 +1503,14 @@ func (p *SingboxProducer) wireguardParser(proxy Proxy) (map[string]interface{},
 		return nil, fmt.Errorf("invalid port")
 	}
 
-	// Build local_address from ip and ipv6
+	// Build local_address from ip and ipv6 (a prefix length already present is dropped)
 	localAddress := make([]string, 0)
-	if ip := GetString(proxy, "ip"); ip != "" {
+	if ip, _, _ := strings.Cut(GetString(proxy, "ip"), "/"); ip != "" {
 		if IsIPv4(ip) {
 			localAddress = append(localAddress, fmt.Sprintf("%s/32", ip))
 		}
 	}
-	if ipv6 := GetString(proxy, "ipv6"); ipv6 != "" {
+	if ipv6, _, _ := strings.Cut(strings.Trim(GetString(proxy, "ipv6"), "[]"), "/"); ipv6 != "" {
 		if IsIPv6(ipv6) {
 			localAddress = append(localAddress, fmt.Sprintf("%s/128", ipv6))
 		}
@@ -1500,7 +1526,11 @@ func (p *SingboxProducer) wireguardParser(proxy Proxy) (map[string]interface{},
 		"peer_public_key": GetString(proxy, "public-key"),
 	}
 
-	if preSharedKey := GetString(proxy, "pre-shared-key"); preSharedKey != "" {
+	preSharedKey := GetString(proxy, "pre-shared-key")
+	if preSharedKey == "" {
+		preSharedKey = GetString(proxy, "preshared-key")
+	}
+	if preSharedKey != "" {
 		parsed["pre_shared_key"] = preSharedKey
 	}
 
@@ -1508,23 +1538,12 @@ func (p *SingboxProducer) wireguardParser(proxy Proxy) (map[string]interface{},
 		parsed["udp_fragment"] = true
 	}
 
-	// Handle reserved
-	if reserved := proxy["reserved"]; reserved != nil {
-		if str, ok := reserved.(string); ok {
-			parsed["reserved"] = str
-		} else if slice, ok := reserved.([]interface{}); ok {
-			nums := make([]int, 0, len(slice))
-			for _, v := range slice {
-				if num, ok := v.(int); ok {
-					nums = append(nums, num)
-				} else if num, ok := v.(float64); ok {
-					nums = append(nums, int(num))
-				}
-			}
-			if len(nums) > 0 {
-				parsed["reserved"] = nums
-			}
-		}
+	if mtu := GetInt(proxy, "mtu"); mtu > 0 {
+		parsed["mtu"] = mtu
+	}
+
+	if reserved := wireGuardReserved(proxy["reserved"]); reserved != nil {
+		parsed["reserved"] = reserved
 	}
 
 	// Handle peers
@@ -1546,23 +1565,8 @@ func (p *SingboxProducer) wireguardParser(proxy Proxy) (map[string]interface{},
 						peer["allowed_ips"] = allowedIPs
 					}
 
-					// Handle reserved
-					if reserved := peerMap["reserved"]; reserved != nil {
-						if str, ok := reserved.(string); ok {
-							peer["reserved"] = str
-						} else if slice, ok := reserved.([]interface{}); ok {
-							nums := make([]int, 0, len(slice))
-							for _, v := range slice {
-								if num, ok := v.(int); ok {
-									nums = append(nums, num)
-								} else if num, ok := v.(float64); ok {
-									nums = append(nums, int(num))
-								}
-							}
-							if len(nums) > 0 {
-								peer["reserved"] = nums
-							}
-						}
+					if reserved := wireGuardReserved(peerMap["reserved"]); reserved != nil {
+						peer["reserved"] = reserved
 					}
 
 					if preSharedKey := GetString(peerMap, "pre-shared-key"); preSharedKey != "" {
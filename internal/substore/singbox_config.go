@@ -0,0 +1,582 @@
+package substore
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sing-box complete configuration, generated from a Clash config (opts.FullConfig) so that t=sing-box
+// is directly usable: log, dns, inbounds (tun + mixed), outbounds (proxy-groups + nodes), route
+// (rules translated from the Clash rules) and experimental (cache file / clash api).
+// The output targets sing-box 1.12 (new DNS server format, rule actions).
+
+const (
+	singboxDirectTag = "DIRECT"
+
+	singboxDNSLocal  = "dns-local"
+	singboxDNSDirect = "dns-direct"
+	singboxDNSRemote = "dns-remote"
+	singboxDNSFakeIP = "dns-fakeip"
+
+	singboxDefaultRemoteDNS = "https://1.1.1.1/dns-query"
+	singboxDefaultDirectDNS = "223.5.5.5"
+	singboxDefaultTestURL   = "https://www.gstatic.com/generate_204"
+
+	// sing-box 二进制规则集（MetaCubeX meta-rules-dat 的 sing 分支）
+	singboxGeositeRuleSetURL = "https://github.com/MetaCubeX/meta-rules-dat/raw/sing/geo/geosite/%s.srs"
+	singboxGeoIPRuleSetURL   = "https://github.com/MetaCubeX/meta-rules-dat/raw/sing/geo/geoip/%s.srs"
+)
+
+// singboxLogLevels maps Clash log-level to sing-box log.level
+var singboxLogLevels = map[string]string{
+	"debug":   "debug",
+	"info":    "info",
+	"warning": "warn",
+	"error":   "error",
+	"silent":  "panic",
+}
+
+// singboxRuleFields maps Clash rule types to sing-box route rule fields
+var singboxRuleFields = map[string]string{
+	"DOMAIN":         "domain",
+	"DOMAIN-SUFFIX":  "domain_suffix",
+	"DOMAIN-KEYWORD": "domain_keyword",
+	"DOMAIN-REGEX":   "domain_regex",
+	"IP-CIDR":        "ip_cidr",
+	"IP-CIDR6":       "ip_cidr",
+	"SRC-IP-CIDR":    "source_ip_cidr",
+	"DST-PORT":       "port",
+	"SRC-PORT":       "source_port",
+	"PROCESS-NAME":   "process_name",
+	"PROCESS-PATH":   "process_path",
+	"NETWORK":        "network",
+}
+
+// IsFullConfigSource reports whether fullConfig carries enough of a Clash config (proxy-groups
+// or rules) to generate a complete client configuration (sing-box, Surge) instead of a bare node list.
+func IsFullConfigSource(fullConfig map[string]interface{}) bool {
+	if fullConfig == nil {
+		return false
+	}
+	groups, _ := fullConfig["proxy-groups"].([]interface{})
+	rules, _ := fullConfig["rules"].([]interface{})
+	return len(groups) > 0 || len(rules) > 0
+}
+
+// BuildSingboxConfig builds a complete sing-box configuration from the converted node outbounds and
+// the original Clash config. Clash features sing-box cannot express (logical rules, text rule
+// providers, relay groups, ...) are skipped or approximated.
+func BuildSingboxConfig(nodes []map[string]interface{}, fullConfig map[string]interface{}) map[string]interface{} {
+	b := &singboxConfigBuilder{
+		clash:    fullConfig,
+		nodeTags: make(map[string]bool, len(nodes)),
+		ruleSets: make(map[string]map[string]interface{}),
+	}
+	for _, node := range nodes {
+		tag := GetString(node, "tag")
+		if tag == "" {
+			continue
+		}
+		b.nodeTags[tag] = true
+		// shadow-tls 拆出的前置出站只供 detour 引用，不加入 include-all 的代理组
+		if GetString(node, "type") != "shadowtls" {
+			b.nodeOrder = append(b.nodeOrder, tag)
+		}
+	}
+
+	groups := b.buildGroups()
+	outbounds := make([]map[string]interface{}, 0, len(groups)+len(nodes)+1)
+	outbounds = append(outbounds, groups...)
+	outbounds = append(outbounds, nodes...)
+	outbounds = append(outbounds, map[string]interface{}{"type": "direct", "tag": singboxDirectTag})
+
+	config := map[string]interface{}{
+		"log":          b.buildLog(),
+		"dns":          b.buildDNS(),
+		"inbounds":     b.buildInbounds(),
+		"outbounds":    outbounds,
+		"route":        b.buildRoute(),
+		"experimental": b.buildExperimental(),
+	}
+	return config
+}
+
+type singboxConfigBuilder struct {
+	clash      map[string]interface{}
+	nodeTags   map[string]bool
+	nodeOrder  []string
+	groupTags  map[string]bool
+	firstGroup string
+	ruleSets   map[string]map[string]interface{}
+}
+
+func (b *singboxConfigBuilder) buildLog() map[string]interface{} {
+	level := singboxLogLevels[strings.ToLower(GetString(b.clash, "log-level"))]
+	if level == "" {
+		level = "info"
+	}
+	return map[string]interface{}{"level": level, "timestamp": true}
+}
+
+func (b *singboxConfigBuilder) buildInbounds() []map[string]interface{} {
+	listen := "127.0.0.1"
+	if GetBool(b.clash, "allow-lan") {
+		listen = "0.0.0.0"
+	}
+	port := GetInt(b.clash, "mixed-port")
+	if port == 0 {
+		port = GetInt(b.clash, "port")
+	}
+	if port == 0 {
+		port = 7890
+	}
+
+	return []map[string]interface{}{
+		{
+			"type":         "tun",
+			"tag":          "tun-in",
+			"address":      []string{"172.19.0.1/30", "fdfe:dcba:9876::1/126"},
+			"auto_route":   true,
+			"strict_route": true,
+			"stack":        "mixed",
+		},
+		{
+			"type":        "mixed",
+			"tag":         "mixed-in",
+			"listen":      listen,
+			"listen_port": port,
+		},
+	}
+}
+
+// buildGroups converts Clash proxy-groups to selector / urltest outbounds. fallback and load-balance
+// have no sing-box equivalent and become urltest; relay becomes a selector.
+func (b *singboxConfigBuilder) buildGroups() []map[string]interface{} {
+	rawGroups, _ := b.clash["proxy-groups"].([]interface{})
+	b.groupTags = make(map[string]bool, len(rawGroups))
+	for _, raw := range rawGroups {
+		if group, ok := raw.(map[string]interface{}); ok {
+			if name := GetString(group, "name"); name != "" {
+				b.groupTags[name] = true
+				if b.firstGroup == "" {
+					b.firstGroup = name
+				}
+			}
+		}
+	}
+
+	result := make([]map[string]interface{}, 0, len(rawGroups))
+	for _, raw := range rawGroups {
+		group, ok := raw.(map[string]interface{})
+		if !ok || GetString(group, "name") == "" {
+			continue
+		}
+		name := GetString(group, "name")
+
+		members := b.groupMembers(group)
+		if len(members) == 0 {
+			members = []string{singboxDirectTag}
+		}
+
+		outbound := map[string]interface{}{
+			"tag":       name,
+			"outbounds": members,
+		}
+		switch strings.ToLower(GetString(group, "type")) {
+		case "url-test", "fallback", "load-balance":
+			outbound["type"] = "urltest"
+			testURL := GetString(group, "url")
+			if testURL == "" {
+				testURL = singboxDefaultTestURL
+			}
+			outbound["url"] = testURL
+			if interval := GetInt(group, "interval"); interval > 0 {
+				outbound["interval"] = fmt.Sprintf("%ds", interval)
+			}
+			if tolerance := GetInt(group, "tolerance"); tolerance > 0 {
+				outbound["tolerance"] = tolerance
+			}
+		default:
+			outbound["type"] = "selector"
+			outbound["default"] = members[0]
+		}
+		result = append(result, outbound)
+	}
+	return result
+}
+
+// groupMembers resolves the members of a proxy group to existing outbound tags. Nodes that were
+// dropped during conversion and REJECT policies are left out.
+func (b *singboxConfigBuilder) groupMembers(group map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	var members []string
+	add := func(tag string) {
+		if tag == "" || seen[tag] || tag == GetString(group, "name") {
+			return
+		}
+		seen[tag] = true
+		members = append(members, tag)
+	}
+
+	for _, name := range singboxStringList(group["proxies"]) {
+		switch {
+		case strings.EqualFold(name, "DIRECT"):
+			add(singboxDirectTag)
+		case b.nodeTags[name], b.groupTags[name]:
+			add(name)
+		}
+	}
+
+	if GetBool(group, "include-all") || GetBool(group, "include-all-proxies") {
+		var filter *regexp.Regexp
+		if pattern := GetString(group, "filter"); pattern != "" {
+			filter, _ = regexp.Compile(pattern)
+		}
+		for _, tag := range b.nodeOrder {
+			if filter == nil || filter.MatchString(tag) {
+				add(tag)
+			}
+		}
+	}
+	return members
+}
+
+func (b *singboxConfigBuilder) buildDNS() map[string]interface{} {
+	dnsConfig := GetMap(b.clash, "dns")
+
+	remoteAddr := singboxDefaultRemoteDNS
+	directAddr := singboxDefaultDirectDNS
+	if dnsConfig != nil {
+		if servers := singboxStringList(dnsConfig["nameserver"]); len(servers) > 0 {
+			remoteAddr = servers[0]
+		}
+		if servers := singboxStringList(dnsConfig["default-nameserver"]); len(servers) > 0 {
+			directAddr = servers[0]
+		}
+	}
+
+	local := map[string]interface{}{"type": "local", "tag": singboxDNSLocal}
+	direct := singboxDNSServer(directAddr, singboxDNSDirect)
+	remote := singboxDNSServer(remoteAddr, singboxDNSRemote)
+	if b.firstGroup != "" {
+		remote["detour"] = b.firstGroup
+	}
+	servers := []map[string]interface{}{local, direct, remote}
+
+	var rules []map[string]interface{}
+	if dnsConfig != nil && strings.EqualFold(GetString(dnsConfig, "enhanced-mode"), "fake-ip") {
+		fakeIPRange := GetString(dnsConfig, "fake-ip-range")
+		if fakeIPRange == "" {
+			fakeIPRange = "198.18.0.1/16"
+		}
+		servers = append(servers, map[string]interface{}{
+			"type":        "fakeip",
+			"tag":         singboxDNSFakeIP,
+			"inet4_range": fakeIPRange,
+		})
+		rules = append(rules, map[string]interface{}{
+			"query_type": []string{"A", "AAAA"},
+			"server":     singboxDNSFakeIP,
+		})
+	}
+
+	result := map[string]interface{}{
+		"servers": servers,
+		"final":   singboxDNSRemote,
+	}
+	if len(rules) > 0 {
+		result["rules"] = rules
+	}
+	if dnsConfig != nil && IsPresent(dnsConfig, "ipv6") && !GetBool(dnsConfig, "ipv6") {
+		result["strategy"] = "ipv4_only"
+	}
+	return result
+}
+
+// singboxDNSServer converts a Clash nameserver address (223.5.5.5, tls://dns.google,
+// https://1.1.1.1/dns-query, quic://..., dhcp://..., system) to a sing-box 1.12 DNS server.
+func singboxDNSServer(address, tag string) map[string]interface{} {
+	address = strings.TrimSpace(address)
+	// Clash 允许在地址后追加 #代理组 / #参数，sing-box 不支持
+	if idx := strings.Index(address, "#"); idx != -1 {
+		address = address[:idx]
+	}
+	if address == "" || address == "system" || strings.HasPrefix(address, "system://") {
+		return map[string]interface{}{"type": "local", "tag": tag}
+	}
+	if !strings.Contains(address, "://") {
+		address = "udp://" + address
+	}
+
+	parsed, err := url.Parse(address)
+	if err != nil || parsed.Hostname() == "" {
+		return map[string]interface{}{"type": "local", "tag": tag}
+	}
+
+	server := map[string]interface{}{"tag": tag}
+	switch parsed.Scheme {
+	case "dhcp":
+		server["type"] = "dhcp"
+		if parsed.Host != "" && parsed.Host != "system" {
+			server["interface"] = parsed.Host
+		}
+		return server
+	case "https", "h3", "tls", "quic", "tcp", "udp":
+		server["type"] = parsed.Scheme
+	default:
+		server["type"] = "udp"
+	}
+	server["server"] = parsed.Hostname()
+	if port, err := strconv.Atoi(parsed.Port()); err == nil && port > 0 {
+		server["server_port"] = port
+	}
+	if (parsed.Scheme == "https" || parsed.Scheme == "h3") && parsed.Path != "" && parsed.Path != "/dns-query" {
+		server["path"] = parsed.Path
+	}
+	if net.ParseIP(parsed.Hostname()) == nil {
+		server["domain_resolver"] = singboxDNSLocal
+	}
+	return server
+}
+
+func (b *singboxConfigBuilder) buildRoute() map[string]interface{} {
+	rules := []map[string]interface{}{
+		{"action": "sniff"},
+		{"protocol": "dns", "action": "hijack-dns"},
+	}
+
+	final := ""
+	for _, raw := range singboxStringList(b.clash["rules"]) {
+		ruleType, payload, policy, ok := splitClashRule(raw)
+		if !ok {
+			continue
+		}
+		if ruleType == "MATCH" || ruleType == "FINAL" {
+			if b.isOutbound(policy) {
+				final = b.outboundTag(policy)
+			}
+			break
+		}
+
+		rule := b.translateRule(ruleType, payload)
+		if rule == nil {
+			continue
+		}
+		switch strings.ToUpper(policy) {
+		case "REJECT", "REJECT-TINY":
+			rule["action"] = "reject"
+		case "REJECT-DROP":
+			rule["action"] = "reject"
+			rule["method"] = "drop"
+		default:
+			if !b.isOutbound(policy) {
+				continue
+			}
+			rule["outbound"] = b.outboundTag(policy)
+		}
+		rules = append(rules, rule)
+	}
+
+	route := map[string]interface{}{
+		"rules":                   rules,
+		"auto_detect_interface":   true,
+		"default_domain_resolver": singboxDNSDirect,
+	}
+	if final != "" {
+		route["final"] = final
+	}
+	if len(b.ruleSets) > 0 {
+		tags := make([]string, 0, len(b.ruleSets))
+		for tag := range b.ruleSets {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		ruleSets := make([]map[string]interface{}, 0, len(tags))
+		for _, tag := range tags {
+			ruleSets = append(ruleSets, b.ruleSets[tag])
+		}
+		route["rule_set"] = ruleSets
+	}
+	return route
+}
+
+// splitClashRule splits "TYPE,payload,policy[,no-resolve]" / "MATCH,policy"
+func splitClashRule(raw string) (ruleType, payload, policy string, ok bool) {
+	parts := strings.Split(raw, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	ruleType = strings.ToUpper(parts[0])
+	if ruleType == "MATCH" || ruleType == "FINAL" {
+		if len(parts) < 2 {
+			return "", "", "", false
+		}
+		return ruleType, "", parts[1], true
+	}
+	if len(parts) < 3 {
+		return "", "", "", false
+	}
+	return ruleType, parts[1], parts[2], true
+}
+
+// translateRule returns the sing-box match fields of a Clash rule, or nil when the rule type has no
+// sing-box equivalent (logical rules, IP-ASN, ...).
+func (b *singboxConfigBuilder) translateRule(ruleType, payload string) map[string]interface{} {
+	switch ruleType {
+	case "GEOSITE":
+		return map[string]interface{}{"rule_set": b.geoRuleSet("geosite", payload)}
+	case "GEOIP":
+		if strings.EqualFold(payload, "lan") || strings.EqualFold(payload, "private") {
+			return map[string]interface{}{"ip_is_private": true}
+		}
+		return map[string]interface{}{"rule_set": b.geoRuleSet("geoip", payload)}
+	case "RULE-SET":
+		if tag := b.providerRuleSet(payload); tag != "" {
+			return map[string]interface{}{"rule_set": tag}
+		}
+		return nil
+	case "DST-PORT", "SRC-PORT":
+		var ports []int
+		var ranges []string
+		for _, item := range strings.Split(payload, "/") {
+			item = strings.TrimSpace(item)
+			if port, err := strconv.Atoi(item); err == nil {
+				ports = append(ports, port)
+			} else if start, end, ok := strings.Cut(item, "-"); ok {
+				ranges = append(ranges, start+":"+end)
+			}
+		}
+		field := singboxRuleFields[ruleType]
+		rule := map[string]interface{}{}
+		if len(ports) > 0 {
+			rule[field] = ports
+		}
+		if len(ranges) > 0 {
+			rule[field+"_range"] = ranges
+		}
+		if len(rule) == 0 {
+			return nil
+		}
+		return rule
+	case "NETWORK":
+		return map[string]interface{}{"network": strings.ToLower(payload)}
+	}
+
+	field, ok := singboxRuleFields[ruleType]
+	if !ok {
+		return nil
+	}
+	return map[string]interface{}{field: payload}
+}
+
+// geoRuleSet registers the remote binary rule set for GEOSITE / GEOIP and returns its tag
+func (b *singboxConfigBuilder) geoRuleSet(kind, name string) string {
+	name = strings.ToLower(name)
+	tag := kind + "-" + name
+	if _, exists := b.ruleSets[tag]; !exists {
+		urlFormat := singboxGeositeRuleSetURL
+		if kind == "geoip" {
+			urlFormat = singboxGeoIPRuleSetURL
+		}
+		b.ruleSets[tag] = singboxRemoteRuleSet(tag, "binary", fmt.Sprintf(urlFormat, name))
+	}
+	return tag
+}
+
+// providerRuleSet converts a Clash rule-provider into a sing-box rule set. Only providers with a sing-box
+// compatible source can be used: .srs / .json URLs, and MetaCubeX meta-rules-dat, which publishes
+// the same rules as .srs on its sing branch. Returns "" when the provider can't be converted.
+func (b *singboxConfigBuilder) providerRuleSet(name string) string {
+	if _, exists := b.ruleSets[name]; exists {
+		return name
+	}
+	provider := GetMap(GetMap(b.clash, "rule-providers"), name)
+	if provider == nil {
+		return ""
+	}
+	providerURL := GetString(provider, "url")
+	if providerURL == "" {
+		return ""
+	}
+
+	parsed, err := url.Parse(providerURL)
+	if err != nil {
+		return ""
+	}
+	ext := strings.ToLower(path.Ext(parsed.Path))
+	switch {
+	case ext == ".srs":
+		b.ruleSets[name] = singboxRemoteRuleSet(name, "binary", providerURL)
+	case ext == ".json":
+		b.ruleSets[name] = singboxRemoteRuleSet(name, "source", providerURL)
+	case strings.Contains(providerURL, "meta-rules-dat") && (ext == ".mrs" || ext == ".yaml" || ext == ".list"):
+		converted := strings.Replace(providerURL, "/meta/", "/sing/", 1)
+		converted = strings.Replace(converted, "@meta/", "@sing/", 1)
+		if convertedURL, err := url.Parse(converted); err == nil {
+			convertedURL.Path = strings.TrimSuffix(convertedURL.Path, path.Ext(convertedURL.Path)) + ".srs"
+			convertedURL.RawPath = ""
+			converted = convertedURL.String()
+		}
+		b.ruleSets[name] = singboxRemoteRuleSet(name, "binary", converted)
+	default:
+		return ""
+	}
+	return name
+}
+
+func singboxRemoteRuleSet(tag, format, ruleSetURL string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":   "remote",
+		"tag":    tag,
+		"format": format,
+		"url":    ruleSetURL,
+	}
+}
+
+func (b *singboxConfigBuilder) isOutbound(policy string) bool {
+	return strings.EqualFold(policy, "DIRECT") || b.groupTags[policy] || b.nodeTags[policy]
+}
+
+func (b *singboxConfigBuilder) outboundTag(policy string) string {
+	if strings.EqualFold(policy, "DIRECT") {
+		return singboxDirectTag
+	}
+	return policy
+}
+
+func (b *singboxConfigBuilder) buildExperimental() map[string]interface{} {
+	experimental := map[string]interface{}{
+		"cache_file": map[string]interface{}{"enabled": true},
+	}
+	if controller := GetString(b.clash, "external-controller"); controller != "" {
+		clashAPI := map[string]interface{}{"external_controller": controller}
+		if secret := GetString(b.clash, "secret"); secret != "" {
+			clashAPI["secret"] = secret
+		}
+		experimental["clash_api"] = clashAPI
+	}
+	return experimental
+}
+
+// singboxStringList reads a YAML list of strings
+func singboxStringList(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
@@ -65,10 +65,12 @@ func (p *StashProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 
 		// Filter unsupported types
 		shouldSkip := false
+		skipReason := ""
 
 		// Check supported types
 		if !p.isSupportedType(proxyType) {
 			shouldSkip = true
+			skipReason = "unsupported proxy type " + proxyType
 			logger.Info("[Stash] 跳过不支持的协议类型", "name", GetString(proxy, "name"), "type", proxyType)
 		}
 
@@ -79,6 +81,7 @@ func (p *StashProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 				// 客户端兼容模式开启时跳过不支持的cipher节点
 				if opts.ClientCompatibilityMode {
 					shouldSkip = true
+					skipReason = "unsupported shadowsocks cipher " + cipher
 					logger.Info("[Stash] 跳过不支持的SS加密方式", "name", GetString(proxy, "name"), "cipher", cipher)
 				}
 			}
@@ -87,6 +90,7 @@ func (p *StashProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 		// Check Snell version
 		if proxyType == "snell" && GetInt(proxy, "version") >= 4 {
 			shouldSkip = true
+			skipReason = "snell v4+ is not supported"
 			logger.Info("[Stash] 跳过Snell v4+节点", "name", GetString(proxy, "name"), "version", GetInt(proxy, "version"))
 		}
 
@@ -97,6 +101,7 @@ func (p *StashProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 				// 客户端兼容模式开启时跳过没有流控算法的节点
 				if opts.ClientCompatibilityMode {
 					shouldSkip = true
+					skipReason = "vless reality requires xtls-rprx-vision flow"
 					logger.Info("[Stash] 跳过VLESS reality节点(缺少xtls-rprx-vision流控)", "name", GetString(proxy, "name"), "flow", flow)
 				}
 			}
@@ -107,6 +112,7 @@ func (p *StashProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 			// 客户端兼容模式开启时跳过链式代理节点
 			if opts.ClientCompatibilityMode {
 				shouldSkip = true
+				skipReason = "dialer proxy is not supported"
 				logger.Info("[Stash] 跳过链式代理节点", "name", GetString(proxy, "name"))
 			}
 		}
@@ -114,6 +120,7 @@ func (p *StashProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 		// Check anytls: requires include-unsupported-proxy
 		if proxyType == "anytls" && !opts.IncludeUnsupportedProxy {
 			shouldSkip = true
+			skipReason = "anytls requires include-unsupported-proxy"
 			logger.Info("[Stash] 跳过anytls节点(需要启用include-unsupported-proxy)", "name", GetString(proxy, "name"))
 		}
 
@@ -122,10 +129,12 @@ func (p *StashProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 			network := GetString(proxy, "network")
 			if network != "" && network != "tcp" {
 				shouldSkip = true
+				skipReason = "anytls only supports tcp network"
 				logger.Info("[Stash] 跳过anytls节点(不支持的network)", "name", GetString(proxy, "name"), "network", network)
 			}
 			if network == "tcp" && IsPresent(proxy, "reality-opts") {
 				shouldSkip = true
+				skipReason = "anytls with reality is not supported"
 				logger.Info("[Stash] 跳过anytls节点(tcp+reality不支持)", "name", GetString(proxy, "name"))
 			}
 		}
@@ -133,6 +142,7 @@ func (p *StashProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 		// Check xhttp network
 		if GetString(proxy, "network") == "xhttp" {
 			shouldSkip = true
+			skipReason = "xhttp network is not supported"
 			logger.Info("[Stash] 跳过xhttp网络节点", "name", GetString(proxy, "name"))
 		}
 
@@ -141,6 +151,7 @@ func (p *StashProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 			encryption := GetString(proxy, "encryption")
 			if encryption != "" && encryption != "none" {
 				shouldSkip = true
+				skipReason = "unsupported vless encryption " + encryption
 				logger.Info("[Stash] 跳过VLESS节点(encryption必须为none)", "name", GetString(proxy, "name"), "encryption", encryption)
 			}
 		}
@@ -150,12 +161,14 @@ func (p *StashProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 			if wsOpts := GetMap(proxy, "ws-opts"); wsOpts != nil {
 				if GetBool(wsOpts, "v2ray-http-upgrade") {
 					shouldSkip = true
+					skipReason = "ws with http upgrade is not supported"
 					logger.Info("[Stash] 跳过ws+v2ray-http-upgrade节点", "name", GetString(proxy, "name"))
 				}
 			}
 		}
 
 		if shouldSkip {
+			opts.skip(proxy, skipReason)
 			continue
 		}
 
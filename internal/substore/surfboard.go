@@ -24,6 +24,11 @@ func (p *SurfboardProducer) GetType() string {
 	return p.producerType
 }
 
+// OutputFormat returns the format used to serve the output
+func (p *SurfboardProducer) OutputFormat() OutputFormat {
+	return OutputFormatText
+}
+
 // Produce converts a single proxy to Surfboard format
 // For Surfboard, we expect proxies to be converted one by one
 func (p *SurfboardProducer) Produce(proxies []Proxy, outputType string, opts *ProduceOptions) (interface{}, error) {
@@ -35,11 +40,9 @@ func (p *SurfboardProducer) Produce(proxies []Proxy, outputType string, opts *Pr
 	for _, proxy := range proxies {
 		result, err := p.produceSingle(proxy)
 		if err != nil {
-			// Skip unsupported proxies if configured
-			if opts.IncludeUnsupportedProxy {
-				continue
-			}
-			return nil, err
+			// Skip unsupported proxies and report them instead of failing the whole conversion
+			opts.skip(proxy, err.Error())
+			continue
 		}
 		results = append(results, result)
 	}
@@ -2,7 +2,6 @@ package substore
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
 )
 
@@ -33,6 +32,11 @@ func (p *SurgeProducer) GetType() string {
 	return p.producerType
 }
 
+// OutputFormat returns the format used to serve the output
+func (p *SurgeProducer) OutputFormat() OutputFormat {
+	return OutputFormatText
+}
+
 // Produce converts proxies to Surge format
 func (p *SurgeProducer) Produce(proxies []Proxy, outputType string, opts *ProduceOptions) (interface{}, error) {
 	if opts == nil {
@@ -51,6 +55,7 @@ func (p *SurgeProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 
 		if err != nil {
 			if !opts.IncludeUnsupportedProxy {
+				opts.skip(proxy, err.Error())
 				continue
 			}
 		}
@@ -124,17 +129,14 @@ func (p *SurgeProducer) ProduceOne(proxy Proxy, outputType string, opts *Produce
 		}
 		return "", fmt.Errorf("platform Surge does not support proxy type: %s", proxyType)
 	case "anytls":
-		if includeUnsupported {
-			network := GetString(proxy, "network")
-			if network != "" && network != "tcp" {
-				return "", fmt.Errorf("platform Surge does not support proxy type %s with network or reality", proxyType)
-			}
-			if network == "tcp" && IsPresent(proxy, "reality-opts") {
-				return "", fmt.Errorf("platform Surge does not support proxy type %s with network or reality", proxyType)
-			}
-			return p.anytls(proxy)
+		network := GetString(proxy, "network")
+		if network != "" && network != "tcp" {
+			return "", fmt.Errorf("platform Surge does not support proxy type %s with network or reality", proxyType)
 		}
-		return "", fmt.Errorf("platform Surge does not support proxy type: %s", proxyType)
+		if IsPresent(proxy, "reality-opts") {
+			return "", fmt.Errorf("platform Surge does not support proxy type %s with network or reality", proxyType)
+		}
+		return p.anytls(proxy)
 	default:
 		return "", fmt.Errorf("platform Surge does not support proxy type: %s", proxyType)
 	}
@@ -394,20 +396,14 @@ func (p *SurgeProducer) tuic(proxy Proxy) (string, error) {
 	// alpn
 	if IsPresent(proxy, "alpn") {
 		alpn := proxy["alpn"]
-		if alpnSlice, ok := alpn.([]interface{}); ok && len(alpnSlice) > 0 {
-			result.Append(fmt.Sprintf(",alpn=%v", alpnSlice[0]))
+		if alpnSlice := GetStringSlice(proxy, "alpn"); len(alpnSlice) > 0 {
+			result.Append(fmt.Sprintf(",alpn=%s", alpnSlice[0]))
 		} else if alpnStr, ok := alpn.(string); ok {
 			result.Append(fmt.Sprintf(",alpn=%s", alpnStr))
 		}
 	}
 
-	// port hopping
-	if IsPresent(proxy, "ports") {
-		ports := strings.ReplaceAll(GetString(proxy, "ports"), ",", ";")
-		result.Append(fmt.Sprintf(`,port-hopping="%s"`, ports))
-	}
-	result.AppendIfPresent(`,port-hopping-interval=%s`, "hop-interval")
-
+	p.appendPortHopping(result, proxy)
 	p.appendIPVersion(result, proxy)
 
 	// Common options except tfo (we handle it separately below)
@@ -440,31 +436,47 @@ func (p *SurgeProducer) tuic(proxy Proxy) (string, error) {
 }
 
 func (p *SurgeProducer) wireguard(proxy Proxy) (string, error) {
+	line, section, err := p.WireGuard(proxy)
+	if err != nil {
+		return "", err
+	}
+	name := GetString(proxy, "name")
+
+	// A proxy list has no place for the [WireGuard] section, so both parts are emitted for the user
+	// to copy: the proxy line commented out, followed by the section.
+	return fmt.Sprintf("# > WireGuard Proxy %s\n# %s\n# > WireGuard Section %s\n%s", name, line, name, section), nil
+}
+
+// WireGuard returns the [Proxy] line of a WireGuard proxy and the [WireGuard <section-name>] section
+// it references. Peer options are written in a fixed order; reserved bytes become client-id.
+func (p *SurgeProducer) WireGuard(proxy Proxy) (string, string, error) {
 	// Handle peers array
 	if peers, ok := proxy["peers"].([]interface{}); ok && len(peers) > 0 {
 		if peer, ok := peers[0].(map[string]interface{}); ok {
-			proxy["server"] = peer["server"]
-			proxy["port"] = peer["port"]
-			proxy["ip"] = peer["ip"]
-			proxy["ipv6"] = peer["ipv6"]
-			proxy["public-key"] = peer["public-key"]
-			proxy["preshared-key"] = peer["pre-shared-key"]
-			proxy["allowed-ips"] = peer["allowed-ips"]
-			proxy["reserved"] = peer["reserved"]
+			for _, key := range []string{"server", "port", "ip", "ipv6", "public-key", "allowed-ips", "reserved"} {
+				if IsPresent(peer, key) {
+					proxy[key] = peer[key]
+				}
+			}
+			if IsPresent(peer, "pre-shared-key") {
+				proxy["preshared-key"] = peer["pre-shared-key"]
+			}
 		}
 	}
+	if GetString(proxy, "private-key") == "" || GetString(proxy, "public-key") == "" {
+		return "", "", fmt.Errorf("wireguard proxy requires private-key and public-key")
+	}
 
-	result := &Result{Proxy: proxy}
-	name := GetString(proxy, "name")
-
-	result.Append(fmt.Sprintf("# > WireGuard Proxy %s\n# %s=wireguard", name, name))
-
+	name := strings.NewReplacer("=", "", ",", "").Replace(GetString(proxy, "name"))
+	proxy["name"] = name
 	sectionName := GetString(proxy, "section-name")
 	if sectionName == "" {
 		sectionName = name
 		proxy["section-name"] = sectionName
 	}
 
+	result := &Result{Proxy: proxy}
+	result.Append(fmt.Sprintf("%s=wireguard", name))
 	result.AppendIfPresent(`,section-name=%s`, "section-name")
 	p.appendCommonOptions(result, proxy)
 
@@ -473,93 +485,49 @@ func (p *SurgeProducer) wireguard(proxy Proxy) (string, error) {
 		ipVersion = GetString(proxy, "ip-version")
 	}
 
-	result.Append(fmt.Sprintf("\n# > WireGuard Section %s\n[WireGuard %s]\nprivate-key = %s",
-		name, sectionName, GetString(proxy, "private-key")))
-
-	result.AppendIfPresent(`\nself-ip = %s`, "ip")
-	result.AppendIfPresent(`\nself-ip-v6 = %s`, "ipv6")
-
-	// DNS
-	if IsPresent(proxy, "dns") {
-		dns := proxy["dns"]
-		if dnsSlice, ok := dns.([]interface{}); ok {
-			var dnsStrs []string
-			for _, d := range dnsSlice {
-				dnsStrs = append(dnsStrs, fmt.Sprintf("%v", d))
-			}
-			result.Append(fmt.Sprintf("\ndns-server = %s", strings.Join(dnsStrs, ", ")))
-		} else if dnsStr, ok := dns.(string); ok {
-			result.Append(fmt.Sprintf("\ndns-server = %s", dnsStr))
-		}
+	var section strings.Builder
+	fmt.Fprintf(&section, "[WireGuard %s]\nprivate-key = %s", sectionName, GetString(proxy, "private-key"))
+	if ip, _, _ := strings.Cut(GetString(proxy, "ip"), "/"); ip != "" {
+		fmt.Fprintf(&section, "\nself-ip = %s", ip)
 	}
-
-	result.AppendIfPresent(`\nmtu = %d`, "mtu")
-
-	if ipVersion == "prefer-v6" {
-		result.Append("\nprefer-ipv6 = true")
+	if ipv6, _, _ := strings.Cut(strings.Trim(GetString(proxy, "ipv6"), "[]"), "/"); ipv6 != "" {
+		fmt.Fprintf(&section, "\nself-ip-v6 = %s", ipv6)
 	}
-
-	// allowed-ips
-	var allowedIps string
-	if ips, ok := proxy["allowed-ips"].([]interface{}); ok {
-		var ipStrs []string
-		for _, ip := range ips {
-			ipStrs = append(ipStrs, fmt.Sprintf("%v", ip))
-		}
-		allowedIps = strings.Join(ipStrs, ",")
-	} else if ips, ok := proxy["allowed-ips"].(string); ok {
-		allowedIps = ips
+	if dns := wireGuardStrings(proxy["dns"]); len(dns) > 0 {
+		fmt.Fprintf(&section, "\ndns-server = %s", strings.Join(dns, ", "))
 	}
-
-	// reserved
-	var reserved string
-	if res, ok := proxy["reserved"].([]interface{}); ok {
-		var resStrs []string
-		for _, r := range res {
-			resStrs = append(resStrs, fmt.Sprintf("%v", r))
-		}
-		reserved = strings.Join(resStrs, "/")
-	} else if res, ok := proxy["reserved"].(string); ok {
-		reserved = res
+	if mtu := GetInt(proxy, "mtu"); mtu > 0 {
+		fmt.Fprintf(&section, "\nmtu = %d", mtu)
 	}
-
-	// preshared-key
-	presharedKey := GetString(proxy, "preshared-key")
-	if presharedKey == "" {
-		presharedKey = GetString(proxy, "pre-shared-key")
+	if ipVersion == "prefer-v6" {
+		section.WriteString("\nprefer-ipv6 = true")
 	}
 
-	// Build peer
-	peer := make(map[string]string)
-	peer["public-key"] = GetString(proxy, "public-key")
-	if allowedIps != "" {
-		peer["allowed-ips"] = fmt.Sprintf(`"%s"`, allowedIps)
+	peer := []string{"public-key = " + GetString(proxy, "public-key")}
+	if allowedIPs := wireGuardStrings(proxy["allowed-ips"]); len(allowedIPs) > 0 {
+		peer = append(peer, fmt.Sprintf(`allowed-ips = "%s"`, strings.Join(allowedIPs, ", ")))
 	}
-	peer["endpoint"] = fmt.Sprintf("%s:%d", GetString(proxy, "server"), GetInt(proxy, "port"))
-
+	peer = append(peer, fmt.Sprintf("endpoint = %s:%d", GetString(proxy, "server"), GetInt(proxy, "port")))
 	keepalive := GetInt(proxy, "persistent-keepalive")
 	if keepalive == 0 {
 		keepalive = GetInt(proxy, "keepalive")
 	}
 	if keepalive > 0 {
-		peer["keepalive"] = fmt.Sprintf("%d", keepalive)
+		peer = append(peer, fmt.Sprintf("keepalive = %d", keepalive))
 	}
-	if reserved != "" {
-		peer["client-id"] = reserved
+	if reserved := wireGuardReserved(proxy["reserved"]); reserved != nil {
+		peer = append(peer, fmt.Sprintf("client-id = %d/%d/%d", reserved[0], reserved[1], reserved[2]))
 	}
-	if presharedKey != "" {
-		peer["preshared-key"] = presharedKey
+	presharedKey := GetString(proxy, "preshared-key")
+	if presharedKey == "" {
+		presharedKey = GetString(proxy, "pre-shared-key")
 	}
-
-	var peerParts []string
-	for k, v := range peer {
-		if v != "" {
-			peerParts = append(peerParts, fmt.Sprintf("%s = %s", k, v))
-		}
+	if presharedKey != "" {
+		peer = append(peer, "preshared-key = "+presharedKey)
 	}
-	result.Append(fmt.Sprintf("\npeer = (%s)", strings.Join(peerParts, ", ")))
+	fmt.Fprintf(&section, "\npeer = (%s)", strings.Join(peer, ", "))
 
-	return result.String(), nil
+	return result.String(), section.String(), nil
 }
 
 func (p *SurgeProducer) wireguardSurge(proxy Proxy) (string, error) {
@@ -574,15 +542,9 @@ func (p *SurgeProducer) wireguardSurge(proxy Proxy) (string, error) {
 }
 
 func (p *SurgeProducer) hysteria2(proxy Proxy, includeUnsupported bool) (string, error) {
-	// Check obfs support
-	if includeUnsupported {
-		if IsPresent(proxy, "obfs-password") && GetString(proxy, "obfs") != "salamander" {
-			return "", fmt.Errorf("only salamander obfs is supported")
-		}
-	} else {
-		if IsPresent(proxy, "obfs") || IsPresent(proxy, "obfs-password") {
-			return "", fmt.Errorf("obfs is unsupported")
-		}
+	// Surge only implements the salamander obfs
+	if obfs := GetString(proxy, "obfs"); (obfs != "" && obfs != "salamander") || (obfs == "" && IsPresent(proxy, "obfs-password")) {
+		return "", fmt.Errorf("only salamander obfs is supported")
 	}
 
 	result := &Result{Proxy: proxy}
@@ -593,13 +555,7 @@ func (p *SurgeProducer) hysteria2(proxy Proxy, includeUnsupported bool) (string,
 		GetInt(proxy, "port")))
 
 	result.AppendIfPresent(`,password="%s"`, "password")
-
-	// port hopping
-	if IsPresent(proxy, "ports") {
-		ports := strings.ReplaceAll(GetString(proxy, "ports"), ",", ";")
-		result.Append(fmt.Sprintf(`,port-hopping="%s"`, ports))
-	}
-	result.AppendIfPresent(`,port-hopping-interval=%s`, "hop-interval")
+	p.appendPortHopping(result, proxy)
 
 	// salamander obfs
 	if IsPresent(proxy, "obfs-password") && GetString(proxy, "obfs") == "salamander" {
@@ -612,11 +568,8 @@ func (p *SurgeProducer) hysteria2(proxy Proxy, includeUnsupported bool) (string,
 	p.appendShadowTLS(result, proxy)
 
 	// download-bandwidth
-	if down := GetString(proxy, "down"); down != "" {
-		re := regexp.MustCompile(`\d+`)
-		if match := re.FindString(down); match != "" {
-			result.Append(fmt.Sprintf(",download-bandwidth=%s", match))
-		}
+	if down := GetBandwidthMbps(proxy, "down"); down > 0 {
+		result.Append(fmt.Sprintf(",download-bandwidth=%d", down))
 	}
 
 	result.AppendIfPresent(`,ecn=%v`, "ecn")
@@ -655,6 +608,16 @@ func (p *SurgeProducer) appendIPVersion(result *Result, proxy Proxy) {
 	}
 }
 
+// appendPortHopping 输出 hysteria2 / tuic 的端口跳跃：port-hopping="1000-2000;3000"
+func (p *SurgeProducer) appendPortHopping(result *Result, proxy Proxy) {
+	if ports := GetPortHopping(proxy); len(ports) > 0 {
+		result.Append(fmt.Sprintf(`,port-hopping="%s"`, strings.Join(ports, ";")))
+		if interval := GetDurationSeconds(proxy, "hop-interval"); interval != "" {
+			result.Append(",port-hopping-interval=" + interval)
+		}
+	}
+}
+
 func (p *SurgeProducer) appendCommonOptions(result *Result, _ Proxy) {
 	result.AppendIfPresent(`,no-error-alert=%v`, "no-error-alert")
 	result.AppendIfPresent(`,tfo=%v`, "tfo")
@@ -0,0 +1,448 @@
+package substore
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Surge complete profile, generated from a Clash config for t=clash-to-surge: [General] (log level,
+// DNS, listeners), [Proxy] (converted nodes), [Proxy Group] (translated from proxy-groups) and [Rule]
+// (translated from the Clash rules). Rules Surge cannot express are kept as comments so the profile
+// stays loadable and the gap is visible. t=surge keeps returning the bare node list, which clients
+// load as a policy-path / external node list.
+
+const surgeDefaultTestURL = "http://www.gstatic.com/generate_204"
+
+// surgeRuleTypes maps Clash rule types to their Surge names. Types not listed here have no Surge
+// equivalent (GEOSITE, DOMAIN-REGEX, SRC-GEOIP, ...).
+var surgeRuleTypes = map[string]string{
+	"DOMAIN":          "DOMAIN",
+	"DOMAIN-SUFFIX":   "DOMAIN-SUFFIX",
+	"DOMAIN-KEYWORD":  "DOMAIN-KEYWORD",
+	"DOMAIN-WILDCARD": "DOMAIN-WILDCARD",
+	"IP-CIDR":         "IP-CIDR",
+	"IP-CIDR6":        "IP-CIDR6",
+	"IP-ASN":          "IP-ASN",
+	"GEOIP":           "GEOIP",
+	"SRC-IP-CIDR":     "SRC-IP",
+	"SRC-PORT":        "SRC-PORT",
+	"DST-PORT":        "DEST-PORT",
+	"IN-PORT":         "IN-PORT",
+	"PROCESS-NAME":    "PROCESS-NAME",
+	"PROCESS-PATH":    "PROCESS-NAME",
+	"NETWORK":         "PROTOCOL",
+}
+
+// surgePrivateCIDRs replaces GEOIP,LAN / GEOIP,PRIVATE, which Surge's GeoIP database doesn't know
+var surgePrivateCIDRs = []string{"IP-CIDR,10.0.0.0/8", "IP-CIDR,100.64.0.0/10", "IP-CIDR,127.0.0.0/8", "IP-CIDR,172.16.0.0/12", "IP-CIDR,192.168.0.0/16", "IP-CIDR6,fc00::/7", "IP-CIDR6,fe80::/10"}
+
+var surgeNameReplacer = strings.NewReplacer("=", "", ",", "")
+
+// BuildSurgeProfile builds a complete Surge profile from the nodes and the original Clash config.
+// Nodes Surge can't use are reported through opts.Warnings and removed from the groups.
+func BuildSurgeProfile(proxies []Proxy, fullConfig map[string]interface{}, opts *ProduceOptions) string {
+	b := &surgeProfileBuilder{
+		clash:     fullConfig,
+		nodeNames: make(map[string]string, len(proxies)),
+		groups:    make(map[string]string),
+	}
+
+	proxySection := b.buildProxies(proxies, opts)
+	groupSection := b.buildGroups()
+	sections := []string{b.buildGeneral(), proxySection, groupSection, b.buildRules()}
+	sections = append(sections, b.wireGuard...)
+	return strings.Join(sections, "\n\n") + "\n"
+}
+
+type surgeProfileBuilder struct {
+	clash map[string]interface{}
+	// nodeNames / groups map the Clash name to the (sanitized) Surge policy name
+	nodeNames  map[string]string
+	groups     map[string]string
+	firstGroup string
+	wireGuard  []string
+}
+
+func (b *surgeProfileBuilder) buildGeneral() string {
+	lines := []string{"[General]"}
+	lines = append(lines, "loglevel = "+convertLogLevel(GetString(b.clash, "log-level")))
+
+	dnsConfig := GetMap(b.clash, "dns")
+	var plain, encrypted []string
+	if dnsConfig != nil {
+		servers := append(append([]string{}, singboxStringList(dnsConfig["default-nameserver"])...), singboxStringList(dnsConfig["nameserver"])...)
+		for _, server := range servers {
+			server = strings.TrimSpace(server)
+			if idx := strings.Index(server, "#"); idx != -1 {
+				server = server[:idx]
+			}
+			switch {
+			case strings.HasPrefix(server, "https://"), strings.HasPrefix(server, "quic://"), strings.HasPrefix(server, "h3://"):
+				if !contains(encrypted, server) {
+					encrypted = append(encrypted, server)
+				}
+			case strings.Contains(server, "://"):
+				// tls:// / tcp:// / dhcp:// 无法直接对应，取其中的 IP 作为普通 DNS
+				if parsed, err := url.Parse(server); err == nil && net.ParseIP(parsed.Hostname()) != nil && !contains(plain, parsed.Hostname()) {
+					plain = append(plain, parsed.Hostname())
+				}
+			case server == "system":
+				if !contains(plain, "system") {
+					plain = append(plain, "system")
+				}
+			default:
+				if host, _, err := net.SplitHostPort(server); err == nil {
+					server = host
+				}
+				if net.ParseIP(server) != nil && !contains(plain, server) {
+					plain = append(plain, server)
+				}
+			}
+		}
+	}
+	if len(plain) == 0 {
+		plain = []string{"223.5.5.5", "119.29.29.29"}
+	}
+	lines = append(lines, "dns-server = "+strings.Join(plain, ", "))
+	if len(encrypted) > 0 {
+		lines = append(lines, "encrypted-dns-server = "+strings.Join(encrypted, ", "))
+	}
+
+	ipv6 := GetBool(b.clash, "ipv6")
+	if dnsConfig != nil && IsPresent(dnsConfig, "ipv6") {
+		ipv6 = ipv6 || GetBool(dnsConfig, "ipv6")
+	}
+	lines = append(lines, fmt.Sprintf("ipv6 = %v", ipv6))
+
+	// fake-ip-filter 中的域名需要返回真实 IP，对应 Surge 的 always-real-ip
+	if dnsConfig != nil && strings.EqualFold(GetString(dnsConfig, "enhanced-mode"), "fake-ip") {
+		var realIP []string
+		for _, domain := range singboxStringList(dnsConfig["fake-ip-filter"]) {
+			domain = strings.TrimSpace(domain)
+			if domain == "" || strings.Contains(domain, ":") {
+				continue
+			}
+			if after, ok := strings.CutPrefix(domain, "+."); ok {
+				domain = "*." + after
+			}
+			realIP = append(realIP, domain)
+		}
+		if len(realIP) > 0 {
+			lines = append(lines, "always-real-ip = "+strings.Join(realIP, ", "))
+		}
+	}
+
+	lines = append(lines,
+		"skip-proxy = 127.0.0.1, 192.168.0.0/16, 10.0.0.0/8, 172.16.0.0/12, 100.64.0.0/10, localhost, *.local",
+		"exclude-simple-hostnames = true",
+		"internet-test-url = "+surgeDefaultTestURL,
+		"proxy-test-url = "+surgeDefaultTestURL,
+		"test-timeout = 5",
+	)
+
+	if GetBool(b.clash, "allow-lan") {
+		lines = append(lines, "allow-wifi-access = true")
+		port := GetInt(b.clash, "mixed-port")
+		if port == 0 {
+			port = GetInt(b.clash, "port")
+		}
+		if port > 0 {
+			lines = append(lines, fmt.Sprintf("wifi-access-http-port = %d", port))
+		}
+		socksPort := GetInt(b.clash, "socks-port")
+		if socksPort == 0 {
+			socksPort = GetInt(b.clash, "mixed-port")
+		}
+		if socksPort > 0 {
+			lines = append(lines, fmt.Sprintf("wifi-access-socks5-port = %d", socksPort))
+		}
+	}
+
+	// 仅在 Clash 配置了密钥时开放外部控制，避免使用默认密码
+	if controller, secret := GetString(b.clash, "external-controller"), GetString(b.clash, "secret"); controller != "" && secret != "" {
+		lines = append(lines, fmt.Sprintf("external-controller-access = %s@%s", secret, controller))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (b *surgeProfileBuilder) buildProxies(proxies []Proxy, opts *ProduceOptions) string {
+	producer := NewSurgeProducer()
+	lines := []string{"[Proxy]"}
+	for _, proxy := range proxies {
+		original := GetString(proxy, "name")
+
+		var line string
+		var err error
+		if GetString(proxy, "type") == ProxyTypeWireGuard {
+			var section string
+			line, section, err = producer.WireGuard(proxy)
+			if err == nil {
+				b.wireGuard = append(b.wireGuard, section)
+			}
+		} else {
+			line, err = producer.ProduceOne(proxy, "", opts)
+		}
+		if err != nil || line == "" {
+			if err != nil {
+				opts.skip(proxy, err.Error())
+			}
+			continue
+		}
+
+		name := surgeNameReplacer.Replace(original)
+		if dialer := GetString(proxy, "dialer-proxy"); dialer != "" {
+			line += ",underlying-proxy=" + surgeNameReplacer.Replace(dialer)
+		}
+		lines = append(lines, line)
+		b.nodeNames[original] = name
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (b *surgeProfileBuilder) buildGroups() string {
+	rawGroups, _ := b.clash["proxy-groups"].([]interface{})
+	for _, raw := range rawGroups {
+		if group, ok := raw.(map[string]interface{}); ok {
+			if name := GetString(group, "name"); name != "" {
+				b.groups[name] = surgeNameReplacer.Replace(name)
+				if b.firstGroup == "" {
+					b.firstGroup = b.groups[name]
+				}
+			}
+		}
+	}
+
+	lines := []string{"[Proxy Group]"}
+	for _, raw := range rawGroups {
+		group, ok := raw.(map[string]interface{})
+		if !ok || GetString(group, "name") == "" {
+			continue
+		}
+		name := b.groups[GetString(group, "name")]
+		groupType := convertProxyGroupType(GetString(group, "type"))
+
+		var members, filters []string
+		for _, member := range singboxStringList(group["proxies"]) {
+			if IsRegexProxyPattern(member) {
+				filters = append(filters, member)
+				continue
+			}
+			if policy, ok := b.policy(member); ok && policy != name && !contains(members, policy) {
+				members = append(members, policy)
+			}
+		}
+		includeAll := len(filters) > 0 || GetBool(group, "include-all") || GetBool(group, "include-all-proxies")
+		if len(members) == 0 && !includeAll {
+			members = []string{"DIRECT"}
+		}
+
+		parts := []string{groupType}
+		parts = append(parts, members...)
+		if groupType != "select" {
+			testURL := GetString(group, "url")
+			if testURL == "" {
+				testURL = surgeDefaultTestURL
+			}
+			interval := GetInt(group, "interval")
+			if interval <= 0 {
+				interval = 300
+			}
+			parts = append(parts, "url="+testURL, fmt.Sprintf("interval=%d", interval), "timeout=5")
+			if groupType == "url-test" {
+				tolerance := GetInt(group, "tolerance")
+				if tolerance <= 0 {
+					tolerance = 150
+				}
+				parts = append(parts, fmt.Sprintf("tolerance=%d", tolerance))
+			}
+		}
+		if includeAll {
+			filter := GetString(group, "filter")
+			if len(filters) > 0 {
+				filter = ExtractSurgeRegexFilter(filters)
+			}
+			if filter != "" {
+				parts = append(parts, "policy-regex-filter="+filter)
+			}
+			parts = append(parts, "include-all-proxies=1")
+		}
+		if GetBool(group, "hidden") {
+			parts = append(parts, "hidden=1")
+		}
+		lines = append(lines, name+" = "+strings.Join(parts, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (b *surgeProfileBuilder) buildRules() string {
+	lines := []string{"[Rule]"}
+	hasFinal := false
+	for _, raw := range singboxStringList(b.clash["rules"]) {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		translated, ok := b.translateRule(raw)
+		if !ok {
+			lines = append(lines, "# 未转换: "+raw)
+			continue
+		}
+		lines = append(lines, translated...)
+		if len(translated) > 0 && strings.HasPrefix(translated[0], "FINAL,") {
+			hasFinal = true
+			break
+		}
+	}
+	if !hasFinal {
+		final := b.firstGroup
+		if final == "" {
+			final = "DIRECT"
+		}
+		lines = append(lines, "FINAL,"+final)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// translateRule converts one Clash rule to Surge rule lines; ok is false when Surge has no equivalent
+// or the rule targets a policy missing from the profile.
+func (b *surgeProfileBuilder) translateRule(raw string) ([]string, bool) {
+	ruleType, _, _ := strings.Cut(raw, ",")
+	ruleType = strings.ToUpper(strings.TrimSpace(ruleType))
+
+	// AND / OR / NOT 的子规则中含有逗号，策略取最外层的最后一个字段
+	if ruleType == "AND" || ruleType == "OR" || ruleType == "NOT" {
+		body, policyName, ok := splitLogicalRule(raw)
+		if !ok {
+			return nil, false
+		}
+		policy, ok := b.policy(policyName)
+		if !ok {
+			return nil, false
+		}
+		body = strings.NewReplacer("(DST-PORT,", "(DEST-PORT,", "(SRC-IP-CIDR,", "(SRC-IP,", "(NETWORK,", "(PROTOCOL,").Replace(body)
+		return []string{body + "," + policy}, true
+	}
+
+	parts := strings.Split(raw, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	if ruleType == "MATCH" || ruleType == "FINAL" {
+		if len(parts) < 2 {
+			return nil, false
+		}
+		policy, ok := b.policy(parts[1])
+		if !ok {
+			return nil, false
+		}
+		return []string{"FINAL," + policy}, true
+	}
+	if len(parts) < 3 {
+		return nil, false
+	}
+	payload := parts[1]
+	policy, ok := b.policy(parts[2])
+	if !ok {
+		return nil, false
+	}
+	var options string
+	if len(parts) > 3 && strings.EqualFold(parts[3], "no-resolve") {
+		options = ",no-resolve"
+	}
+
+	switch ruleType {
+	case "GEOIP":
+		if strings.EqualFold(payload, "lan") || strings.EqualFold(payload, "private") {
+			lines := make([]string, 0, len(surgePrivateCIDRs))
+			for _, cidr := range surgePrivateCIDRs {
+				lines = append(lines, cidr+","+policy+",no-resolve")
+			}
+			return lines, true
+		}
+	case "RULE-SET":
+		ruleSetURL, ok := b.providerURL(payload)
+		if !ok {
+			return nil, false
+		}
+		return []string{"RULE-SET," + ruleSetURL + "," + policy + options}, true
+	case "NETWORK":
+		payload = strings.ToUpper(payload)
+	}
+
+	surgeType, ok := surgeRuleTypes[ruleType]
+	if !ok {
+		return nil, false
+	}
+	return []string{surgeType + "," + payload + "," + policy + options}, true
+}
+
+// splitLogicalRule splits "AND,((DOMAIN,a),(DST-PORT,443)),Policy" into body and policy
+func splitLogicalRule(raw string) (body, policy string, ok bool) {
+	depth := 0
+	for i := len(raw) - 1; i >= 0; i-- {
+		switch raw[i] {
+		case ')':
+			depth++
+		case '(':
+			depth--
+		case ',':
+			if depth == 0 {
+				body, policy = strings.TrimSpace(raw[:i]), strings.TrimSpace(raw[i+1:])
+				// 末尾可能是 no-resolve 等选项
+				if !strings.HasSuffix(body, ")") {
+					return splitLogicalRule(body)
+				}
+				return body, policy, body != "" && policy != ""
+			}
+		}
+	}
+	return "", "", false
+}
+
+// providerURL returns a rule list Surge can load for a Clash rule-provider: classical text lists
+// (.list / .txt), and blackmatrix7 ios_rule_script, which publishes the same rules for Surge.
+func (b *surgeProfileBuilder) providerURL(name string) (string, bool) {
+	provider := GetMap(GetMap(b.clash, "rule-providers"), name)
+	if provider == nil {
+		return "", false
+	}
+	providerURL := GetString(provider, "url")
+	parsed, err := url.Parse(providerURL)
+	if providerURL == "" || err != nil {
+		return "", false
+	}
+	behavior := strings.ToLower(GetString(provider, "behavior"))
+	ext := strings.ToLower(path.Ext(parsed.Path))
+
+	if strings.Contains(parsed.Path, "/rule/Clash/") {
+		converted := strings.Replace(providerURL, "/rule/Clash/", "/rule/Surge/", 1)
+		if ext == ".yaml" || ext == ".yml" {
+			converted = strings.TrimSuffix(converted, path.Ext(parsed.Path)) + ".list"
+		}
+		return converted, true
+	}
+	if (ext == ".list" || ext == ".txt" || strings.EqualFold(GetString(provider, "format"), "text")) && (behavior == "" || behavior == "classical") {
+		return providerURL, true
+	}
+	return "", false
+}
+
+// policy resolves a Clash policy name to a Surge policy present in the profile
+func (b *surgeProfileBuilder) policy(name string) (string, bool) {
+	switch upper := strings.ToUpper(name); upper {
+	case "DIRECT", "REJECT", "REJECT-DROP", "REJECT-TINY":
+		return upper, true
+	case "PASS":
+		return "", false
+	}
+	if group, ok := b.groups[name]; ok {
+		return group, true
+	}
+	if node, ok := b.nodeNames[name]; ok {
+		return node, true
+	}
+	return "", false
+}
@@ -413,67 +413,3 @@ func contains(slice []string, val string) bool {
 }
 
 // Note: We could use slices.Contains in Go 1.21+, but keeping this for compatibility
-
-// BuildCompleteSurgeConfig builds a complete Surge configuration from Clash config
-// This is a high-level function that combines all parts
-func BuildCompleteSurgeConfig(
-	clashConfig *ClashConfig,
-	proxies []Proxy,
-	templateOpts *SurgeTemplateConfig,
-	includeUnsupported bool,
-) (string, error) {
-
-	var sections []string
-
-	// 1. Build General section
-	generalSection, err := ConvertClashToSurgeConfig(clashConfig, templateOpts)
-	if err != nil {
-		return "", fmt.Errorf("failed to convert general config: %w", err)
-	}
-	sections = append(sections, generalSection)
-
-	// 2. Build Proxy section
-	var proxyBuilder strings.Builder
-	proxyBuilder.WriteString("[Proxy]")
-	proxyBuilder.WriteString("\nDIRECT = direct")
-
-	// Convert proxies using surge.go
-	surgeProducer := NewSurgeProducer()
-	opts := &ProduceOptions{
-		IncludeUnsupportedProxy: includeUnsupported,
-	}
-
-	for _, proxy := range proxies {
-		line, err := surgeProducer.ProduceOne(proxy, "", opts)
-		if err != nil {
-			// Skip unsupported proxies
-			continue
-		}
-		if line != "" {
-			proxyBuilder.WriteString("\n")
-			proxyBuilder.WriteString(line)
-		}
-	}
-	sections = append(sections, proxyBuilder.String())
-
-	// 3. Build Proxy Group section
-	aclGroups := ConvertClashProxyGroupsToSurge(clashConfig.ProxyGroups)
-	proxyGroupSection := GenerateSurgeProxyGroups(aclGroups, false)
-	sections = append(sections, proxyGroupSection)
-
-	// 4. Build Rule section
-	surgeRules, err := ConvertClashRulesToSurgeFormat(clashConfig.Rules, clashConfig.RuleProviders)
-	if err != nil {
-		return "", fmt.Errorf("failed to convert rules: %w", err)
-	}
-
-	var ruleBuilder strings.Builder
-	ruleBuilder.WriteString("[Rule]")
-	for _, rule := range surgeRules {
-		ruleBuilder.WriteString("\n")
-		ruleBuilder.WriteString(rule)
-	}
-	sections = append(sections, ruleBuilder.String())
-
-	return strings.Join(sections, "\n\n"), nil
-}
@@ -241,81 +241,79 @@ func TestConvertClashProxyGroupsToSurge(t *testing.T) {
 	}
 }
 
-func TestBuildCompleteSurgeConfig(t *testing.T) {
-	clashConfig := &ClashConfig{
-		Port:      7890,
-		SocksPort: 7891,
-		LogLevel:  "info",
-		DNS: ClashDNS{
-			Enable: true,
-			Nameserver: []string{
-				"https://223.5.5.5/dns-query",
-			},
+func TestBuildSurgeProfile(t *testing.T) {
+	fullConfig := map[string]interface{}{
+		"log-level": "info",
+		"dns": map[string]interface{}{
+			"enable":     true,
+			"nameserver": []interface{}{"https://223.5.5.5/dns-query"},
 		},
-		ProxyGroups: []ClashProxyGroup{
-			{
-				Name:    "Proxy",
-				Type:    "select",
-				Proxies: []string{"DIRECT"},
+		"proxy-groups": []interface{}{
+			map[string]interface{}{
+				"name":    "Proxy",
+				"type":    "select",
+				"proxies": []interface{}{"TestProxy", "DIRECT"},
 			},
 		},
-		Rules: []string{
+		"rules": []interface{}{
 			"DOMAIN-SUFFIX,google.com,Proxy",
 			"GEOIP,CN,DIRECT",
 			"MATCH,Proxy",
 		},
-		RuleProviders: map[string]ClashRuleProvider{},
 	}
 
 	proxies := []Proxy{
 		{
-			"name":   "TestProxy",
-			"type":   "ss",
-			"server": "1.2.3.4",
-			"port":   8388,
-			"cipher": "aes-256-gcm",
+			"name":     "TestProxy",
+			"type":     "ss",
+			"server":   "1.2.3.4",
+			"port":     8388,
+			"cipher":   "aes-256-gcm",
 			"password": "password",
 		},
 	}
 
-	templateOpts := &SurgeTemplateConfig{}
-	applyDefaultSurgeConfig(templateOpts)
-
-	result, err := BuildCompleteSurgeConfig(clashConfig, proxies, templateOpts, false)
-	if err != nil {
-		t.Fatalf("BuildCompleteSurgeConfig failed: %v", err)
-	}
-
-	// Check for all sections
-	requiredSections := []string{
-		"[General]",
-		"[Proxy]",
-		"[Proxy Group]",
-		"[Rule]",
-	}
+	result := BuildSurgeProfile(proxies, fullConfig, &ProduceOptions{})
 
-	for _, section := range requiredSections {
+	for _, section := range []string{"[General]", "[Proxy]", "[Proxy Group]", "[Rule]"} {
 		if !strings.Contains(result, section) {
 			t.Errorf("Expected result to contain section %q", section)
 		}
 	}
-
-	// Check for DIRECT proxy
-	if !strings.Contains(result, "DIRECT = direct") {
-		t.Error("Expected DIRECT proxy in result")
-	}
-
-	// Check for TestProxy
 	if !strings.Contains(result, "TestProxy=ss") {
 		t.Error("Expected TestProxy in result")
 	}
-
-	// Check for FINAL rule (converted from MATCH)
 	if !strings.Contains(result, "FINAL,Proxy") {
 		t.Error("Expected FINAL rule in result")
 	}
 }
 
+func TestSurgeProducerKeepsNodeList(t *testing.T) {
+	// t=surge must stay a bare node list even when the full Clash config is available,
+	// clients load it as a policy-path / external node list
+	fullConfig := map[string]interface{}{
+		"proxy-groups": []interface{}{
+			map[string]interface{}{"name": "Proxy", "type": "select", "proxies": []interface{}{"TestProxy"}},
+		},
+		"rules": []interface{}{"MATCH,Proxy"},
+	}
+	proxies := []Proxy{
+		{"name": "TestProxy", "type": "ss", "server": "1.2.3.4", "port": 8388, "cipher": "aes-256-gcm", "password": "password"},
+	}
+
+	result, err := NewSurgeProducer().Produce(proxies, "", &ProduceOptions{FullConfig: fullConfig})
+	if err != nil {
+		t.Fatalf("Produce failed: %v", err)
+	}
+	output, _ := result.(string)
+	if strings.Contains(output, "[General]") || strings.Contains(output, "[Rule]") {
+		t.Errorf("Expected a bare node list, got a full profile:\n%s", output)
+	}
+	if !strings.Contains(output, "TestProxy") {
+		t.Errorf("Expected TestProxy in node list, got:\n%s", output)
+	}
+}
+
 func TestApplyDefaultSurgeConfig(t *testing.T) {
 	opts := &SurgeTemplateConfig{}
 	applyDefaultSurgeConfig(opts)
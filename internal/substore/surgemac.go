@@ -27,6 +27,11 @@ func (p *SurgeMacProducer) GetType() string {
 	return p.producerType
 }
 
+// OutputFormat returns the format used to serve the output
+func (p *SurgeMacProducer) OutputFormat() OutputFormat {
+	return OutputFormatText
+}
+
 // Produce converts proxies to Surge for macOS format
 func (p *SurgeMacProducer) Produce(proxies []Proxy, outputType string, opts *ProduceOptions) (interface{}, error) {
 	if opts == nil {
@@ -42,12 +47,15 @@ func (p *SurgeMacProducer) Produce(proxies []Proxy, outputType string, opts *Pro
 				if opts.UseMihomoExternal {
 					line, err = p.produceMihomo(proxy, outputType, opts)
 					if err != nil {
+						opts.skip(proxy, err.Error())
 						continue
 					}
 				} else {
+					opts.skip(proxy, err.Error())
 					continue
 				}
 			} else {
+				opts.skip(proxy, err.Error())
 				continue
 			}
 		}
@@ -14,6 +14,24 @@ type ProduceOptions struct {
 	Nameserver              []string
 	// FullConfig contains the complete original config for producers that need to output full config (e.g., Stash)
 	FullConfig map[string]interface{}
+	// ProviderURL is the subscription URL that producers referencing the panel as a proxy-provider point to
+	ProviderURL string
+	// Warnings collects proxies that were left out because the target can't express them
+	Warnings []ConversionWarning
+}
+
+// ConversionWarning describes a proxy dropped during conversion
+type ConversionWarning struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// skip records that proxy was left out of the output
+func (o *ProduceOptions) skip(proxy Proxy, reason string) {
+	if o == nil {
+		return
+	}
+	o.Warnings = append(o.Warnings, ConversionWarning{Name: GetString(proxy, "name"), Reason: reason})
 }
 
 // Producer is the interface for all proxy format producers
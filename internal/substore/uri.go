@@ -26,6 +26,11 @@ func (p *URIProducer) GetType() string {
 	return p.producerType
 }
 
+// OutputFormat returns the format used to serve the output
+func (p *URIProducer) OutputFormat() OutputFormat {
+	return OutputFormatText
+}
+
 // isIPv6 checks if a string is an IPv6 address
 func isIPv6(addr string) bool {
 	ip := net.ParseIP(addr)
@@ -121,11 +126,13 @@ func (p *URIProducer) Produce(proxies []Proxy, outputType string, opts *ProduceO
 			uri, err = p.encodeAnyTLS(proxy)
 		default:
 			// Skip unsupported proxy types instead of returning error
+			opts.skip(proxy, "unsupported proxy type "+proxyType)
 			continue
 		}
 
 		if err != nil {
 			// Skip proxies that fail to encode
+			opts.skip(proxy, err.Error())
 			continue
 		}
 
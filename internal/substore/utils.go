@@ -367,3 +367,41 @@ func GetSNI(proxy Proxy) string {
 	}
 	return ""
 }
+
+// GetPortHopping returns the port hopping ranges of a hysteria2 / tuic proxy ("443", "1000-2000").
+// The Clash "ports" field may be a number or a string separated by ",", ";" or "/".
+func GetPortHopping(proxy Proxy) []string {
+	raw := GetAnyString(proxy, "ports")
+	if raw == "" {
+		return nil
+	}
+	var ranges []string
+	for _, part := range regexp.MustCompile(`[,;/]`).Split(raw, -1) {
+		part = regexp.MustCompile(`\s*-\s*`).ReplaceAllString(strings.TrimSpace(part), "-")
+		if part != "" {
+			ranges = append(ranges, part)
+		}
+	}
+	return ranges
+}
+
+// GetBandwidthMbps extracts the Mbps value of a bandwidth field such as up / down, which may be a
+// number or a string like "100 Mbps". Returns 0 when no number is present.
+func GetBandwidthMbps(proxy Proxy, key string) int {
+	match := regexp.MustCompile(`\d+`).FindString(GetAnyString(proxy, key))
+	if match == "" {
+		return 0
+	}
+	value, _ := strconv.Atoi(match)
+	return value
+}
+
+// GetDurationSeconds returns a duration option given in seconds as a plain number ("30", 30 or
+// "30s"), or "" when the value is missing or not in seconds.
+func GetDurationSeconds(proxy Proxy, key string) string {
+	value := strings.TrimSuffix(strings.TrimSpace(GetAnyString(proxy, key)), "s")
+	if matched, _ := regexp.MatchString(`^\d+$`, value); matched {
+		return value
+	}
+	return ""
+}
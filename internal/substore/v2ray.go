@@ -24,6 +24,11 @@ func (p *V2RayProducer) GetType() string {
 	return p.producerType
 }
 
+// OutputFormat returns the format used to serve the output
+func (p *V2RayProducer) OutputFormat() OutputFormat {
+	return OutputFormatText
+}
+
 // Produce converts proxies to V2Ray subscription format (base64 encoded URIs)
 func (p *V2RayProducer) Produce(proxies []Proxy, outputType string, opts *ProduceOptions) (interface{}, error) {
 	var uris []string
@@ -33,7 +38,7 @@ func (p *V2RayProducer) Produce(proxies []Proxy, outputType string, opts *Produc
 		uri, err := p.uriProducer.ProduceOne(proxy)
 		if err != nil {
 			// Skip proxies that cannot be encoded
-			// In production, you might want to log this
+			opts.skip(proxy, err.Error())
 			continue
 		}
 		uris = append(uris, uri)
@@ -0,0 +1,79 @@
+package substore
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// wireGuardReserved normalizes the reserved bytes of a WireGuard proxy. Clash configs carry them as
+// a list ([1, 2, 3]), URIs and Surge as "1,2,3" / "1/2/3", and WARP clients as a base64 client id.
+func wireGuardReserved(value interface{}) []int {
+	var parts []string
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []int:
+		parts = make([]string, 0, len(v))
+		for _, n := range v {
+			parts = append(parts, strconv.Itoa(n))
+		}
+	case []interface{}:
+		parts = make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, fmt.Sprintf("%v", item))
+		}
+	case string:
+		trimmed := strings.Trim(strings.TrimSpace(v), "[]")
+		if trimmed == "" {
+			return nil
+		}
+		parts = strings.FieldsFunc(trimmed, func(r rune) bool { return r == ',' || r == '/' })
+		if len(parts) != 3 {
+			if decoded, err := base64.StdEncoding.DecodeString(trimmed); err == nil && len(decoded) == 3 {
+				return []int{int(decoded[0]), int(decoded[1]), int(decoded[2])}
+			}
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	if len(parts) != 3 {
+		return nil
+	}
+	reserved := make([]int, 0, 3)
+	for _, part := range parts {
+		n, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || n < 0 || n > 255 || n != float64(int(n)) {
+			return nil
+		}
+		reserved = append(reserved, int(n))
+	}
+	return reserved
+}
+
+// wireGuardStrings normalizes list fields such as allowed-ips and dns, which may be a list or a
+// comma separated string.
+func wireGuardStrings(value interface{}) []string {
+	var items []string
+	switch v := value.(type) {
+	case []string:
+		items = v
+	case []interface{}:
+		for _, item := range v {
+			items = append(items, fmt.Sprintf("%v", item))
+		}
+	case string:
+		items = strings.Split(strings.Trim(strings.TrimSpace(v), "[]"), ",")
+	}
+
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if item = strings.Trim(strings.TrimSpace(item), `"`); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
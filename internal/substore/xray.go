@@ -0,0 +1,410 @@
+package substore
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// XrayProducer implements the Producer interface for Xray-core outbounds
+type XrayProducer struct {
+	producerType string
+	helper       *ProxyHelper
+}
+
+// NewXrayProducer creates a new Xray producer
+func NewXrayProducer() *XrayProducer {
+	return &XrayProducer{
+		producerType: "xray",
+		helper:       NewProxyHelper(),
+	}
+}
+
+// GetType returns the producer type
+func (p *XrayProducer) GetType() string {
+	return p.producerType
+}
+
+// OutputFormat returns the format used to serve the output
+func (p *XrayProducer) OutputFormat() OutputFormat {
+	return OutputFormatJSON
+}
+
+// Produce converts proxies to Xray outbounds. The JSON output is an object with a single
+// "outbounds" array so it can be dropped into an Xray confdir and merged as is.
+func (p *XrayProducer) Produce(proxies []Proxy, outputType string, opts *ProduceOptions) (interface{}, error) {
+	if opts == nil {
+		opts = &ProduceOptions{}
+	}
+
+	// 先统一转换为 ClashMeta 内部格式，复用其字段归一化
+	clashProxies, err := NewClashMetaProducer().Produce(proxies, "internal", &ProduceOptions{
+		IncludeUnsupportedProxy: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	proxiesSlice, ok := clashProxies.([]Proxy)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type from ClashMeta producer")
+	}
+
+	list := make([]map[string]interface{}, 0)
+
+	for _, proxy := range proxiesSlice {
+		proxyType := p.helper.GetProxyType(proxy)
+		var parsed map[string]interface{}
+		var err error
+
+		switch proxyType {
+		case "vmess":
+			parsed, err = p.vmessParser(proxy)
+		case "vless":
+			parsed, err = p.vlessParser(proxy)
+		case "trojan":
+			parsed, err = p.trojanParser(proxy)
+		case "ss":
+			parsed, err = p.ssParser(proxy)
+		case "socks5":
+			parsed, err = p.socksParser(proxy)
+		case "http":
+			parsed, err = p.httpParser(proxy)
+		default:
+			err = fmt.Errorf("platform xray does not support proxy type: %s", proxyType)
+		}
+
+		if err != nil {
+			opts.skip(proxy, err.Error())
+			continue
+		}
+
+		// 节点自定义字段中的 _xray 对象直接并入出站，用于解析器尚不支持的选项
+		if extra, ok := proxy["_xray"].(map[string]interface{}); ok {
+			for key, value := range extra {
+				if key != "protocol" && key != "tag" {
+					parsed[key] = value
+				}
+			}
+		}
+		list = append(list, parsed)
+	}
+
+	if outputType == "internal" {
+		return list, nil
+	}
+
+	result := map[string]interface{}{
+		"outbounds": list,
+	}
+
+	jsonBytes, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return string(jsonBytes), nil
+}
+
+// Parser implementations
+
+func (p *XrayProducer) vmessParser(proxy Proxy) (map[string]interface{}, error) {
+	cipher := GetString(proxy, "cipher")
+	if cipher == "" {
+		cipher = "auto"
+	}
+
+	user := map[string]interface{}{
+		"id":       GetString(proxy, "uuid"),
+		"alterId":  GetInt(proxy, "alterId"),
+		"security": cipher,
+	}
+
+	return p.outbound(proxy, "vmess", map[string]interface{}{
+		"vnext": []map[string]interface{}{p.serverEntry(proxy, "users", user)},
+	})
+}
+
+func (p *XrayProducer) vlessParser(proxy Proxy) (map[string]interface{}, error) {
+	user := map[string]interface{}{
+		"id":         GetString(proxy, "uuid"),
+		"encryption": "none",
+	}
+	if flow := GetString(proxy, "flow"); flow != "" {
+		if !strings.HasPrefix(flow, "xtls-rprx-vision") {
+			return nil, fmt.Errorf("platform xray does not support proxy type: vless with flow %s", flow)
+		}
+		user["flow"] = flow
+	}
+
+	return p.outbound(proxy, "vless", map[string]interface{}{
+		"vnext": []map[string]interface{}{p.serverEntry(proxy, "users", user)},
+	})
+}
+
+func (p *XrayProducer) trojanParser(proxy Proxy) (map[string]interface{}, error) {
+	if flow := GetString(proxy, "flow"); flow != "" {
+		return nil, fmt.Errorf("platform xray does not support proxy type: trojan with flow %s", flow)
+	}
+
+	server := p.serverEntry(proxy, "", nil)
+	server["password"] = GetString(proxy, "password")
+
+	return p.outbound(proxy, "trojan", map[string]interface{}{
+		"servers": []map[string]interface{}{server},
+	})
+}
+
+func (p *XrayProducer) ssParser(proxy Proxy) (map[string]interface{}, error) {
+	if plugin := GetString(proxy, "plugin"); plugin != "" {
+		return nil, fmt.Errorf("platform xray does not support proxy type: ss with plugin %s", plugin)
+	}
+
+	server := p.serverEntry(proxy, "", nil)
+	server["method"] = GetString(proxy, "cipher")
+	server["password"] = GetString(proxy, "password")
+	if GetBool(proxy, "udp-over-tcp") {
+		server["uot"] = true
+		if version := GetInt(proxy, "udp-over-tcp-version"); version > 0 {
+			server["UoTVersion"] = version
+		}
+	}
+
+	return p.outbound(proxy, "shadowsocks", map[string]interface{}{
+		"servers": []map[string]interface{}{server},
+	})
+}
+
+func (p *XrayProducer) socksParser(proxy Proxy) (map[string]interface{}, error) {
+	return p.outbound(proxy, "socks", map[string]interface{}{
+		"servers": []map[string]interface{}{p.serverEntry(proxy, "users", p.authUser(proxy))},
+	})
+}
+
+func (p *XrayProducer) httpParser(proxy Proxy) (map[string]interface{}, error) {
+	return p.outbound(proxy, "http", map[string]interface{}{
+		"servers": []map[string]interface{}{p.serverEntry(proxy, "users", p.authUser(proxy))},
+	})
+}
+
+// Helper parsers
+
+// outbound assembles the outbound object and attaches stream settings
+func (p *XrayProducer) outbound(proxy Proxy, protocol string, settings map[string]interface{}) (map[string]interface{}, error) {
+	stream, err := p.streamSettings(proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := map[string]interface{}{
+		"tag":      p.helper.GetProxyName(proxy),
+		"protocol": protocol,
+		"settings": settings,
+	}
+	if len(stream) > 0 {
+		parsed["streamSettings"] = stream
+	}
+	return parsed, nil
+}
+
+// serverEntry returns {address, port} with an optional single-user list under usersKey
+func (p *XrayProducer) serverEntry(proxy Proxy, usersKey string, user map[string]interface{}) map[string]interface{} {
+	entry := map[string]interface{}{
+		"address": GetString(proxy, "server"),
+		"port":    GetInt(proxy, "port"),
+	}
+	if usersKey != "" && user != nil {
+		entry[usersKey] = []map[string]interface{}{user}
+	}
+	return entry
+}
+
+func (p *XrayProducer) authUser(proxy Proxy) map[string]interface{} {
+	username := GetString(proxy, "username")
+	if username == "" {
+		return nil
+	}
+	return map[string]interface{}{
+		"user": username,
+		"pass": GetString(proxy, "password"),
+	}
+}
+
+func (p *XrayProducer) streamSettings(proxy Proxy) (map[string]interface{}, error) {
+	stream := make(map[string]interface{})
+
+	network := GetString(proxy, "network")
+	switch network {
+	case "", "tcp":
+		if network != "" {
+			stream["network"] = "tcp"
+		}
+	case "ws":
+		wsOpts := GetMap(proxy, "ws-opts")
+		path := GetString(wsOpts, "path")
+		if path == "" {
+			path = "/"
+		}
+		host := p.headerValue(GetMap(wsOpts, "headers"), "Host")
+
+		if GetBool(wsOpts, "v2ray-http-upgrade") {
+			stream["network"] = "httpupgrade"
+			stream["httpupgradeSettings"] = map[string]interface{}{
+				"path": path,
+				"host": host,
+			}
+			break
+		}
+
+		// Xray 只支持通过 path 上的 ed 参数开启 0-RTT
+		if maxEarlyData := GetInt(wsOpts, "max-early-data"); maxEarlyData > 0 && !strings.Contains(path, "ed=") {
+			sep := "?"
+			if strings.Contains(path, "?") {
+				sep = "&"
+			}
+			path = fmt.Sprintf("%s%sed=%d", path, sep, maxEarlyData)
+		}
+		ws := map[string]interface{}{"path": path}
+		if host != "" {
+			ws["host"] = host
+		}
+		stream["network"] = "ws"
+		stream["wsSettings"] = ws
+	case "grpc":
+		stream["network"] = "grpc"
+		stream["grpcSettings"] = map[string]interface{}{
+			"serviceName": GetString(GetMap(proxy, "grpc-opts"), "grpc-service-name"),
+		}
+	case "h2":
+		h2Opts := GetMap(proxy, "h2-opts")
+		h2 := map[string]interface{}{}
+		if path := GetString(h2Opts, "path"); path != "" {
+			h2["path"] = path
+		}
+		if hosts := p.stringList(h2Opts["host"]); len(hosts) > 0 {
+			h2["host"] = hosts
+		}
+		stream["network"] = "http"
+		stream["httpSettings"] = h2
+	case "http":
+		// Clash 的 http 网络是 TCP 上的 HTTP 伪装头
+		httpOpts := GetMap(proxy, "http-opts")
+		request := map[string]interface{}{}
+		if paths := p.stringList(httpOpts["path"]); len(paths) > 0 {
+			request["path"] = paths
+		}
+		if headers := GetMap(httpOpts, "headers"); headers != nil {
+			processed := make(map[string]interface{})
+			for key, value := range headers {
+				if values := p.stringList(value); len(values) > 0 {
+					processed[key] = values
+				}
+			}
+			if len(processed) > 0 {
+				request["headers"] = processed
+			}
+		}
+		stream["network"] = "tcp"
+		stream["tcpSettings"] = map[string]interface{}{
+			"header": map[string]interface{}{
+				"type":    "http",
+				"request": request,
+			},
+		}
+	default:
+		return nil, fmt.Errorf("platform xray does not support proxy type: %s with network %s", p.helper.GetProxyType(proxy), network)
+	}
+
+	p.securityParser(proxy, stream)
+
+	sockopt := make(map[string]interface{})
+	if dialerProxy := GetString(proxy, "dialer-proxy"); dialerProxy != "" {
+		sockopt["dialerProxy"] = dialerProxy
+	}
+	if GetBool(proxy, "tfo") || GetBool(proxy, "fast-open") {
+		sockopt["tcpFastOpen"] = true
+	}
+	if len(sockopt) > 0 {
+		stream["sockopt"] = sockopt
+	}
+
+	return stream, nil
+}
+
+func (p *XrayProducer) securityParser(proxy Proxy, stream map[string]interface{}) {
+	fingerprint := GetString(proxy, "client-fingerprint")
+
+	if realityOpts := GetMap(proxy, "reality-opts"); realityOpts != nil {
+		if fingerprint == "" {
+			fingerprint = "chrome"
+		}
+		reality := map[string]interface{}{
+			"serverName":  GetSNI(proxy),
+			"fingerprint": fingerprint,
+			"publicKey":   GetString(realityOpts, "public-key"),
+		}
+		if shortID := GetString(realityOpts, "short-id"); shortID != "" {
+			reality["shortId"] = shortID
+		}
+		stream["security"] = "reality"
+		stream["realitySettings"] = reality
+		return
+	}
+
+	// trojan 总是走 TLS
+	if !GetBool(proxy, "tls") && p.helper.GetProxyType(proxy) != "trojan" {
+		return
+	}
+
+	tls := make(map[string]interface{})
+	if sni := GetSNI(proxy); sni != "" {
+		tls["serverName"] = sni
+	}
+	if GetBool(proxy, "skip-cert-verify") {
+		tls["allowInsecure"] = true
+	}
+	if alpn := p.stringList(proxy["alpn"]); len(alpn) > 0 {
+		tls["alpn"] = alpn
+	}
+	if fingerprint != "" {
+		tls["fingerprint"] = fingerprint
+	}
+	stream["security"] = "tls"
+	stream["tlsSettings"] = tls
+}
+
+// headerValue looks up a header case-insensitively, taking the first value of a list
+func (p *XrayProducer) headerValue(headers map[string]interface{}, name string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			if values := p.stringList(value); len(values) > 0 {
+				return values[0]
+			}
+		}
+	}
+	return ""
+}
+
+// stringList accepts a string or a list and returns the non-empty values
+func (p *XrayProducer) stringList(value interface{}) []string {
+	var result []string
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			result = append(result, v)
+		}
+	case []string:
+		for _, item := range v {
+			if item != "" {
+				result = append(result, item)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if s := fmt.Sprintf("%v", item); s != "" && item != nil {
+				result = append(result, s)
+			}
+		}
+	}
+	return result
+}
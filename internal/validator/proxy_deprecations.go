@@ -0,0 +1,166 @@
+package validator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProxyDeprecation 节点配置中已过时、新版内核不再推荐或不再支持的设置
+type ProxyDeprecation struct {
+	Code     string          `json:"code"`
+	Level    ValidationLevel `json:"level"`
+	Field    string          `json:"field"`
+	Message  string          `json:"message"`
+	Fixable  bool            `json:"fixable"`
+	Solution string          `json:"solution,omitempty"`
+}
+
+// deprecatedSSCiphers 无认证的流加密，现代内核已弃用或默认禁用
+var deprecatedSSCiphers = []string{
+	"rc4", "rc4-md5", "bf-cfb", "cast5-cfb", "des-cfb", "idea-cfb", "rc2-cfb", "seed-cfb", "salsa20",
+	"chacha20", "chacha20-ietf", "xchacha20",
+	"aes-128-cfb", "aes-192-cfb", "aes-256-cfb",
+	"aes-128-ctr", "aes-192-ctr", "aes-256-ctr",
+	"camellia-128-cfb", "camellia-192-cfb", "camellia-256-cfb",
+}
+
+// deprecatedXTLSFlows XTLS 旧版流控，Xray 已移除，仅剩 xtls-rprx-vision
+var deprecatedXTLSFlows = []string{
+	"xtls-rprx-origin", "xtls-rprx-origin-udp443",
+	"xtls-rprx-direct", "xtls-rprx-direct-udp443",
+	"xtls-rprx-splice", "xtls-rprx-splice-udp443",
+}
+
+// CheckProxyDeprecations 扫描单个 Clash 代理节点中的过时设置
+func CheckProxyDeprecations(proxy map[string]interface{}) []ProxyDeprecation {
+	var found []ProxyDeprecation
+	proxyType := strings.ToLower(stringField(proxy, "type"))
+
+	switch proxyType {
+	case "ss":
+		if cipher := strings.ToLower(stringField(proxy, "cipher")); contains(deprecatedSSCiphers, cipher) {
+			found = append(found, ProxyDeprecation{
+				Code:     "ss_stream_cipher",
+				Level:    WarningLevel,
+				Field:    "cipher",
+				Message:  fmt.Sprintf("加密方式 %s 为无认证的流加密，已被弃用且容易被识别", cipher),
+				Solution: "服务端改用 AEAD（如 aes-128-gcm、chacha20-ietf-poly1305）或 2022-blake3 系列加密",
+			})
+		}
+		if plugin := strings.ToLower(stringField(proxy, "plugin")); plugin == "obfs" {
+			found = append(found, ProxyDeprecation{
+				Code:     "ss_simple_obfs",
+				Level:    WarningLevel,
+				Field:    "plugin",
+				Message:  "simple-obfs 插件已停止维护，混淆特征明显",
+				Solution: "服务端改用 shadow-tls 或 v2ray-plugin",
+			})
+		}
+	case "ssr":
+		found = append(found, ProxyDeprecation{
+			Code:     "ssr_protocol",
+			Level:    InfoLevel,
+			Field:    "type",
+			Message:  "ShadowsocksR 已停止维护，部分新版客户端（如 sing-box）不再支持",
+			Solution: "迁移到 Shadowsocks AEAD / 2022 或其他现代协议",
+		})
+	case "vmess":
+		if alterID, ok := intValue(proxy["alterId"]); ok && alterID > 0 {
+			found = append(found, ProxyDeprecation{
+				Code:     "vmess_alter_id",
+				Level:    WarningLevel,
+				Field:    "alterId",
+				Message:  fmt.Sprintf("alterId=%d 使用旧版 MD5 认证，新版 Xray/sing-box 默认拒绝", alterID),
+				Fixable:  true,
+				Solution: "将 alterId 设为 0 以启用 VMess AEAD",
+			})
+		}
+	}
+
+	if proxyType == "vless" || proxyType == "trojan" {
+		if flow := strings.ToLower(stringField(proxy, "flow")); contains(deprecatedXTLSFlows, flow) {
+			found = append(found, ProxyDeprecation{
+				Code:     "xtls_legacy_flow",
+				Level:    ErrorLevel,
+				Field:    "flow",
+				Message:  fmt.Sprintf("流控 %s 已从 Xray 移除，新版内核无法连接", flow),
+				Solution: "服务端改用 xtls-rprx-vision",
+			})
+		}
+	}
+
+	// 旧版 Clash 的 ws-path / ws-headers 平铺写法，mihomo 只识别 ws-opts
+	if _, hasPath := proxy["ws-path"]; hasPath || proxy["ws-headers"] != nil {
+		found = append(found, ProxyDeprecation{
+			Code:     "ws_flat_options",
+			Level:    WarningLevel,
+			Field:    "ws-path",
+			Message:  "ws-path / ws-headers 为旧版写法，mihomo 已不再识别",
+			Fixable:  true,
+			Solution: "迁移到 ws-opts.path / ws-opts.headers",
+		})
+	}
+
+	if proxyType == "trojan" && proxy["servername"] != nil && proxy["sni"] == nil {
+		found = append(found, ProxyDeprecation{
+			Code:     "trojan_servername",
+			Level:    WarningLevel,
+			Field:    "servername",
+			Message:  "trojan 节点应使用 sni 字段，servername 会被忽略",
+			Fixable:  true,
+			Solution: "将 servername 重命名为 sni",
+		})
+	}
+
+	return found
+}
+
+// FixProxyDeprecations 自动修复可安全修复的过时设置，返回修复后的副本与已应用的修复代码
+func FixProxyDeprecations(proxy map[string]interface{}) (map[string]interface{}, []string) {
+	fixed := deepCopyMap(proxy)
+	var applied []string
+
+	for _, deprecation := range CheckProxyDeprecations(proxy) {
+		if !deprecation.Fixable {
+			continue
+		}
+		switch deprecation.Code {
+		case "vmess_alter_id":
+			fixed["alterId"] = 0
+		case "ws_flat_options":
+			opts, _ := fixed["ws-opts"].(map[string]interface{})
+			if opts == nil {
+				opts = map[string]interface{}{}
+			}
+			if path, ok := fixed["ws-path"]; ok {
+				if _, exists := opts["path"]; !exists {
+					opts["path"] = path
+				}
+			}
+			if headers, ok := fixed["ws-headers"]; ok && headers != nil {
+				if _, exists := opts["headers"]; !exists {
+					opts["headers"] = headers
+				}
+			}
+			fixed["ws-opts"] = opts
+			delete(fixed, "ws-path")
+			delete(fixed, "ws-headers")
+			if stringField(fixed, "network") == "" {
+				fixed["network"] = "ws"
+			}
+		case "trojan_servername":
+			fixed["sni"] = fixed["servername"]
+			delete(fixed, "servername")
+		default:
+			continue
+		}
+		applied = append(applied, deprecation.Code)
+	}
+
+	return fixed, applied
+}
+
+func stringField(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return strings.TrimSpace(s)
+}
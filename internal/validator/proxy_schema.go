@@ -0,0 +1,180 @@
+package validator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// proxySchema 单个协议的字段约束
+type proxySchema struct {
+	// required 必填字段；用 "a|b" 表示至少提供其中之一
+	required []string
+	// enums 取值受限的字段，空字符串表示允许不填
+	enums map[string][]string
+}
+
+var (
+	ssCiphers = []string{
+		"none", "dummy", "rc4-md5", "rc4",
+		"aes-128-gcm", "aes-192-gcm", "aes-256-gcm",
+		"aes-128-cfb", "aes-192-cfb", "aes-256-cfb",
+		"aes-128-ctr", "aes-192-ctr", "aes-256-ctr",
+		"aes-128-ccm", "aes-192-ccm", "aes-256-ccm",
+		"aes-128-gcm-siv", "aes-256-gcm-siv",
+		"chacha20", "chacha20-ietf", "xchacha20",
+		"chacha20-poly1305", "chacha20-ietf-poly1305", "xchacha20-ietf-poly1305",
+		"chacha8-ietf-poly1305", "xchacha8-ietf-poly1305",
+		"rabbit128-poly1305", "aegis-128l", "aegis-256",
+		"2022-blake3-aes-128-gcm", "2022-blake3-aes-256-gcm", "2022-blake3-chacha20-poly1305",
+	}
+	ssrCiphers = append([]string{
+		"bf-cfb", "cast5-cfb", "des-cfb", "idea-cfb", "rc2-cfb", "seed-cfb", "salsa20",
+		"camellia-128-cfb", "camellia-192-cfb", "camellia-256-cfb",
+	}, ssCiphers...)
+	vmessCiphers = []string{"auto", "none", "zero", "aes-128-gcm", "chacha20-poly1305"}
+	networks     = []string{"", "tcp", "ws", "http", "h2", "grpc", "httpupgrade", "xhttp", "kcp", "quic"}
+)
+
+// proxySchemas 各协议的 Clash (mihomo) 字段约束，未列出的协议只校验 server/port
+var proxySchemas = map[string]proxySchema{
+	"ss": {
+		required: []string{"cipher", "password"},
+		enums:    map[string][]string{"cipher": ssCiphers},
+	},
+	"ssr": {
+		required: []string{"cipher", "password", "obfs", "protocol"},
+		enums: map[string][]string{
+			"cipher":   ssrCiphers,
+			"obfs":     {"plain", "http_simple", "http_post", "random_head", "tls1.2_ticket_auth", "tls1.2_ticket_fastauth"},
+			"protocol": {"origin", "auth_sha1_v4", "auth_aes128_md5", "auth_aes128_sha1", "auth_chain_a", "auth_chain_b"},
+		},
+	},
+	"vmess": {
+		required: []string{"uuid"},
+		enums:    map[string][]string{"cipher": append([]string{""}, vmessCiphers...), "network": networks},
+	},
+	"vless": {
+		required: []string{"uuid"},
+		enums: map[string][]string{
+			"flow":    {"", "xtls-rprx-vision", "xtls-rprx-vision-udp443"},
+			"network": networks,
+		},
+	},
+	"trojan": {
+		required: []string{"password"},
+		enums:    map[string][]string{"network": networks},
+	},
+	"hysteria": {
+		required: []string{"auth-str|auth|obfs"},
+		enums:    map[string][]string{"protocol": {"", "udp", "wechat-video", "faketcp"}},
+	},
+	"hysteria2": {
+		required: []string{"password"},
+		enums:    map[string][]string{"obfs": {"", "salamander"}},
+	},
+	"tuic": {
+		required: []string{"uuid|token"},
+		enums:    map[string][]string{"congestion-controller": {"", "cubic", "new_reno", "bbr"}, "udp-relay-mode": {"", "native", "quic"}},
+	},
+	"wireguard": {
+		required: []string{"private-key", "public-key|peers", "ip|ipv6"},
+	},
+	"anytls": {required: []string{"password"}},
+	"snell":  {required: []string{"psk"}},
+	"ssh":    {required: []string{"username"}},
+	"mieru":  {required: []string{"username", "password"}},
+	"http":   {},
+	"socks5": {},
+}
+
+// ValidateProxy 按协议校验单个 Clash 代理节点：必填字段、端口范围、加密方式白名单等。
+// 未知协议只给出警告，避免阻止解析器尚未收录的新协议
+func ValidateProxy(proxy map[string]interface{}) []ValidationIssue {
+	var issues []ValidationIssue
+	addError := func(field, message string) {
+		issues = append(issues, ValidationIssue{Level: ErrorLevel, Message: message, Field: field})
+	}
+
+	name, _ := proxy["name"].(string)
+	if strings.TrimSpace(name) == "" {
+		addError("name", "缺少name字段或name为空")
+	}
+
+	proxyType, _ := proxy["type"].(string)
+	proxyType = strings.ToLower(strings.TrimSpace(proxyType))
+	if proxyType == "" {
+		addError("type", "缺少type字段")
+		return issues
+	}
+
+	if server, _ := proxy["server"].(string); strings.TrimSpace(server) == "" {
+		addError("server", "缺少server字段")
+	}
+	if port, ok := intValue(proxy["port"]); !ok {
+		addError("port", "缺少port字段或port不是数字")
+	} else if port < 1 || port > 65535 {
+		addError("port", fmt.Sprintf("端口 %d 超出范围 (1-65535)", port))
+	}
+
+	schema, known := proxySchemas[proxyType]
+	if !known {
+		issues = append(issues, ValidationIssue{
+			Level:   WarningLevel,
+			Message: fmt.Sprintf("未知的协议类型 %q，仅校验了 server/port", proxyType),
+			Field:   "type",
+		})
+		return issues
+	}
+
+	for _, required := range schema.required {
+		candidates := strings.Split(required, "|")
+		found := false
+		for _, field := range candidates {
+			if value, ok := proxy[field]; ok && value != nil && fmt.Sprint(value) != "" {
+				found = true
+				break
+			}
+		}
+		if !found {
+			addError(candidates[0], fmt.Sprintf("%s 节点缺少必需字段: %s", proxyType, strings.Join(candidates, " 或 ")))
+		}
+	}
+
+	for field, allowed := range schema.enums {
+		value, ok := proxy[field]
+		if !ok || value == nil {
+			continue
+		}
+		text, isString := value.(string)
+		if !isString {
+			addError(field, fmt.Sprintf("%s 字段必须是字符串", field))
+			continue
+		}
+		if !contains(allowed, strings.ToLower(strings.TrimSpace(text))) {
+			addError(field, fmt.Sprintf("%s 节点不支持的 %s: %q", proxyType, field, text))
+		}
+	}
+
+	return issues
+}
+
+// intValue 解析整数字段（端口、alterId 等），兼容 JSON 数字与数字字符串
+func intValue(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		if v != float64(int(v)) {
+			return 0, false
+		}
+		return int(v), true
+	case string:
+		port, err := strconv.Atoi(strings.TrimSpace(v))
+		return port, err == nil
+	default:
+		return 0, false
+	}
+}
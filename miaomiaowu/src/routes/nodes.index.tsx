@@ -78,6 +78,8 @@ type ParsedNode = {
   tag: string
   original_server: string
   probe_server: string
+  source_url: string
+  import_batch: string
   created_at: string
   updated_at: string
 }
@@ -91,6 +93,7 @@ type TempNode = {
   enabled: boolean
   originalServer?: string // 保存原始服务器地址，用于回退
   tag?: string
+  sourceUrl?: string // 从订阅导入时的订阅地址
   isSaved?: boolean
   dbId?: number
   dbNode?: ParsedNode
@@ -961,7 +964,8 @@ function NodesPage() {
       const result = await api.post('/api/admin/tcping', {
         host: node.parsed.server,
         port: node.parsed.port,
-        timeout: 5000
+        timeout: 5000,
+        node_id: node.isSaved ? node.dbId : undefined, // 已保存节点的检测结果用于订阅来源可靠性评分
       })
 
       setTcpingResults(prev => ({
@@ -1023,7 +1027,8 @@ function NodesPage() {
       const requests = selectedNodes.map(node => ({
         host: node.parsed!.server,
         port: node.parsed!.port,
-        timeout: 5000
+        timeout: 5000,
+        node_id: node.dbId,
       }))
 
       const result = await api.post('/api/admin/tcping/batch', requests)
@@ -1153,9 +1158,9 @@ function NodesPage() {
   // 批量创建节点
   const batchCreateMutation = useMutation({
     mutationFn: async (nodes: TempNode[]) => {
-      // 根据当前标签类型使用对应的自定义标签
+      // 根据当前标签类型使用对应的自定义标签；手动输入未填写标签时由后端按自动标签规则和默认标签补全
       const tag = currentTag === 'manual'
-        ? (manualTag.trim() || '手动输入')
+        ? manualTag.trim()
         : (subscriptionTag.trim() || '订阅导入')
 
       const payload = nodes.map(n => ({
@@ -1166,6 +1171,7 @@ function NodesPage() {
         clash_config: n.clash ? JSON.stringify(cloneProxyWithName(n.clash, n.name)) : '',
         enabled: n.enabled,
         tag: tag,
+        source_url: n.sourceUrl || '',
       }))
 
       const response = await api.post('/api/admin/nodes/batch', { nodes: payload })
@@ -1734,6 +1740,7 @@ function NodesPage() {
             return {
               id: Math.random().toString(36).substring(7),
               rawUrl: uri,
+              sourceUrl: variables.url,
               name,
               parsed: normalizedParsed,
               clash: normalizedClash,
@@ -1759,6 +1766,7 @@ function NodesPage() {
           return {
             id: Math.random().toString(36).substring(7),
             rawUrl: variables.url,
+            sourceUrl: variables.url,
             name,
             parsed: parsedProxy,
             clash: clashProxy,
@@ -88,6 +88,49 @@ type ExternalSubscription = {
   traffic_mode: 'download' | 'upload' | 'both'
   created_at: string
   updated_at: string
+  reliability?: ExternalSubscriptionReliability
+}
+
+// 外部订阅可靠性评分：节点变动率、死节点比例、同步失败率
+type ExternalSubscriptionReliability = {
+  score: number
+  has_data: boolean
+  churn_rate: number
+  dead_ratio: number
+  checked_nodes: number
+  dead_nodes: number
+  sync_runs: number
+  sync_failures: number
+  failure_rate: number
+  last_error?: string
+}
+
+const formatPercent = (value: number) => `${Math.round(value * 100)}%`
+
+function ReliabilityBadge({ reliability }: { reliability?: ExternalSubscriptionReliability }) {
+  if (!reliability?.has_data) {
+    return <span className='text-sm text-muted-foreground'>-</span>
+  }
+  const color = reliability.score >= 80
+    ? 'bg-green-500/10 text-green-700 dark:text-green-400'
+    : reliability.score >= 60
+      ? 'bg-yellow-500/10 text-yellow-700 dark:text-yellow-400'
+      : 'bg-red-500/10 text-red-700 dark:text-red-400'
+  return (
+    <Tooltip>
+      <TooltipTrigger asChild>
+        <Badge variant='outline' className={`cursor-help ${color}`}>{reliability.score}</Badge>
+      </TooltipTrigger>
+      <TooltipContent>
+        <div className='space-y-1 text-xs'>
+          <div>节点变动率: {formatPercent(reliability.churn_rate)}</div>
+          <div>死节点: {reliability.dead_nodes}/{reliability.checked_nodes} ({formatPercent(reliability.dead_ratio)})</div>
+          <div>同步失败: {reliability.sync_failures}/{reliability.sync_runs} ({formatPercent(reliability.failure_rate)})</div>
+          {reliability.last_error && <div className='max-w-xs break-all'>最近失败: {reliability.last_error}</div>}
+        </div>
+      </TooltipContent>
+    </Tooltip>
+  )
 }
 
 type ProxyProviderConfig = {
@@ -2997,6 +3040,12 @@ function SubscribeFilesPage() {
                         <span className='text-sm text-muted-foreground'>-</span>
                       )
                     },
+                    {
+                      header: '可靠性',
+                      cell: (sub) => <ReliabilityBadge reliability={sub.reliability} />,
+                      headerClassName: 'text-center',
+                      cellClassName: 'text-center',
+                    },
                     {
                       header: '最后同步',
                       cell: (sub) => (
@@ -3243,6 +3292,10 @@ function SubscribeFilesPage() {
                         label: '到期',
                         value: (sub) => sub.expire ? dateFormatter.format(new Date(sub.expire)) : '-'
                       },
+                      {
+                        label: '可靠性',
+                        value: (sub) => <ReliabilityBadge reliability={sub.reliability} />
+                      },
                       {
                         label: '最后同步',
                         value: (sub) => sub.last_sync_at ? dateFormatter.format(new Date(sub.last_sync_at)) : '-'
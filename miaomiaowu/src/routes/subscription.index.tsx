@@ -91,6 +91,7 @@ const ICON_MAP: Record<string, any> = {
 // Client types configuration with icons and names
 const CLIENT_TYPES = [
   { type: 'clash', name: 'Clash', icon: clashIcon },
+  { type: 'mihomo-provider', name: 'Mihomo (Provider)', icon: clashIcon },
   { type: 'stash', name: 'Stash', icon: stashIcon },
   { type: 'shadowrocket', name: 'Shadowrocket', icon: shadowrocketIcon },
   { type: 'surfboard', name: 'Surfboard', icon: surfboardIcon },
@@ -99,9 +100,11 @@ const CLIENT_TYPES = [
   { type: 'clash-to-surge', name: 'Clash→Surge', icon: surgeIcon },
   { type: 'loon', name: 'Loon', icon: loonIcon },
   { type: 'qx', name: 'QuantumultX', icon: quanxIcon },
+  { type: 'quantumult', name: 'Quantumult', icon: quanxIcon },
   { type: 'egern', name: 'Egern', icon: egernIcon },
   { type: 'sing-box', name: 'sing-box', icon: singboxIcon },
   { type: 'v2ray', name: 'V2Ray', icon: v2rayIcon },
+  { type: 'xray', name: 'Xray', icon: v2rayIcon },
   { type: 'uri', name: 'URI', icon: uriIcon },
 ] as const
 